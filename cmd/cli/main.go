@@ -27,6 +27,8 @@ import (
 
 	clihandler "github.com/RockX-SG/frost-dkg-demo/internal/cli"
 	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/resolver"
+	"github.com/bloxapp/ssv-spec/types"
 	"github.com/urfave/cli/v2"
 )
 
@@ -34,21 +36,66 @@ const serviceName = "cli"
 
 var version string
 
+func init() {
+	types.InitBLS()
+}
+
 func main() {
+	// outbound host names resolve with the static hosts and DoH resolver in DKG_HOSTS, DKG_DOH_URL...
+	resolution, err := resolver.ConfigFromEnv("DKG")
+	if err != nil {
+		log.Print(err)
+		os.Exit(clihandler.ExitValidation)
+	}
+	resolver.Install(resolution)
+
 	h := clihandler.New(logger.New(serviceName))
 	app := &cli.App{
 		Name:  "rockx-dkg-cli",
 		Usage: "Perform DKG (Keygen & Resharing) and generating SSV compatible output",
-		Commands: []*cli.Command{
+		Commands: clihandler.WithExitCodes([]*cli.Command{
 			h.CommandKeygen(),
 			h.CommandResharing(),
+			h.CommandPlanResharing(),
+			h.CommandResharingBatch(),
+			h.CommandBuildInit(),
+			h.CommandSendInit(),
+			h.CommandCoordinatorApprove(),
+			h.CommandCoordinatorAssemble(),
 			h.CommandGetDKGResults(),
+			h.CommandStatus(),
+			h.CommandHistory(),
+			h.CommandReconcileResults(),
 			h.CommandGenerateDepositData(),
+			h.CommandResignDeposit(),
 			h.CommandGetKeyshares(),
-		},
+			h.CommandExportResult(),
+			h.CommandRegisterSSV(),
+			h.CommandDecrypt(),
+			h.CommandBLSToExecutionChange(),
+			h.CommandSignMessage(),
+			h.CommandHandover(),
+			h.CommandRecoveryRequest(),
+			h.CommandRecoveryApprove(),
+			h.CommandRecoverShare(),
+			h.CommandAddressBook(),
+			h.CommandDenylist(),
+			h.CommandServe(),
+			h.CommandMessengerStatus(),
+			h.CommandInspect(),
+			h.CommandNodeList(),
+			h.CommandTelemetryPreview(),
+			h.CommandLineage(),
+			h.CommandReport(),
+			h.CommandCheckCommittee(),
+			h.CommandVerifyTranscript(),
+			h.CommandVerifyArtifact(),
+			h.CommandVerifyOutput(),
+		}),
 		Version: version,
 	}
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		os.Exit(clihandler.ExitCode(err))
 	}
 }
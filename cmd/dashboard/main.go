@@ -0,0 +1,54 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// dashboard writes the grafana dashboard of the ceremony metrics of the nodes
+// and the messenger, to stdout or the file given with -o
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/stats"
+)
+
+func main() {
+	output := flag.String("o", "", "file to write the dashboard to, stdout when empty")
+	flag.Parse()
+
+	data, err := json.MarshalIndent(stats.NewDashboard(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode dashboard: %v\n", err)
+		os.Exit(1)
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*output, data, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write dashboard: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/bench"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+func main() {
+	cfg := bench.DefaultConfig()
+	flags := flag.NewFlagSet("dkgbench", flag.ExitOnError)
+	flags.StringVar(&cfg.MessengerAddr, "messenger", cfg.MessengerAddr, "messenger address, defaults to MESSENGER_SRV_ADDR")
+	flags.IntVar(&cfg.Ceremonies, "ceremonies", cfg.Ceremonies, "number of concurrent ceremonies")
+	flags.IntVar(&cfg.Operators, "operators", cfg.Operators, "number of mock operator nodes")
+	flags.IntVar(&cfg.Committee, "committee", cfg.Committee, "operators per ceremony")
+	flags.IntVar(&cfg.Rounds, "rounds", cfg.Rounds, "messages every operator publishes per ceremony")
+	flags.IntVar(&cfg.PayloadBytes, "payload", cfg.PayloadBytes, "commitment bytes per message")
+	flags.StringVar(&cfg.ListenHost, "listen", cfg.ListenHost, "host the mock nodes listen on, must be reachable from the messenger")
+	firstID := flags.Uint64("first-operator-id", uint64(cfg.FirstOperatorID), "id of the first mock operator, keep clear of real operators")
+	flags.DurationVar(&cfg.Drain, "drain", cfg.Drain, "how long to wait for deliveries after the last publish")
+	asJSON := flags.Bool("json", false, "print the report as json")
+	_ = flags.Parse(os.Args[1:])
+	cfg.FirstOperatorID = types.OperatorID(*firstID)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := bench.Run(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dkgbench: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "dkgbench: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	printReport(report)
+}
+
+func printReport(r *bench.Report) {
+	fmt.Printf("ceremonies:        %d\n", r.Ceremonies)
+	fmt.Printf("elapsed:           %s\n", r.Elapsed)
+	fmt.Printf("published:         %d (%d failed)\n", r.Published, r.PublishFailures)
+	fmt.Printf("delivered:         %d of %d (%d duplicates)\n", r.Delivered, r.Expected, r.Duplicates)
+	fmt.Printf("failure rate:      %.2f%%\n", 100*r.FailureRate())
+	if r.Elapsed > 0 {
+		fmt.Printf("delivery rate:     %.0f msg/s\n", float64(r.Delivered)/r.Elapsed.Seconds())
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\tcount\tmin\tmean\tp50\tp90\tp99\tmax\t")
+	for _, row := range []struct {
+		name  string
+		stats bench.Stats
+	}{
+		{"publish", r.PublishLatency},
+		{"delivery", r.DeliveryLatency},
+		{"fan-out", r.FanOut},
+	} {
+		s := row.stats
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n", row.name, s.Count, s.Min, s.Mean, s.P50, s.P90, s.P99, s.Max)
+	}
+	w.Flush()
+}
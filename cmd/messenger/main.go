@@ -22,15 +22,24 @@
 package main
 
 import (
+	"crypto/rsa"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
 	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
 	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/middleware"
 	"github.com/RockX-SG/frost-dkg-demo/internal/ping"
+	"github.com/RockX-SG/frost-dkg-demo/internal/stats"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
 	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
+	"github.com/bloxapp/ssv-spec/types"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -38,24 +47,90 @@ const serviceName = "messenger"
 
 var version string
 
+// publicPaths are left to probes and to the replication api, which checks its own token
+var publicPaths = []string{"/ping", "/metrics", "/version", "/limits", "/relay_key", "/openapi.json", "/replication/*", messenger.PublicResultsPath + "/*"}
+
 func main() {
 	log := logger.New(serviceName)
 
 	m := &messenger.Messenger{
 		Topics: map[string]*messenger.Topic{
-			messenger.DefaultTopic: {
-				Name:        messenger.DefaultTopic,
-				Subscribers: make(map[string]*messenger.Subscriber),
-			},
+			messenger.DefaultTopic: messenger.NewTopic(messenger.DefaultTopic),
 		},
-		Incoming: make(chan *messenger.Message, 50),
-		Data:     make(map[string]*messenger.DataStore),
+		Incoming:       make(chan *messenger.Message, messenger.IncomingQueueSize),
+		UrgentIncoming: make(chan *messenger.Message, messenger.IncomingQueueSize),
+		Data:           make(map[string]*messenger.DataStore),
 	}
 	m.WithLogger(log)
+	limits, err := limitsFromEnv()
+	if err != nil {
+		log.Fatalf("Main: %s", err.Error())
+	}
+	m.Limits = limits
+	relayKey, err := messenger.RelayKeyFromEnv()
+	if err != nil {
+		log.Fatalf("Main: %s", err.Error())
+	}
+	m.RelayKey = relayKey
+	webhookAllow, err := messenger.WebhookAllowFromEnv()
+	if err != nil {
+		log.Fatalf("Main: %s", err.Error())
+	}
+	m.WebhookAllow = webhookAllow
+	sessions, err := sessionsFromEnv()
+	if err != nil {
+		log.Fatalf("Main: %s", err.Error())
+	}
+	if sessions == nil {
+		log.Warnf("Main: MESSENGER_SESSIONS=off, publishes, streams and registrations are open to anyone")
+	}
+	m.Sessions = sessions
+	faults, err := faultsFromEnv()
+	if err != nil {
+		log.Fatalf("Main: %s", err.Error())
+	}
+	if faults != nil {
+		log.Warnf("Main: MESSENGER_FAULTS is set, deliveries to the nodes are disturbed for testing: %s", faults)
+		prometheus.MustRegister(faults.Collectors()...)
+	}
+	m.Faults = faults
+	m.Stats = stats.NewRecorder(stats.DefaultRecorderSize)
+	m.Stats.Metrics = stats.NewMetrics(serviceName)
+	prometheus.MustRegister(m.Stats.Metrics.Collectors()...)
+
+	logSize := messenger.DefaultReplicationLogSize
+	if value := os.Getenv("MESSENGER_REPLICATION_LOG"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			log.Fatalf("Main: invalid MESSENGER_REPLICATION_LOG %q", value)
+		}
+		logSize = size
+	}
+	token := os.Getenv("MESSENGER_REPLICATION_TOKEN")
 
 	runner := workers.NewRunner(log)
 	go runner.Run()
 
+	// a standby tails the primary and keeps its own log only once promoted
+	var standby *messenger.Standby
+	if primary := os.Getenv("MESSENGER_STANDBY_OF"); primary != "" {
+		client := messenger.NewMessengerClient(primary)
+		client.Token = token
+		standby = messenger.NewStandby(m, client, runner, log)
+		standby.LogSize = logSize
+		if value := os.Getenv("MESSENGER_PROMOTE_AFTER"); value != "" {
+			promoteAfter, err := time.ParseDuration(value)
+			if err != nil {
+				log.Fatalf("Main: invalid MESSENGER_PROMOTE_AFTER %q: %s", value, err.Error())
+			}
+			standby.PromoteAfter = promoteAfter
+		}
+		prometheus.MustRegister(standby.Collectors()...)
+		standby.Start()
+	} else if logSize > 0 {
+		m.Replication = messenger.NewReplicationLog(logSize)
+	}
+
 	runner.AddJob(&workers.Job{
 		ID: fmt.Sprintf("TOPIC__%s", messenger.DefaultTopic),
 		Fn: m.ProcessIncomingMessageWorker,
@@ -66,32 +141,72 @@ func main() {
 		messengerAddr = "0.0.0.0:3000"
 	}
 
-	r := gin.Default()
-	r.Use(logger.GinLogger(log))
+	config, err := middleware.ConfigFromEnv("MESSENGER", publicPaths)
+	if err != nil {
+		log.Fatalf("Main: %s", err.Error())
+	}
+	stack, err := middleware.NewStack(serviceName, config, log)
+	if err != nil {
+		log.Fatalf("Main: %s", err.Error())
+	}
+	prometheus.MustRegister(stack.Collectors()...)
+	publicLimiter, err := publicLimiterFromEnv()
+	if err != nil {
+		log.Fatalf("Main: %s", err.Error())
+	}
+
+	r := stack.Engine()
+	r.Use(m.LimitBody())
+	if standby != nil {
+		r.Use(standby.Guard())
+	}
 	setRoutes(r, m, runner)
+	setReplicationRoutes(r, m, standby, token)
+	r.GET(messenger.PublicResultsPath+"/:request_id", publicLimiter.Handler(), m.HandlePublicResult())
 
-	panic(r.Run(messengerAddr))
+	panic(stack.Run(r, middleware.ListenAddrs(messengerAddr)...))
 }
 
 func setRoutes(r *gin.Engine, m *messenger.Messenger, runner *workers.Runner) {
 
 	r.GET("/ping", ping.HandlePing)
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/openapi.json", m.HandleOpenAPISpec())
+	r.GET("/limits", m.HandleLimits())
+	r.GET("/stats", m.HandleStats())
+	r.GET(messenger.RelayKeyPath, m.HandleRelayKey())
 
 	// CRUD APIs for Topics
 	r.GET("/topics", m.GetTopics())
 	r.POST("/topics", m.HandleCreateTopic())
 	r.GET("/topics/:topic_name", m.GetTopic())
 	r.DELETE("/topics/:topic_name", m.DeleteTopic())
+	r.POST("/topics/:topic_name/sync", m.RequireSession(), m.HandleSyncTopic())
+	r.GET("/topics/:topic_name/outputs", m.HandleTopicOutputs())
+	r.GET("/topics/:topic_name/partials", m.HandleTopicPartials())
+	r.GET("/topics/:topic_name/progress", m.HandleTopicProgress())
+	r.POST("/topics/:topic_name/sealed", m.HandlePublishSealed())
+	r.POST("/topics/:topic_name/start", m.HandlePublishStart())
+
+	// Webhooks of external systems following the ceremony of a topic
+	r.POST("/topics/:topic_name/webhooks", m.HandleAddWebhook())
+	r.GET("/topics/:topic_name/webhooks", m.HandleListWebhooks())
+	r.DELETE("/topics/:topic_name/webhooks/:id", m.HandleDeleteWebhook())
+
+	// Sessions of the operator nodes
+	r.POST(messenger.SessionChallengePath, m.HandleSessionChallenge())
+	r.POST(messenger.SessionPath, m.HandleOpenSession())
 
 	// Register a node
-	r.POST("/register_node", m.HandleNodeRegistration(runner))
+	r.POST("/register_node", m.RequireSession(), m.HandleNodeRegistration(runner))
 
 	// DKG network implementation
-	r.POST("/publish", m.HandlePublish())
-	r.POST("/stream/dkgoutput", m.HandleStreamDKGOutput())
-	r.POST("/stream/dkgblame", m.HandleStreamDKGBlame())
+	r.POST("/publish", m.RequireSession(), m.HandlePublish())
+	r.POST("/stream/dkgoutput", m.RequireSession(), m.HandleStreamDKGOutput())
+	r.POST("/stream/dkgblame", m.RequireSession(), m.HandleStreamDKGBlame())
 	r.GET("/data/:request_id", m.HandleGetData())
+	r.GET("/data/:request_id/outputs", m.HandleDataOutputs())
+	r.GET("/data/:request_id/blames", m.HandleDataBlames())
 
 	r.GET("/version", func(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gin.H{
@@ -99,3 +214,124 @@ func setRoutes(r *gin.Engine, m *messenger.Messenger, runner *workers.Runner) {
 		})
 	})
 }
+
+func setReplicationRoutes(r *gin.Engine, m *messenger.Messenger, standby *messenger.Standby, token string) {
+	r.GET("/replication/status", m.HandleReplicationStatus())
+
+	replication := r.Group("/replication", messenger.ReplicationAuth(token))
+	replication.GET("/changes", m.HandleReplicationChanges())
+	replication.GET("/snapshot", m.HandleReplicationSnapshot())
+	if standby != nil {
+		replication.POST("/promote", standby.HandlePromote())
+	}
+}
+
+// sessionsFromEnv reads MESSENGER_SESSIONS and MESSENGER_SESSION_TTL. Nodes
+// need a session unless MESSENGER_SESSIONS is off, left for benchmarks and
+// nodes older than sessions.
+func sessionsFromEnv() (*messenger.Sessions, error) {
+	switch value := os.Getenv("MESSENGER_SESSIONS"); value {
+	case "", "on":
+	case "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid MESSENGER_SESSIONS %q, expected on or off", value)
+	}
+	ttl := messenger.DefaultSessionTTL
+	if value := os.Getenv("MESSENGER_SESSION_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid MESSENGER_SESSION_TTL %q", value)
+		}
+		ttl = parsed
+	}
+	return messenger.NewSessions(operatorKey, ttl), nil
+}
+
+// operatorKey is the registry key of an operator, nodes sign their session
+// challenge with it
+func operatorKey(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+	operator, err := storage.FetchOperatorByID(operatorID)
+	if err != nil {
+		return nil, err
+	}
+	return operator.EncryptionPubKey, nil
+}
+
+// faultsFromEnv reads MESSENGER_FAULTS, MESSENGER_FAULTS_SEED and
+// MESSENGER_FAULTS_MAX_DELAY, the fault injection test mode is off without
+// MESSENGER_FAULTS. Without a seed one is picked and logged to run it again.
+func faultsFromEnv() (*messenger.Faults, error) {
+	spec := os.Getenv("MESSENGER_FAULTS")
+	if spec == "" {
+		return nil, nil
+	}
+	seed := time.Now().UnixNano()
+	if value := os.Getenv("MESSENGER_FAULTS_SEED"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MESSENGER_FAULTS_SEED %q", value)
+		}
+		seed = parsed
+	}
+	var maxDelay time.Duration
+	if value := os.Getenv("MESSENGER_FAULTS_MAX_DELAY"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid MESSENGER_FAULTS_MAX_DELAY %q", value)
+		}
+		maxDelay = parsed
+	}
+	return messenger.ParseFaults(spec, seed, maxDelay)
+}
+
+// publicLimiterFromEnv reads MESSENGER_PUBLIC_RATE_LIMIT and
+// MESSENGER_PUBLIC_RATE_BURST, the rate limit of the public results on top of
+// MESSENGER_RATE_LIMIT, which deployments with authentication often leave off
+func publicLimiterFromEnv() (*middleware.RateLimiter, error) {
+	limit, burst := 1.0, 10
+	if value := os.Getenv("MESSENGER_PUBLIC_RATE_LIMIT"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid MESSENGER_PUBLIC_RATE_LIMIT %q", value)
+		}
+		limit = parsed
+	}
+	if value := os.Getenv("MESSENGER_PUBLIC_RATE_BURST"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid MESSENGER_PUBLIC_RATE_BURST %q", value)
+		}
+		burst = parsed
+	}
+	return middleware.NewRateLimiter(limit, burst), nil
+}
+
+// limitsFromEnv reads MESSENGER_MAX_OPERATORS, MESSENGER_MAX_MESSAGE_BYTES and
+// MESSENGER_MAX_BATCH_SIZE, the defaults for those not set
+func limitsFromEnv() (ceremony.Limits, error) {
+	limits := ceremony.DefaultLimits
+	counts := map[string]*int{
+		"MESSENGER_MAX_OPERATORS":  &limits.MaxOperators,
+		"MESSENGER_MAX_BATCH_SIZE": &limits.MaxBatchSize,
+	}
+	for env, count := range counts {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return limits, fmt.Errorf("invalid %s %q", env, value)
+		}
+		*count = parsed
+	}
+	if value := os.Getenv("MESSENGER_MAX_MESSAGE_BYTES"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			return limits, fmt.Errorf("invalid MESSENGER_MAX_MESSAGE_BYTES %q", value)
+		}
+		limits.MaxMessageBytes = parsed
+	}
+	return limits, nil
+}
@@ -22,12 +22,29 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"crypto/rsa"
 	"encoding/base64"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/middleware"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/quota"
+	"github.com/RockX-SG/frost-dkg-demo/internal/sandbox"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/telemetry"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
 	"github.com/bloxapp/ssv-spec/types"
 )
 
@@ -35,22 +52,311 @@ type AppParams struct {
 	OperatorID         types.OperatorID
 	HttpAddress        string
 	OperatorPrivateKey *rsa.PrivateKey
+	PhaseTimeouts      ceremony.PhaseTimeouts
+
+	// StorageBackend is badger (default) or postgres, failover needs postgres
+	StorageBackend string
+	// DataDir is the badger directory
+	DataDir     string
+	PostgresDSN string
+	// StoragePassphrase encrypts the stored values, StorageOldPassphrase
+	// still reads the values of an unfinished rekey-storage run
+	StoragePassphrase    string
+	StorageOldPassphrase string
+	Failover             bool
+	InstanceID           string
+	LeaseTTL             time.Duration
+
+	// ResendInterval and ResendRetries bound how missing round messages are re-requested from peers
+	ResendInterval time.Duration
+	ResendRetries  int
+
+	// ProcessConcurrency bounds the messages processed at once, the ones of
+	// ceremonies started with priority=urgent get a free slot first
+	ProcessConcurrency int
+	// OverloadQueueDepth is the number of messages waiting for a slot from
+	// which /health reports the node overloaded, 0 never does
+	OverloadQueueDepth int
+
+	// Coordinators, when set, must approve every keygen and resharing start message
+	Coordinators *coordinator.Set
+	// KeySignDomains is the allowlist of signing domain tags for keysign requests
+	KeySignDomains *signing.Policy
+	// KeySignUsage restricts what the key shares sign, globally and per validator
+	KeySignUsage *signing.UsagePolicy
+
+	// OperatorCache is how long operators fetched from the ssv registry are trusted
+	OperatorCache store.OperatorCachePolicy
+
+	// DiskQuota bounds the badger database and the free space it leaves on disk
+	DiskQuota quota.Config
+
+	// MemoryBudget bounds the message cache, the processing queue and the
+	// runner state of the ceremonies
+	MemoryBudget node.MemoryBudget
+
+	// Retention is how long the state of ended ceremonies is kept
+	Retention node.RetentionPolicy
+
+	// Outbox is how long messages the messenger refused are retried
+	Outbox node.OutboxPolicy
+
+	// Telemetry reports anonymized ceremony statistics when opted in
+	Telemetry telemetry.Config
+
+	// Limits bound the ceremonies and requests the node accepts
+	Limits ceremony.Limits
+
+	// Middleware authenticates and rate limits the api
+	Middleware middleware.Config
+
+	// RequireRelaySignature rejects deliveries the messenger didn't sign
+	RequireRelaySignature bool
+	// RelayKeys pin the keys of the messenger, fetched from it when empty
+	RelayKeys []ed25519.PublicKey
+	// RelayMaxAge bounds the clock skew and delay of a signed delivery
+	RelayMaxAge time.Duration
+
+	// MinProtocolVersion is the oldest protocol version of keygens and
+	// resharings the node takes part in
+	MinProtocolVersion uint32
+	// RequireManifest refuses keygens and resharings started without a signed manifest
+	RequireManifest bool
+	// InitSigning lets initiators without an operator key have this node
+	// sign and publish the start messages of ceremonies it is part of
+	InitSigning bool
+	// ReconcilePolicy settles the ceremonies left open when the node starts
+	ReconcilePolicy node.ReconcilePolicy
+	// ReshareCheck is what the node does with reshare messages its share doesn't back
+	ReshareCheck node.ReshareCheck
+	// ReshareInterval is the least time between two resharings of a
+	// validator, unlimited when zero; ReshareOverrideApprovals coordinators
+	// approving a reshare message lift it
+	ReshareInterval          time.Duration
+	ReshareOverrideApprovals int
+
+	// CeremonyLogs, when set, tees the log entries of each ceremony into a
+	// file of its own in the data directory
+	CeremonyLogs *logger.CeremonyLogConfig
+
+	// Sandbox is the user the node drops to and the landlock and seccomp
+	// profiles confining it
+	Sandbox sandbox.Config
+
+	// UpgradeSocket is where the node hands over to a new binary,
+	// UpgradeTimeout bounds the start of the new process and
+	// UpgradeDrainTimeout the ceremonies the old one still finishes
+	UpgradeSocket       string
+	UpgradeTimeout      time.Duration
+	UpgradeDrainTimeout time.Duration
+}
+
+// publicNodePaths are reached by the messenger and peers, or by probes; the
+// messages on them are signed by operator keys
+var publicNodePaths = []string{
+	"/ping", "/health", "/metrics", "/version", "/limits", "/capabilities", "/config", "/failover",
+	"/consume", messenger.SealedStartPath, messenger.RelayedStartPath, "/resend",
+}
+
+// allowlistGroups are the paths NODE_ALLOW_PEER, NODE_ALLOW_ADMIN and
+// NODE_ALLOW_METRICS restrict to client networks: the start messages,
+// resends and results of the messenger, the cli and peers, the operator's own
+// endpoints, among them the ones signing with the operator key, and the
+// metrics scrape. Every route is in a group or in publicNodePaths.
+var allowlistGroups = map[string][]string{
+	"peer": {"/consume", messenger.SealedStartPath, messenger.RelayedStartPath, "/resend", "/dkg_results/*"},
+	"admin": {
+		"/init/sign", "/observe", "/observe/*", "/ceremonies", "/ceremonies/*", "/retention/*", "/handover/*", "/recovery/*",
+		"/telemetry/*", "/shares", "/lineage/*", "/usage/*", "/stats",
+	},
+	"metrics": {"/metrics"},
+}
+
+// defaultAdminAllowlist keeps the admin group, which signs with the operator
+// key, to this host when neither NODE_ALLOW_ADMIN nor NODE_AUTH is set
+func defaultAdminAllowlist() []middleware.Allowlist {
+	if os.Getenv("NODE_ALLOW_ADMIN") != "" || os.Getenv("NODE_AUTH") != "" {
+		return nil
+	}
+	loopback, _ := middleware.ParseNetworks([]string{"127.0.0.0/8", "::1"})
+	return []middleware.Allowlist{{Group: "admin", Paths: allowlistGroups["admin"], Networks: loopback}}
 }
 
 func (params *AppParams) loadFromEnv() error {
 	params.loadOperatorID()
 	params.loadHttpAddress()
+	if err := params.loadPhaseTimeouts(); err != nil {
+		return err
+	}
+	if err := params.loadStorage(); err != nil {
+		return err
+	}
+	if err := params.loadResend(); err != nil {
+		return err
+	}
+	if err := params.loadProcessConcurrency(); err != nil {
+		return err
+	}
+	if err := params.loadCoordinators(); err != nil {
+		return err
+	}
+	params.KeySignDomains = signing.ParsePolicy(os.Getenv("NODE_KEYSIGN_DOMAINS"))
+	usage, err := signing.LoadUsagePolicy(os.Getenv("NODE_KEYSIGN_USAGE"), os.Getenv("NODE_KEYSIGN_USAGE_FILE"))
+	if err != nil {
+		return err
+	}
+	params.KeySignUsage = usage
+	if err := params.loadOperatorCache(); err != nil {
+		return err
+	}
+	if err := params.loadDiskQuota(); err != nil {
+		return err
+	}
+	if err := params.loadMemoryBudget(); err != nil {
+		return err
+	}
+	if err := params.loadRetention(); err != nil {
+		return err
+	}
+	if err := params.loadOutbox(); err != nil {
+		return err
+	}
+	if err := params.loadTelemetry(); err != nil {
+		return err
+	}
+	if err := params.loadLimits(); err != nil {
+		return err
+	}
+	if err := params.loadRelay(); err != nil {
+		return err
+	}
+	if err := params.loadMinProtocolVersion(); err != nil {
+		return err
+	}
+	params.RequireManifest = os.Getenv("NODE_REQUIRE_MANIFEST") == "true"
+	params.InitSigning = os.Getenv("NODE_INIT_SIGNING") == "true"
+	policy, err := node.ParseReconcilePolicy(os.Getenv("NODE_RECONCILE_POLICY"))
+	if err != nil {
+		return err
+	}
+	params.ReconcilePolicy = policy
+	reshareCheck, err := node.ParseReshareCheck(os.Getenv("NODE_RESHARE_CHECK"))
+	if err != nil {
+		return err
+	}
+	params.ReshareCheck = reshareCheck
+	if err := params.loadReshareRate(); err != nil {
+		return err
+	}
+	middlewareConfig, err := middleware.ConfigFromEnv("NODE", publicNodePaths)
+	if err != nil {
+		return err
+	}
+	params.Middleware = middlewareConfig
+	if params.Middleware.Allowlists, err = middleware.AllowlistsFromEnv("NODE", allowlistGroups); err != nil {
+		return err
+	}
+	params.Middleware.Allowlists = append(params.Middleware.Allowlists, defaultAdminAllowlist()...)
+	if err := params.loadCeremonyLogs(); err != nil {
+		return err
+	}
+	if err := params.loadUpgrade(); err != nil {
+		return err
+	}
+	if err := params.loadSandbox(); err != nil {
+		return err
+	}
 	return params.loadOperatorPrivateKey()
 }
 
 func (params *AppParams) print() string {
 	return fmt.Sprintf(
-		"operatorID=%d http_addr=%s",
+		"operatorID=%d http_addr=%s phase_timeouts=%+v storage=%s storage_encrypted=%t process_concurrency=%d overload_queue_depth=%d failover=%t instance=%s coordinators=%s keysign_domains=%s keysign_usage=%s operator_ttl=%s operator_stale=%s db_max_size=%d db_min_free=%d memory_budget=%+v retention=%+v outbox=%s telemetry=%s limits=%+v require_relay_signature=%t relay_keys=%d min_protocol_version=%d require_manifest=%t init_signing=%t reconcile_policy=%s reshare_check=%s reshare_interval=%s reshare_override_approvals=%d allowlists=%v ceremony_logs=%s sandbox=%s upgrade_socket=%s upgrade_drain_timeout=%s",
 		params.OperatorID,
 		params.HttpAddress,
+		params.PhaseTimeouts,
+		params.StorageBackend,
+		params.StoragePassphrase != "",
+		params.ProcessConcurrency,
+		params.OverloadQueueDepth,
+		params.Failover,
+		params.InstanceID,
+		params.coordinatorsString(),
+		params.KeySignDomains,
+		params.keySignUsageString(),
+		params.OperatorCache.TTL,
+		params.OperatorCache.StaleWhileRevalidate,
+		params.DiskQuota.MaxBytes,
+		params.DiskQuota.MinFreeBytes,
+		params.MemoryBudget,
+		params.Retention,
+		params.Outbox,
+		params.Telemetry,
+		params.Limits,
+		params.RequireRelaySignature,
+		len(params.RelayKeys),
+		params.MinProtocolVersion,
+		params.RequireManifest,
+		params.InitSigning,
+		params.ReconcilePolicy,
+		params.ReshareCheck,
+		params.ReshareInterval,
+		params.ReshareOverrideApprovals,
+		params.Middleware.Allowlists,
+		params.ceremonyLogsString(),
+		&params.Sandbox,
+		params.UpgradeSocket,
+		params.UpgradeDrainTimeout,
 	)
 }
 
+func (params *AppParams) keySignUsageString() string {
+	if params.KeySignUsage == nil {
+		return "unrestricted"
+	}
+	return params.KeySignUsage.String()
+}
+
+func (params *AppParams) ceremonyLogsString() string {
+	if params.CeremonyLogs == nil {
+		return "off"
+	}
+	return fmt.Sprintf("%s max_size=%d files=%d retention=%s",
+		params.CeremonyLogs.Dir, params.CeremonyLogs.MaxBytes, params.CeremonyLogs.MaxFiles, params.CeremonyLogs.Retention)
+}
+
+// advertisedConfig is what the node serves on /config for committee checks
+func (params *AppParams) advertisedConfig(capabilities *messengerclient.Capabilities, signedDeliveries bool) *node.AdvertisedConfig {
+	spec, backend := node.BuildVersions()
+	return &node.AdvertisedConfig{
+		OperatorID:    params.OperatorID,
+		Version:       version,
+		SpecVersion:   spec,
+		Network:       string(types.PrimusTestnet),
+		CryptoBackend: backend,
+		PhaseTimeouts: params.PhaseTimeouts,
+		Limits:        params.Limits.OrDefault(),
+		Capabilities:  capabilities,
+		Features: map[string]string{
+			"coordinator_approvals":   params.coordinatorsString(),
+			"require_manifest":        strconv.FormatBool(params.RequireManifest),
+			"init_signing":            strconv.FormatBool(params.InitSigning),
+			"telemetry":               strconv.FormatBool(params.Telemetry.Enabled),
+			"require_relay_signature": strconv.FormatBool(params.RequireRelaySignature),
+			"signed_deliveries":       strconv.FormatBool(signedDeliveries),
+			"reshare_check":           string(params.ReshareCheck),
+			"reshare_interval":        params.ReshareInterval.String(),
+		},
+	}
+}
+
+func (params *AppParams) coordinatorsString() string {
+	if params.Coordinators == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d-of-%d", params.Coordinators.Threshold(), params.Coordinators.Size())
+}
+
 func (params *AppParams) loadOperatorID() {
 	operatorID, err := strconv.ParseUint(os.Getenv("NODE_OPERATOR_ID"), 10, 32)
 	if err != nil {
@@ -67,6 +373,565 @@ func (params *AppParams) loadHttpAddress() {
 	params.HttpAddress = nodeAddr
 }
 
+// loadPhaseTimeouts reads the default phase deadlines, ceremonies can override
+// them when they start
+func (params *AppParams) loadPhaseTimeouts() error {
+	params.PhaseTimeouts = ceremony.DefaultPhaseTimeouts
+	envs := map[string]*time.Duration{
+		"NODE_TIMEOUT_INIT_ACK":  &params.PhaseTimeouts.InitAck,
+		"NODE_TIMEOUT_ROUND1":    &params.PhaseTimeouts.Round1,
+		"NODE_TIMEOUT_ROUND2":    &params.PhaseTimeouts.Round2,
+		"NODE_TIMEOUT_OUTPUT":    &params.PhaseTimeouts.Output,
+		"NODE_TIMEOUT_EXTENSION": &params.PhaseTimeouts.Extension,
+	}
+	for env, d := range envs {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", env, err)
+		}
+		*d = parsed
+	}
+	return nil
+}
+
+func (params *AppParams) loadStorage() error {
+	params.StorageBackend = os.Getenv("NODE_STORAGE")
+	if params.StorageBackend == "" {
+		params.StorageBackend = "badger"
+	}
+	if params.StorageBackend != "badger" && params.StorageBackend != "postgres" {
+		return fmt.Errorf("unknown NODE_STORAGE %s", params.StorageBackend)
+	}
+	params.DataDir = os.Getenv("NODE_DATA_DIR")
+	if params.DataDir == "" {
+		params.DataDir = "/frost-dkg-data"
+	}
+	params.PostgresDSN = os.Getenv("NODE_POSTGRES_DSN")
+	if params.StorageBackend == "postgres" && params.PostgresDSN == "" {
+		return fmt.Errorf("NODE_POSTGRES_DSN is required with postgres storage")
+	}
+	params.StoragePassphrase = os.Getenv("NODE_STORAGE_PASSPHRASE")
+	params.StorageOldPassphrase = os.Getenv("NODE_STORAGE_OLD_PASSPHRASE")
+	if params.StorageOldPassphrase != "" && params.StoragePassphrase == "" {
+		return fmt.Errorf("NODE_STORAGE_OLD_PASSPHRASE needs NODE_STORAGE_PASSPHRASE")
+	}
+
+	params.Failover = os.Getenv("NODE_FAILOVER") == "true"
+	if params.Failover && params.StorageBackend != "postgres" {
+		return fmt.Errorf("NODE_FAILOVER needs the shared postgres storage")
+	}
+
+	params.InstanceID = os.Getenv("NODE_INSTANCE_ID")
+	if params.InstanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to get hostname for instance id: %w", err)
+		}
+		params.InstanceID = hostname
+	}
+
+	params.LeaseTTL = 15 * time.Second
+	if ttl := os.Getenv("NODE_LEASE_TTL"); ttl != "" {
+		parsed, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("failed to parse NODE_LEASE_TTL: %w", err)
+		}
+		params.LeaseTTL = parsed
+	}
+	return nil
+}
+
+func (params *AppParams) loadResend() error {
+	params.ResendInterval = 30 * time.Second
+	if interval := os.Getenv("NODE_RESEND_INTERVAL"); interval != "" {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("failed to parse NODE_RESEND_INTERVAL: %w", err)
+		}
+		params.ResendInterval = parsed
+	}
+
+	params.ResendRetries = 3
+	if retries := os.Getenv("NODE_RESEND_RETRIES"); retries != "" {
+		parsed, err := strconv.Atoi(retries)
+		if err != nil {
+			return fmt.Errorf("failed to parse NODE_RESEND_RETRIES: %w", err)
+		}
+		params.ResendRetries = parsed
+	}
+	return nil
+}
+
+// loadUpgrade reads NODE_UPGRADE_SOCKET, the handover socket in the data
+// directory by default, NODE_UPGRADE_TIMEOUT, how long the new process has to
+// take over, and NODE_UPGRADE_DRAIN_TIMEOUT, how long the old one finishes
+// its ceremonies before it exits anyway
+func (params *AppParams) loadUpgrade() error {
+	params.UpgradeSocket = os.Getenv("NODE_UPGRADE_SOCKET")
+	if params.UpgradeSocket == "" {
+		params.UpgradeSocket = filepath.Join(params.DataDir, "upgrade.sock")
+	}
+	params.UpgradeTimeout = 2 * time.Minute
+	params.UpgradeDrainTimeout = time.Hour
+	envs := map[string]*time.Duration{
+		"NODE_UPGRADE_TIMEOUT":       &params.UpgradeTimeout,
+		"NODE_UPGRADE_DRAIN_TIMEOUT": &params.UpgradeDrainTimeout,
+	}
+	for env, d := range envs {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("failed to parse %s: %q isn't a positive duration", env, value)
+		}
+		*d = parsed
+	}
+	return nil
+}
+
+// loadProcessConcurrency reads NODE_PROCESS_CONCURRENCY, the messages the
+// node processes at once, one per cpu by default, and
+// NODE_OVERLOAD_QUEUE_DEPTH, the waiting messages from which the node reports
+// itself overloaded, eight per processing slot by default
+func (params *AppParams) loadProcessConcurrency() error {
+	params.ProcessConcurrency = runtime.NumCPU()
+	if value := os.Getenv("NODE_PROCESS_CONCURRENCY"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return fmt.Errorf("failed to parse NODE_PROCESS_CONCURRENCY: %q isn't a positive number", value)
+		}
+		params.ProcessConcurrency = parsed
+	}
+	params.OverloadQueueDepth = 8 * params.ProcessConcurrency
+	if value := os.Getenv("NODE_OVERLOAD_QUEUE_DEPTH"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("failed to parse NODE_OVERLOAD_QUEUE_DEPTH: %q isn't a number of messages", value)
+		}
+		params.OverloadQueueDepth = parsed
+	}
+	return nil
+}
+
+// loadOperatorCache reads NODE_OPERATOR_TTL, how long a cached registry
+// operator is used as is, and NODE_OPERATOR_STALE, how long after that it is
+// still used while it is revalidated in the background
+func (params *AppParams) loadOperatorCache() error {
+	params.OperatorCache = store.DefaultOperatorCachePolicy
+	envs := map[string]*time.Duration{
+		"NODE_OPERATOR_TTL":   &params.OperatorCache.TTL,
+		"NODE_OPERATOR_STALE": &params.OperatorCache.StaleWhileRevalidate,
+	}
+	for env, d := range envs {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", env, err)
+		}
+		*d = parsed
+	}
+	return nil
+}
+
+// loadDiskQuota reads NODE_DB_MAX_SIZE and NODE_DB_MIN_FREE, sizes like
+// 20GB, the warning thresholds NODE_DB_WARN_AT and the critical threshold
+// NODE_DB_CRITICAL_AT as fractions of the max size, and
+// NODE_DB_CHECK_INTERVAL
+func (params *AppParams) loadDiskQuota() error {
+	params.DiskQuota = quota.DefaultConfig
+	sizes := map[string]*int64{
+		"NODE_DB_MAX_SIZE": &params.DiskQuota.MaxBytes,
+		"NODE_DB_MIN_FREE": &params.DiskQuota.MinFreeBytes,
+	}
+	for env, size := range sizes {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := quota.ParseBytes(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", env, err)
+		}
+		*size = parsed
+	}
+
+	if warnAt := os.Getenv("NODE_DB_WARN_AT"); warnAt != "" {
+		params.DiskQuota.WarnAt = nil
+		for _, value := range strings.Split(warnAt, ",") {
+			parsed, err := parseFraction(value)
+			if err != nil {
+				return fmt.Errorf("failed to parse NODE_DB_WARN_AT: %w", err)
+			}
+			params.DiskQuota.WarnAt = append(params.DiskQuota.WarnAt, parsed)
+		}
+	}
+	if criticalAt := os.Getenv("NODE_DB_CRITICAL_AT"); criticalAt != "" {
+		parsed, err := parseFraction(criticalAt)
+		if err != nil {
+			return fmt.Errorf("failed to parse NODE_DB_CRITICAL_AT: %w", err)
+		}
+		params.DiskQuota.CriticalAt = parsed
+	}
+	if interval := os.Getenv("NODE_DB_CHECK_INTERVAL"); interval != "" {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("failed to parse NODE_DB_CHECK_INTERVAL: %w", err)
+		}
+		if parsed <= 0 {
+			return fmt.Errorf("NODE_DB_CHECK_INTERVAL must be positive")
+		}
+		params.DiskQuota.Interval = parsed
+	}
+	return nil
+}
+
+// loadMemoryBudget reads NODE_MEMORY_MESSAGES, NODE_MEMORY_QUEUE and
+// NODE_MEMORY_RUNNERS, sizes like 256MB, unbounded when not set
+func (params *AppParams) loadMemoryBudget() error {
+	sizes := map[string]*int64{
+		"NODE_MEMORY_MESSAGES": &params.MemoryBudget.Messages,
+		"NODE_MEMORY_QUEUE":    &params.MemoryBudget.Queue,
+		"NODE_MEMORY_RUNNERS":  &params.MemoryBudget.Runners,
+	}
+	for env, size := range sizes {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := quota.ParseBytes(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", env, err)
+		}
+		*size = parsed
+	}
+	return nil
+}
+
+// loadOutbox reads NODE_OUTBOX_RETRY_INTERVAL between two attempts to publish
+// the spooled messages and NODE_OUTBOX_MAX_AGE after which they are dropped,
+// 0 turns the outbox off
+func (params *AppParams) loadOutbox() error {
+	params.Outbox = node.DefaultOutboxPolicy
+	durations := map[string]*time.Duration{
+		"NODE_OUTBOX_RETRY_INTERVAL": &params.Outbox.RetryInterval,
+		"NODE_OUTBOX_MAX_AGE":        &params.Outbox.MaxAge,
+	}
+	for env, duration := range durations {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("failed to parse %s %q", env, value)
+		}
+		*duration = parsed
+	}
+	return nil
+}
+
+// loadRetention reads NODE_RETENTION_CEREMONIES and NODE_RETENTION_JOURNALS,
+// how long ended ceremonies and their transcripts and committee outputs are
+// kept, forever when not set, and NODE_RETENTION_INTERVAL between two sweeps
+func (params *AppParams) loadRetention() error {
+	params.Retention = node.DefaultRetentionPolicy
+	durations := map[string]*time.Duration{
+		"NODE_RETENTION_CEREMONIES": &params.Retention.Ceremonies,
+		"NODE_RETENTION_JOURNALS":   &params.Retention.Journals,
+		"NODE_RETENTION_INTERVAL":   &params.Retention.Interval,
+	}
+	for env, duration := range durations {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", env, err)
+		}
+		if parsed < 0 {
+			return fmt.Errorf("%s can't be negative", env)
+		}
+		*duration = parsed
+	}
+	if params.Retention.Interval == 0 {
+		return fmt.Errorf("NODE_RETENTION_INTERVAL must be positive")
+	}
+	return nil
+}
+
+// loadTelemetry reads NODE_TELEMETRY, off unless set to on,
+// NODE_TELEMETRY_ENDPOINT the reports are posted to and NODE_TELEMETRY_INTERVAL
+// between two reports
+func (params *AppParams) loadTelemetry() error {
+	enabled, err := telemetry.ParseMode(os.Getenv("NODE_TELEMETRY"))
+	if err != nil {
+		return fmt.Errorf("failed to parse NODE_TELEMETRY: %w", err)
+	}
+	params.Telemetry = telemetry.Config{Enabled: enabled, Endpoint: os.Getenv("NODE_TELEMETRY_ENDPOINT"), Interval: telemetry.DefaultInterval}
+	if value := os.Getenv("NODE_TELEMETRY_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse NODE_TELEMETRY_INTERVAL: %w", err)
+		}
+		params.Telemetry.Interval = interval
+	}
+	return params.Telemetry.Validate()
+}
+
+// loadLimits reads NODE_MAX_OPERATORS, NODE_MAX_MESSAGE_BYTES and
+// NODE_MAX_BATCH_SIZE, the defaults for those not set
+func (params *AppParams) loadLimits() error {
+	params.Limits = ceremony.DefaultLimits
+	counts := map[string]*int{
+		"NODE_MAX_OPERATORS":  &params.Limits.MaxOperators,
+		"NODE_MAX_BATCH_SIZE": &params.Limits.MaxBatchSize,
+	}
+	for env, count := range counts {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("failed to parse %s: %q isn't a positive number", env, value)
+		}
+		*count = parsed
+	}
+	if value := os.Getenv("NODE_MAX_MESSAGE_BYTES"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("failed to parse NODE_MAX_MESSAGE_BYTES: %q isn't a positive number", value)
+		}
+		params.Limits.MaxMessageBytes = parsed
+	}
+	return nil
+}
+
+func parseFraction(value string) (float64, error) {
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	if parsed <= 0 || parsed > 1 {
+		return 0, fmt.Errorf("%s is not a fraction between 0 and 1", value)
+	}
+	return parsed, nil
+}
+
+// loadCoordinators reads NODE_COORDINATOR_KEYS, comma separated base64 encoded
+// PEM public keys, and NODE_COORDINATOR_THRESHOLD approvals required out of them
+func (params *AppParams) loadCoordinators() error {
+	encodedKeys := os.Getenv("NODE_COORDINATOR_KEYS")
+	if encodedKeys == "" {
+		return nil
+	}
+	keys := []*rsa.PublicKey{}
+	for _, encodedKey := range strings.Split(encodedKeys, ",") {
+		pk, err := coordinator.ParsePublicKey(encodedKey)
+		if err != nil {
+			return fmt.Errorf("invalid NODE_COORDINATOR_KEYS: %w", err)
+		}
+		keys = append(keys, pk)
+	}
+
+	threshold, err := strconv.Atoi(os.Getenv("NODE_COORDINATOR_THRESHOLD"))
+	if err != nil {
+		return fmt.Errorf("failed to parse NODE_COORDINATOR_THRESHOLD: %w", err)
+	}
+	coordinators, err := coordinator.NewSet(threshold, keys)
+	if err != nil {
+		return err
+	}
+	params.Coordinators = coordinators
+	return nil
+}
+
+// loadRelay reads NODE_REQUIRE_RELAY_SIGNATURE, NODE_RELAY_KEYS, comma
+// separated base64 encoded ed25519 public keys, and NODE_RELAY_MAX_AGE
+func (params *AppParams) loadRelay() error {
+	params.RequireRelaySignature = os.Getenv("NODE_REQUIRE_RELAY_SIGNATURE") == "true"
+	if encodedKeys := os.Getenv("NODE_RELAY_KEYS"); encodedKeys != "" {
+		for _, encodedKey := range strings.Split(encodedKeys, ",") {
+			key, err := messengerclient.ParseRelayKey(strings.TrimSpace(encodedKey))
+			if err != nil {
+				return fmt.Errorf("invalid NODE_RELAY_KEYS: %w", err)
+			}
+			params.RelayKeys = append(params.RelayKeys, key)
+		}
+	}
+	// a key fetched from the messenger at startup would be trusted on first use
+	if params.RequireRelaySignature && len(params.RelayKeys) == 0 {
+		return fmt.Errorf("NODE_REQUIRE_RELAY_SIGNATURE needs the messenger key pinned in NODE_RELAY_KEYS")
+	}
+	params.RelayMaxAge = messengerclient.DefaultRelayMaxAge
+	if maxAge := os.Getenv("NODE_RELAY_MAX_AGE"); maxAge != "" {
+		parsed, err := time.ParseDuration(maxAge)
+		if err != nil {
+			return fmt.Errorf("failed to parse NODE_RELAY_MAX_AGE: %w", err)
+		}
+		if parsed <= 0 {
+			return fmt.Errorf("NODE_RELAY_MAX_AGE must be positive")
+		}
+		params.RelayMaxAge = parsed
+	}
+	return nil
+}
+
+// loadMinProtocolVersion reads NODE_MIN_PROTOCOL_VERSION, version 1 by default
+func (params *AppParams) loadMinProtocolVersion() error {
+	params.MinProtocolVersion = ceremony.ProtocolV1
+	minVersion := os.Getenv("NODE_MIN_PROTOCOL_VERSION")
+	if minVersion == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseUint(minVersion, 10, 32)
+	if err != nil {
+		return fmt.Errorf("failed to parse NODE_MIN_PROTOCOL_VERSION: %w", err)
+	}
+	if version := uint32(parsed); version < ceremony.ProtocolV1 || version > ceremony.ProtocolVersion {
+		return fmt.Errorf("NODE_MIN_PROTOCOL_VERSION must be between %d and %d", ceremony.ProtocolV1, ceremony.ProtocolVersion)
+	}
+	params.MinProtocolVersion = uint32(parsed)
+	return nil
+}
+
+// loadReshareRate reads NODE_RESHARE_MIN_INTERVAL and
+// NODE_RESHARE_OVERRIDE_APPROVALS, every coordinator by default. A single
+// coordinator never lifts the interval.
+func (params *AppParams) loadReshareRate() error {
+	interval := os.Getenv("NODE_RESHARE_MIN_INTERVAL")
+	if interval == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(interval)
+	if err != nil {
+		return fmt.Errorf("failed to parse NODE_RESHARE_MIN_INTERVAL: %w", err)
+	}
+	params.ReshareInterval = parsed
+	if params.Coordinators == nil {
+		return nil
+	}
+
+	approvals := os.Getenv("NODE_RESHARE_OVERRIDE_APPROVALS")
+	if approvals == "" {
+		if params.Coordinators.Size() > 1 {
+			params.ReshareOverrideApprovals = params.Coordinators.Size()
+		}
+		return nil
+	}
+	if params.ReshareOverrideApprovals, err = strconv.Atoi(approvals); err != nil {
+		return fmt.Errorf("failed to parse NODE_RESHARE_OVERRIDE_APPROVALS: %w", err)
+	}
+	if params.ReshareOverrideApprovals < 2 || params.ReshareOverrideApprovals > params.Coordinators.Size() {
+		return fmt.Errorf("NODE_RESHARE_OVERRIDE_APPROVALS must be between 2 and the %d coordinators", params.Coordinators.Size())
+	}
+	return nil
+}
+
+// loadCeremonyLogs reads NODE_CEREMONY_LOGS=true, which writes the logs of
+// each ceremony to ceremony-logs in the data directory, the size a log is
+// rotated at NODE_CEREMONY_LOG_MAX_SIZE, the rotated files kept
+// NODE_CEREMONY_LOG_FILES and NODE_CEREMONY_LOG_RETENTION
+func (params *AppParams) loadCeremonyLogs() error {
+	if os.Getenv("NODE_CEREMONY_LOGS") != "true" {
+		return nil
+	}
+	config := logger.DefaultCeremonyLogConfig
+	config.Dir = filepath.Join(params.DataDir, logger.CeremonyLogDir)
+	if value := os.Getenv("NODE_CEREMONY_LOG_MAX_SIZE"); value != "" {
+		parsed, err := quota.ParseBytes(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse NODE_CEREMONY_LOG_MAX_SIZE: %w", err)
+		}
+		config.MaxBytes = parsed
+	}
+	if value := os.Getenv("NODE_CEREMONY_LOG_FILES"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("invalid NODE_CEREMONY_LOG_FILES %q", value)
+		}
+		config.MaxFiles = parsed
+	}
+	if value := os.Getenv("NODE_CEREMONY_LOG_RETENTION"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse NODE_CEREMONY_LOG_RETENTION: %w", err)
+		}
+		config.Retention = parsed
+	}
+	params.CeremonyLogs = &config
+	return nil
+}
+
+// loadSandbox reads the user to drop to and the sandbox profile. The paths
+// the node is configured with are added to NODE_SANDBOX_PATHS: the data dir,
+// log dir and unix socket dirs writable, tls and policy files readable.
+func (params *AppParams) loadSandbox() error {
+	params.Sandbox.AllowRoot = os.Getenv("NODE_ALLOW_ROOT") == "true"
+	for _, arg := range os.Args[1:] {
+		if arg == "--allow-root" {
+			params.Sandbox.AllowRoot = true
+		}
+	}
+	params.Sandbox.User = os.Getenv("NODE_RUN_AS")
+
+	landlock, seccomp, err := sandbox.ParseModes(os.Getenv("NODE_SANDBOX"))
+	if err != nil {
+		return fmt.Errorf("invalid NODE_SANDBOX: %w", err)
+	}
+	params.Sandbox.Landlock, params.Sandbox.Seccomp = landlock, seccomp
+	paths, err := sandbox.ParsePaths(os.Getenv("NODE_SANDBOX_PATHS"))
+	if err != nil {
+		return fmt.Errorf("invalid NODE_SANDBOX_PATHS: %w", err)
+	}
+
+	writable := []string{params.DataDir, params.logDir(), filepath.Dir(params.UpgradeSocket)}
+	for _, addr := range middleware.ListenAddrs(params.HttpAddress) {
+		if path, ok := middleware.UnixPath(addr); ok {
+			writable = append(writable, filepath.Dir(path))
+		}
+	}
+	readable := []string{
+		os.Getenv("NODE_KEYSIGN_USAGE_FILE"), os.Getenv("NODE_HOSTS_FILE"),
+		params.Middleware.TLSCert, params.Middleware.TLSKey, params.Middleware.ClientCA,
+	}
+	for _, path := range writable {
+		if abs, err := filepath.Abs(path); err == nil && path != "" {
+			paths = append(paths, sandbox.Path{Path: abs, Write: true})
+		}
+	}
+	for _, path := range readable {
+		if abs, err := filepath.Abs(path); err == nil && path != "" {
+			paths = append(paths, sandbox.Path{Path: abs})
+		}
+	}
+	params.Sandbox.Paths = paths
+	return nil
+}
+
+// logDir is where the logger writes the log file of the node
+func (params *AppParams) logDir() string {
+	if dir := os.Getenv("DKG_LOG_PATH"); dir != "" {
+		return dir
+	}
+	return "."
+}
+
+// logFile is the log file of the node, handed to the user the node drops to
+func (params *AppParams) logFile() string {
+	return filepath.Join(params.logDir(), fmt.Sprintf("rockx_dkg_%s.log", serviceName))
+}
+
 func (params *AppParams) loadOperatorPrivateKey() error {
 	encodedKey := os.Getenv("OPERATOR_PRIVATE_KEY")
 	if encodedKey == "" {
@@ -0,0 +1,131 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/debugbundle"
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/middleware"
+)
+
+// runDebugBundle writes the debug bundle of a ceremony for a support ticket.
+// It asks the api of the running node, so unlike export it works while the
+// node runs, and reads the log file next to it.
+func runDebugBundle(args []string) error {
+	flags := flag.NewFlagSet("debug-bundle", flag.ExitOnError)
+	requestID := flags.String("request-id", "", "request id of the ceremony")
+	nodeURL := flags.String("node", "", "url of the node api, default NODE_ADDR on localhost")
+	token := flags.String("token", "", "bearer token of the node api, default the first of NODE_AUTH_TOKENS")
+	logPath := flags.String("log", "", "log file of the node, default rockx_dkg_node.log in DKG_LOG_PATH")
+	ceremonyLogs := flags.String("ceremony-logs", "", "directory of the ceremony logs, default ceremony-logs in NODE_DATA_DIR")
+	logLines := flags.Int("log-lines", 2000, "most recent log lines of the ceremony to include")
+	out := flags.String("out", "", "archive to write, default debug-bundle_<request id>_<unix time>.tar.gz")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *requestID == "" {
+		return fmt.Errorf("runDebugBundle: --request-id is required")
+	}
+
+	auth, err := middleware.ConfigFromEnv("NODE", publicNodePaths)
+	if err != nil {
+		return fmt.Errorf("runDebugBundle: %w", err)
+	}
+	if *nodeURL == "" {
+		params := &AppParams{}
+		params.loadHttpAddress()
+		// the first tcp address, the http client doesn't dial unix sockets
+		var addr string
+		for _, listen := range middleware.ListenAddrs(params.HttpAddress) {
+			if _, unix := middleware.UnixPath(listen); !unix {
+				addr = listen
+				break
+			}
+		}
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("runDebugBundle: no tcp address in NODE_ADDR %s, set --node: %w", params.HttpAddress, err)
+		}
+		scheme := "http"
+		if auth.TLSCert != "" {
+			scheme = "https"
+		}
+		*nodeURL = fmt.Sprintf("%s://127.0.0.1:%s", scheme, port)
+	}
+	if *token == "" && len(auth.Tokens) > 0 {
+		*token = auth.Tokens[0]
+	}
+	if *logPath == "" {
+		dir := os.Getenv("DKG_LOG_PATH")
+		if dir == "" {
+			dir = "."
+		}
+		*logPath = fmt.Sprintf("%s/rockx_dkg_%s.log", dir, serviceName)
+	}
+
+	if *ceremonyLogs == "" {
+		dataDir := os.Getenv("NODE_DATA_DIR")
+		if dataDir == "" {
+			dataDir = "/frost-dkg-data"
+		}
+		*ceremonyLogs = filepath.Join(dataDir, logger.CeremonyLogDir)
+	}
+	if _, err := os.Stat(*ceremonyLogs); err != nil {
+		// the node doesn't write ceremony logs
+		*ceremonyLogs = ""
+	}
+
+	collector := &debugbundle.Collector{
+		Node:           *nodeURL,
+		Token:          *token,
+		LogPath:        *logPath,
+		CeremonyLogDir: *ceremonyLogs,
+		MaxLogLines:    *logLines,
+		Environ:        os.Environ(),
+	}
+	files, err := collector.Collect(*requestID)
+	if err != nil {
+		return fmt.Errorf("runDebugBundle: %w", err)
+	}
+
+	name := fmt.Sprintf("debug-bundle_%s_%d", *requestID, time.Now().Unix())
+	if *out == "" {
+		*out = name + ".tar.gz"
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("runDebugBundle: failed to create %s: %w", *out, err)
+	}
+	defer file.Close()
+	if err := debugbundle.Write(file, name, files); err != nil {
+		return fmt.Errorf("runDebugBundle: %w", err)
+	}
+	fmt.Printf("debug bundle written to %s\n", *out)
+	return nil
+}
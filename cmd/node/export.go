@@ -0,0 +1,78 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/export"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+)
+
+// runExport dumps the ceremony history of the node storage, it only reads the
+// storage settings from the environment. Badger holds a lock on its directory,
+// run it while the node is stopped or against postgres.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "sqlite", "output format: sqlite (sql script for the sqlite3 shell) or csv")
+	out := flags.String("out", "", "output file for sqlite (default stdout), output directory for csv (default export)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	params := &AppParams{}
+	if err := params.loadStorage(); err != nil {
+		return fmt.Errorf("runExport: failed to load storage params: %w", err)
+	}
+	db, err := openStorage(params)
+	if err != nil {
+		return fmt.Errorf("runExport: failed to setup DB: %w", err)
+	}
+	defer db.Close()
+
+	tables, err := export.Build(store.NewStorage(db, 0, nil))
+	if err != nil {
+		return fmt.Errorf("runExport: %w", err)
+	}
+
+	switch *format {
+	case "csv":
+		dir := *out
+		if dir == "" {
+			dir = "export"
+		}
+		return export.WriteCSV(dir, tables)
+	case "sqlite":
+		if *out == "" {
+			return export.WriteSQLite(os.Stdout, tables)
+		}
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("runExport: failed to create %s: %w", *out, err)
+		}
+		defer file.Close()
+		return export.WriteSQLite(file, tables)
+	}
+	return fmt.Errorf("runExport: unknown format %s", *format)
+}
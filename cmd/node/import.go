@@ -0,0 +1,124 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/backfill"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+var errImportDrift = errors.New("imported results and the node storage disagree")
+
+// runImportResults archives the results of past ceremonies from a messenger
+// replication snapshot or a map of request ids to results, and checks the
+// results the operator signed against its local shares. It exits non-zero
+// when a signed result has no or another local share. Like export it only
+// reads the storage settings, badger is locked by a running node.
+func runImportResults(args []string) error {
+	flags := flag.NewFlagSet("import-results", flag.ExitOnError)
+	operator := flags.Uint64("operator-id", 0, "operator to reconcile the results with, default NODE_OPERATOR_ID")
+	asJSON := flags.Bool("json", false, "print the report as json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("runImportResults: usage: import-results [--operator-id id] [--json] <dump.json>")
+	}
+
+	operatorID := types.OperatorID(*operator)
+	if operatorID == 0 {
+		parsed, err := strconv.ParseUint(os.Getenv("NODE_OPERATOR_ID"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("runImportResults: set --operator-id or NODE_OPERATOR_ID: %w", err)
+		}
+		operatorID = types.OperatorID(parsed)
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("runImportResults: %w", err)
+	}
+	dump, err := backfill.ParseDump(data)
+	if err != nil {
+		return fmt.Errorf("runImportResults: %s: %w", flags.Arg(0), err)
+	}
+
+	params := &AppParams{}
+	if err := params.loadStorage(); err != nil {
+		return fmt.Errorf("runImportResults: failed to load storage params: %w", err)
+	}
+	db, err := openStorage(params)
+	if err != nil {
+		return fmt.Errorf("runImportResults: failed to setup DB: %w", err)
+	}
+	defer db.Close()
+	storage := store.NewStorage(db, operatorID, nil)
+
+	report, err := backfill.Import(dump, operatorID, storage, storage, registryKeys(storage))
+	if err != nil {
+		return fmt.Errorf("runImportResults: %w", err)
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printImportReport(report)
+	}
+	if report.Drifted() {
+		return errImportDrift
+	}
+	return nil
+}
+
+func printImportReport(report *backfill.Report) {
+	fmt.Printf("%d ceremonies read, %d outputs archived\n", report.Ceremonies, report.Outputs)
+	for _, skipped := range report.Skipped {
+		fmt.Printf("skipped: %s, %s\n", skipped.RequestID, skipped.Reason)
+	}
+	for _, rejected := range report.Rejected {
+		fmt.Printf("rejected: output of operator %d for %s, %s\n", rejected.Signer, rejected.RequestID, rejected.Reason)
+	}
+	fmt.Printf("operator %d: %d validators in sync\n", report.OperatorID, len(report.InSync))
+	for _, finding := range report.Missing {
+		fmt.Printf("missing: %s was signed by the operator in %s but has no local share\n", finding.ValidatorPK, finding.RequestID)
+	}
+	for _, finding := range report.Mismatch {
+		fmt.Printf("mismatch: the local share of %s differs from the one signed in %s\n", finding.ValidatorPK, finding.RequestID)
+	}
+	for _, finding := range report.HandedOver {
+		fmt.Printf("handed over: the share of %s from %s was handed over to another node\n", finding.ValidatorPK, finding.RequestID)
+	}
+	for _, finding := range report.Canary {
+		fmt.Printf("canary: %s from canary request %s\n", finding.ValidatorPK, finding.RequestID)
+	}
+}
@@ -22,24 +22,41 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/failover"
 	"github.com/RockX-SG/frost-dkg-demo/internal/keymanager"
 	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
 	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/middleware"
 	"github.com/RockX-SG/frost-dkg-demo/internal/node"
-	"github.com/RockX-SG/frost-dkg-demo/internal/ping"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/internal/plugin"
+	"github.com/RockX-SG/frost-dkg-demo/internal/quota"
+	"github.com/RockX-SG/frost-dkg-demo/internal/resolver"
+	"github.com/RockX-SG/frost-dkg-demo/internal/sandbox"
+	"github.com/RockX-SG/frost-dkg-demo/internal/sink"
+	"github.com/RockX-SG/frost-dkg-demo/internal/stats"
 	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/telemetry"
+	"github.com/RockX-SG/frost-dkg-demo/internal/upgrade"
 
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/dkg/frost"
 	"github.com/bloxapp/ssv-spec/dkg/keysign"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/dgraph-io/badger/v3"
-	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 )
 
 const serviceName = "node"
@@ -51,7 +68,75 @@ func init() {
 }
 
 func main() {
+	// outbound host names resolve with the static hosts and DoH resolver of the node
+	resolution, err := resolver.ConfigFromEnv("NODE")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	resolver.Install(resolution)
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExport(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "refresh-operators" {
+		if err := runRefreshOperators(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		if err := runReconcile(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import-results" {
+		if err := runImportResults(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "debug-bundle" {
+		if err := runDebugBundle(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate-storage" {
+		if err := runMigrateStorage(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rekey-storage" {
+		if err := runRekeyStorage(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		if err := runService(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
+	runNode()
+}
+
+func runNode() {
 	log := logger.New(serviceName)
 	params := &AppParams{}
 	if err := params.loadFromEnv(); err != nil {
@@ -59,24 +144,120 @@ func main() {
 		panic(err)
 	}
 	log.Debugf("Main: app env: %s messenger addr: %s", params.print(), messenger.MessengerAddrFromEnv())
+	if err := sandbox.CheckUser(&params.Sandbox); err != nil {
+		log.Errorf("Main: %s", err.Error())
+		panic(err)
+	}
+	if err := sandbox.Enter(&params.Sandbox); err != nil {
+		log.Errorf("Main: failed to enter sandbox: %s", err.Error())
+		panic(err)
+	}
+	if sandbox.Entered() {
+		log.Infof("Main: running in %s sandbox", params.Sandbox.String())
+	}
+
+	if params.CeremonyLogs != nil {
+		ceremonyLogs, err := logger.NewCeremonyLogs(*params.CeremonyLogs)
+		if err != nil {
+			log.Errorf("Main: failed to set up ceremony logs: %s", err.Error())
+			panic(err)
+		}
+		log.AddHook(ceremonyLogs)
+		go ceremonyLogs.Run(nil, log)
+	}
 
 	// set up db for storage
-	db, err := setupDB()
+	db, err := openStorage(params)
 	if err != nil {
 		log.Errorf("Main: failed to setup DB: %s", err.Error())
 		panic(err)
 	}
 	defer db.Close()
 
+	// watch the disk usage of badger, postgres is sized by its operator
+	var disk *quota.Monitor
+	if params.StorageBackend != "postgres" {
+		disk = quota.NewMonitor(params.DiskQuota, params.DataDir, log)
+		db = disk.Wrap(db)
+		prometheus.MustRegister(disk.Collectors()...)
+		go disk.Run(nil)
+	}
+
 	storage := store.NewStorage(db, params.OperatorID, params.OperatorPrivateKey)
+	storage.SetOperatorCache(params.OperatorCache)
+	if rebuilt, err := storage.EnsureIndexes(); err != nil {
+		log.Errorf("Main: failed to build storage indexes: %s", err.Error())
+		panic(err)
+	} else if rebuilt {
+		log.Infof("Main: built share and ceremony indexes of the storage")
+	}
 	signer := keymanager.NewKeyManager(types.PrimusTestnet)
-	network := messenger.NewMessengerClient(messenger.MessengerAddrFromEnv())
+	// publishes, streams and registrations carry a session opened with the operator key
+	network := messenger.NewMessengerClient(messenger.MessengerAddrFromEnv()).WithSession(params.OperatorID, params.OperatorPrivateKey)
+	network.Token = messenger.MessengerTokenFromEnv()
+	network.MaxMessageBytes = messengerLimits(network, params.Limits, log).MaxMessageBytes
+	tracker := ceremony.NewTracker(storage)
+	watchdog := ceremony.NewWatchdog(tracker, params.OperatorID, params.PhaseTimeouts, log)
+
+	sinks, err := sink.FromEnv()
+	if err != nil {
+		log.Errorf("Main: failed to set up result sinks: %s", err.Error())
+		panic(err)
+	}
+	// site plugins vet start messages, follow ceremony outcomes and export results
+	registrations, err := plugin.FromEnv()
+	if err != nil {
+		log.Errorf("Main: failed to set up plugins: %s", err.Error())
+		panic(err)
+	}
+	plugins := plugin.NewHooks(params.OperatorID, registrations, log)
+	sinks = append(sinks, plugins.Sinks()...)
+
+	cache := node.NewMessageCache()
+	tracker.Subscribe(cache.Observe)
+	ceremonyMetrics := stats.NewMetrics(serviceName)
+	prometheus.MustRegister(ceremonyMetrics.Collectors()...)
+	tracker.Subscribe(ceremonyMetrics.ObserveCeremony)
+	tracker.Subscribe(node.NewPluginNotifier(plugins, log).Observe)
+	tracker.Subscribe(node.NewSinkPublisher(storage, sinks, &params.OperatorPrivateKey.PublicKey, log).Observe)
+
+	// shares of canary keygens are marked on completion and deleted once they expire
+	canaries := node.NewCanarySweeper(storage, log)
+	tracker.Subscribe(canaries.Observe)
+	go canaries.Run(nil)
 
+	// the state of ended ceremonies is purged by the retention policy, shares are kept
+	retention := node.NewRetentionSweeper(params.Retention, storage, tracker, log)
+	prometheus.MustRegister(retention.Collectors()...)
+	go retention.Run(nil)
+
+	// a keysign never runs while a resharing of the validator supersedes its share
+	interlock := node.NewValidatorInterlock(tracker)
+	tracker.Subscribe(interlock.Observe)
+	prometheus.MustRegister(interlock.Collectors()...)
+
+	// transcripts of keygens and resharings are kept for verification long after
+	transcripts := node.NewTranscriptRecorder(registryKeys(storage), storage, log)
+	tracker.Subscribe(transcripts.Observe)
+
+	// every operator's signed output is kept, so any node can hand out the result
+	outputs := node.NewOutputRecorder(registryKeys(storage), storage, tracker, log)
+
+	// messages the messenger refuses are spooled and retried in order
+	outbox, err := node.NewOutbox(params.Outbox, network, storage, log)
+	if err != nil {
+		log.Errorf("Main: %s", err.Error())
+		panic(err)
+	}
+	prometheus.MustRegister(outbox.Collectors()...)
+	go outbox.Run(nil)
+
+	observed := node.NewObservedNetwork(network, tracker, cache, transcripts, log).WithCommitteeOutputs(outputs).WithVersionClaims(params.OperatorID, params.OperatorPrivateKey).WithOutbox(outbox)
 	config := &dkg.Config{
 		KeygenProtocol:      frost.New,
 		ReshareProtocol:     frost.NewResharing,
 		KeySign:             keysign.NewSignature,
-		Network:             network,
+		Network:             observed,
 		Signer:              signer,
 		Storage:             storage,
 		SignatureDomainType: types.PrimusTestnet,
@@ -89,37 +270,214 @@ func main() {
 	}
 	dkgnode := dkg.NewNode(thisOperator, config)
 
-	// register dkg operator node with the messenger
-	if err := network.RegisterOperatorNode(strconv.Itoa(int(params.OperatorID)), os.Getenv("NODE_BROADCAST_ADDR")); err != nil {
-		log.Errorf("Main: %s", err.Error())
+	// register dkg operator node with the messenger, in a failover pair only the active instance does
+	capabilities := node.Capabilities(params.Limits, params.MinProtocolVersion)
+	registerNode := func() error {
+		return network.RegisterOperatorNodeWith(strconv.Itoa(int(params.OperatorID)), os.Getenv("NODE_BROADCAST_ADDR"), capabilities)
+	}
+	// a process started by an upgrade leaves the ceremonies in flight to the one it replaces
+	predecessor, err := upgrade.Join(log)
+	if err != nil {
+		log.Errorf("Main: failed to take over from the old node process: %s", err.Error())
 		panic(err)
 	}
+	if predecessor != nil {
+		log.Infof("Main: taking over from node process %d (%s), it finishes ceremonies %v", predecessor.State.PID, predecessor.State.Version, predecessor.State.Ceremonies)
+	}
 
-	h := node.New(log)
+	// settle the ceremonies the records left open, the rounds of the dkg runners don't survive a restart
+	reconciler := node.NewStartupReconciler(params.ReconcilePolicy, params.OperatorID, storage, tracker, watchdog, observed, network, log)
+	if predecessor != nil {
+		reconciler.HandedOver = predecessor.Owns
+	}
+	reconcile := func() {
+		if _, err := reconciler.Reconcile(nil); err != nil {
+			log.Errorf("Main: %s", err.Error())
+		}
+	}
+	isLeader := func() bool { return true }
+	if params.Failover {
+		elector, err := setupElector(params, db, log)
+		if err != nil {
+			log.Errorf("Main: failed to setup failover: %s", err.Error())
+			panic(err)
+		}
+		elector.OnElected(func() {
+			tracker.Reset()
+			if err := registerNode(); err != nil {
+				log.Errorf("Main: %s", err.Error())
+			}
+			reconcile()
+		})
+		isLeader = elector.IsLeader
+		go elector.Run(context.Background())
+	} else {
+		if err := registerNode(); err != nil {
+			log.Errorf("Main: %s", err.Error())
+			panic(err)
+		}
+		reconcile()
+	}
 
-	// register api routes
-	r := gin.Default()
-	r.Use(logger.GinLogger(log))
+	// anonymized ceremony statistics go out only when the operator opted in,
+	// the preview shows them either way
+	installationID, err := telemetry.InstallationID(params.DataDir)
+	if err != nil {
+		if params.Telemetry.Enabled {
+			log.Errorf("Main: %s", err.Error())
+			panic(err)
+		}
+		log.Warnf("Main: %s", err.Error())
+	}
+	reporter := telemetry.NewReporter(params.Telemetry, serviceName, version, installationID, node.TelemetrySource(storage, tracker), log).OnlyWhen(isLeader)
+	go reporter.Run(nil)
 
-	r.GET("/ping", ping.HandlePing)
+	scheduler := node.NewScheduler(params.ProcessConcurrency, params.OverloadQueueDepth)
+	h := node.New(log, tracker).WithTranscripts(transcripts).WithCommitteeOutputs(outputs).WithCapabilities(capabilities).
+		WithScheduler(scheduler).WithEquivocationBlame(observed.BlameEquivocation)
 
-	// handle incoming message
-	r.POST("/consume", h.HandleConsume(dkgnode))
+	// refuse new ceremonies before the running ones take more memory than budgeted
+	memory := node.NewMemoryGuard(params.MemoryBudget, cache, scheduler, tracker)
+	prometheus.MustRegister(memory.Collectors()...)
 
-	// get dkg results
-	r.GET("/dkg_results/:vk", h.HandleGetDKGResults(dkgnode))
+	// ask peers again for round messages that didn't arrive
+	process := h.ProcessMessage(dkgnode, cache)
+	rerequester := node.NewRerequester(tracker, process, params.OperatorID, params.OperatorPrivateKey, node.MessengerPeers(network), log)
+	rerequester.Interval = params.ResendInterval
+	rerequester.Retries = params.ResendRetries
+	rerequester.Sync = node.NewTopicSyncer(network, cache, params.OperatorID, process, log).Sync
 
-	r.GET("/version", func(ctx *gin.Context) {
-		ctx.JSON(http.StatusOK, gin.H{
-			"version": version,
-		})
+	// witness ceremonies this operator was invited to as observer
+	obs := observer.New(params.OperatorID, params.OperatorPrivateKey, registryKeys(storage), storage, log)
+
+	// register api routes
+	stack, err := middleware.NewStack(serviceName, params.Middleware, log)
+	if err != nil {
+		log.Errorf("Main: %s", err.Error())
+		panic(err)
+	}
+	prometheus.MustRegister(stack.Collectors()...)
+	upgrader := newUpgrader(params, stack, tracker, log)
+
+	// handle incoming message, start messages may come sealed through the messenger
+	// deliveries are checked against the relay key when every one must be signed,
+	// or when a ceremony is held to protocol version 2
+	keys := relayKeys(network, params.RelayKeys, log)
+	startPolicy := &node.StartPolicy{
+		Coordinators:       params.Coordinators,
+		KeySignDomains:     params.KeySignDomains,
+		KeySignUsage:       params.KeySignUsage,
+		Disk:               disk,
+		Memory:             memory,
+		Limits:             &params.Limits,
+		Canaries:           storage,
+		Plugins:            plugins,
+		MinProtocolVersion: params.MinProtocolVersion,
+		Keys:               registryKeys(storage),
+		SignedDeliveries:   len(keys) > 0,
+		RequireManifest:    params.RequireManifest,
+		ReshareCheck:       params.ReshareCheck,
+		Self:               params.OperatorID,
+		Shares:             storage,
+		HandingOver:        upgrader.HandingOver,
+		Interlock:          interlock,
+	}
+	if params.ReshareInterval > 0 {
+		startPolicy.ReshareRate = &node.ReshareRate{
+			Interval:          params.ReshareInterval,
+			OverrideApprovals: params.ReshareOverrideApprovals,
+			History:           storage,
+		}
+	}
+	r := stack.Engine()
+	registerRoutes(r, h, &nodeServices{
+		params:       params,
+		isLeader:     isLeader,
+		handedOver:   h.HandedOver(predecessor),
+		disk:         disk,
+		relayKeys:    keys,
+		startPolicy:  startPolicy,
+		capabilities: capabilities,
+		dkgnode:      dkgnode,
+		cache:        cache,
+		observer:     obs,
+		network:      network,
+		storage:      storage,
+		reporter:     reporter,
+		retention:    retention,
 	})
 
-	panic(r.Run(params.HttpAddress))
+	// an upgraded process serves on the listeners of the one it replaces
+	inherited, err := upgrade.Inherited()
+	if err != nil {
+		panic(err)
+	}
+	addrs := middleware.ListenAddrs(params.HttpAddress)
+	listeners, err := stack.Adopt(inherited, addrs...)
+	if err != nil {
+		panic(err)
+	}
+	// the ports are bound and the tls key is read, nothing else needs root
+	if err := sandbox.DropPrivileges(&params.Sandbox, params.DataDir, params.logFile()); err != nil {
+		log.Errorf("Main: %s", err.Error())
+		panic(err)
+	}
+	if predecessor != nil {
+		if err := predecessor.Ack(); err != nil {
+			log.Errorf("Main: %s", err.Error())
+			panic(err)
+		}
+	}
+	go upgrader.watch(addrs, listeners, r)
+	err = stack.Serve(r, listeners)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-upgrader.Done()
+		os.Exit(upgrader.Supervise())
+	}
+	panic(err)
 }
 
-func setupDB() (*badger.DB, error) {
-	return badger.Open(badger.DefaultOptions("/frost-dkg-data"))
+func setupDB(params *AppParams) (store.DB, error) {
+	if params.StorageBackend == "postgres" {
+		return store.OpenSQLDB("postgres", params.PostgresDSN)
+	}
+	db, err := badger.Open(badger.DefaultOptions(params.DataDir))
+	if err != nil {
+		return nil, err
+	}
+	return store.NewBadgerDB(db), nil
+}
+
+// openStorage opens the storage of the node, its values encrypted with
+// NODE_STORAGE_PASSPHRASE when it's set
+func openStorage(params *AppParams) (store.DB, error) {
+	raw, err := setupDB(params)
+	if err != nil {
+		return nil, err
+	}
+	db, err := store.OpenEncrypted(raw, params.StoragePassphrase, params.StorageOldPassphrase)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// setupElector campaigns for the lease of this operator in the shared database
+func setupElector(params *AppParams, db store.DB, log *logrus.Logger) (*failover.Elector, error) {
+	// the leases live in their own table, outside the encrypted values
+	if encrypted, ok := db.(*store.EncryptedDB); ok {
+		db = encrypted.DB
+	}
+	sqlDB, ok := db.(*store.SQLDB)
+	if !ok {
+		return nil, fmt.Errorf("failover needs the postgres storage")
+	}
+	leases, err := failover.NewSQLLeaseStore(sqlDB.SQL())
+	if err != nil {
+		return nil, err
+	}
+	return failover.NewElector(leases, fmt.Sprintf("operator/%d", params.OperatorID), params.InstanceID, params.LeaseTTL, log), nil
 }
 
 func thisOperator(operatorID uint32, storage dkg.Storage) (*dkg.Operator, error) {
@@ -132,3 +490,49 @@ func thisOperator(operatorID uint32, storage dkg.Storage) (*dkg.Operator, error)
 	}
 	return operator, nil
 }
+
+// messengerLimits are the limits of both the node and the messenger, the
+// messages the node broadcasts have to fit them
+func messengerLimits(network *messenger.Client, own ceremony.Limits, log *logrus.Logger) ceremony.Limits {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	limits, err := network.Limits(ctx)
+	if err != nil {
+		log.Warnf("Main: failed to get the limits of the messenger, using the node's own: %s", err.Error())
+		return own
+	}
+	return ceremony.Negotiate(own, limits)
+}
+
+// relayKeys are the pinned relay keys, or the key the messenger publishes
+// when none are pinned. A node that requires signed deliveries has them
+// pinned, others go on without a key and can't join version 2 ceremonies nor
+// take sealed or relayed starts.
+func relayKeys(network *messenger.Client, pinned []ed25519.PublicKey, log *logrus.Logger) []ed25519.PublicKey {
+	if len(pinned) > 0 {
+		return pinned
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	key, err := network.RelayKey(ctx)
+	if err == nil && key == nil {
+		err = fmt.Errorf("the messenger doesn't sign deliveries")
+	}
+	if err != nil {
+		log.Warnf("Main: no relay key, ceremonies of protocol version 2 and sealed or relayed starts are refused: %s", err.Error())
+		return nil
+	}
+	log.Infof("Main: using the relay key published by the messenger, pin it with NODE_RELAY_KEYS")
+	return []ed25519.PublicKey{key}
+}
+
+// registryKeys looks up operator keys in the operator registry cached by storage
+func registryKeys(storage dkg.Storage) observer.KeyLookup {
+	return func(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+		_, operator, err := storage.GetDKGOperator(operatorID)
+		if err != nil {
+			return nil, err
+		}
+		return operator.EncryptionPubKey, nil
+	}
+}
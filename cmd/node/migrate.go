@@ -0,0 +1,105 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+)
+
+// runMigrateStorage copies the whole node storage from one backend to
+// another, e.g. badger to a managed postgres, and verifies the copy. Badger
+// is locked by a running node: stop the node, migrate, switch NODE_STORAGE
+// and start it again.
+func runMigrateStorage(args []string) error {
+	flags := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+	from := flags.String("from", "", "source storage, badger:<dir> or postgres:<dsn>")
+	to := flags.String("to", "", "empty target storage, badger:<dir> or postgres:<dsn>")
+	batch := flags.Int("batch", store.DefaultMigrateBatch, "keys written per batch")
+	verifyOnly := flags.Bool("verify-only", false, "only compare the key counts and hashes of both storages")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return fmt.Errorf("runMigrateStorage: --from and --to are required")
+	}
+
+	source, err := openStorageSpec(*from)
+	if err != nil {
+		return fmt.Errorf("runMigrateStorage: source: %w", err)
+	}
+	defer source.Close()
+	target, err := openStorageSpec(*to)
+	if err != nil {
+		return fmt.Errorf("runMigrateStorage: target: %w", err)
+	}
+	defer target.Close()
+
+	var digest store.Digest
+	if *verifyOnly {
+		if digest, err = store.DigestDB(source); err != nil {
+			return fmt.Errorf("runMigrateStorage: failed to digest source: %w", err)
+		}
+		copied, err := store.DigestDB(target)
+		if err != nil {
+			return fmt.Errorf("runMigrateStorage: failed to digest target: %w", err)
+		}
+		if err := digest.Compare(copied); err != nil {
+			return fmt.Errorf("runMigrateStorage: target doesn't match the source: %w", err)
+		}
+	} else {
+		digest, err = store.Migrate(source, target, *batch, func(copied int) {
+			fmt.Printf("copied %d keys\n", copied)
+		})
+		if err != nil {
+			return fmt.Errorf("runMigrateStorage: %w", err)
+		}
+	}
+
+	for _, kind := range digest.Kinds() {
+		fmt.Printf("%s\t%d keys\tsha256 %s\n", kind, digest[kind].Keys, digest[kind].Hash)
+	}
+	fmt.Printf("verified %d keys\n", digest.Keys())
+	return nil
+}
+
+// openStorageSpec opens badger:<dir> or postgres:<dsn> the way the node opens
+// its own storage
+func openStorageSpec(spec string) (store.DB, error) {
+	backend, location, ok := strings.Cut(spec, ":")
+	if !ok || location == "" {
+		return nil, fmt.Errorf("invalid storage %q, expected badger:<dir> or postgres:<dsn>", spec)
+	}
+	params := &AppParams{StorageBackend: backend}
+	switch backend {
+	case "badger":
+		params.DataDir = location
+	case "postgres":
+		params.PostgresDSN = location
+	default:
+		return nil, fmt.Errorf("unknown storage backend %s", backend)
+	}
+	return setupDB(params)
+}
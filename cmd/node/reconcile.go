@@ -0,0 +1,144 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/reconcile"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+var errDrift = errors.New("node storage and the ssv contract disagree")
+
+// runReconcile compares the shares in the node storage with the validators
+// registered to the operator in the SSVNetwork contract. It exits non-zero on
+// drift so it can run from cron. Like export it only reads the storage
+// settings, badger is locked by a running node.
+func runReconcile(args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	rpc := flags.String("ssv-rpc", "", "json-rpc url of an execution node of the network")
+	network := flags.String("network", "mainnet", "network of the SSVNetwork contract: mainnet or holesky")
+	contract := flags.String("ssv-contract", "", "SSVNetwork contract address, overrides the one of --network")
+	fromBlock := flags.Uint64("from-block", 0, "first block to scan, default the deployment block of the contract")
+	blockRange := flags.Uint64("block-range", reconcile.DefaultBlockRange, "blocks per eth_getLogs request")
+	operator := flags.Uint64("operator-id", 0, "operator to reconcile, default NODE_OPERATOR_ID")
+	asJSON := flags.Bool("json", false, "print the report as json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *rpc == "" {
+		return fmt.Errorf("runReconcile: --ssv-rpc is required")
+	}
+
+	ssvContract, ok := reconcile.Contracts[*network]
+	if *contract != "" {
+		ssvContract = reconcile.Contract{Address: *contract}
+	} else if !ok {
+		return fmt.Errorf("runReconcile: no SSVNetwork contract known for network %q, set --ssv-contract", *network)
+	}
+	if *fromBlock != 0 {
+		ssvContract.DeployBlock = *fromBlock
+	}
+	if *blockRange == 0 {
+		return fmt.Errorf("runReconcile: --block-range must be positive")
+	}
+
+	operatorID := types.OperatorID(*operator)
+	if operatorID == 0 {
+		parsed, err := strconv.ParseUint(os.Getenv("NODE_OPERATOR_ID"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("runReconcile: set --operator-id or NODE_OPERATOR_ID: %w", err)
+		}
+		operatorID = types.OperatorID(parsed)
+	}
+
+	params := &AppParams{}
+	if err := params.loadStorage(); err != nil {
+		return fmt.Errorf("runReconcile: failed to load storage params: %w", err)
+	}
+	db, err := openStorage(params)
+	if err != nil {
+		return fmt.Errorf("runReconcile: failed to setup DB: %w", err)
+	}
+	defer db.Close()
+	storage := store.NewStorage(db, operatorID, nil)
+
+	shares, err := storage.ListValidatorShares()
+	if err != nil {
+		return fmt.Errorf("runReconcile: %w", err)
+	}
+	tombstones, err := storage.ListHandoverTombstones()
+	if err != nil {
+		return fmt.Errorf("runReconcile: failed to list handed over shares: %w", err)
+	}
+	handedOver := make(map[string]bool)
+	for _, tombstone := range tombstones {
+		handedOver[strings.TrimPrefix(tombstone.ValidatorPK, "0x")] = true
+	}
+
+	chain := reconcile.NewChain(*rpc, ssvContract)
+	chain.BlockRange = *blockRange
+	registered, err := chain.ValidatorsOf(context.Background(), operatorID)
+	if err != nil {
+		return fmt.Errorf("runReconcile: failed to read validators from the ssv contract: %w", err)
+	}
+
+	report := reconcile.Reconcile(operatorID, shares, handedOver, registered)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printReconcileReport(report)
+	}
+	if report.Drifted() {
+		return errDrift
+	}
+	return nil
+}
+
+func printReconcileReport(report *reconcile.Report) {
+	fmt.Printf("operator %d: %d validators in sync\n", report.OperatorID, len(report.InSync))
+	for _, pk := range report.Unregistered {
+		fmt.Printf("unregistered: %s has a local share but isn't registered with the operator\n", pk)
+	}
+	for _, validator := range report.Missing {
+		fmt.Printf("missing: %s is registered by %s with operators %v but has no local share\n", validator.PublicKey, validator.Owner, validator.OperatorIDs)
+	}
+	for _, mismatch := range report.CommitteeMismatch {
+		fmt.Printf("committee mismatch: %s is registered with operators %v, the local share is for %v\n", mismatch.Validator.PublicKey, mismatch.Validator.OperatorIDs, mismatch.LocalOperatorIDs)
+	}
+	for _, validator := range report.HandedOver {
+		fmt.Printf("handed over: %s is registered, its share was handed over to another node\n", validator.PublicKey)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// runRefreshOperators revalidates the cached registry operators, all of them
+// or the ones given with --ids, and reports the operators whose key changed.
+// Like export it only reads the storage settings, badger is locked by a
+// running node.
+func runRefreshOperators(args []string) error {
+	flags := flag.NewFlagSet("refresh-operators", flag.ExitOnError)
+	ids := flags.String("ids", "", "comma separated operator ids to refresh, default every cached operator")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	params := &AppParams{}
+	if err := params.loadStorage(); err != nil {
+		return fmt.Errorf("runRefreshOperators: failed to load storage params: %w", err)
+	}
+	db, err := openStorage(params)
+	if err != nil {
+		return fmt.Errorf("runRefreshOperators: failed to setup DB: %w", err)
+	}
+	defer db.Close()
+	storage := store.NewStorage(db, 0, nil)
+
+	operatorIDs, err := parseOperatorIDs(*ids)
+	if err != nil {
+		return fmt.Errorf("runRefreshOperators: %w", err)
+	}
+	if len(operatorIDs) == 0 {
+		if operatorIDs, err = storage.ListOperatorIDs(); err != nil {
+			return fmt.Errorf("runRefreshOperators: failed to list cached operators: %w", err)
+		}
+	}
+
+	// fetch every operator first and store them in one batch
+	failed := 0
+	fetched := make(map[types.OperatorID]*store.OperatorRecord, len(operatorIDs))
+	for _, operatorID := range operatorIDs {
+		before := "none"
+		if cached, err := storage.GetOperatorRecord(operatorID); err == nil {
+			before = keyFingerprint(cached.Operator.EncryptionPubKey)
+		}
+		record, err := storage.FetchOperatorRecord(operatorID)
+		if err != nil {
+			failed++
+			fmt.Printf("operator %d: refresh failed: %v\n", operatorID, err)
+			continue
+		}
+		fetched[operatorID] = record
+		after := keyFingerprint(record.Operator.EncryptionPubKey)
+		switch {
+		case before == "none":
+			fmt.Printf("operator %d: fetched key %s\n", operatorID, after)
+		case before != after:
+			fmt.Printf("operator %d: key changed %s -> %s\n", operatorID, before, after)
+		default:
+			fmt.Printf("operator %d: key unchanged %s\n", operatorID, after)
+		}
+	}
+	if err := storage.SaveOperatorRecords(fetched); err != nil {
+		return fmt.Errorf("runRefreshOperators: failed to store %d operators: %w", len(fetched), err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("runRefreshOperators: %d of %d operators failed to refresh", failed, len(operatorIDs))
+	}
+	return nil
+}
+
+func parseOperatorIDs(value string) ([]types.OperatorID, error) {
+	var operatorIDs []types.OperatorID
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid operator id %q: %w", field, err)
+		}
+		operatorIDs = append(operatorIDs, types.OperatorID(id))
+	}
+	return operatorIDs, nil
+}
+
+// keyFingerprint is the start of the sha256 of the der encoded public key
+func keyFingerprint(pk *rsa.PublicKey) string {
+	if pk == nil {
+		return "none"
+	}
+	der, err := x509.MarshalPKIXPublicKey(pk)
+	if err != nil {
+		return "invalid"
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
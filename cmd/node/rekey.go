@@ -0,0 +1,68 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+)
+
+// runRekeyStorage re-encrypts every stored value from
+// NODE_STORAGE_OLD_PASSPHRASE to NODE_STORAGE_PASSPHRASE, or encrypts a
+// plaintext storage when the old passphrase is unset. Each batch is committed with a checkpoint: a run that
+// stops halfway resumes where it was, and the node reads the storage with
+// both passphrases in between. A run that fails its verification is rolled
+// back to the old passphrase. Badger is locked by a running node: stop the
+// node, rekey with the environment the node then starts with, and drop
+// NODE_STORAGE_OLD_PASSPHRASE once it succeeded.
+func runRekeyStorage(args []string) error {
+	flags := flag.NewFlagSet("rekey-storage", flag.ExitOnError)
+	batch := flags.Int("batch", store.DefaultRekeyBatch, "values re-encrypted per batch")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	params := &AppParams{}
+	if err := params.loadStorage(); err != nil {
+		return fmt.Errorf("runRekeyStorage: failed to load storage params: %w", err)
+	}
+	if params.StoragePassphrase == "" {
+		return fmt.Errorf("runRekeyStorage: NODE_STORAGE_PASSPHRASE is required")
+	}
+	// the storage is opened raw, the re-keying reads both keys itself
+	db, err := setupDB(params)
+	if err != nil {
+		return fmt.Errorf("runRekeyStorage: failed to setup DB: %w", err)
+	}
+	defer db.Close()
+
+	result, err := store.Rekey(db, params.StorageOldPassphrase, params.StoragePassphrase, *batch, func(done int) {
+		fmt.Printf("re-encrypted %d values\n", done)
+	})
+	if err != nil {
+		return fmt.Errorf("runRekeyStorage: %w", err)
+	}
+	fmt.Printf("verified %d values under key %s, NODE_STORAGE_OLD_PASSPHRASE can be unset\n", result.Verified, result.To)
+	return nil
+}
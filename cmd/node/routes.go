@@ -0,0 +1,149 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"strconv"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/internal/ping"
+	"github.com/RockX-SG/frost-dkg-demo/internal/quota"
+	"github.com/RockX-SG/frost-dkg-demo/internal/recovery"
+	store "github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/telemetry"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// nodeServices are the parts of the node the api routes are served from
+type nodeServices struct {
+	params       *AppParams
+	isLeader     func() bool
+	handedOver   gin.HandlerFunc
+	disk         *quota.Monitor
+	relayKeys    []ed25519.PublicKey
+	startPolicy  *node.StartPolicy
+	capabilities *messengerclient.Capabilities
+	dkgnode      *dkg.Node
+	cache        *node.MessageCache
+	observer     *observer.Observer
+	network      *messenger.Client
+	storage      *store.Storage
+	reporter     *telemetry.Reporter
+	retention    *node.RetentionSweeper
+}
+
+// registerRoutes adds the api of the node to r, every path has to be in
+// publicNodePaths or one of the allowlistGroups
+func registerRoutes(r *gin.Engine, h *node.ApiHandler, s *nodeServices) {
+	r.Use(h.LimitBody(s.params.Limits))
+
+	r.GET("/ping", ping.HandlePing)
+	r.GET("/health", h.HandleHealth(s.disk))
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/limits", h.HandleLimits(s.params.Limits))
+	r.GET("/capabilities", h.HandleCapabilities())
+
+	// the configuration committees check for consistency before ceremonies
+	r.GET("/config", h.HandleConfig(s.params.advertisedConfig(s.capabilities, len(s.relayKeys) > 0)))
+
+	consume := h.HandleConsume(s.dkgnode, s.startPolicy, s.cache)
+	relayPolicy := &node.RelayPolicy{
+		Recipient: strconv.Itoa(int(s.params.OperatorID)),
+		Keys:      s.relayKeys,
+		MaxAge:    s.params.RelayMaxAge,
+		Require:   s.params.RequireRelaySignature,
+	}
+	consumeChain := []gin.HandlerFunc{h.LeaderOnly(s.isLeader)}
+	if len(s.relayKeys) > 0 {
+		consumeChain = append(consumeChain, h.RelayOnly(relayPolicy))
+	}
+	r.POST("/consume", append(consumeChain, s.handedOver, h.ObservedOnly(s.observer), consume)...)
+	// sealed and relayed starts are refused without a relay key to check them
+	relayedChain := []gin.HandlerFunc{h.LeaderOnly(s.isLeader), h.RelayOnly(relayPolicy)}
+	r.POST(messenger.SealedStartPath, append(relayedChain, h.HandleConsumeSealed(s.params.OperatorPrivateKey, consume))...)
+	r.POST(messenger.RelayedStartPath, append(relayedChain, h.HandleConsumeRelayed(consume))...)
+	// sign and publish start messages for initiators without an operator key
+	if s.params.InitSigning {
+		r.POST("/init/sign", h.LeaderOnly(s.isLeader), s.handedOver, h.HandleSignInit(s.startPolicy, s.network, s.params.OperatorPrivateKey))
+	}
+
+	// observed ceremonies and their attestations
+	r.POST("/observe", h.LeaderOnly(s.isLeader), h.HandleObserve(s.observer))
+	r.GET("/observe/:request_id", h.HandleGetAttestation(s.observer))
+
+	// get dkg results
+	r.GET("/dkg_results/:vk", h.HandleGetDKGResults(s.dkgnode))
+	r.GET("/shares", h.HandleListShares(s.storage))
+	r.GET("/lineage/:validator_pk", h.HandleGetLineage(s.storage))
+	r.GET("/usage/:validator_pk", h.HandleGetUsage(s.storage))
+
+	// ceremony state and event log
+	r.GET("/ceremonies", h.HandleListCeremonies(s.storage))
+	r.GET("/stats", h.HandleStats(s.storage))
+	r.GET("/telemetry/preview", h.HandleTelemetryPreview(s.reporter))
+	r.GET("/ceremonies/:request_id", s.handedOver, h.HandleGetCeremony())
+	r.POST("/ceremonies/:request_id/abort", h.LeaderOnly(s.isLeader), s.handedOver, h.HandleAbortCeremony())
+	r.GET("/ceremonies/:request_id/transcript", h.HandleGetTranscript(s.storage))
+	r.GET("/ceremonies/:request_id/committee-outputs", h.HandleGetCommitteeOutputs(s.storage, registryKeys(s.storage)))
+	r.GET("/ceremonies/:request_id/approval", h.HandleGetApproval(s.storage, registryKeys(s.storage), s.params.OperatorID, s.params.OperatorPrivateKey))
+
+	// purge ended ceremonies now, one or all those the retention policy allows
+	r.POST("/retention/purge", h.LeaderOnly(s.isLeader), h.HandlePurge(s.retention))
+
+	// re-send this node's round messages to a peer that missed them
+	r.POST("/resend", h.LeaderOnly(s.isLeader), s.handedOver, h.HandleResend(s.storage, s.cache))
+
+	// share handover between hosts of the same operator
+	r.POST("/handover/enrollment", h.LeaderOnly(s.isLeader), h.HandleHandoverEnrollment(s.storage, s.params.OperatorPrivateKey))
+	r.POST("/handover/export", h.LeaderOnly(s.isLeader), h.HandleHandoverExport(s.storage, s.params.OperatorPrivateKey))
+	r.POST("/handover/import", h.LeaderOnly(s.isLeader), h.HandleHandoverImport(s.storage))
+
+	// share recovery from threshold many peers of the committee
+	recoveryKeys := recovery.KeyLookup(registryKeys(s.storage))
+	r.POST("/recovery/split", h.LeaderOnly(s.isLeader), h.HandleRecoverySplit(s.storage, s.params.OperatorPrivateKey, recoveryKeys))
+	r.POST("/recovery/combine", h.LeaderOnly(s.isLeader), h.HandleRecoveryCombine(s.storage, s.params.OperatorPrivateKey, recoveryKeys))
+	r.POST("/recovery/import", h.LeaderOnly(s.isLeader), h.HandleRecoveryImport(s.storage, s.params.OperatorPrivateKey, recoveryKeys))
+	r.GET("/recovery/:request_id", h.HandleGetRecovery(s.storage))
+
+	// failover status of this instance
+	r.GET("/failover", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{
+			"instance": s.params.InstanceID,
+			"failover": s.params.Failover,
+			"active":   s.isLeader(),
+		})
+	})
+
+	r.GET("/version", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{
+			"version": version,
+		})
+	})
+}
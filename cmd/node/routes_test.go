@@ -0,0 +1,86 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoutesAllowlisted fails on a route that NODE_ALLOW_* can't restrict and
+// that isn't meant to be public
+func TestRoutesAllowlisted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	r := gin.New()
+	params := &AppParams{OperatorID: 1, OperatorPrivateKey: sk, InitSigning: true}
+	registerRoutes(r, node.New(logrus.New(), nil), &nodeServices{params: params, isLeader: func() bool { return true }})
+
+	for _, route := range r.Routes() {
+		if matchesAny(publicNodePaths, route.Path) {
+			continue
+		}
+		grouped := false
+		for _, paths := range allowlistGroups {
+			grouped = grouped || matchesAny(paths, route.Path)
+		}
+		require.True(t, grouped, "%s %s is in no allowlist group and isn't public", route.Method, route.Path)
+	}
+}
+
+// matchesAny matches the way the allowlist middleware does, a trailing *
+// matches a prefix
+func matchesAny(paths []string, route string) bool {
+	for _, path := range paths {
+		if strings.HasSuffix(path, "*") {
+			if strings.HasPrefix(route, strings.TrimSuffix(path, "*")) {
+				return true
+			}
+		} else if route == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDefaultAdminAllowlist(t *testing.T) {
+	t.Setenv("NODE_ALLOW_ADMIN", "")
+	t.Setenv("NODE_AUTH", "")
+	allowlists := defaultAdminAllowlist()
+	require.Len(t, allowlists, 1)
+	require.Equal(t, "admin:127.0.0.0/8,::1/128", allowlists[0].String())
+
+	t.Setenv("NODE_AUTH", "token")
+	require.Empty(t, defaultAdminAllowlist())
+	t.Setenv("NODE_AUTH", "")
+	t.Setenv("NODE_ALLOW_ADMIN", "10.20.0.0/16")
+	require.Empty(t, defaultAdminAllowlist())
+}
@@ -0,0 +1,123 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/sandbox"
+	"github.com/RockX-SG/frost-dkg-demo/internal/service"
+)
+
+var errServiceUsage = errors.New("usage: node service install|uninstall|status|run [options]")
+
+// runService installs the node as a system service, `service run` is the
+// command line the installed service starts the node with
+func runService(args []string) error {
+	if len(args) == 0 {
+		return errServiceUsage
+	}
+
+	switch args[0] {
+	case "install":
+		return installService(args[1:])
+	case "uninstall":
+		flags := flag.NewFlagSet("service uninstall", flag.ExitOnError)
+		name := flags.String("name", service.DefaultName, "service name")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := service.New().Uninstall(*name); err != nil {
+			return fmt.Errorf("runService: failed to uninstall %s: %w", *name, err)
+		}
+		fmt.Printf("service %s uninstalled\n", *name)
+		return nil
+	case "status":
+		flags := flag.NewFlagSet("service status", flag.ExitOnError)
+		name := flags.String("name", service.DefaultName, "service name")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		status, err := service.New().Status(*name)
+		if err != nil {
+			return fmt.Errorf("runService: failed to get status of %s: %w", *name, err)
+		}
+		fmt.Printf("%s: %s\n", *name, status)
+		return nil
+	case "run":
+		flags := flag.NewFlagSet("service run", flag.ExitOnError)
+		name := flags.String("name", service.DefaultName, "service name")
+		envFile := flags.String("env-file", "", "file with the node environment variables")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		// a node started again inside its sandbox inherited the environment
+		if *envFile != "" && !sandbox.Entered() {
+			if err := service.ApplyEnvFile(*envFile); err != nil {
+				return fmt.Errorf("runService: failed to load env file: %w", err)
+			}
+		}
+		return service.Run(*name, runNode)
+	}
+	return errServiceUsage
+}
+
+func installService(args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("installService: failed to locate node binary: %w", err)
+	}
+	cfg := service.DefaultConfig(executable)
+
+	flags := flag.NewFlagSet("service install", flag.ExitOnError)
+	flags.StringVar(&cfg.Name, "name", cfg.Name, "service name, run one service per operator")
+	flags.StringVar(&cfg.EnvFile, "env-file", "", "file with the node environment variables (required)")
+	flags.StringVar(&cfg.LogDir, "log-dir", cfg.LogDir, "directory for the node log files")
+	flags.StringVar(&cfg.DataDir, "data-dir", cfg.DataDir, "directory for the badger storage")
+	flags.DurationVar(&cfg.RestartDelay, "restart-delay", cfg.RestartDelay, "how long to wait before restarting a failed node")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if cfg.EnvFile == "" {
+		return fmt.Errorf("installService: --env-file is required")
+	}
+
+	// the supervisor doesn't start the node from the current directory
+	for _, path := range []*string{&cfg.EnvFile, &cfg.LogDir, &cfg.DataDir} {
+		if *path == "" {
+			continue
+		}
+		if *path, err = filepath.Abs(*path); err != nil {
+			return fmt.Errorf("installService: %w", err)
+		}
+	}
+
+	if err := service.New().Install(cfg); err != nil {
+		return fmt.Errorf("installService: failed to install %s: %w", cfg.Name, err)
+	}
+	fmt.Printf("service %s installed and started, logs in %s\n", cfg.Name, cfg.LogDir)
+	return nil
+}
@@ -0,0 +1,153 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/middleware"
+	"github.com/RockX-SG/frost-dkg-demo/internal/upgrade"
+	"github.com/sirupsen/logrus"
+)
+
+// upgrader hands this node process over to a new binary on upgrade.Signal.
+// The new process takes the listeners and every ceremony started from then
+// on, this one finishes the ceremonies it runs and then stays as the parent
+// of the new one.
+type upgrader struct {
+	params     *AppParams
+	stack      *middleware.Stack
+	tracker    *ceremony.Tracker
+	log        *logrus.Logger
+	executable string
+	startedAt  time.Time
+
+	handingOver atomic.Bool
+	successor   *upgrade.Handover
+	done        chan struct{}
+}
+
+func newUpgrader(params *AppParams, stack *middleware.Stack, tracker *ceremony.Tracker, log *logrus.Logger) *upgrader {
+	// the path is read now, the binary at it is replaced by the upgrade
+	executable, err := os.Executable()
+	if err != nil {
+		log.Warnf("Main: in-place upgrades are off, the node binary isn't found: %s", err.Error())
+	}
+	return &upgrader{
+		params:     params,
+		stack:      stack,
+		tracker:    tracker,
+		log:        log,
+		executable: executable,
+		startedAt:  time.Now().UTC(),
+		done:       make(chan struct{}),
+	}
+}
+
+// HandingOver reports whether the node hands over, it refuses new ceremonies then
+func (u *upgrader) HandingOver() bool {
+	return u.handingOver.Load()
+}
+
+// Done is closed once the process handed over and finished its ceremonies
+func (u *upgrader) Done() <-chan struct{} {
+	return u.done
+}
+
+// Supervise runs once Done is closed, this process stays the parent of the
+// new one until it exits and returns its exit code
+func (u *upgrader) Supervise() int {
+	return u.successor.Supervise()
+}
+
+// watch hands over on every upgrade.Signal until a handover succeeds
+func (u *upgrader) watch(addrs []string, listeners []net.Listener, handler http.Handler) {
+	if upgrade.Signal == nil || u.executable == "" {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, upgrade.Signal)
+	for range signals {
+		handover, err := u.handOver(addrs, listeners, handler)
+		if err != nil {
+			u.log.Errorf("Main: upgrade failed, this process goes on serving: %s", err.Error())
+			continue
+		}
+		signal.Stop(signals)
+		u.drain()
+		handover.Close()
+		u.successor = handover
+		close(u.done)
+		return
+	}
+}
+
+func (u *upgrader) handOver(addrs []string, listeners []net.Listener, handler http.Handler) (*upgrade.Handover, error) {
+	// two processes can't open the badger database
+	if u.params.StorageBackend != "postgres" {
+		return nil, errors.New("in-place upgrades need the postgres storage, restart the node to upgrade it")
+	}
+	u.handingOver.Store(true)
+	state := func() *upgrade.State {
+		return &upgrade.State{PID: os.Getpid(), Version: version, Ceremonies: u.tracker.Running(), StartedAt: u.startedAt}
+	}
+	u.log.Infof("Main: handing over to %s", u.executable)
+	handover, err := upgrade.Start(u.executable, os.Args[1:], u.params.UpgradeSocket, addrs, listeners, handler, state, u.params.UpgradeTimeout, u.log)
+	if err != nil {
+		u.handingOver.Store(false)
+		return nil, err
+	}
+
+	// stop accepting, the new process does from now on
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := u.stack.Shutdown(ctx); err != nil {
+		u.log.Warnf("Main: requests still in progress after the handover: %s", err.Error())
+	}
+	return handover, nil
+}
+
+// drain waits for the ceremonies this process runs, the new process forwards
+// their messages to it through the handover socket
+func (u *upgrader) drain() {
+	deadline := time.Now().Add(u.params.UpgradeDrainTimeout)
+	for {
+		running := u.tracker.Running()
+		if len(running) == 0 {
+			u.log.Infof("Main: handed over, no ceremony left to finish")
+			return
+		}
+		if time.Now().After(deadline) {
+			u.log.Warnf("Main: handed over, leaving %d ceremonies unfinished after %s: %v", len(running), u.params.UpgradeDrainTimeout, running)
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,247 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package addressbook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+const (
+	// HistorySize is how many health checks are kept per operator
+	HistorySize = 20
+	// StaleFailures consecutive failed checks flag an endpoint as stale
+	StaleFailures = 3
+	// StaleAge without a successful check flags an endpoint as stale
+	StaleAge = 7 * 24 * time.Hour
+)
+
+// Sources of an endpoint, the latest one wins
+const (
+	SourceManual    = "manual"
+	SourceCeremony  = "ceremony"
+	SourceMessenger = "messenger"
+)
+
+var ErrUnknownOperator = errors.New("operator not in address book")
+
+type HealthCheck struct {
+	At        int64  `json:"at"`
+	OK        bool   `json:"ok"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Entry struct {
+	OperatorID types.OperatorID `json:"operator_id"`
+	Endpoint   string           `json:"endpoint"`
+	PublicKey  string           `json:"public_key,omitempty"`
+	Source     string           `json:"source"`
+	UpdatedAt  int64            `json:"updated_at"`
+	Health     []HealthCheck    `json:"health,omitempty"`
+	// Region and ASN of the operator's node, set by hand, the resharing
+	// planner spreads committees over them
+	Region string `json:"region,omitempty"`
+	ASN    uint32 `json:"asn,omitempty"`
+}
+
+// Stale reports whether the endpoint failed its last checks or wasn't seen
+// healthy for a long time, entries that were never checked aren't stale
+func (e *Entry) Stale(now time.Time) bool {
+	if len(e.Health) == 0 {
+		return false
+	}
+
+	failures := 0
+	for i := len(e.Health) - 1; i >= 0 && !e.Health[i].OK; i-- {
+		failures++
+	}
+	if failures >= StaleFailures {
+		return true
+	}
+
+	lastOK := e.LastOK()
+	return lastOK == nil || now.Sub(time.Unix(lastOK.At, 0)) > StaleAge
+}
+
+func (e *Entry) LastOK() *HealthCheck {
+	for i := len(e.Health) - 1; i >= 0; i-- {
+		if e.Health[i].OK {
+			return &e.Health[i]
+		}
+	}
+	return nil
+}
+
+// Book maps operator IDs to their node endpoints, it is stored as a json
+// file next to the cli
+type Book struct {
+	mu        sync.Mutex
+	path      string
+	Operators map[types.OperatorID]*Entry `json:"operators"`
+}
+
+// DefaultPath is $DKG_ADDRESS_BOOK or ~/.rockx-dkg/addressbook.json
+func DefaultPath() string {
+	if path := os.Getenv("DKG_ADDRESS_BOOK"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "addressbook.json"
+	}
+	return filepath.Join(home, ".rockx-dkg", "addressbook.json")
+}
+
+// Load reads the book at path, a missing file is an empty book
+func Load(path string) (*Book, error) {
+	book := &Book{path: path, Operators: make(map[types.OperatorID]*Entry)}
+
+	byts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return book, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read address book %s: %w", path, err)
+	}
+	if err := json.Unmarshal(byts, book); err != nil {
+		return nil, fmt.Errorf("failed to parse address book %s: %w", path, err)
+	}
+	if book.Operators == nil {
+		book.Operators = make(map[types.OperatorID]*Entry)
+	}
+	return book, nil
+}
+
+func (b *Book) Save() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	byts, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o700); err != nil {
+		return err
+	}
+	// write to a temp file first so a crash never leaves half a book behind
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, byts, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+func (b *Book) Get(operatorID types.OperatorID) (*Entry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.Operators[operatorID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownOperator, operatorID)
+	}
+	return entry, nil
+}
+
+// List returns the entries ordered by operator ID
+func (b *Book) List() []*Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := make([]*Entry, 0, len(b.Operators))
+	for _, entry := range b.Operators {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].OperatorID < entries[j].OperatorID })
+	return entries
+}
+
+// SetEndpoint records the endpoint of an operator, the health history is
+// dropped when the endpoint changes since it described another host
+func (b *Book) SetEndpoint(operatorID types.OperatorID, endpoint, source string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry := b.entry(operatorID)
+	if entry.Endpoint != endpoint {
+		entry.Health = nil
+	}
+	entry.Endpoint = endpoint
+	entry.Source = source
+	entry.UpdatedAt = time.Now().UTC().Unix()
+}
+
+func (b *Book) SetPublicKey(operatorID types.OperatorID, publicKey string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entry(operatorID).PublicKey = publicKey
+}
+
+// SetLocation records where the node of an operator runs, an empty region or
+// a zero asn leaves the recorded one
+func (b *Book) SetLocation(operatorID types.OperatorID, region string, asn uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry := b.entry(operatorID)
+	if region != "" {
+		entry.Region = region
+	}
+	if asn != 0 {
+		entry.ASN = asn
+	}
+}
+
+func (b *Book) RecordHealth(operatorID types.OperatorID, check HealthCheck) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry := b.entry(operatorID)
+	entry.Health = append(entry.Health, check)
+	if len(entry.Health) > HistorySize {
+		entry.Health = entry.Health[len(entry.Health)-HistorySize:]
+	}
+}
+
+func (b *Book) Remove(operatorID types.OperatorID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.Operators, operatorID)
+}
+
+func (b *Book) entry(operatorID types.OperatorID) *Entry {
+	entry, ok := b.Operators[operatorID]
+	if !ok {
+		entry = &Entry{OperatorID: operatorID}
+		b.Operators[operatorID] = entry
+	}
+	return entry
+}
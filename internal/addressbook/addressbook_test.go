@@ -0,0 +1,83 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package addressbook
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book", "addressbook.json")
+
+	book, err := Load(path)
+	require.NoError(t, err)
+	require.Empty(t, book.List())
+
+	book.SetEndpoint(2, "http://10.0.0.2:8081", SourceCeremony)
+	book.SetEndpoint(1, "http://10.0.0.1:8081", SourceManual)
+	book.SetPublicKey(1, "LS0tLS1CRUdJTi")
+	book.RecordHealth(1, HealthCheck{At: time.Now().Unix(), OK: true, LatencyMs: 12})
+	require.NoError(t, book.Save())
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	entries := loaded.List()
+	require.Len(t, entries, 2)
+	require.EqualValues(t, 1, entries[0].OperatorID)
+	require.Equal(t, "LS0tLS1CRUdJTi", entries[0].PublicKey)
+	require.Len(t, entries[0].Health, 1)
+	require.Equal(t, SourceCeremony, entries[1].Source)
+
+	_, err = loaded.Get(3)
+	require.ErrorIs(t, err, ErrUnknownOperator)
+}
+
+func TestBookHealthHistory(t *testing.T) {
+	book, err := Load(filepath.Join(t.TempDir(), "addressbook.json"))
+	require.NoError(t, err)
+	now := time.Now()
+
+	book.SetEndpoint(1, "http://10.0.0.1:8081", SourceManual)
+	for i := 0; i < HistorySize+5; i++ {
+		book.RecordHealth(1, HealthCheck{At: now.Unix(), OK: true})
+	}
+	entry, _ := book.Get(1)
+	require.Len(t, entry.Health, HistorySize)
+	require.False(t, entry.Stale(now))
+
+	for i := 0; i < StaleFailures; i++ {
+		book.RecordHealth(1, HealthCheck{At: now.Unix(), Error: "connection refused"})
+	}
+	require.True(t, entry.Stale(now))
+
+	// a new endpoint starts with a clean history
+	book.SetEndpoint(1, "http://10.0.0.9:8081", SourceMessenger)
+	require.Empty(t, entry.Health)
+	require.False(t, entry.Stale(now))
+
+	book.RecordHealth(1, HealthCheck{At: now.Add(-StaleAge - time.Hour).Unix(), OK: true})
+	require.True(t, entry.Stale(now))
+}
@@ -0,0 +1,217 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package backfill imports the results of past ceremonies, as exported by a
+// messenger or another coordinator, into the committee outputs archive of a
+// node and checks the ones the node took part in against its local shares.
+package backfill
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Dump are the results of past ceremonies by request id
+type Dump map[string]*messengerclient.DataStore
+
+// ParseDump reads a messenger replication snapshot or a plain map of request
+// ids to results, the layout the messenger stores its data in
+func ParseDump(data []byte) (Dump, error) {
+	snapshot := &messengerclient.ReplicationSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err == nil && len(snapshot.Data) > 0 {
+		return snapshot.Data, nil
+	}
+	dump := make(Dump)
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("ParseDump: neither a replication snapshot nor a map of results: %w", err)
+	}
+	return dump, nil
+}
+
+// Archive stores the committee outputs of ceremonies
+type Archive interface {
+	UpdateCommitteeOutputs(requestID string, update func(*observer.CommitteeOutputs) error) error
+}
+
+// ShareStore returns the local share of a validator, storage.ErrShareHandedOver
+// when the share was handed over to another node
+type ShareStore interface {
+	GetKeyGenOutput(pk types.ValidatorPK) (*dkg.KeyGenOutput, error)
+}
+
+// Report is what an import stored and how the results of the ceremonies the
+// operator took part in compare with its local shares
+type Report struct {
+	OperatorID types.OperatorID `json:"operator_id"`
+	// Ceremonies are the results read from the dump
+	Ceremonies int `json:"ceremonies"`
+	// Outputs are the signed outputs stored that weren't archived yet
+	Outputs  int        `json:"outputs"`
+	Skipped  []*Skipped `json:"skipped"`
+	Rejected []*Skipped `json:"rejected"`
+	// InSync are validators whose local share matches the share key the
+	// operator signed in the imported result
+	InSync []string `json:"in_sync"`
+	// Missing are validators the operator signed a result for without a local share
+	Missing []*Finding `json:"missing"`
+	// Mismatch are validators whose local share differs from the signed result
+	Mismatch []*Finding `json:"mismatch"`
+	// HandedOver are validators whose share this node handed over to another node
+	HandedOver []*Finding `json:"handed_over"`
+	// Canary are canary keygens of the operator, their shares are deleted
+	// once they expire and never back a validator
+	Canary []*Finding `json:"canary"`
+}
+
+// Skipped is a result or an output that wasn't archived
+type Skipped struct {
+	RequestID string           `json:"request_id"`
+	Signer    types.OperatorID `json:"signer,omitempty"`
+	Reason    string           `json:"reason"`
+}
+
+type Finding struct {
+	RequestID   string `json:"request_id"`
+	ValidatorPK string `json:"validator_pk"`
+}
+
+// Drifted reports whether a signed result of the operator has no or another
+// share in the local storage
+func (r *Report) Drifted() bool {
+	return len(r.Missing) > 0 || len(r.Mismatch) > 0
+}
+
+// Import stores the outputs of dump in archive once their signatures check
+// out against keys. Where operatorID signed an output the share key of the
+// output is compared with the local share. Outputs already archived are kept
+// as they are, so a dump can be imported more than once.
+func Import(dump Dump, operatorID types.OperatorID, archive Archive, shares ShareStore, keys observer.KeyLookup) (*Report, error) {
+	report := &Report{
+		OperatorID: operatorID,
+		Ceremonies: len(dump),
+		Skipped:    []*Skipped{},
+		Rejected:   []*Skipped{},
+		InSync:     []string{},
+		Missing:    []*Finding{},
+		Mismatch:   []*Finding{},
+		HandedOver: []*Finding{},
+		Canary:     []*Finding{},
+	}
+
+	requestIDs := make([]string, 0, len(dump))
+	for requestID := range dump {
+		requestIDs = append(requestIDs, requestID)
+	}
+	sort.Strings(requestIDs)
+
+	for _, requestID := range requestIDs {
+		result := dump[requestID]
+		switch {
+		case result == nil || (len(result.DKGOutputs) == 0 && result.BlameOutput == nil):
+			report.Skipped = append(report.Skipped, &Skipped{RequestID: requestID, Reason: "no result"})
+			continue
+		case len(result.DKGOutputs) == 0:
+			report.Skipped = append(report.Skipped, &Skipped{RequestID: requestID, Reason: "ceremony ended in blame"})
+			continue
+		}
+
+		var rejected []*Skipped
+		stored := 0
+		err := archive.UpdateCommitteeOutputs(requestID, func(outputs *observer.CommitteeOutputs) error {
+			rejected, stored = nil, 0
+			outputs.Canary = outputs.Canary || result.Canary
+			for _, signer := range sortedSigners(result.DKGOutputs) {
+				known := len(outputs.Outputs) + len(outputs.Conflicts)
+				if err := outputs.Add(result.DKGOutputs[signer], keys); err != nil {
+					rejected = append(rejected, &Skipped{RequestID: requestID, Signer: signer, Reason: err.Error()})
+					continue
+				}
+				stored += len(outputs.Outputs) + len(outputs.Conflicts) - known
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Import: failed to archive outputs of request %s: %w", requestID, err)
+		}
+		report.Outputs += stored
+		report.Rejected = append(report.Rejected, rejected...)
+
+		own, ok := result.DKGOutputs[operatorID]
+		if !ok || own == nil || own.Data == nil || isRejected(rejected, operatorID) {
+			continue
+		}
+		if err := report.reconcile(requestID, own.Data, result.Canary, shares); err != nil {
+			return nil, fmt.Errorf("Import: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// reconcile compares the share key the operator signed with its local share
+func (r *Report) reconcile(requestID string, output *dkg.Output, canary bool, shares ShareStore) error {
+	finding := &Finding{RequestID: requestID, ValidatorPK: hex.EncodeToString(output.ValidatorPubKey)}
+	local, err := shares.GetKeyGenOutput(output.ValidatorPubKey)
+	switch {
+	case errors.Is(err, storage.ErrShareHandedOver):
+		r.HandedOver = append(r.HandedOver, finding)
+	case errors.Is(err, storage.ErrKeyNotFound) && canary:
+		r.Canary = append(r.Canary, finding)
+	case errors.Is(err, storage.ErrKeyNotFound):
+		r.Missing = append(r.Missing, finding)
+	case err != nil:
+		return fmt.Errorf("failed to get share of %s: %w", finding.ValidatorPK, err)
+	case local.Share == nil || !bytes.Equal(local.Share.GetPublicKey().Serialize(), output.SharePubKey):
+		r.Mismatch = append(r.Mismatch, finding)
+	case canary:
+		r.Canary = append(r.Canary, finding)
+	default:
+		r.InSync = append(r.InSync, finding.ValidatorPK)
+	}
+	return nil
+}
+
+func sortedSigners(outputs map[types.OperatorID]*dkg.SignedOutput) []types.OperatorID {
+	signers := make([]types.OperatorID, 0, len(outputs))
+	for signer := range outputs {
+		signers = append(signers, signer)
+	}
+	sort.Slice(signers, func(i, j int) bool { return signers[i] < signers[j] })
+	return signers
+}
+
+func isRejected(rejected []*Skipped, signer types.OperatorID) bool {
+	for _, skipped := range rejected {
+		if skipped.Signer == signer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package backfill
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+type memArchive map[string]*observer.CommitteeOutputs
+
+func (a memArchive) UpdateCommitteeOutputs(requestID string, update func(*observer.CommitteeOutputs) error) error {
+	outputs, ok := a[requestID]
+	if !ok {
+		outputs = observer.NewCommitteeOutputs(requestID, nil)
+	}
+	if err := update(outputs); err != nil {
+		return err
+	}
+	a[requestID] = outputs
+	return nil
+}
+
+type memShares map[string]*dkg.KeyGenOutput
+
+func (s memShares) GetKeyGenOutput(pk types.ValidatorPK) (*dkg.KeyGenOutput, error) {
+	if output, ok := s[hex.EncodeToString(pk)]; ok {
+		if output == nil {
+			return nil, storage.ErrShareHandedOver
+		}
+		return output, nil
+	}
+	return nil, storage.ErrKeyNotFound
+}
+
+func testKeys(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+	return &testingutils.TestingKeygenKeySet().DKGOperators[operatorID].EncryptionKey.PublicKey, nil
+}
+
+func newShare() *bls.SecretKey {
+	share := &bls.SecretKey{}
+	share.SetByCSPRNG()
+	return share
+}
+
+func signedOutput(t *testing.T, operatorID types.OperatorID, requestID dkg.RequestID, vk []byte, share *bls.SecretKey) *dkg.SignedOutput {
+	output := &dkg.Output{RequestID: requestID, SharePubKey: share.GetPublicKey().Serialize(), ValidatorPubKey: vk}
+	sk := testingutils.TestingKeygenKeySet().DKGOperators[operatorID].EncryptionKey
+	root, err := types.ComputeSigningRoot(output, types.ComputeSignatureDomain(types.PrimusTestnet, types.DKGSignatureType))
+	require.NoError(t, err)
+	sig, err := types.Sign(sk, root)
+	require.NoError(t, err)
+	return &dkg.SignedOutput{Data: output, Signer: operatorID, Signature: sig}
+}
+
+func requestID(b byte) dkg.RequestID {
+	id := dkg.RequestID{}
+	id[0] = b
+	return id
+}
+
+func key(b byte) string {
+	id := requestID(b)
+	return hex.EncodeToString(id[:])
+}
+
+func TestParseDump(t *testing.T) {
+	result := &messengerclient.DataStore{BlameOutput: &dkg.BlameOutput{}}
+	snapshot, err := json.Marshal(&messengerclient.ReplicationSnapshot{Seq: 3, Data: map[string]*messengerclient.DataStore{"ab": result}})
+	require.NoError(t, err)
+	dump, err := ParseDump(snapshot)
+	require.NoError(t, err)
+	require.Contains(t, dump, "ab")
+
+	plain, err := json.Marshal(map[string]*messengerclient.DataStore{"cd": result})
+	require.NoError(t, err)
+	dump, err = ParseDump(plain)
+	require.NoError(t, err)
+	require.Contains(t, dump, "cd")
+
+	_, err = ParseDump([]byte("[1, 2]"))
+	require.Error(t, err)
+}
+
+func TestImport(t *testing.T) {
+	types.InitBLS()
+	vk := func(b byte) []byte { return []byte{b, b, b} }
+
+	own, peer := newShare(), newShare()
+	forged := signedOutput(t, 2, requestID(1), vk(1), peer)
+	forged.Signer = 3
+
+	dump := Dump{
+		// in sync, with a forged output of operator 3
+		key(1): {DKGOutputs: map[types.OperatorID]*dkg.SignedOutput{
+			1: signedOutput(t, 1, requestID(1), vk(1), own),
+			2: signedOutput(t, 2, requestID(1), vk(1), peer),
+			3: forged,
+		}},
+		// the local share differs
+		key(2): {DKGOutputs: map[types.OperatorID]*dkg.SignedOutput{
+			1: signedOutput(t, 1, requestID(2), vk(2), newShare()),
+		}},
+		// no local share
+		key(3): {DKGOutputs: map[types.OperatorID]*dkg.SignedOutput{
+			1: signedOutput(t, 1, requestID(3), vk(3), newShare()),
+		}},
+		// handed over
+		key(4): {DKGOutputs: map[types.OperatorID]*dkg.SignedOutput{
+			1: signedOutput(t, 1, requestID(4), vk(4), newShare()),
+		}},
+		// an expired canary
+		key(5): {Canary: true, DKGOutputs: map[types.OperatorID]*dkg.SignedOutput{
+			1: signedOutput(t, 1, requestID(5), vk(5), newShare()),
+		}},
+		// operator 1 wasn't in the committee
+		key(6): {DKGOutputs: map[types.OperatorID]*dkg.SignedOutput{
+			2: signedOutput(t, 2, requestID(6), vk(6), newShare()),
+		}},
+		key(7): {BlameOutput: &dkg.BlameOutput{}},
+	}
+	shares := memShares{
+		hex.EncodeToString(vk(1)): {Share: own},
+		hex.EncodeToString(vk(2)): {Share: newShare()},
+		hex.EncodeToString(vk(4)): nil,
+	}
+	archive := memArchive{}
+
+	report, err := Import(dump, 1, archive, shares, testKeys)
+	require.NoError(t, err)
+	require.Equal(t, 7, report.Ceremonies)
+	require.Equal(t, 7, report.Outputs)
+	require.Len(t, report.Skipped, 1)
+	require.Len(t, report.Rejected, 1)
+	require.Equal(t, types.OperatorID(3), report.Rejected[0].Signer)
+	require.Equal(t, []string{hex.EncodeToString(vk(1))}, report.InSync)
+	require.Equal(t, hex.EncodeToString(vk(2)), report.Mismatch[0].ValidatorPK)
+	require.Equal(t, hex.EncodeToString(vk(3)), report.Missing[0].ValidatorPK)
+	require.Equal(t, hex.EncodeToString(vk(4)), report.HandedOver[0].ValidatorPK)
+	require.Equal(t, hex.EncodeToString(vk(5)), report.Canary[0].ValidatorPK)
+	require.True(t, report.Drifted())
+
+	canary := archive[key(5)]
+	require.True(t, canary.Canary)
+	require.Len(t, archive[key(1)].Outputs, 2)
+
+	// importing the same dump again stores nothing new
+	report, err = Import(dump, 1, archive, shares, testKeys)
+	require.NoError(t, err)
+	require.Zero(t, report.Outputs)
+}
@@ -0,0 +1,418 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package bench drives a messenger with simulated ceremonies to measure how it
+// behaves under load. Mock operator nodes register with the messenger like
+// real ones and record when every relayed message arrives.
+package bench
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+type Config struct {
+	MessengerAddr string
+	// Ceremonies run at the same time, each on its own topic
+	Ceremonies int
+	// Operators is the number of mock nodes, committees are picked from them
+	Operators int
+	// Committee is the number of operators of every ceremony
+	Committee int
+	// Rounds is the number of messages every operator publishes per ceremony
+	Rounds int
+	// PayloadBytes is the size of the commitment carried by every message
+	PayloadBytes int
+	// ListenHost is the address the mock nodes listen on, it has to be
+	// reachable from the messenger
+	ListenHost string
+	// FirstOperatorID keeps the mock operators apart from real ones registered
+	// with the same messenger
+	FirstOperatorID types.OperatorID
+	// Drain is how long to wait for deliveries after the last publish
+	Drain time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MessengerAddr:   messenger.MessengerAddrFromEnv(),
+		Ceremonies:      100,
+		Operators:       16,
+		Committee:       4,
+		Rounds:          3,
+		PayloadBytes:    1024,
+		ListenHost:      "127.0.0.1",
+		FirstOperatorID: 1000000,
+		Drain:           30 * time.Second,
+	}
+}
+
+func (cfg Config) validate() error {
+	if cfg.Ceremonies < 1 || cfg.Rounds < 1 {
+		return errors.New("at least one ceremony and one round are required")
+	}
+	if cfg.Committee < 2 || cfg.Committee > cfg.Operators {
+		return fmt.Errorf("committee of %d operators needs 2 to %d operators", cfg.Committee, cfg.Operators)
+	}
+	return nil
+}
+
+type Report struct {
+	Ceremonies int `json:"ceremonies"`
+	Published  int `json:"published"`
+	// PublishFailures are messages the messenger didn't accept
+	PublishFailures int `json:"publish_failures"`
+	// Expected is the number of deliveries of all published messages, one per
+	// committee member other than the publisher
+	Expected  int `json:"expected_deliveries"`
+	Delivered int `json:"delivered"`
+	// Duplicates are deliveries of a message an operator already received
+	Duplicates int           `json:"duplicates"`
+	Elapsed    time.Duration `json:"elapsed"`
+	// PublishLatency is the time the messenger takes to accept a message
+	PublishLatency Stats `json:"publish_latency"`
+	// DeliveryLatency is the time from publishing to one operator receiving it
+	DeliveryLatency Stats `json:"delivery_latency"`
+	// FanOut is the time from publishing to the last operator receiving it,
+	// for fully delivered messages
+	FanOut Stats `json:"fan_out"`
+}
+
+// FailureRate is the share of deliveries that never happened, a message the
+// messenger refused counts as undelivered to every recipient
+func (r *Report) FailureRate() float64 {
+	if r.Expected == 0 {
+		return 0
+	}
+	return float64(r.Expected-r.Delivered) / float64(r.Expected)
+}
+
+// sent is a published message waiting for its deliveries
+type sent struct {
+	publishedAt time.Time
+	recipients  map[types.OperatorID]bool
+	received    map[types.OperatorID]time.Time
+}
+
+// tracker matches the messages the mock nodes receive with the published ones
+type tracker struct {
+	mu         sync.Mutex
+	messages   map[string]*sent
+	pending    int
+	duplicates int
+}
+
+func newTracker() *tracker {
+	return &tracker{messages: make(map[string]*sent)}
+}
+
+// expect registers a message before it is published, deliveries can arrive
+// before the publish call returns
+func (t *tracker) expect(data []byte, recipients []types.OperatorID) {
+	msg := &sent{
+		publishedAt: time.Now(),
+		recipients:  make(map[types.OperatorID]bool, len(recipients)),
+		received:    make(map[types.OperatorID]time.Time, len(recipients)),
+	}
+	for _, id := range recipients {
+		msg.recipients[id] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages[messenger.MessageHash(data)] = msg
+	t.pending += len(recipients)
+}
+
+func (t *tracker) receive(operatorID types.OperatorID, data []byte) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	msg, ok := t.messages[messenger.MessageHash(data)]
+	if !ok || !msg.recipients[operatorID] {
+		return
+	}
+	if _, dup := msg.received[operatorID]; dup {
+		t.duplicates++
+		return
+	}
+	msg.received[operatorID] = now
+	t.pending--
+}
+
+// drain waits until every expected delivery arrived or timeout passed
+func (t *tracker) drain(ctx context.Context, timeout time.Duration) {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		t.mu.Lock()
+		pending := t.pending
+		t.mu.Unlock()
+		if pending == 0 {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// mockNode accepts the messages the messenger relays to an operator
+type mockNode struct {
+	id      types.OperatorID
+	addr    string
+	server  *http.Server
+	tracker *tracker
+}
+
+func startMockNode(id types.OperatorID, host string, t *tracker) (*mockNode, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, err
+	}
+	n := &mockNode{id: id, addr: "http://" + listener.Addr().String(), tracker: t}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/consume", n.handleConsume)
+	n.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go n.server.Serve(listener)
+	return n, nil
+}
+
+func (n *mockNode) handleConsume(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	n.tracker.receive(n.id, data)
+	w.WriteHeader(http.StatusOK)
+}
+
+type publishResult struct {
+	latency time.Duration
+	err     error
+}
+
+// Run registers the mock nodes, creates a topic per ceremony and has every
+// committee member publish its round messages at the same time. Topics are
+// created before the load starts and deleted at the end, so only publishing
+// and delivery are measured.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("Run: %w", err)
+	}
+	client := messenger.NewMessengerClient(cfg.MessengerAddr)
+	t := newTracker()
+
+	nodes := make([]*mockNode, 0, cfg.Operators)
+	defer func() {
+		for _, n := range nodes {
+			n.server.Close()
+		}
+	}()
+	for i := 0; i < cfg.Operators; i++ {
+		n, err := startMockNode(cfg.FirstOperatorID+types.OperatorID(i), cfg.ListenHost, t)
+		if err != nil {
+			return nil, fmt.Errorf("Run: failed to start mock node: %w", err)
+		}
+		nodes = append(nodes, n)
+		if err := client.RegisterNode(ctx, messenger.DefaultTopic, &messengerclient.Subscriber{Name: strconv.Itoa(int(n.id)), SrvAddr: n.addr}); err != nil {
+			return nil, fmt.Errorf("Run: failed to register mock operator %d: %w", n.id, err)
+		}
+	}
+
+	topics := make([]string, 0, cfg.Ceremonies)
+	committees := make([][]types.OperatorID, 0, cfg.Ceremonies)
+	defer func() {
+		for _, topic := range topics {
+			_ = client.DeleteTopic(context.Background(), topic)
+		}
+	}()
+	for i := 0; i < cfg.Ceremonies; i++ {
+		committee := make([]types.OperatorID, 0, cfg.Committee)
+		for j := 0; j < cfg.Committee; j++ {
+			committee = append(committee, nodes[(i+j)%len(nodes)].id)
+		}
+		topic := randomTopic()
+		if err := client.CreateTopicContext(ctx, topicJSON(topic, committee)); err != nil {
+			return nil, fmt.Errorf("Run: failed to create topic: %w", err)
+		}
+		topics = append(topics, topic)
+		committees = append(committees, committee)
+	}
+
+	results := make(chan publishResult, cfg.Ceremonies*cfg.Committee*cfg.Rounds)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range topics {
+		for _, operatorID := range committees[i] {
+			wg.Add(1)
+			go func(topic string, committee []types.OperatorID, operatorID types.OperatorID) {
+				defer wg.Done()
+				publishRounds(ctx, client, t, cfg, topic, committee, operatorID, results)
+			}(topics[i], committees[i], operatorID)
+		}
+	}
+	wg.Wait()
+	close(results)
+
+	t.drain(ctx, cfg.Drain)
+	elapsed := time.Since(start)
+
+	report := &Report{Ceremonies: cfg.Ceremonies, Elapsed: elapsed}
+	publishLatencies := []time.Duration{}
+	for result := range results {
+		report.Published++
+		if result.err != nil {
+			report.PublishFailures++
+			continue
+		}
+		publishLatencies = append(publishLatencies, result.latency)
+	}
+	report.PublishLatency = Summarize(publishLatencies)
+	t.fill(report)
+	return report, nil
+}
+
+func publishRounds(ctx context.Context, client *messenger.Client, t *tracker, cfg Config, topic string, committee []types.OperatorID, operatorID types.OperatorID, results chan<- publishResult) {
+	recipients := make([]types.OperatorID, 0, len(committee)-1)
+	for _, id := range committee {
+		if id != operatorID {
+			recipients = append(recipients, id)
+		}
+	}
+
+	for round := 0; round < cfg.Rounds; round++ {
+		data, err := roundMessage(topic, operatorID, cfg.PayloadBytes)
+		if err != nil {
+			results <- publishResult{err: err}
+			continue
+		}
+		t.expect(data, recipients)
+		begin := time.Now()
+		err = client.Publish(ctx, topic, data)
+		results <- publishResult{latency: time.Since(begin), err: err}
+	}
+}
+
+func (t *tracker) fill(report *Report) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deliveries, fanOuts := []time.Duration{}, []time.Duration{}
+	for _, msg := range t.messages {
+		report.Expected += len(msg.recipients)
+		report.Delivered += len(msg.received)
+		var last time.Duration
+		for _, at := range msg.received {
+			latency := at.Sub(msg.publishedAt)
+			deliveries = append(deliveries, latency)
+			if latency > last {
+				last = latency
+			}
+		}
+		if len(msg.received) == len(msg.recipients) {
+			fanOuts = append(fanOuts, last)
+		}
+	}
+	report.Duplicates = t.duplicates
+	report.DeliveryLatency = Summarize(deliveries)
+	report.FanOut = Summarize(fanOuts)
+}
+
+// roundMessage builds a round 1 message of the size of a real one for the
+// payload, the messenger decodes it but doesn't verify the signature
+func roundMessage(topic string, operatorID types.OperatorID, payloadBytes int) ([]byte, error) {
+	requestID := dkg.RequestID{}
+	byts, err := hex.DecodeString(topic)
+	if err != nil {
+		return nil, err
+	}
+	copy(requestID[:], byts)
+
+	commitment := make([]byte, payloadBytes)
+	signature := make([]byte, 256)
+	if _, err := rand.Read(commitment); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(signature); err != nil {
+		return nil, err
+	}
+
+	protocolMsg := &frost.ProtocolMsg{
+		Round:         common.Round1,
+		Round1Message: &frost.Round1Message{Commitment: [][]byte{commitment}},
+	}
+	data, err := protocolMsg.Encode()
+	if err != nil {
+		return nil, err
+	}
+	signedMsg := &dkg.SignedMessage{
+		Message: &dkg.Message{
+			MsgType:    dkg.ProtocolMsgType,
+			Identifier: requestID,
+			Data:       data,
+		},
+		Signer:    operatorID,
+		Signature: signature,
+	}
+	signedBytes, err := signedMsg.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return (&types.SSVMessage{MsgType: types.DKGMsgType, Data: signedBytes}).Encode()
+}
+
+func randomTopic() string {
+	requestID := dkg.RequestID{}
+	_, _ = rand.Read(requestID[:])
+	return hex.EncodeToString(requestID[:])
+}
+
+func topicJSON(topic string, committee []types.OperatorID) *messenger.TopicJSON {
+	subscribers := make([]string, 0, len(committee))
+	for _, id := range committee {
+		subscribers = append(subscribers, strconv.Itoa(int(id)))
+	}
+	return &messenger.TopicJSON{TopicName: topic, Subscribers: subscribers}
+}
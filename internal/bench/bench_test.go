@@ -0,0 +1,98 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package bench
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	samples := []time.Duration{}
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	stats := Summarize(samples)
+	require.Equal(t, 100, stats.Count)
+	require.Equal(t, time.Millisecond, stats.Min)
+	require.Equal(t, 100*time.Millisecond, stats.Max)
+	require.Equal(t, 50*time.Millisecond, stats.P50)
+	require.Equal(t, 90*time.Millisecond, stats.P90)
+	require.Equal(t, 99*time.Millisecond, stats.P99)
+	require.Equal(t, 50500*time.Microsecond, stats.Mean)
+
+	require.Equal(t, Stats{}, Summarize(nil))
+}
+
+func TestRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	m := &messenger.Messenger{
+		Topics:   map[string]*messenger.Topic{messenger.DefaultTopic: messenger.NewTopic(messenger.DefaultTopic)},
+		Incoming: make(chan *messenger.Message, 50),
+		Data:     make(map[string]*messenger.DataStore),
+	}
+	m.WithLogger(logger)
+	runner := workers.NewRunner(logger)
+	go runner.Run()
+	runner.AddJob(&workers.Job{ID: "TOPIC__default", Fn: m.ProcessIncomingMessageWorker})
+
+	r := gin.New()
+	r.POST("/topics", m.HandleCreateTopic())
+	r.DELETE("/topics/:topic_name", m.DeleteTopic())
+	r.POST("/register_node", m.HandleNodeRegistration(runner))
+	r.POST("/publish", m.HandlePublish())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.MessengerAddr = srv.URL
+	cfg.Ceremonies = 5
+	cfg.Operators = 5
+	cfg.Rounds = 2
+	cfg.PayloadBytes = 64
+	cfg.Drain = 10 * time.Second
+
+	report, err := Run(context.Background(), cfg)
+	require.NoError(t, err)
+	require.Equal(t, 5*4*2, report.Published)
+	require.Zero(t, report.PublishFailures)
+	require.Equal(t, report.Published*3, report.Expected)
+	require.Equal(t, report.Expected, report.Delivered)
+	require.Zero(t, report.FailureRate())
+	require.Equal(t, report.Published, report.FanOut.Count)
+	require.Len(t, m.Topics, 1, "ceremony topics are deleted")
+
+	cfg.Committee = 6
+	_, err = Run(context.Background(), cfg)
+	require.Error(t, err)
+}
@@ -0,0 +1,80 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultCanaryTTL is how long nodes keep the share of a canary keygen
+	DefaultCanaryTTL = time.Hour
+	// MaxCanaryTTL bounds the ttl an initiator can ask for
+	MaxCanaryTTL = 7 * 24 * time.Hour
+
+	canaryQueryKey = "canary_ttl"
+)
+
+// Canary marks a keygen run by a production committee to check its health,
+// its result never backs a validator and nodes delete their share once it
+// expires
+type Canary struct {
+	// ExpiresAt is when the node deletes its share, in unix seconds
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+func (c *Canary) Expired(now time.Time) bool {
+	return now.Unix() >= c.ExpiresAt
+}
+
+// CanaryQuery marks a start message as canary keygen whose share lives for ttl
+func CanaryQuery(ttl time.Duration) url.Values {
+	query := url.Values{}
+	if ttl > 0 {
+		query.Set(canaryQueryKey, ttl.String())
+	}
+	return query
+}
+
+// ParseCanary reads the ttl set by CanaryQuery, it returns nil for ceremonies
+// that aren't canaries
+func ParseCanary(query url.Values, now time.Time) (*Canary, error) {
+	value := query.Get(canaryQueryKey)
+	if value == "" {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", canaryQueryKey, err)
+	}
+	if ttl <= 0 || ttl > MaxCanaryTTL {
+		return nil, fmt.Errorf("invalid %s: %s is not between 0 and %s", canaryQueryKey, ttl, MaxCanaryTTL)
+	}
+	return &Canary{ExpiresAt: now.Add(ttl).Unix()}, nil
+}
+
+// IsCanary reports whether the ceremony is a canary keygen
+func (c *Ceremony) IsCanary() bool {
+	return c.Params != nil && c.Params.Canary != nil
+}
@@ -0,0 +1,56 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanaryQuery(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	canary, err := ParseCanary(CanaryQuery(2*time.Hour), now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(2*time.Hour).Unix(), canary.ExpiresAt)
+	require.False(t, canary.Expired(now))
+	require.True(t, canary.Expired(now.Add(2*time.Hour)))
+
+	canary, err = ParseCanary(CanaryQuery(0), now)
+	require.NoError(t, err)
+	require.Nil(t, canary, "not a canary")
+}
+
+func TestParseCanaryInvalid(t *testing.T) {
+	for _, value := range []string{"soon", "-1h", "0s", (MaxCanaryTTL + time.Second).String()} {
+		_, err := ParseCanary(url.Values{canaryQueryKey: {value}}, time.Now())
+		require.Error(t, err, value)
+	}
+}
+
+func TestCeremonyIsCanary(t *testing.T) {
+	require.False(t, (&Ceremony{}).IsCanary())
+	require.False(t, (&Ceremony{Params: &Params{}}).IsCanary())
+	require.True(t, (&Ceremony{Params: &Params{Canary: &Canary{}}}).IsCanary())
+}
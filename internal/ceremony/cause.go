@@ -0,0 +1,125 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"strings"
+
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+)
+
+// Cause categorizes why a ceremony failed or a message was rejected, the same
+// causes label the failure metrics of every node and the messenger
+type Cause string
+
+const (
+	// CauseInvalidShare is a blame for a share that doesn't match its commitments
+	CauseInvalidShare Cause = "invalid_share"
+	// CauseInconsistentMessage is a blame for two different messages of one round
+	CauseInconsistentMessage Cause = "inconsistent_message"
+	// CauseInvalidMessage is a blame for a message with invalid values
+	CauseInvalidMessage Cause = "invalid_message"
+	// CauseEquivocation is a blame for two different messages of one round
+	// caught by the transcript of a node, before the second one reached the
+	// dkg protocol
+	CauseEquivocation Cause = "equivocation"
+	// CauseMissingMessage is a phase that timed out waiting for some operators
+	CauseMissingMessage Cause = "missing_message"
+	CauseBadSignature   Cause = "bad_signature"
+	// CauseTimeout is a round timeout of the dkg protocol, or a phase that
+	// timed out without knowing whom it waited for
+	CauseTimeout       Cause = "timeout"
+	CauseDecodeFailure Cause = "decode_failure"
+	// CauseCancelled is a ceremony aborted by the operator that started it
+	CauseCancelled Cause = "cancelled"
+	// CauseRestarted is a ceremony the node aborted when it restarted
+	CauseRestarted Cause = "restarted"
+	CauseOther     Cause = "other"
+)
+
+// Causes are all the causes, in the order they are listed
+var Causes = []Cause{
+	CauseInvalidShare, CauseInconsistentMessage, CauseInvalidMessage, CauseEquivocation, CauseMissingMessage, CauseBadSignature,
+	CauseTimeout, CauseDecodeFailure, CauseCancelled, CauseRestarted, CauseOther,
+}
+
+// BlameCause is the cause of a blame of the frost protocol
+func BlameCause(t frost.BlameType) Cause {
+	switch t {
+	case frost.InvalidShare:
+		return CauseInvalidShare
+	case frost.InconsistentMessage:
+		return CauseInconsistentMessage
+	case frost.InvalidMessage:
+		return CauseInvalidMessage
+	}
+	return CauseOther
+}
+
+// BlameMessageCause is the cause of a blame message. The frost protocol always
+// reveals the session key of the blamer, blames of inconsistent messages
+// without one come from the transcript of a node.
+func BlameMessageCause(blame *frost.BlameMessage) Cause {
+	if blame.Type == frost.InconsistentMessage && len(blame.BlamerSessionSk) == 0 {
+		return CauseEquivocation
+	}
+	return BlameCause(blame.Type)
+}
+
+// ErrorCause categorizes an error of the dkg flow by its message, the dkg
+// library doesn't wrap its errors in types to tell them apart
+func ErrorCause(message string) Cause {
+	message = strings.ToLower(message)
+	switch {
+	case strings.Contains(message, "signature") || strings.Contains(message, "signed message invalid") ||
+		strings.Contains(message, "sig invalid") || strings.Contains(message, "signed output invalid"):
+		return CauseBadSignature
+	case strings.Contains(message, "decode") || strings.Contains(message, "deserialize") ||
+		strings.Contains(message, "unmarshal") || strings.Contains(message, "invalid character"):
+		return CauseDecodeFailure
+	case strings.Contains(message, "timeout") || strings.Contains(message, "timed out"):
+		return CauseTimeout
+	}
+	return CauseOther
+}
+
+// eventCause is the cause of a failure or rejection event recorded without
+// one, e.g. stored before causes were recorded
+func eventCause(e *Event) Cause {
+	switch e.Type {
+	case EventTimedOut:
+		if len(e.Missing) > 0 {
+			return CauseMissingMessage
+		}
+		return CauseTimeout
+	case EventBlamed:
+		for _, t := range []frost.BlameType{frost.InvalidShare, frost.InconsistentMessage, frost.InvalidMessage} {
+			if e.Details == t.ToString() {
+				return BlameCause(t)
+			}
+		}
+		return CauseOther
+	case EventAborted, EventMessageRejected:
+		return ErrorCause(e.Details)
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ceremony is the state of a single dkg request as seen by this node. It is
+// never stored directly, only rebuilt from its events.
+type Ceremony struct {
+	RequestID string `json:"request_id"`
+	State     State  `json:"state"`
+	// Cause is why an aborted or blamed ceremony failed
+	Cause     Cause     `json:"cause,omitempty"`
+	Params    *Params   `json:"params,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Events    []*Event  `json:"events"`
+}
+
+func New(requestID string) *Ceremony {
+	return &Ceremony{
+		RequestID: requestID,
+		State:     StateNone,
+		Events:    make([]*Event, 0),
+	}
+}
+
+// Apply validates the event against the current state and appends it
+func (c *Ceremony) Apply(e *Event) error {
+	next, err := Next(c.State, e.Type)
+	if err != nil {
+		return err
+	}
+	if e.Seq != uint64(len(c.Events)+1) {
+		return fmt.Errorf("out of order ceremony event: expected seq %d got %d", len(c.Events)+1, e.Seq)
+	}
+	if e.Type == EventCreated {
+		if e.Params == nil {
+			return fmt.Errorf("created event without ceremony params")
+		}
+		c.Params = e.Params
+		c.CreatedAt = e.Time
+	}
+
+	if e.Cause == "" {
+		e.Cause = eventCause(e)
+	}
+	if next == StateAborted || next == StateBlamed {
+		c.Cause = e.Cause
+	}
+
+	c.State = next
+	c.UpdatedAt = e.Time
+	c.Events = append(c.Events, e)
+	return nil
+}
+
+// Replay rebuilds a ceremony from its stored events
+func Replay(requestID string, events []*Event) (*Ceremony, error) {
+	c := New(requestID)
+	for _, e := range events {
+		if err := c.Apply(e); err != nil {
+			return nil, fmt.Errorf("failed to replay ceremony %s: %w", requestID, err)
+		}
+	}
+	return c, nil
+}
+
+// NextEvent returns an event with the next sequence number for this ceremony
+func (c *Ceremony) NextEvent(t EventType) *Event {
+	return &Event{
+		Seq:  uint64(len(c.Events) + 1),
+		Type: t,
+		Time: time.Now().UTC(),
+	}
+}
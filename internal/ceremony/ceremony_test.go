@@ -0,0 +1,194 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+type memStore struct {
+	events map[string][]*Event
+}
+
+func (s *memStore) AppendCeremonyEvent(requestID string, e *Event) error {
+	s.events[requestID] = append(s.events[requestID], e)
+	return nil
+}
+
+func (s *memStore) GetCeremonyEvents(requestID string) ([]*Event, error) {
+	events, ok := s.events[requestID]
+	if !ok {
+		return nil, ErrCeremonyNotFound
+	}
+	return events, nil
+}
+
+var allEvents = []EventType{
+	EventCreated, EventInitialized, EventRound1, EventRound2, EventOutputPending,
+	EventCompleted, EventAborted, EventBlamed, EventTimedOut, EventMessageReceived, EventMessageRejected,
+	EventPhaseExtended, EventPeerUnresponsive,
+}
+
+func testParams() *Params {
+	return &Params{Kind: KindKeygen, Operators: []types.OperatorID{1, 2, 3, 4}, Threshold: 3}
+}
+
+func TestCeremonyHappyPath(t *testing.T) {
+	c := New("req")
+	for _, eventType := range []EventType{EventCreated, EventInitialized, EventMessageReceived, EventRound1, EventRound2, EventOutputPending, EventCompleted} {
+		e := c.NextEvent(eventType)
+		if eventType == EventCreated {
+			e.Params = testParams()
+		}
+		require.NoError(t, c.Apply(e))
+	}
+	require.Equal(t, StateCompleted, c.State)
+	require.Len(t, c.Events, 7)
+
+	err := c.Apply(c.NextEvent(EventRound1))
+	require.Error(t, err)
+	require.IsType(t, &ErrIllegalTransition{}, err)
+}
+
+func TestCeremonyRejectsBadEvents(t *testing.T) {
+	c := New("req")
+	require.Error(t, c.Apply(c.NextEvent(EventCreated)), "created event needs params")
+	require.Error(t, c.Apply(c.NextEvent(EventMessageReceived)), "progress before created")
+
+	e := c.NextEvent(EventCreated)
+	e.Params = testParams()
+	e.Seq = 5
+	require.Error(t, c.Apply(e), "out of order seq")
+}
+
+func TestCeremonyCause(t *testing.T) {
+	start := func() *Ceremony {
+		c := New("req")
+		e := c.NextEvent(EventCreated)
+		e.Params = testParams()
+		require.NoError(t, c.Apply(e))
+		require.NoError(t, c.Apply(c.NextEvent(EventInitialized)))
+		return c
+	}
+
+	c := start()
+	rejected := c.NextEvent(EventMessageRejected)
+	rejected.Details = "failed to decode protocol msg"
+	require.NoError(t, c.Apply(rejected))
+	require.Equal(t, CauseDecodeFailure, rejected.Cause)
+	require.Empty(t, c.Cause, "a rejected message doesn't fail the ceremony")
+
+	timedOut := c.NextEvent(EventTimedOut)
+	timedOut.Missing = []types.OperatorID{2}
+	require.NoError(t, c.Apply(timedOut))
+	require.Equal(t, CauseMissingMessage, c.Cause)
+
+	// blames stored before causes were recorded are categorized by their type
+	c = start()
+	blamed := c.NextEvent(EventBlamed)
+	blamed.Details = "Invalid Share"
+	require.NoError(t, c.Apply(blamed))
+	require.Equal(t, CauseInvalidShare, c.Cause)
+
+	c = start()
+	aborted := c.NextEvent(EventAborted)
+	aborted.Details = "cancelled by orchestrator"
+	aborted.Cause = CauseCancelled
+	require.NoError(t, c.Apply(aborted))
+	require.Equal(t, CauseCancelled, c.Cause)
+
+	require.Equal(t, CauseBadSignature, ErrorCause("failed to Validate signed message: invalid signature"))
+	require.Equal(t, CauseTimeout, ErrorCause("round timeout"))
+	require.Equal(t, CauseOther, ErrorCause("signer not part of committee"))
+
+	// the frost protocol reveals the blamer's session key, a node's transcript can't
+	require.Equal(t, CauseInconsistentMessage, BlameMessageCause(&frost.BlameMessage{Type: frost.InconsistentMessage, BlamerSessionSk: []byte{1}}))
+	require.Equal(t, CauseEquivocation, BlameMessageCause(&frost.BlameMessage{Type: frost.InconsistentMessage}))
+	require.Equal(t, CauseInvalidShare, BlameMessageCause(&frost.BlameMessage{Type: frost.InvalidShare}))
+}
+
+// TestCeremonyRandomSequences applies random event sequences and checks that the
+// state machine invariants hold whatever the order of events
+func TestCeremonyRandomSequences(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		store := &memStore{events: make(map[string][]*Event)}
+		tracker := NewTracker(store)
+
+		for j := 0; j < 20; j++ {
+			eventType := allEvents[r.Intn(len(allEvents))]
+			before, err := tracker.Get("req")
+			if err == ErrCeremonyNotFound {
+				before = New("req")
+			}
+			expected, legal := Next(before.State, eventType)
+
+			after, err := tracker.Record("req", eventType, func(e *Event) {
+				if e.Type == EventCreated {
+					e.Params = testParams()
+				}
+			})
+			if legal != nil {
+				require.Error(t, err)
+				if before.State.IsTerminal() {
+					current, _ := tracker.Get("req")
+					require.Equal(t, before.State, current.State, "terminal states absorb every event")
+				}
+				continue
+			}
+			require.NoError(t, err)
+			require.Equal(t, expected, after.State)
+		}
+
+		// a fresh tracker over the same store must reach the same ceremony
+		cached, err := tracker.Get("req")
+		if err == ErrCeremonyNotFound {
+			continue
+		}
+		require.NoError(t, err)
+		replayed, err := NewTracker(store).Get("req")
+		require.NoError(t, err)
+		require.Equal(t, cached.State, replayed.State)
+		require.Equal(t, len(cached.Events), len(replayed.Events))
+	}
+}
+
+func TestParamsSameStart(t *testing.T) {
+	params := testParams()
+	same := testParams()
+	same.Operators = []types.OperatorID{4, 3, 2, 1}
+	same.Timeouts = &PhaseTimeouts{Round1: 1}
+	require.True(t, params.SameStart(same), "operator order and timeouts sent along don't matter")
+
+	other := testParams()
+	other.Threshold = 2
+	require.False(t, params.SameStart(other))
+
+	other = testParams()
+	other.Kind = KindKeySign
+	require.False(t, params.SameStart(other))
+}
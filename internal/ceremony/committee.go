@@ -0,0 +1,88 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"fmt"
+	"time"
+)
+
+// CommitteeSizes are the 3f+1 committees ssv clusters run and the dkg nodes
+// accept for a keygen
+var CommitteeSizes = []int{4, 7, 10, 13}
+
+const (
+	MinCommitteeSize = 4
+	MaxCommitteeSize = 13
+)
+
+// FaultTolerance is the number of operators a committee of size n can lose
+func FaultTolerance(n int) int {
+	return (n - 1) / 3
+}
+
+// ThresholdFor is the 2f+1 threshold the dkg nodes require for n operators
+func ThresholdFor(n int) uint64 {
+	return uint64(2*FaultTolerance(n) + 1)
+}
+
+// CheckCommittee returns an error unless n is a supported committee size and
+// threshold its 2f+1 threshold
+func CheckCommittee(n int, threshold uint64) error {
+	supported := false
+	for _, size := range CommitteeSizes {
+		supported = supported || size == n
+	}
+	if !supported {
+		return fmt.Errorf("%d operators is not a supported committee size, use one of %v", n, CommitteeSizes)
+	}
+	if threshold != ThresholdFor(n) {
+		return fmt.Errorf("threshold %d doesn't match the 2f+1 threshold %d of %d operators", threshold, ThresholdFor(n), n)
+	}
+	return nil
+}
+
+// ScaleTimeouts stretches timeouts tuned for a 4 operator committee to a
+// committee of n operators. Every operator checks one message per peer in
+// each round and round 1 carries an encrypted share for every peer, so the
+// phase deadlines grow with the committee: by half for 7 operators, double
+// for 10 and two and a half times for 13. The extension is kept so that the
+// default deadlines with their extension stay within the 10 minute round
+// timeout of the frost protocol.
+func ScaleTimeouts(t PhaseTimeouts, n int) PhaseTimeouts {
+	if n <= MinCommitteeSize {
+		return t
+	}
+	scaled := t
+	for _, d := range []*time.Duration{&scaled.InitAck, &scaled.Round1, &scaled.Round2, &scaled.Output} {
+		*d += time.Duration(int64(*d) * int64(n-MinCommitteeSize) / 6)
+	}
+	return scaled
+}
+
+// committeeSize is the largest committee taking part in the ceremony
+func (p *Params) committeeSize() int {
+	if len(p.OldOperators) > len(p.Operators) {
+		return len(p.OldOperators)
+	}
+	return len(p.Operators)
+}
@@ -0,0 +1,199 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+)
+
+// Limits bound what a node or the messenger accepts. Both advertise theirs on
+// GET /limits, the initiator negotiates the smallest of each before a
+// ceremony and carries the result to the nodes with the start message, so a
+// committee too large for one participant fails before it starts instead of
+// on a 413 halfway through.
+type Limits struct {
+	// MaxOperators bounds the operators taking part in a ceremony, old and new
+	// committee and observers
+	MaxOperators int `json:"max_operators"`
+	// MaxMessageBytes bounds a request body
+	MaxMessageBytes int64 `json:"max_message_bytes"`
+	// MaxBatchSize bounds the items of a list in one request or response, like
+	// the messages of a topic sync
+	MaxBatchSize int `json:"max_batch_size"`
+}
+
+// DefaultLimits fit a resharing between two committees of the largest size
+// with a few observers, with room for the messages of 13 operators many times over
+var DefaultLimits = Limits{
+	MaxOperators:    32,
+	MaxMessageBytes: 1 << 20,
+	MaxBatchSize:    500,
+}
+
+var limitQueryKeys = []string{"limit_max_operators", "limit_max_message_bytes", "limit_max_batch_size"}
+
+// ErrLimitExceeded is returned when a ceremony or a request is larger than a
+// limit allows, it is the messenger client's so refusals of either are the same
+type ErrLimitExceeded = messengerclient.ErrLimitExceeded
+
+// IsLimitExceeded reports whether err is or wraps an ErrLimitExceeded
+func IsLimitExceeded(err error) bool {
+	var limitErr *ErrLimitExceeded
+	return errors.As(err, &limitErr)
+}
+
+// OrDefault fills the limits that aren't set with the defaults
+func (l Limits) OrDefault() Limits {
+	if l.MaxOperators <= 0 {
+		l.MaxOperators = DefaultLimits.MaxOperators
+	}
+	if l.MaxMessageBytes <= 0 {
+		l.MaxMessageBytes = DefaultLimits.MaxMessageBytes
+	}
+	if l.MaxBatchSize <= 0 {
+		l.MaxBatchSize = DefaultLimits.MaxBatchSize
+	}
+	return l
+}
+
+// Negotiate returns the smallest of each limit, the limits every participant accepts
+func Negotiate(limits ...Limits) Limits {
+	negotiated := Limits{}
+	for _, l := range limits {
+		l = l.OrDefault()
+		if negotiated.MaxOperators == 0 || l.MaxOperators < negotiated.MaxOperators {
+			negotiated.MaxOperators = l.MaxOperators
+		}
+		if negotiated.MaxMessageBytes == 0 || l.MaxMessageBytes < negotiated.MaxMessageBytes {
+			negotiated.MaxMessageBytes = l.MaxMessageBytes
+		}
+		if negotiated.MaxBatchSize == 0 || l.MaxBatchSize < negotiated.MaxBatchSize {
+			negotiated.MaxBatchSize = l.MaxBatchSize
+		}
+	}
+	return negotiated.OrDefault()
+}
+
+// Covers returns an error when negotiated allows more than l, a node refuses
+// to start a ceremony negotiated without it
+func (l Limits) Covers(negotiated Limits) error {
+	l = l.OrDefault()
+	if negotiated.MaxOperators > l.MaxOperators {
+		return &ErrLimitExceeded{Limit: "negotiated max operators", Value: int64(negotiated.MaxOperators), Max: int64(l.MaxOperators)}
+	}
+	if negotiated.MaxMessageBytes > l.MaxMessageBytes {
+		return &ErrLimitExceeded{Limit: "negotiated max message bytes", Value: negotiated.MaxMessageBytes, Max: l.MaxMessageBytes}
+	}
+	if negotiated.MaxBatchSize > l.MaxBatchSize {
+		return &ErrLimitExceeded{Limit: "negotiated max batch size", Value: int64(negotiated.MaxBatchSize), Max: int64(l.MaxBatchSize)}
+	}
+	return nil
+}
+
+// CheckOperators returns an error when n operators are more than a ceremony may have
+func (l Limits) CheckOperators(n int) error {
+	if max := l.OrDefault().MaxOperators; n > max {
+		return &ErrLimitExceeded{Limit: "operators", Value: int64(n), Max: int64(max)}
+	}
+	return nil
+}
+
+// CheckMessage returns an error when a message of size bytes is too large
+func (l Limits) CheckMessage(size int64) error {
+	if max := l.OrDefault().MaxMessageBytes; size > max {
+		return &ErrLimitExceeded{Limit: "message bytes", Value: size, Max: max}
+	}
+	return nil
+}
+
+// CheckBatch returns an error when a list of n items is too long
+func (l Limits) CheckBatch(n int) error {
+	if max := l.OrDefault().MaxBatchSize; n > max {
+		return &ErrLimitExceeded{Limit: "batch size", Value: int64(n), Max: int64(max)}
+	}
+	return nil
+}
+
+// EstimateMessageBytes is an upper bound of the largest message a committee of
+// n operators sends, its round 1 message: up to n commitments of 48 bytes and
+// an rsa encrypted share of 256 bytes for every peer, with proofs and the
+// signature. The message is json encoded three times over, each time
+// inflating byte fields by a third in base64.
+func EstimateMessageBytes(n int) int64 {
+	raw := int64(1024 + (48+256)*n)
+	return raw*64/27 + 1024
+}
+
+// Query returns the limits as consume query parameters
+func (l Limits) Query() url.Values {
+	query := url.Values{}
+	for i, value := range []int64{int64(l.MaxOperators), l.MaxMessageBytes, int64(l.MaxBatchSize)} {
+		if value > 0 {
+			query.Set(limitQueryKeys[i], strconv.FormatInt(value, 10))
+		}
+	}
+	return query
+}
+
+// ParseLimits reads the limits set by Query, it returns nil when none is set
+func ParseLimits(query url.Values) (*Limits, error) {
+	values := make([]int64, len(limitQueryKeys))
+	found := false
+	for i, key := range limitQueryKeys {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", key, value)
+		}
+		values[i] = parsed
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	return &Limits{MaxOperators: int(values[0]), MaxMessageBytes: values[1], MaxBatchSize: int(values[2])}, nil
+}
+
+// ReadBody reads a request body of at most max bytes
+func ReadBody(r *http.Request, max int64) ([]byte, error) {
+	if r.ContentLength > max {
+		return nil, &ErrLimitExceeded{Limit: "message bytes", Value: r.ContentLength, Max: max}
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, &ErrLimitExceeded{Limit: "message bytes", Value: int64(len(data)), Max: max}
+	}
+	return data, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateLimits(t *testing.T) {
+	negotiated := Negotiate(
+		Limits{MaxOperators: 16, MaxMessageBytes: 1 << 20},
+		Limits{MaxOperators: 32, MaxMessageBytes: 1 << 18, MaxBatchSize: 100},
+		Limits{},
+	)
+	require.Equal(t, Limits{MaxOperators: 16, MaxMessageBytes: 1 << 18, MaxBatchSize: 100}, negotiated)
+	require.Equal(t, DefaultLimits, Negotiate())
+
+	require.NoError(t, DefaultLimits.Covers(negotiated))
+	err := negotiated.Covers(DefaultLimits)
+	require.True(t, IsLimitExceeded(err))
+	require.EqualError(t, err, "negotiated max operators 32 exceeds the limit of 16")
+}
+
+func TestLimitsQuery(t *testing.T) {
+	limits := Limits{MaxOperators: 7, MaxMessageBytes: 4096, MaxBatchSize: 50}
+	parsed, err := ParseLimits(limits.Query())
+	require.NoError(t, err)
+	require.Equal(t, &limits, parsed)
+
+	parsed, err = ParseLimits(nil)
+	require.NoError(t, err)
+	require.Nil(t, parsed)
+
+	query := limits.Query()
+	query.Set("limit_max_batch_size", "-1")
+	_, err = ParseLimits(query)
+	require.Error(t, err)
+}
+
+func TestDefaultLimitsFitLargestCommittee(t *testing.T) {
+	require.NoError(t, DefaultLimits.CheckOperators(13+13+4))
+	require.NoError(t, DefaultLimits.CheckMessage(EstimateMessageBytes(13)))
+	require.True(t, IsLimitExceeded(Limits{MaxMessageBytes: 8 << 10}.CheckMessage(EstimateMessageBytes(13))))
+}
+
+func TestReadBody(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(make([]byte, 10)))
+	data, err := ReadBody(req, 10)
+	require.NoError(t, err)
+	require.Len(t, data, 10)
+
+	req = httptest.NewRequest("POST", "/", bytes.NewReader(make([]byte, 11)))
+	_, err = ReadBody(req, 10)
+	require.True(t, IsLimitExceeded(err))
+
+	// a body without content length is cut at the limit
+	req = httptest.NewRequest("POST", "/", bytes.NewReader(make([]byte, 11)))
+	req.ContentLength = -1
+	_, err = ReadBody(req, 10)
+	require.True(t, IsLimitExceeded(err))
+}
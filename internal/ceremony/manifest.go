@@ -0,0 +1,239 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/cryptosuite"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// ManifestVersion is the version of the manifest format this node hashes
+const ManifestVersion = 1
+
+const manifestQueryKey = "manifest"
+
+var manifestLabel = []byte("rockx-dkg-manifest")
+
+// Manifest holds every parameter of a keygen or resharing, and is addressed by
+// its hash. It leaves out the request ID, so running a ceremony again with
+// the same parameters yields the same hash.
+type Manifest struct {
+	Version      int                `json:"version"`
+	Kind         Kind               `json:"kind"`
+	Operators    []types.OperatorID `json:"operators"`
+	OldOperators []types.OperatorID `json:"old_operators,omitempty"`
+	Threshold    uint64             `json:"threshold"`
+	// WithdrawalCredentials and ForkVersion of a keygen deposit, hex encoded
+	WithdrawalCredentials string `json:"withdrawal_credentials,omitempty"`
+	ForkVersion           string `json:"fork_version,omitempty"`
+	// ValidatorPK a resharing keeps, hex encoded
+	ValidatorPK        string  `json:"validator_pk,omitempty"`
+	MinProtocolVersion uint32  `json:"min_protocol_version,omitempty"`
+	Options            Options `json:"options,omitempty"`
+	// Suite is the ID of the crypto suite of the ceremony, the default one
+	// when empty
+	Suite string `json:"suite,omitempty"`
+}
+
+// canonical is the manifest with sorted operators, lower case hex and without
+// options set to their default, the form that is hashed
+func (m *Manifest) canonical() *Manifest {
+	c := *m
+	c.Operators = sortedOperators(m.Operators)
+	c.OldOperators = sortedOperators(m.OldOperators)
+	c.WithdrawalCredentials = strings.ToLower(strings.TrimPrefix(m.WithdrawalCredentials, "0x"))
+	c.ForkVersion = strings.ToLower(strings.TrimPrefix(m.ForkVersion, "0x"))
+	c.ValidatorPK = strings.ToLower(strings.TrimPrefix(m.ValidatorPK, "0x"))
+	c.Suite = cryptosuite.Canonical(m.Suite)
+	c.Options = nil
+	for key, value := range m.Options {
+		if values, ok := SupportedOptions[key]; ok && values[0] == value {
+			continue
+		}
+		if c.Options == nil {
+			c.Options = make(Options)
+		}
+		c.Options[key] = value
+	}
+	return &c
+}
+
+// Hash is the hex encoded digest of the canonical json of the manifest with
+// the hash of its crypto suite, sha256 for the default one. It is empty for
+// a suite this node doesn't know.
+func (m *Manifest) Hash() string {
+	suite, err := cryptosuite.Lookup(m.Suite)
+	if err != nil {
+		return ""
+	}
+	byts, _ := json.Marshal(m.canonical())
+	return hex.EncodeToString(suite.Digest(byts))
+}
+
+// Matches checks the manifest against the parameters of the signed start
+// message, the options and the minimum protocol version sent along with it
+func (m *Manifest) Matches(params *Params, options Options, minVersion uint32) error {
+	if m.Version != ManifestVersion {
+		return fmt.Errorf("manifest version %d, expected %d", m.Version, ManifestVersion)
+	}
+	c, p := m.canonical(), (&Manifest{
+		Kind:                  params.Kind,
+		Operators:             params.Operators,
+		OldOperators:          params.OldOperators,
+		Threshold:             params.Threshold,
+		WithdrawalCredentials: params.WithdrawalCredentials,
+		ForkVersion:           params.ForkVersion,
+		ValidatorPK:           params.ValidatorPK,
+		Options:               options,
+	}).canonical()
+	switch {
+	case c.Kind != p.Kind:
+		return fmt.Errorf("manifest is for a %s, start message is a %s", c.Kind, p.Kind)
+	case !sameOperators(c.Operators, p.Operators):
+		return fmt.Errorf("manifest operators %v, start message has %v", c.Operators, p.Operators)
+	case !sameOperators(c.OldOperators, p.OldOperators):
+		return fmt.Errorf("manifest old operators %v, start message has %v", c.OldOperators, p.OldOperators)
+	case c.Threshold != p.Threshold:
+		return fmt.Errorf("manifest threshold %d, start message has %d", c.Threshold, p.Threshold)
+	case c.WithdrawalCredentials != p.WithdrawalCredentials:
+		return fmt.Errorf("manifest withdrawal credentials %s, start message has %s", c.WithdrawalCredentials, p.WithdrawalCredentials)
+	case c.ForkVersion != p.ForkVersion:
+		return fmt.Errorf("manifest fork version %s, start message has %s", c.ForkVersion, p.ForkVersion)
+	case c.ValidatorPK != p.ValidatorPK:
+		return fmt.Errorf("manifest validator pk %s, start message has %s", c.ValidatorPK, p.ValidatorPK)
+	case c.Options.String() != p.Options.String():
+		return fmt.Errorf("manifest options %q, start message has %q", c.Options.String(), p.Options.String())
+	case c.MinProtocolVersion != minVersion:
+		return fmt.Errorf("manifest minimum protocol version %d, start message claims %d", c.MinProtocolVersion, minVersion)
+	}
+	return nil
+}
+
+// SignedManifest binds a manifest to one ceremony, the initiator signs its
+// hash with the request ID of the start message
+type SignedManifest struct {
+	RequestID string           `json:"request_id"`
+	Signer    types.OperatorID `json:"signer"`
+	Hash      string           `json:"hash"`
+	Manifest  *Manifest        `json:"manifest"`
+	Signature string           `json:"signature,omitempty"`
+}
+
+func (s *SignedManifest) signingRoot() []byte {
+	data := append([]byte{}, manifestLabel...)
+	data = append(data, []byte(s.RequestID)...)
+	data = binary.BigEndian.AppendUint64(data, uint64(s.Signer))
+	return append(data, []byte(s.Hash)...)
+}
+
+// SignManifest signs the hash of manifest for the ceremony requestID with the
+// initiator's operator key
+func SignManifest(sk *rsa.PrivateKey, signer types.OperatorID, requestID string, manifest *Manifest) (*SignedManifest, error) {
+	signed := &SignedManifest{RequestID: requestID, Signer: signer, Hash: manifest.Hash(), Manifest: manifest}
+	hashed := sha256.Sum256(signed.signingRoot())
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sk, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, fmt.Errorf("SignManifest: failed to sign manifest: %w", err)
+	}
+	signed.Signature = hex.EncodeToString(signature)
+	return signed, nil
+}
+
+// Verify checks the manifest hashes to the signed hash and the signature of
+// the initiator key pk
+func (s *SignedManifest) Verify(pk *rsa.PublicKey) error {
+	if s.Manifest == nil {
+		return fmt.Errorf("signed manifest without manifest")
+	}
+	if _, err := cryptosuite.Lookup(s.Manifest.Suite); err != nil {
+		return err
+	}
+	if hash := s.Manifest.Hash(); hash != s.Hash {
+		return fmt.Errorf("manifest hashes to %s, not to the signed hash %s", hash, s.Hash)
+	}
+	signature, err := hex.DecodeString(s.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid manifest signature encoding: %w", err)
+	}
+	if !types.Verify(pk, s.signingRoot(), signature) {
+		return fmt.Errorf("invalid manifest signature of operator %d", s.Signer)
+	}
+	return nil
+}
+
+// Query carries the signed manifest in the query of a start message
+func (s *SignedManifest) Query() url.Values {
+	byts, _ := json.Marshal(s)
+	return url.Values{manifestQueryKey: []string{base64.RawURLEncoding.EncodeToString(byts)}}
+}
+
+// ParseSignedManifest reads the manifest set by Query, it returns nil for
+// start messages sent without one
+func ParseSignedManifest(query url.Values) (*SignedManifest, error) {
+	value := query.Get(manifestQueryKey)
+	if value == "" {
+		return nil, nil
+	}
+	byts, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestQueryKey, err)
+	}
+	signed := &SignedManifest{}
+	if err := json.Unmarshal(byts, signed); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestQueryKey, err)
+	}
+	return signed, nil
+}
+
+func sortedOperators(operators []types.OperatorID) []types.OperatorID {
+	if len(operators) == 0 {
+		return nil
+	}
+	sorted := append([]types.OperatorID{}, operators...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func sameOperators(a, b []types.OperatorID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
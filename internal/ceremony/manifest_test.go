@@ -0,0 +1,126 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/cryptosuite"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/stretchr/testify/require"
+)
+
+func testManifest() *Manifest {
+	return &Manifest{
+		Version:               ManifestVersion,
+		Kind:                  KindKeygen,
+		Operators:             []types.OperatorID{1, 2, 3, 4},
+		Threshold:             3,
+		WithdrawalCredentials: "010000000000000000000000535953b5a6040074948cf185eaa7d2abbd66808f",
+		ForkVersion:           "00000000",
+		MinProtocolVersion:    ProtocolV2,
+	}
+}
+
+func TestManifestHash(t *testing.T) {
+	manifest := testManifest()
+	hash := manifest.Hash()
+	require.Len(t, hash, 64)
+
+	same := testManifest()
+	same.Operators = []types.OperatorID{4, 2, 1, 3}
+	same.WithdrawalCredentials = "0x" + "010000000000000000000000535953B5A6040074948CF185EAA7D2ABBD66808F"
+	same.Options = Options{OptionEncryption: "off"}
+	require.Equal(t, hash, same.Hash(), "operator order, hex case and default options don't change the hash")
+
+	other := testManifest()
+	other.Options = Options{OptionEncryption: "on"}
+	require.NotEqual(t, hash, other.Hash())
+
+	other = testManifest()
+	other.Threshold = 2
+	require.NotEqual(t, hash, other.Hash())
+
+	same = testManifest()
+	same.Suite = cryptosuite.Default
+	require.Equal(t, hash, same.Hash(), "manifests without a suite are of the default one")
+
+	other = testManifest()
+	other.Suite = "unknown"
+	require.Empty(t, other.Hash())
+}
+
+func TestManifestMatches(t *testing.T) {
+	manifest := testManifest()
+	params := &Params{
+		Kind:                  KindKeygen,
+		Operators:             []types.OperatorID{3, 1, 2, 4},
+		Threshold:             3,
+		WithdrawalCredentials: manifest.WithdrawalCredentials,
+		ForkVersion:           manifest.ForkVersion,
+	}
+	require.NoError(t, manifest.Matches(params, nil, ProtocolV2))
+	require.Error(t, manifest.Matches(params, nil, ProtocolV1), "minimum protocol version")
+	require.Error(t, manifest.Matches(params, Options{OptionTranscript: "off"}, ProtocolV2), "options")
+
+	params.Operators = []types.OperatorID{1, 2, 3, 5}
+	require.Error(t, manifest.Matches(params, nil, ProtocolV2), "operators")
+
+	params.Operators, params.ForkVersion = manifest.Operators, "00001020"
+	require.Error(t, manifest.Matches(params, nil, ProtocolV2), "fork version")
+}
+
+func TestSignedManifest(t *testing.T) {
+	ks := testingutils.TestingKeygenKeySet()
+	sk := ks.DKGOperators[1].EncryptionKey
+
+	signed, err := SignManifest(sk, 1, "0a0b", testManifest())
+	require.NoError(t, err)
+	require.Equal(t, testManifest().Hash(), signed.Hash)
+	require.NoError(t, signed.Verify(&sk.PublicKey))
+
+	parsed, err := ParseSignedManifest(signed.Query())
+	require.NoError(t, err)
+	require.Equal(t, signed, parsed)
+	require.NoError(t, parsed.Verify(&sk.PublicKey))
+
+	other := ks.DKGOperators[2].EncryptionKey
+	require.Error(t, signed.Verify(&other.PublicKey), "signed by operator 1")
+
+	parsed.Manifest.Threshold = 2
+	require.Error(t, parsed.Verify(&sk.PublicKey), "manifest changed after signing")
+
+	parsed, err = ParseSignedManifest(url.Values{})
+	require.NoError(t, err)
+	require.Nil(t, parsed, "no manifest")
+
+	_, err = ParseSignedManifest(url.Values{"manifest": []string{"!"}})
+	require.Error(t, err)
+
+	manifest := testManifest()
+	manifest.Suite = "unknown"
+	signed, err = SignManifest(sk, 1, "0a0b", manifest)
+	require.NoError(t, err)
+	require.Error(t, signed.Verify(&sk.PublicKey), "unsupported crypto suite")
+}
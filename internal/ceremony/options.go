@@ -0,0 +1,156 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Options of a ceremony, passed by the initiator along with the start message,
+// switch optional node behaviors on and off without changing the messages of
+// the protocol. A node refuses a ceremony with an option it doesn't know or a
+// value it doesn't support.
+type Options map[string]string
+
+const (
+	// OptionEncryption=on has nodes join only when the start message reached
+	// them sealed to their operator key
+	OptionEncryption = "encryption"
+	// OptionTranscript=off has nodes keep no transcript of the ceremony
+	OptionTranscript = "transcript"
+	// OptionProgressEvents=on has nodes hand every event of the ceremony to
+	// their progress plugins
+	OptionProgressEvents = "progress-events"
+	// OptionPriority=urgent has the messenger relay the messages of the
+	// ceremony and nodes process them ahead of the ones of normal ceremonies
+	OptionPriority = "priority"
+
+	optionsQueryKey = "option"
+)
+
+// SupportedOptions lists the values nodes accept for every option, the first
+// one is the default
+var SupportedOptions = map[string][]string{
+	OptionEncryption:     {"off", "on"},
+	OptionTranscript:     {"full", "off"},
+	OptionProgressEvents: {"off", "on"},
+	OptionPriority:       {"normal", "urgent"},
+}
+
+// ParseOptions reads key=value pairs, like the --option flags of the cli
+func ParseOptions(pairs []string) (Options, error) {
+	options := make(Options)
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid ceremony option %q, expected key=value", pair)
+		}
+		if previous, ok := options[key]; ok && previous != value {
+			return nil, fmt.Errorf("ceremony option %s set to both %s and %s", key, previous, value)
+		}
+		options[key] = value
+	}
+	return options, nil
+}
+
+// Keys of the options, sorted
+func (o Options) Keys() []string {
+	keys := make([]string, 0, len(o))
+	for key := range o {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Query carries the options to the nodes along with the start message
+func (o Options) Query() url.Values {
+	query := url.Values{}
+	for _, key := range o.Keys() {
+		query.Add(optionsQueryKey, key+"="+o[key])
+	}
+	return query
+}
+
+// OptionsFromQuery reads the options set by Query, it returns nil for
+// ceremonies started without any
+func OptionsFromQuery(query url.Values) (Options, error) {
+	pairs := query[optionsQueryKey]
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	return ParseOptions(pairs)
+}
+
+// Validate checks every option is one of supported with one of its values
+func (o Options) Validate(supported map[string][]string) error {
+	for _, key := range o.Keys() {
+		values, ok := supported[key]
+		if !ok {
+			return fmt.Errorf("unsupported ceremony option %s", key)
+		}
+		if !contains(values, o[key]) {
+			return fmt.Errorf("unsupported value %s of ceremony option %s, expected one of %s", o[key], key, strings.Join(values, ", "))
+		}
+	}
+	return nil
+}
+
+// Get returns the value of the option key, or its default when it isn't set
+func (o Options) Get(key string) string {
+	if value, ok := o[key]; ok {
+		return value
+	}
+	if values := SupportedOptions[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (o Options) String() string {
+	pairs := make([]string, 0, len(o))
+	for _, key := range o.Keys() {
+		pairs = append(pairs, key+"="+o[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Option returns the value of the ceremony option key, or its default
+func (c *Ceremony) Option(key string) string {
+	if c.Params == nil {
+		return Options(nil).Get(key)
+	}
+	return c.Params.Options.Get(key)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsQuery(t *testing.T) {
+	options, err := ParseOptions([]string{"encryption=on", " transcript = off ", "progress-events=on"})
+	require.NoError(t, err)
+	require.Equal(t, Options{OptionEncryption: "on", OptionTranscript: "off", OptionProgressEvents: "on"}, options)
+	require.Equal(t, "encryption=on,progress-events=on,transcript=off", options.String())
+
+	decoded, err := OptionsFromQuery(options.Query())
+	require.NoError(t, err)
+	require.Equal(t, options, decoded)
+
+	decoded, err = OptionsFromQuery(url.Values{})
+	require.NoError(t, err)
+	require.Nil(t, decoded, "started without options")
+}
+
+func TestParseOptionsInvalid(t *testing.T) {
+	for _, pairs := range [][]string{{"encryption"}, {"=on"}, {"encryption="}, {"encryption=on", "encryption=off"}} {
+		_, err := ParseOptions(pairs)
+		require.Error(t, err, pairs)
+	}
+	options, err := ParseOptions([]string{"encryption=on", "encryption=on"})
+	require.NoError(t, err, "repeated with the same value")
+	require.Len(t, options, 1)
+}
+
+func TestOptionsValidate(t *testing.T) {
+	require.NoError(t, Options(nil).Validate(SupportedOptions))
+	require.NoError(t, Options{OptionTranscript: "off"}.Validate(SupportedOptions))
+	require.ErrorContains(t, Options{"compression": "on"}.Validate(SupportedOptions), "unsupported ceremony option compression")
+	require.ErrorContains(t, Options{OptionTranscript: "partial"}.Validate(SupportedOptions), "expected one of full, off")
+}
+
+func TestCeremonyOption(t *testing.T) {
+	require.Equal(t, "full", (&Ceremony{}).Option(OptionTranscript), "default")
+	require.Equal(t, "off", (&Ceremony{Params: &Params{}}).Option(OptionProgressEvents))
+	require.Equal(t, "on", (&Ceremony{Params: &Params{Options: Options{OptionProgressEvents: "on"}}}).Option(OptionProgressEvents))
+	require.Equal(t, "", (&Ceremony{}).Option("compression"), "unknown option")
+}
@@ -0,0 +1,242 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"fmt"
+	"time"
+
+	"encoding/json"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+type State string
+
+const (
+	StateNone          State = ""
+	StateCreated       State = "created"
+	StateInitialized   State = "initialized"
+	StateRound1        State = "round1"
+	StateRound2        State = "round2"
+	StateOutputPending State = "output_pending"
+	StateCompleted     State = "completed"
+	StateAborted       State = "aborted"
+	StateBlamed        State = "blamed"
+)
+
+// States are the states a stored ceremony can be in
+var States = []State{StateCreated, StateInitialized, StateRound1, StateRound2, StateOutputPending, StateCompleted, StateAborted, StateBlamed}
+
+// ParseState returns the state named s, StateNone for an empty s
+func ParseState(s string) (State, error) {
+	if s == "" {
+		return StateNone, nil
+	}
+	for _, state := range States {
+		if string(state) == s {
+			return state, nil
+		}
+	}
+	return StateNone, fmt.Errorf("unknown ceremony state %q", s)
+}
+
+func (s State) IsTerminal() bool {
+	return s == StateCompleted || s == StateAborted || s == StateBlamed
+}
+
+type Kind string
+
+const (
+	KindKeygen  Kind = "keygen"
+	KindReshare Kind = "reshare"
+	KindKeySign Kind = "keysign"
+)
+
+type EventType string
+
+const (
+	// EventCreated is recorded when a start message (init, reshare, keysign) arrives
+	EventCreated EventType = "created"
+	// EventInitialized is recorded once the dkg runner accepted the start message
+	EventInitialized EventType = "initialized"
+	// EventRound1 and EventRound2 are recorded when this node broadcasts its message for the round
+	EventRound1 EventType = "round1"
+	EventRound2 EventType = "round2"
+	// EventOutputPending is recorded when this node broadcasts deposit data or its output
+	EventOutputPending EventType = "output_pending"
+	EventCompleted     EventType = "completed"
+	EventAborted       EventType = "aborted"
+	EventBlamed        EventType = "blamed"
+	// EventTimedOut is recorded when a phase deadline passed without all the expected messages
+	EventTimedOut EventType = "timed_out"
+
+	// progress events, they don't move the ceremony to a different state
+	EventMessageReceived EventType = "message_received"
+	EventMessageRejected EventType = "message_rejected"
+	EventPhaseExtended   EventType = "phase_extended"
+	// EventPeerUnresponsive is recorded when a peer didn't answer the re-requests for its message of Round
+	EventPeerUnresponsive EventType = "peer_unresponsive"
+)
+
+// transitions lists the state reached for every legal (state, event) pair
+var transitions = map[State]map[EventType]State{
+	StateNone: {
+		EventCreated: StateCreated,
+	},
+	StateCreated: {
+		EventInitialized: StateInitialized,
+		EventAborted:     StateAborted,
+	},
+	StateInitialized: {
+		EventRound1:   StateRound1,
+		EventAborted:  StateAborted,
+		EventBlamed:   StateBlamed,
+		EventTimedOut: StateAborted,
+	},
+	StateRound1: {
+		EventRound2:        StateRound2,
+		EventOutputPending: StateOutputPending,
+		EventAborted:       StateAborted,
+		EventBlamed:        StateBlamed,
+		EventTimedOut:      StateAborted,
+	},
+	StateRound2: {
+		EventOutputPending: StateOutputPending,
+		EventAborted:       StateAborted,
+		EventBlamed:        StateBlamed,
+		EventTimedOut:      StateAborted,
+	},
+	StateOutputPending: {
+		EventCompleted: StateCompleted,
+		EventAborted:   StateAborted,
+		EventBlamed:    StateBlamed,
+		EventTimedOut:  StateAborted,
+	},
+}
+
+// IsProgress tells whether t is a progress event, which never changes the state
+func (t EventType) IsProgress() bool {
+	return isProgressEvent(t)
+}
+
+func isProgressEvent(t EventType) bool {
+	return t == EventMessageReceived || t == EventMessageRejected || t == EventPhaseExtended || t == EventPeerUnresponsive
+}
+
+type Event struct {
+	Seq      uint64           `json:"seq"`
+	Type     EventType        `json:"type"`
+	Time     time.Time        `json:"time"`
+	Operator types.OperatorID `json:"operator,omitempty"`
+	Round    string           `json:"round,omitempty"`
+	Details  string           `json:"details,omitempty"`
+	// Cause categorizes EventAborted, EventBlamed, EventTimedOut and EventMessageRejected
+	Cause Cause `json:"cause,omitempty"`
+
+	// set on EventTimedOut and EventPhaseExtended, the operators whose message for Round hasn't arrived
+	Missing []types.OperatorID `json:"missing,omitempty"`
+
+	// set on EventCompleted for keygen and resharing
+	ValidatorPK string `json:"validator_pk,omitempty"`
+	// set on EventCompleted for keygen and resharing, signed by this node
+	VersionClaim *VersionClaim `json:"version_claim,omitempty"`
+
+	// set on EventCreated only
+	Params *Params `json:"params,omitempty"`
+}
+
+// Params are the ceremony parameters taken from the start message
+type Params struct {
+	Kind         Kind               `json:"kind"`
+	Operators    []types.OperatorID `json:"operators"`
+	OldOperators []types.OperatorID `json:"old_operators,omitempty"`
+	Threshold    uint64             `json:"threshold,omitempty"`
+	ValidatorPK  string             `json:"validator_pk,omitempty"`
+	Timeouts     *PhaseTimeouts     `json:"timeouts,omitempty"`
+	Canary       *Canary            `json:"canary,omitempty"`
+	// WithdrawalCredentials and ForkVersion of a keygen deposit, hex encoded
+	WithdrawalCredentials string `json:"withdrawal_credentials,omitempty"`
+	ForkVersion           string `json:"fork_version,omitempty"`
+	// MinProtocolVersion the ceremony is held to, the stricter of the
+	// initiator's claim and the node's own minimum
+	MinProtocolVersion uint32 `json:"min_protocol_version,omitempty"`
+	// VersionClaim of the initiator, sent with the start message
+	VersionClaim *VersionClaim `json:"version_claim,omitempty"`
+	// Options the initiator started the ceremony with
+	Options Options `json:"options,omitempty"`
+	// ManifestHash of the manifest the initiator signed for the ceremony
+	ManifestHash string `json:"manifest_hash,omitempty"`
+	// KeySign is what a keysign signs with the shares
+	KeySign *KeySignParams `json:"keysign,omitempty"`
+}
+
+// KeySignParams is the declared purpose of a keysign, as the node verified
+// it. Usage is undeclared when the request left the message out or its
+// signing root didn't match it.
+type KeySignParams struct {
+	Usage     string `json:"usage"`
+	DomainTag string `json:"domain_tag,omitempty"`
+	// SigningRoot is hex encoded, but for the owner:nonce root of a registration
+	SigningRoot string `json:"signing_root"`
+	// Message is the ethereum message of a deposit, exit or withdrawal change
+	Message json.RawMessage `json:"message,omitempty"`
+}
+
+// SameStart tells whether other was taken from the same start message as p,
+// it compares the fields of the message and leaves out the ones sent with it
+func (p *Params) SameStart(other *Params) bool {
+	return p.Kind == other.Kind &&
+		sameOperators(sortedOperators(p.Operators), sortedOperators(other.Operators)) &&
+		sameOperators(sortedOperators(p.OldOperators), sortedOperators(other.OldOperators)) &&
+		p.Threshold == other.Threshold &&
+		p.ValidatorPK == other.ValidatorPK &&
+		p.WithdrawalCredentials == other.WithdrawalCredentials &&
+		p.ForkVersion == other.ForkVersion
+}
+
+type ErrIllegalTransition struct {
+	From  State
+	Event EventType
+}
+
+func (err *ErrIllegalTransition) Error() string {
+	from := err.From
+	if from == StateNone {
+		from = "none"
+	}
+	return fmt.Sprintf("illegal ceremony transition: event %s in state %s", err.Event, from)
+}
+
+// Next returns the state reached by applying event t in state s
+func Next(s State, t EventType) (State, error) {
+	if isProgressEvent(t) {
+		if s == StateNone || s.IsTerminal() {
+			return s, &ErrIllegalTransition{From: s, Event: t}
+		}
+		return s, nil
+	}
+	next, ok := transitions[s][t]
+	if !ok {
+		return s, &ErrIllegalTransition{From: s, Event: t}
+	}
+	return next, nil
+}
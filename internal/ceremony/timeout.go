@@ -0,0 +1,328 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Phase is a part of the protocol during which this node waits on its peers
+type Phase string
+
+const (
+	PhaseInitAck Phase = "init_ack"
+	PhaseRound1  Phase = "round1"
+	PhaseRound2  Phase = "round2"
+	PhaseOutput  Phase = "output"
+)
+
+type expectation struct {
+	phase Phase
+	// round is the name recorded on EventMessageReceived for the message every operator has to send
+	round string
+}
+
+// phases lists the states in which the ceremony waits on a message from every operator
+var phases = map[State]expectation{
+	StateInitialized:   {phase: PhaseInitAck, round: "preparation"},
+	StateRound1:        {phase: PhaseRound1, round: "round1"},
+	StateRound2:        {phase: PhaseRound2, round: "round2"},
+	StateOutputPending: {phase: PhaseOutput, round: "output"},
+}
+
+// ExpectedRound returns the round every operator has to send a message for
+// while the ceremony is in state s
+func ExpectedRound(s State) (string, bool) {
+	expected, ok := phases[s]
+	return expected.round, ok
+}
+
+// PhaseTimeouts are the deadlines of each phase, a zero value falls back to the
+// node default
+type PhaseTimeouts struct {
+	InitAck time.Duration `json:"init_ack,omitempty"`
+	Round1  time.Duration `json:"round1,omitempty"`
+	Round2  time.Duration `json:"round2,omitempty"`
+	Output  time.Duration `json:"output,omitempty"`
+	// Extension is granted once per phase when at least threshold operators delivered
+	Extension time.Duration `json:"extension,omitempty"`
+}
+
+var DefaultPhaseTimeouts = PhaseTimeouts{
+	InitAck:   2 * time.Minute,
+	Round1:    3 * time.Minute,
+	Round2:    3 * time.Minute,
+	Output:    3 * time.Minute,
+	Extension: 2 * time.Minute,
+}
+
+// Merge returns t with every zero duration taken from defaults
+func (t *PhaseTimeouts) Merge(defaults PhaseTimeouts) PhaseTimeouts {
+	if t == nil {
+		return defaults
+	}
+	merged := *t
+	fallback := defaults.fields()
+	for i, d := range merged.fields() {
+		if *d == 0 {
+			*d = *fallback[i]
+		}
+	}
+	return merged
+}
+
+func (t PhaseTimeouts) For(p Phase) time.Duration {
+	switch p {
+	case PhaseInitAck:
+		return t.InitAck
+	case PhaseRound1:
+		return t.Round1
+	case PhaseRound2:
+		return t.Round2
+	case PhaseOutput:
+		return t.Output
+	}
+	return 0
+}
+
+var timeoutQueryKeys = []string{"timeout_init_ack", "timeout_round1", "timeout_round2", "timeout_output", "timeout_extension"}
+
+func (t *PhaseTimeouts) fields() []*time.Duration {
+	return []*time.Duration{&t.InitAck, &t.Round1, &t.Round2, &t.Output, &t.Extension}
+}
+
+// Query encodes the non zero timeouts as the query parameters a start message is sent with
+func (t PhaseTimeouts) Query() url.Values {
+	query := url.Values{}
+	for i, d := range t.fields() {
+		if *d != 0 {
+			query.Set(timeoutQueryKeys[i], d.String())
+		}
+	}
+	return query
+}
+
+// ParsePhaseTimeouts reads the timeouts set by Query, it returns nil when none is set
+func ParsePhaseTimeouts(query url.Values) (*PhaseTimeouts, error) {
+	t := &PhaseTimeouts{}
+	found := false
+	for i, d := range t.fields() {
+		value := query.Get(timeoutQueryKeys[i])
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", timeoutQueryKeys[i], err)
+		}
+		if parsed < 0 {
+			return nil, fmt.Errorf("invalid %s: negative duration", timeoutQueryKeys[i])
+		}
+		*d = parsed
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// Delivery splits the operators expected to send a message for round into the
+// ones this node accepted a message from and the ones still missing. self
+// always counts as delivered.
+func (c *Ceremony) Delivery(round string, self types.OperatorID) (delivered, missing []types.OperatorID) {
+	if c.Params == nil {
+		return nil, nil
+	}
+	expected := c.Params.Operators
+	if c.Params.Kind == KindReshare && round == "round1" {
+		// only the old committee runs round 1 of a resharing
+		expected = c.Params.OldOperators
+	}
+
+	accepted := make(map[types.OperatorID]bool)
+	for _, e := range c.Events {
+		if e.Round != round {
+			continue
+		}
+		switch e.Type {
+		case EventMessageReceived:
+			accepted[e.Operator] = true
+		case EventMessageRejected:
+			accepted[e.Operator] = false
+		}
+	}
+
+	for _, operatorID := range expected {
+		if operatorID == self || accepted[operatorID] {
+			delivered = append(delivered, operatorID)
+		} else {
+			missing = append(missing, operatorID)
+		}
+	}
+	return delivered, missing
+}
+
+// Watchdog arms a deadline every time a ceremony enters a phase and records
+// EventTimedOut with the operators that failed to deliver when it passes
+type Watchdog struct {
+	tracker  *Tracker
+	self     types.OperatorID
+	defaults PhaseTimeouts
+	logger   *logrus.Logger
+
+	mu     sync.Mutex
+	timers map[string]*phaseTimer
+}
+
+type phaseTimer struct {
+	state    State
+	timer    *time.Timer
+	extended bool
+}
+
+func NewWatchdog(tracker *Tracker, self types.OperatorID, defaults PhaseTimeouts, logger *logrus.Logger) *Watchdog {
+	w := &Watchdog{
+		tracker:  tracker,
+		self:     self,
+		defaults: defaults,
+		logger:   logger,
+		timers:   make(map[string]*phaseTimer),
+	}
+	tracker.Subscribe(w.observe)
+	return w
+}
+
+func (w *Watchdog) observe(c *Ceremony, e *Event) {
+	if isProgressEvent(e.Type) {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if pt, ok := w.timers[c.RequestID]; ok {
+		pt.timer.Stop()
+		delete(w.timers, c.RequestID)
+	}
+	expected, ok := phases[c.State]
+	if !ok {
+		return
+	}
+	if timeout := w.timeouts(c).For(expected.phase); timeout > 0 {
+		w.arm(c.RequestID, c.State, timeout, false)
+	}
+}
+
+// Rearm arms the deadline of the phase c is in, counting from now. The timers
+// live in memory, a restarted node rearms them for the ceremonies it keeps open.
+func (w *Watchdog) Rearm(c *Ceremony) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.timers[c.RequestID]; ok {
+		return
+	}
+	expected, ok := phases[c.State]
+	if !ok {
+		return
+	}
+	if timeout := w.timeouts(c).For(expected.phase); timeout > 0 {
+		w.arm(c.RequestID, c.State, timeout, false)
+	}
+}
+
+// arm must be called with w.mu held
+func (w *Watchdog) arm(requestID string, state State, d time.Duration, extended bool) {
+	pt := &phaseTimer{state: state, extended: extended}
+	pt.timer = time.AfterFunc(d, func() { w.expire(requestID, pt) })
+	w.timers[requestID] = pt
+}
+
+func (w *Watchdog) expire(requestID string, pt *phaseTimer) {
+	w.mu.Lock()
+	if w.timers[requestID] != pt {
+		// the ceremony moved to another phase in the meantime
+		w.mu.Unlock()
+		return
+	}
+	delete(w.timers, requestID)
+	w.mu.Unlock()
+
+	c, err := w.tracker.Get(requestID)
+	if err != nil {
+		w.logger.Errorf("Watchdog: failed to load ceremony %s: %v", requestID, err)
+		return
+	}
+	expected, ok := phases[c.State]
+	if !ok || c.State != pt.state {
+		return
+	}
+	delivered, missing := c.Delivery(expected.round, w.self)
+	if len(missing) == 0 {
+		return
+	}
+
+	timeouts := w.timeouts(c)
+	if !pt.extended && timeouts.Extension > 0 && uint64(len(delivered)) >= c.Params.Threshold {
+		w.mu.Lock()
+		if _, ok := w.timers[requestID]; ok {
+			w.mu.Unlock()
+			return
+		}
+		w.arm(requestID, pt.state, timeouts.Extension, true)
+		w.mu.Unlock()
+
+		w.record(requestID, EventPhaseExtended, expected.round, missing, fmt.Sprintf("%s extended by %s, %d of %d operators delivered", expected.phase, timeouts.Extension, len(delivered), len(delivered)+len(missing)))
+		return
+	}
+
+	w.record(requestID, EventTimedOut, expected.round, missing, fmt.Sprintf("%s timed out, missing %s message from operators %v", expected.phase, expected.round, missing))
+}
+
+func (w *Watchdog) record(requestID string, eventType EventType, round string, missing []types.OperatorID, details string) {
+	_, err := w.tracker.Record(requestID, eventType, func(e *Event) {
+		e.Round = round
+		e.Missing = missing
+		e.Details = details
+	})
+	if err != nil {
+		w.logger.Errorf("Watchdog: failed to record %s event for request %s: %v", eventType, requestID, err)
+		return
+	}
+	w.logger.Warnf("Watchdog: request %s: %s", requestID, details)
+}
+
+// timeouts are the timeouts the ceremony started with, the node defaults
+// scaled to the committee size fill in the ones it left out
+func (w *Watchdog) timeouts(c *Ceremony) PhaseTimeouts {
+	if c.Params == nil {
+		return w.defaults
+	}
+	return c.Params.Timeouts.Merge(ScaleTimeouts(w.defaults, c.Params.committeeSize()))
+}
@@ -0,0 +1,164 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func startCeremony(t *testing.T, tracker *Tracker, timeouts *PhaseTimeouts) {
+	_, err := tracker.Record("req", EventCreated, func(e *Event) {
+		e.Params = testParams()
+		e.Params.Timeouts = timeouts
+	})
+	require.NoError(t, err)
+	_, err = tracker.Record("req", EventInitialized, nil)
+	require.NoError(t, err)
+}
+
+func receive(t *testing.T, tracker *Tracker, operatorID types.OperatorID, round string) {
+	_, err := tracker.Record("req", EventMessageReceived, func(e *Event) {
+		e.Operator = operatorID
+		e.Round = round
+	})
+	require.NoError(t, err)
+}
+
+func waitForState(t *testing.T, tracker *Tracker, state State) *Ceremony {
+	var c *Ceremony
+	require.Eventually(t, func() bool {
+		c, _ = tracker.Get("req")
+		return c.State == state
+	}, time.Second, 5*time.Millisecond)
+	return c
+}
+
+func TestWatchdogTimesOutMissingOperators(t *testing.T) {
+	tracker := NewTracker(&memStore{events: make(map[string][]*Event)})
+	NewWatchdog(tracker, 1, PhaseTimeouts{InitAck: 20 * time.Millisecond}, logrus.New())
+
+	startCeremony(t, tracker, nil)
+	receive(t, tracker, 2, "preparation")
+	require.Equal(t, 1, tracker.Active())
+	require.Equal(t, []string{"req"}, tracker.Running())
+
+	c := waitForState(t, tracker, StateAborted)
+	last := c.Events[len(c.Events)-1]
+	require.Equal(t, EventTimedOut, last.Type)
+	require.Equal(t, "preparation", last.Round)
+	require.Equal(t, []types.OperatorID{3, 4}, last.Missing)
+	require.Zero(t, tracker.Active(), "aborted ceremonies aren't active")
+	require.Empty(t, tracker.Running())
+}
+
+func TestWatchdogExtendsOnPartialProgress(t *testing.T) {
+	tracker := NewTracker(&memStore{events: make(map[string][]*Event)})
+	NewWatchdog(tracker, 1, DefaultPhaseTimeouts, logrus.New())
+
+	startCeremony(t, tracker, &PhaseTimeouts{InitAck: 20 * time.Millisecond, Extension: 40 * time.Millisecond})
+	receive(t, tracker, 2, "preparation")
+	receive(t, tracker, 3, "preparation")
+
+	require.Eventually(t, func() bool {
+		c, _ := tracker.Get("req")
+		return c.Events[len(c.Events)-1].Type == EventPhaseExtended
+	}, time.Second, 5*time.Millisecond)
+
+	// the extension is granted once, the phase times out when it passes
+	c := waitForState(t, tracker, StateAborted)
+	last := c.Events[len(c.Events)-1]
+	require.Equal(t, EventTimedOut, last.Type)
+	require.Equal(t, []types.OperatorID{4}, last.Missing)
+}
+
+func TestWatchdogStopsOnNextPhase(t *testing.T) {
+	tracker := NewTracker(&memStore{events: make(map[string][]*Event)})
+	NewWatchdog(tracker, 1, PhaseTimeouts{InitAck: 20 * time.Millisecond}, logrus.New())
+
+	startCeremony(t, tracker, nil)
+	_, err := tracker.Record("req", EventRound1, nil)
+	require.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	c, err := tracker.Get("req")
+	require.NoError(t, err)
+	require.Equal(t, StateRound1, c.State)
+}
+
+func TestWatchdogRearm(t *testing.T) {
+	store := &memStore{events: make(map[string][]*Event)}
+	startCeremony(t, NewTracker(store), nil)
+
+	// a restarted node replays the ceremony from the store without timers
+	tracker := NewTracker(store)
+	watchdog := NewWatchdog(tracker, 1, PhaseTimeouts{InitAck: 20 * time.Millisecond}, logrus.New())
+	c, err := tracker.Get("req")
+	require.NoError(t, err)
+	watchdog.Rearm(c)
+
+	c = waitForState(t, tracker, StateAborted)
+	require.Equal(t, EventTimedOut, c.Events[len(c.Events)-1].Type)
+}
+
+func TestPhaseTimeoutsQuery(t *testing.T) {
+	timeouts := PhaseTimeouts{Round1: time.Minute, Extension: 30 * time.Second}
+	parsed, err := ParsePhaseTimeouts(timeouts.Query())
+	require.NoError(t, err)
+	require.Equal(t, timeouts, *parsed)
+
+	merged := parsed.Merge(DefaultPhaseTimeouts)
+	require.Equal(t, DefaultPhaseTimeouts.InitAck, merged.InitAck)
+	require.Equal(t, time.Minute, merged.Round1)
+
+	parsed, err = ParsePhaseTimeouts(PhaseTimeouts{}.Query())
+	require.NoError(t, err)
+	require.Nil(t, parsed)
+}
+
+func TestScaleTimeouts(t *testing.T) {
+	require.Equal(t, DefaultPhaseTimeouts, ScaleTimeouts(DefaultPhaseTimeouts, 4))
+
+	expected := map[int]time.Duration{7: 270 * time.Second, 10: 6 * time.Minute, 13: 450 * time.Second}
+	for n, round := range expected {
+		scaled := ScaleTimeouts(DefaultPhaseTimeouts, n)
+		require.Equal(t, round, scaled.Round1, "%d operators", n)
+		require.Equal(t, round, scaled.Round2, "%d operators", n)
+		require.Equal(t, DefaultPhaseTimeouts.Extension, scaled.Extension)
+		require.Less(t, scaled.Round1+scaled.Extension, frost.DefaultTimeoutDuration)
+	}
+}
+
+func TestCheckCommittee(t *testing.T) {
+	for _, n := range CommitteeSizes {
+		require.NoError(t, CheckCommittee(n, ThresholdFor(n)))
+	}
+	require.EqualValues(t, 9, ThresholdFor(13))
+	require.ErrorContains(t, CheckCommittee(5, 3), "not a supported committee size")
+	require.ErrorContains(t, CheckCommittee(16, 11), "not a supported committee size")
+	require.ErrorContains(t, CheckCommittee(7, 4), "2f+1 threshold 5")
+}
@@ -0,0 +1,176 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrCeremonyNotFound = errors.New("ceremony not found")
+
+type EventStore interface {
+	AppendCeremonyEvent(requestID string, e *Event) error
+	// GetCeremonyEvents returns ErrCeremonyNotFound when no event was stored for requestID
+	GetCeremonyEvents(requestID string) ([]*Event, error)
+}
+
+// Tracker serializes event recording per node and keeps replayed ceremonies in memory
+type Tracker struct {
+	store EventStore
+
+	mu         sync.Mutex
+	ceremonies map[string]*Ceremony
+	listeners  []Listener
+}
+
+// Listener is called after an event was stored, outside of the tracker lock
+type Listener func(c *Ceremony, e *Event)
+
+func NewTracker(store EventStore) *Tracker {
+	return &Tracker{
+		store:      store,
+		ceremonies: make(map[string]*Ceremony),
+	}
+}
+
+// Subscribe registers a listener for every event recorded from now on
+func (t *Tracker) Subscribe(l Listener) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners = append(t.listeners, l)
+}
+
+// Record applies an event of type t to the ceremony, fill sets the optional event fields
+func (t *Tracker) Record(requestID string, eventType EventType, fill func(*Event)) (*Ceremony, error) {
+	c, e, listeners, err := t.record(requestID, eventType, fill)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range listeners {
+		l(c, e)
+	}
+	return c, nil
+}
+
+func (t *Tracker) record(requestID string, eventType EventType, fill func(*Event)) (*Ceremony, *Event, []Listener, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, err := t.load(requestID)
+	if err == ErrCeremonyNotFound {
+		c = New(requestID)
+	} else if err != nil {
+		return nil, nil, nil, err
+	}
+
+	e := c.NextEvent(eventType)
+	if fill != nil {
+		fill(e)
+	}
+
+	// apply on a copy so that a failed write doesn't leave the cache ahead of the store
+	updated := *c
+	updated.Events = append(make([]*Event, 0, len(c.Events)+1), c.Events...)
+	if err := updated.Apply(e); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := t.store.AppendCeremonyEvent(requestID, e); err != nil {
+		return nil, nil, nil, err
+	}
+	t.ceremonies[requestID] = &updated
+	return &updated, e, t.listeners, nil
+}
+
+// Reset drops the replayed ceremonies, the next reads go to the store again.
+// A standby node calls it when it takes over from the instance that wrote them.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ceremonies = make(map[string]*Ceremony)
+}
+
+// Forget drops a ceremony from memory once its events were purged from the
+// store, a running ceremony is kept
+func (t *Tracker) Forget(requestID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.ceremonies[requestID]; ok && c.State.IsTerminal() {
+		delete(t.ceremonies, requestID)
+	}
+}
+
+// Active counts the ceremonies recorded or read since the node started that
+// are still running
+func (t *Tracker) Active() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := 0
+	for _, c := range t.ceremonies {
+		if c.State != StateNone && !c.State.IsTerminal() {
+			active++
+		}
+	}
+	return active
+}
+
+// Running lists the request ids of the ceremonies Active counts
+func (t *Tracker) Running() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var running []string
+	for requestID, c := range t.ceremonies {
+		if c.State != StateNone && !c.State.IsTerminal() {
+			running = append(running, requestID)
+		}
+	}
+	sort.Strings(running)
+	return running
+}
+
+func (t *Tracker) Get(requestID string) (*Ceremony, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.load(requestID)
+}
+
+func (t *Tracker) Exists(requestID string) bool {
+	_, err := t.Get(requestID)
+	return err == nil
+}
+
+func (t *Tracker) load(requestID string) (*Ceremony, error) {
+	if c, ok := t.ceremonies[requestID]; ok {
+		return c, nil
+	}
+	events, err := t.store.GetCeremonyEvents(requestID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Replay(requestID, events)
+	if err != nil {
+		return nil, err
+	}
+	t.ceremonies[requestID] = c
+	return c, nil
+}
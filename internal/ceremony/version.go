@@ -0,0 +1,139 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Protocol versions of the nodes. A keygen or resharing runs at the minimum
+// version its initiator signed, a node that doesn't speak it refuses to join.
+const (
+	// ProtocolV1 takes the start parameters from the unsigned query and the
+	// round messages from whoever posts them
+	ProtocolV1 uint32 = 1
+	// ProtocolV2 binds the minimum version to the start message with a signed
+	// version claim, takes the round messages of the ceremony only as signed
+	// messenger deliveries and signs a version claim with the output
+	ProtocolV2 uint32 = 2
+
+	// ProtocolVersion is the version this node speaks
+	ProtocolVersion = ProtocolV2
+)
+
+const versionClaimQueryKey = "version_claim"
+
+var versionClaimLabel = []byte("rockx-dkg-version-claim")
+
+// VersionClaim is an operator's signed statement of the protocol version it
+// runs a ceremony with and the minimum version it holds the ceremony to. The
+// initiator sends one with the start message, nodes sign one with their output.
+type VersionClaim struct {
+	RequestID  string           `json:"request_id"`
+	Operator   types.OperatorID `json:"operator"`
+	Version    uint32           `json:"version"`
+	MinVersion uint32           `json:"min_version"`
+	Signature  string           `json:"signature,omitempty"`
+}
+
+func (c *VersionClaim) signingRoot() []byte {
+	data := append([]byte{}, versionClaimLabel...)
+	data = append(data, []byte(c.RequestID)...)
+	data = binary.BigEndian.AppendUint64(data, uint64(c.Operator))
+	data = binary.BigEndian.AppendUint32(data, c.Version)
+	return binary.BigEndian.AppendUint32(data, c.MinVersion)
+}
+
+// SignVersionClaim signs the claim of operator, with its operator key, that it
+// runs the ceremony requestID at this node's version and holds it to minVersion
+func SignVersionClaim(sk *rsa.PrivateKey, operator types.OperatorID, requestID string, minVersion uint32) (*VersionClaim, error) {
+	claim := &VersionClaim{RequestID: requestID, Operator: operator, Version: ProtocolVersion, MinVersion: minVersion}
+	if minVersion > ProtocolVersion {
+		return nil, fmt.Errorf("SignVersionClaim: minimum protocol version %d is newer than version %d", minVersion, ProtocolVersion)
+	}
+	hashed := sha256.Sum256(claim.signingRoot())
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sk, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, fmt.Errorf("SignVersionClaim: failed to sign claim: %w", err)
+	}
+	claim.Signature = hex.EncodeToString(signature)
+	return claim, nil
+}
+
+// Verify checks the claim was signed by the operator key pk
+func (c *VersionClaim) Verify(pk *rsa.PublicKey) error {
+	signature, err := hex.DecodeString(c.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid version claim signature encoding: %w", err)
+	}
+	if !types.Verify(pk, c.signingRoot(), signature) {
+		return fmt.Errorf("invalid version claim signature of operator %d", c.Operator)
+	}
+	if c.MinVersion > c.Version {
+		return fmt.Errorf("operator %d claims minimum protocol version %d above its version %d", c.Operator, c.MinVersion, c.Version)
+	}
+	return nil
+}
+
+// Query carries the claim in the query of a start message
+func (c *VersionClaim) Query() url.Values {
+	byts, _ := json.Marshal(c)
+	return url.Values{versionClaimQueryKey: []string{base64.RawURLEncoding.EncodeToString(byts)}}
+}
+
+// ParseVersionClaim reads the claim set by Query, it returns nil for start
+// messages sent without one
+func ParseVersionClaim(query url.Values) (*VersionClaim, error) {
+	value := query.Get(versionClaimQueryKey)
+	if value == "" {
+		return nil, nil
+	}
+	byts, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", versionClaimQueryKey, err)
+	}
+	claim := &VersionClaim{}
+	if err := json.Unmarshal(byts, claim); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", versionClaimQueryKey, err)
+	}
+	return claim, nil
+}
+
+// MinProtocolVersion is the version the ceremony is held to, version 1 for
+// ceremonies started without a version claim
+func (c *Ceremony) MinProtocolVersion() uint32 {
+	if c.Params == nil || c.Params.MinProtocolVersion == 0 {
+		return ProtocolV1
+	}
+	return c.Params.MinProtocolVersion
+}
@@ -0,0 +1,69 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package ceremony
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionClaim(t *testing.T) {
+	ks := testingutils.TestingKeygenKeySet()
+	sk := ks.DKGOperators[1].EncryptionKey
+
+	claim, err := SignVersionClaim(sk, 1, "0a0b", ProtocolV2)
+	require.NoError(t, err)
+	require.Equal(t, ProtocolVersion, claim.Version)
+	require.NoError(t, claim.Verify(&sk.PublicKey))
+
+	parsed, err := ParseVersionClaim(claim.Query())
+	require.NoError(t, err)
+	require.Equal(t, claim, parsed)
+	require.NoError(t, parsed.Verify(&sk.PublicKey))
+
+	parsed.MinVersion = ProtocolV1
+	require.Error(t, parsed.Verify(&sk.PublicKey), "downgraded claim")
+
+	other := ks.DKGOperators[2].EncryptionKey
+	require.Error(t, claim.Verify(&other.PublicKey), "signed by operator 1")
+
+	_, err = SignVersionClaim(sk, 1, "0a0b", ProtocolVersion+1)
+	require.Error(t, err)
+}
+
+func TestParseVersionClaim(t *testing.T) {
+	claim, err := ParseVersionClaim(url.Values{})
+	require.NoError(t, err)
+	require.Nil(t, claim, "no claim")
+
+	_, err = ParseVersionClaim(url.Values{versionClaimQueryKey: {"!"}})
+	require.Error(t, err)
+}
+
+func TestCeremonyMinProtocolVersion(t *testing.T) {
+	require.Equal(t, ProtocolV1, (&Ceremony{}).MinProtocolVersion())
+	require.Equal(t, ProtocolV1, (&Ceremony{Params: &Params{}}).MinProtocolVersion())
+	require.Equal(t, ProtocolV2, (&Ceremony{Params: &Params{MinProtocolVersion: ProtocolV2}}).MinProtocolVersion())
+}
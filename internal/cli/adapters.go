@@ -0,0 +1,370 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Adapter turns the generic result of a keygen into the artifact a staking
+// protocol takes to register the validator
+type Adapter interface {
+	Name() string
+	// Check validates the options before the ceremony result is fetched
+	Check(opts *AdapterOptions) error
+	Export(result *DKGResult, opts *AdapterOptions) (interface{}, error)
+}
+
+// AdapterOptions are the export-result flags, each adapter uses the ones it needs
+type AdapterOptions struct {
+	WithdrawalCredentials string
+	Network               string
+	// Threshold of the committee, the result doesn't carry it
+	Threshold   uint64
+	ClusterName string
+	// ENRs of the charon nodes of the operators, and the fee recipient of the
+	// validator, for the obol cluster lock
+	ENRs         map[types.OperatorID]string
+	FeeRecipient string
+	// OperatorAddress looks up the address of an operator in the registry
+	OperatorAddress func(operatorID types.OperatorID) (string, error)
+	// CSMNodeOperatorID is the Lido CSM node operator the keys are added to, nil for a new operator
+	CSMNodeOperatorID *uint64
+	// SignOwner runs the keysign of the ssv owner address and nonce
+	SignOwner func(result *DKGResult) (string, error)
+	// Custodian is the account the custodian adapters onboard the validator to
+	Custodian CustodianOptions
+}
+
+var adapters = map[string]Adapter{
+	"ssv":          ssvAdapter{},
+	"deposit-data": depositDataAdapter{},
+	"lido-csm":     lidoCSMAdapter{},
+	"obol":         obolAdapter{},
+	"fireblocks":   fireblocksAdapter{},
+	"copper":       copperAdapter{},
+}
+
+func adapterNames() []string {
+	names := make([]string, 0, len(adapters))
+	for name := range adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseAdapters looks up the adapters by name, each is used once
+func parseAdapters(names []string) ([]Adapter, error) {
+	selected := make([]Adapter, 0, len(names))
+	seen := make(map[string]bool)
+	for _, value := range names {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			adapter, ok := adapters[name]
+			if !ok {
+				return nil, fail(ConditionValidation, fmt.Errorf("unknown adapter %s, expected one of %s", name, strings.Join(adapterNames(), ", ")))
+			}
+			seen[name] = true
+			selected = append(selected, adapter)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fail(ConditionValidation, fmt.Errorf("no adapter given, expected any of %s", strings.Join(adapterNames(), ", ")))
+	}
+	return selected, nil
+}
+
+// sortedOperators are the operators of a result in ascending order, the order
+// share lists are expected in
+func (r *DKGResult) sortedOperators() []types.OperatorID {
+	operators := make([]types.OperatorID, 0, len(r.Output))
+	for operatorID := range r.Output {
+		operators = append(operators, operatorID)
+	}
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+	return operators
+}
+
+// checkDepositOptions validates the options of adapters that carry deposit data
+func checkDepositOptions(opts *AdapterOptions) error {
+	if opts.WithdrawalCredentials == "" {
+		return fmt.Errorf("--withdrawal-credentials is required")
+	}
+	if _, err := hexenc.ParseWithdrawalCredentials(opts.WithdrawalCredentials); err != nil {
+		return fmt.Errorf("--withdrawal-credentials must be 32 bytes hex encoded")
+	}
+	if types.NetworkFromString(opts.Network) == "" {
+		return fmt.Errorf("--fork-version must be one of %s, %s", types.MainNetwork, types.PraterNetwork)
+	}
+	return nil
+}
+
+// verifiedDepositData is the deposit data of the result, checked against the
+// withdrawal credentials and network the adapter was given
+func verifiedDepositData(result *DKGResult, opts *AdapterOptions) (*DepositDataJson, error) {
+	depositData, err := depositDataFromResult(result, opts.WithdrawalCredentials, opts.Network)
+	if err != nil {
+		return nil, err
+	}
+	if err := depositData.Verify(); err != nil {
+		return nil, err
+	}
+	return depositData, nil
+}
+
+// ssvAdapter writes the keyshares file of the ssv webapp, like get-keyshares
+type ssvAdapter struct{}
+
+func (ssvAdapter) Name() string { return "ssv" }
+
+func (ssvAdapter) Check(opts *AdapterOptions) error {
+	if opts.SignOwner == nil {
+		return fmt.Errorf("--owner-address, --owner-nonce and --operator are required")
+	}
+	return nil
+}
+
+func (ssvAdapter) Export(result *DKGResult, opts *AdapterOptions) (interface{}, error) {
+	ownerPrefix, err := opts.SignOwner(result)
+	if err != nil {
+		return nil, err
+	}
+	keyshares := &KeyShares{}
+	if err := keyshares.GenerateKeyshareV4(result, ownerPrefix); err != nil {
+		return nil, err
+	}
+	return keyshares, nil
+}
+
+// depositDataAdapter writes the deposit data in the format of the staking deposit cli
+type depositDataAdapter struct{}
+
+func (depositDataAdapter) Name() string { return "deposit-data" }
+
+func (depositDataAdapter) Check(opts *AdapterOptions) error {
+	return checkDepositOptions(opts)
+}
+
+func (depositDataAdapter) Export(result *DKGResult, opts *AdapterOptions) (interface{}, error) {
+	depositData, err := verifiedDepositData(result, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []DepositDataJson{*depositData}, nil
+}
+
+// lidoWithdrawalVaults are the Lido withdrawal vaults CSM validators must withdraw to
+var lidoWithdrawalVaults = map[types.BeaconNetwork]string{
+	types.MainNetwork: "b9d7934878b5fb9610b3fe8a5e441e8fad7e293f",
+}
+
+// LidoCSMSubmission holds the arguments of addNodeOperatorETH and
+// addValidatorKeysETH of the Lido community staking module, along with the
+// deposit data the CSM widget takes
+type LidoCSMSubmission struct {
+	NodeOperatorID *uint64           `json:"nodeOperatorId,omitempty"`
+	KeysCount      int               `json:"keysCount"`
+	PublicKeys     string            `json:"publicKeys"`
+	Signatures     string            `json:"signatures"`
+	DepositData    []DepositDataJson `json:"depositData"`
+}
+
+type lidoCSMAdapter struct{}
+
+func (lidoCSMAdapter) Name() string { return "lido-csm" }
+
+func (lidoCSMAdapter) Check(opts *AdapterOptions) error {
+	if err := checkDepositOptions(opts); err != nil {
+		return err
+	}
+	vault, ok := lidoWithdrawalVaults[types.NetworkFromString(opts.Network)]
+	if !ok {
+		return nil
+	}
+	if expected := executionWithdrawalCredentials(vault); !strings.EqualFold(opts.WithdrawalCredentials, expected) {
+		return fmt.Errorf("CSM validators withdraw to the Lido withdrawal vault, --withdrawal-credentials must be %s", expected)
+	}
+	return nil
+}
+
+func (lidoCSMAdapter) Export(result *DKGResult, opts *AdapterOptions) (interface{}, error) {
+	depositData, err := verifiedDepositData(result, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &LidoCSMSubmission{
+		NodeOperatorID: opts.CSMNodeOperatorID,
+		KeysCount:      1,
+		PublicKeys:     "0x" + depositData.PubKey,
+		Signatures:     "0x" + depositData.Signature,
+		DepositData:    []DepositDataJson{*depositData},
+	}, nil
+}
+
+// executionWithdrawalCredentials are the 0x01 credentials of an execution
+// address, hex without 0x
+func executionWithdrawalCredentials(address string) string {
+	return "01" + strings.Repeat("00", 11) + strings.ToLower(address)
+}
+
+// ObolClusterVersion is the version of the Obol cluster lock layout the obol
+// adapter follows
+const ObolClusterVersion = "v1.7.0"
+
+// ObolClusterLock follows the cluster lock of Obol distributed validators, so
+// tooling that reads cluster locks takes the result of a keygen. The committee
+// operators stand in for the charon peers; the config, definition and lock
+// hashes and the operator signatures are left out, charon itself doesn't run
+// the cluster.
+type ObolClusterLock struct {
+	Definition            ObolClusterDefinition      `json:"cluster_definition"`
+	DistributedValidators []ObolDistributedValidator `json:"distributed_validators"`
+}
+
+type ObolClusterDefinition struct {
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	NumValidators int    `json:"num_validators"`
+	Threshold     uint64 `json:"threshold"`
+	// Operators in the order of the public_shares lists
+	Operators    []ObolOperator       `json:"operators"`
+	Validators   []ObolValidatorAddrs `json:"validators"`
+	DKGAlgorithm string               `json:"dkg_algorithm"`
+	ForkVersion  string               `json:"fork_version"`
+}
+
+type ObolOperator struct {
+	// Address is the owner address of the operator in the ssv registry
+	Address string `json:"address"`
+	// ENR of the operator's charon node, given with --enr, empty otherwise
+	ENR        string `json:"enr"`
+	OperatorID uint32 `json:"operator_id"`
+	// ShareIndex is the index of the operator's share in the public_shares lists
+	ShareIndex int `json:"share_index"`
+}
+
+type ObolValidatorAddrs struct {
+	FeeRecipientAddress string `json:"fee_recipient_address"`
+	// WithdrawalAddress is the execution address of 0x01 credentials, empty for 0x00
+	WithdrawalAddress string `json:"withdrawal_address"`
+}
+
+type ObolDistributedValidator struct {
+	DistributedPublicKey string          `json:"distributed_public_key"`
+	PublicShares         []string        `json:"public_shares"`
+	DepositData          ObolDepositData `json:"deposit_data"`
+}
+
+type ObolDepositData struct {
+	PubKey                string `json:"pubkey"`
+	WithdrawalCredentials string `json:"withdrawal_credentials"`
+	Amount                string `json:"amount"`
+	Signature             string `json:"signature"`
+}
+
+type obolAdapter struct{}
+
+func (obolAdapter) Name() string { return "obol" }
+
+func (obolAdapter) Check(opts *AdapterOptions) error {
+	if opts.Threshold == 0 {
+		return fmt.Errorf("--threshold is required")
+	}
+	for operatorID, enr := range opts.ENRs {
+		if !strings.HasPrefix(enr, "enr:") {
+			return fmt.Errorf("--enr of operator %d must start with enr:", operatorID)
+		}
+	}
+	if opts.FeeRecipient != "" {
+		if _, err := hexenc.ParseAddress(opts.FeeRecipient); err != nil {
+			return fmt.Errorf("--fee-recipient must be a 20 bytes hex encoded address")
+		}
+	}
+	return checkDepositOptions(opts)
+}
+
+func (obolAdapter) Export(result *DKGResult, opts *AdapterOptions) (interface{}, error) {
+	operators := result.sortedOperators()
+	if opts.Threshold > uint64(len(operators)) {
+		return nil, fmt.Errorf("threshold %d is more than the %d operators of the result", opts.Threshold, len(operators))
+	}
+	for operatorID := range opts.ENRs {
+		if _, ok := result.Output[operatorID]; !ok {
+			return nil, fmt.Errorf("--enr of operator %d, which isn't in the committee", operatorID)
+		}
+	}
+	depositData, err := verifiedDepositData(result, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := ObolValidatorAddrs{}
+	if opts.FeeRecipient != "" {
+		feeRecipient, _ := hexenc.ParseAddress(opts.FeeRecipient)
+		addrs.FeeRecipientAddress = hexenc.Format(feeRecipient)
+	}
+	if credentials, err := hexenc.ParseWithdrawalCredentials(depositData.WithdrawalCredentials); err == nil && credentials[0] == 0x01 {
+		addrs.WithdrawalAddress = hexenc.Format(credentials[12:])
+	}
+	lock := &ObolClusterLock{
+		Definition: ObolClusterDefinition{
+			Name:          opts.ClusterName,
+			Version:       ObolClusterVersion,
+			NumValidators: 1,
+			Threshold:     opts.Threshold,
+			Validators:    []ObolValidatorAddrs{addrs},
+			DKGAlgorithm:  "frost",
+			ForkVersion:   "0x" + depositData.ForkVersion,
+		},
+	}
+	validator := ObolDistributedValidator{
+		DistributedPublicKey: "0x" + depositData.PubKey,
+		DepositData: ObolDepositData{
+			PubKey:                "0x" + depositData.PubKey,
+			WithdrawalCredentials: "0x" + depositData.WithdrawalCredentials,
+			Amount:                strconv.FormatUint(uint64(depositData.Amount), 10),
+			Signature:             "0x" + depositData.Signature,
+		},
+	}
+	for i, operatorID := range operators {
+		operator := ObolOperator{OperatorID: uint32(operatorID), ShareIndex: i, ENR: opts.ENRs[operatorID]}
+		if opts.OperatorAddress != nil {
+			if operator.Address, err = opts.OperatorAddress(operatorID); err != nil {
+				return nil, fmt.Errorf("failed to get the address of operator %d: %w", operatorID, err)
+			}
+		}
+		lock.Definition.Operators = append(lock.Definition.Operators, operator)
+		validator.PublicShares = append(validator.PublicShares, "0x"+result.Output[operatorID].Data.SharePubKey)
+	}
+	lock.DistributedValidators = []ObolDistributedValidator{validator}
+	return lock, nil
+}
@@ -0,0 +1,185 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+var csmWithdrawalCredentials = executionWithdrawalCredentials(lidoWithdrawalVaults[types.MainNetwork])
+
+// keygenResult is the result of a 4 operator keygen whose deposit the
+// committee signed for withdrawalCredentials on network
+func keygenResult(t *testing.T, withdrawalCredentials string, network types.BeaconNetwork) *DKGResult {
+	types.InitBLS()
+	sk := &bls.SecretKey{}
+	sk.SetByCSPRNG()
+	pk := sk.GetPublicKey().Serialize()
+
+	credentials, err := hex.DecodeString(withdrawalCredentials)
+	require.NoError(t, err)
+	signingRoot, _, err := types.GenerateETHDepositData(pk, credentials, network.ForkVersion(), types.DomainDeposit)
+	require.NoError(t, err)
+	signature := sk.SignByte(signingRoot).Serialize()
+
+	result := &DKGResult{Output: make(map[types.OperatorID]SignedOutput)}
+	for _, operatorID := range []types.OperatorID{4, 2, 3, 1} {
+		share := &bls.SecretKey{}
+		share.SetByCSPRNG()
+		result.Output[operatorID] = SignedOutput{Data: Output{
+			SharePubKey:          hex.EncodeToString(share.GetPublicKey().Serialize()),
+			ValidatorPubKey:      hex.EncodeToString(pk),
+			DepositDataSignature: hex.EncodeToString(signature),
+		}}
+	}
+	return result
+}
+
+func TestParseAdapters(t *testing.T) {
+	selected, err := parseAdapters([]string{"lido-csm,obol", "lido-csm"})
+	require.NoError(t, err)
+	require.Len(t, selected, 2)
+	require.Equal(t, "lido-csm", selected[0].Name())
+	require.Equal(t, "obol", selected[1].Name())
+
+	_, err = parseAdapters([]string{"rocketpool"})
+	require.ErrorContains(t, err, "copper, deposit-data, fireblocks, lido-csm, obol, ssv")
+	require.Equal(t, ExitValidation, ExitCode(err))
+
+	_, err = parseAdapters(nil)
+	require.Error(t, err)
+}
+
+func TestAdapterChecks(t *testing.T) {
+	require.ErrorContains(t, adapters["ssv"].Check(&AdapterOptions{}), "--owner-address")
+	require.ErrorContains(t, adapters["deposit-data"].Check(&AdapterOptions{Network: "mainnet"}), "--withdrawal-credentials is required")
+	require.ErrorContains(t, adapters["deposit-data"].Check(&AdapterOptions{WithdrawalCredentials: "0100", Network: "mainnet"}), "32 bytes")
+	require.ErrorContains(t, adapters["deposit-data"].Check(&AdapterOptions{WithdrawalCredentials: csmWithdrawalCredentials, Network: "holesky"}), "--fork-version")
+	require.ErrorContains(t, adapters["obol"].Check(&AdapterOptions{WithdrawalCredentials: csmWithdrawalCredentials, Network: "mainnet"}), "--threshold")
+	require.ErrorContains(t, adapters["obol"].Check(&AdapterOptions{WithdrawalCredentials: csmWithdrawalCredentials, Network: "mainnet", Threshold: 3, ENRs: map[types.OperatorID]string{1: "-HW4Q"}}), "--enr of operator 1")
+	require.ErrorContains(t, adapters["obol"].Check(&AdapterOptions{WithdrawalCredentials: csmWithdrawalCredentials, Network: "mainnet", Threshold: 3, FeeRecipient: "0x12"}), "--fee-recipient")
+
+	// CSM keys on mainnet withdraw to the Lido vault, testnets take any credentials
+	other := "01" + strings.Repeat("00", 11) + strings.Repeat("ab", 20)
+	require.ErrorContains(t, adapters["lido-csm"].Check(&AdapterOptions{WithdrawalCredentials: other, Network: "mainnet"}), csmWithdrawalCredentials)
+	require.NoError(t, adapters["lido-csm"].Check(&AdapterOptions{WithdrawalCredentials: strings.ToUpper(csmWithdrawalCredentials), Network: "mainnet"}))
+	require.NoError(t, adapters["lido-csm"].Check(&AdapterOptions{WithdrawalCredentials: other, Network: "prater"}))
+}
+
+func TestDepositDataAdapter(t *testing.T) {
+	result := keygenResult(t, csmWithdrawalCredentials, types.PraterNetwork)
+
+	artifact, err := adapters["deposit-data"].Export(result, &AdapterOptions{WithdrawalCredentials: csmWithdrawalCredentials, Network: "prater"})
+	require.NoError(t, err)
+	depositData := artifact.([]DepositDataJson)
+	require.Len(t, depositData, 1)
+	require.Equal(t, result.Output[1].Data.ValidatorPubKey, depositData[0].PubKey)
+	require.Equal(t, "00001020", depositData[0].ForkVersion)
+
+	// the keygen signed for other credentials or another network
+	_, err = adapters["deposit-data"].Export(result, &AdapterOptions{WithdrawalCredentials: "01" + strings.Repeat("00", 31), Network: "prater"})
+	require.ErrorContains(t, err, "deposit signature isn't for withdrawal credentials")
+	_, err = adapters["deposit-data"].Export(result, &AdapterOptions{WithdrawalCredentials: csmWithdrawalCredentials, Network: "mainnet"})
+	require.Error(t, err)
+}
+
+func TestLidoCSMAdapter(t *testing.T) {
+	result := keygenResult(t, csmWithdrawalCredentials, types.MainNetwork)
+	opts := &AdapterOptions{WithdrawalCredentials: csmWithdrawalCredentials, Network: "mainnet"}
+	require.NoError(t, adapters["lido-csm"].Check(opts))
+
+	artifact, err := adapters["lido-csm"].Export(result, opts)
+	require.NoError(t, err)
+	submission := artifact.(*LidoCSMSubmission)
+	require.Nil(t, submission.NodeOperatorID)
+	require.Equal(t, 1, submission.KeysCount)
+	require.Equal(t, "0x"+result.Output[1].Data.ValidatorPubKey, submission.PublicKeys)
+	require.Equal(t, "0x"+result.Output[1].Data.DepositDataSignature, submission.Signatures)
+	require.Len(t, submission.PublicKeys, 2+2*48)
+	require.Len(t, submission.Signatures, 2+2*96)
+	require.Equal(t, csmWithdrawalCredentials, submission.DepositData[0].WithdrawalCredentials)
+
+	nodeOperatorID := uint64(12)
+	opts.CSMNodeOperatorID = &nodeOperatorID
+	artifact, err = adapters["lido-csm"].Export(result, opts)
+	require.NoError(t, err)
+	require.Equal(t, uint64(12), *artifact.(*LidoCSMSubmission).NodeOperatorID)
+}
+
+func TestObolAdapter(t *testing.T) {
+	result := keygenResult(t, csmWithdrawalCredentials, types.MainNetwork)
+	opts := &AdapterOptions{
+		WithdrawalCredentials: csmWithdrawalCredentials,
+		Network:               "mainnet",
+		Threshold:             3,
+		ClusterName:           "acme",
+		ENRs:                  map[types.OperatorID]string{2: "enr:-HW4QBHlcyD3fYWUMADiOv4OxODaL5wJG0a7P7d_ltu4VZe1MibZ1N-twFaoaq0BoCtXcY71etxLJGeEZT5p3XCO6GOAgmlkgnY0iXNlY3AyNTZrMaEDI2HRUlVBag__njkOWEEQRLlC9ylIVCrIXOuNBSlrx6o"},
+		FeeRecipient:          "0x" + strings.Repeat("CD", 20),
+		OperatorAddress: func(operatorID types.OperatorID) (string, error) {
+			return fmt.Sprintf("0x%040d", operatorID), nil
+		},
+	}
+	require.NoError(t, adapters["obol"].Check(opts))
+
+	artifact, err := adapters["obol"].Export(result, opts)
+	require.NoError(t, err)
+	lock := artifact.(*ObolClusterLock)
+	definition := lock.Definition
+	require.Equal(t, "acme", definition.Name)
+	require.Equal(t, ObolClusterVersion, definition.Version)
+	require.Equal(t, "frost", definition.DKGAlgorithm)
+	require.Equal(t, "0x00000000", definition.ForkVersion)
+	require.Equal(t, uint64(3), definition.Threshold)
+	require.Equal(t, []ObolValidatorAddrs{{
+		FeeRecipientAddress: "0x" + strings.Repeat("cd", 20),
+		WithdrawalAddress:   "0x" + lidoWithdrawalVaults[types.MainNetwork],
+	}}, definition.Validators)
+	require.Len(t, definition.Operators, 4)
+	require.Len(t, lock.DistributedValidators, 1)
+
+	validator := lock.DistributedValidators[0]
+	require.Equal(t, "0x"+result.Output[1].Data.ValidatorPubKey, validator.DistributedPublicKey)
+	require.Equal(t, "32000000000", validator.DepositData.Amount)
+	for i, operator := range definition.Operators {
+		require.Equal(t, uint32(i+1), operator.OperatorID)
+		require.Equal(t, i, operator.ShareIndex)
+		require.Equal(t, fmt.Sprintf("0x%040d", i+1), operator.Address)
+		require.Equal(t, opts.ENRs[types.OperatorID(i+1)], operator.ENR)
+		require.Equal(t, "0x"+result.Output[types.OperatorID(i+1)].Data.SharePubKey, validator.PublicShares[i])
+	}
+
+	opts.ENRs[7] = opts.ENRs[2]
+	_, err = adapters["obol"].Export(result, opts)
+	require.ErrorContains(t, err, "operator 7, which isn't in the committee")
+	delete(opts.ENRs, 7)
+
+	opts.Threshold = 5
+	_, err = adapters["obol"].Export(result, opts)
+	require.ErrorContains(t, err, "threshold 5 is more than the 4 operators")
+}
@@ -0,0 +1,127 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// decodedOutputs are the outputs of the result as the operators signed them,
+// with the request id they are for
+func (r *DKGResult) decodedOutputs() (string, map[types.OperatorID]*dkg.SignedOutput, error) {
+	if len(r.Output) == 0 {
+		return "", nil, fmt.Errorf("no outputs")
+	}
+	var requestID string
+	outputs := make(map[types.OperatorID]*dkg.SignedOutput, len(r.Output))
+	for _, operatorID := range r.sortedOperators() {
+		output, err := r.Output[operatorID].decode()
+		if err != nil {
+			return "", nil, fmt.Errorf("output of operator %d: %w", operatorID, err)
+		}
+		if output.KeySignData != nil {
+			requestID = hex.EncodeToString(output.KeySignData.RequestID[:])
+		} else {
+			requestID = hex.EncodeToString(output.Data.RequestID[:])
+		}
+		outputs[operatorID] = output
+	}
+	return requestID, outputs, nil
+}
+
+// approvedBy returns the operators whose approval of the result checks out
+func (r *DKGResult) approvedBy(keys observer.KeyLookup) ([]types.OperatorID, error) {
+	if r.Approval == nil {
+		return nil, nil
+	}
+	requestID, outputs, err := r.decodedOutputs()
+	if err != nil {
+		return nil, err
+	}
+	return r.Approval.Approved(requestID, outputs, keys)
+}
+
+// requireApprovals fails unless at least threshold operators approved the result
+func (r *DKGResult) requireApprovals(threshold int, keys observer.KeyLookup) error {
+	approved, err := r.approvedBy(keys)
+	if err != nil {
+		return fmt.Errorf("approvals: %w", err)
+	}
+	if len(approved) < threshold {
+		return fmt.Errorf("approved by %d of %d operators, %d required", len(approved), len(r.Output), threshold)
+	}
+	return nil
+}
+
+// collectApprovals asks every operator node for its signed approval of the
+// result and attaches the ones that check out. An operator that refuses or
+// approves another result is reported and left out.
+func (h *CliHandler) collectApprovals(requestID string, results *DKGResult, operators map[types.OperatorID]string, keys observer.KeyLookup) error {
+	_, outputs, err := results.decodedOutputs()
+	if err != nil {
+		return err
+	}
+	hash, err := observer.ResultHash(outputs)
+	if err != nil {
+		return err
+	}
+	ids := make([]types.OperatorID, 0, len(operators))
+	for operatorID := range operators {
+		ids = append(ids, operatorID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	approval := &observer.CommitteeApproval{ResultHash: hex.EncodeToString(hash)}
+	for _, operatorID := range ids {
+		signed := &observer.Approval{}
+		if err := h.getNodeJSON(fmt.Sprintf("%s/ceremonies/%s/approval", operators[operatorID], requestID), signed); err != nil {
+			fmt.Printf("warning: no approval from operator %d: %v\n", operatorID, err)
+			continue
+		}
+		if signed.Operator != operatorID || signed.RequestID != requestID {
+			fmt.Printf("warning: operator %d returned the approval of operator %d for request %s\n", operatorID, signed.Operator, signed.RequestID)
+			continue
+		}
+		pk, err := keys(operatorID)
+		if err != nil {
+			return fmt.Errorf("failed to get encryption key of operator %d: %w", operatorID, err)
+		}
+		if err := signed.Verify(pk); err != nil {
+			fmt.Printf("warning: approval of operator %d: %v\n", operatorID, err)
+			continue
+		}
+		if signed.ResultHash != approval.ResultHash {
+			fmt.Printf("warning: operator %d approved result %s, not %s\n", operatorID, signed.ResultHash, approval.ResultHash)
+			continue
+		}
+		approval.Approvals = append(approval.Approvals, signed)
+	}
+	results.Approval = approval
+	fmt.Printf("result %s approved by %d of %d operators\n", approval.ResultHash, len(approval.Approvals), len(results.Output))
+	return nil
+}
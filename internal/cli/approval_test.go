@@ -0,0 +1,83 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// approvalNode serves the approval of operatorID for outputs, signed with signer's key
+func approvalNode(t *testing.T, outputs *observer.CommitteeOutputs, operatorID, signer types.OperatorID) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ceremonies/"+outputs.RequestID+"/approval", r.URL.Path)
+		approval, err := observer.Approve(outputs.RequestID, operatorID, outputs.Outputs)
+		require.NoError(t, err)
+		require.NoError(t, approval.Sign(testingutils.TestingKeygenKeySet().DKGOperators[signer].EncryptionKey))
+		require.NoError(t, json.NewEncoder(w).Encode(approval))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCollectApprovals(t *testing.T) {
+	requestID := dkg.RequestID{1, 2, 3}
+	outputs := committeeOutputs(t, requestID, 1, 2, 3, 4)
+	result := formatResults(&messenger.DataStore{DKGOutputs: outputs.Outputs})
+	nodes := map[types.OperatorID]string{
+		1: approvalNode(t, outputs, 1, 1).URL,
+		2: approvalNode(t, outputs, 2, 2).URL,
+		3: approvalNode(t, outputs, 3, 1).URL,
+	}
+
+	h := New(logrus.New())
+	require.NoError(t, h.collectApprovals(hex.EncodeToString(requestID[:]), result, nodes, testingKeys))
+	require.Len(t, result.Approval.Approvals, 2)
+
+	approved, err := result.approvedBy(testingKeys)
+	require.NoError(t, err)
+	require.Equal(t, []types.OperatorID{1, 2}, approved)
+	require.NoError(t, result.requireApprovals(2, testingKeys))
+	require.EqualError(t, result.requireApprovals(3, testingKeys), "approved by 2 of 4 operators, 3 required")
+
+	// the approvals survive the artifact but not a change of the result
+	byts, err := json.Marshal(result)
+	require.NoError(t, err)
+	decoded := &DKGResult{}
+	require.NoError(t, json.Unmarshal(byts, decoded))
+	require.NoError(t, decoded.requireApprovals(2, testingKeys))
+	output := decoded.Output[4]
+	output.Data.SharePubKey = "09"
+	decoded.Output[4] = output
+	require.ErrorContains(t, decoded.requireApprovals(2, testingKeys), "approvals: approvals are for result")
+}
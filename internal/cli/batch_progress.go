@@ -0,0 +1,394 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+)
+
+// BatchProgressEvent is the X-DKG-Event of the notifications posted to
+// --batch-webhook, signed like the webhooks of the messenger
+const BatchProgressEvent = "batch-progress"
+
+var (
+	// batchPollInterval is the wait between two fetches of the results of
+	// the ceremonies of a batch that are still running
+	batchPollInterval = 5 * time.Second
+	// batchWebhookAttempts a notification is posted before it is dropped,
+	// the wait doubles from batchWebhookBackoff between them
+	batchWebhookAttempts = 4
+	batchWebhookBackoff  = time.Second
+)
+
+// BatchRequest are the params of startBatch, the ceremonies of the batch
+// are started in order: keygens first, then reshares
+type BatchRequest struct {
+	Keygens  []*KeygenRequest    `json:"keygens,omitempty"`
+	Reshares []*ResharingRequest `json:"reshares,omitempty"`
+}
+
+// BatchFailure is a ceremony of a batch that failed to start, ended with a
+// blame, was cancelled or had no result before --batch-timeout
+type BatchFailure struct {
+	// Index of the ceremony in the batch, reshares follow the keygens
+	Index     int    `json:"index"`
+	RequestID string `json:"request_id,omitempty"`
+	Error     string `json:"error"`
+}
+
+// BatchProgress is returned by getBatch and posted to --batch-webhook every
+// time a ceremony of the batch completes or fails
+type BatchProgress struct {
+	BatchID string `json:"batch_id"`
+	Total   int    `json:"total"`
+	// Completed ceremonies have the outputs of every operator
+	Completed int             `json:"completed"`
+	Failed    int             `json:"failed"`
+	Pending   int             `json:"pending"`
+	Failures  []*BatchFailure `json:"failures"`
+	// RequestIDs of the ceremonies by index, empty for the ones that failed
+	// to start
+	RequestIDs []string `json:"request_ids"`
+	StartedAt  int64    `json:"started_at"`
+	UpdatedAt  int64    `json:"updated_at"`
+	// ETASeconds is the estimated time until the last pending ceremony ends,
+	// at the pace of the ones that ended so far
+	ETASeconds int64 `json:"eta_seconds,omitempty"`
+	Done       bool  `json:"done"`
+}
+
+type batchParams struct {
+	BatchID string `json:"batch_id"`
+}
+
+// batchWebhook is the endpoint of a front end following the batches
+type batchWebhook struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// post sends a notification, again with a growing wait while the webhook
+// fails, and drops it after batchWebhookAttempts
+func (w *batchWebhook) post(logger *logrus.Logger, progress *BatchProgress) {
+	body, err := json.Marshal(progress)
+	if err != nil {
+		logger.Errorf("batchWebhook: failed to marshal progress of batch %s: %v", progress.BatchID, err)
+		return
+	}
+	backoff := batchWebhookBackoff
+	for attempt := 1; ; attempt++ {
+		err := w.postOnce(body)
+		if err == nil {
+			return
+		}
+		if attempt == batchWebhookAttempts {
+			logger.Warnf("batchWebhook: dropped progress of batch %s after %d attempts: %v", progress.BatchID, attempt, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *batchWebhook) postOnce(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(messengerclient.WebhookEventHeader, BatchProgressEvent)
+	req.Header.Set(messengerclient.WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(messengerclient.WebhookSignatureHeader, messengerclient.SignWebhook(w.secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %s", resp.Status)
+	}
+	return nil
+}
+
+// batchItem is one ceremony of a batch
+type batchItem struct {
+	kind      ceremony.Kind
+	operators map[types.OperatorID]string
+	// outputs the ceremony has once every operator of the new committee
+	// published its share
+	outputs int
+	start   func() (string, error)
+}
+
+// batchRun starts the ceremonies of a batch and follows their results until
+// all of them completed or failed
+type batchRun struct {
+	mu       sync.Mutex
+	progress *BatchProgress
+	items    []*batchItem
+	// ended holds the indexes of the ceremonies that completed or failed
+	ended      map[int]bool
+	startedAt  time.Time
+	timeout    time.Duration
+	ceremonies *ceremonyRegistry
+	result     func(requestID string) (*DKGResult, error)
+	notify     func(*BatchProgress)
+}
+
+func newBatchRun(items []*batchItem, timeout time.Duration, ceremonies *ceremonyRegistry) *batchRun {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	now := time.Now()
+	return &batchRun{
+		progress: &BatchProgress{
+			BatchID:    hex.EncodeToString(id),
+			Total:      len(items),
+			Pending:    len(items),
+			Failures:   make([]*BatchFailure, 0),
+			RequestIDs: make([]string, len(items)),
+			StartedAt:  now.Unix(),
+			UpdatedAt:  now.Unix(),
+		},
+		items:      items,
+		ended:      make(map[int]bool),
+		startedAt:  now,
+		timeout:    timeout,
+		ceremonies: ceremonies,
+		notify:     func(*BatchProgress) {},
+	}
+}
+
+// snapshot is a copy of the progress with the eta of the pending ceremonies
+func (b *batchRun) snapshot() *BatchProgress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	progress := *b.progress
+	progress.Failures = append([]*BatchFailure{}, b.progress.Failures...)
+	progress.RequestIDs = append([]string{}, b.progress.RequestIDs...)
+	if ended := progress.Completed + progress.Failed; ended > 0 && progress.Pending > 0 {
+		elapsed := time.Unix(progress.UpdatedAt, 0).Sub(b.startedAt)
+		progress.ETASeconds = int64((elapsed * time.Duration(progress.Pending) / time.Duration(ended)).Seconds())
+	}
+	return &progress
+}
+
+func (b *batchRun) complete(index int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ended[index] = true
+	b.progress.Completed++
+	b.progress.Pending--
+	b.progress.UpdatedAt = time.Now().Unix()
+}
+
+func (b *batchRun) fail(index int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ended[index] = true
+	b.progress.Failed++
+	b.progress.Pending--
+	b.progress.Failures = append(b.progress.Failures, &BatchFailure{
+		Index:     index,
+		RequestID: b.progress.RequestIDs[index],
+		Error:     err.Error(),
+	})
+	b.progress.UpdatedAt = time.Now().Unix()
+}
+
+// run starts every ceremony of the batch, then fetches the results of the
+// running ones every batchPollInterval. It notifies once all are started and
+// after every poll that completed or failed a ceremony.
+func (b *batchRun) run() {
+	for i, item := range b.items {
+		requestID, err := item.start()
+		if err != nil {
+			b.fail(i, err)
+			continue
+		}
+		b.mu.Lock()
+		b.progress.RequestIDs[i] = requestID
+		b.mu.Unlock()
+		b.ceremonies.add(&CeremonyInfo{
+			RequestID: requestID,
+			Kind:      item.kind,
+			Operators: item.operators,
+			StartedAt: time.Now().Unix(),
+		})
+	}
+	b.notify(b.snapshot())
+
+	deadline := b.startedAt.Add(b.timeout)
+	for !b.poll(time.Now().After(deadline)) {
+		time.Sleep(batchPollInterval)
+	}
+}
+
+// poll checks the ceremonies that are still running and fails them when
+// expired, it reports whether the batch is done
+func (b *batchRun) poll(expired bool) bool {
+	changed := false
+	for i, item := range b.items {
+		b.mu.Lock()
+		requestID, ended := b.progress.RequestIDs[i], b.ended[i]
+		b.mu.Unlock()
+		if ended {
+			continue
+		}
+
+		if info, ok := b.ceremonies.get(requestID); ok && info.Cancelled {
+			b.fail(i, fmt.Errorf("ceremony %s was cancelled", requestID))
+			changed = true
+			continue
+		}
+		result, err := b.result(requestID)
+		if err == nil {
+			err = result.blameFailure(requestID)
+		}
+		var failure *Failure
+		switch {
+		case err == nil && len(result.Output) >= item.outputs:
+			b.complete(i)
+			changed = true
+		case errors.As(err, &failure) && failure.Condition == ConditionBlame:
+			b.fail(i, err)
+			changed = true
+		case expired:
+			b.fail(i, fmt.Errorf("no result for ceremony %s after %s", requestID, b.timeout))
+			changed = true
+		}
+	}
+
+	progress := b.snapshot()
+	if progress.Pending == 0 {
+		b.mu.Lock()
+		b.progress.Done = true
+		b.mu.Unlock()
+		progress.Done = true
+	}
+	if changed || progress.Done {
+		b.notify(progress)
+	}
+	return progress.Done
+}
+
+// batchRegistry holds the batches started by serve
+type batchRegistry struct {
+	mu      sync.Mutex
+	runs    map[string]*batchRun
+	webhook *batchWebhook
+	timeout time.Duration
+}
+
+func newBatchRegistry() *batchRegistry {
+	return &batchRegistry{runs: make(map[string]*batchRun), timeout: time.Hour}
+}
+
+func (r *batchRegistry) add(run *batchRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[run.progress.BatchID] = run
+}
+
+func (r *batchRegistry) get(batchID string) (*batchRun, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[batchID]
+	return run, ok
+}
+
+// rpcStartBatch checks every ceremony of the batch, then starts them in the
+// background and returns the batch id to follow them with getBatch
+func (h *CliHandler) rpcStartBatch(params json.RawMessage) (interface{}, error) {
+	request := &BatchRequest{}
+	if err := decodeParams(params, request); err != nil {
+		return nil, err
+	}
+	if len(request.Keygens)+len(request.Reshares) == 0 {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "keygens or reshares are required"}
+	}
+
+	items := make([]*batchItem, 0, len(request.Keygens)+len(request.Reshares))
+	for _, keygen := range request.Keygens {
+		keygen := keygen
+		if err := validateKeygenRequest(keygen); err != nil {
+			err.Data = len(items)
+			return nil, err
+		}
+		items = append(items, &batchItem{
+			kind:      ceremony.KindKeygen,
+			operators: keygen.Operators,
+			outputs:   len(keygen.Operators),
+			start:     func() (string, error) { return h.startKeygen(keygen) },
+		})
+	}
+	for _, reshare := range request.Reshares {
+		reshare := reshare
+		if err := validateResharingRequest(reshare); err != nil {
+			err.Data = len(items)
+			return nil, err
+		}
+		items = append(items, &batchItem{
+			kind:      ceremony.KindReshare,
+			operators: reshareOperators(reshare),
+			outputs:   len(reshare.Operators),
+			start:     func() (string, error) { return h.startResharing(reshare) },
+		})
+	}
+
+	run := newBatchRun(items, h.batches.timeout, h.ceremonies)
+	run.result = h.DKGResultByRequestID
+	if webhook := h.batches.webhook; webhook != nil {
+		run.notify = func(progress *BatchProgress) { webhook.post(h.logger, progress) }
+	}
+	h.batches.add(run)
+	go run.run()
+	return &batchParams{BatchID: run.progress.BatchID}, nil
+}
+
+func (h *CliHandler) rpcGetBatch(params json.RawMessage) (interface{}, error) {
+	p := &batchParams{}
+	if err := decodeParams(params, p); err != nil {
+		return nil, err
+	}
+	run, ok := h.batches.get(p.BatchID)
+	if !ok {
+		return nil, &RPCError{Code: RPCBatchNotFound, Message: "batch not found", Data: p.BatchID}
+	}
+	return run.snapshot(), nil
+}
@@ -0,0 +1,150 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchRunProgress(t *testing.T) {
+	defer func(interval time.Duration) { batchPollInterval = interval }(batchPollInterval)
+	batchPollInterval = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	received := make([]*BatchProgress, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		require.Equal(t, BatchProgressEvent, r.Header.Get(messengerclient.WebhookEventHeader))
+		require.NoError(t, messengerclient.VerifyWebhook("secret", r.Header, body, time.Minute))
+		progress := &BatchProgress{}
+		require.NoError(t, json.Unmarshal(body, progress))
+		mu.Lock()
+		received = append(received, progress)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	webhook := &batchWebhook{url: srv.URL, secret: "secret", client: srv.Client()}
+
+	operators := map[types.OperatorID]string{1: "http://node1", 2: "http://node2"}
+	started := func(requestID string) func() (string, error) {
+		return func() (string, error) { return requestID, nil }
+	}
+	items := []*batchItem{
+		{kind: ceremony.KindKeygen, operators: operators, outputs: 2, start: started("aa")},
+		{kind: ceremony.KindKeygen, operators: operators, outputs: 2, start: func() (string, error) { return "", errors.New("messenger down") }},
+		{kind: ceremony.KindKeygen, operators: operators, outputs: 2, start: started("bb")},
+		{kind: ceremony.KindReshare, operators: operators, outputs: 2, start: started("cc")},
+	}
+	run := newBatchRun(items, time.Minute, newCeremonyRegistry())
+	run.notify = func(progress *BatchProgress) { webhook.post(logrus.New(), progress) }
+	polls := 0
+	run.result = func(requestID string) (*DKGResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		polls++
+		switch {
+		case requestID == "aa":
+			return &DKGResult{Output: map[types.OperatorID]SignedOutput{1: {}, 2: {}}}, nil
+		case requestID == "bb" && polls > 3:
+			return &DKGResult{Blame: &dkg.BlameOutput{}}, nil
+		case requestID == "cc" && polls > 6:
+			return &DKGResult{Output: map[types.OperatorID]SignedOutput{1: {}, 2: {}}}, nil
+		case requestID == "cc":
+			return &DKGResult{Output: map[types.OperatorID]SignedOutput{1: {}}}, nil
+		}
+		return nil, errors.New("no result yet")
+	}
+	run.run()
+
+	progress := run.snapshot()
+	require.True(t, progress.Done)
+	require.Equal(t, 4, progress.Total)
+	require.Equal(t, 2, progress.Completed)
+	require.Equal(t, 2, progress.Failed)
+	require.Zero(t, progress.Pending)
+	require.Equal(t, []string{"aa", "", "bb", "cc"}, progress.RequestIDs)
+	require.Len(t, progress.Failures, 2)
+	require.Equal(t, 1, progress.Failures[0].Index)
+	require.Equal(t, "messenger down", progress.Failures[0].Error)
+	require.Equal(t, "bb", progress.Failures[1].RequestID)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.GreaterOrEqual(t, len(received), 3)
+	require.Equal(t, 3, received[0].Pending, "first notification once every ceremony is started")
+	require.Equal(t, *progress, *received[len(received)-1])
+	for i := 1; i < len(received); i++ {
+		require.GreaterOrEqual(t, received[i].Completed+received[i].Failed, received[i-1].Completed+received[i-1].Failed)
+	}
+}
+
+func TestBatchRunTimeoutAndCancel(t *testing.T) {
+	ceremonies := newCeremonyRegistry()
+	items := []*batchItem{
+		{kind: ceremony.KindKeygen, outputs: 1, start: func() (string, error) { return "aa", nil }},
+		{kind: ceremony.KindKeygen, outputs: 1, start: func() (string, error) { return "bb", nil }},
+	}
+	run := newBatchRun(items, time.Minute, ceremonies)
+	run.result = func(string) (*DKGResult, error) { return nil, errors.New("no result yet") }
+	for i, item := range items {
+		requestID, _ := item.start()
+		run.progress.RequestIDs[i] = requestID
+		ceremonies.add(&CeremonyInfo{RequestID: requestID})
+	}
+
+	ceremonies.cancel("aa")
+	require.False(t, run.poll(false))
+	require.Equal(t, 1, run.snapshot().Failed)
+	require.True(t, run.poll(true))
+
+	progress := run.snapshot()
+	require.Equal(t, 2, progress.Failed)
+	require.Contains(t, progress.Failures[0].Error, "cancelled")
+	require.Contains(t, progress.Failures[1].Error, "no result")
+}
+
+func TestRPCStartBatchValidates(t *testing.T) {
+	h := New(logrus.New())
+	_, err := h.rpcStartBatch(json.RawMessage(`{}`))
+	require.Equal(t, RPCInvalidParams, err.(*RPCError).Code)
+
+	_, err = h.rpcStartBatch(json.RawMessage(`{"keygens":[{"operators":{"1":"http://node1"},"threshold":1}],"reshares":[{"operators":{"1":"http://node1"}}]}`))
+	require.Equal(t, RPCInvalidParams, err.(*RPCError).Code)
+	require.Equal(t, 1, err.(*RPCError).Data)
+
+	_, err = h.rpcGetBatch(json.RawMessage(`{"batch_id":"missing"}`))
+	require.Equal(t, RPCBatchNotFound, err.(*RPCError).Code)
+}
@@ -0,0 +1,196 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/cryptosuite"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+const capabilityKeysign = "keysign"
+
+// capabilityRequirement is what a ceremony needs of every node taking part
+type capabilityRequirement struct {
+	// Ceremony is keygen, reshare or keysign
+	Ceremony string
+	// Operators are the participants, old and new committee and observers
+	Operators int
+	// Observers need nodes that join as observer
+	Observers map[types.OperatorID]string
+	// MinProtocolVersion the ceremony is claimed at, 0 without a claim
+	MinProtocolVersion uint32
+	// Options the ceremony is started with
+	Options ceremony.Options
+	// Suite is the crypto suite of the ceremony, empty for the default one
+	Suite string
+}
+
+// checkCapabilities refuses a ceremony some node of the committee can't run,
+// before anything is sent. Nodes that don't advertise capabilities are older
+// and only warned about.
+func (h *CliHandler) checkCapabilities(requirement capabilityRequirement, participants ...map[types.OperatorID]string) error {
+	capabilities := h.committeeCapabilities(participants...)
+	for _, addrs := range participants {
+		for operatorID := range addrs {
+			if _, ok := capabilities[operatorID]; !ok {
+				h.logger.Warnf("checkCapabilities: operator %d doesn't advertise capabilities, it may not support the %s", operatorID, requirement.Ceremony)
+			}
+		}
+	}
+	if err := requirement.check(capabilities); err != nil {
+		return fail(ConditionValidation, err)
+	}
+	return nil
+}
+
+// check compares the capabilities of each operator with the requirement,
+// the refusals name every operator lacking a capability
+func (r capabilityRequirement) check(capabilities map[types.OperatorID]*messengerclient.Capabilities) error {
+	operatorIDs := make([]types.OperatorID, 0, len(capabilities))
+	for operatorID := range capabilities {
+		operatorIDs = append(operatorIDs, operatorID)
+	}
+	sort.Slice(operatorIDs, func(i, j int) bool { return operatorIDs[i] < operatorIDs[j] })
+
+	minVersion := r.MinProtocolVersion
+	if minVersion < ceremony.ProtocolV1 {
+		minVersion = ceremony.ProtocolV1
+	}
+	for _, operatorID := range operatorIDs {
+		c := capabilities[operatorID]
+		if r.Ceremony != capabilityKeysign && !c.Supports(messengerclient.ProtocolFROST) {
+			return fmt.Errorf("operator %d doesn't run the %s protocol", operatorID, messengerclient.ProtocolFROST)
+		}
+		if r.Ceremony == string(ceremony.KindReshare) && !c.Resharing {
+			return fmt.Errorf("operator %d doesn't support resharing", operatorID)
+		}
+		if r.Ceremony == capabilityKeysign && !c.Keysign {
+			return fmt.Errorf("operator %d doesn't support keysign", operatorID)
+		}
+		if _, ok := r.Observers[operatorID]; ok && !c.Observer {
+			return fmt.Errorf("operator %d doesn't join ceremonies as observer", operatorID)
+		}
+		if c.MaxCommittee > 0 && r.Operators > c.MaxCommittee {
+			return fmt.Errorf("operator %d takes at most %d operators, the %s has %d", operatorID, c.MaxCommittee, r.Ceremony, r.Operators)
+		}
+		if r.Ceremony == capabilityKeysign {
+			continue
+		}
+		if minVersion > c.ProtocolVersion {
+			return fmt.Errorf("operator %d speaks protocol version %d, the %s requires %d", operatorID, c.ProtocolVersion, r.Ceremony, minVersion)
+		}
+		if c.MinProtocolVersion > minVersion {
+			return fmt.Errorf("operator %d requires protocol version %d, start the %s with --min-protocol-version %d", operatorID, c.MinProtocolVersion, r.Ceremony, c.MinProtocolVersion)
+		}
+		for _, key := range r.Options.Keys() {
+			// nodes older than an option behave as with its default
+			if values := ceremony.SupportedOptions[key]; len(values) > 0 && values[0] == r.Options[key] {
+				continue
+			}
+			if !c.SupportsOption(key, r.Options[key]) {
+				return fmt.Errorf("operator %d doesn't support the ceremony option %s=%s", operatorID, key, r.Options[key])
+			}
+		}
+		// nodes older than suites run the default one
+		if suite := cryptosuite.Canonical(r.Suite); suite != "" && !c.SupportsSuite(suite) {
+			return fmt.Errorf("operator %d doesn't support the crypto suite %s", operatorID, suite)
+		}
+	}
+	return nil
+}
+
+// countParticipants counts the distinct operators of the participant lists
+func countParticipants(participants ...map[types.OperatorID]string) int {
+	operators := make(map[types.OperatorID]bool)
+	for _, addrs := range participants {
+		for operatorID := range addrs {
+			operators[operatorID] = true
+		}
+	}
+	return len(operators)
+}
+
+// committeeCapabilities are the capabilities the participants registered
+// with the messenger, or advertise themselves when the messenger has none
+func (h *CliHandler) committeeCapabilities(participants ...map[types.OperatorID]string) map[types.OperatorID]*messengerclient.Capabilities {
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+	registered, err := h.messengerClient().Capabilities(ctx)
+	if err != nil {
+		h.logger.Warnf("committeeCapabilities: failed to get capabilities from the messenger: %v", err)
+	}
+
+	capabilities := make(map[types.OperatorID]*messengerclient.Capabilities)
+	for _, addrs := range participants {
+		for operatorID, addr := range addrs {
+			if _, ok := capabilities[operatorID]; ok {
+				continue
+			}
+			if c, ok := registered[strconv.Itoa(int(operatorID))]; ok {
+				capabilities[operatorID] = c
+				continue
+			}
+			c, err := h.nodeCapabilities(addr)
+			if err != nil {
+				h.logger.Warnf("committeeCapabilities: failed to get capabilities of operator %d: %v", operatorID, err)
+				continue
+			}
+			if c != nil {
+				capabilities[operatorID] = c
+			}
+		}
+	}
+	return capabilities
+}
+
+// nodeCapabilities returns the capabilities of a node, nil for a node that
+// doesn't advertise any
+func (h *CliHandler) nodeCapabilities(addr string) (*messengerclient.Capabilities, error) {
+	resp, err := h.client.Get(addr + "/capabilities")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed with status %s: %s", resp.Status, string(respBody))
+	}
+	capabilities := &messengerclient.Capabilities{}
+	if err := json.Unmarshal(respBody, capabilities); err != nil {
+		return nil, err
+	}
+	return capabilities, nil
+}
@@ -0,0 +1,113 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func capabilitiesServer(t *testing.T, capabilities *messengerclient.Capabilities) string {
+	r := gin.New()
+	if capabilities != nil {
+		r.GET("/capabilities", func(c *gin.Context) { c.JSON(http.StatusOK, capabilities) })
+	}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func testCapabilities() *messengerclient.Capabilities {
+	return &messengerclient.Capabilities{
+		Protocols:          []string{messengerclient.ProtocolFROST},
+		ProtocolVersion:    ceremony.ProtocolV2,
+		MinProtocolVersion: ceremony.ProtocolV1,
+		MaxCommittee:       13,
+		Resharing:          true,
+		Keysign:            true,
+		Observer:           true,
+	}
+}
+
+func TestCapabilityRequirement(t *testing.T) {
+	noResharing := testCapabilities()
+	noResharing.Resharing = false
+	strict := testCapabilities()
+	strict.MinProtocolVersion = ceremony.ProtocolV2
+	capabilities := map[types.OperatorID]*messengerclient.Capabilities{1: testCapabilities(), 2: noResharing, 3: strict}
+
+	keygen := capabilityRequirement{Ceremony: string(ceremony.KindKeygen), Operators: 4}
+	require.ErrorContains(t, keygen.check(capabilities), "operator 3 requires protocol version 2")
+	keygen.MinProtocolVersion = ceremony.ProtocolV2
+	require.NoError(t, keygen.check(capabilities))
+	keygen.Operators = 14
+	require.ErrorContains(t, keygen.check(capabilities), "at most 13")
+
+	reshare := capabilityRequirement{Ceremony: string(ceremony.KindReshare), Operators: 4, MinProtocolVersion: ceremony.ProtocolV2}
+	require.ErrorContains(t, reshare.check(capabilities), "operator 2 doesn't support resharing")
+
+	noObserver := testCapabilities()
+	noObserver.Observer = false
+	observed := capabilityRequirement{Ceremony: string(ceremony.KindKeygen), Operators: 5, Observers: map[types.OperatorID]string{5: ""}}
+	require.NoError(t, observed.check(map[types.OperatorID]*messengerclient.Capabilities{1: noObserver}))
+	require.ErrorContains(t, observed.check(map[types.OperatorID]*messengerclient.Capabilities{5: noObserver}), "observer")
+
+	keysign := capabilityRequirement{Ceremony: capabilityKeysign, Operators: 4}
+	require.NoError(t, keysign.check(capabilities), "versions are claimed by keygen and resharing only")
+
+	withOptions := testCapabilities()
+	withOptions.Options = ceremony.SupportedOptions
+	optioned := capabilityRequirement{Ceremony: string(ceremony.KindKeygen), Operators: 4, Options: ceremony.Options{ceremony.OptionTranscript: "off"}}
+	require.NoError(t, optioned.check(map[types.OperatorID]*messengerclient.Capabilities{1: withOptions}))
+	require.ErrorContains(t, optioned.check(map[types.OperatorID]*messengerclient.Capabilities{1: withOptions, 2: testCapabilities()}), "operator 2 doesn't support the ceremony option transcript=off")
+	optioned.Options = ceremony.Options{ceremony.OptionTranscript: "full"}
+	require.NoError(t, optioned.check(map[types.OperatorID]*messengerclient.Capabilities{2: testCapabilities()}), "older nodes run with the defaults")
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(logrus.New())
+	h.messengerAddr = capabilitiesServer(t, nil)
+	noResharing := testCapabilities()
+	noResharing.Resharing = false
+	operators := map[types.OperatorID]string{
+		1: capabilitiesServer(t, testCapabilities()),
+		2: capabilitiesServer(t, noResharing),
+		3: capabilitiesServer(t, nil),
+		4: "http://127.0.0.1:1",
+	}
+
+	keygen := capabilityRequirement{Ceremony: string(ceremony.KindKeygen), Operators: 4}
+	require.NoError(t, h.checkCapabilities(keygen, operators), "operators 3 and 4 advertise nothing")
+
+	reshare := capabilityRequirement{Ceremony: string(ceremony.KindReshare), Operators: 4}
+	require.Equal(t, ExitValidation, ExitCode(h.checkCapabilities(reshare, operators)))
+}
@@ -0,0 +1,140 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// CeremonyConfig is the committee and parameters of a keygen or resharing
+// read from --config, yaml or json. Flags given on the command line take
+// precedence over the file, an --operator flag replaces its operators.
+type CeremonyConfig struct {
+	// Operators of the committee, without an endpoint they are looked up in
+	// the address book
+	Operators []CommitteeOperator `yaml:"operators"`
+	// OldOperators are the committee a resharing moves the validator from
+	OldOperators          []CommitteeOperator `yaml:"old_operators"`
+	Threshold             int                 `yaml:"threshold"`
+	WithdrawalCredentials string              `yaml:"withdrawal_credentials"`
+	ForkVersion           string              `yaml:"fork_version"`
+	ValidatorPK           string              `yaml:"validator_pk"`
+}
+
+func configFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "config",
+		Aliases: []string{"c"},
+		Usage:   "yaml or json file with the operators, threshold, withdrawal credentials and fork version (validator pk and old operators for a resharing), flags override it",
+	}
+}
+
+func loadCeremonyConfig(path string) (*CeremonyConfig, error) {
+	byts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadCeremonyConfig: %w", err)
+	}
+	config := &CeremonyConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(byts))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("loadCeremonyConfig: invalid %s: %w", path, err)
+	}
+	for name, operators := range map[string][]CommitteeOperator{"operators": config.Operators, "old_operators": config.OldOperators} {
+		seen := make(map[types.OperatorID]bool)
+		for _, operator := range operators {
+			if operator.ID == 0 {
+				return nil, fmt.Errorf("loadCeremonyConfig: operator without id in %s of %s", name, path)
+			}
+			if seen[operator.ID] {
+				return nil, fmt.Errorf("loadCeremonyConfig: operator %d listed twice in %s of %s", operator.ID, name, path)
+			}
+			seen[operator.ID] = true
+		}
+	}
+	return config, nil
+}
+
+// operatorValues turns the operators of a config into --operator values
+func operatorValues(operators []CommitteeOperator) []string {
+	values := make([]string, 0, len(operators))
+	for _, operator := range operators {
+		value := strconv.FormatUint(uint64(operator.ID), 10)
+		if operator.Endpoint != "" {
+			value += "=" + operator.Endpoint
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// applyCeremonyConfig sets the flags the command line left out from the
+// --config file, then checks the required ones are there
+func applyCeremonyConfig(c *cli.Context, required ...string) error {
+	if path := c.String("config"); path != "" {
+		config, err := loadCeremonyConfig(path)
+		if err != nil {
+			return err
+		}
+		threshold := ""
+		if config.Threshold != 0 {
+			threshold = strconv.Itoa(config.Threshold)
+		}
+		values := []struct {
+			flag   string
+			values []string
+		}{
+			{"operator", operatorValues(config.Operators)},
+			{"old-operator", operatorValues(config.OldOperators)},
+			{"threshold", []string{threshold}},
+			{"withdrawal-credentials", []string{config.WithdrawalCredentials}},
+			{"fork-version", []string{config.ForkVersion}},
+			{"validator-pk", []string{config.ValidatorPK}},
+		}
+		for _, value := range values {
+			if c.IsSet(value.flag) {
+				continue
+			}
+			for _, v := range value.values {
+				if v == "" {
+					continue
+				}
+				if err := c.Set(value.flag, v); err != nil {
+					return fmt.Errorf("applyCeremonyConfig: %s doesn't take the %s of %s", c.Command.Name, value.flag, path)
+				}
+			}
+		}
+	}
+	for _, name := range required {
+		if !c.IsSet(name) {
+			return fmt.Errorf("--%s is required, on the command line or in --config", name)
+		}
+	}
+	return nil
+}
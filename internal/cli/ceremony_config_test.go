@@ -0,0 +1,107 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// parseWith runs command with args, parsing its request instead of starting
+// the ceremony
+func parseWith(t *testing.T, command *cli.Command, parse func(c *cli.Context) error, args ...string) error {
+	command.Action = parse
+	app := &cli.App{Commands: []*cli.Command{command}}
+	return app.Run(append([]string{"cli", command.Name}, args...))
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestKeygenConfig(t *testing.T) {
+	path := writeConfig(t, "keygen.yaml", `
+operators:
+  - id: 1
+    endpoint: http://0.0.0.0:8081
+  - id: 2
+    endpoint: http://0.0.0.0:8082
+  - id: 3
+    endpoint: http://0.0.0.0:8083
+  - id: 4
+    endpoint: http://0.0.0.0:8084
+threshold: 3
+withdrawal_credentials: "010000000000000000000000535953b5a6040074948cf185eaa7d2abbd66808f"
+fork_version: prater
+`)
+	h := CliHandler{}
+	request := &KeygenRequest{}
+	require.NoError(t, parseWith(t, h.CommandKeygen(), request.parseKeygenRequest, "--config", path))
+	require.Len(t, request.Operators, 4)
+	require.Equal(t, "http://0.0.0.0:8083", request.Operators[3])
+	require.Equal(t, 3, request.Threshold)
+	require.Equal(t, "prater", request.ForkVersion)
+
+	// flags take precedence, an --operator flag replaces the operators
+	request = &KeygenRequest{}
+	require.NoError(t, parseWith(t, h.CommandKeygen(), request.parseKeygenRequest, "--config", path, "--threshold", "4", "--operator", "7=http://0.0.0.0:8087"))
+	require.Equal(t, map[types.OperatorID]string{7: "http://0.0.0.0:8087"}, request.Operators)
+	require.Equal(t, 4, request.Threshold)
+	require.Equal(t, "010000000000000000000000535953b5a6040074948cf185eaa7d2abbd66808f", request.WithdrawalCredential)
+
+	err := parseWith(t, h.CommandKeygen(), (&KeygenRequest{}).parseKeygenRequest, "--operator", "1=http://0.0.0.0:8081", "--threshold", "3")
+	require.ErrorContains(t, err, "--withdrawal-credentials is required")
+}
+
+func TestResharingConfig(t *testing.T) {
+	path := writeConfig(t, "resharing.json", `{
+  "operators": [{"id": 5, "endpoint": "http://0.0.0.0:8085"}, {"id": 6, "endpoint": "http://0.0.0.0:8086"}],
+  "old_operators": [{"id": 1, "endpoint": "http://0.0.0.0:8081"}],
+  "threshold": 3,
+  "validator_pk": "adf8b634f1c2bb64fe61af95b208a2a7bdac0d2d15963f83463bdb85c7e726250bfa3a390bf01edfc0700d61f4bee579"
+}`)
+	h := CliHandler{}
+	request := &ResharingRequest{}
+	require.NoError(t, parseWith(t, h.CommandResharing(), request.parseResharingRequest, "--config", path))
+	require.Len(t, request.Operators, 2)
+	require.Equal(t, map[types.OperatorID]string{1: "http://0.0.0.0:8081"}, request.OperatorsOld)
+	require.Equal(t, 3, request.Threshold)
+
+	// a keygen has no old operators
+	err := parseWith(t, h.CommandKeygen(), (&KeygenRequest{}).parseKeygenRequest, "--config", path)
+	require.ErrorContains(t, err, "keygen doesn't take the old-operator")
+}
+
+func TestLoadCeremonyConfig(t *testing.T) {
+	_, err := loadCeremonyConfig(writeConfig(t, "twice.yaml", "operators:\n  - id: 1\n  - id: 1\n"))
+	require.ErrorContains(t, err, "operator 1 listed twice")
+
+	_, err = loadCeremonyConfig(writeConfig(t, "typo.yaml", "treshold: 3\n"))
+	require.ErrorContains(t, err, "treshold")
+}
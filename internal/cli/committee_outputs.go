@@ -0,0 +1,90 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// registryAddress looks up the owner address of an operator in the operator registry
+func registryAddress(operatorID types.OperatorID) (string, error) {
+	operator, err := storage.FetchOperatorByID(operatorID)
+	if err != nil {
+		return "", err
+	}
+	return hexenc.Format(operator.ETHAddress[:]), nil
+}
+
+// registryKeys looks up the encryption keys of operators in the operator registry
+func registryKeys(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+	operator, err := storage.FetchOperatorByID(operatorID)
+	if err != nil {
+		return nil, err
+	}
+	return operator.EncryptionPubKey, nil
+}
+
+// committeeResult rebuilds the result of a ceremony from the outputs the
+// operator nodes stored for it, for when the messenger lost its copy. The
+// outputs of a node are verified again against the registry keys and taken
+// from the first node whose set is complete and consistent.
+func (h *CliHandler) committeeResult(requestID string, operators map[types.OperatorID]string, keys observer.KeyLookup) (*DKGResult, error) {
+	ids := make([]types.OperatorID, 0, len(operators))
+	for operatorID := range operators {
+		ids = append(ids, operatorID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var problems []string
+	for _, operatorID := range ids {
+		report := &observer.OutputsReport{}
+		if err := h.getNodeJSON(fmt.Sprintf("%s/ceremonies/%s/committee-outputs", operators[operatorID], requestID), report); err != nil {
+			problems = append(problems, fmt.Sprintf("operator %d: %v", operatorID, err))
+			continue
+		}
+		outputs := report.CommitteeOutputs
+		if outputs == nil || outputs.RequestID != requestID || len(outputs.Outputs) == 0 {
+			problems = append(problems, fmt.Sprintf("operator %d: no outputs for the request", operatorID))
+			continue
+		}
+		// a node that didn't track the ceremony can't tell who is missing
+		if len(outputs.Operators) == 0 {
+			outputs.Operators = ids
+		}
+		if findings := outputs.Verify(keys); len(findings) > 0 {
+			problems = append(problems, fmt.Sprintf("operator %d: %s", operatorID, strings.Join(findings, ", ")))
+			continue
+		}
+		h.logger.Infof("committeeResult: rebuilt result of request %s from the outputs stored by operator %d", requestID, operatorID)
+		return formatResults(&messenger.DataStore{DKGOutputs: outputs.Outputs, Canary: outputs.Canary}), nil
+	}
+	return nil, fmt.Errorf("no operator has the complete outputs of ceremony %s: %s", requestID, strings.Join(problems, "; "))
+}
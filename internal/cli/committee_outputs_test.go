@@ -0,0 +1,81 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func testingKeys(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+	return &testingutils.TestingKeygenKeySet().DKGOperators[operatorID].EncryptionKey.PublicKey, nil
+}
+
+func committeeOutputs(t *testing.T, requestID dkg.RequestID, operators ...types.OperatorID) *observer.CommitteeOutputs {
+	outputs := observer.NewCommitteeOutputs(hex.EncodeToString(requestID[:]), []types.OperatorID{1, 2, 3, 4})
+	for _, operatorID := range operators {
+		output := &dkg.Output{RequestID: requestID, SharePubKey: []byte{byte(operatorID)}, ValidatorPubKey: []byte("validator")}
+		root, err := types.ComputeSigningRoot(output, types.ComputeSignatureDomain(types.PrimusTestnet, types.DKGSignatureType))
+		require.NoError(t, err)
+		sig, err := types.Sign(testingutils.TestingKeygenKeySet().DKGOperators[operatorID].EncryptionKey, root)
+		require.NoError(t, err)
+		require.NoError(t, outputs.Add(&dkg.SignedOutput{Data: output, Signer: operatorID, Signature: sig}, testingKeys))
+	}
+	return outputs
+}
+
+func outputsNode(t *testing.T, outputs *observer.CommitteeOutputs) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ceremonies/"+outputs.RequestID+"/committee-outputs", r.URL.Path)
+		require.NoError(t, json.NewEncoder(w).Encode(outputs.Report(testingKeys)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCommitteeResult(t *testing.T) {
+	requestID := dkg.RequestID{1, 2, 3}
+	partial := outputsNode(t, committeeOutputs(t, requestID, 1, 2, 3))
+	complete := outputsNode(t, committeeOutputs(t, requestID, 1, 2, 3, 4))
+
+	h := New(logrus.New())
+	result, err := h.committeeResult(hex.EncodeToString(requestID[:]), map[types.OperatorID]string{1: partial.URL, 2: complete.URL}, testingKeys)
+	require.NoError(t, err)
+	require.Len(t, result.Output, 4)
+	vk, err := result.GetValidatorPK()
+	require.NoError(t, err)
+	require.Equal(t, types.ValidatorPK("validator"), vk)
+
+	_, err = h.committeeResult(hex.EncodeToString(requestID[:]), map[types.OperatorID]string{1: partial.URL}, testingKeys)
+	require.ErrorContains(t, err, "operator 1: no output of operator 4")
+}
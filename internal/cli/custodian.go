@@ -0,0 +1,338 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Submitter is implemented by adapters whose artifact can be pushed to the
+// API of the protocol or custodian it is meant for
+type Submitter interface {
+	Adapter
+	// CheckSubmit validates the credentials before the ceremony result is fetched
+	CheckSubmit(opts *CustodianOptions) error
+	Submit(artifact interface{}, opts *CustodianOptions) (*CustodianReceipt, error)
+}
+
+// CustodianOptions are the customer's account and API credentials at a
+// custodian, only needed when the submission is pushed
+type CustodianOptions struct {
+	// URL overrides the onboarding endpoint of the custodian
+	URL string
+	// Account is the Fireblocks vault account or the Copper portfolio the validator is onboarded to
+	Account string
+	APIKey  string
+	// Secret is the path to the PEM private key of the API user for Fireblocks
+	// and the API secret for Copper
+	Secret string
+
+	client *http.Client
+	now    func() time.Time
+}
+
+func (o *CustodianOptions) httpClient() *http.Client {
+	if o.client != nil {
+		return o.client
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+func (o *CustodianOptions) clock() time.Time {
+	if o.now != nil {
+		return o.now()
+	}
+	return time.Now()
+}
+
+func (o *CustodianOptions) endpoint(defaultURL string) string {
+	if o.URL != "" {
+		return o.URL
+	}
+	return defaultURL
+}
+
+// CustodianReceipt is what the custodian answered to a submission
+type CustodianReceipt struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// CustodianValidator is the validator and deposit of a submission, hex
+// values are 0x prefixed and the amount is in gwei
+type CustodianValidator struct {
+	PubKey                string `json:"pubkey"`
+	WithdrawalCredentials string `json:"withdrawalCredentials"`
+	Amount                string `json:"amount"`
+	DepositSignature      string `json:"depositSignature"`
+	DepositMessageRoot    string `json:"depositMessageRoot"`
+	DepositDataRoot       string `json:"depositDataRoot"`
+	ForkVersion           string `json:"forkVersion"`
+}
+
+func custodianValidator(depositData *DepositDataJson) CustodianValidator {
+	return CustodianValidator{
+		PubKey:                "0x" + depositData.PubKey,
+		WithdrawalCredentials: "0x" + depositData.WithdrawalCredentials,
+		Amount:                strconv.FormatUint(uint64(depositData.Amount), 10),
+		DepositSignature:      "0x" + depositData.Signature,
+		DepositMessageRoot:    "0x" + depositData.DepositMessageRoot,
+		DepositDataRoot:       "0x" + depositData.DepositDataRoot,
+		ForkVersion:           "0x" + depositData.ForkVersion,
+	}
+}
+
+// postJSON sends a submission with the authentication headers sign sets and
+// decodes the receipt
+func postJSON(endpoint string, body interface{}, opts *CustodianOptions, sign func(req *http.Request, payload []byte) error) (*CustodianReceipt, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := sign(req, payload); err != nil {
+		return nil, err
+	}
+
+	resp, err := opts.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s answered %d: %s", endpoint, resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	receipt := &CustodianReceipt{}
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, receipt); err != nil {
+			return nil, fmt.Errorf("%s answered an invalid receipt: %w", endpoint, err)
+		}
+	}
+	return receipt, nil
+}
+
+// fireblocksURL is the validator onboarding endpoint of the Fireblocks API
+const fireblocksURL = "https://api.fireblocks.io/v1/staking/validators"
+
+// fireblocksChains are the Fireblocks asset ids of the networks
+var fireblocksChains = map[types.BeaconNetwork]string{
+	types.MainNetwork:   "ETH",
+	types.PraterNetwork: "ETH_TEST3",
+}
+
+// FireblocksSubmission onboards validators generated outside Fireblocks to a vault account
+type FireblocksSubmission struct {
+	VaultAccountID  string               `json:"vaultAccountId"`
+	ChainDescriptor string               `json:"chainDescriptor"`
+	Validators      []CustodianValidator `json:"validators"`
+}
+
+type fireblocksAdapter struct{}
+
+func (fireblocksAdapter) Name() string { return "fireblocks" }
+
+func (fireblocksAdapter) Check(opts *AdapterOptions) error {
+	return checkDepositOptions(opts)
+}
+
+func (fireblocksAdapter) Export(result *DKGResult, opts *AdapterOptions) (interface{}, error) {
+	depositData, err := verifiedDepositData(result, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &FireblocksSubmission{
+		VaultAccountID:  opts.Custodian.Account,
+		ChainDescriptor: fireblocksChains[types.NetworkFromString(opts.Network)],
+		Validators:      []CustodianValidator{custodianValidator(depositData)},
+	}, nil
+}
+
+func (fireblocksAdapter) CheckSubmit(opts *CustodianOptions) error {
+	if opts.Account == "" {
+		return fmt.Errorf("--custodian-account, the vault account id, is required")
+	}
+	if opts.APIKey == "" || opts.Secret == "" {
+		return fmt.Errorf("--custodian-api-key and --custodian-secret, the path to the API user's private key, are required")
+	}
+	_, err := readRSAPrivateKey(opts.Secret)
+	return err
+}
+
+// Submit signs the request with a Fireblocks API token, a JWT over the
+// request path and body signed by the API user's RSA key
+func (fireblocksAdapter) Submit(artifact interface{}, opts *CustodianOptions) (*CustodianReceipt, error) {
+	sk, err := readRSAPrivateKey(opts.Secret)
+	if err != nil {
+		return nil, err
+	}
+	return postJSON(opts.endpoint(fireblocksURL), artifact, opts, func(req *http.Request, payload []byte) error {
+		token, err := fireblocksToken(sk, opts.APIKey, req.URL, payload, opts.clock())
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-API-Key", opts.APIKey)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+func fireblocksToken(sk *rsa.PrivateKey, apiKey string, uri *url.URL, payload []byte, now time.Time) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	bodyHash := sha256.Sum256(payload)
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"uri":      uri.RequestURI(),
+		"nonce":    hex.EncodeToString(nonce),
+		"iat":      now.Unix(),
+		"exp":      now.Add(30 * time.Second).Unix(),
+		"sub":      apiKey,
+		"bodyHash": hex.EncodeToString(bodyHash[:]),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sk, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// readRSAPrivateKey reads a PKCS#8 or PKCS#1 PEM encoded RSA key
+func readRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s isn't PEM encoded", path)
+	}
+	if sk, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return sk, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't an RSA private key: %w", path, err)
+	}
+	sk, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't an RSA private key", path)
+	}
+	return sk, nil
+}
+
+// copperURL is the validator onboarding endpoint of the Copper platform API
+const copperURL = "https://api.copper.co/platform/staking/validators"
+
+// CopperSubmission onboards validators generated outside Copper to a portfolio
+type CopperSubmission struct {
+	PortfolioID string               `json:"portfolioId"`
+	Currency    string               `json:"currency"`
+	Network     string               `json:"network"`
+	Validators  []CustodianValidator `json:"validators"`
+}
+
+type copperAdapter struct{}
+
+func (copperAdapter) Name() string { return "copper" }
+
+func (copperAdapter) Check(opts *AdapterOptions) error {
+	return checkDepositOptions(opts)
+}
+
+func (copperAdapter) Export(result *DKGResult, opts *AdapterOptions) (interface{}, error) {
+	depositData, err := verifiedDepositData(result, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &CopperSubmission{
+		PortfolioID: opts.Custodian.Account,
+		Currency:    "ETH",
+		Network:     string(types.NetworkFromString(opts.Network)),
+		Validators:  []CustodianValidator{custodianValidator(depositData)},
+	}, nil
+}
+
+func (copperAdapter) CheckSubmit(opts *CustodianOptions) error {
+	if opts.Account == "" {
+		return fmt.Errorf("--custodian-account, the portfolio id, is required")
+	}
+	if opts.APIKey == "" || opts.Secret == "" {
+		return fmt.Errorf("--custodian-api-key and --custodian-secret are required")
+	}
+	return nil
+}
+
+// Submit signs the request the way the Copper API expects, an HMAC-SHA256
+// with the API secret over the timestamp, method, path and body
+func (copperAdapter) Submit(artifact interface{}, opts *CustodianOptions) (*CustodianReceipt, error) {
+	return postJSON(opts.endpoint(copperURL), artifact, opts, func(req *http.Request, payload []byte) error {
+		timestamp := strconv.FormatInt(opts.clock().UnixMilli(), 10)
+		req.Header.Set("Authorization", "ApiKey "+opts.APIKey)
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Signature", copperSignature(opts.Secret, timestamp, req.Method, req.URL.RequestURI(), payload))
+		return nil
+	})
+}
+
+func copperSignature(secret, timestamp, method, uri string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + method + uri))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,140 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustodianAdapters(t *testing.T) {
+	result := keygenResult(t, csmWithdrawalCredentials, types.PraterNetwork)
+	opts := &AdapterOptions{WithdrawalCredentials: csmWithdrawalCredentials, Network: "prater", Custodian: CustodianOptions{Account: "7"}}
+
+	artifact, err := adapters["fireblocks"].Export(result, opts)
+	require.NoError(t, err)
+	fireblocks := artifact.(*FireblocksSubmission)
+	require.Equal(t, "7", fireblocks.VaultAccountID)
+	require.Equal(t, "ETH_TEST3", fireblocks.ChainDescriptor)
+	require.Len(t, fireblocks.Validators, 1)
+	validator := fireblocks.Validators[0]
+	require.Equal(t, "0x"+result.Output[1].Data.ValidatorPubKey, validator.PubKey)
+	require.Equal(t, "0x"+result.Output[1].Data.DepositDataSignature, validator.DepositSignature)
+	require.Equal(t, "0x"+csmWithdrawalCredentials, validator.WithdrawalCredentials)
+	require.Equal(t, "32000000000", validator.Amount)
+	require.Equal(t, "0x00001020", validator.ForkVersion)
+	require.Len(t, validator.DepositDataRoot, 2+64)
+
+	artifact, err = adapters["copper"].Export(result, opts)
+	require.NoError(t, err)
+	copper := artifact.(*CopperSubmission)
+	require.Equal(t, "7", copper.PortfolioID)
+	require.Equal(t, "prater", copper.Network)
+	require.Equal(t, validator, copper.Validators[0])
+
+	// only the custodian adapters push their output
+	_, ok := adapters["obol"].(Submitter)
+	require.False(t, ok)
+	require.ErrorContains(t, adapters["copper"].(Submitter).CheckSubmit(&CustodianOptions{APIKey: "key", Secret: "secret"}), "--custodian-account")
+	require.ErrorContains(t, adapters["copper"].(Submitter).CheckSubmit(&CustodianOptions{Account: "7"}), "--custodian-api-key")
+	require.ErrorContains(t, adapters["fireblocks"].(Submitter).CheckSubmit(&CustodianOptions{Account: "7", APIKey: "key", Secret: filepath.Join(t.TempDir(), "missing.pem")}), "no such file")
+}
+
+func TestFireblocksSubmit(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(sk)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "fireblocks.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, "api-key", r.Header.Get("X-API-Key"))
+
+		// the token is an RS256 JWT over the path and body of the request
+		parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+		require.Len(t, parts, 3)
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		require.NoError(t, rsa.VerifyPKCS1v15(&sk.PublicKey, crypto.SHA256, digest[:], signature))
+		claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		claims := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(claimsJSON, &claims))
+		bodyHash := sha256.Sum256(body)
+		require.Equal(t, "/v1/onboard?x=1", claims["uri"])
+		require.Equal(t, "api-key", claims["sub"])
+		require.Equal(t, hex.EncodeToString(bodyHash[:]), claims["bodyHash"])
+
+		submission := &FireblocksSubmission{}
+		require.NoError(t, json.Unmarshal(body, submission))
+		require.Equal(t, "7", submission.VaultAccountID)
+		_, _ = w.Write([]byte(`{"id":"sub-1","status":"PENDING"}`))
+	}))
+	defer server.Close()
+
+	opts := &CustodianOptions{URL: server.URL + "/v1/onboard?x=1", Account: "7", APIKey: "api-key", Secret: keyFile}
+	submitter := adapters["fireblocks"].(Submitter)
+	require.NoError(t, submitter.CheckSubmit(opts))
+	receipt, err := submitter.Submit(&FireblocksSubmission{VaultAccountID: "7"}, opts)
+	require.NoError(t, err)
+	require.Equal(t, &CustodianReceipt{ID: "sub-1", Status: "PENDING"}, receipt)
+}
+
+func TestCopperSubmit(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.Equal(t, "ApiKey api-key", r.Header.Get("Authorization"))
+		require.Equal(t, "1700000000123", r.Header.Get("X-Timestamp"))
+		require.Equal(t, copperSignature("secret", "1700000000123", http.MethodPost, "/platform/validators", body), r.Header.Get("X-Signature"))
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"error":"portfolio not found"}`))
+	}))
+	defer server.Close()
+
+	opts := &CustodianOptions{URL: server.URL + "/platform/validators", Account: "p-1", APIKey: "api-key", Secret: "secret", now: func() time.Time { return now }}
+	_, err := adapters["copper"].(Submitter).Submit(&CopperSubmission{PortfolioID: "p-1"}, opts)
+	require.ErrorContains(t, err, "answered 422: {\"error\":\"portfolio not found\"}")
+}
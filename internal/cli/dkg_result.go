@@ -28,6 +28,7 @@ import (
 	"strconv"
 
 	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 )
@@ -35,6 +36,16 @@ import (
 type DKGResult struct {
 	Output map[types.OperatorID]SignedOutput `json:"output,omitempty"`
 	Blame  *dkg.BlameOutput                  `json:"blame,omitempty"`
+	// Attestations of the observers of the ceremony, added by get-dkg-results
+	Attestations []*observer.Attestation `json:"attestations,omitempty"`
+	// Approval are the signatures of the committee operators over the hash of
+	// the consolidated result, added by get-dkg-results --approvals
+	Approval *observer.CommitteeApproval `json:"approval,omitempty"`
+	// Canary results come from a canary keygen and never back a validator
+	Canary bool `json:"canary,omitempty"`
+	// ManifestHash is the hash of the manifest the ceremony was started with,
+	// known when it was started from this machine
+	ManifestHash string `json:"manifest_hash,omitempty"`
 }
 
 type Output struct {
@@ -96,6 +107,98 @@ func (r *DKGResult) GetSignatureFromKeySign() (string, error) {
 	return hex.EncodeToString(sig), nil
 }
 
+// blameFailure is the failure of a ceremony that ended with a blame output,
+// nil when it has a result
+func (r *DKGResult) blameFailure(requestID string) error {
+	if r.Blame == nil {
+		return nil
+	}
+	if r.Blame.BlameMessage != nil {
+		return fail(ConditionBlame, fmt.Errorf("ceremony %s ended with a blame output from operator %d", requestID, r.Blame.BlameMessage.Signer))
+	}
+	return fail(ConditionBlame, fmt.Errorf("ceremony %s ended with a blame output", requestID))
+}
+
+// canaryFailure refuses the result of a canary keygen for anything that
+// would make it back a validator
+func (r *DKGResult) canaryFailure(requestID string) error {
+	if !r.Canary {
+		return nil
+	}
+	return fail(ConditionValidation, fmt.Errorf("ceremony %s is a canary keygen, its result can't be used for a validator", requestID))
+}
+
+// verifyOutputs checks the signature of every operator output against the
+// registry key of the operator and that the outputs are of one validator
+func (r *DKGResult) verifyOutputs(keys observer.KeyLookup) error {
+	if r.Blame != nil {
+		return fmt.Errorf("ceremony ended with a blame output")
+	}
+	if len(r.Output) == 0 {
+		return fmt.Errorf("no outputs")
+	}
+	for _, operatorID := range r.sortedOperators() {
+		output, err := r.Output[operatorID].decode()
+		if err != nil {
+			return fmt.Errorf("output of operator %d: %w", operatorID, err)
+		}
+		if output.Signer != operatorID {
+			return fmt.Errorf("output of operator %d is signed by operator %d", operatorID, output.Signer)
+		}
+		if err := observer.VerifySignedOutput(output, keys); err != nil {
+			return fmt.Errorf("output of operator %d: %w", operatorID, err)
+		}
+	}
+	if r.Output[r.sortedOperators()[0]].KeySignData.Signature != "" {
+		_, err := r.GetSignatureFromKeySign()
+		return err
+	}
+	_, err := r.GetValidatorPK()
+	return err
+}
+
+// decode is the inverse of formatResults for one output
+func (o SignedOutput) decode() (*dkg.SignedOutput, error) {
+	signer, err := strconv.ParseUint(o.Signer, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer %q", o.Signer)
+	}
+	signature, err := hex.DecodeString(o.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	output := &dkg.SignedOutput{Signer: types.OperatorID(signer), Signature: signature}
+
+	fields := []string{o.Data.RequestID, o.Data.EncryptedShare, o.Data.SharePubKey, o.Data.ValidatorPubKey, o.Data.DepositDataSignature}
+	if o.KeySignData.Signature != "" {
+		fields = []string{o.KeySignData.RequestID, o.KeySignData.ValidatorPubKey, o.KeySignData.Signature}
+	}
+	decoded := make([][]byte, len(fields))
+	for i, field := range fields {
+		if decoded[i], err = hex.DecodeString(field); err != nil {
+			return nil, fmt.Errorf("invalid hex: %w", err)
+		}
+	}
+	var requestID dkg.RequestID
+	if len(decoded[0]) != len(requestID) {
+		return nil, fmt.Errorf("invalid request id %q", fields[0])
+	}
+	copy(requestID[:], decoded[0])
+
+	if o.KeySignData.Signature != "" {
+		output.KeySignData = &dkg.KeySignOutput{RequestID: requestID, ValidatorPK: decoded[1], Signature: decoded[2]}
+		return output, nil
+	}
+	output.Data = &dkg.Output{
+		RequestID:            requestID,
+		EncryptedShare:       decoded[1],
+		SharePubKey:          decoded[2],
+		ValidatorPubKey:      decoded[3],
+		DepositDataSignature: decoded[4],
+	}
+	return output, nil
+}
+
 func formatResults(data *messenger.DataStore) *DKGResult {
 	if data.BlameOutput != nil {
 		return formatBlameResults(data.BlameOutput)
@@ -131,7 +234,7 @@ func formatResults(data *messenger.DataStore) *DKGResult {
 		}
 	}
 
-	return &DKGResult{Output: output}
+	return &DKGResult{Output: output, Canary: data.Canary}
 }
 
 func formatBlameResults(blameOutput *dkg.BlameOutput) *DKGResult {
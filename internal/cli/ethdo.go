@@ -0,0 +1,128 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+)
+
+// deposit data and change operations are written in the formats ethdo and
+// the staking deposit cli write, and read in any of them, so the artifacts
+// can move between this cli and ethdo based runbooks
+
+// ethdoDepositData is any of the deposit data formats: the launchpad format
+// of the staking deposit cli and ethdo --launchpad with bare hex, and the
+// default format of ethdo with 0x prefixed hex, the account name and a version
+type ethdoDepositData struct {
+	PubKey                string      `json:"pubkey"`
+	WithdrawalCredentials string      `json:"withdrawal_credentials"`
+	Signature             string      `json:"signature"`
+	Amount                phase0.Gwei `json:"amount"`
+	DepositDataRoot       string      `json:"deposit_data_root"`
+	DepositMessageRoot    string      `json:"deposit_message_root"`
+	ForkVersion           string      `json:"fork_version"`
+	NetworkName           string      `json:"network_name"`
+	// Eth2NetworkName is the network name of staking deposit cli 1.x
+	Eth2NetworkName   string `json:"eth2_network_name"`
+	DepositCliVersion string `json:"deposit_cli_version"`
+}
+
+// networkNames are the networks of the fork versions deposits are signed with
+var networkNames = map[string]string{
+	"00000000": "mainnet",
+	"00001020": "prater",
+	"01017000": "holesky",
+}
+
+// parseDepositData reads deposit data in any of the formats, a list or a
+// single deposit, into the launchpad format
+func parseDepositData(byts []byte) ([]DepositDataJson, error) {
+	var deposits []ethdoDepositData
+	if err := unmarshalOneOrMany(byts, &deposits); err != nil {
+		return nil, fmt.Errorf("parseDepositData: %w", err)
+	}
+	if len(deposits) == 0 {
+		return nil, fmt.Errorf("parseDepositData: no deposits")
+	}
+
+	parsed := make([]DepositDataJson, 0, len(deposits))
+	for i, deposit := range deposits {
+		if deposit.PubKey == "" || deposit.WithdrawalCredentials == "" || deposit.Signature == "" || deposit.Amount == 0 {
+			return nil, fmt.Errorf("parseDepositData: deposit %d misses its pubkey, withdrawal credentials, signature or amount", i)
+		}
+		data := DepositDataJson{
+			PubKey:                bareHex(deposit.PubKey),
+			WithdrawalCredentials: bareHex(deposit.WithdrawalCredentials),
+			Amount:                deposit.Amount,
+			Signature:             bareHex(deposit.Signature),
+			DepositMessageRoot:    bareHex(deposit.DepositMessageRoot),
+			DepositDataRoot:       bareHex(deposit.DepositDataRoot),
+			ForkVersion:           bareHex(deposit.ForkVersion),
+			NetworkName:           deposit.NetworkName,
+			DepositCliVersion:     deposit.DepositCliVersion,
+		}
+		if data.NetworkName == "" {
+			data.NetworkName = deposit.Eth2NetworkName
+		}
+		if data.NetworkName == "" {
+			data.NetworkName = networkNames[data.ForkVersion]
+		}
+		parsed = append(parsed, data)
+	}
+	return parsed, nil
+}
+
+// parseChangeOperations reads signed bls to execution changes, the list ethdo
+// writes to change-operations.json or a single change
+func parseChangeOperations(byts []byte) ([]SignedBLSToExecutionChangeJson, error) {
+	var changes []SignedBLSToExecutionChangeJson
+	if err := unmarshalOneOrMany(byts, &changes); err != nil {
+		return nil, fmt.Errorf("parseChangeOperations: %w", err)
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("parseChangeOperations: no changes")
+	}
+	for i, change := range changes {
+		if change.Message.FromBLSPubkey == "" || change.Signature == "" {
+			return nil, fmt.Errorf("parseChangeOperations: change %d isn't a signed bls to execution change", i)
+		}
+	}
+	return changes, nil
+}
+
+// unmarshalOneOrMany unmarshals a json list, or a single object as a list of one
+func unmarshalOneOrMany(byts []byte, list interface{}) error {
+	byts = bytes.TrimSpace(byts)
+	if len(byts) > 0 && byts[0] != '[' {
+		byts = append(append([]byte{'['}, byts...), ']')
+	}
+	return json.Unmarshal(byts, list)
+}
+
+func bareHex(s string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+}
@@ -0,0 +1,121 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+// the formats ethdo writes, from its depositdata and credentials set commands
+const (
+	ethdoLaunchpadFormat   = `[{"pubkey":"%s","withdrawal_credentials":"%s","amount":%d,"signature":"%s","deposit_message_root":"%s","deposit_data_root":"%s","fork_version":"%s","network_name":"%s","deposit_cli_version":"%s"}]`
+	ethdoDepositDataFormat = `{"name":"Deposit for validators/1","account":"validators/1","pubkey":"0x%s","withdrawal_credentials":"0x%s","signature":"0x%s","amount":%d,"deposit_data_root":"0x%s","deposit_message_root":"0x%s","fork_version":"0x%s","version":3}`
+	ethdoChangeFormat      = `[{"message":{"validator_index":"%d","from_bls_pubkey":"0x%s","to_execution_address":"%s"},"signature":"0x%s"}]`
+)
+
+func TestDepositDataEthdoRoundTrip(t *testing.T) {
+	result := keygenResult(t, csmWithdrawalCredentials, types.PraterNetwork)
+	deposit, err := depositDataFromResult(result, csmWithdrawalCredentials, "prater")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "deposit-data.json")
+	require.NoError(t, utils.WriteJSON(path, []DepositDataJson{*deposit}))
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	launchpad := fmt.Sprintf(ethdoLaunchpadFormat, deposit.PubKey, deposit.WithdrawalCredentials, deposit.Amount, deposit.Signature,
+		deposit.DepositMessageRoot, deposit.DepositDataRoot, deposit.ForkVersion, deposit.NetworkName, deposit.DepositCliVersion)
+	require.Equal(t, launchpad+"\n", string(written))
+
+	parsed, err := parseDepositData(written)
+	require.NoError(t, err)
+	require.Equal(t, []DepositDataJson{*deposit}, parsed)
+	require.NoError(t, parsed[0].Verify())
+
+	// the default ethdo format of the same deposit
+	ethdo := fmt.Sprintf(ethdoDepositDataFormat, deposit.PubKey, deposit.WithdrawalCredentials, deposit.Signature, deposit.Amount,
+		deposit.DepositDataRoot, deposit.DepositMessageRoot, deposit.ForkVersion)
+	parsed, err = parseDepositData([]byte(ethdo))
+	require.NoError(t, err)
+	require.Len(t, parsed, 1)
+	require.Equal(t, deposit.PubKey, parsed[0].PubKey)
+	require.Equal(t, "prater", parsed[0].NetworkName)
+	require.NoError(t, parsed[0].Verify())
+
+	// a deposit of another amount has another signing root
+	parsed[0].Amount = 1_000_000_000
+	require.ErrorContains(t, parsed[0].Verify(), "deposit signature isn't for withdrawal credentials")
+	parsed[0].Amount = deposit.Amount
+	parsed[0].DepositDataRoot = strings.Repeat("00", 32)
+	require.ErrorContains(t, parsed[0].Verify(), "deposit data root")
+
+	_, err = parseDepositData([]byte(`[{"pubkey":"0x00"}]`))
+	require.Error(t, err)
+}
+
+func TestChangeOperationsEthdoRoundTrip(t *testing.T) {
+	types.InitBLS()
+	sk := &bls.SecretKey{}
+	sk.SetByCSPRNG()
+	pk := sk.GetPublicKey().Serialize()
+	address := common.HexToAddress("0x1d2f14d2dffee594b4093d42e4bc1b0ea55e8aa7")
+
+	change := &BLSToExecutionChange{ValidatorIndex: 412345}
+	copy(change.FromBLSPubkey[:], pk)
+	copy(change.ToExecutionAddress[:], address[:])
+	network := blsToExecutionNetworks["holesky"]
+	signingRoot, err := change.SigningRoot(network)
+	require.NoError(t, err)
+	signature := hex.EncodeToString(sk.SignByte(signingRoot[:]).Serialize())
+
+	path := filepath.Join(t.TempDir(), "change-operations.json")
+	require.NoError(t, utils.WriteJSON(path, []SignedBLSToExecutionChangeJson{signedChangeJson(change, signature)}))
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	ethdo := fmt.Sprintf(ethdoChangeFormat, 412345, hex.EncodeToString(pk), "0x1d2F14D2dFfEe594b4093d42e4BC1b0EA55e8Aa7", signature)
+	require.Equal(t, ethdo+"\n", string(written))
+
+	changes, err := parseChangeOperations([]byte(ethdo))
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.NoError(t, changes[0].Verify(network))
+	require.Error(t, changes[0].Verify(blsToExecutionNetworks["mainnet"]))
+
+	// a single change, with the address in lower case
+	single := strings.TrimSuffix(strings.TrimPrefix(ethdo, "["), "]")
+	changes, err = parseChangeOperations([]byte(strings.ToLower(single)))
+	require.NoError(t, err)
+	require.NoError(t, changes[0].Verify(network))
+
+	_, err = parseChangeOperations([]byte(`[{"message":{}}]`))
+	require.Error(t, err)
+}
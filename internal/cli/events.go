@@ -0,0 +1,148 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	EventServeStarted      = "serve_started"
+	EventTopicCreated      = "topic_created"
+	EventObserverInvited   = "observer_invited"
+	EventStartSent         = "start_sent"
+	EventStartRelayed      = "start_relayed"
+	EventCeremonyStarted   = "ceremony_started"
+	EventCeremonyFailed    = "ceremony_failed"
+	EventCeremonyCancelled = "ceremony_cancelled"
+	EventNodeState         = "node_state"
+	EventNodeUnreachable   = "node_unreachable"
+	EventNodeOverloaded    = "node_overloaded"
+)
+
+// EventRecord is one line of the --events-out file, a JSON object per line so
+// it can be piped into jq or shipped to a log pipeline as is
+type EventRecord struct {
+	Time      time.Time          `json:"time"`
+	Command   string             `json:"command"`
+	Event     string             `json:"event"`
+	RequestID string             `json:"request_id,omitempty"`
+	Kind      ceremony.Kind      `json:"kind,omitempty"`
+	Operators []types.OperatorID `json:"operators,omitempty"`
+	Operator  types.OperatorID   `json:"operator,omitempty"`
+	State     ceremony.State     `json:"state,omitempty"`
+	Details   string             `json:"details,omitempty"`
+}
+
+// eventLog appends event records to a file. A nil log drops every record, so
+// commands emit events without checking whether --events-out was set.
+type eventLog struct {
+	command string
+
+	mu     sync.Mutex
+	file   *os.File
+	states map[string]ceremony.State
+}
+
+func eventsOutFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "events-out",
+		Usage: "append structured events as JSON lines to this file",
+	}
+}
+
+// openEventLog opens the --events-out file of the command for appending, it
+// returns a nil log when the flag isn't set
+func openEventLog(c *cli.Context) (*eventLog, error) {
+	path := c.String("events-out")
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open events file: %w", err)
+	}
+	return &eventLog{command: c.Command.Name, file: file, states: make(map[string]ceremony.State)}, nil
+}
+
+func (l *eventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// emit writes one record, a record is a single write so lines of concurrent
+// emitters never interleave
+func (l *eventLog) emit(e *EventRecord) {
+	if l == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.Command = l.command
+	byts, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.file.Write(append(byts, '\n'))
+}
+
+// ceremonyDelivered records the outcome of delivering a start message
+func (l *eventLog) ceremonyDelivered(requestID string, kind ceremony.Kind, operators []types.OperatorID, err error) {
+	e := &EventRecord{Event: EventCeremonyStarted, RequestID: requestID, Kind: kind, Operators: operators}
+	if err != nil {
+		e.Event, e.Details = EventCeremonyFailed, err.Error()
+	}
+	l.emit(e)
+}
+
+// nodeState records the state of a ceremony on an operator node, polling the
+// same state again isn't recorded
+func (l *eventLog) nodeState(requestID string, operatorID types.OperatorID, state *NodeCeremonyState) {
+	if l == nil {
+		return
+	}
+	if state.Error != "" {
+		l.emit(&EventRecord{Event: EventNodeUnreachable, RequestID: requestID, Operator: operatorID, Details: state.Error})
+		return
+	}
+
+	key := fmt.Sprintf("%s/%d", requestID, operatorID)
+	l.mu.Lock()
+	changed := l.states[key] != state.State
+	l.states[key] = state.State
+	l.mu.Unlock()
+	if changed {
+		l.emit(&EventRecord{Event: EventNodeState, RequestID: requestID, Operator: operatorID, State: state.State})
+	}
+}
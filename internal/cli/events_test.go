@@ -0,0 +1,104 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func eventsContext(t *testing.T, path string) *cli.Context {
+	set := flag.NewFlagSet("serve", flag.ContinueOnError)
+	set.String("events-out", "", "")
+	require.NoError(t, set.Parse([]string{"--events-out", path}))
+	c := cli.NewContext(cli.NewApp(), set, nil)
+	c.Command = &cli.Command{Name: "serve"}
+	return c
+}
+
+func readEvents(t *testing.T, path string) []*EventRecord {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	records := []*EventRecord{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := &EventRecord{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestEventLogWritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	events, err := openEventLog(eventsContext(t, path))
+	require.NoError(t, err)
+	events.ceremonyDelivered("aa", ceremony.KindKeygen, []types.OperatorID{1, 2, 3, 4}, nil)
+	events.ceremonyDelivered("bb", ceremony.KindReshare, []types.OperatorID{1, 2}, errors.New("operator 2 unreachable"))
+	for _, state := range []ceremony.State{ceremony.StateRound1, ceremony.StateRound1, ceremony.StateRound2} {
+		events.nodeState("aa", 3, &NodeCeremonyState{State: state})
+	}
+	events.nodeState("aa", 4, &NodeCeremonyState{Error: "connection refused"})
+	require.NoError(t, events.Close())
+
+	// a second run appends to the same file
+	events, err = openEventLog(eventsContext(t, path))
+	require.NoError(t, err)
+	events.emit(&EventRecord{Event: EventServeStarted, Details: "0.0.0.0:8000"})
+	require.NoError(t, events.Close())
+
+	records := readEvents(t, path)
+	require.Len(t, records, 6)
+	require.Equal(t, EventCeremonyStarted, records[0].Event)
+	require.Equal(t, "serve", records[0].Command)
+	require.Equal(t, []types.OperatorID{1, 2, 3, 4}, records[0].Operators)
+	require.False(t, records[0].Time.IsZero())
+	require.Equal(t, EventCeremonyFailed, records[1].Event)
+	require.Equal(t, "operator 2 unreachable", records[1].Details)
+	require.Equal(t, ceremony.StateRound1, records[2].State, "repeated states are recorded once")
+	require.Equal(t, ceremony.StateRound2, records[3].State)
+	require.Equal(t, EventNodeUnreachable, records[4].Event)
+	require.Equal(t, EventServeStarted, records[5].Event)
+}
+
+func TestEventLogDisabled(t *testing.T) {
+	events, err := openEventLog(eventsContext(t, ""))
+	require.NoError(t, err)
+	require.Nil(t, events)
+
+	events.emit(&EventRecord{Event: EventServeStarted})
+	events.nodeState("aa", 1, &NodeCeremonyState{State: ceremony.StateRound1})
+	require.NoError(t, events.Close())
+}
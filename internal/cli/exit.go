@@ -0,0 +1,264 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes of the cli. They are part of its interface, pipelines branch on
+// them, so a code is never reused for another condition.
+const (
+	ExitOK              = 0
+	ExitError           = 1
+	ExitPartialDelivery = 2
+	ExitTimeout         = 3
+	ExitBlame           = 4
+	ExitValidation      = 5
+	ExitUnreachable     = 6
+	ExitAttestation     = 7
+	ExitDivergence      = 8
+	ExitInconsistent    = 9
+)
+
+// Condition is a way a command can go wrong, each condition has its exit code
+type Condition string
+
+const (
+	// ConditionPartialDelivery is a start message that reached some operators but not all
+	ConditionPartialDelivery Condition = "partial-delivery"
+	// ConditionTimeout is a ceremony whose result didn't arrive in time
+	ConditionTimeout Condition = "timeout"
+	// ConditionBlame is a ceremony that ended with a blame output instead of a result
+	ConditionBlame Condition = "blame"
+	// ConditionValidation are invalid flags or ceremony parameters
+	ConditionValidation Condition = "validation"
+	// ConditionLintWarning are lint warnings on the ceremony parameters, fatal they are a validation error
+	ConditionLintWarning Condition = "lint-warning"
+	// ConditionUnreachable is a messenger, or every operator, that can't be reached
+	ConditionUnreachable Condition = "unreachable"
+	// ConditionAttestation is an observer that doesn't vouch for the result
+	ConditionAttestation Condition = "attestation"
+	// ConditionDivergence are two coordinators holding different results of a ceremony
+	ConditionDivergence Condition = "divergence"
+	// ConditionInconsistent are nodes of a committee configured in ways that make ceremonies fail
+	ConditionInconsistent Condition = "inconsistent"
+)
+
+var conditionCodes = map[Condition]int{
+	ConditionPartialDelivery: ExitPartialDelivery,
+	ConditionTimeout:         ExitTimeout,
+	ConditionBlame:           ExitBlame,
+	ConditionValidation:      ExitValidation,
+	ConditionUnreachable:     ExitUnreachable,
+	ConditionAttestation:     ExitAttestation,
+	ConditionDivergence:      ExitDivergence,
+	ConditionInconsistent:    ExitInconsistent,
+}
+
+// tolerable are the conditions --fail-on can turn into warnings, the command
+// still produces its output with them. Every other condition is always fatal.
+var tolerable = []Condition{ConditionPartialDelivery, ConditionBlame, ConditionAttestation, ConditionLintWarning}
+
+// defaultFailOn keeps lint warnings and attestations warnings, like before
+// there was a policy
+var defaultFailOn = []string{string(ConditionPartialDelivery), string(ConditionBlame)}
+
+// Failure is an error of a command together with the condition that decides its exit code
+type Failure struct {
+	Condition Condition
+	Err       error
+}
+
+func fail(condition Condition, err error) error {
+	return &Failure{Condition: condition, Err: err}
+}
+
+func (f *Failure) Error() string {
+	return f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Code is the exit code of the failure, errors without a condition exit with ExitError
+func (f *Failure) Code() int {
+	if code, ok := conditionCodes[f.Condition]; ok {
+		return code
+	}
+	return ExitError
+}
+
+// WithExitCodes wraps the actions of the commands and their subcommands so
+// every error they return is a Failure. Errors the cli returns before an
+// action runs, a missing required flag or an invalid flag value, are then
+// told apart by ExitCode as validation errors.
+func WithExitCodes(commands []*cli.Command) []*cli.Command {
+	for _, command := range commands {
+		if action := command.Action; action != nil {
+			command.Action = func(c *cli.Context) error {
+				err := action(c)
+				var failure *Failure
+				if err == nil || errors.As(err, &failure) {
+					return err
+				}
+				return &Failure{Err: err}
+			}
+		}
+		WithExitCodes(command.Subcommands)
+	}
+	return commands
+}
+
+// ExitCode is the exit code of an error returned by a cli app whose commands
+// are wrapped with WithExitCodes
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var failure *Failure
+	if errors.As(err, &failure) {
+		return failure.Code()
+	}
+	return ExitValidation
+}
+
+func failOnFlag() cli.Flag {
+	names := make([]string, 0, len(tolerable))
+	for _, condition := range tolerable {
+		names = append(names, string(condition))
+	}
+	return &cli.StringSliceFlag{
+		Name:  "fail-on",
+		Usage: fmt.Sprintf("conditions that fail the command, the others are printed as warnings: %s, all or none", strings.Join(names, ", ")),
+		Value: cli.NewStringSlice(defaultFailOn...),
+	}
+}
+
+// failPolicy are the tolerable conditions that are fatal for the command
+type failPolicy map[Condition]bool
+
+// parseFailOn reads --fail-on, commands without the flag use the defaults
+func parseFailOn(c *cli.Context) (failPolicy, error) {
+	values := c.StringSlice("fail-on")
+	if values == nil {
+		values = defaultFailOn
+	}
+
+	policy := make(failPolicy)
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			switch name = strings.TrimSpace(name); name {
+			case "", "none":
+			case "all":
+				for _, condition := range tolerable {
+					policy[condition] = true
+				}
+			default:
+				if !isTolerable(Condition(name)) {
+					return nil, fail(ConditionValidation, fmt.Errorf("--fail-on: unknown condition %q", name))
+				}
+				policy[Condition(name)] = true
+			}
+		}
+	}
+	return policy, nil
+}
+
+func isTolerable(condition Condition) bool {
+	for _, c := range tolerable {
+		if c == condition {
+			return true
+		}
+	}
+	return false
+}
+
+// tolerate returns err unless it is a failure the --fail-on policy of the
+// command tolerates, that one is printed as a warning and dropped
+func tolerate(c *cli.Context, err error) error {
+	var failure *Failure
+	if err == nil || !errors.As(err, &failure) || !isTolerable(failure.Condition) {
+		return err
+	}
+	policy, policyErr := parseFailOn(c)
+	if policyErr != nil {
+		return policyErr
+	}
+	if policy[failure.Condition] {
+		return err
+	}
+	fmt.Printf("warning: %s: %v\n", failure.Condition, err)
+	return nil
+}
+
+// strictLint reports whether lint warnings block the command, with --strict
+// or when --fail-on includes lint-warning
+func strictLint(c *cli.Context) (bool, error) {
+	policy, err := parseFailOn(c)
+	if err != nil {
+		return false, err
+	}
+	return c.Bool("strict") || policy[ConditionLintWarning], nil
+}
+
+// unreachable classifies errors of requests that never got a response
+func unreachable(err error) error {
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return fail(ConditionUnreachable, err)
+	}
+	return err
+}
+
+// deliveryFailure is the failure of sending a start message to the operators,
+// a partial delivery when at least one operator got it
+func deliveryFailure(failed map[types.OperatorID]error, total int) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	ids := make([]types.OperatorID, 0, len(failed))
+	for operatorID := range failed {
+		ids = append(ids, operatorID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	reasons := make([]string, 0, len(ids))
+	for _, operatorID := range ids {
+		reasons = append(reasons, fmt.Sprintf("operator %d: %v", operatorID, failed[operatorID]))
+	}
+	err := fmt.Errorf("start message not delivered to %d of %d operators: %s", len(failed), total, strings.Join(reasons, "; "))
+	if len(failed) == total {
+		return fail(ConditionUnreachable, err)
+	}
+	return fail(ConditionPartialDelivery, err)
+}
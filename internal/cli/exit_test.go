@@ -0,0 +1,155 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func failOnContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	require.NoError(t, failOnFlag().Apply(set))
+	require.NoError(t, set.Parse(args))
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+func TestParseFailOn(t *testing.T) {
+	policy, err := parseFailOn(failOnContext(t))
+	require.NoError(t, err)
+	require.Equal(t, failPolicy{ConditionPartialDelivery: true, ConditionBlame: true}, policy)
+
+	policy, err = parseFailOn(failOnContext(t, "--fail-on", "blame,attestation", "--fail-on", "lint-warning"))
+	require.NoError(t, err)
+	require.Equal(t, failPolicy{ConditionBlame: true, ConditionAttestation: true, ConditionLintWarning: true}, policy)
+
+	policy, err = parseFailOn(failOnContext(t, "--fail-on", "all"))
+	require.NoError(t, err)
+	require.Len(t, policy, len(tolerable))
+
+	policy, err = parseFailOn(failOnContext(t, "--fail-on", "none"))
+	require.NoError(t, err)
+	require.Empty(t, policy)
+
+	_, err = parseFailOn(failOnContext(t, "--fail-on", "validation"))
+	require.Error(t, err, "validation errors are always fatal")
+	require.Equal(t, ExitValidation, ExitCode(err))
+}
+
+func TestTolerate(t *testing.T) {
+	partial := fmt.Errorf("HandleKeygen: %w", fail(ConditionPartialDelivery, errors.New("operator 4 unreachable")))
+	require.Error(t, tolerate(failOnContext(t), partial))
+	require.NoError(t, tolerate(failOnContext(t, "--fail-on", "blame"), partial))
+
+	blame := fail(ConditionBlame, errors.New("blamed"))
+	require.Error(t, tolerate(failOnContext(t, "--fail-on", "partial-delivery,blame"), blame))
+	require.NoError(t, tolerate(failOnContext(t, "--fail-on", "none"), blame))
+
+	unreachable := fail(ConditionUnreachable, errors.New("messenger down"))
+	require.Error(t, tolerate(failOnContext(t, "--fail-on", "none"), unreachable), "only tolerable conditions are dropped")
+	require.NoError(t, tolerate(failOnContext(t), nil))
+}
+
+func TestExitCode(t *testing.T) {
+	require.Equal(t, ExitOK, ExitCode(nil))
+	require.Equal(t, ExitError, ExitCode(&Failure{Err: errors.New("boom")}))
+	require.Equal(t, ExitBlame, ExitCode(fmt.Errorf("HandleGetData: %w", fail(ConditionBlame, errors.New("blamed")))))
+	require.Equal(t, ExitValidation, ExitCode(errors.New("Required flag \"request-id\" not set")))
+}
+
+func TestWithExitCodes(t *testing.T) {
+	run := func(action cli.ActionFunc, args ...string) int {
+		app := &cli.App{
+			Name: "rockx-dkg-cli",
+			Commands: WithExitCodes([]*cli.Command{{
+				Name:   "get-dkg-results",
+				Action: action,
+				Flags:  []cli.Flag{&cli.StringFlag{Name: "request-id", Required: true}},
+			}}),
+		}
+		return ExitCode(app.Run(append([]string{"rockx-dkg-cli", "get-dkg-results"}, args...)))
+	}
+
+	require.Equal(t, ExitOK, run(func(*cli.Context) error { return nil }, "--request-id", "aa"))
+	require.Equal(t, ExitError, run(func(*cli.Context) error { return errors.New("boom") }, "--request-id", "aa"))
+	require.Equal(t, ExitTimeout, run(func(*cli.Context) error { return fail(ConditionTimeout, errors.New("late")) }, "--request-id", "aa"))
+	require.Equal(t, ExitValidation, run(func(*cli.Context) error { return nil }), "missing required flag")
+	require.Equal(t, ExitValidation, run(func(*cli.Context) error { return nil }, "--request-id", "aa", "--unknown"))
+}
+
+func TestBlameFailure(t *testing.T) {
+	require.NoError(t, (&DKGResult{}).blameFailure("aa"))
+	err := (&DKGResult{Blame: &dkg.BlameOutput{BlameMessage: &dkg.SignedMessage{Signer: 3}}}).blameFailure("aa")
+	require.Equal(t, ExitBlame, ExitCode(err))
+	require.Contains(t, err.Error(), "operator 3")
+}
+
+func TestCanaryFailure(t *testing.T) {
+	require.NoError(t, (&DKGResult{}).canaryFailure("aa"))
+	err := (&DKGResult{Canary: true}).canaryFailure("aa")
+	require.Equal(t, ExitValidation, ExitCode(err))
+	require.Contains(t, err.Error(), "canary")
+}
+
+func TestDeliverKeygenPartial(t *testing.T) {
+	t.Setenv("DKG_ADDRESS_BOOK", filepath.Join(t.TempDir(), "address_book.json"))
+	t.Setenv("DKG_TOPIC_CACHE", filepath.Join(t.TempDir(), "topics.json"))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	messenger := httptest.NewServer(ok)
+	defer messenger.Close()
+	up := httptest.NewServer(ok)
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	h := New(logrus.New())
+	h.messengerAddr = messenger.URL
+
+	request := testKeygenRequest()
+	request.Operators = map[types.OperatorID]string{1: up.URL, 2: up.URL, 3: up.URL, 4: down.URL}
+	requestID, err := h.startKeygen(request)
+	require.NotEmpty(t, requestID, "the ceremony was started on some operators")
+	require.Equal(t, ExitPartialDelivery, ExitCode(err))
+	require.Contains(t, err.Error(), "1 of 4 operators")
+
+	request.Operators = map[types.OperatorID]string{1: down.URL, 2: down.URL, 3: down.URL, 4: down.URL}
+	requestID, err = h.startKeygen(request)
+	require.Empty(t, requestID)
+	require.Equal(t, ExitUnreachable, ExitCode(err))
+
+	h.messengerAddr = "http://127.0.0.1:1"
+	_, err = h.startKeygen(request)
+	require.Equal(t, ExitUnreachable, ExitCode(err), "messenger can't be reached")
+}
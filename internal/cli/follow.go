@@ -0,0 +1,268 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/topiccache"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+)
+
+// followPollInterval is how often get-dkg-results --follow asks the messenger
+// for outputs published since the last time
+var followPollInterval = 2 * time.Second
+
+// outputFollower checks the outputs of a ceremony one at a time, as the
+// operators publish them, against each other and the deposit when known
+type outputFollower struct {
+	requestID string
+	operators []types.OperatorID
+	outputs   map[types.OperatorID]SignedOutput
+	// withdrawalCredentials and network, when set, check the deposit signature of every output
+	withdrawalCredentials string
+	network               string
+	// unavailable is set once the messenger couldn't list the outputs
+	unavailable bool
+	// published are the outputs fetched from the messenger so far, the next
+	// poll only asks for the ones after them and etag of the last response
+	published map[types.OperatorID]*dkg.SignedOutput
+	total     int
+	etag      string
+}
+
+func newOutputFollower(requestID, withdrawalCredentials, network string) *outputFollower {
+	return &outputFollower{
+		requestID:             requestID,
+		outputs:               make(map[types.OperatorID]SignedOutput),
+		published:             make(map[types.OperatorID]*dkg.SignedOutput),
+		withdrawalCredentials: withdrawalCredentials,
+		network:               network,
+	}
+}
+
+// add checks the output of operatorID against the outputs seen before and
+// returns its findings, none for an output that agrees with them
+func (f *outputFollower) add(operatorID types.OperatorID, output SignedOutput) []string {
+	findings := []string{}
+	if output.Signer != strconv.Itoa(int(operatorID)) {
+		findings = append(findings, fmt.Sprintf("signed by operator %s", output.Signer))
+	}
+	if len(f.operators) > 0 && !containsOperator(f.operators, operatorID) {
+		findings = append(findings, "operator isn't subscribed to the ceremony")
+	}
+
+	keySign := output.KeySignData.Signature != ""
+	requestID, value, name := output.Data.RequestID, output.Data.ValidatorPubKey, "validator pk"
+	if keySign {
+		requestID, value, name = output.KeySignData.RequestID, output.KeySignData.Signature, "signature"
+	}
+	if requestID != f.requestID {
+		findings = append(findings, fmt.Sprintf("output of ceremony %s", requestID))
+	}
+	var disagree []types.OperatorID
+	for other, seen := range f.outputs {
+		seenValue := seen.Data.ValidatorPubKey
+		if keySign {
+			seenValue = seen.KeySignData.Signature
+		}
+		if seenValue != value {
+			disagree = append(disagree, other)
+		}
+	}
+	if len(disagree) > 0 {
+		sortOperators(disagree)
+		findings = append(findings, fmt.Sprintf("%s %s differs from the outputs of operators %v", name, abbreviate(value), disagree))
+	}
+
+	if !keySign {
+		if sharePK, err := hex.DecodeString(output.Data.SharePubKey); err != nil || (&bls.PublicKey{}).Deserialize(sharePK) != nil {
+			findings = append(findings, "share pk isn't a bls public key")
+		}
+		if f.withdrawalCredentials != "" {
+			depositData, err := depositDataFromResult(&DKGResult{Output: map[types.OperatorID]SignedOutput{operatorID: output}}, f.withdrawalCredentials, f.network)
+			if err == nil {
+				err = depositData.Verify()
+			}
+			if err != nil {
+				findings = append(findings, err.Error())
+			}
+		}
+	}
+
+	f.outputs[operatorID] = output
+	return findings
+}
+
+// meter shows how many operators published their output and whether the
+// threshold of the committee is reached
+func (f *outputFollower) meter() string {
+	total := len(f.operators)
+	if total < len(f.outputs) {
+		total = len(f.outputs)
+	}
+	threshold := int(ceremony.ThresholdFor(total))
+	bar := strings.Repeat("#", len(f.outputs)) + strings.Repeat("-", total-len(f.outputs))
+	status := fmt.Sprintf("[%s] %d/%d outputs, threshold %d", bar, len(f.outputs), total, threshold)
+	if len(f.outputs) >= threshold {
+		status += " reached"
+	}
+
+	var missing []types.OperatorID
+	for _, operatorID := range f.operators {
+		if _, ok := f.outputs[operatorID]; !ok {
+			missing = append(missing, operatorID)
+		}
+	}
+	if len(missing) > 0 {
+		status += fmt.Sprintf(", waiting for %v", missing)
+	}
+	return status
+}
+
+// followOutputs prints the outputs published since the last call with the
+// findings of their checks, and the quorum meter when there are new ones.
+// Only the outputs after the ones fetched before are asked for, and nothing
+// is downloaded when the messenger has no new ones.
+func (h *CliHandler) followOutputs(f *outputFollower) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+
+	published, etag, err := h.messengerClient().TopicOutputsAfter(ctx, f.requestID, f.total, f.etag)
+	if errors.Is(err, messenger.ErrNotModified) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if published.Total < f.total {
+		// the messenger lost outputs, e.g. a standby took over, start over
+		f.published = make(map[types.OperatorID]*dkg.SignedOutput)
+		f.total, f.etag = 0, ""
+		return h.followOutputs(f)
+	}
+	f.etag = etag
+	for operatorID, output := range published.Outputs {
+		f.published[operatorID] = output
+	}
+	// an older messenger ignores after and sends all outputs
+	f.total = published.Total
+	if f.total < len(f.published) {
+		f.total = len(f.published)
+	}
+	h.updateTopicCache(func(cache *topiccache.Cache) {
+		cache.SetSubscribers(f.requestID, published.Operators)
+		cache.SetOutputs(f.requestID, f.published)
+	})
+	f.operators = f.operators[:0]
+	for _, name := range published.Operators {
+		operatorID, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			continue
+		}
+		f.operators = append(f.operators, types.OperatorID(operatorID))
+	}
+	sortOperators(f.operators)
+
+	formatted := formatResults(&messenger.DataStore{DKGOutputs: f.published})
+	var received []types.OperatorID
+	for operatorID := range formatted.Output {
+		if _, seen := f.outputs[operatorID]; !seen {
+			received = append(received, operatorID)
+		}
+	}
+	if len(received) == 0 {
+		return nil
+	}
+	sortOperators(received)
+	for _, operatorID := range received {
+		findings := f.add(operatorID, formatted.Output[operatorID])
+		if len(findings) == 0 {
+			fmt.Printf("operator %d: output verified\n", operatorID)
+			continue
+		}
+		fmt.Printf("operator %d: output has %d findings\n", operatorID, len(findings))
+		for _, finding := range findings {
+			fmt.Printf("  - %s\n", finding)
+		}
+	}
+	fmt.Println(f.meter())
+	return nil
+}
+
+// followDKGResult follows the outputs of a ceremony until the messenger has
+// its result, or wait is over when set
+func (h *CliHandler) followDKGResult(f *outputFollower, wait, interval time.Duration) (*DKGResult, error) {
+	var deadline time.Time
+	if wait > 0 {
+		deadline = time.Now().Add(wait)
+	}
+	for {
+		if err := h.followOutputs(f); err != nil && !f.unavailable {
+			fmt.Printf("warning: outputs of ceremony %s can't be followed, waiting for its result: %v\n", f.requestID, err)
+			f.unavailable = true
+		}
+		result, err := h.DKGResultByRequestID(f.requestID)
+		if err == nil {
+			return result, nil
+		}
+		if !deadline.IsZero() && time.Now().Add(interval).After(deadline) {
+			var failure *Failure
+			if errors.As(err, &failure) {
+				return nil, err
+			}
+			return nil, fail(ConditionTimeout, fmt.Errorf("no result for ceremony %s after %s: %w", f.requestID, wait, err))
+		}
+		time.Sleep(interval)
+	}
+}
+
+func containsOperator(operators []types.OperatorID, operatorID types.OperatorID) bool {
+	for _, operator := range operators {
+		if operator == operatorID {
+			return true
+		}
+	}
+	return false
+}
+
+func sortOperators(operators []types.OperatorID) {
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+}
+
+// abbreviate shortens a hex value for a finding
+func abbreviate(value string) string {
+	if len(value) <= 16 {
+		return value
+	}
+	return value[:16] + "..."
+}
@@ -0,0 +1,162 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+const followRequestID = "aabbccddeeff00112233445566778899aabbccddeeff0011"
+
+// followedResult is a keygen result whose outputs carry their ceremony and signer
+func followedResult(t *testing.T) *DKGResult {
+	result := keygenResult(t, csmWithdrawalCredentials, types.MainNetwork)
+	for operatorID, output := range result.Output {
+		output.Data.RequestID = followRequestID
+		output.Signer = strconv.Itoa(int(operatorID))
+		result.Output[operatorID] = output
+	}
+	return result
+}
+
+func TestOutputFollower(t *testing.T) {
+	result := followedResult(t)
+	f := newOutputFollower(followRequestID, csmWithdrawalCredentials, "mainnet")
+	f.operators = []types.OperatorID{1, 2, 3, 4}
+
+	require.Empty(t, f.add(1, result.Output[1]))
+	require.Empty(t, f.add(2, result.Output[2]))
+	require.Equal(t, "[##--] 2/4 outputs, threshold 3, waiting for [3 4]", f.meter())
+
+	other := followedResult(t).Output[3]
+	findings := f.add(3, other)
+	require.Len(t, findings, 1)
+	require.Contains(t, findings[0], "differs from the outputs of operators [1 2]")
+	require.Equal(t, "[###-] 3/4 outputs, threshold 3 reached, waiting for [4]", f.meter())
+
+	wrongDeposit := result.Output[4]
+	wrongDeposit.Data.DepositDataSignature = other.Data.DepositDataSignature
+	wrongDeposit.Signer = "5"
+	findings = f.add(4, wrongDeposit)
+	require.Len(t, findings, 3)
+	require.Contains(t, findings[0], "signed by operator 5")
+	require.Contains(t, findings[1], "differs from the outputs of operators [3]")
+	require.Contains(t, findings[2], "deposit signature")
+}
+
+func TestFollowDKGResult(t *testing.T) {
+	t.Setenv("DKG_TOPIC_CACHE", filepath.Join(t.TempDir(), "topics.json"))
+	result := followedResult(t)
+	published := map[types.OperatorID]*dkg.SignedOutput{}
+	for operatorID, output := range result.Output {
+		sharePK, _ := hex.DecodeString(output.Data.SharePubKey)
+		validatorPK, _ := hex.DecodeString(output.Data.ValidatorPubKey)
+		signature, _ := hex.DecodeString(output.Data.DepositDataSignature)
+		requestID := dkg.RequestID{}
+		requestIDBytes, _ := hex.DecodeString(followRequestID)
+		copy(requestID[:], requestIDBytes)
+		published[operatorID] = &dkg.SignedOutput{
+			Data:   &dkg.Output{RequestID: requestID, SharePubKey: sharePK, ValidatorPubKey: validatorPK, DepositDataSignature: signature},
+			Signer: operatorID,
+		}
+	}
+
+	var polls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/topics/" + followRequestID + "/outputs":
+			// one more operator publishes its output with every poll
+			n := atomic.AddInt32(&polls, 1)
+			outputs := map[types.OperatorID]*dkg.SignedOutput{}
+			for operatorID := types.OperatorID(1); operatorID <= types.OperatorID(n) && operatorID <= 4; operatorID++ {
+				outputs[operatorID] = published[operatorID]
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"operators": []string{"1", "2", "3", "4"}, "outputs": outputs})
+		case "/data/" + followRequestID:
+			if atomic.LoadInt32(&polls) < 4 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"DKGOutputs": published})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	h := New(logrus.New())
+	h.messengerAddr = srv.URL
+	f := newOutputFollower(followRequestID, "", "")
+	followed, err := h.followDKGResult(f, time.Minute, time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, followed.Output, 4)
+	require.Len(t, f.outputs, 4, "every output was checked before the result")
+
+	_, err = h.followDKGResult(newOutputFollower("missing", "", ""), 10*time.Millisecond, time.Millisecond)
+	require.Error(t, err)
+}
+
+func TestFollowOutputsIncremental(t *testing.T) {
+	t.Setenv("DKG_TOPIC_CACHE", filepath.Join(t.TempDir(), "topics.json"))
+
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("after")+" "+r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"e2"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		outputs := map[types.OperatorID]*dkg.SignedOutput{}
+		etag := `"e1"`
+		if r.URL.Query().Get("after") == "" {
+			outputs[1] = &dkg.SignedOutput{Data: &dkg.Output{}, Signer: 1}
+		} else {
+			etag = `"e2"`
+		}
+		w.Header().Set("ETag", etag)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"operators": []string{"1", "2"}, "outputs": outputs, "total": 1})
+	}))
+	defer srv.Close()
+
+	h := New(logrus.New())
+	h.messengerAddr = srv.URL
+	f := newOutputFollower(followRequestID, "", "")
+	for i := 0; i < 3; i++ {
+		require.NoError(t, h.followOutputs(f))
+	}
+	require.Equal(t, []string{" ", `1 "e1"`, `1 "e2"`}, requests)
+	require.Len(t, f.published, 1, "outputs fetched before are kept")
+	require.Len(t, f.outputs, 1)
+}
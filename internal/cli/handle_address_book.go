@@ -0,0 +1,325 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandAddressBook() *cli.Command {
+	return &cli.Command{
+		Name:    "address-book",
+		Aliases: []string{"ab"},
+		Usage:   "manage the operator endpoints used when --operator only has an operator id",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "list operators with their endpoint and health",
+				Action: h.HandleAddressBookList,
+			},
+			{
+				Name:   "set",
+				Usage:  "set the endpoint of operators",
+				Action: h.HandleAddressBookSet,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "operator",
+						Aliases:  []string{"o"},
+						Usage:    "operator key-value pair, or a bare operator id to only set its region or asn",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "region",
+						Usage: "region the nodes of the operators run in, like eu-west",
+					},
+					&cli.UintFlag{
+						Name:  "asn",
+						Usage: "autonomous system number of the network the nodes of the operators run in",
+					},
+				},
+			},
+			{
+				Name:   "remove",
+				Usage:  "remove an operator",
+				Action: h.HandleAddressBookRemove,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:     "operator-id",
+						Aliases:  []string{"id"},
+						Usage:    "operator id",
+						Required: true,
+					},
+				},
+			},
+			{
+				Name:   "sync",
+				Usage:  "import endpoints registered with the messenger and public keys from the ssv registry",
+				Action: h.HandleAddressBookSync,
+			},
+			{
+				Name:   "check",
+				Usage:  "ping every operator and record the result in its health history",
+				Action: h.HandleAddressBookCheck,
+			},
+		},
+	}
+}
+
+func (h *CliHandler) HandleAddressBookList(c *cli.Context) error {
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleAddressBookList: %w", err)
+	}
+
+	now := time.Now()
+	for _, entry := range book.List() {
+		health := "unchecked"
+		if len(entry.Health) > 0 {
+			ok := 0
+			for _, check := range entry.Health {
+				if check.OK {
+					ok++
+				}
+			}
+			health = fmt.Sprintf("%d/%d checks ok", ok, len(entry.Health))
+		}
+		stale := ""
+		if entry.Stale(now) {
+			stale = " STALE"
+		}
+		location := entry.Region
+		if entry.ASN != 0 {
+			location = strings.TrimPrefix(fmt.Sprintf("%s/AS%d", location, entry.ASN), "/")
+		}
+		if location == "" {
+			location = "-"
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\t%s%s\n", entry.OperatorID, entry.Endpoint, entry.Source, location, health, stale)
+	}
+	return nil
+}
+
+func (h *CliHandler) HandleAddressBookSet(c *cli.Context) error {
+	region, asn := c.String("region"), uint32(c.Uint("asn"))
+	if region == "" && asn == 0 {
+		operators, err := parseOperatorPairs(c.StringSlice("operator"), nil)
+		if err != nil {
+			return fmt.Errorf("HandleAddressBookSet: %w", err)
+		}
+		if err := h.rememberOperators(operators, addressbook.SourceManual); err != nil {
+			return fmt.Errorf("HandleAddressBookSet: %w", err)
+		}
+		return nil
+	}
+
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleAddressBookSet: %w", err)
+	}
+	operators, err := parseOperatorPairs(c.StringSlice("operator"), book)
+	if err != nil {
+		return fmt.Errorf("HandleAddressBookSet: %w", err)
+	}
+	for operatorID, endpoint := range operators {
+		// a bare id keeps the endpoint and its source
+		if entry, err := book.Get(operatorID); err != nil || entry.Endpoint != endpoint {
+			book.SetEndpoint(operatorID, endpoint, addressbook.SourceManual)
+		}
+		book.SetLocation(operatorID, region, asn)
+	}
+	if err := book.Save(); err != nil {
+		return fmt.Errorf("HandleAddressBookSet: failed to save address book: %w", err)
+	}
+	return nil
+}
+
+func (h *CliHandler) HandleAddressBookRemove(c *cli.Context) error {
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleAddressBookRemove: %w", err)
+	}
+	book.Remove(types.OperatorID(c.Int("operator-id")))
+	return book.Save()
+}
+
+func (h *CliHandler) HandleAddressBookSync(c *cli.Context) error {
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleAddressBookSync: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+
+	// operator nodes register on the default topic when they start
+	topic, err := h.messengerClient().GetTopicContext(ctx, messenger.DefaultTopic)
+	if err != nil {
+		return fmt.Errorf("HandleAddressBookSync: failed to get registered nodes from messenger: %w", err)
+	}
+	for _, subscriber := range topic.Subscribers {
+		operatorID, err := strconv.Atoi(subscriber.Name)
+		if err != nil {
+			h.logger.Warnf("HandleAddressBookSync: skipping subscriber %s that is not an operator", subscriber.Name)
+			continue
+		}
+		book.SetEndpoint(types.OperatorID(operatorID), subscriber.SrvAddr, addressbook.SourceMessenger)
+	}
+
+	for _, entry := range book.List() {
+		operator, err := storage.GetOperatorFromRegistryByID(entry.OperatorID)
+		if err != nil {
+			h.logger.Warnf("HandleAddressBookSync: failed to get public key of operator %d: %v", entry.OperatorID, err)
+			continue
+		}
+		book.SetPublicKey(entry.OperatorID, operator.PublicKey)
+	}
+
+	fmt.Printf("address book has %d operators\n", len(book.List()))
+	return book.Save()
+}
+
+func (h *CliHandler) HandleAddressBookCheck(c *cli.Context) error {
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleAddressBookCheck: %w", err)
+	}
+
+	for _, entry := range book.List() {
+		check := h.checkEndpoint(entry.Endpoint)
+		book.RecordHealth(entry.OperatorID, check)
+		if check.OK {
+			fmt.Printf("%d\t%s\tok in %dms\n", entry.OperatorID, entry.Endpoint, check.LatencyMs)
+		} else {
+			fmt.Printf("%d\t%s\tfailed: %s\n", entry.OperatorID, entry.Endpoint, check.Error)
+		}
+	}
+	return book.Save()
+}
+
+func (h *CliHandler) checkEndpoint(endpoint string) addressbook.HealthCheck {
+	started := time.Now()
+	check := addressbook.HealthCheck{At: started.UTC().Unix()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/ping", nil)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	resp, err := h.client.Do(req)
+	check.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		check.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+// rememberOperators saves operator endpoints in the address book
+func (h *CliHandler) rememberOperators(operators map[types.OperatorID]string, source string) error {
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return err
+	}
+	for operatorID, endpoint := range operators {
+		book.SetEndpoint(operatorID, endpoint, source)
+	}
+	if err := book.Save(); err != nil {
+		return fmt.Errorf("failed to save address book: %w", err)
+	}
+	return nil
+}
+
+// parseOperatorPairs parses id=endpoint values, a bare id takes its endpoint
+// from the address book when one is given
+func parseOperatorPairs(values []string, book *addressbook.Book) (map[types.OperatorID]string, error) {
+	operators := make(map[types.OperatorID]string)
+	for _, o := range values {
+
+		operator := strings.Trim(o, " ")
+
+		pair := strings.Split(operator, "=")
+		if len(pair) > 2 || (len(pair) == 1 && book == nil) {
+			return nil, fmt.Errorf("operator %s is not in the form of key=value", operator)
+		}
+
+		operatorID, err := strconv.Atoi(pair[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(pair) == 2 {
+			operators[types.OperatorID(operatorID)] = pair[1]
+			continue
+		}
+
+		entry, err := book.Get(types.OperatorID(operatorID))
+		if errors.Is(err, addressbook.ErrUnknownOperator) {
+			return nil, fmt.Errorf("operator %d has no endpoint, pass %d=<endpoint> or add it to the address book", operatorID, operatorID)
+		}
+		if entry.Stale(time.Now()) {
+			fmt.Printf("warning: endpoint %s of operator %d failed its recent health checks\n", entry.Endpoint, operatorID)
+		}
+		operators[types.OperatorID(operatorID)] = entry.Endpoint
+	}
+	return operators, nil
+}
+
+// needsAddressBook tells whether some operator values are bare ids
+func needsAddressBook(values ...[]string) bool {
+	for _, vs := range values {
+		for _, v := range vs {
+			if !strings.Contains(v, "=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadBookFor loads the address book only when some operator values need it
+func loadBookFor(values ...[]string) (*addressbook.Book, error) {
+	if !needsAddressBook(values...) {
+		return nil, nil
+	}
+	return addressbook.Load(addressbook.DefaultPath())
+}
@@ -0,0 +1,53 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOperatorPairs(t *testing.T) {
+	book, err := addressbook.Load(filepath.Join(t.TempDir(), "addressbook.json"))
+	require.NoError(t, err)
+	book.SetEndpoint(2, "http://10.0.0.2:8081", addressbook.SourceCeremony)
+
+	operators, err := parseOperatorPairs([]string{"1=http://10.0.0.1:8081", " 2 "}, book)
+	require.NoError(t, err)
+	require.Equal(t, map[types.OperatorID]string{
+		1: "http://10.0.0.1:8081",
+		2: "http://10.0.0.2:8081",
+	}, operators)
+
+	_, err = parseOperatorPairs([]string{"3"}, book)
+	require.ErrorContains(t, err, "operator 3 has no endpoint")
+
+	_, err = parseOperatorPairs([]string{"2"}, nil)
+	require.Error(t, err)
+
+	require.False(t, needsAddressBook([]string{"1=a"}, []string{"2=b"}))
+	require.True(t, needsAddressBook([]string{"1=a"}, []string{"2"}))
+}
@@ -0,0 +1,261 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/ethereum/go-ethereum/common"
+	ssz "github.com/ferranbt/fastssz"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/urfave/cli/v2"
+)
+
+// DomainBLSToExecutionChange is the capella signature domain for withdrawal credential changes
+var DomainBLSToExecutionChange = signing.DomainBLSToExecutionChange
+
+// blsToExecutionNetwork holds what the domain of a BLSToExecutionChange is computed
+// from, it is always the genesis fork version so changes stay valid across forks
+type blsToExecutionNetwork struct {
+	GenesisForkVersion    phase0.Version
+	GenesisValidatorsRoot phase0.Root
+}
+
+var blsToExecutionNetworks = map[string]blsToExecutionNetwork{
+	"mainnet": {
+		GenesisForkVersion:    phase0.Version{0x00, 0x00, 0x00, 0x00},
+		GenesisValidatorsRoot: mustRoot("4b363db94e286120d76eb905340fdd4e54bfe9f06bf33ff6cf5ad27f511bfe95"),
+	},
+	"prater": {
+		GenesisForkVersion:    phase0.Version{0x00, 0x00, 0x10, 0x20},
+		GenesisValidatorsRoot: mustRoot("043db0d9a83813551ee2f33450d23797757d430911a9320530ad8a0eabc43efb"),
+	},
+	"holesky": {
+		GenesisForkVersion:    phase0.Version{0x01, 0x01, 0x70, 0x00},
+		GenesisValidatorsRoot: mustRoot("9143aa7c615a7f7115e2b6aac319c03529df8242ae705fba9df39b79c59fa8b1"),
+	},
+}
+
+// BLSToExecutionChange is the capella container, go-eth2-client in use predates capella
+type BLSToExecutionChange struct {
+	ValidatorIndex     phase0.ValidatorIndex
+	FromBLSPubkey      phase0.BLSPubKey
+	ToExecutionAddress [20]byte
+}
+
+func (c *BLSToExecutionChange) HashTreeRoot() ([32]byte, error) {
+	return ssz.HashWithDefaultHasher(c)
+}
+
+func (c *BLSToExecutionChange) HashTreeRootWith(hh *ssz.Hasher) error {
+	indx := hh.Index()
+	hh.PutUint64(uint64(c.ValidatorIndex))
+	hh.PutBytes(c.FromBLSPubkey[:])
+	hh.PutBytes(c.ToExecutionAddress[:])
+	hh.Merkleize(indx)
+	return nil
+}
+
+// SigningRoot returns the root the committee threshold signs for the network
+func (c *BLSToExecutionChange) SigningRoot(network blsToExecutionNetwork) (phase0.Root, error) {
+	domain, err := types.ComputeETHDomain(DomainBLSToExecutionChange, network.GenesisForkVersion, network.GenesisValidatorsRoot)
+	if err != nil {
+		return phase0.Root{}, err
+	}
+	return types.ComputeETHSigningRoot(c, domain)
+}
+
+// KeySign declares the change along with its signing root, so that nodes with
+// a key share usage policy can recompute the root
+func (c *BLSToExecutionChange) KeySign(network blsToExecutionNetwork) (*signing.KeySign, error) {
+	root, err := c.SigningRoot(network)
+	if err != nil {
+		return nil, err
+	}
+	return &signing.KeySign{
+		ValidatorPK: c.FromBLSPubkey[:],
+		SigningRoot: root[:],
+		Usage:       signing.UsageWithdrawalChange,
+		Message: &signing.EthMessage{
+			ForkVersion:           hex.EncodeToString(network.GenesisForkVersion[:]),
+			GenesisValidatorsRoot: hex.EncodeToString(network.GenesisValidatorsRoot[:]),
+			ValidatorIndex:        uint64(c.ValidatorIndex),
+			ToExecutionAddress:    hex.EncodeToString(c.ToExecutionAddress[:]),
+		},
+	}, nil
+}
+
+// SignedBLSToExecutionChangeJson is the beacon api encoding accepted by
+// POST /eth/v1/beacon/pool/bls_to_execution_changes
+type SignedBLSToExecutionChangeJson struct {
+	Message   BLSToExecutionChangeJson `json:"message"`
+	Signature string                   `json:"signature"`
+}
+
+// BLSToExecutionChangeJson has the execution address in its EIP-55 checksum
+// encoding, as ethdo writes it
+type BLSToExecutionChangeJson struct {
+	ValidatorIndex     string `json:"validator_index"`
+	FromBLSPubkey      string `json:"from_bls_pubkey"`
+	ToExecutionAddress string `json:"to_execution_address"`
+}
+
+// Verify checks the change is signed by its bls key on the network
+func (s *SignedBLSToExecutionChangeJson) Verify(network blsToExecutionNetwork) error {
+	index, err := strconv.ParseUint(s.Message.ValidatorIndex, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid validator index %s", s.Message.ValidatorIndex)
+	}
+	pk, err := hex.DecodeString(strings.TrimPrefix(s.Message.FromBLSPubkey, "0x"))
+	if err != nil || len(pk) != len(phase0.BLSPubKey{}) {
+		return fmt.Errorf("from_bls_pubkey must be 48 bytes of hex")
+	}
+	address, err := hex.DecodeString(strings.TrimPrefix(s.Message.ToExecutionAddress, "0x"))
+	if err != nil || len(address) != 20 {
+		return fmt.Errorf("to_execution_address must be 20 bytes of hex")
+	}
+
+	change := &BLSToExecutionChange{ValidatorIndex: phase0.ValidatorIndex(index)}
+	copy(change.FromBLSPubkey[:], pk)
+	copy(change.ToExecutionAddress[:], address)
+	signingRoot, err := change.SigningRoot(network)
+	if err != nil {
+		return fmt.Errorf("failed to compute signing root: %w", err)
+	}
+	return verifyBLSSignature(pk, signingRoot[:], strings.TrimPrefix(s.Signature, "0x"))
+}
+
+func (h *CliHandler) HandleBLSToExecutionChange(c *cli.Context) error {
+	if err := h.loadInitiator(c); err != nil {
+		return fmt.Errorf("HandleBLSToExecutionChange: %w", err)
+	}
+	keygenRequestID, err := lookupRequestID(c)
+	if err != nil {
+		return err
+	}
+
+	network, ok := blsToExecutionNetworks[c.String("fork-version")]
+	if !ok {
+		return fmt.Errorf("HandleBLSToExecutionChange: unsupported network %s", c.String("fork-version"))
+	}
+
+	address, err := hexenc.ParseAddress(c.String("execution-address"))
+	if err != nil {
+		return fmt.Errorf("HandleBLSToExecutionChange: execution address must be 20 bytes of hex")
+	}
+
+	keygenOutput, err := h.completedDKGResult(keygenRequestID)
+	if err != nil {
+		return fmt.Errorf("HandleBLSToExecutionChange: failed to get dkg result for requestID %s: %w", keygenRequestID, err)
+	}
+	vk, err := keygenOutput.GetValidatorPK()
+	if err != nil {
+		return fmt.Errorf("HandleBLSToExecutionChange: failed to get ValidatorPK from keygen results: %w", err)
+	}
+
+	// the committee can only sign the change when the 0x00 credentials commit to the validator key itself
+	if withdrawalCredentials := c.String("withdrawal-credentials"); withdrawalCredentials != "" {
+		expected := blsWithdrawalCredentials(vk)
+		if strings.TrimPrefix(withdrawalCredentials, "0x") != hex.EncodeToString(expected) {
+			return fmt.Errorf("HandleBLSToExecutionChange: withdrawal credentials %s are not derived from validator key %x, the change has to be signed by that withdrawal key", withdrawalCredentials, vk)
+		}
+	}
+
+	change := &BLSToExecutionChange{ValidatorIndex: phase0.ValidatorIndex(c.Uint64("validator-index"))}
+	copy(change.FromBLSPubkey[:], vk)
+	copy(change.ToExecutionAddress[:], address)
+
+	keySign, err := change.KeySign(network)
+	if err != nil {
+		return fmt.Errorf("HandleBLSToExecutionChange: failed to compute signing root: %w", err)
+	}
+
+	signatureRequestID, err := h.GenerateDeclaredSignature(c, keySign)
+	if err != nil {
+		return fmt.Errorf("HandleBLSToExecutionChange: failed to send signing root for signature: %w", err)
+	}
+	signature, err := h.keysignSignature(keygenOutput, hex.EncodeToString(signatureRequestID[:]), keySign.SigningRoot)
+	if err != nil {
+		return fmt.Errorf("HandleBLSToExecutionChange: failed to sign bls to execution change: %w", err)
+	}
+
+	filepath := fmt.Sprintf("bls_to_execution_change_%d.json", time.Now().UTC().Unix())
+	fmt.Printf("writing signed bls to execution change to file %s\n", filepath)
+	return utils.WriteJSON(filepath, []SignedBLSToExecutionChangeJson{signedChangeJson(change, signature)})
+}
+
+// signedChangeJson is the beacon api encoding of the change with its signature in hex
+func signedChangeJson(change *BLSToExecutionChange, signature string) SignedBLSToExecutionChangeJson {
+	return SignedBLSToExecutionChangeJson{
+		Message: BLSToExecutionChangeJson{
+			ValidatorIndex:     strconv.FormatUint(uint64(change.ValidatorIndex), 10),
+			FromBLSPubkey:      "0x" + hex.EncodeToString(change.FromBLSPubkey[:]),
+			ToExecutionAddress: common.BytesToAddress(change.ToExecutionAddress[:]).Hex(),
+		},
+		Signature: "0x" + signature,
+	}
+}
+
+// blsWithdrawalCredentials returns the 0x00 credentials committing to the bls key pk
+func blsWithdrawalCredentials(pk []byte) []byte {
+	h := sha256.Sum256(pk)
+	return append([]byte{types.BLSWithdrawalPrefixByte}, h[1:]...)
+}
+
+func verifyBLSSignature(pk, root []byte, sigHex string) error {
+	publicKey := &bls.PublicKey{}
+	if err := publicKey.Deserialize(pk); err != nil {
+		return fmt.Errorf("failed to deserialize validator pk: %w", err)
+	}
+	sigBytes, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %w", err)
+	}
+	sig := &bls.Sign{}
+	if err := sig.Deserialize(sigBytes); err != nil {
+		return fmt.Errorf("failed to deserialize signature: %w", err)
+	}
+	if !sig.VerifyByte(publicKey, root) {
+		return fmt.Errorf("committee signature doesn't verify against validator pk %x", pk)
+	}
+	return nil
+}
+
+func mustRoot(s string) phase0.Root {
+	root := phase0.Root{}
+	byts, err := hex.DecodeString(s)
+	if err != nil || len(byts) != len(root) {
+		panic(fmt.Sprintf("invalid root %s", s))
+	}
+	copy(root[:], byts)
+	return root
+}
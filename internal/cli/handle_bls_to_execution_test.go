@@ -0,0 +1,108 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func hashPair(a, b []byte) []byte {
+	h := sha256.Sum256(append(append([]byte{}, a...), b...))
+	return h[:]
+}
+
+func TestBLSToExecutionChangeHashTreeRoot(t *testing.T) {
+	change := &BLSToExecutionChange{ValidatorIndex: 123456}
+	for i := range change.FromBLSPubkey {
+		change.FromBLSPubkey[i] = byte(i)
+	}
+	for i := range change.ToExecutionAddress {
+		change.ToExecutionAddress[i] = 0xaa
+	}
+
+	// three fields merkleized over four 32 byte leaves
+	index := make([]byte, 32)
+	binary.LittleEndian.PutUint64(index, 123456)
+	pubkey := make([]byte, 64)
+	copy(pubkey, change.FromBLSPubkey[:])
+	address := make([]byte, 32)
+	copy(address, change.ToExecutionAddress[:])
+	expected := hashPair(
+		hashPair(index, hashPair(pubkey[:32], pubkey[32:])),
+		hashPair(address, make([]byte, 32)),
+	)
+
+	root, err := change.HashTreeRoot()
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(expected), hex.EncodeToString(root[:]))
+}
+
+func TestBLSToExecutionChangeSignature(t *testing.T) {
+	types.InitBLS()
+	sk := &bls.SecretKey{}
+	sk.SetByCSPRNG()
+	pk := sk.GetPublicKey().Serialize()
+
+	change := &BLSToExecutionChange{ValidatorIndex: 7}
+	copy(change.FromBLSPubkey[:], pk)
+
+	prater, err := change.SigningRoot(blsToExecutionNetworks["prater"])
+	require.NoError(t, err)
+	mainnet, err := change.SigningRoot(blsToExecutionNetworks["mainnet"])
+	require.NoError(t, err)
+	require.NotEqual(t, prater, mainnet)
+
+	sig := sk.SignByte(prater[:])
+	require.NoError(t, verifyBLSSignature(pk, prater[:], hex.EncodeToString(sig.Serialize())))
+	require.Error(t, verifyBLSSignature(pk, mainnet[:], hex.EncodeToString(sig.Serialize())))
+
+	credentials := blsWithdrawalCredentials(pk)
+	require.Len(t, credentials, 32)
+	require.Equal(t, byte(0), credentials[0])
+}
+
+func TestBLSToExecutionChangeKeySign(t *testing.T) {
+	change := &BLSToExecutionChange{ValidatorIndex: 7}
+	for i := range change.FromBLSPubkey {
+		change.FromBLSPubkey[i] = byte(i)
+	}
+	change.ToExecutionAddress[0] = 0xaa
+
+	keySign, err := change.KeySign(blsToExecutionNetworks["holesky"])
+	require.NoError(t, err)
+	root, err := change.SigningRoot(blsToExecutionNetworks["holesky"])
+	require.NoError(t, err)
+	require.Equal(t, root[:], keySign.SigningRoot)
+
+	// nodes recompute the same root from the declared change
+	usage, err := keySign.VerifyUsage()
+	require.NoError(t, err)
+	require.Equal(t, signing.UsageWithdrawalChange, usage)
+}
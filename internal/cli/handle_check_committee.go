@@ -0,0 +1,390 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// CommitteeConfig is the committee check-committee reads from --config
+type CommitteeConfig struct {
+	Operators []CommitteeOperator `yaml:"operators"`
+	// Expect pins values every node has to advertise, on top of agreeing
+	// with each other
+	Expect CommitteeExpect `yaml:"expect"`
+}
+
+// CommitteeOperator is an operator of the committee, without an endpoint it
+// is looked up in the address book
+type CommitteeOperator struct {
+	ID       types.OperatorID `yaml:"id"`
+	Endpoint string           `yaml:"endpoint"`
+}
+
+type CommitteeExpect struct {
+	Network     string `yaml:"network"`
+	SpecVersion string `yaml:"spec_version"`
+	Version     string `yaml:"version"`
+}
+
+// CommitteeCheck is the outcome of check-committee, Configs are the
+// configurations the nodes advertised by operator id
+type CommitteeCheck struct {
+	Configs  map[types.OperatorID]*node.AdvertisedConfig `json:"configs"`
+	Findings []LintFinding                               `json:"findings"`
+}
+
+func (h CliHandler) CommandCheckCommittee() *cli.Command {
+	return &cli.Command{
+		Name:   "check-committee",
+		Usage:  "compare the configuration the nodes of a committee advertise and report what makes ceremonies fail",
+		Action: h.HandleCheckCommittee,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "config",
+				Aliases:  []string{"c"},
+				Usage:    "yaml file with the operators of the committee and the values to expect",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "treat warnings as inconsistencies",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the configurations and findings as json",
+			},
+		},
+	}
+}
+
+// HandleCheckCommittee fetches /config from every node of the committee and
+// exits with ExitInconsistent when the nodes disagree on something a
+// ceremony needs them to agree on
+func (h *CliHandler) HandleCheckCommittee(c *cli.Context) error {
+	config, err := loadCommitteeConfig(c.String("config"))
+	if err != nil {
+		return fail(ConditionValidation, err)
+	}
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return err
+	}
+	operators := make(map[types.OperatorID]string, len(config.Operators))
+	for _, operator := range config.Operators {
+		endpoint := operator.Endpoint
+		if endpoint == "" {
+			entry, err := book.Get(operator.ID)
+			if err != nil {
+				return fail(ConditionValidation, fmt.Errorf("HandleCheckCommittee: operator %d has no endpoint: %w", operator.ID, err))
+			}
+			endpoint = entry.Endpoint
+		}
+		operators[operator.ID] = endpoint
+	}
+
+	check, err := h.checkCommittee(operators, config.Expect)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		if err := json.NewEncoder(os.Stdout).Encode(check); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range check.Findings {
+			fmt.Printf("%s [%s]: %s\n", f.Severity, f.Rule, f.Message)
+		}
+		if len(check.Findings) == 0 {
+			fmt.Printf("the %d nodes of the committee are consistent\n", len(operators))
+		}
+	}
+
+	blocking := 0
+	for _, f := range check.Findings {
+		if f.Severity == LintError || c.Bool("strict") {
+			blocking++
+		}
+	}
+	if blocking > 0 {
+		return fail(ConditionInconsistent, fmt.Errorf("HandleCheckCommittee: committee has %d blocking inconsistencies", blocking))
+	}
+	return nil
+}
+
+func loadCommitteeConfig(path string) (*CommitteeConfig, error) {
+	byts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadCommitteeConfig: %w", err)
+	}
+	config := &CommitteeConfig{}
+	if err := yaml.Unmarshal(byts, config); err != nil {
+		return nil, fmt.Errorf("loadCommitteeConfig: invalid %s: %w", path, err)
+	}
+	if len(config.Operators) == 0 {
+		return nil, fmt.Errorf("loadCommitteeConfig: %s lists no operators", path)
+	}
+	seen := make(map[types.OperatorID]bool)
+	for _, operator := range config.Operators {
+		if operator.ID == 0 {
+			return nil, fmt.Errorf("loadCommitteeConfig: operator without id in %s", path)
+		}
+		if seen[operator.ID] {
+			return nil, fmt.Errorf("loadCommitteeConfig: operator %d listed twice in %s", operator.ID, path)
+		}
+		seen[operator.ID] = true
+	}
+	return config, nil
+}
+
+// checkCommittee asks every node for its configuration and compares them,
+// nodes that don't answer are findings too, only a committee where no node
+// answers is an error
+func (h *CliHandler) checkCommittee(operators map[types.OperatorID]string, expect CommitteeExpect) (*CommitteeCheck, error) {
+	check := &CommitteeCheck{Configs: make(map[types.OperatorID]*node.AdvertisedConfig), Findings: []LintFinding{}}
+	var lastErr error
+	for operatorID, addr := range operators {
+		config := &node.AdvertisedConfig{}
+		if err := h.getNodeJSON(strings.TrimSuffix(addr, "/")+"/config", config); err != nil {
+			lastErr = err
+			check.Findings = append(check.Findings, LintFinding{
+				Rule:     "unreachable",
+				Severity: LintError,
+				Message:  fmt.Sprintf("operator %d at %s didn't return its configuration: %v", operatorID, addr, err),
+			})
+			continue
+		}
+		if config.OperatorID != operatorID {
+			check.Findings = append(check.Findings, LintFinding{
+				Rule:     "operator_id",
+				Severity: LintError,
+				Message:  fmt.Sprintf("the node at %s runs as operator %d, not %d", addr, config.OperatorID, operatorID),
+			})
+		}
+		check.Configs[operatorID] = config
+	}
+	if len(check.Configs) == 0 {
+		return nil, unreachable(fmt.Errorf("checkCommittee: none of the operators answered: %w", lastErr))
+	}
+
+	check.Findings = append(check.Findings, compareConfigs(check.Configs, len(operators), expect)...)
+	sort.SliceStable(check.Findings, func(i, j int) bool { return check.Findings[i].Rule < check.Findings[j].Rule })
+	return check, nil
+}
+
+// compareConfigs reports the differences between the configurations that make
+// ceremonies fail as errors, and the ones that only make them fragile as
+// warnings
+func compareConfigs(configs map[types.OperatorID]*node.AdvertisedConfig, committeeSize int, expect CommitteeExpect) []LintFinding {
+	findings := []LintFinding{}
+	differs := func(rule string, severity LintSeverity, what string, value func(*node.AdvertisedConfig) string, expected string) {
+		values := make(map[types.OperatorID]string, len(configs))
+		for operatorID, config := range configs {
+			values[operatorID] = value(config)
+		}
+		if expected != "" {
+			for _, operatorID := range sortedConfigIDs(configs) {
+				if values[operatorID] != expected {
+					findings = append(findings, LintFinding{
+						Rule:     rule,
+						Severity: LintError,
+						Message:  fmt.Sprintf("operator %d runs %s %q, expected %q", operatorID, what, values[operatorID], expected),
+					})
+				}
+			}
+			return
+		}
+		if message, ok := disagreement(what, values); ok {
+			findings = append(findings, LintFinding{Rule: rule, Severity: severity, Message: message})
+		}
+	}
+
+	differs("network", LintError, "network", func(c *node.AdvertisedConfig) string { return c.Network }, expect.Network)
+	differs("spec_version", LintError, "spec", func(c *node.AdvertisedConfig) string { return c.SpecVersion }, expect.SpecVersion)
+	differs("version", LintWarning, "node version", func(c *node.AdvertisedConfig) string { return c.Version }, expect.Version)
+	differs("crypto_backend", LintWarning, "crypto backend", func(c *node.AdvertisedConfig) string { return c.CryptoBackend }, "")
+	differs("phase_timeouts", LintWarning, "phase timeouts", func(c *node.AdvertisedConfig) string {
+		t := c.PhaseTimeouts
+		return fmt.Sprintf("init_ack=%s round1=%s round2=%s output=%s extension=%s", t.InitAck, t.Round1, t.Round2, t.Output, t.Extension)
+	}, "")
+	differs("limits", LintWarning, "limits", func(c *node.AdvertisedConfig) string {
+		return fmt.Sprintf("max_operators=%d max_message_bytes=%d max_batch_size=%d", c.Limits.MaxOperators, c.Limits.MaxMessageBytes, c.Limits.MaxBatchSize)
+	}, "")
+
+	features := make(map[string]bool)
+	for _, config := range configs {
+		for name := range config.Features {
+			features[name] = true
+		}
+	}
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		name := name
+		differs("feature_"+name, LintError, name, func(c *node.AdvertisedConfig) string {
+			if value, ok := c.Features[name]; ok {
+				return value
+			}
+			return "unset"
+		}, "")
+	}
+
+	for _, operatorID := range sortedConfigIDs(configs) {
+		if limit := configs[operatorID].Limits.MaxOperators; limit > 0 && limit < committeeSize {
+			findings = append(findings, LintFinding{
+				Rule:     "max_operators",
+				Severity: LintError,
+				Message:  fmt.Sprintf("operator %d takes at most %d operators, the committee has %d", operatorID, limit, committeeSize),
+			})
+		}
+	}
+	return append(findings, compareCapabilities(configs)...)
+}
+
+// compareCapabilities checks the nodes share a protocol version, a suite and
+// the values of the ceremony options
+func compareCapabilities(configs map[types.OperatorID]*node.AdvertisedConfig) []LintFinding {
+	findings := []LintFinding{}
+	var low, high uint32
+	suites := make(map[string]int)
+	options := make(map[string]map[types.OperatorID]string)
+	withCapabilities := 0
+	for _, operatorID := range sortedConfigIDs(configs) {
+		capabilities := configs[operatorID].Capabilities
+		if capabilities == nil {
+			findings = append(findings, LintFinding{
+				Rule:     "capabilities",
+				Severity: LintWarning,
+				Message:  fmt.Sprintf("operator %d advertises no capabilities", operatorID),
+			})
+			continue
+		}
+		if withCapabilities == 0 || capabilities.MinProtocolVersion > low {
+			low = capabilities.MinProtocolVersion
+		}
+		if withCapabilities == 0 || capabilities.ProtocolVersion < high {
+			high = capabilities.ProtocolVersion
+		}
+		withCapabilities++
+		for _, suite := range capabilities.Suites {
+			suites[suite]++
+		}
+		for option, values := range capabilities.Options {
+			if options[option] == nil {
+				options[option] = make(map[types.OperatorID]string)
+			}
+			options[option][operatorID] = strings.Join(values, ",")
+		}
+	}
+	if withCapabilities == 0 {
+		return findings
+	}
+	if low > high {
+		findings = append(findings, LintFinding{
+			Rule:     "protocol_version",
+			Severity: LintError,
+			Message:  fmt.Sprintf("the nodes share no protocol version, one requires at least %d and another speaks at most %d", low, high),
+		})
+	}
+
+	if len(suites) > 0 {
+		common := false
+		for _, count := range suites {
+			common = common || count == withCapabilities
+		}
+		if !common {
+			findings = append(findings, LintFinding{
+				Rule:     "suites",
+				Severity: LintError,
+				Message:  "the nodes share no crypto suite",
+			})
+		}
+	}
+
+	names := make([]string, 0, len(options))
+	for option := range options {
+		names = append(names, option)
+	}
+	sort.Strings(names)
+	for _, option := range names {
+		if message, ok := disagreement("values of option "+option, options[option]); ok || len(options[option]) != withCapabilities {
+			if !ok {
+				message = fmt.Sprintf("only operators %s honor option %s", formatOperatorIDs(sortedValueIDs(options[option])), option)
+			}
+			findings = append(findings, LintFinding{Rule: "options", Severity: LintWarning, Message: message})
+		}
+	}
+	return findings
+}
+
+// disagreement describes the values of the operators when they aren't all the
+// same
+func disagreement(what string, values map[types.OperatorID]string) (string, bool) {
+	groups := make(map[string][]types.OperatorID)
+	for operatorID, value := range values {
+		groups[value] = append(groups[value], operatorID)
+	}
+	if len(groups) < 2 {
+		return "", false
+	}
+	distinct := make([]string, 0, len(groups))
+	for value := range groups {
+		distinct = append(distinct, value)
+	}
+	sort.Strings(distinct)
+	parts := make([]string, 0, len(distinct))
+	for _, value := range distinct {
+		parts = append(parts, fmt.Sprintf("%s on %s", value, formatOperatorIDs(groups[value])))
+	}
+	return fmt.Sprintf("the nodes differ in %s: %s", what, strings.Join(parts, "; ")), true
+}
+
+func sortedConfigIDs(configs map[types.OperatorID]*node.AdvertisedConfig) []types.OperatorID {
+	ids := make([]types.OperatorID, 0, len(configs))
+	for operatorID := range configs {
+		ids = append(ids, operatorID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func sortedValueIDs(values map[types.OperatorID]string) []types.OperatorID {
+	ids := make([]types.OperatorID, 0, len(values))
+	for operatorID := range values {
+		ids = append(ids, operatorID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,122 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func configServer(t *testing.T, config *node.AdvertisedConfig) string {
+	r := gin.New()
+	r.GET("/config", func(c *gin.Context) { c.JSON(http.StatusOK, config) })
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func advertisedConfig(operatorID types.OperatorID) *node.AdvertisedConfig {
+	return &node.AdvertisedConfig{
+		OperatorID:    operatorID,
+		Version:       "0.2.6",
+		SpecVersion:   "github.com/RockX-SG/ssv-spec v0.1.8",
+		Network:       "00000402",
+		CryptoBackend: "github.com/herumi/bls-eth-go-binary v1.28.1",
+		PhaseTimeouts: ceremony.DefaultPhaseTimeouts,
+		Limits:        ceremony.DefaultLimits,
+		Capabilities: &messengerclient.Capabilities{
+			ProtocolVersion:    2,
+			MinProtocolVersion: 1,
+			Suites:             []string{"bls12381-frost-v1"},
+		},
+		Features: map[string]string{"require_manifest": "false"},
+	}
+}
+
+func findingRules(findings []LintFinding) []string {
+	rules := make([]string, 0, len(findings))
+	for _, f := range findings {
+		rules = append(rules, f.Rule)
+	}
+	return rules
+}
+
+func TestCheckCommittee(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := New(logrus.New())
+
+	operators := map[types.OperatorID]string{}
+	for id := types.OperatorID(1); id <= 4; id++ {
+		operators[id] = configServer(t, advertisedConfig(id))
+	}
+	check, err := h.checkCommittee(operators, CommitteeExpect{})
+	require.NoError(t, err)
+	require.Empty(t, check.Findings)
+	require.Len(t, check.Configs, 4)
+
+	// a node on another network with a stricter policy and a newer protocol,
+	// one answering for the wrong operator and one that is down
+	other := advertisedConfig(2)
+	other.Network = "00000000"
+	other.Features["require_manifest"] = "true"
+	other.Capabilities.MinProtocolVersion = 3
+	other.Capabilities.ProtocolVersion = 3
+	operators[2] = configServer(t, other)
+	operators[3] = configServer(t, advertisedConfig(5))
+	operators[4] = "http://127.0.0.1:1"
+	check, err = h.checkCommittee(operators, CommitteeExpect{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"feature_require_manifest", "network", "operator_id", "protocol_version", "unreachable"}, findingRules(check.Findings))
+	for _, f := range check.Findings {
+		require.Equal(t, LintError, f.Severity)
+	}
+
+	// the expected network is checked on every node even when they agree
+	operators = map[types.OperatorID]string{1: configServer(t, advertisedConfig(1))}
+	check, err = h.checkCommittee(operators, CommitteeExpect{Network: "00000000"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"network"}, findingRules(check.Findings))
+
+	_, err = h.checkCommittee(map[types.OperatorID]string{1: "http://127.0.0.1:1"}, CommitteeExpect{})
+	require.Equal(t, ExitUnreachable, ExitCode(err))
+}
+
+func TestCompareConfigsWarnings(t *testing.T) {
+	configs := map[types.OperatorID]*node.AdvertisedConfig{1: advertisedConfig(1), 2: advertisedConfig(2), 3: advertisedConfig(3)}
+	configs[2].Version = "0.2.5"
+	configs[2].PhaseTimeouts.Round1 *= 2
+	configs[3].Limits.MaxOperators = 2
+
+	findings := compareConfigs(configs, 3, CommitteeExpect{})
+	require.Equal(t, []string{"version", "phase_timeouts", "limits", "max_operators"}, findingRules(findings))
+	require.Equal(t, LintWarning, findings[0].Severity)
+	require.Equal(t, LintError, findings[3].Severity)
+}
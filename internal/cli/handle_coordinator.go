@@ -0,0 +1,186 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandCoordinatorApprove() *cli.Command {
+	return &cli.Command{
+		Name:   "coordinator-approve",
+		Usage:  "sign a start message built with build-init with a coordinator key",
+		Action: h.HandleCoordinatorApprove,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "bundle",
+				Aliases:  []string{"b"},
+				Usage:    "file written by build-init",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "coordinator-key",
+				Usage:    "file with the rsa private key of the coordinator",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "file the approval is written to, defaults to approval_<request id>_<coordinator>.json",
+			},
+		},
+	}
+}
+
+func (h CliHandler) CommandCoordinatorAssemble() *cli.Command {
+	return &cli.Command{
+		Name:   "coordinator-assemble",
+		Usage:  "add coordinator approvals to a start message bundle before send-init",
+		Action: h.HandleCoordinatorAssemble,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "bundle",
+				Aliases:  []string{"b"},
+				Usage:    "file written by build-init, updated in place",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "approval",
+				Aliases:  []string{"a"},
+				Usage:    "file written by coordinator-approve",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "threshold",
+				Usage: "fail unless the bundle ends up with at least this many coordinator approvals",
+			},
+		},
+	}
+}
+
+// HandleCoordinatorApprove prints what is being approved, coordinators are
+// expected to review it before passing the approval on
+func (h *CliHandler) HandleCoordinatorApprove(c *cli.Context) error {
+	bundle, err := readInitBundle(c.String("bundle"))
+	if err != nil {
+		return fmt.Errorf("HandleCoordinatorApprove: %w", err)
+	}
+	msg, err := bundle.startMessage()
+	if err != nil {
+		return fmt.Errorf("HandleCoordinatorApprove: failed to decode start message: %w", err)
+	}
+	sk, err := loadRSAKey(c.String("coordinator-key"))
+	if err != nil {
+		return fmt.Errorf("HandleCoordinatorApprove: coordinator key: %w", err)
+	}
+
+	approval, err := coordinator.Approve(sk, msg)
+	if err != nil {
+		return fmt.Errorf("HandleCoordinatorApprove: %w", err)
+	}
+
+	fmt.Printf("approving %s with ID %s signed by operator %d\n", bundle.Kind, bundle.RequestID, bundle.Signer)
+	fmt.Printf("operators: %v\n", operatorIDs(bundle.Operators))
+	if len(bundle.OperatorsOld) > 0 {
+		fmt.Printf("old operators: %v\n", operatorIDs(bundle.OperatorsOld))
+	}
+	fmt.Printf("coordinator: %s\n", approval.Coordinator)
+
+	filepath := c.String("out")
+	if filepath == "" {
+		filepath = fmt.Sprintf("approval_%s_%s.json", bundle.RequestID, approval.Coordinator[:8])
+	}
+	fmt.Printf("writing approval to file %s\n", filepath)
+	return utils.WriteJSON(filepath, approval)
+}
+
+func (h *CliHandler) HandleCoordinatorAssemble(c *cli.Context) error {
+	path := c.String("bundle")
+	bundle, err := readInitBundle(path)
+	if err != nil {
+		return fmt.Errorf("HandleCoordinatorAssemble: %w", err)
+	}
+
+	approvals := []*coordinator.Approval{}
+	for _, approvalPath := range c.StringSlice("approval") {
+		byts, err := os.ReadFile(approvalPath)
+		if err != nil {
+			return fmt.Errorf("HandleCoordinatorAssemble: failed to read approval: %w", err)
+		}
+		approval := &coordinator.Approval{}
+		if err := json.Unmarshal(byts, approval); err != nil {
+			return fmt.Errorf("HandleCoordinatorAssemble: failed to parse approval %s: %w", approvalPath, err)
+		}
+		approvals = append(approvals, approval)
+	}
+
+	if err := bundle.addApprovals(approvals...); err != nil {
+		return fmt.Errorf("HandleCoordinatorAssemble: %w", err)
+	}
+	if threshold := c.Int("threshold"); len(bundle.Approvals) < threshold {
+		return fmt.Errorf("HandleCoordinatorAssemble: %w: %d of %d", coordinator.ErrNotEnoughApprovals, len(bundle.Approvals), threshold)
+	}
+
+	fmt.Printf("bundle %s carries %d coordinator approvals\n", path, len(bundle.Approvals))
+	return utils.WriteJSON(path, bundle)
+}
+
+// addApprovals checks every approval against the start message of the bundle,
+// approvals of a coordinator already in the bundle replace the earlier one
+func (b *InitBundle) addApprovals(approvals ...*coordinator.Approval) error {
+	msg, err := b.startMessage()
+	if err != nil {
+		return fmt.Errorf("failed to decode start message: %w", err)
+	}
+
+	for _, approval := range approvals {
+		if err := approval.Check(msg); err != nil {
+			return fmt.Errorf("approval of coordinator %s doesn't match the bundle: %w", approval.Coordinator, err)
+		}
+		replaced := false
+		for i, existing := range b.Approvals {
+			if existing.Coordinator == approval.Coordinator {
+				b.Approvals[i], replaced = approval, true
+			}
+		}
+		if !replaced {
+			b.Approvals = append(b.Approvals, approval)
+		}
+	}
+	return nil
+}
+
+func operatorIDs(operators map[types.OperatorID]string) []types.OperatorID {
+	ids := make([]types.OperatorID, 0, len(operators))
+	for id := range operators {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,123 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/stretchr/testify/require"
+)
+
+func testInitBundle(t *testing.T) *InitBundle {
+	request := testKeygenRequest()
+	requestID := getRandRequestID()
+	msg, err := request.initMsgForKeygen(requestID, testingInitSigner())
+	require.NoError(t, err)
+
+	return &InitBundle{
+		Kind:      ceremony.KindKeygen,
+		RequestID: hex.EncodeToString(requestID[:]),
+		Operators: request.Operators,
+		Signer:    1,
+		Message:   hex.EncodeToString(msg),
+	}
+}
+
+func TestInitBundleAddApprovals(t *testing.T) {
+	keys := testingutils.TestingKeygenKeySet().DKGOperators
+	bundle := testInitBundle(t)
+	msg, err := bundle.startMessage()
+	require.NoError(t, err)
+
+	first, err := coordinator.Approve(keys[1].EncryptionKey, msg)
+	require.NoError(t, err)
+	second, err := coordinator.Approve(keys[2].EncryptionKey, msg)
+	require.NoError(t, err)
+
+	require.NoError(t, bundle.addApprovals(first, second, first))
+	require.Len(t, bundle.Approvals, 2)
+
+	// an approval of another start message is refused
+	other := testInitBundle(t)
+	otherMsg, err := other.startMessage()
+	require.NoError(t, err)
+	foreign, err := coordinator.Approve(keys[3].EncryptionKey, otherMsg)
+	require.NoError(t, err)
+	require.ErrorContains(t, bundle.addApprovals(foreign), "doesn't match the bundle")
+	require.Len(t, bundle.Approvals, 2)
+}
+
+func TestConsumeURLCarriesApprovals(t *testing.T) {
+	approvals := []*coordinator.Approval{{Coordinator: "aa", Signature: "01"}, {Coordinator: "bb", Signature: "02"}}
+	consume := consumeURL("http://node:8080", ceremony.PhaseTimeouts{}, approvals, nil, 0, nil, nil, nil)
+	require.True(t, strings.HasPrefix(consume, "http://node:8080/consume?"))
+
+	parsed, err := url.Parse(consume)
+	require.NoError(t, err)
+	decoded, err := coordinator.ParseQuery(parsed.Query())
+	require.NoError(t, err)
+	require.Equal(t, approvals, decoded)
+
+	require.Equal(t, "http://node:8080/consume", consumeURL("http://node:8080", ceremony.PhaseTimeouts{}, nil, nil, 0, nil, nil, nil))
+}
+
+func TestConsumeURLCarriesCanary(t *testing.T) {
+	parsed, err := url.Parse(consumeURL("http://node:8080", ceremony.PhaseTimeouts{}, nil, nil, 30*time.Minute, nil, nil, nil))
+	require.NoError(t, err)
+	now := time.Now()
+	canary, err := ceremony.ParseCanary(parsed.Query(), now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(30*time.Minute).Unix(), canary.ExpiresAt)
+}
+
+func TestConsumeURLCarriesVersionClaim(t *testing.T) {
+	request := testKeygenRequest()
+	request.MinProtocolVersion = ceremony.ProtocolV2
+	requestID := getRandRequestID()
+	_, err := request.initMsgForKeygen(requestID, testingInitSigner())
+	require.NoError(t, err)
+	require.NotNil(t, request.VersionClaim)
+	require.Equal(t, hex.EncodeToString(requestID[:]), request.VersionClaim.RequestID)
+
+	parsed, err := url.Parse(consumeURL("http://node:8080", ceremony.PhaseTimeouts{}, nil, nil, 0, request.VersionClaim, nil, nil))
+	require.NoError(t, err)
+	claim, err := ceremony.ParseVersionClaim(parsed.Query())
+	require.NoError(t, err)
+	require.Equal(t, ceremony.ProtocolV2, claim.MinVersion)
+	require.NoError(t, claim.Verify(&testingutils.TestingKeygenKeySet().DKGOperators[1].EncryptionKey.PublicKey))
+}
+
+func TestConsumeURLCarriesOptions(t *testing.T) {
+	options := ceremony.Options{ceremony.OptionTranscript: "off", ceremony.OptionProgressEvents: "on"}
+	parsed, err := url.Parse(consumeURL("http://node:8080", ceremony.PhaseTimeouts{}, nil, nil, 0, nil, options, nil))
+	require.NoError(t, err)
+	decoded, err := ceremony.OptionsFromQuery(parsed.Query())
+	require.NoError(t, err)
+	require.Equal(t, options, decoded)
+}
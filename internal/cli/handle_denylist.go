@@ -0,0 +1,306 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/denylist"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandDenylist() *cli.Command {
+	return &cli.Command{
+		Name:    "denylist",
+		Aliases: []string{"dl"},
+		Usage:   "manage the operators keygen and resharing refuse to put in a committee",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "list denied operators with the reason and where the entry comes from",
+				Action: h.HandleDenylistList,
+			},
+			{
+				Name:   "add",
+				Usage:  "deny an operator",
+				Action: h.HandleDenylistAdd,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:     "operator-id",
+						Aliases:  []string{"id"},
+						Usage:    "operator id",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "reason",
+						Usage: "why the operator is denied",
+						Value: "flagged by hand",
+					},
+				},
+			},
+			{
+				Name:   "remove",
+				Usage:  "allow an operator again",
+				Action: h.HandleDenylistRemove,
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:     "operator-id",
+						Aliases:  []string{"id"},
+						Usage:    "operator id",
+						Required: true,
+					},
+				},
+			},
+			{
+				Name:   "sync",
+				Usage:  "apply a signed denylist feed, entries the feed no longer lists are dropped",
+				Action: h.HandleDenylistSync,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "url",
+						Usage:    "url of the signed feed",
+						EnvVars:  []string{"DKG_DENYLIST_FEED"},
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "feed-key",
+						Usage:    "base64 encoded PEM public key the feed has to be signed with",
+						EnvVars:  []string{"DKG_DENYLIST_FEED_KEY"},
+						Required: true,
+					},
+				},
+			},
+			{
+				Name:   "sign",
+				Usage:  "publish the manual and blame entries of the denylist as a signed feed",
+				Action: h.HandleDenylistSign,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "key",
+						Usage:    "PEM or base64 encoded PEM private key of the feed publisher",
+						Required: true,
+					},
+					&cli.Uint64Flag{
+						Name:  "sequence",
+						Usage: "sequence of the feed, it has to grow with every feed (default: current unix time)",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "file the signed feed is written to",
+						Value: "denylist_feed.json",
+					},
+				},
+			},
+		},
+	}
+}
+
+func forceFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "force",
+		Usage: "start the ceremony even when operators of the committee are on the denylist",
+	}
+}
+
+func (h *CliHandler) HandleDenylistList(c *cli.Context) error {
+	list, err := denylist.Load(denylist.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleDenylistList: %w", err)
+	}
+	for _, entry := range list.List() {
+		requestID := ""
+		if entry.RequestID != "" {
+			requestID = " request " + entry.RequestID
+		}
+		fmt.Printf("%d\t%s\t%s\t%s%s\n", entry.OperatorID, entry.Source, time.Unix(entry.AddedAt, 0).UTC().Format(time.RFC3339), entry.Reason, requestID)
+	}
+	return nil
+}
+
+func (h *CliHandler) HandleDenylistAdd(c *cli.Context) error {
+	list, err := denylist.Load(denylist.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleDenylistAdd: %w", err)
+	}
+	list.Add(&denylist.Entry{OperatorID: types.OperatorID(c.Int("operator-id")), Reason: c.String("reason"), Source: denylist.SourceManual})
+	return list.Save()
+}
+
+func (h *CliHandler) HandleDenylistRemove(c *cli.Context) error {
+	list, err := denylist.Load(denylist.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleDenylistRemove: %w", err)
+	}
+	if !list.Remove(types.OperatorID(c.Int("operator-id"))) {
+		return fail(ConditionValidation, fmt.Errorf("HandleDenylistRemove: operator %d isn't on the denylist", c.Int("operator-id")))
+	}
+	return list.Save()
+}
+
+func (h *CliHandler) HandleDenylistSync(c *cli.Context) error {
+	pkPem, err := base64.StdEncoding.DecodeString(strings.TrimSpace(c.String("feed-key")))
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleDenylistSync: failed to decode feed key: %w", err))
+	}
+	pk, err := types.PemToPublicKey(pkPem)
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleDenylistSync: failed to parse feed key: %w", err))
+	}
+
+	feed, err := h.fetchFeed(c.String("url"))
+	if err != nil {
+		return unreachable(fmt.Errorf("HandleDenylistSync: %w", err))
+	}
+	if err := feed.Verify(pk); err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleDenylistSync: %w", err))
+	}
+
+	list, err := denylist.Load(denylist.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleDenylistSync: %w", err)
+	}
+	added, dropped, err := list.ApplyFeed(&feed.Feed)
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleDenylistSync: %w", err))
+	}
+	if err := list.Save(); err != nil {
+		return fmt.Errorf("HandleDenylistSync: %w", err)
+	}
+	fmt.Printf("applied feed %d: %d operators added, %d dropped\n", feed.Feed.Sequence, added, dropped)
+	return nil
+}
+
+func (h *CliHandler) fetchFeed(url string) (*denylist.SignedFeed, error) {
+	resp, err := h.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	byts, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed request failed with status %s", resp.Status)
+	}
+	feed := &denylist.SignedFeed{}
+	if err := json.Unmarshal(byts, feed); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+	return feed, nil
+}
+
+func (h *CliHandler) HandleDenylistSign(c *cli.Context) error {
+	sk, err := loadRSAKey(c.String("key"))
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleDenylistSign: %w", err))
+	}
+	list, err := denylist.Load(denylist.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleDenylistSign: %w", err)
+	}
+
+	now := time.Now().Unix()
+	feed := &denylist.Feed{Sequence: uint64(now), IssuedAt: now, Operators: []denylist.FeedEntry{}}
+	if c.IsSet("sequence") {
+		feed.Sequence = c.Uint64("sequence")
+	}
+	// entries from another feed are that publisher's to vouch for
+	for _, entry := range list.List() {
+		if entry.Source != denylist.SourceFeed {
+			feed.Operators = append(feed.Operators, denylist.FeedEntry{OperatorID: entry.OperatorID, Reason: entry.Reason})
+		}
+	}
+	signed, err := denylist.SignFeed(sk, feed)
+	if err != nil {
+		return fmt.Errorf("HandleDenylistSign: %w", err)
+	}
+	fmt.Printf("writing feed %d with %d operators to file: %s\n", feed.Sequence, len(feed.Operators), c.String("out"))
+	return utils.WriteJSON(c.String("out"), signed)
+}
+
+// checkDenylist refuses a committee with denied operators unless --force is set
+func (h *CliHandler) checkDenylist(c *cli.Context, operators map[types.OperatorID]string) error {
+	list, err := denylist.Load(denylist.DefaultPath())
+	if err != nil {
+		return err
+	}
+	ids := make([]types.OperatorID, 0, len(operators))
+	for operatorID := range operators {
+		ids = append(ids, operatorID)
+	}
+	listed := list.Listed(ids)
+	if len(listed) == 0 {
+		return nil
+	}
+
+	denied := make([]types.OperatorID, 0, len(listed))
+	for _, entry := range listed {
+		fmt.Printf("operator %d is on the denylist (%s): %s\n", entry.OperatorID, entry.Source, entry.Reason)
+		denied = append(denied, entry.OperatorID)
+	}
+	if c.Bool("force") {
+		h.logger.Warnf("checkDenylist: starting with denied operators %v because of --force", denied)
+		return nil
+	}
+	return fail(ConditionValidation, fmt.Errorf("operators %v are on the denylist, pass --force to start anyway", denied))
+}
+
+// recordBlame puts the operator a blame output points at on the denylist
+func (h *CliHandler) recordBlame(requestID string, blame *dkg.BlameOutput) {
+	if blame == nil || blame.BlameMessage == nil || blame.BlameMessage.Message == nil {
+		return
+	}
+	protocolMsg := &frost.ProtocolMsg{}
+	if err := protocolMsg.Decode(blame.BlameMessage.Message.Data); err != nil || protocolMsg.BlameMessage == nil {
+		return
+	}
+	target := types.OperatorID(protocolMsg.BlameMessage.TargetOperatorID)
+
+	list, err := denylist.Load(denylist.DefaultPath())
+	if err != nil {
+		h.logger.Warnf("recordBlame: %v", err)
+		return
+	}
+	list.Add(&denylist.Entry{
+		OperatorID: target,
+		Reason:     fmt.Sprintf("blamed by operator %d: %s", blame.BlameMessage.Signer, protocolMsg.BlameMessage.Type.ToString()),
+		Source:     denylist.SourceBlame,
+		RequestID:  requestID,
+	})
+	if err := list.Save(); err != nil {
+		h.logger.Warnf("recordBlame: failed to save denylist: %v", err)
+		return
+	}
+	fmt.Printf("operator %d blamed in ceremony %s, added to the denylist\n", target, requestID)
+}
@@ -0,0 +1,85 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/denylist"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func forceContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	require.NoError(t, forceFlag().Apply(set))
+	require.NoError(t, set.Parse(args))
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+func TestCheckDenylist(t *testing.T) {
+	t.Setenv("DKG_DENYLIST", filepath.Join(t.TempDir(), "denylist.json"))
+	h := New(logrus.New())
+	operators := map[types.OperatorID]string{1: "a", 2: "b", 3: "c", 4: "d"}
+
+	require.NoError(t, h.checkDenylist(forceContext(t), operators))
+
+	list, err := denylist.Load(denylist.DefaultPath())
+	require.NoError(t, err)
+	list.Add(&denylist.Entry{OperatorID: 3, Reason: "offline", Source: denylist.SourceManual})
+	require.NoError(t, list.Save())
+
+	err = h.checkDenylist(forceContext(t), operators)
+	require.Equal(t, ExitValidation, ExitCode(err))
+	require.Contains(t, err.Error(), "[3]")
+	require.NoError(t, h.checkDenylist(forceContext(t, "--force"), operators))
+	require.NoError(t, h.checkDenylist(forceContext(t), map[types.OperatorID]string{1: "a", 2: "b", 4: "d", 5: "e"}))
+}
+
+func TestRecordBlame(t *testing.T) {
+	t.Setenv("DKG_DENYLIST", filepath.Join(t.TempDir(), "denylist.json"))
+	protocolMsg, err := (&frost.ProtocolMsg{
+		BlameMessage: &frost.BlameMessage{Type: frost.InvalidShare, TargetOperatorID: 2},
+	}).Encode()
+	require.NoError(t, err)
+	blame := &dkg.BlameOutput{BlameMessage: &dkg.SignedMessage{
+		Message: &dkg.Message{MsgType: dkg.ProtocolMsgType, Data: protocolMsg},
+		Signer:  4,
+	}}
+
+	New(logrus.New()).recordBlame("aa", blame)
+
+	list, err := denylist.Load(denylist.DefaultPath())
+	require.NoError(t, err)
+	listed := list.Listed([]types.OperatorID{1, 2, 4})
+	require.Len(t, listed, 1)
+	require.Equal(t, types.OperatorID(2), listed[0].OperatorID)
+	require.Equal(t, denylist.SourceBlame, listed[0].Source)
+	require.Equal(t, "aa", listed[0].RequestID)
+	require.Contains(t, listed[0].Reason, "operator 4")
+}
@@ -0,0 +1,145 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// ageExtension is added to the name of artifacts written with --encrypt-to
+const ageExtension = ".age"
+
+func encryptToFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "encrypt-to",
+		Usage: "age recipient (age1...) the file is encrypted to instead of being written in plaintext, repeat for several recipients",
+	}
+}
+
+// parseRecipients reads the --encrypt-to recipients, nil when the artifact is written in plaintext
+func parseRecipients(c *cli.Context) ([]*encryption.AgeRecipient, error) {
+	var recipients []*encryption.AgeRecipient
+	for _, value := range c.StringSlice("encrypt-to") {
+		recipient, err := encryption.ParseAgeRecipient(value)
+		if err != nil {
+			return nil, fail(ConditionValidation, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// artifactPath is the file an artifact is written to, encrypted artifacts get the age extension
+func artifactPath(filepath string, recipients []*encryption.AgeRecipient) string {
+	if len(recipients) == 0 {
+		return filepath
+	}
+	return filepath + ageExtension
+}
+
+// writeArtifact writes data as json, encrypted to the recipients when there are any
+func writeArtifact(filepath string, data any, recipients []*encryption.AgeRecipient) error {
+	if len(recipients) == 0 {
+		return utils.WriteJSON(filepath, data)
+	}
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := encryption.EncryptAge(append(plaintext, '\n'), recipients...)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath, ciphertext, 0o600)
+}
+
+func (h CliHandler) CommandDecrypt() *cli.Command {
+	return &cli.Command{
+		Name:   "decrypt",
+		Usage:  "decrypt a file written with --encrypt-to, or any age file for an X25519 identity",
+		Action: h.HandleDecrypt,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "identity",
+				Aliases:  []string{"i"},
+				Usage:    "age identity file (AGE-SECRET-KEY-1...), as written by age-keygen",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "in",
+				Usage:    "encrypted file",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "decrypted file, '-' for stdout, defaults to the input without its .age extension",
+			},
+		},
+	}
+}
+
+func (h *CliHandler) HandleDecrypt(c *cli.Context) error {
+	identityFile, err := os.Open(c.String("identity"))
+	if err != nil {
+		return fmt.Errorf("HandleDecrypt: failed to open identity file: %w", err)
+	}
+	defer identityFile.Close()
+	identities, err := encryption.ParseAgeIdentities(identityFile)
+	if err != nil {
+		return fmt.Errorf("HandleDecrypt: failed to read identity file: %w", err)
+	}
+
+	in := c.String("in")
+	out := c.String("out")
+	if out == "" {
+		if !strings.HasSuffix(in, ageExtension) {
+			return fmt.Errorf("HandleDecrypt: %s has no %s extension, set --out", in, ageExtension)
+		}
+		out = strings.TrimSuffix(in, ageExtension)
+	}
+
+	ciphertext, err := os.ReadFile(in)
+	if err != nil {
+		return fmt.Errorf("HandleDecrypt: failed to read %s: %w", in, err)
+	}
+	plaintext, err := encryption.DecryptAge(ciphertext, identities...)
+	if err != nil {
+		return fmt.Errorf("HandleDecrypt: failed to decrypt %s: %w", in, err)
+	}
+
+	if out == "-" {
+		_, err = os.Stdout.Write(plaintext)
+		return err
+	}
+	if err := os.WriteFile(out, plaintext, 0o600); err != nil {
+		return fmt.Errorf("HandleDecrypt: failed to write %s: %w", out, err)
+	}
+	fmt.Printf("decrypted %s to %s\n", in, out)
+	return nil
+}
@@ -0,0 +1,66 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestWriteArtifactEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	identity, err := encryption.GenerateAgeIdentity()
+	require.NoError(t, err)
+	identityFile := filepath.Join(dir, "key.txt")
+	require.NoError(t, os.WriteFile(identityFile, []byte("# custody team\n"+identity.String()+"\n"), 0o600))
+
+	deposit := []DepositDataJson{{PubKey: "8f3c", Amount: 32000000000, NetworkName: "prater"}}
+	recipients := []*encryption.AgeRecipient{identity.Recipient()}
+	path := artifactPath(filepath.Join(dir, "deposit-data_1.json"), recipients)
+	require.Equal(t, filepath.Join(dir, "deposit-data_1.json.age"), path)
+	require.NoError(t, writeArtifact(path, deposit, recipients))
+
+	ciphertext, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(ciphertext), "8f3c")
+
+	h := New(logrus.New())
+	app := &cli.App{Commands: []*cli.Command{h.CommandDecrypt()}}
+	require.NoError(t, app.Run([]string{"cli", "decrypt", "--identity", identityFile, "--in", path}))
+
+	decrypted := []DepositDataJson{}
+	plaintext, err := os.ReadFile(filepath.Join(dir, "deposit-data_1.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(plaintext, &decrypted))
+	require.Equal(t, deposit, decrypted)
+
+	// plaintext artifacts are written as before
+	require.Equal(t, "results.json", artifactPath("results.json", nil))
+	require.NoError(t, writeArtifact(filepath.Join(dir, "results.json"), deposit, nil))
+}
@@ -0,0 +1,210 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandExportResult() *cli.Command {
+	return &cli.Command{
+		Name:    "export-result",
+		Aliases: []string{"exr"},
+		Usage:   "export the result of a keygen for a staking protocol, one file per adapter",
+		Action:  h.HandleExportResult,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "request-id",
+				Aliases:  []string{"req"},
+				Usage:    "request id of the keygen",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "adapter",
+				Aliases:  []string{"a"},
+				Usage:    "output adapter, any of " + strings.Join(adapterNames(), ", ") + " (repeatable)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "withdrawal-credentials",
+				Aliases: []string{"w"},
+				Usage:   "withdrawal credentials the keygen signed the deposit for (deposit-data, lido-csm, obol, fireblocks, copper)",
+			},
+			&cli.StringFlag{
+				Name:    "fork-version",
+				Aliases: []string{"f"},
+				Usage:   "network of the deposit, mainnet or prater (deposit-data, lido-csm, obol, fireblocks, copper)",
+			},
+			&cli.StringSliceFlag{
+				Name:    "operator",
+				Aliases: []string{"o"},
+				Usage:   "operator key-value pair, the committee signs the owner address (ssv)",
+			},
+			&cli.StringFlag{
+				Name:    "owner-address",
+				Aliases: []string{"oa"},
+				Usage:   "the cluster owner address in the SSV contract (ssv)",
+			},
+			&cli.IntFlag{
+				Name:    "owner-nonce",
+				Aliases: []string{"on"},
+				Usage:   "the validator registration nonce of the owner address (ssv)",
+			},
+			&cli.Uint64Flag{
+				Name:  "csm-node-operator-id",
+				Usage: "Lido CSM node operator to add the key to, leave out for a new node operator (lido-csm)",
+			},
+			&cli.Uint64Flag{
+				Name:  "threshold",
+				Usage: "threshold of the committee (obol)",
+			},
+			&cli.StringFlag{
+				Name:  "cluster-name",
+				Usage: "name of the cluster (obol)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "enr",
+				Usage: "operator id and ENR of its charon node, e.g. 1=enr:-HW4Q... (obol, repeatable)",
+			},
+			&cli.StringFlag{
+				Name:  "fee-recipient",
+				Usage: "fee recipient address of the validator (obol)",
+			},
+			&cli.BoolFlag{
+				Name:  "submit",
+				Usage: "push the submission to the custodian API with the customer's credentials (fireblocks, copper)",
+			},
+			&cli.StringFlag{
+				Name:  "custodian-account",
+				Usage: "Fireblocks vault account id or Copper portfolio id the validator is onboarded to (fireblocks, copper)",
+			},
+			&cli.StringFlag{
+				Name:  "custodian-url",
+				Usage: "validator onboarding endpoint of the custodian, when it isn't the default one (fireblocks, copper)",
+			},
+			&cli.StringFlag{
+				Name:    "custodian-api-key",
+				Usage:   "API key of the custodian account (fireblocks, copper)",
+				EnvVars: []string{"CUSTODIAN_API_KEY"},
+			},
+			&cli.StringFlag{
+				Name:    "custodian-secret",
+				Usage:   "path to the PEM private key of the Fireblocks API user, or the Copper API secret",
+				EnvVars: []string{"CUSTODIAN_SECRET"},
+			},
+			encryptToFlag(),
+		},
+	}
+}
+
+func (h *CliHandler) HandleExportResult(c *cli.Context) error {
+	requestID, err := lookupRequestID(c)
+	if err != nil {
+		return err
+	}
+	recipients, err := parseRecipients(c)
+	if err != nil {
+		return fmt.Errorf("HandleExportResult: %w", err)
+	}
+	selected, err := parseAdapters(c.StringSlice("adapter"))
+	if err != nil {
+		return fmt.Errorf("HandleExportResult: %w", err)
+	}
+
+	opts := &AdapterOptions{
+		WithdrawalCredentials: strings.TrimPrefix(c.String("withdrawal-credentials"), "0x"),
+		Network:               c.String("fork-version"),
+		Threshold:             c.Uint64("threshold"),
+		ClusterName:           c.String("cluster-name"),
+		FeeRecipient:          c.String("fee-recipient"),
+		OperatorAddress:       registryAddress,
+		Custodian: CustodianOptions{
+			URL:     c.String("custodian-url"),
+			Account: c.String("custodian-account"),
+			APIKey:  c.String("custodian-api-key"),
+			Secret:  c.String("custodian-secret"),
+		},
+	}
+	if enrs := c.StringSlice("enr"); len(enrs) > 0 {
+		if opts.ENRs, err = parseOperatorPairs(enrs, nil); err != nil {
+			return fmt.Errorf("HandleExportResult: --enr: %w", fail(ConditionValidation, err))
+		}
+	}
+	if c.IsSet("csm-node-operator-id") {
+		nodeOperatorID := c.Uint64("csm-node-operator-id")
+		opts.CSMNodeOperatorID = &nodeOperatorID
+	}
+	if c.IsSet("owner-address") && c.IsSet("owner-nonce") && len(c.StringSlice("operator")) > 0 {
+		opts.SignOwner = func(result *DKGResult) (string, error) {
+			return h.signOwnerPrefix(c, result)
+		}
+	}
+	for _, adapter := range selected {
+		if err := adapter.Check(opts); err != nil {
+			return fmt.Errorf("HandleExportResult: %s adapter: %w", adapter.Name(), fail(ConditionValidation, err))
+		}
+		if !c.Bool("submit") {
+			continue
+		}
+		submitter, ok := adapter.(Submitter)
+		if !ok {
+			return fmt.Errorf("HandleExportResult: %s adapter: %w", adapter.Name(), fail(ConditionValidation, fmt.Errorf("--submit isn't supported")))
+		}
+		if err := submitter.CheckSubmit(&opts.Custodian); err != nil {
+			return fmt.Errorf("HandleExportResult: %s adapter: %w", adapter.Name(), fail(ConditionValidation, err))
+		}
+	}
+
+	result, err := h.completedDKGResult(requestID)
+	if err != nil {
+		return fmt.Errorf("HandleExportResult: failed to get dkg result for requestID %s: %w", requestID, err)
+	}
+	if vk, err := result.GetValidatorPK(); err != nil || len(vk) == 0 {
+		return fmt.Errorf("HandleExportResult: ceremony %s isn't a keygen or resharing", requestID)
+	}
+
+	now := time.Now().Unix()
+	for _, adapter := range selected {
+		artifact, err := adapter.Export(result, opts)
+		if err != nil {
+			return fmt.Errorf("HandleExportResult: %s adapter: %w", adapter.Name(), err)
+		}
+		filepath := artifactPath(fmt.Sprintf("%s_%s_%d.json", adapter.Name(), requestID, now), recipients)
+		fmt.Printf("writing %s output to file: %s\n", adapter.Name(), filepath)
+		if err := writeArtifact(filepath, artifact, recipients); err != nil {
+			return fmt.Errorf("HandleExportResult: %w", err)
+		}
+		if !c.Bool("submit") {
+			continue
+		}
+		receipt, err := adapter.(Submitter).Submit(artifact, &opts.Custodian)
+		if err != nil {
+			return fmt.Errorf("HandleExportResult: %s adapter: failed to submit: %w", adapter.Name(), err)
+		}
+		fmt.Printf("submitted %s output, id: %s, status: %s\n", adapter.Name(), receipt.ID, receipt.Status)
+	}
+	return nil
+}
@@ -25,17 +25,128 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
 	"github.com/urfave/cli/v2"
 )
 
+// resultPollInterval is how often get-dkg-results --wait asks the messenger for the result
+var resultPollInterval = 5 * time.Second
+
 func (h *CliHandler) HandleGetData(c *cli.Context) error {
-	requestID := c.String("request-id")
-	results, err := h.DKGResultByRequestID(requestID)
+	requestID, err := lookupRequestID(c)
+	if err != nil {
+		return err
+	}
+	recipients, err := parseRecipients(c)
+	if err != nil {
+		return fmt.Errorf("HandleGetData: %w", err)
+	}
+	if _, err := parseFailOn(c); err != nil {
+		return fmt.Errorf("HandleGetData: %w", err)
+	}
+	if c.String("withdrawal-credentials") != "" && c.String("fork-version") == "" {
+		return fail(ConditionValidation, fmt.Errorf("HandleGetData: --withdrawal-credentials needs --fork-version"))
+	}
+	if c.Bool("approvals") && len(c.StringSlice("operator")) == 0 {
+		return fail(ConditionValidation, fmt.Errorf("HandleGetData: --approvals needs the --operator pairs to ask"))
+	}
+	var results *DKGResult
+	if c.Bool("follow") {
+		follower := newOutputFollower(requestID, c.String("withdrawal-credentials"), c.String("fork-version"))
+		results, err = h.followDKGResult(follower, c.Duration("wait"), followPollInterval)
+	} else {
+		results, err = h.pollDKGResult(requestID, c.Duration("wait"), resultPollInterval)
+	}
+	if err != nil && len(c.StringSlice("operator")) > 0 {
+		h.logger.Warnf("HandleGetData: no result from the messenger, asking the operators: %v", err)
+		results, err = h.committeeResultFromFlags(c, requestID)
+	}
 	if err != nil {
 		return fmt.Errorf("HandleGetData: failed to get dkg result for requestID %s: %w", requestID, err)
 	}
-	filepath := fmt.Sprintf("dkg_results_%s_%d.json", requestID, time.Now().Unix())
+	if results.Blame != nil {
+		h.recordBlame(requestID, results.Blame)
+	}
+	disputed, err := h.attachAttestations(c, requestID, results)
+	if err != nil {
+		return fmt.Errorf("HandleGetData: %w", err)
+	}
+	if err := h.attachApprovals(c, requestID, results); err != nil {
+		return fmt.Errorf("HandleGetData: %w", err)
+	}
+	filepath := artifactPath(fmt.Sprintf("dkg_results_%s_%d.json", requestID, time.Now().Unix()), recipients)
 	fmt.Printf("writing results to file: %s\n", filepath)
-	return utils.WriteJSON(filepath, results)
+	if err := writeArtifact(filepath, results, recipients); err != nil {
+		return err
+	}
+
+	// the results are written either way, --fail-on decides whether they are a failure
+	if err := tolerate(c, results.blameFailure(requestID)); err != nil {
+		return fmt.Errorf("HandleGetData: %w", err)
+	}
+	if len(disputed) > 0 {
+		err := fail(ConditionAttestation, fmt.Errorf("observers %v don't vouch for the result of ceremony %s", disputed, requestID))
+		if err := tolerate(c, err); err != nil {
+			return fmt.Errorf("HandleGetData: %w", err)
+		}
+	}
+	return nil
+}
+
+// attachAttestations adds the signed attestations of the --observer operators
+// to the results and returns the observers whose attestation doesn't vouch for them
+func (h *CliHandler) attachAttestations(c *cli.Context, requestID string, results *DKGResult) ([]types.OperatorID, error) {
+	observers, err := parseObservers(c)
+	if err != nil || observers == nil || results.Blame != nil {
+		return nil, err
+	}
+	if results.Attestations, err = h.fetchAttestations(requestID, observers); err != nil {
+		return nil, err
+	}
+
+	validatorPK, err := results.GetValidatorPK()
+	if err != nil {
+		return nil, err
+	}
+	var disputed []types.OperatorID
+	for _, attestation := range results.Attestations {
+		if err := attestation.Vouches(validatorPK); err != nil {
+			fmt.Printf("warning: observer %d doesn't vouch for the result: %v\n", attestation.Observer, err)
+			for _, finding := range attestation.Findings {
+				fmt.Printf("  - %s\n", finding)
+			}
+			disputed = append(disputed, attestation.Observer)
+		}
+	}
+	return disputed, nil
+}
+
+// attachApprovals adds the approvals of the --operator operators to the
+// results when --approvals is set
+func (h *CliHandler) attachApprovals(c *cli.Context, requestID string, results *DKGResult) error {
+	if !c.Bool("approvals") || results.Blame != nil {
+		return nil
+	}
+	book, err := loadBookFor(c.StringSlice("operator"))
+	if err != nil {
+		return err
+	}
+	operators, err := parseOperatorPairs(c.StringSlice("operator"), book)
+	if err != nil {
+		return fail(ConditionValidation, err)
+	}
+	return h.collectApprovals(requestID, results, operators, registryKeys)
+}
+
+// committeeResultFromFlags rebuilds the result from the nodes of the --operator pairs
+func (h *CliHandler) committeeResultFromFlags(c *cli.Context, requestID string) (*DKGResult, error) {
+	book, err := loadBookFor(c.StringSlice("operator"))
+	if err != nil {
+		return nil, err
+	}
+	operators, err := parseOperatorPairs(c.StringSlice("operator"), book)
+	if err != nil {
+		return nil, fail(ConditionValidation, err)
+	}
+	return h.committeeResult(requestID, operators, registryKeys)
 }
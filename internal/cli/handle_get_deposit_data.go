@@ -26,7 +26,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/urfave/cli/v2"
@@ -45,13 +44,33 @@ type DepositDataJson struct {
 }
 
 func (h *CliHandler) HandleGetDepositData(c *cli.Context) error {
-	requestID := c.String("request-id")
+	requestID, err := lookupRequestID(c)
+	if err != nil {
+		return err
+	}
+	recipients, err := parseRecipients(c)
+	if err != nil {
+		return fmt.Errorf("HandleGetDepositData: %w", err)
+	}
 
-	results, err := h.DKGResultByRequestID(requestID)
+	results, err := h.completedDKGResult(requestID)
 	if err != nil {
 		return fmt.Errorf("HandleGetDepositData: failed to get dkg result for requestID %s: %w", requestID, err)
 	}
 
+	depositDataJson, err := depositDataFromResult(results, c.String("withdrawal-credentials"), c.String("fork-version"))
+	if err != nil {
+		return fmt.Errorf("HandleGetDepositData: %w", err)
+	}
+
+	filepath := artifactPath(fmt.Sprintf("deposit-data_%d.json", time.Now().UTC().Unix()), recipients)
+	fmt.Printf("writing deposit data json to file %s\n", filepath)
+	return writeArtifact(filepath, []DepositDataJson{*depositDataJson}, recipients)
+}
+
+// depositDataFromResult builds the deposit data of the validator of a keygen,
+// signed by the committee for the withdrawal credentials given at keygen
+func depositDataFromResult(results *DKGResult, withdrawalCredentialsHex, network string) (*DepositDataJson, error) {
 	// all operators will have same validatorPK in their result
 	var firstOperator types.OperatorID
 	for k := range results.Output {
@@ -59,14 +78,21 @@ func (h *CliHandler) HandleGetDepositData(c *cli.Context) error {
 		break
 	}
 
-	validatorPK, _ := hex.DecodeString(results.Output[firstOperator].Data.ValidatorPubKey)
-	withdrawalCredentials, _ := hex.DecodeString(c.String("withdrawal-credentials"))
-	fork := types.NetworkFromString(c.String("fork-version")).ForkVersion()
+	data := results.Output[firstOperator].Data
+	return newDepositData(data.ValidatorPubKey, withdrawalCredentialsHex, network, data.DepositDataSignature)
+}
+
+// newDepositData is the deposit data of a full deposit of the validator,
+// signatureHex signs it for the withdrawal credentials on the network
+func newDepositData(validatorPKHex, withdrawalCredentialsHex, network, signatureHex string) (*DepositDataJson, error) {
+	validatorPK, _ := hex.DecodeString(validatorPKHex)
+	withdrawalCredentials, _ := hex.DecodeString(withdrawalCredentialsHex)
+	fork := types.NetworkFromString(network).ForkVersion()
 	amount := phase0.Gwei(types.MaxEffectiveBalanceInGwei)
 
 	_, depositData, err := types.GenerateETHDepositData(validatorPK, withdrawalCredentials, fork, types.DomainDeposit)
 	if err != nil {
-		return fmt.Errorf("HandleGetDepositData: failed to generate eth deposit data: %w", err)
+		return nil, fmt.Errorf("failed to generate eth deposit data: %w", err)
 	}
 
 	depositMsg := &phase0.DepositMessage{
@@ -76,26 +102,91 @@ func (h *CliHandler) HandleGetDepositData(c *cli.Context) error {
 	}
 	depositMsgRoot, _ := depositMsg.HashTreeRoot()
 
-	blsSigBytes, _ := hex.DecodeString(results.Output[firstOperator].Data.DepositDataSignature)
+	blsSigBytes, _ := hex.DecodeString(signatureHex)
 	blsSig := phase0.BLSSignature{}
 	copy(blsSig[:], blsSigBytes)
 	depositData.Signature = blsSig
 
 	depositDataRoot, _ := depositData.HashTreeRoot()
 
-	depositDataJson := DepositDataJson{
-		PubKey:                results.Output[firstOperator].Data.ValidatorPubKey,
-		WithdrawalCredentials: c.String("withdrawal-credentials"),
+	return &DepositDataJson{
+		PubKey:                validatorPKHex,
+		WithdrawalCredentials: withdrawalCredentialsHex,
 		Amount:                amount,
-		Signature:             results.Output[firstOperator].Data.DepositDataSignature,
+		Signature:             signatureHex,
 		DepositMessageRoot:    hex.EncodeToString(depositMsgRoot[:]),
 		DepositDataRoot:       hex.EncodeToString(depositDataRoot[:]),
 		ForkVersion:           hex.EncodeToString(fork[:]),
-		NetworkName:           c.String("fork-version"),
+		NetworkName:           network,
 		DepositCliVersion:     "2.3.0",
+	}, nil
+}
+
+// Verify checks the committee signed the deposit for these withdrawal
+// credentials on this network, a deposit with another signature burns the
+// ether. The roots, when given, have to be of the deposit too
+func (d *DepositDataJson) Verify() error {
+	validatorPK, err := hex.DecodeString(d.PubKey)
+	if err != nil {
+		return fmt.Errorf("failed to decode validator pk: %w", err)
+	}
+	withdrawalCredentials, err := hex.DecodeString(d.WithdrawalCredentials)
+	if err != nil {
+		return fmt.Errorf("failed to decode withdrawal credentials: %w", err)
+	}
+	fork, err := d.fork()
+	if err != nil {
+		return err
 	}
 
-	filepath := fmt.Sprintf("deposit-data_%d.json", time.Now().UTC().Unix())
-	fmt.Printf("writing deposit data json to file %s\n", filepath)
-	return utils.WriteJSON(filepath, []DepositDataJson{depositDataJson})
+	depositMsg := &phase0.DepositMessage{WithdrawalCredentials: withdrawalCredentials, Amount: d.Amount}
+	copy(depositMsg.PublicKey[:], validatorPK)
+	domain, err := types.ComputeETHDomain(types.DomainDeposit, fork, phase0.Root{})
+	if err != nil {
+		return fmt.Errorf("failed to compute deposit domain: %w", err)
+	}
+	signingRoot, err := types.ComputeETHSigningRoot(depositMsg, domain)
+	if err != nil {
+		return fmt.Errorf("failed to compute deposit signing root: %w", err)
+	}
+	if err := verifyBLSSignature(validatorPK, signingRoot[:], d.Signature); err != nil {
+		return fmt.Errorf("deposit signature isn't for withdrawal credentials %s on %s: %w", d.WithdrawalCredentials, d.NetworkName, err)
+	}
+
+	depositMsgRoot, err := depositMsg.HashTreeRoot()
+	if err != nil {
+		return err
+	}
+	if d.DepositMessageRoot != "" && d.DepositMessageRoot != hex.EncodeToString(depositMsgRoot[:]) {
+		return fmt.Errorf("deposit message root %s isn't the root of the deposit", d.DepositMessageRoot)
+	}
+	depositData := &phase0.DepositData{PublicKey: depositMsg.PublicKey, WithdrawalCredentials: withdrawalCredentials, Amount: d.Amount}
+	signature, _ := hex.DecodeString(d.Signature)
+	copy(depositData.Signature[:], signature)
+	depositDataRoot, err := depositData.HashTreeRoot()
+	if err != nil {
+		return err
+	}
+	if d.DepositDataRoot != "" && d.DepositDataRoot != hex.EncodeToString(depositDataRoot[:]) {
+		return fmt.Errorf("deposit data root %s isn't the root of the deposit", d.DepositDataRoot)
+	}
+	return nil
+}
+
+// fork is the fork version the deposit is signed for, the network name is
+// only a fallback as tools name testnets differently
+func (d *DepositDataJson) fork() (phase0.Version, error) {
+	fork := phase0.Version{}
+	if d.ForkVersion == "" {
+		if network := types.NetworkFromString(d.NetworkName); network != "" {
+			return network.ForkVersion(), nil
+		}
+		return fork, fmt.Errorf("deposit has neither a fork version nor a known network")
+	}
+	byts, err := hex.DecodeString(d.ForkVersion)
+	if err != nil || len(byts) != len(fork) {
+		return fork, fmt.Errorf("fork version must be 4 bytes of hex")
+	}
+	copy(fork[:], byts)
+	return fork, nil
 }
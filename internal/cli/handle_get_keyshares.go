@@ -23,70 +23,115 @@ package cli
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
 	"github.com/urfave/cli/v2"
 )
 
 func (h *CliHandler) HandleGetKeyShares(c *cli.Context) error {
-	keygenRequestID := c.String("request-id")
+	if err := h.loadInitiator(c); err != nil {
+		return fmt.Errorf("HandleGetKeyShares: %w", err)
+	}
+	keygenRequestID, err := lookupRequestID(c)
+	if err != nil {
+		return err
+	}
+	recipients, err := parseRecipients(c)
+	if err != nil {
+		return fmt.Errorf("HandleGetKeyShares: %w", err)
+	}
 
-	keygenOutput, err := h.DKGResultByRequestID(keygenRequestID)
+	keygenOutput, err := h.completedDKGResult(keygenRequestID)
 	if err != nil {
 		return fmt.Errorf("HandleGetKeyShares: failed to get dkg result for requestID %s: %w", keygenRequestID, err)
 	}
 
+	ownerPrefix, err := h.signOwnerPrefix(c, keygenOutput)
+	if err != nil {
+		return fmt.Errorf("HandleGetKeyShares: %w", err)
+	}
+
+	keyshares := &KeyShares{}
+	if err := keyshares.GenerateKeyshareV4(keygenOutput, ownerPrefix); err != nil {
+		return fmt.Errorf("HandleGetKeyShares: failed to parse keyshare from dkg results: %w", err)
+	}
+
+	filename := artifactPath(fmt.Sprintf("keyshares-%d.json", time.Now().Unix()), recipients)
+	fmt.Printf("writing keyshares to file: %s\n", filename)
+	return writeArtifact(filename, keyshares, recipients)
+}
+
+// signOwnerPrefix has the committee sign the owner address and nonce, the
+// signature prefixes the shares of the ssv keyshares
+func (h *CliHandler) signOwnerPrefix(c *cli.Context, keygenOutput *DKGResult) (string, error) {
 	vk, err := keygenOutput.GetValidatorPK()
 	if err != nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to get ValidatorPK from keygen results: %w", err)
+		return "", fmt.Errorf("failed to get ValidatorPK from keygen results: %w", err)
 	}
 
 	ownerAddress := c.String("owner-address")
 	ownerNonce := c.Int("owner-nonce")
 	signingRoot := []byte(fmt.Sprintf("%s:%d", ownerAddress, ownerNonce))
 
-	signatureRequestID, err := h.GenerateSignature(c, vk, signingRoot)
+	signatureRequestID, err := h.GenerateDeclaredSignature(c, &signing.KeySign{ValidatorPK: vk, SigningRoot: signingRoot, Usage: signing.UsageRegistration})
 	if err != nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to send signingRoot for signature: %w", err)
+		return "", fmt.Errorf("failed to send signingRoot for signature: %w", err)
 	}
 
-	var signatureResult *DKGResult
+	ownerPrefix, err := h.keysignSignature(keygenOutput, hex.EncodeToString(signatureRequestID[:]), signingRoot)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign owner prefix: %w", err)
+	}
+	return ownerPrefix, nil
+}
 
-	try := 0
-	sleepTime := 2
+// waitDKGResult polls the messenger for the result of a short ceremony like keysign
+func (h *CliHandler) waitDKGResult(requestID string) (*DKGResult, error) {
+	result, err := h.pollDKGResult(requestID, 8*time.Second, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.blameFailure(requestID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
+// pollDKGResult fetches the result of a ceremony until the messenger has it
+// or wait is over, without wait it fetches once
+func (h *CliHandler) pollDKGResult(requestID string, wait, interval time.Duration) (*DKGResult, error) {
+	deadline := time.Now().Add(wait)
 	for {
-		if try == 4 {
-			break
+		result, err := h.DKGResultByRequestID(requestID)
+		if err == nil || wait == 0 {
+			return result, err
 		}
-
-		signatureResult, err = h.DKGResultByRequestID(hex.EncodeToString(signatureRequestID[:]))
-		if err != nil {
-			time.Sleep(time.Duration(sleepTime) * time.Second)
-			try++
-			continue
-		} else {
-			break
+		if time.Now().Add(interval).After(deadline) {
+			var failure *Failure
+			if errors.As(err, &failure) {
+				return nil, err
+			}
+			return nil, fail(ConditionTimeout, fmt.Errorf("no result for ceremony %s after %s: %w", requestID, wait, err))
 		}
+		time.Sleep(interval)
 	}
+}
 
-	if signatureResult == nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to sign owner prefix: %w", err)
-	}
-
-	ownerPrefix, err := signatureResult.GetSignatureFromKeySign()
+// completedDKGResult is the result of a ceremony that didn't end with a blame
+// and wasn't a canary
+func (h *CliHandler) completedDKGResult(requestID string) (*DKGResult, error) {
+	result, err := h.DKGResultByRequestID(requestID)
 	if err != nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to parse owner prefix from signature result: %w", err)
+		return nil, err
 	}
-
-	keyshares := &KeyShares{}
-	if err := keyshares.GenerateKeyshareV4(keygenOutput, ownerPrefix); err != nil {
-		return fmt.Errorf("HandleGetKeyShares: failed to parse keyshare from dkg results: %w", err)
+	if err := result.blameFailure(requestID); err != nil {
+		return nil, err
 	}
-
-	filename := fmt.Sprintf("keyshares-%d.json", time.Now().Unix())
-	fmt.Printf("writing keyshares to file: %s\n", filename)
-	return utils.WriteJSON(filename, keyshares)
+	if err := result.canaryFailure(requestID); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
@@ -0,0 +1,97 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func (h *CliHandler) HandleHandover(c *cli.Context) error {
+	validatorPK := c.String("validator-pk")
+	from := c.String("from")
+	to := c.String("to")
+
+	enrollment := &node.EnrollmentResponse{}
+	if err := h.postNodeJSON(to+"/handover/enrollment", nil, enrollment); err != nil {
+		return fmt.Errorf("HandleHandover: failed to create enrollment key on destination node %s: %w", to, err)
+	}
+	fmt.Printf("destination node enrollment key fingerprint: %s\n", enrollment.Fingerprint)
+
+	record := &node.HandoverRecord{}
+	exportReq := &node.HandoverExportRequest{
+		ValidatorPK:         validatorPK,
+		EnrollmentKey:       enrollment.EnrollmentKey,
+		EnrollmentSignature: enrollment.Signature,
+	}
+	if err := h.postNodeJSON(from+"/handover/export", exportReq, record); err != nil {
+		return fmt.Errorf("HandleHandover: failed to export share from source node %s: %w", from, err)
+	}
+
+	// keep a copy of the record so the share can still be imported if the last step fails
+	filepath := fmt.Sprintf("handover_%s_%d.json", validatorPK, time.Now().Unix())
+	fmt.Printf("writing signed handover record to file: %s\n", filepath)
+	if err := utils.WriteJSON(filepath, record); err != nil {
+		return fmt.Errorf("HandleHandover: failed to write handover record: %w", err)
+	}
+
+	if err := h.postNodeJSON(to+"/handover/import", record, nil); err != nil {
+		return fmt.Errorf("HandleHandover: failed to import share on destination node %s (retry with the record in %s): %w", to, filepath, err)
+	}
+
+	fmt.Printf("share for validator %s handed over from %s to %s\n", validatorPK, from, to)
+	return nil
+}
+
+func (h *CliHandler) postNodeJSON(url string, in, out any) error {
+	var body []byte
+	if in != nil {
+		byts, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = byts
+	}
+
+	resp, err := h.client.Post(url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed with status %s: %s", resp.Status, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -0,0 +1,440 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/cryptosuite"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/urfave/cli/v2"
+)
+
+// initSigner signs the start message of a ceremony, nodes check the signature
+// against the public key of the signer in the operator registry. Without a key
+// the node of the operator signs, see delegatedSigner.
+type initSigner struct {
+	sk *rsa.PrivateKey
+	id types.OperatorID
+}
+
+// testingInitSigner signs the start messages the cli sends without --signer
+func testingInitSigner() *initSigner {
+	ks := testingutils.TestingKeygenKeySet()
+	return &initSigner{sk: ks.DKGOperators[1].EncryptionKey, id: 1}
+}
+
+func testingResharingSigner() *initSigner {
+	ks := testingutils.TestingResharingKeySet()
+	return &initSigner{sk: ks.DKGOperators[1].EncryptionKey, id: 1}
+}
+
+// delegatedSigner leaves the signatures to the node of operator id, which
+// signs the start message with its operator key and publishes it, so the cli
+// holds no operator key. The message and manifest it returns are unsigned.
+func delegatedSigner(id types.OperatorID) *initSigner {
+	return &initSigner{id: id}
+}
+
+// claimVersion signs the minimum protocol version of the ceremony, none is
+// claimed when minVersion is zero or the signer is delegated
+func (s *initSigner) claimVersion(requestID dkg.RequestID, minVersion uint32) (*ceremony.VersionClaim, error) {
+	if minVersion == 0 || s.sk == nil {
+		return nil, nil
+	}
+	return ceremony.SignVersionClaim(s.sk, s.id, hex.EncodeToString(requestID[:]), minVersion)
+}
+
+// signManifest signs the manifest of the ceremony, it has to hash to expected
+// when set
+func (s *initSigner) signManifest(requestID dkg.RequestID, manifest *ceremony.Manifest, expected string) (*ceremony.SignedManifest, error) {
+	if _, err := cryptosuite.Lookup(manifest.Suite); err != nil {
+		return nil, fail(ConditionValidation, err)
+	}
+	if hash := manifest.Hash(); expected != "" && !strings.EqualFold(hash, strings.TrimPrefix(expected, "0x")) {
+		return nil, fail(ConditionValidation, fmt.Errorf("the ceremony's manifest hashes to %s, not to --manifest-hash %s", hash, expected))
+	}
+	if s.sk == nil {
+		return &ceremony.SignedManifest{RequestID: hex.EncodeToString(requestID[:]), Signer: s.id, Hash: manifest.Hash(), Manifest: manifest}, nil
+	}
+	return ceremony.SignManifest(s.sk, s.id, hex.EncodeToString(requestID[:]), manifest)
+}
+
+// sign returns the start message to send, the encoded dkg message when the
+// signer is delegated
+func (s *initSigner) sign(msg *dkg.Message) ([]byte, error) {
+	if s.sk == nil {
+		return msg.Encode()
+	}
+	signedMsg := testingutils.SignDKGMsg(s.sk, s.id, msg)
+	signedMsgBytes, err := signedMsg.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	ssvMsg := &types.SSVMessage{
+		MsgType: types.DKGMsgType,
+		Data:    signedMsgBytes,
+	}
+	return ssvMsg.Encode()
+}
+
+// InitBundle is a start message built and signed offline, together with what
+// the online host needs to deliver it. Endpoints and timeouts aren't signed,
+// the operator IDs are checked against the signed message before sending.
+type InitBundle struct {
+	Kind         ceremony.Kind               `json:"kind"`
+	RequestID    string                      `json:"request_id"`
+	Operators    map[types.OperatorID]string `json:"operators"`
+	OperatorsOld map[types.OperatorID]string `json:"operators_old,omitempty"`
+	Timeouts     ceremony.PhaseTimeouts      `json:"timeouts"`
+	Signer       types.OperatorID            `json:"signer"`
+	Message      string                      `json:"message"`
+	CreatedAt    int64                       `json:"created_at"`
+	// Approvals of the coordinators, added by coordinator-assemble
+	Approvals []*coordinator.Approval `json:"approvals,omitempty"`
+	// Observers get the start message and the broadcasts but aren't part of the committee
+	Observers map[types.OperatorID]string `json:"observers,omitempty"`
+	// VersionClaim of the signer, the minimum protocol version of the ceremony
+	VersionClaim *ceremony.VersionClaim `json:"version_claim,omitempty"`
+	// Options of the ceremony the nodes honor
+	Options ceremony.Options `json:"options,omitempty"`
+	// Manifest of the ceremony signed by the signer, nodes check it against the message
+	Manifest *ceremony.SignedManifest `json:"manifest,omitempty"`
+}
+
+func (h CliHandler) CommandBuildInit() *cli.Command {
+	return &cli.Command{
+		Name:   "build-init",
+		Usage:  "build and sign a keygen or resharing start message to a file without any network access",
+		Action: h.HandleBuildInit,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "kind",
+				Usage: "ceremony to start (keygen, reshare)",
+				Value: string(ceremony.KindKeygen),
+			},
+			&cli.StringSliceFlag{
+				Name:    "operator",
+				Aliases: []string{"o"},
+				Usage:   "operator key-value pair",
+			},
+			&cli.StringSliceFlag{
+				Name:    "old-operator",
+				Aliases: []string{"oo"},
+				Usage:   "old operator key-value pair, for reshare",
+			},
+			&cli.IntFlag{
+				Name:    "threshold",
+				Aliases: []string{"t"},
+				Usage:   "threshold value",
+			},
+			&cli.StringFlag{
+				Name:    "withdrawal-credentials",
+				Aliases: []string{"w"},
+				Usage:   "withdrawal credential value, for keygen",
+			},
+			&cli.StringFlag{
+				Name:    "fork-version",
+				Aliases: []string{"f"},
+				Usage:   "fork version, for keygen",
+			},
+			&cli.StringFlag{
+				Name:    "validator-pk",
+				Aliases: []string{"vk"},
+				Usage:   "validator public key value, for reshare",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "file the bundle is written to, defaults to init_<request id>.json",
+			},
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "refuse to build the message when the parameter lint has warnings",
+			},
+			configFlag(),
+			optionFlag(),
+			observerFlag(),
+			minProtocolVersionFlag(),
+			manifestHashFlag(),
+			cryptoSuiteFlag(),
+			requestIDFlag(),
+			forceFlag(),
+			failOnFlag(),
+		}, append(initiatorKeyFlags(), phaseTimeoutFlags()...)...),
+	}
+}
+
+func (h CliHandler) CommandSendInit() *cli.Command {
+	return &cli.Command{
+		Name:   "send-init",
+		Usage:  "deliver a start message built with build-init to the messenger and operators",
+		Action: h.HandleSendInit,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "bundle",
+				Aliases:  []string{"b"},
+				Usage:    "file written by build-init",
+				Required: true,
+			},
+			encryptInitFlag(),
+			relayInitFlag(),
+			eventsOutFlag(),
+			failOnFlag(),
+		},
+	}
+}
+
+// HandleBuildInit never touches the network, the address book is the only
+// state it reads so it can run on an air-gapped host
+func (h *CliHandler) HandleBuildInit(c *cli.Context) error {
+	signer, err := initiatorSigner(c)
+	if err != nil {
+		return fmt.Errorf("HandleBuildInit: %w", err)
+	}
+	if signer == nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleBuildInit: --initiator-key or %s is required", initiatorKeyEnv))
+	}
+
+	requestID, err := newRequestID(c.String("request-id"))
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleBuildInit: %w", err))
+	}
+	bundle := &InitBundle{
+		Kind:      ceremony.Kind(c.String("kind")),
+		RequestID: hex.EncodeToString(requestID[:]),
+		Signer:    signer.id,
+		CreatedAt: time.Now().UTC().Unix(),
+	}
+	linter := &ceremonyLinter{}
+	strict, err := strictLint(c)
+	if err != nil {
+		return fmt.Errorf("HandleBuildInit: %w", err)
+	}
+
+	var msg []byte
+	switch bundle.Kind {
+	case ceremony.KindKeygen:
+		request := &KeygenRequest{}
+		if err := request.parseKeygenRequest(c); err != nil {
+			return fail(ConditionValidation, fmt.Errorf("HandleBuildInit: failed to parse keygen request: %w", err))
+		}
+		if err := reportLint(linter.LintKeygen(request), strict); err != nil {
+			return fmt.Errorf("HandleBuildInit: %w", err)
+		}
+		if err := h.checkDenylist(c, request.Operators); err != nil {
+			return fmt.Errorf("HandleBuildInit: %w", err)
+		}
+		if msg, err = request.initMsgForKeygen(requestID, signer); err != nil {
+			return fmt.Errorf("HandleBuildInit: failed to generate init message for keygen: %w", err)
+		}
+		bundle.Operators, bundle.Timeouts, bundle.Observers, bundle.VersionClaim, bundle.Options = request.Operators, request.Timeouts, request.Observers, request.VersionClaim, request.Options
+		bundle.Manifest = request.Manifest
+	case ceremony.KindReshare:
+		request := &ResharingRequest{}
+		if err := request.parseResharingRequest(c); err != nil {
+			return fail(ConditionValidation, fmt.Errorf("HandleBuildInit: failed to parse resharing request: %w", err))
+		}
+		if err := reportLint(linter.LintResharing(request), strict); err != nil {
+			return fmt.Errorf("HandleBuildInit: %w", err)
+		}
+		if err := h.checkDenylist(c, request.Operators); err != nil {
+			return fmt.Errorf("HandleBuildInit: %w", err)
+		}
+		if msg, err = request.initMsgForResharing(requestID, signer); err != nil {
+			return fmt.Errorf("HandleBuildInit: failed to generate reshare message: %w", err)
+		}
+		bundle.Operators, bundle.OperatorsOld, bundle.Timeouts, bundle.Observers, bundle.VersionClaim, bundle.Options = request.Operators, request.OperatorsOld, request.Timeouts, request.Observers, request.VersionClaim, request.Options
+		bundle.Manifest = request.Manifest
+	default:
+		return fail(ConditionValidation, fmt.Errorf("HandleBuildInit: unsupported ceremony kind %s", bundle.Kind))
+	}
+	bundle.Message = hex.EncodeToString(msg)
+
+	filepath := c.String("out")
+	if filepath == "" {
+		filepath = fmt.Sprintf("init_%s.json", bundle.RequestID)
+	}
+	fmt.Printf("writing signed %s start message with ID %s and manifest hash %s to file %s\n", bundle.Kind, bundle.RequestID, bundle.Manifest.Hash, filepath)
+	return utils.WriteJSON(filepath, bundle)
+}
+
+func (h *CliHandler) HandleSendInit(c *cli.Context) error {
+	bundle, err := readInitBundle(c.String("bundle"))
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleSendInit: %w", err))
+	}
+	msg, err := hex.DecodeString(bundle.Message)
+	if err != nil {
+		return fmt.Errorf("HandleSendInit: failed to decode start message: %w", err)
+	}
+	if h.events, err = openEventLog(c); err != nil {
+		return fmt.Errorf("HandleSendInit: %w", err)
+	}
+	defer h.events.Close()
+
+	var minVersion uint32
+	if bundle.VersionClaim != nil {
+		minVersion = bundle.VersionClaim.MinVersion
+	}
+	switch bundle.Kind {
+	case ceremony.KindKeygen:
+		err = h.deliverKeygen(bundle.RequestID, &KeygenRequest{Operators: bundle.Operators, Timeouts: bundle.Timeouts, Approvals: bundle.Approvals, EncryptInit: c.Bool("encrypt-init"), RelayInit: c.Bool("relay-init"), Observers: bundle.Observers, MinProtocolVersion: minVersion, VersionClaim: bundle.VersionClaim, Options: bundle.Options, Manifest: bundle.Manifest}, msg)
+	case ceremony.KindReshare:
+		err = h.deliverResharing(bundle.RequestID, &ResharingRequest{Operators: bundle.Operators, OperatorsOld: bundle.OperatorsOld, Timeouts: bundle.Timeouts, Approvals: bundle.Approvals, EncryptInit: c.Bool("encrypt-init"), RelayInit: c.Bool("relay-init"), Observers: bundle.Observers, MinProtocolVersion: minVersion, VersionClaim: bundle.VersionClaim, Options: bundle.Options, Manifest: bundle.Manifest}, msg)
+	default:
+		err = fail(ConditionValidation, fmt.Errorf("unsupported ceremony kind %s", bundle.Kind))
+	}
+	if err := tolerate(c, err); err != nil {
+		return fmt.Errorf("HandleSendInit: %w", err)
+	}
+
+	fmt.Printf("%s init request sent with ID: %s\n", bundle.Kind, bundle.RequestID)
+	if bundle.Manifest != nil {
+		fmt.Printf("manifest hash: %s\n", bundle.Manifest.Hash)
+	}
+	return nil
+}
+
+// check compares the unsigned fields of the bundle with the signed message,
+// an edited bundle must not send the message to other operators
+func (b *InitBundle) check(msg []byte) error {
+	signedMsg, err := decodeStartMessage(msg)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(signedMsg.Message.Identifier[:]) != b.RequestID {
+		return fmt.Errorf("request id %s, message is for %x", b.RequestID, signedMsg.Message.Identifier[:])
+	}
+	if signedMsg.Signer != b.Signer {
+		return fmt.Errorf("signer %d, message is signed by %d", b.Signer, signedMsg.Signer)
+	}
+
+	params, err := node.StartParams(signedMsg.Message)
+	if err != nil {
+		return err
+	}
+	if params.Kind != b.Kind {
+		return fmt.Errorf("kind %s, message starts a %s", b.Kind, params.Kind)
+	}
+	if !sameOperators(b.Operators, params.Operators) {
+		return fmt.Errorf("operators don't match the signed message")
+	}
+	if b.Kind == ceremony.KindReshare && !sameOperators(b.OperatorsOld, params.OldOperators) {
+		return fmt.Errorf("old operators don't match the signed message")
+	}
+	if b.VersionClaim != nil && (b.VersionClaim.RequestID != b.RequestID || b.VersionClaim.Operator != b.Signer) {
+		return fmt.Errorf("version claim isn't the signer's claim for request %s", b.RequestID)
+	}
+	if b.Manifest != nil {
+		if b.Manifest.RequestID != b.RequestID || b.Manifest.Signer != b.Signer {
+			return fmt.Errorf("manifest isn't the signer's manifest for request %s", b.RequestID)
+		}
+		if b.Manifest.Manifest == nil || b.Manifest.Manifest.Hash() != b.Manifest.Hash {
+			return fmt.Errorf("manifest doesn't hash to %s", b.Manifest.Hash)
+		}
+		var minVersion uint32
+		if b.VersionClaim != nil {
+			minVersion = b.VersionClaim.MinVersion
+		}
+		if err := b.Manifest.Manifest.Matches(params, b.Options, minVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readInitBundle reads a bundle written by build-init and checks it against
+// its signed message
+func readInitBundle(path string) (*InitBundle, error) {
+	byts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	bundle := &InitBundle{}
+	if err := json.Unmarshal(byts, bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle: %w", err)
+	}
+	msg, err := hex.DecodeString(bundle.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode start message: %w", err)
+	}
+	if err := bundle.check(msg); err != nil {
+		return nil, fmt.Errorf("bundle doesn't match its signed message: %w", err)
+	}
+	return bundle, nil
+}
+
+// startMessage is the dkg message of the bundle coordinators approve
+func (b *InitBundle) startMessage() (*dkg.Message, error) {
+	msg, err := hex.DecodeString(b.Message)
+	if err != nil {
+		return nil, err
+	}
+	signedMsg, err := decodeStartMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return signedMsg.Message, nil
+}
+
+func decodeStartMessage(msg []byte) (*dkg.SignedMessage, error) {
+	ssvMsg := &types.SSVMessage{}
+	if err := ssvMsg.Decode(msg); err != nil {
+		return nil, err
+	}
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(ssvMsg.Data); err != nil {
+		return nil, err
+	}
+	if signedMsg.Message == nil {
+		return nil, fmt.Errorf("missing message")
+	}
+	return signedMsg, nil
+}
+
+func sameOperators(operators map[types.OperatorID]string, ids []types.OperatorID) bool {
+	if len(operators) != len(ids) {
+		return false
+	}
+	sorted := append([]types.OperatorID{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i, id := range sorted {
+		if _, ok := operators[id]; !ok || (i > 0 && sorted[i-1] == id) {
+			return false
+		}
+	}
+	return true
+}
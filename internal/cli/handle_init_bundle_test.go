@@ -0,0 +1,88 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitBundleCheck(t *testing.T) {
+	request := testKeygenRequest()
+	requestID := getRandRequestID()
+	msg, err := request.initMsgForKeygen(requestID, testingInitSigner())
+	require.NoError(t, err)
+
+	bundle := &InitBundle{
+		Kind:      ceremony.KindKeygen,
+		RequestID: hex.EncodeToString(requestID[:]),
+		Operators: request.Operators,
+		Signer:    1,
+	}
+	require.NoError(t, bundle.check(msg))
+
+	bundle.Operators = map[types.OperatorID]string{1: "a", 2: "b", 3: "c", 5: "d"}
+	require.ErrorContains(t, bundle.check(msg), "operators don't match")
+
+	bundle.Operators = request.Operators
+	bundle.Kind = ceremony.KindReshare
+	require.ErrorContains(t, bundle.check(msg), "message starts a keygen")
+
+	bundle.Kind = ceremony.KindKeygen
+	bundle.RequestID = "00"
+	require.ErrorContains(t, bundle.check(msg), "request id")
+
+	bundle.RequestID = hex.EncodeToString(requestID[:])
+	bundle.Manifest = request.Manifest
+	require.NoError(t, bundle.check(msg))
+
+	bundle.Manifest.Manifest.Threshold = 2
+	require.ErrorContains(t, bundle.check(msg), "manifest doesn't hash")
+
+	bundle.Manifest.Manifest.Threshold = 3
+	bundle.Options = ceremony.Options{ceremony.OptionTranscript: "off"}
+	require.ErrorContains(t, bundle.check(msg), "manifest options")
+}
+
+func TestManifestHashFlag(t *testing.T) {
+	request := testKeygenRequest()
+	_, err := request.initMsgForKeygen(getRandRequestID(), testingInitSigner())
+	require.NoError(t, err)
+	require.NotNil(t, request.Manifest)
+	hash := request.Manifest.Hash
+
+	again := testKeygenRequest()
+	again.ManifestHash = "0x" + hash
+	_, err = again.initMsgForKeygen(getRandRequestID(), testingInitSigner())
+	require.NoError(t, err)
+	require.Equal(t, hash, again.Manifest.Hash, "same parameters, same manifest")
+
+	changed := testKeygenRequest()
+	changed.ManifestHash = hash
+	changed.Options = ceremony.Options{ceremony.OptionTranscript: "off"}
+	_, err = changed.initMsgForKeygen(getRandRequestID(), testingInitSigner())
+	require.Equal(t, ExitValidation, ExitCode(err))
+}
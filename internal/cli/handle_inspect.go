@@ -0,0 +1,125 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandInspect() *cli.Command {
+	return &cli.Command{
+		Name:      "inspect",
+		Usage:     "decode a dkg message blob from a log or packet capture and print its contents",
+		ArgsUsage: "[blob...], reads one blob per line from stdin without blobs or with -",
+		Action:    h.HandleInspect,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "encoding",
+				Usage: "encoding of the blobs: auto, hex, base64 or json",
+				Value: "auto",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the decoded messages as json",
+			},
+		},
+	}
+}
+
+func (h *CliHandler) HandleInspect(c *cli.Context) error {
+	blobs := c.Args().Slice()
+	if len(blobs) == 0 || (len(blobs) == 1 && blobs[0] == "-") {
+		var err error
+		if blobs, err = readBlobs(os.Stdin); err != nil {
+			return fmt.Errorf("HandleInspect: failed to read stdin: %w", err)
+		}
+	}
+	if len(blobs) == 0 {
+		return fail(ConditionValidation, fmt.Errorf("HandleInspect: no message to inspect"))
+	}
+
+	decoded := make([]*DecodedMessage, 0, len(blobs))
+	for i, blob := range blobs {
+		data, err := decodeBlob(blob, c.String("encoding"))
+		if err != nil {
+			return fail(ConditionValidation, fmt.Errorf("HandleInspect: blob %d: %w", i+1, err))
+		}
+		msg, err := inspectMessage(data)
+		if err != nil {
+			return fail(ConditionValidation, fmt.Errorf("HandleInspect: blob %d: %w", i+1, err))
+		}
+		decoded = append(decoded, msg)
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if len(decoded) == 1 {
+			return encoder.Encode(decoded[0])
+		}
+		return encoder.Encode(decoded)
+	}
+	for i, msg := range decoded {
+		if i > 0 {
+			fmt.Println()
+		}
+		printDecodedMessage(os.Stdout, msg, "")
+	}
+	return nil
+}
+
+// readBlobs reads one blob per non empty line
+func readBlobs(r io.Reader) ([]string, error) {
+	blobs := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			blobs = append(blobs, line)
+		}
+	}
+	return blobs, scanner.Err()
+}
+
+func printDecodedMessage(w io.Writer, msg *DecodedMessage, indent string) {
+	fmt.Fprintf(w, "%s%s\n", indent, msg.Type)
+	for _, field := range msg.Fields {
+		fmt.Fprintf(w, "%s  %s: %s\n", indent, field.Name, field.Value)
+	}
+	if msg.Error != "" {
+		fmt.Fprintf(w, "%s  error: %s\n", indent, msg.Error)
+	}
+	for i, embedded := range msg.Embedded {
+		fmt.Fprintf(w, "%s  evidence %d:\n", indent, i+1)
+		printDecodedMessage(w, embedded, indent+"    ")
+	}
+	if msg.Payload != nil {
+		printDecodedMessage(w, msg.Payload, indent+"  ")
+	}
+}
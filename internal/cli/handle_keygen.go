@@ -24,12 +24,16 @@ package cli
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
+	"time"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/RockX-SG/frost-dkg-demo/internal/topiccache"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/bloxapp/ssv-spec/types/testingutils"
@@ -39,34 +43,178 @@ import (
 func (h *CliHandler) HandleKeygen(c *cli.Context) error {
 	keygenRequest := &KeygenRequest{}
 	if err := keygenRequest.parseKeygenRequest(c); err != nil {
-		return fmt.Errorf("HandleKeygen: failed to parse keygen request: %w", err)
+		return fail(ConditionValidation, fmt.Errorf("HandleKeygen: failed to parse keygen request: %w", err))
+	}
+	strict, err := strictLint(c)
+	if err != nil {
+		return fmt.Errorf("HandleKeygen: %w", err)
+	}
+	if err := reportLint(h.newLinter(c).LintKeygen(keygenRequest), strict); err != nil {
+		return fmt.Errorf("HandleKeygen: %w", err)
+	}
+	if err := h.checkDenylist(c, keygenRequest.Operators); err != nil {
+		return fmt.Errorf("HandleKeygen: %w", err)
 	}
 
-	requestID := getRandRequestID()
-	requestIDInHex := hex.EncodeToString(requestID[:])
+	if err := h.loadInitiator(c); err != nil {
+		return fmt.Errorf("HandleKeygen: %w", err)
+	}
+	events, err := openEventLog(c)
+	if err != nil {
+		return fmt.Errorf("HandleKeygen: %w", err)
+	}
+	h.events = events
+	defer events.Close()
 
-	messengerClient := messenger.NewMessengerClient(messenger.MessengerAddrFromEnv())
-	if err := messengerClient.CreateTopic(requestIDInHex, keygenRequest.allOperators()); err != nil {
-		return fmt.Errorf("HandleKeygen: failed to create a new topic on messenger service: %w", err)
+	requestIDInHex, err := h.startKeygen(keygenRequest)
+	if requestIDInHex == "" {
+		return fmt.Errorf("HandleKeygen: %w", err)
 	}
 
-	initMsgBytes, err := keygenRequest.initMsgForKeygen(requestID)
+	fmt.Printf("keygen init request sent with ID: %s\n", requestIDInHex)
+	if keygenRequest.Manifest != nil {
+		fmt.Printf("manifest hash: %s\n", keygenRequest.Manifest.Hash)
+	}
+	if keygenRequest.CanaryTTL > 0 {
+		fmt.Printf("canary keygen, nodes delete their share after %s; the result can't be used for a validator\n", keygenRequest.CanaryTTL)
+	}
+	if err := tolerate(c, err); err != nil {
+		return fmt.Errorf("HandleKeygen: %w", err)
+	}
+	return nil
+}
+
+// startKeygen creates the topic for a new keygen and sends the init message to
+// every operator, it returns the request ID in hex, also when the message
+// reached only some operators
+func (h *CliHandler) startKeygen(keygenRequest *KeygenRequest) (string, error) {
+	requestID, err := newRequestID(keygenRequest.RequestID)
 	if err != nil {
-		return fmt.Errorf("HandleKeygen: failed to generate init message for keygen: %w", err)
+		return "", fail(ConditionValidation, err)
+	}
+	if keygenRequest.RequestID != "" {
+		if err := h.checkRequestIDUnused(hex.EncodeToString(requestID[:]), keygenRequest.Operators); err != nil {
+			return "", err
+		}
 	}
 
-	for operatorID, nodeAddr := range keygenRequest.Operators {
-		if err := h.sendInitMsg(operatorID, nodeAddr, initMsgBytes); err != nil {
-			return fmt.Errorf("HandleKeygen: failed to send init message to operatorID %d: %w", operatorID, err)
+	signer := h.initiator
+	if signer == nil {
+		signer = testingInitSigner()
+	}
+	if keygenRequest.Signer != 0 {
+		if err := checkSigner(keygenRequest.Signer, keygenRequest.Operators, keygenRequest.Observers, keygenRequest.EncryptInit, keygenRequest.Options); err != nil {
+			return "", err
 		}
+		signer = delegatedSigner(keygenRequest.Signer)
+	}
+	initMsgBytes, err := keygenRequest.initMsgForKeygen(requestID, signer)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate init message for keygen: %w", err)
 	}
 
-	fmt.Printf("keygen init request sent with ID: %s\n", requestIDInHex)
+	requestIDInHex := hex.EncodeToString(requestID[:])
+	if err := h.deliverKeygen(requestIDInHex, keygenRequest, initMsgBytes); err != nil {
+		var failure *Failure
+		if errors.As(err, &failure) && failure.Condition == ConditionPartialDelivery {
+			return requestIDInHex, err
+		}
+		return "", err
+	}
+	return requestIDInHex, nil
+}
+
+// deliverKeygen creates the topic for the keygen and sends the signed init
+// message to every operator
+func (h *CliHandler) deliverKeygen(requestIDInHex string, keygenRequest *KeygenRequest, initMsgBytes []byte) (err error) {
+	defer func() {
+		h.events.ceremonyDelivered(requestIDInHex, ceremony.KindKeygen, keygenRequest.allOperators(), err)
+		h.updateTopicCache(func(cache *topiccache.Cache) {
+			if keygenRequest.Manifest != nil {
+				cache.SetManifestHash(requestIDInHex, keygenRequest.Manifest.Hash)
+			}
+			cache.SetDelivery(requestIDInHex, ceremony.KindKeygen, keygenRequest.allOperators(), err)
+		})
+	}()
+
+	limits, err := h.negotiateLimits(len(keygenRequest.Operators), initMsgBytes, keygenRequest.Operators, keygenRequest.Observers)
+	if err != nil {
+		return err
+	}
+	requirement := capabilityRequirement{
+		Ceremony:           string(ceremony.KindKeygen),
+		Operators:          countParticipants(keygenRequest.Operators, keygenRequest.Observers),
+		Observers:          keygenRequest.Observers,
+		MinProtocolVersion: keygenRequest.MinProtocolVersion,
+		Options:            keygenRequest.Options,
+		Suite:              keygenRequest.Suite,
+	}
+	if err := h.checkCapabilities(requirement, keygenRequest.Operators, keygenRequest.Observers); err != nil {
+		return err
+	}
+
+	messengerClient := h.messengerClient()
+	createTopic := messengerClient.CreateTopic
+	if keygenRequest.Options.Get(ceremony.OptionPriority) == "urgent" {
+		createTopic = messengerClient.CreateUrgentTopic
+	}
+	// canary keygens back no validator, they never need to hurry
+	if keygenRequest.CanaryTTL > 0 {
+		createTopic = messengerClient.CreateCanaryTopic
+	}
+	if err := createTopic(requestIDInHex, withObservers(keygenRequest.allOperators(), keygenRequest.Observers)); err != nil {
+		return unreachable(fmt.Errorf("failed to create a new topic on messenger service: %w", err))
+	}
+	h.events.emit(&EventRecord{Event: EventTopicCreated, RequestID: requestIDInHex})
+	if err := h.inviteObservers(requestIDInHex, keygenRequest.Observers, initMsgBytes); err != nil {
+		return err
+	}
+
+	if keygenRequest.Signer != 0 {
+		signature, err := h.delegateStart(requestIDInHex, keygenRequest.Operators[keygenRequest.Signer], keygenRequest.allOperators(), keygenRequest.Timeouts, keygenRequest.Approvals, limits, keygenRequest.CanaryTTL, keygenRequest.MinProtocolVersion, keygenRequest.Options, keygenRequest.Manifest, initMsgBytes)
+		if err != nil {
+			return fmt.Errorf("operator %d failed to sign and publish init message: %w", keygenRequest.Signer, err)
+		}
+		keygenRequest.VersionClaim, keygenRequest.Manifest = signature.VersionClaim, signature.Manifest
+		h.events.emit(&EventRecord{Event: EventStartRelayed, RequestID: requestIDInHex, Operators: keygenRequest.allOperators()})
+	} else if keygenRequest.EncryptInit || keygenRequest.Options.Get(ceremony.OptionEncryption) == "on" {
+		if err := h.sealStart(requestIDInHex, keygenRequest.allOperators(), keygenRequest.Timeouts, keygenRequest.Approvals, limits, keygenRequest.CanaryTTL, keygenRequest.VersionClaim, keygenRequest.Options, keygenRequest.Manifest, initMsgBytes); err != nil {
+			return fmt.Errorf("failed to relay sealed init message: %w", err)
+		}
+		h.events.emit(&EventRecord{Event: EventStartRelayed, RequestID: requestIDInHex, Operators: keygenRequest.allOperators()})
+	} else if keygenRequest.RelayInit {
+		if err := h.relayStart(requestIDInHex, keygenRequest.allOperators(), keygenRequest.Timeouts, keygenRequest.Approvals, limits, keygenRequest.CanaryTTL, keygenRequest.VersionClaim, keygenRequest.Options, keygenRequest.Manifest, initMsgBytes); err != nil {
+			return fmt.Errorf("failed to relay init message: %w", err)
+		}
+		h.events.emit(&EventRecord{Event: EventStartRelayed, RequestID: requestIDInHex, Operators: keygenRequest.allOperators()})
+	} else {
+		// keep sending after a failure, the operators that got the message
+		// are reported with the partial delivery
+		failed := make(map[types.OperatorID]error)
+		for operatorID, nodeAddr := range keygenRequest.Operators {
+			if err := h.awaitCapacity(requestIDInHex, operatorID, nodeAddr); err != nil {
+				failed[operatorID] = err
+				continue
+			}
+			url := consumeURL(nodeAddr, keygenRequest.Timeouts, keygenRequest.Approvals, limits, keygenRequest.CanaryTTL, keygenRequest.VersionClaim, keygenRequest.Options, keygenRequest.Manifest)
+			if err := h.sendInitMsg(operatorID, url, initMsgBytes); err != nil {
+				failed[operatorID] = err
+				continue
+			}
+			h.events.emit(&EventRecord{Event: EventStartSent, RequestID: requestIDInHex, Operator: operatorID})
+		}
+		if err := deliveryFailure(failed, len(keygenRequest.Operators)); err != nil {
+			return err
+		}
+	}
+
+	if err := h.rememberOperators(keygenRequest.Operators, addressbook.SourceCeremony); err != nil {
+		h.logger.Warnf("deliverKeygen: failed to update address book: %v", err)
+	}
 	return nil
 }
 
-func (h *CliHandler) sendInitMsg(operatorID types.OperatorID, addr string, data []byte) error {
-	url := fmt.Sprintf("%s/consume", addr)
+func (h *CliHandler) sendInitMsg(operatorID types.OperatorID, url string, data []byte) error {
 	resp, err := h.client.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		return err
@@ -79,10 +227,39 @@ func (h *CliHandler) sendInitMsg(operatorID types.OperatorID, addr string, data
 }
 
 type KeygenRequest struct {
+	// RequestID supplied by the caller, see newRequestID, random when empty
+	RequestID            string                      `json:"request_id,omitempty"`
 	Operators            map[types.OperatorID]string `json:"operators"`
 	Threshold            int                         `json:"threshold"`
 	WithdrawalCredential string                      `json:"withdrawal_credentials"`
 	ForkVersion          string                      `json:"fork_version"`
+	Timeouts             ceremony.PhaseTimeouts      `json:"timeouts"`
+	Approvals            []*coordinator.Approval     `json:"approvals,omitempty"`
+	// EncryptInit relays the init message through the messenger encrypted to each operator
+	EncryptInit bool `json:"encrypt_init,omitempty"`
+	// RelayInit publishes the init message to the topic for the messenger to deliver
+	RelayInit bool `json:"relay_init,omitempty"`
+	// Signer, when set, is the operator whose node signs and publishes the
+	// init message with its operator key instead of the cli
+	Signer types.OperatorID `json:"signer,omitempty"`
+	// Observers verify the transcript and attest to the result without holding a share
+	Observers map[types.OperatorID]string `json:"observers,omitempty"`
+	// CanaryTTL, when set, runs the keygen as canary: the result is marked
+	// as such and nodes delete their share once the ttl passed
+	CanaryTTL time.Duration `json:"canary_ttl,omitempty"`
+	// MinProtocolVersion, when set, is claimed with the start message and
+	// nodes refuse to run the keygen at an older version
+	MinProtocolVersion uint32                 `json:"min_protocol_version,omitempty"`
+	VersionClaim       *ceremony.VersionClaim `json:"version_claim,omitempty"`
+	// Options of the keygen the nodes honor, encryption=on relays the init
+	// message sealed like EncryptInit
+	Options ceremony.Options `json:"options,omitempty"`
+	// ManifestHash, when set, is the hash the manifest of the keygen must
+	// have, e.g. the one of an earlier keygen run again
+	ManifestHash string                   `json:"manifest_hash,omitempty"`
+	Manifest     *ceremony.SignedManifest `json:"manifest,omitempty"`
+	// Suite is the crypto suite of the keygen, empty for the default one
+	Suite string `json:"suite,omitempty"`
 }
 
 func (request *KeygenRequest) allOperators() []types.OperatorID {
@@ -94,6 +271,9 @@ func (request *KeygenRequest) allOperators() []types.OperatorID {
 }
 
 func (request *KeygenRequest) parseKeygenRequest(c *cli.Context) error {
+	if err := applyCeremonyConfig(c, "operator", "threshold", "withdrawal-credentials", "fork-version"); err != nil {
+		return err
+	}
 	operators, err := parseOperatorList(c)
 	if err != nil {
 		return err
@@ -103,31 +283,51 @@ func (request *KeygenRequest) parseKeygenRequest(c *cli.Context) error {
 	request.Threshold = c.Int("threshold")
 	request.WithdrawalCredential = c.String("withdrawal-credentials")
 	request.ForkVersion = c.String("fork-version")
-	return nil
+	request.Timeouts = parsePhaseTimeouts(c)
+	request.EncryptInit = c.Bool("encrypt-init")
+	request.RelayInit = c.Bool("relay-init")
+	request.Signer = types.OperatorID(c.Uint64("signer"))
+	request.MinProtocolVersion = uint32(c.Uint("min-protocol-version"))
+	request.ManifestHash = c.String("manifest-hash")
+	request.Suite = c.String("crypto-suite")
+	request.RequestID = c.String("request-id")
+	if request.Options, err = parseCeremonyOptions(c); err != nil {
+		return err
+	}
+	if c.Bool("canary") {
+		request.CanaryTTL = c.Duration("canary-ttl")
+		if request.CanaryTTL <= 0 || request.CanaryTTL > ceremony.MaxCanaryTTL {
+			return fmt.Errorf("canary ttl has to be between 0 and %s", ceremony.MaxCanaryTTL)
+		}
+	}
+	request.Observers, err = parseObservers(c, request.Operators)
+	return err
 }
 
-func parseOperatorList(c *cli.Context) (map[types.OperatorID]string, error) {
-	operators := make(map[types.OperatorID]string)
-	for _, o := range c.StringSlice("operator") {
-
-		operator := strings.Trim(o, " ")
-
-		pair := strings.Split(operator, "=")
-		if len(pair) != 2 {
-			return nil, fmt.Errorf("operator %s is not in the form of key=value", operator)
-		}
+// consumeURL is the node endpoint start messages are sent to, with the phase
+// timeouts, coordinator approvals, negotiated limits, canary ttl, version
+// claim, options and manifest of the ceremony in the query
+func consumeURL(addr string, timeouts ceremony.PhaseTimeouts, approvals []*coordinator.Approval, limits *ceremony.Limits, canaryTTL time.Duration, claim *ceremony.VersionClaim, options ceremony.Options, manifest *ceremony.SignedManifest) string {
+	query := consumeQuery(timeouts, approvals, limits, canaryTTL, claim, options, manifest)
+	if len(query) == 0 {
+		return fmt.Sprintf("%s/consume", addr)
+	}
+	return fmt.Sprintf("%s/consume?%s", addr, query.Encode())
+}
 
-		operatorID, err := strconv.Atoi(pair[0])
-		if err != nil {
-			return nil, err
-		}
-		operators[types.OperatorID(operatorID)] = pair[1]
+func parseOperatorList(c *cli.Context) (map[types.OperatorID]string, error) {
+	book, err := loadBookFor(c.StringSlice("operator"))
+	if err != nil {
+		return nil, err
 	}
-	return operators, nil
+	return parseOperatorPairs(c.StringSlice("operator"), book)
 }
 
-func (request *KeygenRequest) initMsgForKeygen(requestID dkg.RequestID) ([]byte, error) {
-	withdrawalCred, _ := hex.DecodeString(request.WithdrawalCredential)
+func (request *KeygenRequest) initMsgForKeygen(requestID dkg.RequestID, signer *initSigner) ([]byte, error) {
+	withdrawalCred, err := hexenc.ParseWithdrawalCredentials(request.WithdrawalCredential)
+	if err != nil {
+		return nil, err
+	}
 	forkVersion := types.NetworkFromString(request.ForkVersion).ForkVersion()
 
 	init := testingutils.InitMessageData(
@@ -138,18 +338,26 @@ func (request *KeygenRequest) initMsgForKeygen(requestID dkg.RequestID) ([]byte,
 	)
 	initBytes, _ := init.Encode()
 
-	// TODO: TBD who signs this init msg
-	ks := testingutils.TestingKeygenKeySet()
-	signedInitMsg := testingutils.SignDKGMsg(ks.DKGOperators[1].EncryptionKey, 1, &dkg.Message{
+	if request.VersionClaim, err = signer.claimVersion(requestID, request.MinProtocolVersion); err != nil {
+		return nil, err
+	}
+	manifest := &ceremony.Manifest{
+		Version:               ceremony.ManifestVersion,
+		Kind:                  ceremony.KindKeygen,
+		Operators:             init.OperatorIDs,
+		Threshold:             uint64(init.Threshold),
+		WithdrawalCredentials: hex.EncodeToString(init.WithdrawalCredentials),
+		ForkVersion:           hex.EncodeToString(init.Fork[:]),
+		MinProtocolVersion:    request.MinProtocolVersion,
+		Options:               request.Options,
+		Suite:                 request.Suite,
+	}
+	if request.Manifest, err = signer.signManifest(requestID, manifest, request.ManifestHash); err != nil {
+		return nil, err
+	}
+	return signer.sign(&dkg.Message{
 		MsgType:    dkg.InitMsgType,
 		Identifier: requestID,
 		Data:       initBytes,
 	})
-	signedInitMsgBytes, _ := signedInitMsg.Encode()
-
-	msg := &types.SSVMessage{
-		MsgType: types.DKGMsgType,
-		Data:    signedInitMsgBytes,
-	}
-	return msg.Encode()
 }
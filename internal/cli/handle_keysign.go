@@ -24,26 +24,35 @@ package cli
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
-	"github.com/bloxapp/ssv-spec/types/testingutils"
 	"github.com/urfave/cli/v2"
 )
 
-func (h *CliHandler) GenerateSignature(c *cli.Context, vk types.ValidatorPK, signingRoot []byte) (dkg.RequestID, error) {
+// GenerateDeclaredSignature starts a keysign that tells the nodes what it
+// signs: an application message root under a custom signing domain or an
+// ethereum message. Nodes refuse domains and usages their policy doesn't allow.
+func (h *CliHandler) GenerateDeclaredSignature(c *cli.Context, keySign *signing.KeySign) (dkg.RequestID, error) {
+	keySignBytes, err := json.Marshal(keySign)
+	if err != nil {
+		return [24]byte{}, fmt.Errorf("GenerateDeclaredSignature: failed to encode keysign request: %w", err)
+	}
+	return h.startKeySign(c, keySignBytes)
+}
+
+func (h *CliHandler) startKeySign(c *cli.Context, keySignBytes []byte) (dkg.RequestID, error) {
 	requestID := getRandRequestID()
 
-	keySign := dkg.KeySign{
-		ValidatorPK: vk,
-		SigningRoot: signingRoot,
+	signer := h.initiator
+	if signer == nil {
+		signer = testingInitSigner()
 	}
-	keySignBytes, _ := keySign.Encode()
-
-	initBytes, err := initMsgForKeySign(requestID, keySignBytes)
+	initBytes, err := initMsgForKeySign(requestID, keySignBytes, signer)
 	if err != nil {
 		return [24]byte{}, fmt.Errorf("HandleKeySign: failed to generate init msg for KeySign: %w", err)
 	}
@@ -53,12 +62,17 @@ func (h *CliHandler) GenerateSignature(c *cli.Context, vk types.ValidatorPK, sig
 		return [24]byte{}, fmt.Errorf("HandleKeySign: failed to parse operator list from command: %w", err)
 	}
 
+	requirement := capabilityRequirement{Ceremony: capabilityKeysign, Operators: len(operators)}
+	if err := h.checkCapabilities(requirement, operators); err != nil {
+		return [24]byte{}, fmt.Errorf("HandleKeySign: %w", err)
+	}
+
 	ol := make([]types.OperatorID, 0)
 	for operatorID := range operators {
 		ol = append(ol, operatorID)
 	}
 
-	messengerClient := messenger.NewMessengerClient(messenger.MessengerAddrFromEnv())
+	messengerClient := h.messengerClient()
 	if err := messengerClient.CreateTopic(hex.EncodeToString(requestID[:]), ol); err != nil {
 		return [24]byte{}, fmt.Errorf("HandleKeygen: failed to create a new topic on messenger service: %w", err)
 	}
@@ -80,23 +94,24 @@ func (h *CliHandler) sendKeySignMsg(operatorID types.OperatorID, addr string, da
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
+		refusal := &struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}{}
+		if json.NewDecoder(resp.Body).Decode(refusal) == nil && refusal.Code == "validator_busy" {
+			return fmt.Errorf("operator %d refused the keysign: %s", operatorID, refusal.Error)
+		}
 		return fmt.Errorf("request to operator %d to consume init message failed with status %s", operatorID, resp.Status)
 	}
 	return nil
 }
 
-func initMsgForKeySign(requestID dkg.RequestID, data []byte) ([]byte, error) {
-	ks := testingutils.TestingKeygenKeySet()
-	signedInitMsg := testingutils.SignDKGMsg(ks.DKGOperators[1].EncryptionKey, 1, &dkg.Message{
+// initMsgForKeySign signs the keysign start with the initiator key, nodes
+// verify it like keygen and resharing starts
+func initMsgForKeySign(requestID dkg.RequestID, data []byte, signer *initSigner) ([]byte, error) {
+	return signer.sign(&dkg.Message{
 		MsgType:    dkg.KeySignMsgType,
 		Identifier: requestID,
 		Data:       data,
 	})
-	signedInitMsgBytes, _ := signedInitMsg.Encode()
-
-	msg := &types.SSVMessage{
-		MsgType: types.DKGMsgType,
-		Data:    signedInitMsgBytes,
-	}
-	return msg.Encode()
 }
@@ -0,0 +1,197 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+// ValidatorLineage is the history of a validator's committees put together
+// from the nodes that took part in its ceremonies
+type ValidatorLineage struct {
+	ValidatorPK string `json:"validator_pk"`
+	// Origin is the request id of the keygen that created the validator,
+	// empty when no node that took part in it answered
+	Origin string `json:"origin,omitempty"`
+	// Entries are the keygen and resharings, oldest first
+	Entries []*storage.LineageEntry `json:"entries"`
+	// Committee is the committee the latest ceremony left the validator with
+	Committee []types.OperatorID `json:"committee"`
+	// Unreachable are the operators that were asked and didn't answer
+	Unreachable []types.OperatorID `json:"unreachable,omitempty"`
+}
+
+func (h CliHandler) CommandLineage() *cli.Command {
+	return &cli.Command{
+		Name:   "lineage",
+		Usage:  "show the keygen, resharings and current committee of a validator",
+		Action: h.HandleLineage,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "validator-pk",
+				Usage:    "validator public key",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:    "operator",
+				Aliases: []string{"o"},
+				Usage:   "node to ask first, id=endpoint or a bare id from the address book; every operator of the address book when not set",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the lineage as json",
+			},
+		},
+	}
+}
+
+// HandleLineage asks the nodes for the ceremonies of the validator they took
+// part in, and follows the committees they name to the other operators of the
+// address book, so one operator of any committee is enough to start with
+func (h *CliHandler) HandleLineage(c *cli.Context) error {
+	pk, err := hexenc.ParseValidatorPK(c.String("validator-pk"))
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleLineage: invalid validator pk: %w", err))
+	}
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return err
+	}
+	operators, err := parseOperatorPairs(c.StringSlice("operator"), book)
+	if err != nil {
+		return fail(ConditionValidation, err)
+	}
+	if len(operators) == 0 {
+		for _, entry := range book.List() {
+			operators[entry.OperatorID] = entry.Endpoint
+		}
+	}
+	if len(operators) == 0 {
+		return fail(ConditionValidation, fmt.Errorf("HandleLineage: no operator to ask, pass --operator or fill the address book"))
+	}
+
+	lineage, err := h.collectLineage(hex.EncodeToString(pk), operators, book)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return json.NewEncoder(os.Stdout).Encode(lineage)
+	}
+	fmt.Printf("validator %s\n", lineage.ValidatorPK)
+	for _, entry := range lineage.Entries {
+		committee := fmt.Sprintf("operators %s", formatOperatorIDs(entry.Operators))
+		if entry.Kind == ceremony.KindReshare {
+			committee = fmt.Sprintf("operators %s from %s", formatOperatorIDs(entry.Operators), formatOperatorIDs(entry.OldOperators))
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\tthreshold %d\n", entry.CompletedAt.Format(time.RFC3339), entry.Kind, entry.RequestID, committee, entry.Threshold)
+	}
+	if lineage.Origin == "" {
+		fmt.Println("warning: no node of the keygen answered, the lineage starts with a resharing")
+	}
+	if len(lineage.Unreachable) > 0 {
+		fmt.Printf("warning: operators %s didn't answer\n", formatOperatorIDs(lineage.Unreachable))
+	}
+	fmt.Printf("current committee: %s\n", formatOperatorIDs(lineage.Committee))
+	return nil
+}
+
+// collectLineage merges the lineages of the operators by request id, asking
+// the operators of every committee it learns about that the book has an
+// endpoint for
+func (h *CliHandler) collectLineage(validatorPK string, operators map[types.OperatorID]string, book *addressbook.Book) (*ValidatorLineage, error) {
+	asked := make(map[types.OperatorID]bool)
+	entries := make(map[string]*storage.LineageEntry)
+	lineage := &ValidatorLineage{ValidatorPK: validatorPK}
+
+	queue := make([]types.OperatorID, 0, len(operators))
+	for operatorID := range operators {
+		queue = append(queue, operatorID)
+	}
+	answered := 0
+	var lastErr error
+	for len(queue) > 0 {
+		operatorID := queue[0]
+		queue = queue[1:]
+		if asked[operatorID] {
+			continue
+		}
+		asked[operatorID] = true
+
+		addr, ok := operators[operatorID]
+		if !ok {
+			entry, err := book.Get(operatorID)
+			if err != nil {
+				continue
+			}
+			addr = entry.Endpoint
+		}
+		nodeLineage := &node.Lineage{}
+		if err := h.getNodeJSON(fmt.Sprintf("%s/lineage/%s", strings.TrimSuffix(addr, "/"), validatorPK), nodeLineage); err != nil {
+			h.logger.Warnf("collectLineage: failed to get lineage from operator %d: %v", operatorID, err)
+			lineage.Unreachable = append(lineage.Unreachable, operatorID)
+			lastErr = err
+			continue
+		}
+		answered++
+		for _, entry := range nodeLineage.Entries {
+			if _, ok := entries[entry.RequestID]; ok {
+				continue
+			}
+			entries[entry.RequestID] = entry
+			queue = append(queue, entry.Operators...)
+			queue = append(queue, entry.OldOperators...)
+		}
+	}
+	if answered == 0 {
+		return nil, unreachable(fmt.Errorf("collectLineage: none of the operators answered: %w", lastErr))
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("collectLineage: none of the operators took part in a ceremony of validator %s", validatorPK)
+	}
+
+	for _, entry := range entries {
+		lineage.Entries = append(lineage.Entries, entry)
+	}
+	sort.Slice(lineage.Entries, func(i, j int) bool {
+		return lineage.Entries[i].CompletedAt.Before(lineage.Entries[j].CompletedAt)
+	})
+	if first := lineage.Entries[0]; first.Kind == ceremony.KindKeygen {
+		lineage.Origin = first.RequestID
+	}
+	lineage.Committee = lineage.Entries[len(lineage.Entries)-1].Operators
+	sort.Slice(lineage.Unreachable, func(i, j int) bool { return lineage.Unreachable[i] < lineage.Unreachable[j] })
+	return lineage, nil
+}
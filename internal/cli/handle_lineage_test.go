@@ -0,0 +1,78 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func lineageServer(t *testing.T, entries ...*storage.LineageEntry) string {
+	r := gin.New()
+	r.GET("/lineage/:validator_pk", func(c *gin.Context) {
+		c.JSON(http.StatusOK, &node.Lineage{ValidatorPK: c.Param("validator_pk"), Entries: entries})
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestCollectLineage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	start := time.Now().UTC()
+	keygen := &storage.LineageEntry{RequestID: "a", Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3, 4}, Threshold: 3, CompletedAt: start}
+	reshare := &storage.LineageEntry{RequestID: "b", Kind: ceremony.KindReshare, Operators: []types.OperatorID{5, 6, 7, 8}, OldOperators: []types.OperatorID{1, 2, 3, 4}, Threshold: 3, CompletedAt: start.Add(time.Hour)}
+
+	book, err := addressbook.Load(filepath.Join(t.TempDir(), "addressbook.json"))
+	require.NoError(t, err)
+	book.SetEndpoint(1, lineageServer(t, keygen, reshare), addressbook.SourceManual)
+	book.SetEndpoint(2, "http://127.0.0.1:1", addressbook.SourceManual)
+
+	// operator 5 only took part in the resharing, the keygen comes from operator 1
+	h := New(logrus.New())
+	lineage, err := h.collectLineage("aa", map[types.OperatorID]string{5: lineageServer(t, reshare)}, book)
+	require.NoError(t, err)
+	require.Equal(t, "a", lineage.Origin)
+	require.Len(t, lineage.Entries, 2)
+	require.Equal(t, "b", lineage.Entries[1].RequestID)
+	require.Equal(t, []types.OperatorID{5, 6, 7, 8}, lineage.Committee)
+	require.Equal(t, []types.OperatorID{2}, lineage.Unreachable)
+
+	_, err = h.collectLineage("aa", map[types.OperatorID]string{9: lineageServer(t)}, book)
+	require.Error(t, err, "no ceremony of the validator")
+
+	_, err = h.collectLineage("aa", map[types.OperatorID]string{9: "http://127.0.0.1:1"}, book)
+	require.Equal(t, ExitUnreachable, ExitCode(err))
+}
@@ -0,0 +1,95 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandMessengerStatus() *cli.Command {
+	return &cli.Command{
+		Name:   "messenger-status",
+		Usage:  "show whether a messenger is the primary or a standby and how far the standby is behind",
+		Action: h.HandleMessengerStatus,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "addr",
+				Usage: "messenger to ask, defaults to MESSENGER_SRV_ADDR",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the status as json",
+			},
+		},
+	}
+}
+
+func (h *CliHandler) HandleMessengerStatus(c *cli.Context) error {
+	addr := c.String("addr")
+	if addr == "" {
+		addr = h.messengerAddr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	status, err := messenger.NewMessengerClient(addr).ReplicationStatus(ctx)
+	if err != nil {
+		return unreachable(fmt.Errorf("HandleMessengerStatus: failed to get replication status of %s: %w", addr, err))
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+	printReplicationStatus(addr, status)
+	return nil
+}
+
+func printReplicationStatus(addr string, status *messenger.ReplicationStatus) {
+	fmt.Printf("messenger: %s\n", addr)
+	switch {
+	case status.PromotedAt != nil:
+		fmt.Printf("role: primary, promoted from standby of %s at %s\n", status.Primary, status.PromotedAt.Format(time.RFC3339))
+	case status.Role == messenger.RoleStandby:
+		fmt.Printf("role: standby of %s\n", status.Primary)
+	default:
+		fmt.Printf("role: %s\n", status.Role)
+	}
+	if status.Role == messenger.RoleStandby {
+		fmt.Printf("applied change: %d of %d (%d behind, lag %.1fs)\n", status.AppliedSeq, status.PrimarySeq, status.LagChanges, status.LagSeconds)
+		if status.LastContact != nil {
+			fmt.Printf("last contact with primary: %s ago\n", time.Since(*status.LastContact).Round(time.Second))
+		} else {
+			fmt.Println("last contact with primary: never")
+		}
+	} else {
+		fmt.Printf("changes logged: %d\n", status.AppliedSeq)
+	}
+}
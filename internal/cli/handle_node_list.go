@@ -0,0 +1,161 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandNodeList() *cli.Command {
+	listFlags := func(flags ...cli.Flag) []cli.Flag {
+		return append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "node",
+				Usage:    "address of the node to list, e.g. http://0.0.0.0:8081",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "entries per page",
+				Value: 100,
+			},
+			&cli.StringFlag{
+				Name:  "after",
+				Usage: "cursor printed with the previous page",
+			},
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "follow the cursors and list every page",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the pages as json, one per line",
+			},
+		}, flags...)
+	}
+	return &cli.Command{
+		Name:  "node-list",
+		Usage: "list the shares and ceremonies stored by a node",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "shares",
+				Usage:  "list the validators the node holds a share of",
+				Action: h.HandleNodeListShares,
+				Flags: listFlags(&cli.IntFlag{
+					Name:  "operator",
+					Usage: "only shares of committees with this operator",
+				}),
+			},
+			{
+				Name:   "ceremonies",
+				Usage:  "list the ceremonies the node took part in",
+				Action: h.HandleNodeListCeremonies,
+				Flags: listFlags(&cli.StringFlag{
+					Name:  "state",
+					Usage: "only ceremonies in this state, e.g. completed, aborted or round1",
+				}),
+			},
+		},
+	}
+}
+
+func (h *CliHandler) HandleNodeListShares(c *cli.Context) error {
+	query := url.Values{}
+	if c.IsSet("operator") {
+		query.Set("operator", strconv.Itoa(c.Int("operator")))
+	}
+	return h.listNodePages(c, "/shares", query, func(addr string) (string, error) {
+		list := &node.ShareList{}
+		if err := h.getNodeJSON(addr, list); err != nil {
+			return "", err
+		}
+		if c.Bool("json") {
+			return list.Next, json.NewEncoder(os.Stdout).Encode(list)
+		}
+		for _, share := range list.Shares {
+			canary := ""
+			if share.Canary {
+				canary = "\tcanary"
+			}
+			fmt.Printf("%s\t%s\tthreshold %d%s\n", share.ValidatorPK, formatOperatorIDs(share.Operators), share.Threshold, canary)
+		}
+		return list.Next, nil
+	})
+}
+
+func (h *CliHandler) HandleNodeListCeremonies(c *cli.Context) error {
+	query := url.Values{}
+	if state := c.String("state"); state != "" {
+		query.Set("state", state)
+	}
+	return h.listNodePages(c, "/ceremonies", query, func(addr string) (string, error) {
+		list := &node.CeremonyList{}
+		if err := h.getNodeJSON(addr, list); err != nil {
+			return "", err
+		}
+		if c.Bool("json") {
+			return list.Next, json.NewEncoder(os.Stdout).Encode(list)
+		}
+		for _, cer := range list.Ceremonies {
+			kind := ""
+			if cer.Params != nil {
+				kind = string(cer.Params.Kind)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", cer.RequestID, cer.State, kind, cer.UpdatedAt.Format(time.RFC3339))
+		}
+		return list.Next, nil
+	})
+}
+
+// listNodePages walks the pages of a node list endpoint, page gets and prints
+// the page at addr and returns the cursor of the next one
+func (h *CliHandler) listNodePages(c *cli.Context, path string, query url.Values, page func(addr string) (string, error)) error {
+	query.Set("limit", strconv.Itoa(c.Int("limit")))
+	if after := c.String("after"); after != "" {
+		query.Set("after", after)
+	}
+	for {
+		next, err := page(strings.TrimSuffix(c.String("node"), "/") + path + "?" + query.Encode())
+		if err != nil {
+			return unreachable(fmt.Errorf("failed to list %s of %s: %w", strings.TrimPrefix(path, "/"), c.String("node"), err))
+		}
+		if next == "" {
+			return nil
+		}
+		if !c.Bool("all") {
+			if !c.Bool("json") {
+				fmt.Printf("more with --after %s\n", next)
+			}
+			return nil
+		}
+		query.Set("after", next)
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/denylist"
+	"github.com/RockX-SG/frost-dkg-demo/internal/reshareplan"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+// ResharingPlan is the output of plan-resharing, each ceremony is a complete
+// resharing request resharing-batch starts as is
+type ResharingPlan struct {
+	Ceremonies []*ResharingRequest      `json:"ceremonies"`
+	Load       map[types.OperatorID]int `json:"load"`
+}
+
+func (h CliHandler) CommandPlanResharing() *cli.Command {
+	return &cli.Command{
+		Name:   "plan-resharing",
+		Usage:  "assign a batch of validators to new committees from a pool of operators and write the resharings to a plan file",
+		Action: h.HandlePlanResharing,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "validators",
+				Usage:    "json file with a list of {\"validator_pk\", \"operators_old\"} to reshare",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "operator",
+				Aliases:  []string{"o"},
+				Usage:    "operator key-value pair of the target pool, a bare id takes its endpoint, region and asn from the address book",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "committee-size",
+				Usage: "operators in each new committee",
+				Value: 4,
+			},
+			&cli.IntFlag{
+				Name:    "threshold",
+				Aliases: []string{"t"},
+				Usage:   "threshold of the new committees, two thirds of the committee plus one when unset",
+			},
+			&cli.IntFlag{
+				Name:  "max-per-operator",
+				Usage: "most validators one operator of the pool takes, unlimited when unset",
+			},
+			&cli.IntFlag{
+				Name:  "max-per-region",
+				Usage: "most operators of one committee in the same region of the address book, unlimited when unset",
+			},
+			&cli.IntFlag{
+				Name:  "max-per-asn",
+				Usage: "most operators of one committee in the same asn of the address book, unlimited when unset",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "file to write the plan to",
+				Value: "resharing-plan.json",
+			},
+		},
+	}
+}
+
+func (h *CliHandler) HandlePlanResharing(c *cli.Context) error {
+	byts, err := os.ReadFile(c.String("validators"))
+	if err != nil {
+		return fmt.Errorf("HandlePlanResharing: failed to read validators: %w", err)
+	}
+	validators := make([]reshareplan.Validator, 0)
+	if err := json.Unmarshal(byts, &validators); err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandlePlanResharing: failed to parse validators: %w", err))
+	}
+
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandlePlanResharing: %w", err)
+	}
+	pool, err := parseOperatorPairs(c.StringSlice("operator"), book)
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandlePlanResharing: %w", err))
+	}
+	list, err := denylist.Load(denylist.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandlePlanResharing: %w", err)
+	}
+	ids := make([]types.OperatorID, 0, len(pool))
+	for operatorID := range pool {
+		ids = append(ids, operatorID)
+	}
+	for _, entry := range list.Listed(ids) {
+		fmt.Printf("leaving operator %d out of the pool, it is on the denylist (%s): %s\n", entry.OperatorID, entry.Source, entry.Reason)
+		delete(pool, entry.OperatorID)
+	}
+
+	constraints := reshareplan.Constraints{
+		CommitteeSize:  c.Int("committee-size"),
+		MaxPerOperator: c.Int("max-per-operator"),
+		MaxPerRegion:   c.Int("max-per-region"),
+		MaxPerASN:      c.Int("max-per-asn"),
+	}
+	plan, err := buildResharingPlan(validators, pool, book, constraints, c.Int("threshold"))
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandlePlanResharing: %w", err))
+	}
+
+	byts, err = json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("HandlePlanResharing: %w", err)
+	}
+	if err := os.WriteFile(c.String("out"), byts, 0o644); err != nil {
+		return fmt.Errorf("HandlePlanResharing: failed to write plan: %w", err)
+	}
+
+	operators := make([]types.OperatorID, 0, len(plan.Load))
+	for operatorID := range plan.Load {
+		operators = append(operators, operatorID)
+	}
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+	for _, operatorID := range operators {
+		fmt.Printf("operator %d: %d validators\n", operatorID, plan.Load[operatorID])
+	}
+	fmt.Printf("planned %d resharings in %s\n", len(plan.Ceremonies), c.String("out"))
+	return nil
+}
+
+// buildResharingPlan assigns the validators to committees of the pool and
+// turns the assignments into resharing requests, the endpoints of the old
+// committees come from the address book
+func buildResharingPlan(validators []reshareplan.Validator, pool map[types.OperatorID]string, book *addressbook.Book, constraints reshareplan.Constraints, threshold int) (*ResharingPlan, error) {
+	if threshold == 0 {
+		threshold = constraints.CommitteeSize - (constraints.CommitteeSize-1)/3
+	}
+	if threshold <= 0 || threshold > constraints.CommitteeSize {
+		return nil, fmt.Errorf("threshold %d doesn't fit committees of %d", threshold, constraints.CommitteeSize)
+	}
+
+	operators := make([]reshareplan.Operator, 0, len(pool))
+	for operatorID := range pool {
+		operator := reshareplan.Operator{ID: operatorID}
+		if entry, err := book.Get(operatorID); err == nil {
+			operator.Region = entry.Region
+			operator.ASN = entry.ASN
+		}
+		operators = append(operators, operator)
+	}
+	sort.Slice(operators, func(i, j int) bool { return operators[i].ID < operators[j].ID })
+
+	plan, err := reshareplan.Build(validators, operators, constraints)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ResharingPlan{Load: plan.Load}
+	for _, assignment := range plan.Assignments {
+		request := &ResharingRequest{
+			ValidatorPK:  assignment.ValidatorPK,
+			Threshold:    threshold,
+			Operators:    make(map[types.OperatorID]string, len(assignment.Operators)),
+			OperatorsOld: make(map[types.OperatorID]string, len(assignment.OldOperators)),
+		}
+		for _, operatorID := range assignment.Operators {
+			request.Operators[operatorID] = pool[operatorID]
+		}
+		for _, operatorID := range assignment.OldOperators {
+			entry, err := book.Get(operatorID)
+			if err != nil {
+				return nil, fmt.Errorf("old operator %d of validator %s: %w", operatorID, assignment.ValidatorPK, err)
+			}
+			request.OperatorsOld[operatorID] = entry.Endpoint
+		}
+		out.Ceremonies = append(out.Ceremonies, request)
+	}
+	return out, nil
+}
+
+func (h CliHandler) CommandResharingBatch() *cli.Command {
+	return &cli.Command{
+		Name:   "resharing-batch",
+		Usage:  "start the resharings of a plan file written by plan-resharing",
+		Action: h.HandleResharingBatch,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "plan",
+				Usage:    "plan file written by plan-resharing",
+				Required: true,
+			},
+			encryptInitFlag(),
+			relayInitFlag(),
+			signerFlag(),
+			optionFlag(),
+			minProtocolVersionFlag(),
+			forceFlag(),
+			eventsOutFlag(),
+			failOnFlag(),
+		}, append(append(initiatorKeyFlags(), phaseTimeoutFlags()...), lintFlags()...)...),
+	}
+}
+
+// HandleResharingBatch starts the resharings of the plan one after the other,
+// a resharing that fails to start doesn't stop the ones after it
+func (h *CliHandler) HandleResharingBatch(c *cli.Context) error {
+	byts, err := os.ReadFile(c.String("plan"))
+	if err != nil {
+		return fmt.Errorf("HandleResharingBatch: failed to read plan: %w", err)
+	}
+	plan := &ResharingPlan{}
+	if err := json.Unmarshal(byts, plan); err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleResharingBatch: failed to parse plan: %w", err))
+	}
+	options, err := parseCeremonyOptions(c)
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleResharingBatch: %w", err))
+	}
+	strict, err := strictLint(c)
+	if err != nil {
+		return fmt.Errorf("HandleResharingBatch: %w", err)
+	}
+
+	if err := h.loadInitiator(c); err != nil {
+		return fmt.Errorf("HandleResharingBatch: %w", err)
+	}
+	events, err := openEventLog(c)
+	if err != nil {
+		return fmt.Errorf("HandleResharingBatch: %w", err)
+	}
+	h.events = events
+	defer events.Close()
+
+	linter := h.newLinter(c)
+	failed := 0
+	for i, request := range plan.Ceremonies {
+		request.Timeouts = parsePhaseTimeouts(c)
+		request.EncryptInit = c.Bool("encrypt-init")
+		request.RelayInit = c.Bool("relay-init")
+		request.Signer = types.OperatorID(c.Uint64("signer"))
+		request.MinProtocolVersion = uint32(c.Uint("min-protocol-version"))
+		request.Options = options
+
+		requestIDInHex, err := h.startPlannedResharing(c, linter, strict, request)
+		if requestIDInHex != "" {
+			err = tolerate(c, err)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("%d/%d %s failed: %v\n", i+1, len(plan.Ceremonies), request.ValidatorPK, err)
+			continue
+		}
+		fmt.Printf("%d/%d %s resharing init request sent with ID: %s\n", i+1, len(plan.Ceremonies), request.ValidatorPK, requestIDInHex)
+	}
+	if failed > 0 {
+		return fmt.Errorf("HandleResharingBatch: %d of %d resharings failed to start", failed, len(plan.Ceremonies))
+	}
+	return nil
+}
+
+func (h *CliHandler) startPlannedResharing(c *cli.Context, linter *ceremonyLinter, strict bool, request *ResharingRequest) (string, error) {
+	if err := reportLint(linter.LintResharing(request), strict); err != nil {
+		return "", err
+	}
+	if err := h.checkDenylist(c, request.Operators); err != nil {
+		return "", err
+	}
+	return h.startResharing(request)
+}
@@ -0,0 +1,80 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/reshareplan"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildResharingPlan(t *testing.T) {
+	book, err := addressbook.Load(filepath.Join(t.TempDir(), "addressbook.json"))
+	require.NoError(t, err)
+	pool := make(map[types.OperatorID]string)
+	for i := 1; i <= 8; i++ {
+		operatorID := types.OperatorID(i)
+		book.SetEndpoint(operatorID, fmt.Sprintf("http://10.0.0.%d:8081", i), addressbook.SourceManual)
+		region := "eu"
+		if i > 4 {
+			region = "us"
+		}
+		book.SetLocation(operatorID, region, 0)
+		if i > 2 {
+			pool[operatorID] = fmt.Sprintf("http://10.0.0.%d:8081", i)
+		}
+	}
+
+	validators := []reshareplan.Validator{
+		{ValidatorPK: "aa", OldOperators: []types.OperatorID{1, 2, 3, 4}},
+		{ValidatorPK: "bb", OldOperators: []types.OperatorID{1, 2, 3, 4}},
+	}
+	plan, err := buildResharingPlan(validators, pool, book, reshareplan.Constraints{CommitteeSize: 4, MaxPerRegion: 2}, 0)
+	require.NoError(t, err)
+	require.Len(t, plan.Ceremonies, 2)
+
+	first := plan.Ceremonies[0]
+	require.Equal(t, "aa", first.ValidatorPK)
+	require.Equal(t, 3, first.Threshold)
+	require.Equal(t, map[types.OperatorID]string{
+		3: "http://10.0.0.3:8081",
+		4: "http://10.0.0.4:8081",
+		5: "http://10.0.0.5:8081",
+		6: "http://10.0.0.6:8081",
+	}, first.Operators)
+	require.Equal(t, "http://10.0.0.1:8081", first.OperatorsOld[1])
+	require.Len(t, plan.Ceremonies[1].Operators, 4)
+	require.Equal(t, 2, plan.Load[3])
+	require.Equal(t, 1, plan.Load[8])
+
+	_, err = buildResharingPlan(validators, pool, book, reshareplan.Constraints{CommitteeSize: 4}, 5)
+	require.Error(t, err)
+
+	validators[0].OldOperators = []types.OperatorID{9}
+	_, err = buildResharingPlan(validators, pool, book, reshareplan.Constraints{CommitteeSize: 4}, 3)
+	require.ErrorIs(t, err, addressbook.ErrUnknownOperator)
+}
@@ -0,0 +1,489 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// RPCResultConflict is returned for a submitted result that differs from the
+// one the server holds for the request id
+const RPCResultConflict = -32002
+
+// resultFileName matches the results files get-dkg-results writes
+var resultFileName = regexp.MustCompile(`^dkg_results_([0-9a-f]{48})_([0-9]+)\.json$`)
+
+// ResultManifest lists the results a coordinator collected, the digest of
+// each by request id
+type ResultManifest struct {
+	Results map[string]string `json:"results"`
+}
+
+// ResultDivergence is how two result manifests differ
+type ResultDivergence struct {
+	// OnlyLocal and OnlyRemote are results one coordinator misses
+	OnlyLocal  []string `json:"only_local"`
+	OnlyRemote []string `json:"only_remote"`
+	// Diverged are request ids both have different results for
+	Diverged []string `json:"diverged"`
+}
+
+// compareManifests lists the request ids of two manifests that differ, sorted
+func compareManifests(local, remote *ResultManifest) *ResultDivergence {
+	divergence := &ResultDivergence{OnlyLocal: []string{}, OnlyRemote: []string{}, Diverged: []string{}}
+	for requestID, digest := range local.Results {
+		remoteDigest, ok := remote.Results[requestID]
+		switch {
+		case !ok:
+			divergence.OnlyLocal = append(divergence.OnlyLocal, requestID)
+		case remoteDigest != digest:
+			divergence.Diverged = append(divergence.Diverged, requestID)
+		}
+	}
+	for requestID := range remote.Results {
+		if _, ok := local.Results[requestID]; !ok {
+			divergence.OnlyRemote = append(divergence.OnlyRemote, requestID)
+		}
+	}
+	sort.Strings(divergence.OnlyLocal)
+	sort.Strings(divergence.OnlyRemote)
+	sort.Strings(divergence.Diverged)
+	return divergence
+}
+
+// resultDigest is the sha256 of what the committee produced: the outputs or
+// the blame. Attestations and the manifest hash depend on who collected the
+// result and are left out.
+func resultDigest(result *DKGResult) (string, error) {
+	byts, err := json.Marshal(&DKGResult{Output: result.Output, Blame: result.Blame, Canary: result.Canary})
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(byts)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// checkResult verifies a result received from another coordinator: every
+// output is signed by its operator's registry key and belongs to requestID
+func checkResult(requestID string, result *DKGResult, keys observer.KeyLookup) error {
+	if result.Blame != nil {
+		return fmt.Errorf("blame results can't be checked against the operator keys")
+	}
+	if err := result.verifyOutputs(keys); err != nil {
+		return err
+	}
+	for operatorID, output := range result.Output {
+		outputRequestID := output.Data.RequestID
+		if output.KeySignData.Signature != "" {
+			outputRequestID = output.KeySignData.RequestID
+		}
+		if outputRequestID != requestID {
+			return fmt.Errorf("output of operator %d is of request %s", operatorID, outputRequestID)
+		}
+	}
+	return nil
+}
+
+// resultStore is a directory of results files as get-dkg-results writes
+// them, the newest file of a request id is its result
+type resultStore struct {
+	dir  string
+	keys observer.KeyLookup
+}
+
+// files returns the newest results file of every request id
+func (s *resultStore) files() (map[string]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	newest := make(map[string]int64)
+	for _, entry := range entries {
+		match := resultFileName.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		at, _ := strconv.ParseInt(match[2], 10, 64)
+		if _, ok := files[match[1]]; !ok || at > newest[match[1]] {
+			files[match[1]] = filepath.Join(s.dir, entry.Name())
+			newest[match[1]] = at
+		}
+	}
+	return files, nil
+}
+
+// manifest lists the results of the store, only those of requestIDs when
+// there are any
+func (s *resultStore) manifest(requestIDs []string) (*ResultManifest, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ResultManifest{Results: make(map[string]string)}
+	for requestID, file := range files {
+		if len(requestIDs) > 0 && !containsString(requestIDs, requestID) {
+			continue
+		}
+		result, err := readResult(file)
+		if err != nil {
+			return nil, err
+		}
+		if manifest.Results[requestID], err = resultDigest(result); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+func (s *resultStore) get(requestID string) (*DKGResult, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	file, ok := files[requestID]
+	if !ok {
+		return nil, nil
+	}
+	return readResult(file)
+}
+
+// put checks the result and writes it unless the store has it already. A
+// different result for the request id is refused.
+func (s *resultStore) put(requestID string, result *DKGResult) (string, error) {
+	if err := checkResult(requestID, result, s.keys); err != nil {
+		return "", err
+	}
+	digest, err := resultDigest(result)
+	if err != nil {
+		return "", err
+	}
+	existing, err := s.get(requestID)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		existingDigest, err := resultDigest(existing)
+		if err != nil {
+			return "", err
+		}
+		if existingDigest != digest {
+			return "", fmt.Errorf("a different result of request %s is stored: %s", requestID, existingDigest)
+		}
+		return digest, nil
+	}
+	file := filepath.Join(s.dir, fmt.Sprintf("dkg_results_%s_%d.json", requestID, time.Now().Unix()))
+	return digest, utils.WriteJSON(file, result)
+}
+
+func readResult(file string) (*DKGResult, error) {
+	byts, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	result := &DKGResult{}
+	if err := json.Unmarshal(byts, result); err != nil {
+		return nil, fmt.Errorf("invalid results file %s: %w", file, err)
+	}
+	return result, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type resultManifestParams struct {
+	RequestIDs []string `json:"request_ids,omitempty"`
+}
+
+type submitResultParams struct {
+	RequestID string     `json:"request_id"`
+	Result    *DKGResult `json:"result"`
+}
+
+type submitResultResponse struct {
+	Digest string `json:"digest"`
+}
+
+func (h *CliHandler) rpcResultManifest(params json.RawMessage) (interface{}, error) {
+	request := &resultManifestParams{}
+	if len(params) > 0 {
+		if err := decodeParams(params, request); err != nil {
+			return nil, err
+		}
+	}
+	return h.results.manifest(request.RequestIDs)
+}
+
+func (h *CliHandler) rpcGetResult(params json.RawMessage) (interface{}, error) {
+	request := &ceremonyParams{}
+	if err := decodeParams(params, request); err != nil {
+		return nil, err
+	}
+	result, err := h.results.get(request.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, &RPCError{Code: RPCCeremonyNotFound, Message: fmt.Sprintf("no result of request %s", request.RequestID)}
+	}
+	return result, nil
+}
+
+func (h *CliHandler) rpcSubmitResult(params json.RawMessage) (interface{}, error) {
+	request := &submitResultParams{}
+	if err := decodeParams(params, request); err != nil {
+		return nil, err
+	}
+	if request.RequestID == "" || request.Result == nil {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "request_id and result are required"}
+	}
+	digest, err := h.results.put(request.RequestID, request.Result)
+	if err != nil {
+		return nil, &RPCError{Code: RPCResultConflict, Message: err.Error()}
+	}
+	h.logger.Infof("rpcSubmitResult: stored result of request %s from another coordinator", request.RequestID)
+	return &submitResultResponse{Digest: digest}, nil
+}
+
+// resultPeer is the json-rpc api of the other coordinator
+type resultPeer struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (p *resultPeer) call(method string, params, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fail(ConditionUnreachable, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s failed with status %s: %s", method, resp.Status, string(respBody))
+	}
+	rpcResp := &rpcResponse{}
+	if err := json.Unmarshal(respBody, rpcResp); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", method, err)
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+	return json.Unmarshal(rpcResp.Result, out)
+}
+
+// ReconcileReport is what reconcile-results found and did
+type ReconcileReport struct {
+	*ResultDivergence
+	// Fetched are results of the peer stored locally, Pushed results the peer took
+	Fetched []string `json:"fetched"`
+	Pushed  []string `json:"pushed"`
+	// Failed are results that couldn't be exchanged, with the reason
+	Failed map[string]string `json:"failed"`
+	DryRun bool              `json:"dry_run,omitempty"`
+}
+
+// reconcileResults exchanges the missing results with the peer, each side
+// checks a result against the operator keys before it keeps it. Diverged
+// results are only reported.
+func reconcileResults(local *resultStore, peer *resultPeer, requestIDs []string, dryRun bool) (*ReconcileReport, error) {
+	localManifest, err := local.manifest(requestIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local results: %w", err)
+	}
+	remoteManifest := &ResultManifest{}
+	if err := peer.call("resultManifest", &resultManifestParams{RequestIDs: requestIDs}, remoteManifest); err != nil {
+		return nil, fmt.Errorf("failed to get the result manifest of the peer: %w", err)
+	}
+
+	report := &ReconcileReport{
+		ResultDivergence: compareManifests(localManifest, remoteManifest),
+		Fetched:          []string{},
+		Pushed:           []string{},
+		Failed:           make(map[string]string),
+		DryRun:           dryRun,
+	}
+	if dryRun {
+		return report, nil
+	}
+	for _, requestID := range report.OnlyRemote {
+		result := &DKGResult{}
+		if err := peer.call("getResult", &ceremonyParams{RequestID: requestID}, result); err != nil {
+			report.Failed[requestID] = err.Error()
+			continue
+		}
+		// the result is the one the manifest announced
+		if digest, err := resultDigest(result); err != nil || digest != remoteManifest.Results[requestID] {
+			report.Failed[requestID] = "result doesn't match the manifest of the peer"
+			continue
+		}
+		if _, err := local.put(requestID, result); err != nil {
+			report.Failed[requestID] = err.Error()
+			continue
+		}
+		report.Fetched = append(report.Fetched, requestID)
+	}
+	for _, requestID := range report.OnlyLocal {
+		result, err := local.get(requestID)
+		if err != nil {
+			report.Failed[requestID] = err.Error()
+			continue
+		}
+		response := &submitResultResponse{}
+		if err := peer.call("submitResult", &submitResultParams{RequestID: requestID, Result: result}, response); err != nil {
+			report.Failed[requestID] = err.Error()
+			continue
+		}
+		report.Pushed = append(report.Pushed, requestID)
+	}
+	return report, nil
+}
+
+func (h CliHandler) CommandReconcileResults() *cli.Command {
+	return &cli.Command{
+		Name:   "reconcile-results",
+		Usage:  "compare the results collected here with another coordinator's and exchange the missing ones",
+		Action: h.HandleReconcileResults,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "peer",
+				Usage:    "json-rpc url of the other coordinator, its serve --results-dir, e.g. https://coordinator-b:8000/rpc",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "bearer token of the peer api",
+				EnvVars: []string{"DKG_PEER_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:  "results-dir",
+				Usage: "directory of the results files written by get-dkg-results",
+				Value: ".",
+			},
+			&cli.StringSliceFlag{
+				Name:    "request-id",
+				Aliases: []string{"req"},
+				Usage:   "reconcile only these request ids, e.g. those of a batch",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "only compare the manifests",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the report as json",
+			},
+		},
+	}
+}
+
+func (h *CliHandler) HandleReconcileResults(c *cli.Context) error {
+	local := &resultStore{dir: c.String("results-dir"), keys: cachedKeys(registryKeys)}
+	peer := &resultPeer{url: c.String("peer"), token: c.String("token"), client: h.client}
+	report, err := reconcileResults(local, peer, c.StringSlice("request-id"), c.Bool("dry-run"))
+	if err != nil {
+		return fmt.Errorf("HandleReconcileResults: %w", err)
+	}
+
+	if c.Bool("json") {
+		byts, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("HandleReconcileResults: %w", err)
+		}
+		fmt.Println(string(byts))
+	} else {
+		printReconcileReport(report)
+	}
+
+	if len(report.Diverged) > 0 {
+		return fail(ConditionDivergence, fmt.Errorf("HandleReconcileResults: the coordinators hold different results of %s", strings.Join(report.Diverged, ", ")))
+	}
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("HandleReconcileResults: %d results couldn't be exchanged", len(report.Failed))
+	}
+	return nil
+}
+
+func printReconcileReport(report *ReconcileReport) {
+	fmt.Printf("only here: %d, only on the peer: %d, diverged: %d\n", len(report.OnlyLocal), len(report.OnlyRemote), len(report.Diverged))
+	for _, requestID := range report.Diverged {
+		fmt.Printf("  diverged: %s\n", requestID)
+	}
+	if report.DryRun {
+		for _, requestID := range report.OnlyLocal {
+			fmt.Printf("  only here: %s\n", requestID)
+		}
+		for _, requestID := range report.OnlyRemote {
+			fmt.Printf("  only on the peer: %s\n", requestID)
+		}
+		return
+	}
+	for _, requestID := range report.Fetched {
+		fmt.Printf("  fetched: %s\n", requestID)
+	}
+	for _, requestID := range report.Pushed {
+		fmt.Printf("  pushed: %s\n", requestID)
+	}
+	failed := make([]string, 0, len(report.Failed))
+	for requestID := range report.Failed {
+		failed = append(failed, requestID)
+	}
+	sort.Strings(failed)
+	for _, requestID := range failed {
+		fmt.Printf("  failed: %s: %s\n", requestID, report.Failed[requestID])
+	}
+}
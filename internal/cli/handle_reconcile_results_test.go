@@ -0,0 +1,124 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func testResult(t *testing.T, requestID dkg.RequestID, operators ...types.OperatorID) (string, *DKGResult) {
+	outputs := committeeOutputs(t, requestID, operators...)
+	return hex.EncodeToString(requestID[:]), formatResults(&messenger.DataStore{DKGOutputs: outputs.Outputs})
+}
+
+func testResultStore(t *testing.T) *resultStore {
+	return &resultStore{dir: t.TempDir(), keys: testingKeys}
+}
+
+func TestReconcileResults(t *testing.T) {
+	local, remote := testResultStore(t), testResultStore(t)
+
+	shared, sharedResult := testResult(t, dkg.RequestID{1}, 1, 2, 3, 4)
+	onlyLocal, onlyLocalResult := testResult(t, dkg.RequestID{2}, 1, 2, 3, 4)
+	onlyRemote, onlyRemoteResult := testResult(t, dkg.RequestID{3}, 1, 2, 3, 4)
+	diverged, divergedLocal := testResult(t, dkg.RequestID{4}, 1, 2, 3, 4)
+	_, divergedRemote := testResult(t, dkg.RequestID{4}, 1, 2, 3)
+	forged, forgedResult := testResult(t, dkg.RequestID{5}, 1, 2, 3, 4)
+	output := forgedResult.Output[2]
+	output.Signature = forgedResult.Output[1].Signature
+	forgedResult.Output[2] = output
+
+	for requestID, result := range map[string]*DKGResult{shared: sharedResult, onlyLocal: onlyLocalResult, diverged: divergedLocal} {
+		_, err := local.put(requestID, result)
+		require.NoError(t, err)
+	}
+	for requestID, result := range map[string]*DKGResult{shared: sharedResult, onlyRemote: onlyRemoteResult, diverged: divergedRemote} {
+		_, err := remote.put(requestID, result)
+		require.NoError(t, err)
+	}
+	// a forged result doesn't get into a store through put
+	_, err := remote.put(forged, forgedResult)
+	require.ErrorContains(t, err, "output of operator 2")
+	require.NoError(t, writeArtifact(remote.dir+"/dkg_results_"+forged+"_1.json", forgedResult, nil))
+
+	h := New(logrus.New())
+	h.results = remote
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/rpc", h.HandleJSONRPC())
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	peer := &resultPeer{url: srv.URL + "/rpc", client: srv.Client()}
+
+	report, err := reconcileResults(local, peer, nil, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{onlyLocal}, report.OnlyLocal)
+	require.Equal(t, []string{onlyRemote, forged}, report.OnlyRemote)
+	require.Equal(t, []string{diverged}, report.Diverged)
+	require.Empty(t, report.Fetched)
+
+	report, err = reconcileResults(local, peer, nil, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{onlyRemote}, report.Fetched)
+	require.Equal(t, []string{onlyLocal}, report.Pushed)
+	require.Len(t, report.Failed, 1)
+	require.Contains(t, report.Failed[forged], "output of operator 2")
+
+	// only the diverged result and the forged one are left
+	report, err = reconcileResults(local, peer, nil, true)
+	require.NoError(t, err)
+	require.Empty(t, report.OnlyLocal)
+	require.Equal(t, []string{forged}, report.OnlyRemote)
+	require.Equal(t, []string{diverged}, report.Diverged)
+
+	// a batch is reconciled on its own
+	report, err = reconcileResults(local, peer, []string{shared, diverged}, true)
+	require.NoError(t, err)
+	require.Empty(t, report.OnlyRemote)
+	require.Equal(t, []string{diverged}, report.Diverged)
+
+	// the diverged result isn't overwritten on the peer
+	_, err = remote.put(diverged, divergedLocal)
+	require.ErrorContains(t, err, "a different result")
+	stored, err := remote.get(diverged)
+	require.NoError(t, err)
+	require.Len(t, stored.Output, 3)
+}
+
+func TestResultDigestIgnoresCollector(t *testing.T) {
+	_, result := testResult(t, dkg.RequestID{1}, 1, 2, 3, 4)
+	digest, err := resultDigest(result)
+	require.NoError(t, err)
+	result.ManifestHash = "abcd"
+	withManifest, err := resultDigest(result)
+	require.NoError(t, err)
+	require.Equal(t, digest, withManifest)
+}
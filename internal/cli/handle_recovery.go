@@ -0,0 +1,248 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/recovery"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+// RecoveryFile is a share recovery request passed between the operators
+// approving it, with the node addresses of the helpers
+type RecoveryFile struct {
+	recovery.Bundle
+	// HelperAddrs aren't part of what is approved
+	HelperAddrs map[types.OperatorID]string `json:"helper_addrs"`
+}
+
+func (h CliHandler) CommandRecoveryRequest() *cli.Command {
+	return &cli.Command{
+		Name:   "recovery-request",
+		Usage:  "create a request to recover a lost operator share from threshold many peers of its committee",
+		Action: h.HandleRecoveryRequest,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "validator-pk",
+				Aliases:  []string{"vk"},
+				Usage:    "validator public key value",
+				Required: true,
+			},
+			&cli.Uint64Flag{
+				Name:     "operator-id",
+				Usage:    "id of the operator that lost its share",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "helper",
+				Usage:    "helper operator key-value pair, at least threshold many operators of the committee",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "file the request is written to, defaults to recovery_<request id>.json",
+			},
+		},
+	}
+}
+
+func (h CliHandler) CommandRecoveryApprove() *cli.Command {
+	return &cli.Command{
+		Name:   "recovery-approve",
+		Usage:  "sign a share recovery request with an operator key",
+		Action: h.HandleRecoveryApprove,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "request",
+				Usage:    "file written by recovery-request, updated in place",
+				Required: true,
+			},
+			&cli.Uint64Flag{
+				Name:     "operator-id",
+				Usage:    "id of the approving operator",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "operator-key",
+				Usage:    "file with the rsa private key of the approving operator",
+				Required: true,
+			},
+		},
+	}
+}
+
+func (h CliHandler) CommandRecoverShare() *cli.Command {
+	return &cli.Command{
+		Name:   "recover-share",
+		Usage:  "run an approved share recovery request with the helpers and the recovering node",
+		Action: h.HandleRecoverShare,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "request",
+				Usage:    "file written by recovery-request and signed with recovery-approve",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "node",
+				Usage:    "address of the node of the recovering operator",
+				Required: true,
+			},
+		},
+	}
+}
+
+func (h *CliHandler) HandleRecoveryRequest(c *cli.Context) error {
+	book, err := loadBookFor(c.StringSlice("helper"))
+	if err != nil {
+		return fmt.Errorf("HandleRecoveryRequest: %w", err)
+	}
+	helperAddrs, err := parseOperatorPairs(c.StringSlice("helper"), book)
+	if err != nil {
+		return fmt.Errorf("HandleRecoveryRequest: %w", err)
+	}
+	helpers := make([]types.OperatorID, 0, len(helperAddrs))
+	for id := range helperAddrs {
+		helpers = append(helpers, id)
+	}
+
+	request, err := recovery.NewRequest(c.String("validator-pk"), types.OperatorID(c.Uint64("operator-id")), helpers)
+	if err != nil {
+		return fmt.Errorf("HandleRecoveryRequest: %w", err)
+	}
+	file := &RecoveryFile{Bundle: recovery.Bundle{Request: request}, HelperAddrs: helperAddrs}
+
+	filepath := c.String("out")
+	if filepath == "" {
+		filepath = fmt.Sprintf("recovery_%s.json", request.ID)
+	}
+	fmt.Printf("recovery request %s for operator %d of validator %s with helpers %v\n", request.ID, request.Operator, request.ValidatorPK, request.Helpers)
+	fmt.Printf("it needs the approval of operator %d and threshold many other committee operators (recovery-approve), it expires in %s\n", request.Operator, recovery.MaxRequestAge)
+	fmt.Printf("writing recovery request to file %s\n", filepath)
+	return utils.WriteJSON(filepath, file)
+}
+
+// HandleRecoveryApprove prints what is being approved, operators are expected
+// to confirm the recovery out of band before signing
+func (h *CliHandler) HandleRecoveryApprove(c *cli.Context) error {
+	path := c.String("request")
+	file, err := readRecoveryFile(path)
+	if err != nil {
+		return fmt.Errorf("HandleRecoveryApprove: %w", err)
+	}
+	sk, err := loadRSAKey(c.String("operator-key"))
+	if err != nil {
+		return fmt.Errorf("HandleRecoveryApprove: operator key: %w", err)
+	}
+	operatorID := types.OperatorID(c.Uint64("operator-id"))
+
+	approval, err := recovery.Approve(sk, operatorID, file.Request)
+	if err != nil {
+		return fmt.Errorf("HandleRecoveryApprove: %w", err)
+	}
+	approvals := []*recovery.Approval{approval}
+	for _, existing := range file.Approvals {
+		if existing.OperatorID != operatorID {
+			approvals = append(approvals, existing)
+		}
+	}
+	sort.Slice(approvals, func(i, j int) bool { return approvals[i].OperatorID < approvals[j].OperatorID })
+	file.Approvals = approvals
+
+	r := file.Request
+	fmt.Printf("approving recovery %s of operator %d's share for validator %s\n", r.ID, r.Operator, r.ValidatorPK)
+	fmt.Printf("helpers: %v\n", r.Helpers)
+	fmt.Printf("approved by operators: %v\n", file.Approvers())
+	return utils.WriteJSON(path, file)
+}
+
+// HandleRecoverShare collects a split from every helper, hands every helper
+// the splits to combine and passes the combined contributions to the
+// recovering node. Only the recovering node can decrypt the contributions.
+func (h *CliHandler) HandleRecoverShare(c *cli.Context) error {
+	file, err := readRecoveryFile(c.String("request"))
+	if err != nil {
+		return fmt.Errorf("HandleRecoverShare: %w", err)
+	}
+	r := file.Request
+	for _, helper := range r.Helpers {
+		if file.HelperAddrs[helper] == "" {
+			return fmt.Errorf("HandleRecoverShare: no node address for helper %d", helper)
+		}
+	}
+
+	splits := make([]*recovery.Split, 0, len(r.Helpers))
+	for _, helper := range r.Helpers {
+		split := &recovery.Split{}
+		if err := h.postNodeJSON(file.HelperAddrs[helper]+"/recovery/split", &file.Bundle, split); err != nil {
+			return fmt.Errorf("HandleRecoverShare: helper %d refused to split its share: %w", helper, err)
+		}
+		splits = append(splits, split)
+		fmt.Printf("helper %d split its share\n", helper)
+	}
+
+	importReq := &node.RecoveryImportRequest{Bundle: &file.Bundle}
+	combineReq := &node.RecoveryCombineRequest{Bundle: &file.Bundle, Splits: splits}
+	for _, helper := range r.Helpers {
+		contribution := &recovery.Contribution{}
+		if err := h.postNodeJSON(file.HelperAddrs[helper]+"/recovery/combine", combineReq, contribution); err != nil {
+			return fmt.Errorf("HandleRecoverShare: helper %d refused to combine the splits: %w", helper, err)
+		}
+		importReq.Contributions = append(importReq.Contributions, contribution)
+		fmt.Printf("helper %d sent its contribution\n", helper)
+	}
+
+	// keep the contributions so the import can be retried, they are encrypted to the recovering operator
+	filepath := fmt.Sprintf("recovery_%s_contributions.json", r.ID)
+	fmt.Printf("writing encrypted contributions to file: %s\n", filepath)
+	if err := utils.WriteJSON(filepath, importReq); err != nil {
+		return fmt.Errorf("HandleRecoverShare: failed to write contributions: %w", err)
+	}
+
+	nodeAddr := c.String("node")
+	if err := h.postNodeJSON(nodeAddr+"/recovery/import", importReq, nil); err != nil {
+		return fmt.Errorf("HandleRecoverShare: node %s failed to recover the share (retry with the contributions in %s): %w", nodeAddr, filepath, err)
+	}
+	fmt.Printf("share of operator %d for validator %s recovered on %s\n", r.Operator, r.ValidatorPK, nodeAddr)
+	return nil
+}
+
+func readRecoveryFile(path string) (*RecoveryFile, error) {
+	byts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recovery request: %w", err)
+	}
+	file := &RecoveryFile{}
+	if err := json.Unmarshal(byts, file); err != nil {
+		return nil, fmt.Errorf("failed to parse recovery request: %w", err)
+	}
+	if file.Request == nil {
+		return nil, fmt.Errorf("%s has no recovery request", path)
+	}
+	return file, nil
+}
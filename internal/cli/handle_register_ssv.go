@@ -0,0 +1,304 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keystore"
+	"github.com/RockX-SG/frost-dkg-demo/internal/reconcile"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandRegisterSSV() *cli.Command {
+	return &cli.Command{
+		Name:    "register-ssv",
+		Aliases: []string{"rssv"},
+		Usage:   "build, sign and optionally send the SSVNetwork registerValidator transaction of a keyshares file",
+		Action:  h.HandleRegisterSSV,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "keyshares",
+				Aliases:  []string{"k"},
+				Usage:    "keyshares file written by get-keyshares or export-result --adapter ssv",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "rpc",
+				Usage:    "execution layer json-rpc url",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "network",
+				Usage: "network of the SSVNetwork contract (mainnet, holesky)",
+				Value: "mainnet",
+			},
+			&cli.StringFlag{
+				Name:  "ssv-contract",
+				Usage: "address of the SSVNetwork contract, overrides the one of --network",
+			},
+			&cli.Uint64Flag{
+				Name:  "from-block",
+				Usage: "block the cluster scan starts from, defaults to the deploy block of the contract",
+			},
+			&cli.Uint64Flag{
+				Name:  "block-range",
+				Usage: "blocks per eth_getLogs request of the cluster scan",
+				Value: reconcile.DefaultBlockRange,
+			},
+			&cli.StringFlag{
+				Name:  "amount",
+				Usage: "SSV tokens in wei deposited to the cluster balance, the contract has to be approved to spend them",
+				Value: "0",
+			},
+			&cli.Uint64Flag{
+				Name:  "nonce",
+				Usage: "transaction nonce of the owner, defaults to its pending nonce",
+			},
+			&cli.Uint64Flag{
+				Name:  "gas-limit",
+				Usage: "gas limit of the transaction, defaults to the estimate plus a margin",
+			},
+			&cli.StringFlag{
+				Name:  "priority-fee",
+				Usage: "max priority fee per gas in wei, defaults to the suggestion of the rpc",
+			},
+			&cli.BoolFlag{
+				Name:  "send",
+				Usage: "broadcast the signed transaction, otherwise it is only written to a file",
+			},
+		}, txSignerFlags()...),
+	}
+}
+
+// SignedRegistration is the signed registerValidator transaction with what
+// it was built from, for review before it is broadcast
+type SignedRegistration struct {
+	Owner                string             `json:"owner"`
+	Contract             string             `json:"contract"`
+	PublicKey            string             `json:"publicKey"`
+	OperatorIDs          []uint64           `json:"operatorIds"`
+	Amount               string             `json:"amount"`
+	Cluster              *reconcile.Cluster `json:"cluster"`
+	OwnerNonce           uint64             `json:"ownerNonce"`
+	ChainID              string             `json:"chainId"`
+	Nonce                uint64             `json:"nonce"`
+	Gas                  uint64             `json:"gas"`
+	MaxFeePerGas         string             `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string             `json:"maxPriorityFeePerGas"`
+	Hash                 string             `json:"hash"`
+	RawTransaction       string             `json:"rawTransaction"`
+}
+
+func (h *CliHandler) HandleRegisterSSV(c *cli.Context) error {
+	byts, err := os.ReadFile(c.String("keyshares"))
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: failed to read keyshares: %w", err)
+	}
+	keyshares := &KeyShares{}
+	if err := json.Unmarshal(byts, keyshares); err != nil {
+		return fmt.Errorf("HandleRegisterSSV: %w", fail(ConditionValidation, fmt.Errorf("invalid keyshares: %w", err)))
+	}
+	registration, err := registrationOf(keyshares)
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: %w", fail(ConditionValidation, err))
+	}
+	if _, ok := registration.Amount.SetString(c.String("amount"), 10); !ok || registration.Amount.Sign() < 0 {
+		return fmt.Errorf("HandleRegisterSSV: %w", fail(ConditionValidation, fmt.Errorf("--amount must be a number of wei")))
+	}
+	opts := reconcile.TxOptions{GasLimit: c.Uint64("gas-limit")}
+	if c.IsSet("nonce") {
+		nonce := c.Uint64("nonce")
+		opts.Nonce = &nonce
+	}
+	if c.IsSet("priority-fee") {
+		tip, ok := new(big.Int).SetString(c.String("priority-fee"), 10)
+		if !ok || tip.Sign() < 0 {
+			return fmt.Errorf("HandleRegisterSSV: %w", fail(ConditionValidation, fmt.Errorf("--priority-fee must be a number of wei")))
+		}
+		opts.PriorityFee = tip
+	}
+
+	contract, ok := reconcile.Contracts[c.String("network")]
+	if !ok && !c.IsSet("ssv-contract") {
+		return fmt.Errorf("HandleRegisterSSV: %w", fail(ConditionValidation, fmt.Errorf("unknown network %s, set --ssv-contract", c.String("network"))))
+	}
+	if c.IsSet("ssv-contract") {
+		contract.Address = c.String("ssv-contract")
+	}
+	if c.IsSet("from-block") {
+		contract.DeployBlock = c.Uint64("from-block")
+	}
+	chain := reconcile.NewChain(c.String("rpc"), contract)
+	chain.BlockRange = c.Uint64("block-range")
+
+	ctx, cancel := context.WithTimeout(c.Context, 10*time.Minute)
+	defer cancel()
+	chainID, err := chain.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: failed to get chain id: %w", fail(ConditionUnreachable, err))
+	}
+	signer, err := h.newTxSigner(ctx, c, chainID)
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: %w", err)
+	}
+	defer signer.Close()
+	owner := signer.Address()
+
+	state, err := chain.OwnerState(ctx, owner, registration.OperatorIDs)
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: failed to get cluster of owner %s: %w", owner.Hex(), fail(ConditionUnreachable, err))
+	}
+	registration.Cluster = state.Cluster
+
+	// the shares are prefixed with the committee signature of owner:nonce,
+	// the contract takes them with any nonce but operators drop the validator
+	if err := verifyOwnerPrefix(registration, owner, state.Nonce); err != nil {
+		return fmt.Errorf("HandleRegisterSSV: %w", fail(ConditionValidation, err))
+	}
+	if state.Cluster.ValidatorCount == 0 && state.Cluster.Balance.Sign() == 0 && registration.Amount.Sign() == 0 {
+		h.logger.Warnf("HandleRegisterSSV: the cluster of operators %v has no balance, the validator needs an --amount to stay active", registration.OperatorIDs)
+	}
+
+	data, err := registration.Data()
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: %w", err)
+	}
+	unsigned, err := chain.PrepareTx(ctx, owner, data, opts)
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: failed to prepare transaction: %w", err)
+	}
+	tx, err := signer.SignTx(ctx, unsigned)
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: failed to sign transaction: %w", err)
+	}
+	if err := checkSignedTx(unsigned, tx, owner); err != nil {
+		return fmt.Errorf("HandleRegisterSSV: %w", fail(ConditionValidation, err))
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: %w", err)
+	}
+
+	signed := SignedRegistration{
+		Owner:                owner.Hex(),
+		Contract:             contract.Address,
+		PublicKey:            "0x" + hex.EncodeToString(registration.PublicKey),
+		OperatorIDs:          registration.OperatorIDs,
+		Amount:               registration.Amount.String(),
+		Cluster:              registration.Cluster,
+		OwnerNonce:           state.Nonce,
+		ChainID:              unsigned.ChainID.String(),
+		Nonce:                tx.Nonce(),
+		Gas:                  tx.Gas(),
+		MaxFeePerGas:         tx.GasFeeCap().String(),
+		MaxPriorityFeePerGas: tx.GasTipCap().String(),
+		Hash:                 tx.Hash().Hex(),
+		RawTransaction:       hexutil.Encode(raw),
+	}
+	fmt.Printf("owner %s registers validator %s with operators %v on %s\n", signed.Owner, signed.PublicKey, signed.OperatorIDs, signed.Contract)
+	fmt.Printf("cluster %d validators, balance %s, owner nonce %d, amount %s\n", state.Cluster.ValidatorCount, state.Cluster.Balance, state.Nonce, signed.Amount)
+	fmt.Printf("transaction nonce %d, gas %d, max fee %s wei, max priority fee %s wei\n", signed.Nonce, signed.Gas, signed.MaxFeePerGas, signed.MaxPriorityFeePerGas)
+
+	filepath := fmt.Sprintf("register_ssv_%s_%d.json", hex.EncodeToString(registration.PublicKey[:4]), time.Now().UTC().Unix())
+	fmt.Printf("writing signed registration to file: %s\n", filepath)
+	if err := utils.WriteJSON(filepath, signed); err != nil {
+		return fmt.Errorf("HandleRegisterSSV: %w", err)
+	}
+	if !c.Bool("send") {
+		return nil
+	}
+
+	hash, err := chain.SendTx(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("HandleRegisterSSV: failed to send transaction: %w", err)
+	}
+	fmt.Printf("sent transaction %s\n", hash.Hex())
+	return nil
+}
+
+// registrationOf decodes the readable payload of the keyshares
+func registrationOf(keyshares *KeyShares) (*reconcile.Registration, error) {
+	payload := keyshares.Payload.Readable
+	publicKey, err := hex.DecodeString(strings.TrimPrefix(payload.PublicKey, "0x"))
+	if err != nil || len(publicKey) != 48 {
+		return nil, fmt.Errorf("keyshares public key must be 48 bytes of hex")
+	}
+	shares, err := hex.DecodeString(strings.TrimPrefix(payload.Shares, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("keyshares shares aren't hex: %w", err)
+	}
+	if len(payload.OperatorIDs) == 0 {
+		return nil, fmt.Errorf("keyshares have no operators")
+	}
+	// signature, then a public key and an encrypted share per operator
+	if len(shares) < 96+48*len(payload.OperatorIDs) {
+		return nil, fmt.Errorf("keyshares shares are too short for %d operators, were they exported with the owner signature?", len(payload.OperatorIDs))
+	}
+
+	registration := &reconcile.Registration{PublicKey: publicKey, Shares: shares, Amount: new(big.Int)}
+	for _, id := range payload.OperatorIDs {
+		registration.OperatorIDs = append(registration.OperatorIDs, uint64(id))
+	}
+	return registration, nil
+}
+
+// verifyOwnerPrefix checks the signature the shares start with is of the
+// owner and nonce, in either of the address encodings get-keyshares takes
+func verifyOwnerPrefix(registration *reconcile.Registration, owner common.Address, nonce uint64) error {
+	signature := hex.EncodeToString(registration.Shares[:96])
+	for _, address := range []string{owner.Hex(), strings.ToLower(owner.Hex())} {
+		root := []byte(fmt.Sprintf("%s:%d", address, nonce))
+		if verifyBLSSignature(registration.PublicKey, root, signature) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("keyshares aren't signed for owner %s with its nonce %d, export them again with --owner-nonce %d", owner.Hex(), nonce, nonce)
+}
+
+// readOwnerKey reads a hex private key, or a plain keystore key file
+func readOwnerKey(filepath string) (*ecdsa.PrivateKey, error) {
+	content, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read owner key: %w", err)
+	}
+	if key, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(string(content)), "0x")); err == nil {
+		return key, nil
+	}
+	stored, err := keystore.ReadKeystoreFromFile(filepath)
+	if err != nil || stored.PrivateKey == nil {
+		return nil, fmt.Errorf("owner key must be a hex private key or a keystore key file")
+	}
+	return stored.PrivateKey, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyshares(t *testing.T, owner string, nonce int) (*KeyShares, *bls.SecretKey) {
+	types.InitBLS()
+	sk := &bls.SecretKey{}
+	sk.SetByCSPRNG()
+	signature := sk.SignByte([]byte(fmt.Sprintf("%s:%d", owner, nonce))).Serialize()
+
+	shares := append([]byte{}, signature...)
+	for i := 0; i < 4; i++ {
+		shares = append(shares, make([]byte, 48+256)...)
+	}
+	return &KeyShares{Payload: KeySharesPayload{Readable: ReadablePayload{
+		PublicKey:   "0x" + hex.EncodeToString(sk.GetPublicKey().Serialize()),
+		OperatorIDs: []uint32{1, 2, 3, 4},
+		Shares:      "0x" + hex.EncodeToString(shares),
+	}}}, sk
+}
+
+func TestRegistrationOf(t *testing.T) {
+	keyshares, _ := testKeyshares(t, "0x0", 0)
+	registration, err := registrationOf(keyshares)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2, 3, 4}, registration.OperatorIDs)
+	require.Len(t, registration.PublicKey, 48)
+
+	// exported without the owner signature
+	keyshares.Payload.Readable.Shares = keyshares.Payload.Readable.Shares[:2+2*(48*4)]
+	_, err = registrationOf(keyshares)
+	require.Error(t, err)
+}
+
+func TestVerifyOwnerPrefix(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+
+	for _, address := range []string{owner.Hex(), strings.ToLower(owner.Hex())} {
+		keyshares, _ := testKeyshares(t, address, 3)
+		registration, err := registrationOf(keyshares)
+		require.NoError(t, err)
+		require.NoError(t, verifyOwnerPrefix(registration, owner, 3))
+
+		err = verifyOwnerPrefix(registration, owner, 4)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "--owner-nonce 4")
+	}
+}
+
+func TestReadOwnerKey(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "owner.key")
+	require.NoError(t, os.WriteFile(path, []byte("0x"+hex.EncodeToString(crypto.FromECDSA(key))+"\n"), 0o600))
+
+	read, err := readOwnerKey(path)
+	require.NoError(t, err)
+	require.Equal(t, crypto.PubkeyToAddress(key.PublicKey), crypto.PubkeyToAddress(read.PublicKey))
+
+	require.NoError(t, os.WriteFile(path, []byte("not a key"), 0o600))
+	_, err = readOwnerKey(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,258 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+// UsageReport is what the shares of a validator signed, merged from the
+// nodes of every committee that held them
+type UsageReport struct {
+	ValidatorPK string `json:"validator_pk"`
+	// Entries are the deposit and keysigns, oldest first
+	Entries []*UsageReportEntry `json:"entries"`
+	// Totals counts the entries by usage
+	Totals map[string]int `json:"totals"`
+	// Unreachable are the operators that held a share and didn't answer
+	Unreachable []types.OperatorID `json:"unreachable,omitempty"`
+}
+
+// UsageReportEntry is a signature of the validator as the nodes that took
+// part in it report it
+type UsageReportEntry struct {
+	storage.UsageEntry
+	// ReportedBy are the operators that have the entry in their storage
+	ReportedBy []types.OperatorID `json:"reported_by"`
+	// States of the ceremony on each operator, missing where it was purged
+	States map[types.OperatorID]ceremony.State `json:"states,omitempty"`
+	// Conflicting is set when the operators don't agree on the usage or
+	// signing root of the request
+	Conflicting bool `json:"conflicting,omitempty"`
+}
+
+func (h CliHandler) CommandReport() *cli.Command {
+	return &cli.Command{
+		Name:   "report",
+		Usage:  "report every deposit, exit and other message the shares of a validator signed, from the nodes of all its committees",
+		Action: h.HandleReport,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "validator-pk",
+				Usage:    "validator public key",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:    "operator",
+				Aliases: []string{"o"},
+				Usage:   "node to ask first, id=endpoint or a bare id from the address book; every operator of the address book when not set",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the report as json",
+			},
+		},
+	}
+}
+
+// HandleReport finds the committees of the validator the way lineage does,
+// then asks every operator that held a share what it signed with it
+func (h *CliHandler) HandleReport(c *cli.Context) error {
+	pk, err := hexenc.ParseValidatorPK(c.String("validator-pk"))
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleReport: invalid validator pk: %w", err))
+	}
+	book, err := addressbook.Load(addressbook.DefaultPath())
+	if err != nil {
+		return err
+	}
+	operators, err := parseOperatorPairs(c.StringSlice("operator"), book)
+	if err != nil {
+		return fail(ConditionValidation, err)
+	}
+	if len(operators) == 0 {
+		for _, entry := range book.List() {
+			operators[entry.OperatorID] = entry.Endpoint
+		}
+	}
+	if len(operators) == 0 {
+		return fail(ConditionValidation, fmt.Errorf("HandleReport: no operator to ask, pass --operator or fill the address book"))
+	}
+
+	validatorPK := hex.EncodeToString(pk)
+	lineage, err := h.collectLineage(validatorPK, operators, book)
+	if err != nil {
+		return err
+	}
+	report, err := h.collectUsage(validatorPK, lineage, operators, book)
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+	fmt.Printf("validator %s\n", report.ValidatorPK)
+	for _, entry := range report.Entries {
+		usage := entry.Usage
+		if entry.DomainTag != "" {
+			usage = fmt.Sprintf("%s %s", entry.Usage, entry.DomainTag)
+		}
+		root := entry.SigningRoot
+		if root == "" {
+			root = "-"
+		}
+		fmt.Printf("%s\t%s\t%s %s\troot %s\treported by %s%s\n", entry.Time.Format(time.RFC3339), usage, entry.Kind, entry.RequestID, root, formatOperatorIDs(entry.ReportedBy), formatUsageStates(entry.States))
+		if entry.Conflicting {
+			fmt.Printf("warning: operators don't agree on what request %s signed, see --json\n", entry.RequestID)
+		}
+	}
+	usages := make([]string, 0, len(report.Totals))
+	for usage := range report.Totals {
+		usages = append(usages, usage)
+	}
+	sort.Strings(usages)
+	totals := make([]string, 0, len(usages))
+	for _, usage := range usages {
+		totals = append(totals, fmt.Sprintf("%s %d", usage, report.Totals[usage]))
+	}
+	fmt.Printf("totals: %s\n", strings.Join(totals, ", "))
+	if lineage.Origin == "" {
+		fmt.Println("warning: no node of the keygen answered, the deposit may be missing")
+	}
+	if len(report.Unreachable) > 0 {
+		fmt.Printf("warning: operators %s held a share and didn't answer, the report may be missing what they signed\n", formatOperatorIDs(report.Unreachable))
+	}
+	return nil
+}
+
+// collectUsage asks every operator of the committees in the lineage for its
+// usage of the validator and merges the entries by request id
+func (h *CliHandler) collectUsage(validatorPK string, lineage *ValidatorLineage, operators map[types.OperatorID]string, book *addressbook.Book) (*UsageReport, error) {
+	holders := make(map[types.OperatorID]bool)
+	for _, entry := range lineage.Entries {
+		for _, operatorID := range append(append([]types.OperatorID{}, entry.Operators...), entry.OldOperators...) {
+			holders[operatorID] = true
+		}
+	}
+	ids := make([]types.OperatorID, 0, len(holders))
+	for operatorID := range holders {
+		ids = append(ids, operatorID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	report := &UsageReport{ValidatorPK: validatorPK, Totals: make(map[string]int)}
+	entries := make(map[string]*UsageReportEntry)
+	answered := 0
+	var lastErr error
+	for _, operatorID := range ids {
+		addr, ok := operators[operatorID]
+		if !ok {
+			entry, err := book.Get(operatorID)
+			if err != nil {
+				report.Unreachable = append(report.Unreachable, operatorID)
+				if lastErr == nil {
+					lastErr = fmt.Errorf("no endpoint for operator %d", operatorID)
+				}
+				continue
+			}
+			addr = entry.Endpoint
+		}
+		usage := &node.ShareUsage{}
+		if err := h.getNodeJSON(fmt.Sprintf("%s/usage/%s", strings.TrimSuffix(addr, "/"), validatorPK), usage); err != nil {
+			h.logger.Warnf("collectUsage: failed to get usage from operator %d: %v", operatorID, err)
+			report.Unreachable = append(report.Unreachable, operatorID)
+			lastErr = err
+			continue
+		}
+		answered++
+		for _, nodeEntry := range usage.Entries {
+			if nodeEntry.UsageEntry == nil {
+				continue
+			}
+			entry, ok := entries[nodeEntry.RequestID]
+			if !ok {
+				entry = &UsageReportEntry{UsageEntry: *nodeEntry.UsageEntry, States: make(map[types.OperatorID]ceremony.State)}
+				entries[nodeEntry.RequestID] = entry
+			} else {
+				if entry.Usage != nodeEntry.Usage || entry.SigningRoot != nodeEntry.SigningRoot {
+					entry.Conflicting = true
+				}
+				// each node records a keysign when it starts there, the earliest is closest to the request
+				if nodeEntry.Time.Before(entry.Time) {
+					entry.Time = nodeEntry.Time
+				}
+			}
+			entry.ReportedBy = append(entry.ReportedBy, operatorID)
+			if nodeEntry.State != ceremony.StateNone {
+				entry.States[operatorID] = nodeEntry.State
+			}
+		}
+	}
+	if answered == 0 {
+		return nil, unreachable(fmt.Errorf("collectUsage: none of the operators answered: %w", lastErr))
+	}
+
+	report.Entries = make([]*UsageReportEntry, 0, len(entries))
+	for _, entry := range entries {
+		report.Entries = append(report.Entries, entry)
+		report.Totals[entry.Usage]++
+	}
+	sort.Slice(report.Entries, func(i, j int) bool {
+		return report.Entries[i].Time.Before(report.Entries[j].Time)
+	})
+	return report, nil
+}
+
+// formatUsageStates groups the operators of an entry by ceremony state
+func formatUsageStates(states map[types.OperatorID]ceremony.State) string {
+	byState := make(map[ceremony.State][]types.OperatorID)
+	for operatorID, state := range states {
+		byState[state] = append(byState[state], operatorID)
+	}
+	names := make([]string, 0, len(byState))
+	for state := range byState {
+		names = append(names, string(state))
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s on %s", name, formatOperatorIDs(byState[ceremony.State(name)])))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "\t" + strings.Join(parts, "; ")
+}
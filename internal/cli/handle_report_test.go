@@ -0,0 +1,95 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func usageServer(t *testing.T, entries ...*node.UsageEntry) string {
+	r := gin.New()
+	r.GET("/usage/:validator_pk", func(c *gin.Context) {
+		c.JSON(http.StatusOK, &node.ShareUsage{ValidatorPK: c.Param("validator_pk"), Entries: entries})
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestCollectUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	start := time.Now().UTC()
+	lineage := &ValidatorLineage{ValidatorPK: "aa", Entries: []*storage.LineageEntry{
+		{RequestID: "a", Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3}, Threshold: 2, CompletedAt: start},
+		{RequestID: "b", Kind: ceremony.KindReshare, Operators: []types.OperatorID{2, 3, 4}, OldOperators: []types.OperatorID{1, 2, 3}, Threshold: 2, CompletedAt: start.Add(time.Hour)},
+	}}
+	deposit := &storage.UsageEntry{RequestID: "a", Kind: ceremony.KindKeygen, Usage: "deposit", SigningRoot: "0x01", Operators: []types.OperatorID{1, 2, 3}, Time: start}
+	exit := &storage.UsageEntry{RequestID: "c", Kind: ceremony.KindKeySign, Usage: "exit", SigningRoot: "0x02", Operators: []types.OperatorID{2, 3, 4}, Time: start.Add(2 * time.Hour)}
+	tampered := *exit
+	tampered.SigningRoot = "0x03"
+
+	book, err := addressbook.Load(filepath.Join(t.TempDir(), "addressbook.json"))
+	require.NoError(t, err)
+	book.SetEndpoint(1, usageServer(t, &node.UsageEntry{UsageEntry: deposit, State: ceremony.StateCompleted}), addressbook.SourceManual)
+	book.SetEndpoint(3, "http://127.0.0.1:1", addressbook.SourceManual)
+
+	// operator 2 comes from --operator, 3 doesn't answer and 4 has no endpoint
+	h := New(logrus.New())
+	operators := map[types.OperatorID]string{2: usageServer(t,
+		&node.UsageEntry{UsageEntry: deposit},
+		&node.UsageEntry{UsageEntry: exit, State: ceremony.StateCompleted},
+	)}
+	report, err := h.collectUsage("aa", lineage, operators, book)
+	require.NoError(t, err)
+	require.Len(t, report.Entries, 2)
+	require.Equal(t, "a", report.Entries[0].RequestID)
+	require.Equal(t, []types.OperatorID{1, 2}, report.Entries[0].ReportedBy)
+	require.Equal(t, map[types.OperatorID]ceremony.State{1: ceremony.StateCompleted}, report.Entries[0].States)
+	require.Equal(t, "c", report.Entries[1].RequestID)
+	require.False(t, report.Entries[1].Conflicting)
+	require.Equal(t, map[string]int{"deposit": 1, "exit": 1}, report.Totals)
+	require.Equal(t, []types.OperatorID{3, 4}, report.Unreachable)
+
+	// operators reporting another signing root for the same request
+	book.SetEndpoint(4, usageServer(t, &node.UsageEntry{UsageEntry: &tampered}), addressbook.SourceManual)
+	report, err = h.collectUsage("aa", lineage, operators, book)
+	require.NoError(t, err)
+	require.True(t, report.Entries[1].Conflicting)
+	require.Equal(t, []types.OperatorID{2, 4}, report.Entries[1].ReportedBy)
+
+	_, err = h.collectUsage("aa", lineage, map[types.OperatorID]string{1: "http://127.0.0.1:1", 2: "http://127.0.0.1:1"}, &addressbook.Book{})
+	require.Equal(t, ExitUnreachable, ExitCode(err))
+}
@@ -24,12 +24,16 @@ package cli
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 
-	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/addressbook"
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/RockX-SG/frost-dkg-demo/internal/topiccache"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/bloxapp/ssv-spec/types/testingutils"
@@ -39,39 +43,184 @@ import (
 func (h *CliHandler) HandleResharing(c *cli.Context) error {
 	resharingRequest := &ResharingRequest{}
 	if err := resharingRequest.parseResharingRequest(c); err != nil {
-		return fmt.Errorf("HandleResharing: failed to parse resharing request: %w", err)
+		return fail(ConditionValidation, fmt.Errorf("HandleResharing: failed to parse resharing request: %w", err))
+	}
+	strict, err := strictLint(c)
+	if err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	if err := reportLint(h.newLinter(c).LintResharing(resharingRequest), strict); err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	if err := h.checkDenylist(c, resharingRequest.Operators); err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+
+	if err := h.loadInitiator(c); err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	events, err := openEventLog(c)
+	if err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	h.events = events
+	defer events.Close()
+
+	requestIDInHex, err := h.startResharing(resharingRequest)
+	if requestIDInHex == "" {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+
+	fmt.Printf("resharing init request sent with ID: %s\n", requestIDInHex)
+	if resharingRequest.Manifest != nil {
+		fmt.Printf("manifest hash: %s\n", resharingRequest.Manifest.Hash)
+	}
+	if err := tolerate(c, err); err != nil {
+		return fmt.Errorf("HandleResharing: %w", err)
+	}
+	return nil
+}
+
+// startResharing creates the topic for a new resharing and sends the reshare
+// message to the old and new operators, it returns the request ID in hex, also
+// when the message reached only some operators
+func (h *CliHandler) startResharing(resharingRequest *ResharingRequest) (string, error) {
+	requestID, err := newRequestID(resharingRequest.RequestID)
+	if err != nil {
+		return "", fail(ConditionValidation, err)
+	}
+	if resharingRequest.RequestID != "" {
+		operators := make(map[types.OperatorID]string)
+		for operatorID, addr := range resharingRequest.OperatorsOld {
+			operators[operatorID] = addr
+		}
+		for operatorID, addr := range resharingRequest.Operators {
+			operators[operatorID] = addr
+		}
+		if err := h.checkRequestIDUnused(hex.EncodeToString(requestID[:]), operators); err != nil {
+			return "", err
+		}
+	}
+
+	signer := h.initiator
+	if signer == nil {
+		signer = testingResharingSigner()
+	}
+	if resharingRequest.Signer != 0 {
+		if err := checkSigner(resharingRequest.Signer, reshareOperators(resharingRequest), resharingRequest.Observers, resharingRequest.EncryptInit, resharingRequest.Options); err != nil {
+			return "", err
+		}
+		signer = delegatedSigner(resharingRequest.Signer)
+	}
+	initMsgBytes, err := resharingRequest.initMsgForResharing(requestID, signer)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate init message for keygen: %w", err)
 	}
 
-	requestID := getRandRequestID()
 	requestIDInHex := hex.EncodeToString(requestID[:])
+	if err := h.deliverResharing(requestIDInHex, resharingRequest, initMsgBytes); err != nil {
+		var failure *Failure
+		if errors.As(err, &failure) && failure.Condition == ConditionPartialDelivery {
+			return requestIDInHex, err
+		}
+		return "", err
+	}
+	return requestIDInHex, nil
+}
 
+// deliverResharing creates the topic for the resharing and sends the signed
+// reshare message to the old and new operators
+func (h *CliHandler) deliverResharing(requestIDInHex string, resharingRequest *ResharingRequest, initMsgBytes []byte) (err error) {
 	operators := resharingRequest.newOperators()
 	operatorsOld := resharingRequest.oldOperators()
 	alloperators := append(operators, operatorsOld...)
+	defer func() {
+		h.events.ceremonyDelivered(requestIDInHex, ceremony.KindReshare, alloperators, err)
+		h.updateTopicCache(func(cache *topiccache.Cache) {
+			if resharingRequest.Manifest != nil {
+				cache.SetManifestHash(requestIDInHex, resharingRequest.Manifest.Hash)
+			}
+			cache.SetDelivery(requestIDInHex, ceremony.KindReshare, alloperators, err)
+		})
+	}()
 
-	messengerClient := messenger.NewMessengerClient(messenger.MessengerAddrFromEnv())
-	if err := messengerClient.CreateTopic(requestIDInHex, alloperators); err != nil {
-		return fmt.Errorf("HandleResharing: failed to createa new topic on messenger service: %w", err)
+	committee := len(resharingRequest.Operators)
+	if len(resharingRequest.OperatorsOld) > committee {
+		committee = len(resharingRequest.OperatorsOld)
 	}
-
-	initMsgBytes, err := resharingRequest.initMsgForResharing(requestID)
+	limits, err := h.negotiateLimits(committee, initMsgBytes, resharingRequest.Operators, resharingRequest.OperatorsOld, resharingRequest.Observers)
 	if err != nil {
-		return fmt.Errorf("HandleResharing: failed to generate init message for keygen: %w", err)
+		return err
+	}
+	requirement := capabilityRequirement{
+		Ceremony:           string(ceremony.KindReshare),
+		Operators:          countParticipants(resharingRequest.Operators, resharingRequest.OperatorsOld, resharingRequest.Observers),
+		Observers:          resharingRequest.Observers,
+		MinProtocolVersion: resharingRequest.MinProtocolVersion,
+		Options:            resharingRequest.Options,
+		Suite:              resharingRequest.Suite,
+	}
+	if err := h.checkCapabilities(requirement, resharingRequest.Operators, resharingRequest.OperatorsOld, resharingRequest.Observers); err != nil {
+		return err
+	}
+
+	messengerClient := h.messengerClient()
+	createTopic := messengerClient.CreateTopic
+	if resharingRequest.Options.Get(ceremony.OptionPriority) == "urgent" {
+		createTopic = messengerClient.CreateUrgentTopic
+	}
+	if err := createTopic(requestIDInHex, withObservers(alloperators, resharingRequest.Observers)); err != nil {
+		return unreachable(fmt.Errorf("failed to createa new topic on messenger service: %w", err))
+	}
+	h.events.emit(&EventRecord{Event: EventTopicCreated, RequestID: requestIDInHex})
+	if err := h.inviteObservers(requestIDInHex, resharingRequest.Observers, initMsgBytes); err != nil {
+		return err
 	}
 
-	for _, operatorID := range alloperators {
-		addr := resharingRequest.nodeAddress(operatorID)
-		if err := h.sendReshareMsg(operatorID, addr, initMsgBytes); err != nil {
+	if resharingRequest.Signer != 0 {
+		signature, err := h.delegateStart(requestIDInHex, resharingRequest.nodeAddress(resharingRequest.Signer), alloperators, resharingRequest.Timeouts, resharingRequest.Approvals, limits, 0, resharingRequest.MinProtocolVersion, resharingRequest.Options, resharingRequest.Manifest, initMsgBytes)
+		if err != nil {
+			return fmt.Errorf("operator %d failed to sign and publish reshare message: %w", resharingRequest.Signer, err)
+		}
+		resharingRequest.VersionClaim, resharingRequest.Manifest = signature.VersionClaim, signature.Manifest
+		h.events.emit(&EventRecord{Event: EventStartRelayed, RequestID: requestIDInHex, Operators: alloperators})
+	} else if resharingRequest.EncryptInit || resharingRequest.Options.Get(ceremony.OptionEncryption) == "on" {
+		if err := h.sealStart(requestIDInHex, alloperators, resharingRequest.Timeouts, resharingRequest.Approvals, limits, 0, resharingRequest.VersionClaim, resharingRequest.Options, resharingRequest.Manifest, initMsgBytes); err != nil {
+			return fmt.Errorf("failed to relay sealed reshare message: %w", err)
+		}
+		h.events.emit(&EventRecord{Event: EventStartRelayed, RequestID: requestIDInHex, Operators: alloperators})
+	} else if resharingRequest.RelayInit {
+		if err := h.relayStart(requestIDInHex, alloperators, resharingRequest.Timeouts, resharingRequest.Approvals, limits, 0, resharingRequest.VersionClaim, resharingRequest.Options, resharingRequest.Manifest, initMsgBytes); err != nil {
+			return fmt.Errorf("failed to relay reshare message: %w", err)
+		}
+		h.events.emit(&EventRecord{Event: EventStartRelayed, RequestID: requestIDInHex, Operators: alloperators})
+	} else {
+		failed := make(map[types.OperatorID]error)
+		for _, operatorID := range alloperators {
+			addr := resharingRequest.nodeAddress(operatorID)
+			if err := h.awaitCapacity(requestIDInHex, operatorID, addr); err != nil {
+				failed[operatorID] = err
+				continue
+			}
+			url := consumeURL(addr, resharingRequest.Timeouts, resharingRequest.Approvals, limits, 0, resharingRequest.VersionClaim, resharingRequest.Options, resharingRequest.Manifest)
+			if err := h.sendReshareMsg(operatorID, url, initMsgBytes); err != nil {
+				failed[operatorID] = err
+				continue
+			}
+			h.events.emit(&EventRecord{Event: EventStartSent, RequestID: requestIDInHex, Operator: operatorID})
+		}
+		if err := deliveryFailure(failed, len(alloperators)); err != nil {
 			return err
 		}
 	}
 
-	fmt.Printf("resharing init request sent with ID: %s\n", requestIDInHex)
+	if err := h.rememberOperators(resharingRequest.Operators, addressbook.SourceCeremony); err != nil {
+		h.logger.Warnf("deliverResharing: failed to update address book: %v", err)
+	}
 	return nil
 }
 
-func (h *CliHandler) sendReshareMsg(operatorID types.OperatorID, addr string, data []byte) error {
-	url := fmt.Sprintf("%s/consume", addr)
+func (h *CliHandler) sendReshareMsg(operatorID types.OperatorID, url string, data []byte) error {
 	resp, err := h.client.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
 		return err
@@ -79,52 +228,82 @@ func (h *CliHandler) sendReshareMsg(operatorID types.OperatorID, addr string, da
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		refusal := &struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}{}
+		if json.NewDecoder(resp.Body).Decode(refusal) == nil && (refusal.Code == "reshare_share_invalid" || refusal.Code == "reshare_rate_limited" || refusal.Code == "validator_busy") {
+			return fmt.Errorf("operator %d refused the resharing: %s", operatorID, refusal.Error)
+		}
 		return fmt.Errorf("failed to send reshare message with code %d to operator %d", resp.StatusCode, operatorID)
 	}
 	return nil
 }
 
 type ResharingRequest struct {
+	// RequestID supplied by the caller, see newRequestID, random when empty
+	RequestID    string                      `json:"request_id,omitempty"`
 	Operators    map[types.OperatorID]string `json:"operators"`
 	Threshold    int                         `json:"threshold"`
 	ValidatorPK  string                      `json:"validator_pk"`
 	OperatorsOld map[types.OperatorID]string `json:"operators_old"`
+	Timeouts     ceremony.PhaseTimeouts      `json:"timeouts"`
+	Approvals    []*coordinator.Approval     `json:"approvals,omitempty"`
+	// EncryptInit relays the reshare message through the messenger encrypted to each operator
+	EncryptInit bool `json:"encrypt_init,omitempty"`
+	// RelayInit publishes the reshare message to the topic for the messenger to deliver
+	RelayInit bool `json:"relay_init,omitempty"`
+	// Signer, when set, is the operator whose node signs and publishes the
+	// reshare message with its operator key instead of the cli
+	Signer types.OperatorID `json:"signer,omitempty"`
+	// Observers verify the transcript and attest to the result without holding a share
+	Observers map[types.OperatorID]string `json:"observers,omitempty"`
+	// MinProtocolVersion, when set, is claimed with the reshare message and
+	// nodes refuse to run the resharing at an older version
+	MinProtocolVersion uint32                 `json:"min_protocol_version,omitempty"`
+	VersionClaim       *ceremony.VersionClaim `json:"version_claim,omitempty"`
+	// Options of the resharing the nodes honor, encryption=on relays the
+	// reshare message sealed like EncryptInit
+	Options ceremony.Options `json:"options,omitempty"`
+	// ManifestHash, when set, is the hash the manifest of the resharing must have
+	ManifestHash string                   `json:"manifest_hash,omitempty"`
+	Manifest     *ceremony.SignedManifest `json:"manifest,omitempty"`
+	// Suite is the crypto suite of the resharing, empty for the default one
+	Suite string `json:"suite,omitempty"`
 }
 
 func (request *ResharingRequest) parseResharingRequest(c *cli.Context) error {
-	request.Operators = make(map[types.OperatorID]string)
-	request.OperatorsOld = make(map[types.OperatorID]string)
+	if err := applyCeremonyConfig(c, "operator", "old-operator", "threshold", "validator-pk"); err != nil {
+		return err
+	}
 	request.Threshold = c.Int("threshold")
 	request.ValidatorPK = c.String("validator-pk")
-
-	operatorkv := c.StringSlice("operator")
-	for _, op := range operatorkv {
-		op = strings.Trim(op, " ")
-		pair := strings.Split(op, "=")
-		if len(pair) != 2 {
-			return fmt.Errorf("operator %s is not in the form of key=value", op)
-		}
-		opID, err := strconv.Atoi(pair[0])
-		if err != nil {
-			return err
-		}
-		request.Operators[types.OperatorID(opID)] = pair[1]
+	request.Timeouts = parsePhaseTimeouts(c)
+	request.EncryptInit = c.Bool("encrypt-init")
+	request.RelayInit = c.Bool("relay-init")
+	request.Signer = types.OperatorID(c.Uint64("signer"))
+	request.MinProtocolVersion = uint32(c.Uint("min-protocol-version"))
+	request.ManifestHash = c.String("manifest-hash")
+	request.Suite = c.String("crypto-suite")
+	request.RequestID = c.String("request-id")
+	options, err := parseCeremonyOptions(c)
+	if err != nil {
+		return err
 	}
+	request.Options = options
 
-	oldoperatorkv := c.StringSlice("old-operator")
-	for _, op := range oldoperatorkv {
-		op = strings.Trim(op, " ")
-		pair := strings.Split(op, "=")
-		if len(pair) != 2 {
-			return fmt.Errorf("operator %s is not in the form of key=value", op)
-		}
-		opID, err := strconv.Atoi(pair[0])
-		if err != nil {
-			return err
-		}
-		request.OperatorsOld[types.OperatorID(opID)] = pair[1]
+	book, err := loadBookFor(c.StringSlice("operator"), c.StringSlice("old-operator"))
+	if err != nil {
+		return err
 	}
-	return nil
+	if request.Operators, err = parseOperatorPairs(c.StringSlice("operator"), book); err != nil {
+		return err
+	}
+	if request.OperatorsOld, err = parseOperatorPairs(c.StringSlice("old-operator"), book); err != nil {
+		return err
+	}
+	request.Observers, err = parseObservers(c, request.Operators, request.OperatorsOld)
+	return err
 }
 
 func (request *ResharingRequest) nodeAddress(operatorID types.OperatorID) string {
@@ -153,8 +332,8 @@ func (request *ResharingRequest) oldOperators() []types.OperatorID {
 	return operatorsOld
 }
 
-func (request *ResharingRequest) initMsgForResharing(requestID dkg.RequestID) ([]byte, error) {
-	vk, err := hex.DecodeString(request.ValidatorPK)
+func (request *ResharingRequest) initMsgForResharing(requestID dkg.RequestID, signer *initSigner) ([]byte, error) {
+	vk, err := hexenc.ParseValidatorPK(request.ValidatorPK)
 	if err != nil {
 		return nil, err
 	}
@@ -167,18 +346,26 @@ func (request *ResharingRequest) initMsgForResharing(requestID dkg.RequestID) ([
 	)
 	reshareBytes, _ := reshare.Encode()
 
-	// TODO: TBD who signs this init msg
-	ks := testingutils.TestingResharingKeySet()
-	reshareMsg := testingutils.SignDKGMsg(ks.DKGOperators[1].EncryptionKey, 1, &dkg.Message{
+	if request.VersionClaim, err = signer.claimVersion(requestID, request.MinProtocolVersion); err != nil {
+		return nil, err
+	}
+	manifest := &ceremony.Manifest{
+		Version:            ceremony.ManifestVersion,
+		Kind:               ceremony.KindReshare,
+		Operators:          reshare.OperatorIDs,
+		OldOperators:       reshare.OldOperatorIDs,
+		Threshold:          uint64(reshare.Threshold),
+		ValidatorPK:        hex.EncodeToString(reshare.ValidatorPK),
+		MinProtocolVersion: request.MinProtocolVersion,
+		Options:            request.Options,
+		Suite:              request.Suite,
+	}
+	if request.Manifest, err = signer.signManifest(requestID, manifest, request.ManifestHash); err != nil {
+		return nil, err
+	}
+	return signer.sign(&dkg.Message{
 		MsgType:    dkg.ReshareMsgType,
 		Identifier: requestID,
 		Data:       reshareBytes,
 	})
-	byts, _ := reshareMsg.Encode()
-
-	msg := &types.SSVMessage{
-		MsgType: types.DKGMsgType,
-		Data:    byts,
-	}
-	return msg.Encode()
 }
@@ -0,0 +1,63 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendReshareMsgRefused(t *testing.T) {
+	r := gin.New()
+	r.POST("/refused", func(c *gin.Context) {
+		c.JSON(http.StatusConflict, gin.H{
+			"message": "resharing refused, no valid share of the old committee",
+			"error":   "operator 2 holds no share of validator aa",
+			"code":    "reshare_share_invalid",
+		})
+	})
+	r.POST("/too-soon", func(c *gin.Context) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"message": "validator was reshared too recently",
+			"error":   "validator aa was reshared by request bb",
+			"code":    "reshare_rate_limited",
+		})
+	})
+	r.POST("/failed", func(c *gin.Context) {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "dkg node failed to process message"})
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	h := New(logrus.New())
+	err := h.sendReshareMsg(2, srv.URL+"/refused", []byte("{}"))
+	require.EqualError(t, err, "operator 2 refused the resharing: operator 2 holds no share of validator aa")
+	err = h.sendReshareMsg(2, srv.URL+"/too-soon", []byte("{}"))
+	require.EqualError(t, err, "operator 2 refused the resharing: validator aa was reshared by request bb")
+	err = h.sendReshareMsg(2, srv.URL+"/failed", []byte("{}"))
+	require.EqualError(t, err, "failed to send reshare message with code 500 to operator 2")
+}
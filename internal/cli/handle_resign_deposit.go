@@ -0,0 +1,218 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandResignDeposit() *cli.Command {
+	return &cli.Command{
+		Name:   "resign-deposit",
+		Usage:  "threshold sign the deposit of a validator again for another withdrawal address, before it is deposited",
+		Action: h.HandleResignDeposit,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "request-id",
+				Aliases:  []string{"req"},
+				Usage:    "request id of the keygen/resharing that created the validator",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "operator",
+				Aliases:  []string{"o"},
+				Usage:    "operator key-value pair",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "withdrawal-address",
+				Aliases:  []string{"wa"},
+				Usage:    "execution address of the new 0x01 withdrawal credentials",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "fork-version",
+				Aliases:  []string{"f"},
+				Usage:    "fork version",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "deposit data file to replace, the replaced file is kept as its next version; default deposit-data_<request id>.json",
+			},
+			encryptToFlag(),
+		}, initiatorKeyFlags()...),
+	}
+}
+
+// HandleResignDeposit has the committee sign the deposit message for new
+// withdrawal credentials and replaces the deposit data file, earlier versions
+// stay next to it. Once the validator is deposited its credentials only change
+// on the beacon chain, with a bls to execution change of 0x00 credentials.
+func (h *CliHandler) HandleResignDeposit(c *cli.Context) error {
+	if err := h.loadInitiator(c); err != nil {
+		return fmt.Errorf("HandleResignDeposit: %w", err)
+	}
+	keygenRequestID, err := lookupRequestID(c)
+	if err != nil {
+		return err
+	}
+	recipients, err := parseRecipients(c)
+	if err != nil {
+		return fmt.Errorf("HandleResignDeposit: %w", err)
+	}
+	decoded, err := hexenc.ParseAddress(c.String("withdrawal-address"))
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleResignDeposit: withdrawal address must be 20 bytes of hex"))
+	}
+	address := hexenc.Key(decoded)
+	network := c.String("fork-version")
+	if types.NetworkFromString(network) == "" {
+		return fail(ConditionValidation, fmt.Errorf("HandleResignDeposit: unsupported network %s", network))
+	}
+
+	keygenOutput, err := h.completedDKGResult(keygenRequestID)
+	if err != nil {
+		return fmt.Errorf("HandleResignDeposit: failed to get dkg result for requestID %s: %w", keygenRequestID, err)
+	}
+	vk, err := keygenOutput.GetValidatorPK()
+	if err != nil {
+		return fmt.Errorf("HandleResignDeposit: failed to get ValidatorPK from keygen results: %w", err)
+	}
+
+	out := c.String("out")
+	if out == "" {
+		out = artifactPath(fmt.Sprintf("deposit-data_%s.json", keygenRequestID), recipients)
+	}
+	if err := checkDepositFile(out, hex.EncodeToString(vk)); err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleResignDeposit: %w", err))
+	}
+
+	withdrawalCredentials := executionWithdrawalCredentials(address)
+	keySign, err := depositKeySign(vk, withdrawalCredentials, network)
+	if err != nil {
+		return fmt.Errorf("HandleResignDeposit: %w", err)
+	}
+	signatureRequestID, err := h.GenerateDeclaredSignature(c, keySign)
+	if err != nil {
+		return fmt.Errorf("HandleResignDeposit: failed to send deposit signing root for signature: %w", err)
+	}
+	signature, err := h.keysignSignature(keygenOutput, hex.EncodeToString(signatureRequestID[:]), keySign.SigningRoot)
+	if err != nil {
+		return fmt.Errorf("HandleResignDeposit: failed to sign deposit: %w", err)
+	}
+
+	depositData, err := newDepositData(hex.EncodeToString(vk), withdrawalCredentials, network, signature)
+	if err != nil {
+		return fmt.Errorf("HandleResignDeposit: %w", err)
+	}
+	if err := depositData.Verify(); err != nil {
+		return fmt.Errorf("HandleResignDeposit: %w", err)
+	}
+
+	replaced, err := keepVersion(out)
+	if err != nil {
+		return fmt.Errorf("HandleResignDeposit: %w", err)
+	}
+	if replaced != "" {
+		fmt.Printf("kept the replaced deposit data as %s\n", replaced)
+	}
+	fmt.Printf("writing deposit data for withdrawal address 0x%s to file %s\n", address, out)
+	return writeArtifact(out, []DepositDataJson{*depositData}, recipients)
+}
+
+// depositKeySign declares the deposit message of a full deposit for the
+// withdrawal credentials on the network
+func depositKeySign(validatorPK []byte, withdrawalCredentialsHex, network string) (*signing.KeySign, error) {
+	fork := types.NetworkFromString(network).ForkVersion()
+	message := &signing.EthMessage{
+		ForkVersion:           hex.EncodeToString(fork[:]),
+		WithdrawalCredentials: withdrawalCredentialsHex,
+		Amount:                types.MaxEffectiveBalanceInGwei,
+	}
+	root, err := message.SigningRoot(signing.UsageDeposit, validatorPK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute deposit signing root: %w", err)
+	}
+	return &signing.KeySign{ValidatorPK: validatorPK, SigningRoot: root[:], Usage: signing.UsageDeposit, Message: message}, nil
+}
+
+// checkDepositFile refuses to replace a plaintext deposit data file of
+// another validator, encrypted files can't be checked
+func checkDepositFile(path, validatorPKHex string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var deposits []DepositDataJson
+	if err := json.Unmarshal(data, &deposits); err != nil {
+		return nil
+	}
+	for _, deposit := range deposits {
+		if !strings.EqualFold(strings.TrimPrefix(deposit.PubKey, "0x"), validatorPKHex) {
+			return fmt.Errorf("%s holds the deposit of validator %s, not of %s", path, deposit.PubKey, validatorPKHex)
+		}
+	}
+	return nil
+}
+
+// keepVersion moves the file at path to its next free version, e.g.
+// deposit-data_x.v2.json, and returns where it went; nothing when there is no
+// file yet
+func keepVersion(path string) (string, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	for version := 1; ; version++ {
+		versioned := versionedPath(path, version)
+		if _, err := os.Stat(versioned); errors.Is(err, os.ErrNotExist) {
+			return versioned, os.Rename(path, versioned)
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// versionedPath puts the version in front of the extensions of the file name
+func versionedPath(path string, version int) string {
+	dir, name := filepath.Split(path)
+	suffix := ""
+	if i := strings.Index(name, "."); i > 0 {
+		name, suffix = name[:i], name[i:]
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s.v%d%s", name, version, suffix))
+}
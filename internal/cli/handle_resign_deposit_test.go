@@ -0,0 +1,90 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDepositKeySign(t *testing.T) {
+	types.InitBLS()
+	sk := &bls.SecretKey{}
+	sk.SetByCSPRNG()
+	pk := sk.GetPublicKey().Serialize()
+	credentials := executionWithdrawalCredentials("1d2f14d2dffee594b4093d42e4bc1b0ea55e8aa7")
+
+	keySign, err := depositKeySign(pk, credentials, "prater")
+	require.NoError(t, err)
+	usage, err := keySign.VerifyUsage()
+	require.NoError(t, err)
+	require.Equal(t, signing.UsageDeposit, usage)
+
+	// the committee's signature of the declared root is a valid deposit
+	signature := hex.EncodeToString(sk.SignByte(keySign.SigningRoot).Serialize())
+	deposit, err := newDepositData(hex.EncodeToString(pk), credentials, "prater", signature)
+	require.NoError(t, err)
+	require.NoError(t, deposit.Verify())
+	require.Equal(t, credentials, deposit.WithdrawalCredentials)
+}
+
+func TestKeepVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "deposit-data_abcd.json")
+	require.Equal(t, filepath.Join(dir, "deposit-data_abcd.v2.json"), versionedPath(path, 2))
+	require.Equal(t, filepath.Join(dir, "deposit-data_abcd.v1.json.age"), versionedPath(path+".age", 1))
+
+	replaced, err := keepVersion(path)
+	require.NoError(t, err)
+	require.Empty(t, replaced, "nothing to keep yet")
+
+	for _, content := range []string{"first", "second"} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		_, err := keepVersion(path)
+		require.NoError(t, err)
+	}
+	first, err := os.ReadFile(filepath.Join(dir, "deposit-data_abcd.v1.json"))
+	require.NoError(t, err)
+	require.Equal(t, "first", string(first))
+	second, err := os.ReadFile(filepath.Join(dir, "deposit-data_abcd.v2.json"))
+	require.NoError(t, err)
+	require.Equal(t, "second", string(second))
+	require.NoFileExists(t, path)
+}
+
+func TestCheckDepositFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deposit-data.json")
+	require.NoError(t, checkDepositFile(path, "aa"), "a new file")
+	require.NoError(t, utils.WriteJSON(path, []DepositDataJson{{PubKey: "aa"}}))
+	require.NoError(t, checkDepositFile(path, "aa"))
+	require.Error(t, checkDepositFile(path, "bb"), "the deposit of another validator")
+	require.NoError(t, os.WriteFile(path, []byte("age-encryption.org/v1"), 0600))
+	require.NoError(t, checkDepositFile(path, "bb"), "encrypted files aren't checked")
+}
@@ -0,0 +1,351 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/middleware"
+	"github.com/RockX-SG/frost-dkg-demo/internal/ping"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/urfave/cli/v2"
+)
+
+// CeremonyInfo is what the serve mode remembers about a ceremony it started
+type CeremonyInfo struct {
+	RequestID string                      `json:"request_id"`
+	Kind      ceremony.Kind               `json:"kind"`
+	Operators map[types.OperatorID]string `json:"operators"`
+	StartedAt int64                       `json:"started_at"`
+	Cancelled bool                        `json:"cancelled"`
+}
+
+// CeremonyStatus is a ceremony together with its state on every operator node
+type CeremonyStatus struct {
+	*CeremonyInfo
+	Nodes map[types.OperatorID]*NodeCeremonyState `json:"nodes"`
+}
+
+type NodeCeremonyState struct {
+	State ceremony.State `json:"state,omitempty"`
+	Error string         `json:"error,omitempty"`
+}
+
+type ceremonyRegistry struct {
+	mu         sync.Mutex
+	ceremonies map[string]*CeremonyInfo
+}
+
+func newCeremonyRegistry() *ceremonyRegistry {
+	return &ceremonyRegistry{ceremonies: make(map[string]*CeremonyInfo)}
+}
+
+func (r *ceremonyRegistry) add(info *CeremonyInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ceremonies[info.RequestID] = info
+}
+
+func (r *ceremonyRegistry) get(requestID string) (*CeremonyInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.ceremonies[requestID]
+	if !ok {
+		return nil, false
+	}
+	copied := *info
+	return &copied, true
+}
+
+func (r *ceremonyRegistry) cancel(requestID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info, ok := r.ceremonies[requestID]; ok {
+		info.Cancelled = true
+	}
+}
+
+func (r *ceremonyRegistry) list() []*CeremonyInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]*CeremonyInfo, 0, len(r.ceremonies))
+	for _, info := range r.ceremonies {
+		copied := *info
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt < list[j].StartedAt })
+	return list
+}
+
+type ceremonyParams struct {
+	RequestID string `json:"request_id"`
+}
+
+func (h *CliHandler) HandleServe(c *cli.Context) error {
+	if err := h.loadInitiator(c); err != nil {
+		return fmt.Errorf("HandleServe: %w", err)
+	}
+	events, err := openEventLog(c)
+	if err != nil {
+		return fmt.Errorf("HandleServe: %w", err)
+	}
+	h.events = events
+	defer events.Close()
+	if dir := c.String("results-dir"); dir != "" {
+		h.results = &resultStore{dir: dir, keys: cachedKeys(registryKeys)}
+	}
+	if addr := c.String("batch-webhook"); addr != "" {
+		webhook := &messengerclient.Webhook{URL: addr}
+		if err := webhook.Validate(); err != nil {
+			return fail(ConditionValidation, fmt.Errorf("HandleServe: invalid --batch-webhook: %w", err))
+		}
+		h.batches.webhook = &batchWebhook{url: addr, secret: c.String("batch-webhook-secret"), client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	h.batches.timeout = c.Duration("batch-timeout")
+
+	config, err := middleware.ConfigFromEnv("CLI_SERVE", []string{"/ping", "/metrics"})
+	if err != nil {
+		return fmt.Errorf("HandleServe: %w", err)
+	}
+	// serve starts ceremonies with the initiator key, only this host may reach it without auth
+	if config.Auth == middleware.AuthNone && !middleware.IsLocal(c.String("addr")) {
+		return fail(ConditionValidation, fmt.Errorf("HandleServe: --addr %s is reachable from other hosts, set CLI_SERVE_AUTH or listen on a loopback address", c.String("addr")))
+	}
+	stack, err := middleware.NewStack("cli", config, h.logger)
+	if err != nil {
+		return fmt.Errorf("HandleServe: %w", err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(stack.Collectors()...)
+
+	r := stack.Engine()
+	r.GET("/ping", ping.HandlePing)
+	r.GET("/metrics", gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+	r.POST("/rpc", h.HandleJSONRPC())
+
+	h.logger.Infof("HandleServe: serving json-rpc on %s/rpc", c.String("addr"))
+	h.events.emit(&EventRecord{Event: EventServeStarted, Details: c.String("addr")})
+	return stack.Run(r, c.String("addr"))
+}
+
+func (h *CliHandler) HandleJSONRPC() func(*gin.Context) {
+	dispatcher := &rpcDispatcher{methods: map[string]rpcMethod{
+		"startKeygen":    h.rpcStartKeygen,
+		"startReshare":   h.rpcStartReshare,
+		"getCeremony":    h.rpcGetCeremony,
+		"listCeremonies": h.rpcListCeremonies,
+		"cancelCeremony": h.rpcCancelCeremony,
+		"startBatch":     h.rpcStartBatch,
+		"getBatch":       h.rpcGetBatch,
+	}}
+	if h.results != nil {
+		dispatcher.methods["resultManifest"] = h.rpcResultManifest
+		dispatcher.methods["getResult"] = h.rpcGetResult
+		dispatcher.methods["submitResult"] = h.rpcSubmitResult
+	}
+
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to load data from request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		resp := dispatcher.Serve(body)
+		if resp == nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.Data(http.StatusOK, "application/json", resp)
+	}
+}
+
+func (h *CliHandler) rpcStartKeygen(params json.RawMessage) (interface{}, error) {
+	request := &KeygenRequest{}
+	if err := decodeParams(params, request); err != nil {
+		return nil, err
+	}
+	if err := validateKeygenRequest(request); err != nil {
+		return nil, err
+	}
+
+	requestID, err := h.startKeygen(request)
+	if err != nil {
+		return nil, err
+	}
+	h.ceremonies.add(&CeremonyInfo{
+		RequestID: requestID,
+		Kind:      ceremony.KindKeygen,
+		Operators: request.Operators,
+		StartedAt: time.Now().Unix(),
+	})
+	return &ceremonyParams{RequestID: requestID}, nil
+}
+
+func (h *CliHandler) rpcStartReshare(params json.RawMessage) (interface{}, error) {
+	request := &ResharingRequest{}
+	if err := decodeParams(params, request); err != nil {
+		return nil, err
+	}
+	if err := validateResharingRequest(request); err != nil {
+		return nil, err
+	}
+
+	requestID, err := h.startResharing(request)
+	if err != nil {
+		return nil, err
+	}
+	h.ceremonies.add(&CeremonyInfo{
+		RequestID: requestID,
+		Kind:      ceremony.KindReshare,
+		Operators: reshareOperators(request),
+		StartedAt: time.Now().Unix(),
+	})
+	return &ceremonyParams{RequestID: requestID}, nil
+}
+
+func validateKeygenRequest(request *KeygenRequest) *RPCError {
+	if len(request.Operators) == 0 || request.Threshold <= 0 {
+		return &RPCError{Code: RPCInvalidParams, Message: "operators and threshold are required"}
+	}
+	if err := request.Options.Validate(ceremony.SupportedOptions); err != nil {
+		return &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func validateResharingRequest(request *ResharingRequest) *RPCError {
+	if len(request.Operators) == 0 || len(request.OperatorsOld) == 0 || request.Threshold <= 0 || request.ValidatorPK == "" {
+		return &RPCError{Code: RPCInvalidParams, Message: "operators, operators_old, threshold and validator_pk are required"}
+	}
+	if err := request.Options.Validate(ceremony.SupportedOptions); err != nil {
+		return &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// reshareOperators are the operators of the old and the new committee
+func reshareOperators(request *ResharingRequest) map[types.OperatorID]string {
+	operators := make(map[types.OperatorID]string)
+	for operatorID, addr := range request.OperatorsOld {
+		operators[operatorID] = addr
+	}
+	for operatorID, addr := range request.Operators {
+		operators[operatorID] = addr
+	}
+	return operators
+}
+
+func (h *CliHandler) rpcGetCeremony(params json.RawMessage) (interface{}, error) {
+	info, err := h.ceremonyFromParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &CeremonyStatus{CeremonyInfo: info, Nodes: make(map[types.OperatorID]*NodeCeremonyState)}
+	for operatorID, addr := range info.Operators {
+		cer := &ceremony.Ceremony{}
+		if err := h.getNodeJSON(fmt.Sprintf("%s/ceremonies/%s", addr, info.RequestID), cer); err != nil {
+			status.Nodes[operatorID] = &NodeCeremonyState{Error: err.Error()}
+		} else {
+			status.Nodes[operatorID] = &NodeCeremonyState{State: cer.State}
+		}
+		h.events.nodeState(info.RequestID, operatorID, status.Nodes[operatorID])
+	}
+	return status, nil
+}
+
+func (h *CliHandler) rpcListCeremonies(json.RawMessage) (interface{}, error) {
+	return h.ceremonies.list(), nil
+}
+
+// rpcCancelCeremony deletes the topic so no more messages are routed for the
+// ceremony and marks it aborted on every node
+func (h *CliHandler) rpcCancelCeremony(params json.RawMessage) (interface{}, error) {
+	info, err := h.ceremonyFromParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+	if err := h.messengerClient().DeleteTopic(ctx, info.RequestID); err != nil {
+		return nil, fmt.Errorf("failed to delete topic %s: %w", info.RequestID, err)
+	}
+
+	status := &CeremonyStatus{CeremonyInfo: info, Nodes: make(map[types.OperatorID]*NodeCeremonyState)}
+	for operatorID, addr := range info.Operators {
+		cer := &ceremony.Ceremony{}
+		if err := h.postNodeJSON(fmt.Sprintf("%s/ceremonies/%s/abort", addr, info.RequestID), nil, cer); err != nil {
+			status.Nodes[operatorID] = &NodeCeremonyState{Error: err.Error()}
+		} else {
+			status.Nodes[operatorID] = &NodeCeremonyState{State: cer.State}
+		}
+		h.events.nodeState(info.RequestID, operatorID, status.Nodes[operatorID])
+	}
+
+	h.ceremonies.cancel(info.RequestID)
+	h.events.emit(&EventRecord{Event: EventCeremonyCancelled, RequestID: info.RequestID, Kind: info.Kind})
+	status.Cancelled = true
+	return status, nil
+}
+
+func (h *CliHandler) ceremonyFromParams(params json.RawMessage) (*CeremonyInfo, error) {
+	p := &ceremonyParams{}
+	if err := decodeParams(params, p); err != nil {
+		return nil, err
+	}
+	info, ok := h.ceremonies.get(p.RequestID)
+	if !ok {
+		return nil, &RPCError{Code: RPCCeremonyNotFound, Message: "ceremony not found", Data: p.RequestID}
+	}
+	return info, nil
+}
+
+func (h *CliHandler) getNodeJSON(url string, out any) error {
+	resp, err := h.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed with status %s: %s", resp.Status, string(respBody))
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -0,0 +1,142 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// SignedMessageJson is the committee signature of an application message root
+type SignedMessageJson struct {
+	ValidatorPK string `json:"validator_pk"`
+	DomainTag   string `json:"domain_tag"`
+	Domain      string `json:"domain"`
+	MessageRoot string `json:"message_root"`
+	SigningRoot string `json:"signing_root"`
+	Signature   string `json:"signature"`
+}
+
+func (h CliHandler) CommandSignMessage() *cli.Command {
+	return &cli.Command{
+		Name:    "sign-message",
+		Aliases: []string{"sm"},
+		Usage:   "threshold sign an application message root under a custom signing domain",
+		Action:  h.HandleSignMessage,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "request-id",
+				Aliases:  []string{"req"},
+				Usage:    "request id of the keygen/resharing that created the validator",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:     "operator",
+				Aliases:  []string{"o"},
+				Usage:    "operator key-value pair",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "domain",
+				Aliases:  []string{"d"},
+				Usage:    "domain tag of the application, e.g. acme-bridge/v1",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "message-root",
+				Aliases:  []string{"mr"},
+				Usage:    "32 bytes hex root of the application message",
+				Required: true,
+			},
+		}, initiatorKeyFlags()...),
+	}
+}
+
+func (h *CliHandler) HandleSignMessage(c *cli.Context) error {
+	if err := h.loadInitiator(c); err != nil {
+		return fmt.Errorf("HandleSignMessage: %w", err)
+	}
+	keygenRequestID, err := lookupRequestID(c)
+	if err != nil {
+		return err
+	}
+
+	messageRoot, err := parseRoot(c.String("message-root"))
+	if err != nil {
+		return fmt.Errorf("HandleSignMessage: %w", err)
+	}
+	domain, err := signing.Domain(c.String("domain"))
+	if err != nil {
+		return fmt.Errorf("HandleSignMessage: %w", err)
+	}
+
+	keygenOutput, err := h.completedDKGResult(keygenRequestID)
+	if err != nil {
+		return fmt.Errorf("HandleSignMessage: failed to get dkg result for requestID %s: %w", keygenRequestID, err)
+	}
+	vk, err := keygenOutput.GetValidatorPK()
+	if err != nil {
+		return fmt.Errorf("HandleSignMessage: failed to get ValidatorPK from keygen results: %w", err)
+	}
+
+	keySign, err := signing.NewKeySign(vk, c.String("domain"), messageRoot)
+	if err != nil {
+		return fmt.Errorf("HandleSignMessage: %w", err)
+	}
+	signatureRequestID, err := h.GenerateDeclaredSignature(c, keySign)
+	if err != nil {
+		return fmt.Errorf("HandleSignMessage: failed to send signing root for signature: %w", err)
+	}
+	signature, err := h.keysignSignature(keygenOutput, hex.EncodeToString(signatureRequestID[:]), keySign.SigningRoot)
+	if err != nil {
+		return fmt.Errorf("HandleSignMessage: failed to sign message: %w", err)
+	}
+
+	signed := SignedMessageJson{
+		ValidatorPK: "0x" + hex.EncodeToString(vk),
+		DomainTag:   keySign.DomainTag,
+		Domain:      "0x" + hex.EncodeToString(domain[:]),
+		MessageRoot: "0x" + hex.EncodeToString(keySign.MessageRoot),
+		SigningRoot: "0x" + hex.EncodeToString(keySign.SigningRoot),
+		Signature:   "0x" + signature,
+	}
+
+	filepath := fmt.Sprintf("signed_message_%d.json", time.Now().UTC().Unix())
+	fmt.Printf("writing signed message to file %s\n", filepath)
+	return utils.WriteJSON(filepath, signed)
+}
+
+func parseRoot(s string) ([32]byte, error) {
+	root := [32]byte{}
+	byts, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(byts) != len(root) {
+		return root, fmt.Errorf("message root must be 32 bytes of hex")
+	}
+	copy(root[:], byts)
+	return root, nil
+}
@@ -0,0 +1,514 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/topiccache"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandStatus() *cli.Command {
+	return &cli.Command{
+		Name:   "status",
+		Usage:  "show the state of a ceremony's topic, from the local cache when the messenger is unreachable",
+		Action: h.HandleStatus,
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:  "wait",
+				Usage: "poll the messenger until the ceremony has a result, printing the stage of each operator as it changes, and fail when it has none after this long",
+			},
+			&cli.StringFlag{
+				Name:     "request-id",
+				Aliases:  []string{"req"},
+				Usage:    "request id of the ceremony",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "only read the local cache, don't ask the messenger",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the status as json",
+			},
+		},
+	}
+}
+
+func (h CliHandler) CommandHistory() *cli.Command {
+	return &cli.Command{
+		Name:   "history",
+		Usage:  "list the ceremonies in the local topic cache, the most recent first",
+		Action: h.HandleHistory,
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "number of ceremonies to list, 0 for all",
+				Value: 20,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the ceremonies as json",
+			},
+		},
+	}
+}
+
+// TopicStatus is the state of a ceremony's topic, Stale when it comes from
+// the cache instead of the messenger
+type TopicStatus struct {
+	*topiccache.Entry
+	Stale bool `json:"stale"`
+	// Reason the messenger wasn't asked or didn't answer
+	Reason string `json:"reason,omitempty"`
+	// Progress of the operators while the ceremony has no result, nil when
+	// the messenger can't tell
+	Progress *messenger.TopicProgress `json:"progress,omitempty"`
+}
+
+func (h *CliHandler) HandleStatus(c *cli.Context) error {
+	requestID, err := lookupRequestID(c)
+	if err != nil {
+		return err
+	}
+	if wait := c.Duration("wait"); wait > 0 {
+		if c.Bool("offline") {
+			return fail(ConditionValidation, fmt.Errorf("HandleStatus: --wait polls the messenger, it can't be combined with --offline"))
+		}
+		status, err := h.waitTopicStatus(requestID, wait, followPollInterval, !c.Bool("json"))
+		if status != nil && c.Bool("json") {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if encodeErr := encoder.Encode(status); encodeErr != nil {
+				return encodeErr
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("HandleStatus: %w", err)
+		}
+		return nil
+	}
+
+	status, err := h.topicStatus(requestID, c.Bool("offline"))
+	if err != nil {
+		return fmt.Errorf("HandleStatus: %w", err)
+	}
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+	printTopicStatus(status, time.Now())
+	return nil
+}
+
+// topicStatus is the state of a ceremony's topic from the messenger, or from
+// the cache when offline or the messenger is unreachable
+func (h *CliHandler) topicStatus(requestID string, offline bool) (*TopicStatus, error) {
+	if offline {
+		entry, err := cachedTopic(requestID)
+		if err != nil {
+			return nil, err
+		}
+		return &TopicStatus{Entry: entry, Stale: true, Reason: "--offline"}, nil
+	}
+	entry, err := h.fetchTopicStatus(requestID)
+	if err != nil {
+		var failure *Failure
+		if !errors.As(err, &failure) || failure.Condition != ConditionUnreachable {
+			return nil, err
+		}
+		cached, cacheErr := cachedTopic(requestID)
+		if cacheErr != nil {
+			return nil, fmt.Errorf("%w, and %v", err, cacheErr)
+		}
+		return &TopicStatus{Entry: cached, Stale: true, Reason: fmt.Sprintf("messenger unreachable: %v", err)}, nil
+	}
+	status := &TopicStatus{Entry: entry}
+	if entry.Result == nil {
+		status.Progress = h.fetchTopicProgress(requestID)
+	}
+	return status, nil
+}
+
+// waitTopicStatus polls the messenger every interval until the ceremony has a
+// result, printing the stages of the operators whenever they change when
+// verbose. It returns the last status, with a ConditionTimeout failure naming
+// the operators that are behind when there is no result after wait, and the
+// blame of a ceremony that ended with one.
+func (h *CliHandler) waitTopicStatus(requestID string, wait, interval time.Duration, verbose bool) (*TopicStatus, error) {
+	deadline := time.Now().Add(wait)
+	printed := ""
+	for {
+		status, err := h.topicStatus(requestID, false)
+		if err == nil && !status.Stale {
+			if status.Result != nil {
+				if verbose {
+					printTopicStatus(status, time.Now())
+				}
+				return status, formatResults(status.Result).blameFailure(requestID)
+			}
+			if line := progressLine(status.Progress); verbose && line != printed {
+				fmt.Printf("%s %s\n", time.Now().UTC().Format(time.RFC3339), line)
+				printed = line
+			}
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			if err != nil {
+				var failure *Failure
+				if errors.As(err, &failure) {
+					return nil, err
+				}
+				return nil, fail(ConditionTimeout, fmt.Errorf("no result for ceremony %s after %s: %w", requestID, wait, err))
+			}
+			if status.Stale {
+				return status, fail(ConditionUnreachable, fmt.Errorf("no result for ceremony %s after %s, %s", requestID, wait, status.Reason))
+			}
+			if behind := behindOperators(status.Progress); len(behind) > 0 {
+				return status, fail(ConditionTimeout, fmt.Errorf("no result for ceremony %s after %s, waiting on operators %v", requestID, wait, behind))
+			}
+			return status, fail(ConditionTimeout, fmt.Errorf("no result for ceremony %s after %s", requestID, wait))
+		}
+		time.Sleep(interval)
+	}
+}
+
+// fetchTopicProgress asks the messenger for the stages of the operators, nil
+// when it can't tell, e.g. a messenger from before the progress endpoint
+func (h *CliHandler) fetchTopicProgress(requestID string) *messenger.TopicProgress {
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+	progress, err := h.messengerClient().TopicProgress(ctx, requestID)
+	if err != nil {
+		h.logger.Debugf("fetchTopicProgress: %v", err)
+		return nil
+	}
+	return progress
+}
+
+// progressOperators are the operators of a ceremony's progress: the operator
+// ids subscribed to the topic and the ones that published, in order
+func progressOperators(progress *messenger.TopicProgress) []types.OperatorID {
+	seen := make(map[types.OperatorID]bool)
+	for _, name := range progress.Operators {
+		if operatorID, err := strconv.ParseUint(name, 10, 64); err == nil {
+			seen[types.OperatorID(operatorID)] = true
+		}
+	}
+	for operatorID := range progress.Stages {
+		seen[operatorID] = true
+	}
+	operators := make([]types.OperatorID, 0, len(seen))
+	for operatorID := range seen {
+		operators = append(operators, operatorID)
+	}
+	sortOperators(operators)
+	return operators
+}
+
+// behindOperators are the operators that haven't reached the stage of the
+// furthest one, they hold the ceremony up
+func behindOperators(progress *messenger.TopicProgress) []types.OperatorID {
+	if progress == nil {
+		return nil
+	}
+	furthest := -1
+	for _, stage := range progress.Stages {
+		if stage.Index() > furthest {
+			furthest = stage.Index()
+		}
+	}
+	var behind []types.OperatorID
+	for _, operatorID := range progressOperators(progress) {
+		if progress.Stages[operatorID].Index() < furthest {
+			behind = append(behind, operatorID)
+		}
+	}
+	return behind
+}
+
+// progressLine is one line with the operators at each stage, e.g.
+// "init_received [4], round2 [1 2 3], waiting on [4]"
+func progressLine(progress *messenger.TopicProgress) string {
+	if progress == nil {
+		return "progress unknown"
+	}
+	byStage := make(map[messengerclient.ProgressStage][]types.OperatorID)
+	var silent []types.OperatorID
+	for _, operatorID := range progressOperators(progress) {
+		if stage, ok := progress.Stages[operatorID]; ok {
+			byStage[stage] = append(byStage[stage], operatorID)
+		} else {
+			silent = append(silent, operatorID)
+		}
+	}
+	var parts []string
+	if len(silent) > 0 {
+		parts = append(parts, fmt.Sprintf("no messages %v", silent))
+	}
+	for _, stage := range messengerclient.ProgressStages {
+		if operators := byStage[stage]; len(operators) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %v", stage, operators))
+		}
+	}
+	if len(parts) == 0 {
+		return "no operators subscribed"
+	}
+	if behind := behindOperators(progress); len(behind) > 0 {
+		parts = append(parts, fmt.Sprintf("waiting on %v", behind))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fetchTopicStatus asks the messenger for the subscribers, outputs and result
+// of a ceremony and caches what it answers
+func (h *CliHandler) fetchTopicStatus(requestID string) (*topiccache.Entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+	client := h.messengerClient()
+
+	var (
+		subscribers []string
+		outputs     *messenger.TopicOutputs
+		result      *messenger.DataStore
+		resultETag  string
+	)
+	topic, err := client.GetTopicContext(ctx, requestID)
+	if err != nil && !messenger.IsNotFound(err) {
+		return nil, unreachable(fmt.Errorf("failed to fetch topic %s: %w", requestID, err))
+	}
+	if topic != nil {
+		for subscriber := range topic.Subscribers {
+			subscribers = append(subscribers, subscriber)
+		}
+		sortSubscribers(subscribers)
+		if outputs, err = client.TopicOutputs(ctx, requestID); err != nil && !messenger.IsNotFound(err) {
+			return nil, unreachable(fmt.Errorf("failed to fetch outputs of topic %s: %w", requestID, err))
+		}
+	}
+	if result, resultETag, err = fetchResult(ctx, client, requestID); err != nil && !messenger.IsNotFound(err) {
+		return nil, unreachable(fmt.Errorf("failed to fetch result of ceremony %s: %w", requestID, err))
+	}
+	if topic == nil && result == nil {
+		return nil, fmt.Errorf("messenger has no topic or result for ceremony %s", requestID)
+	}
+
+	var entry *topiccache.Entry
+	h.updateTopicCache(func(cache *topiccache.Cache) {
+		if topic != nil {
+			cache.SetSubscribers(requestID, subscribers)
+		}
+		if outputs != nil {
+			cache.SetOutputs(requestID, outputs.Outputs)
+		}
+		if result != nil {
+			cache.SetResult(requestID, result, resultETag)
+		}
+		entry, _ = cache.Get(requestID)
+	})
+	if entry == nil {
+		// the cache isn't writable, the status is still what the messenger said
+		entry = &topiccache.Entry{RequestID: requestID, Subscribers: subscribers, Result: result, FetchedAt: time.Now().Unix()}
+		if outputs != nil && result == nil {
+			entry.Outputs = outputs.Outputs
+		}
+	}
+	return entry, nil
+}
+
+func (h *CliHandler) HandleHistory(c *cli.Context) error {
+	cache, err := topiccache.Load(topiccache.DefaultPath())
+	if err != nil {
+		return fmt.Errorf("HandleHistory: %w", err)
+	}
+	entries := cache.List()
+	if limit := c.Int("limit"); limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		kind := string(entry.Kind)
+		if kind == "" {
+			kind = "-"
+		}
+		fetched := "never fetched"
+		if entry.FetchedAt != 0 {
+			fetched = fmt.Sprintf("fetched %s ago", entry.Age(now).Round(time.Second))
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", entry.RequestID, kind, fetched, resultSummary(entry))
+	}
+	return nil
+}
+
+func printTopicStatus(status *TopicStatus, now time.Time) {
+	entry := status.Entry
+	if entry.Kind != "" {
+		fmt.Printf("ceremony: %s (%s)\n", entry.RequestID, entry.Kind)
+	} else {
+		fmt.Printf("ceremony: %s\n", entry.RequestID)
+	}
+	switch {
+	case !status.Stale:
+		fmt.Println("source: messenger")
+	case entry.FetchedAt == 0:
+		fmt.Printf("source: cache, STALE: never fetched from the messenger (%s)\n", status.Reason)
+	default:
+		fetchedAt := time.Unix(entry.FetchedAt, 0).UTC()
+		fmt.Printf("source: cache, STALE: fetched %s, %s ago (%s)\n", fetchedAt.Format(time.RFC3339), entry.Age(now).Round(time.Second), status.Reason)
+	}
+	if delivery := entry.Delivery; delivery != nil {
+		if delivery.Error == "" {
+			fmt.Printf("start message: delivered to %v\n", delivery.Operators)
+		} else {
+			fmt.Printf("start message: %s\n", delivery.Error)
+		}
+	}
+	if entry.ManifestHash != "" {
+		fmt.Printf("manifest hash: %s\n", entry.ManifestHash)
+	}
+	if len(entry.Subscribers) > 0 {
+		fmt.Printf("subscribers: %s\n", strings.Join(entry.Subscribers, ", "))
+	}
+	if entry.Result == nil && len(entry.Outputs) > 0 {
+		published := make([]types.OperatorID, 0, len(entry.Outputs))
+		for operatorID := range entry.Outputs {
+			published = append(published, operatorID)
+		}
+		sortOperators(published)
+		fmt.Printf("outputs: %d published by %v\n", len(published), published)
+	}
+	if entry.Result == nil && status.Progress != nil {
+		fmt.Printf("progress: %s\n", progressLine(status.Progress))
+	}
+	fmt.Printf("result: %s\n", resultSummary(entry))
+}
+
+// resultSummary is one line about the result of a cached ceremony
+func resultSummary(entry *topiccache.Entry) string {
+	if entry.Result == nil {
+		if len(entry.Outputs) > 0 {
+			return fmt.Sprintf("pending, %d outputs", len(entry.Outputs))
+		}
+		return "pending"
+	}
+	result := formatResults(entry.Result)
+	if result.Blame != nil {
+		if result.Blame.BlameMessage != nil {
+			return fmt.Sprintf("blame by operator %d", result.Blame.BlameMessage.Signer)
+		}
+		return "blame"
+	}
+	summary := "complete"
+	if vk, err := result.GetValidatorPK(); err == nil && len(vk) > 0 {
+		summary = fmt.Sprintf("complete, validator 0x%x", []byte(vk))
+	}
+	if entry.Result.Canary {
+		summary += " (canary)"
+	}
+	return summary
+}
+
+// cachedTopic is the cached entry of a ceremony
+func cachedTopic(requestID string) (*topiccache.Entry, error) {
+	cache, err := topiccache.Load(topiccache.DefaultPath())
+	if err != nil {
+		return nil, err
+	}
+	return cache.Get(requestID)
+}
+
+// fetchResult gets the result of a ceremony from the messenger, a result that
+// is cached with its etag isn't downloaded again unless it changed
+func fetchResult(ctx context.Context, client *messenger.Client, requestID string) (*messenger.DataStore, string, error) {
+	etag := ""
+	entry, err := cachedTopic(requestID)
+	if err == nil && entry.Result != nil {
+		etag = entry.ResultETag
+	}
+	data, fetchedETag, err := client.GetDataIfChanged(ctx, requestID, etag)
+	if errors.Is(err, messenger.ErrNotModified) {
+		return entry.Result, etag, nil
+	}
+	return data, fetchedETag, err
+}
+
+// cachedDKGResult is the cached result of a ceremony, for when the messenger
+// can't be reached; it warns that the result wasn't fetched now
+func cachedDKGResult(requestID string) (*DKGResult, bool) {
+	entry, err := cachedTopic(requestID)
+	if err != nil || entry.Result == nil {
+		return nil, false
+	}
+	fmt.Printf("warning: messenger unreachable, using the result of ceremony %s cached %s ago\n", requestID, entry.Age(time.Now()).Round(time.Second))
+	result := formatResults(entry.Result)
+	result.ManifestHash = entry.ManifestHash
+	return result, true
+}
+
+// updateTopicCache applies update to the topic cache and saves it, the cache
+// is a convenience so failures are only logged
+func (h *CliHandler) updateTopicCache(update func(cache *topiccache.Cache)) {
+	cache, err := topiccache.Load(topiccache.DefaultPath())
+	if err != nil {
+		h.logger.Warnf("updateTopicCache: %v", err)
+		return
+	}
+	update(cache)
+	if err := cache.Save(); err != nil {
+		h.logger.Warnf("updateTopicCache: %v", err)
+	}
+}
+
+// sortSubscribers orders operator ids numerically, other names after them
+func sortSubscribers(subscribers []string) {
+	sort.Slice(subscribers, func(i, j int) bool {
+		a, errA := strconv.ParseUint(subscribers[i], 10, 64)
+		b, errB := strconv.ParseUint(subscribers[j], 10, 64)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		if (errA == nil) != (errB == nil) {
+			return errA == nil
+		}
+		return subscribers[i] < subscribers[j]
+	})
+}
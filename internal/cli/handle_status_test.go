@@ -0,0 +1,160 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/topiccache"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicStatusCache(t *testing.T) {
+	t.Setenv("DKG_TOPIC_CACHE", filepath.Join(t.TempDir(), "topics.json"))
+	published := map[types.OperatorID]*dkg.SignedOutput{}
+	for operatorID := types.OperatorID(1); operatorID <= 4; operatorID++ {
+		published[operatorID] = &dkg.SignedOutput{Data: &dkg.Output{ValidatorPubKey: []byte{0xaa}}, Signer: operatorID}
+	}
+
+	done := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/topics/" + followRequestID:
+			subscribers := map[string]interface{}{"10": nil, "2": nil, "1": nil}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"Name": followRequestID, "Subscribers": subscribers})
+		case "/topics/" + followRequestID + "/outputs":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"operators": []string{"1", "2", "10"}, "outputs": map[types.OperatorID]*dkg.SignedOutput{1: published[1]}})
+		case "/data/" + followRequestID:
+			if !done {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"DKGOutputs": published})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	h := New(logrus.New())
+	h.messengerAddr = srv.URL
+	entry, err := h.fetchTopicStatus(followRequestID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "10"}, entry.Subscribers)
+	require.Len(t, entry.Outputs, 1)
+	require.Equal(t, "pending, 1 outputs", resultSummary(entry))
+
+	done = true
+	result, err := h.DKGResultByRequestID(followRequestID)
+	require.NoError(t, err)
+	require.Len(t, result.Output, 4)
+
+	// with the messenger down the result and topic come from the cache
+	srv.Close()
+	cached, err := h.DKGResultByRequestID(followRequestID)
+	require.NoError(t, err)
+	require.Equal(t, result, cached)
+	_, err = h.fetchTopicStatus(followRequestID)
+	require.Equal(t, ExitUnreachable, ExitCode(err))
+
+	entry, err = cachedTopic(followRequestID)
+	require.NoError(t, err)
+	require.Nil(t, entry.Outputs)
+	require.Equal(t, "complete, validator 0xaa", resultSummary(entry))
+
+	_, err = h.DKGResultByRequestID("missing")
+	require.Equal(t, ExitUnreachable, ExitCode(err), "nothing cached for the ceremony")
+	_, err = cachedTopic("missing")
+	require.ErrorIs(t, err, topiccache.ErrNotCached)
+}
+
+func TestProgressLine(t *testing.T) {
+	progress := &messenger.TopicProgress{
+		Operators: []string{"1", "2", "3", "4", "observer"},
+		Stages: map[types.OperatorID]messengerclient.ProgressStage{
+			1: messengerclient.StageRound2,
+			2: messengerclient.StageRound2,
+			3: messengerclient.StageRound1,
+		},
+	}
+	require.Equal(t, []types.OperatorID{3, 4}, behindOperators(progress))
+	require.Equal(t, "no messages [4], round1 [3], round2 [1 2], waiting on [3 4]", progressLine(progress))
+
+	progress.Stages[3] = messengerclient.StageRound2
+	progress.Stages[4] = messengerclient.StageRound2
+	require.Empty(t, behindOperators(progress))
+	require.Equal(t, "round2 [1 2 3 4]", progressLine(progress))
+
+	require.Empty(t, behindOperators(nil))
+	require.Equal(t, "progress unknown", progressLine(nil))
+}
+
+func TestWaitTopicStatus(t *testing.T) {
+	t.Setenv("DKG_TOPIC_CACHE", filepath.Join(t.TempDir(), "topics.json"))
+	stages := map[types.OperatorID]messengerclient.ProgressStage{1: messengerclient.StageRound1, 2: messengerclient.StageInitReceived}
+	done := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/topics/" + followRequestID:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"Name": followRequestID, "Subscribers": map[string]interface{}{"1": nil, "2": nil}})
+		case "/topics/" + followRequestID + "/outputs":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"operators": []string{"1", "2"}, "outputs": map[string]interface{}{}})
+		case "/topics/" + followRequestID + "/progress":
+			_ = json.NewEncoder(w).Encode(&messenger.TopicProgress{Operators: []string{"1", "2"}, Stages: stages})
+		case "/data/" + followRequestID:
+			if !done {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			outputs := map[types.OperatorID]*dkg.SignedOutput{}
+			for operatorID := types.OperatorID(1); operatorID <= 2; operatorID++ {
+				outputs[operatorID] = &dkg.SignedOutput{Data: &dkg.Output{ValidatorPubKey: []byte{0xaa}}, Signer: operatorID}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"DKGOutputs": outputs})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	h := New(logrus.New())
+	h.messengerAddr = srv.URL
+	status, err := h.waitTopicStatus(followRequestID, 30*time.Millisecond, 10*time.Millisecond, false)
+	require.Equal(t, ExitTimeout, ExitCode(err))
+	require.ErrorContains(t, err, "waiting on operators [2]")
+	require.Equal(t, stages, status.Progress.Stages)
+
+	done = true
+	status, err = h.waitTopicStatus(followRequestID, time.Second, 10*time.Millisecond, false)
+	require.NoError(t, err)
+	require.NotNil(t, status.Result)
+	require.Nil(t, status.Progress)
+}
@@ -0,0 +1,70 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/telemetry"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandTelemetryPreview() *cli.Command {
+	return &cli.Command{
+		Name:   "telemetry-preview",
+		Usage:  "print exactly the anonymized telemetry report a node would send next, whether its telemetry is on or off",
+		Action: h.HandleTelemetryPreview,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "node",
+				Usage:    "address of the node, e.g. http://0.0.0.0:8081",
+				Required: true,
+			},
+		},
+	}
+}
+
+func (h *CliHandler) HandleTelemetryPreview(c *cli.Context) error {
+	addr := strings.TrimSuffix(c.String("node"), "/")
+	report := &telemetry.Report{}
+	if err := h.getNodeJSON(addr+"/telemetry/preview", report); err != nil {
+		return unreachable(fmt.Errorf("HandleTelemetryPreview: %w", err))
+	}
+
+	mode := "unknown"
+	config := &node.AdvertisedConfig{}
+	if err := h.getNodeJSON(addr+"/config", config); err == nil {
+		mode = telemetry.ModeOff
+		if config.Features["telemetry"] == "true" {
+			mode = telemetry.ModeOn
+		}
+	}
+	fmt.Fprintf(os.Stderr, "telemetry of the node is %s, the report of %s to %s:\n", mode, report.PeriodStart.Format("2006-01-02T15:04Z"), report.PeriodEnd.Format("2006-01-02T15:04Z"))
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,183 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandVerifyArtifact() *cli.Command {
+	return &cli.Command{
+		Name:    "verify-artifact",
+		Aliases: []string{"va"},
+		Usage:   "verify the signatures of deposit data, bls to execution changes or dkg results, written by this cli or by ethdo",
+		Action:  h.HandleVerifyArtifact,
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "file",
+				Aliases:  []string{"f"},
+				Usage:    "deposit data, change operations or dkg results file, repeat it to verify a batch",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "fork-version",
+				Usage: "network the bls to execution changes are for (mainnet, prater, holesky), deposit data carries its own",
+			},
+			&cli.IntFlag{
+				Name:  "require-approvals",
+				Usage: "dkg results need the signed approval of at least this many operators of the committee",
+			},
+			workersFlag(),
+		},
+	}
+}
+
+// artifactEntry is one deposit, change or ceremony result of the files
+// verify-artifact is given
+type artifactEntry struct {
+	name string
+	// network is printed with a deposit that verifies
+	network string
+	verify  func() error
+}
+
+func (h *CliHandler) HandleVerifyArtifact(c *cli.Context) error {
+	keys := cachedKeys(registryKeys)
+	var entries []*artifactEntry
+	for _, file := range c.StringSlice("file") {
+		fileEntries, err := readArtifactEntries(file, c.String("fork-version"), c.Int("require-approvals"), keys)
+		if err != nil {
+			return fail(ConditionValidation, fmt.Errorf("HandleVerifyArtifact: %w", err))
+		}
+		entries = append(entries, fileEntries...)
+	}
+
+	var progress io.Writer
+	if len(entries) > 1 {
+		progress = os.Stderr
+	}
+	errs := verifyConcurrently(len(entries), c.Int("workers"), progress, func(i int) error {
+		return entries[i].verify()
+	})
+
+	var failures []string
+	for i, entry := range entries {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", entry.name, errs[i]))
+			continue
+		}
+		if entry.network != "" {
+			fmt.Printf("%s on %s: ok\n", entry.name, entry.network)
+			continue
+		}
+		fmt.Printf("%s: ok\n", entry.name)
+	}
+	if len(failures) > 0 {
+		fmt.Printf("%d of %d entries don't verify:\n", len(failures), len(entries))
+		for _, failure := range failures {
+			fmt.Printf("  - %s\n", failure)
+		}
+		return fail(ConditionValidation, fmt.Errorf("HandleVerifyArtifact: %d of %d entries don't verify", len(failures), len(entries)))
+	}
+	return nil
+}
+
+// readArtifactEntries reads the deposit data, change operations or dkg
+// results of file, a list of them or a single one. Dkg results need
+// requireApprovals approvals of their committee.
+func readArtifactEntries(file, forkVersion string, requireApprovals int, keys observer.KeyLookup) ([]*artifactEntry, error) {
+	byts, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var raw []map[string]json.RawMessage
+	if err := unmarshalOneOrMany(byts, &raw); err != nil || len(raw) == 0 {
+		return nil, fmt.Errorf("%s is neither deposit data, change operations nor dkg results", file)
+	}
+
+	var entries []*artifactEntry
+	_, isChange := raw[0]["message"]
+	_, isResult := raw[0]["output"]
+	if _, isBlame := raw[0]["blame"]; isBlame {
+		isResult = true
+	}
+	switch {
+	case isChange:
+		network, ok := blsToExecutionNetworks[forkVersion]
+		if !ok {
+			return nil, fmt.Errorf("change operations need --fork-version, one of mainnet, prater, holesky")
+		}
+		changes, err := parseChangeOperations(byts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for i := range changes {
+			change := changes[i]
+			entries = append(entries, &artifactEntry{
+				name:   fmt.Sprintf("change of validator %s to %s", change.Message.ValidatorIndex, change.Message.ToExecutionAddress),
+				verify: func() error { return change.Verify(network) },
+			})
+		}
+	case isResult:
+		var results []*DKGResult
+		if err := unmarshalOneOrMany(byts, &results); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for i := range results {
+			result := results[i]
+			name := fmt.Sprintf("dkg result %d of %s", i, file)
+			for _, output := range result.Output {
+				name = fmt.Sprintf("dkg result of request %s%s", output.Data.RequestID, output.KeySignData.RequestID)
+				break
+			}
+			entries = append(entries, &artifactEntry{
+				name: name,
+				verify: func() error {
+					if err := result.verifyOutputs(keys); err != nil {
+						return err
+					}
+					return result.requireApprovals(requireApprovals, keys)
+				},
+			})
+		}
+	default:
+		deposits, err := parseDepositData(byts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for i := range deposits {
+			deposit := deposits[i]
+			entries = append(entries, &artifactEntry{
+				name:    fmt.Sprintf("deposit of %d gwei for validator %s", deposit.Amount, deposit.PubKey),
+				network: deposit.NetworkName,
+				verify:  deposit.Verify,
+			})
+		}
+	}
+	return entries, nil
+}
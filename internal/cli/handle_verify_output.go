@@ -0,0 +1,104 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandVerifyOutput() *cli.Command {
+	return &cli.Command{
+		Name:   "verify-output",
+		Usage:  "verify the published result of a ceremony, e.g. the one of a validator holding delegated stake",
+		Action: h.HandleVerifyOutput,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "request-id",
+				Aliases:  []string{"r"},
+				Usage:    "request id of the ceremony",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "remote",
+				Usage: "messenger to fetch the result from its public endpoint, no credentials needed; MESSENGER_SRV_ADDR when not set",
+			},
+			&cli.StringFlag{
+				Name:  "validator-pk",
+				Usage: "validator public key the result has to be of",
+			},
+		},
+	}
+}
+
+// HandleVerifyOutput fetches the outputs of a ceremony from the public
+// endpoint of a messenger and checks them like verify-artifact checks a
+// results file: every output signed by the registry key of its operator and
+// all of one validator
+func (h *CliHandler) HandleVerifyOutput(c *cli.Context) error {
+	remote := c.String("remote")
+	if remote == "" {
+		remote = h.messengerAddr
+	}
+	requestID, err := lookupRequestID(c)
+	if err != nil {
+		return err
+	}
+	result, err := h.verifyPublicResult(remote, requestID, cachedKeys(registryKeys))
+	if err != nil {
+		return err
+	}
+
+	validatorPK, err := result.GetValidatorPK()
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleVerifyOutput: %w", err))
+	}
+	if expected := c.String("validator-pk"); expected != "" && !hexenc.Equal(expected, hexenc.Key(validatorPK)) {
+		return fail(ConditionValidation, fmt.Errorf("HandleVerifyOutput: ceremony %s created validator %s, not %s", requestID, hexenc.Format(validatorPK), expected))
+	}
+	fmt.Printf("validator %x\n", validatorPK)
+	fmt.Printf("operators %s\n", formatOperatorIDs(result.sortedOperators()))
+	if result.Canary {
+		fmt.Println("warning: the ceremony is a canary keygen, its validator never holds stake")
+	}
+	fmt.Printf("dkg result of request %s: ok\n", requestID)
+	return nil
+}
+
+// verifyPublicResult fetches the published result of the ceremony from the
+// messenger at remote and verifies the signatures of its outputs
+func (h *CliHandler) verifyPublicResult(remote, requestID string, keys observer.KeyLookup) (*DKGResult, error) {
+	data, err := messenger.NewMessengerClient(remote).PublicResult(context.Background(), requestID)
+	if err != nil {
+		return nil, unreachable(fmt.Errorf("verifyPublicResult: failed to get the result of %s from %s: %w", requestID, remote, err))
+	}
+	result := formatResults(data)
+	if err := result.verifyOutputs(keys); err != nil {
+		return nil, fail(ConditionValidation, fmt.Errorf("verifyPublicResult: dkg result of request %s: %w", requestID, err))
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyPublicResult(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	requestID := dkg.RequestID{7, 8, 9}
+	outputs := committeeOutputs(t, requestID, 1, 2, 3, 4)
+	m := &messenger.Messenger{Data: map[string]*messenger.DataStore{
+		"good": {DKGOutputs: outputs.Outputs},
+	}}
+	tampered := committeeOutputs(t, requestID, 1, 2, 3, 4)
+	tampered.Outputs[3].Data.SharePubKey = []byte{0xff}
+	m.Data["tampered"] = &messenger.DataStore{DKGOutputs: tampered.Outputs}
+
+	r := gin.New()
+	r.GET(messenger.PublicResultsPath+"/:request_id", m.HandlePublicResult())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	h := New(logrus.New())
+	result, err := h.verifyPublicResult(srv.URL, "good", testingKeys)
+	require.NoError(t, err)
+	validatorPK, err := result.GetValidatorPK()
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString([]byte("validator")), hex.EncodeToString(validatorPK))
+
+	_, err = h.verifyPublicResult(srv.URL, "tampered", testingKeys)
+	require.ErrorContains(t, err, "output of operator 3: invalid output signature")
+	require.Equal(t, ExitValidation, ExitCode(err))
+
+	_, err = h.verifyPublicResult("http://127.0.0.1:1", "good", testingKeys)
+	require.Equal(t, ExitUnreachable, ExitCode(err))
+}
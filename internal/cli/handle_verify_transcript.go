@@ -0,0 +1,169 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/internal/utils"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/urfave/cli/v2"
+)
+
+func (h CliHandler) CommandVerifyTranscript() *cli.Command {
+	return &cli.Command{
+		Name:   "verify-transcript",
+		Usage:  "verify the stored transcript of a keygen or resharing offline, from a file or fetched from a node",
+		Action: h.HandleVerifyTranscript,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "transcript",
+				Usage: "transcript file, as written with --node",
+			},
+			&cli.StringFlag{
+				Name:  "node",
+				Usage: "address of a node that took part in the ceremony to fetch the transcript from, e.g. http://0.0.0.0:8081",
+			},
+			&cli.StringFlag{
+				Name:  "request-id",
+				Usage: "request ID of the ceremony to fetch with --node",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "file to write the fetched transcript to, transcript_<request_id>_<timestamp>.json by default",
+			},
+			&cli.StringFlag{
+				Name:  "validator-pk",
+				Usage: "validator public key the ceremony has to have produced",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the result as json",
+			},
+		},
+	}
+}
+
+// TranscriptVerification is the result of verifying a stored transcript
+type TranscriptVerification struct {
+	RequestID   string   `json:"request_id"`
+	Kind        string   `json:"kind"`
+	Operators   string   `json:"operators"`
+	Threshold   uint64   `json:"threshold"`
+	Messages    int      `json:"messages"`
+	Root        string   `json:"root"`
+	ValidatorPK string   `json:"validator_pk,omitempty"`
+	Valid       bool     `json:"valid"`
+	Findings    []string `json:"findings,omitempty"`
+}
+
+func (h *CliHandler) HandleVerifyTranscript(c *cli.Context) error {
+	record, err := h.loadTranscript(c)
+	if err != nil {
+		return fmt.Errorf("HandleVerifyTranscript: %w", err)
+	}
+
+	t, err := observer.LoadTranscript(record)
+	if err != nil {
+		return fail(ConditionValidation, fmt.Errorf("HandleVerifyTranscript: %w", err))
+	}
+	validatorPK, findings := t.Verify()
+	if want := c.String("validator-pk"); want != "" && len(validatorPK) > 0 && !hexenc.Equal(want, hexenc.Key(validatorPK)) {
+		findings = append(findings, fmt.Sprintf("transcript produced validator key %s instead of %s", hexenc.Format(validatorPK), want))
+	}
+
+	result := &TranscriptVerification{
+		RequestID:   record.RequestID,
+		Kind:        string(t.Kind),
+		Operators:   formatOperatorIDs(t.Operators),
+		Threshold:   t.Threshold,
+		Messages:    t.Messages(),
+		Root:        record.Root,
+		ValidatorPK: hex.EncodeToString(validatorPK),
+		Valid:       len(findings) == 0,
+		Findings:    findings,
+	}
+	if c.Bool("json") {
+		if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+			return fmt.Errorf("HandleVerifyTranscript: %w", err)
+		}
+	} else {
+		fmt.Printf("%s %s\noperators: %s, threshold %d\nmessages: %d, root %s\n", result.Kind, result.RequestID, result.Operators, result.Threshold, result.Messages, result.Root)
+		if result.ValidatorPK != "" {
+			fmt.Printf("validator key: %s\n", result.ValidatorPK)
+		}
+		for _, finding := range findings {
+			fmt.Printf("finding: %s\n", finding)
+		}
+	}
+	if !result.Valid {
+		return fail(ConditionAttestation, fmt.Errorf("HandleVerifyTranscript: transcript of %s doesn't verify, %d findings", record.RequestID, len(findings)))
+	}
+	if !c.Bool("json") {
+		fmt.Println("transcript verifies")
+	}
+	return nil
+}
+
+// loadTranscript reads the transcript file, or fetches the transcript from
+// the node and writes it to a file first so it can be verified again later
+func (h *CliHandler) loadTranscript(c *cli.Context) (*observer.TranscriptRecord, error) {
+	record := &observer.TranscriptRecord{}
+	if path := c.String("transcript"); path != "" {
+		byts, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fail(ConditionValidation, fmt.Errorf("failed to read transcript: %w", err))
+		}
+		if err := json.Unmarshal(byts, record); err != nil {
+			return nil, fail(ConditionValidation, fmt.Errorf("failed to parse transcript: %w", err))
+		}
+		return record, nil
+	}
+
+	if c.String("node") == "" || c.String("request-id") == "" {
+		return nil, fail(ConditionValidation, fmt.Errorf("either --transcript or --node and --request-id are required"))
+	}
+	requestID, err := lookupRequestID(c)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/ceremonies/%s/transcript", strings.TrimSuffix(c.String("node"), "/"), requestID)
+	if err := h.getNodeJSON(url, record); err != nil {
+		return nil, unreachable(fmt.Errorf("failed to fetch transcript from %s: %w", c.String("node"), err))
+	}
+
+	filepath := c.String("out")
+	if filepath == "" {
+		filepath = fmt.Sprintf("transcript_%s_%d.json", requestID, time.Now().Unix())
+	}
+	fmt.Printf("writing transcript to file: %s\n", filepath)
+	if err := utils.WriteJSON(filepath, record); err != nil {
+		return nil, fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return record, nil
+}
@@ -0,0 +1,69 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func TestVerifyTranscriptFetchesAndKeepsTranscript(t *testing.T) {
+	record := &observer.TranscriptRecord{Version: observer.TranscriptVersion + 1, RequestID: "9a45c1f30a9896c5263508c2a132ebf7fc7e3c37ab86c74b", Root: "00"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ceremonies/9a45c1f30a9896c5263508c2a132ebf7fc7e3c37ab86c74b/transcript", r.URL.Path)
+		_ = json.NewEncoder(w).Encode(record)
+	}))
+	defer srv.Close()
+
+	out := filepath.Join(t.TempDir(), "transcript.json")
+	h := New(logrus.New())
+	app := &cli.App{Commands: WithExitCodes([]*cli.Command{h.CommandVerifyTranscript()})}
+	err := app.Run([]string{"cli", "verify-transcript", "--node", srv.URL, "--request-id", "0x9A45C1F30A9896C5263508C2A132EBF7FC7E3C37AB86C74B", "--out", out})
+	require.ErrorContains(t, err, "unsupported transcript version")
+	require.Equal(t, ExitValidation, ExitCode(err))
+
+	// the fetched transcript is written before it is verified
+	kept := &observer.TranscriptRecord{}
+	byts, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(byts, kept))
+	require.Equal(t, record, kept)
+
+	err = app.Run([]string{"cli", "verify-transcript", "--transcript", out})
+	require.Equal(t, ExitValidation, ExitCode(err))
+}
+
+func TestVerifyTranscriptNeedsASource(t *testing.T) {
+	h := New(logrus.New())
+	app := &cli.App{Commands: WithExitCodes([]*cli.Command{h.CommandVerifyTranscript()})}
+	err := app.Run([]string{"cli", "verify-transcript", "--node", "http://0.0.0.0:8081"})
+	require.Equal(t, ExitValidation, ExitCode(err))
+}
@@ -0,0 +1,208 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keystore"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// initiatorKeyEnv holds the initiator key when --initiator-key isn't
+	// given: a base64 encoded PEM like OPERATOR_PRIVATE_KEY of the node, or
+	// an encrypted operator keystore
+	initiatorKeyEnv = "DKG_INITIATOR_KEY"
+	// initiatorKeyPasswordEnv holds the password of an encrypted initiator
+	// keystore when --initiator-key-password-file isn't given
+	initiatorKeyPasswordEnv = "DKG_INITIATOR_KEY_PASSWORD"
+)
+
+var errECDSAKey = errors.New("ECDSA keys can't sign start messages, nodes verify them against the rsa operator keys of the registry")
+
+// initiatorKeyFlags select the operator key the cli signs start messages with
+func initiatorKeyFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "initiator-key",
+			Usage: "file with the rsa operator key signing the start message: PEM, base64 encoded PEM or an encrypted operator keystore, " + initiatorKeyEnv + " holds the key otherwise",
+		},
+		&cli.IntFlag{
+			Name:    "initiator-id",
+			Usage:   "operator id the nodes verify the initiator key against",
+			EnvVars: []string{"DKG_INITIATOR_ID"},
+		},
+		&cli.StringFlag{
+			Name:  "initiator-key-password-file",
+			Usage: "file with the password of an encrypted initiator keystore, " + initiatorKeyPasswordEnv + " holds the password otherwise",
+		},
+	}
+}
+
+// initiatorSigner loads the initiator key of --initiator-key, or of
+// DKG_INITIATOR_KEY when the flag isn't given. It returns nil without a key.
+func initiatorSigner(c *cli.Context) (*initSigner, error) {
+	var data []byte
+	switch path := c.String("initiator-key"); {
+	case path != "":
+		byts, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read initiator key: %w", err)
+		}
+		data = byts
+	case os.Getenv(initiatorKeyEnv) != "":
+		data = []byte(os.Getenv(initiatorKeyEnv))
+	default:
+		return nil, nil
+	}
+	if c.Int("initiator-id") <= 0 {
+		return nil, fail(ConditionValidation, fmt.Errorf("--initiator-id is required with an initiator key"))
+	}
+
+	password := os.Getenv(initiatorKeyPasswordEnv)
+	if path := c.String("initiator-key-password-file"); path != "" {
+		byts, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read initiator key password: %w", err)
+		}
+		password = strings.TrimRight(string(byts), "\r\n")
+	}
+
+	signer, err := newInitSigner(data, password, types.OperatorID(c.Int("initiator-id")))
+	if err != nil {
+		return nil, fail(ConditionValidation, err)
+	}
+	return signer, nil
+}
+
+// loadInitiator sets the initiator key keygen, resharing and keysign starts are
+// signed with. Without a key and without --signer the cli falls back to the
+// testing key of operator 1, which only nodes of the hardcoded registry
+// accept, so it refuses to with the real registry.
+func (h *CliHandler) loadInitiator(c *cli.Context) error {
+	signer, err := initiatorSigner(c)
+	if err != nil {
+		return err
+	}
+	delegated := c.Uint64("signer") != 0
+	switch {
+	case signer != nil && delegated:
+		return fail(ConditionValidation, fmt.Errorf("--initiator-key and --signer both sign the start message, give one of them"))
+	case signer == nil && !delegated:
+		if !storage.UsingHardcodedOperators() {
+			return fail(ConditionValidation, fmt.Errorf("no initiator key, pass --initiator-key, %s or --signer; nodes refuse starts signed with the testing key", initiatorKeyEnv))
+		}
+		h.logger.Warn("no --initiator-key, start messages are signed with the testing key of operator 1")
+		return nil
+	case signer == nil:
+		return nil
+	}
+
+	// nodes refuse a start message the registry key of the signer doesn't
+	// verify, an unreachable registry leaves the check to them
+	pk, err := registryKeys(signer.id)
+	if err != nil {
+		h.logger.Warnf("failed to check the initiator key against the registry: %v", err)
+	} else if !pk.Equal(&signer.sk.PublicKey) {
+		return fail(ConditionValidation, fmt.Errorf("the initiator key isn't the registry key of operator %d", signer.id))
+	}
+	h.initiator = signer
+	return nil
+}
+
+// newInitSigner reads an initiator key: a PEM, a base64 encoded PEM like
+// OPERATOR_PRIVATE_KEY of the node or an operator keystore, which is
+// decrypted with password
+func newInitSigner(data []byte, password string, id types.OperatorID) (*initSigner, error) {
+	sk, err := parseRSAKey(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("initiator key: %w", err)
+	}
+	return &initSigner{sk: sk, id: id}, nil
+}
+
+func loadRSAKey(path string) (*rsa.PrivateKey, error) {
+	byts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	return parseRSAKey(byts, "")
+}
+
+func parseRSAKey(byts []byte, password string) (*rsa.PrivateKey, error) {
+	byts = bytes.TrimSpace(byts)
+	if keystore.IsOperatorKeystore(byts) {
+		if password == "" {
+			return nil, fmt.Errorf("key is an encrypted keystore and no password was given")
+		}
+		secret, err := keystore.DecryptOperatorKey(byts, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt keystore: %w", err)
+		}
+		byts = bytes.TrimSpace(secret)
+	}
+	if !bytes.HasPrefix(byts, []byte("-----BEGIN")) {
+		var err error
+		if byts, err = base64.StdEncoding.DecodeString(string(byts)); err != nil {
+			return nil, fmt.Errorf("key is neither PEM nor base64 encoded PEM: %w", err)
+		}
+	}
+
+	block, _ := pem.Decode(byts)
+	if block == nil {
+		return nil, fmt.Errorf("key is neither PEM nor base64 encoded PEM")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return nil, errECDSAKey
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key: %w", err)
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case *ecdsa.PrivateKey:
+			return nil, errECDSAKey
+		default:
+			return nil, fmt.Errorf("key is a %T, not an rsa key", key)
+		}
+	}
+	sk, err := types.PemToPrivateKey(byts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	return sk, nil
+}
@@ -0,0 +1,183 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keystore"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+func initiatorContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	for _, f := range append(initiatorKeyFlags(), &cli.Uint64Flag{Name: "signer"}) {
+		require.NoError(t, f.Apply(set))
+	}
+	require.NoError(t, set.Parse(args))
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+func writeKey(t *testing.T, name string, content []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	return path
+}
+
+func pemKey(sk *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(sk)})
+}
+
+func TestNewInitSigner(t *testing.T) {
+	sk := testingutils.TestingKeygenKeySet().DKGOperators[2].EncryptionKey
+	encoded := pemKey(sk)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(sk)
+	require.NoError(t, err)
+	encrypted, err := keystore.EncryptOperatorKey([]byte(base64.StdEncoding.EncodeToString(encoded)), "secret", "")
+	require.NoError(t, err)
+
+	for name, content := range map[string][]byte{
+		"pem":      encoded,
+		"base64":   []byte(base64.StdEncoding.EncodeToString(encoded) + "\n"),
+		"pkcs8":    pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		"keystore": encrypted,
+	} {
+		signer, err := newInitSigner(content, "secret", 2)
+		require.NoError(t, err, name)
+		require.EqualValues(t, 2, signer.id)
+		require.True(t, sk.Equal(signer.sk), name)
+	}
+
+	_, err = newInitSigner(encrypted, "", 2)
+	require.ErrorContains(t, err, "no password")
+	_, err = newInitSigner(encrypted, "wrong", 2)
+	require.ErrorIs(t, err, keystore.ErrWrongPassword)
+
+	_, err = newInitSigner([]byte("not a key"), "", 2)
+	require.Error(t, err)
+	_, err = newInitSigner([]byte(base64.StdEncoding.EncodeToString([]byte("not a key"))), "", 2)
+	require.Error(t, err)
+}
+
+func TestNewInitSignerRefusesECDSA(t *testing.T) {
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sec1, err := x509.MarshalECPrivateKey(sk)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(sk)
+	require.NoError(t, err)
+
+	_, err = newInitSigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), "", 1)
+	require.ErrorIs(t, err, errECDSAKey)
+	_, err = newInitSigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), "", 1)
+	require.ErrorIs(t, err, errECDSAKey)
+}
+
+func TestInitiatorSigner(t *testing.T) {
+	sk := testingutils.TestingKeygenKeySet().DKGOperators[2].EncryptionKey
+	encoded := pemKey(sk)
+	encrypted, err := keystore.EncryptOperatorKey([]byte(base64.StdEncoding.EncodeToString(encoded)), "secret", "")
+	require.NoError(t, err)
+	t.Setenv(initiatorKeyEnv, "")
+	t.Setenv(initiatorKeyPasswordEnv, "")
+
+	// from a file
+	signer, err := initiatorSigner(initiatorContext(t, "--initiator-key", writeKey(t, "key.pem", encoded), "--initiator-id", "2"))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, signer.id)
+	require.True(t, sk.Equal(signer.sk))
+
+	// from a keystore with its password file, or the password env
+	keystorePath := writeKey(t, "keystore.json", encrypted)
+	signer, err = initiatorSigner(initiatorContext(t, "--initiator-key", keystorePath, "--initiator-id", "2", "--initiator-key-password-file", writeKey(t, "password", []byte("secret\n"))))
+	require.NoError(t, err)
+	require.True(t, sk.Equal(signer.sk))
+	_, err = initiatorSigner(initiatorContext(t, "--initiator-key", keystorePath, "--initiator-id", "2"))
+	require.Equal(t, ExitValidation, ExitCode(err), "no password")
+	t.Setenv(initiatorKeyPasswordEnv, "secret")
+	signer, err = initiatorSigner(initiatorContext(t, "--initiator-key", keystorePath, "--initiator-id", "2"))
+	require.NoError(t, err)
+	require.True(t, sk.Equal(signer.sk))
+
+	// from the env, the flag wins over it
+	t.Setenv(initiatorKeyEnv, base64.StdEncoding.EncodeToString(encoded))
+	signer, err = initiatorSigner(initiatorContext(t, "--initiator-id", "2"))
+	require.NoError(t, err)
+	require.True(t, sk.Equal(signer.sk))
+	other := testingutils.TestingKeygenKeySet().DKGOperators[3].EncryptionKey
+	signer, err = initiatorSigner(initiatorContext(t, "--initiator-key", writeKey(t, "other.pem", pemKey(other)), "--initiator-id", "3"))
+	require.NoError(t, err)
+	require.True(t, other.Equal(signer.sk))
+
+	_, err = initiatorSigner(initiatorContext(t))
+	require.Equal(t, ExitValidation, ExitCode(err), "key without --initiator-id")
+	_, err = initiatorSigner(initiatorContext(t, "--initiator-key", filepath.Join(t.TempDir(), "missing"), "--initiator-id", "2"))
+	require.Error(t, err)
+
+	t.Setenv(initiatorKeyEnv, "")
+	signer, err = initiatorSigner(initiatorContext(t))
+	require.NoError(t, err)
+	require.Nil(t, signer)
+}
+
+func TestLoadInitiator(t *testing.T) {
+	t.Setenv(initiatorKeyEnv, "")
+	t.Setenv("USE_HARDCODED_OPERATORS", "true")
+	sk := storage.DKGOperators[2].EncryptionKey
+	keyPath := writeKey(t, "key.pem", pemKey(sk))
+	h := New(logrus.New())
+
+	require.NoError(t, h.loadInitiator(initiatorContext(t, "--initiator-key", keyPath, "--initiator-id", "2")))
+	require.True(t, sk.Equal(h.initiator.sk))
+
+	// the key of operator 2 isn't the registry key of operator 1
+	h = New(logrus.New())
+	err := h.loadInitiator(initiatorContext(t, "--initiator-key", keyPath, "--initiator-id", "1"))
+	require.Equal(t, ExitValidation, ExitCode(err))
+	require.ErrorContains(t, err, "registry key of operator 1")
+	require.Nil(t, h.initiator)
+
+	err = h.loadInitiator(initiatorContext(t, "--initiator-key", keyPath, "--initiator-id", "2", "--signer", "3"))
+	require.Equal(t, ExitValidation, ExitCode(err))
+	require.NoError(t, h.loadInitiator(initiatorContext(t, "--signer", "3")))
+
+	// the testing key only goes with the hardcoded registry
+	require.NoError(t, h.loadInitiator(initiatorContext(t)))
+	require.Nil(t, h.initiator)
+	t.Setenv("USE_HARDCODED_OPERATORS", "false")
+	err = h.loadInitiator(initiatorContext(t))
+	require.Equal(t, ExitValidation, ExitCode(err))
+}
@@ -0,0 +1,406 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// DecodedMessage is one layer of a message blob, an ssv message carries a
+// signed dkg message which carries the payload of its message type
+type DecodedMessage struct {
+	Type    string          `json:"type"`
+	Fields  []DecodedField  `json:"fields"`
+	Payload *DecodedMessage `json:"payload,omitempty"`
+	// Embedded are the messages a blame message carries as evidence
+	Embedded []*DecodedMessage `json:"embedded,omitempty"`
+	// Error is set when the payload of the layer doesn't decode
+	Error string `json:"error,omitempty"`
+}
+
+type DecodedField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (d *DecodedMessage) add(name string, format string, args ...any) {
+	d.Fields = append(d.Fields, DecodedField{Name: name, Value: fmt.Sprintf(format, args...)})
+}
+
+func (d *DecodedMessage) addBytes(name string, value []byte) {
+	if len(value) == 0 {
+		d.add(name, "<empty>")
+		return
+	}
+	d.add(name, "0x%s", hex.EncodeToString(value))
+}
+
+// decodeBlob reads a message blob in the given encoding: hex with or without
+// 0x, base64 or the json the messages are encoded to. auto tells them apart
+// by their characters.
+func decodeBlob(blob string, encoding string) ([]byte, error) {
+	blob = strings.Trim(strings.TrimSpace(blob), "\"'")
+	if encoding == "auto" {
+		encoding = detectEncoding(blob)
+	}
+	switch encoding {
+	case "json":
+		return []byte(blob), nil
+	case "hex":
+		return hex.DecodeString(strings.TrimPrefix(blob, "0x"))
+	case "base64":
+		for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+			if data, err := enc.DecodeString(blob); err == nil {
+				return data, nil
+			}
+		}
+		return nil, errors.New("not valid base64")
+	}
+	return nil, fmt.Errorf("unknown encoding %q, use auto, hex, base64 or json", encoding)
+}
+
+func detectEncoding(blob string) string {
+	if strings.HasPrefix(blob, "{") {
+		return "json"
+	}
+	if strings.HasPrefix(blob, "0x") {
+		return "hex"
+	}
+	if len(blob)%2 == 0 && strings.Trim(strings.ToLower(blob), "0123456789abcdef") == "" {
+		return "hex"
+	}
+	return "base64"
+}
+
+// inspectMessage decodes an ssv message, a signed dkg message, a dkg message
+// or the payload of one, whichever data is, down to its innermost layer
+func inspectMessage(data []byte) (*DecodedMessage, error) {
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("not a json encoded message: %w", err)
+	}
+	has := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := keys[name]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case has("MsgType", "MsgID", "Data"):
+		return inspectSSVMessage(data)
+	case has("Message", "Signer", "Signature"):
+		return inspectSignedMessage(data)
+	case has("MsgType", "Identifier", "Data"):
+		return inspectDKGMessage(data)
+	case has("Signer", "Signature") && (has("Data") || has("BlameData") || has("KeySignData")):
+		return inspectPayload(dkg.OutputMsgType, data), nil
+	case has("Signer", "Root", "Signature"):
+		return inspectPayload(dkg.DepositDataMsgType, data), nil
+	case has("OperatorIDs", "Threshold", "WithdrawalCredentials"):
+		return inspectPayload(dkg.InitMsgType, data), nil
+	case has("ValidatorPK", "OperatorIDs", "OldOperatorIDs"):
+		return inspectPayload(dkg.ReshareMsgType, data), nil
+	case has("ValidatorPK", "SigningRoot"):
+		return inspectPayload(dkg.KeySignMsgType, data), nil
+	case has("round") || has("preparation") || has("round1") || has("round2") || has("blame") || has("timeout"):
+		return inspectPayload(dkg.ProtocolMsgType, data), nil
+	}
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown message with fields %s", strings.Join(names, ", "))
+}
+
+func inspectSSVMessage(data []byte) (*DecodedMessage, error) {
+	msg := &types.SSVMessage{}
+	if err := msg.Decode(data); err != nil {
+		return nil, fmt.Errorf("failed to decode ssv message: %w", err)
+	}
+	d := &DecodedMessage{Type: "SSVMessage"}
+	d.add("msg_type", "%s (%d)", ssvMsgTypeName(msg.MsgType), msg.MsgType)
+	d.add("msg_id", "%s", msg.MsgID.String())
+	d.add("data_bytes", "%d", len(msg.Data))
+	if msg.MsgType != types.DKGMsgType {
+		return d, nil
+	}
+	payload, err := inspectSignedMessage(msg.Data)
+	if err != nil {
+		d.Error = err.Error()
+		return d, nil
+	}
+	d.Payload = payload
+	return d, nil
+}
+
+func inspectSignedMessage(data []byte) (*DecodedMessage, error) {
+	msg := &dkg.SignedMessage{}
+	if err := msg.Decode(data); err != nil {
+		return nil, fmt.Errorf("failed to decode signed message: %w", err)
+	}
+	d := &DecodedMessage{Type: "SignedMessage"}
+	d.add("signer", "%d", msg.Signer)
+	d.addBytes("signature", msg.Signature)
+	if msg.Message == nil {
+		d.Error = "no message"
+		return d, nil
+	}
+	d.Payload = decodedDKGMessage(msg.Message)
+	return d, nil
+}
+
+func inspectDKGMessage(data []byte) (*DecodedMessage, error) {
+	msg := &dkg.Message{}
+	if err := msg.Decode(data); err != nil {
+		return nil, fmt.Errorf("failed to decode dkg message: %w", err)
+	}
+	return decodedDKGMessage(msg), nil
+}
+
+func decodedDKGMessage(msg *dkg.Message) *DecodedMessage {
+	d := &DecodedMessage{Type: "Message"}
+	d.add("msg_type", "%s (%d)", dkgMsgTypeName(msg.MsgType), msg.MsgType)
+	d.add("identifier", "%s", hex.EncodeToString(msg.Identifier[:]))
+	d.add("eth_address", "%s", msg.Identifier.GetETHAddress().Hex())
+	d.add("index", "%d", msg.Identifier.GetRoleType())
+	d.Payload = inspectPayload(msg.MsgType, msg.Data)
+	return d
+}
+
+// inspectPayload decodes the data of a dkg message of msgType
+func inspectPayload(msgType dkg.MsgType, data []byte) *DecodedMessage {
+	var (
+		d   *DecodedMessage
+		err error
+	)
+	switch msgType {
+	case dkg.InitMsgType:
+		d, err = inspectInit(data)
+	case dkg.ReshareMsgType:
+		d, err = inspectReshare(data)
+	case dkg.KeySignMsgType:
+		d, err = inspectKeySign(data)
+	case dkg.ProtocolMsgType:
+		d, err = inspectProtocolMsg(data)
+	case dkg.DepositDataMsgType:
+		d, err = inspectPartialDepositData(data)
+	case dkg.OutputMsgType:
+		d, err = inspectSignedOutput(data)
+	default:
+		err = fmt.Errorf("unknown message type %d", msgType)
+	}
+	if err != nil {
+		d = &DecodedMessage{Type: dkgMsgTypeName(msgType), Error: err.Error()}
+		d.addBytes("data", data)
+	}
+	return d
+}
+
+func inspectInit(data []byte) (*DecodedMessage, error) {
+	init := &dkg.Init{}
+	if err := init.Decode(data); err != nil {
+		return nil, err
+	}
+	d := &DecodedMessage{Type: "Init"}
+	d.add("operators", "%v", init.OperatorIDs)
+	d.add("threshold", "%d", init.Threshold)
+	d.addBytes("withdrawal_credentials", init.WithdrawalCredentials)
+	d.add("fork_version", "0x%s", hex.EncodeToString(init.Fork[:]))
+	return d, nil
+}
+
+func inspectReshare(data []byte) (*DecodedMessage, error) {
+	reshare := &dkg.Reshare{}
+	if err := reshare.Decode(data); err != nil {
+		return nil, err
+	}
+	d := &DecodedMessage{Type: "Reshare"}
+	d.addBytes("validator_pk", reshare.ValidatorPK)
+	d.add("operators", "%v", reshare.OperatorIDs)
+	d.add("threshold", "%d", reshare.Threshold)
+	d.add("old_operators", "%v", reshare.OldOperatorIDs)
+	return d, nil
+}
+
+func inspectKeySign(data []byte) (*DecodedMessage, error) {
+	// only the public fields, a node's copy carries key material
+	keySign := struct {
+		signing.KeySign
+		Operators []uint32
+		Threshold uint64
+	}{}
+	if err := json.Unmarshal(data, &keySign); err != nil {
+		return nil, err
+	}
+	d := &DecodedMessage{Type: "KeySign"}
+	d.addBytes("validator_pk", keySign.ValidatorPK)
+	d.addBytes("signing_root", keySign.SigningRoot)
+	if keySign.DomainTag != "" {
+		d.add("domain_tag", "%s", keySign.DomainTag)
+		d.addBytes("message_root", keySign.MessageRoot)
+	}
+	if len(keySign.Operators) > 0 {
+		d.add("operators", "%v", keySign.Operators)
+		d.add("threshold", "%d", keySign.Threshold)
+	}
+	return d, nil
+}
+
+func inspectProtocolMsg(data []byte) (*DecodedMessage, error) {
+	msg := &frost.ProtocolMsg{}
+	if err := msg.Decode(data); err != nil {
+		return nil, err
+	}
+	d := &DecodedMessage{Type: "ProtocolMsg"}
+	d.add("round", "%s", strings.ToLower(msg.Round.String()))
+	if msg.PreparationMessage != nil {
+		d.addBytes("preparation.session_pk", msg.PreparationMessage.SessionPk)
+	}
+	if round1 := msg.Round1Message; round1 != nil {
+		for i, commitment := range round1.Commitment {
+			d.addBytes(fmt.Sprintf("round1.commitment[%d]", i), commitment)
+		}
+		d.addBytes("round1.proof_s", round1.ProofS)
+		d.addBytes("round1.proof_r", round1.ProofR)
+		operators := make([]uint32, 0, len(round1.Shares))
+		for operatorID := range round1.Shares {
+			operators = append(operators, operatorID)
+		}
+		sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+		for _, operatorID := range operators {
+			d.addBytes(fmt.Sprintf("round1.share[%d]", operatorID), round1.Shares[operatorID])
+		}
+	}
+	if round2 := msg.Round2Message; round2 != nil {
+		d.addBytes("round2.vk", round2.Vk)
+		d.addBytes("round2.vk_share", round2.VkShare)
+	}
+	if blame := msg.BlameMessage; blame != nil {
+		d.add("blame.type", "%s (%d)", blame.Type.ToString(), blame.Type)
+		d.add("blame.target", "%d", blame.TargetOperatorID)
+		d.addBytes("blame.blamer_session_sk", blame.BlamerSessionSk)
+		for _, evidence := range blame.BlameData {
+			embedded, err := inspectSignedMessage(evidence)
+			if err != nil {
+				embedded = &DecodedMessage{Type: "SignedMessage", Error: err.Error()}
+				embedded.addBytes("data", evidence)
+			}
+			d.Embedded = append(d.Embedded, embedded)
+		}
+	}
+	if msg.TimeoutMessage != nil {
+		d.add("timeout.round", "%s", strings.ToLower(msg.TimeoutMessage.Round.String()))
+	}
+	return d, nil
+}
+
+func inspectPartialDepositData(data []byte) (*DecodedMessage, error) {
+	msg := &dkg.PartialDepositData{}
+	if err := msg.Decode(data); err != nil {
+		return nil, err
+	}
+	d := &DecodedMessage{Type: "PartialDepositData"}
+	d.add("signer", "%d", msg.Signer)
+	d.addBytes("root", msg.Root)
+	d.addBytes("signature", msg.Signature)
+	return d, nil
+}
+
+func inspectSignedOutput(data []byte) (*DecodedMessage, error) {
+	msg := &dkg.SignedOutput{}
+	if err := msg.Decode(data); err != nil {
+		return nil, err
+	}
+	d := &DecodedMessage{Type: "SignedOutput"}
+	d.add("signer", "%d", msg.Signer)
+	d.addBytes("signature", msg.Signature)
+	if output := msg.Data; output != nil {
+		d.add("output.request_id", "%s", hex.EncodeToString(output.RequestID[:]))
+		d.addBytes("output.encrypted_share", output.EncryptedShare)
+		d.addBytes("output.share_pubkey", output.SharePubKey)
+		d.addBytes("output.validator_pubkey", output.ValidatorPubKey)
+		d.addBytes("output.deposit_data_signature", output.DepositDataSignature)
+	}
+	if blame := msg.BlameData; blame != nil {
+		d.add("blame.request_id", "%s", hex.EncodeToString(blame.RequestID[:]))
+		d.add("blame.valid", "%t", blame.Valid)
+		blameMsg := &frost.BlameMessage{}
+		if err := blameMsg.Decode(blame.BlameMessage); err == nil {
+			d.add("blame.type", "%s (%d)", blameMsg.Type.ToString(), blameMsg.Type)
+			d.add("blame.target", "%d", blameMsg.TargetOperatorID)
+		} else {
+			d.addBytes("blame.message", blame.BlameMessage)
+		}
+	}
+	if keySign := msg.KeySignData; keySign != nil {
+		d.add("keysign.request_id", "%s", hex.EncodeToString(keySign.RequestID[:]))
+		d.addBytes("keysign.validator_pk", keySign.ValidatorPK)
+		d.addBytes("keysign.signature", keySign.Signature)
+	}
+	return d, nil
+}
+
+func ssvMsgTypeName(msgType types.MsgType) string {
+	switch msgType {
+	case types.SSVConsensusMsgType:
+		return "consensus"
+	case types.SSVPartialSignatureMsgType:
+		return "partial_signature"
+	case types.DKGMsgType:
+		return "dkg"
+	}
+	return "unknown"
+}
+
+func dkgMsgTypeName(msgType dkg.MsgType) string {
+	switch msgType {
+	case dkg.InitMsgType:
+		return "init"
+	case dkg.ProtocolMsgType:
+		return "protocol"
+	case dkg.DepositDataMsgType:
+		return "deposit_data"
+	case dkg.OutputMsgType:
+		return "output"
+	case dkg.ReshareMsgType:
+		return "reshare"
+	case dkg.KeySignMsgType:
+		return "keysign"
+	}
+	return "unknown"
+}
@@ -0,0 +1,110 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/stretchr/testify/require"
+)
+
+func field(t *testing.T, msg *DecodedMessage, name string) string {
+	for _, f := range msg.Fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	t.Fatalf("%s has no field %s", msg.Type, name)
+	return ""
+}
+
+func TestInspectInitMessage(t *testing.T) {
+	t.Setenv("USE_HARDCODED_OPERATORS", "true")
+	requestID := getRandRequestID()
+	msg, err := testKeygenRequest().initMsgForKeygen(requestID, testingInitSigner())
+	require.NoError(t, err)
+
+	for _, blob := range []string{"0x" + hex.EncodeToString(msg), base64.StdEncoding.EncodeToString(msg), string(msg)} {
+		data, err := decodeBlob(blob, "auto")
+		require.NoError(t, err)
+		decoded, err := inspectMessage(data)
+		require.NoError(t, err)
+
+		require.Equal(t, "SSVMessage", decoded.Type)
+		require.Equal(t, "dkg (2)", field(t, decoded, "msg_type"))
+		signed := decoded.Payload
+		require.Equal(t, "SignedMessage", signed.Type)
+		message := signed.Payload
+		require.Equal(t, "init (0)", field(t, message, "msg_type"))
+		require.Equal(t, hex.EncodeToString(requestID[:]), field(t, message, "identifier"))
+		init := message.Payload
+		require.Equal(t, "Init", init.Type)
+		require.Len(t, field(t, init, "operators"), len("[1 2 3 4]"))
+		require.Equal(t, "3", field(t, init, "threshold"))
+		require.Empty(t, init.Error)
+	}
+}
+
+func TestInspectProtocolMessage(t *testing.T) {
+	evidence, err := (&dkg.SignedMessage{Message: &dkg.Message{MsgType: dkg.ProtocolMsgType, Data: []byte("{}")}, Signer: 3}).Encode()
+	require.NoError(t, err)
+	protocolMsg, err := (&frost.ProtocolMsg{
+		Round: common.Blame,
+		BlameMessage: &frost.BlameMessage{
+			Type:             frost.InvalidShare,
+			TargetOperatorID: 3,
+			BlameData:        [][]byte{evidence},
+		},
+	}).Encode()
+	require.NoError(t, err)
+	msg, err := (&dkg.Message{MsgType: dkg.ProtocolMsgType, Data: protocolMsg}).Encode()
+	require.NoError(t, err)
+
+	decoded, err := inspectMessage(msg)
+	require.NoError(t, err)
+	blame := decoded.Payload
+	require.Equal(t, "ProtocolMsg", blame.Type)
+	require.Equal(t, "blame", field(t, blame, "round"))
+	require.Equal(t, "Invalid Share (1)", field(t, blame, "blame.type"))
+	require.Len(t, blame.Embedded, 1)
+	require.Equal(t, "3", field(t, blame.Embedded[0], "signer"))
+
+	out := &bytes.Buffer{}
+	printDecodedMessage(out, decoded, "")
+	require.Contains(t, out.String(), "  ProtocolMsg\n    round: blame\n")
+	require.Contains(t, out.String(), "    evidence 1:\n      SignedMessage\n        signer: 3\n")
+}
+
+func TestInspectRejectsUnknownBlobs(t *testing.T) {
+	_, err := decodeBlob("not base64!", "auto")
+	require.Error(t, err)
+	_, err = inspectMessage([]byte("{\"foo\": 1}"))
+	require.EqualError(t, err, "unknown message with fields foo")
+	_, err = inspectMessage([]byte{0x01, 0x02})
+	require.Error(t, err)
+}
@@ -0,0 +1,171 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// JSON-RPC 2.0 error codes, see https://www.jsonrpc.org/specification#error_object
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+
+	// RPCCeremonyNotFound is returned for request IDs this server didn't start
+	RPCCeremonyNotFound = -32001
+	// RPCBatchNotFound is returned for batch IDs this server didn't start
+	RPCBatchNotFound = -32003
+)
+
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (err *RPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", err.Code, err.Message)
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// ID is nil for notifications, which get no response
+	ID json.RawMessage `json:"id,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcMethod func(params json.RawMessage) (interface{}, error)
+
+// rpcDispatcher serves JSON-RPC 2.0 single and batch requests
+type rpcDispatcher struct {
+	methods map[string]rpcMethod
+}
+
+// Serve returns the encoded response for body, or nil when body only holds
+// notifications
+func (d *rpcDispatcher) Serve(body []byte) []byte {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		return d.serveBatch(body)
+	}
+
+	resp := d.serveOne(body)
+	if resp == nil {
+		return nil
+	}
+	byts, _ := json.Marshal(resp)
+	return byts
+}
+
+func (d *rpcDispatcher) serveBatch(body []byte) []byte {
+	batch := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(body, &batch); err != nil {
+		byts, _ := json.Marshal(errorResponse(nil, RPCParseError, "parse error", err))
+		return byts
+	}
+	if len(batch) == 0 {
+		byts, _ := json.Marshal(errorResponse(nil, RPCInvalidRequest, "invalid request", fmt.Errorf("empty batch")))
+		return byts
+	}
+
+	responses := make([]*rpcResponse, 0, len(batch))
+	for _, raw := range batch {
+		if resp := d.serveOne(raw); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	byts, _ := json.Marshal(responses)
+	return byts
+}
+
+func (d *rpcDispatcher) serveOne(raw []byte) *rpcResponse {
+	req := &rpcRequest{}
+	if err := json.Unmarshal(raw, req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return errorResponse(nil, RPCParseError, "parse error", err)
+		}
+		return errorResponse(nil, RPCInvalidRequest, "invalid request", err)
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, RPCInvalidRequest, "invalid request", fmt.Errorf("jsonrpc must be 2.0 and method must be set"))
+	}
+
+	method, ok := d.methods[req.Method]
+	if !ok {
+		if req.ID == nil {
+			return nil
+		}
+		return errorResponse(req.ID, RPCMethodNotFound, "method not found", fmt.Errorf("unknown method %s", req.Method))
+	}
+
+	result, err := method(req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	if err != nil {
+		if rpcErr, ok := err.(*RPCError); ok {
+			return &rpcResponse{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}
+		}
+		return errorResponse(req.ID, RPCInternalError, "internal error", err)
+	}
+
+	byts, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, RPCInternalError, "failed to encode result", err)
+	}
+	return &rpcResponse{JSONRPC: "2.0", Result: byts, ID: req.ID}
+}
+
+func errorResponse(id json.RawMessage, code int, message string, err error) *rpcResponse {
+	return &rpcResponse{
+		JSONRPC: "2.0",
+		Error:   &RPCError{Code: code, Message: message, Data: err.Error()},
+		ID:      id,
+	}
+}
+
+// decodeParams reads named params into out
+func decodeParams(params json.RawMessage, out interface{}) error {
+	if len(params) == 0 {
+		return &RPCError{Code: RPCInvalidParams, Message: "missing params"}
+	}
+	if err := json.Unmarshal(params, out); err != nil {
+		return &RPCError{Code: RPCInvalidParams, Message: "invalid params", Data: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testDispatcher() *rpcDispatcher {
+	return &rpcDispatcher{methods: map[string]rpcMethod{
+		"echo": func(params json.RawMessage) (interface{}, error) {
+			p := &ceremonyParams{}
+			if err := decodeParams(params, p); err != nil {
+				return nil, err
+			}
+			return p, nil
+		},
+		"fail": func(json.RawMessage) (interface{}, error) {
+			return nil, errors.New("boom")
+		},
+	}}
+}
+
+func TestJSONRPCSingle(t *testing.T) {
+	resp := &rpcResponse{}
+	require.NoError(t, json.Unmarshal(testDispatcher().Serve([]byte(`{"jsonrpc":"2.0","method":"echo","params":{"request_id":"ab"},"id":1}`)), resp))
+	require.Nil(t, resp.Error)
+	require.JSONEq(t, `{"request_id":"ab"}`, string(resp.Result))
+	require.Equal(t, "1", string(resp.ID))
+
+	require.NoError(t, json.Unmarshal(testDispatcher().Serve([]byte(`{"jsonrpc":"2.0","method":"echo","id":"x"}`)), resp))
+	require.Equal(t, RPCInvalidParams, resp.Error.Code)
+
+	require.NoError(t, json.Unmarshal(testDispatcher().Serve([]byte(`{"jsonrpc":"2.0","method":"fail","id":2}`)), resp))
+	require.Equal(t, RPCInternalError, resp.Error.Code)
+
+	require.NoError(t, json.Unmarshal(testDispatcher().Serve([]byte(`{"jsonrpc":"2.0","method":"echo"`)), resp))
+	require.Equal(t, RPCParseError, resp.Error.Code)
+	require.Equal(t, "null", string(resp.ID))
+}
+
+func TestJSONRPCBatch(t *testing.T) {
+	body := `[
+		{"jsonrpc":"2.0","method":"echo","params":{"request_id":"ab"},"id":1},
+		{"jsonrpc":"2.0","method":"echo","params":{"request_id":"cd"}},
+		{"jsonrpc":"2.0","method":"missing","id":2},
+		{"foo":"bar"}
+	]`
+	responses := make([]*rpcResponse, 0)
+	require.NoError(t, json.Unmarshal(testDispatcher().Serve([]byte(body)), &responses))
+	require.Len(t, responses, 3, "notifications get no response")
+	require.Nil(t, responses[0].Error)
+	require.Equal(t, RPCMethodNotFound, responses[1].Error.Code)
+	require.Equal(t, RPCInvalidRequest, responses[2].Error.Code)
+
+	require.Nil(t, testDispatcher().Serve([]byte(`[{"jsonrpc":"2.0","method":"echo","params":{}}]`)))
+
+	resp := &rpcResponse{}
+	require.NoError(t, json.Unmarshal(testDispatcher().Serve([]byte(`[]`)), resp))
+	require.Equal(t, RPCInvalidRequest, resp.Error.Code)
+}
@@ -0,0 +1,164 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+)
+
+// RejectedPartial is a partial signature left out of an aggregation
+type RejectedPartial struct {
+	Operator types.OperatorID
+	Reason   string
+}
+
+// AggregatedSignature is a signature recovered by the cli from the partial
+// signatures of a keysign
+type AggregatedSignature struct {
+	// Signature in hex, verified against the validator pk
+	Signature string
+	// Signers are the operators whose partials recovered the signature
+	Signers  []types.OperatorID
+	Rejected []RejectedPartial
+}
+
+// sharePubKeys are the public key shares of the operators in a keygen result
+func sharePubKeys(keygen *DKGResult) (map[types.OperatorID]*bls.PublicKey, error) {
+	sharePKs := make(map[types.OperatorID]*bls.PublicKey, len(keygen.Output))
+	for operatorID, output := range keygen.Output {
+		sharePK, err := hex.DecodeString(output.Data.SharePubKey)
+		if err != nil {
+			return nil, fmt.Errorf("sharePubKeys: failed to decode share pk of operator %d: %w", operatorID, err)
+		}
+		pk := &bls.PublicKey{}
+		if err := pk.Deserialize(sharePK); err != nil {
+			return nil, fmt.Errorf("sharePubKeys: failed to deserialize share pk of operator %d: %w", operatorID, err)
+		}
+		sharePKs[operatorID] = pk
+	}
+	return sharePKs, nil
+}
+
+// aggregatePartials verifies every partial against the share pk of its
+// operator and recovers the signature of root from the valid ones. The
+// threshold isn't part of a keygen result, so valid partials are added in
+// operator order until the recovered signature verifies against the validator
+// pk: any threshold of valid partials recovers the same signature, fewer
+// recover a wrong one
+func aggregatePartials(partials map[types.OperatorID][]byte, sharePKs map[types.OperatorID]*bls.PublicKey, validatorPK, root []byte) (*AggregatedSignature, error) {
+	operators := make([]types.OperatorID, 0, len(partials))
+	for operatorID := range partials {
+		operators = append(operators, operatorID)
+	}
+	sortOperators(operators)
+
+	agg := &AggregatedSignature{}
+	var verified []types.OperatorID
+	for _, operatorID := range operators {
+		sharePK, ok := sharePKs[operatorID]
+		if !ok {
+			agg.Rejected = append(agg.Rejected, RejectedPartial{Operator: operatorID, Reason: "operator has no share of the validator key"})
+			continue
+		}
+		sig := &bls.Sign{}
+		if err := sig.Deserialize(partials[operatorID]); err != nil {
+			agg.Rejected = append(agg.Rejected, RejectedPartial{Operator: operatorID, Reason: fmt.Sprintf("invalid signature encoding: %v", err)})
+			continue
+		}
+		if !sig.VerifyByte(sharePK, root) {
+			agg.Rejected = append(agg.Rejected, RejectedPartial{Operator: operatorID, Reason: "doesn't verify against the share pk of the operator"})
+			continue
+		}
+		verified = append(verified, operatorID)
+	}
+
+	subset := make(map[types.OperatorID][]byte)
+	for _, operatorID := range verified {
+		subset[operatorID] = partials[operatorID]
+		agg.Signers = append(agg.Signers, operatorID)
+		recovered, err := types.ReconstructSignatures(subset)
+		if err != nil {
+			return agg, fmt.Errorf("aggregatePartials: failed to recover signature from partials of operators %v: %w", agg.Signers, err)
+		}
+		if types.VerifyReconstructedSignature(recovered, validatorPK, root) == nil {
+			agg.Signature = hex.EncodeToString(recovered.Serialize())
+			return agg, nil
+		}
+	}
+	return agg, fmt.Errorf("aggregatePartials: the %d valid partials of operators %v don't reach the threshold", len(verified), verified)
+}
+
+// keysignSignature is the signature of root by the committee of a keygen,
+// from the result of the keysign when it finished and verifies, otherwise
+// aggregated from the partials the operators published so a missing or
+// misbehaving operator doesn't fail the signing while a threshold is left
+func (h *CliHandler) keysignSignature(keygen *DKGResult, requestID string, root []byte) (string, error) {
+	vk, err := keygen.GetValidatorPK()
+	if err != nil {
+		return "", fmt.Errorf("keysignSignature: %w", err)
+	}
+
+	result, err := h.waitDKGResult(requestID)
+	if err == nil {
+		var signature string
+		if signature, err = result.GetSignatureFromKeySign(); err == nil {
+			if err = verifyBLSSignature(vk, root, signature); err == nil {
+				return signature, nil
+			}
+		}
+	}
+	h.logger.Warnf("keysign %s didn't finish with a valid signature, aggregating partials: %v", requestID, err)
+
+	agg, aggErr := h.aggregateKeysign(keygen, requestID, vk, root)
+	if agg != nil {
+		for _, rejected := range agg.Rejected {
+			fmt.Printf("rejected partial of operator %d: %s\n", rejected.Operator, rejected.Reason)
+		}
+	}
+	if aggErr != nil {
+		return "", fmt.Errorf("keysignSignature: %w, partials don't recover the signature either: %v", err, aggErr)
+	}
+	fmt.Printf("recovered signature from partials of operators %v\n", agg.Signers)
+	return agg.Signature, nil
+}
+
+// aggregateKeysign fetches the partials of a keysign from the messenger and
+// aggregates them
+func (h *CliHandler) aggregateKeysign(keygen *DKGResult, requestID string, vk, root []byte) (*AggregatedSignature, error) {
+	sharePKs, err := sharePubKeys(keygen)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+	published, err := h.messengerClient().TopicPartials(ctx, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch partials of keysign %s: %w", requestID, err)
+	}
+	return aggregatePartials(published.Partials, sharePKs, vk, root)
+}
@@ -0,0 +1,72 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregatePartials(t *testing.T) {
+	types.InitBLS()
+	ks := testingutils.Testing4SharesSet()
+	root := []byte("signing root")
+	validatorPK := ks.ValidatorPK.Serialize()
+	sharePKs := make(map[types.OperatorID]*bls.PublicKey)
+	partials := make(map[types.OperatorID][]byte)
+	for operatorID, share := range ks.Shares {
+		sharePKs[operatorID] = share.GetPublicKey()
+		partials[operatorID] = share.SignByte(root).Serialize()
+	}
+	expected := hex.EncodeToString(ks.ValidatorSK.SignByte(root).Serialize())
+
+	agg, err := aggregatePartials(partials, sharePKs, validatorPK, root)
+	require.NoError(t, err)
+	require.Equal(t, expected, agg.Signature)
+	require.Equal(t, []types.OperatorID{1, 2, 3}, agg.Signers, "the first threshold of valid partials is enough")
+	require.Empty(t, agg.Rejected)
+
+	// operator 1 signs something else, operator 5 isn't in the committee
+	partials[1] = ks.Shares[1].SignByte([]byte("other root")).Serialize()
+	partials[5] = ks.Shares[2].SignByte(root).Serialize()
+	agg, err = aggregatePartials(partials, sharePKs, validatorPK, root)
+	require.NoError(t, err)
+	require.Equal(t, expected, agg.Signature)
+	require.Equal(t, []types.OperatorID{2, 3, 4}, agg.Signers)
+	require.Len(t, agg.Rejected, 2)
+	require.Equal(t, types.OperatorID(1), agg.Rejected[0].Operator)
+	require.Contains(t, agg.Rejected[0].Reason, "doesn't verify")
+	require.Equal(t, types.OperatorID(5), agg.Rejected[1].Operator)
+
+	// below the threshold nothing verifies
+	partials[4] = []byte("garbage")
+	agg, err = aggregatePartials(partials, sharePKs, validatorPK, root)
+	require.ErrorContains(t, err, "don't reach the threshold")
+	require.Equal(t, []types.OperatorID{2, 3}, agg.Signers)
+	require.Len(t, agg.Rejected, 3)
+	require.Contains(t, agg.Rejected[1].Reason, "invalid signature encoding")
+}
@@ -0,0 +1,99 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// negotiateLimits fetches the limits of the messenger and of every node taking
+// part in a ceremony and checks the ceremony against the smallest of each. The
+// negotiated limits go to the nodes with the start message. A node that can't
+// be reached is left out, delivering the start message reports it.
+func (h *CliHandler) negotiateLimits(committee int, initMsg []byte, participants ...map[types.OperatorID]string) (*ceremony.Limits, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+
+	messengerLimits, err := h.messengerClient().Limits(ctx)
+	if err != nil {
+		return nil, unreachable(fmt.Errorf("failed to get messenger limits: %w", err))
+	}
+	all := []ceremony.Limits{messengerLimits}
+
+	operators := make(map[types.OperatorID]bool)
+	for _, addrs := range participants {
+		for operatorID, addr := range addrs {
+			if operators[operatorID] {
+				continue
+			}
+			operators[operatorID] = true
+			limits, err := h.nodeLimits(addr)
+			if err != nil {
+				h.logger.Warnf("negotiateLimits: failed to get limits of operator %d: %v", operatorID, err)
+				continue
+			}
+			all = append(all, limits)
+		}
+	}
+
+	negotiated := ceremony.Negotiate(all...)
+	if err := negotiated.CheckOperators(len(operators)); err != nil {
+		return nil, fail(ConditionValidation, err)
+	}
+	if err := negotiated.CheckMessage(int64(len(initMsg))); err != nil {
+		return nil, fail(ConditionValidation, fmt.Errorf("init message: %w", err))
+	}
+	if err := negotiated.CheckMessage(ceremony.EstimateMessageBytes(committee)); err != nil {
+		return nil, fail(ConditionValidation, fmt.Errorf("round messages of %d operators: %w", committee, err))
+	}
+	return &negotiated, nil
+}
+
+// nodeLimits returns the limits of a node, the defaults for a node that
+// doesn't advertise any
+func (h *CliHandler) nodeLimits(addr string) (ceremony.Limits, error) {
+	resp, err := h.client.Get(addr + "/limits")
+	if err != nil {
+		return ceremony.Limits{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ceremony.DefaultLimits, nil
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return ceremony.Limits{}, fmt.Errorf("request failed with status %s: %s", resp.Status, string(respBody))
+	}
+	limits := ceremony.Limits{}
+	if err := json.Unmarshal(respBody, &limits); err != nil {
+		return ceremony.Limits{}, err
+	}
+	return limits.OrDefault(), nil
+}
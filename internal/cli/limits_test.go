@@ -0,0 +1,68 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func limitsServer(t *testing.T, limits *ceremony.Limits) string {
+	r := gin.New()
+	if limits != nil {
+		r.GET("/limits", func(c *gin.Context) { c.JSON(http.StatusOK, limits) })
+	}
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestNegotiateLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(logrus.New())
+	h.messengerAddr = limitsServer(t, &ceremony.Limits{MaxMessageBytes: 1 << 19})
+	operators := map[types.OperatorID]string{
+		1: limitsServer(t, &ceremony.Limits{MaxOperators: 7}),
+		2: limitsServer(t, &ceremony.Limits{MaxBatchSize: 100}),
+		3: limitsServer(t, nil),
+		4: "http://127.0.0.1:1",
+	}
+
+	limits, err := h.negotiateLimits(4, make([]byte, 1024), operators)
+	require.NoError(t, err)
+	require.Equal(t, &ceremony.Limits{MaxOperators: 7, MaxMessageBytes: 1 << 19, MaxBatchSize: 100}, limits)
+
+	observers := map[types.OperatorID]string{5: operators[3], 6: operators[3], 7: operators[3], 8: operators[3]}
+	_, err = h.negotiateLimits(4, make([]byte, 1024), operators, observers)
+	require.Equal(t, ExitValidation, ExitCode(err), "8 participants, operator 1 takes 7")
+
+	_, err = h.negotiateLimits(4, make([]byte, 1<<20), operators)
+	require.Equal(t, ExitValidation, ExitCode(err), "init message over the messenger limit")
+}
@@ -0,0 +1,448 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+type LintSeverity string
+
+const (
+	// LintWarning findings are printed, --strict turns them into errors
+	LintWarning LintSeverity = "warning"
+	// LintError findings always stop the ceremony, the nodes would accept
+	// the parameters but the result would be unusable
+	LintError LintSeverity = "error"
+)
+
+type LintFinding struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+}
+
+// lintLookup answers the optional network questions of the lint pass
+type lintLookup interface {
+	HostIPs(host string) ([]string, error)
+	ASN(ip string) (string, error)
+	MainnetActive(address string) (bool, error)
+}
+
+type ceremonyLinter struct {
+	lookup lintLookup
+}
+
+func lintFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "strict",
+			Usage: "refuse to start the ceremony when the parameter lint has warnings",
+		},
+		&cli.BoolFlag{
+			Name:  "lint-lookup",
+			Usage: "resolve operator hosts, their ASN and the withdrawal address on mainnet during the parameter lint",
+		},
+	}
+}
+
+func (h *CliHandler) newLinter(c *cli.Context) *ceremonyLinter {
+	if !c.Bool("lint-lookup") {
+		return &ceremonyLinter{}
+	}
+	asnURL := os.Getenv("LINT_ASN_URL")
+	if asnURL == "" {
+		asnURL = "https://api.iptoasn.com/v1/as/ip/"
+	}
+	return &ceremonyLinter{lookup: &httpLintLookup{
+		client:     h.client,
+		asnURL:     asnURL,
+		mainnetRPC: os.Getenv("LINT_MAINNET_RPC"),
+	}}
+}
+
+func (l *ceremonyLinter) LintKeygen(request *KeygenRequest) []LintFinding {
+	findings := l.lintCommittee(request.Operators, request.Threshold)
+
+	network := types.NetworkFromString(request.ForkVersion)
+	if network == "" {
+		findings = append(findings, LintFinding{
+			Rule:     "unknown_fork_version",
+			Severity: LintError,
+			Message:  fmt.Sprintf("fork version %q is not a known network, deposit data would be signed for an unusable fork", request.ForkVersion),
+		})
+	}
+
+	credentials, err := hexenc.ParseWithdrawalCredentials(request.WithdrawalCredential)
+	if err != nil {
+		return append(findings, LintFinding{
+			Rule:     "invalid_withdrawal_credentials",
+			Severity: LintError,
+			Message:  "withdrawal credentials must be 32 bytes of hex",
+		})
+	}
+	switch credentials[0] {
+	case types.BLSWithdrawalPrefixByte:
+		findings = append(findings, LintFinding{
+			Rule:     "bls_withdrawal_credentials",
+			Severity: LintWarning,
+			Message:  "0x00 withdrawal credentials need a bls-to-execution-change before withdrawals are possible",
+		})
+	case 0x01:
+		if !bytes.Equal(credentials[1:12], make([]byte, 11)) {
+			findings = append(findings, LintFinding{
+				Rule:     "invalid_withdrawal_credentials",
+				Severity: LintError,
+				Message:  "0x01 withdrawal credentials must pad the execution address with zeros",
+			})
+			break
+		}
+		if network != "" && network != types.MainNetwork && l.lookup != nil {
+			address := "0x" + hex.EncodeToString(credentials[12:])
+			active, err := l.lookup.MainnetActive(address)
+			if err != nil {
+				findings = append(findings, lookupFailed("withdrawal address", err))
+			} else if active {
+				findings = append(findings, LintFinding{
+					Rule:     "testnet_fork_mainnet_address",
+					Severity: LintWarning,
+					Message:  fmt.Sprintf("withdrawal address %s is in use on mainnet but the ceremony is for %s", address, network),
+				})
+			}
+		}
+	default:
+		findings = append(findings, LintFinding{
+			Rule:     "invalid_withdrawal_credentials",
+			Severity: LintError,
+			Message:  fmt.Sprintf("unknown withdrawal credentials prefix 0x%02x", credentials[0]),
+		})
+	}
+	return findings
+}
+
+func (l *ceremonyLinter) LintResharing(request *ResharingRequest) []LintFinding {
+	findings := l.lintCommittee(request.Operators, request.Threshold)
+
+	if _, err := hexenc.ParseValidatorPK(request.ValidatorPK); err != nil {
+		findings = append(findings, LintFinding{
+			Rule:     "invalid_validator_pk",
+			Severity: LintError,
+			Message:  "validator pk must be 48 bytes of hex",
+		})
+	}
+
+	same := len(request.Operators) == len(request.OperatorsOld)
+	for operatorID := range request.Operators {
+		if _, ok := request.OperatorsOld[operatorID]; !ok {
+			same = false
+		}
+	}
+	if same {
+		findings = append(findings, LintFinding{
+			Rule:     "unchanged_committee",
+			Severity: LintWarning,
+			Message:  "new committee is the same as the old one",
+		})
+	}
+	for operatorID, addr := range request.OperatorsOld {
+		if newAddr, ok := request.Operators[operatorID]; ok && normalizeEndpoint(newAddr) != normalizeEndpoint(addr) {
+			findings = append(findings, LintFinding{
+				Rule:     "endpoint_mismatch",
+				Severity: LintWarning,
+				Message:  fmt.Sprintf("operator %d has different endpoints in the old and new committee", operatorID),
+			})
+		}
+	}
+	return findings
+}
+
+// lintCommittee runs the rules shared by keygen and resharing
+func (l *ceremonyLinter) lintCommittee(operators map[types.OperatorID]string, threshold int) []LintFinding {
+	findings := []LintFinding{}
+	n := len(operators)
+
+	switch {
+	case threshold <= 0 || threshold > n:
+		findings = append(findings, LintFinding{
+			Rule:     "invalid_threshold",
+			Severity: LintError,
+			Message:  fmt.Sprintf("threshold %d must be between 1 and the %d operators", threshold, n),
+		})
+	case threshold == n:
+		findings = append(findings, LintFinding{
+			Rule:     "threshold_equals_operators",
+			Severity: LintWarning,
+			Message:  fmt.Sprintf("threshold %d equals the operator count, a single offline operator stops the validator", threshold),
+		})
+	case threshold*2 <= n:
+		findings = append(findings, LintFinding{
+			Rule:     "threshold_below_majority",
+			Severity: LintWarning,
+			Message:  fmt.Sprintf("threshold %d of %d lets a minority of operators sign", threshold, n),
+		})
+	}
+	if n > 0 && ceremony.CheckCommittee(n, ceremony.ThresholdFor(n)) != nil {
+		findings = append(findings, LintFinding{
+			Rule:     "committee_size",
+			Severity: LintError,
+			Message:  fmt.Sprintf("%d operators is not a supported committee, the nodes only run committees of %v operators", n, ceremony.CommitteeSizes),
+		})
+	}
+
+	endpoints := make(map[string][]types.OperatorID)
+	for operatorID, addr := range operators {
+		endpoint := normalizeEndpoint(addr)
+		endpoints[endpoint] = append(endpoints[endpoint], operatorID)
+	}
+	for endpoint, ids := range endpoints {
+		if len(ids) > 1 {
+			findings = append(findings, LintFinding{
+				Rule:     "duplicate_endpoint",
+				Severity: LintWarning,
+				Message:  fmt.Sprintf("operators %s share the endpoint %s", formatOperatorIDs(ids), endpoint),
+			})
+		}
+	}
+
+	if l.lookup != nil {
+		findings = append(findings, l.lintHosts(operators)...)
+	}
+	return findings
+}
+
+// lintHosts warns about operators running on the same ip or in the same
+// autonomous system, one outage would take them all down
+func (l *ceremonyLinter) lintHosts(operators map[types.OperatorID]string) []LintFinding {
+	findings := []LintFinding{}
+	ips := make(map[string][]types.OperatorID)
+	asns := make(map[string][]types.OperatorID)
+
+	for operatorID, addr := range operators {
+		host := endpointHost(addr)
+		hostIPs, err := l.lookup.HostIPs(host)
+		if err != nil {
+			findings = append(findings, lookupFailed(host, err))
+			continue
+		}
+		seenASN := make(map[string]bool)
+		for _, ip := range hostIPs {
+			ips[ip] = append(ips[ip], operatorID)
+
+			asn, err := l.lookup.ASN(ip)
+			if err != nil {
+				findings = append(findings, lookupFailed(ip, err))
+				continue
+			}
+			if asn != "" && !seenASN[asn] {
+				seenASN[asn] = true
+				asns[asn] = append(asns[asn], operatorID)
+			}
+		}
+	}
+
+	for ip, ids := range ips {
+		if len(ids) > 1 {
+			findings = append(findings, LintFinding{
+				Rule:     "shared_ip",
+				Severity: LintWarning,
+				Message:  fmt.Sprintf("operators %s resolve to the same ip %s", formatOperatorIDs(ids), ip),
+			})
+		}
+	}
+	for asn, ids := range asns {
+		if len(ids) > 1 {
+			findings = append(findings, LintFinding{
+				Rule:     "shared_asn",
+				Severity: LintWarning,
+				Message:  fmt.Sprintf("operators %s are hosted in the same autonomous system AS%s", formatOperatorIDs(ids), asn),
+			})
+		}
+	}
+	return findings
+}
+
+// reportLint prints the findings and returns an error when the ceremony must not start
+func reportLint(findings []LintFinding, strict bool) error {
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Rule < findings[j].Rule })
+
+	blocking := 0
+	for _, f := range findings {
+		fmt.Printf("lint %s [%s]: %s\n", f.Severity, f.Rule, f.Message)
+		if f.Severity == LintError || strict {
+			blocking++
+		}
+	}
+	if blocking > 0 {
+		return fail(ConditionValidation, fmt.Errorf("ceremony parameters failed lint with %d blocking findings", blocking))
+	}
+	return nil
+}
+
+func lookupFailed(target string, err error) LintFinding {
+	return LintFinding{
+		Rule:     "lookup_failed",
+		Severity: LintWarning,
+		Message:  fmt.Sprintf("failed to look up %s: %v", target, err),
+	}
+}
+
+func normalizeEndpoint(addr string) string {
+	u, err := url.Parse(strings.TrimSpace(addr))
+	if err != nil || u.Host == "" {
+		return strings.ToLower(strings.TrimRight(addr, "/"))
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return strings.ToLower(net.JoinHostPort(host, port))
+}
+
+func endpointHost(addr string) string {
+	host, _, err := net.SplitHostPort(normalizeEndpoint(addr))
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+func formatOperatorIDs(ids []types.OperatorID) string {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	strs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strs = append(strs, fmt.Sprintf("%d", id))
+	}
+	return strings.Join(strs, ", ")
+}
+
+type httpLintLookup struct {
+	client     *http.Client
+	asnURL     string
+	mainnetRPC string
+}
+
+func (l *httpLintLookup) HostIPs(host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP.String())
+	}
+	return ips, nil
+}
+
+func (l *httpLintLookup) ASN(ip string) (string, error) {
+	if parsed := net.ParseIP(ip); parsed == nil || parsed.IsPrivate() || parsed.IsLoopback() {
+		return "", nil
+	}
+
+	resp, err := l.client.Get(l.asnURL + ip)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("asn lookup failed with status %s", resp.Status)
+	}
+
+	result := struct {
+		Announced bool  `json:"announced"`
+		ASNumber  int64 `json:"as_number"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if !result.Announced || result.ASNumber == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%d", result.ASNumber), nil
+}
+
+// MainnetActive reports whether the address sent transactions or holds code on
+// mainnet, the check is skipped when no mainnet rpc is configured
+func (l *httpLintLookup) MainnetActive(address string) (bool, error) {
+	if l.mainnetRPC == "" {
+		return false, nil
+	}
+
+	nonce, err := l.ethCall("eth_getTransactionCount", address)
+	if err != nil {
+		return false, err
+	}
+	code, err := l.ethCall("eth_getCode", address)
+	if err != nil {
+		return false, err
+	}
+	return nonce != "0x0" || code != "0x", nil
+}
+
+func (l *httpLintLookup) ethCall(method, address string) (string, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  []string{address, "latest"},
+	})
+	resp, err := l.client.Post(l.mainnetRPC, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	result := struct {
+		Result string    `json:"result"`
+		Error  *RPCError `json:"error"`
+	}{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("%s: %w", method, err)
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf("%s: %s", method, result.Error.Message)
+	}
+	return result.Result, nil
+}
@@ -0,0 +1,141 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLintLookup struct {
+	ips     map[string][]string
+	asns    map[string]string
+	mainnet map[string]bool
+}
+
+func (l *fakeLintLookup) HostIPs(host string) ([]string, error) {
+	ips, ok := l.ips[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return ips, nil
+}
+
+func (l *fakeLintLookup) ASN(ip string) (string, error) { return l.asns[ip], nil }
+
+func (l *fakeLintLookup) MainnetActive(address string) (bool, error) { return l.mainnet[address], nil }
+
+func lintRules(findings []LintFinding) []string {
+	rules := []string{}
+	for _, f := range findings {
+		rules = append(rules, f.Rule)
+	}
+	return rules
+}
+
+func testKeygenRequest() *KeygenRequest {
+	return &KeygenRequest{
+		Operators: map[types.OperatorID]string{
+			1: "http://10.0.0.1:8081",
+			2: "http://10.0.0.2:8081",
+			3: "http://10.0.0.3:8081",
+			4: "http://10.0.0.4:8081",
+		},
+		Threshold:            3,
+		WithdrawalCredential: "0100000000000000000000001d2f14d2dffee594b4093d42e4bc1b0ea55e8aa7",
+		ForkVersion:          "prater",
+	}
+}
+
+func TestLintKeygenClean(t *testing.T) {
+	findings := (&ceremonyLinter{}).LintKeygen(testKeygenRequest())
+	require.Empty(t, findings)
+	require.NoError(t, reportLint(findings, true))
+}
+
+func TestLintKeygenWarnings(t *testing.T) {
+	request := testKeygenRequest()
+	request.Threshold = 4
+	request.Operators[4] = "http://10.0.0.3:8081/"
+
+	findings := (&ceremonyLinter{}).LintKeygen(request)
+	require.ElementsMatch(t, []string{"threshold_equals_operators", "duplicate_endpoint"}, lintRules(findings))
+	require.NoError(t, reportLint(findings, false))
+	require.Error(t, reportLint(findings, true))
+}
+
+func TestLintKeygenErrors(t *testing.T) {
+	request := testKeygenRequest()
+	request.ForkVersion = "goerli"
+	request.WithdrawalCredential = "02"
+
+	findings := (&ceremonyLinter{}).LintKeygen(request)
+	require.ElementsMatch(t, []string{"unknown_fork_version", "invalid_withdrawal_credentials"}, lintRules(findings))
+	require.Error(t, reportLint(findings, false))
+}
+
+func TestLintKeygenCommitteeSize(t *testing.T) {
+	request := testKeygenRequest()
+	request.Operators[5] = "http://10.0.0.5:8081"
+
+	findings := (&ceremonyLinter{}).LintKeygen(request)
+	require.Equal(t, []string{"committee_size"}, lintRules(findings))
+	require.Error(t, reportLint(findings, false))
+
+	for i := 6; i <= 13; i++ {
+		request.Operators[types.OperatorID(i)] = fmt.Sprintf("http://10.0.0.%d:8081", i)
+	}
+	request.Threshold = 9
+	require.Empty(t, (&ceremonyLinter{}).LintKeygen(request))
+}
+
+func TestLintKeygenLookup(t *testing.T) {
+	lookup := &fakeLintLookup{
+		ips: map[string][]string{
+			"10.0.0.1": {"1.1.1.1"},
+			"10.0.0.2": {"1.1.1.1"},
+			"10.0.0.3": {"2.2.2.2"},
+			"10.0.0.4": {"3.3.3.3"},
+		},
+		asns:    map[string]string{"1.1.1.1": "13335", "2.2.2.2": "16509", "3.3.3.3": "16509"},
+		mainnet: map[string]bool{"0x1d2f14d2dffee594b4093d42e4bc1b0ea55e8aa7": true},
+	}
+
+	findings := (&ceremonyLinter{lookup: lookup}).LintKeygen(testKeygenRequest())
+	require.ElementsMatch(t, []string{"shared_ip", "shared_asn", "shared_asn", "testnet_fork_mainnet_address"}, lintRules(findings))
+}
+
+func TestLintResharing(t *testing.T) {
+	request := &ResharingRequest{
+		Operators:    map[types.OperatorID]string{1: "http://a:1", 2: "http://b:1", 3: "http://c:1", 4: "http://d:1"},
+		OperatorsOld: map[types.OperatorID]string{1: "http://a:2", 2: "http://b:1", 3: "http://c:1", 4: "http://d:1"},
+		Threshold:    3,
+		ValidatorPK:  "adf8b634f1c2bb64fe61af95b208a2a7bdac0d2d15963f83463bdb85c7e726250bfa3a390bf01edfc0700d61f4bee579",
+	}
+
+	findings := (&ceremonyLinter{}).LintResharing(request)
+	require.ElementsMatch(t, []string{"unchanged_committee", "endpoint_mismatch"}, lintRules(findings))
+}
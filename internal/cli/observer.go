@@ -0,0 +1,107 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+func observerFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "observer",
+		Usage: "observer key-value pair, an operator verifying the transcript without holding a share",
+	}
+}
+
+// parseObservers reads the --observer pairs, an observer can't be part of the
+// committees it observes
+func parseObservers(c *cli.Context, committees ...map[types.OperatorID]string) (map[types.OperatorID]string, error) {
+	if len(c.StringSlice("observer")) == 0 {
+		return nil, nil
+	}
+	book, err := loadBookFor(c.StringSlice("observer"))
+	if err != nil {
+		return nil, err
+	}
+	observers, err := parseOperatorPairs(c.StringSlice("observer"), book)
+	if err != nil {
+		return nil, err
+	}
+	for operatorID := range observers {
+		for _, committee := range committees {
+			if _, ok := committee[operatorID]; ok {
+				return nil, fmt.Errorf("operator %d can't observe a ceremony it takes part in", operatorID)
+			}
+		}
+	}
+	return observers, nil
+}
+
+// withObservers adds the observers to the operators subscribed to the ceremony topic
+func withObservers(operators []types.OperatorID, observers map[types.OperatorID]string) []types.OperatorID {
+	members := append([]types.OperatorID{}, operators...)
+	for operatorID := range observers {
+		members = append(members, operatorID)
+	}
+	return members
+}
+
+// inviteObservers hands the start message to the observers before the
+// committee gets it, so they don't miss any broadcast
+func (h *CliHandler) inviteObservers(requestIDInHex string, observers map[types.OperatorID]string, msg []byte) error {
+	for operatorID, addr := range observers {
+		if err := h.sendInitMsg(operatorID, addr+"/observe", msg); err != nil {
+			return fmt.Errorf("failed to invite observer %d: %w", operatorID, err)
+		}
+		h.events.emit(&EventRecord{Event: EventObserverInvited, RequestID: requestIDInHex, Operator: operatorID})
+	}
+	return nil
+}
+
+// fetchAttestations collects the attestation of every observer and checks its
+// signature against the observer's registry key
+func (h *CliHandler) fetchAttestations(requestID string, observers map[types.OperatorID]string) ([]*observer.Attestation, error) {
+	attestations := make([]*observer.Attestation, 0, len(observers))
+	for operatorID, addr := range observers {
+		attestation := &observer.Attestation{}
+		if err := h.getNodeJSON(fmt.Sprintf("%s/observe/%s", addr, requestID), attestation); err != nil {
+			return nil, fmt.Errorf("failed to get attestation of observer %d: %w", operatorID, err)
+		}
+		if attestation.Observer != operatorID || attestation.RequestID != requestID {
+			return nil, fmt.Errorf("observer %d returned the attestation of operator %d for request %s", operatorID, attestation.Observer, attestation.RequestID)
+		}
+		operator, err := storage.FetchOperatorByID(operatorID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get encryption key of observer %d: %w", operatorID, err)
+		}
+		if err := attestation.Verify(operator.EncryptionPubKey); err != nil {
+			return nil, err
+		}
+		attestations = append(attestations, attestation)
+	}
+	return attestations, nil
+}
@@ -0,0 +1,102 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// pacing is how long the cli holds back the start message of an overloaded
+// node: it checks again after Backoff, doubled up to MaxBackoff, and gives up
+// on the node after MaxWait
+type pacing struct {
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	MaxWait    time.Duration
+}
+
+var defaultPacing = pacing{
+	Backoff:    time.Second,
+	MaxBackoff: 30 * time.Second,
+	MaxWait:    5 * time.Minute,
+}
+
+// nodeLoad returns the load a node reports on /health, nil for a node too
+// old to report any
+func (h *CliHandler) nodeLoad(addr string) (*node.Load, error) {
+	resp, err := h.client.Get(addr + "/health")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// a node low on disk answers 503 with its load all the same
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("request failed with status %s", resp.Status)
+	}
+	health := struct {
+		Load *node.Load `json:"load"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, err
+	}
+	return health.Load, nil
+}
+
+// awaitCapacity holds back the start message of a node while it reports
+// itself overloaded, so a batch of ceremonies slows down to the pace of the
+// node instead of running into http timeouts. Nodes that don't report their
+// load, or can't be asked, get the message right away.
+func (h *CliHandler) awaitCapacity(requestID string, operatorID types.OperatorID, addr string) error {
+	backoff := h.pacing.Backoff
+	deadline := time.Now().Add(h.pacing.MaxWait)
+	for {
+		load, err := h.nodeLoad(addr)
+		if err != nil {
+			h.logger.Debugf("awaitCapacity: failed to get load of operator %d: %v", operatorID, err)
+			return nil
+		}
+		if load == nil || !load.Overloaded {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("operator %d is still overloaded after %s with %d queued messages", operatorID, h.pacing.MaxWait, load.QueueDepth)
+		}
+		h.logger.Infof("awaitCapacity: operator %d is overloaded with %d active ceremonies and %d queued messages, retrying in %s", operatorID, load.ActiveCeremonies, load.QueueDepth, backoff)
+		h.events.emit(&EventRecord{
+			Event:     EventNodeOverloaded,
+			RequestID: requestID,
+			Operator:  operatorID,
+			Details:   fmt.Sprintf("%d queued messages, retrying in %s", load.QueueDepth, backoff),
+		})
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > h.pacing.MaxBackoff {
+			backoff = h.pacing.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// loadServer reports the node overloaded on the first overloaded health checks
+func loadServer(t *testing.T, overloaded int32) (string, *int32) {
+	checks := new(int32)
+	r := gin.New()
+	r.GET("/health", func(c *gin.Context) {
+		n := atomic.AddInt32(checks, 1)
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "load": &node.Load{QueueDepth: 100, Overloaded: n <= overloaded}})
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv.URL, checks
+}
+
+func TestAwaitCapacity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := New(logrus.New())
+	h.pacing = pacing{Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxWait: 100 * time.Millisecond}
+
+	addr, checks := loadServer(t, 3)
+	require.NoError(t, h.awaitCapacity("0a0b", 1, addr))
+	require.EqualValues(t, 4, atomic.LoadInt32(checks), "held back until the node caught up")
+
+	addr, _ = loadServer(t, 1<<20)
+	require.Error(t, h.awaitCapacity("0a0b", 1, addr), "still overloaded after the max wait")
+
+	// older nodes don't report their load, unreachable ones fail on the start message
+	require.NoError(t, h.awaitCapacity("0a0b", 1, limitsServer(t, nil)))
+	require.NoError(t, h.awaitCapacity("0a0b", 1, "http://127.0.0.1:1"))
+}
@@ -0,0 +1,171 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/urfave/cli/v2"
+)
+
+var requestIDLabel = []byte("rockx-dkg-request-id")
+
+// requestIDSchemes derive the request ID of a ceremony from the value of
+// --request-id given as scheme:value, a value without scheme is the request
+// ID itself in hex
+var requestIDSchemes = map[string]func(value string) (dkg.RequestID, error){
+	"hex":   hexRequestID,
+	"owner": ownerRequestID,
+	"hash":  hashRequestID,
+}
+
+func requestIDFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "request-id",
+		Usage: "request id of the ceremony instead of a random one: 48 hex characters, owner:<address>:<nonce>:<batch index> or hash:<any identifier>",
+	}
+}
+
+// newRequestID returns the request ID of a new ceremony, a random one when
+// the caller didn't supply one
+func newRequestID(spec string) (dkg.RequestID, error) {
+	if spec == "" {
+		return getRandRequestID(), nil
+	}
+	scheme, value, ok := strings.Cut(spec, ":")
+	if !ok {
+		scheme, value = "hex", spec
+	}
+	derive, ok := requestIDSchemes[scheme]
+	if !ok {
+		return dkg.RequestID{}, fmt.Errorf("unknown request id scheme %q, expected one of %s", scheme, strings.Join(requestIDSchemeNames(), ", "))
+	}
+	requestID, err := derive(value)
+	if err != nil {
+		return dkg.RequestID{}, fmt.Errorf("invalid %s request id: %w", scheme, err)
+	}
+	return requestID, nil
+}
+
+func requestIDSchemeNames() []string {
+	names := make([]string, 0, len(requestIDSchemes))
+	for name := range requestIDSchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hexRequestID(value string) (dkg.RequestID, error) {
+	return hexenc.ParseRequestID(value)
+}
+
+// lookupRequestID is the --request-id of an existing ceremony in the form
+// nodes, the messenger and the local caches key ceremonies by
+func lookupRequestID(c *cli.Context) (string, error) {
+	requestID, err := hexenc.RequestIDKey(c.String("request-id"))
+	if err != nil {
+		return "", fail(ConditionValidation, fmt.Errorf("invalid --request-id: %w", err))
+	}
+	return requestID, nil
+}
+
+// ownerRequestID keeps the owner address in the first 20 bytes, where the
+// ssv spec expects it, and fills the last 4 with a hash of nonce and batch
+// index. Two nonces of an owner may collide, the nodes refuse a request ID
+// they saw for another ceremony.
+func ownerRequestID(value string) (dkg.RequestID, error) {
+	requestID := dkg.RequestID{}
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return requestID, fmt.Errorf("expected <address>:<nonce>:<batch index>")
+	}
+	if !common.IsHexAddress(parts[0]) {
+		return requestID, fmt.Errorf("invalid owner address %q", parts[0])
+	}
+	nonce, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return requestID, fmt.Errorf("invalid nonce: %w", err)
+	}
+	index, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return requestID, fmt.Errorf("invalid batch index: %w", err)
+	}
+
+	data := append([]byte{}, requestIDLabel...)
+	data = binary.BigEndian.AppendUint64(data, nonce)
+	data = binary.BigEndian.AppendUint32(data, uint32(index))
+	hash := sha256.Sum256(data)
+	address := common.HexToAddress(parts[0])
+	copy(requestID[:common.AddressLength], address[:])
+	copy(requestID[common.AddressLength:], hash[:])
+	return requestID, nil
+}
+
+// hashRequestID hashes an identifier of the caller, e.g. a uuid of its own
+func hashRequestID(value string) (dkg.RequestID, error) {
+	requestID := dkg.RequestID{}
+	if value == "" {
+		return requestID, fmt.Errorf("empty identifier")
+	}
+	hash := sha256.Sum256(append(append([]byte{}, requestIDLabel...), value...))
+	copy(requestID[:], hash[:])
+	return requestID, nil
+}
+
+// checkRequestIDUnused asks the operators whether they saw a request ID the
+// caller supplied. Nodes that can't be asked are skipped, they refuse a taken
+// request ID themselves when the start message arrives.
+func (h *CliHandler) checkRequestIDUnused(requestID string, operators map[types.OperatorID]string) error {
+	ids := make([]types.OperatorID, 0, len(operators))
+	for operatorID := range operators {
+		ids = append(ids, operatorID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, operatorID := range ids {
+		resp, err := h.client.Get(fmt.Sprintf("%s/ceremonies/%s", operators[operatorID], requestID))
+		if err != nil {
+			h.logger.Warnf("checkRequestIDUnused: failed to ask operator %d for request %s: %v", operatorID, requestID, err)
+			continue
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+		case http.StatusOK:
+			return fail(ConditionValidation, fmt.Errorf("request id %s is already used by operator %d", requestID, operatorID))
+		default:
+			h.logger.Warnf("checkRequestIDUnused: operator %d answered %s for request %s", operatorID, resp.Status, requestID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRequestID(t *testing.T) {
+	random, err := newRequestID("")
+	require.NoError(t, err)
+	other, err := newRequestID("")
+	require.NoError(t, err)
+	require.NotEqual(t, random, other)
+
+	explicit := "9a45c1f30a9896c5263508c2a132ebf7fc7e3c37ab86c74b"
+	requestID, err := newRequestID(explicit)
+	require.NoError(t, err)
+	require.Equal(t, explicit, hex.EncodeToString(requestID[:]))
+	requestID, err = newRequestID("hex:0x" + explicit)
+	require.NoError(t, err)
+	require.Equal(t, explicit, hex.EncodeToString(requestID[:]))
+	_, err = newRequestID("9a45")
+	require.ErrorContains(t, err, "expected 24")
+
+	owner := "0x1d2f14d2dffee594b4093d42e4bc1b0ea55e8aa7"
+	requestID, err = newRequestID("owner:" + owner + ":7:0")
+	require.NoError(t, err)
+	require.Equal(t, owner, "0x"+hex.EncodeToString(requestID[:20]), "the owner address comes first")
+	again, err := newRequestID("owner:" + owner + ":7:0")
+	require.NoError(t, err)
+	require.Equal(t, requestID, again, "derived deterministically")
+	next, err := newRequestID("owner:" + owner + ":7:1")
+	require.NoError(t, err)
+	require.NotEqual(t, requestID, next)
+	_, err = newRequestID("owner:" + owner + ":7")
+	require.Error(t, err)
+
+	hashed, err := newRequestID("hash:batch-2024-01/17")
+	require.NoError(t, err)
+	again, err = newRequestID("hash:batch-2024-01/17")
+	require.NoError(t, err)
+	require.Equal(t, hashed, again)
+
+	_, err = newRequestID("uuid:17")
+	require.ErrorContains(t, err, "unknown request id scheme")
+}
+
+func TestCheckRequestIDUnused(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const used = "9a45c1f30a9896c5263508c2a132ebf7fc7e3c37ab86c74b"
+
+	r := gin.New()
+	r.GET("/ceremonies/:request_id", func(c *gin.Context) {
+		if c.Param("request_id") == used {
+			c.JSON(http.StatusOK, gin.H{"request_id": used})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"message": "ceremony not found"})
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	h := New(logrus.New())
+	operators := map[types.OperatorID]string{1: srv.URL, 2: "http://127.0.0.1:1"}
+	require.NoError(t, h.checkRequestIDUnused("00", operators), "operator 2 can't be asked")
+	require.Equal(t, ExitValidation, ExitCode(h.checkRequestIDUnused(used, operators)))
+}
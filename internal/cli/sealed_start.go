@@ -0,0 +1,156 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// sealStart relays the start message through the messenger encrypted to the
+// registry key of every operator, the messenger only sees the topic and the
+// operator ids. It replaces posting the message to each node.
+func (h *CliHandler) sealStart(requestIDInHex string, operators []types.OperatorID, timeouts ceremony.PhaseTimeouts, approvals []*coordinator.Approval, limits *ceremony.Limits, canaryTTL time.Duration, claim *ceremony.VersionClaim, options ceremony.Options, manifest *ceremony.SignedManifest, msg []byte) error {
+	query := consumeQuery(timeouts, approvals, limits, canaryTTL, claim, options, manifest)
+	sealed := &messenger.SealedStart{Envelopes: make(map[string]*encryption.Envelope)}
+	for _, operatorID := range operators {
+		operator, err := storage.FetchOperatorByID(operatorID)
+		if err != nil {
+			return fmt.Errorf("failed to get encryption key of operator %d: %w", operatorID, err)
+		}
+		envelope, err := node.SealStart(operator.EncryptionPubKey, requestIDInHex, msg, query)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt start message to operator %d: %w", operatorID, err)
+		}
+		sealed.Envelopes[strconv.Itoa(int(operatorID))] = envelope
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+	return h.messengerClient().PublishSealed(ctx, requestIDInHex, sealed)
+}
+
+// relayStart publishes the start message to the topic and lets the messenger
+// deliver it to every operator with its retries, for nodes that only reach
+// the messenger. It replaces posting the message to each node.
+func (h *CliHandler) relayStart(requestIDInHex string, operators []types.OperatorID, timeouts ceremony.PhaseTimeouts, approvals []*coordinator.Approval, limits *ceremony.Limits, canaryTTL time.Duration, claim *ceremony.VersionClaim, options ceremony.Options, manifest *ceremony.SignedManifest, msg []byte) error {
+	start := &messenger.RelayedStart{
+		Message: msg,
+		Query:   consumeQuery(timeouts, approvals, limits, canaryTTL, claim, options, manifest).Encode(),
+	}
+	for _, operatorID := range operators {
+		start.Operators = append(start.Operators, strconv.Itoa(int(operatorID)))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+	return h.messengerClient().PublishStart(ctx, requestIDInHex, start)
+}
+
+// delegateStart has the node of the --signer operator sign the start message
+// built by delegatedSigner and publish it to the topic like relayStart. The
+// node adds its version claim and manifest, which it returns with the signed
+// message.
+func (h *CliHandler) delegateStart(requestIDInHex, signerAddr string, operators []types.OperatorID, timeouts ceremony.PhaseTimeouts, approvals []*coordinator.Approval, limits *ceremony.Limits, canaryTTL time.Duration, minVersion uint32, options ceremony.Options, manifest *ceremony.SignedManifest, msg []byte) (*node.InitSignature, error) {
+	request := &node.InitSignRequest{
+		Message:            msg,
+		MinProtocolVersion: minVersion,
+		Query:              consumeQuery(timeouts, approvals, limits, canaryTTL, nil, options, nil).Encode(),
+	}
+	if manifest != nil {
+		request.Manifest = manifest.Manifest
+	}
+	for _, operatorID := range operators {
+		request.Operators = append(request.Operators, strconv.Itoa(int(operatorID)))
+	}
+
+	signature := &node.InitSignature{}
+	if err := h.postNodeJSON(signerAddr+"/init/sign", request, signature); err != nil {
+		return nil, err
+	}
+	if signature.Manifest != nil && manifest != nil && signature.Manifest.Hash != manifest.Hash {
+		return nil, fmt.Errorf("signer returned manifest %s for ceremony %s, expected %s", signature.Manifest.Hash, requestIDInHex, manifest.Hash)
+	}
+	return signature, nil
+}
+
+// checkSigner checks that the --signer operator is in the committee and gets
+// the start message the way its node publishes it: through the messenger, in
+// the clear, and without observers the cli would have to hand it first
+func checkSigner(signer types.OperatorID, committee map[types.OperatorID]string, observers map[types.OperatorID]string, encryptInit bool, options ceremony.Options) error {
+	if signer == 0 {
+		return nil
+	}
+	if _, ok := committee[signer]; !ok {
+		return fail(ConditionValidation, fmt.Errorf("signer %d isn't an operator of the ceremony", signer))
+	}
+	if len(observers) > 0 {
+		return fail(ConditionValidation, fmt.Errorf("--signer can't be combined with observers, they need the start message before the committee"))
+	}
+	if encryptInit || options.Get(ceremony.OptionEncryption) == "on" {
+		return fail(ConditionValidation, fmt.Errorf("--signer can't be combined with --encrypt-init, the signer publishes the start message in the clear"))
+	}
+	return nil
+}
+
+// consumeQuery carries the phase timeouts, coordinator approvals, negotiated
+// limits, version claim, options and signed manifest of a ceremony to the
+// nodes along with its start message
+func consumeQuery(timeouts ceremony.PhaseTimeouts, approvals []*coordinator.Approval, limits *ceremony.Limits, canaryTTL time.Duration, claim *ceremony.VersionClaim, options ceremony.Options, manifest *ceremony.SignedManifest) url.Values {
+	query := timeouts.Query()
+	for key, values := range coordinator.Query(approvals) {
+		query[key] = values
+	}
+	for key, values := range ceremony.CanaryQuery(canaryTTL) {
+		query[key] = values
+	}
+	if limits != nil {
+		for key, values := range limits.Query() {
+			query[key] = values
+		}
+	}
+	if claim != nil {
+		for key, values := range claim.Query() {
+			query[key] = values
+		}
+	}
+	for key, values := range options.Query() {
+		query[key] = values
+	}
+	if manifest != nil {
+		for key, values := range manifest.Query() {
+			query[key] = values
+		}
+	}
+	return query
+}
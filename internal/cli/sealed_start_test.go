@@ -0,0 +1,201 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/node"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealStart(t *testing.T) {
+	t.Setenv("USE_HARDCODED_OPERATORS", "true")
+	gin.SetMode(gin.TestMode)
+
+	requestID := getRandRequestID()
+	request := testKeygenRequest()
+	msg, err := request.initMsgForKeygen(requestID, testingInitSigner())
+	require.NoError(t, err)
+	topicName := hex.EncodeToString(requestID[:])
+
+	m := &messenger.Messenger{Topics: map[string]*messenger.Topic{}}
+	m.WithLogger(logrus.New())
+	topic := messenger.NewTopic(topicName)
+	for _, operator := range []string{"1", "2"} {
+		topic.Subscribers[operator] = &messenger.Subscriber{Name: operator, Outgoing: make(chan *messenger.Message, 1)}
+	}
+	m.Topics[topicName] = topic
+	r := gin.New()
+	r.POST("/topics/:topic_name/sealed", m.HandlePublishSealed())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	h := New(logrus.New())
+	h.messengerAddr = srv.URL
+	timeouts := ceremony.PhaseTimeouts{Round1: time.Minute}
+	require.NoError(t, h.sealStart(topicName, []types.OperatorID{1, 2}, timeouts, nil, nil, 0, nil, nil, nil, msg))
+
+	relayed := <-topic.Subscribers["2"].Outgoing
+	delivery := &messenger.SealedDelivery{}
+	require.NoError(t, json.Unmarshal(relayed.Data, delivery))
+	require.NotContains(t, string(relayed.Data), request.WithdrawalCredential)
+
+	_, err = node.OpenStart(storage.DKGOperators[1].EncryptionKey, topicName, delivery.Envelope)
+	require.Error(t, err, "envelope of operator 2 doesn't open with the key of operator 1")
+	_, err = node.OpenStart(storage.DKGOperators[2].EncryptionKey, "other", delivery.Envelope)
+	require.Error(t, err, "envelope is bound to its topic")
+
+	sealed, err := node.OpenStart(storage.DKGOperators[2].EncryptionKey, topicName, delivery.Envelope)
+	require.NoError(t, err)
+	require.Equal(t, msg, sealed.Message)
+	require.Equal(t, timeouts.Query().Encode(), sealed.Query)
+
+	require.Error(t, h.sealStart(topicName, []types.OperatorID{1, 3}, timeouts, nil, nil, 0, nil, nil, nil, msg), "operator 3 isn't subscribed")
+}
+
+func TestRelayStart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	requestID := getRandRequestID()
+	request := testKeygenRequest()
+	msg, err := request.initMsgForKeygen(requestID, testingInitSigner())
+	require.NoError(t, err)
+	topicName := hex.EncodeToString(requestID[:])
+
+	m := &messenger.Messenger{Topics: map[string]*messenger.Topic{}}
+	m.WithLogger(logrus.New())
+	topic := messenger.NewTopic(topicName)
+	for _, operator := range []string{"1", "2", "5"} {
+		topic.Subscribers[operator] = &messenger.Subscriber{Name: operator, Outgoing: make(chan *messenger.Message, 1)}
+	}
+	m.Topics[topicName] = topic
+	r := gin.New()
+	r.POST("/topics/:topic_name/start", m.HandlePublishStart())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	h := New(logrus.New())
+	h.messengerAddr = srv.URL
+	timeouts := ceremony.PhaseTimeouts{Round1: time.Minute}
+	require.NoError(t, h.relayStart(topicName, []types.OperatorID{1, 2}, timeouts, nil, nil, 0, nil, nil, nil, msg))
+
+	relayed := <-topic.Subscribers["2"].Outgoing
+	require.Equal(t, messenger.RelayedStartPath, relayed.Path)
+	delivery := &messenger.RelayedDelivery{}
+	require.NoError(t, json.Unmarshal(relayed.Data, delivery))
+	require.Equal(t, topicName, delivery.Topic)
+	require.Equal(t, msg, delivery.Message)
+	require.Equal(t, timeouts.Query().Encode(), delivery.Query)
+	require.Len(t, topic.Subscribers["5"].Outgoing, 0, "only the listed operators get the start message")
+
+	require.Error(t, h.relayStart(topicName, []types.OperatorID{1, 3}, timeouts, nil, nil, 0, nil, nil, nil, msg), "operator 3 isn't subscribed")
+}
+
+func TestDelegateStart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	requestID := getRandRequestID()
+	topicName := hex.EncodeToString(requestID[:])
+	request := testKeygenRequest()
+	request.MinProtocolVersion = 1
+	msg, err := request.initMsgForKeygen(requestID, delegatedSigner(1))
+	require.NoError(t, err)
+	require.Nil(t, request.VersionClaim, "the signer claims the version")
+	require.Empty(t, request.Manifest.Signature)
+	manifest := request.Manifest
+
+	m := &messenger.Messenger{Topics: map[string]*messenger.Topic{}}
+	m.WithLogger(logrus.New())
+	topic := messenger.NewTopic(topicName)
+	for _, operator := range []string{"1", "2", "3", "4"} {
+		topic.Subscribers[operator] = &messenger.Subscriber{Name: operator, Outgoing: make(chan *messenger.Message, 1)}
+	}
+	m.Topics[topicName] = topic
+	r := gin.New()
+	r.POST("/topics/:topic_name/start", m.HandlePublishStart())
+	messengerSrv := httptest.NewServer(r)
+	defer messengerSrv.Close()
+
+	sk := testingInitSigner().sk
+	signerNode := gin.New()
+	policy := &node.StartPolicy{Self: 1}
+	signerNode.POST("/init/sign", node.New(logrus.New(), nil).HandleSignInit(policy, messenger.NewMessengerClient(messengerSrv.URL), sk))
+	nodeSrv := httptest.NewServer(signerNode)
+	defer nodeSrv.Close()
+
+	h := New(logrus.New())
+	timeouts := ceremony.PhaseTimeouts{Round1: time.Minute}
+	signature, err := h.delegateStart(topicName, nodeSrv.URL, request.allOperators(), timeouts, nil, nil, 0, request.MinProtocolVersion, nil, manifest, msg)
+	require.NoError(t, err)
+	require.Equal(t, types.OperatorID(1), signature.Signer)
+	require.NoError(t, signature.Manifest.Verify(&sk.PublicKey))
+	require.Equal(t, manifest.Hash, signature.Manifest.Hash)
+	require.Equal(t, uint32(1), signature.VersionClaim.MinVersion)
+
+	unsigned := &dkg.Message{}
+	require.NoError(t, unsigned.Decode(msg))
+	signed, err := testingInitSigner().sign(unsigned)
+	require.NoError(t, err)
+	require.Equal(t, signed, signature.Message, "the node signs the message the cli would have signed with its key")
+
+	relayed := <-topic.Subscribers["3"].Outgoing
+	delivery := &messenger.RelayedDelivery{}
+	require.NoError(t, json.Unmarshal(relayed.Data, delivery))
+	require.Equal(t, signed, delivery.Message)
+	require.Equal(t, signature.Query, delivery.Query)
+	claim, err := ceremony.ParseVersionClaim(mustParseQuery(t, delivery.Query))
+	require.NoError(t, err)
+	require.Equal(t, signature.VersionClaim, claim)
+
+	policy.Self = 7
+	_, err = h.delegateStart(topicName, nodeSrv.URL, request.allOperators(), timeouts, nil, nil, 0, 0, nil, manifest, msg)
+	require.ErrorContains(t, err, "isn't in the committee")
+}
+
+func TestCheckSigner(t *testing.T) {
+	request := testKeygenRequest()
+	require.NoError(t, checkSigner(0, request.Operators, nil, true, nil))
+	require.NoError(t, checkSigner(2, request.Operators, nil, false, nil))
+	require.Error(t, checkSigner(9, request.Operators, nil, false, nil))
+	require.Error(t, checkSigner(2, request.Operators, map[types.OperatorID]string{5: "http://10.0.0.5:8081"}, false, nil))
+	require.Error(t, checkSigner(2, request.Operators, nil, true, nil))
+	require.Error(t, checkSigner(2, request.Operators, nil, false, ceremony.Options{ceremony.OptionEncryption: "on"}))
+}
+
+func mustParseQuery(t *testing.T, query string) url.Values {
+	values, err := url.ParseQuery(query)
+	require.NoError(t, err)
+	return values
+}
@@ -22,16 +22,23 @@
 package cli
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"math/big"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
 	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/middleware"
+	"github.com/RockX-SG/frost-dkg-demo/internal/topiccache"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/cryptosuite"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
@@ -41,6 +48,19 @@ type CliHandler struct {
 	client        *http.Client
 	logger        *logrus.Logger
 	messengerAddr string
+	ceremonies    *ceremonyRegistry
+	// events is the --events-out log of the running command, nil when not set
+	events *eventLog
+	// results are the results serve shares with other coordinators, nil
+	// without --results-dir
+	results *resultStore
+	// pacing holds back start messages to overloaded nodes
+	pacing pacing
+	// batches are the batches of ceremonies started by serve
+	batches *batchRegistry
+	// initiator signs keygen and resharing starts, nil without
+	// --initiator-key and the testing key signs them
+	initiator *initSigner
 }
 
 func New(logger *logrus.Logger) *CliHandler {
@@ -49,13 +69,14 @@ func New(logger *logrus.Logger) *CliHandler {
 
 	return &CliHandler{
 		client: &http.Client{
-			Timeout: 5 * time.Minute,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
+			Timeout:   5 * time.Minute,
+			Transport: clientTransport(messenger.MessengerAddrFromEnv()),
 		},
 		logger:        logger,
 		messengerAddr: messenger.MessengerAddrFromEnv(),
+		ceremonies:    newCeremonyRegistry(),
+		pacing:        defaultPacing,
+		batches:       newBatchRegistry(),
 	}
 }
 
@@ -65,32 +86,50 @@ func (h CliHandler) CommandKeygen() *cli.Command {
 		Aliases: []string{"k"},
 		Usage:   "start keygen process",
 		Action:  h.HandleKeygen,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringSliceFlag{
-				Name:     "operator",
-				Aliases:  []string{"o"},
-				Usage:    "operator key-value pair",
-				Required: true,
+				Name:    "operator",
+				Aliases: []string{"o"},
+				Usage:   "operator key-value pair",
 			},
 			&cli.IntFlag{
-				Name:     "threshold",
-				Aliases:  []string{"t"},
-				Usage:    "threshold value",
-				Required: true,
+				Name:    "threshold",
+				Aliases: []string{"t"},
+				Usage:   "threshold value",
 			},
 			&cli.StringFlag{
-				Name:     "withdrawal-credentials",
-				Aliases:  []string{"w"},
-				Usage:    "withdrawal credential value",
-				Required: true,
+				Name:    "withdrawal-credentials",
+				Aliases: []string{"w"},
+				Usage:   "withdrawal credential value",
 			},
 			&cli.StringFlag{
-				Name:     "fork-version",
-				Aliases:  []string{"f"},
-				Usage:    "fork version",
-				Required: true,
+				Name:    "fork-version",
+				Aliases: []string{"f"},
+				Usage:   "fork version",
 			},
-		},
+			configFlag(),
+			encryptInitFlag(),
+			relayInitFlag(),
+			signerFlag(),
+			optionFlag(),
+			observerFlag(),
+			minProtocolVersionFlag(),
+			manifestHashFlag(),
+			cryptoSuiteFlag(),
+			requestIDFlag(),
+			forceFlag(),
+			eventsOutFlag(),
+			failOnFlag(),
+			&cli.BoolFlag{
+				Name:  "canary",
+				Usage: "run a canary keygen to check the committee, its result is never used for a validator",
+			},
+			&cli.DurationFlag{
+				Name:  "canary-ttl",
+				Usage: "how long nodes keep the share of a canary keygen",
+				Value: ceremony.DefaultCanaryTTL,
+			},
+		}, append(append(initiatorKeyFlags(), phaseTimeoutFlags()...), lintFlags()...)...),
 	}
 }
 
@@ -100,32 +139,143 @@ func (h CliHandler) CommandResharing() *cli.Command {
 		Aliases: []string{"r"},
 		Usage:   "start resharing process",
 		Action:  h.HandleResharing,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringSliceFlag{
-				Name:     "operator",
-				Aliases:  []string{"o"},
-				Usage:    "operator key-value pair",
-				Required: true,
+				Name:    "operator",
+				Aliases: []string{"o"},
+				Usage:   "operator key-value pair",
 			},
 			&cli.StringSliceFlag{
-				Name:     "old-operator",
-				Aliases:  []string{"oo"},
-				Usage:    "old operator key-value pair",
-				Required: true,
+				Name:    "old-operator",
+				Aliases: []string{"oo"},
+				Usage:   "old operator key-value pair",
 			},
 			&cli.IntFlag{
-				Name:     "threshold",
-				Aliases:  []string{"t"},
-				Usage:    "threshold value",
-				Required: true,
+				Name:    "threshold",
+				Aliases: []string{"t"},
+				Usage:   "threshold value",
 			},
 			&cli.StringFlag{
-				Name:     "validator-pk",
-				Aliases:  []string{"vk"},
-				Usage:    "validator public key value",
-				Required: true,
+				Name:    "validator-pk",
+				Aliases: []string{"vk"},
+				Usage:   "validator public key value",
 			},
+			configFlag(),
+			encryptInitFlag(),
+			relayInitFlag(),
+			signerFlag(),
+			optionFlag(),
+			observerFlag(),
+			minProtocolVersionFlag(),
+			manifestHashFlag(),
+			cryptoSuiteFlag(),
+			requestIDFlag(),
+			forceFlag(),
+			eventsOutFlag(),
+			failOnFlag(),
+		}, append(append(initiatorKeyFlags(), phaseTimeoutFlags()...), lintFlags()...)...),
+	}
+}
+
+// phaseTimeoutFlags override the node defaults for the ceremony, unset flags keep them
+func phaseTimeoutFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "timeout-init-ack",
+			Usage: "how long nodes wait for every operator to acknowledge the init message",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout-round1",
+			Usage: "how long nodes wait for every operator's round 1 message",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout-round2",
+			Usage: "how long nodes wait for every operator's round 2 message",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout-output",
+			Usage: "how long nodes wait for every operator's output",
 		},
+		&cli.DurationFlag{
+			Name:  "timeout-extension",
+			Usage: "extra time granted once per phase when at least threshold operators delivered",
+		},
+	}
+}
+
+func minProtocolVersionFlag() cli.Flag {
+	return &cli.UintFlag{
+		Name:  "min-protocol-version",
+		Usage: "sign a claim of the minimum protocol version with the start message, nodes refuse to run the ceremony at an older version",
+	}
+}
+
+func manifestHashFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "manifest-hash",
+		Usage: "hash the manifest of the ceremony must have, e.g. of an earlier ceremony to run it again with the same parameters",
+	}
+}
+
+func cryptoSuiteFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "crypto-suite",
+		Usage: fmt.Sprintf("crypto suite of the ceremony, one of %s", strings.Join(cryptosuite.IDs(), ", ")),
+		Value: cryptosuite.Default,
+	}
+}
+
+func encryptInitFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "encrypt-init",
+		Usage: "relay the start message through the messenger encrypted to each operator's key instead of posting it to the nodes",
+	}
+}
+
+func relayInitFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "relay-init",
+		Usage: "publish the start message to the topic and let the messenger deliver it instead of posting it to the nodes, the nodes only need to reach the messenger",
+	}
+}
+
+func signerFlag() cli.Flag {
+	return &cli.Uint64Flag{
+		Name:  "signer",
+		Usage: "operator of the committee whose node signs the start message with its operator key and publishes it through the messenger, the cli then needs no operator key",
+	}
+}
+
+func optionFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "option",
+		Usage: "ceremony option key=value the nodes honor, like encryption=on, transcript=off or progress-events=on",
+	}
+}
+
+// parseCeremonyOptions reads the --option flags, options the nodes of this
+// version don't support are refused before anything is sent
+func parseCeremonyOptions(c *cli.Context) (ceremony.Options, error) {
+	options, err := ceremony.ParseOptions(c.StringSlice("option"))
+	if err != nil {
+		return nil, err
+	}
+	if err := options.Validate(ceremony.SupportedOptions); err != nil {
+		return nil, err
+	}
+	if len(options) == 0 {
+		return nil, nil
+	}
+	return options, nil
+}
+
+func parsePhaseTimeouts(c *cli.Context) ceremony.PhaseTimeouts {
+	return ceremony.PhaseTimeouts{
+		InitAck:   c.Duration("timeout-init-ack"),
+		Round1:    c.Duration("timeout-round1"),
+		Round2:    c.Duration("timeout-round2"),
+		Output:    c.Duration("timeout-output"),
+		Extension: c.Duration("timeout-extension"),
 	}
 }
 
@@ -142,6 +292,39 @@ func (h CliHandler) CommandGetDKGResults() *cli.Command {
 				Usage:    "request id for keygen/resharing",
 				Required: true,
 			},
+			&cli.StringSliceFlag{
+				Name:    "operator",
+				Aliases: []string{"o"},
+				Usage:   "operator key-value pair, the result is rebuilt from the outputs the operators stored when the messenger has none",
+			},
+			&cli.StringSliceFlag{
+				Name:  "observer",
+				Usage: "observer key-value pair, its signed attestation is added to the results",
+			},
+			&cli.BoolFlag{
+				Name:  "approvals",
+				Usage: "ask every --operator to sign the hash of the result and add the approvals to the results",
+			},
+			&cli.DurationFlag{
+				Name:  "wait",
+				Usage: "wait up to this long for the ceremony to finish, exits with 3 when it didn't",
+			},
+			&cli.BoolFlag{
+				Name:  "follow",
+				Usage: "show and check the outputs of the operators as they publish them until the result is in, bounded by --wait when set",
+			},
+			&cli.StringFlag{
+				Name:    "withdrawal-credentials",
+				Aliases: []string{"w"},
+				Usage:   "with --follow, check the deposit signature of every output for these withdrawal credentials",
+			},
+			&cli.StringFlag{
+				Name:    "fork-version",
+				Aliases: []string{"f"},
+				Usage:   "fork version of the deposit checked with --withdrawal-credentials",
+			},
+			encryptToFlag(),
+			failOnFlag(),
 		},
 	}
 }
@@ -152,7 +335,7 @@ func (h CliHandler) CommandGetKeyshares() *cli.Command {
 		Aliases: []string{"gks"},
 		Usage:   "generates a keyshare for registering the validator on ssv UI",
 		Action:  h.HandleGetKeyShares,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:     "request-id",
 				Aliases:  []string{"req"},
@@ -160,10 +343,9 @@ func (h CliHandler) CommandGetKeyshares() *cli.Command {
 				Required: true,
 			},
 			&cli.StringSliceFlag{
-				Name:     "operator",
-				Aliases:  []string{"o"},
-				Usage:    "operator key-value pair",
-				Required: true,
+				Name:    "operator",
+				Aliases: []string{"o"},
+				Usage:   "operator key-value pair",
 			},
 			&cli.StringFlag{
 				Name:     "owner-address",
@@ -177,7 +359,8 @@ func (h CliHandler) CommandGetKeyshares() *cli.Command {
 				Usage:    "The validator registration nonce of the account (owner address) within the SSV contract (increments after each validator registration), obtained using the ssv-scanner tool.",
 				Required: true,
 			},
-		},
+			encryptToFlag(),
+		}, initiatorKeyFlags()...),
 	}
 }
 
@@ -200,42 +383,187 @@ func (h CliHandler) CommandGenerateDepositData() *cli.Command {
 				Usage:    "withdrawal credential",
 				Required: true,
 			},
+			&cli.StringFlag{
+				Name:    "fork-version",
+				Aliases: []string{"f"},
+				Usage:   "fork version",
+			},
+			encryptToFlag(),
+		},
+	}
+}
+
+func (h CliHandler) CommandBLSToExecutionChange() *cli.Command {
+	return &cli.Command{
+		Name:    "bls-to-execution-change",
+		Aliases: []string{"btec"},
+		Usage:   "threshold sign a change of 0x00 withdrawal credentials to an execution address",
+		Action:  h.HandleBLSToExecutionChange,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "request-id",
+				Aliases:  []string{"req"},
+				Usage:    "request id of the keygen/resharing that created the validator",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:    "operator",
+				Aliases: []string{"o"},
+				Usage:   "operator key-value pair",
+			},
+			&cli.Uint64Flag{
+				Name:     "validator-index",
+				Aliases:  []string{"vi"},
+				Usage:    "beacon chain index of the validator",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "execution-address",
+				Aliases:  []string{"ea"},
+				Usage:    "execution address receiving the withdrawals",
+				Required: true,
+			},
 			&cli.StringFlag{
 				Name:     "fork-version",
 				Aliases:  []string{"f"},
-				Usage:    "fork version",
+				Usage:    "network of the validator (mainnet, prater, holesky)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "withdrawal-credentials",
+				Aliases: []string{"w"},
+				Usage:   "current 0x00 withdrawal credentials, checked against the validator key when set",
+			},
+		}, initiatorKeyFlags()...),
+	}
+}
+
+func (h CliHandler) CommandHandover() *cli.Command {
+	return &cli.Command{
+		Name:    "handover",
+		Aliases: []string{"ho"},
+		Usage:   "move an operator's share for a validator to a new node without resharing",
+		Action:  h.HandleHandover,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "validator-pk",
+				Aliases: []string{"vk"},
+				Usage:   "validator public key value",
+			},
+			&cli.StringFlag{
+				Name:     "from",
+				Usage:    "address of the node currently holding the share",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "address of the new node for the same operator",
 				Required: true,
 			},
 		},
 	}
 }
 
+func (h CliHandler) CommandServe() *cli.Command {
+	return &cli.Command{
+		Name:   "serve",
+		Usage:  "serve a json-rpc 2.0 api to start and follow ceremonies",
+		Action: h.HandleServe,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "addr",
+				Usage: "address the api listens on, any other than a loopback address needs CLI_SERVE_AUTH",
+				Value: "127.0.0.1:8000",
+			},
+			&cli.StringFlag{
+				Name:  "results-dir",
+				Usage: "share the results files in this directory with other coordinators running reconcile-results",
+			},
+			&cli.StringFlag{
+				Name:  "batch-webhook",
+				Usage: "post the progress of the batches started with startBatch to this url",
+			},
+			&cli.StringFlag{
+				Name:    "batch-webhook-secret",
+				Usage:   "secret signing the --batch-webhook notifications like messenger webhooks",
+				EnvVars: []string{"DKG_BATCH_WEBHOOK_SECRET"},
+			},
+			&cli.DurationFlag{
+				Name:  "batch-timeout",
+				Usage: "fail the ceremonies of a batch that have no result this long after it started",
+				Value: time.Hour,
+			},
+			eventsOutFlag(),
+		}, initiatorKeyFlags()...),
+	}
+}
+
 func (h *CliHandler) DKGResultByRequestID(requestID string) (*DKGResult, error) {
 	log := h.logger.WithFields(logrus.Fields{"request-id": requestID})
 	log.Debug("DKGResultByRequestID: fetching dkg results for keygen/resharing")
 
-	resp, err := h.client.Get(fmt.Sprintf("%s/data/%s", h.messengerAddr, requestID))
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+
+	data, etag, err := fetchResult(ctx, h.messengerClient(), requestID)
 	if err != nil {
-		log.Errorf("failed to request messenger server for dkg result: %s", err.Error())
-		return nil, fmt.Errorf("DKGResultByRequestID: failed to request messenger server for dkg result %s", err.Error())
+		log.Errorf("failed to fetch keygen/resharing results: %s", err.Error())
+		err = unreachable(fmt.Errorf("DKGResultByRequestID: failed to fetch dkg result for request %s: %w", requestID, err))
+		var failure *Failure
+		if errors.As(err, &failure) && failure.Condition == ConditionUnreachable {
+			if result, ok := cachedDKGResult(requestID); ok {
+				return result, nil
+			}
+		}
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		log.Errorf("failed to fetch keygen/resharing results with status %s", resp.Status)
-		log.Debugf("request failed with body %s", string(respBody))
-		return nil, fmt.Errorf("DKGResultByRequestID: failed to fetch dkg result for request %s with code %d", requestID, resp.StatusCode)
+	result := formatResults(data)
+	h.updateTopicCache(func(cache *topiccache.Cache) {
+		cache.SetResult(requestID, data, etag)
+		if entry, err := cache.Get(requestID); err == nil {
+			result.ManifestHash = entry.ManifestHash
+		}
+	})
+	return result, nil
+}
+
+func (h *CliHandler) messengerClient() *messenger.Client {
+	return messenger.NewMessengerClient(h.messengerAddr).WithTransport(h.client.Transport)
+}
+
+// clientTransport authenticates the cli to servers that require it: the
+// bearer token in MESSENGER_TOKEN to the messenger, the one in NODE_TOKEN to
+// the nodes, and the client certificate in DKG_TLS_CERT and DKG_TLS_KEY to all
+func clientTransport(messengerAddr string) http.RoundTripper {
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	if certFile, keyFile := os.Getenv("DKG_TLS_CERT"), os.Getenv("DKG_TLS_KEY"); certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return failedTransport{fmt.Errorf("failed to load client certificate: %w", err)}
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
 
-	data := &messenger.DataStore{}
-	body, _ := io.ReadAll(resp.Body)
-	if err := json.Unmarshal(body, &data); err != nil {
-		log.Errorf("failed to parse response json: %s", err.Error())
-		return nil, fmt.Errorf("DKGResultByRequestID: failed to parse dkg result from api response")
+	tokens := make(map[string]string)
+	if addr, err := url.Parse(messengerAddr); err == nil {
+		tokens[addr.Host] = messenger.MessengerTokenFromEnv()
 	}
+	return &middleware.TokenTransport{
+		Base:    &http.Transport{TLSClientConfig: tlsConfig},
+		Tokens:  tokens,
+		Default: os.Getenv("NODE_TOKEN"),
+	}
+}
+
+// failedTransport fails every request with the error that kept the client
+// from being set up, commands report it on their first request
+type failedTransport struct {
+	err error
+}
 
-	return formatResults(data), nil
+func (t failedTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
 }
 
 func getRandRequestID() dkg.RequestID {
@@ -0,0 +1,318 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/walletconnect"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/urfave/cli/v2"
+)
+
+// signers of on-chain submissions, clef fronts ledger and trezor devices
+const (
+	signerKey           = "key"
+	signerClef          = "clef"
+	signerWalletConnect = "walletconnect"
+)
+
+// txSigner signs the transactions the cli submits on chain
+type txSigner interface {
+	Address() common.Address
+	SignTx(ctx context.Context, tx *ethtypes.DynamicFeeTx) (*ethtypes.Transaction, error)
+	Close()
+}
+
+func txSignerFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "signer",
+			Usage: "what signs the transaction: key (--owner-key), clef (a ledger, trezor or keystore account of clef) or walletconnect (a wallet app)",
+			Value: signerKey,
+		},
+		&cli.StringFlag{
+			Name:  "owner-key",
+			Usage: "file with the hex private key of the owner address, for --signer key",
+		},
+		&cli.StringFlag{
+			Name:  "owner",
+			Usage: "owner address, picks the account when clef or the wallet has more than one",
+		},
+		&cli.StringFlag{
+			Name:  "clef",
+			Usage: "ipc path or http url of clef, defaults to ~/.clef/clef.ipc",
+		},
+		&cli.StringFlag{
+			Name:    "wc-project-id",
+			Usage:   "walletconnect cloud project id",
+			EnvVars: []string{"WALLETCONNECT_PROJECT_ID"},
+		},
+		&cli.StringFlag{
+			Name:  "wc-relay",
+			Usage: "walletconnect relay url",
+			Value: walletconnect.DefaultRelay,
+		},
+	}
+}
+
+// newTxSigner opens the signer of --signer for transactions on chainID
+func (h *CliHandler) newTxSigner(ctx context.Context, c *cli.Context, chainID *big.Int) (txSigner, error) {
+	var owner *common.Address
+	if c.IsSet("owner") {
+		if !common.IsHexAddress(c.String("owner")) {
+			return nil, fail(ConditionValidation, fmt.Errorf("--owner must be an address"))
+		}
+		address := common.HexToAddress(c.String("owner"))
+		owner = &address
+	}
+
+	switch c.String("signer") {
+	case signerKey:
+		if c.String("owner-key") == "" {
+			return nil, fail(ConditionValidation, fmt.Errorf("--signer key needs --owner-key"))
+		}
+		key, err := readOwnerKey(c.String("owner-key"))
+		if err != nil {
+			return nil, fail(ConditionValidation, err)
+		}
+		signer := &keySigner{key: key}
+		if owner != nil && *owner != signer.Address() {
+			return nil, fail(ConditionValidation, fmt.Errorf("--owner-key is the key of %s, not of --owner %s", signer.Address().Hex(), owner.Hex()))
+		}
+		return signer, nil
+	case signerClef:
+		endpoint := c.String("clef")
+		if endpoint == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			endpoint = filepath.Join(home, ".clef", "clef.ipc")
+		}
+		return newClefSigner(endpoint, owner)
+	case signerWalletConnect:
+		if c.String("wc-project-id") == "" {
+			return nil, fail(ConditionValidation, fmt.Errorf("--signer walletconnect needs --wc-project-id"))
+		}
+		return newWalletConnectSigner(ctx, c.String("wc-relay"), c.String("wc-project-id"), chainID, owner)
+	default:
+		return nil, fail(ConditionValidation, fmt.Errorf("unknown --signer %s, use key, clef or walletconnect", c.String("signer")))
+	}
+}
+
+// pickAccount is owner if the signer has it, or the only account of the signer
+func pickAccount(addresses []common.Address, owner *common.Address) (common.Address, error) {
+	if owner != nil {
+		for _, address := range addresses {
+			if address == *owner {
+				return address, nil
+			}
+		}
+		return common.Address{}, fail(ConditionValidation, fmt.Errorf("the signer has no account %s", owner.Hex()))
+	}
+	switch len(addresses) {
+	case 0:
+		return common.Address{}, fail(ConditionValidation, fmt.Errorf("the signer shares no account"))
+	case 1:
+		return addresses[0], nil
+	default:
+		return common.Address{}, fail(ConditionValidation, fmt.Errorf("the signer has %d accounts, pick one with --owner", len(addresses)))
+	}
+}
+
+// checkSignedTx makes sure the signer signed the transaction it was given,
+// from the owner; a wallet may change the fees but nothing else
+func checkSignedTx(unsigned *ethtypes.DynamicFeeTx, signed *ethtypes.Transaction, owner common.Address) error {
+	sender, err := ethtypes.Sender(ethtypes.LatestSignerForChainID(unsigned.ChainID), signed)
+	if err != nil {
+		return fmt.Errorf("checkSignedTx: invalid signature: %w", err)
+	}
+	if sender != owner {
+		return fmt.Errorf("checkSignedTx: transaction is signed by %s, not by the owner %s", sender.Hex(), owner.Hex())
+	}
+	value := unsigned.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	switch {
+	case signed.ChainId().Cmp(unsigned.ChainID) != 0:
+		return fmt.Errorf("checkSignedTx: signer changed the chain id to %s", signed.ChainId())
+	case signed.Nonce() != unsigned.Nonce:
+		return fmt.Errorf("checkSignedTx: signer changed the nonce to %d", signed.Nonce())
+	case signed.To() == nil || *signed.To() != *unsigned.To:
+		return fmt.Errorf("checkSignedTx: signer changed the recipient")
+	case signed.Value().Cmp(value) != 0:
+		return fmt.Errorf("checkSignedTx: signer changed the value to %s", signed.Value())
+	case !bytes.Equal(signed.Data(), unsigned.Data):
+		return fmt.Errorf("checkSignedTx: signer changed the calldata")
+	}
+	return nil
+}
+
+// keySigner signs with a hot key read from a file
+type keySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *keySigner) Address() common.Address {
+	return crypto.PubkeyToAddress(s.key.PublicKey)
+}
+
+func (s *keySigner) SignTx(ctx context.Context, tx *ethtypes.DynamicFeeTx) (*ethtypes.Transaction, error) {
+	return ethtypes.SignNewTx(s.key, ethtypes.LatestSignerForChainID(tx.ChainID), tx)
+}
+
+func (s *keySigner) Close() {}
+
+// clefSigner asks clef to sign, clef shows the transaction for approval and
+// signs with a ledger, a trezor or its own keystore
+type clefSigner struct {
+	signer  *external.ExternalSigner
+	account accounts.Account
+}
+
+func newClefSigner(endpoint string, owner *common.Address) (*clefSigner, error) {
+	signer, err := external.NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, fail(ConditionUnreachable, fmt.Errorf("failed to connect to clef at %s: %w", endpoint, err))
+	}
+	// clef asks its user before it lists the accounts
+	var addresses []common.Address
+	for _, account := range signer.Accounts() {
+		addresses = append(addresses, account.Address)
+	}
+	address, err := pickAccount(addresses, owner)
+	if err != nil {
+		return nil, err
+	}
+	return &clefSigner{signer: signer, account: accounts.Account{Address: address}}, nil
+}
+
+func (s *clefSigner) Address() common.Address {
+	return s.account.Address
+}
+
+func (s *clefSigner) SignTx(ctx context.Context, tx *ethtypes.DynamicFeeTx) (*ethtypes.Transaction, error) {
+	fmt.Println("approve the transaction in clef")
+	return s.signer.SignTx(s.account, ethtypes.NewTx(tx), tx.ChainID)
+}
+
+func (s *clefSigner) Close() {}
+
+// walletConnectSigner asks a wallet app paired over walletconnect to sign
+type walletConnectSigner struct {
+	client  *walletconnect.Client
+	session *walletconnect.Session
+	chain   string
+	address common.Address
+}
+
+func newWalletConnectSigner(ctx context.Context, relay, projectID string, chainID *big.Int, owner *common.Address) (*walletConnectSigner, error) {
+	client, err := walletconnect.Dial(ctx, relay, projectID, walletconnect.Metadata{
+		Name:        "rockx-dkg-cli",
+		Description: "on-chain submissions of dkg ceremony results",
+		URL:         "https://github.com/RockX-SG/frost-dkg-demo",
+		Icons:       []string{},
+	})
+	if err != nil {
+		return nil, fail(ConditionUnreachable, err)
+	}
+	chain := walletconnect.EIP155(chainID)
+	pairing, err := client.Pair(ctx, chain, []string{"eth_signTransaction"})
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	fmt.Printf("connect your wallet with this walletconnect uri:\n\n%s\n\n", pairing.URI)
+	session, err := client.Approved(ctx, pairing)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	var addresses []common.Address
+	for _, account := range session.Accounts(chain) {
+		if common.IsHexAddress(account) {
+			addresses = append(addresses, common.HexToAddress(account))
+		}
+	}
+	address, err := pickAccount(addresses, owner)
+	if err != nil {
+		_ = session.Disconnect(ctx)
+		client.Close()
+		return nil, err
+	}
+	return &walletConnectSigner{client: client, session: session, chain: chain, address: address}, nil
+}
+
+func (s *walletConnectSigner) Address() common.Address {
+	return s.address
+}
+
+func (s *walletConnectSigner) SignTx(ctx context.Context, tx *ethtypes.DynamicFeeTx) (*ethtypes.Transaction, error) {
+	value := tx.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	args := map[string]interface{}{
+		"type":                 hexutil.Uint64(ethtypes.DynamicFeeTxType),
+		"chainId":              (*hexutil.Big)(tx.ChainID),
+		"from":                 s.address.Hex(),
+		"to":                   tx.To.Hex(),
+		"nonce":                hexutil.Uint64(tx.Nonce),
+		"gas":                  hexutil.Uint64(tx.Gas),
+		"maxFeePerGas":         (*hexutil.Big)(tx.GasFeeCap),
+		"maxPriorityFeePerGas": (*hexutil.Big)(tx.GasTipCap),
+		"value":                (*hexutil.Big)(value),
+		"data":                 hexutil.Bytes(tx.Data),
+	}
+	fmt.Println("approve the transaction in your wallet")
+	var raw hexutil.Bytes
+	if err := s.session.Request(ctx, s.chain, "eth_signTransaction", []interface{}{args}, &raw); err != nil {
+		return nil, fmt.Errorf("SignTx: %w", err)
+	}
+	signed := new(ethtypes.Transaction)
+	if err := signed.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("SignTx: wallet returned an invalid transaction: %w", err)
+	}
+	return signed, nil
+}
+
+func (s *walletConnectSigner) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = s.session.Disconnect(ctx)
+	s.client.Close()
+}
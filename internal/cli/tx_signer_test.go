@@ -0,0 +1,158 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func testTx() *ethtypes.DynamicFeeTx {
+	to := common.HexToAddress("0xDD9BC35aE942eF0cFa76930954a156B3fF30a4E1")
+	return &ethtypes.DynamicFeeTx{
+		ChainID:   big.NewInt(17000),
+		Nonce:     3,
+		GasTipCap: big.NewInt(1_500_000_000),
+		GasFeeCap: big.NewInt(30_000_000_000),
+		Gas:       400_000,
+		To:        &to,
+		Data:      []byte{0x06, 0xe8, 0xfb, 0x9c},
+	}
+}
+
+// fakeClef answers the external signer api of clef with key, signing what it
+// is asked to with the fee cap it is given plus feeBump
+func fakeClef(t *testing.T, key *ecdsa.PrivateKey, feeBump int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		var result interface{}
+		switch req.Method {
+		case "account_version":
+			result = "6.1.0"
+		case "account_list":
+			result = []common.Address{crypto.PubkeyToAddress(key.PublicKey)}
+		case "account_signTransaction":
+			var args struct {
+				ChainID              *hexutil.Big    `json:"chainId"`
+				Nonce                hexutil.Uint64  `json:"nonce"`
+				Gas                  hexutil.Uint64  `json:"gas"`
+				MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+				MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+				To                   *common.Address `json:"to"`
+				Value                *hexutil.Big    `json:"value"`
+				Data                 hexutil.Bytes   `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(req.Params[0], &args))
+			tx, err := ethtypes.SignNewTx(key, ethtypes.LatestSignerForChainID(args.ChainID.ToInt()), &ethtypes.DynamicFeeTx{
+				ChainID:   args.ChainID.ToInt(),
+				Nonce:     uint64(args.Nonce),
+				GasTipCap: args.MaxPriorityFeePerGas.ToInt(),
+				GasFeeCap: new(big.Int).Add(args.MaxFeePerGas.ToInt(), big.NewInt(feeBump)),
+				Gas:       uint64(args.Gas),
+				To:        args.To,
+				Value:     args.Value.ToInt(),
+				Data:      args.Data,
+			})
+			require.NoError(t, err)
+			raw, err := tx.MarshalBinary()
+			require.NoError(t, err)
+			result = map[string]interface{}{"raw": hexutil.Bytes(raw), "tx": tx}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result}))
+	}))
+}
+
+func TestClefSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	clef := fakeClef(t, key, 1)
+	defer clef.Close()
+
+	other := common.HexToAddress("0x52908400098527886E0F7030069857D2E4169EE7")
+	_, err = newClefSigner(clef.URL, &other)
+	require.Equal(t, ExitValidation, ExitCode(err))
+
+	signer, err := newClefSigner(clef.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, owner, signer.Address())
+
+	unsigned := testTx()
+	tx, err := signer.SignTx(context.Background(), unsigned)
+	require.NoError(t, err)
+	require.NoError(t, checkSignedTx(unsigned, tx, owner))
+	require.Equal(t, int64(30_000_000_001), tx.GasFeeCap().Int64())
+}
+
+func TestCheckSignedTx(t *testing.T) {
+	sk, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := &keySigner{key: sk}
+	unsigned := testTx()
+	tx, err := signer.SignTx(context.Background(), unsigned)
+	require.NoError(t, err)
+	require.NoError(t, checkSignedTx(unsigned, tx, signer.Address()))
+	require.ErrorContains(t, checkSignedTx(unsigned, tx, common.Address{1}), "not by the owner")
+
+	changed := testTx()
+	changed.Data = []byte{0x01}
+	tx, err = signer.SignTx(context.Background(), changed)
+	require.NoError(t, err)
+	require.ErrorContains(t, checkSignedTx(unsigned, tx, signer.Address()), "calldata")
+
+	changed = testTx()
+	changed.Nonce = 4
+	tx, err = signer.SignTx(context.Background(), changed)
+	require.NoError(t, err)
+	require.ErrorContains(t, checkSignedTx(unsigned, tx, signer.Address()), "nonce")
+}
+
+func TestPickAccount(t *testing.T) {
+	a, b := common.Address{1}, common.Address{2}
+	address, err := pickAccount([]common.Address{a}, nil)
+	require.NoError(t, err)
+	require.Equal(t, a, address)
+	address, err = pickAccount([]common.Address{a, b}, &b)
+	require.NoError(t, err)
+	require.Equal(t, b, address)
+	_, err = pickAccount([]common.Address{a, b}, nil)
+	require.ErrorContains(t, err, "--owner")
+	_, err = pickAccount(nil, nil)
+	require.Equal(t, ExitValidation, ExitCode(err))
+}
@@ -0,0 +1,112 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/urfave/cli/v2"
+)
+
+func workersFlag() *cli.IntFlag {
+	return &cli.IntFlag{
+		Name:  "workers",
+		Usage: "entries verified in parallel, default the number of cpus",
+		Value: runtime.NumCPU(),
+	}
+}
+
+// verifyConcurrently runs verify for the entries 0..total-1 on workers
+// goroutines and returns the error of every entry by index. Progress is
+// written to progress, about every 5% of the entries.
+func verifyConcurrently(total, workers int, progress io.Writer, verify func(i int) error) []error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > total {
+		workers = total
+	}
+	step := total / 20
+	if step < 1 {
+		step = 1
+	}
+
+	errs := make([]error, total)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done, failed := 0, 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				err := verify(i)
+				errs[i] = err
+
+				mu.Lock()
+				done++
+				if err != nil {
+					failed++
+				}
+				if progress != nil && (done%step == 0 || done == total) {
+					fmt.Fprintf(progress, "verified %d/%d, %d failed\n", done, total, failed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < total; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errs
+}
+
+// cachedKeys looks every operator up once, for batches sharing committees
+func cachedKeys(keys observer.KeyLookup) observer.KeyLookup {
+	var mu sync.Mutex
+	cache := make(map[types.OperatorID]*rsa.PublicKey)
+	return func(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+		mu.Lock()
+		pk, ok := cache[operatorID]
+		mu.Unlock()
+		if ok {
+			return pk, nil
+		}
+		pk, err := keys(operatorID)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		cache[operatorID] = pk
+		mu.Unlock()
+		return pk, nil
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyConcurrently(t *testing.T) {
+	var calls int32
+	progress := &bytes.Buffer{}
+	errs := verifyConcurrently(100, 8, progress, func(i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i%10 == 3 {
+			return errors.New("invalid")
+		}
+		return nil
+	})
+	require.Equal(t, int32(100), calls)
+	require.Len(t, errs, 100)
+	for i, err := range errs {
+		require.Equal(t, i%10 == 3, err != nil, "entry %d", i)
+	}
+	lines := strings.Split(strings.TrimSpace(progress.String()), "\n")
+	require.Len(t, lines, 20)
+	require.Equal(t, "verified 100/100, 10 failed", lines[len(lines)-1])
+
+	// more workers than entries and no progress
+	errs = verifyConcurrently(2, 16, nil, func(i int) error { return nil })
+	require.Equal(t, []error{nil, nil}, errs)
+}
+
+func TestDKGResultVerifyOutputs(t *testing.T) {
+	requestID := dkg.RequestID{4, 5, 6}
+	outputs := committeeOutputs(t, requestID, 1, 2, 3, 4)
+	result := formatResults(&messenger.DataStore{DKGOutputs: outputs.Outputs})
+	require.NoError(t, result.verifyOutputs(testingKeys))
+
+	tampered := formatResults(&messenger.DataStore{DKGOutputs: outputs.Outputs})
+	output := tampered.Output[2]
+	output.Data.SharePubKey = "ff"
+	tampered.Output[2] = output
+	require.ErrorContains(t, tampered.verifyOutputs(testingKeys), "output of operator 2: invalid output signature")
+
+	swapped := formatResults(&messenger.DataStore{DKGOutputs: outputs.Outputs})
+	swapped.Output[3], swapped.Output[4] = swapped.Output[4], swapped.Output[3]
+	require.ErrorContains(t, swapped.verifyOutputs(testingKeys), "output of operator 3 is signed by operator 4")
+
+	blamed := &DKGResult{Blame: &dkg.BlameOutput{}}
+	require.Error(t, blamed.verifyOutputs(testingKeys))
+
+	keys := cachedKeys(testingKeys)
+	for i := 0; i < 2; i++ {
+		pk, err := keys(types.OperatorID(1))
+		require.NoError(t, err)
+		require.NotNil(t, pk)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package coordinator lets a set of coordinator keys co-sign the start of a
+// ceremony, nodes configured with the set only start keygen and resharing
+// when K of the M coordinators approved the exact start message.
+package coordinator
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+var approvalLabel = []byte("rockx-dkg-coordinator-approval")
+
+// approvalQueryKey carries the approvals of a start message in the query of
+// the consume request, next to the phase timeouts
+const approvalQueryKey = "approval"
+
+var ErrNotEnoughApprovals = errors.New("not enough coordinator approvals")
+
+// Approval is the signature of one coordinator over a start message
+type Approval struct {
+	// Coordinator is the fingerprint of the coordinator public key
+	Coordinator string `json:"coordinator"`
+	// PublicKey is the base64 encoded PEM of the coordinator key, it lets the
+	// approvals be checked before the node does
+	PublicKey string `json:"public_key,omitempty"`
+	Signature string `json:"signature"`
+}
+
+// Fingerprint identifies a coordinator key, it is the hex sha256 of its DER encoding
+func Fingerprint(pk *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pk)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func signingRoot(msg *dkg.Message) ([]byte, error) {
+	root, err := msg.GetRoot()
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, approvalLabel...), root...), nil
+}
+
+// Approve signs msg with the key of a coordinator
+func Approve(sk *rsa.PrivateKey, msg *dkg.Message) (*Approval, error) {
+	data, err := signingRoot(msg)
+	if err != nil {
+		return nil, fmt.Errorf("Approve: failed to compute message root: %w", err)
+	}
+	hashed := sha256.Sum256(data)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sk, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, fmt.Errorf("Approve: failed to sign message: %w", err)
+	}
+
+	fingerprint, err := Fingerprint(&sk.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Approve: %w", err)
+	}
+	pkPem, err := types.GetPublicKeyPem(sk)
+	if err != nil {
+		return nil, fmt.Errorf("Approve: %w", err)
+	}
+	return &Approval{
+		Coordinator: fingerprint,
+		PublicKey:   base64.StdEncoding.EncodeToString(pkPem),
+		Signature:   hex.EncodeToString(signature),
+	}, nil
+}
+
+// Check verifies the approval against the public key it carries
+func (a *Approval) Check(msg *dkg.Message) error {
+	pk, err := ParsePublicKey(a.PublicKey)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := Fingerprint(pk)
+	if err != nil {
+		return err
+	}
+	if fingerprint != a.Coordinator {
+		return fmt.Errorf("public key doesn't match coordinator %s", a.Coordinator)
+	}
+	return a.verify(pk, msg)
+}
+
+func (a *Approval) verify(pk *rsa.PublicKey, msg *dkg.Message) error {
+	signature, err := hex.DecodeString(a.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	data, err := signingRoot(msg)
+	if err != nil {
+		return err
+	}
+	if !types.Verify(pk, data, signature) {
+		return fmt.Errorf("invalid signature of coordinator %s", a.Coordinator)
+	}
+	return nil
+}
+
+// ParsePublicKey reads a base64 encoded PEM public key, the format of operator
+// keys in the ssv registry
+func ParsePublicKey(encoded string) (*rsa.PublicKey, error) {
+	pkPem, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode coordinator public key: %w", err)
+	}
+	pk, err := types.PemToPublicKey(pkPem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse coordinator public key: %w", err)
+	}
+	return pk, nil
+}
+
+// Set is the coordinators a node accepts approvals from
+type Set struct {
+	threshold int
+	keys      map[string]*rsa.PublicKey
+}
+
+func NewSet(threshold int, keys []*rsa.PublicKey) (*Set, error) {
+	s := &Set{threshold: threshold, keys: make(map[string]*rsa.PublicKey)}
+	for _, pk := range keys {
+		fingerprint, err := Fingerprint(pk)
+		if err != nil {
+			return nil, err
+		}
+		s.keys[fingerprint] = pk
+	}
+	if threshold < 1 || threshold > len(s.keys) {
+		return nil, fmt.Errorf("coordinator threshold %d out of range for %d coordinators", threshold, len(s.keys))
+	}
+	return s, nil
+}
+
+func (s *Set) Threshold() int {
+	return s.threshold
+}
+
+func (s *Set) Size() int {
+	return len(s.keys)
+}
+
+// Verify returns ErrNotEnoughApprovals unless threshold distinct coordinators
+// of the set signed msg, approvals of unknown keys are ignored
+func (s *Set) Verify(msg *dkg.Message, approvals []*Approval) error {
+	approved, err := s.Approved(msg, approvals)
+	if err != nil {
+		return err
+	}
+	if approved < s.threshold {
+		return fmt.Errorf("%w: %d of %d", ErrNotEnoughApprovals, approved, s.threshold)
+	}
+	return nil
+}
+
+// Approved counts the coordinators of the set that approved msg, approvals of
+// other keys are ignored and an invalid signature fails the whole set
+func (s *Set) Approved(msg *dkg.Message, approvals []*Approval) (int, error) {
+	approved := make(map[string]bool)
+	for _, a := range approvals {
+		pk, ok := s.keys[a.Coordinator]
+		if !ok || approved[a.Coordinator] {
+			continue
+		}
+		if err := a.verify(pk, msg); err != nil {
+			return 0, err
+		}
+		approved[a.Coordinator] = true
+	}
+	return len(approved), nil
+}
+
+// Query encodes approvals for the consume request, the public keys are left
+// out since nodes know the keys of their coordinators
+func Query(approvals []*Approval) url.Values {
+	query := url.Values{}
+	for _, a := range approvals {
+		query.Add(approvalQueryKey, a.Coordinator+":"+a.Signature)
+	}
+	return query
+}
+
+// ParseQuery reads the approvals encoded by Query
+func ParseQuery(query url.Values) ([]*Approval, error) {
+	approvals := make([]*Approval, 0, len(query[approvalQueryKey]))
+	for _, value := range query[approvalQueryKey] {
+		coordinator, signature, ok := strings.Cut(value, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid approval %q", value)
+		}
+		approvals = append(approvals, &Approval{Coordinator: coordinator, Signature: signature})
+	}
+	return approvals, nil
+}
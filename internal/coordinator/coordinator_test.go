@@ -0,0 +1,118 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package coordinator
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeys(t *testing.T, n int) []*rsa.PrivateKey {
+	keys := make([]*rsa.PrivateKey, 0, n)
+	for i := 0; i < n; i++ {
+		sk, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		keys = append(keys, sk)
+	}
+	return keys
+}
+
+func testSet(t *testing.T, threshold int, keys []*rsa.PrivateKey) *Set {
+	pks := make([]*rsa.PublicKey, 0, len(keys))
+	for _, sk := range keys {
+		pks = append(pks, &sk.PublicKey)
+	}
+	set, err := NewSet(threshold, pks)
+	require.NoError(t, err)
+	return set
+}
+
+func testStartMsg(data string) *dkg.Message {
+	return &dkg.Message{MsgType: dkg.InitMsgType, Identifier: dkg.RequestID{1, 2, 3}, Data: []byte(data)}
+}
+
+func TestSetVerify(t *testing.T) {
+	keys := testKeys(t, 3)
+	set := testSet(t, 2, keys)
+	msg := testStartMsg("init")
+
+	first, err := Approve(keys[0], msg)
+	require.NoError(t, err)
+	require.NoError(t, first.Check(msg))
+	second, err := Approve(keys[2], msg)
+	require.NoError(t, err)
+
+	err = set.Verify(msg, []*Approval{first})
+	require.True(t, errors.Is(err, ErrNotEnoughApprovals))
+
+	// the same coordinator twice doesn't count twice
+	err = set.Verify(msg, []*Approval{first, first})
+	require.True(t, errors.Is(err, ErrNotEnoughApprovals))
+
+	require.NoError(t, set.Verify(msg, []*Approval{first, second}))
+
+	// approvals only go through the query without their public keys
+	approvals, err := ParseQuery(Query([]*Approval{first, second}))
+	require.NoError(t, err)
+	require.NoError(t, set.Verify(msg, approvals))
+
+	// approvals don't carry over to another message
+	other := testStartMsg("other init")
+	require.Error(t, set.Verify(other, approvals))
+	require.Error(t, first.Check(other))
+}
+
+func TestSetIgnoresUnknownCoordinators(t *testing.T) {
+	keys := testKeys(t, 3)
+	set := testSet(t, 2, keys[:2])
+	msg := testStartMsg("init")
+
+	first, err := Approve(keys[0], msg)
+	require.NoError(t, err)
+	outsider, err := Approve(keys[2], msg)
+	require.NoError(t, err)
+
+	err = set.Verify(msg, []*Approval{first, outsider})
+	require.True(t, errors.Is(err, ErrNotEnoughApprovals))
+
+	approved, err := set.Approved(msg, []*Approval{first, outsider, first})
+	require.NoError(t, err)
+	require.Equal(t, 1, approved)
+}
+
+func TestNewSetThreshold(t *testing.T) {
+	keys := testKeys(t, 2)
+	pks := []*rsa.PublicKey{&keys[0].PublicKey, &keys[1].PublicKey}
+
+	_, err := NewSet(0, pks)
+	require.Error(t, err)
+	_, err = NewSet(3, pks)
+	require.Error(t, err)
+	// duplicate keys are one coordinator
+	_, err = NewSet(2, []*rsa.PublicKey{pks[0], pks[0]})
+	require.Error(t, err)
+}
@@ -0,0 +1,409 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package debugbundle gathers what maintainers need to triage a ceremony of
+// a node into one archive: the ceremony record, the metadata of the
+// messages the node recorded, its log lines and a redacted view of its
+// configuration. Shares, keys and message payloads are left out.
+package debugbundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/logger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/dkg"
+)
+
+// Summary is the first file of the archive
+type Summary struct {
+	RequestID string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Node      string    `json:"node"`
+	// Version is what the node answers on /version
+	Version json.RawMessage `json:"version,omitempty"`
+	// ConfigDigest is the sha256 of the node settings of the environment,
+	// secrets only count with whether they are set
+	ConfigDigest string       `json:"config_digest"`
+	Environment  *Environment `json:"environment"`
+	// Errors are the parts that couldn't be gathered
+	Errors []string `json:"errors,omitempty"`
+}
+
+type Environment struct {
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	CPUs      int    `json:"cpus"`
+	// Variables are the settings of the node, dkg and messenger, secrets redacted
+	Variables map[string]string `json:"variables"`
+}
+
+// MessageMeta describes a recorded message without its payload
+type MessageMeta struct {
+	Signer uint64 `json:"signer"`
+	Type   string `json:"type"`
+	Size   int    `json:"size"`
+	Hash   string `json:"hash"`
+}
+
+// File is a file of the archive
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Redacted replaces the value of secret settings and log fields
+const Redacted = "<redacted>"
+
+var (
+	variablePrefixes = []string{"NODE_", "DKG_", "MESSENGER_"}
+	secretName       = regexp.MustCompile(`(?i)key|token|secret|password|passphrase|dsn|sinks|plugins`)
+	secretField      = regexp.MustCompile(`(?i)((?:secret|private|password|token|passphrase)[a-z_]*["']?\s*[:=]\s*)("[^"]*"|\S+)`)
+	pemBlock         = regexp.MustCompile(`-----BEGIN [A-Z ]+-----[\s\S]*?-----END [A-Z ]+-----`)
+	hexBlob          = regexp.MustCompile(`(?:0x)?[0-9a-fA-F]{128,}`)
+	base64Blob       = regexp.MustCompile(`[A-Za-z0-9+/_-]{160,}={0,2}`)
+)
+
+var errNotFound = errors.New("not found")
+
+// Environ returns the settings in environ, as os.Environ lists them, with
+// secrets redacted, and the digest of the configuration
+func Environ(environ []string) (*Environment, string) {
+	env := &Environment{
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		Variables: make(map[string]string),
+	}
+	for _, variable := range environ {
+		name, value, _ := strings.Cut(variable, "=")
+		if !hasPrefix(name, variablePrefixes) && name != "OPERATOR_PRIVATE_KEY" {
+			continue
+		}
+		if secretName.MatchString(name) && value != "" {
+			value = Redacted
+		}
+		env.Variables[name] = value
+	}
+
+	names := make([]string, 0, len(env.Variables))
+	for name := range env.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	digest := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(digest, "%s=%s\n", name, env.Variables[name])
+	}
+	return env, hex.EncodeToString(digest.Sum(nil))
+}
+
+func hasPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sanitize redacts keys, secret fields and long hex or base64 blobs, shares
+// and payloads, from a log line
+func Sanitize(line string) string {
+	line = pemBlock.ReplaceAllString(line, Redacted)
+	line = secretField.ReplaceAllString(line, "${1}"+Redacted)
+	line = hexBlob.ReplaceAllStringFunc(line, func(blob string) string {
+		return fmt.Sprintf("<redacted %d hex chars>", len(blob))
+	})
+	return base64Blob.ReplaceAllStringFunc(line, func(blob string) string {
+		return fmt.Sprintf("<redacted %d base64 chars>", len(blob))
+	})
+}
+
+// FilterLog returns the last max lines of the log in r that mention
+// requestID, sanitized
+func FilterLog(r io.Reader, requestID string, max int) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if !strings.Contains(scanner.Text(), requestID) {
+			continue
+		}
+		lines = append(lines, Sanitize(scanner.Text()))
+		if max > 0 && len(lines) > max {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("FilterLog: %w", err)
+	}
+	return lines, nil
+}
+
+// Messages describes the messages of a transcript by signer, type, size and
+// sha256 of the encoded message
+func Messages(record *observer.TranscriptRecord) ([]*MessageMeta, error) {
+	messages := make([]*MessageMeta, 0, len(record.Messages))
+	for i, encoded := range record.Messages {
+		byts, err := hex.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Messages: message %d: %w", i, err)
+		}
+		msg := &dkg.SignedMessage{}
+		if err := msg.Decode(byts); err != nil || msg.Message == nil {
+			return nil, fmt.Errorf("Messages: message %d isn't a signed dkg message", i)
+		}
+		hash := sha256.Sum256(byts)
+		messages = append(messages, &MessageMeta{
+			Signer: uint64(msg.Signer),
+			Type:   msgTypeName(msg.Message.MsgType),
+			Size:   len(byts),
+			Hash:   hex.EncodeToString(hash[:]),
+		})
+	}
+	return messages, nil
+}
+
+func msgTypeName(msgType dkg.MsgType) string {
+	switch msgType {
+	case dkg.InitMsgType:
+		return "init"
+	case dkg.ProtocolMsgType:
+		return "protocol"
+	case dkg.DepositDataMsgType:
+		return "deposit_data"
+	case dkg.OutputMsgType:
+		return "output"
+	case dkg.ReshareMsgType:
+		return "reshare"
+	case dkg.KeySignMsgType:
+		return "keysign"
+	}
+	return "unknown"
+}
+
+// Collector gathers the bundle of a ceremony from the api of a running node
+// and its log file
+type Collector struct {
+	// Node is the base url of the node api
+	Node string
+	// Token is sent as bearer token when set
+	Token   string
+	LogPath string
+	// CeremonyLogDir holds the log files of each ceremony when the node
+	// writes them, their lines are added whole
+	CeremonyLogDir string
+	// MaxLogLines are the most recent log lines of the ceremony kept
+	MaxLogLines int
+	Client      *http.Client
+	// Environ are the environment variables the node runs with
+	Environ []string
+}
+
+// Collect returns the files of the bundle of requestID. Parts that can't be
+// gathered are listed in the errors of the summary, the bundle is still
+// worth attaching without them.
+func (c *Collector) Collect(requestID string) ([]*File, error) {
+	env, digest := Environ(c.Environ)
+	summary := &Summary{
+		RequestID:    requestID,
+		CreatedAt:    time.Now().UTC(),
+		Node:         c.Node,
+		ConfigDigest: digest,
+		Environment:  env,
+	}
+	var files []*File
+	failed := func(part string, err error) {
+		summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %v", part, err))
+	}
+
+	if version, err := c.get("/version"); err != nil {
+		failed("version", err)
+	} else {
+		summary.Version = version
+	}
+
+	if record, err := c.get("/ceremonies/" + requestID); err != nil {
+		failed("ceremony record", err)
+	} else {
+		files = append(files, &File{Name: "ceremony.json", Data: record})
+	}
+
+	if messages, err := c.messages(requestID); err != nil {
+		failed("message metadata", err)
+	} else {
+		files = append(files, &File{Name: "messages.json", Data: messages})
+	}
+
+	outputs, err := c.get("/ceremonies/" + requestID + "/committee-outputs")
+	switch {
+	case err == nil:
+		files = append(files, &File{Name: "committee-outputs.json", Data: outputs})
+	case !errors.Is(err, errNotFound):
+		failed("committee outputs", err)
+	}
+
+	if lines, err := c.readLog(requestID); err != nil {
+		failed("log", err)
+	} else {
+		files = append(files, &File{Name: "node.log", Data: []byte(strings.Join(lines, "\n") + "\n")})
+	}
+
+	if c.CeremonyLogDir != "" {
+		lines, err := c.readCeremonyLog(requestID)
+		switch {
+		case err != nil:
+			failed("ceremony log", err)
+		case len(lines) > 0:
+			files = append(files, &File{Name: "ceremony.log", Data: []byte(strings.Join(lines, "\n") + "\n")})
+		}
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("Collect: %w", err)
+	}
+	return append([]*File{{Name: "summary.json", Data: data}}, files...), nil
+}
+
+// messages returns the metadata of the messages of the transcript the node
+// recorded for requestID
+func (c *Collector) messages(requestID string) ([]byte, error) {
+	byts, err := c.get("/ceremonies/" + requestID + "/transcript")
+	if err != nil {
+		return nil, err
+	}
+	record := &observer.TranscriptRecord{}
+	if err := json.Unmarshal(byts, record); err != nil {
+		return nil, err
+	}
+	messages, err := Messages(record)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(messages, "", "  ")
+}
+
+func (c *Collector) get(path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.Node, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("status %s: %s", resp.Status, Sanitize(string(body)))
+	}
+	return body, nil
+}
+
+func (c *Collector) readLog(requestID string) ([]string, error) {
+	file, err := os.Open(c.LogPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return FilterLog(file, requestID, c.MaxLogLines)
+}
+
+// readCeremonyLog returns the sanitized lines of the log files of the
+// ceremony, oldest first
+func (c *Collector) readCeremonyLog(requestID string) ([]string, error) {
+	paths, err := logger.CeremonyLogFiles(c.CeremonyLogDir, requestID)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		// every line of the file belongs to the ceremony
+		fileLines, err := FilterLog(file, "", 0)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, fileLines...)
+	}
+	return lines, nil
+}
+
+// Write writes files into the directory dir of a gzipped tar archive
+func Write(w io.Writer, dir string, files []*File) error {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	now := time.Now()
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    dir + "/" + file.Name,
+			Mode:    0o644,
+			Size:    int64(len(file.Data)),
+			ModTime: now,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return fmt.Errorf("Write: %w", err)
+		}
+		if _, err := archive.Write(file.Data); err != nil {
+			return fmt.Errorf("Write: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	return gz.Close()
+}
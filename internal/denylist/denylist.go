@@ -0,0 +1,282 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package denylist keeps the operators an initiator refuses to put in a new
+// committee: operators blamed in an earlier ceremony, flagged by hand or
+// listed by a signed remote feed.
+package denylist
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Sources of an entry, manual and blame entries are never replaced by a feed
+const (
+	SourceManual = "manual"
+	SourceBlame  = "blame"
+	SourceFeed   = "feed"
+)
+
+var feedLabel = []byte("rockx-dkg-denylist-feed")
+
+var ErrStaleFeed = errors.New("feed isn't newer than the last one applied")
+
+type Entry struct {
+	OperatorID types.OperatorID `json:"operator_id"`
+	Reason     string           `json:"reason"`
+	Source     string           `json:"source"`
+	// RequestID is the ceremony the operator was blamed in
+	RequestID string `json:"request_id,omitempty"`
+	AddedAt   int64  `json:"added_at"`
+}
+
+// List is the denylist of the cli, it is stored as a json file next to the
+// address book
+type List struct {
+	mu        sync.Mutex
+	path      string
+	Operators map[types.OperatorID]*Entry `json:"operators"`
+	// FeedSequence is the sequence of the last feed applied
+	FeedSequence uint64 `json:"feed_sequence,omitempty"`
+}
+
+// DefaultPath is $DKG_DENYLIST or ~/.rockx-dkg/denylist.json
+func DefaultPath() string {
+	if path := os.Getenv("DKG_DENYLIST"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "denylist.json"
+	}
+	return filepath.Join(home, ".rockx-dkg", "denylist.json")
+}
+
+// Load reads the list at path, a missing file is an empty list
+func Load(path string) (*List, error) {
+	list := &List{path: path, Operators: make(map[types.OperatorID]*Entry)}
+
+	byts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return list, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read denylist %s: %w", path, err)
+	}
+	if err := json.Unmarshal(byts, list); err != nil {
+		return nil, fmt.Errorf("failed to parse denylist %s: %w", path, err)
+	}
+	if list.Operators == nil {
+		list.Operators = make(map[types.OperatorID]*Entry)
+	}
+	return list, nil
+}
+
+func (l *List) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	byts, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	// write to a temp file first so a crash never leaves half a list behind
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, byts, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// Add lists an operator, an entry of a feed gives way to a manual or blame
+// entry but not the other way around
+func (l *List) Add(entry *Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if existing, ok := l.Operators[entry.OperatorID]; ok && existing.Source != SourceFeed && entry.Source == SourceFeed {
+		return
+	}
+	if entry.AddedAt == 0 {
+		entry.AddedAt = time.Now().Unix()
+	}
+	l.Operators[entry.OperatorID] = entry
+}
+
+func (l *List) Remove(operatorID types.OperatorID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.Operators[operatorID]
+	delete(l.Operators, operatorID)
+	return ok
+}
+
+// List returns the entries ordered by operator ID
+func (l *List) List() []*Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]*Entry, 0, len(l.Operators))
+	for _, entry := range l.Operators {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].OperatorID < entries[j].OperatorID })
+	return entries
+}
+
+// Listed returns the entries of the operators that are on the list, ordered
+// by operator ID
+func (l *List) Listed(operators []types.OperatorID) []*Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var listed []*Entry
+	for _, operatorID := range operators {
+		if entry, ok := l.Operators[operatorID]; ok {
+			listed = append(listed, entry)
+		}
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].OperatorID < listed[j].OperatorID })
+	return listed
+}
+
+// Feed is a denylist published for many initiators, the sequence only grows
+type Feed struct {
+	Sequence  uint64      `json:"sequence"`
+	IssuedAt  int64       `json:"issued_at"`
+	Operators []FeedEntry `json:"operators"`
+}
+
+type FeedEntry struct {
+	OperatorID types.OperatorID `json:"operator_id"`
+	Reason     string           `json:"reason"`
+}
+
+// SignedFeed is a feed with the signature of its publisher
+type SignedFeed struct {
+	Feed Feed `json:"feed"`
+	// Signer is the fingerprint of the publisher key
+	Signer    string `json:"signer"`
+	Signature string `json:"signature"`
+}
+
+func feedDigest(feed *Feed) ([]byte, error) {
+	byts, err := json.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(append(append([]byte{}, feedLabel...), byts...))
+	return digest[:], nil
+}
+
+// SignFeed signs the feed with the key of its publisher
+func SignFeed(sk *rsa.PrivateKey, feed *Feed) (*SignedFeed, error) {
+	digest, err := feedDigest(feed)
+	if err != nil {
+		return nil, fmt.Errorf("SignFeed: %w", err)
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, sk, crypto.SHA256, digest)
+	if err != nil {
+		return nil, fmt.Errorf("SignFeed: failed to sign feed: %w", err)
+	}
+	fingerprint, err := coordinator.Fingerprint(&sk.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("SignFeed: %w", err)
+	}
+	return &SignedFeed{Feed: *feed, Signer: fingerprint, Signature: hex.EncodeToString(signature)}, nil
+}
+
+// Verify checks the feed was signed with the pinned publisher key
+func (s *SignedFeed) Verify(pk *rsa.PublicKey) error {
+	fingerprint, err := coordinator.Fingerprint(pk)
+	if err != nil {
+		return err
+	}
+	if fingerprint != s.Signer {
+		return fmt.Errorf("feed is signed by %s, not by the pinned key %s", s.Signer, fingerprint)
+	}
+	signature, err := hex.DecodeString(s.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	digest, err := feedDigest(&s.Feed)
+	if err != nil {
+		return err
+	}
+	if err := rsa.VerifyPKCS1v15(pk, crypto.SHA256, digest, signature); err != nil {
+		return errors.New("invalid feed signature")
+	}
+	return nil
+}
+
+// ApplyFeed replaces the feed entries of the list with the ones of a newer
+// feed and returns how many operators were added and dropped
+func (l *List) ApplyFeed(feed *Feed) (int, int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if feed.Sequence <= l.FeedSequence {
+		return 0, 0, fmt.Errorf("%w: sequence %d, last applied %d", ErrStaleFeed, feed.Sequence, l.FeedSequence)
+	}
+
+	listed := make(map[types.OperatorID]FeedEntry)
+	for _, entry := range feed.Operators {
+		listed[entry.OperatorID] = entry
+	}
+	dropped := 0
+	for operatorID, entry := range l.Operators {
+		if _, ok := listed[operatorID]; entry.Source == SourceFeed && !ok {
+			delete(l.Operators, operatorID)
+			dropped++
+		}
+	}
+	added := 0
+	for operatorID, entry := range listed {
+		if existing, ok := l.Operators[operatorID]; ok {
+			if existing.Source == SourceFeed {
+				existing.Reason = entry.Reason
+			}
+			continue
+		}
+		l.Operators[operatorID] = &Entry{OperatorID: operatorID, Reason: entry.Reason, Source: SourceFeed, AddedAt: feed.IssuedAt}
+		added++
+	}
+	l.FeedSequence = feed.Sequence
+	return added, dropped, nil
+}
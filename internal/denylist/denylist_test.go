@@ -0,0 +1,102 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package denylist
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"path/filepath"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dkg", "denylist.json")
+
+	list, err := Load(path)
+	require.NoError(t, err)
+	require.Empty(t, list.List())
+
+	list.Add(&Entry{OperatorID: 7, Reason: "invalid share", Source: SourceBlame, RequestID: "abcd"})
+	list.Add(&Entry{OperatorID: 3, Reason: "key leaked", Source: SourceManual})
+	require.NoError(t, list.Save())
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	entries := loaded.List()
+	require.Len(t, entries, 2)
+	require.EqualValues(t, 3, entries[0].OperatorID)
+	require.Equal(t, "abcd", entries[1].RequestID)
+	require.NotZero(t, entries[1].AddedAt)
+
+	listed := loaded.Listed([]types.OperatorID{1, 2, 7, 4})
+	require.Len(t, listed, 1)
+	require.EqualValues(t, 7, listed[0].OperatorID)
+
+	require.True(t, loaded.Remove(7))
+	require.False(t, loaded.Remove(7))
+	require.Empty(t, loaded.Listed([]types.OperatorID{7}))
+}
+
+func TestApplyFeed(t *testing.T) {
+	list, err := Load(filepath.Join(t.TempDir(), "denylist.json"))
+	require.NoError(t, err)
+	list.Add(&Entry{OperatorID: 1, Reason: "flagged by hand", Source: SourceManual})
+
+	added, dropped, err := list.ApplyFeed(&Feed{Sequence: 1, Operators: []FeedEntry{{OperatorID: 1, Reason: "feed"}, {OperatorID: 2, Reason: "feed"}}})
+	require.NoError(t, err)
+	require.Equal(t, 1, added)
+	require.Equal(t, 0, dropped)
+	// the manual entry stays as it was
+	require.Equal(t, SourceManual, list.Operators[1].Source)
+
+	added, dropped, err = list.ApplyFeed(&Feed{Sequence: 2, Operators: []FeedEntry{{OperatorID: 3, Reason: "feed"}}})
+	require.NoError(t, err)
+	require.Equal(t, 1, added)
+	require.Equal(t, 1, dropped)
+	require.Len(t, list.List(), 2)
+
+	_, _, err = list.ApplyFeed(&Feed{Sequence: 2})
+	require.ErrorIs(t, err, ErrStaleFeed)
+
+	// a feed entry gives way to an operator flagged by hand
+	list.Add(&Entry{OperatorID: 3, Reason: "flagged by hand", Source: SourceManual})
+	list.Add(&Entry{OperatorID: 3, Reason: "feed", Source: SourceFeed})
+	require.Equal(t, SourceManual, list.Operators[3].Source)
+}
+
+func TestSignedFeed(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	signed, err := SignFeed(sk, &Feed{Sequence: 5, IssuedAt: 1700000000, Operators: []FeedEntry{{OperatorID: 9, Reason: "blamed"}}})
+	require.NoError(t, err)
+	require.NoError(t, signed.Verify(&sk.PublicKey))
+	require.Error(t, signed.Verify(&other.PublicKey))
+
+	signed.Feed.Operators = nil
+	require.ErrorContains(t, signed.Verify(&sk.PublicKey), "invalid feed signature")
+}
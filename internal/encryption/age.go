@@ -0,0 +1,436 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// The age v1 file format (https://age-encryption.org/v1) with X25519
+// recipients, so artifacts encrypted by the cli open with the age tools and
+// the other way around.
+
+const (
+	ageIntro         = "age-encryption.org/v1"
+	ageX25519Label   = "age-encryption.org/v1/X25519"
+	ageRecipientHRP  = "age"
+	ageIdentityHRP   = "AGE-SECRET-KEY-"
+	ageArmorBegin    = "-----BEGIN AGE ENCRYPTED FILE-----"
+	ageArmorEnd      = "-----END AGE ENCRYPTED FILE-----"
+	ageFileKeySize   = 16
+	ageChunkSize     = 64 * 1024
+	ageStanzaColumns = 48 // raw bytes per 64 character base64 line
+)
+
+var ErrNoAgeIdentity = errors.New("no identity matched any of the file's recipients")
+
+// AgeRecipient is an X25519 public key, age1...
+type AgeRecipient struct {
+	key []byte
+}
+
+// AgeIdentity is an X25519 private key, AGE-SECRET-KEY-1...
+type AgeIdentity struct {
+	key       []byte
+	recipient *AgeRecipient
+}
+
+func ParseAgeRecipient(s string) (*AgeRecipient, error) {
+	hrp, key, err := bech32Decode(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %q: %w", s, err)
+	}
+	if hrp != ageRecipientHRP || len(key) != curve25519.PointSize {
+		return nil, fmt.Errorf("invalid age recipient %q: not an X25519 public key", s)
+	}
+	return &AgeRecipient{key: key}, nil
+}
+
+func (r *AgeRecipient) String() string {
+	s, _ := bech32Encode(ageRecipientHRP, r.key)
+	return s
+}
+
+func GenerateAgeIdentity() (*AgeIdentity, error) {
+	key := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return newAgeIdentity(key)
+}
+
+func ParseAgeIdentity(s string) (*AgeIdentity, error) {
+	hrp, key, err := bech32Decode(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age identity: %w", err)
+	}
+	if hrp != strings.ToLower(ageIdentityHRP) || len(key) != curve25519.ScalarSize {
+		return nil, errors.New("invalid age identity: not an X25519 secret key")
+	}
+	return newAgeIdentity(key)
+}
+
+// ParseAgeIdentities reads an identity file as written by age-keygen, one
+// identity per line with # comments
+func ParseAgeIdentities(r io.Reader) ([]*AgeIdentity, error) {
+	identities := []*AgeIdentity{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		identity, err := ParseAgeIdentity(line)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(identities) == 0 {
+		return nil, errors.New("no age identities found")
+	}
+	return identities, nil
+}
+
+func newAgeIdentity(key []byte) (*AgeIdentity, error) {
+	pk, err := curve25519.X25519(key, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &AgeIdentity{key: key, recipient: &AgeRecipient{key: pk}}, nil
+}
+
+func (i *AgeIdentity) Recipient() *AgeRecipient {
+	return i.recipient
+}
+
+func (i *AgeIdentity) String() string {
+	s, _ := bech32Encode(ageIdentityHRP, i.key)
+	return s
+}
+
+type ageStanza struct {
+	args []string
+	body []byte
+}
+
+// EncryptAge encrypts plaintext to every recipient
+func EncryptAge(plaintext []byte, recipients ...*AgeRecipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no age recipients")
+	}
+	fileKey := make([]byte, ageFileKeySize)
+	if _, err := io.ReadFull(rand.Reader, fileKey); err != nil {
+		return nil, err
+	}
+
+	stanzas := []*ageStanza{}
+	for _, r := range recipients {
+		stanza, err := r.wrap(fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap file key for %s: %w", r, err)
+		}
+		stanzas = append(stanzas, stanza)
+	}
+
+	out := &bytes.Buffer{}
+	header := marshalAgeHeader(stanzas)
+	mac, err := ageHeaderMAC(fileKey, header)
+	if err != nil {
+		return nil, err
+	}
+	out.Write(header)
+	out.WriteString(" " + base64.RawStdEncoding.EncodeToString(mac) + "\n")
+
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out.Write(nonce)
+	payload, err := ageStream(fileKey, nonce, plaintext, true)
+	if err != nil {
+		return nil, err
+	}
+	out.Write(payload)
+	return out.Bytes(), nil
+}
+
+// DecryptAge decrypts a binary or armored age file with the first identity
+// that matches one of its recipients
+func DecryptAge(ciphertext []byte, identities ...*AgeIdentity) ([]byte, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(ciphertext), []byte(ageArmorBegin)) {
+		var err error
+		if ciphertext, err = dearmorAge(ciphertext); err != nil {
+			return nil, err
+		}
+	}
+
+	stanzas, header, mac, payload, err := parseAgeHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileKey []byte
+	for _, identity := range identities {
+		for _, stanza := range stanzas {
+			if fileKey, err = identity.unwrap(stanza); err == nil {
+				break
+			}
+		}
+		if fileKey != nil {
+			break
+		}
+	}
+	if fileKey == nil {
+		return nil, ErrNoAgeIdentity
+	}
+
+	expected, err := ageHeaderMAC(fileKey, header)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, expected) {
+		return nil, errors.New("age header MAC mismatch")
+	}
+	if len(payload) < 16 {
+		return nil, errors.New("age payload is truncated")
+	}
+	return ageStream(fileKey, payload[:16], payload[16:], false)
+}
+
+func (r *AgeRecipient) wrap(fileKey []byte) (*ageStanza, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, ephemeral); err != nil {
+		return nil, err
+	}
+	share, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(ephemeral, r.key)
+	if err != nil {
+		return nil, err
+	}
+	wrapKey, err := ageHKDF(shared, append(append([]byte{}, share...), r.key...), ageX25519Label)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	return &ageStanza{
+		args: []string{"X25519", base64.RawStdEncoding.EncodeToString(share)},
+		body: aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil),
+	}, nil
+}
+
+func (i *AgeIdentity) unwrap(stanza *ageStanza) ([]byte, error) {
+	if len(stanza.args) != 2 || stanza.args[0] != "X25519" {
+		return nil, errors.New("not an X25519 stanza")
+	}
+	share, err := base64.RawStdEncoding.Strict().DecodeString(stanza.args[1])
+	if err != nil || len(share) != curve25519.PointSize {
+		return nil, errors.New("invalid X25519 stanza")
+	}
+	shared, err := curve25519.X25519(i.key, share)
+	if err != nil {
+		return nil, err
+	}
+	wrapKey, err := ageHKDF(shared, append(append([]byte{}, share...), i.recipient.key...), ageX25519Label)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), stanza.body, nil)
+}
+
+// marshalAgeHeader is the header up to and including the --- of the MAC line
+func marshalAgeHeader(stanzas []*ageStanza) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(ageIntro + "\n")
+	for _, stanza := range stanzas {
+		b.WriteString("-> " + strings.Join(stanza.args, " ") + "\n")
+		// the body ends with a line shorter than 64 characters, empty if need be
+		body := stanza.body
+		for {
+			n := len(body)
+			if n > ageStanzaColumns {
+				n = ageStanzaColumns
+			}
+			b.WriteString(base64.RawStdEncoding.EncodeToString(body[:n]) + "\n")
+			body = body[n:]
+			if n < ageStanzaColumns {
+				break
+			}
+		}
+	}
+	b.WriteString("---")
+	return b.Bytes()
+}
+
+func parseAgeHeader(data []byte) (stanzas []*ageStanza, header, mac, payload []byte, err error) {
+	offset := 0
+	readLine := func() (string, error) {
+		end := bytes.IndexByte(data[offset:], '\n')
+		if end < 0 {
+			return "", errors.New("age header is truncated")
+		}
+		line := string(data[offset : offset+end])
+		offset += end + 1
+		return line, nil
+	}
+
+	line, err := readLine()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if line != ageIntro {
+		return nil, nil, nil, nil, errors.New("not an age v1 file")
+	}
+	for {
+		if line, err = readLine(); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if strings.HasPrefix(line, "--- ") {
+			break
+		}
+		if !strings.HasPrefix(line, "-> ") {
+			return nil, nil, nil, nil, fmt.Errorf("malformed age header line %q", line)
+		}
+		stanza := &ageStanza{args: strings.Split(strings.TrimPrefix(line, "-> "), " ")}
+		for {
+			bodyLine, err := readLine()
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			chunk, err := base64.RawStdEncoding.Strict().DecodeString(bodyLine)
+			if err != nil || len(bodyLine) > 64 {
+				return nil, nil, nil, nil, errors.New("malformed age stanza body")
+			}
+			stanza.body = append(stanza.body, chunk...)
+			if len(bodyLine) < 64 {
+				break
+			}
+		}
+		stanzas = append(stanzas, stanza)
+	}
+
+	if mac, err = base64.RawStdEncoding.Strict().DecodeString(strings.TrimPrefix(line, "--- ")); err != nil {
+		return nil, nil, nil, nil, errors.New("malformed age header MAC")
+	}
+	// the MAC covers the header up to the --- of its own line
+	headerEnd := offset - len(line) - 1 + len("---")
+	return stanzas, data[:headerEnd], mac, data[offset:], nil
+}
+
+func ageHeaderMAC(fileKey, header []byte) ([]byte, error) {
+	key, err := ageHKDF(fileKey, nil, "header")
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(header)
+	return h.Sum(nil), nil
+}
+
+// ageStream seals or opens the payload in 64 KiB chunks, the nonce of a chunk
+// is its counter and a flag marking the last one
+func ageStream(fileKey, nonce, in []byte, seal bool) ([]byte, error) {
+	key, err := ageHKDF(fileKey, nonce, "payload")
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := ageChunkSize
+	if !seal {
+		chunkSize += aead.Overhead()
+	}
+	out := []byte{}
+	chunkNonce := make([]byte, chacha20poly1305.NonceSize)
+	for counter := uint64(0); ; counter++ {
+		n := len(in)
+		if n > chunkSize {
+			n = chunkSize
+		}
+		last := len(in) == n
+		binary.BigEndian.PutUint64(chunkNonce[3:11], counter)
+		if last {
+			chunkNonce[11] = 1
+		}
+		if seal {
+			out = aead.Seal(out, chunkNonce, in[:n], nil)
+		} else {
+			if counter > 0 && n == aead.Overhead() {
+				return nil, errors.New("age payload ends with an empty chunk")
+			}
+			if out, err = aead.Open(out, chunkNonce, in[:n], nil); err != nil {
+				return nil, errors.New("age payload is corrupted or truncated")
+			}
+		}
+		in = in[n:]
+		if last {
+			return out, nil
+		}
+	}
+}
+
+func ageHKDF(secret, salt []byte, info string) ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func dearmorAge(data []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(text, ageArmorBegin) || !strings.HasSuffix(text, ageArmorEnd) {
+		return nil, errors.New("malformed age armor")
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, ageArmorBegin), ageArmorEnd)
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+}
@@ -0,0 +1,139 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBech32(t *testing.T) {
+	// valid strings of BIP 173
+	for _, s := range []string{
+		"A12UEL5L",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	} {
+		_, _, err := bech32Decode(s)
+		require.NoError(t, err, s)
+	}
+	for _, s := range []string{"A12UEL5l", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxx", "1pzry9x0s0muk"} {
+		_, _, err := bech32Decode(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestAgeKeys(t *testing.T) {
+	identity, err := GenerateAgeIdentity()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(identity.String(), "AGE-SECRET-KEY-1"))
+	require.True(t, strings.HasPrefix(identity.Recipient().String(), "age1"))
+
+	parsed, err := ParseAgeIdentity(identity.String())
+	require.NoError(t, err)
+	require.Equal(t, identity.Recipient().String(), parsed.Recipient().String())
+
+	recipient, err := ParseAgeRecipient(identity.Recipient().String())
+	require.NoError(t, err)
+	require.Equal(t, identity.Recipient().key, recipient.key)
+
+	_, err = ParseAgeRecipient(identity.String())
+	require.Error(t, err)
+
+	file := "# created: 2023-01-01\n# public key: " + recipient.String() + "\n" + identity.String() + "\n"
+	identities, err := ParseAgeIdentities(strings.NewReader(file))
+	require.NoError(t, err)
+	require.Len(t, identities, 1)
+}
+
+func TestAgeEncryptDecrypt(t *testing.T) {
+	alice, err := GenerateAgeIdentity()
+	require.NoError(t, err)
+	bob, err := GenerateAgeIdentity()
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 100, ageChunkSize, ageChunkSize + 1, 3*ageChunkSize + 17} {
+		plaintext := make([]byte, size)
+		_, _ = rand.Read(plaintext)
+
+		ciphertext, err := EncryptAge(plaintext, alice.Recipient(), bob.Recipient())
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(ciphertext, []byte("age-encryption.org/v1\n-> X25519 ")))
+
+		for _, identity := range []*AgeIdentity{alice, bob} {
+			decrypted, err := DecryptAge(ciphertext, identity)
+			require.NoError(t, err, size)
+			require.Equal(t, plaintext, decrypted)
+		}
+	}
+}
+
+func TestAgeDecryptFailures(t *testing.T) {
+	alice, err := GenerateAgeIdentity()
+	require.NoError(t, err)
+	eve, err := GenerateAgeIdentity()
+	require.NoError(t, err)
+
+	ciphertext, err := EncryptAge([]byte("deposit data"), alice.Recipient())
+	require.NoError(t, err)
+
+	_, err = DecryptAge(ciphertext, eve)
+	require.ErrorIs(t, err, ErrNoAgeIdentity)
+
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = DecryptAge(tampered, alice)
+	require.Error(t, err)
+
+	_, err = DecryptAge(ciphertext[:len(ciphertext)-1], alice)
+	require.Error(t, err)
+
+	// a recipient added to the header breaks its MAC
+	i := bytes.Index(ciphertext, []byte("\n---"))
+	extra := append(append(append([]byte{}, ciphertext[:i+1]...), []byte("-> X25519 "+base64.RawStdEncoding.EncodeToString(make([]byte, 32))+"\n\n")...), ciphertext[i+1:]...)
+	_, err = DecryptAge(extra, alice)
+	require.EqualError(t, err, "age header MAC mismatch")
+}
+
+func TestAgeArmor(t *testing.T) {
+	alice, err := GenerateAgeIdentity()
+	require.NoError(t, err)
+	ciphertext, err := EncryptAge([]byte("results"), alice.Recipient())
+	require.NoError(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString(ciphertext)
+	armored := ageArmorBegin + "\n"
+	for len(encoded) > 64 {
+		armored += encoded[:64] + "\n"
+		encoded = encoded[64:]
+	}
+	armored += encoded + "\n" + ageArmorEnd + "\n"
+
+	decrypted, err := DecryptAge([]byte(armored), alice)
+	require.NoError(t, err)
+	require.Equal(t, []byte("results"), decrypted)
+}
@@ -0,0 +1,121 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/artifacts"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/cryptosuite"
+)
+
+// Envelope is a payload encrypted with a random AES-256-GCM key, where the
+// AES key itself is wrapped with RSA-OAEP for the recipient. The type is part
+// of the public artifacts.
+type Envelope = artifacts.Envelope
+
+func SealRSA(pk *rsa.PublicKey, plaintext, label []byte) (*Envelope, error) {
+	if pk == nil {
+		return nil, errors.New("public key is nil")
+	}
+
+	suite, err := cryptosuite.Lookup(cryptosuite.Default)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(suite.Hash.New(), rand.Reader, pk, key, label)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap envelope key: %w", err)
+	}
+
+	nonce, ciphertext, err := sealAESGCM(key, plaintext, label)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		EncryptedKey: encryptedKey,
+		Nonce:        nonce,
+		Ciphertext:   ciphertext,
+		Suite:        suite.ID,
+	}, nil
+}
+
+func OpenRSA(sk *rsa.PrivateKey, envelope *Envelope, label []byte) ([]byte, error) {
+	if sk == nil {
+		return nil, errors.New("private key is nil")
+	}
+
+	suite, err := cryptosuite.Lookup(envelope.Suite)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := rsa.DecryptOAEP(suite.Hash.New(), rand.Reader, sk, envelope.EncryptedKey, label)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap envelope key: %w", err)
+	}
+	return openAESGCM(key, envelope.Nonce, envelope.Ciphertext, label)
+}
+
+func sealAESGCM(key, plaintext, additionalData []byte) ([]byte, []byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
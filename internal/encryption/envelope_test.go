@@ -0,0 +1,60 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpenRSA(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	plaintext := make([]byte, 4096)
+	_, _ = rand.Read(plaintext)
+
+	envelope, err := SealRSA(&sk.PublicKey, plaintext, []byte("label"))
+	require.NoError(t, err)
+
+	opened, err := OpenRSA(sk, envelope, []byte("label"))
+	require.NoError(t, err)
+	require.Equal(t, plaintext, opened)
+
+	_, err = OpenRSA(sk, envelope, []byte("other-label"))
+	require.Error(t, err)
+}
+
+func TestRSAPublicKeyEncoding(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	encoded, err := EncodeRSAPublicKey(&sk.PublicKey)
+	require.NoError(t, err)
+
+	decoded, err := DecodeRSAPublicKey(encoded)
+	require.NoError(t, err)
+	require.True(t, sk.PublicKey.Equal(decoded))
+}
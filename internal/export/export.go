@@ -0,0 +1,236 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package export turns the ceremony history of a node into relational tables
+// for reporting. Shares and keys are never part of it.
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Source is the part of the node storage the export reads
+type Source interface {
+	ListCeremonyIDs() ([]string, error)
+	GetCeremonyEvents(requestID string) ([]*ceremony.Event, error)
+	ListHandoverTombstones() ([]*storage.HandoverTombstone, error)
+}
+
+type ColumnType string
+
+const (
+	Text    ColumnType = "TEXT"
+	Integer ColumnType = "INTEGER"
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Table holds rows of string, int64 or nil values in column order
+type Table struct {
+	Name    string
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+func (t *Table) add(values ...interface{}) {
+	t.Rows = append(t.Rows, values)
+}
+
+// Build reads every ceremony and handover of the node into the tables
+// ceremonies, ceremony_events, operator_stats and handovers
+func Build(src Source) ([]*Table, error) {
+	ceremonies := &Table{Name: "ceremonies", Columns: []Column{
+		{"request_id", Text}, {"kind", Text}, {"state", Text}, {"threshold", Integer},
+		{"operators", Text}, {"old_operators", Text}, {"validator_pk", Text},
+		{"created_at", Text}, {"updated_at", Text}, {"duration_seconds", Integer}, {"event_count", Integer},
+	}}
+	events := &Table{Name: "ceremony_events", Columns: []Column{
+		{"request_id", Text}, {"seq", Integer}, {"type", Text}, {"time", Text},
+		{"operator", Integer}, {"round", Text}, {"missing", Text}, {"details", Text},
+	}}
+	handovers := &Table{Name: "handovers", Columns: []Column{
+		{"validator_pk", Text}, {"record_hash", Text}, {"exported_at", Text},
+	}}
+
+	ids, err := src.ListCeremonyIDs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ceremonies: %w", err)
+	}
+	sort.Strings(ids)
+
+	stats := newOperatorStats()
+	for _, requestID := range ids {
+		stored, err := src.GetCeremonyEvents(requestID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load events of ceremony %s: %w", requestID, err)
+		}
+		c, err := ceremony.Replay(requestID, stored)
+		if err != nil {
+			return nil, err
+		}
+
+		params := c.Params
+		if params == nil {
+			params = &ceremony.Params{}
+		}
+		ceremonies.add(
+			c.RequestID, string(params.Kind), string(c.State), int64(params.Threshold),
+			joinOperators(params.Operators), joinOperators(params.OldOperators), nullable(validatorPK(c)),
+			formatTime(c.CreatedAt), formatTime(c.UpdatedAt), int64(c.UpdatedAt.Sub(c.CreatedAt).Seconds()), int64(len(c.Events)),
+		)
+		for _, e := range c.Events {
+			var operator interface{}
+			if e.Operator != 0 {
+				operator = int64(e.Operator)
+			}
+			events.add(
+				c.RequestID, int64(e.Seq), string(e.Type), formatTime(e.Time),
+				operator, nullable(e.Round), nullable(joinOperators(e.Missing)), nullable(e.Details),
+			)
+		}
+		stats.add(c)
+	}
+
+	tombstones, err := src.ListHandoverTombstones()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list handovers: %w", err)
+	}
+	for _, tombstone := range tombstones {
+		handovers.add(tombstone.ValidatorPK, tombstone.RecordHash, formatTime(time.Unix(tombstone.ExportedAt, 0)))
+	}
+
+	return []*Table{ceremonies, events, stats.table(), handovers}, nil
+}
+
+type operatorStat struct {
+	ceremonies, completed, received, rejected, missed, unresponsive int64
+}
+
+type operatorStats map[types.OperatorID]*operatorStat
+
+func newOperatorStats() operatorStats {
+	return make(operatorStats)
+}
+
+func (s operatorStats) get(operatorID types.OperatorID) *operatorStat {
+	stat, ok := s[operatorID]
+	if !ok {
+		stat = &operatorStat{}
+		s[operatorID] = stat
+	}
+	return stat
+}
+
+// add counts a ceremony for its participants as seen by this node
+func (s operatorStats) add(c *ceremony.Ceremony) {
+	if c.Params != nil {
+		participants := make(map[types.OperatorID]bool)
+		for _, ids := range [][]types.OperatorID{c.Params.Operators, c.Params.OldOperators} {
+			for _, id := range ids {
+				participants[id] = true
+			}
+		}
+		for id := range participants {
+			stat := s.get(id)
+			stat.ceremonies++
+			if c.State == ceremony.StateCompleted {
+				stat.completed++
+			}
+		}
+	}
+
+	for _, e := range c.Events {
+		switch e.Type {
+		case ceremony.EventMessageReceived:
+			s.get(e.Operator).received++
+		case ceremony.EventMessageRejected:
+			s.get(e.Operator).rejected++
+		case ceremony.EventTimedOut:
+			for _, id := range e.Missing {
+				s.get(id).missed++
+			}
+		case ceremony.EventPeerUnresponsive:
+			s.get(e.Operator).unresponsive++
+		}
+	}
+}
+
+func (s operatorStats) table() *Table {
+	t := &Table{Name: "operator_stats", Columns: []Column{
+		{"operator_id", Integer}, {"ceremonies", Integer}, {"completed", Integer},
+		{"messages_received", Integer}, {"messages_rejected", Integer},
+		{"timeouts_missing", Integer}, {"unresponsive", Integer},
+	}}
+	ids := make([]types.OperatorID, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		stat := s[id]
+		t.add(int64(id), stat.ceremonies, stat.completed, stat.received, stat.rejected, stat.missed, stat.unresponsive)
+	}
+	return t
+}
+
+func validatorPK(c *ceremony.Ceremony) string {
+	for _, e := range c.Events {
+		if e.ValidatorPK != "" {
+			return e.ValidatorPK
+		}
+	}
+	if c.Params != nil {
+		return c.Params.ValidatorPK
+	}
+	return ""
+}
+
+func joinOperators(ids []types.OperatorID) string {
+	strs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strs = append(strs, fmt.Sprintf("%d", id))
+	}
+	return strings.Join(strs, ",")
+}
+
+func formatTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
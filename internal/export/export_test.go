@@ -0,0 +1,165 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+type testSource struct {
+	events     map[string][]*ceremony.Event
+	tombstones []*storage.HandoverTombstone
+}
+
+func (s *testSource) AppendCeremonyEvent(requestID string, e *ceremony.Event) error {
+	s.events[requestID] = append(s.events[requestID], e)
+	return nil
+}
+
+func (s *testSource) ListCeremonyIDs() ([]string, error) {
+	ids := make([]string, 0, len(s.events))
+	for id := range s.events {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *testSource) GetCeremonyEvents(requestID string) ([]*ceremony.Event, error) {
+	events, ok := s.events[requestID]
+	if !ok {
+		return nil, ceremony.ErrCeremonyNotFound
+	}
+	return events, nil
+}
+
+func (s *testSource) ListHandoverTombstones() ([]*storage.HandoverTombstone, error) {
+	return s.tombstones, nil
+}
+
+func testSourceWithHistory(t *testing.T) *testSource {
+	src := &testSource{events: make(map[string][]*ceremony.Event)}
+	tracker := ceremony.NewTracker(src)
+
+	record := func(requestID string, eventType ceremony.EventType, fill func(*ceremony.Event)) {
+		_, err := tracker.Record(requestID, eventType, fill)
+		require.NoError(t, err)
+	}
+
+	record("aa", ceremony.EventCreated, func(e *ceremony.Event) {
+		e.Params = &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3, 4}, Threshold: 3}
+	})
+	record("aa", ceremony.EventInitialized, nil)
+	record("aa", ceremony.EventMessageReceived, func(e *ceremony.Event) { e.Operator = 2; e.Round = "round1" })
+	record("aa", ceremony.EventMessageRejected, func(e *ceremony.Event) { e.Operator = 3; e.Details = "it's invalid" })
+	record("aa", ceremony.EventRound1, nil)
+	record("aa", ceremony.EventRound2, nil)
+	record("aa", ceremony.EventOutputPending, nil)
+	record("aa", ceremony.EventCompleted, func(e *ceremony.Event) { e.ValidatorPK = "abcd" })
+
+	record("bb", ceremony.EventCreated, func(e *ceremony.Event) {
+		e.Params = &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3, 5}, Threshold: 3}
+	})
+	record("bb", ceremony.EventInitialized, nil)
+	record("bb", ceremony.EventTimedOut, func(e *ceremony.Event) { e.Missing = []types.OperatorID{5} })
+
+	src.tombstones = []*storage.HandoverTombstone{{ValidatorPK: "abcd", RecordHash: "ff", ExportedAt: 1700000000}}
+	return src
+}
+
+func tableByName(tables []*Table, name string) *Table {
+	for _, t := range tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func TestBuild(t *testing.T) {
+	tables, err := Build(testSourceWithHistory(t))
+	require.NoError(t, err)
+	require.Len(t, tables, 4)
+
+	ceremonies := tableByName(tables, "ceremonies")
+	require.Len(t, ceremonies.Rows, 2)
+	require.Equal(t, "aa", ceremonies.Rows[0][0])
+	require.Equal(t, string(ceremony.StateCompleted), ceremonies.Rows[0][2])
+	require.Equal(t, "1,2,3,4", ceremonies.Rows[0][4])
+	require.Equal(t, "abcd", ceremonies.Rows[0][6])
+	require.Nil(t, ceremonies.Rows[1][6])
+
+	events := tableByName(tables, "ceremony_events")
+	require.Len(t, events.Rows, 11)
+
+	stats := tableByName(tables, "operator_stats")
+	require.Len(t, stats.Rows, 5)
+	// operator 5: one ceremony, missed its timeout
+	require.Equal(t, []interface{}{int64(5), int64(1), int64(0), int64(0), int64(0), int64(1), int64(0)}, stats.Rows[4])
+	// operator 3: two ceremonies, one rejected message
+	require.Equal(t, []interface{}{int64(3), int64(2), int64(1), int64(0), int64(1), int64(0), int64(0)}, stats.Rows[2])
+
+	handovers := tableByName(tables, "handovers")
+	require.Equal(t, []interface{}{"abcd", "ff", "2023-11-14T22:13:20Z"}, handovers.Rows[0])
+}
+
+func TestWriteSQLite(t *testing.T) {
+	tables, err := Build(testSourceWithHistory(t))
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteSQLite(&out, tables))
+	script := out.String()
+
+	require.True(t, strings.HasPrefix(script, "BEGIN TRANSACTION;\n"))
+	require.True(t, strings.HasSuffix(script, "COMMIT;\n"))
+	require.Contains(t, script, "CREATE TABLE ceremonies (request_id TEXT, kind TEXT")
+	require.Contains(t, script, "'it''s invalid'")
+	require.Contains(t, script, "INSERT INTO operator_stats (operator_id, ceremonies, completed, messages_received, messages_rejected, timeouts_missing, unresponsive) VALUES (5, 1, 0, 0, 0, 1, 0);")
+}
+
+func TestWriteCSV(t *testing.T) {
+	tables, err := Build(testSourceWithHistory(t))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, WriteCSV(dir, tables))
+
+	for _, table := range tables {
+		file, err := os.Open(filepath.Join(dir, table.Name+".csv"))
+		require.NoError(t, err)
+		records, err := csv.NewReader(file).ReadAll()
+		file.Close()
+		require.NoError(t, err)
+		require.Len(t, records, len(table.Rows)+1)
+		require.Len(t, records[0], len(table.Columns))
+	}
+}
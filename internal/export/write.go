@@ -0,0 +1,118 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteCSV writes every table to <dir>/<table>.csv with a header row, null
+// values are empty cells
+func WriteCSV(dir string, tables []*Table) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := writeCSVFile(filepath.Join(dir, t.Name+".csv"), t); err != nil {
+			return fmt.Errorf("failed to write %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+func writeCSVFile(path string, t *Table) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	header := make([]string, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		header = append(header, c.Name)
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		record := make([]string, 0, len(row))
+		for _, v := range row {
+			if v == nil {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, fmt.Sprint(v))
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteSQLite writes a SQL script creating and filling the tables in one
+// transaction, load it with `sqlite3 export.db < export.sql`
+func WriteSQLite(w io.Writer, tables []*Table) error {
+	var b strings.Builder
+	b.WriteString("BEGIN TRANSACTION;\n")
+	for _, t := range tables {
+		columns := make([]string, 0, len(t.Columns))
+		names := make([]string, 0, len(t.Columns))
+		for _, c := range t.Columns {
+			columns = append(columns, fmt.Sprintf("%s %s", c.Name, c.Type))
+			names = append(names, c.Name)
+		}
+		fmt.Fprintf(&b, "DROP TABLE IF EXISTS %s;\n", t.Name)
+		fmt.Fprintf(&b, "CREATE TABLE %s (%s);\n", t.Name, strings.Join(columns, ", "))
+
+		for _, row := range t.Rows {
+			values := make([]string, 0, len(row))
+			for _, v := range row {
+				values = append(values, sqlLiteral(v))
+			}
+			fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES (%s);\n", t.Name, strings.Join(names, ", "), strings.Join(values, ", "))
+		}
+	}
+	b.WriteString("COMMIT;\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sqlLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return fmt.Sprintf("%d", v)
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'"
+}
@@ -0,0 +1,137 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package failover
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LeaseStore grants a named lease to a single holder at a time
+type LeaseStore interface {
+	// Acquire takes or renews the lease for holder, it returns false while
+	// another holder's lease hasn't expired
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, name, holder string) error
+}
+
+// Elector keeps one of the instances running the same operator active. The
+// active instance renews its lease every third of the ttl, the standby takes
+// over once the lease of the active one expires.
+type Elector struct {
+	store  LeaseStore
+	name   string
+	holder string
+	ttl    time.Duration
+	logger *logrus.Logger
+
+	leader      atomic.Bool
+	lastRenewal time.Time
+
+	mu        sync.Mutex
+	onElected []func()
+}
+
+func NewElector(store LeaseStore, name, holder string, ttl time.Duration, logger *logrus.Logger) *Elector {
+	return &Elector{
+		store:  store,
+		name:   name,
+		holder: holder,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// OnElected registers fn to be called every time this instance becomes active
+func (e *Elector) OnElected(fn func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onElected = append(e.onElected, fn)
+}
+
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+func (e *Elector) Holder() string {
+	return e.holder
+}
+
+// Run campaigns until ctx is done and releases the lease on the way out
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	e.tick(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			if e.leader.Swap(false) {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+				if err := e.store.Release(releaseCtx, e.name, e.holder); err != nil {
+					e.logger.Errorf("Elector: failed to release lease %s: %v", e.name, err)
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+			e.tick(ctx)
+		}
+	}
+}
+
+func (e *Elector) tick(ctx context.Context) {
+	acquired, err := e.store.Acquire(ctx, e.name, e.holder, e.ttl)
+	if err != nil {
+		e.logger.Errorf("Elector: failed to renew lease %s: %v", e.name, err)
+		// without a renewal the other instance may take over once the lease expires
+		if e.leader.Load() && time.Since(e.lastRenewal) >= e.ttl {
+			e.leader.Store(false)
+			e.logger.Warnf("Elector: %s stepped down, lease %s expired", e.holder, e.name)
+		}
+		return
+	}
+
+	if !acquired {
+		if e.leader.Swap(false) {
+			e.logger.Warnf("Elector: %s lost lease %s", e.holder, e.name)
+		}
+		return
+	}
+
+	e.lastRenewal = time.Now()
+	if e.leader.Swap(true) {
+		return
+	}
+	e.logger.Infof("Elector: %s holds lease %s and is now active", e.holder, e.name)
+
+	e.mu.Lock()
+	callbacks := append([]func(){}, e.onElected...)
+	e.mu.Unlock()
+	for _, fn := range callbacks {
+		fn()
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package failover
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+type memLeaseStore struct {
+	mu        sync.Mutex
+	holder    string
+	expiresAt time.Time
+}
+
+func (s *memLeaseStore) Acquire(_ context.Context, _, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder != "" && s.holder != holder && time.Now().Before(s.expiresAt) {
+		return false, nil
+	}
+	s.holder = holder
+	s.expiresAt = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (s *memLeaseStore) Release(_ context.Context, _, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder == holder {
+		s.holder = ""
+	}
+	return nil
+}
+
+func TestElectorFailover(t *testing.T) {
+	store := &memLeaseStore{}
+	ttl := 60 * time.Millisecond
+
+	active := NewElector(store, "operator/1", "a", ttl, logrus.New())
+	standby := NewElector(store, "operator/1", "b", ttl, logrus.New())
+
+	elected := make(chan string, 2)
+	active.OnElected(func() { elected <- "a" })
+	standby.OnElected(func() { elected <- "b" })
+
+	ctx, stop := context.WithCancel(context.Background())
+	go active.Run(ctx)
+	require.Equal(t, "a", <-elected)
+
+	standbyCtx, stopStandby := context.WithCancel(context.Background())
+	defer stopStandby()
+	go standby.Run(standbyCtx)
+
+	time.Sleep(2 * ttl)
+	require.True(t, active.IsLeader())
+	require.False(t, standby.IsLeader(), "lease is renewed by the active instance")
+
+	// the active instance goes away, the standby takes over
+	stop()
+	select {
+	case holder := <-elected:
+		require.Equal(t, "b", holder)
+	case <-time.After(10 * ttl):
+		t.Fatal("standby never took over")
+	}
+	require.True(t, standby.IsLeader())
+	require.Eventually(t, func() bool { return !active.IsLeader() }, ttl, time.Millisecond)
+}
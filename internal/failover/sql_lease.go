@@ -0,0 +1,64 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package failover
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SQLLeaseStore keeps leases in the Postgres database the instances share.
+// Expiry is computed with the database clock so host clocks don't need to agree.
+type SQLLeaseStore struct {
+	db *sql.DB
+}
+
+func NewSQLLeaseStore(db *sql.DB) (*SQLLeaseStore, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS leases (name TEXT PRIMARY KEY, holder TEXT NOT NULL, expires_at TIMESTAMPTZ NOT NULL)`); err != nil {
+		return nil, fmt.Errorf("failed to create leases table: %w", err)
+	}
+	return &SQLLeaseStore{db: db}, nil
+}
+
+func (s *SQLLeaseStore) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	var current string
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, now() + $3 * interval '1 millisecond')
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE leases.holder = EXCLUDED.holder OR leases.expires_at < now()
+		RETURNING holder`,
+		name, holder, ttl.Milliseconds(),
+	).Scan(&current)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return current == holder, nil
+}
+
+func (s *SQLLeaseStore) Release(ctx context.Context, name, holder string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM leases WHERE name = $1 AND holder = $2`, name, holder)
+	return err
+}
@@ -0,0 +1,147 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package integration
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/stretchr/testify/require"
+)
+
+// forEachCommittee runs a test for every supported committee size, in short
+// mode only for the smallest
+func forEachCommittee(t *testing.T, test func(t *testing.T, n int)) {
+	for _, n := range ceremony.CommitteeSizes {
+		n := n
+		t.Run(fmt.Sprintf("%d operators", n), func(t *testing.T) {
+			if testing.Short() && n > ceremony.MinCommitteeSize {
+				t.Skip("large committees are skipped in short mode")
+			}
+			test(t, n)
+		})
+	}
+}
+
+func (c *cluster) keygen(operators []types.OperatorID) types.ValidatorPK {
+	threshold := ceremony.ThresholdFor(len(operators))
+	data := testingutils.InitMessageDataBytes(operators, uint16(threshold), make([]byte, 32), testingutils.TestingForkVersion)
+	requestID := c.start(dkg.InitMsgType, data, operators)
+	return c.requireOutputs(requestID, operators)
+}
+
+// requireOutputs checks that every operator got the signed outputs of all
+// operators for the same validator and stored the share it announced
+func (c *cluster) requireOutputs(requestID dkg.RequestID, operators []types.OperatorID) types.ValidatorPK {
+	t := c.t
+	var validatorPK types.ValidatorPK
+	for _, id := range operators {
+		output := c.nodes[id].lastOutput()
+		require.NotNil(t, output, "operator %d has no output", id)
+		require.Len(t, output, len(operators))
+
+		for signer, o := range output {
+			require.Equal(t, requestID, o.Data.RequestID)
+			if validatorPK == nil {
+				validatorPK = o.Data.ValidatorPubKey
+			}
+			require.Equal(t, validatorPK, o.Data.ValidatorPubKey, "operator %d disagrees on the validator", signer)
+
+			root, err := types.ComputeSigningRoot(o.Data, types.ComputeSignatureDomain(types.PrimusTestnet, types.DKGSignatureType))
+			require.NoError(t, err)
+			require.True(t, types.Verify(&c.keys[signer].PublicKey, root, o.Signature), "bad output signature of operator %d", signer)
+		}
+
+		stored, err := c.nodes[id].storage.GetKeyGenOutput(validatorPK)
+		require.NoError(t, err)
+		require.Equal(t, output[id].Data.SharePubKey, stored.Share.GetPublicKey().Serialize())
+	}
+	return validatorPK
+}
+
+func TestKeygenCommittees(t *testing.T) {
+	forEachCommittee(t, func(t *testing.T, n int) {
+		c := newCluster(t, n)
+		c.keygen(operatorRange(1, n))
+	})
+}
+
+func TestReshareCommittees(t *testing.T) {
+	forEachCommittee(t, func(t *testing.T, n int) {
+		c := newCluster(t, n+1)
+		validatorPK := c.keygen(operatorRange(1, n))
+
+		// threshold many operators of the old committee hand their shares to a
+		// committee that replaces operator 1 with operator n+1
+		threshold := ceremony.ThresholdFor(n)
+		oldOperators, newOperators := operatorRange(1, int(threshold)), operatorRange(2, n+1)
+		data := testingutils.ReshareMessageDataBytes(newOperators, uint16(threshold), validatorPK, oldOperators)
+		requestID := c.start(dkg.ReshareMsgType, data, operatorRange(1, n+1))
+		require.Equal(t, validatorPK, c.requireOutputs(requestID, newOperators))
+	})
+}
+
+func TestBlameCommittees(t *testing.T) {
+	forEachCommittee(t, func(t *testing.T, n int) {
+		c := newCluster(t, n)
+		culprit := types.OperatorID(n)
+		// the culprit sends a round 1 commitment that is not a curve point
+		c.tamper = func(msg *dkg.SignedMessage) *dkg.SignedMessage {
+			if msg.Signer != culprit || msg.Message.MsgType != dkg.ProtocolMsgType {
+				return msg
+			}
+			protocolMsg := &frost.ProtocolMsg{}
+			require.NoError(t, protocolMsg.Decode(msg.Message.Data))
+			if protocolMsg.Round1Message == nil {
+				return msg
+			}
+			protocolMsg.Round1Message.Commitment[0] = []byte("not a point")
+			data, err := protocolMsg.Encode()
+			require.NoError(t, err)
+
+			message := *msg.Message
+			message.Data = data
+			return c.resign(&dkg.SignedMessage{Message: &message, Signer: msg.Signer})
+		}
+
+		operators := operatorRange(1, n)
+		data := testingutils.InitMessageDataBytes(operators, uint16(ceremony.ThresholdFor(n)), make([]byte, 32), testingutils.TestingForkVersion)
+		c.start(dkg.InitMsgType, data, operators)
+
+		for _, id := range operators {
+			require.Nil(t, c.nodes[id].lastOutput(), "operator %d finished the keygen", id)
+
+			blame := c.nodes[id].lastBlame()
+			require.NotNil(t, blame, "operator %d has no blame", id)
+			require.True(t, blame.Valid)
+			protocolMsg := &frost.ProtocolMsg{}
+			require.NoError(t, protocolMsg.Decode(blame.BlameMessage.Message.Data))
+			require.Equal(t, frost.InvalidMessage, protocolMsg.BlameMessage.Type)
+			require.EqualValues(t, culprit, protocolMsg.BlameMessage.TargetOperatorID)
+		}
+	})
+}
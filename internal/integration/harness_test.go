@@ -0,0 +1,256 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package integration
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/keymanager"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/dkg/keysign"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// cluster is a set of operator nodes connected by an in-memory broadcast.
+// Messages are delivered one at a time in the order they were sent.
+type cluster struct {
+	t     *testing.T
+	keys  map[types.OperatorID]*rsa.PrivateKey
+	nodes map[types.OperatorID]*testNode
+
+	mu    sync.Mutex
+	queue []*dkg.SignedMessage
+	// participants of the running ceremony, broadcasts reach these operators
+	participants []types.OperatorID
+	// tamper rewrites the messages an operator broadcasts, nil leaves them as they are
+	tamper func(msg *dkg.SignedMessage) *dkg.SignedMessage
+}
+
+type testNode struct {
+	id      types.OperatorID
+	node    *dkg.Node
+	storage *storage.Storage
+
+	mu      sync.Mutex
+	outputs []map[types.OperatorID]*dkg.SignedOutput
+	blames  []*dkg.BlameOutput
+}
+
+// newCluster starts nodes for operators 1 to n with fresh keys served by a
+// test operator registry
+func newCluster(t *testing.T, n int) *cluster {
+	c := &cluster{
+		t:     t,
+		keys:  make(map[types.OperatorID]*rsa.PrivateKey),
+		nodes: make(map[types.OperatorID]*testNode),
+	}
+	for i := 1; i <= n; i++ {
+		sk, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		c.keys[types.OperatorID(i)] = sk
+	}
+	c.serveRegistry()
+
+	for id := range c.keys {
+		c.nodes[id] = c.newNode(id)
+	}
+	return c
+}
+
+func (c *cluster) serveRegistry() {
+	t := c.t
+	t.Setenv("USE_HARDCODED_OPERATORS", "false")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, err := strconv.Atoi(req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:])
+		sk, ok := c.keys[types.OperatorID(id)]
+		if err != nil || !ok {
+			http.NotFound(w, req)
+			return
+		}
+		der, _ := x509.MarshalPKIXPublicKey(&sk.PublicKey)
+		pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: der})
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":            id,
+			"owner_address": fmt.Sprintf("0x%040x", id),
+			"public_key":    base64.StdEncoding.EncodeToString(pemKey),
+		})
+	}))
+	old := storage.RegistryAPI
+	storage.RegistryAPI = server.URL
+	t.Cleanup(func() {
+		storage.RegistryAPI = old
+		server.Close()
+	})
+}
+
+func (c *cluster) newNode(id types.OperatorID) *testNode {
+	t := c.t
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil).WithMemTableSize(16 << 20))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	tn := &testNode{id: id, storage: storage.NewStorage(storage.NewBadgerDB(db), id, c.keys[id])}
+	_, operator, err := tn.storage.GetDKGOperator(id)
+	require.NoError(t, err)
+
+	tn.node = dkg.NewNode(operator, &dkg.Config{
+		KeygenProtocol:      frost.New,
+		ReshareProtocol:     frost.NewResharing,
+		KeySign:             keysign.NewSignature,
+		Network:             &testNetwork{cluster: c, node: tn},
+		Signer:              keymanager.NewKeyManager(types.PrimusTestnet),
+		Storage:             tn.storage,
+		SignatureDomainType: types.PrimusTestnet,
+	})
+	return tn
+}
+
+// start hands the signed start message to every participant, like the cli
+// posting it to each node, and delivers the broadcasts until none are left
+func (c *cluster) start(msgType dkg.MsgType, data []byte, participants []types.OperatorID) dkg.RequestID {
+	requestID := dkg.RequestID{}
+	_, err := rand.Read(requestID[:])
+	require.NoError(c.t, err)
+
+	c.participants = participants
+	signer := participants[0]
+	msg := testingutils.SignDKGMsg(c.keys[signer], signer, &dkg.Message{MsgType: msgType, Identifier: requestID, Data: data})
+	for _, id := range participants {
+		c.deliver(id, msg)
+	}
+	c.run()
+	return requestID
+}
+
+func (c *cluster) broadcast(msg *dkg.SignedMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tamper != nil {
+		msg = c.tamper(msg)
+	}
+	c.queue = append(c.queue, msg)
+}
+
+func (c *cluster) next() *dkg.SignedMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) == 0 {
+		return nil
+	}
+	msg := c.queue[0]
+	c.queue = c.queue[1:]
+	return msg
+}
+
+// run delivers queued messages to every participant but the sender
+func (c *cluster) run() {
+	for msg := c.next(); msg != nil; msg = c.next() {
+		for _, id := range c.participants {
+			if id != msg.Signer {
+				c.deliver(id, msg)
+			}
+		}
+	}
+}
+
+func (c *cluster) deliver(id types.OperatorID, msg *dkg.SignedMessage) {
+	data, err := msg.Encode()
+	require.NoError(c.t, err)
+	// messages for finished ceremonies are refused by the node, as they are in production
+	if err := c.nodes[id].node.ProcessMessage(&types.SSVMessage{MsgType: types.DKGMsgType, Data: data}); err != nil {
+		c.t.Logf("operator %d: message type %d from %d: %v", id, msg.Message.MsgType, msg.Signer, err)
+	}
+}
+
+// resign replaces the signature of a rewritten message with a valid one of its signer
+func (c *cluster) resign(msg *dkg.SignedMessage) *dkg.SignedMessage {
+	return testingutils.SignDKGMsg(c.keys[msg.Signer], msg.Signer, msg.Message)
+}
+
+func (tn *testNode) lastOutput() map[types.OperatorID]*dkg.SignedOutput {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	if len(tn.outputs) == 0 {
+		return nil
+	}
+	return tn.outputs[len(tn.outputs)-1]
+}
+
+func (tn *testNode) lastBlame() *dkg.BlameOutput {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	if len(tn.blames) == 0 {
+		return nil
+	}
+	return tn.blames[len(tn.blames)-1]
+}
+
+// testNetwork is the dkg.Network of one node of a cluster
+type testNetwork struct {
+	cluster *cluster
+	node    *testNode
+}
+
+func (n *testNetwork) StreamDKGBlame(blame *dkg.BlameOutput) error {
+	n.node.mu.Lock()
+	defer n.node.mu.Unlock()
+	n.node.blames = append(n.node.blames, blame)
+	return nil
+}
+
+func (n *testNetwork) StreamDKGOutput(output map[types.OperatorID]*dkg.SignedOutput) error {
+	n.node.mu.Lock()
+	defer n.node.mu.Unlock()
+	n.node.outputs = append(n.node.outputs, output)
+	return nil
+}
+
+func (n *testNetwork) BroadcastDKGMessage(msg *dkg.SignedMessage) error {
+	n.cluster.broadcast(msg)
+	return nil
+}
+
+func operatorRange(from, to int) []types.OperatorID {
+	ids := []types.OperatorID{}
+	for i := from; i <= to; i++ {
+		ids = append(ids, types.OperatorID(i))
+	}
+	return ids
+}
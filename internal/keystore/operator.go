@@ -0,0 +1,220 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrWrongPassword is returned when the checksum of a keystore doesn't match
+// the key derived from the password
+var ErrWrongPassword = errors.New("wrong keystore password")
+
+// OperatorKeystore is an EIP-2335 keystore, the format ssv operator keys are
+// encrypted in. The secret of an operator keystore is the base64 encoded PEM
+// of the RSA key, PubKey its public key.
+type OperatorKeystore struct {
+	Checksum keystoreModule `json:"checksum"`
+	Cipher   keystoreModule `json:"cipher"`
+	KDF      keystoreModule `json:"kdf"`
+	PubKey   string         `json:"pubKey,omitempty"`
+}
+
+type keystoreModule struct {
+	Function string          `json:"function"`
+	Params   json.RawMessage `json:"params"`
+	Message  string          `json:"message"`
+}
+
+type scryptParams struct {
+	DKLen int    `json:"dklen"`
+	N     int    `json:"n"`
+	P     int    `json:"p"`
+	R     int    `json:"r"`
+	Salt  string `json:"salt"`
+}
+
+type pbkdf2Params struct {
+	C     int    `json:"c"`
+	DKLen int    `json:"dklen"`
+	PRF   string `json:"prf"`
+	Salt  string `json:"salt"`
+}
+
+type cipherParams struct {
+	IV string `json:"iv"`
+}
+
+// IsOperatorKeystore tells an encrypted keystore apart from a plain key
+func IsOperatorKeystore(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("{")) {
+		return false
+	}
+	ks, err := parseOperatorKeystore(data)
+	return err == nil && ks.Cipher.Function != ""
+}
+
+// parseOperatorKeystore reads a bare keystore like ssv writes it, or one
+// nested in the crypto field of a full EIP-2335 keystore
+func parseOperatorKeystore(data []byte) (*OperatorKeystore, error) {
+	wrapped := &struct {
+		Crypto *OperatorKeystore `json:"crypto"`
+	}{}
+	if err := json.Unmarshal(data, wrapped); err != nil {
+		return nil, err
+	}
+	if wrapped.Crypto != nil {
+		return wrapped.Crypto, nil
+	}
+	ks := &OperatorKeystore{}
+	return ks, json.Unmarshal(data, ks)
+}
+
+// DecryptOperatorKey decrypts the secret of a keystore with its password
+func DecryptOperatorKey(data []byte, password string) ([]byte, error) {
+	ks, err := parseOperatorKeystore(bytes.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("DecryptOperatorKey: invalid keystore: %w", err)
+	}
+	key, err := ks.deriveKey(password)
+	if err != nil {
+		return nil, fmt.Errorf("DecryptOperatorKey: %w", err)
+	}
+	message, err := hex.DecodeString(ks.Cipher.Message)
+	if err != nil {
+		return nil, fmt.Errorf("DecryptOperatorKey: invalid cipher message: %w", err)
+	}
+	if ks.Checksum.Function != "sha256" {
+		return nil, fmt.Errorf("DecryptOperatorKey: unsupported checksum %q", ks.Checksum.Function)
+	}
+	checksum := sha256.Sum256(append(append([]byte{}, key[16:32]...), message...))
+	if hex.EncodeToString(checksum[:]) != strings.ToLower(ks.Checksum.Message) {
+		return nil, fmt.Errorf("DecryptOperatorKey: %w", ErrWrongPassword)
+	}
+
+	if ks.Cipher.Function != "aes-128-ctr" {
+		return nil, fmt.Errorf("DecryptOperatorKey: unsupported cipher %q", ks.Cipher.Function)
+	}
+	params := &cipherParams{}
+	if err := json.Unmarshal(ks.Cipher.Params, params); err != nil {
+		return nil, fmt.Errorf("DecryptOperatorKey: invalid cipher params: %w", err)
+	}
+	iv, err := hex.DecodeString(params.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("DecryptOperatorKey: invalid cipher iv")
+	}
+	return aesCTR(key[:16], iv, message)
+}
+
+// EncryptOperatorKey encrypts secret into a keystore with scrypt and
+// aes-128-ctr, the way ssv encrypts operator keys
+func EncryptOperatorKey(secret []byte, password, pubKey string) ([]byte, error) {
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	kdf, _ := json.Marshal(&scryptParams{DKLen: 32, N: 262144, P: 1, R: 8, Salt: hex.EncodeToString(salt)})
+	ks := &OperatorKeystore{
+		KDF:    keystoreModule{Function: "scrypt", Params: kdf, Message: ""},
+		PubKey: pubKey,
+	}
+	key, err := ks.deriveKey(password)
+	if err != nil {
+		return nil, fmt.Errorf("EncryptOperatorKey: %w", err)
+	}
+	message, err := aesCTR(key[:16], iv, secret)
+	if err != nil {
+		return nil, fmt.Errorf("EncryptOperatorKey: %w", err)
+	}
+	checksum := sha256.Sum256(append(append([]byte{}, key[16:32]...), message...))
+	cipherParamsJSON, _ := json.Marshal(&cipherParams{IV: hex.EncodeToString(iv)})
+	ks.Cipher = keystoreModule{Function: "aes-128-ctr", Params: cipherParamsJSON, Message: hex.EncodeToString(message)}
+	ks.Checksum = keystoreModule{Function: "sha256", Params: json.RawMessage("{}"), Message: hex.EncodeToString(checksum[:])}
+	return json.Marshal(ks)
+}
+
+// deriveKey runs the kdf of the keystore over the password, normalized to
+// NFKD and without control codes as EIP-2335 requires
+func (ks *OperatorKeystore) deriveKey(password string) ([]byte, error) {
+	normalized := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, norm.NFKD.String(password))
+
+	switch ks.KDF.Function {
+	case "scrypt":
+		params := &scryptParams{}
+		if err := json.Unmarshal(ks.KDF.Params, params); err != nil {
+			return nil, fmt.Errorf("invalid scrypt params: %w", err)
+		}
+		salt, err := hex.DecodeString(params.Salt)
+		if err != nil || params.DKLen < 32 {
+			return nil, fmt.Errorf("invalid scrypt params")
+		}
+		return scrypt.Key([]byte(normalized), salt, params.N, params.R, params.P, params.DKLen)
+	case "pbkdf2":
+		params := &pbkdf2Params{}
+		if err := json.Unmarshal(ks.KDF.Params, params); err != nil {
+			return nil, fmt.Errorf("invalid pbkdf2 params: %w", err)
+		}
+		salt, err := hex.DecodeString(params.Salt)
+		if err != nil || params.DKLen < 32 || params.C <= 0 {
+			return nil, fmt.Errorf("invalid pbkdf2 params")
+		}
+		if params.PRF != "hmac-sha256" {
+			return nil, fmt.Errorf("unsupported pbkdf2 prf %q", params.PRF)
+		}
+		return pbkdf2.Key([]byte(normalized), salt, params.C, params.DKLen, sha256.New), nil
+	}
+	return nil, fmt.Errorf("unsupported kdf %q", ks.KDF.Function)
+}
+
+func aesCTR(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
@@ -0,0 +1,253 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CeremonyField tags a log entry with the request id of a ceremony, entries
+// mentioning "request <id>" in their message are tagged as well
+const CeremonyField = "ceremony"
+
+// CeremonyLogDir is the directory of the ceremony logs in the data directory
+const CeremonyLogDir = "ceremony-logs"
+
+var ceremonyMention = regexp.MustCompile(`request ([0-9a-f]{48})\b`)
+
+// CeremonyLogConfig bounds the log files kept per ceremony
+type CeremonyLogConfig struct {
+	Dir string
+	// MaxBytes rotates a ceremony log growing past it
+	MaxBytes int64
+	// MaxFiles are the rotated files kept next to the current one
+	MaxFiles int
+	// Retention removes ceremony logs not written for longer
+	Retention time.Duration
+	// Interval between two retention sweeps
+	Interval time.Duration
+}
+
+var DefaultCeremonyLogConfig = CeremonyLogConfig{
+	MaxBytes:  10 << 20,
+	MaxFiles:  2,
+	Retention: 30 * 24 * time.Hour,
+	Interval:  time.Hour,
+}
+
+// CeremonyLogs is a hook writing the entries of each ceremony to a log file
+// of its own, <request id>.log in the directory of the config
+type CeremonyLogs struct {
+	config    CeremonyLogConfig
+	formatter logrus.Formatter
+
+	mu sync.Mutex
+}
+
+func NewCeremonyLogs(config CeremonyLogConfig) (*CeremonyLogs, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("NewCeremonyLogs: no directory")
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("NewCeremonyLogs: %w", err)
+	}
+	return &CeremonyLogs{config: config, formatter: &logrus.JSONFormatter{}}, nil
+}
+
+func (l *CeremonyLogs) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire appends the entry to the log of every ceremony it is tagged with
+func (l *CeremonyLogs) Fire(entry *logrus.Entry) error {
+	requestIDs := ceremonies(entry)
+	if len(requestIDs) == 0 {
+		return nil
+	}
+	line, err := l.formatter.Format(entry)
+	if err != nil {
+		return fmt.Errorf("Fire: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, requestID := range requestIDs {
+		if err := l.write(requestID, line); err != nil {
+			return fmt.Errorf("Fire: %w", err)
+		}
+	}
+	return nil
+}
+
+// ceremonies returns the request ids an entry is tagged with
+func ceremonies(entry *logrus.Entry) []string {
+	var requestIDs []string
+	if requestID, ok := entry.Data[CeremonyField].(string); ok && validRequestID(requestID) {
+		requestIDs = append(requestIDs, requestID)
+	}
+	for _, match := range ceremonyMention.FindAllStringSubmatch(entry.Message, -1) {
+		if !contains(requestIDs, match[1]) {
+			requestIDs = append(requestIDs, match[1])
+		}
+	}
+	return requestIDs
+}
+
+func validRequestID(requestID string) bool {
+	return len(requestID) == 48 && strings.Trim(requestID, "0123456789abcdef") == ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *CeremonyLogs) write(requestID string, line []byte) error {
+	path := l.Path(requestID)
+	if l.config.MaxBytes > 0 {
+		if info, err := os.Stat(path); err == nil && info.Size()+int64(len(line)) > l.config.MaxBytes {
+			if err := l.rotate(path); err != nil {
+				return err
+			}
+		}
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rotate shifts path to path.1, path.1 to path.2 and so on, dropping the
+// files past MaxFiles
+func (l *CeremonyLogs) rotate(path string) error {
+	if l.config.MaxFiles <= 0 {
+		return os.Remove(path)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", path, l.config.MaxFiles))
+	for i := l.config.MaxFiles - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
+
+// Path is the current log file of a ceremony
+func (l *CeremonyLogs) Path(requestID string) string {
+	return CeremonyLogPath(l.config.Dir, requestID)
+}
+
+func CeremonyLogPath(dir, requestID string) string {
+	return filepath.Join(dir, requestID+".log")
+}
+
+// CeremonyLogFiles returns the log files of a ceremony in dir, oldest first
+func CeremonyLogFiles(dir, requestID string) ([]string, error) {
+	if !validRequestID(requestID) {
+		return nil, fmt.Errorf("CeremonyLogFiles: invalid request id %q", requestID)
+	}
+	rotated, err := filepath.Glob(CeremonyLogPath(dir, requestID) + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("CeremonyLogFiles: %w", err)
+	}
+	// path.2 was rotated before path.1
+	sort.Slice(rotated, func(i, j int) bool {
+		return len(rotated[i]) > len(rotated[j]) || len(rotated[i]) == len(rotated[j]) && rotated[i] > rotated[j]
+	})
+	files := []string{}
+	for _, path := range append(rotated, CeremonyLogPath(dir, requestID)) {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// Prune removes the ceremony logs not written since the retention, it
+// returns how many files it removed
+func (l *CeremonyLogs) Prune(now time.Time) (int, error) {
+	if l.config.Retention <= 0 {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(l.config.Dir)
+	if err != nil {
+		return 0, fmt.Errorf("Prune: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || !strings.Contains(entry.Name(), ".log") {
+			continue
+		}
+		if now.Sub(info.ModTime()) < l.config.Retention {
+			continue
+		}
+		if err := os.Remove(filepath.Join(l.config.Dir, entry.Name())); err != nil {
+			return removed, fmt.Errorf("Prune: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Run prunes the ceremony logs every interval until done is closed
+func (l *CeremonyLogs) Run(done <-chan struct{}, logger *logrus.Logger) {
+	interval := l.config.Interval
+	if interval <= 0 {
+		interval = DefaultCeremonyLogConfig.Interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if removed, err := l.Prune(time.Now()); err != nil {
+			logger.Errorf("Run: failed to prune ceremony logs: %v", err)
+		} else if removed > 0 {
+			logger.Infof("Run: removed %d ceremony logs older than %s", removed, l.config.Retention)
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
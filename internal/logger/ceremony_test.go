@@ -0,0 +1,119 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package logger
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRequestA = "0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a"
+	testRequestB = "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b"
+)
+
+func testCeremonyLogger(t *testing.T, config CeremonyLogConfig) (*logrus.Logger, *CeremonyLogs) {
+	logs, err := NewCeremonyLogs(config)
+	require.NoError(t, err)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(logs)
+	return logger, logs
+}
+
+func readLines(t *testing.T, path string) []string {
+	byts, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(byts)), "\n")
+}
+
+func TestCeremonyLogs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), CeremonyLogDir)
+	logger, logs := testCeremonyLogger(t, CeremonyLogConfig{Dir: dir})
+
+	logger.Infof("HandleConsume: round 1 of request %s", testRequestA)
+	logger.WithField(CeremonyField, testRequestB).Warn("HandleConsume: late message")
+	logger.Infof("Rerequester: request %s waits for request %s", testRequestA, testRequestB)
+	logger.Info("Monitor: database passed 80% of its quota")
+
+	linesA := readLines(t, logs.Path(testRequestA))
+	require.Len(t, linesA, 2)
+	require.Contains(t, linesA[0], "round 1")
+	linesB := readLines(t, logs.Path(testRequestB))
+	require.Len(t, linesB, 2)
+	require.Contains(t, linesB[0], "late message")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestCeremonyLogsRotate(t *testing.T) {
+	dir := t.TempDir()
+	logger, logs := testCeremonyLogger(t, CeremonyLogConfig{Dir: dir, MaxBytes: 200, MaxFiles: 2})
+
+	for i := 0; i < 20; i++ {
+		logger.Infof("HandleConsume: message %02d of request %s", i, testRequestA)
+	}
+	files, err := CeremonyLogFiles(dir, testRequestA)
+	require.NoError(t, err)
+	require.Equal(t, []string{logs.Path(testRequestA) + ".2", logs.Path(testRequestA) + ".1", logs.Path(testRequestA)}, files)
+
+	// the newest entries are kept, oldest file first
+	var lines []string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		require.LessOrEqual(t, info.Size(), int64(200))
+		lines = append(lines, readLines(t, file)...)
+	}
+	require.Contains(t, lines[len(lines)-1], "message 19")
+	require.NotContains(t, strings.Join(lines, "\n"), "message 00")
+
+	_, err = CeremonyLogFiles(dir, "../secret")
+	require.Error(t, err)
+}
+
+func TestCeremonyLogsPrune(t *testing.T) {
+	dir := t.TempDir()
+	logger, logs := testCeremonyLogger(t, CeremonyLogConfig{Dir: dir, Retention: time.Hour})
+
+	logger.Infof("request %s", testRequestA)
+	logger.Infof("request %s", testRequestB)
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(logs.Path(testRequestA), old, old))
+
+	removed, err := logs.Prune(time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	_, err = os.Stat(logs.Path(testRequestA))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(logs.Path(testRequestB))
+	require.NoError(t, err)
+}
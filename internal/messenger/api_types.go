@@ -0,0 +1,88 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import "github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+
+// The wire types of the messenger API are defined by the public client so
+// the server and every consumer of the client agree on them.
+type (
+	APIResponse         = messengerclient.APIResponse
+	VersionResponse     = messengerclient.VersionResponse
+	PingResponse        = messengerclient.PingResponse
+	DataStore           = messengerclient.DataStore
+	TopicJSON           = messengerclient.TopicJSON
+	HistoryMessage      = messengerclient.HistoryMessage
+	SyncRequest         = messengerclient.SyncRequest
+	SyncResponse        = messengerclient.SyncResponse
+	TopicOutputs        = messengerclient.TopicOutputs
+	OutputPage          = messengerclient.OutputPage
+	BlamePage           = messengerclient.BlamePage
+	TopicPartials       = messengerclient.TopicPartials
+	TopicProgress       = messengerclient.TopicProgress
+	SealedStart         = messengerclient.SealedStart
+	SealedDelivery      = messengerclient.SealedDelivery
+	RelayedStart        = messengerclient.RelayedStart
+	RelayedDelivery     = messengerclient.RelayedDelivery
+	Change              = messengerclient.Change
+	ChangesResponse     = messengerclient.ChangesResponse
+	ReplicationSnapshot = messengerclient.ReplicationSnapshot
+	TopicSnapshot       = messengerclient.TopicSnapshot
+	ReplicationStatus   = messengerclient.ReplicationStatus
+	RelayKey            = messengerclient.RelayKey
+	Capabilities        = messengerclient.Capabilities
+	Webhook             = messengerclient.Webhook
+	WebhookNotification = messengerclient.WebhookNotification
+
+	SessionChallengeRequest = messengerclient.SessionChallengeRequest
+	SessionChallenge        = messengerclient.SessionChallenge
+	SessionRequest          = messengerclient.SessionRequest
+	Session                 = messengerclient.Session
+)
+
+const (
+	DefaultTopic     = messengerclient.DefaultTopic
+	SealedStartPath  = messengerclient.SealedStartPath
+	RelayedStartPath = messengerclient.RelayedStartPath
+	RelayKeyPath     = messengerclient.RelayKeyPath
+
+	PublicResultsPath = messengerclient.PublicResultsPath
+
+	SessionChallengePath = messengerclient.SessionChallengePath
+	SessionPath          = messengerclient.SessionPath
+
+	OpRegisterNode  = messengerclient.OpRegisterNode
+	OpCreateTopic   = messengerclient.OpCreateTopic
+	OpDeleteTopic   = messengerclient.OpDeleteTopic
+	OpPublish       = messengerclient.OpPublish
+	OpResult        = messengerclient.OpResult
+	OpAddWebhook    = messengerclient.OpAddWebhook
+	OpDeleteWebhook = messengerclient.OpDeleteWebhook
+
+	RolePrimary = messengerclient.RolePrimary
+	RoleStandby = messengerclient.RoleStandby
+)
+
+// MessageHash identifies a message by its content
+func MessageHash(data []byte) string {
+	return messengerclient.MessageHash(data)
+}
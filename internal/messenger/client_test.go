@@ -0,0 +1,41 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPISpecIsValidJSON(t *testing.T) {
+	spec := struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}{}
+	require.NoError(t, json.Unmarshal(OpenAPISpec(), &spec))
+	require.Equal(t, "3.0.3", spec.OpenAPI)
+	for _, path := range []string{"/topics", "/topics/{topic_name}", "/topics/{topic_name}/sync", "/topics/{topic_name}/outputs", "/topics/{topic_name}/progress", "/topics/{topic_name}/sealed", "/topics/{topic_name}/start", "/register_node", "/publish", "/stream/dkgoutput", "/stream/dkgblame", "/data/{request_id}", "/data/{request_id}/outputs", "/data/{request_id}/blames", "/replication/status", "/replication/changes", "/replication/snapshot", "/replication/promote", "/limits", "/stats", "/relay_key", "/sessions/challenge", "/sessions"} {
+		require.Contains(t, spec.Paths, path)
+	}
+}
@@ -36,6 +36,9 @@ func (m *Messenger) HandlePublish() func(*gin.Context) {
 
 	return func(c *gin.Context) {
 		topicName := c.Query("topic_name")
+		if !m.allowTopic(c, topicName) {
+			return
+		}
 
 		data, err := io.ReadAll(c.Request.Body)
 		if err != nil {
@@ -67,12 +70,12 @@ func (m *Messenger) HandleGetData() func(*gin.Context) {
 	return func(c *gin.Context) {
 		requestID := c.Param("request_id")
 
-		_, ok := m.Data[requestID]
+		data, ok := m.Data[requestID]
 		if !ok {
 			c.AbortWithStatus(http.StatusNotFound)
 			return
 		}
-		c.JSON(http.StatusOK, m.Data[requestID])
+		respondCached(c, data)
 	}
 }
 
@@ -81,6 +84,9 @@ func (m *Messenger) HandleStreamDKGOutput() func(*gin.Context) {
 	return func(c *gin.Context) {
 		data := make(map[types.OperatorID]*dkg.SignedOutput)
 		requestID := c.Query("request_id")
+		if !m.allowTopic(c, requestID) {
+			return
+		}
 
 		body, _ := io.ReadAll(c.Request.Body)
 		if err := json.Unmarshal(body, &data); err != nil {
@@ -91,7 +97,20 @@ func (m *Messenger) HandleStreamDKGOutput() func(*gin.Context) {
 			return
 		}
 
-		m.Data[requestID] = &DataStore{DKGOutputs: data}
+		if err := m.limits().CheckOperators(len(data)); err != nil {
+			m.respondLimit(c, err)
+			return
+		}
+
+		// the topic of a ceremony is named after its request ID
+		canary := false
+		if topic, ok := m.Topics[requestID]; ok {
+			canary = topic.Canary
+		}
+		m.Data[requestID] = &DataStore{DKGOutputs: data, Canary: canary}
+		m.recordResult(requestID, nil)
+		m.replicate(&Change{Op: OpResult, RequestID: requestID, Result: m.Data[requestID]})
+		m.notifyOutput(requestID, data)
 		c.JSON(http.StatusOK, nil)
 	}
 }
@@ -101,6 +120,9 @@ func (m *Messenger) HandleStreamDKGBlame() func(*gin.Context) {
 	return func(c *gin.Context) {
 		data := new(dkg.BlameOutput)
 		requestID := c.Query("request_id")
+		if !m.allowTopic(c, requestID) {
+			return
+		}
 
 		body, _ := io.ReadAll(c.Request.Body)
 		if err := json.Unmarshal(body, &data); err != nil {
@@ -112,6 +134,9 @@ func (m *Messenger) HandleStreamDKGBlame() func(*gin.Context) {
 		}
 
 		m.Data[requestID] = &DataStore{BlameOutput: data}
+		m.recordResult(requestID, data)
+		m.replicate(&Change{Op: OpResult, RequestID: requestID, Result: m.Data[requestID]})
+		m.notifyBlame(requestID, data)
 		c.JSON(http.StatusOK, nil)
 	}
 }
@@ -21,7 +21,11 @@
 
 package messenger
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+)
 
 type ErrTopicNotFound struct {
 	TopicName string
@@ -30,3 +34,17 @@ type ErrTopicNotFound struct {
 func (err *ErrTopicNotFound) Error() string {
 	return fmt.Sprintf("topic with name %s not found\n", err.TopicName)
 }
+
+type ErrUnexpectedStatus = messengerclient.ErrUnexpectedStatus
+
+var ErrNotModified = messengerclient.ErrNotModified
+
+func IsNotFound(err error) bool {
+	return messengerclient.IsNotFound(err)
+}
+
+// IsLimitExceeded reports whether a request was over the limits of the
+// messenger, refused by it with 413 or before sending by the client
+func IsLimitExceeded(err error) bool {
+	return messengerclient.IsLimitExceeded(err)
+}
@@ -0,0 +1,206 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of relay misbehavior Faults injects
+const (
+	FaultDrop      = "drop"
+	FaultDuplicate = "duplicate"
+	FaultDelay     = "delay"
+	FaultReorder   = "reorder"
+)
+
+var faultKinds = []string{FaultDrop, FaultDuplicate, FaultDelay, FaultReorder}
+
+// DefaultFaultMaxDelay bounds the delay of delayed deliveries and how long a
+// reordered one waits for the next message to overtake it
+const DefaultFaultMaxDelay = 2 * time.Second
+
+// Faults is a test mode of the messenger that misbehaves like a real relay:
+// it drops, duplicates, delays or reorders a fraction of the deliveries to
+// the nodes, so their re-requests, resends and deduplication can be tested.
+// Whether and how a delivery is disturbed only depends on the seed, the
+// recipient and the message, a run with the same seed disturbs the same
+// deliveries. Never turn it on in production.
+type Faults struct {
+	// Rates are the fractions of deliveries disturbed by each kind of fault,
+	// together at most 1
+	Rates    map[string]float64
+	Seed     int64
+	MaxDelay time.Duration
+
+	mu sync.Mutex
+	// held are the reordered messages waiting for the next message to the
+	// same subscriber
+	held     map[string]*Message
+	injected map[string]*uint64
+}
+
+// ParseFaults reads the fault rates from kind=fraction pairs separated by
+// commas, e.g. drop=0.05,reorder=0.1
+func ParseFaults(spec string, seed int64, maxDelay time.Duration) (*Faults, error) {
+	if maxDelay <= 0 {
+		maxDelay = DefaultFaultMaxDelay
+	}
+	faults := &Faults{
+		Rates:    make(map[string]float64),
+		Seed:     seed,
+		MaxDelay: maxDelay,
+		held:     make(map[string]*Message),
+		injected: make(map[string]*uint64),
+	}
+	for _, kind := range faultKinds {
+		faults.injected[kind] = new(uint64)
+	}
+
+	total := 0.0
+	for _, pair := range strings.Split(spec, ",") {
+		kind, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("ParseFaults: %q isn't a kind=fraction pair", pair)
+		}
+		if _, known := faults.injected[kind]; !known {
+			return nil, fmt.Errorf("ParseFaults: unknown fault %q, expected one of %s", kind, strings.Join(faultKinds, ", "))
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("ParseFaults: rate of %s has to be a fraction between 0 and 1, not %q", kind, value)
+		}
+		faults.Rates[kind] = rate
+		total += rate
+	}
+	if total > 1 {
+		return nil, fmt.Errorf("ParseFaults: the fault rates add up to %g, more than 1", total)
+	}
+	return faults, nil
+}
+
+func (f *Faults) String() string {
+	pairs := make([]string, 0, len(faultKinds))
+	for _, kind := range faultKinds {
+		if rate := f.Rates[kind]; rate > 0 {
+			pairs = append(pairs, fmt.Sprintf("%s=%g", kind, rate))
+		}
+	}
+	return fmt.Sprintf("%s seed=%d max_delay=%s", strings.Join(pairs, ","), f.Seed, f.MaxDelay)
+}
+
+// pick decides the fault of a delivery, empty for none, and the fraction of
+// MaxDelay a delayed delivery waits
+func (f *Faults) pick(recipient string, data []byte) (string, float64) {
+	hash := sha256.New()
+	_ = binary.Write(hash, binary.BigEndian, f.Seed)
+	hash.Write([]byte(recipient))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	sum := hash.Sum(nil)
+	draw := float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+	wait := float64(binary.BigEndian.Uint64(sum[8:16])>>11) / (1 << 53)
+
+	for _, kind := range faultKinds {
+		if draw < f.Rates[kind] {
+			return kind, wait
+		}
+		draw -= f.Rates[kind]
+	}
+	return "", wait
+}
+
+// inject queues the message for the subscriber, disturbed by the fault picked
+// for it
+func (f *Faults) inject(s *Subscriber, msg *Message) {
+	kind, wait := f.pick(s.Name, msg.Data)
+	if kind != "" {
+		atomic.AddUint64(f.injected[kind], 1)
+	}
+
+	switch kind {
+	case FaultDrop:
+	case FaultDuplicate:
+		s.enqueue(msg)
+		s.enqueue(msg)
+	case FaultDelay:
+		time.AfterFunc(time.Duration(wait*float64(f.MaxDelay)), func() { s.enqueue(msg) })
+	case FaultReorder:
+		f.mu.Lock()
+		held := f.held[s.Name]
+		f.held[s.Name] = msg
+		f.mu.Unlock()
+		if held != nil {
+			s.enqueue(held)
+		}
+		// nothing may follow to overtake it, it goes out after MaxDelay then
+		time.AfterFunc(f.MaxDelay, func() { f.release(s, msg) })
+	default:
+		s.enqueue(msg)
+		f.release(s, nil)
+	}
+}
+
+// release queues the message held back for the subscriber, only when it is
+// msg unless msg is nil
+func (f *Faults) release(s *Subscriber, msg *Message) {
+	f.mu.Lock()
+	held := f.held[s.Name]
+	if held == nil || (msg != nil && held != msg) {
+		f.mu.Unlock()
+		return
+	}
+	delete(f.held, s.Name)
+	f.mu.Unlock()
+	s.enqueue(held)
+}
+
+// Injected is the number of deliveries disturbed by the kind of fault
+func (f *Faults) Injected(kind string) uint64 {
+	counter, ok := f.injected[kind]
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(counter)
+}
+
+func (f *Faults) Collectors() []prometheus.Collector {
+	collectors := make([]prometheus.Collector, 0, len(faultKinds))
+	for _, kind := range faultKinds {
+		kind := kind
+		collectors = append(collectors, prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "messenger_faults_injected_total",
+			Help:        "Deliveries disturbed by the fault injection test mode",
+			ConstLabels: prometheus.Labels{"fault": kind},
+		}, func() float64 { return float64(f.Injected(kind)) }))
+	}
+	return collectors
+}
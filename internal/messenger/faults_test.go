@@ -0,0 +1,123 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFaults(t *testing.T) {
+	faults, err := ParseFaults("drop=0.1, reorder=0.25", 7, 0)
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{FaultDrop: 0.1, FaultReorder: 0.25}, faults.Rates)
+	require.Equal(t, DefaultFaultMaxDelay, faults.MaxDelay)
+	require.Equal(t, "drop=0.1,reorder=0.25 seed=7 max_delay=2s", faults.String())
+
+	for _, spec := range []string{"drop", "lose=0.1", "drop=1.5", "drop=0.6,delay=0.6"} {
+		_, err := ParseFaults(spec, 7, 0)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestFaultsAreReproducible(t *testing.T) {
+	faults, err := ParseFaults("drop=0.1,duplicate=0.1,delay=0.2,reorder=0.1", 42, time.Second)
+	require.NoError(t, err)
+	again, err := ParseFaults("drop=0.1,duplicate=0.1,delay=0.2,reorder=0.1", 42, time.Second)
+	require.NoError(t, err)
+	other, err := ParseFaults("drop=0.1,duplicate=0.1,delay=0.2,reorder=0.1", 43, time.Second)
+	require.NoError(t, err)
+
+	counts := make(map[string]int)
+	differs := false
+	for i := 0; i < 10000; i++ {
+		data := []byte(fmt.Sprintf("message %d", i))
+		kind, wait := faults.pick("1", data)
+		againKind, againWait := again.pick("1", data)
+		require.Equal(t, kind, againKind)
+		require.Equal(t, wait, againWait)
+		otherKind, _ := other.pick("1", data)
+		differs = differs || kind != otherKind
+		counts[kind]++
+	}
+	require.True(t, differs, "another seed disturbs other deliveries")
+	require.InDelta(t, 1000, counts[FaultDrop], 150)
+	require.InDelta(t, 1000, counts[FaultDuplicate], 150)
+	require.InDelta(t, 2000, counts[FaultDelay], 200)
+	require.InDelta(t, 1000, counts[FaultReorder], 150)
+	require.InDelta(t, 5000, counts[""], 250)
+}
+
+// messageWith finds a message the faults disturb with kind for subscriber 1
+func messageWith(t *testing.T, faults *Faults, kind string) *Message {
+	for i := 0; i < 1000; i++ {
+		data := []byte(fmt.Sprintf("%s %d", kind, i))
+		if picked, _ := faults.pick("1", data); picked == kind {
+			return &Message{Topic: "abcd", Data: data}
+		}
+	}
+	t.Fatalf("no message disturbed by %s", kind)
+	return nil
+}
+
+func TestFaultsDisturbDeliveries(t *testing.T) {
+	faults, err := ParseFaults("drop=0.2,duplicate=0.2,delay=0.2,reorder=0.2", 1, 50*time.Millisecond)
+	require.NoError(t, err)
+	s := &Subscriber{Name: "1", Outgoing: make(chan *Message, 10), faults: faults}
+
+	s.queue(messageWith(t, faults, FaultDrop))
+	require.Len(t, s.Outgoing, 0)
+	require.Equal(t, uint64(1), faults.Injected(FaultDrop))
+
+	duplicated := messageWith(t, faults, FaultDuplicate)
+	s.queue(duplicated)
+	require.Equal(t, duplicated, <-s.Outgoing)
+	require.Equal(t, duplicated, <-s.Outgoing)
+
+	delayed := messageWith(t, faults, FaultDelay)
+	s.queue(delayed)
+	select {
+	case msg := <-s.Outgoing:
+		require.Equal(t, delayed, msg)
+	case <-time.After(time.Second):
+		t.Fatal("delayed message wasn't delivered")
+	}
+
+	reordered, next := messageWith(t, faults, FaultReorder), messageWith(t, faults, "")
+	s.queue(reordered)
+	require.Len(t, s.Outgoing, 0)
+	s.queue(next)
+	require.Equal(t, next, <-s.Outgoing)
+	require.Equal(t, reordered, <-s.Outgoing, "the held message goes out after the next one")
+
+	last := messageWith(t, faults, FaultReorder)
+	s.queue(last)
+	select {
+	case msg := <-s.Outgoing:
+		require.Equal(t, last, msg)
+	case <-time.After(time.Second):
+		t.Fatal("reordered message without a successor wasn't delivered")
+	}
+}
@@ -0,0 +1,361 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"encoding/json"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/keysign"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+// maxTopicHistory bounds the messages kept per topic for catch-up, the oldest
+// are dropped first
+const maxTopicHistory = 10000
+
+// History keeps the messages published to a topic so a node can catch up on
+// what it missed without a full replay
+type History struct {
+	mu       sync.Mutex
+	messages []*historyEntry
+	hashes   map[string]bool
+}
+
+type historyEntry struct {
+	hash   string
+	signer string
+	data   []byte
+}
+
+func NewHistory() *History {
+	return &History{hashes: make(map[string]bool)}
+}
+
+// Add records a message published by signer, duplicates are ignored
+func (h *History) Add(signer string, data []byte) {
+	hash := MessageHash(data)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.hashes[hash] {
+		return
+	}
+	if len(h.messages) >= maxTopicHistory {
+		delete(h.hashes, h.messages[0].hash)
+		h.messages = h.messages[1:]
+	}
+	h.messages = append(h.messages, &historyEntry{hash: hash, signer: signer, data: data})
+	h.hashes[hash] = true
+}
+
+// Missing returns, in publishing order, the messages not in have and not
+// published by operator itself, along with the number of messages kept
+func (h *History) Missing(operator string, have map[string]bool) ([][]byte, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	missing := [][]byte{}
+	for _, e := range h.messages {
+		if e.signer == operator || have[e.hash] {
+			continue
+		}
+		missing = append(missing, e.data)
+	}
+	return missing, len(h.messages)
+}
+
+// Len is the number of kept messages
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.messages)
+}
+
+// Messages returns the kept messages in publishing order
+func (h *History) Messages() []*HistoryMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	messages := make([]*HistoryMessage, 0, len(h.messages))
+	for _, e := range h.messages {
+		messages = append(messages, &HistoryMessage{Signer: e.signer, Data: e.data})
+	}
+	return messages
+}
+
+// HandleSyncTopic returns only the topic messages the requesting node doesn't
+// have, so a node catching up doesn't download the whole history
+func (m *Messenger) HandleSyncTopic() func(*gin.Context) {
+	return func(c *gin.Context) {
+		topicName := c.Param("topic_name")
+		tp, exist := m.Topics[topicName]
+		if !exist {
+			err := &ErrTopicNotFound{TopicName: topicName}
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": fmt.Sprintf("topic %s doesn't exist", topicName),
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		req := &SyncRequest{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			m.logger.Errorf("HandleSyncTopic: failed to parse sync request: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to parse sync request from request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if !m.allowOperator(c, req.Operator) {
+			return
+		}
+		if _, ok := tp.Subscribers[req.Operator]; !ok {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": fmt.Sprintf("operator %s isn't subscribed to topic %s", req.Operator, topicName),
+				"error":   "not a subscriber",
+			})
+			return
+		}
+
+		resp := &SyncResponse{Messages: [][]byte{}}
+		if tp.History != nil {
+			have := make(map[string]bool, len(req.Have))
+			for _, hash := range req.Have {
+				have[hash] = true
+			}
+			resp.Messages, resp.Total = tp.History.Missing(req.Operator, have)
+		}
+		if batch := m.limits().MaxBatchSize; len(resp.Messages) > batch {
+			resp.Messages, resp.More = resp.Messages[:batch], true
+		}
+		m.logger.Debugf("HandleSyncTopic: operator %s has %d messages of topic %s, sending %d of %d", req.Operator, len(req.Have), topicName, len(resp.Messages), resp.Total)
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// HandleTopicOutputs returns the outputs the operators published to the topic
+// so far, the cli follows a ceremony's result with it as operators finish.
+// With after it leaves out the outputs of the first operators that published,
+// so a follower only fetches the new ones.
+func (m *Messenger) HandleTopicOutputs() func(*gin.Context) {
+	return func(c *gin.Context) {
+		topicName := c.Param("topic_name")
+		tp, exist := m.Topics[topicName]
+		if !exist {
+			err := &ErrTopicNotFound{TopicName: topicName}
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": fmt.Sprintf("topic %s doesn't exist", topicName),
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		after := 0
+		if value := c.Query("after"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"message": fmt.Sprintf("invalid after %q", value),
+					"error":   "after must be a non-negative number",
+				})
+				return
+			}
+			after = parsed
+		}
+
+		resp := &TopicOutputs{Operators: []string{}, Outputs: map[types.OperatorID]*dkg.SignedOutput{}}
+		for name := range tp.Subscribers {
+			resp.Operators = append(resp.Operators, name)
+		}
+		sort.Strings(resp.Operators)
+		if tp.History != nil {
+			// operators in the order they first published an output
+			var signers []types.OperatorID
+			outputs := make(map[types.OperatorID]*dkg.SignedOutput)
+			for _, msg := range tp.History.Messages() {
+				if output := decodeOutput(msg.Data); output != nil {
+					if _, ok := outputs[output.Signer]; !ok {
+						signers = append(signers, output.Signer)
+					}
+					outputs[output.Signer] = output
+				}
+			}
+			resp.Total = len(signers)
+			for i, signer := range signers {
+				if i >= after {
+					resp.Outputs[signer] = outputs[signer]
+				}
+			}
+		}
+		respondCached(c, resp)
+	}
+}
+
+// decodeOutput returns the signed output in a published message, nil when it
+// carries something else or its signer isn't the signer of the message
+func decodeOutput(data []byte) *dkg.SignedOutput {
+	ssvMsg := &types.SSVMessage{}
+	if err := ssvMsg.Decode(data); err != nil {
+		return nil
+	}
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(ssvMsg.Data); err != nil || signedMsg.Message == nil || signedMsg.Message.MsgType != dkg.OutputMsgType {
+		return nil
+	}
+	output := &dkg.SignedOutput{}
+	if err := output.Decode(signedMsg.Message.Data); err != nil || output.Signer != signedMsg.Signer {
+		return nil
+	}
+	return output
+}
+
+// HandleTopicPartials returns the partial signatures the operators published
+// to the topic of a keysign so far, the cli aggregates them itself when the
+// keysign stalls on an operator that doesn't answer or signs wrong
+func (m *Messenger) HandleTopicPartials() func(*gin.Context) {
+	return func(c *gin.Context) {
+		topicName := c.Param("topic_name")
+		tp, exist := m.Topics[topicName]
+		if !exist {
+			err := &ErrTopicNotFound{TopicName: topicName}
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": fmt.Sprintf("topic %s doesn't exist", topicName),
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		resp := &TopicPartials{Operators: []string{}, Partials: map[types.OperatorID][]byte{}}
+		for name := range tp.Subscribers {
+			resp.Operators = append(resp.Operators, name)
+		}
+		sort.Strings(resp.Operators)
+		if tp.History != nil {
+			for _, msg := range tp.History.Messages() {
+				if signer, partial := decodePartial(msg.Data); partial != nil {
+					resp.Partials[signer] = partial
+				}
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// HandleTopicProgress returns the stage each operator of a ceremony reached by
+// the messages it published to the topic, so the cli can tell which operator
+// holds the ceremony up
+func (m *Messenger) HandleTopicProgress() func(*gin.Context) {
+	return func(c *gin.Context) {
+		topicName := c.Param("topic_name")
+		tp, exist := m.Topics[topicName]
+		if !exist {
+			err := &ErrTopicNotFound{TopicName: topicName}
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": fmt.Sprintf("topic %s doesn't exist", topicName),
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		resp := &TopicProgress{Operators: []string{}, Stages: map[types.OperatorID]messengerclient.ProgressStage{}}
+		for name := range tp.Subscribers {
+			resp.Operators = append(resp.Operators, name)
+		}
+		sort.Strings(resp.Operators)
+		if tp.History != nil {
+			for _, msg := range tp.History.Messages() {
+				signer, stage := decodeStage(msg.Data)
+				if stage.Index() > resp.Stages[signer].Index() {
+					resp.Stages[signer] = stage
+				}
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// decodeStage returns the signer of a published message and the stage it
+// shows the signer reached, an empty stage for blames, timeouts and anything
+// that isn't a protocol message or an output. Keygen, resharing and keysign
+// protocol messages all carry their round in the same field.
+func decodeStage(data []byte) (types.OperatorID, messengerclient.ProgressStage) {
+	ssvMsg := &types.SSVMessage{}
+	if err := ssvMsg.Decode(data); err != nil {
+		return 0, ""
+	}
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(ssvMsg.Data); err != nil || signedMsg.Message == nil {
+		return 0, ""
+	}
+	switch signedMsg.Message.MsgType {
+	case dkg.OutputMsgType:
+		return signedMsg.Signer, messengerclient.StageOutput
+	case dkg.ProtocolMsgType:
+		protocolMsg := &struct {
+			Round common.ProtocolRound `json:"round"`
+		}{}
+		if err := json.Unmarshal(signedMsg.Message.Data, protocolMsg); err != nil {
+			return 0, ""
+		}
+		switch protocolMsg.Round {
+		case common.Preparation:
+			return signedMsg.Signer, messengerclient.StageInitReceived
+		case common.Round1:
+			return signedMsg.Signer, messengerclient.StageRound1
+		case common.Round2:
+			return signedMsg.Signer, messengerclient.StageRound2
+		}
+	}
+	return 0, ""
+}
+
+// decodePartial returns the signer and partial signature of a published
+// keysign preparation message, nil when it carries something else like the
+// preparation of a frost keygen, which has the same round. The
+// partial isn't checked here, the cli verifies it against the share pk of
+// its signer
+func decodePartial(data []byte) (types.OperatorID, []byte) {
+	ssvMsg := &types.SSVMessage{}
+	if err := ssvMsg.Decode(data); err != nil {
+		return 0, nil
+	}
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(ssvMsg.Data); err != nil || signedMsg.Message == nil || signedMsg.Message.MsgType != dkg.ProtocolMsgType {
+		return 0, nil
+	}
+	protocolMsg := &keysign.ProtocolMsg{}
+	if err := protocolMsg.Decode(signedMsg.Message.Data); err != nil || protocolMsg.Round != common.Preparation || protocolMsg.PreparationMessage == nil || len(protocolMsg.PreparationMessage.PartialSignature) == 0 {
+		return 0, nil
+	}
+	return signedMsg.Signer, protocolMsg.PreparationMessage.PartialSignature
+}
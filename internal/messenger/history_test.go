@@ -0,0 +1,227 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/dkg/keysign"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryMissing(t *testing.T) {
+	h := NewHistory()
+	h.Add("1", []byte("a"))
+	h.Add("2", []byte("b"))
+	h.Add("2", []byte("b"))
+	h.Add("3", []byte("c"))
+
+	missing, total := h.Missing("3", map[string]bool{MessageHash([]byte("a")): true})
+	require.Equal(t, 3, total)
+	require.Equal(t, [][]byte{[]byte("b")}, missing)
+
+	missing, _ = h.Missing("4", nil)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, missing)
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	h := NewHistory()
+	for i := 0; i < maxTopicHistory+5; i++ {
+		h.Add("1", []byte(fmt.Sprintf("msg %d", i)))
+	}
+	missing, total := h.Missing("2", nil)
+	require.Equal(t, maxTopicHistory, total)
+	require.Equal(t, []byte("msg 5"), missing[0])
+}
+
+func TestSyncTopic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &Messenger{Topics: map[string]*Topic{}, logger: logrus.New()}
+	topic := NewTopic("abcd")
+	topic.Subscribers["1"] = &Subscriber{Name: "1"}
+	topic.Subscribers["2"] = &Subscriber{Name: "2"}
+	m.Topics["abcd"] = topic
+	topic.History.Add("1", []byte("round1 of 1"))
+	topic.History.Add("2", []byte("round1 of 2"))
+	topic.History.Add("2", []byte("round2 of 2"))
+
+	r := gin.New()
+	r.POST("/topics/:topic_name/sync", m.HandleSyncTopic())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	cl := NewMessengerClient(srv.URL)
+
+	resp, err := cl.SyncTopic(context.Background(), "abcd", 1, []string{MessageHash([]byte("round1 of 2"))})
+	require.NoError(t, err)
+	require.Equal(t, 3, resp.Total)
+	require.Equal(t, [][]byte{[]byte("round2 of 2")}, resp.Messages)
+
+	_, err = cl.SyncTopic(context.Background(), "abcd", 3, nil)
+	require.Error(t, err, "operator 3 isn't subscribed")
+
+	_, err = cl.SyncTopic(context.Background(), "missing", 1, nil)
+	require.True(t, IsNotFound(err))
+}
+
+// outputMessage is a published output message of signer, the output signed by outputSigner
+func outputMessage(t *testing.T, signer, outputSigner types.OperatorID) []byte {
+	output, err := (&dkg.SignedOutput{Data: &dkg.Output{SharePubKey: []byte{byte(signer)}}, Signer: outputSigner}).Encode()
+	require.NoError(t, err)
+	signed, err := (&dkg.SignedMessage{Message: &dkg.Message{MsgType: dkg.OutputMsgType, Data: output}, Signer: signer}).Encode()
+	require.NoError(t, err)
+	msg, err := (&types.SSVMessage{MsgType: types.DKGMsgType, Data: signed}).Encode()
+	require.NoError(t, err)
+	return msg
+}
+
+func TestTopicOutputs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &Messenger{Topics: map[string]*Topic{}, logger: logrus.New()}
+	topic := NewTopic("abcd")
+	for _, name := range []string{"3", "1", "2"} {
+		topic.Subscribers[name] = &Subscriber{Name: name}
+	}
+	m.Topics["abcd"] = topic
+	topic.History.Add("1", roundMessage(t, 1))
+	topic.History.Add("1", outputMessage(t, 1, 1))
+	topic.History.Add("2", outputMessage(t, 2, 3))
+
+	r := gin.New()
+	r.GET("/topics/:topic_name/outputs", m.HandleTopicOutputs())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	cl := NewMessengerClient(srv.URL)
+
+	outputs, err := cl.TopicOutputs(context.Background(), "abcd")
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "3"}, outputs.Operators)
+	require.Len(t, outputs.Outputs, 1, "round messages and outputs signed for another operator are left out")
+	require.Equal(t, []byte{1}, outputs.Outputs[1].Data.SharePubKey)
+
+	_, err = cl.TopicOutputs(context.Background(), "missing")
+	require.True(t, IsNotFound(err))
+}
+
+// partialMessage is a published keysign preparation message of signer
+func partialMessage(t *testing.T, signer types.OperatorID, partial []byte) []byte {
+	data, err := (&keysign.ProtocolMsg{
+		Round:              common.Preparation,
+		PreparationMessage: &keysign.PreparationMessage{PartialSignature: partial},
+	}).Encode()
+	require.NoError(t, err)
+	signed, err := (&dkg.SignedMessage{Message: &dkg.Message{MsgType: dkg.ProtocolMsgType, Data: data}, Signer: signer}).Encode()
+	require.NoError(t, err)
+	msg, err := (&types.SSVMessage{MsgType: types.DKGMsgType, Data: signed}).Encode()
+	require.NoError(t, err)
+	return msg
+}
+
+func TestTopicPartials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &Messenger{Topics: map[string]*Topic{}, logger: logrus.New()}
+	topic := NewTopic("abcd")
+	for _, name := range []string{"2", "1"} {
+		topic.Subscribers[name] = &Subscriber{Name: name}
+	}
+	m.Topics["abcd"] = topic
+	topic.History.Add("1", partialMessage(t, 1, []byte{1}))
+	topic.History.Add("2", roundMessage(t, 2))
+	topic.History.Add("2", outputMessage(t, 2, 2))
+
+	frostPreparation, err := (&frost.ProtocolMsg{
+		Round:              common.Preparation,
+		PreparationMessage: &frost.PreparationMessage{SessionPk: []byte{2}},
+	}).Encode()
+	require.NoError(t, err)
+	signed, err := (&dkg.SignedMessage{Message: &dkg.Message{MsgType: dkg.ProtocolMsgType, Data: frostPreparation}, Signer: 2}).Encode()
+	require.NoError(t, err)
+	msg, err := (&types.SSVMessage{MsgType: types.DKGMsgType, Data: signed}).Encode()
+	require.NoError(t, err)
+	topic.History.Add("2", msg)
+
+	r := gin.New()
+	r.GET("/topics/:topic_name/partials", m.HandleTopicPartials())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	cl := NewMessengerClient(srv.URL)
+
+	partials, err := cl.TopicPartials(context.Background(), "abcd")
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2"}, partials.Operators)
+	require.Equal(t, map[types.OperatorID][]byte{1: {1}}, partials.Partials, "frost messages and outputs are left out")
+
+	_, err = cl.TopicPartials(context.Background(), "missing")
+	require.True(t, IsNotFound(err))
+}
+
+func TestTopicProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &Messenger{Topics: map[string]*Topic{}, logger: logrus.New()}
+	topic := NewTopic("abcd")
+	for _, name := range []string{"3", "1", "2"} {
+		topic.Subscribers[name] = &Subscriber{Name: name}
+	}
+	m.Topics["abcd"] = topic
+
+	preparation, err := (&frost.ProtocolMsg{
+		Round:              common.Preparation,
+		PreparationMessage: &frost.PreparationMessage{SessionPk: []byte{1}},
+	}).Encode()
+	require.NoError(t, err)
+	signed, err := (&dkg.SignedMessage{Message: &dkg.Message{MsgType: dkg.ProtocolMsgType, Data: preparation}, Signer: 2}).Encode()
+	require.NoError(t, err)
+	msg, err := (&types.SSVMessage{MsgType: types.DKGMsgType, Data: signed}).Encode()
+	require.NoError(t, err)
+
+	topic.History.Add("1", outputMessage(t, 1, 1))
+	topic.History.Add("1", roundMessage(t, 1))
+	topic.History.Add("2", msg)
+	topic.History.Add("3", roundMessage(t, 3))
+
+	r := gin.New()
+	r.GET("/topics/:topic_name/progress", m.HandleTopicProgress())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	cl := NewMessengerClient(srv.URL)
+
+	progress, err := cl.TopicProgress(context.Background(), "abcd")
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "3"}, progress.Operators)
+	require.Equal(t, map[types.OperatorID]messengerclient.ProgressStage{
+		1: messengerclient.StageOutput,
+		2: messengerclient.StageInitReceived,
+		3: messengerclient.StageRound1,
+	}, progress.Stages, "a stage doesn't go back with a late round message")
+
+	_, err = cl.TopicProgress(context.Background(), "missing")
+	require.True(t, IsNotFound(err))
+}
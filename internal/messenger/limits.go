@@ -0,0 +1,79 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/gin-gonic/gin"
+)
+
+func (m *Messenger) limits() ceremony.Limits {
+	return m.Limits.OrDefault()
+}
+
+// LimitBody refuses request bodies larger than the messenger accepts with
+// 413, before a handler reads them into memory
+func (m *Messenger) LimitBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		data, err := ceremony.ReadBody(c.Request, m.limits().MaxMessageBytes)
+		if err != nil {
+			if ceremony.IsLimitExceeded(err) {
+				m.respondLimit(c, err)
+			} else {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"message": "failed to load data from request body",
+					"error":   err.Error(),
+				})
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		c.Next()
+	}
+}
+
+// HandleLimits advertises the limits of the messenger to initiators and nodes
+func (m *Messenger) HandleLimits() func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, m.limits())
+	}
+}
+
+// respondLimit refuses a request over one of the messenger's limits, along with the limits
+func (m *Messenger) respondLimit(c *gin.Context, err error) {
+	m.logger.Warnf("refused request over the messenger limits: %v", err)
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"message": "request exceeds the limits of the messenger",
+		"error":   err.Error(),
+		"code":    "limit_exceeded",
+		"limits":  m.limits(),
+	})
+}
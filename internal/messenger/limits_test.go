@@ -0,0 +1,99 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimitedMessenger(t *testing.T, limits ceremony.Limits) (*Messenger, *Client) {
+	gin.SetMode(gin.TestMode)
+	m := &Messenger{Topics: map[string]*Topic{DefaultTopic: NewTopic(DefaultTopic)}, Limits: limits, logger: logrus.New()}
+
+	r := gin.New()
+	r.Use(m.LimitBody())
+	r.GET("/limits", m.HandleLimits())
+	r.POST("/topics", m.HandleCreateTopic())
+	r.POST("/topics/:topic_name/sync", m.HandleSyncTopic())
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return m, NewMessengerClient(srv.URL)
+}
+
+func TestMessengerLimits(t *testing.T) {
+	_, cl := newLimitedMessenger(t, ceremony.Limits{MaxOperators: 4, MaxMessageBytes: 256})
+
+	limits, err := cl.Limits(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, ceremony.Limits{MaxOperators: 4, MaxMessageBytes: 256, MaxBatchSize: ceremony.DefaultLimits.MaxBatchSize}, limits)
+
+	require.NoError(t, cl.CreateTopic("small", []types.OperatorID{1, 2, 3, 4}))
+	err = cl.CreateTopic("large", []types.OperatorID{1, 2, 3, 4, 5})
+	require.True(t, IsLimitExceeded(err))
+
+	have := []string{}
+	for i := 0; i < 64; i++ {
+		have = append(have, MessageHash([]byte(fmt.Sprintf("msg %d", i))))
+	}
+	_, err = cl.SyncTopic(context.Background(), "small", 1, have)
+	require.True(t, IsLimitExceeded(err), "sync request body over 256 bytes")
+
+	// the client refuses bodies over the negotiated size before sending them
+	cl.MaxMessageBytes = 16
+	_, err = cl.SyncTopic(context.Background(), "small", 1, nil)
+	require.True(t, ceremony.IsLimitExceeded(err))
+}
+
+func TestSyncTopicInBatches(t *testing.T) {
+	m, cl := newLimitedMessenger(t, ceremony.Limits{MaxBatchSize: 2})
+	topic := NewTopic("abcd")
+	topic.Subscribers["1"] = &Subscriber{Name: "1"}
+	m.Topics["abcd"] = topic
+	for i := 0; i < 5; i++ {
+		topic.History.Add("2", []byte(fmt.Sprintf("msg %d", i)))
+	}
+
+	have := []string{}
+	for batches := 1; ; batches++ {
+		resp, err := cl.SyncTopic(context.Background(), "abcd", 1, have)
+		require.NoError(t, err)
+		require.Equal(t, 5, resp.Total)
+		require.LessOrEqual(t, len(resp.Messages), 2)
+		for _, msg := range resp.Messages {
+			have = append(have, MessageHash(msg))
+		}
+		if !resp.More {
+			require.Equal(t, 3, batches)
+			break
+		}
+	}
+	require.Len(t, have, 5)
+}
@@ -24,24 +24,40 @@ package messenger
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/stats"
 	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/dkg/frost"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/sirupsen/logrus"
 )
 
+// messagesPerCeremony is what a node gets from every peer in a keygen:
+// preparation, round 1, round 2, deposit data and output
+const messagesPerCeremony = 5
+
 var (
-	DefaultTopic = "default"
+	// SubscriberQueueSize holds the messages of four ceremonies of the largest
+	// supported committee for one node, a slow node doesn't hold up the relay
+	// to the others until it falls that far behind
+	SubscriberQueueSize = 4 * messagesPerCeremony * (ceremony.MaxCommitteeSize - 1)
+	// IncomingQueueSize holds the messages published in four ceremonies of the
+	// largest supported committee before publishers have to wait
+	IncomingQueueSize = 4 * messagesPerCeremony * ceremony.MaxCommitteeSize
 )
 
 type Messenger struct {
@@ -49,6 +65,37 @@ type Messenger struct {
 	Data   map[string]*DataStore
 
 	Incoming chan *Message
+	// UrgentIncoming queues the messages of urgent topics, they are relayed
+	// before any waiting in Incoming. Urgent messages go to Incoming when nil.
+	UrgentIncoming chan *Message
+
+	// Replication keeps the latest changes for standbys, nil turns it off
+	Replication *ReplicationLog
+	// standby is set while this messenger follows a primary
+	standby *Standby
+
+	// Limits the messenger enforces and advertises, the defaults when not set
+	Limits ceremony.Limits
+
+	// RelayKey signs the deliveries to nodes, they go out unsigned when nil
+	RelayKey ed25519.PrivateKey
+
+	// WebhookAllow are the private, loopback and link-local networks webhooks
+	// may point to, all of them are refused when empty
+	WebhookAllow  []*net.IPNet
+	webhookOnce   sync.Once
+	webhookClient *http.Client
+
+	// Stats records the ceremonies relayed for GET /stats, nil turns it off
+	Stats *stats.Recorder
+
+	// Sessions of the operator nodes, publishes, streams and registrations
+	// need the token of one when set
+	Sessions *Sessions
+
+	// Faults, when set, disturb the deliveries to the nodes for resilience
+	// tests
+	Faults *Faults
 
 	logger *logrus.Logger
 }
@@ -60,6 +107,23 @@ func (m *Messenger) WithLogger(logger *logrus.Logger) {
 type Topic struct {
 	Name        string
 	Subscribers map[string]*Subscriber
+	// Canary topics carry canary keygens, their results are marked as such
+	Canary bool `json:",omitempty"`
+	// Urgent topics carry time-sensitive ceremonies, e.g. a reshare away
+	// from a compromised operator, their messages skip the queues
+	Urgent  bool     `json:",omitempty"`
+	History *History `json:"-"`
+	// Webhooks of external systems notified of the ceremony of the topic,
+	// left out of the topic since they hold their secrets
+	Webhooks []*Webhook `json:"-"`
+}
+
+func NewTopic(name string) *Topic {
+	return &Topic{
+		Name:        name,
+		Subscribers: make(map[string]*Subscriber),
+		History:     NewHistory(),
+	}
 }
 
 type Subscriber struct {
@@ -67,17 +131,23 @@ type Subscriber struct {
 	SrvAddr      string            `json:"srv_addr"`
 	SubscribesTo map[string]*Topic `json:"-"`
 	Outgoing     chan *Message     `json:"-"`
+	Urgent       chan *Message     `json:"-"`
 	RetryData    map[string]int    `json:"-"`
+	// Capabilities the node advertised when it registered
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+	// relayKey is the relay key of the messenger the subscriber registered with
+	relayKey ed25519.PrivateKey
+	// faults disturb the deliveries to the subscriber when set
+	faults *Faults
 }
 
 type Message struct {
 	Topic string
 	Data  []byte
-}
-
-type DataStore struct {
-	DKGOutputs  map[types.OperatorID]*dkg.SignedOutput
-	BlameOutput *dkg.BlameOutput
+	// Path is the node endpoint the message is posted to, /consume when empty
+	Path string
+	// Urgent messages belong to an urgent topic
+	Urgent bool
 }
 
 func (m *Messenger) Publish(topicName string, data []byte) error {
@@ -87,32 +157,46 @@ func (m *Messenger) Publish(topicName string, data []byte) error {
 		return &ErrTopicNotFound{TopicName: topicName}
 	}
 
-	m.Incoming <- &Message{Topic: tp.Name, Data: data}
+	msg := &Message{Topic: tp.Name, Data: data, Urgent: tp.Urgent}
+	if msg.Urgent && m.UrgentIncoming != nil {
+		m.UrgentIncoming <- msg
+		return nil
+	}
+	m.Incoming <- msg
 	return nil
 }
 
+// nextIncoming waits for the next published message, urgent ones first
+func (m *Messenger) nextIncoming() (*Message, bool) {
+	return next(m.UrgentIncoming, m.Incoming)
+}
+
 func (m *Messenger) ProcessIncomingMessageWorker(ctx *context.Context) {
-	for msg := range m.Incoming {
+	for {
+		msg, ok := m.nextIncoming()
+		if !ok {
+			return
+		}
 		tp, exist := m.Topics[msg.Topic]
 		if !exist {
 			var err = &ErrTopicNotFound{TopicName: msg.Topic}
-			m.logger.Errorf("ProcessIncomingMessageWorker: %w", err)
+			m.logger.Errorf("ProcessIncomingMessageWorker: %v", err)
 			continue
 		}
 
 		ssvMsg := &types.SSVMessage{}
 		if err := ssvMsg.Decode(msg.Data); err != nil {
-			m.logger.Errorf("ProcessIncomingMessageWorker: %w", err)
+			m.logger.Errorf("ProcessIncomingMessageWorker: %v", err)
 			continue
 		}
 		signedMsg := &dkg.SignedMessage{}
 		if err := signedMsg.Decode(ssvMsg.Data); err != nil {
-			m.logger.Errorf("ProcessIncomingMessageWorker: failed to decode signed message: %w", err)
+			m.logger.Errorf("ProcessIncomingMessageWorker: failed to decode signed message: %v", err)
 			continue
 		}
 		protocolMsg := &frost.ProtocolMsg{}
 		if err := protocolMsg.Decode(signedMsg.Message.Data); err != nil {
-			m.logger.Errorf("ProcessIncomingMessageWorker: failed to decode protocol message: %w", err)
+			m.logger.Errorf("ProcessIncomingMessageWorker: failed to decode protocol message: %v", err)
 			continue
 		}
 
@@ -123,14 +207,71 @@ func (m *Messenger) ProcessIncomingMessageWorker(ctx *context.Context) {
 			protocolMsg.Round,
 		)
 
+		operatorID := strconv.Itoa(int(signedMsg.Signer))
+		if tp.History != nil {
+			tp.History.Add(operatorID, msg.Data)
+		}
+		m.replicate(&Change{Op: OpPublish, Topic: tp.Name, Signer: operatorID, Data: msg.Data})
+		m.notifyProgress(tp, signedMsg.Signer)
+
 		for _, subscriber := range tp.Subscribers {
-			operatorID := strconv.Itoa(int(signedMsg.Signer))
 			if operatorID == subscriber.Name {
 				continue
 			}
-			subscriber.Outgoing <- msg
+			subscriber.queue(msg)
+		}
+	}
+}
+
+// queue adds the message to the lane of its topic, or lets the fault
+// injection disturb it
+func (s *Subscriber) queue(msg *Message) {
+	if s.faults != nil {
+		s.faults.inject(s, msg)
+		return
+	}
+	s.enqueue(msg)
+}
+
+func (s *Subscriber) enqueue(msg *Message) {
+	if msg.Urgent && s.Urgent != nil {
+		s.Urgent <- msg
+		return
+	}
+	s.Outgoing <- msg
+}
+
+// requeue adds the message back to its lane for a retry, without waiting on
+// a full queue
+func (s *Subscriber) requeue(msg *Message) bool {
+	lane := s.Outgoing
+	if msg.Urgent && s.Urgent != nil {
+		lane = s.Urgent
+	}
+	select {
+	case lane <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// next takes a message from the urgent lane when it has one, else waits on
+// both. ok is false once the normal lane is closed and drained.
+func next(urgent, normal chan *Message) (*Message, bool) {
+	if urgent != nil {
+		select {
+		case msg := <-urgent:
+			return msg, true
+		default:
 		}
 	}
+	select {
+	case msg := <-urgent:
+		return msg, true
+	case msg, ok := <-normal:
+		return msg, ok
+	}
 }
 
 const (
@@ -146,7 +287,11 @@ func (s *Subscriber) ProcessOutgoingMessageWorker(ctx *context.Context) {
 	logger := log.(*logrus.Logger)
 	logger.Infof("ProcessOutgoingMessageWorker: logger loaded successfully")
 
-	for msg := range s.Outgoing {
+	for {
+		msg, ok := next(s.Urgent, s.Outgoing)
+		if !ok {
+			return
+		}
 
 		h := sha256.Sum256(msg.Data)
 		k := base64.RawStdEncoding.EncodeToString(h[:])
@@ -169,23 +314,42 @@ func (s *Subscriber) ProcessOutgoingMessageWorker(ctx *context.Context) {
 		_, exist := s.SubscribesTo[msg.Topic]
 		if !exist {
 			var err = &ErrTopicNotFound{TopicName: msg.Topic}
-			logger.Errorf("ProcessOutgoingMessageWorker: %w", err)
+			logger.Errorf("ProcessOutgoingMessageWorker: %v", err)
 			continue
 		}
 
+		path := msg.Path
+		if path == "" {
+			path = "/consume"
+		}
+
+		req, err := http.NewRequest(http.MethodPost, s.SrvAddr+path, bytes.NewReader(msg.Data))
+		if err != nil {
+			logger.Errorf("ProcessOutgoingMessageWorker: %v", err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if s.relayKey != nil {
+			messengerclient.SignDelivery(req, s.relayKey, s.Name, msg.Topic, msg.Data, time.Now())
+		}
+
 		// TODO: replace this client
-		resp, err := http.Post(fmt.Sprintf("%s/consume", s.SrvAddr), "application/json", bytes.NewBuffer(msg.Data))
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			logger.Errorf("ProcessOutgoingMessageWorker: %w", err)
+			logger.Errorf("ProcessOutgoingMessageWorker: %v", err)
 			continue
 		}
 
 		respbody, _ := io.ReadAll(resp.Body)
 		if resp.StatusCode != http.StatusOK {
-			s.Outgoing <- msg
+			// this worker is the only reader of the queue, waiting on a full
+			// queue would block it for good
+			if !s.requeue(msg) {
+				logger.Errorf("ProcessOutgoingMessageWorker: queue of subscriber %s is full, dropped retry of message %s", s.Name, k)
+			}
 
 			err := fmt.Errorf("failed to publish message to the subscriber %s %v", s.Name, string(respbody))
-			logger.Errorf("ProcessOutgoingMessageWorker: %w", err)
+			logger.Errorf("ProcessOutgoingMessageWorker: %v", err)
 		} else {
 			logger.Infof("ProcessOutgoingMessageWorker: message sent to %s successfully", s.Name)
 		}
@@ -200,3 +364,36 @@ func MessengerAddrFromEnv() string {
 	}
 	return messengerAddr
 }
+
+// RelayKeyFromEnv reads the seed of the ed25519 relay key, base64 encoded in
+// MESSENGER_RELAY_KEY or in the file named by MESSENGER_RELAY_KEY_FILE, nil
+// when neither is set
+func RelayKeyFromEnv() (ed25519.PrivateKey, error) {
+	encoded := os.Getenv("MESSENGER_RELAY_KEY")
+	if path := os.Getenv("MESSENGER_RELAY_KEY_FILE"); path != "" {
+		if encoded != "" {
+			return nil, fmt.Errorf("RelayKeyFromEnv: MESSENGER_RELAY_KEY and MESSENGER_RELAY_KEY_FILE are exclusive")
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("RelayKeyFromEnv: %w", err)
+		}
+		encoded = string(bytes.TrimSpace(content))
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("RelayKeyFromEnv: invalid relay key: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("RelayKeyFromEnv: relay key is %d bytes instead of a %d byte seed", len(seed), ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// MessengerTokenFromEnv is the bearer token sent to a messenger that requires authentication
+func MessengerTokenFromEnv() string {
+	return os.Getenv("MESSENGER_TOKEN")
+}
@@ -0,0 +1,120 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// benchRoundMessage is a relayed round 1 message with a commitment of a
+// 13 operator committee
+func benchRoundMessage(b *testing.B) []byte {
+	commitment := make([][]byte, 9)
+	for i := range commitment {
+		commitment[i] = make([]byte, 48)
+		_, _ = rand.Read(commitment[i])
+	}
+	data, err := (&frost.ProtocolMsg{
+		Round:         common.Round1,
+		Round1Message: &frost.Round1Message{Commitment: commitment, ProofS: make([]byte, 32), ProofR: make([]byte, 48)},
+	}).Encode()
+	if err != nil {
+		b.Fatal(err)
+	}
+	signed, err := (&dkg.SignedMessage{
+		Message:   &dkg.Message{MsgType: dkg.ProtocolMsgType, Data: data},
+		Signer:    1,
+		Signature: make([]byte, 256),
+	}).Encode()
+	if err != nil {
+		b.Fatal(err)
+	}
+	msg, err := (&types.SSVMessage{MsgType: types.DKGMsgType, Data: signed}).Encode()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return msg
+}
+
+// BenchmarkDecodeRelayedMessage is the decoding the incoming worker does for
+// every published message
+func BenchmarkDecodeRelayedMessage(b *testing.B) {
+	data := benchRoundMessage(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ssvMsg := &types.SSVMessage{}
+		if err := ssvMsg.Decode(data); err != nil {
+			b.Fatal(err)
+		}
+		signedMsg := &dkg.SignedMessage{}
+		if err := signedMsg.Decode(ssvMsg.Data); err != nil {
+			b.Fatal(err)
+		}
+		if err := (&frost.ProtocolMsg{}).Decode(signedMsg.Message.Data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMessageHash(b *testing.B) {
+	data := benchRoundMessage(b)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MessageHash(data)
+	}
+}
+
+func BenchmarkHistoryAdd(b *testing.B) {
+	h := NewHistory()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Add("1", []byte(fmt.Sprintf("message %d", i)))
+	}
+}
+
+func BenchmarkHistoryMissing(b *testing.B) {
+	h := NewHistory()
+	have := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		data := []byte(fmt.Sprintf("message %d", i))
+		h.Add(fmt.Sprint(i%13+1), data)
+		if i%10 != 0 {
+			have[MessageHash(data)] = true
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Missing("1", have)
+	}
+}
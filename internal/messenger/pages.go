@@ -0,0 +1,170 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/gin-gonic/gin"
+)
+
+// respondCached writes v as json with an etag of its content, a client that
+// already has it gets 304 without the body
+func respondCached(c *gin.Context, v any) {
+	byts, err := json.Marshal(v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "failed to encode response",
+			"error":   err.Error(),
+		})
+		return
+	}
+	sum := sha256.Sum256(byts)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if matchesETag(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", byts)
+}
+
+func matchesETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// pageParams reads the offset and limit of a paged request, the limit is at
+// most the batch size the messenger advertises
+func (m *Messenger) pageParams(c *gin.Context) (int, int, bool) {
+	offset, limit := 0, m.limits().MaxBatchSize
+	if value := c.Query("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("invalid offset %q", value),
+				"error":   "offset must be a non-negative number",
+			})
+			return 0, 0, false
+		}
+		offset = parsed
+	}
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("invalid limit %q", value),
+				"error":   "limit must be a positive number",
+			})
+			return 0, 0, false
+		}
+		if parsed < limit {
+			limit = parsed
+		}
+	}
+	return offset, limit, true
+}
+
+// page returns the bounds of the items of a page and the offset of the next
+func page(offset, limit, total int) (int, int, int) {
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end >= total {
+		return offset, total, 0
+	}
+	return offset, end, end
+}
+
+// HandleDataOutputs returns a page of the outputs in the result of a
+// ceremony, so large results can be fetched in parts
+func (m *Messenger) HandleDataOutputs() func(*gin.Context) {
+	return func(c *gin.Context) {
+		data, ok := m.Data[c.Param("request_id")]
+		if !ok {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		offset, limit, ok := m.pageParams(c)
+		if !ok {
+			return
+		}
+
+		outputs := make([]*dkg.SignedOutput, 0, len(data.DKGOutputs))
+		for _, output := range data.DKGOutputs {
+			outputs = append(outputs, output)
+		}
+		sort.Slice(outputs, func(i, j int) bool { return outputs[i].Signer < outputs[j].Signer })
+
+		start, end, next := page(offset, limit, len(outputs))
+		respondCached(c, &OutputPage{
+			Outputs: outputs[start:end],
+			Offset:  start,
+			Total:   len(outputs),
+			Next:    next,
+			Canary:  data.Canary,
+		})
+	}
+}
+
+// HandleDataBlames returns a page of the blames in the result of a ceremony
+func (m *Messenger) HandleDataBlames() func(*gin.Context) {
+	return func(c *gin.Context) {
+		data, ok := m.Data[c.Param("request_id")]
+		if !ok {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		offset, limit, ok := m.pageParams(c)
+		if !ok {
+			return
+		}
+
+		blames := make([]*dkg.BlameOutput, 0, 1)
+		if data.BlameOutput != nil {
+			blames = append(blames, data.BlameOutput)
+		}
+		start, end, next := page(offset, limit, len(blames))
+		respondCached(c, &BlamePage{
+			Blames: blames[start:end],
+			Offset: start,
+			Total:  len(blames),
+			Next:   next,
+		})
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &Messenger{Data: map[string]*DataStore{}, logger: logrus.New()}
+	m.Data["abcd"] = &DataStore{DKGOutputs: map[types.OperatorID]*dkg.SignedOutput{
+		3: {Signer: 3}, 1: {Signer: 1}, 4: {Signer: 4}, 2: {Signer: 2}, 5: {Signer: 5},
+	}}
+	m.Data["blamed"] = &DataStore{BlameOutput: &dkg.BlameOutput{}}
+
+	r := gin.New()
+	r.GET("/data/:request_id", m.HandleGetData())
+	r.GET("/data/:request_id/outputs", m.HandleDataOutputs())
+	r.GET("/data/:request_id/blames", m.HandleDataBlames())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	cl := NewMessengerClient(srv.URL)
+	ctx := context.Background()
+
+	page, err := cl.DataOutputs(ctx, "abcd", 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, 5, page.Total)
+	require.Equal(t, 2, page.Next)
+	require.EqualValues(t, 1, page.Outputs[0].Signer)
+	require.EqualValues(t, 2, page.Outputs[1].Signer)
+
+	page, err = cl.DataOutputs(ctx, "abcd", 4, 2)
+	require.NoError(t, err)
+	require.Zero(t, page.Next, "last page")
+	require.Len(t, page.Outputs, 1)
+	require.EqualValues(t, 5, page.Outputs[0].Signer)
+
+	page, err = cl.DataOutputs(ctx, "abcd", 9, 0)
+	require.NoError(t, err)
+	require.Empty(t, page.Outputs)
+
+	blames, err := cl.DataBlames(ctx, "blamed", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, blames.Total)
+	require.Len(t, blames.Blames, 1)
+	blames, err = cl.DataBlames(ctx, "abcd", 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, blames.Blames)
+
+	_, err = cl.DataOutputs(ctx, "missing", 0, 0)
+	require.True(t, IsNotFound(err))
+	resp, err := http.Get(srv.URL + "/data/abcd/outputs?offset=-1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	data, etag, err := cl.GetDataIfChanged(ctx, "abcd", "")
+	require.NoError(t, err)
+	require.Len(t, data.DKGOutputs, 5)
+	require.NotEmpty(t, etag)
+	_, _, err = cl.GetDataIfChanged(ctx, "abcd", etag)
+	require.True(t, errors.Is(err, ErrNotModified))
+
+	m.Data["abcd"].DKGOutputs[6] = &dkg.SignedOutput{Signer: 6}
+	data, changed, err := cl.GetDataIfChanged(ctx, "abcd", etag)
+	require.NoError(t, err)
+	require.Len(t, data.DKGOutputs, 6)
+	require.NotEqual(t, etag, changed)
+}
+
+func TestTopicOutputsAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &Messenger{Topics: map[string]*Topic{}, logger: logrus.New()}
+	topic := NewTopic("abcd")
+	topic.Subscribers["1"] = &Subscriber{Name: "1"}
+	m.Topics["abcd"] = topic
+	topic.History.Add("2", outputMessage(t, 2, 2))
+	topic.History.Add("1", outputMessage(t, 1, 1))
+
+	r := gin.New()
+	r.GET("/topics/:topic_name/outputs", m.HandleTopicOutputs())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	cl := NewMessengerClient(srv.URL)
+	ctx := context.Background()
+
+	outputs, etag, err := cl.TopicOutputsAfter(ctx, "abcd", 0, "")
+	require.NoError(t, err)
+	require.Equal(t, 2, outputs.Total)
+	require.Len(t, outputs.Outputs, 2)
+
+	outputs, etag, err = cl.TopicOutputsAfter(ctx, "abcd", 1, etag)
+	require.NoError(t, err)
+	require.Len(t, outputs.Outputs, 1, "outputs of the operators that published first are left out")
+	require.NotNil(t, outputs.Outputs[1])
+
+	_, _, err = cl.TopicOutputsAfter(ctx, "abcd", 1, etag)
+	require.True(t, errors.Is(err, ErrNotModified))
+
+	topic.History.Add("3", outputMessage(t, 3, 3))
+	outputs, _, err = cl.TopicOutputsAfter(ctx, "abcd", 2, etag)
+	require.NoError(t, err)
+	require.Equal(t, 3, outputs.Total)
+	require.Len(t, outputs.Outputs, 1)
+	require.NotNil(t, outputs.Outputs[3])
+}
@@ -0,0 +1,49 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandlePublicResult serves the outputs of a finished ceremony to anyone, so
+// delegators can check the validator their stake went to was created by the
+// committee they were promised. The outputs are signed by the operators and
+// carry the shares only encrypted to them, nothing in them is secret. Blames
+// stay behind authentication, they name operators. Browsers may fetch it from
+// any origin.
+func (m *Messenger) HandlePublicResult() func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", "*")
+		data, ok := m.Data[c.Param("request_id")]
+		if !ok || len(data.DKGOutputs) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "no published result for the request id",
+				"error":   "not found",
+			})
+			return
+		}
+		respondCached(c, &DataStore{DKGOutputs: data.DKGOutputs, Canary: data.Canary})
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlePublicResult(t *testing.T) {
+	m, runner := testMessenger(t)
+	m.Data["done"] = &DataStore{DKGOutputs: map[types.OperatorID]*dkg.SignedOutput{1: {Signer: 1, Data: &dkg.Output{ValidatorPubKey: []byte{1}}}}, Canary: true}
+	m.Data["blamed"] = &DataStore{BlameOutput: &dkg.BlameOutput{}}
+	router := testRouter(m, runner, nil)
+	router.GET(PublicResultsPath+"/:request_id", m.HandlePublicResult())
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	client := NewMessengerClient(srv.URL)
+	data, err := client.PublicResult(context.Background(), "done")
+	require.NoError(t, err)
+	require.True(t, data.Canary)
+	require.Nil(t, data.BlameOutput)
+	require.Equal(t, types.OperatorID(1), data.DKGOutputs[1].Signer)
+
+	resp, err := http.Get(srv.URL + PublicResultsPath + "/done")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+
+	// blames aren't published, neither are unknown ceremonies
+	for _, requestID := range []string{"blamed", "missing"} {
+		_, err = client.PublicResult(context.Background(), requestID)
+		require.Error(t, err)
+		require.True(t, IsNotFound(err), requestID)
+	}
+}
@@ -22,10 +22,13 @@
 package messenger
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 
 	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
 	"github.com/gin-gonic/gin"
 )
 
@@ -38,7 +41,7 @@ func (m *Messenger) HandleNodeRegistration(runner *workers.Runner) func(*gin.Con
 		_, exist := m.Topics[subscribesTo]
 		if !exist {
 			err := &ErrTopicNotFound{TopicName: subscribesTo}
-			m.logger.Errorf("HandleNodeRegistration: %w", err)
+			m.logger.Errorf("HandleNodeRegistration: %v", err)
 			c.JSON(http.StatusNotFound, gin.H{
 				"message": fmt.Sprintf("topic %s doesn't exist", subscribesTo),
 				"error":   err.Error(),
@@ -48,12 +51,13 @@ func (m *Messenger) HandleNodeRegistration(runner *workers.Runner) func(*gin.Con
 
 		subscriber := &Subscriber{
 			SubscribesTo: map[string]*Topic{},
-			Outgoing:     make(chan *Message, 50),
+			Outgoing:     make(chan *Message, SubscriberQueueSize),
+			Urgent:       make(chan *Message, SubscriberQueueSize),
 			RetryData:    make(map[string]int),
 		}
 
 		if err := c.ShouldBindJSON(subscriber); err != nil {
-			m.logger.Errorf("HandleNodeRegistration: failed to parse subscriber from request body: %w", err)
+			m.logger.Errorf("HandleNodeRegistration: failed to parse subscriber from request body: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"message": "failed to parse subscriber data from the request body",
 				"error":   err.Error(),
@@ -63,29 +67,71 @@ func (m *Messenger) HandleNodeRegistration(runner *workers.Runner) func(*gin.Con
 
 		if subscriber.Name == "" || subscriber.SrvAddr == "" {
 			err := fmt.Errorf("empty name %s or subscriber's address %s", subscriber.Name, subscriber.SrvAddr)
-			m.logger.Errorf("HandleNodeRegistration: %w", err)
+			m.logger.Errorf("HandleNodeRegistration: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"message": "invalid subscriber data: empty name or addr",
 				"error":   err.Error(),
 			})
 			return
 		}
+		if !m.allowOperator(c, subscriber.Name) {
+			return
+		}
 
-		existingSubscriber, ok := m.Topics[subscribesTo].Subscribers[subscriber.Name]
-		if ok {
-			existingSubscriber.SrvAddr = subscriber.SrvAddr
-			m.Topics[subscribesTo].Subscribers[subscriber.Name] = existingSubscriber
-		} else {
-			subscriber.Outgoing = make(chan *Message, 50)
-			subscriber.RetryData = make(map[string]int)
-			subscriber.SubscribesTo[subscribesTo] = m.Topics[subscribesTo]
-			m.Topics[subscribesTo].Subscribers[subscriber.Name] = subscriber
+		registration := &messengerclient.Subscriber{Name: subscriber.Name, SrvAddr: subscriber.SrvAddr, Capabilities: subscriber.Capabilities}
+		if registered, created := m.registerSubscriber(subscribesTo, registration); created {
+			startDelivery(runner, registered)
+		}
+		m.replicate(&Change{Op: OpRegisterNode, Topic: subscribesTo, Subscriber: registration})
+		c.JSON(http.StatusOK, nil)
+	}
+}
+
+// registerSubscriber adds the subscriber to the topic or updates its address
+// and capabilities, created reports whether it is new and needs a delivery worker
+func (m *Messenger) registerSubscriber(topicName string, registration *messengerclient.Subscriber) (subscriber *Subscriber, created bool) {
+	existingSubscriber, ok := m.Topics[topicName].Subscribers[registration.Name]
+	if ok {
+		existingSubscriber.SrvAddr = registration.SrvAddr
+		existingSubscriber.Capabilities = registration.Capabilities
+		return existingSubscriber, false
+	}
 
-			runner.AddJob(&workers.Job{
-				ID: fmt.Sprintf("SUBSCRIBER__%s", subscriber.Name),
-				Fn: m.Topics[subscribesTo].Subscribers[subscriber.Name].ProcessOutgoingMessageWorker,
+	subscriber = &Subscriber{
+		Name:         registration.Name,
+		SrvAddr:      registration.SrvAddr,
+		Capabilities: registration.Capabilities,
+		SubscribesTo: map[string]*Topic{topicName: m.Topics[topicName]},
+		Outgoing:     make(chan *Message, SubscriberQueueSize),
+		Urgent:       make(chan *Message, SubscriberQueueSize),
+		RetryData:    make(map[string]int),
+		relayKey:     m.RelayKey,
+		faults:       m.Faults,
+	}
+	m.Topics[topicName].Subscribers[registration.Name] = subscriber
+	return subscriber, true
+}
+
+// HandleRelayKey publishes the public key deliveries are signed with, 404
+// when the messenger doesn't sign them
+func (m *Messenger) HandleRelayKey() func(*gin.Context) {
+	return func(c *gin.Context) {
+		if m.RelayKey == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "this messenger doesn't sign deliveries",
+				"error":   "no relay key",
 			})
+			return
 		}
-		c.JSON(http.StatusOK, nil)
+		publicKey := m.RelayKey.Public().(ed25519.PublicKey)
+		c.JSON(http.StatusOK, &RelayKey{PublicKey: base64.StdEncoding.EncodeToString(publicKey)})
 	}
 }
+
+// startDelivery runs the worker posting the subscriber's queued messages to its node
+func startDelivery(runner *workers.Runner, subscriber *Subscriber) {
+	runner.AddJob(&workers.Job{
+		ID: fmt.Sprintf("SUBSCRIBER__%s", subscriber.Name),
+		Fn: subscriber.ProcessOutgoingMessageWorker,
+	})
+}
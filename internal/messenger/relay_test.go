@@ -0,0 +1,109 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveriesAreSigned(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	verified := make(chan error, 1)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verified <- messengerclient.VerifyDelivery(r.Header, r.URL.Path, "1", body, []ed25519.PublicKey{pk}, time.Now(), messengerclient.DefaultRelayMaxAge)
+	}))
+	defer node.Close()
+
+	m, runner := testMessenger(t)
+	m.RelayKey = sk
+	router := testRouter(m, runner, nil)
+	router.GET(RelayKeyPath, m.HandleRelayKey())
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	key, err := NewMessengerClient(srv.URL).RelayKey(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, pk, key)
+
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/register_node?subscribes_to=default", &Subscriber{Name: "1", SrvAddr: node.URL}).StatusCode)
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/topics", &TopicJSON{TopicName: "aa", Subscribers: []string{"1", "2"}}).StatusCode)
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/publish?topic_name=aa", roundMessage(t, 2)).StatusCode)
+	require.NoError(t, <-verified)
+}
+
+func TestUrgentTopicsSkipTheQueues(t *testing.T) {
+	m := &Messenger{
+		Topics:         map[string]*Topic{DefaultTopic: NewTopic(DefaultTopic)},
+		Incoming:       make(chan *Message, 4),
+		UrgentIncoming: make(chan *Message, 4),
+	}
+	m.createTopic("batch", nil, false, false)
+	m.createTopic("reshare", nil, false, true)
+	require.True(t, m.Topics["reshare"].Urgent)
+
+	require.NoError(t, m.Publish("batch", []byte("1")))
+	require.NoError(t, m.Publish("batch", []byte("2")))
+	require.NoError(t, m.Publish("reshare", []byte("3")))
+	for _, expected := range []string{"3", "1", "2"} {
+		msg, ok := m.nextIncoming()
+		require.True(t, ok)
+		require.Equal(t, expected, string(msg.Data))
+	}
+
+	subscriber := &Subscriber{Outgoing: make(chan *Message, 4), Urgent: make(chan *Message, 4)}
+	subscriber.queue(&Message{Topic: "batch", Data: []byte("1")})
+	subscriber.queue(&Message{Topic: "reshare", Data: []byte("2"), Urgent: true})
+	msg, ok := next(subscriber.Urgent, subscriber.Outgoing)
+	require.True(t, ok)
+	require.Equal(t, "2", string(msg.Data))
+
+	// a retry goes back to the lane it came from
+	require.True(t, subscriber.requeue(msg))
+	require.Len(t, subscriber.Urgent, 1)
+	require.Len(t, subscriber.Outgoing, 1)
+
+	close(subscriber.Outgoing)
+	for _, expected := range []string{"2", "1"} {
+		msg, ok := next(subscriber.Urgent, subscriber.Outgoing)
+		require.True(t, ok)
+		require.Equal(t, expected, string(msg.Data))
+	}
+	_, ok = next(subscriber.Urgent, subscriber.Outgoing)
+	require.False(t, ok)
+
+	// without an urgent queue the messages of urgent topics wait with the others
+	m.UrgentIncoming = nil
+	require.NoError(t, m.Publish("reshare", []byte("4")))
+	require.Len(t, m.Incoming, 1)
+}
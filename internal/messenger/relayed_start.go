@@ -0,0 +1,98 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandlePublishStart relays a plain start message to the listed operators of
+// the topic, so the initiator doesn't need to reach the nodes. Like sealed
+// start messages it isn't kept for topic sync.
+func (m *Messenger) HandlePublishStart() func(*gin.Context) {
+	return func(c *gin.Context) {
+		topicName := c.Param("topic_name")
+		tp, exist := m.Topics[topicName]
+		if !exist {
+			err := &ErrTopicNotFound{TopicName: topicName}
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": fmt.Sprintf("topic %s doesn't exist", topicName),
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		start := &RelayedStart{}
+		if err := c.ShouldBindJSON(start); err != nil {
+			m.logger.Errorf("HandlePublishStart: failed to parse start message: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to parse start message from request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := m.limits().CheckOperators(len(start.Operators)); err != nil {
+			m.respondLimit(c, err)
+			return
+		}
+		if err := m.limits().CheckMessage(int64(len(start.Message))); err != nil {
+			m.respondLimit(c, err)
+			return
+		}
+
+		data, err := json.Marshal(&RelayedDelivery{Topic: topicName, Message: start.Message, Query: start.Query})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid start message",
+				"error":   err.Error(),
+			})
+			return
+		}
+		// check every recipient first, a start message reaching part of the committee only stalls the ceremony
+		recipients := make([]*Subscriber, 0, len(start.Operators))
+		for _, operator := range start.Operators {
+			subscriber, ok := tp.Subscribers[operator]
+			if !ok || subscriber.Outgoing == nil {
+				c.JSON(http.StatusConflict, gin.H{
+					"message": fmt.Sprintf("operator %s isn't subscribed to topic %s", operator, topicName),
+					"error":   "not a subscriber",
+				})
+				return
+			}
+			recipients = append(recipients, subscriber)
+		}
+
+		for _, subscriber := range recipients {
+			subscriber.queue(&Message{Topic: topicName, Data: data, Path: RelayedStartPath, Urgent: tp.Urgent})
+		}
+		m.logger.Debugf("HandlePublishStart: relayed start message of topic %s to %d operators", topicName, len(recipients))
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("start message relayed to %d operators of topic %s", len(recipients), topicName),
+			"error":   "",
+		})
+	}
+}
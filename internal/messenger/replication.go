@@ -0,0 +1,308 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultReplicationLogSize is how many changes a primary keeps for standbys,
+// a standby further behind starts over from a snapshot
+const DefaultReplicationLogSize = 4096
+
+// maxChangesPerResponse bounds a response of the changes endpoint
+const maxChangesPerResponse = 500
+
+// maxReplicationWait bounds how long the changes endpoint holds a request open
+const maxReplicationWait = time.Minute
+
+// ReplicationLog keeps the latest changes of a primary for its standbys
+type ReplicationLog struct {
+	mu       sync.Mutex
+	size     int
+	changes  []*Change
+	head     uint64
+	headTime time.Time
+	// appended is closed and replaced on every change, waiting standbys wake up on it
+	appended chan struct{}
+}
+
+func NewReplicationLog(size int) *ReplicationLog {
+	return &ReplicationLog{size: size, appended: make(chan struct{})}
+}
+
+func (m *Messenger) replicate(change *Change) {
+	if m.Replication != nil {
+		m.Replication.Append(change)
+	}
+}
+
+// Append numbers the change and adds it to the log, dropping the oldest change when full
+func (l *ReplicationLog) Append(change *Change) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.head++
+	l.headTime = time.Now().UTC()
+	change.Seq, change.Time = l.head, l.headTime
+	if len(l.changes) >= l.size {
+		l.changes = l.changes[1:]
+	}
+	l.changes = append(l.changes, change)
+
+	close(l.appended)
+	l.appended = make(chan struct{})
+}
+
+// Head is the sequence number and time of the latest change
+func (l *ReplicationLog) Head() (uint64, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head, l.headTime
+}
+
+// Since returns up to max changes after seq and a channel closed on the next
+// change. ok is false when changes after seq were dropped already, or seq is
+// from before a restart of the primary; the standby needs a snapshot then.
+func (l *ReplicationLog) Since(after uint64, max int) (changes []*Change, appended <-chan struct{}, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if after > l.head {
+		return nil, nil, false
+	}
+	oldest := l.head - uint64(len(l.changes)) + 1
+	if after+1 < oldest {
+		return nil, nil, false
+	}
+	changes = l.changes[after+1-oldest:]
+	if len(changes) > max {
+		changes = changes[:max]
+	}
+	return append([]*Change{}, changes...), l.appended, true
+}
+
+// Snapshot copies the state of the messenger, it starts with the head of the
+// log so every change it might miss is replayed from the log
+func (m *Messenger) Snapshot() *ReplicationSnapshot {
+	snapshot := &ReplicationSnapshot{Topics: []*TopicSnapshot{}, Data: make(map[string]*DataStore)}
+	if m.Replication != nil {
+		snapshot.Seq, snapshot.Time = m.Replication.Head()
+	}
+
+	// the default topic first, the other topics link its subscribers
+	names := []string{DefaultTopic}
+	for name := range m.Topics {
+		if name != DefaultTopic {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		topic, ok := m.Topics[name]
+		if !ok {
+			continue
+		}
+		topicSnapshot := &TopicSnapshot{Name: name, Subscribers: []*messengerclient.Subscriber{}, Canary: topic.Canary, Urgent: topic.Urgent, History: []*HistoryMessage{}, Webhooks: topic.Webhooks}
+		for _, subscriber := range topic.Subscribers {
+			topicSnapshot.Subscribers = append(topicSnapshot.Subscribers, &messengerclient.Subscriber{Name: subscriber.Name, SrvAddr: subscriber.SrvAddr, Capabilities: subscriber.Capabilities})
+		}
+		if topic.History != nil {
+			topicSnapshot.History = topic.History.Messages()
+		}
+		snapshot.Topics = append(snapshot.Topics, topicSnapshot)
+	}
+	for requestID, data := range m.Data {
+		snapshot.Data[requestID] = data
+	}
+	return snapshot
+}
+
+// restore replaces the state of the messenger with the snapshot
+func (m *Messenger) restore(snapshot *ReplicationSnapshot) {
+	m.Topics = map[string]*Topic{DefaultTopic: NewTopic(DefaultTopic)}
+	m.Data = make(map[string]*DataStore)
+
+	for _, topicSnapshot := range snapshot.Topics {
+		if topicSnapshot.Name != DefaultTopic {
+			names := make([]string, 0, len(topicSnapshot.Subscribers))
+			for _, subscriber := range topicSnapshot.Subscribers {
+				names = append(names, subscriber.Name)
+			}
+			m.createTopic(topicSnapshot.Name, names, topicSnapshot.Canary, topicSnapshot.Urgent)
+		}
+		for _, subscriber := range topicSnapshot.Subscribers {
+			if _, ok := m.Topics[topicSnapshot.Name].Subscribers[subscriber.Name]; !ok {
+				m.registerSubscriber(topicSnapshot.Name, subscriber)
+			}
+		}
+		for _, message := range topicSnapshot.History {
+			m.Topics[topicSnapshot.Name].History.Add(message.Signer, message.Data)
+		}
+		m.Topics[topicSnapshot.Name].Webhooks = topicSnapshot.Webhooks
+	}
+	for requestID, data := range snapshot.Data {
+		m.Data[requestID] = data
+	}
+}
+
+// apply replays a change of the primary. Messages aren't delivered, the
+// primary did; after a take-over nodes fetch what they missed with a topic sync.
+func (m *Messenger) apply(change *Change) {
+	switch change.Op {
+	case OpRegisterNode:
+		if _, ok := m.Topics[change.Topic]; ok && change.Subscriber != nil {
+			m.registerSubscriber(change.Topic, change.Subscriber)
+		}
+	case OpCreateTopic:
+		m.createTopic(change.Topic, change.Subscribers, change.Canary, change.Urgent)
+	case OpDeleteTopic:
+		delete(m.Topics, change.Topic)
+	case OpPublish:
+		if topic, ok := m.Topics[change.Topic]; ok && topic.History != nil {
+			topic.History.Add(change.Signer, change.Data)
+		}
+	case OpResult:
+		m.Data[change.RequestID] = change.Result
+	case OpAddWebhook:
+		if topic, ok := m.Topics[change.Topic]; ok && change.Webhook != nil {
+			topic.Webhooks = append(topic.Webhooks, change.Webhook)
+		}
+	case OpDeleteWebhook:
+		if topic, ok := m.Topics[change.Topic]; ok && change.Webhook != nil {
+			topic.deleteWebhook(change.Webhook.ID)
+		}
+	default:
+		m.logger.Warnf("apply: unknown replication op %s of change %d", change.Op, change.Seq)
+	}
+}
+
+// ReplicationAuth requires the bearer token on the replication endpoints when
+// it isn't empty, the snapshot holds every kept message and result
+func ReplicationAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "invalid replication token",
+				"error":   "unauthorized",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// HandleReplicationChanges returns the logged changes after the sequence
+// number in the after query, holding the request up to wait for new changes
+func (m *Messenger) HandleReplicationChanges() func(*gin.Context) {
+	return func(c *gin.Context) {
+		if m.Replication == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "replication is turned off",
+				"error":   "no replication log",
+			})
+			return
+		}
+		after, err := strconv.ParseUint(c.DefaultQuery("after", "0"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid after sequence number",
+				"error":   err.Error(),
+			})
+			return
+		}
+		var wait time.Duration
+		if value := c.Query("wait"); value != "" {
+			if wait, err = time.ParseDuration(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"message": "invalid wait duration",
+					"error":   err.Error(),
+				})
+				return
+			}
+		}
+		if wait > maxReplicationWait {
+			wait = maxReplicationWait
+		}
+
+		changes, appended, ok := m.Replication.Since(after, maxChangesPerResponse)
+		if ok && len(changes) == 0 && wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-appended:
+			case <-timer.C:
+			case <-c.Request.Context().Done():
+			}
+			timer.Stop()
+			changes, _, ok = m.Replication.Since(after, maxChangesPerResponse)
+		}
+		if !ok {
+			c.JSON(http.StatusGone, gin.H{
+				"message": "changes after " + strconv.FormatUint(after, 10) + " aren't kept, start over from a snapshot",
+				"error":   "snapshot required",
+			})
+			return
+		}
+
+		resp := &ChangesResponse{Changes: changes}
+		resp.Head, resp.HeadTime = m.Replication.Head()
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func (m *Messenger) HandleReplicationSnapshot() func(*gin.Context) {
+	return func(c *gin.Context) {
+		if m.Replication == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "replication is turned off",
+				"error":   "no replication log",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, m.Snapshot())
+	}
+}
+
+// HandleReplicationStatus reports the role of the messenger and, on a
+// standby, how far it is behind its primary
+func (m *Messenger) HandleReplicationStatus() func(*gin.Context) {
+	return func(c *gin.Context) {
+		if m.standby != nil {
+			c.JSON(http.StatusOK, m.standby.Status())
+			return
+		}
+		status := &ReplicationStatus{Role: RolePrimary}
+		if m.Replication != nil {
+			status.AppliedSeq, _ = m.Replication.Head()
+			status.PrimarySeq = status.AppliedSeq
+		}
+		c.JSON(http.StatusOK, status)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func roundMessage(t *testing.T, signer types.OperatorID) []byte {
+	commitment := [][]byte{make([]byte, 48)}
+	_, _ = rand.Read(commitment[0])
+	data, err := (&frost.ProtocolMsg{
+		Round:         common.Round1,
+		Round1Message: &frost.Round1Message{Commitment: commitment, ProofS: make([]byte, 32), ProofR: make([]byte, 48)},
+	}).Encode()
+	require.NoError(t, err)
+	signed, err := (&dkg.SignedMessage{
+		Message:   &dkg.Message{MsgType: dkg.ProtocolMsgType, Data: data},
+		Signer:    signer,
+		Signature: make([]byte, 256),
+	}).Encode()
+	require.NoError(t, err)
+	msg, err := (&types.SSVMessage{MsgType: types.DKGMsgType, Data: signed}).Encode()
+	require.NoError(t, err)
+	return msg
+}
+
+func testMessenger(t *testing.T) (*Messenger, *workers.Runner) {
+	m := &Messenger{
+		Topics:   map[string]*Topic{DefaultTopic: NewTopic(DefaultTopic)},
+		Incoming: make(chan *Message, IncomingQueueSize),
+		Data:     make(map[string]*DataStore),
+	}
+	m.WithLogger(logrus.New())
+	runner := workers.NewRunner(m.logger)
+	go runner.Run()
+	ctx := context.Background()
+	go m.ProcessIncomingMessageWorker(&ctx)
+	t.Cleanup(func() { close(m.Incoming) })
+	return m, runner
+}
+
+func testRouter(m *Messenger, runner *workers.Runner, standby *Standby) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if standby != nil {
+		r.Use(standby.Guard())
+	}
+	r.POST("/topics", m.HandleCreateTopic())
+	r.GET("/topics/:topic_name", m.GetTopic())
+	r.POST("/register_node", m.HandleNodeRegistration(runner))
+	r.POST("/publish", m.HandlePublish())
+	r.POST("/stream/dkgoutput", m.HandleStreamDKGOutput())
+	r.GET("/data/:request_id", m.HandleGetData())
+	r.GET("/replication/status", m.HandleReplicationStatus())
+	replication := r.Group("/replication", ReplicationAuth("secret"))
+	replication.GET("/changes", m.HandleReplicationChanges())
+	replication.GET("/snapshot", m.HandleReplicationSnapshot())
+	return r
+}
+
+// testNode records the messages delivered to an operator node
+func testNode(t *testing.T) (*httptest.Server, chan []byte) {
+	delivered := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		delivered <- body
+	}))
+	t.Cleanup(srv.Close)
+	return srv, delivered
+}
+
+func post(t *testing.T, url string, body interface{}) *http.Response {
+	var data []byte
+	switch body := body.(type) {
+	case []byte:
+		data = body
+	default:
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func TestReplicationLogSince(t *testing.T) {
+	log := NewReplicationLog(3)
+	changes, _, ok := log.Since(0, 10)
+	require.True(t, ok)
+	require.Empty(t, changes)
+
+	for i := 0; i < 5; i++ {
+		log.Append(&Change{Op: OpDeleteTopic, Topic: fmt.Sprint(i)})
+	}
+	head, _ := log.Head()
+	require.Equal(t, uint64(5), head)
+
+	_, _, ok = log.Since(1, 10)
+	require.False(t, ok, "change 2 was dropped")
+	changes, _, ok = log.Since(2, 10)
+	require.True(t, ok)
+	require.Len(t, changes, 3)
+	require.Equal(t, uint64(3), changes[0].Seq)
+	changes, _, ok = log.Since(2, 2)
+	require.True(t, ok)
+	require.Len(t, changes, 2)
+
+	changes, appended, ok := log.Since(5, 10)
+	require.True(t, ok)
+	require.Empty(t, changes)
+	log.Append(&Change{Op: OpDeleteTopic})
+	<-appended
+
+	_, _, ok = log.Since(7, 10)
+	require.False(t, ok, "standby is ahead of a restarted primary")
+}
+
+func TestStandbyFollowsAndTakesOver(t *testing.T) {
+	node1, delivered1 := testNode(t)
+	node2, _ := testNode(t)
+
+	primary, primaryRunner := testMessenger(t)
+	primary.Replication = NewReplicationLog(DefaultReplicationLogSize)
+	primarySrv := httptest.NewServer(testRouter(primary, primaryRunner, nil))
+	defer primarySrv.Close()
+
+	// state before the standby starts comes with the snapshot
+	require.Equal(t, http.StatusOK, post(t, primarySrv.URL+"/register_node?subscribes_to=default", &Subscriber{Name: "1", SrvAddr: node1.URL, Capabilities: &Capabilities{Protocols: []string{"frost"}, Resharing: true}}).StatusCode)
+	require.Equal(t, http.StatusOK, post(t, primarySrv.URL+"/register_node?subscribes_to=default", &Subscriber{Name: "2", SrvAddr: node2.URL}).StatusCode)
+	require.Equal(t, http.StatusOK, post(t, primarySrv.URL+"/topics", &TopicJSON{TopicName: "aa", Subscribers: []string{"1", "2"}}).StatusCode)
+	round1 := roundMessage(t, 2)
+	require.Equal(t, http.StatusOK, post(t, primarySrv.URL+"/publish?topic_name=aa", round1).StatusCode)
+	require.Equal(t, round1, <-delivered1)
+
+	client := NewMessengerClient(primarySrv.URL)
+	capabilities, err := client.Capabilities(context.Background())
+	require.NoError(t, err)
+	require.Len(t, capabilities, 1, "operator 2 registered without capabilities")
+	require.True(t, capabilities["1"].Resharing)
+	_, err = client.ReplicationSnapshot(context.Background())
+	require.Error(t, err, "replication needs the token")
+	client.Token = "secret"
+
+	standbyMessenger, standbyRunner := testMessenger(t)
+	standby := NewStandby(standbyMessenger, client, standbyRunner, standbyMessenger.logger)
+	standby.PromoteAfter = 500 * time.Millisecond
+	standbySrv := httptest.NewServer(testRouter(standbyMessenger, standbyRunner, standby))
+	defer standbySrv.Close()
+	standby.Start()
+
+	// state after it started comes through the changes
+	require.Equal(t, http.StatusOK, post(t, primarySrv.URL+"/topics", &TopicJSON{TopicName: "bb", Subscribers: []string{"1", "2"}}).StatusCode)
+	round1b := roundMessage(t, 2)
+	require.Equal(t, http.StatusOK, post(t, primarySrv.URL+"/publish?topic_name=bb", round1b).StatusCode)
+	require.Equal(t, round1b, <-delivered1)
+	output := map[types.OperatorID]*dkg.SignedOutput{1: {Signer: 1, Signature: []byte{1}}}
+	require.Equal(t, http.StatusOK, post(t, primarySrv.URL+"/stream/dkgoutput?request_id=aa", output).StatusCode)
+
+	head, _ := primary.Replication.Head()
+	require.Eventually(t, func() bool { return standby.Status().AppliedSeq == head }, 5*time.Second, 10*time.Millisecond)
+	status := standby.Status()
+	require.Equal(t, RoleStandby, status.Role)
+	require.Zero(t, status.LagChanges)
+
+	resp, err := http.Get(standbySrv.URL + "/topics/aa")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "a standby serves nothing while the primary is up")
+
+	// the primary fails, the first request after PromoteAfter promotes the standby
+	primarySrv.Close()
+	time.Sleep(standby.PromoteAfter)
+	resp, err = http.Get(standbySrv.URL + "/topics/aa")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	status = standby.Status()
+	require.Equal(t, RolePrimary, status.Role)
+	require.NotNil(t, status.PromotedAt)
+	require.True(t, standbyMessenger.Topics[DefaultTopic].Subscribers["1"].Capabilities.Resharing)
+	require.Len(t, standbyMessenger.Topics["aa"].History.Messages(), 1)
+	require.Len(t, standbyMessenger.Topics["bb"].History.Messages(), 1)
+	require.Equal(t, types.Signature{1}, standbyMessenger.Data["aa"].DKGOutputs[1].Signature)
+
+	// the promoted standby delivers the next round of the running ceremony
+	round2 := roundMessage(t, 2)
+	require.Equal(t, http.StatusOK, post(t, standbySrv.URL+"/publish?topic_name=aa", round2).StatusCode)
+	select {
+	case delivered := <-delivered1:
+		require.Equal(t, round2, delivered)
+	case <-time.After(5 * time.Second):
+		t.Fatal("promoted standby didn't deliver the message")
+	}
+}
+
+func TestCanaryTopicMarksResult(t *testing.T) {
+	m, runner := testMessenger(t)
+	m.Replication = NewReplicationLog(DefaultReplicationLogSize)
+	srv := httptest.NewServer(testRouter(m, runner, nil))
+	defer srv.Close()
+
+	require.NoError(t, NewMessengerClient(srv.URL).CreateCanaryTopic("aa", []types.OperatorID{1, 2}))
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/topics", &TopicJSON{TopicName: "bb", Subscribers: []string{"1", "2"}}).StatusCode)
+	output := map[types.OperatorID]*dkg.SignedOutput{1: {Signer: 1, Signature: []byte{1}}}
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/stream/dkgoutput?request_id=aa", output).StatusCode)
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/stream/dkgoutput?request_id=bb", output).StatusCode)
+
+	require.True(t, m.Data["aa"].Canary)
+	require.False(t, m.Data["bb"].Canary)
+
+	// a standby restoring the snapshot keeps the mark
+	standby, _ := testMessenger(t)
+	standby.restore(m.Snapshot())
+	require.True(t, standby.Topics["aa"].Canary)
+	require.True(t, standby.Data["aa"].Canary)
+	require.False(t, standby.Topics["bb"].Canary)
+}
@@ -0,0 +1,93 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandlePublishSealed relays every envelope of a sealed start message to the
+// subscriber it is encrypted to, sealed messages aren't kept for topic sync
+func (m *Messenger) HandlePublishSealed() func(*gin.Context) {
+	return func(c *gin.Context) {
+		topicName := c.Param("topic_name")
+		tp, exist := m.Topics[topicName]
+		if !exist {
+			err := &ErrTopicNotFound{TopicName: topicName}
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": fmt.Sprintf("topic %s doesn't exist", topicName),
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		sealed := &SealedStart{}
+		if err := c.ShouldBindJSON(sealed); err != nil {
+			m.logger.Errorf("HandlePublishSealed: failed to parse sealed start message: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to parse sealed start message from request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := m.limits().CheckOperators(len(sealed.Envelopes)); err != nil {
+			m.respondLimit(c, err)
+			return
+		}
+
+		// check every recipient first, a start message reaching part of the committee only stalls the ceremony
+		messages := make(map[*Subscriber]*Message, len(sealed.Envelopes))
+		for operator, envelope := range sealed.Envelopes {
+			subscriber, ok := tp.Subscribers[operator]
+			if !ok || subscriber.Outgoing == nil {
+				c.JSON(http.StatusConflict, gin.H{
+					"message": fmt.Sprintf("operator %s isn't subscribed to topic %s", operator, topicName),
+					"error":   "not a subscriber",
+				})
+				return
+			}
+			data, err := json.Marshal(&SealedDelivery{Topic: topicName, Envelope: envelope})
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"message": fmt.Sprintf("invalid envelope for operator %s", operator),
+					"error":   err.Error(),
+				})
+				return
+			}
+			messages[subscriber] = &Message{Topic: topicName, Data: data, Path: SealedStartPath, Urgent: tp.Urgent}
+		}
+
+		for subscriber, msg := range messages {
+			subscriber.queue(msg)
+		}
+		m.logger.Debugf("HandlePublishSealed: relayed sealed start message of topic %s to %d operators", topicName, len(messages))
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("sealed start message relayed to %d operators of topic %s", len(messages), topicName),
+			"error":   "",
+		})
+	}
+}
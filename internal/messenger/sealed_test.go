@@ -0,0 +1,70 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishSealed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := &Messenger{Topics: map[string]*Topic{}, logger: logrus.New()}
+	topic := NewTopic("abcd")
+	topic.Subscribers["1"] = &Subscriber{Name: "1", Outgoing: make(chan *Message, 1)}
+	topic.Subscribers["2"] = &Subscriber{Name: "2", Outgoing: make(chan *Message, 1)}
+	m.Topics["abcd"] = topic
+
+	r := gin.New()
+	r.POST("/topics/:topic_name/sealed", m.HandlePublishSealed())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	cl := NewMessengerClient(srv.URL)
+
+	err := cl.PublishSealed(context.Background(), "abcd", &SealedStart{Envelopes: map[string]*encryption.Envelope{
+		"1": {Ciphertext: []byte("for 1")},
+		"3": {Ciphertext: []byte("for 3")},
+	}})
+	require.Error(t, err, "operator 3 isn't subscribed")
+	require.Len(t, topic.Subscribers["1"].Outgoing, 0, "nothing is relayed when a recipient is missing")
+
+	err = cl.PublishSealed(context.Background(), "abcd", &SealedStart{Envelopes: map[string]*encryption.Envelope{
+		"1": {Ciphertext: []byte("for 1")},
+		"2": {Ciphertext: []byte("for 2")},
+	}})
+	require.NoError(t, err)
+
+	msg := <-topic.Subscribers["2"].Outgoing
+	require.Equal(t, SealedStartPath, msg.Path)
+	delivery := &SealedDelivery{}
+	require.NoError(t, json.Unmarshal(msg.Data, delivery))
+	require.Equal(t, "abcd", delivery.Topic)
+	require.Equal(t, []byte("for 2"), delivery.Envelope.Ciphertext)
+	require.Empty(t, topic.History.messages, "sealed messages aren't kept for sync")
+}
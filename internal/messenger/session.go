@@ -0,0 +1,322 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultSessionTTL is how long a session token is valid
+	DefaultSessionTTL = time.Hour
+	// challengeTTL is how long an operator has to sign a challenge
+	challengeTTL = time.Minute
+	// maxPendingChallenges bounds the challenges handed out and not used yet
+	maxPendingChallenges = 10000
+
+	sessionOperatorKey = "session_operator"
+)
+
+var (
+	ErrInvalidSession     = errors.New("invalid or expired session token")
+	ErrInvalidChallenge   = errors.New("unknown or expired session challenge")
+	ErrChallengeSignature = errors.New("challenge isn't signed by the operator key")
+	errTooManyChallenges  = errors.New("too many pending session challenges")
+)
+
+// OperatorKeys looks up the registry key of an operator
+type OperatorKeys func(operatorID types.OperatorID) (*rsa.PublicKey, error)
+
+// Sessions maps the tokens of the operators that signed a challenge with their
+// operator key to their operator ids. Sessions live in memory only, nodes open
+// a new one when a restarted or promoted messenger doesn't know theirs.
+type Sessions struct {
+	TTL  time.Duration
+	keys OperatorKeys
+
+	mu         sync.Mutex
+	challenges map[string]*SessionChallenge
+	tokens     map[string]*Session
+}
+
+func NewSessions(keys OperatorKeys, ttl time.Duration) *Sessions {
+	return &Sessions{
+		TTL:        ttl,
+		keys:       keys,
+		challenges: make(map[string]*SessionChallenge),
+		tokens:     make(map[string]*Session),
+	}
+}
+
+// Challenge hands out a nonce for operator to sign
+func (s *Sessions) Challenge(operator string, now time.Time) (*SessionChallenge, error) {
+	if _, err := parseOperator(operator); err != nil {
+		return nil, err
+	}
+	nonce, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	if len(s.challenges) >= maxPendingChallenges {
+		return nil, errTooManyChallenges
+	}
+	challenge := &SessionChallenge{Operator: operator, Challenge: nonce, ExpiresAt: now.Add(challengeTTL).Unix()}
+	s.challenges[nonce] = challenge
+	return challenge, nil
+}
+
+// Open checks the signed challenge against the registry key of the operator
+// and opens a session for it, a challenge opens one session at most
+func (s *Sessions) Open(req *SessionRequest, now time.Time) (*Session, error) {
+	s.mu.Lock()
+	challenge, ok := s.challenges[req.Challenge]
+	delete(s.challenges, req.Challenge)
+	s.mu.Unlock()
+	if !ok || challenge.Operator != req.Operator || now.Unix() >= challenge.ExpiresAt {
+		return nil, ErrInvalidChallenge
+	}
+
+	operatorID, err := parseOperator(req.Operator)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(req.Challenge)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	signature, err := hex.DecodeString(req.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrChallengeSignature, err.Error())
+	}
+	pk, err := s.keys(operatorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the key of operator %d: %w", operatorID, err)
+	}
+	if !types.Verify(pk, messengerclient.SessionRoot(operatorID, nonce), signature) {
+		return nil, ErrChallengeSignature
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{Token: token, Operator: req.Operator, ExpiresAt: now.Add(s.ttl()).Unix()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = session
+	return session, nil
+}
+
+// Operator returns the operator of the session token
+func (s *Sessions) Operator(token string, now time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.tokens[token]
+	if !ok || now.Unix() >= session.ExpiresAt {
+		return "", ErrInvalidSession
+	}
+	return session.Operator, nil
+}
+
+func (s *Sessions) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return DefaultSessionTTL
+	}
+	return s.TTL
+}
+
+// expire drops the expired challenges and sessions, the caller holds mu
+func (s *Sessions) expire(now time.Time) {
+	for nonce, challenge := range s.challenges {
+		if now.Unix() >= challenge.ExpiresAt {
+			delete(s.challenges, nonce)
+		}
+	}
+	for token, session := range s.tokens {
+		if now.Unix() >= session.ExpiresAt {
+			delete(s.tokens, token)
+		}
+	}
+}
+
+func parseOperator(operator string) (types.OperatorID, error) {
+	id, err := strconv.ParseUint(operator, 10, 64)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid operator id %q", operator)
+	}
+	return types.OperatorID(id), nil
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HandleSessionChallenge hands a node a challenge to sign with its operator key
+func (m *Messenger) HandleSessionChallenge() func(*gin.Context) {
+	return func(c *gin.Context) {
+		if m.Sessions == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "this messenger doesn't use sessions",
+				"error":   "sessions are off",
+			})
+			return
+		}
+		req := &SessionChallengeRequest{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to parse challenge request",
+				"error":   err.Error(),
+			})
+			return
+		}
+		challenge, err := m.Sessions.Challenge(req.Operator, time.Now())
+		if errors.Is(err, errTooManyChallenges) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"message": "too many pending session challenges, try again later",
+				"error":   err.Error(),
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid challenge request",
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, challenge)
+	}
+}
+
+// HandleOpenSession opens a session for the node that signed its challenge
+func (m *Messenger) HandleOpenSession() func(*gin.Context) {
+	return func(c *gin.Context) {
+		if m.Sessions == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "this messenger doesn't use sessions",
+				"error":   "sessions are off",
+			})
+			return
+		}
+		req := &SessionRequest{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to parse session request",
+				"error":   err.Error(),
+			})
+			return
+		}
+		session, err := m.Sessions.Open(req, time.Now())
+		if errors.Is(err, ErrInvalidChallenge) || errors.Is(err, ErrChallengeSignature) {
+			m.logger.Warnf("HandleOpenSession: refused session of operator %s: %v", req.Operator, err)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"message": "session refused",
+				"error":   err.Error(),
+			})
+			return
+		} else if err != nil {
+			m.logger.Errorf("HandleOpenSession: failed to open session of operator %s: %v", req.Operator, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "failed to open session",
+				"error":   err.Error(),
+			})
+			return
+		}
+		m.logger.Infof("HandleOpenSession: opened session of operator %s", req.Operator)
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// RequireSession refuses requests without the token of an open session and
+// keeps the operator of the session for the handlers, it lets every request
+// through when the messenger doesn't use sessions
+func (m *Messenger) RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m.Sessions == nil {
+			c.Next()
+			return
+		}
+		operator, err := m.Sessions.Operator(c.GetHeader(messengerclient.SessionHeader), time.Now())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "open a session with the operator key first",
+				"error":   err.Error(),
+				"code":    messengerclient.CodeInvalidSession,
+			})
+			return
+		}
+		c.Set(sessionOperatorKey, operator)
+		c.Next()
+	}
+}
+
+// allowOperator refuses the request when its session belongs to another
+// operator than the one it acts for
+func (m *Messenger) allowOperator(c *gin.Context, operator string) bool {
+	sessionOperator, ok := c.Get(sessionOperatorKey)
+	if !ok || sessionOperator == operator {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"message": fmt.Sprintf("session of operator %s can't act for operator %s", sessionOperator, operator),
+		"error":   "operator mismatch",
+	})
+	return false
+}
+
+// allowTopic refuses the request when the operator of its session isn't a
+// subscriber of the topic
+func (m *Messenger) allowTopic(c *gin.Context, topicName string) bool {
+	sessionOperator, ok := c.Get(sessionOperatorKey)
+	if !ok {
+		return true
+	}
+	if topic, exist := m.Topics[topicName]; exist {
+		if _, subscribed := topic.Subscribers[sessionOperator.(string)]; subscribed {
+			return true
+		}
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"message": fmt.Sprintf("operator %s isn't subscribed to topic %s", sessionOperator, topicName),
+		"error":   "not a subscriber",
+	})
+	return false
+}
@@ -0,0 +1,150 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func testOperatorKeys(t *testing.T, operators ...types.OperatorID) (map[types.OperatorID]*rsa.PrivateKey, OperatorKeys) {
+	keys := make(map[types.OperatorID]*rsa.PrivateKey)
+	for _, operator := range operators {
+		sk, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		keys[operator] = sk
+	}
+	return keys, func(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+		sk, ok := keys[operatorID]
+		if !ok {
+			return nil, fmt.Errorf("operator %d not found", operatorID)
+		}
+		return &sk.PublicKey, nil
+	}
+}
+
+func TestSessions(t *testing.T) {
+	keys, lookup := testOperatorKeys(t, 1, 2)
+	sessions := NewSessions(lookup, time.Hour)
+	now := time.Unix(1700000000, 0)
+
+	challenge, err := sessions.Challenge("1", now)
+	require.NoError(t, err)
+	signed, err := messengerclient.SignSessionChallenge(keys[1], challenge)
+	require.NoError(t, err)
+	session, err := sessions.Open(signed, now)
+	require.NoError(t, err)
+	require.Equal(t, "1", session.Operator)
+	require.Equal(t, now.Add(time.Hour).Unix(), session.ExpiresAt)
+
+	operator, err := sessions.Operator(session.Token, now)
+	require.NoError(t, err)
+	require.Equal(t, "1", operator)
+	_, err = sessions.Operator(session.Token, now.Add(time.Hour))
+	require.ErrorIs(t, err, ErrInvalidSession, "expired")
+	_, err = sessions.Operator("unknown", now)
+	require.ErrorIs(t, err, ErrInvalidSession)
+
+	_, err = sessions.Open(signed, now)
+	require.ErrorIs(t, err, ErrInvalidChallenge, "a challenge opens one session")
+
+	challenge, err = sessions.Challenge("2", now)
+	require.NoError(t, err)
+	forged, err := messengerclient.SignSessionChallenge(keys[1], challenge)
+	require.NoError(t, err)
+	_, err = sessions.Open(forged, now)
+	require.ErrorIs(t, err, ErrChallengeSignature, "signed by operator 1 for operator 2")
+
+	challenge, err = sessions.Challenge("2", now)
+	require.NoError(t, err)
+	signed, err = messengerclient.SignSessionChallenge(keys[2], challenge)
+	require.NoError(t, err)
+	_, err = sessions.Open(signed, now.Add(challengeTTL))
+	require.ErrorIs(t, err, ErrInvalidChallenge, "expired")
+
+	_, err = sessions.Challenge("operator", now)
+	require.Error(t, err)
+}
+
+func TestRequireSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, lookup := testOperatorKeys(t, 1, 2)
+	m := &Messenger{Topics: map[string]*Topic{}, Incoming: make(chan *Message, 1), Sessions: NewSessions(lookup, time.Hour), logger: logrus.New()}
+	topic := NewTopic("abcd")
+	topic.Subscribers["1"] = &Subscriber{Name: "1"}
+	m.Topics["abcd"] = topic
+
+	r := gin.New()
+	r.POST(SessionChallengePath, m.HandleSessionChallenge())
+	r.POST(SessionPath, m.HandleOpenSession())
+	r.POST("/publish", m.RequireSession(), m.HandlePublish())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	ctx := context.Background()
+
+	err := NewMessengerClient(srv.URL).Publish(ctx, "abcd", []byte("msg"))
+	require.True(t, messengerclient.IsInvalidSession(err), "no session")
+
+	cl := NewMessengerClient(srv.URL).WithSession(1, keys[1])
+	require.NoError(t, cl.Publish(ctx, "abcd", []byte("msg")))
+	require.Len(t, m.Incoming, 1)
+	<-m.Incoming
+
+	m.Sessions = NewSessions(lookup, time.Hour)
+	require.NoError(t, cl.Publish(ctx, "abcd", []byte("msg")), "a new session after the messenger forgot the old one")
+	<-m.Incoming
+
+	other := NewMessengerClient(srv.URL).WithSession(2, keys[2])
+	err = other.Publish(ctx, "abcd", []byte("msg"))
+	require.Error(t, err, "operator 2 isn't subscribed")
+	require.Len(t, m.Incoming, 0)
+
+	impostor := NewMessengerClient(srv.URL).WithSession(1, keys[2])
+	require.ErrorContains(t, impostor.Publish(ctx, "abcd", []byte("msg")), "failed to open messenger session")
+}
+
+func TestWithSessionWithoutSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, _ := testOperatorKeys(t, 1)
+	m := &Messenger{Topics: map[string]*Topic{"abcd": NewTopic("abcd")}, Incoming: make(chan *Message, 1), logger: logrus.New()}
+
+	r := gin.New()
+	r.POST(SessionChallengePath, m.HandleSessionChallenge())
+	r.POST("/publish", m.RequireSession(), m.HandlePublish())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cl := NewMessengerClient(srv.URL).WithSession(1, keys[1])
+	require.NoError(t, cl.Publish(context.Background(), "abcd", []byte("msg")), "the messenger doesn't use sessions")
+	require.Len(t, m.Incoming, 1)
+}
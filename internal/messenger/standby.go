@@ -0,0 +1,311 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/workers"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPromoteAfter is how long a standby has to lose its primary before a
+// request to it makes it take over
+const DefaultPromoteAfter = 30 * time.Second
+
+// standbyRetryInterval is the pause after a failed request to the primary
+const standbyRetryInterval = 2 * time.Second
+
+// Standby keeps a messenger in sync with a primary by tailing its replication
+// log. Until it is promoted it delivers nothing to the nodes and answers only
+// the replication and health endpoints, so a DNS flip to it after the primary
+// failed picks up the topics, subscribers and messages of running ceremonies.
+type Standby struct {
+	// PromoteAfter is how long the primary has to be unreachable before a
+	// request to the standby promotes it
+	PromoteAfter time.Duration
+	// LogSize is the replication log the standby keeps once promoted
+	LogSize int
+
+	m       *Messenger
+	primary *Client
+	runner  *workers.Runner
+	logger  *logrus.Logger
+
+	mu          sync.Mutex
+	promoted    bool
+	promotedAt  time.Time
+	applied     uint64
+	appliedTime time.Time
+	head        uint64
+	headTime    time.Time
+	lastContact time.Time
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// NewStandby makes m a standby of the primary, runner starts the delivery
+// workers on promotion
+func NewStandby(m *Messenger, primary *Client, runner *workers.Runner, logger *logrus.Logger) *Standby {
+	s := &Standby{
+		PromoteAfter: DefaultPromoteAfter,
+		LogSize:      DefaultReplicationLogSize,
+		m:            m,
+		primary:      primary,
+		runner:       runner,
+		logger:       logger,
+	}
+	m.standby = s
+	return s
+}
+
+// Start tails the primary until the standby is promoted
+func (s *Standby) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancel, s.done = cancel, make(chan struct{})
+	s.mu.Unlock()
+	go s.run(ctx, s.done)
+}
+
+func (s *Standby) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	synced := false
+	for ctx.Err() == nil {
+		var err error
+		if !synced {
+			err = s.syncSnapshot(ctx)
+		} else {
+			err = s.tail(ctx)
+		}
+		switch {
+		case err == nil:
+			synced = true
+		case ctx.Err() != nil:
+			return
+		default:
+			var statusErr *ErrUnexpectedStatus
+			if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusGone {
+				s.logger.Warnf("Standby: fell behind the replication log of %s, starting over from a snapshot", s.primary.SrvAddr)
+				synced = false
+				continue
+			}
+			s.logger.Errorf("Standby: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(standbyRetryInterval):
+			}
+		}
+	}
+}
+
+func (s *Standby) syncSnapshot(ctx context.Context) error {
+	snapshot, err := s.primary.ReplicationSnapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	s.m.restore(snapshot)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applied, s.appliedTime = snapshot.Seq, snapshot.Time
+	s.head, s.headTime = snapshot.Seq, snapshot.Time
+	s.lastContact = time.Now()
+	s.logger.Infof("Standby: restored snapshot of %s at change %d with %d topics", s.primary.SrvAddr, snapshot.Seq, len(snapshot.Topics))
+	return nil
+}
+
+func (s *Standby) tail(ctx context.Context) error {
+	s.mu.Lock()
+	after := s.applied
+	s.mu.Unlock()
+
+	resp, err := s.primary.ReplicationChanges(ctx, after, s.pollWait())
+	if err != nil {
+		return fmt.Errorf("failed to get changes after %d: %w", after, err)
+	}
+	for _, change := range resp.Changes {
+		s.m.apply(change)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(resp.Changes); n > 0 {
+		s.applied, s.appliedTime = resp.Changes[n-1].Seq, resp.Changes[n-1].Time
+	}
+	s.head, s.headTime = resp.Head, resp.HeadTime
+	s.lastContact = time.Now()
+	return nil
+}
+
+// pollWait keeps the long poll well below PromoteAfter, a healthy primary
+// never looks unreachable
+func (s *Standby) pollWait() time.Duration {
+	wait := s.PromoteAfter / 3
+	if wait > 10*time.Second {
+		wait = 10 * time.Second
+	}
+	return wait
+}
+
+// Promote stops tailing the primary and makes the standby deliver messages and
+// accept requests. Messages the primary published but didn't deliver before it
+// failed reach the nodes through their topic sync.
+func (s *Standby) Promote() {
+	s.mu.Lock()
+	if s.promoted {
+		s.mu.Unlock()
+		return
+	}
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.promoted {
+		return
+	}
+	started := make(map[*Subscriber]bool)
+	for _, topic := range s.m.Topics {
+		for _, subscriber := range topic.Subscribers {
+			if !started[subscriber] {
+				started[subscriber] = true
+				startDelivery(s.runner, subscriber)
+			}
+		}
+	}
+	if s.LogSize > 0 {
+		s.m.Replication = NewReplicationLog(s.LogSize)
+	}
+	s.promoted, s.promotedAt = true, time.Now().UTC()
+	s.logger.Warnf("Standby: promoted to primary at change %d of %s, delivering to %d subscribers", s.applied, s.primary.SrvAddr, len(started))
+}
+
+// Status is the replication state of the standby, the role turns primary once promoted
+func (s *Standby) Status() *ReplicationStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := &ReplicationStatus{
+		Role:       RoleStandby,
+		Primary:    s.primary.SrvAddr,
+		AppliedSeq: s.applied,
+		PrimarySeq: s.head,
+	}
+	if s.head > s.applied {
+		status.LagChanges = s.head - s.applied
+		status.LagSeconds = s.headTime.Sub(s.appliedTime).Seconds()
+	}
+	if !s.lastContact.IsZero() {
+		lastContact := s.lastContact.UTC()
+		status.LastContact = &lastContact
+	}
+	if s.promoted {
+		status.Role = RolePrimary
+		promotedAt := s.promotedAt
+		status.PromotedAt = &promotedAt
+	}
+	return status
+}
+
+// primaryLost reports whether the primary didn't answer for PromoteAfter
+func (s *Standby) primaryLost() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.lastContact) >= s.PromoteAfter
+}
+
+func (s *Standby) isPromoted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.promoted
+}
+
+// Guard answers requests with 503 while the primary is alive and promotes the
+// standby on the first request after it was lost. Health, metrics and the
+// replication endpoints are always served.
+func (s *Standby) Guard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if s.isPromoted() || path == "/ping" || path == "/version" || path == "/metrics" || path == "/openapi.json" || strings.HasPrefix(path, "/replication/") {
+			c.Next()
+			return
+		}
+		if !s.primaryLost() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"message": fmt.Sprintf("messenger is a standby of %s", s.primary.SrvAddr),
+				"error":   "standby",
+			})
+			return
+		}
+		s.logger.Warnf("Standby: %s %s while %s is unreachable, taking over", c.Request.Method, path, s.primary.SrvAddr)
+		s.Promote()
+		c.Next()
+	}
+}
+
+// HandlePromote promotes the standby right away, for a planned switch-over
+// while the primary is still up
+func (s *Standby) HandlePromote() func(*gin.Context) {
+	return func(c *gin.Context) {
+		s.Promote()
+		c.JSON(http.StatusOK, s.Status())
+	}
+}
+
+func (s *Standby) Collectors() []prometheus.Collector {
+	gauge := func(name, help string, value func(status *ReplicationStatus) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			return value(s.Status())
+		})
+	}
+	return []prometheus.Collector{
+		gauge("messenger_replication_standby", "1 while the messenger is a standby, 0 once promoted", func(status *ReplicationStatus) float64 {
+			if status.Role == RoleStandby {
+				return 1
+			}
+			return 0
+		}),
+		gauge("messenger_replication_lag_changes", "Changes of the primary the standby didn't apply yet", func(status *ReplicationStatus) float64 { return float64(status.LagChanges) }),
+		gauge("messenger_replication_lag_seconds", "How much older the last applied change is than the latest change of the primary", func(status *ReplicationStatus) float64 { return status.LagSeconds }),
+		gauge("messenger_replication_last_contact_seconds", "Seconds since the standby last heard from the primary, -1 before the first contact", func(status *ReplicationStatus) float64 {
+			if status.LastContact == nil {
+				return -1
+			}
+			return time.Since(*status.LastContact).Seconds()
+		}),
+	}
+}
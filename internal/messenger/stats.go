@@ -0,0 +1,90 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/stats"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleStats aggregates the ceremonies relayed since the messenger started
+// over the last ?days= days. Ceremonies that never got a result aren't
+// counted, the nodes count them as timed out.
+func (m *Messenger) HandleStats() func(*gin.Context) {
+	return func(c *gin.Context) {
+		days, err := stats.ParseDays(c.Query("days"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid stats parameters",
+				"error":   err.Error(),
+			})
+			return
+		}
+		var samples []stats.Sample
+		if m.Stats != nil {
+			samples = m.Stats.Samples()
+		}
+		c.JSON(http.StatusOK, stats.Aggregate(samples, days, time.Now()))
+	}
+}
+
+// recordStart starts the ceremony of a topic in the stats
+func (m *Messenger) recordStart(requestID string) {
+	if m.Stats != nil {
+		m.Stats.Start(requestID, time.Now().UTC())
+	}
+}
+
+// recordResult finishes the ceremony of a result in the stats, a blame is
+// attributed to the operator it targets and categorized by its type
+func (m *Messenger) recordResult(requestID string, blame *dkg.BlameOutput) {
+	if m.Stats == nil {
+		return
+	}
+	if blame == nil {
+		m.Stats.Finish(requestID, true, "", nil, time.Now().UTC())
+		return
+	}
+	cause, culprits := blameCause(blame)
+	m.Stats.Finish(requestID, false, cause, culprits, time.Now().UTC())
+}
+
+// blameCause is the cause of a blame and the operator it targets
+func blameCause(blame *dkg.BlameOutput) (ceremony.Cause, []types.OperatorID) {
+	cause := ceremony.CauseOther
+	var culprits []types.OperatorID
+	if blame.BlameMessage != nil && blame.BlameMessage.Message != nil {
+		protocolMsg := &frost.ProtocolMsg{}
+		if err := protocolMsg.Decode(blame.BlameMessage.Message.Data); err == nil && protocolMsg.BlameMessage != nil {
+			culprits = append(culprits, types.OperatorID(protocolMsg.BlameMessage.TargetOperatorID))
+			cause = ceremony.BlameMessageCause(protocolMsg.BlameMessage)
+		}
+	}
+	return cause, culprits
+}
@@ -0,0 +1,76 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/stats"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	m, runner := testMessenger(t)
+	m.Stats = stats.NewRecorder(0)
+	r := testRouter(m, runner, nil)
+	r.POST("/stream/dkgblame", m.HandleStreamDKGBlame())
+	r.GET("/stats", m.HandleStats())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	for _, topic := range []string{"aa", "bb"} {
+		require.Equal(t, http.StatusOK, post(t, srv.URL+"/topics", &TopicJSON{TopicName: topic, Subscribers: []string{"1", "2"}}).StatusCode)
+	}
+	output := map[types.OperatorID]*dkg.SignedOutput{1: {Signer: 1, Signature: []byte{1}}}
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/stream/dkgoutput?request_id=aa", output).StatusCode)
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/stream/dkgoutput?request_id=aa", output).StatusCode)
+
+	blame, err := (&frost.ProtocolMsg{Round: common.Blame, BlameMessage: &frost.BlameMessage{TargetOperatorID: 2}}).Encode()
+	require.NoError(t, err)
+	blameOutput := &dkg.BlameOutput{BlameMessage: &dkg.SignedMessage{Message: &dkg.Message{MsgType: dkg.ProtocolMsgType, Data: blame}, Signer: 1}}
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/stream/dkgblame?request_id=bb", blameOutput).StatusCode)
+
+	resp, err := http.Get(srv.URL + "/stats?days=7")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	got := &stats.Stats{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(got))
+	require.Len(t, got.Days, 7)
+	require.Equal(t, 2, got.Total.Ceremonies, "the outputs of the other operators don't count again")
+	require.Equal(t, 1, got.Total.Completed)
+	require.Equal(t, 0.5, got.Total.SuccessRate)
+	require.Len(t, got.Operators, 1)
+	require.Equal(t, types.OperatorID(2), got.Operators[0].Operator)
+
+	resp, err = http.Get(srv.URL + "/stats?days=0")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
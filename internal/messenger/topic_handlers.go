@@ -27,11 +27,6 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-type TopicJSON struct {
-	TopicName   string   `json:"topic_name"`
-	Subscribers []string `json:"subscribers"`
-}
-
 func (m *Messenger) GetTopics() func(*gin.Context) {
 	return func(c *gin.Context) {
 		c.JSON(http.StatusOK, m.Topics)
@@ -42,7 +37,7 @@ func (m *Messenger) HandleCreateTopic() func(*gin.Context) {
 	return func(c *gin.Context) {
 		topicJSON := &TopicJSON{}
 		if err := c.ShouldBindJSON(topicJSON); err != nil {
-			m.logger.Errorf("HandleCreateTopic: failed to parse topic from request body: %w", err)
+			m.logger.Errorf("HandleCreateTopic: failed to parse topic from request body: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{
 				"message": "failed to load data from request body",
 				"error":   err.Error(),
@@ -50,23 +45,36 @@ func (m *Messenger) HandleCreateTopic() func(*gin.Context) {
 			return
 		}
 
-		topic := Topic{
-			Name:        topicJSON.TopicName,
-			Subscribers: make(map[string]*Subscriber),
+		if err := m.limits().CheckOperators(len(topicJSON.Subscribers)); err != nil {
+			m.respondLimit(c, err)
+			return
 		}
 
-		for _, sub := range topicJSON.Subscribers {
-			subscriber, ok := m.Topics[DefaultTopic].Subscribers[sub]
-			if ok {
-				subscriber.SubscribesTo[topicJSON.TopicName] = &topic
-				topic.Subscribers[sub] = subscriber
-			}
-		}
-		m.Topics[topicJSON.TopicName] = &topic
+		topic := m.createTopic(topicJSON.TopicName, topicJSON.Subscribers, topicJSON.Canary, topicJSON.Urgent)
+		m.recordStart(topicJSON.TopicName)
+		m.replicate(&Change{Op: OpCreateTopic, Topic: topicJSON.TopicName, Subscribers: topicJSON.Subscribers, Canary: topicJSON.Canary, Urgent: topicJSON.Urgent})
 		c.JSON(http.StatusOK, topic)
 	}
 }
 
+// createTopic replaces the topic with a new one for the subscribers of the
+// default topic in subscribers, other names are left out
+func (m *Messenger) createTopic(name string, subscribers []string, canary, urgent bool) *Topic {
+	topic := NewTopic(name)
+	topic.Canary = canary
+	topic.Urgent = urgent
+
+	for _, sub := range subscribers {
+		subscriber, ok := m.Topics[DefaultTopic].Subscribers[sub]
+		if ok {
+			subscriber.SubscribesTo[name] = topic
+			topic.Subscribers[sub] = subscriber
+		}
+	}
+	m.Topics[name] = topic
+	return topic
+}
+
 func (m *Messenger) GetTopic() func(*gin.Context) {
 	return func(c *gin.Context) {
 		topic, exist := m.Topics[c.Param("topic_name")]
@@ -86,5 +94,6 @@ func (m *Messenger) DeleteTopic() func(*gin.Context) {
 			return
 		}
 		delete(m.Topics, topic.Name)
+		m.replicate(&Change{Op: OpDeleteTopic, Topic: topic.Name})
 	}
 }
@@ -0,0 +1,345 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxTopicWebhooks bounds the webhooks of a topic
+	maxTopicWebhooks = 8
+	// webhookAttempts a notification is posted before it is dropped, the
+	// wait doubles from webhookBackoff between them
+	webhookAttempts = 4
+	webhookBackoff  = time.Second
+)
+
+// WebhookAllowFromEnv reads MESSENGER_WEBHOOK_ALLOW, comma separated
+// networks or addresses of the private, loopback and link-local addresses
+// webhooks may point to
+func WebhookAllowFromEnv() ([]*net.IPNet, error) {
+	var allow []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv("MESSENGER_WEBHOOK_ALLOW"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			allow = append(allow, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MESSENGER_WEBHOOK_ALLOW entry %q", entry)
+		}
+		allow = append(allow, network)
+	}
+	return allow, nil
+}
+
+// webhookAddrAllowed keeps webhooks off the messenger's own network: private,
+// loopback, link-local and unspecified addresses are refused unless allowed
+func (m *Messenger) webhookAddrAllowed(ip net.IP) bool {
+	for _, network := range m.WebhookAllow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified())
+}
+
+// checkWebhookHost refuses a webhook whose host resolves to an address that
+// isn't allowed
+func (m *Messenger) checkWebhookHost(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host %s: %w", u.Hostname(), err)
+	}
+	for _, ip := range ips {
+		if !m.webhookAddrAllowed(ip) {
+			return fmt.Errorf("webhook host %s resolves to %s, a private, loopback or link-local address not in MESSENGER_WEBHOOK_ALLOW", u.Hostname(), ip)
+		}
+	}
+	return nil
+}
+
+// webhooks is the client notifications are posted with. It checks the
+// address of every connection, so a host resolving to another address after
+// registration or a redirect doesn't reach the messenger's network either.
+func (m *Messenger) webhooks() *http.Client {
+	m.webhookOnce.Do(func() {
+		dialer := &net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !m.webhookAddrAllowed(ip) {
+					return fmt.Errorf("webhook address %s isn't allowed", host)
+				}
+				return nil
+			},
+		}
+		m.webhookClient = &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+		}
+	})
+	return m.webhookClient
+}
+
+// HandleAddWebhook registers a webhook on the topic and returns it with its
+// id and secret, the secret isn't returned again
+func (m *Messenger) HandleAddWebhook() func(*gin.Context) {
+	return func(c *gin.Context) {
+		topic, ok := m.Topics[c.Param("topic_name")]
+		if !ok {
+			c.JSON(http.StatusNotFound, nil)
+			return
+		}
+		webhook := &Webhook{}
+		if err := c.ShouldBindJSON(webhook); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "failed to load data from request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+		err := webhook.Validate()
+		if err == nil {
+			err = m.checkWebhookHost(c.Request.Context(), webhook.URL)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid webhook",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if len(topic.Webhooks) >= maxTopicWebhooks {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "invalid webhook",
+				"error":   fmt.Sprintf("topic %s has %d webhooks already", topic.Name, maxTopicWebhooks),
+			})
+			return
+		}
+		id, err := randomHex(8)
+		if err == nil && webhook.Secret == "" {
+			webhook.Secret, err = randomHex(32)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "failed to register webhook",
+				"error":   err.Error(),
+			})
+			return
+		}
+		webhook.ID = id
+		topic.Webhooks = append(topic.Webhooks, webhook)
+		m.replicate(&Change{Op: OpAddWebhook, Topic: topic.Name, Webhook: webhook})
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// HandleListWebhooks lists the webhooks of the topic without their secrets
+func (m *Messenger) HandleListWebhooks() func(*gin.Context) {
+	return func(c *gin.Context) {
+		topic, ok := m.Topics[c.Param("topic_name")]
+		if !ok {
+			c.JSON(http.StatusNotFound, nil)
+			return
+		}
+		webhooks := make([]*Webhook, 0, len(topic.Webhooks))
+		for _, webhook := range topic.Webhooks {
+			webhooks = append(webhooks, &Webhook{ID: webhook.ID, URL: webhook.URL, Events: webhook.Events})
+		}
+		c.JSON(http.StatusOK, webhooks)
+	}
+}
+
+// HandleDeleteWebhook removes a webhook of the topic, the caller proves it
+// registered the webhook with its secret: the ids are listed to anyone
+func (m *Messenger) HandleDeleteWebhook() func(*gin.Context) {
+	return func(c *gin.Context) {
+		topic, ok := m.Topics[c.Param("topic_name")]
+		webhook := topic.webhook(c.Param("id"))
+		if !ok || webhook == nil {
+			c.JSON(http.StatusNotFound, nil)
+			return
+		}
+		secret := c.GetHeader(messengerclient.WebhookSecretHeader)
+		if secret == "" || !hmac.Equal([]byte(secret), []byte(webhook.Secret)) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "failed to delete webhook",
+				"error":   fmt.Sprintf("%s doesn't hold the secret of webhook %s", messengerclient.WebhookSecretHeader, webhook.ID),
+			})
+			return
+		}
+		topic.deleteWebhook(webhook.ID)
+		m.replicate(&Change{Op: OpDeleteWebhook, Topic: topic.Name, Webhook: &Webhook{ID: c.Param("id")}})
+		c.JSON(http.StatusOK, nil)
+	}
+}
+
+func (t *Topic) webhook(id string) *Webhook {
+	if t == nil {
+		return nil
+	}
+	for _, webhook := range t.Webhooks {
+		if webhook.ID == id {
+			return webhook
+		}
+	}
+	return nil
+}
+
+func (t *Topic) deleteWebhook(id string) bool {
+	for i, webhook := range t.Webhooks {
+		if webhook.ID == id {
+			t.Webhooks = append(t.Webhooks[:i:i], t.Webhooks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// notifyProgress tells the webhooks of the topic an operator published a message
+func (m *Messenger) notifyProgress(topic *Topic, signer types.OperatorID) {
+	n := &WebhookNotification{Event: messengerclient.WebhookProgress, Operator: signer}
+	if topic.History != nil {
+		n.Messages = topic.History.Len()
+	}
+	m.notify(topic.Name, n)
+}
+
+// notifyOutput tells the webhooks of the topic the ceremony completed
+func (m *Messenger) notifyOutput(requestID string, outputs map[types.OperatorID]*dkg.SignedOutput) {
+	n := &WebhookNotification{Event: messengerclient.WebhookOutput}
+	for operatorID, output := range outputs {
+		n.Operators = append(n.Operators, operatorID)
+		if output != nil && output.Data != nil && n.ValidatorPK == "" {
+			n.ValidatorPK = hex.EncodeToString(output.Data.ValidatorPubKey)
+		}
+	}
+	sort.Slice(n.Operators, func(i, j int) bool { return n.Operators[i] < n.Operators[j] })
+	m.notify(requestID, n)
+}
+
+// notifyBlame tells the webhooks of the topic an operator was blamed
+func (m *Messenger) notifyBlame(requestID string, blame *dkg.BlameOutput) {
+	cause, culprits := blameCause(blame)
+	n := &WebhookNotification{Event: messengerclient.WebhookBlame, Cause: string(cause)}
+	if len(culprits) > 0 {
+		n.Culprit = culprits[0]
+	}
+	m.notify(requestID, n)
+}
+
+// notify posts the notification to the webhooks of the topic that want its
+// event, in the background
+func (m *Messenger) notify(topicName string, n *WebhookNotification) {
+	topic, ok := m.Topics[topicName]
+	if !ok || len(topic.Webhooks) == 0 {
+		return
+	}
+	n.Topic, n.RequestID, n.Time = topicName, topicName, time.Now().UTC()
+	body, err := json.Marshal(n)
+	if err != nil {
+		m.logger.Errorf("notify: failed to marshal %s notification of topic %s: %v", n.Event, topicName, err)
+		return
+	}
+	for _, webhook := range topic.Webhooks {
+		if webhook.Wants(n.Event) {
+			go m.deliverWebhook(webhook, n.Event, body)
+		}
+	}
+}
+
+// deliverWebhook posts a notification, again with a growing wait while the
+// webhook fails, and drops it after webhookAttempts
+func (m *Messenger) deliverWebhook(webhook *Webhook, event string, body []byte) {
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(m.webhooks(), webhook, event, body)
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			m.logger.Warnf("deliverWebhook: dropped %s notification for webhook %s after %d attempts: %v", event, webhook.ID, attempt, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postWebhook(client *http.Client, webhook *Webhook, event string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(messengerclient.WebhookEventHeader, event)
+	req.Header.Set(messengerclient.WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(messengerclient.WebhookSignatureHeader, messengerclient.SignWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookNotifiedOfOutput(t *testing.T) {
+	m, runner := testMessenger(t)
+	m.Replication = NewReplicationLog(DefaultReplicationLogSize)
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	r := testRouter(m, runner, nil)
+	r.POST("/topics/:topic_name/webhooks", m.HandleAddWebhook())
+	r.GET("/topics/:topic_name/webhooks", m.HandleListWebhooks())
+	r.DELETE("/topics/:topic_name/webhooks/:id", m.HandleDeleteWebhook())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	delivered := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		delivered <- delivery{header: r.Header, body: body}
+	}))
+	defer receiver.Close()
+
+	cl := NewMessengerClient(srv.URL)
+	ctx := context.Background()
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/topics", &TopicJSON{TopicName: "aa", Subscribers: []string{"1", "2"}}).StatusCode)
+
+	// the receiver listens on loopback, refused until it is allowed
+	_, err := cl.RegisterWebhook(ctx, "aa", &Webhook{URL: receiver.URL})
+	require.Error(t, err)
+	m.WebhookAllow = []*net.IPNet{loopback}
+
+	_, err = cl.RegisterWebhook(ctx, "aa", &Webhook{URL: receiver.URL, Events: []string{"unknown"}})
+	require.Error(t, err)
+	_, err = cl.RegisterWebhook(ctx, "missing", &Webhook{URL: receiver.URL})
+	require.Error(t, err)
+
+	webhook, err := cl.RegisterWebhook(ctx, "aa", &Webhook{URL: receiver.URL, Events: []string{messengerclient.WebhookOutput}})
+	require.NoError(t, err)
+	require.NotEmpty(t, webhook.ID)
+	require.NotEmpty(t, webhook.Secret)
+
+	webhooks, err := cl.Webhooks(ctx, "aa")
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	require.Empty(t, webhooks[0].Secret, "secrets aren't listed")
+
+	output := map[types.OperatorID]*dkg.SignedOutput{
+		2: {Signer: 2, Data: &dkg.Output{ValidatorPubKey: []byte{0xab}}},
+		1: {Signer: 1, Data: &dkg.Output{ValidatorPubKey: []byte{0xab}}},
+	}
+	require.Equal(t, http.StatusOK, post(t, srv.URL+"/stream/dkgoutput?request_id=aa", output).StatusCode)
+
+	var got delivery
+	select {
+	case got = <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook wasn't notified")
+	}
+	require.Equal(t, messengerclient.WebhookOutput, got.header.Get(messengerclient.WebhookEventHeader))
+	require.NoError(t, messengerclient.VerifyWebhook(webhook.Secret, got.header, got.body, time.Minute))
+	require.Error(t, messengerclient.VerifyWebhook("other", got.header, got.body, time.Minute))
+	n := &WebhookNotification{}
+	require.NoError(t, json.Unmarshal(got.body, n))
+	require.Equal(t, "aa", n.RequestID)
+	require.Equal(t, "ab", n.ValidatorPK)
+	require.Equal(t, []types.OperatorID{1, 2}, n.Operators)
+
+	// a standby keeps the webhooks, secrets included, to notify after taking over
+	standby, _ := testMessenger(t)
+	standby.restore(m.Snapshot())
+	require.Len(t, standby.Topics["aa"].Webhooks, 1)
+	require.Equal(t, webhook.Secret, standby.Topics["aa"].Webhooks[0].Secret)
+
+	// the ids are listed to anyone, deleting takes the secret
+	require.Error(t, cl.DeleteWebhook(ctx, "aa", webhook.ID, ""))
+	require.Error(t, cl.DeleteWebhook(ctx, "aa", webhook.ID, "other"))
+	require.Len(t, m.Topics["aa"].Webhooks, 1)
+	require.NoError(t, cl.DeleteWebhook(ctx, "aa", webhook.ID, webhook.Secret))
+	require.Error(t, cl.DeleteWebhook(ctx, "aa", webhook.ID, webhook.Secret))
+	require.Empty(t, m.Topics["aa"].Webhooks)
+}
+
+func TestWebhookAddrAllowed(t *testing.T) {
+	m := &Messenger{}
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "192.168.0.1", "169.254.169.254", "::1", "fe80::1", "fd00::1", "0.0.0.0"} {
+		require.False(t, m.webhookAddrAllowed(net.ParseIP(addr)), addr)
+	}
+	require.True(t, m.webhookAddrAllowed(net.ParseIP("93.184.216.34")))
+
+	t.Setenv("MESSENGER_WEBHOOK_ALLOW", "10.0.0.0/8, 169.254.0.1")
+	allow, err := WebhookAllowFromEnv()
+	require.NoError(t, err)
+	m.WebhookAllow = allow
+	require.True(t, m.webhookAddrAllowed(net.ParseIP("10.1.2.3")))
+	require.True(t, m.webhookAddrAllowed(net.ParseIP("169.254.0.1")))
+	require.False(t, m.webhookAddrAllowed(net.ParseIP("169.254.169.254")))
+
+	t.Setenv("MESSENGER_WEBHOOK_ALLOW", "internal")
+	_, err = WebhookAllowFromEnv()
+	require.Error(t, err)
+}
@@ -0,0 +1,148 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Allowlist restricts a group of paths to client networks, e.g. the admin
+// endpoints to the management network
+type Allowlist struct {
+	Group string
+	// Paths of the group, a trailing * matches a prefix
+	Paths    []string
+	Networks []*net.IPNet
+}
+
+func (a Allowlist) String() string {
+	networks := make([]string, 0, len(a.Networks))
+	for _, network := range a.Networks {
+		networks = append(networks, network.String())
+	}
+	return fmt.Sprintf("%s:%s", a.Group, strings.Join(networks, ","))
+}
+
+// allows reports whether ip is in one of the networks of the allowlist
+func (a Allowlist) allows(ip net.IP) bool {
+	for _, network := range a.Networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNetworks reads CIDRs, a bare address is a network of its own
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", value, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// AllowlistsFromEnv reads the networks of each group of paths from
+// <prefix>_ALLOW_<GROUP>, e.g. NODE_ALLOW_ADMIN. Groups without networks
+// stay open to every client unless the caller adds a default.
+func AllowlistsFromEnv(prefix string, groups map[string][]string) ([]Allowlist, error) {
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	var allowlists []Allowlist
+	for _, group := range names {
+		env := fmt.Sprintf("%s_ALLOW_%s", prefix, strings.ToUpper(group))
+		values := splitList(os.Getenv(env))
+		if len(values) == 0 {
+			continue
+		}
+		networks, err := ParseNetworks(values)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", env, err)
+		}
+		allowlists = append(allowlists, Allowlist{Group: group, Paths: groups[group], Networks: networks})
+	}
+	return allowlists, nil
+}
+
+// Allow refuses requests to the paths of an allowlist from clients outside
+// its networks, and logs every refusal for the audit trail. The client is the
+// peer of the connection, forwarded-for headers are not trusted. Requests
+// over unix sockets carry no address and pass, the socket's file
+// permissions guard them.
+func Allow(allowlists []Allowlist, logger *logrus.Logger, metrics *Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		for _, allowlist := range allowlists {
+			if !matchPath(allowlist.Paths, path) {
+				continue
+			}
+			ip := net.ParseIP(c.RemoteIP())
+			if ip == nil || allowlist.allows(ip) {
+				break
+			}
+			metrics.refused(allowlist.Group)
+			logger.WithFields(logrus.Fields{
+				"audit":      "allowlist",
+				"group":      allowlist.Group,
+				"client_ip":  ip.String(),
+				"method":     c.Request.Method,
+				"path":       path,
+				"request_id": c.GetString(RequestIDKey),
+			}).Warnf("Allow: refused %s from %s outside the %s allowlist", path, ip, allowlist.Group)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"message": "client address not allowed",
+				"error":   fmt.Sprintf("%s is not in the %s allowlist", ip, allowlist.Group),
+				"code":    "address_not_allowed",
+			})
+			return
+		}
+		c.Next()
+	}
+}
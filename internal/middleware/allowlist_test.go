@@ -0,0 +1,102 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"10.0.0.0/8", "192.168.1.7", "fd00::/8", "::1"})
+	require.NoError(t, err)
+	require.Len(t, networks, 4)
+	require.Equal(t, "192.168.1.7/32", networks[1].String())
+	require.Equal(t, "::1/128", networks[3].String())
+
+	_, err = ParseNetworks([]string{"10.0.0.0/33"})
+	require.ErrorContains(t, err, "10.0.0.0/33")
+	_, err = ParseNetworks([]string{"management"})
+	require.ErrorContains(t, err, "management")
+}
+
+func TestAllowlistsFromEnv(t *testing.T) {
+	groups := map[string][]string{"admin": {"/admin/*"}, "metrics": {"/metrics"}}
+	t.Setenv("TEST_ALLOW_ADMIN", "10.0.0.0/8, 192.168.1.7")
+	allowlists, err := AllowlistsFromEnv("TEST", groups)
+	require.NoError(t, err)
+	require.Len(t, allowlists, 1)
+	require.Equal(t, "admin:10.0.0.0/8,192.168.1.7/32", allowlists[0].String())
+
+	t.Setenv("TEST_ALLOW_METRICS", "10.0.0.300")
+	_, err = AllowlistsFromEnv("TEST", groups)
+	require.ErrorContains(t, err, "TEST_ALLOW_METRICS")
+}
+
+func TestAllow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	networks, err := ParseNetworks([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	config := Config{Auth: AuthNone, Allowlists: []Allowlist{{Group: "admin", Paths: []string{"/admin/*"}, Networks: networks}}}
+	logger, hook := test.NewNullLogger()
+	logger.SetOutput(io.Discard)
+	stack, err := NewStack("test", config, logger)
+	require.NoError(t, err)
+	r := stack.Engine()
+	r.GET("/admin/purge", func(c *gin.Context) { c.String(http.StatusOK, "purged") })
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+	request := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		// forwarded addresses are not trusted
+		req.Header.Set("X-Forwarded-For", "10.1.2.3")
+		return serve(r, req)
+	}
+
+	require.Equal(t, http.StatusOK, request("/admin/purge", "10.1.2.3:40000").Code)
+	require.Equal(t, http.StatusOK, request("/ping", "203.0.113.9:40000").Code)
+	// unix sockets carry no address
+	require.Equal(t, http.StatusOK, request("/admin/purge", "@").Code)
+
+	w := request("/admin/purge", "203.0.113.9:40000")
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "address_not_allowed")
+	require.Equal(t, float64(1), testutil.ToFloat64(stack.metrics.refusals.WithLabelValues("admin")))
+
+	var audited bool
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["audit"] == "allowlist" {
+			audited = true
+			require.Equal(t, "203.0.113.9", entry.Data["client_ip"])
+			require.Equal(t, "/admin/purge", entry.Data["path"])
+		}
+	}
+	require.True(t, audited)
+}
@@ -0,0 +1,159 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrincipalKey is the gin context key of the authenticated caller
+const PrincipalKey = "principal"
+
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator checks the credentials of a request and names its caller
+type Authenticator interface {
+	Authenticate(r *http.Request) (principal string, err error)
+}
+
+// NewAuthenticator returns the authenticator of the configured strategy, nil for none
+func NewAuthenticator(config Config) (Authenticator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	switch config.Auth {
+	case AuthToken:
+		return newTokenAuthenticator(config.Tokens), nil
+	case AuthMTLS:
+		return &mtlsAuthenticator{subjects: config.Subjects}, nil
+	case AuthJWT:
+		return newJWTAuthenticator(config.JWT), nil
+	}
+	return nil, nil
+}
+
+// Auth refuses requests to non public paths the authenticator doesn't accept
+func Auth(auth Authenticator, config Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auth == nil || config.isPublic(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		principal, err := auth.Authenticate(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "authentication failed",
+				"error":   err.Error(),
+				"code":    "unauthorized",
+			})
+			return
+		}
+		c.Set(PrincipalKey, principal)
+		c.Next()
+	}
+}
+
+// Principal is the caller Auth authenticated, empty for public paths and without auth
+func Principal(c *gin.Context) string {
+	return c.GetString(PrincipalKey)
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrNoCredentials
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", fmt.Errorf("expected a bearer token")
+	}
+	return token, nil
+}
+
+type tokenAuthenticator struct {
+	tokens [][]byte
+}
+
+func newTokenAuthenticator(tokens []string) *tokenAuthenticator {
+	a := &tokenAuthenticator{}
+	for _, token := range tokens {
+		a.tokens = append(a.tokens, []byte(token))
+	}
+	return a
+}
+
+// Authenticate names the caller after a hash of its token, so logs tell
+// callers apart without leaking the tokens
+func (a *tokenAuthenticator) Authenticate(r *http.Request) (string, error) {
+	given, err := bearerToken(r)
+	if err != nil {
+		return "", err
+	}
+	match := 0
+	for _, token := range a.tokens {
+		match |= subtle.ConstantTimeCompare([]byte(given), token)
+	}
+	if match != 1 {
+		return "", fmt.Errorf("invalid token")
+	}
+	hash := sha256.Sum256([]byte(given))
+	return "token:" + hex.EncodeToString(hash[:4]), nil
+}
+
+type mtlsAuthenticator struct {
+	subjects []string
+}
+
+// Authenticate accepts the client certificates the server verified against
+// the client ca, the tls handshake already did the cryptography
+func (a *mtlsAuthenticator) Authenticate(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", fmt.Errorf("no verified client certificate")
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if len(a.subjects) == 0 {
+		return cert.Subject.CommonName, nil
+	}
+
+	names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	for _, name := range names {
+		for _, subject := range a.subjects {
+			if name == subject {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("client certificate %q is not allowed", cert.Subject.CommonName)
+}
@@ -0,0 +1,255 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func get(path, token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("TEST_AUTH", "token")
+	t.Setenv("TEST_AUTH_TOKENS", "a, b")
+	t.Setenv("TEST_RATE_LIMIT", "5")
+	config, err := ConfigFromEnv("TEST", []string{"/ping"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, config.Tokens)
+	require.Equal(t, []string{"/ping"}, config.Public)
+	require.Equal(t, 5.0, config.RateLimit)
+
+	t.Setenv("TEST_AUTH_PUBLIC", "")
+	config, err = ConfigFromEnv("TEST", []string{"/ping"})
+	require.NoError(t, err)
+	require.Empty(t, config.Public)
+
+	t.Setenv("TEST_AUTH_TOKENS", "")
+	_, err = ConfigFromEnv("TEST", nil)
+	require.ErrorContains(t, err, "at least one token")
+
+	t.Setenv("TEST_AUTH", "basic")
+	_, err = ConfigFromEnv("TEST", nil)
+	require.ErrorContains(t, err, "unknown auth strategy")
+}
+
+func TestTokenAuth(t *testing.T) {
+	r := testStack(t, Config{Auth: AuthToken, Tokens: []string{"secret", "other"}, Public: []string{"/ping", "/public/*"}})
+
+	require.Equal(t, http.StatusOK, serve(r, get("/ping", "")).Code)
+	require.Equal(t, http.StatusNotFound, serve(r, get("/public/anything", "")).Code)
+	require.Equal(t, http.StatusUnauthorized, serve(r, get("/whoami", "")).Code)
+	require.Equal(t, http.StatusUnauthorized, serve(r, get("/whoami", "wrong")).Code)
+
+	w := serve(r, get("/whoami", "other"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Regexp(t, "^token:[0-9a-f]{8}$", w.Body.String())
+	require.NotEqual(t, serve(r, get("/whoami", "secret")).Body.String(), w.Body.String())
+}
+
+func testCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func TestMTLSAuth(t *testing.T) {
+	ca, caKey := testCertificate(t, "dkg ca", nil, nil)
+	client, clientKey := testCertificate(t, "operator-1", ca, caKey)
+	stranger, strangerKey := testCertificate(t, "operator-2", ca, caKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	// the stack needs certificate files, the test server brings its own
+	r := gin.New()
+	r.Use(Auth(&mtlsAuthenticator{subjects: []string{"operator-1"}}, Config{Public: []string{"/ping"}}))
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	r.GET("/whoami", func(c *gin.Context) { c.String(http.StatusOK, Principal(c)) })
+	srv := httptest.NewUnstartedServer(r)
+	srv.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	srv.StartTLS()
+	defer srv.Close()
+
+	request := func(path string, cert *x509.Certificate, key *ecdsa.PrivateKey) (int, string) {
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		if cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		return resp.StatusCode, string(body[:n])
+	}
+
+	status, _ := request("/ping", nil, nil)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = request("/whoami", nil, nil)
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = request("/whoami", stranger, strangerKey)
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, principal := request("/whoami", client, clientKey)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "operator-1", principal)
+}
+
+func signJWT(t *testing.T, alg, kid string, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestJWTAuthSecret(t *testing.T) {
+	secret := "shared secret"
+	hs256 := func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+	r := testStack(t, Config{Auth: AuthJWT, JWT: JWTConfig{Secret: secret, Audience: "dkg-node"}})
+	exp := time.Now().Add(time.Hour).Unix()
+
+	token := signJWT(t, "HS256", "", map[string]interface{}{"sub": "orchestrator", "aud": []string{"dkg-node", "other"}, "exp": exp}, hs256)
+	w := serve(r, get("/whoami", token))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "orchestrator", w.Body.String())
+
+	for name, claims := range map[string]map[string]interface{}{
+		"expired":     {"sub": "orchestrator", "aud": "dkg-node", "exp": time.Now().Add(-time.Hour).Unix()},
+		"no expiry":   {"sub": "orchestrator", "aud": "dkg-node"},
+		"not yet":     {"sub": "orchestrator", "aud": "dkg-node", "exp": exp, "nbf": time.Now().Add(time.Hour).Unix()},
+		"other aud":   {"sub": "orchestrator", "aud": "messenger", "exp": exp},
+		"missing aud": {"sub": "orchestrator", "exp": exp},
+	} {
+		token := signJWT(t, "HS256", "", claims, hs256)
+		require.Equal(t, http.StatusUnauthorized, serve(r, get("/whoami", token)).Code, name)
+	}
+
+	// alg none and a wrong secret
+	token = signJWT(t, "none", "", map[string]interface{}{"sub": "orchestrator", "aud": "dkg-node", "exp": exp}, func([]byte) []byte { return nil })
+	require.Equal(t, http.StatusUnauthorized, serve(r, get("/whoami", token)).Code)
+	secret = "guessed"
+	token = signJWT(t, "HS256", "", map[string]interface{}{"sub": "orchestrator", "aud": "dkg-node", "exp": exp}, hs256)
+	require.Equal(t, http.StatusUnauthorized, serve(r, get("/whoami", token)).Code)
+}
+
+func TestJWTAuthOIDC(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwksFetches := 0
+	mux := http.NewServeMux()
+	idp := httptest.NewServer(mux)
+	defer idp.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": idp.URL, "jwks_uri": idp.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		jwksFetches++
+		b64 := base64.RawURLEncoding.EncodeToString
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": "AAAA"},
+		}})
+	})
+
+	r := testStack(t, Config{Auth: AuthJWT, JWT: JWTConfig{Issuer: idp.URL, Audience: "dkg"}})
+	claims := map[string]interface{}{"iss": idp.URL, "sub": "ops", "aud": "dkg", "exp": time.Now().Add(time.Hour).Unix()}
+
+	rs256 := signJWT(t, "RS256", "rsa-1", claims, func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+		return signature
+	})
+	w := serve(r, get("/whoami", rs256))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, "ops", w.Body.String())
+
+	es256 := signJWT(t, "ES256", "ec-1", claims, func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		require.NoError(t, err)
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	})
+	require.Equal(t, http.StatusOK, serve(r, get("/whoami", es256)).Code)
+	require.Equal(t, 1, jwksFetches)
+
+	// an rsa key id with an ec signature, another issuer and an unknown key id
+	mixed := signJWT(t, "ES256", "rsa-1", claims, func([]byte) []byte { return make([]byte, 64) })
+	require.Equal(t, http.StatusUnauthorized, serve(r, get("/whoami", mixed)).Code)
+	claims["iss"] = "https://evil.example"
+	require.Equal(t, http.StatusUnauthorized, serve(r, get("/whoami", signJWT(t, "HS256", "", claims, func([]byte) []byte { return nil }))).Code)
+	unknown := signJWT(t, "RS256", "rsa-2", claims, func([]byte) []byte { return []byte{1} })
+	require.Equal(t, http.StatusUnauthorized, serve(r, get("/whoami", unknown)).Code)
+	require.Equal(t, 1, jwksFetches, "keys are refetched at most once a minute")
+}
@@ -0,0 +1,206 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AuthNone  = "none"
+	AuthToken = "token"
+	AuthMTLS  = "mtls"
+	AuthJWT   = "jwt"
+)
+
+// Config selects the middleware of a server
+type Config struct {
+	// Auth is the strategy requests are authenticated with: none, token, mtls or jwt
+	Auth string
+	// Tokens are the bearer tokens accepted by the token strategy
+	Tokens []string
+	// Public are the paths served without authentication, a trailing * matches a prefix
+	Public []string
+
+	// TLSCert and TLSKey make the server listen on https
+	TLSCert string
+	TLSKey  string
+	// TLSMinVersion is the oldest tls version accepted, 0 means tls 1.2
+	TLSMinVersion uint16
+	// TLSCiphers restricts the tls 1.2 cipher suites, tls 1.3 suites are not configurable
+	TLSCiphers []uint16
+	// ClientCA verifies client certificates for the mtls strategy
+	ClientCA string
+	// Subjects, when set, are the client certificate common names or SANs the mtls strategy accepts
+	Subjects []string
+
+	JWT JWTConfig
+
+	// Allowlists restrict groups of paths to client networks, the first
+	// group a path is in decides
+	Allowlists []Allowlist
+
+	// RateLimit is the number of requests per second a client IP may send, 0 turns the limit off
+	RateLimit float64
+	RateBurst int
+}
+
+// JWTConfig verifies the bearer tokens of the jwt strategy, either with a
+// shared HS256 secret or with the keys the OIDC issuer publishes
+type JWTConfig struct {
+	Issuer   string
+	Audience string
+	Secret   string
+	// JWKSURL defaults to the jwks_uri of the issuer's openid configuration
+	JWKSURL string
+	// Leeway is the clock skew allowed on exp and nbf
+	Leeway time.Duration
+}
+
+// ConfigFromEnv reads the middleware settings of a server from the
+// environment variables starting with prefix, e.g. NODE_AUTH. Public are the
+// paths left without authentication when <prefix>_AUTH_PUBLIC is not set.
+func ConfigFromEnv(prefix string, public []string) (Config, error) {
+	config := Config{
+		Auth:     strings.ToLower(os.Getenv(prefix + "_AUTH")),
+		Tokens:   splitList(os.Getenv(prefix + "_AUTH_TOKENS")),
+		Public:   public,
+		TLSCert:  os.Getenv(prefix + "_TLS_CERT"),
+		TLSKey:   os.Getenv(prefix + "_TLS_KEY"),
+		ClientCA: os.Getenv(prefix + "_TLS_CLIENT_CA"),
+		Subjects: splitList(os.Getenv(prefix + "_AUTH_SUBJECTS")),
+		JWT: JWTConfig{
+			Issuer:   os.Getenv(prefix + "_JWT_ISSUER"),
+			Audience: os.Getenv(prefix + "_JWT_AUDIENCE"),
+			Secret:   os.Getenv(prefix + "_JWT_SECRET"),
+			JWKSURL:  os.Getenv(prefix + "_JWT_JWKS_URL"),
+			Leeway:   time.Minute,
+		},
+	}
+	if config.Auth == "" {
+		config.Auth = AuthNone
+	}
+	if value, ok := os.LookupEnv(prefix + "_AUTH_PUBLIC"); ok {
+		config.Public = splitList(value)
+	}
+	if value := os.Getenv(prefix + "_TLS_MIN_VERSION"); value != "" {
+		version, err := ParseTLSVersion(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid %s_TLS_MIN_VERSION: %w", prefix, err)
+		}
+		config.TLSMinVersion = version
+	}
+	if value := os.Getenv(prefix + "_TLS_CIPHERS"); value != "" {
+		ciphers, err := ParseCipherSuites(splitList(value))
+		if err != nil {
+			return config, fmt.Errorf("invalid %s_TLS_CIPHERS: %w", prefix, err)
+		}
+		config.TLSCiphers = ciphers
+	}
+	if value := os.Getenv(prefix + "_JWT_LEEWAY"); value != "" {
+		leeway, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid %s_JWT_LEEWAY %q: %w", prefix, value, err)
+		}
+		config.JWT.Leeway = leeway
+	}
+	if value := os.Getenv(prefix + "_RATE_LIMIT"); value != "" {
+		limit, err := strconv.ParseFloat(value, 64)
+		if err != nil || limit < 0 {
+			return config, fmt.Errorf("invalid %s_RATE_LIMIT %q", prefix, value)
+		}
+		config.RateLimit = limit
+	}
+	if value := os.Getenv(prefix + "_RATE_BURST"); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil || burst <= 0 {
+			return config, fmt.Errorf("invalid %s_RATE_BURST %q", prefix, value)
+		}
+		config.RateBurst = burst
+	}
+	return config, config.Validate()
+}
+
+// Validate checks the settings the selected auth strategy needs
+func (c Config) Validate() error {
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls needs both a certificate and a key")
+	}
+	if c.TLSCert == "" && (c.TLSMinVersion != 0 || len(c.TLSCiphers) > 0) {
+		return fmt.Errorf("tls version and cipher settings need a tls certificate")
+	}
+	if c.TLSMinVersion == tls.VersionTLS13 && len(c.TLSCiphers) > 0 {
+		return fmt.Errorf("tls cipher suites only apply below tls 1.3")
+	}
+	switch c.Auth {
+	case AuthNone:
+	case AuthToken:
+		if len(c.Tokens) == 0 {
+			return fmt.Errorf("token auth needs at least one token")
+		}
+	case AuthMTLS:
+		if c.TLSCert == "" || c.ClientCA == "" {
+			return fmt.Errorf("mtls auth needs a tls certificate, key and client ca")
+		}
+	case AuthJWT:
+		if c.JWT.Secret == "" && c.JWT.Issuer == "" && c.JWT.JWKSURL == "" {
+			return fmt.Errorf("jwt auth needs a secret, an oidc issuer or a jwks url")
+		}
+	default:
+		return fmt.Errorf("unknown auth strategy %q, expected none, token, mtls or jwt", c.Auth)
+	}
+	return nil
+}
+
+// isPublic reports whether path is served without authentication
+func (c Config) isPublic(path string) bool {
+	return matchPath(c.Public, path)
+}
+
+// matchPath reports whether path is one of paths, a trailing * matches a prefix
+func matchPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,329 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval bounds how often an unknown key id makes the
+// authenticator fetch the issuer's keys again
+const jwksRefreshInterval = time.Minute
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+}
+
+// audiences reads the aud claim, a string or a list of strings
+func (c *jwtClaims) audiences() []string {
+	var single string
+	if err := json.Unmarshal(c.Audience, &single); err == nil {
+		return []string{single}
+	}
+	var list []string
+	_ = json.Unmarshal(c.Audience, &list)
+	return list
+}
+
+type jwtAuthenticator struct {
+	config JWTConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newJWTAuthenticator(config JWTConfig) *jwtAuthenticator {
+	return &jwtAuthenticator{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// Authenticate verifies a HS256, RS256 or ES256 signed bearer token and its
+// issuer, audience and validity, the caller is the token's subject
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (string, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed jwt")
+	}
+
+	header := &jwtHeader{}
+	if err := decodeSegment(parts[0], header); err != nil {
+		return "", fmt.Errorf("malformed jwt header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed jwt signature: %w", err)
+	}
+	if err := a.verify(r.Context(), header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return "", err
+	}
+
+	claims := &jwtClaims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return "", fmt.Errorf("malformed jwt claims: %w", err)
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+func (a *jwtAuthenticator) verify(ctx context.Context, header *jwtHeader, signed, signature []byte) error {
+	digest := sha256.Sum256(signed)
+	switch header.Alg {
+	case "HS256":
+		if a.config.Secret == "" {
+			return fmt.Errorf("jwt algorithm HS256 is not accepted")
+		}
+		mac := hmac.New(sha256.New, []byte(a.config.Secret))
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("invalid jwt signature")
+		}
+		return nil
+	case "RS256":
+		key, err := a.key(ctx, header.Kid)
+		if err != nil {
+			return err
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt key %q is not an rsa key", header.Kid)
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("invalid jwt signature")
+		}
+		return nil
+	case "ES256":
+		key, err := a.key(ctx, header.Kid)
+		if err != nil {
+			return err
+		}
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("jwt key %q is not a P-256 key", header.Kid)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return fmt.Errorf("invalid jwt signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("jwt algorithm %q is not accepted", header.Alg)
+}
+
+func (a *jwtAuthenticator) checkClaims(claims *jwtClaims) error {
+	now := a.now()
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("jwt has no expiry")
+	}
+	if now.After(time.Unix(*claims.ExpiresAt, 0).Add(a.config.Leeway)) {
+		return fmt.Errorf("jwt expired")
+	}
+	if claims.NotBefore != nil && now.Add(a.config.Leeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return fmt.Errorf("jwt not valid yet")
+	}
+	if a.config.Issuer != "" && claims.Issuer != a.config.Issuer {
+		return fmt.Errorf("jwt issuer %q is not accepted", claims.Issuer)
+	}
+	if a.config.Audience != "" {
+		for _, audience := range claims.audiences() {
+			if audience == a.config.Audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("jwt is not meant for audience %q", a.config.Audience)
+	}
+	return nil
+}
+
+// key returns the issuer's public key with the key id, fetching the keys
+// again when it's unknown
+func (a *jwtAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if key, ok := a.lookup(kid); ok {
+		return key, nil
+	}
+	if a.keys != nil && a.now().Sub(a.fetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown jwt key %q", kid)
+	}
+	keys, err := a.fetchKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwt keys: %w", err)
+	}
+	a.keys = keys
+	a.fetched = a.now()
+	if key, ok := a.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown jwt key %q", kid)
+}
+
+// lookup finds the key by id, a token without key id matches the only key
+func (a *jwtAuthenticator) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, true
+		}
+	}
+	key, ok := a.keys[kid]
+	return key, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (a *jwtAuthenticator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	jwksURL := a.config.JWKSURL
+	if jwksURL == "" {
+		discovery := &struct {
+			JWKSURI string `json:"jwks_uri"`
+		}{}
+		if err := a.getJSON(ctx, strings.TrimSuffix(a.config.Issuer, "/")+"/.well-known/openid-configuration", discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, fmt.Errorf("openid configuration of %s has no jwks_uri", a.config.Issuer)
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	set := &struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := a.getJSON(ctx, jwksURL, set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// keys of other types don't stop the ones we can use
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (a *jwtAuthenticator) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on P-256")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,133 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// UnixPrefix marks a listen address as a unix domain socket, e.g. unix:/run/rockx-dkg/node.sock
+const UnixPrefix = "unix:"
+
+// ListenAddrs splits a comma separated list of listen addresses
+func ListenAddrs(value string) []string {
+	return splitList(value)
+}
+
+// UnixPath returns the socket path of a unix: listen address
+func UnixPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, UnixPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, UnixPrefix), true
+}
+
+// Listen opens a tcp listener on addr or a unix domain socket for a unix:
+// address. The socket is readable and writable by its owner and group only,
+// a sidecar reaches it through a shared group.
+func Listen(addr string) (net.Listener, error) {
+	path, ok := UnixPath(addr)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("Listen: unix address without a path")
+	}
+	// a socket left behind by a previous run refuses the bind, anything else at the path is kept
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("Listen: %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("Listen: failed to remove stale socket %s: %w", path, err)
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("Listen: %w", err)
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("Listen: %w", err)
+	}
+	return l, nil
+}
+
+// IsLocal tells if a listen address is only reachable from this host: a
+// loopback address, localhost or a unix domain socket
+func IsLocal(addr string) bool {
+	if _, ok := UnixPath(addr); ok {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion reads a minimum tls version, 1.2 or 1.3
+func ParseTLSVersion(value string) (uint16, error) {
+	version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(value), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unknown tls version %q, expected 1.2 or 1.3", value)
+	}
+	return version, nil
+}
+
+// ParseCipherSuites reads cipher suite names as crypto/tls spells them, e.g.
+// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. Suites go lists as insecure are refused.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+	var ids []uint16
+	for _, name := range names {
+		id, ok := secure[name]
+		if !ok {
+			if insecure[name] {
+				return nil, fmt.Errorf("cipher suite %s is insecure", name)
+			}
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
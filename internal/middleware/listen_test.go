@@ -0,0 +1,163 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSSettings(t *testing.T) {
+	version, err := ParseTLSVersion("1.3")
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), version)
+	_, err = ParseTLSVersion("1.0")
+	require.Error(t, err)
+
+	ciphers, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	require.NoError(t, err)
+	require.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, ciphers)
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	require.ErrorContains(t, err, "insecure")
+
+	t.Setenv("TEST_TLS_MIN_VERSION", "1.3")
+	_, err = ConfigFromEnv("TEST", nil)
+	require.ErrorContains(t, err, "need a tls certificate")
+
+	t.Setenv("TEST_TLS_CERT", "tls.crt")
+	t.Setenv("TEST_TLS_KEY", "tls.key")
+	config, err := ConfigFromEnv("TEST", nil)
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), config.TLSMinVersion)
+
+	t.Setenv("TEST_TLS_CIPHERS", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384")
+	_, err = ConfigFromEnv("TEST", nil)
+	require.ErrorContains(t, err, "below tls 1.3")
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.sock")
+	l, err := Listen(UnixPrefix + path)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0660), info.Mode().Perm())
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+
+	// the stale socket of a previous run is replaced
+	l, err = Listen(UnixPrefix + path)
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	file := filepath.Join(t.TempDir(), "node.db")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	_, err = Listen(UnixPrefix + file)
+	require.ErrorContains(t, err, "not a socket")
+}
+
+func TestIsLocal(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:8000", "[::1]:8000", "localhost:8000", UnixPrefix + "/run/dkg.sock"} {
+		require.True(t, IsLocal(addr), addr)
+	}
+	for _, addr := range []string{"0.0.0.0:8000", ":8000", "[::]:8000", "10.0.0.5:8000", "example.com:8000", "8000"} {
+		require.False(t, IsLocal(addr), addr)
+	}
+}
+
+func TestRunAddresses(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	stack, err := NewStack("test", Config{Auth: AuthNone}, logger)
+	require.NoError(t, err)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("pong")) })
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "node.db")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	require.Error(t, stack.Run(handler, UnixPrefix+filepath.Join(dir, "a.sock"), UnixPrefix+file))
+	require.Error(t, stack.Run(handler))
+
+	sockets := []string{filepath.Join(dir, "a.sock"), filepath.Join(dir, "b.sock")}
+	go stack.Run(handler, UnixPrefix+sockets[0], UnixPrefix+sockets[1])
+
+	for _, socket := range sockets {
+		socket := socket
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}}
+		require.Eventually(t, func() bool {
+			resp, err := client.Get("http://node/ping")
+			if err != nil {
+				return false
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			return string(body) == "pong"
+		}, 2*time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestAdoptAndShutdown(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	stack, err := NewStack("test", Config{Auth: AuthNone}, logger)
+	require.NoError(t, err)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("pong")) })
+
+	passed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dropped, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := passed.Addr().String()
+	listeners, err := stack.Adopt(map[string]net.Listener{addr: passed, "127.0.0.1:1": dropped}, addr)
+	require.NoError(t, err)
+	require.Equal(t, []net.Listener{passed}, listeners)
+	_, err = dropped.Accept()
+	require.Error(t, err, "a passed listener of an address that isn't listed is closed")
+
+	served := make(chan error, 1)
+	go func() { served <- stack.Serve(handler, listeners) }()
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + "/ping")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, stack.Shutdown(context.Background()))
+	require.ErrorIs(t, <-served, http.ErrServerClosed)
+}
@@ -0,0 +1,204 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is the gin context key of the request ID
+	RequestIDKey = "request_id"
+)
+
+// RequestID takes the request ID of the caller, or makes one up, and returns
+// it in the response header
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 64 {
+		return false
+	}
+	for _, r := range requestID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// HexParams are the path parameters holding request ids and validator keys
+var HexParams = []string{"request_id", "vk", "validator_pk"}
+
+// CanonicalHexParams rewrites the hex path parameters to the bare lowercase
+// form lookups are keyed by, so 0x-prefixed or uppercase ids find the same
+// ceremony or share. Values that aren't hex are left to the handlers.
+func CanonicalHexParams(names ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for i, param := range c.Params {
+			for _, name := range names {
+				if param.Key != name {
+					continue
+				}
+				if b, err := hexenc.Parse(param.Value); err == nil && len(b) > 0 {
+					c.Params[i].Value = hexenc.Key(b)
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// Logger logs every request with its outcome
+func Logger(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		raw := c.Request.URL.RawQuery
+
+		// Process request
+		c.Next()
+
+		statusCode := c.Writer.Status()
+		entry := logger.WithFields(logrus.Fields{
+			"status_code": statusCode,
+			"latency":     time.Since(start),
+			"client_ip":   c.ClientIP(),
+			"method":      c.Request.Method,
+			"path":        path,
+			"query":       raw,
+			"error":       c.Errors.ByType(gin.ErrorTypePrivate).String(),
+			"request_id":  c.GetString(RequestIDKey),
+			"principal":   Principal(c),
+		})
+
+		switch {
+		case statusCode >= 500:
+			entry.Error()
+		case statusCode >= 400:
+			entry.Warn()
+		default:
+			entry.Info()
+		}
+	}
+}
+
+// Recovery turns a panicking handler into a 500
+func Recovery(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				logger.WithFields(logrus.Fields{
+					"request_id": c.GetString(RequestIDKey),
+					"path":       c.Request.URL.Path,
+				}).Errorf("Recovery: handler panicked: %v\n%s", recovered, debug.Stack())
+				if c.Writer.Written() {
+					c.Abort()
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"message": "internal server error",
+					"error":   fmt.Sprint(recovered),
+				})
+			}
+		}()
+		c.Next()
+	}
+}
+
+// Metrics counts the requests of a server and how long they took
+type Metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	// refusals counts the requests Allow refused by group
+	refusals *prometheus.CounterVec
+}
+
+// NewMetrics names the metrics after the service, e.g. dkg_node_http_requests_total
+func NewMetrics(service string) *Metrics {
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: fmt.Sprintf("dkg_%s_http_requests_total", service),
+			Help: "HTTP requests by route and status code",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    fmt.Sprintf("dkg_%s_http_request_duration_seconds", service),
+			Help:    "Time taken to serve HTTP requests by route",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		refusals: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: fmt.Sprintf("dkg_%s_http_allowlist_refusals_total", service),
+			Help: "HTTP requests refused for a client outside the allowlist by path group",
+		}, []string{"group"}),
+	}
+}
+
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// the route pattern keeps request IDs and keys out of the labels
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		m.duration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (m *Metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.requests, m.duration, m.refusals}
+}
+
+func (m *Metrics) refused(group string) {
+	m.refusals.WithLabelValues(group).Inc()
+}
@@ -0,0 +1,164 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func testStack(t *testing.T, config Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	stack, err := NewStack("test", config, logger)
+	require.NoError(t, err)
+
+	r := stack.Engine()
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	r.GET("/whoami", func(c *gin.Context) { c.String(http.StatusOK, Principal(c)) })
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+	return r
+}
+
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequestID(t *testing.T) {
+	r := testStack(t, Config{Auth: AuthNone})
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	require.Len(t, w.Header().Get(RequestIDHeader), 32)
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set(RequestIDHeader, "keygen-42")
+	w = serve(r, req)
+	require.Equal(t, "keygen-42", w.Header().Get(RequestIDHeader))
+
+	req.Header.Set(RequestIDHeader, "bad id\nInjected: header")
+	w = serve(r, req)
+	require.NotContains(t, w.Header().Get(RequestIDHeader), "Injected")
+}
+
+func TestRecovery(t *testing.T) {
+	r := testStack(t, Config{Auth: AuthNone})
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, w.Body.String(), "boom")
+
+	// the server keeps serving
+	w = serve(r, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metrics := NewMetrics("test")
+	r := gin.New()
+	r.Use(metrics.Handler())
+	r.GET("/ceremonies/:request_id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+
+	serve(r, httptest.NewRequest(http.MethodGet, "/ceremonies/a", nil))
+	serve(r, httptest.NewRequest(http.MethodGet, "/ceremonies/b", nil))
+	serve(r, httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.requests.WithLabelValues(http.MethodGet, "/ceremonies/:request_id", "404")))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues(http.MethodGet, "unmatched", "404")))
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("10.0.0.1")
+		require.True(t, ok)
+	}
+	ok, wait := limiter.Allow("10.0.0.1")
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, wait)
+
+	// other clients have their own bucket
+	ok, _ = limiter.Allow("10.0.0.2")
+	require.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.Allow("10.0.0.1")
+	require.True(t, ok)
+	ok, _ = limiter.Allow("10.0.0.1")
+	require.False(t, ok)
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	r := testStack(t, Config{Auth: AuthNone, RateLimit: 1, RateBurst: 1})
+	require.Equal(t, http.StatusOK, serve(r, httptest.NewRequest(http.MethodGet, "/ping", nil)).Code)
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+}
+
+func TestTokenTransport(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &TokenTransport{
+		Tokens:  map[string]string{"messenger.example:3000": "m"},
+		Default: "n",
+	}}
+	_, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Bearer n"}, got)
+
+	client.Transport.(*TokenTransport).Tokens[srv.Listener.Addr().String()] = "m"
+	_, err = client.Get(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, "Bearer m", got[1])
+}
+
+func TestCanonicalHexParams(t *testing.T) {
+	r := testStack(t, Config{Auth: AuthNone})
+	r.GET("/ceremonies/:request_id", func(c *gin.Context) { c.String(http.StatusOK, c.Param("request_id")) })
+
+	for path, want := range map[string]string{
+		"/ceremonies/0x9A45C1F30A9896C5263508C2A132EBF7FC7E3C37AB86C74B": "9a45c1f30a9896c5263508c2a132ebf7fc7e3c37ab86c74b",
+		"/ceremonies/9a45c1f30a9896c5263508c2a132ebf7fc7e3c37ab86c74b":   "9a45c1f30a9896c5263508c2a132ebf7fc7e3c37ab86c74b",
+		"/ceremonies/not-hex": "not-hex",
+	} {
+		w := serve(r, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, want, w.Body.String(), path)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Stack is the middleware every server of the project runs: request IDs,
+// logging, metrics, panic recovery, allowlists, rate limiting and authentication
+type Stack struct {
+	config  Config
+	logger  *logrus.Logger
+	metrics *Metrics
+	limiter *RateLimiter
+	auth    Authenticator
+	tls     *tls.Config
+
+	mu     sync.Mutex
+	server *http.Server
+}
+
+func NewStack(service string, config Config, logger *logrus.Logger) (*Stack, error) {
+	auth, err := NewAuthenticator(config)
+	if err != nil {
+		return nil, fmt.Errorf("NewStack: %w", err)
+	}
+	s := &Stack{
+		config:  config,
+		logger:  logger,
+		metrics: NewMetrics(service),
+		auth:    auth,
+	}
+	if config.RateLimit > 0 {
+		s.limiter = NewRateLimiter(config.RateLimit, config.RateBurst)
+	}
+	if config.TLSCert != "" {
+		s.tls = &tls.Config{MinVersion: tls.VersionTLS12, CipherSuites: config.TLSCiphers}
+		if config.TLSMinVersion != 0 {
+			s.tls.MinVersion = config.TLSMinVersion
+		}
+	}
+	if config.ClientCA != "" {
+		if s.tls == nil {
+			return nil, fmt.Errorf("NewStack: a client ca needs a tls certificate")
+		}
+		pem, err := os.ReadFile(config.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("NewStack: failed to read client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("NewStack: no certificates in client ca %s", config.ClientCA)
+		}
+		// public paths stay reachable without a certificate, Auth refuses the others
+		s.tls.ClientCAs = pool
+		s.tls.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return s, nil
+}
+
+// Handlers are the middleware in the order they have to run
+func (s *Stack) Handlers() []gin.HandlerFunc {
+	handlers := []gin.HandlerFunc{
+		RequestID(),
+		Logger(s.logger),
+		s.metrics.Handler(),
+		Recovery(s.logger),
+	}
+	if len(s.config.Allowlists) > 0 {
+		handlers = append(handlers, Allow(s.config.Allowlists, s.logger, s.metrics))
+	}
+	if s.limiter != nil {
+		handlers = append(handlers, s.limiter.Handler())
+	}
+	return append(handlers, Auth(s.auth, s.config), CanonicalHexParams(HexParams...))
+}
+
+// Engine is a gin engine running the stack
+func (s *Stack) Engine() *gin.Engine {
+	r := gin.New()
+	r.Use(s.Handlers()...)
+	return r
+}
+
+func (s *Stack) Collectors() []prometheus.Collector {
+	return s.metrics.Collectors()
+}
+
+// Run serves the handler on every address, on https when the stack has a tls
+// certificate. Unix sockets (unix:/path) serve plain http, the socket's file
+// permissions guard them. Run returns when the first listener fails.
+func (s *Stack) Run(handler http.Handler, addrs ...string) error {
+	listeners, err := s.Listen(addrs...)
+	if err != nil {
+		return fmt.Errorf("Run: %w", err)
+	}
+	return s.Serve(handler, listeners)
+}
+
+// Listen binds every address and loads the tls certificate, so a process can
+// give up the privileges it needed for both before it serves
+func (s *Stack) Listen(addrs ...string) ([]net.Listener, error) {
+	return s.Adopt(nil, addrs...)
+}
+
+// Adopt is Listen taking the listeners another process passed for some of
+// the addresses, the others are bound. Passed listeners of addresses that
+// aren't listed are closed.
+func (s *Stack) Adopt(inherited map[string]net.Listener, addrs ...string) ([]net.Listener, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("Listen: no listen address")
+	}
+	if s.tls != nil && len(s.tls.Certificates) == 0 {
+		cert, err := tls.LoadX509KeyPair(s.config.TLSCert, s.config.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("Listen: failed to load tls certificate: %w", err)
+		}
+		s.tls.Certificates = []tls.Certificate{cert}
+	}
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		if l, ok := inherited[addr]; ok {
+			listeners = append(listeners, l)
+			continue
+		}
+		l, err := Listen(addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("Listen: %w", err)
+		}
+		listeners = append(listeners, l)
+	}
+	listed := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		listed[addr] = true
+	}
+	for addr, l := range inherited {
+		if !listed[addr] {
+			l.Close()
+		}
+	}
+	return listeners, nil
+}
+
+// Serve serves the handler on listeners opened by Listen and returns when the
+// first of them fails
+func (s *Stack) Serve(handler http.Handler, listeners []net.Listener) error {
+	if len(listeners) == 0 {
+		return fmt.Errorf("Serve: no listener")
+	}
+	server := &http.Server{Handler: handler, TLSConfig: s.tls}
+	s.mu.Lock()
+	s.server = server
+	s.mu.Unlock()
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			addr := l.Addr().String()
+			if l.Addr().Network() == "unix" || s.tls == nil {
+				s.logger.Infof("Serve: listening on http://%s with %s auth", addr, s.config.Auth)
+				errs <- server.Serve(l)
+				return
+			}
+			s.logger.Infof("Serve: listening on https://%s with %s auth", addr, s.config.Auth)
+			errs <- server.ServeTLS(l, "", "")
+		}(l)
+	}
+	err := <-errs
+	server.Close()
+	return err
+}
+
+// Shutdown stops serving and waits for the requests in progress, Serve
+// returns http.ErrServerClosed
+func (s *Stack) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.server
+	s.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
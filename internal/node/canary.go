@@ -0,0 +1,99 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/sirupsen/logrus"
+)
+
+// CanarySweeper marks the shares of canary keygens when they complete and
+// deletes them once they expire
+type CanarySweeper struct {
+	Interval time.Duration
+
+	storage *storage.Storage
+	logger  *logrus.Logger
+	now     func() time.Time
+}
+
+func NewCanarySweeper(s *storage.Storage, logger *logrus.Logger) *CanarySweeper {
+	return &CanarySweeper{Interval: time.Minute, storage: s, logger: logger, now: time.Now}
+}
+
+// Observe is a ceremony.Listener
+func (s *CanarySweeper) Observe(c *ceremony.Ceremony, e *ceremony.Event) {
+	if e.Type != ceremony.EventCompleted || e.ValidatorPK == "" || !c.IsCanary() {
+		return
+	}
+	canary := &storage.CanaryShare{ValidatorPK: e.ValidatorPK, RequestID: c.RequestID, ExpiresAt: c.Params.Canary.ExpiresAt}
+	if err := s.storage.SaveCanaryShare(canary); err != nil {
+		s.logger.Errorf("CanarySweeper: failed to mark share of canary request %s: %v", c.RequestID, err)
+		return
+	}
+	s.logger.Infof("CanarySweeper: canary request %s completed, share of %s is deleted at %s", c.RequestID, e.ValidatorPK, time.Unix(canary.ExpiresAt, 0).UTC())
+}
+
+// Run deletes expired canary shares every interval until done is closed
+func (s *CanarySweeper) Run(done <-chan struct{}) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		s.Sweep()
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes the canary shares that expired, it returns how many
+func (s *CanarySweeper) Sweep() int {
+	canaries, err := s.storage.ListCanaryShares()
+	if err != nil {
+		s.logger.Errorf("Sweep: failed to list canary shares: %v", err)
+		return 0
+	}
+	deleted := 0
+	for _, canary := range canaries {
+		if !(&ceremony.Canary{ExpiresAt: canary.ExpiresAt}).Expired(s.now()) {
+			continue
+		}
+		pk, err := hexenc.ParseValidatorPK(canary.ValidatorPK)
+		if err != nil {
+			s.logger.Errorf("Sweep: invalid validator pk of canary request %s: %v", canary.RequestID, err)
+			continue
+		}
+		if err := s.storage.DeleteCanaryShare(pk); err != nil {
+			s.logger.Errorf("Sweep: failed to delete share of canary request %s: %v", canary.RequestID, err)
+			continue
+		}
+		s.logger.Infof("Sweep: deleted expired share of canary request %s", canary.RequestID)
+		deleted++
+	}
+	return deleted
+}
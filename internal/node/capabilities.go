@@ -0,0 +1,64 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/cryptosuite"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/gin-gonic/gin"
+)
+
+// Capabilities of this node: frost keygen and resharing, keysign and
+// observing, for committees within its limits
+func Capabilities(limits ceremony.Limits, minProtocolVersion uint32) *messengerclient.Capabilities {
+	if minProtocolVersion < ceremony.ProtocolV1 {
+		minProtocolVersion = ceremony.ProtocolV1
+	}
+	return &messengerclient.Capabilities{
+		Protocols:          []string{messengerclient.ProtocolFROST},
+		ProtocolVersion:    ceremony.ProtocolVersion,
+		MinProtocolVersion: minProtocolVersion,
+		MaxCommittee:       limits.OrDefault().MaxOperators,
+		Resharing:          true,
+		Keysign:            true,
+		Observer:           true,
+		Options:            ceremony.SupportedOptions,
+		Suites:             cryptosuite.IDs(),
+	}
+}
+
+// WithCapabilities advertises the capabilities of the node in its ack of a
+// start message
+func (h *ApiHandler) WithCapabilities(capabilities *messengerclient.Capabilities) *ApiHandler {
+	h.capabilities = capabilities
+	return h
+}
+
+// HandleCapabilities advertises the capabilities of the node to initiators
+func (h *ApiHandler) HandleCapabilities() func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, h.capabilities)
+	}
+}
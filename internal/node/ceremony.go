@@ -0,0 +1,449 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ObservedNetwork records the messages this node sends to the dkg network as
+// ceremony events before handing them to the underlying network
+type ObservedNetwork struct {
+	network     dkg.Network
+	tracker     *ceremony.Tracker
+	cache       *MessageCache
+	transcripts *TranscriptRecorder
+	outputs     *OutputRecorder
+	outbox      *Outbox
+	logger      *logrus.Logger
+
+	// operatorID and sk sign the version claim recorded with an output
+	operatorID types.OperatorID
+	sk         *rsa.PrivateKey
+}
+
+func NewObservedNetwork(network dkg.Network, tracker *ceremony.Tracker, cache *MessageCache, transcripts *TranscriptRecorder, logger *logrus.Logger) *ObservedNetwork {
+	return &ObservedNetwork{network: network, tracker: tracker, cache: cache, transcripts: transcripts, logger: logger}
+}
+
+// WithCommitteeOutputs stores the output this node broadcasts with the ones
+// of its peers
+func (n *ObservedNetwork) WithCommitteeOutputs(outputs *OutputRecorder) *ObservedNetwork {
+	n.outputs = outputs
+	return n
+}
+
+// WithOutbox publishes the messages through the outbox, which spools those
+// the messenger refuses for a retry
+func (n *ObservedNetwork) WithOutbox(outbox *Outbox) *ObservedNetwork {
+	n.outbox = outbox
+	return n
+}
+
+// WithVersionClaims records the output of a keygen or resharing with the
+// version claim of the operator, signed with its operator key
+func (n *ObservedNetwork) WithVersionClaims(operatorID types.OperatorID, sk *rsa.PrivateKey) *ObservedNetwork {
+	n.operatorID = operatorID
+	n.sk = sk
+	return n
+}
+
+// versionClaim signs the claim of this node for the output of a ceremony, nil
+// without an operator key
+func (n *ObservedNetwork) versionClaim(requestID string) *ceremony.VersionClaim {
+	if n.sk == nil {
+		return nil
+	}
+	minVersion := ceremony.ProtocolV1
+	if cer, err := n.tracker.Get(requestID); err == nil {
+		minVersion = cer.MinProtocolVersion()
+	}
+	claim, err := ceremony.SignVersionClaim(n.sk, n.operatorID, requestID, minVersion)
+	if err != nil {
+		n.logger.Errorf("versionClaim: request %s: %v", requestID, err)
+		return nil
+	}
+	return claim
+}
+
+func (n *ObservedNetwork) StreamDKGBlame(blame *dkg.BlameOutput) error {
+	if err := n.network.StreamDKGBlame(blame); err != nil {
+		return err
+	}
+	n.recordBlame(blame)
+	return nil
+}
+
+// recordBlame records the blame of a ceremony, streamed by this node or taken
+// from the result on the messenger
+func (n *ObservedNetwork) recordBlame(blame *dkg.BlameOutput) {
+	if blame.BlameMessage == nil || blame.BlameMessage.Message == nil {
+		return
+	}
+
+	requestID := hex.EncodeToString(blame.BlameMessage.Message.Identifier[:])
+	recordEvent(n.tracker, n.logger, requestID, ceremony.EventBlamed, func(e *ceremony.Event) {
+		protocolMsg := &frost.ProtocolMsg{}
+		if err := protocolMsg.Decode(blame.BlameMessage.Message.Data); err != nil || protocolMsg.BlameMessage == nil {
+			return
+		}
+		e.Operator = types.OperatorID(protocolMsg.BlameMessage.TargetOperatorID)
+		e.Details = protocolMsg.BlameMessage.Type.ToString()
+		e.Cause = ceremony.BlameMessageCause(protocolMsg.BlameMessage)
+	})
+}
+
+func (n *ObservedNetwork) StreamDKGOutput(output map[types.OperatorID]*dkg.SignedOutput) error {
+	if err := n.network.StreamDKGOutput(output); err != nil {
+		return err
+	}
+	n.recordOutput(output)
+	return nil
+}
+
+// recordOutput completes a ceremony with the outputs of the committee,
+// streamed by this node or taken from the result on the messenger
+func (n *ObservedNetwork) recordOutput(output map[types.OperatorID]*dkg.SignedOutput) {
+	var requestID, validatorPK string
+	for _, o := range output {
+		if o.Data != nil {
+			requestID = hex.EncodeToString(o.Data.RequestID[:])
+			validatorPK = hex.EncodeToString(o.Data.ValidatorPubKey)
+		} else if o.KeySignData != nil {
+			requestID = hex.EncodeToString(o.KeySignData.RequestID[:])
+		}
+	}
+	if requestID != "" {
+		var claim *ceremony.VersionClaim
+		if validatorPK != "" {
+			claim = n.versionClaim(requestID)
+		}
+		recordEvent(n.tracker, n.logger, requestID, ceremony.EventCompleted, func(e *ceremony.Event) {
+			e.ValidatorPK = validatorPK
+			e.VersionClaim = claim
+		})
+	}
+}
+
+func (n *ObservedNetwork) BroadcastDKGMessage(msg *dkg.SignedMessage) error {
+	publish := n.network.BroadcastDKGMessage
+	if n.outbox != nil {
+		publish = n.outbox.Publish
+	}
+	if err := publish(msg); err != nil {
+		return err
+	}
+
+	requestID := hex.EncodeToString(msg.Message.Identifier[:])
+	if err := n.cache.Add(requestID, msg); err != nil {
+		n.logger.Warnf("BroadcastDKGMessage: failed to cache message for request %s: %v", requestID, err)
+	}
+	n.transcripts.Add(msg)
+	n.outputs.Add(msg)
+
+	switch msg.Message.MsgType {
+	case dkg.ProtocolMsgType:
+		switch protocolRound(msg.Message.Data) {
+		case common.Round1:
+			recordEvent(n.tracker, n.logger, requestID, ceremony.EventRound1, nil)
+		case common.Round2:
+			recordEvent(n.tracker, n.logger, requestID, ceremony.EventRound2, nil)
+		case common.Timeout:
+			recordEvent(n.tracker, n.logger, requestID, ceremony.EventAborted, func(e *ceremony.Event) {
+				e.Details = "round timeout"
+				e.Cause = ceremony.CauseTimeout
+			})
+		}
+	case dkg.DepositDataMsgType, dkg.OutputMsgType:
+		// keygen broadcasts deposit data and then its output, only the first one moves the state
+		recordEvent(n.tracker, n.logger, requestID, ceremony.EventOutputPending, func(e *ceremony.Event) {
+			e.Round = msgTypeName(msg.Message.MsgType)
+		})
+	}
+	return nil
+}
+
+// observeStart records the start of a ceremony, it returns the function to call
+// with the result of processing the start message
+func (h *ApiHandler) observeStart(signedMsg *dkg.SignedMessage, timeouts *ceremony.PhaseTimeouts, canary *ceremony.Canary, minVersion uint32, claim *ceremony.VersionClaim, options ceremony.Options, manifestHash string) func(error) {
+	requestID := hex.EncodeToString(signedMsg.Message.Identifier[:])
+	if h.tracker.Exists(requestID) {
+		return func(error) {}
+	}
+
+	params, err := StartParams(signedMsg.Message)
+	if err != nil {
+		h.logger.Warnf("observeStart: failed to decode ceremony params for request %s: %v", requestID, err)
+		return func(error) {}
+	}
+	params.Timeouts = timeouts
+	params.Canary = canary
+	params.MinProtocolVersion = minVersion
+	params.VersionClaim = claim
+	params.Options = options
+	params.ManifestHash = manifestHash
+	recordEvent(h.tracker, h.logger, requestID, ceremony.EventCreated, func(e *ceremony.Event) {
+		e.Operator = signedMsg.Signer
+		e.Params = params
+	})
+	// the dkg node broadcasts its first messages while processing the start message
+	if options.Get(ceremony.OptionTranscript) != "off" {
+		h.transcripts.Start(signedMsg)
+	}
+
+	return func(err error) {
+		if err != nil {
+			h.transcripts.Drop(requestID)
+			recordEvent(h.tracker, h.logger, requestID, ceremony.EventAborted, func(e *ceremony.Event) {
+				e.Details = err.Error()
+			})
+			return
+		}
+		recordEvent(h.tracker, h.logger, requestID, ceremony.EventInitialized, nil)
+	}
+}
+
+// checkRequestID refuses a start message for a request ID this node recorded
+// another ceremony under, the same start message delivered again passes
+func (h *ApiHandler) checkRequestID(signedMsg *dkg.SignedMessage) error {
+	requestID := hex.EncodeToString(signedMsg.Message.Identifier[:])
+	cer, err := h.tracker.Get(requestID)
+	if errors.Is(err, ceremony.ErrCeremonyNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	params, err := StartParams(signedMsg.Message)
+	if err != nil {
+		return err
+	}
+	if cer.Params == nil || len(cer.Events) == 0 {
+		return fmt.Errorf("request id %s is taken by another ceremony", requestID)
+	}
+	if initiator := cer.Events[0].Operator; initiator != signedMsg.Signer || !cer.Params.SameStart(params) {
+		return fmt.Errorf("request id %s is taken by a %s started by operator %d", requestID, cer.Params.Kind, initiator)
+	}
+	return nil
+}
+
+// observeMessage records a message received from a peer, it returns the function
+// to call with the result of processing the message
+func (h *ApiHandler) observeMessage(signedMsg *dkg.SignedMessage) func(error) {
+	requestID := hex.EncodeToString(signedMsg.Message.Identifier[:])
+	round := messageRound(signedMsg.Message)
+
+	recordEvent(h.tracker, h.logger, requestID, ceremony.EventMessageReceived, func(e *ceremony.Event) {
+		e.Operator = signedMsg.Signer
+		e.Round = round
+	})
+
+	return func(err error) {
+		if err == nil {
+			return
+		}
+		recordEvent(h.tracker, h.logger, requestID, ceremony.EventMessageRejected, func(e *ceremony.Event) {
+			e.Operator = signedMsg.Signer
+			e.Round = round
+			e.Details = err.Error()
+		})
+	}
+}
+
+func (h *ApiHandler) HandleGetCeremony() func(*gin.Context) {
+	return func(c *gin.Context) {
+		cer, err := h.tracker.Get(c.Param("request_id"))
+		if errors.Is(err, ceremony.ErrCeremonyNotFound) {
+			h.respondError(c, http.StatusNotFound, "ceremony not found", err)
+			return
+		} else if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load ceremony", err)
+			return
+		}
+		c.JSON(http.StatusOK, cer)
+	}
+}
+
+// HandleAbortCeremony marks a ceremony aborted on request of the operator that
+// started it, messages still arriving for it are rejected by the state machine
+func (h *ApiHandler) HandleAbortCeremony() func(*gin.Context) {
+	return func(c *gin.Context) {
+		requestID := c.Param("request_id")
+		cer, err := h.tracker.Record(requestID, ceremony.EventAborted, func(e *ceremony.Event) {
+			e.Details = "cancelled by orchestrator"
+			e.Cause = ceremony.CauseCancelled
+		})
+		var illegal *ceremony.ErrIllegalTransition
+		if errors.As(err, &illegal) {
+			h.respondError(c, http.StatusConflict, "ceremony can't be aborted in its current state", err)
+			return
+		} else if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to abort ceremony", err)
+			return
+		}
+		h.logger.Infof("HandleAbortCeremony: ceremony %s aborted", requestID)
+		c.JSON(http.StatusOK, cer)
+	}
+}
+
+// recordEvent records a ceremony event, failures are logged and never interrupt the dkg flow
+func recordEvent(tracker *ceremony.Tracker, logger *logrus.Logger, requestID string, eventType ceremony.EventType, fill func(*ceremony.Event)) {
+	_, err := tracker.Record(requestID, eventType, fill)
+	var illegal *ceremony.ErrIllegalTransition
+	if errors.As(err, &illegal) {
+		logger.Debugf("recordEvent: request %s: %v", requestID, err)
+	} else if err != nil {
+		logger.Errorf("recordEvent: failed to record %s event for request %s: %v", eventType, requestID, err)
+	}
+}
+
+// StartParams decodes the ceremony parameters of a start message
+func StartParams(msg *dkg.Message) (*ceremony.Params, error) {
+	switch msg.MsgType {
+	case dkg.InitMsgType:
+		init := &dkg.Init{}
+		if err := init.Decode(msg.Data); err != nil {
+			return nil, err
+		}
+		return &ceremony.Params{
+			Kind:                  ceremony.KindKeygen,
+			Operators:             init.OperatorIDs,
+			Threshold:             uint64(init.Threshold),
+			WithdrawalCredentials: hex.EncodeToString(init.WithdrawalCredentials),
+			ForkVersion:           hex.EncodeToString(init.Fork[:]),
+		}, nil
+	case dkg.ReshareMsgType:
+		reshare := &dkg.Reshare{}
+		if err := reshare.Decode(msg.Data); err != nil {
+			return nil, err
+		}
+		return &ceremony.Params{
+			Kind:         ceremony.KindReshare,
+			Operators:    reshare.OperatorIDs,
+			OldOperators: reshare.OldOperatorIDs,
+			Threshold:    uint64(reshare.Threshold),
+			ValidatorPK:  hex.EncodeToString(reshare.ValidatorPK),
+		}, nil
+	case dkg.KeySignMsgType:
+		// only the public fields, the payload carries key material on the node side
+		keySign := struct {
+			ValidatorPK types.ValidatorPK
+			Operators   []uint32
+			Threshold   uint64
+		}{}
+		if err := json.Unmarshal(msg.Data, &keySign); err != nil {
+			return nil, err
+		}
+		operators := make([]types.OperatorID, 0, len(keySign.Operators))
+		for _, id := range keySign.Operators {
+			operators = append(operators, types.OperatorID(id))
+		}
+		return &ceremony.Params{
+			Kind:        ceremony.KindKeySign,
+			Operators:   operators,
+			Threshold:   keySign.Threshold,
+			ValidatorPK: hex.EncodeToString(keySign.ValidatorPK),
+			KeySign:     keySignParams(msg.Data),
+		}, nil
+	}
+	return nil, errors.New("not a start message")
+}
+
+// keySignParams records what the keysign signs for the usage report of its
+// validator, a message that doesn't verify is recorded as undeclared
+func keySignParams(data []byte) *ceremony.KeySignParams {
+	keySign := &signing.KeySign{}
+	if err := json.Unmarshal(data, keySign); err != nil {
+		return nil
+	}
+	usage, err := keySign.VerifyUsage()
+	if err != nil {
+		usage = signing.UsageUndeclared
+	}
+	params := &ceremony.KeySignParams{
+		Usage:       string(usage),
+		DomainTag:   keySign.DomainTag,
+		SigningRoot: hexenc.Format(keySign.SigningRoot),
+	}
+	if usage == signing.UsageRegistration {
+		params.SigningRoot = string(keySign.SigningRoot)
+	}
+	if keySign.Message != nil && err == nil {
+		params.Message, _ = json.Marshal(keySign.Message)
+	}
+	return params
+}
+
+func isStartMsg(msgType dkg.MsgType) bool {
+	return msgType == dkg.InitMsgType || msgType == dkg.ReshareMsgType || msgType == dkg.KeySignMsgType
+}
+
+// messageRound names the round of a message the way ceremony events record it
+func messageRound(msg *dkg.Message) string {
+	if msg.MsgType == dkg.ProtocolMsgType {
+		return strings.ToLower(protocolRound(msg.Data).String())
+	}
+	return msgTypeName(msg.MsgType)
+}
+
+func protocolRound(data []byte) common.ProtocolRound {
+	msg := struct {
+		Round common.ProtocolRound `json:"round"`
+	}{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return common.Uninitialized
+	}
+	return msg.Round
+}
+
+func msgTypeName(msgType dkg.MsgType) string {
+	switch msgType {
+	case dkg.InitMsgType:
+		return "init"
+	case dkg.ProtocolMsgType:
+		return "protocol"
+	case dkg.DepositDataMsgType:
+		return "deposit_data"
+	case dkg.OutputMsgType:
+		return "output"
+	case dkg.ReshareMsgType:
+		return "reshare"
+	case dkg.KeySignMsgType:
+		return "keysign"
+	}
+	return "unknown"
+}
@@ -0,0 +1,87 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	specModule = "github.com/bloxapp/ssv-spec"
+	blsModule  = "github.com/herumi/bls-eth-go-binary"
+)
+
+// AdvertisedConfig is the configuration of a node that has to agree across a
+// committee for its ceremonies to get through, check-committee compares it
+type AdvertisedConfig struct {
+	OperatorID types.OperatorID `json:"operator_id"`
+	Version    string           `json:"version"`
+	// SpecVersion is the ssv-spec module the node is built with, it encodes
+	// the dkg messages on the wire
+	SpecVersion string `json:"spec_version"`
+	// Network is the signature domain of the node's messages
+	Network string `json:"network"`
+	// CryptoBackend is the bls library the node is built with
+	CryptoBackend string                        `json:"crypto_backend"`
+	PhaseTimeouts ceremony.PhaseTimeouts        `json:"phase_timeouts"`
+	Limits        ceremony.Limits               `json:"limits"`
+	Capabilities  *messengerclient.Capabilities `json:"capabilities"`
+	// Features are the node policies that refuse start messages other nodes
+	// accept, by name
+	Features map[string]string `json:"features"`
+}
+
+// BuildVersions are the ssv-spec and bls modules the binary is built with,
+// with their replacements
+func BuildVersions() (spec, backend string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown", "unknown"
+	}
+	spec, backend = "unknown", "unknown"
+	for _, dep := range info.Deps {
+		version := dep.Path + " " + dep.Version
+		if dep.Replace != nil {
+			version = dep.Replace.Path + " " + dep.Replace.Version
+		}
+		switch dep.Path {
+		case specModule:
+			spec = version
+		case blsModule:
+			backend = version
+		}
+	}
+	return spec, backend
+}
+
+// HandleConfig advertises the configuration of the node to check-committee
+func (h *ApiHandler) HandleConfig(config *AdvertisedConfig) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, config)
+	}
+}
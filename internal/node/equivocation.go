@@ -0,0 +1,107 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// BlameEquivocation ends the ceremony with a blame of the operator that sent
+// the conflicting messages. The blame is streamed to the messenger as result
+// of the ceremony, signed by this node and with both messages as evidence.
+func (n *ObservedNetwork) BlameEquivocation(e *observer.Equivocation) error {
+	if n.sk == nil {
+		return errors.New("BlameEquivocation: no operator key to sign the blame with")
+	}
+	blameMessage, err := e.Blame()
+	if err != nil {
+		return err
+	}
+	data, err := (&frost.ProtocolMsg{Round: common.Blame, BlameMessage: blameMessage}).Encode()
+	if err != nil {
+		return fmt.Errorf("BlameEquivocation: failed to encode blame: %w", err)
+	}
+	blame := &dkg.SignedMessage{
+		Message: &dkg.Message{
+			MsgType:    dkg.ProtocolMsgType,
+			Identifier: e.Second.Message.Identifier,
+			Data:       data,
+		},
+		Signer: n.operatorID,
+	}
+	root, err := types.ComputeSigningRoot(blame, types.ComputeSignatureDomain(types.PrimusTestnet, types.DKGSignatureType))
+	if err != nil {
+		return fmt.Errorf("BlameEquivocation: %w", err)
+	}
+	if blame.Signature, err = types.Sign(n.sk, root); err != nil {
+		return fmt.Errorf("BlameEquivocation: failed to sign blame: %w", err)
+	}
+
+	requestID := hex.EncodeToString(e.Second.Message.Identifier[:])
+	recordEvent(n.tracker, n.logger, requestID, ceremony.EventBlamed, func(ev *ceremony.Event) {
+		ev.Operator = e.Operator
+		ev.Round = e.Round
+		ev.Details = e.Error()
+		ev.Cause = ceremony.CauseEquivocation
+	})
+	if err := n.network.StreamDKGBlame(&dkg.BlameOutput{Valid: true, BlameMessage: blame}); err != nil {
+		return fmt.Errorf("BlameEquivocation: failed to stream blame: %w", err)
+	}
+	return nil
+}
+
+// WithEquivocationBlame has the handler refuse a message conflicting with
+// one its signer sent for the same round before and pass the equivocation to
+// blame. Equivocations are caught by the transcript of the ceremony, so not in
+// ceremonies run with transcript=off.
+func (h *ApiHandler) WithEquivocationBlame(blame func(*observer.Equivocation) error) *ApiHandler {
+	h.blameEquivocation = blame
+	return h
+}
+
+// checkEquivocation returns the equivocation when msg conflicts with an earlier
+// message of its signer, the first time it blames the signer for it
+func (h *ApiHandler) checkEquivocation(msg *dkg.SignedMessage) error {
+	if h.blameEquivocation == nil {
+		return nil
+	}
+	e, isNew := h.transcripts.Conflict(msg)
+	if e == nil {
+		return nil
+	}
+	if isNew {
+		h.logger.Warnf("checkEquivocation: request %x: %v", msg.Message.Identifier[:], e)
+		if err := h.blameEquivocation(e); err != nil {
+			h.logger.Errorf("checkEquivocation: request %x: %v", msg.Message.Identifier[:], err)
+		}
+	}
+	return e
+}
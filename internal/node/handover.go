@@ -0,0 +1,276 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+var handoverLabel = []byte("rockx-dkg-share-handover")
+
+// HandoverRecord carries one validator share from the node currently running
+// an operator to the node replacing it. The share is encrypted to the
+// destination's enrollment key and the record is signed with the operator key.
+type HandoverRecord struct {
+	OperatorID            types.OperatorID     `json:"operator_id"`
+	ValidatorPK           string               `json:"validator_pk"`
+	EnrollmentFingerprint string               `json:"enrollment_fingerprint"`
+	Share                 *encryption.Envelope `json:"share"`
+	ExportedAt            int64                `json:"exported_at"`
+	Signature             []byte               `json:"signature,omitempty"`
+}
+
+func (r *HandoverRecord) Root() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	byts, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(byts)
+	return h[:], nil
+}
+
+// EnrollmentResponse is the destination's enrollment key, signed with the
+// operator key both nodes hold so the source only exports to it
+type EnrollmentResponse struct {
+	EnrollmentKey string `json:"enrollment_key"`
+	Fingerprint   string `json:"fingerprint"`
+	Signature     []byte `json:"signature"`
+}
+
+type HandoverExportRequest struct {
+	ValidatorPK         string `json:"validator_pk"`
+	EnrollmentKey       string `json:"enrollment_key"`
+	EnrollmentSignature []byte `json:"enrollment_signature"`
+}
+
+// enrollmentRoot is what the operator key signs over an enrollment key
+func enrollmentRoot(operatorID types.OperatorID, enrollmentKey string) ([]byte, error) {
+	byts, err := json.Marshal(struct {
+		Label         string           `json:"label"`
+		OperatorID    types.OperatorID `json:"operator_id"`
+		EnrollmentKey string           `json:"enrollment_key"`
+	}{string(handoverLabel), operatorID, enrollmentKey})
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(byts)
+	return h[:], nil
+}
+
+// HandleHandoverEnrollment creates a fresh enrollment key on the destination
+// node. Calling it again replaces any key generated earlier.
+func (h *ApiHandler) HandleHandoverEnrollment(s *storage.Storage, operatorKey *rsa.PrivateKey) func(*gin.Context) {
+	return func(c *gin.Context) {
+		sk, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to generate enrollment key", err)
+			return
+		}
+		if err := s.SaveEnrollmentKey(sk); err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to store enrollment key", err)
+			return
+		}
+
+		encoded, _ := encryption.EncodeRSAPublicKey(&sk.PublicKey)
+		fingerprint, _ := encryption.RSAPublicKeyFingerprint(&sk.PublicKey)
+		root, _ := enrollmentRoot(s.OperatorID(), encoded)
+		signature, err := types.Sign(operatorKey, root)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to sign enrollment key", err)
+			return
+		}
+		h.logger.Infof("HandleHandoverEnrollment: created enrollment key %s", fingerprint)
+		c.JSON(http.StatusOK, &EnrollmentResponse{EnrollmentKey: encoded, Fingerprint: fingerprint, Signature: signature})
+	}
+}
+
+// HandleHandoverExport encrypts the share for a validator to the destination
+// enrollment key and invalidates the local copy. The enrollment key must be
+// signed with this node's operator key, anything else is refused before the
+// share is touched.
+func (h *ApiHandler) HandleHandoverExport(s *storage.Storage, operatorKey *rsa.PrivateKey) func(*gin.Context) {
+	return func(c *gin.Context) {
+		req := &HandoverExportRequest{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse handover export request", err)
+			return
+		}
+
+		vk, err := hexenc.ParseValidatorPK(req.ValidatorPK)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid validator pk", err)
+			return
+		}
+		enrollmentKey, err := encryption.DecodeRSAPublicKey(req.EnrollmentKey)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid enrollment key", err)
+			return
+		}
+
+		_, operator, err := s.GetDKGOperator(s.OperatorID())
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load operator public key", err)
+			return
+		}
+		keyRoot, _ := enrollmentRoot(s.OperatorID(), req.EnrollmentKey)
+		if len(req.EnrollmentSignature) == 0 || !types.Verify(operator.EncryptionPubKey, keyRoot, req.EnrollmentSignature) {
+			h.respondError(c, http.StatusForbidden, "enrollment key isn't signed by this operator", fmt.Errorf("enrollment signature doesn't match operator %d", s.OperatorID()))
+			return
+		}
+
+		output, err := s.GetKeyGenOutput(vk)
+		if err != nil {
+			h.respondError(c, http.StatusNotFound, fmt.Sprintf("no share found for validator %s", req.ValidatorPK), err)
+			return
+		}
+		plaintext, err := (&storage.KeyGenOutput{}).Encode(output)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to encode share", err)
+			return
+		}
+
+		envelope, err := encryption.SealRSA(enrollmentKey, plaintext, handoverLabel)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to encrypt share to enrollment key", err)
+			return
+		}
+		fingerprint, _ := encryption.RSAPublicKeyFingerprint(enrollmentKey)
+
+		record := &HandoverRecord{
+			OperatorID:            s.OperatorID(),
+			ValidatorPK:           req.ValidatorPK,
+			EnrollmentFingerprint: fingerprint,
+			Share:                 envelope,
+			ExportedAt:            time.Now().UTC().Unix(),
+		}
+		root, _ := record.Root()
+		if record.Signature, err = types.Sign(operatorKey, root); err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to sign handover record", err)
+			return
+		}
+
+		tombstone := &storage.HandoverTombstone{
+			ValidatorPK: req.ValidatorPK,
+			RecordHash:  hex.EncodeToString(root),
+			ExportedAt:  record.ExportedAt,
+		}
+		if err := s.InvalidateKeyGenOutput(vk, tombstone); err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to invalidate local share", err)
+			return
+		}
+
+		h.logger.Infof("HandleHandoverExport: share for validator %s exported to enrollment key %s, record %s", req.ValidatorPK, fingerprint, tombstone.RecordHash)
+		c.JSON(http.StatusOK, record)
+	}
+}
+
+// HandleHandoverImport verifies a handover record was signed by this node's
+// operator and stores the decrypted share.
+func (h *ApiHandler) HandleHandoverImport(s *storage.Storage) func(*gin.Context) {
+	return func(c *gin.Context) {
+		record := &HandoverRecord{}
+		if err := c.ShouldBindJSON(record); err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse handover record", err)
+			return
+		}
+
+		if record.OperatorID != s.OperatorID() {
+			h.respondError(c, http.StatusBadRequest, "handover record is for a different operator", fmt.Errorf("record operator %d, this node %d", record.OperatorID, s.OperatorID()))
+			return
+		}
+
+		_, operator, err := s.GetDKGOperator(record.OperatorID)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load operator public key", err)
+			return
+		}
+		root, _ := record.Root()
+		if !types.Verify(operator.EncryptionPubKey, root, record.Signature) {
+			h.respondError(c, http.StatusBadRequest, "invalid handover record signature", fmt.Errorf("signature doesn't match operator %d", record.OperatorID))
+			return
+		}
+
+		enrollmentKey, err := s.GetEnrollmentKey()
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "this node has no enrollment key, call /handover/enrollment first", err)
+			return
+		}
+		fingerprint, _ := encryption.RSAPublicKeyFingerprint(&enrollmentKey.PublicKey)
+		if fingerprint != record.EnrollmentFingerprint {
+			h.respondError(c, http.StatusBadRequest, "handover record was encrypted to a different enrollment key", fmt.Errorf("expected %s got %s", fingerprint, record.EnrollmentFingerprint))
+			return
+		}
+
+		plaintext, err := encryption.OpenRSA(enrollmentKey, record.Share, handoverLabel)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to decrypt share", err)
+			return
+		}
+		output, err := (&storage.KeyGenOutput{}).Decode(plaintext)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to decode share", err)
+			return
+		}
+		if !hexenc.Equal(hexenc.Key(output.ValidatorPK), record.ValidatorPK) {
+			h.respondError(c, http.StatusBadRequest, "share doesn't belong to the validator in the record", fmt.Errorf("share is for %x", output.ValidatorPK))
+			return
+		}
+		sharePK, ok := output.OperatorPubKeys[s.OperatorID()]
+		if !ok || !sharePK.IsEqual(output.Share.GetPublicKey()) {
+			h.respondError(c, http.StatusBadRequest, "share doesn't match the committee public key of this operator", fmt.Errorf("share pubkey mismatch"))
+			return
+		}
+
+		if err := s.SaveKeyGenOutput(output); err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to store imported share", err)
+			return
+		}
+		h.logger.Infof("HandleHandoverImport: imported share for validator %s", record.ValidatorPK)
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("share for validator %s imported successfully", record.ValidatorPK),
+			"error":   nil,
+		})
+	}
+}
+
+func (h *ApiHandler) respondError(c *gin.Context, status int, message string, err error) {
+	h.logger.Errorf("%s: %v", message, err)
+	c.JSON(status, gin.H{
+		"message": message,
+		"error":   err.Error(),
+	})
+}
@@ -0,0 +1,116 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+// newHandoverStorage opens a storage for operator 1 with its registry key
+// cached and one share stored
+func newHandoverStorage(t *testing.T, operatorKey *rsa.PrivateKey) (*storage.Storage, *dkg.KeyGenOutput) {
+	s, _ := openTestStorage(t, "")
+	require.NoError(t, s.SaveOperatorRecords(map[types.OperatorID]*storage.OperatorRecord{
+		1: {Operator: &dkg.Operator{OperatorID: 1, EncryptionPubKey: &operatorKey.PublicKey}, FetchedAt: time.Now().Unix()},
+	}))
+
+	types.InitBLS()
+	share := &bls.SecretKey{}
+	share.SetByCSPRNG()
+	output := &dkg.KeyGenOutput{
+		Share:           share,
+		ValidatorPK:     share.GetPublicKey().Serialize(),
+		OperatorPubKeys: map[types.OperatorID]*bls.PublicKey{1: share.GetPublicKey()},
+		Threshold:       1,
+	}
+	require.NoError(t, s.SaveKeyGenOutput(output))
+	return s, output
+}
+
+func postHandoverExport(t *testing.T, handler gin.HandlerFunc, req *HandoverExportRequest) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/handover/export", handler)
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/handover/export", bytes.NewReader(body)))
+	return w
+}
+
+func TestHandoverExportRefusesUnsignedEnrollmentKey(t *testing.T) {
+	operatorKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	s, output := newHandoverStorage(t, operatorKey)
+	h := New(testLogger(), nil)
+
+	attackerKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	encoded, err := encryption.EncodeRSAPublicKey(&attackerKey.PublicKey)
+	require.NoError(t, err)
+	root, err := enrollmentRoot(1, encoded)
+	require.NoError(t, err)
+	foreign, err := types.Sign(attackerKey, root)
+	require.NoError(t, err)
+
+	for _, signature := range [][]byte{nil, foreign} {
+		w := postHandoverExport(t, h.HandleHandoverExport(s, operatorKey), &HandoverExportRequest{
+			ValidatorPK:         hex.EncodeToString(output.ValidatorPK),
+			EnrollmentKey:       encoded,
+			EnrollmentSignature: signature,
+		})
+		require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+		// the local share is untouched
+		stored, err := s.GetKeyGenOutput(output.ValidatorPK)
+		require.NoError(t, err)
+		require.True(t, stored.Share.IsEqual(output.Share))
+	}
+
+	// an enrollment key signed with the operator key is exported
+	signature, err := types.Sign(operatorKey, root)
+	require.NoError(t, err)
+	w := postHandoverExport(t, h.HandleHandoverExport(s, operatorKey), &HandoverExportRequest{
+		ValidatorPK:         hex.EncodeToString(output.ValidatorPK),
+		EnrollmentKey:       encoded,
+		EnrollmentSignature: signature,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, err = s.GetKeyGenOutput(output.ValidatorPK)
+	require.Error(t, err)
+}
@@ -0,0 +1,91 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/quota"
+	"github.com/gin-gonic/gin"
+)
+
+// Load is the work at hand of the node, initiators starting a batch of
+// ceremonies hold back the start messages of an overloaded node
+type Load struct {
+	ActiveCeremonies int `json:"active_ceremonies"`
+	// Processing and QueueDepth are the messages processed and waiting for
+	// a processing slot
+	Processing int  `json:"processing"`
+	QueueDepth int  `json:"queue_depth"`
+	Overloaded bool `json:"overloaded"`
+}
+
+// load reports the ceremonies in flight and the scheduler queue
+func (h *ApiHandler) load() *Load {
+	processing, waiting, overloaded := h.scheduler.Load()
+	return &Load{
+		ActiveCeremonies: h.tracker.Active(),
+		Processing:       processing,
+		QueueDepth:       waiting,
+		Overloaded:       overloaded,
+	}
+}
+
+// HandleHealth reports the disk usage and the load of the node, 503 while
+// the disk usage is critical. Without monitor, for a node on postgres, the
+// disk is always healthy. An overloaded node stays healthy, it only asks
+// initiators to slow down.
+func (h *ApiHandler) HandleHealth(monitor *quota.Monitor) func(*gin.Context) {
+	return func(c *gin.Context) {
+		if monitor == nil {
+			c.JSON(http.StatusOK, gin.H{"status": quota.LevelOK, "load": h.load()})
+			return
+		}
+		usage := monitor.Usage()
+		status := http.StatusOK
+		if usage.Level == quota.LevelCritical {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"status": usage.Level,
+			"disk":   usage,
+			"load":   h.load(),
+		})
+	}
+}
+
+// respondQuota refuses a ceremony for lack of disk space with the usage that
+// made the node refuse it
+func (h *ApiHandler) respondQuota(c *gin.Context, err error) {
+	h.logger.Errorf("HandleConsume: refused new ceremony: %v", err)
+	body := gin.H{
+		"message": "node is low on disk space and doesn't accept new ceremonies",
+		"error":   err.Error(),
+		"code":    "disk_quota_exceeded",
+	}
+	var quotaErr *quota.ErrQuota
+	if errors.As(err, &quotaErr) {
+		body["disk"] = quotaErr.Usage
+	}
+	c.JSON(http.StatusInsufficientStorage, body)
+}
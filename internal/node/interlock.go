@@ -0,0 +1,194 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrValidatorBusy refuses a keysign or resharing of a validator while a
+// ceremony it conflicts with runs on this node
+type ErrValidatorBusy struct {
+	ValidatorPK string
+	Kind        ceremony.Kind
+	// Holder is the running ceremony in the way
+	Holder     string
+	HolderKind ceremony.Kind
+}
+
+func (e *ErrValidatorBusy) Error() string {
+	return fmt.Sprintf("validator %s is in %s %s, a %s can't start before it ends", e.ValidatorPK, e.HolderKind, e.Holder, e.Kind)
+}
+
+// ValidatorInterlock keeps a keysign from running while a resharing of the
+// same validator does, so no signature comes from a share the resharing is
+// superseding, and two resharings of a validator apart. Keysigns of a
+// validator run alongside each other.
+type ValidatorInterlock struct {
+	tracker *ceremony.Tracker
+
+	mu sync.Mutex
+	// pending are the starts admitted but not recorded by the tracker yet
+	pending map[string]*ceremony.Params
+
+	keySignRefused int64
+	reshareRefused int64
+}
+
+func NewValidatorInterlock(tracker *ceremony.Tracker) *ValidatorInterlock {
+	return &ValidatorInterlock{tracker: tracker, pending: make(map[string]*ceremony.Params)}
+}
+
+// Acquire admits the start of a keysign or resharing unless it conflicts with
+// a running ceremony of the validator. Start messages of ceremonies the
+// tracker already knows are delivered again and always pass.
+func (l *ValidatorInterlock) Acquire(msg *dkg.Message) error {
+	if msg.MsgType != dkg.KeySignMsgType && msg.MsgType != dkg.ReshareMsgType {
+		return nil
+	}
+	requestID := hex.EncodeToString(msg.Identifier[:])
+	if l.tracker.Exists(requestID) {
+		return nil
+	}
+	params, err := StartParams(msg)
+	if err != nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if holder, kind := l.conflict(requestID, params); holder != "" {
+		if params.Kind == ceremony.KindKeySign {
+			atomic.AddInt64(&l.keySignRefused, 1)
+		} else {
+			atomic.AddInt64(&l.reshareRefused, 1)
+		}
+		return &ErrValidatorBusy{ValidatorPK: params.ValidatorPK, Kind: params.Kind, Holder: holder, HolderKind: kind}
+	}
+	l.pending[requestID] = params
+	return nil
+}
+
+// conflict is the first running or pending ceremony of the validator the
+// start conflicts with
+func (l *ValidatorInterlock) conflict(requestID string, params *ceremony.Params) (string, ceremony.Kind) {
+	for other, otherParams := range l.pending {
+		if other != requestID && conflicts(params, otherParams) {
+			return other, otherParams.Kind
+		}
+	}
+	for _, other := range l.tracker.Running() {
+		cer, err := l.tracker.Get(other)
+		if err != nil || other == requestID || cer.Params == nil {
+			continue
+		}
+		if conflicts(params, cer.Params) {
+			return other, cer.Params.Kind
+		}
+	}
+	return "", ""
+}
+
+// conflicts tells whether two ceremonies can't run together: a resharing and
+// anything else on the same validator
+func conflicts(a, b *ceremony.Params) bool {
+	if a.ValidatorPK == "" || a.ValidatorPK != b.ValidatorPK {
+		return false
+	}
+	return a.Kind == ceremony.KindReshare || b.Kind == ceremony.KindReshare
+}
+
+// Release drops a pending start once its handling is over. A start the
+// tracker recorded is kept apart by the tracker from then on, one refused or
+// failed after Acquire admitted it must not hold the validator.
+func (l *ValidatorInterlock) Release(msg *dkg.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.pending, hex.EncodeToString(msg.Identifier[:]))
+}
+
+// Observe drops a pending start once the tracker recorded it
+func (l *ValidatorInterlock) Observe(cer *ceremony.Ceremony, e *ceremony.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.pending, cer.RequestID)
+}
+
+func (l *ValidatorInterlock) Collectors() []prometheus.Collector {
+	kinds := []struct {
+		kind  ceremony.Kind
+		value *int64
+	}{
+		{ceremony.KindKeySign, &l.keySignRefused},
+		{ceremony.KindReshare, &l.reshareRefused},
+	}
+	collectors := make([]prometheus.Collector, 0, len(kinds))
+	for _, kind := range kinds {
+		kind := kind
+		collectors = append(collectors, prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "dkg_node_validator_interlock_refusals_total",
+			Help:        "Keysigns and resharings refused while a conflicting ceremony of the validator ran",
+			ConstLabels: prometheus.Labels{"kind": string(kind.kind)},
+		}, func() float64 { return float64(atomic.LoadInt64(kind.value)) }))
+	}
+	return collectors
+}
+
+// checkInterlock refuses a keysign or resharing of a validator busy with a
+// conflicting ceremony
+func (p *StartPolicy) checkInterlock(msg *dkg.Message) error {
+	if p.Interlock == nil {
+		return nil
+	}
+	return p.Interlock.Acquire(msg)
+}
+
+func (p *StartPolicy) releaseInterlock(msg *dkg.Message) {
+	if p.Interlock != nil {
+		p.Interlock.Release(msg)
+	}
+}
+
+func (h *ApiHandler) respondInterlock(c *gin.Context, err error) {
+	var busy *ErrValidatorBusy
+	if !errors.As(err, &busy) {
+		h.respondError(c, http.StatusInternalServerError, "failed to check the validator interlock", err)
+		return
+	}
+	h.logger.Warnf("HandleConsume: refused %s: %v", busy.Kind, err)
+	c.JSON(http.StatusConflict, gin.H{
+		"message": "validator is busy with a conflicting ceremony",
+		"error":   err.Error(),
+		"code":    "validator_busy",
+		"holder":  busy.Holder,
+	})
+}
@@ -0,0 +1,136 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func testReshareMsg(t *testing.T, id byte, validatorPK types.ValidatorPK) *dkg.Message {
+	reshare := &dkg.Reshare{
+		ValidatorPK:    validatorPK,
+		OperatorIDs:    []types.OperatorID{1, 2, 3, 5},
+		OldOperatorIDs: []types.OperatorID{1, 2, 3, 4},
+		Threshold:      3,
+	}
+	data, err := reshare.Encode()
+	require.NoError(t, err)
+	return &dkg.Message{MsgType: dkg.ReshareMsgType, Identifier: dkg.RequestID{id}, Data: data}
+}
+
+func newTestInterlock(store ceremony.EventStore) (*ValidatorInterlock, *ceremony.Tracker) {
+	tracker := ceremony.NewTracker(store)
+	interlock := NewValidatorInterlock(tracker)
+	tracker.Subscribe(interlock.Observe)
+	return interlock, tracker
+}
+
+func TestInterlockKeySignAndReshare(t *testing.T) {
+	interlock, _ := newTestInterlock(newMemEvents())
+	validator, other := testValidatorPK(1), testValidatorPK(2)
+
+	// keysigns of a validator run alongside each other
+	require.NoError(t, interlock.Acquire(testKeySignMsg(t, 1, validator)))
+	require.NoError(t, interlock.Acquire(testKeySignMsg(t, 2, validator)))
+
+	// a resharing waits for them, unless it is of another validator
+	var busy *ErrValidatorBusy
+	err := interlock.Acquire(testReshareMsg(t, 3, validator))
+	require.ErrorAs(t, err, &busy)
+	require.Equal(t, ceremony.KindReshare, busy.Kind)
+	require.Equal(t, ceremony.KindKeySign, busy.HolderKind)
+	require.NoError(t, interlock.Acquire(testReshareMsg(t, 4, other)))
+
+	// and a resharing keeps keysigns and other resharings of its validator out
+	err = interlock.Acquire(testKeySignMsg(t, 5, other))
+	require.ErrorAs(t, err, &busy)
+	require.Equal(t, requestIDOf(testReshareMsg(t, 4, other)), busy.Holder)
+	require.ErrorAs(t, interlock.Acquire(testReshareMsg(t, 6, other)), &busy)
+	require.Equal(t, int64(1), interlock.keySignRefused)
+	require.Equal(t, int64(2), interlock.reshareRefused)
+
+	// the same start delivered again isn't in its own way
+	require.NoError(t, interlock.Acquire(testReshareMsg(t, 4, other)))
+}
+
+func TestInterlockRelease(t *testing.T) {
+	interlock, tracker := newTestInterlock(newMemEvents())
+	validator := testValidatorPK(1)
+	keySign := testKeySignMsg(t, 1, validator)
+	reshare := testReshareMsg(t, 2, validator)
+
+	require.NoError(t, interlock.Acquire(keySign))
+	require.Error(t, interlock.Acquire(reshare))
+	interlock.Release(keySign)
+	require.NoError(t, interlock.Acquire(reshare))
+
+	// once recorded, the tracker keeps the resharing in the way until it ends
+	require.NoError(t, recordStart(t, tracker, reshare))
+	interlock.Release(reshare)
+	require.Empty(t, interlock.pending)
+	require.Error(t, interlock.Acquire(keySign))
+	_, err := tracker.Record(requestIDOf(reshare), ceremony.EventAborted, nil)
+	require.NoError(t, err)
+	require.NoError(t, interlock.Acquire(keySign))
+
+	// a start the tracker knows passes again
+	require.NoError(t, recordStart(t, tracker, keySign))
+	require.NoError(t, interlock.Acquire(keySign))
+}
+
+func TestInterlockReleaseAfterFailedRecord(t *testing.T) {
+	store := newMemEvents()
+	interlock, tracker := newTestInterlock(store)
+	validator := testValidatorPK(1)
+	reshare := testReshareMsg(t, 1, validator)
+
+	// the resharing is admitted but the tracker fails to record it, nothing
+	// but Release drops it
+	require.NoError(t, interlock.Acquire(reshare))
+	store.fail = true
+	require.Error(t, recordStart(t, tracker, reshare))
+	store.fail = false
+	require.Empty(t, tracker.Running())
+	require.Len(t, interlock.pending, 1)
+	require.Error(t, interlock.Acquire(testKeySignMsg(t, 2, validator)))
+
+	interlock.Release(reshare)
+	require.Empty(t, interlock.pending)
+	require.NoError(t, interlock.Acquire(testKeySignMsg(t, 2, validator)))
+}
+
+func TestStartPolicyReleaseInterlock(t *testing.T) {
+	// a policy without an interlock has nothing to release
+	(&StartPolicy{}).releaseInterlock(testKeySignMsg(t, 1, testValidatorPK(1)))
+
+	interlock, _ := newTestInterlock(newMemEvents())
+	policy := &StartPolicy{Interlock: interlock}
+	reshare := testReshareMsg(t, 1, testValidatorPK(1))
+	require.NoError(t, policy.checkInterlock(reshare))
+	policy.releaseInterlock(reshare)
+	require.Empty(t, interlock.pending)
+}
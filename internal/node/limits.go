@@ -0,0 +1,122 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+// LimitBody refuses request bodies larger than the node accepts with 413,
+// before a handler reads them into memory
+func (h *ApiHandler) LimitBody(limits ceremony.Limits) gin.HandlerFunc {
+	limits = limits.OrDefault()
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		data, err := ceremony.ReadBody(c.Request, limits.MaxMessageBytes)
+		if err != nil {
+			if ceremony.IsLimitExceeded(err) {
+				h.respondLimit(c, limits, err)
+			} else {
+				h.respondError(c, http.StatusBadRequest, "failed to load data from request body", err)
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		c.Next()
+	}
+}
+
+// HandleLimits advertises the limits of the node to initiators
+func (h *ApiHandler) HandleLimits(limits ceremony.Limits) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, limits.OrDefault())
+	}
+}
+
+// respondLimit refuses a request over one of the node's limits, along with the limits
+func (h *ApiHandler) respondLimit(c *gin.Context, limits ceremony.Limits, err error) {
+	h.logger.Warnf("refused request over the node limits: %v", err)
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"message": "request exceeds the limits of the node",
+		"error":   err.Error(),
+		"code":    "limit_exceeded",
+		"limits":  limits.OrDefault(),
+	})
+}
+
+// checkLimits refuses a start message for more operators than the node
+// accepts, or negotiated by the initiator with limits above the node's own
+func (p *StartPolicy) checkLimits(msg *dkg.Message, query url.Values) error {
+	limits := p.limits()
+	negotiated, err := ceremony.ParseLimits(query)
+	if err != nil {
+		return err
+	}
+	if negotiated != nil {
+		if err := limits.Covers(*negotiated); err != nil {
+			return err
+		}
+	}
+	return limits.CheckOperators(startOperators(msg))
+}
+
+func (p *StartPolicy) limits() ceremony.Limits {
+	if p.Limits == nil {
+		return ceremony.DefaultLimits
+	}
+	return p.Limits.OrDefault()
+}
+
+// startOperators counts the operators of a keygen or resharing start message,
+// operators of both committees of a resharing count once
+func startOperators(msg *dkg.Message) int {
+	var operators []types.OperatorID
+	switch msg.MsgType {
+	case dkg.InitMsgType:
+		init := &dkg.Init{}
+		if err := init.Decode(msg.Data); err == nil {
+			operators = init.OperatorIDs
+		}
+	case dkg.ReshareMsgType:
+		reshare := &dkg.Reshare{}
+		if err := reshare.Decode(msg.Data); err == nil {
+			operators = append(append(operators, reshare.OperatorIDs...), reshare.OldOperatorIDs...)
+		}
+	}
+	distinct := make(map[types.OperatorID]bool, len(operators))
+	for _, operatorID := range operators {
+		distinct[operatorID] = true
+	}
+	return len(distinct)
+}
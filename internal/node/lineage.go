@@ -0,0 +1,56 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/gin-gonic/gin"
+)
+
+// Lineage is the keygen and resharings of a validator this node took part
+// in, oldest first
+type Lineage struct {
+	ValidatorPK string                  `json:"validator_pk"`
+	Entries     []*storage.LineageEntry `json:"entries"`
+}
+
+// HandleGetLineage returns the lineage of the validator, empty when this node
+// took part in none of its ceremonies
+func (h *ApiHandler) HandleGetLineage(s *storage.Storage) func(*gin.Context) {
+	return func(c *gin.Context) {
+		pk, err := hexenc.ParseValidatorPK(c.Param("validator_pk"))
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid validator pk", err)
+			return
+		}
+		entries, err := s.Lineage(pk)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to get lineage", err)
+			return
+		}
+		c.JSON(http.StatusOK, &Lineage{ValidatorPK: hex.EncodeToString(pk), Entries: entries})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// getValidatorPK gets path on handler with the validator key in the form
+// given, and returns the validator_pk of the response
+func getValidatorPK(t *testing.T, route string, handler gin.HandlerFunc, pk string) string {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET(route, handler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.Replace(route, ":validator_pk", pk, 1), nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	body := struct {
+		ValidatorPK string `json:"validator_pk"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body.ValidatorPK
+}
+
+func TestHandleGetLineageValidatorPK(t *testing.T) {
+	s, _ := openTestStorage(t, "")
+	h := New(testLogger(), nil)
+	pk := hex.EncodeToString(testValidatorPK(0xab))
+
+	// any form of the key is taken, the response keeps the bare lowercase hex
+	for _, form := range []string{pk, "0x" + pk, "0X" + strings.ToUpper(pk)} {
+		require.Equal(t, pk, getValidatorPK(t, "/lineage/:validator_pk", h.HandleGetLineage(s), form))
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+// ShareSummary is a share this node holds, without its secret
+type ShareSummary struct {
+	ValidatorPK string             `json:"validator_pk"`
+	Operators   []types.OperatorID `json:"operators"`
+	Threshold   uint64             `json:"threshold"`
+	// Canary shares are deleted once the canary keygen expires
+	Canary bool `json:"canary,omitempty"`
+}
+
+// ShareList is a page of shares, Next is the cursor of the next page
+type ShareList struct {
+	Shares []*ShareSummary `json:"shares"`
+	Next   string          `json:"next,omitempty"`
+}
+
+// CeremonySummary is a ceremony without its event log
+type CeremonySummary struct {
+	RequestID string           `json:"request_id"`
+	State     ceremony.State   `json:"state"`
+	Params    *ceremony.Params `json:"params,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// CeremonyList is a page of ceremonies, Next is the cursor of the next page
+type CeremonyList struct {
+	Ceremonies []*CeremonySummary `json:"ceremonies"`
+	Next       string             `json:"next,omitempty"`
+}
+
+// HandleListShares pages through the shares of this node, with ?operator=
+// only those of committees the operator is part of
+func (h *ApiHandler) HandleListShares(s *storage.Storage) func(*gin.Context) {
+	return func(c *gin.Context) {
+		opts, err := listOptions(c)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid list parameters", err)
+			return
+		}
+
+		var shares []*storage.ValidatorShare
+		var next string
+		if operator := c.Query("operator"); operator != "" {
+			operatorID, perr := strconv.ParseUint(operator, 10, 64)
+			if perr != nil {
+				h.respondError(c, http.StatusBadRequest, "invalid list parameters", fmt.Errorf("invalid operator %q", operator))
+				return
+			}
+			shares, next, err = s.ListByOperator(types.OperatorID(operatorID), opts)
+		} else {
+			shares, next, err = s.ListKeyGenOutputs(opts)
+		}
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to list shares", err)
+			return
+		}
+
+		list := &ShareList{Shares: make([]*ShareSummary, 0, len(shares)), Next: next}
+		for _, share := range shares {
+			canary, err := s.IsCanaryShare(share.ValidatorPK)
+			if err != nil {
+				h.respondError(c, http.StatusInternalServerError, "failed to list shares", err)
+				return
+			}
+			list.Shares = append(list.Shares, &ShareSummary{
+				ValidatorPK: hex.EncodeToString(share.ValidatorPK),
+				Operators:   share.Operators,
+				Threshold:   share.Threshold,
+				Canary:      canary,
+			})
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// HandleListCeremonies pages through the ceremonies of this node, with
+// ?state= only those in the state
+func (h *ApiHandler) HandleListCeremonies(s *storage.Storage) func(*gin.Context) {
+	return func(c *gin.Context) {
+		opts, err := listOptions(c)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid list parameters", err)
+			return
+		}
+		state, err := ceremony.ParseState(c.Query("state"))
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid list parameters", err)
+			return
+		}
+
+		ids, next, err := s.ListCeremoniesByStatus(state, opts)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to list ceremonies", err)
+			return
+		}
+		list := &CeremonyList{Ceremonies: make([]*CeremonySummary, 0, len(ids)), Next: next}
+		for _, requestID := range ids {
+			cer, err := h.tracker.Get(requestID)
+			if err != nil {
+				h.respondError(c, http.StatusInternalServerError, "failed to load ceremony", err)
+				return
+			}
+			list.Ceremonies = append(list.Ceremonies, &CeremonySummary{
+				RequestID: cer.RequestID,
+				State:     cer.State,
+				Params:    cer.Params,
+				CreatedAt: cer.CreatedAt,
+				UpdatedAt: cer.UpdatedAt,
+			})
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// listOptions reads the ?after= cursor and ?limit= of a list request
+func listOptions(c *gin.Context) (storage.ListOptions, error) {
+	opts := storage.ListOptions{After: c.Query("after")}
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed <= 0 || parsed > storage.MaxListLimit {
+			return opts, fmt.Errorf("limit must be between 1 and %d", storage.MaxListLimit)
+		}
+		opts.Limit = parsed
+	}
+	return opts, nil
+}
@@ -0,0 +1,80 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+)
+
+// checkManifest verifies the manifest the initiator signed for a keygen or
+// resharing: it has to hash to the signed hash and describe exactly the
+// ceremony the start message, its options and version claim start. It returns
+// the manifest hash, empty for start messages sent without a manifest.
+func (p *StartPolicy) checkManifest(signedMsg *dkg.SignedMessage, query url.Values, claim *ceremony.VersionClaim, options ceremony.Options) (string, error) {
+	msgType := signedMsg.Message.MsgType
+	if msgType != dkg.InitMsgType && msgType != dkg.ReshareMsgType {
+		return "", nil
+	}
+
+	signed, err := ceremony.ParseSignedManifest(query)
+	if err != nil {
+		return "", err
+	}
+	if signed == nil {
+		if p.RequireManifest {
+			return "", fmt.Errorf("start message without manifest, this node requires one")
+		}
+		return "", nil
+	}
+
+	if signed.RequestID != hex.EncodeToString(signedMsg.Message.Identifier[:]) || signed.Signer != signedMsg.Signer {
+		return "", fmt.Errorf("manifest of operator %d for request %s isn't the manifest of the start message", signed.Signer, signed.RequestID)
+	}
+	if p.Keys == nil {
+		return "", fmt.Errorf("no operator keys to check the manifest")
+	}
+	pk, err := p.Keys(signed.Signer)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the key of operator %d: %w", signed.Signer, err)
+	}
+	if err := signed.Verify(pk); err != nil {
+		return "", err
+	}
+
+	params, err := StartParams(signedMsg.Message)
+	if err != nil {
+		return "", err
+	}
+	var minVersion uint32
+	if claim != nil {
+		minVersion = claim.MinVersion
+	}
+	if err := signed.Manifest.Matches(params, options, minVersion); err != nil {
+		return "", err
+	}
+	return signed.Hash, nil
+}
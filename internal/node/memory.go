@@ -0,0 +1,191 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// runnerOperatorBytes estimates the state a dkg runner keeps for each
+// operator of its ceremony: the round 1 commitments, proofs and encrypted
+// shares and the round 2 keys, with the frost instance around them
+const runnerOperatorBytes = 64 << 10
+
+// MemoryBudget bounds the memory the node spends on ceremonies, a zero
+// budget leaves its part unbounded
+type MemoryBudget struct {
+	// Messages bounds the message cache: the messages the node broadcast,
+	// kept for resends, and the hashes of the ones it received
+	Messages int64 `json:"messages,omitempty"`
+	// Queue bounds the messages waiting for a scheduler slot
+	Queue int64 `json:"queue,omitempty"`
+	// Runners bounds the estimated state of the dkg runners of the running
+	// ceremonies
+	Runners int64 `json:"runners,omitempty"`
+}
+
+// MemoryUsage is the memory the node spends on ceremonies right now
+type MemoryUsage struct {
+	MessageBytes int64        `json:"message_bytes"`
+	QueueBytes   int64        `json:"queue_bytes"`
+	RunnerBytes  int64        `json:"runner_bytes"`
+	Running      int          `json:"running"`
+	Budget       MemoryBudget `json:"budget"`
+}
+
+// ErrMemoryBudget is returned for a ceremony refused because the node is
+// over one of its memory budgets
+type ErrMemoryBudget struct {
+	Usage  MemoryUsage
+	Reason string
+}
+
+func (e *ErrMemoryBudget) Error() string {
+	return fmt.Sprintf("memory budget exceeded: %s", e.Reason)
+}
+
+// MemoryGuard refuses new ceremonies while the memory of the running ones is
+// over budget, so a large batch is turned away instead of running the node
+// out of memory. Ceremonies already running are left to finish.
+type MemoryGuard struct {
+	budget    MemoryBudget
+	cache     *MessageCache
+	scheduler *Scheduler
+	tracker   *ceremony.Tracker
+
+	refused int64
+}
+
+func NewMemoryGuard(budget MemoryBudget, cache *MessageCache, scheduler *Scheduler, tracker *ceremony.Tracker) *MemoryGuard {
+	return &MemoryGuard{budget: budget, cache: cache, scheduler: scheduler, tracker: tracker}
+}
+
+// Usage measures the message cache and the scheduler queue, and estimates
+// the runner state from the operators of the running ceremonies
+func (g *MemoryGuard) Usage() MemoryUsage {
+	usage := MemoryUsage{Budget: g.budget, QueueBytes: g.scheduler.QueuedBytes()}
+	if g.cache != nil {
+		usage.MessageBytes = g.cache.Bytes()
+	}
+	for _, requestID := range g.tracker.Running() {
+		cer, err := g.tracker.Get(requestID)
+		if err != nil || cer.Params == nil {
+			continue
+		}
+		usage.Running++
+		usage.RunnerBytes += runnerBytes(len(cer.Params.Operators) + len(cer.Params.OldOperators))
+	}
+	return usage
+}
+
+// Admit returns an *ErrMemoryBudget when the node is over a budget, or the
+// runners would be with one more ceremony of operators
+func (g *MemoryGuard) Admit(operators int) error {
+	usage := g.Usage()
+	var reasons []string
+	if g.budget.Messages > 0 && usage.MessageBytes >= g.budget.Messages {
+		reasons = append(reasons, fmt.Sprintf("message cache holds %d bytes of its %d byte budget", usage.MessageBytes, g.budget.Messages))
+	}
+	if g.budget.Queue > 0 && usage.QueueBytes >= g.budget.Queue {
+		reasons = append(reasons, fmt.Sprintf("messages waiting for processing take %d bytes of their %d byte budget", usage.QueueBytes, g.budget.Queue))
+	}
+	if g.budget.Runners > 0 && usage.RunnerBytes+runnerBytes(operators) > g.budget.Runners {
+		reasons = append(reasons, fmt.Sprintf("%d running ceremonies take an estimated %d bytes, another one of %d operators would pass the %d byte budget", usage.Running, usage.RunnerBytes, operators, g.budget.Runners))
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	atomic.AddInt64(&g.refused, 1)
+	return &ErrMemoryBudget{Usage: usage, Reason: strings.Join(reasons, "; ")}
+}
+
+func runnerBytes(operators int) int64 {
+	return int64(operators) * runnerOperatorBytes
+}
+
+// Collectors are the prometheus metrics of the guard
+func (g *MemoryGuard) Collectors() []prometheus.Collector {
+	parts := []struct {
+		name   string
+		budget int64
+		value  func(u MemoryUsage) int64
+	}{
+		{"messages", g.budget.Messages, func(u MemoryUsage) int64 { return u.MessageBytes }},
+		{"queue", g.budget.Queue, func(u MemoryUsage) int64 { return u.QueueBytes }},
+		{"runners", g.budget.Runners, func(u MemoryUsage) int64 { return u.RunnerBytes }},
+	}
+	collectors := make([]prometheus.Collector, 0, 2*len(parts)+1)
+	for _, part := range parts {
+		part := part
+		labels := prometheus.Labels{"part": part.name}
+		collectors = append(collectors,
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "dkg_node_memory_bytes",
+				Help:        "Memory the node spends on ceremonies by part, the runner state is an estimate",
+				ConstLabels: labels,
+			}, func() float64 { return float64(part.value(g.Usage())) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "dkg_node_memory_budget_bytes",
+				Help:        "Memory budget of the part, 0 when unbounded",
+				ConstLabels: labels,
+			}, func() float64 { return float64(part.budget) }),
+		)
+	}
+	return append(collectors, prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "dkg_node_memory_refused_total",
+		Help: "Start messages refused because the node was over a memory budget",
+	}, func() float64 {
+		return float64(atomic.LoadInt64(&g.refused))
+	}))
+}
+
+func (p *StartPolicy) admitMemory(msg *dkg.Message) error {
+	if p.Memory == nil {
+		return nil
+	}
+	return p.Memory.Admit(startOperators(msg))
+}
+
+// respondMemory refuses a ceremony for lack of memory with the usage that
+// made the node refuse it, initiators retry once running ceremonies finished
+func (h *ApiHandler) respondMemory(c *gin.Context, err error) {
+	h.logger.Warnf("HandleConsume: refused new ceremony: %v", err)
+	body := gin.H{
+		"message": "node is over its memory budget and doesn't accept new ceremonies",
+		"error":   err.Error(),
+		"code":    "memory_budget_exceeded",
+	}
+	var memoryErr *ErrMemoryBudget
+	if errors.As(err, &memoryErr) {
+		body["memory"] = memoryErr.Usage
+	}
+	c.JSON(http.StatusServiceUnavailable, body)
+}
@@ -0,0 +1,152 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+// memEvents stores ceremony events in memory, fail makes the appends fail
+type memEvents struct {
+	events map[string][]*ceremony.Event
+	fail   bool
+}
+
+func newMemEvents() *memEvents {
+	return &memEvents{events: make(map[string][]*ceremony.Event)}
+}
+
+func (s *memEvents) AppendCeremonyEvent(requestID string, e *ceremony.Event) error {
+	if s.fail {
+		return errors.New("storage unavailable")
+	}
+	s.events[requestID] = append(s.events[requestID], e)
+	return nil
+}
+
+func (s *memEvents) GetCeremonyEvents(requestID string) ([]*ceremony.Event, error) {
+	events, ok := s.events[requestID]
+	if !ok {
+		return nil, ceremony.ErrCeremonyNotFound
+	}
+	return events, nil
+}
+
+func testValidatorPK(b byte) types.ValidatorPK {
+	pk := make(types.ValidatorPK, 48)
+	pk[0] = b
+	return pk
+}
+
+func testKeySignMsg(t *testing.T, id byte, validatorPK types.ValidatorPK) *dkg.Message {
+	data, err := json.Marshal(map[string]interface{}{
+		"ValidatorPK": validatorPK,
+		"Operators":   []uint32{1, 2, 3, 4},
+		"Threshold":   3,
+	})
+	require.NoError(t, err)
+	return &dkg.Message{MsgType: dkg.KeySignMsgType, Identifier: dkg.RequestID{id}, Data: data}
+}
+
+// testSignedMsg is a protocol message of request carrying data
+func testSignedMsg(request byte, data string) *dkg.SignedMessage {
+	return &dkg.SignedMessage{
+		Message: &dkg.Message{MsgType: dkg.ProtocolMsgType, Identifier: dkg.RequestID{request}, Data: []byte(data)},
+		Signer:  1,
+	}
+}
+
+// recordStart records the start of msg the way the node does once it admitted it
+func recordStart(t *testing.T, tracker *ceremony.Tracker, msg *dkg.Message) error {
+	params, err := StartParams(msg)
+	require.NoError(t, err)
+	_, err = tracker.Record(requestIDOf(msg), ceremony.EventCreated, func(e *ceremony.Event) {
+		e.Operator = 1
+		e.Params = params
+	})
+	return err
+}
+
+func requestIDOf(msg *dkg.Message) string {
+	return hex.EncodeToString(msg.Identifier[:])
+}
+
+func TestMemoryGuardRunners(t *testing.T) {
+	tracker := ceremony.NewTracker(newMemEvents())
+	// room for the runners of two ceremonies of 4 operators
+	guard := NewMemoryGuard(MemoryBudget{Runners: runnerBytes(8)}, NewMessageCache(), NewScheduler(1, 0), tracker)
+
+	require.NoError(t, guard.Admit(4))
+	require.NoError(t, recordStart(t, tracker, testKeySignMsg(t, 1, testValidatorPK(1))))
+	require.Equal(t, runnerBytes(4), guard.Usage().RunnerBytes)
+	// one more fits the budget exactly
+	require.NoError(t, guard.Admit(4))
+	require.NoError(t, recordStart(t, tracker, testKeySignMsg(t, 2, testValidatorPK(1))))
+
+	var budgetErr *ErrMemoryBudget
+	require.ErrorAs(t, guard.Admit(4), &budgetErr)
+	require.Equal(t, 2, budgetErr.Usage.Running)
+	require.Equal(t, runnerBytes(8), budgetErr.Usage.RunnerBytes)
+	require.Contains(t, budgetErr.Reason, "2 running ceremonies")
+	require.Equal(t, int64(1), guard.refused)
+
+	// a finished ceremony gives its room back
+	_, err := tracker.Record(requestIDOf(testKeySignMsg(t, 1, nil)), ceremony.EventAborted, nil)
+	require.NoError(t, err)
+	require.NoError(t, guard.Admit(4))
+	require.Error(t, guard.Admit(5))
+}
+
+func TestMemoryGuardMessages(t *testing.T) {
+	cache := NewMessageCache()
+	msg := testSignedMsg(1, "a1")
+	size := cachedBytes(t, msg)
+	guard := NewMemoryGuard(MemoryBudget{Messages: 2 * size}, cache, nil, ceremony.NewTracker(newMemEvents()))
+
+	require.NoError(t, cache.Add("a", msg))
+	require.NoError(t, guard.Admit(4))
+	// a cache at its budget refuses
+	require.NoError(t, cache.Add("a", msg))
+	var budgetErr *ErrMemoryBudget
+	require.ErrorAs(t, guard.Admit(4), &budgetErr)
+	require.Equal(t, 2*size, budgetErr.Usage.MessageBytes)
+	require.Contains(t, budgetErr.Reason, "message cache")
+
+	cache.Observe(&ceremony.Ceremony{RequestID: "a", State: ceremony.StateCompleted}, nil)
+	require.NoError(t, guard.Admit(4))
+}
+
+func TestMemoryGuardUnbounded(t *testing.T) {
+	cache := NewMessageCache()
+	require.NoError(t, cache.Add("a", testSignedMsg(1, "a1")))
+	guard := NewMemoryGuard(MemoryBudget{}, cache, nil, ceremony.NewTracker(newMemEvents()))
+	require.NoError(t, guard.Admit(100))
+	require.Zero(t, guard.refused)
+}
@@ -0,0 +1,128 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleObserve registers this node as observer of the ceremony started by the
+// start message in the body, the same message the committee gets on /consume
+func (h *ApiHandler) HandleObserve(obs *observer.Observer) func(*gin.Context) {
+	return func(c *gin.Context) {
+		signedMsg, _, err := readSignedMessage(c)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse data from request body", err)
+			return
+		}
+		if !isStartMsg(signedMsg.Message.MsgType) {
+			h.respondError(c, http.StatusBadRequest, "not a start message", errors.New("observers are invited with the start message of a ceremony"))
+			return
+		}
+		if err := obs.Watch(signedMsg); err != nil {
+			h.respondError(c, http.StatusBadRequest, "can't observe ceremony", err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "observing ceremony",
+			"error":   nil,
+		})
+	}
+}
+
+// HandleGetAttestation returns the signed attestation of an observed ceremony,
+// 202 while the ceremony is running
+func (h *ApiHandler) HandleGetAttestation(obs *observer.Observer) func(*gin.Context) {
+	return func(c *gin.Context) {
+		attestation, err := obs.Attestation(c.Param("request_id"))
+		if errors.Is(err, observer.ErrPending) {
+			c.JSON(http.StatusAccepted, gin.H{
+				"message": "ceremony still running",
+				"error":   nil,
+			})
+			return
+		} else if errors.Is(err, observer.ErrNotObserved) {
+			h.respondError(c, http.StatusNotFound, "ceremony not observed", err)
+			return
+		} else if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load attestation", err)
+			return
+		}
+		c.JSON(http.StatusOK, attestation)
+	}
+}
+
+// ObservedOnly takes the messages of ceremonies this node observes out of
+// /consume, they go to the transcript instead of the dkg node
+func (h *ApiHandler) ObservedOnly(obs *observer.Observer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		signedMsg, data, err := readSignedMessage(c)
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		if err != nil || !obs.Watching(hex.EncodeToString(signedMsg.Message.Identifier[:])) {
+			c.Next()
+			return
+		}
+
+		if err := obs.Observe(signedMsg); err != nil {
+			h.logger.Warnf("ObservedOnly: message of operator %d not added to transcript: %v", signedMsg.Signer, err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"message": "observer refused message",
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusOK, gin.H{
+			"message": "message added to transcript",
+			"error":   nil,
+		})
+	}
+}
+
+// readSignedMessage decodes the dkg message in the body, it also returns the
+// raw body so it can be read again
+func readSignedMessage(c *gin.Context) (*dkg.SignedMessage, []byte, error) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	ssvMsg := &types.SSVMessage{}
+	if err := ssvMsg.Decode(data); err != nil {
+		return nil, data, err
+	}
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(ssvMsg.Data); err != nil {
+		return nil, data, err
+	}
+	if signedMsg.Message == nil {
+		return nil, data, errors.New("missing message")
+	}
+	return signedMsg, data, nil
+}
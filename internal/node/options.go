@@ -0,0 +1,42 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"errors"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/gin-gonic/gin"
+)
+
+// sealedStartKey marks the gin context of a start message that reached the
+// node sealed to its operator key
+const sealedStartKey = "sealed_start"
+
+// checkOptions refuses the options of a start message the node can't honor
+// for it, encryption=on needs the start message sealed
+func checkOptions(c *gin.Context, options ceremony.Options) error {
+	if options.Get(ceremony.OptionEncryption) == "on" && !c.GetBool(sealedStartKey) {
+		return errors.New("ceremony option encryption=on requires a sealed start message")
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// OutboxPolicy decides how long the messages the messenger refused are
+// retried
+type OutboxPolicy struct {
+	// RetryInterval is the wait between two attempts to publish the spooled messages
+	RetryInterval time.Duration
+	// MaxAge is how long a message is retried before it's dropped, 0 turns the
+	// outbox off and a failed publish fails the broadcast
+	MaxAge time.Duration
+}
+
+var DefaultOutboxPolicy = OutboxPolicy{RetryInterval: 2 * time.Second, MaxAge: 10 * time.Minute}
+
+func (p OutboxPolicy) Enabled() bool {
+	return p.MaxAge > 0
+}
+
+func (p OutboxPolicy) String() string {
+	if !p.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("retry=%s max_age=%s", p.RetryInterval, p.MaxAge)
+}
+
+// Outbox publishes the messages of the ceremonies to the messenger and spools
+// those it refuses in the node storage, so a relay outage delays a ceremony
+// instead of losing its messages. Messages of a topic are published in the
+// order they were broadcast: once one is spooled, the next ones of its topic
+// queue behind it until the retries published it.
+type Outbox struct {
+	policy  OutboxPolicy
+	network dkg.Network
+	storage *storage.Storage
+	logger  *logrus.Logger
+	now     func() time.Time
+
+	mu  sync.Mutex
+	seq uint64
+	// topics holds the topics with spooled messages, and those being published
+	topics map[string]*outboxTopic
+
+	spooled int64
+	dropped int64
+}
+
+type outboxTopic struct {
+	mu      sync.Mutex
+	pending int
+}
+
+// NewOutbox picks up the messages spooled before the node restarted
+func NewOutbox(policy OutboxPolicy, network dkg.Network, s *storage.Storage, logger *logrus.Logger) (*Outbox, error) {
+	if policy.RetryInterval <= 0 {
+		policy.RetryInterval = DefaultOutboxPolicy.RetryInterval
+	}
+	o := &Outbox{policy: policy, network: network, storage: s, logger: logger, now: time.Now, topics: make(map[string]*outboxTopic)}
+	entries, err := s.ListOutbox("")
+	if err != nil {
+		return nil, fmt.Errorf("NewOutbox: failed to load spooled messages: %w", err)
+	}
+	for _, e := range entries {
+		if e.Seq > o.seq {
+			o.seq = e.Seq
+		}
+		t, ok := o.topics[e.Topic]
+		if !ok {
+			t = &outboxTopic{}
+			o.topics[e.Topic] = t
+		}
+		t.pending++
+	}
+	o.spooled = int64(len(entries))
+	if len(entries) > 0 {
+		logger.Infof("NewOutbox: %d spooled messages of %d ceremonies to publish", len(entries), len(o.topics))
+	}
+	return o, nil
+}
+
+// lockTopic locks the topic of a ceremony, it is in topics while locked
+func (o *Outbox) lockTopic(topic string) *outboxTopic {
+	for {
+		o.mu.Lock()
+		t, ok := o.topics[topic]
+		if !ok {
+			t = &outboxTopic{}
+			o.topics[topic] = t
+		}
+		o.mu.Unlock()
+
+		t.mu.Lock()
+		o.mu.Lock()
+		current := o.topics[topic] == t
+		o.mu.Unlock()
+		if current {
+			return t
+		}
+		// the topic was emptied and left topics while we waited
+		t.mu.Unlock()
+	}
+}
+
+// unlockTopic unlocks a topic, one without spooled messages leaves topics
+func (o *Outbox) unlockTopic(topic string, t *outboxTopic) {
+	if t.pending == 0 {
+		o.mu.Lock()
+		delete(o.topics, topic)
+		o.mu.Unlock()
+	}
+	t.mu.Unlock()
+}
+
+// Publish publishes msg to the messenger, or spools it when the messenger
+// refuses it or earlier messages of its ceremony are still spooled. It only
+// fails when the message couldn't be spooled either.
+func (o *Outbox) Publish(msg *dkg.SignedMessage) error {
+	if !o.policy.Enabled() {
+		return o.network.BroadcastDKGMessage(msg)
+	}
+	topic := hex.EncodeToString(msg.Message.Identifier[:])
+	t := o.lockTopic(topic)
+	defer o.unlockTopic(topic, t)
+
+	if t.pending > 0 {
+		return o.spool(t, topic, msg, nil)
+	}
+	err := o.network.BroadcastDKGMessage(msg)
+	if err == nil {
+		return nil
+	}
+	o.logger.Warnf("Outbox: failed to publish a message of request %s, spooling it: %v", topic, err)
+	if spoolErr := o.spool(t, topic, msg, err); spoolErr != nil {
+		return fmt.Errorf("%w, %v", err, spoolErr)
+	}
+	return nil
+}
+
+func (o *Outbox) spool(t *outboxTopic, topic string, msg *dkg.SignedMessage, cause error) error {
+	data, err := msg.Encode()
+	if err != nil {
+		return fmt.Errorf("spool: failed to encode message: %w", err)
+	}
+	o.mu.Lock()
+	o.seq++
+	entry := &storage.OutboxEntry{Topic: topic, Seq: o.seq, Data: data, QueuedAt: o.now().Unix()}
+	o.mu.Unlock()
+	if cause != nil {
+		entry.Attempts = 1
+		entry.LastError = cause.Error()
+	}
+	if err := o.storage.SaveOutboxEntry(entry); err != nil {
+		return fmt.Errorf("spool: failed to spool message of request %s: %w", topic, err)
+	}
+	t.pending++
+	atomic.AddInt64(&o.spooled, 1)
+	return nil
+}
+
+// Run retries the spooled messages every interval until done is closed, it
+// returns right away when the outbox is off
+func (o *Outbox) Run(done <-chan struct{}) {
+	if !o.policy.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(o.policy.RetryInterval)
+	defer ticker.Stop()
+	for {
+		o.Flush()
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes the spooled messages of every ceremony, the ceremonies in
+// parallel and the messages of one in order. A ceremony stops at its first
+// message the messenger refuses again.
+func (o *Outbox) Flush() {
+	o.mu.Lock()
+	topics := make([]string, 0, len(o.topics))
+	for topic := range o.topics {
+		topics = append(topics, topic)
+	}
+	o.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, topic := range topics {
+		wg.Add(1)
+		go func(topic string) {
+			defer wg.Done()
+			o.flushTopic(topic)
+		}(topic)
+	}
+	wg.Wait()
+}
+
+func (o *Outbox) flushTopic(topic string) {
+	t := o.lockTopic(topic)
+	defer o.unlockTopic(topic, t)
+	if t.pending == 0 {
+		return
+	}
+
+	entries, err := o.storage.ListOutbox(topic)
+	if err != nil {
+		o.logger.Errorf("Outbox: failed to load spooled messages of request %s: %v", topic, err)
+		return
+	}
+	published := 0
+	for _, e := range entries {
+		if age := o.now().Sub(time.Unix(e.QueuedAt, 0)); age > o.policy.MaxAge {
+			o.logger.Errorf("Outbox: dropping a message of request %s spooled %s ago after %d attempts: %s", topic, age.Round(time.Second), e.Attempts, e.LastError)
+			atomic.AddInt64(&o.dropped, 1)
+			o.remove(t, e)
+			continue
+		}
+		msg := &dkg.SignedMessage{}
+		if err := msg.Decode(e.Data); err != nil {
+			o.logger.Errorf("Outbox: dropping an undecodable message of request %s: %v", topic, err)
+			atomic.AddInt64(&o.dropped, 1)
+			o.remove(t, e)
+			continue
+		}
+		if err := o.network.BroadcastDKGMessage(msg); err != nil {
+			e.Attempts++
+			e.LastError = err.Error()
+			if err := o.storage.SaveOutboxEntry(e); err != nil {
+				o.logger.Warnf("Outbox: failed to record attempt of request %s: %v", topic, err)
+			}
+			return
+		}
+		o.remove(t, e)
+		published++
+	}
+	if published > 0 {
+		o.logger.Infof("Outbox: published %d spooled messages of request %s", published, topic)
+	}
+}
+
+func (o *Outbox) remove(t *outboxTopic, e *storage.OutboxEntry) {
+	if err := o.storage.DeleteOutboxEntry(e.Topic, e.Seq); err != nil {
+		o.logger.Warnf("Outbox: failed to remove spooled message of request %s: %v", e.Topic, err)
+	}
+	t.pending--
+	atomic.AddInt64(&o.spooled, -1)
+}
+
+func (o *Outbox) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "dkg_node_outbox_messages",
+			Help: "Messages the messenger refused, spooled for a retry",
+		}, func() float64 { return float64(atomic.LoadInt64(&o.spooled)) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "dkg_node_outbox_dropped_total",
+			Help: "Spooled messages dropped after the retries ran out",
+		}, func() float64 { return float64(atomic.LoadInt64(&o.dropped)) }),
+	}
+}
@@ -0,0 +1,238 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// testNetwork records the messages it broadcasts, it refuses them while
+// refuse is above zero and counts refuse down
+type testNetwork struct {
+	mu        sync.Mutex
+	refuse    int
+	published []string
+}
+
+func (n *testNetwork) StreamDKGBlame(*dkg.BlameOutput) error { return nil }
+
+func (n *testNetwork) StreamDKGOutput(map[types.OperatorID]*dkg.SignedOutput) error { return nil }
+
+func (n *testNetwork) BroadcastDKGMessage(msg *dkg.SignedMessage) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.refuse > 0 {
+		n.refuse--
+		return errors.New("messenger unavailable")
+	}
+	n.published = append(n.published, string(msg.Message.Data))
+	return nil
+}
+
+func (n *testNetwork) setRefuse(refuse int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.refuse = refuse
+}
+
+func (n *testNetwork) take() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	published := n.published
+	n.published = nil
+	return published
+}
+
+func openTestStorage(t *testing.T, dir string) (*storage.Storage, func()) {
+	opts := badger.DefaultOptions(dir).WithLogger(nil)
+	if dir == "" {
+		opts = opts.WithInMemory(true)
+	}
+	db, err := badger.Open(opts)
+	require.NoError(t, err)
+	closed := false
+	closeDB := func() {
+		if !closed {
+			closed = true
+			db.Close()
+		}
+	}
+	t.Cleanup(closeDB)
+	return storage.NewStorage(storage.NewBadgerDB(db), 1, nil), closeDB
+}
+
+func newTestOutbox(t *testing.T, s *storage.Storage, network dkg.Network) *Outbox {
+	outbox, err := NewOutbox(OutboxPolicy{RetryInterval: time.Second, MaxAge: time.Minute}, network, s, testLogger())
+	require.NoError(t, err)
+	return outbox
+}
+
+func TestOutboxPublishQueuesBehindSpooled(t *testing.T) {
+	s, _ := openTestStorage(t, "")
+	network := &testNetwork{}
+	outbox := newTestOutbox(t, s, network)
+
+	require.NoError(t, outbox.Publish(testSignedMsg(1, "a1")))
+	require.Equal(t, []string{"a1"}, network.take())
+
+	// the messenger refuses a1 and a2 goes behind it, b1 of another
+	// ceremony goes out right away
+	network.setRefuse(1)
+	require.NoError(t, outbox.Publish(testSignedMsg(1, "a2")))
+	require.NoError(t, outbox.Publish(testSignedMsg(1, "a3")))
+	require.NoError(t, outbox.Publish(testSignedMsg(2, "b1")))
+	require.Equal(t, []string{"b1"}, network.take())
+	require.Equal(t, int64(2), outbox.spooled)
+	entries, err := s.ListOutbox("")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, 1, entries[0].Attempts)
+	require.Equal(t, "messenger unavailable", entries[0].LastError)
+	require.Equal(t, 0, entries[1].Attempts)
+
+	outbox.Flush()
+	require.Equal(t, []string{"a2", "a3"}, network.take())
+	require.Equal(t, int64(0), outbox.spooled)
+	require.Empty(t, outbox.topics)
+	entries, err = s.ListOutbox("")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestOutboxFlushStopsAtRefusal(t *testing.T) {
+	s, _ := openTestStorage(t, "")
+	network := &testNetwork{}
+	outbox := newTestOutbox(t, s, network)
+
+	network.setRefuse(1)
+	for _, data := range []string{"a1", "a2", "a3"} {
+		require.NoError(t, outbox.Publish(testSignedMsg(1, data)))
+	}
+	require.Empty(t, network.take())
+
+	// a1 goes out, a2 is refused again and a3 waits behind it
+	outbox.network = &refuseNth{testNetwork: network, n: 2}
+	outbox.Flush()
+	require.Equal(t, []string{"a1"}, network.take())
+	entries, err := s.ListOutbox("")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, 1, entries[0].Attempts)
+	require.Equal(t, "messenger unavailable", entries[0].LastError)
+
+	// the next flush picks up from a2
+	outbox.Flush()
+	require.Equal(t, []string{"a2", "a3"}, network.take())
+	require.Equal(t, int64(0), outbox.spooled)
+}
+
+// refuseNth refuses the nth message it is asked to broadcast
+type refuseNth struct {
+	*testNetwork
+	n     int
+	calls int
+}
+
+func (n *refuseNth) BroadcastDKGMessage(msg *dkg.SignedMessage) error {
+	n.calls++
+	if n.calls == n.n {
+		return errors.New("messenger unavailable")
+	}
+	return n.testNetwork.BroadcastDKGMessage(msg)
+}
+
+func TestOutboxDropsExpired(t *testing.T) {
+	s, _ := openTestStorage(t, "")
+	network := &testNetwork{refuse: 2}
+	outbox := newTestOutbox(t, s, network)
+	now := time.Unix(1700000000, 0)
+	outbox.now = func() time.Time { return now }
+
+	require.NoError(t, outbox.Publish(testSignedMsg(1, "a1")))
+	now = now.Add(30 * time.Second)
+	require.NoError(t, outbox.Publish(testSignedMsg(2, "b1")))
+
+	// a1 is past MaxAge and dropped without a retry, b1 is still retried
+	now = now.Add(45 * time.Second)
+	network.setRefuse(0)
+	outbox.Flush()
+	require.Equal(t, []string{"b1"}, network.take())
+	require.Equal(t, int64(1), outbox.dropped)
+	require.Equal(t, int64(0), outbox.spooled)
+	entries, err := s.ListOutbox("")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestNewOutboxReloadsSpool(t *testing.T) {
+	dir := t.TempDir()
+	s, closeDB := openTestStorage(t, dir)
+	network := &testNetwork{refuse: 2}
+	outbox := newTestOutbox(t, s, network)
+	require.NoError(t, outbox.Publish(testSignedMsg(1, "a1")))
+	require.NoError(t, outbox.Publish(testSignedMsg(1, "a2")))
+	require.NoError(t, outbox.Publish(testSignedMsg(2, "b1")))
+	closeDB()
+
+	// after the restart the spooled messages are picked up again, new ones
+	// of their ceremony queue behind them and the sequence carries on
+	s, _ = openTestStorage(t, dir)
+	network = &testNetwork{}
+	outbox = newTestOutbox(t, s, network)
+	require.Equal(t, int64(3), outbox.spooled)
+	require.Equal(t, uint64(3), outbox.seq)
+	require.NoError(t, outbox.Publish(testSignedMsg(1, "a3")))
+	require.Empty(t, network.take())
+
+	outbox.Flush()
+	published := network.take()
+	require.ElementsMatch(t, []string{"a1", "a2", "a3", "b1"}, published)
+	var ceremonyA []string
+	for _, data := range published {
+		if data[0] == 'a' {
+			ceremonyA = append(ceremonyA, data)
+		}
+	}
+	require.Equal(t, []string{"a1", "a2", "a3"}, ceremonyA)
+	require.Equal(t, int64(0), outbox.spooled)
+}
+
+func TestOutboxOff(t *testing.T) {
+	s, _ := openTestStorage(t, "")
+	network := &testNetwork{refuse: 1}
+	outbox, err := NewOutbox(OutboxPolicy{}, network, s, testLogger())
+	require.NoError(t, err)
+
+	require.Error(t, outbox.Publish(testSignedMsg(1, "a1")))
+	entries, err := s.ListOutbox("")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
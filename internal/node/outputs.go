@@ -0,0 +1,144 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type CommitteeOutputStore interface {
+	// UpdateCommitteeOutputs applies update to the stored outputs of requestID
+	// in one transaction, starting from empty outputs
+	UpdateCommitteeOutputs(requestID string, update func(*observer.CommitteeOutputs) error) error
+	// GetCommitteeOutputs returns observer.ErrNoCommitteeOutputs when no outputs were stored for requestID
+	GetCommitteeOutputs(requestID string) (*observer.CommitteeOutputs, error)
+}
+
+// OutputRecorder stores the signed output of every operator of a ceremony as
+// it is broadcast on the topic, this node's own and the ones of its peers, so
+// any node of the committee can hand out the whole result after the messenger
+// lost its copy
+type OutputRecorder struct {
+	keys    observer.KeyLookup
+	store   CommitteeOutputStore
+	tracker *ceremony.Tracker
+	logger  *logrus.Logger
+}
+
+func NewOutputRecorder(keys observer.KeyLookup, store CommitteeOutputStore, tracker *ceremony.Tracker, logger *logrus.Logger) *OutputRecorder {
+	return &OutputRecorder{keys: keys, store: store, tracker: tracker, logger: logger}
+}
+
+// Add stores the output carried by msg, other messages are ignored
+func (r *OutputRecorder) Add(msg *dkg.SignedMessage) {
+	if r == nil || msg.Message.MsgType != dkg.OutputMsgType {
+		return
+	}
+	requestID := hex.EncodeToString(msg.Message.Identifier[:])
+	output := &dkg.SignedOutput{}
+	if err := output.Decode(msg.Message.Data); err != nil {
+		r.logger.Warnf("OutputRecorder: failed to decode output of operator %d for request %s: %v", msg.Signer, requestID, err)
+		return
+	}
+
+	var operators []types.OperatorID
+	canary := false
+	if cer, err := r.tracker.Get(requestID); err == nil && cer.Params != nil {
+		operators = cer.Params.Operators
+		canary = cer.IsCanary()
+	}
+	err := r.store.UpdateCommitteeOutputs(requestID, func(outputs *observer.CommitteeOutputs) error {
+		if len(outputs.Operators) == 0 {
+			outputs.Operators = operators
+		}
+		outputs.Canary = outputs.Canary || canary
+		return outputs.Add(output, r.keys)
+	})
+	if err != nil {
+		r.logger.Warnf("OutputRecorder: output of operator %d not stored for request %s: %v", msg.Signer, requestID, err)
+		return
+	}
+	r.logger.Debugf("OutputRecorder: stored output of operator %d for request %s", output.Signer, requestID)
+}
+
+// HandleGetCommitteeOutputs returns the outputs of every operator this node
+// received for a ceremony, checked against each other and the registry keys
+func (h *ApiHandler) HandleGetCommitteeOutputs(store CommitteeOutputStore, keys observer.KeyLookup) func(*gin.Context) {
+	return func(c *gin.Context) {
+		outputs, err := store.GetCommitteeOutputs(c.Param("request_id"))
+		if errors.Is(err, observer.ErrNoCommitteeOutputs) {
+			h.respondError(c, http.StatusNotFound, "no committee outputs for ceremony", err)
+			return
+		} else if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load committee outputs", err)
+			return
+		}
+		c.JSON(http.StatusOK, outputs.Report(keys))
+	}
+}
+
+// HandleGetApproval signs this node's approval of the consolidated result of
+// a ceremony, refused while the committee outputs it holds are incomplete or
+// don't agree
+func (h *ApiHandler) HandleGetApproval(store CommitteeOutputStore, keys observer.KeyLookup, operatorID types.OperatorID, sk *rsa.PrivateKey) func(*gin.Context) {
+	return func(c *gin.Context) {
+		requestID := c.Param("request_id")
+		outputs, err := store.GetCommitteeOutputs(requestID)
+		if errors.Is(err, observer.ErrNoCommitteeOutputs) {
+			h.respondError(c, http.StatusNotFound, "no committee outputs for ceremony", err)
+			return
+		} else if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load committee outputs", err)
+			return
+		}
+		if outputs.Canary {
+			h.respondError(c, http.StatusConflict, "ceremony is a canary keygen", errors.New("the result of a canary keygen never backs a validator"))
+			return
+		}
+		if report := outputs.Report(keys); !report.Consistent {
+			h.respondError(c, http.StatusConflict, "committee outputs are not consistent", fmt.Errorf("%d findings: %s", len(report.Findings), strings.Join(report.Findings, "; ")))
+			return
+		}
+		approval, err := observer.Approve(requestID, operatorID, outputs.Outputs)
+		if err != nil {
+			h.respondError(c, http.StatusConflict, "can't approve result", err)
+			return
+		}
+		if err := approval.Sign(sk); err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to sign approval", err)
+			return
+		}
+		c.JSON(http.StatusOK, approval)
+	}
+}
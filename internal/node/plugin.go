@@ -0,0 +1,133 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/plugin"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// pluginTimeout bounds the post-output plugins of one ceremony together
+const pluginTimeout = 5 * time.Minute
+
+// checkPlugins runs the pre-init plugins on a start message
+func (p *StartPolicy) checkPlugins(ctx context.Context, msg *dkg.Message, canary *ceremony.Canary, options ceremony.Options) error {
+	if !p.Plugins.Has(plugin.HookPreInit) {
+		return nil
+	}
+	params, err := StartParams(msg)
+	if err != nil {
+		return err
+	}
+	params.Canary = canary
+	params.Options = options
+	event := &plugin.Event{
+		Hook:      plugin.HookPreInit,
+		RequestID: hex.EncodeToString(msg.Identifier[:]),
+		Params:    params,
+	}
+	if msg.MsgType == dkg.InitMsgType {
+		init := &dkg.Init{}
+		if err := init.Decode(msg.Data); err != nil {
+			return err
+		}
+		event.WithdrawalCredentials = hex.EncodeToString(init.WithdrawalCredentials)
+		event.ForkVersion = hex.EncodeToString(init.Fork[:])
+	}
+	return p.Plugins.Check(ctx, event)
+}
+
+func (h *ApiHandler) respondPlugin(c *gin.Context, err error) {
+	var refused *plugin.ErrRefused
+	if errors.As(err, &refused) {
+		h.logger.Warnf("HandleConsume: start message %v", err)
+		c.JSON(http.StatusForbidden, gin.H{
+			"message": "start message refused by node plugin",
+			"error":   err.Error(),
+			"code":    "plugin_refused",
+		})
+		return
+	}
+	h.logger.Errorf("HandleConsume: pre-init plugin failed: %v", err)
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"message": "node plugin failed, start message refused",
+		"error":   err.Error(),
+		"code":    "plugin_failed",
+	})
+}
+
+// PluginNotifier runs the post-output plugins once a ceremony ends, and the
+// progress plugins on every event of the ceremonies started with
+// progress-events=on
+type PluginNotifier struct {
+	hooks  *plugin.Hooks
+	logger *logrus.Logger
+}
+
+func NewPluginNotifier(hooks *plugin.Hooks, logger *logrus.Logger) *PluginNotifier {
+	return &PluginNotifier{hooks: hooks, logger: logger}
+}
+
+// Observe is a ceremony.Listener
+func (n *PluginNotifier) Observe(c *ceremony.Ceremony, e *ceremony.Event) {
+	if c.Option(ceremony.OptionProgressEvents) == "on" && n.hooks.Has(plugin.HookProgress) {
+		n.notify(&plugin.Event{
+			Hook:      plugin.HookProgress,
+			RequestID: c.RequestID,
+			Params:    c.Params,
+			Progress:  &plugin.Progress{State: c.State, Event: e},
+		})
+	}
+
+	switch e.Type {
+	case ceremony.EventCompleted, ceremony.EventAborted, ceremony.EventBlamed:
+	default:
+		return
+	}
+	if !n.hooks.Has(plugin.HookPostOutput) {
+		return
+	}
+	event := &plugin.Event{
+		Hook:      plugin.HookPostOutput,
+		RequestID: c.RequestID,
+		Params:    c.Params,
+		Outcome:   &plugin.Outcome{State: c.State, ValidatorPK: e.ValidatorPK, Details: e.Details},
+	}
+	n.notify(event)
+}
+
+func (n *PluginNotifier) notify(event *plugin.Event) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+		defer cancel()
+		n.hooks.Notify(ctx, event)
+	}()
+}
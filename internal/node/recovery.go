@@ -0,0 +1,214 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/recovery"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/gin-gonic/gin"
+)
+
+// RecoveryCombineRequest hands a helper the splits of every helper
+type RecoveryCombineRequest struct {
+	Bundle *recovery.Bundle  `json:"bundle"`
+	Splits []*recovery.Split `json:"splits"`
+}
+
+// RecoveryImportRequest hands the recovering node the contributions of every helper
+type RecoveryImportRequest struct {
+	Bundle        *recovery.Bundle         `json:"bundle"`
+	Contributions []*recovery.Contribution `json:"contributions"`
+}
+
+// HandleRecoverySplit is the first step of a helper in a share recovery
+func (h *ApiHandler) HandleRecoverySplit(s *storage.Storage, operatorKey *rsa.PrivateKey, keys recovery.KeyLookup) func(*gin.Context) {
+	return func(c *gin.Context) {
+		bundle := &recovery.Bundle{}
+		if err := c.ShouldBindJSON(bundle); err != nil || bundle.Request == nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse recovery request", bindError(err))
+			return
+		}
+		output, status, err := h.helperShare(s, bundle)
+		if err != nil {
+			h.auditRecovery(s, "split", bundle, err)
+			h.respondError(c, status, "no share to help recover from", err)
+			return
+		}
+
+		split, err := recovery.NewSplit(bundle, s.OperatorID(), operatorKey, output, keys)
+		h.auditRecovery(s, "split", bundle, err)
+		if err != nil {
+			h.respondError(c, recoveryStatus(err), "refused to split share for recovery", err)
+			return
+		}
+		c.JSON(http.StatusOK, split)
+	}
+}
+
+// HandleRecoveryCombine is the second step of a helper in a share recovery
+func (h *ApiHandler) HandleRecoveryCombine(s *storage.Storage, operatorKey *rsa.PrivateKey, keys recovery.KeyLookup) func(*gin.Context) {
+	return func(c *gin.Context) {
+		req := &RecoveryCombineRequest{}
+		if err := c.ShouldBindJSON(req); err != nil || req.Bundle == nil || req.Bundle.Request == nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse recovery combine request", bindError(err))
+			return
+		}
+		output, status, err := h.helperShare(s, req.Bundle)
+		if err != nil {
+			h.auditRecovery(s, "combine", req.Bundle, err)
+			h.respondError(c, status, "no share to help recover from", err)
+			return
+		}
+
+		contribution, err := recovery.Combine(req.Bundle, s.OperatorID(), operatorKey, output, req.Splits, keys)
+		h.auditRecovery(s, "combine", req.Bundle, err)
+		if err != nil {
+			h.respondError(c, recoveryStatus(err), "refused to combine recovery splits", err)
+			return
+		}
+		c.JSON(http.StatusOK, contribution)
+	}
+}
+
+// HandleRecoveryImport rebuilds the share of this operator from the
+// contributions of the helpers. It refuses to overwrite a share it still has.
+func (h *ApiHandler) HandleRecoveryImport(s *storage.Storage, operatorKey *rsa.PrivateKey, keys recovery.KeyLookup) func(*gin.Context) {
+	return func(c *gin.Context) {
+		req := &RecoveryImportRequest{}
+		if err := c.ShouldBindJSON(req); err != nil || req.Bundle == nil || req.Bundle.Request == nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse recovery import request", bindError(err))
+			return
+		}
+		r := req.Bundle.Request
+		if r.Operator != s.OperatorID() {
+			err := fmt.Errorf("request recovers operator %d, this node runs %d", r.Operator, s.OperatorID())
+			h.auditRecovery(s, "import", req.Bundle, err)
+			h.respondError(c, http.StatusBadRequest, "recovery is for a different operator", err)
+			return
+		}
+		vk, err := hexenc.ParseValidatorPK(r.ValidatorPK)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid validator pk", err)
+			return
+		}
+		if _, err := s.GetKeyGenOutput(vk); err == nil || errors.Is(err, storage.ErrShareHandedOver) {
+			if err == nil {
+				err = fmt.Errorf("share for validator %s is present", r.ValidatorPK)
+			}
+			h.auditRecovery(s, "import", req.Bundle, err)
+			h.respondError(c, http.StatusConflict, "this node doesn't need to recover the share", err)
+			return
+		}
+
+		output, err := recovery.Recover(req.Bundle, operatorKey, req.Contributions, keys)
+		if err != nil {
+			h.auditRecovery(s, "import", req.Bundle, err)
+			h.respondError(c, recoveryStatus(err), "failed to recover share", err)
+			return
+		}
+		if err := s.SaveKeyGenOutput(output); err != nil {
+			h.auditRecovery(s, "import", req.Bundle, err)
+			h.respondError(c, http.StatusInternalServerError, "failed to store recovered share", err)
+			return
+		}
+		h.auditRecovery(s, "import", req.Bundle, nil)
+
+		h.logger.Infof("HandleRecoveryImport: recovered share for validator %s from helpers %v", r.ValidatorPK, r.Helpers)
+		c.JSON(http.StatusOK, gin.H{
+			"message": fmt.Sprintf("share for validator %s recovered successfully", r.ValidatorPK),
+			"error":   nil,
+		})
+	}
+}
+
+// HandleGetRecovery returns the audit log of the steps this node took in a recovery
+func (h *ApiHandler) HandleGetRecovery(s *storage.Storage) func(*gin.Context) {
+	return func(c *gin.Context) {
+		audits, err := s.ListRecoveryAudits(c.Param("request_id"))
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load recovery audit log", err)
+			return
+		}
+		if len(audits) == 0 {
+			h.respondError(c, http.StatusNotFound, "recovery not found", fmt.Errorf("no steps recorded for request %s", c.Param("request_id")))
+			return
+		}
+		c.JSON(http.StatusOK, audits)
+	}
+}
+
+func (h *ApiHandler) helperShare(s *storage.Storage, bundle *recovery.Bundle) (*dkg.KeyGenOutput, int, error) {
+	vk, err := hexenc.ParseValidatorPK(bundle.Request.ValidatorPK)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid validator pk: %w", err)
+	}
+	output, err := s.GetKeyGenOutput(vk)
+	if err != nil {
+		return nil, http.StatusNotFound, fmt.Errorf("no share found for validator %s: %w", bundle.Request.ValidatorPK, err)
+	}
+	return output, http.StatusOK, nil
+}
+
+// auditRecovery records a recovery step in the node storage and the log
+func (h *ApiHandler) auditRecovery(s *storage.Storage, step string, bundle *recovery.Bundle, err error) {
+	r := bundle.Request
+	audit := &storage.RecoveryAudit{
+		RequestID:   r.ID,
+		Step:        step,
+		ValidatorPK: r.ValidatorPK,
+		Operator:    r.Operator,
+		Helpers:     r.Helpers,
+		Approvers:   bundle.Approvers(),
+		At:          time.Now().UTC().UnixNano(),
+	}
+	if err != nil {
+		audit.Error = err.Error()
+		h.logger.Warnf("recovery %s: refused %s for operator %d of validator %s: %v", r.ID, step, r.Operator, r.ValidatorPK, err)
+	} else {
+		h.logger.Infof("recovery %s: %s for operator %d of validator %s with helpers %v approved by %v", r.ID, step, r.Operator, r.ValidatorPK, r.Helpers, audit.Approvers)
+	}
+	if err := s.SaveRecoveryAudit(audit); err != nil {
+		h.logger.Errorf("recovery %s: failed to store audit record: %v", r.ID, err)
+	}
+}
+
+func recoveryStatus(err error) int {
+	if errors.Is(err, recovery.ErrNotApproved) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func bindError(err error) error {
+	if err == nil {
+		return fmt.Errorf("request is missing")
+	}
+	return err
+}
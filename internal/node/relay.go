@@ -0,0 +1,99 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/gin-gonic/gin"
+)
+
+// RelayPolicy decides which deliveries must be signed by the messenger
+type RelayPolicy struct {
+	// Recipient is the name this node is subscribed with, its operator id
+	Recipient string
+	// Keys the messenger may have signed with, a primary and its standby or a
+	// key being rotated
+	Keys []ed25519.PublicKey
+	// MaxAge of a delivery, messengerclient.DefaultRelayMaxAge when zero
+	MaxAge time.Duration
+	// Require rejects every unsigned delivery, otherwise only sealed and
+	// relayed start messages and those of ceremonies held to protocol
+	// version 2 have to be signed
+	Require bool
+}
+
+// RelayOnly rejects deliveries that aren't signed by the messenger. Only the
+// messenger relays round messages and sealed or relayed start messages, a
+// post of those without its signature is spoofed. Plain start messages posted
+// straight by the initiator are left to the start policy.
+func (h *ApiHandler) RelayOnly(policy *RelayPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to read request body", err)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+
+		// sealed and relayed starts only come from the messenger, always signed
+		relayedStart := c.Request.URL.Path == messenger.SealedStartPath || c.Request.URL.Path == messenger.RelayedStartPath
+		required := policy.Require || relayedStart
+		if !relayedStart {
+			signedMsg, _, err := readSignedMessage(c)
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+			if err == nil && isStartMsg(signedMsg.Message.MsgType) {
+				c.Next()
+				return
+			}
+			if err == nil && !required {
+				required = h.relayRequired(hex.EncodeToString(signedMsg.Message.Identifier[:]))
+			}
+		}
+		if !required {
+			c.Next()
+			return
+		}
+
+		maxAge := policy.MaxAge
+		if maxAge == 0 {
+			maxAge = messengerclient.DefaultRelayMaxAge
+		}
+		if err := messengerclient.VerifyDelivery(c.Request.Header, c.Request.URL.Path, policy.Recipient, data, policy.Keys, time.Now(), maxAge); err != nil {
+			h.logger.Warnf("RelayOnly: refused delivery to %s from %s: %v", c.Request.URL.Path, c.ClientIP(), err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "delivery isn't signed by the messenger",
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayOnlyRequiresSignedRelayedStarts(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	h := New(testLogger(), nil)
+
+	for _, keys := range [][]ed25519.PublicKey{{pk}, nil} {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		// the default policy doesn't require signed deliveries
+		relayOnly := h.RelayOnly(&RelayPolicy{Recipient: "1", Keys: keys})
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		r.POST(messenger.SealedStartPath, relayOnly, ok)
+		r.POST(messenger.RelayedStartPath, relayOnly, ok)
+
+		for _, path := range []string{messenger.SealedStartPath, messenger.RelayedStartPath} {
+			body := []byte("start")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+			require.Equal(t, http.StatusUnauthorized, w.Code, path)
+
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+			messengerclient.SignDelivery(req, sk, "1", "topic", body, time.Now())
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if keys == nil {
+				// without a relay key nothing is taken
+				require.Equal(t, http.StatusUnauthorized, w.Code, path)
+			} else {
+				require.Equal(t, http.StatusOK, w.Code, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,526 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// MessageCache keeps the messages this node broadcast for each running
+// ceremony so a peer that missed one can ask for it again, and the hashes of
+// the messages it received so the messenger only sends back missing ones
+type MessageCache struct {
+	mu       sync.Mutex
+	messages map[string]map[string][][]byte
+	received map[string]map[string]bool
+	// sizes are the bytes cached for each ceremony, total their sum
+	sizes map[string]int64
+	total int64
+}
+
+func NewMessageCache() *MessageCache {
+	return &MessageCache{
+		messages: make(map[string]map[string][][]byte),
+		received: make(map[string]map[string]bool),
+		sizes:    make(map[string]int64),
+	}
+}
+
+// Bytes are the bytes of the cached messages and received hashes
+func (c *MessageCache) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+func (c *MessageCache) grow(requestID string, size int) {
+	c.sizes[requestID] += int64(size)
+	c.total += int64(size)
+}
+
+// Add stores msg encoded the way /consume expects it
+func (c *MessageCache) Add(requestID string, msg *dkg.SignedMessage) error {
+	signedMsgBytes, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+	ssvMsgBytes, err := (&types.SSVMessage{MsgType: types.DKGMsgType, Data: signedMsgBytes}).Encode()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rounds, ok := c.messages[requestID]
+	if !ok {
+		rounds = make(map[string][][]byte)
+		c.messages[requestID] = rounds
+	}
+	round := messageRound(msg.Message)
+	rounds[round] = append(rounds[round], ssvMsgBytes)
+	c.grow(requestID, len(ssvMsgBytes))
+	return nil
+}
+
+func (c *MessageCache) Get(requestID, round string) [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.messages[requestID][round]
+}
+
+// MarkReceived records a processed ssv message of a ceremony
+func (c *MessageCache) MarkReceived(requestID string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hashes, ok := c.received[requestID]
+	if !ok {
+		hashes = make(map[string]bool)
+		c.received[requestID] = hashes
+	}
+	hash := messenger.MessageHash(data)
+	if !hashes[hash] {
+		hashes[hash] = true
+		c.grow(requestID, len(hash))
+	}
+}
+
+// Received returns the messenger hashes of the messages processed for a ceremony
+func (c *MessageCache) Received(requestID string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hashes := make([]string, 0, len(c.received[requestID]))
+	for hash := range c.received[requestID] {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// Observe is a ceremony.Listener dropping the messages of finished ceremonies
+func (c *MessageCache) Observe(cer *ceremony.Ceremony, e *ceremony.Event) {
+	if !cer.State.IsTerminal() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.messages, cer.RequestID)
+	delete(c.received, cer.RequestID)
+	c.total -= c.sizes[cer.RequestID]
+	delete(c.sizes, cer.RequestID)
+}
+
+// ResendRequest asks a peer for the messages it broadcast for a round, it is
+// signed with the operator key of the requester
+type ResendRequest struct {
+	RequestID string           `json:"request_id"`
+	Round     string           `json:"round"`
+	Requester types.OperatorID `json:"requester"`
+	Time      int64            `json:"time"`
+	Signature []byte           `json:"signature,omitempty"`
+}
+
+func (r *ResendRequest) Root() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	byts, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(byts)
+	return h[:], nil
+}
+
+type ResendResponse struct {
+	// Messages are hex encoded ssv messages ready for /consume
+	Messages []string `json:"messages"`
+}
+
+// resendMaxAge bounds how old a signed re-request can be, a captured one can't be replayed later
+const resendMaxAge = 5 * time.Minute
+
+// HandleResend returns the cached messages of this node for a round to a
+// participant of the ceremony
+func (h *ApiHandler) HandleResend(s *storage.Storage, cache *MessageCache) func(*gin.Context) {
+	return func(c *gin.Context) {
+		req := &ResendRequest{}
+		if err := c.ShouldBindJSON(req); err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse resend request", err)
+			return
+		}
+		if age := time.Since(time.Unix(req.Time, 0)); age > resendMaxAge || age < -resendMaxAge {
+			h.respondError(c, http.StatusBadRequest, "resend request expired", fmt.Errorf("request is %s old", age))
+			return
+		}
+
+		_, operator, err := s.GetDKGOperator(req.Requester)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load requester public key", err)
+			return
+		}
+		root, _ := req.Root()
+		if !types.Verify(operator.EncryptionPubKey, root, req.Signature) {
+			h.respondError(c, http.StatusUnauthorized, "invalid resend request signature", fmt.Errorf("signature doesn't match operator %d", req.Requester))
+			return
+		}
+
+		cer, err := h.tracker.Get(req.RequestID)
+		if errors.Is(err, ceremony.ErrCeremonyNotFound) {
+			h.respondError(c, http.StatusNotFound, "ceremony not found", err)
+			return
+		} else if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load ceremony", err)
+			return
+		}
+		if !isParticipant(cer, req.Requester) {
+			h.respondError(c, http.StatusForbidden, "requester isn't part of the ceremony", fmt.Errorf("operator %d", req.Requester))
+			return
+		}
+
+		messages := cache.Get(req.RequestID, req.Round)
+		if len(messages) == 0 {
+			h.respondError(c, http.StatusNotFound, "no message cached for round", fmt.Errorf("request %s round %s", req.RequestID, req.Round))
+			return
+		}
+		resp := &ResendResponse{}
+		for _, msg := range messages {
+			resp.Messages = append(resp.Messages, hex.EncodeToString(msg))
+		}
+		h.logger.Infof("HandleResend: re-sent %d %s messages of request %s to operator %d", len(messages), req.Round, req.RequestID, req.Requester)
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func isParticipant(cer *ceremony.Ceremony, operatorID types.OperatorID) bool {
+	if cer.Params == nil {
+		return false
+	}
+	for _, ids := range [][]types.OperatorID{cer.Params.Operators, cer.Params.OldOperators} {
+		for _, id := range ids {
+			if id == operatorID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PeerDirectory returns the node address of an operator
+type PeerDirectory func(types.OperatorID) (string, error)
+
+// MessengerPeers looks peers up in the nodes registered with the messenger
+func MessengerPeers(client *messenger.Client) PeerDirectory {
+	return func(operatorID types.OperatorID) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		topic, err := client.GetTopicContext(ctx, messenger.DefaultTopic)
+		if err != nil {
+			return "", err
+		}
+		subscriber, ok := topic.Subscribers[strconv.Itoa(int(operatorID))]
+		if !ok {
+			return "", fmt.Errorf("operator %d isn't registered with the messenger", operatorID)
+		}
+		return subscriber.SrvAddr, nil
+	}
+}
+
+// Rerequester asks peers again for the round messages this node is missing,
+// every Interval while the ceremony stays in the phase. A peer that doesn't
+// deliver after Retries attempts is recorded as unresponsive, the phase
+// timeout of the watchdog still decides when the ceremony gives up.
+type Rerequester struct {
+	Interval time.Duration
+	Retries  int
+	// Sync, when set, catches up on the ceremony topic before peers are asked
+	// one by one, it returns the number of messages processed
+	Sync func(requestID string) (int, error)
+
+	tracker *ceremony.Tracker
+	process func(*types.SSVMessage) error
+	self    types.OperatorID
+	key     *rsa.PrivateKey
+	peers   PeerDirectory
+	client  *http.Client
+	logger  *logrus.Logger
+
+	mu      sync.Mutex
+	pending map[string]*rerequest
+}
+
+type rerequest struct {
+	state    ceremony.State
+	timer    *time.Timer
+	attempts map[types.OperatorID]int
+}
+
+func NewRerequester(tracker *ceremony.Tracker, process func(*types.SSVMessage) error, self types.OperatorID, key *rsa.PrivateKey, peers PeerDirectory, logger *logrus.Logger) *Rerequester {
+	r := &Rerequester{
+		Interval: 30 * time.Second,
+		Retries:  3,
+		tracker:  tracker,
+		process:  process,
+		self:     self,
+		key:      key,
+		peers:    peers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		logger:   logger,
+		pending:  make(map[string]*rerequest),
+	}
+	tracker.Subscribe(r.observe)
+	return r
+}
+
+func (r *Rerequester) observe(c *ceremony.Ceremony, e *ceremony.Event) {
+	if e.Type.IsProgress() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.pending[c.RequestID]; ok {
+		p.timer.Stop()
+		delete(r.pending, c.RequestID)
+	}
+	if _, ok := ceremony.ExpectedRound(c.State); !ok || r.Interval <= 0 {
+		return
+	}
+	p := &rerequest{state: c.State, attempts: make(map[types.OperatorID]int)}
+	p.timer = time.AfterFunc(r.Interval, func() { r.tick(c.RequestID, p) })
+	r.pending[c.RequestID] = p
+}
+
+func (r *Rerequester) tick(requestID string, p *rerequest) {
+	r.mu.Lock()
+	if r.pending[requestID] != p {
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+
+	c, err := r.tracker.Get(requestID)
+	if err != nil || c.State != p.state {
+		return
+	}
+	round, _ := ceremony.ExpectedRound(c.State)
+	_, missing := c.Delivery(round, r.self)
+
+	if len(missing) > 0 && r.Sync != nil {
+		synced, err := r.Sync(requestID)
+		if err != nil {
+			r.logger.Warnf("Rerequester: failed to sync topic of request %s: %v", requestID, err)
+		} else if synced > 0 {
+			if c, err = r.tracker.Get(requestID); err != nil || c.State != p.state {
+				return
+			}
+			_, missing = c.Delivery(round, r.self)
+		}
+	}
+
+	waiting := false
+	for _, operatorID := range missing {
+		if p.attempts[operatorID] >= r.Retries {
+			continue
+		}
+		p.attempts[operatorID]++
+
+		err := r.rerequest(requestID, round, operatorID)
+		if err == nil {
+			continue
+		}
+		r.logger.Warnf("Rerequester: attempt %d for %s message of operator %d in request %s failed: %v", p.attempts[operatorID], round, operatorID, requestID, err)
+		if p.attempts[operatorID] < r.Retries {
+			waiting = true
+			continue
+		}
+		recordEvent(r.tracker, r.logger, requestID, ceremony.EventPeerUnresponsive, func(e *ceremony.Event) {
+			e.Operator = operatorID
+			e.Round = round
+			e.Details = fmt.Sprintf("no %s message after %d re-requests: %v", round, r.Retries, err)
+		})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if waiting && r.pending[requestID] == p {
+		p.timer = time.AfterFunc(r.Interval, func() { r.tick(requestID, p) })
+	}
+}
+
+func (r *Rerequester) rerequest(requestID, round string, operatorID types.OperatorID) error {
+	addr, err := r.peers(operatorID)
+	if err != nil {
+		return err
+	}
+
+	req := &ResendRequest{RequestID: requestID, Round: round, Requester: r.self, Time: time.Now().Unix()}
+	root, _ := req.Root()
+	if req.Signature, err = types.Sign(r.key, root); err != nil {
+		return err
+	}
+	body, _ := json.Marshal(req)
+
+	resp, err := r.client.Post(addr+"/resend", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("resend failed with status %s: %s", resp.Status, string(respBody))
+	}
+
+	resend := &ResendResponse{}
+	if err := json.Unmarshal(respBody, resend); err != nil {
+		return err
+	}
+	for _, encoded := range resend.Messages {
+		byts, err := hex.DecodeString(encoded)
+		if err != nil {
+			return err
+		}
+		msg := &types.SSVMessage{}
+		if err := msg.Decode(byts); err != nil {
+			return err
+		}
+		if err := r.process(msg); err != nil {
+			return fmt.Errorf("failed to process re-sent message: %w", err)
+		}
+	}
+	r.logger.Infof("Rerequester: got %d re-sent %s messages from operator %d for request %s", len(resend.Messages), round, operatorID, requestID)
+	return nil
+}
+
+// ProcessMessage hands a message to the dkg node the way /consume does for
+// messages of a running ceremony
+func (h *ApiHandler) ProcessMessage(node *dkg.Node, cache *MessageCache) func(*types.SSVMessage) error {
+	return func(msg *types.SSVMessage) error {
+		done := func(error) {}
+		urgent := false
+		signedMsg := &dkg.SignedMessage{}
+		if err := signedMsg.Decode(msg.Data); err == nil && signedMsg.Message != nil {
+			if isStartMsg(signedMsg.Message.MsgType) {
+				return fmt.Errorf("start messages can't be re-sent")
+			}
+			if err := h.checkEquivocation(signedMsg); err != nil {
+				return err
+			}
+			data, err := msg.Encode()
+			if err != nil {
+				return err
+			}
+			urgent = h.isUrgent(signedMsg)
+			done = h.observeReceived(signedMsg, data, cache)
+		}
+		err := h.process(node, msg, urgent)
+		done(err)
+		return err
+	}
+}
+
+// observeReceived is observeMessage that also records the message hash once
+// the dkg node accepted it
+func (h *ApiHandler) observeReceived(signedMsg *dkg.SignedMessage, data []byte, cache *MessageCache) func(error) {
+	done := h.observeMessage(signedMsg)
+	return func(err error) {
+		done(err)
+		if err == nil {
+			cache.MarkReceived(hex.EncodeToString(signedMsg.Message.Identifier[:]), data)
+			h.transcripts.Add(signedMsg)
+			h.outputs.Add(signedMsg)
+		}
+	}
+}
+
+// TopicSyncer catches up on the messages of a ceremony topic through the
+// messenger, presenting the hashes of the messages this node already processed
+type TopicSyncer struct {
+	client  *messenger.Client
+	cache   *MessageCache
+	self    types.OperatorID
+	process func(*types.SSVMessage) error
+	logger  *logrus.Logger
+}
+
+func NewTopicSyncer(client *messenger.Client, cache *MessageCache, self types.OperatorID, process func(*types.SSVMessage) error, logger *logrus.Logger) *TopicSyncer {
+	return &TopicSyncer{client: client, cache: cache, self: self, process: process, logger: logger}
+}
+
+// Sync processes the topic messages missing on this node, messages the dkg
+// node refuses (e.g. of an earlier round) are skipped
+func (s *TopicSyncer) Sync(requestID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the messenger sends the missing messages in batches, the hashes of the
+	// ones already sent go with the next request
+	have := s.cache.Received(requestID)
+	processed, sent := 0, 0
+	for {
+		resp, err := s.client.SyncTopic(ctx, requestID, s.self, have)
+		if err != nil {
+			return processed, err
+		}
+
+		for _, data := range resp.Messages {
+			have = append(have, messenger.MessageHash(data))
+			msg := &types.SSVMessage{}
+			if err := msg.Decode(data); err != nil {
+				s.logger.Warnf("TopicSyncer: failed to decode message of request %s: %v", requestID, err)
+				continue
+			}
+			if err := s.process(msg); err != nil {
+				s.logger.Debugf("TopicSyncer: skipped message of request %s: %v", requestID, err)
+				continue
+			}
+			processed++
+		}
+		sent += len(resp.Messages)
+		if !resp.More || len(resp.Messages) == 0 {
+			s.logger.Infof("TopicSyncer: processed %d of %d missing messages of request %s (%d kept by the messenger)", processed, sent, requestID, resp.Total)
+			return processed, nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+// cachedBytes is the size Add counts for msg, the ssv message /consume takes
+func cachedBytes(t *testing.T, msg *dkg.SignedMessage) int64 {
+	signedMsgBytes, err := msg.Encode()
+	require.NoError(t, err)
+	ssvMsgBytes, err := (&types.SSVMessage{MsgType: types.DKGMsgType, Data: signedMsgBytes}).Encode()
+	require.NoError(t, err)
+	return int64(len(ssvMsgBytes))
+}
+
+func TestMessageCacheBytes(t *testing.T) {
+	cache := NewMessageCache()
+	require.Zero(t, cache.Bytes())
+
+	a1, a2, b1 := testSignedMsg(1, "a1"), testSignedMsg(1, "round 2 of a"), testSignedMsg(2, "b1")
+	require.NoError(t, cache.Add("a", a1))
+	require.Equal(t, cachedBytes(t, a1), cache.Bytes())
+	require.NoError(t, cache.Add("a", a2))
+	require.NoError(t, cache.Add("b", b1))
+	added := cachedBytes(t, a1) + cachedBytes(t, a2) + cachedBytes(t, b1)
+	require.Equal(t, added, cache.Bytes())
+
+	// a received message counts its hash once
+	hash := int64(len(messenger.MessageHash([]byte("from a peer"))))
+	cache.MarkReceived("a", []byte("from a peer"))
+	cache.MarkReceived("a", []byte("from a peer"))
+	require.Equal(t, added+hash, cache.Bytes())
+	require.Len(t, cache.Received("a"), 1)
+
+	// a running ceremony keeps its messages, a finished one gives its bytes back
+	cache.Observe(&ceremony.Ceremony{RequestID: "a", State: ceremony.StateRound1}, nil)
+	require.Equal(t, added+hash, cache.Bytes())
+	cache.Observe(&ceremony.Ceremony{RequestID: "a", State: ceremony.StateCompleted}, nil)
+	require.Equal(t, cachedBytes(t, b1), cache.Bytes())
+	require.Empty(t, cache.Received("a"))
+	require.Empty(t, cache.Get("a", messageRound(a1.Message)))
+
+	// and the cache grows again from there
+	require.NoError(t, cache.Add("c", a1))
+	require.Equal(t, cachedBytes(t, b1)+cachedBytes(t, a1), cache.Bytes())
+	cache.Observe(&ceremony.Ceremony{RequestID: "b", State: ceremony.StateAborted}, nil)
+	cache.Observe(&ceremony.Ceremony{RequestID: "c", State: ceremony.StateBlamed}, nil)
+	require.Zero(t, cache.Bytes())
+}
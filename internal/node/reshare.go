@@ -0,0 +1,170 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+// ReshareCheck is what a node does when the share it holds for a validator
+// doesn't back the old committee a reshare message declares
+type ReshareCheck string
+
+const (
+	// ReshareCheckEnforce refuses the resharing
+	ReshareCheckEnforce ReshareCheck = "enforce"
+	// ReshareCheckWarn logs the finding and joins the resharing
+	ReshareCheckWarn ReshareCheck = "warn"
+	// ReshareCheckOff joins without checking the share
+	ReshareCheckOff ReshareCheck = "off"
+)
+
+// ParseReshareCheck returns the check named s, ReshareCheckEnforce for an empty s
+func ParseReshareCheck(s string) (ReshareCheck, error) {
+	switch check := ReshareCheck(s); check {
+	case "":
+		return ReshareCheckEnforce, nil
+	case ReshareCheckEnforce, ReshareCheckWarn, ReshareCheckOff:
+		return check, nil
+	}
+	return "", fmt.Errorf("unknown reshare check %q, expected enforce, warn or off", s)
+}
+
+// Reasons a reshare message fails the share check
+const (
+	ReshareNoShare             = "no_share"
+	ReshareShareHandedOver     = "share_handed_over"
+	ReshareCommitteeMismatch   = "committee_mismatch"
+	ReshareShareNotInCommittee = "share_not_in_committee"
+)
+
+type ShareStore interface {
+	GetKeyGenOutput(pk types.ValidatorPK) (*dkg.KeyGenOutput, error)
+}
+
+// ErrReshareRefused is a reshare message of a validator this node holds no
+// valid share of the declared old committee for
+type ErrReshareRefused struct {
+	Reason      string             `json:"reason"`
+	ValidatorPK string             `json:"validator_pk"`
+	Operator    types.OperatorID   `json:"operator"`
+	Declared    []types.OperatorID `json:"old_operators"`
+	// Local is the committee of the stored share, empty without one
+	Local []types.OperatorID `json:"local_operators,omitempty"`
+}
+
+func (e *ErrReshareRefused) Error() string {
+	switch e.Reason {
+	case ReshareNoShare:
+		return fmt.Sprintf("operator %d holds no share of validator %s", e.Operator, e.ValidatorPK)
+	case ReshareShareHandedOver:
+		return fmt.Sprintf("operator %d handed its share of validator %s over to another node", e.Operator, e.ValidatorPK)
+	case ReshareCommitteeMismatch:
+		return fmt.Sprintf("the share of validator %s is of operators %v, the reshare message declares %v", e.ValidatorPK, e.Local, e.Declared)
+	}
+	return fmt.Sprintf("the share of operator %d doesn't belong to the committee of validator %s", e.Operator, e.ValidatorPK)
+}
+
+// checkReshare refuses a reshare message, when this node is in the old
+// committee, unless the stored share of the validator comes from a committee
+// with every declared old operator and its public key is the one of this
+// operator in that committee. Nodes only in the new committee hold no share yet.
+func (p *StartPolicy) checkReshare(msg *dkg.Message) error {
+	if msg.MsgType != dkg.ReshareMsgType || p.ReshareCheck == ReshareCheckOff || p.Shares == nil {
+		return nil
+	}
+	reshare := &dkg.Reshare{}
+	if err := reshare.Decode(msg.Data); err != nil {
+		return err
+	}
+	if !containsOperator(reshare.OldOperatorIDs, p.Self) {
+		return nil
+	}
+
+	refused := &ErrReshareRefused{
+		ValidatorPK: fmt.Sprintf("%x", []byte(reshare.ValidatorPK)),
+		Operator:    p.Self,
+		Declared:    reshare.OldOperatorIDs,
+	}
+	output, err := p.Shares.GetKeyGenOutput(reshare.ValidatorPK)
+	switch {
+	case errors.Is(err, storage.ErrShareHandedOver):
+		refused.Reason = ReshareShareHandedOver
+		return refused
+	case errors.Is(err, storage.ErrKeyNotFound):
+		refused.Reason = ReshareNoShare
+		return refused
+	case err != nil:
+		return fmt.Errorf("failed to get the share of validator %s: %w", refused.ValidatorPK, err)
+	}
+
+	for operatorID := range output.OperatorPubKeys {
+		refused.Local = append(refused.Local, operatorID)
+	}
+	sort.Slice(refused.Local, func(i, j int) bool { return refused.Local[i] < refused.Local[j] })
+	for _, operatorID := range reshare.OldOperatorIDs {
+		if _, ok := output.OperatorPubKeys[operatorID]; !ok {
+			refused.Reason = ReshareCommitteeMismatch
+			return refused
+		}
+	}
+	own, ok := output.OperatorPubKeys[p.Self]
+	if output.Share == nil || !ok || own == nil || !own.IsEqual(output.Share.GetPublicKey()) {
+		refused.Reason = ReshareShareNotInCommittee
+		return refused
+	}
+	return nil
+}
+
+func containsOperator(operators []types.OperatorID, operatorID types.OperatorID) bool {
+	for _, id := range operators {
+		if id == operatorID {
+			return true
+		}
+	}
+	return false
+}
+
+// respondReshare answers a reshare message refused by checkReshare with what
+// the node found, so the initiator can tell which share is off
+func (h *ApiHandler) respondReshare(c *gin.Context, err error) {
+	var refused *ErrReshareRefused
+	if !errors.As(err, &refused) {
+		h.respondError(c, http.StatusInternalServerError, "failed to check the share of the resharing", err)
+		return
+	}
+	h.logger.Warnf("HandleConsume: refused resharing: %v", err)
+	c.JSON(http.StatusConflict, gin.H{
+		"message": "resharing refused, no valid share of the old committee",
+		"error":   err.Error(),
+		"code":    "reshare_share_invalid",
+		"details": refused,
+	})
+}
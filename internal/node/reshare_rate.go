@@ -0,0 +1,161 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+type ReshareHistory interface {
+	SaveReshareStart(start *storage.ReshareStart) error
+	// ListReshareStarts returns the resharings of the validator the node joined
+	ListReshareStarts(pk types.ValidatorPK) ([]*storage.ReshareStart, error)
+}
+
+// ReshareRate limits how often a validator is reshared, so an initiator
+// can't churn the committee of a validator. Resharings that were aborted or
+// blamed don't count, a failed resharing can be tried again right away.
+type ReshareRate struct {
+	// Interval is the least time between two resharings of a validator
+	Interval time.Duration
+	// OverrideApprovals coordinators approving the reshare message lift the
+	// interval, never when zero
+	OverrideApprovals int
+	History           ReshareHistory
+}
+
+// ErrReshareTooSoon is a reshare message of a validator that was reshared
+// less than the interval ago
+type ErrReshareTooSoon struct {
+	ValidatorPK string
+	// Last is the resharing within the interval
+	Last       *storage.ReshareStart
+	RetryAfter time.Time
+}
+
+func (e *ErrReshareTooSoon) Error() string {
+	return fmt.Sprintf("validator %s was reshared by request %s at %s, the next resharing is allowed at %s",
+		e.ValidatorPK, e.Last.RequestID, time.Unix(e.Last.StartedAt, 0).UTC().Format(time.RFC3339), e.RetryAfter.UTC().Format(time.RFC3339))
+}
+
+// checkReshareRate refuses a reshare message of a validator with a resharing
+// less than the interval ago that didn't fail, unless enough coordinators
+// approved the message
+func (p *StartPolicy) checkReshareRate(msg *dkg.Message, query url.Values, tracker *ceremony.Tracker, now time.Time) error {
+	rate := p.ReshareRate
+	if msg.MsgType != dkg.ReshareMsgType || rate == nil || rate.Interval <= 0 {
+		return nil
+	}
+	reshare := &dkg.Reshare{}
+	if err := reshare.Decode(msg.Data); err != nil {
+		return err
+	}
+	starts, err := rate.History.ListReshareStarts(reshare.ValidatorPK)
+	if err != nil {
+		return fmt.Errorf("failed to list resharings of the validator: %w", err)
+	}
+
+	requestID := hex.EncodeToString(msg.Identifier[:])
+	var last *storage.ReshareStart
+	for _, start := range starts {
+		if start.RequestID == requestID || now.Sub(time.Unix(start.StartedAt, 0)) >= rate.Interval {
+			continue
+		}
+		if cer, err := tracker.Get(start.RequestID); err == nil && (cer.State == ceremony.StateAborted || cer.State == ceremony.StateBlamed) {
+			continue
+		}
+		if last == nil || start.StartedAt > last.StartedAt {
+			last = start
+		}
+	}
+	if last == nil {
+		return nil
+	}
+
+	if rate.OverrideApprovals > 0 && p.Coordinators != nil {
+		approvals, err := coordinator.ParseQuery(query)
+		if err != nil {
+			return err
+		}
+		approved, err := p.Coordinators.Approved(msg, approvals)
+		if err != nil {
+			return err
+		}
+		if approved >= rate.OverrideApprovals {
+			return nil
+		}
+	}
+	return &ErrReshareTooSoon{
+		ValidatorPK: hex.EncodeToString(reshare.ValidatorPK),
+		Last:        last,
+		RetryAfter:  time.Unix(last.StartedAt, 0).Add(rate.Interval),
+	}
+}
+
+// recordReshare keeps the start of a resharing the node joins for checkReshareRate
+func (p *StartPolicy) recordReshare(msg *dkg.Message, now time.Time) error {
+	if msg.MsgType != dkg.ReshareMsgType || p.ReshareRate == nil || p.ReshareRate.Interval <= 0 {
+		return nil
+	}
+	reshare := &dkg.Reshare{}
+	if err := reshare.Decode(msg.Data); err != nil {
+		return err
+	}
+	return p.ReshareRate.History.SaveReshareStart(&storage.ReshareStart{
+		ValidatorPK: hex.EncodeToString(reshare.ValidatorPK),
+		RequestID:   hex.EncodeToString(msg.Identifier[:]),
+		StartedAt:   now.Unix(),
+	})
+}
+
+// respondReshareRate answers a reshare message refused by checkReshareRate
+// with when the validator can be reshared again
+func (h *ApiHandler) respondReshareRate(c *gin.Context, err error) {
+	var tooSoon *ErrReshareTooSoon
+	if !errors.As(err, &tooSoon) {
+		h.respondError(c, http.StatusForbidden, "start message refused by node policy", err)
+		return
+	}
+	h.logger.Warnf("HandleConsume: refused resharing: %v", err)
+	retryAfter := time.Until(tooSoon.RetryAfter)
+	c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"message":     "validator was reshared too recently",
+		"error":       err.Error(),
+		"code":        "reshare_rate_limited",
+		"last":        tooSoon.Last,
+		"retry_after": tooSoon.RetryAfter.UTC(),
+	})
+}
@@ -0,0 +1,245 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCeremonyRunning is returned when purging a ceremony that didn't end
+var ErrCeremonyRunning = errors.New("ceremony is still running")
+
+// RetentionPolicy is how long the state of ended ceremonies is kept, zero
+// keeps it forever. Shares are always kept.
+type RetentionPolicy struct {
+	// Ceremonies is how long the events, attestation, transcript and
+	// committee outputs of a ceremony are kept after it ended
+	Ceremonies time.Duration
+	// Journals is how long the transcript and committee outputs are kept
+	// after the ceremony ended, usually shorter than Ceremonies
+	Journals time.Duration
+	// Interval between two sweeps
+	Interval time.Duration
+}
+
+// DefaultRetentionPolicy keeps everything and checks every hour
+var DefaultRetentionPolicy = RetentionPolicy{Interval: time.Hour}
+
+func (p RetentionPolicy) Enabled() bool {
+	return p.Ceremonies > 0 || p.Journals > 0
+}
+
+// RetentionReport is what a sweep or purge deleted
+type RetentionReport struct {
+	Ceremonies int   `json:"ceremonies"`
+	Journals   int   `json:"journals"`
+	Keys       int   `json:"keys"`
+	Bytes      int64 `json:"bytes"`
+}
+
+// RetentionSweeper purges the state of ended ceremonies once it is older than
+// the retention policy
+type RetentionSweeper struct {
+	policy  RetentionPolicy
+	storage *storage.Storage
+	tracker *ceremony.Tracker
+	logger  *logrus.Logger
+	now     func() time.Time
+
+	// mu keeps sweeps and admin purges apart
+	mu         sync.Mutex
+	ceremonies int64
+	journals   int64
+	bytes      int64
+}
+
+func NewRetentionSweeper(policy RetentionPolicy, s *storage.Storage, tracker *ceremony.Tracker, logger *logrus.Logger) *RetentionSweeper {
+	if policy.Interval <= 0 {
+		policy.Interval = DefaultRetentionPolicy.Interval
+	}
+	return &RetentionSweeper{policy: policy, storage: s, tracker: tracker, logger: logger, now: time.Now}
+}
+
+// Run sweeps every interval until done is closed, it returns at once when
+// the policy keeps everything
+func (s *RetentionSweeper) Run(done <-chan struct{}) {
+	if !s.policy.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(s.policy.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.Sweep(); err != nil {
+			s.logger.Errorf("RetentionSweeper: %v", err)
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep purges the ceremonies and journals older than the policy
+func (s *RetentionSweeper) Sweep() (*RetentionReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &RetentionReport{}
+	if !s.policy.Enabled() {
+		return report, nil
+	}
+	ended, err := s.storage.ListEndedCeremonies()
+	if err != nil {
+		return nil, fmt.Errorf("Sweep: failed to list ended ceremonies: %w", err)
+	}
+	now := s.now()
+	for _, end := range ended {
+		age := now.Sub(end.EndedAt)
+		switch {
+		case s.policy.Ceremonies > 0 && age >= s.policy.Ceremonies:
+			if err := s.purgeCeremony(end.RequestID, report); err != nil {
+				return report, fmt.Errorf("Sweep: %w", err)
+			}
+		case s.policy.Journals > 0 && age >= s.policy.Journals:
+			purged, err := s.storage.PurgeJournals(end.RequestID)
+			if err != nil {
+				return report, fmt.Errorf("Sweep: failed to purge journals of request %s: %w", end.RequestID, err)
+			}
+			if purged.Keys > 0 {
+				report.Journals++
+				s.count(report, purged, 0, 1)
+				s.logger.Debugf("Sweep: purged journals of request %s, %d bytes", end.RequestID, purged.Bytes)
+			}
+		}
+	}
+	if report.Keys > 0 {
+		s.logger.Infof("Sweep: purged %d ceremonies and the journals of %d more, %d bytes", report.Ceremonies, report.Journals, report.Bytes)
+	}
+	return report, nil
+}
+
+// Purge deletes the state of one ended ceremony whatever its age
+func (s *RetentionSweeper) Purge(requestID string) (*RetentionReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.tracker.Get(requestID)
+	if err != nil {
+		return nil, err
+	}
+	if !c.State.IsTerminal() {
+		return nil, ErrCeremonyRunning
+	}
+	report := &RetentionReport{}
+	if err := s.purgeCeremony(requestID, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (s *RetentionSweeper) purgeCeremony(requestID string, report *RetentionReport) error {
+	purged, err := s.storage.PurgeCeremony(requestID)
+	if err != nil {
+		return fmt.Errorf("failed to purge request %s: %w", requestID, err)
+	}
+	s.tracker.Forget(requestID)
+	report.Ceremonies++
+	s.count(report, purged, 1, 0)
+	s.logger.Debugf("purgeCeremony: purged request %s, %d keys, %d bytes", requestID, purged.Keys, purged.Bytes)
+	return nil
+}
+
+func (s *RetentionSweeper) count(report *RetentionReport, purged *storage.Purged, ceremonies, journals int64) {
+	report.Keys += purged.Keys
+	report.Bytes += purged.Bytes
+	atomic.AddInt64(&s.ceremonies, ceremonies)
+	atomic.AddInt64(&s.journals, journals)
+	atomic.AddInt64(&s.bytes, purged.Bytes)
+}
+
+func (s *RetentionSweeper) Collectors() []prometheus.Collector {
+	kinds := []struct {
+		name  string
+		value *int64
+	}{
+		{"ceremonies", &s.ceremonies},
+		{"journals", &s.journals},
+	}
+	collectors := make([]prometheus.Collector, 0, len(kinds)+1)
+	for _, kind := range kinds {
+		kind := kind
+		collectors = append(collectors, prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "dkg_node_retention_purged_total",
+			Help:        "Ended ceremonies whose records or journals were purged",
+			ConstLabels: prometheus.Labels{"kind": kind.name},
+		}, func() float64 { return float64(atomic.LoadInt64(kind.value)) }))
+	}
+	return append(collectors, prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "dkg_node_retention_reclaimed_bytes_total",
+		Help: "Bytes of keys and values the retention sweeps and purges deleted from the storage",
+	}, func() float64 {
+		return float64(atomic.LoadInt64(&s.bytes))
+	}))
+}
+
+// HandlePurge purges the ceremony of the request_id query parameter, or
+// sweeps by the retention policy right away without one
+func (h *ApiHandler) HandlePurge(sweeper *RetentionSweeper) func(*gin.Context) {
+	return func(c *gin.Context) {
+		requestID := c.Query("request_id")
+		if requestID == "" {
+			report, err := sweeper.Sweep()
+			if err != nil {
+				h.respondError(c, http.StatusInternalServerError, "retention sweep failed", err)
+				return
+			}
+			c.JSON(http.StatusOK, report)
+			return
+		}
+
+		report, err := sweeper.Purge(requestID)
+		if errors.Is(err, ceremony.ErrCeremonyNotFound) {
+			h.respondError(c, http.StatusNotFound, "ceremony not found", err)
+			return
+		} else if errors.Is(err, ErrCeremonyRunning) {
+			h.respondError(c, http.StatusConflict, "ceremony can't be purged", err)
+			return
+		} else if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to purge ceremony", err)
+			return
+		}
+		h.logger.Infof("HandlePurge: purged request %s, %d bytes", requestID, report.Bytes)
+		c.JSON(http.StatusOK, report)
+	}
+}
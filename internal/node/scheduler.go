@@ -0,0 +1,156 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"sync"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Scheduler bounds how many messages the dkg node processes at once. When
+// all slots are taken, messages of urgent ceremonies get the next free one
+// ahead of the waiting messages of normal ceremonies, so a reshare away from
+// a compromised operator isn't stuck behind a large batch of keygens.
+type Scheduler struct {
+	limit int
+	// overloadDepth is the number of waiting messages from which the node
+	// reports itself overloaded, 0 never does
+	overloadDepth int
+
+	mu      sync.Mutex
+	running int
+	urgent  []chan struct{}
+	normal  []chan struct{}
+	// queued are the bytes of the messages waiting for a slot
+	queued int64
+}
+
+// NewScheduler lets limit messages be processed at once, at least one, and
+// reports the node overloaded once overloadDepth messages wait for a slot
+func NewScheduler(limit, overloadDepth int) *Scheduler {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Scheduler{limit: limit, overloadDepth: overloadDepth}
+}
+
+// Load reports the messages processed and waiting right now, and whether the
+// waiting ones reached the overload depth. A nil scheduler never waits.
+func (s *Scheduler) Load() (running, waiting int, overloaded bool) {
+	if s == nil {
+		return 0, 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	waiting = len(s.urgent) + len(s.normal)
+	return s.running, waiting, s.overloadDepth > 0 && waiting >= s.overloadDepth
+}
+
+// QueuedBytes are the bytes of the messages waiting for a slot
+func (s *Scheduler) QueuedBytes() int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queued
+}
+
+// Do runs fn, processing a message of size bytes, once a slot is free, a nil
+// scheduler runs it right away
+func (s *Scheduler) Do(urgent bool, size int, fn func() error) error {
+	if s == nil {
+		return fn()
+	}
+	s.acquire(urgent, int64(size))
+	defer s.release()
+	return fn()
+}
+
+func (s *Scheduler) acquire(urgent bool, size int64) {
+	s.mu.Lock()
+	if s.running < s.limit {
+		s.running++
+		s.mu.Unlock()
+		return
+	}
+	ready := make(chan struct{})
+	if urgent {
+		s.urgent = append(s.urgent, ready)
+	} else {
+		s.normal = append(s.normal, ready)
+	}
+	s.queued += size
+	s.mu.Unlock()
+	<-ready
+
+	s.mu.Lock()
+	s.queued -= size
+	s.mu.Unlock()
+}
+
+// release hands the slot over to the first urgent waiter, else to the first
+// normal one
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case len(s.urgent) > 0:
+		close(s.urgent[0])
+		s.urgent = s.urgent[1:]
+	case len(s.normal) > 0:
+		close(s.normal[0])
+		s.normal = s.normal[1:]
+	default:
+		s.running--
+	}
+}
+
+// WithScheduler has the handler process messages through the scheduler
+func (h *ApiHandler) WithScheduler(scheduler *Scheduler) *ApiHandler {
+	h.scheduler = scheduler
+	return h
+}
+
+// process hands the message to the dkg node once the scheduler has a slot for it
+func (h *ApiHandler) process(node *dkg.Node, msg *types.SSVMessage, urgent bool) error {
+	return h.scheduler.Do(urgent, len(msg.Data), func() error {
+		return node.ProcessMessage(msg)
+	})
+}
+
+// isUrgent reports whether the ceremony of the message was started with
+// priority=urgent
+func (h *ApiHandler) isUrgent(signedMsg *dkg.SignedMessage) bool {
+	if h.scheduler == nil {
+		return false
+	}
+	c, err := h.tracker.Get(hex.EncodeToString(signedMsg.Message.Identifier[:]))
+	if err != nil {
+		return false
+	}
+	return c.Option(ceremony.OptionPriority) == "urgent"
+}
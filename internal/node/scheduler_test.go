@@ -0,0 +1,88 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// waitFor polls cond until it holds or a second passed
+func waitFor(t *testing.T, cond func() bool) {
+	require.Eventually(t, cond, time.Second, time.Millisecond)
+}
+
+func TestSchedulerQueuedBytes(t *testing.T) {
+	scheduler := NewScheduler(1, 2)
+	require.Zero(t, scheduler.QueuedBytes())
+
+	// the only slot is taken, the next messages wait with their bytes
+	block := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scheduler.Do(false, 1000, func() error { <-block; return nil })
+	}()
+	waitFor(t, func() bool { running, _, _ := scheduler.Load(); return running == 1 })
+	require.Zero(t, scheduler.QueuedBytes())
+
+	var mu sync.Mutex
+	var order []string
+	run := func(name string, urgent bool, size int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.Do(urgent, size, func() error {
+				mu.Lock()
+				order = append(order, name)
+				mu.Unlock()
+				return nil
+			})
+		}()
+	}
+	run("normal", false, 100)
+	waitFor(t, func() bool { return scheduler.QueuedBytes() == 100 })
+	run("urgent", true, 50)
+	waitFor(t, func() bool { return scheduler.QueuedBytes() == 150 })
+	_, waiting, overloaded := scheduler.Load()
+	require.Equal(t, 2, waiting)
+	require.True(t, overloaded)
+
+	// once the slot is free the waiting messages run, urgent first, and
+	// their bytes leave the queue
+	close(block)
+	wg.Wait()
+	require.Equal(t, []string{"urgent", "normal"}, order)
+	require.Zero(t, scheduler.QueuedBytes())
+	running, waiting, _ := scheduler.Load()
+	require.Zero(t, running)
+	require.Zero(t, waiting)
+
+	// a nil scheduler never queues
+	var none *Scheduler
+	require.Zero(t, none.QueuedBytes())
+	require.NoError(t, none.Do(false, 10, func() error { return nil }))
+}
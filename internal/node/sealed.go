@@ -0,0 +1,149 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+)
+
+// SealedStart is a start message with the query of its /consume request
+// (phase timeouts, coordinator approvals), encrypted to one operator so the
+// messenger relaying it doesn't learn the ceremony parameters
+type SealedStart struct {
+	Message []byte `json:"message"`
+	Query   string `json:"query,omitempty"`
+}
+
+// sealedStartLabel binds the envelope to the topic it is relayed on
+func sealedStartLabel(topic string) []byte {
+	return []byte("rockx-dkg-sealed-start:" + topic)
+}
+
+// SealStart encrypts the start message msg of topic to the operator key pk
+func SealStart(pk *rsa.PublicKey, topic string, msg []byte, query url.Values) (*encryption.Envelope, error) {
+	plaintext, err := json.Marshal(&SealedStart{Message: msg, Query: query.Encode()})
+	if err != nil {
+		return nil, err
+	}
+	return encryption.SealRSA(pk, plaintext, sealedStartLabel(topic))
+}
+
+// OpenStart decrypts a sealed start message, the message must be the start of
+// the ceremony of the topic it was relayed on
+func OpenStart(sk *rsa.PrivateKey, topic string, envelope *encryption.Envelope) (*SealedStart, error) {
+	if envelope == nil {
+		return nil, errors.New("missing envelope")
+	}
+	plaintext, err := encryption.OpenRSA(sk, envelope, sealedStartLabel(topic))
+	if err != nil {
+		return nil, err
+	}
+	sealed := &SealedStart{}
+	if err := json.Unmarshal(plaintext, sealed); err != nil {
+		return nil, fmt.Errorf("failed to decode sealed start message: %w", err)
+	}
+	if err := checkRelayedStart(sealed.Message, topic); err != nil {
+		return nil, err
+	}
+	return sealed, nil
+}
+
+// checkRelayedStart checks that a message the messenger relayed is the start
+// of the ceremony of the topic it was relayed on
+func checkRelayedStart(msg []byte, topic string) error {
+	ssvMsg := &types.SSVMessage{}
+	if err := ssvMsg.Decode(msg); err != nil {
+		return fmt.Errorf("failed to decode start message: %w", err)
+	}
+	signedMsg := &dkg.SignedMessage{}
+	if err := signedMsg.Decode(ssvMsg.Data); err != nil || signedMsg.Message == nil {
+		return fmt.Errorf("failed to decode signed start message: %v", err)
+	}
+	if !isStartMsg(signedMsg.Message.MsgType) {
+		return fmt.Errorf("relayed message of type %s isn't a start message", msgTypeName(signedMsg.Message.MsgType))
+	}
+	if hex.EncodeToString(signedMsg.Message.Identifier[:]) != topic {
+		return fmt.Errorf("start message for request %x relayed on topic %s", signedMsg.Message.Identifier[:], topic)
+	}
+	return nil
+}
+
+// HandleConsumeSealed opens a start message the messenger relayed sealed to
+// this operator and hands it to consume as if it was posted to /consume
+func (h *ApiHandler) HandleConsumeSealed(operatorKey *rsa.PrivateKey, consume func(*gin.Context)) func(*gin.Context) {
+	return func(c *gin.Context) {
+		delivery := &messenger.SealedDelivery{}
+		if err := c.ShouldBindJSON(delivery); err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse sealed start message", err)
+			return
+		}
+
+		sealed, err := OpenStart(operatorKey, delivery.Topic, delivery.Envelope)
+		if err != nil {
+			h.logger.Warnf("HandleConsumeSealed: failed to open start message of topic %s: %v", delivery.Topic, err)
+			h.respondError(c, http.StatusBadRequest, "failed to open sealed start message", err)
+			return
+		}
+		h.logger.Infof("HandleConsumeSealed: opened sealed start message of topic %s", delivery.Topic)
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(sealed.Message))
+		c.Request.URL.RawQuery = sealed.Query
+		c.Set(sealedStartKey, true)
+		consume(c)
+	}
+}
+
+// HandleConsumeRelayed hands a plain start message the messenger relayed to
+// this operator to consume as if the initiator posted it to /consume
+func (h *ApiHandler) HandleConsumeRelayed(consume func(*gin.Context)) func(*gin.Context) {
+	return func(c *gin.Context) {
+		delivery := &messenger.RelayedDelivery{}
+		if err := c.ShouldBindJSON(delivery); err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse relayed start message", err)
+			return
+		}
+		if err := checkRelayedStart(delivery.Message, delivery.Topic); err != nil {
+			h.logger.Warnf("HandleConsumeRelayed: refused start message of topic %s: %v", delivery.Topic, err)
+			h.respondError(c, http.StatusBadRequest, "invalid relayed start message", err)
+			return
+		}
+		h.logger.Infof("HandleConsumeRelayed: received start message of topic %s through the messenger", delivery.Topic)
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(delivery.Message))
+		c.Request.URL.RawQuery = delivery.Query
+		consume(c)
+	}
+}
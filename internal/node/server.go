@@ -22,10 +22,20 @@
 package node
 
 import (
-	"encoding/hex"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"time"
 
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/coordinator"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/RockX-SG/frost-dkg-demo/internal/plugin"
+	"github.com/RockX-SG/frost-dkg-demo/internal/quota"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
 	"github.com/gin-gonic/gin"
@@ -33,14 +43,169 @@ import (
 )
 
 type ApiHandler struct {
-	logger *logrus.Logger
+	logger      *logrus.Logger
+	tracker     *ceremony.Tracker
+	transcripts *TranscriptRecorder
+	outputs     *OutputRecorder
+	// capabilities are sent along with the ack of a start message
+	capabilities *messengerclient.Capabilities
+	// scheduler, when set, bounds the messages processed at once
+	scheduler *Scheduler
+	// blameEquivocation, when set, blames the signer of conflicting messages
+	blameEquivocation func(*observer.Equivocation) error
 }
 
-func New(logger *logrus.Logger) *ApiHandler {
-	return &ApiHandler{logger: logger}
+func New(logger *logrus.Logger, tracker *ceremony.Tracker) *ApiHandler {
+	return &ApiHandler{logger: logger, tracker: tracker}
 }
 
-func (h *ApiHandler) HandleConsume(node *dkg.Node) func(*gin.Context) {
+// WithTranscripts records the messages the handler accepts in the transcripts
+// of their ceremonies
+func (h *ApiHandler) WithTranscripts(transcripts *TranscriptRecorder) *ApiHandler {
+	h.transcripts = transcripts
+	return h
+}
+
+// WithCommitteeOutputs stores the outputs the handler accepts with the ones
+// of the rest of the committee
+func (h *ApiHandler) WithCommitteeOutputs(outputs *OutputRecorder) *ApiHandler {
+	h.outputs = outputs
+	return h
+}
+
+// StartPolicy decides which ceremonies this node joins
+type StartPolicy struct {
+	// Coordinators, when set, must approve keygen and resharing starts
+	Coordinators *coordinator.Set
+	// KeySignDomains are the signing domains keysign requests may use
+	KeySignDomains *signing.Policy
+	// KeySignUsage, when set, restricts what keysign requests may sign with the shares
+	KeySignUsage *signing.UsagePolicy
+	// Disk, when set, refuses new ceremonies while disk usage is critical
+	Disk *quota.Monitor
+	// Memory, when set, refuses new ceremonies while the node is over a
+	// memory budget
+	Memory *MemoryGuard
+	// Limits of the node, the defaults when nil
+	Limits *ceremony.Limits
+	// Canaries, when set, keeps keysign and resharing away from canary shares
+	Canaries CanaryShares
+	// Plugins run their pre-init hook on every start message
+	Plugins *plugin.Hooks
+	// MinProtocolVersion is the oldest protocol version the node runs keygen
+	// and resharing at, version 1 when zero
+	MinProtocolVersion uint32
+	// Keys looks up the operator keys start messages, version claims and
+	// manifests are checked against
+	Keys observer.KeyLookup
+	// SignedDeliveries is set when the node can check relay signatures,
+	// protocol version 2 needs them
+	SignedDeliveries bool
+	// RequireManifest refuses keygen and resharing starts without a signed manifest
+	RequireManifest bool
+	// ReshareCheck is what the node does with a reshare message its stored
+	// share doesn't back, checked against Shares of operator Self
+	ReshareCheck ReshareCheck
+	Self         types.OperatorID
+	Shares       ShareStore
+	// ReshareRate, when set, limits how often a validator is reshared
+	ReshareRate *ReshareRate
+	// Interlock, when set, keeps keysigns and resharings of a validator apart
+	Interlock *ValidatorInterlock
+	// HandingOver, when set, reports whether the node hands over to a new
+	// process, which takes the ceremonies started from then on
+	HandingOver func() bool
+}
+
+type CanaryShares interface {
+	IsCanaryShare(pk types.ValidatorPK) (bool, error)
+}
+
+func (p *StartPolicy) admit() error {
+	if p.Disk == nil {
+		return nil
+	}
+	return p.Disk.Admit()
+}
+
+func (p *StartPolicy) check(msg *dkg.Message, query url.Values) error {
+	switch msg.MsgType {
+	case dkg.InitMsgType, dkg.ReshareMsgType:
+		if p.Coordinators == nil {
+			return nil
+		}
+		approvals, err := coordinator.ParseQuery(query)
+		if err != nil {
+			return err
+		}
+		return p.Coordinators.Verify(msg, approvals)
+	case dkg.KeySignMsgType:
+		if p.KeySignDomains != nil {
+			if err := p.KeySignDomains.Check(msg.Data); err != nil {
+				return err
+			}
+		}
+		if p.KeySignUsage != nil {
+			return p.KeySignUsage.Check(msg.Data)
+		}
+	}
+	return nil
+}
+
+// checkInitiator verifies the signature of a keygen, resharing or keysign
+// start message against the registry key of its signer. The dkg node doesn't
+// refuse start messages whose signature fails to verify, so the policy does,
+// before the start reserves its request ID.
+func (p *StartPolicy) checkInitiator(signedMsg *dkg.SignedMessage) error {
+	if !isStartMsg(signedMsg.Message.MsgType) || p.Keys == nil {
+		return nil
+	}
+	if err := observer.VerifySignedMessage(signedMsg, p.Keys); err != nil {
+		return fmt.Errorf("start message isn't signed by the initiator it names: %w", err)
+	}
+	return nil
+}
+
+// checkCanary refuses canary starts of anything but keygen, and keysign or
+// resharing of validators whose share comes from a canary keygen
+func (p *StartPolicy) checkCanary(msg *dkg.Message, canary *ceremony.Canary) error {
+	if canary != nil && msg.MsgType != dkg.InitMsgType {
+		return fmt.Errorf("only keygen can run as canary")
+	}
+	if p.Canaries == nil {
+		return nil
+	}
+
+	var pk types.ValidatorPK
+	switch msg.MsgType {
+	case dkg.KeySignMsgType:
+		keySign := &dkg.KeySign{}
+		if err := keySign.Decode(msg.Data); err != nil {
+			return nil
+		}
+		pk = keySign.ValidatorPK
+	case dkg.ReshareMsgType:
+		reshare := &dkg.Reshare{}
+		if err := reshare.Decode(msg.Data); err != nil {
+			return nil
+		}
+		pk = reshare.ValidatorPK
+	default:
+		return nil
+	}
+	isCanary, err := p.Canaries.IsCanaryShare(pk)
+	if err != nil {
+		return err
+	}
+	if isCanary {
+		return fmt.Errorf("validator %x comes from a canary keygen", []byte(pk))
+	}
+	return nil
+}
+
+// HandleConsume feeds messages to the dkg node, start messages have to pass
+// the start policy first
+func (h *ApiHandler) HandleConsume(node *dkg.Node, policy *StartPolicy, cache *MessageCache) func(*gin.Context) {
 	return func(c *gin.Context) {
 		data, err := io.ReadAll(c.Request.Body)
 		if err != nil {
@@ -62,7 +227,134 @@ func (h *ApiHandler) HandleConsume(node *dkg.Node) func(*gin.Context) {
 			return
 		}
 
-		if err = node.ProcessMessage(msg); err != nil {
+		done := func(error) {}
+		start, urgent := false, false
+		signedMsg := &dkg.SignedMessage{}
+		if err := signedMsg.Decode(msg.Data); err == nil && signedMsg.Message != nil {
+			if start = isStartMsg(signedMsg.Message.MsgType); start {
+				if policy.HandingOver != nil && policy.HandingOver() {
+					h.respondError(c, http.StatusServiceUnavailable, "node is handing over to a new process", errHandingOver)
+					return
+				}
+				if err := policy.admit(); err != nil {
+					h.respondQuota(c, err)
+					return
+				}
+				if err := policy.admitMemory(signedMsg.Message); err != nil {
+					h.respondMemory(c, err)
+					return
+				}
+				if err := policy.checkInitiator(signedMsg); err != nil {
+					h.logger.Warnf("HandleConsume: refused to start request %x: %v", signedMsg.Message.Identifier[:], err)
+					h.respondError(c, http.StatusForbidden, "start message refused by node policy", err)
+					return
+				}
+				if err := h.checkRequestID(signedMsg); err != nil {
+					h.respondError(c, http.StatusConflict, "request id already used", err)
+					return
+				}
+				if err := policy.checkLimits(signedMsg.Message, c.Request.URL.Query()); err != nil {
+					if !ceremony.IsLimitExceeded(err) {
+						h.respondError(c, http.StatusBadRequest, "invalid limits", err)
+						return
+					}
+					h.respondLimit(c, policy.limits(), err)
+					return
+				}
+				if err := policy.check(signedMsg.Message, c.Request.URL.Query()); err != nil {
+					h.logger.Warnf("HandleConsume: refused to start request %x: %v", signedMsg.Message.Identifier[:], err)
+					h.respondError(c, http.StatusForbidden, "start message refused by node policy", err)
+					return
+				}
+				timeouts, err := ceremony.ParsePhaseTimeouts(c.Request.URL.Query())
+				if err != nil {
+					h.respondError(c, http.StatusBadRequest, "invalid phase timeouts", err)
+					return
+				}
+				canary, err := ceremony.ParseCanary(c.Request.URL.Query(), time.Now())
+				if err != nil {
+					h.respondError(c, http.StatusBadRequest, "invalid canary ttl", err)
+					return
+				}
+				if err := policy.checkCanary(signedMsg.Message, canary); err != nil {
+					h.logger.Warnf("HandleConsume: refused to start request %x: %v", signedMsg.Message.Identifier[:], err)
+					h.respondError(c, http.StatusForbidden, "start message refused by node policy", err)
+					return
+				}
+				if _, err := ceremony.ParseVersionClaim(c.Request.URL.Query()); err != nil {
+					h.respondError(c, http.StatusBadRequest, "invalid version claim", err)
+					return
+				}
+				minVersion, claim, err := policy.checkVersion(signedMsg, c.Request.URL.Query())
+				if err != nil {
+					h.logger.Warnf("HandleConsume: refused to start request %x: %v", signedMsg.Message.Identifier[:], err)
+					h.respondError(c, http.StatusForbidden, "start message refused by node policy", err)
+					return
+				}
+				options, err := ceremony.OptionsFromQuery(c.Request.URL.Query())
+				if err == nil {
+					err = options.Validate(ceremony.SupportedOptions)
+				}
+				if err != nil {
+					h.respondError(c, http.StatusBadRequest, "invalid ceremony options", err)
+					return
+				}
+				if err := checkOptions(c, options); err != nil {
+					h.logger.Warnf("HandleConsume: refused to start request %x: %v", signedMsg.Message.Identifier[:], err)
+					h.respondError(c, http.StatusForbidden, "start message refused by node policy", err)
+					return
+				}
+				if _, err := ceremony.ParseSignedManifest(c.Request.URL.Query()); err != nil {
+					h.respondError(c, http.StatusBadRequest, "invalid manifest", err)
+					return
+				}
+				manifestHash, err := policy.checkManifest(signedMsg, c.Request.URL.Query(), claim, options)
+				if err != nil {
+					h.logger.Warnf("HandleConsume: refused to start request %x: %v", signedMsg.Message.Identifier[:], err)
+					h.respondError(c, http.StatusForbidden, "start message refused by node policy", err)
+					return
+				}
+				if err := policy.checkReshare(signedMsg.Message); err != nil {
+					if policy.ReshareCheck != ReshareCheckWarn {
+						h.respondReshare(c, err)
+						return
+					}
+					h.logger.Warnf("HandleConsume: joining resharing %x despite: %v", signedMsg.Message.Identifier[:], err)
+				}
+				if err := policy.checkReshareRate(signedMsg.Message, c.Request.URL.Query(), h.tracker, time.Now()); err != nil {
+					h.respondReshareRate(c, err)
+					return
+				}
+				if err := policy.checkPlugins(c.Request.Context(), signedMsg.Message, canary, options); err != nil {
+					h.respondPlugin(c, err)
+					return
+				}
+				if err := policy.checkInterlock(signedMsg.Message); err != nil {
+					h.respondInterlock(c, err)
+					return
+				}
+				// the tracker holds the ceremony once it's recorded, the
+				// pending start goes whether it was or the start failed
+				defer policy.releaseInterlock(signedMsg.Message)
+				if err := policy.recordReshare(signedMsg.Message, time.Now()); err != nil {
+					h.respondError(c, http.StatusInternalServerError, "failed to record resharing", err)
+					return
+				}
+				urgent = options.Get(ceremony.OptionPriority) == "urgent"
+				done = h.observeStart(signedMsg, timeouts, canary, minVersion, claim, options, manifestHash)
+			} else {
+				if err := h.checkEquivocation(signedMsg); err != nil {
+					h.respondError(c, http.StatusConflict, "conflicting message refused", err)
+					return
+				}
+				urgent = h.isUrgent(signedMsg)
+				done = h.observeReceived(signedMsg, data, cache)
+			}
+		}
+
+		err = h.process(node, msg, urgent)
+		done(err)
+		if err != nil {
 			h.logger.Errorf("HandleConsume: dkg node failed to process incoming message: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"message": "dkg node failed to process message",
@@ -72,16 +364,38 @@ func (h *ApiHandler) HandleConsume(node *dkg.Node) func(*gin.Context) {
 		}
 
 		h.logger.Infof("HandleConsume: dkg node processed incoming message successfully")
-		c.JSON(http.StatusOK, gin.H{
+		resp := gin.H{
 			"message": "processed message successfully",
 			"error":   nil,
-		})
+		}
+		if start && h.capabilities != nil {
+			resp["capabilities"] = h.capabilities
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// LeaderOnly rejects requests while this node is the standby of a failover pair
+func (h *ApiHandler) LeaderOnly(isLeader func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isLeader() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"message": "this node is on standby",
+				"error":   "not the active instance for this operator",
+			})
+			return
+		}
+		c.Next()
 	}
 }
 
 func (h *ApiHandler) HandleGetDKGResults(node *dkg.Node) func(*gin.Context) {
 	return func(c *gin.Context) {
-		vkByte, _ := hex.DecodeString(c.Param("vk"))
+		vkByte, err := hexenc.ParseValidatorPK(c.Param("vk"))
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid validator pk", err)
+			return
+		}
 		output, err := node.GetConfig().GetStorage().GetKeyGenOutput(vkByte)
 		if err != nil {
 			h.logger.Errorf("HandleGetDKGResults: failed to get dkg result for vk %s: %v", c.Param("vk"), err)
@@ -0,0 +1,71 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumeRefusesForgedStartBeforeReservingRequestID(t *testing.T) {
+	initiator, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	policy := &StartPolicy{Keys: func(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+		if operatorID != 1 {
+			return nil, fmt.Errorf("unknown operator %d", operatorID)
+		}
+		return &initiator.PublicKey, nil
+	}}
+	h := New(testLogger(), ceremony.NewTracker(newMemEvents()))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/consume", h.HandleConsume(nil, policy, nil))
+
+	msg := testKeySignMsg(t, 7, testValidatorPK(1))
+	forged, err := testingutils.SignDKGMsg(forger, 1, msg).Encode()
+	require.NoError(t, err)
+	body, err := (&types.SSVMessage{MsgType: types.DKGMsgType, Data: forged}).Encode()
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/consume", bytes.NewReader(body)))
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// the forged keysign didn't take the request id from the real one
+	require.False(t, h.tracker.Exists(requestIDOf(msg)))
+	signed := testingutils.SignDKGMsg(initiator, 1, msg)
+	require.NoError(t, policy.checkInitiator(signed))
+	require.NoError(t, h.checkRequestID(signed))
+}
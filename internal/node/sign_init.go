@@ -0,0 +1,276 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/gin-gonic/gin"
+)
+
+// InitSignRequest is an unsigned keygen or resharing start message an
+// initiator without an operator key asks a committee member to sign and
+// publish on its behalf
+type InitSignRequest struct {
+	// Message is the encoded unsigned dkg message
+	Message []byte `json:"message"`
+	// MinProtocolVersion, when set, is claimed by the signer for the ceremony
+	MinProtocolVersion uint32 `json:"min_protocol_version,omitempty"`
+	// Manifest of the ceremony, signed along with the message when set
+	Manifest *ceremony.Manifest `json:"manifest,omitempty"`
+	// Query of the start message: phase timeouts, coordinator approvals,
+	// limits, canary ttl and options. The signer adds its version claim and
+	// manifest.
+	Query string `json:"query,omitempty"`
+	// Operators the messenger delivers the signed start message to
+	Operators []string `json:"operators"`
+}
+
+// InitSignature is the start message the signer published for the initiator
+type InitSignature struct {
+	Signer       types.OperatorID         `json:"signer"`
+	Message      []byte                   `json:"message"`
+	Query        string                   `json:"query,omitempty"`
+	VersionClaim *ceremony.VersionClaim   `json:"version_claim,omitempty"`
+	Manifest     *ceremony.SignedManifest `json:"manifest,omitempty"`
+}
+
+// StartPublisher hands a signed start message to the messenger, which
+// delivers it to the operators of the topic
+type StartPublisher interface {
+	PublishStart(ctx context.Context, topicName string, start *messenger.RelayedStart) error
+}
+
+var errNotInCommittee = errors.New("this operator isn't in the committee of the ceremony")
+
+// checkSigning is the start policy of a start message this node signs for an
+// initiator: the node has to be in the committee and would join the ceremony
+// itself. The checks that depend on the signature run again on every node the
+// message is delivered to.
+func (p *StartPolicy) checkSigning(msg *dkg.Message, query url.Values) error {
+	if msg.MsgType != dkg.InitMsgType && msg.MsgType != dkg.ReshareMsgType {
+		return fmt.Errorf("only keygen and resharing start messages are signed, not %s", msgTypeName(msg.MsgType))
+	}
+	params, err := StartParams(msg)
+	if err != nil {
+		return fmt.Errorf("failed to decode start message: %w", err)
+	}
+	member := false
+	for _, operatorID := range append(params.Operators, params.OldOperators...) {
+		member = member || operatorID == p.Self
+	}
+	if !member {
+		return errNotInCommittee
+	}
+	if err := p.check(msg, query); err != nil {
+		return err
+	}
+	canary, err := ceremony.ParseCanary(query, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := p.checkCanary(msg, canary); err != nil {
+		return err
+	}
+	if p.ReshareCheck != ReshareCheckWarn {
+		return p.checkReshare(msg)
+	}
+	return nil
+}
+
+// HandleSignInit signs the start message of an initiator with the operator
+// key of this node, after checking it against the start policy, and publishes
+// it to the topic of the ceremony for the messenger to deliver
+func (h *ApiHandler) HandleSignInit(policy *StartPolicy, publisher StartPublisher, operatorKey *rsa.PrivateKey) func(*gin.Context) {
+	return func(c *gin.Context) {
+		request := &InitSignRequest{}
+		if err := c.ShouldBindJSON(request); err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to parse start message to sign", err)
+			return
+		}
+		msg := &dkg.Message{}
+		if err := msg.Decode(request.Message); err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to decode start message to sign", err)
+			return
+		}
+		query, err := url.ParseQuery(request.Query)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid start message query", err)
+			return
+		}
+		if len(request.Operators) == 0 {
+			h.respondError(c, http.StatusBadRequest, "no operators to deliver the start message to", errors.New("operators are required"))
+			return
+		}
+		if err := policy.admit(); err != nil {
+			h.respondQuota(c, err)
+			return
+		}
+		if err := policy.checkLimits(msg, query); err != nil {
+			if !ceremony.IsLimitExceeded(err) {
+				h.respondError(c, http.StatusBadRequest, "invalid limits", err)
+				return
+			}
+			h.respondLimit(c, policy.limits(), err)
+			return
+		}
+		if err := policy.checkSigning(msg, query); err != nil {
+			h.logger.Warnf("HandleSignInit: refused to sign start message of request %x: %v", msg.Identifier[:], err)
+			h.respondError(c, http.StatusForbidden, "start message refused by node policy", err)
+			return
+		}
+		if err := checkSignManifest(msg, query, request); err != nil {
+			h.respondError(c, http.StatusBadRequest, "manifest doesn't describe the start message", err)
+			return
+		}
+		if err := checkSignOperators(msg, request.Operators); err != nil {
+			h.respondError(c, http.StatusBadRequest, "operators don't match the committee of the start message", err)
+			return
+		}
+
+		requestID := hex.EncodeToString(msg.Identifier[:])
+		signature, err := signInit(policy.Self, operatorKey, requestID, msg, request)
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "failed to sign start message", err)
+			return
+		}
+		for key, values := range signature.claimQuery() {
+			query[key] = values
+		}
+		signature.Query = query.Encode()
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		start := &messenger.RelayedStart{Operators: request.Operators, Message: signature.Message, Query: signature.Query}
+		if err := publisher.PublishStart(ctx, requestID, start); err != nil {
+			h.respondError(c, http.StatusBadGateway, "failed to publish start message", err)
+			return
+		}
+		h.logger.Infof("HandleSignInit: signed and published start message of request %s for %d operators", requestID, len(request.Operators))
+		c.JSON(http.StatusOK, signature)
+	}
+}
+
+// checkSignManifest keeps the signer from vouching for a manifest of another
+// ceremony than the one its start message starts
+func checkSignManifest(msg *dkg.Message, query url.Values, request *InitSignRequest) error {
+	if request.Manifest == nil {
+		return nil
+	}
+	params, err := StartParams(msg)
+	if err != nil {
+		return err
+	}
+	options, err := ceremony.OptionsFromQuery(query)
+	if err != nil {
+		return err
+	}
+	return request.Manifest.Matches(params, options, request.MinProtocolVersion)
+}
+
+// checkSignOperators keeps the signer from publishing a start message to
+// other operators than its committee: every operator of the keygen, or of
+// both committees of the resharing, once and nobody else
+func checkSignOperators(msg *dkg.Message, operators []string) error {
+	params, err := StartParams(msg)
+	if err != nil {
+		return err
+	}
+	members := append(append([]types.OperatorID{}, params.Operators...), params.OldOperators...)
+	committee := make(map[string]bool, len(members))
+	for _, operatorID := range members {
+		committee[strconv.Itoa(int(operatorID))] = true
+	}
+	listed := make(map[string]bool, len(operators))
+	for _, operator := range operators {
+		if !committee[operator] {
+			return fmt.Errorf("operator %s isn't in the committee", operator)
+		}
+		if listed[operator] {
+			return fmt.Errorf("operator %s is listed twice", operator)
+		}
+		listed[operator] = true
+	}
+	for _, operatorID := range members {
+		if !listed[strconv.Itoa(int(operatorID))] {
+			return fmt.Errorf("operator %d of the committee isn't listed", operatorID)
+		}
+	}
+	return nil
+}
+
+// signInit signs the version claim, the manifest and the start message with
+// the operator key of signer
+func signInit(signer types.OperatorID, sk *rsa.PrivateKey, requestID string, msg *dkg.Message, request *InitSignRequest) (*InitSignature, error) {
+	signature := &InitSignature{Signer: signer}
+	var err error
+	if request.MinProtocolVersion > 0 {
+		if signature.VersionClaim, err = ceremony.SignVersionClaim(sk, signer, requestID, request.MinProtocolVersion); err != nil {
+			return nil, err
+		}
+	}
+	if request.Manifest != nil {
+		if signature.Manifest, err = ceremony.SignManifest(sk, signer, requestID, request.Manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	signedMsg, err := testingutils.SignDKGMsg(sk, signer, msg).Encode()
+	if err != nil {
+		return nil, err
+	}
+	ssvMsg := &types.SSVMessage{MsgType: types.DKGMsgType, Data: signedMsg}
+	if signature.Message, err = ssvMsg.Encode(); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// claimQuery carries the version claim and manifest of the signer to the
+// nodes along with the start message
+func (s *InitSignature) claimQuery() url.Values {
+	query := url.Values{}
+	if s.VersionClaim != nil {
+		for key, values := range s.VersionClaim.Query() {
+			query[key] = values
+		}
+	}
+	if s.Manifest != nil {
+		for key, values := range s.Manifest.Query() {
+			query[key] = values
+		}
+	}
+	return query
+}
@@ -0,0 +1,233 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/messenger"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+type testPublisher struct {
+	topics []string
+	starts []*messenger.RelayedStart
+}
+
+func (p *testPublisher) PublishStart(_ context.Context, topicName string, start *messenger.RelayedStart) error {
+	p.topics = append(p.topics, topicName)
+	p.starts = append(p.starts, start)
+	return nil
+}
+
+// noShares holds no share of any validator
+type noShares struct{}
+
+func (noShares) GetKeyGenOutput(types.ValidatorPK) (*dkg.KeyGenOutput, error) {
+	return nil, storage.ErrKeyNotFound
+}
+
+func testInitMsg(t *testing.T) []byte {
+	init := &dkg.Init{
+		OperatorIDs:           []types.OperatorID{1, 2, 3, 4},
+		Threshold:             3,
+		WithdrawalCredentials: make([]byte, 32),
+		Fork:                  [4]byte{0, 0, 0x10, 0x20},
+	}
+	data, err := init.Encode()
+	require.NoError(t, err)
+	msg, err := (&dkg.Message{MsgType: dkg.InitMsgType, Identifier: dkg.RequestID{1}, Data: data}).Encode()
+	require.NoError(t, err)
+	return msg
+}
+
+func testInitManifest() *ceremony.Manifest {
+	return &ceremony.Manifest{
+		Version:               ceremony.ManifestVersion,
+		Kind:                  ceremony.KindKeygen,
+		Operators:             []types.OperatorID{1, 2, 3, 4},
+		Threshold:             3,
+		WithdrawalCredentials: hex.EncodeToString(make([]byte, 32)),
+		ForkVersion:           "00001020",
+	}
+}
+
+func encodeMsg(t *testing.T, msg *dkg.Message) []byte {
+	data, err := msg.Encode()
+	require.NoError(t, err)
+	return data
+}
+
+func postSignInit(t *testing.T, policy *StartPolicy, publisher StartPublisher, sk *rsa.PrivateKey, request *InitSignRequest) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/init/sign", New(testLogger(), nil).HandleSignInit(policy, publisher, sk))
+	body, err := json.Marshal(request)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/init/sign", bytes.NewReader(body)))
+	return w
+}
+
+func TestHandleSignInit(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publisher := &testPublisher{}
+
+	w := postSignInit(t, &StartPolicy{Self: 2}, publisher, sk, &InitSignRequest{
+		Message:   testInitMsg(t),
+		Manifest:  testInitManifest(),
+		Operators: []string{"4", "3", "2", "1"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	signature := &InitSignature{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), signature))
+	require.Equal(t, types.OperatorID(2), signature.Signer)
+	require.NoError(t, signature.Manifest.Verify(&sk.PublicKey))
+	require.Equal(t, []string{requestIDOf(&dkg.Message{Identifier: dkg.RequestID{1}})}, publisher.topics)
+	require.Equal(t, []string{"4", "3", "2", "1"}, publisher.starts[0].Operators)
+	require.Equal(t, signature.Message, publisher.starts[0].Message)
+}
+
+func TestHandleSignInitRefusals(t *testing.T) {
+	sk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	committee := []string{"1", "2", "3", "4"}
+	mismatch := testInitManifest()
+	mismatch.Threshold = 2
+
+	reshare := &dkg.Reshare{
+		ValidatorPK:    testValidatorPK(1),
+		OperatorIDs:    []types.OperatorID{1, 2, 3, 5},
+		OldOperatorIDs: []types.OperatorID{1, 2, 3, 4},
+		Threshold:      3,
+	}
+	reshareData, err := reshare.Encode()
+	require.NoError(t, err)
+	reshareMsg := encodeMsg(t, &dkg.Message{MsgType: dkg.ReshareMsgType, Identifier: dkg.RequestID{2}, Data: reshareData})
+
+	tests := []struct {
+		name    string
+		policy  *StartPolicy
+		request *InitSignRequest
+		status  int
+		error   string
+	}{
+		{
+			name:    "keysign",
+			policy:  &StartPolicy{Self: 1},
+			request: &InitSignRequest{Message: encodeMsg(t, testKeySignMsg(t, 3, testValidatorPK(1))), Operators: committee},
+			status:  http.StatusForbidden,
+			error:   "only keygen and resharing start messages are signed",
+		},
+		{
+			name:    "signer outside the committee",
+			policy:  &StartPolicy{Self: 7},
+			request: &InitSignRequest{Message: testInitMsg(t), Operators: committee},
+			status:  http.StatusForbidden,
+			error:   errNotInCommittee.Error(),
+		},
+		{
+			name:    "resharing of a share the signer doesn't hold",
+			policy:  &StartPolicy{Self: 1, ReshareCheck: ReshareCheckEnforce, Shares: noShares{}},
+			request: &InitSignRequest{Message: reshareMsg, Operators: []string{"1", "2", "3", "4", "5"}},
+			status:  http.StatusForbidden,
+		},
+		{
+			name:    "manifest of another ceremony",
+			policy:  &StartPolicy{Self: 1},
+			request: &InitSignRequest{Message: testInitMsg(t), Manifest: mismatch, Operators: committee},
+			status:  http.StatusBadRequest,
+			error:   "manifest threshold 2",
+		},
+		{
+			name:    "no operators",
+			policy:  &StartPolicy{Self: 1},
+			request: &InitSignRequest{Message: testInitMsg(t)},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "operator outside the committee",
+			policy:  &StartPolicy{Self: 1},
+			request: &InitSignRequest{Message: testInitMsg(t), Operators: []string{"1", "2", "3", "4", "9"}},
+			status:  http.StatusBadRequest,
+			error:   "operator 9 isn't in the committee",
+		},
+		{
+			name:    "operator of the committee left out",
+			policy:  &StartPolicy{Self: 1},
+			request: &InitSignRequest{Message: testInitMsg(t), Operators: []string{"1", "2", "3"}},
+			status:  http.StatusBadRequest,
+			error:   "operator 4 of the committee isn't listed",
+		},
+		{
+			name:    "operator listed twice",
+			policy:  &StartPolicy{Self: 1},
+			request: &InitSignRequest{Message: testInitMsg(t), Operators: []string{"1", "2", "3", "4", "4"}},
+			status:  http.StatusBadRequest,
+			error:   "operator 4 is listed twice",
+		},
+		{
+			name:    "resharing without its old committee",
+			policy:  &StartPolicy{Self: 1},
+			request: &InitSignRequest{Message: reshareMsg, Operators: []string{"1", "2", "3", "5"}},
+			status:  http.StatusBadRequest,
+			error:   "operator 4 of the committee isn't listed",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			publisher := &testPublisher{}
+			w := postSignInit(t, test.policy, publisher, sk, test.request)
+			require.Equal(t, test.status, w.Code, w.Body.String())
+			require.Contains(t, w.Body.String(), test.error)
+			require.Empty(t, publisher.starts, "nothing is published")
+		})
+	}
+
+	// both committees of a resharing get its start message
+	publisher := &testPublisher{}
+	w := postSignInit(t, &StartPolicy{Self: 5}, publisher, sk, &InitSignRequest{Message: reshareMsg, Operators: []string{"1", "2", "3", "4", "5"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, publisher.starts, 1)
+}
@@ -0,0 +1,115 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/hex"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/RockX-SG/frost-dkg-demo/internal/sink"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+)
+
+var sinkLabel = []byte("rockx-dkg-sink-record")
+
+const sinkTimeout = time.Minute
+
+// SinkPublisher pushes this node's result to the configured secret stores once
+// a keygen or resharing completes
+type SinkPublisher struct {
+	storage     *storage.Storage
+	sinks       []sink.Sink
+	operatorKey *rsa.PublicKey
+	logger      *logrus.Logger
+}
+
+func NewSinkPublisher(s *storage.Storage, sinks []sink.Sink, operatorKey *rsa.PublicKey, logger *logrus.Logger) *SinkPublisher {
+	return &SinkPublisher{storage: s, sinks: sinks, operatorKey: operatorKey, logger: logger}
+}
+
+// Observe is a ceremony.Listener
+func (p *SinkPublisher) Observe(c *ceremony.Ceremony, e *ceremony.Event) {
+	if e.Type != ceremony.EventCompleted || e.ValidatorPK == "" || len(p.sinks) == 0 {
+		return
+	}
+	if c.IsCanary() {
+		p.logger.Infof("SinkPublisher: not pushing result of canary request %s", c.RequestID)
+		return
+	}
+	go p.publish(c.RequestID, e)
+}
+
+func (p *SinkPublisher) publish(requestID string, e *ceremony.Event) {
+	record, err := p.record(requestID, e)
+	if err != nil {
+		p.logger.Errorf("SinkPublisher: failed to build record for request %s: %v", requestID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+	defer cancel()
+
+	for _, s := range p.sinks {
+		if err := s.Put(ctx, record); err != nil {
+			p.logger.Errorf("SinkPublisher: failed to push result of request %s to %s: %v", requestID, s.Name(), err)
+			continue
+		}
+		p.logger.Infof("SinkPublisher: pushed result of request %s to %s", requestID, s.Name())
+	}
+}
+
+func (p *SinkPublisher) record(requestID string, e *ceremony.Event) (*sink.Record, error) {
+	vk, err := hex.DecodeString(e.ValidatorPK)
+	if err != nil {
+		return nil, err
+	}
+	output, err := p.storage.GetKeyGenOutput(vk)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := encryption.SealRSA(p.operatorKey, []byte(output.Share.SerializeToHexStr()), sinkLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &sink.Record{
+		RequestID:       requestID,
+		OperatorID:      p.storage.OperatorID(),
+		ValidatorPK:     e.ValidatorPK,
+		SharePubKey:     output.Share.GetPublicKey().SerializeToHexStr(),
+		OperatorPubKeys: make(map[types.OperatorID]string),
+		Threshold:       output.Threshold,
+		EncryptedShare:  envelope,
+		CompletedAt:     e.Time.Unix(),
+	}
+	for operatorID, pk := range output.OperatorPubKeys {
+		record.OperatorPubKeys[operatorID] = pk.SerializeToHexStr()
+	}
+	return record, nil
+}
@@ -0,0 +1,295 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+)
+
+// ReconcilePolicy is what a node does at startup with the ceremonies its
+// records leave open
+type ReconcilePolicy string
+
+const (
+	// ReconcileResume finishes the ceremonies that got past their rounds from
+	// the result on the messenger, waiting for it while their topic is kept
+	ReconcileResume ReconcilePolicy = "resume"
+	// ReconcileAbort finishes the ceremonies whose result is on the messenger
+	// and aborts every other one
+	ReconcileAbort ReconcilePolicy = "abort"
+	// ReconcileOff leaves the records as they are
+	ReconcileOff ReconcilePolicy = "off"
+)
+
+// ParseReconcilePolicy returns the policy named s, ReconcileResume for an empty s
+func ParseReconcilePolicy(s string) (ReconcilePolicy, error) {
+	switch policy := ReconcilePolicy(s); policy {
+	case "":
+		return ReconcileResume, nil
+	case ReconcileResume, ReconcileAbort, ReconcileOff:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown reconcile policy %q, expected resume, abort or off", s)
+}
+
+// ReconcileMessenger is the part of the messenger client the reconciler uses
+type ReconcileMessenger interface {
+	GetTopics(ctx context.Context) (map[string]*messengerclient.Topic, error)
+	GetData(ctx context.Context, requestID string) (*messengerclient.DataStore, error)
+}
+
+// ReconcileReport is what the reconciler found and did at startup
+type ReconcileReport struct {
+	Policy ReconcilePolicy `json:"policy"`
+	// Topics is how many ceremony topics the operator is subscribed to
+	Topics int `json:"topics"`
+	// Open is how many ceremonies the records left open
+	Open int `json:"open"`
+	// Finished ceremonies were completed or blamed from the messenger result
+	Finished []string `json:"finished,omitempty"`
+	// Waiting ceremonies sent their output and wait for the result
+	Waiting []string           `json:"waiting,omitempty"`
+	Aborted []*AbortedCeremony `json:"aborted,omitempty"`
+	// Unknown are topics the operator is subscribed to without a record of
+	// the ceremony, the start message never reached the node
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+// AbortedCeremony is a ceremony the reconciler aborted and why
+type AbortedCeremony struct {
+	RequestID string         `json:"request_id"`
+	State     ceremony.State `json:"state"`
+	Reason    string         `json:"reason"`
+}
+
+// StartupReconciler compares the ceremonies the node records as open with the
+// topics of the messenger when the node starts. The dkg runners of a ceremony
+// live in memory, so a restarted node can't take part in its rounds anymore;
+// a ceremony past its rounds only waits for the result.
+type StartupReconciler struct {
+	// Interval between the checks for the result of waiting ceremonies
+	Interval time.Duration
+	// HandedOver, when set, reports the ceremonies the process this one
+	// replaced still runs, they are left to it
+	HandedOver func(requestID string) bool
+
+	policy   ReconcilePolicy
+	self     types.OperatorID
+	storage  *storage.Storage
+	tracker  *ceremony.Tracker
+	watchdog *ceremony.Watchdog
+	network  *ObservedNetwork
+	client   ReconcileMessenger
+	logger   *logrus.Logger
+}
+
+func NewStartupReconciler(policy ReconcilePolicy, self types.OperatorID, s *storage.Storage, tracker *ceremony.Tracker, watchdog *ceremony.Watchdog, network *ObservedNetwork, client ReconcileMessenger, logger *logrus.Logger) *StartupReconciler {
+	return &StartupReconciler{
+		Interval: 15 * time.Second,
+		policy:   policy,
+		self:     self,
+		storage:  s,
+		tracker:  tracker,
+		watchdog: watchdog,
+		network:  network,
+		client:   client,
+		logger:   logger,
+	}
+}
+
+// Reconcile settles the open ceremonies per policy and logs the report. The
+// ceremonies left waiting are checked every interval until done is closed.
+func (r *StartupReconciler) Reconcile(done <-chan struct{}) (*ReconcileReport, error) {
+	report := &ReconcileReport{Policy: r.policy}
+	if r.policy == ReconcileOff {
+		return report, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	open, err := r.openCeremonies()
+	if err != nil {
+		return nil, fmt.Errorf("Reconcile: %w", err)
+	}
+	topics, err := r.client.GetTopics(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Reconcile: failed to get the topics of the messenger: %w", err)
+	}
+	subscribed := make(map[string]bool)
+	for name, topic := range topics {
+		if _, ok := topic.Subscribers[strconv.Itoa(int(r.self))]; ok && name != messengerclient.DefaultTopic {
+			subscribed[name] = true
+		}
+	}
+	report.Topics, report.Open = len(subscribed), len(open)
+
+	for _, c := range open {
+		switch {
+		case r.finish(ctx, c):
+			report.Finished = append(report.Finished, c.RequestID)
+		case c.State != ceremony.StateOutputPending:
+			r.abort(report, c, fmt.Sprintf("node restarted in state %s, the round state of the ceremony is lost", c.State))
+		case !subscribed[c.RequestID]:
+			r.abort(report, c, "node restarted waiting for the result, the messenger has no topic for the ceremony")
+		case r.policy == ReconcileAbort:
+			r.abort(report, c, "node restarted waiting for the result, aborted by policy")
+		default:
+			r.watchdog.Rearm(c)
+			report.Waiting = append(report.Waiting, c.RequestID)
+		}
+	}
+	for name := range subscribed {
+		if !r.tracker.Exists(name) {
+			report.Unknown = append(report.Unknown, name)
+		}
+	}
+	sort.Strings(report.Unknown)
+
+	r.log(report)
+	if len(report.Waiting) > 0 {
+		go r.await(append([]string{}, report.Waiting...), done)
+	}
+	return report, nil
+}
+
+// openCeremonies loads the ceremonies in a state that isn't terminal
+func (r *StartupReconciler) openCeremonies() ([]*ceremony.Ceremony, error) {
+	var open []*ceremony.Ceremony
+	for _, state := range ceremony.States {
+		if state.IsTerminal() {
+			continue
+		}
+		opts := storage.ListOptions{}
+		for {
+			ids, next, err := r.storage.ListCeremoniesByStatus(state, opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				if r.HandedOver != nil && r.HandedOver(id) {
+					continue
+				}
+				c, err := r.tracker.Get(id)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load ceremony %s: %w", id, err)
+				}
+				open = append(open, c)
+			}
+			if next == "" {
+				break
+			}
+			opts.After = next
+		}
+	}
+	return open, nil
+}
+
+// finish records the result of the ceremony on the messenger, it reports
+// whether there was one. Only a node past its rounds may take the outputs,
+// its share is stored before it sends its output.
+func (r *StartupReconciler) finish(ctx context.Context, c *ceremony.Ceremony) bool {
+	if c.State != ceremony.StateOutputPending && c.State != ceremony.StateRound1 && c.State != ceremony.StateRound2 {
+		return false
+	}
+	data, err := r.client.GetData(ctx, c.RequestID)
+	if err != nil {
+		if !messengerclient.IsNotFound(err) {
+			r.logger.Warnf("StartupReconciler: failed to get the result of request %s: %v", c.RequestID, err)
+		}
+		return false
+	}
+	switch {
+	case data.BlameOutput != nil:
+		r.network.recordBlame(data.BlameOutput)
+	case c.State == ceremony.StateOutputPending && data.DKGOutputs[r.self] != nil:
+		r.network.recordOutput(data.DKGOutputs)
+	default:
+		return false
+	}
+	return true
+}
+
+func (r *StartupReconciler) abort(report *ReconcileReport, c *ceremony.Ceremony, reason string) {
+	recordEvent(r.tracker, r.logger, c.RequestID, ceremony.EventAborted, func(e *ceremony.Event) {
+		e.Details = reason
+		e.Cause = ceremony.CauseRestarted
+	})
+	report.Aborted = append(report.Aborted, &AbortedCeremony{RequestID: c.RequestID, State: c.State, Reason: reason})
+}
+
+func (r *StartupReconciler) log(report *ReconcileReport) {
+	r.logger.Infof("StartupReconciler: policy %s, %d open ceremonies, %d topics on the messenger: %d finished from the messenger result, %d waiting for the result, %d aborted, %d unknown",
+		report.Policy, report.Open, report.Topics, len(report.Finished), len(report.Waiting), len(report.Aborted), len(report.Unknown))
+	for _, requestID := range report.Finished {
+		r.logger.Infof("StartupReconciler: request %s finished from the messenger result", requestID)
+	}
+	for _, requestID := range report.Waiting {
+		r.logger.Infof("StartupReconciler: request %s waits for the result", requestID)
+	}
+	for _, aborted := range report.Aborted {
+		r.logger.Warnf("StartupReconciler: request %s aborted: %s", aborted.RequestID, aborted.Reason)
+	}
+	for _, requestID := range report.Unknown {
+		r.logger.Warnf("StartupReconciler: subscribed to request %s without a record of it, its start message never arrived", requestID)
+	}
+}
+
+// await checks for the result of the waiting ceremonies every interval, until
+// it is in or the watchdog ended the ceremony
+func (r *StartupReconciler) await(waiting []string, done <-chan struct{}) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for len(waiting) > 0 {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		pending := waiting[:0]
+		for _, requestID := range waiting {
+			c, err := r.tracker.Get(requestID)
+			if err != nil || c.State != ceremony.StateOutputPending {
+				continue
+			}
+			if r.finish(ctx, c) {
+				r.logger.Infof("StartupReconciler: request %s finished from the messenger result", requestID)
+				continue
+			}
+			pending = append(pending, requestID)
+		}
+		cancel()
+		waiting = pending
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/stats"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleStats aggregates the ceremonies this node took part in over the last
+// ?days= days: ceremonies per day, success rate, mean duration and the
+// operators the failures are attributed to
+func (h *ApiHandler) HandleStats(s *storage.Storage) func(*gin.Context) {
+	return func(c *gin.Context) {
+		days, err := stats.ParseDays(c.Query("days"))
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid stats parameters", err)
+			return
+		}
+
+		ids, err := s.ListCeremonyIDs()
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to list ceremonies", err)
+			return
+		}
+		samples := make([]stats.Sample, 0, len(ids))
+		for _, requestID := range ids {
+			cer, err := h.tracker.Get(requestID)
+			if err != nil {
+				h.respondError(c, http.StatusInternalServerError, "failed to load ceremony", err)
+				return
+			}
+			if sample, ok := stats.FromCeremony(cer); ok {
+				samples = append(samples, sample)
+			}
+		}
+		c.JSON(http.StatusOK, stats.Aggregate(samples, days, time.Now()))
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/internal/telemetry"
+	"github.com/gin-gonic/gin"
+)
+
+// TelemetrySource lists the ceremonies of the storage for the telemetry reports
+func TelemetrySource(s *storage.Storage, tracker *ceremony.Tracker) telemetry.Source {
+	return func() ([]*ceremony.Ceremony, error) {
+		ids, err := s.ListCeremonyIDs()
+		if err != nil {
+			return nil, err
+		}
+		ceremonies := make([]*ceremony.Ceremony, 0, len(ids))
+		for _, requestID := range ids {
+			c, err := tracker.Get(requestID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load ceremony %s: %w", requestID, err)
+			}
+			ceremonies = append(ceremonies, c)
+		}
+		return ceremonies, nil
+	}
+}
+
+// HandleTelemetryPreview returns exactly the report the node would send next,
+// also while telemetry is off
+func (h *ApiHandler) HandleTelemetryPreview(reporter *telemetry.Reporter) func(*gin.Context) {
+	return func(c *gin.Context) {
+		report, err := reporter.Preview()
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to build telemetry report", err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
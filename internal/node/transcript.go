@@ -0,0 +1,171 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type TranscriptStore interface {
+	SaveTranscript(record *observer.TranscriptRecord) error
+	// GetTranscript returns observer.ErrNoTranscript when no transcript was stored for requestID
+	GetTranscript(requestID string) (*observer.TranscriptRecord, error)
+}
+
+// TranscriptRecorder collects the broadcast messages of the keygens and
+// resharings this node takes part in, its own and the ones of its peers, and
+// stores the transcript once the ceremony finished so it can be verified
+// again later without any node
+type TranscriptRecorder struct {
+	keys   observer.KeyLookup
+	store  TranscriptStore
+	logger *logrus.Logger
+
+	mu          sync.Mutex
+	transcripts map[string]*observer.Transcript
+}
+
+func NewTranscriptRecorder(keys observer.KeyLookup, store TranscriptStore, logger *logrus.Logger) *TranscriptRecorder {
+	return &TranscriptRecorder{
+		keys:        keys,
+		store:       store,
+		logger:      logger,
+		transcripts: make(map[string]*observer.Transcript),
+	}
+}
+
+// Start opens the transcript of the ceremony started by msg, keysign
+// ceremonies have no transcript
+func (r *TranscriptRecorder) Start(msg *dkg.SignedMessage) {
+	if r == nil || (msg.Message.MsgType != dkg.InitMsgType && msg.Message.MsgType != dkg.ReshareMsgType) {
+		return
+	}
+	requestID := hex.EncodeToString(msg.Message.Identifier[:])
+	t, err := observer.NewTranscript(msg, r.keys)
+	if err != nil {
+		r.logger.Warnf("TranscriptRecorder: no transcript for request %s: %v", requestID, err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.transcripts[requestID]; !ok {
+		r.transcripts[requestID] = t
+	}
+}
+
+// Drop forgets the transcript of a ceremony that didn't start
+func (r *TranscriptRecorder) Drop(requestID string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.transcripts, requestID)
+}
+
+// Add records a message of a running ceremony, messages of ceremonies without
+// a transcript are ignored
+func (r *TranscriptRecorder) Add(msg *dkg.SignedMessage) {
+	if r == nil {
+		return
+	}
+	requestID := hex.EncodeToString(msg.Message.Identifier[:])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.transcripts[requestID]
+	if !ok {
+		return
+	}
+	if err := t.Add(msg); err != nil {
+		r.logger.Warnf("TranscriptRecorder: message of operator %d not added to transcript of request %s: %v", msg.Signer, requestID, err)
+	}
+}
+
+// Conflict records msg when its signer sent a different message for the same
+// round of the ceremony before, and returns the equivocation. isNew is false
+// for a conflicting message recorded already, e.g. delivered again.
+func (r *TranscriptRecorder) Conflict(msg *dkg.SignedMessage) (e *observer.Equivocation, isNew bool) {
+	if r == nil {
+		return nil, false
+	}
+	requestID := hex.EncodeToString(msg.Message.Identifier[:])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.transcripts[requestID]
+	if !ok {
+		return nil, false
+	}
+	return t.Conflict(msg)
+}
+
+// Observe is a ceremony.Listener storing the transcript of a ceremony once it
+// finished, aborted ceremonies keep theirs too
+func (r *TranscriptRecorder) Observe(cer *ceremony.Ceremony, e *ceremony.Event) {
+	if !cer.State.IsTerminal() {
+		return
+	}
+	r.mu.Lock()
+	t, ok := r.transcripts[cer.RequestID]
+	delete(r.transcripts, cer.RequestID)
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	record, err := t.Record()
+	if err != nil {
+		r.logger.Errorf("TranscriptRecorder: failed to record transcript of request %s: %v", cer.RequestID, err)
+		return
+	}
+	if err := r.store.SaveTranscript(record); err != nil {
+		r.logger.Errorf("TranscriptRecorder: failed to save transcript of request %s: %v", cer.RequestID, err)
+		return
+	}
+	r.logger.Infof("TranscriptRecorder: saved transcript of request %s with %d messages", cer.RequestID, len(record.Messages))
+}
+
+// HandleGetTranscript returns the stored transcript of a finished ceremony
+func (h *ApiHandler) HandleGetTranscript(store TranscriptStore) func(*gin.Context) {
+	return func(c *gin.Context) {
+		record, err := store.GetTranscript(c.Param("request_id"))
+		if errors.Is(err, observer.ErrNoTranscript) {
+			h.respondError(c, http.StatusNotFound, "no transcript for ceremony", err)
+			return
+		} else if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to load transcript", err)
+			return
+		}
+		c.JSON(http.StatusOK, record)
+	}
+}
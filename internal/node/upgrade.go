@@ -0,0 +1,76 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/upgrade"
+	"github.com/gin-gonic/gin"
+)
+
+var errHandingOver = errors.New("start the ceremony again once the new node process serves")
+
+// HandedOver passes the requests about ceremonies the process this one
+// replaced still runs to that process, the rest go on to this one
+func (h *ApiHandler) HandedOver(p *upgrade.Predecessor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p == nil {
+			c.Next()
+			return
+		}
+		requestID := c.Param("request_id")
+		if requestID == "" {
+			requestID = bodyRequestID(c)
+		}
+		if !p.Owns(requestID) {
+			c.Next()
+			return
+		}
+		p.Forward(c.Writer, c.Request)
+		c.Abort()
+	}
+}
+
+// bodyRequestID is the request id of a round message or a resend request in
+// the body, which is left to be read again
+func bodyRequestID(c *gin.Context) string {
+	if c.FullPath() == "/consume" {
+		signedMsg, data, err := readSignedMessage(c)
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		if err != nil {
+			return ""
+		}
+		return hex.EncodeToString(signedMsg.Message.Identifier[:])
+	}
+	data, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	req := &ResendRequest{}
+	if err != nil || json.Unmarshal(data, req) != nil {
+		return ""
+	}
+	return req.RequestID
+}
@@ -0,0 +1,72 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"net/http"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/gin-gonic/gin"
+)
+
+// ShareUsage is what this node signed with its shares of a validator, oldest
+// first
+type ShareUsage struct {
+	ValidatorPK string        `json:"validator_pk"`
+	Entries     []*UsageEntry `json:"entries"`
+}
+
+// UsageEntry is a usage entry with the state its ceremony is in, empty once
+// the ceremony was purged
+type UsageEntry struct {
+	*storage.UsageEntry
+	State ceremony.State `json:"state,omitempty"`
+}
+
+// HandleGetUsage returns the deposit and keysigns this node signed with its
+// shares of the validator, empty when it took part in none
+func (h *ApiHandler) HandleGetUsage(s *storage.Storage) func(*gin.Context) {
+	return func(c *gin.Context) {
+		pk, err := hexenc.ParseValidatorPK(c.Param("validator_pk"))
+		if err != nil {
+			h.respondError(c, http.StatusBadRequest, "invalid validator pk", err)
+			return
+		}
+		entries, err := s.Usage(pk)
+		if err != nil {
+			h.respondError(c, http.StatusInternalServerError, "failed to get usage", err)
+			return
+		}
+		usage := &ShareUsage{ValidatorPK: hex.EncodeToString(pk), Entries: make([]*UsageEntry, 0, len(entries))}
+		for _, entry := range entries {
+			record := &UsageEntry{UsageEntry: entry}
+			if cer, err := h.tracker.Get(entry.RequestID); err == nil {
+				record.State = cer.State
+			}
+			usage.Entries = append(usage.Entries, record)
+		}
+		c.JSON(http.StatusOK, usage)
+	}
+}
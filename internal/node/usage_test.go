@@ -0,0 +1,41 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetUsageValidatorPK(t *testing.T) {
+	s, _ := openTestStorage(t, "")
+	h := New(testLogger(), ceremony.NewTracker(newMemEvents()))
+	pk := hex.EncodeToString(testValidatorPK(0xab))
+
+	for _, form := range []string{pk, "0x" + strings.ToUpper(pk)} {
+		require.Equal(t, pk, getValidatorPK(t, "/usage/:validator_pk", h.HandleGetUsage(s), form))
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+)
+
+// checkVersion returns the protocol version a keygen or resharing is held to
+// and the initiator's claim of it. A start message without a claim runs at
+// version 1, unless the node's own minimum is higher: a claim stripped on
+// the way is a downgrade the node refuses.
+func (p *StartPolicy) checkVersion(signedMsg *dkg.SignedMessage, query url.Values) (uint32, *ceremony.VersionClaim, error) {
+	minVersion := p.MinProtocolVersion
+	if minVersion < ceremony.ProtocolV1 {
+		minVersion = ceremony.ProtocolV1
+	}
+	msgType := signedMsg.Message.MsgType
+	if msgType != dkg.InitMsgType && msgType != dkg.ReshareMsgType {
+		return 0, nil, nil
+	}
+
+	claim, err := ceremony.ParseVersionClaim(query)
+	if err != nil {
+		return 0, nil, err
+	}
+	if claim == nil {
+		if minVersion > ceremony.ProtocolV1 {
+			return 0, nil, fmt.Errorf("start message without version claim, this node requires protocol version %d", minVersion)
+		}
+		return minVersion, nil, nil
+	}
+
+	if claim.RequestID != hex.EncodeToString(signedMsg.Message.Identifier[:]) || claim.Operator != signedMsg.Signer {
+		return 0, nil, fmt.Errorf("version claim of operator %d for request %s isn't the claim of the start message", claim.Operator, claim.RequestID)
+	}
+	if p.Keys == nil {
+		return 0, nil, fmt.Errorf("no operator keys to check the version claim")
+	}
+	pk, err := p.Keys(claim.Operator)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get the key of operator %d: %w", claim.Operator, err)
+	}
+	if err := claim.Verify(pk); err != nil {
+		return 0, nil, err
+	}
+	if claim.MinVersion > ceremony.ProtocolVersion {
+		return 0, nil, fmt.Errorf("ceremony requires protocol version %d, this node speaks version %d", claim.MinVersion, ceremony.ProtocolVersion)
+	}
+	if claim.MinVersion > minVersion {
+		minVersion = claim.MinVersion
+	}
+	if minVersion >= ceremony.ProtocolV2 && !p.SignedDeliveries {
+		return 0, nil, fmt.Errorf("protocol version %d needs signed messenger deliveries, no relay key is configured", minVersion)
+	}
+	return minVersion, claim, nil
+}
+
+// relayRequired reports whether the deliveries of a ceremony have to be
+// signed by the messenger, for ceremonies held to protocol version 2
+func (h *ApiHandler) relayRequired(requestID string) bool {
+	cer, err := h.tracker.Get(requestID)
+	if err != nil {
+		return false
+	}
+	return cer.MinProtocolVersion() >= ceremony.ProtocolV2
+}
@@ -0,0 +1,207 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Approval is the statement of a committee operator that it accepts the
+// consolidated result of a ceremony, identified by its result hash. It is
+// signed with the operator's key.
+type Approval struct {
+	RequestID  string           `json:"request_id"`
+	Operator   types.OperatorID `json:"operator"`
+	ResultHash string           `json:"result_hash"`
+	CreatedAt  int64            `json:"created_at"`
+	Signature  []byte           `json:"signature,omitempty"`
+}
+
+// consolidatedShare and consolidatedResult are the canonical form of a
+// result the hash is computed over
+type consolidatedShare struct {
+	Operator       types.OperatorID `json:"operator"`
+	SharePubKey    string           `json:"share_pub_key"`
+	EncryptedShare string           `json:"encrypted_share"`
+}
+
+type consolidatedResult struct {
+	RequestID   string              `json:"request_id"`
+	ValidatorPK string              `json:"validator_pk"`
+	Signature   string              `json:"signature"`
+	Shares      []consolidatedShare `json:"shares,omitempty"`
+}
+
+// ResultHash is the hash of the consolidated result of the outputs of a
+// committee: the validator key, the deposit data signature or the key sign
+// signature, and the share of every operator in ascending order. The outputs
+// have to agree on the result.
+func ResultHash(outputs map[types.OperatorID]*dkg.SignedOutput) ([]byte, error) {
+	if len(outputs) == 0 {
+		return nil, errors.New("no outputs")
+	}
+	operators := make([]types.OperatorID, 0, len(outputs))
+	for operatorID := range outputs {
+		operators = append(operators, operatorID)
+	}
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+
+	var result *consolidatedResult
+	reference := outputs[operators[0]]
+	for _, operatorID := range operators {
+		output := outputs[operatorID]
+		if output.BlameData != nil {
+			return nil, fmt.Errorf("operator %d output a blame", operatorID)
+		}
+		if err := sameResult(reference, output); err != nil {
+			return nil, fmt.Errorf("output of operator %d disagrees with operator %d: %w", operatorID, reference.Signer, err)
+		}
+		requestID, err := outputRequestID(output)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			result = &consolidatedResult{RequestID: requestID}
+		} else if result.RequestID != requestID {
+			return nil, fmt.Errorf("output of operator %d is for request %s", operatorID, requestID)
+		}
+		if output.KeySignData != nil {
+			result.ValidatorPK = hex.EncodeToString(output.KeySignData.ValidatorPK)
+			result.Signature = hex.EncodeToString(output.KeySignData.Signature)
+			continue
+		}
+		result.ValidatorPK = hex.EncodeToString(output.Data.ValidatorPubKey)
+		result.Signature = hex.EncodeToString(output.Data.DepositDataSignature)
+		result.Shares = append(result.Shares, consolidatedShare{
+			Operator:       operatorID,
+			SharePubKey:    hex.EncodeToString(output.Data.SharePubKey),
+			EncryptedShare: hex.EncodeToString(output.Data.EncryptedShare),
+		})
+	}
+	byts, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(byts)
+	return h[:], nil
+}
+
+// Approve returns the unsigned approval of operator for the consolidated
+// result of the outputs
+func Approve(requestID string, operator types.OperatorID, outputs map[types.OperatorID]*dkg.SignedOutput) (*Approval, error) {
+	if _, ok := outputs[operator]; !ok {
+		return nil, fmt.Errorf("no output of operator %d", operator)
+	}
+	hash, err := ResultHash(outputs)
+	if err != nil {
+		return nil, err
+	}
+	return &Approval{
+		RequestID:  requestID,
+		Operator:   operator,
+		ResultHash: hex.EncodeToString(hash),
+		CreatedAt:  time.Now().UTC().Unix(),
+	}, nil
+}
+
+func (a *Approval) Root() ([]byte, error) {
+	unsigned := *a
+	unsigned.Signature = nil
+	byts, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(byts)
+	return h[:], nil
+}
+
+func (a *Approval) Sign(sk *rsa.PrivateKey) error {
+	root, err := a.Root()
+	if err != nil {
+		return err
+	}
+	a.Signature, err = types.Sign(sk, root)
+	return err
+}
+
+// Verify checks the signature of the approval against the operator's key
+func (a *Approval) Verify(pk *rsa.PublicKey) error {
+	root, err := a.Root()
+	if err != nil {
+		return err
+	}
+	if !types.Verify(pk, root, a.Signature) {
+		return fmt.Errorf("invalid signature of operator %d", a.Operator)
+	}
+	return nil
+}
+
+// CommitteeApproval are the approvals of the operators of a ceremony for its
+// consolidated result
+type CommitteeApproval struct {
+	ResultHash string      `json:"result_hash"`
+	Approvals  []*Approval `json:"approvals"`
+}
+
+// Approved returns the operators whose approval is signed by their registry
+// key and is for the result of the outputs, in ascending order. Approvals of
+// operators without an output don't count.
+func (a *CommitteeApproval) Approved(requestID string, outputs map[types.OperatorID]*dkg.SignedOutput, keys KeyLookup) ([]types.OperatorID, error) {
+	hash, err := ResultHash(outputs)
+	if err != nil {
+		return nil, err
+	}
+	if a.ResultHash != hex.EncodeToString(hash) {
+		return nil, fmt.Errorf("approvals are for result %s, the outputs hash to %x", a.ResultHash, hash)
+	}
+	seen := make(map[types.OperatorID]bool)
+	var approved []types.OperatorID
+	for _, approval := range a.Approvals {
+		if _, ok := outputs[approval.Operator]; !ok || seen[approval.Operator] {
+			continue
+		}
+		if approval.RequestID != requestID || approval.ResultHash != a.ResultHash {
+			continue
+		}
+		pk, err := keys(approval.Operator)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key of operator %d: %w", approval.Operator, err)
+		}
+		if approval.Verify(pk) != nil {
+			continue
+		}
+		seen[approval.Operator] = true
+		approved = append(approved, approval.Operator)
+	}
+	sort.Slice(approved, func(i, j int) bool { return approved[i] < approved[j] })
+	return approved, nil
+}
@@ -0,0 +1,91 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultHash(t *testing.T) {
+	vk, _ := hex.DecodeString(testingutils.KeygenMsgStore.Round2[1].Vk)
+	outputs := map[types.OperatorID]*dkg.SignedOutput{}
+	for _, operatorID := range testOperators {
+		outputs[operatorID] = testOutput(t, operatorID, vk)
+	}
+	hash, err := ResultHash(outputs)
+	require.NoError(t, err)
+	again, err := ResultHash(outputs)
+	require.NoError(t, err)
+	require.Equal(t, hash, again)
+
+	// a share of another operator is another result
+	outputs[4] = testOutput(t, 4, vk)
+	outputs[4].Data.SharePubKey = []byte{9}
+	other, err := ResultHash(outputs)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, other)
+
+	outputs[4] = testOutput(t, 4, []byte("other key"))
+	_, err = ResultHash(outputs)
+	require.ErrorContains(t, err, "output of operator 4 disagrees with operator 1: different validator key")
+}
+
+func TestCommitteeApproval(t *testing.T) {
+	vk, _ := hex.DecodeString(testingutils.KeygenMsgStore.Round2[1].Vk)
+	requestID := requestIDHex(testRequestID)
+	outputs := map[types.OperatorID]*dkg.SignedOutput{}
+	for _, operatorID := range testOperators {
+		outputs[operatorID] = testOutput(t, operatorID, vk)
+	}
+
+	approval := &CommitteeApproval{}
+	for _, operatorID := range []types.OperatorID{3, 1, 2} {
+		signed, err := Approve(requestID, operatorID, outputs)
+		require.NoError(t, err)
+		require.NoError(t, signed.Sign(testingutils.TestingKeygenKeySet().DKGOperators[operatorID].EncryptionKey))
+		approval.ResultHash = signed.ResultHash
+		approval.Approvals = append(approval.Approvals, signed)
+	}
+	// signed with the key of another operator
+	forged, err := Approve(requestID, 4, outputs)
+	require.NoError(t, err)
+	require.NoError(t, forged.Sign(testingutils.TestingKeygenKeySet().DKGOperators[1].EncryptionKey))
+	approval.Approvals = append(approval.Approvals, forged, approval.Approvals[0])
+
+	approved, err := approval.Approved(requestID, outputs, testKeys)
+	require.NoError(t, err)
+	require.Equal(t, []types.OperatorID{1, 2, 3}, approved)
+
+	outputs[4].Data.EncryptedShare = []byte("tampered")
+	_, err = approval.Approved(requestID, outputs, testKeys)
+	require.ErrorContains(t, err, "approvals are for result "+approval.ResultHash)
+
+	delete(outputs, 4)
+	_, err = Approve(requestID, 4, outputs)
+	require.EqualError(t, err, "no output of operator 4")
+}
@@ -0,0 +1,119 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Attestation is the statement of an observer about one ceremony: the
+// transcript it received and whether the outputs of the committee are
+// consistent with it. It is signed with the observer's operator key.
+type Attestation struct {
+	RequestID    string             `json:"request_id"`
+	Observer     types.OperatorID   `json:"observer"`
+	Kind         ceremony.Kind      `json:"kind"`
+	Operators    []types.OperatorID `json:"operators"`
+	OldOperators []types.OperatorID `json:"old_operators,omitempty"`
+	Threshold    uint64             `json:"threshold"`
+	// ValidatorPK is the key the commitments add up to, empty when they couldn't be checked
+	ValidatorPK    string   `json:"validator_pk,omitempty"`
+	TranscriptRoot string   `json:"transcript_root"`
+	Messages       int      `json:"messages"`
+	Valid          bool     `json:"valid"`
+	Findings       []string `json:"findings,omitempty"`
+	CreatedAt      int64    `json:"created_at"`
+	Signature      []byte   `json:"signature,omitempty"`
+}
+
+// Attest verifies the transcript and returns the unsigned attestation of observer
+func Attest(t *Transcript, observer types.OperatorID) *Attestation {
+	validatorPK, findings := t.Verify()
+	return &Attestation{
+		RequestID:      requestIDHex(t.RequestID),
+		Observer:       observer,
+		Kind:           t.Kind,
+		Operators:      t.Operators,
+		OldOperators:   t.OldOperators,
+		Threshold:      t.Threshold,
+		ValidatorPK:    hex.EncodeToString(validatorPK),
+		TranscriptRoot: hex.EncodeToString(t.Root()),
+		Messages:       t.Messages(),
+		Valid:          len(findings) == 0,
+		Findings:       findings,
+		CreatedAt:      time.Now().UTC().Unix(),
+	}
+}
+
+func (a *Attestation) Root() ([]byte, error) {
+	unsigned := *a
+	unsigned.Signature = nil
+	byts, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(byts)
+	return h[:], nil
+}
+
+func (a *Attestation) Sign(sk *rsa.PrivateKey) error {
+	root, err := a.Root()
+	if err != nil {
+		return err
+	}
+	a.Signature, err = types.Sign(sk, root)
+	return err
+}
+
+// Verify checks the signature of the attestation against the observer's key
+func (a *Attestation) Verify(pk *rsa.PublicKey) error {
+	root, err := a.Root()
+	if err != nil {
+		return err
+	}
+	if !types.Verify(pk, root, a.Signature) {
+		return fmt.Errorf("invalid signature of observer %d", a.Observer)
+	}
+	return nil
+}
+
+// Vouches returns why the attestation doesn't vouch for a correct ceremony
+// producing validatorPK, nil when it does
+func (a *Attestation) Vouches(validatorPK types.ValidatorPK) error {
+	if !a.Valid {
+		return errors.New("observer found the ceremony incorrect")
+	}
+	if !hexenc.Equal(a.ValidatorPK, hexenc.Key(validatorPK)) {
+		return fmt.Errorf("observer attested validator key %s", a.ValidatorPK)
+	}
+	return nil
+}
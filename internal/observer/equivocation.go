@@ -0,0 +1,123 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Equivocation is an operator sending two different messages for the same
+// round of a ceremony. Both messages carry the operator's signature, anyone
+// with its registry key can check the evidence without trusting the node
+// that reported it.
+type Equivocation struct {
+	Operator types.OperatorID   `json:"operator"`
+	Round    string             `json:"round"`
+	First    *dkg.SignedMessage `json:"first"`
+	Second   *dkg.SignedMessage `json:"second"`
+
+	key  string
+	root []byte
+}
+
+func (e *Equivocation) Error() string {
+	return fmt.Sprintf("operator %d sent conflicting %s messages", e.Operator, e.Round)
+}
+
+// Blame is the equivocation as a frost blame of inconsistent messages, the two
+// signed messages are its blame data
+func (e *Equivocation) Blame() (*frost.BlameMessage, error) {
+	first, err := e.First.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("Blame: failed to encode message: %w", err)
+	}
+	second, err := e.Second.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("Blame: failed to encode message: %w", err)
+	}
+	return &frost.BlameMessage{
+		Type:             frost.InconsistentMessage,
+		TargetOperatorID: uint32(e.Operator),
+		BlameData:        [][]byte{first, second},
+	}, nil
+}
+
+// EquivocationFromBlame checks the evidence of a blame of inconsistent
+// messages: two different messages signed by the blamed operator for the same
+// round of the same ceremony
+func EquivocationFromBlame(blame *frost.BlameMessage, keys KeyLookup) (*Equivocation, error) {
+	if blame.Type != frost.InconsistentMessage {
+		return nil, fmt.Errorf("EquivocationFromBlame: blame of %s, not of inconsistent messages", blame.Type.ToString())
+	}
+	if len(blame.BlameData) != 2 {
+		return nil, fmt.Errorf("EquivocationFromBlame: %d messages as evidence, expected 2", len(blame.BlameData))
+	}
+
+	msgs := make([]*dkg.SignedMessage, 2)
+	keysByRound := make([]string, 2)
+	roots := make([][]byte, 2)
+	for i, data := range blame.BlameData {
+		msg := &dkg.SignedMessage{}
+		if err := msg.Decode(data); err != nil || msg.Message == nil {
+			return nil, errors.New("EquivocationFromBlame: evidence is not a signed dkg message")
+		}
+		if msg.Signer != types.OperatorID(blame.TargetOperatorID) {
+			return nil, fmt.Errorf("EquivocationFromBlame: message signed by operator %d, not by the blamed operator %d", msg.Signer, blame.TargetOperatorID)
+		}
+		if err := VerifySignedMessage(msg, keys); err != nil {
+			return nil, fmt.Errorf("EquivocationFromBlame: %w", err)
+		}
+		round, err := messageRound(msg)
+		if err != nil {
+			return nil, fmt.Errorf("EquivocationFromBlame: %w", err)
+		}
+		root, err := msg.GetRoot()
+		if err != nil {
+			return nil, fmt.Errorf("EquivocationFromBlame: %w", err)
+		}
+		msgs[i], keysByRound[i], roots[i] = msg, messageKey(msg, round), root
+	}
+
+	switch {
+	case msgs[0].Message.Identifier != msgs[1].Message.Identifier:
+		return nil, errors.New("EquivocationFromBlame: the messages belong to different ceremonies")
+	case keysByRound[0] != keysByRound[1]:
+		return nil, errors.New("EquivocationFromBlame: the messages belong to different rounds")
+	case bytes.Equal(roots[0], roots[1]):
+		return nil, errors.New("EquivocationFromBlame: the messages are the same")
+	}
+	round, _ := messageRound(msgs[1])
+	return &Equivocation{
+		Operator: msgs[1].Signer,
+		Round:    roundName(msgs[1].Message.MsgType, round),
+		First:    msgs[0],
+		Second:   msgs[1],
+		key:      keysByRound[1],
+		root:     roots[1],
+	}, nil
+}
@@ -0,0 +1,147 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNotObserved = errors.New("ceremony not observed")
+	ErrPending     = errors.New("ceremony still running")
+	// ErrNoTranscript is returned for ceremonies without a stored transcript
+	ErrNoTranscript = errors.New("no transcript stored")
+	// ErrNoCommitteeOutputs is returned for ceremonies without stored committee outputs
+	ErrNoCommitteeOutputs = errors.New("no committee outputs stored")
+)
+
+type Store interface {
+	SaveAttestation(a *Attestation) error
+	// GetAttestation returns ErrNotObserved when no attestation was stored for requestID
+	GetAttestation(requestID string) (*Attestation, error)
+}
+
+// Observer follows ceremonies an operator was invited to as a witness. It
+// keeps a transcript per ceremony and signs an attestation once the ceremony
+// completed. Observers never take part in the dkg protocol.
+type Observer struct {
+	self  types.OperatorID
+	sk    *rsa.PrivateKey
+	keys  KeyLookup
+	store Store
+	log   *logrus.Logger
+
+	mu          sync.Mutex
+	transcripts map[string]*Transcript
+}
+
+func New(self types.OperatorID, sk *rsa.PrivateKey, keys KeyLookup, store Store, log *logrus.Logger) *Observer {
+	return &Observer{
+		self:        self,
+		sk:          sk,
+		keys:        keys,
+		store:       store,
+		log:         log,
+		transcripts: make(map[string]*Transcript),
+	}
+}
+
+// Watch starts observing the ceremony opened by the signed start message,
+// watching a ceremony twice is a no-op
+func (o *Observer) Watch(start *dkg.SignedMessage) error {
+	t, err := NewTranscript(start, o.keys)
+	if err != nil {
+		return fmt.Errorf("Watch: %w", err)
+	}
+	for _, operatorID := range append(t.Operators, t.OldOperators...) {
+		if operatorID == o.self {
+			return fmt.Errorf("Watch: operator %d is part of the committee and can't observe it", o.self)
+		}
+	}
+
+	requestID := requestIDHex(t.RequestID)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.transcripts[requestID]; ok {
+		return nil
+	}
+	if _, err := o.store.GetAttestation(requestID); err == nil {
+		return nil
+	}
+	o.transcripts[requestID] = t
+	o.log.Infof("Watch: observing %s %s", t.Kind, requestID)
+	return nil
+}
+
+// Watching reports whether the ceremony is being observed right now
+func (o *Observer) Watching(requestID string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, ok := o.transcripts[requestID]
+	return ok
+}
+
+// Observe adds a broadcast message to the transcript of its ceremony, the
+// attestation is signed and stored with the message completing the ceremony
+func (o *Observer) Observe(msg *dkg.SignedMessage) error {
+	requestID := requestIDHex(msg.Message.Identifier)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	t, ok := o.transcripts[requestID]
+	if !ok {
+		return ErrNotObserved
+	}
+	if err := t.Add(msg); err != nil {
+		return fmt.Errorf("Observe: %w", err)
+	}
+	if !t.Complete() {
+		return nil
+	}
+
+	attestation := Attest(t, o.self)
+	if err := attestation.Sign(o.sk); err != nil {
+		return fmt.Errorf("Observe: failed to sign attestation: %w", err)
+	}
+	if err := o.store.SaveAttestation(attestation); err != nil {
+		return fmt.Errorf("Observe: failed to save attestation: %w", err)
+	}
+	delete(o.transcripts, requestID)
+	o.log.Infof("Observe: attested %s %s valid: %t", t.Kind, requestID, attestation.Valid)
+	return nil
+}
+
+// Attestation returns the signed attestation of a completed ceremony,
+// ErrPending while it is running
+func (o *Observer) Attestation(requestID string) (*Attestation, error) {
+	if o.Watching(requestID) {
+		return nil, ErrPending
+	}
+	return o.store.GetAttestation(requestID)
+}
@@ -0,0 +1,287 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	types.InitBLS()
+}
+
+type memStore struct {
+	attestations map[string]*Attestation
+}
+
+func (s *memStore) SaveAttestation(a *Attestation) error {
+	s.attestations[a.RequestID] = a
+	return nil
+}
+
+func (s *memStore) GetAttestation(requestID string) (*Attestation, error) {
+	a, ok := s.attestations[requestID]
+	if !ok {
+		return nil, ErrNotObserved
+	}
+	return a, nil
+}
+
+var (
+	testRequestID = dkg.RequestID{1, 2, 3}
+	testOperators = []types.OperatorID{1, 2, 3, 4}
+)
+
+func testKeys(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+	return &testingutils.TestingKeygenKeySet().DKGOperators[operatorID].EncryptionKey.PublicKey, nil
+}
+
+func signed(operatorID types.OperatorID, msgType dkg.MsgType, data []byte) *dkg.SignedMessage {
+	sk := testingutils.TestingKeygenKeySet().DKGOperators[operatorID].EncryptionKey
+	return testingutils.SignDKGMsg(sk, operatorID, &dkg.Message{MsgType: msgType, Identifier: testRequestID, Data: data})
+}
+
+func startMsg() *dkg.SignedMessage {
+	data := testingutils.InitMessageDataBytes(testOperators, 3, make([]byte, 32), testingutils.TestingForkVersion)
+	return signed(1, dkg.InitMsgType, data)
+}
+
+func outputMsg(t *testing.T, operatorID types.OperatorID, sharePK string) *dkg.SignedMessage {
+	vk, _ := hex.DecodeString(testingutils.KeygenMsgStore.Round2[operatorID].Vk)
+	sharePubKey, _ := hex.DecodeString(sharePK)
+	output := &dkg.Output{RequestID: testRequestID, SharePubKey: sharePubKey, ValidatorPubKey: vk}
+
+	sk := testingutils.TestingKeygenKeySet().DKGOperators[operatorID].EncryptionKey
+	root, err := types.ComputeSigningRoot(output, types.ComputeSignatureDomain(types.PrimusTestnet, types.DKGSignatureType))
+	require.NoError(t, err)
+	sig, err := types.Sign(sk, root)
+	require.NoError(t, err)
+
+	data, err := (&dkg.SignedOutput{Data: output, Signer: operatorID, Signature: sig}).Encode()
+	require.NoError(t, err)
+	return signed(operatorID, dkg.OutputMsgType, data)
+}
+
+// keygenMessages is the broadcast of the keygen in the spec test vectors
+func keygenMessages(t *testing.T) []*dkg.SignedMessage {
+	store := testingutils.KeygenMsgStore
+	msgs := []*dkg.SignedMessage{}
+	for _, operatorID := range testOperators {
+		msgs = append(msgs, signed(operatorID, dkg.ProtocolMsgType, frost.Testing_Round1MessageBytes(operatorID, store)))
+	}
+	for _, operatorID := range testOperators {
+		msgs = append(msgs, signed(operatorID, dkg.ProtocolMsgType, frost.Testing_Round2MessageBytes(operatorID, store)))
+	}
+	for _, operatorID := range testOperators {
+		msgs = append(msgs, outputMsg(t, operatorID, store.Round2[operatorID].VkShare))
+	}
+	return msgs
+}
+
+func newTestObserver(t *testing.T) (*Observer, *rsa.PrivateKey) {
+	sk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return New(5, sk, testKeys, &memStore{attestations: make(map[string]*Attestation)}, logrus.New()), sk
+}
+
+func TestObserverAttestsKeygen(t *testing.T) {
+	obs, sk := newTestObserver(t)
+	requestID := hex.EncodeToString(testRequestID[:])
+
+	require.NoError(t, obs.Watch(startMsg()))
+	require.True(t, obs.Watching(requestID))
+	_, err := obs.Attestation(requestID)
+	require.ErrorIs(t, err, ErrPending)
+
+	for _, msg := range keygenMessages(t) {
+		require.NoError(t, obs.Observe(msg))
+	}
+	require.False(t, obs.Watching(requestID))
+
+	attestation, err := obs.Attestation(requestID)
+	require.NoError(t, err)
+	require.True(t, attestation.Valid, attestation.Findings)
+	require.Equal(t, testingutils.KeygenMsgStore.Round2[1].Vk, attestation.ValidatorPK)
+	require.Equal(t, 13, attestation.Messages)
+	require.NoError(t, attestation.Verify(&sk.PublicKey))
+
+	vk, _ := hex.DecodeString(attestation.ValidatorPK)
+	require.NoError(t, attestation.Vouches(vk))
+
+	attestation.Valid = false
+	require.Error(t, attestation.Verify(&sk.PublicKey), "edited attestation")
+}
+
+func TestTranscriptRootIsOrderIndependent(t *testing.T) {
+	forward, err := NewTranscript(startMsg(), testKeys)
+	require.NoError(t, err)
+	backward, err := NewTranscript(startMsg(), testKeys)
+	require.NoError(t, err)
+
+	msgs := keygenMessages(t)
+	for i := range msgs {
+		require.NoError(t, forward.Add(msgs[i]))
+		require.NoError(t, backward.Add(msgs[len(msgs)-1-i]))
+	}
+	require.Equal(t, forward.Root(), backward.Root())
+}
+
+func TestTranscriptFindsWrongShareKey(t *testing.T) {
+	transcript, err := NewTranscript(startMsg(), testKeys)
+	require.NoError(t, err)
+
+	for _, msg := range keygenMessages(t)[:11] {
+		require.NoError(t, transcript.Add(msg))
+	}
+	// operator 4 claims the share key of operator 3
+	require.NoError(t, transcript.Add(outputMsg(t, 4, testingutils.KeygenMsgStore.Round2[3].VkShare)))
+	require.True(t, transcript.Complete())
+
+	_, findings := transcript.Verify()
+	require.Equal(t, []string{"share key in the output of operator 4 doesn't match the commitments"}, findings)
+}
+
+func TestTranscriptFindsEquivocation(t *testing.T) {
+	transcript, err := NewTranscript(startMsg(), testKeys)
+	require.NoError(t, err)
+
+	round2 := frost.Testing_Round2MessageBytes(1, testingutils.KeygenMsgStore)
+	require.NoError(t, transcript.Add(signed(1, dkg.ProtocolMsgType, round2)))
+	require.NoError(t, transcript.Add(signed(1, dkg.ProtocolMsgType, round2)), "duplicates are fine")
+	require.Empty(t, transcript.findings)
+
+	other := frost.Testing_Round2MessageBytes(2, testingutils.KeygenMsgStore)
+	require.NoError(t, transcript.Add(signed(1, dkg.ProtocolMsgType, other)))
+	require.Equal(t, []string{"operator 1 sent conflicting round2 messages"}, transcript.findings)
+
+	require.NoError(t, transcript.Add(signed(1, dkg.ProtocolMsgType, other)))
+	require.Len(t, transcript.findings, 1, "the same conflict is recorded once")
+}
+
+func TestTranscriptConflict(t *testing.T) {
+	transcript, err := NewTranscript(startMsg(), testKeys)
+	require.NoError(t, err)
+
+	first := signed(2, dkg.ProtocolMsgType, frost.Testing_Round1MessageBytes(2, testingutils.KeygenMsgStore))
+	e, _ := transcript.Conflict(first)
+	require.Nil(t, e, "nothing to conflict with yet")
+	require.NoError(t, transcript.Add(first))
+	e, _ = transcript.Conflict(first)
+	require.Nil(t, e, "a message delivered again isn't a conflict")
+
+	second := signed(2, dkg.ProtocolMsgType, frost.Testing_Round1MessageBytes(3, testingutils.KeygenMsgStore))
+	forged := signed(3, dkg.ProtocolMsgType, frost.Testing_Round1MessageBytes(3, testingutils.KeygenMsgStore))
+	forged.Signer = 2
+	e, _ = transcript.Conflict(forged)
+	require.Nil(t, e, "a message without the signer's signature proves nothing")
+
+	e, isNew := transcript.Conflict(second)
+	require.NotNil(t, e)
+	require.True(t, isNew)
+	require.Equal(t, types.OperatorID(2), e.Operator)
+	require.Equal(t, "round1", e.Round)
+	require.Equal(t, first, e.First)
+	require.Equal(t, second, e.Second)
+	require.Equal(t, []*Equivocation{e}, transcript.Equivocations())
+
+	again, isNew := transcript.Conflict(second)
+	require.Equal(t, e, again)
+	require.False(t, isNew)
+	require.Len(t, transcript.Equivocations(), 1)
+}
+
+func TestEquivocationBlameIsEvidence(t *testing.T) {
+	transcript, err := NewTranscript(startMsg(), testKeys)
+	require.NoError(t, err)
+	require.NoError(t, transcript.Add(signed(2, dkg.DepositDataMsgType, []byte(`{"a":1}`))))
+	e, _ := transcript.Conflict(signed(2, dkg.DepositDataMsgType, []byte(`{"a":2}`)))
+	require.NotNil(t, e)
+
+	blame, err := e.Blame()
+	require.NoError(t, err)
+	require.Equal(t, frost.InconsistentMessage, blame.Type)
+	require.Equal(t, uint32(2), blame.TargetOperatorID)
+	require.NoError(t, blame.Validate())
+
+	// the blame round-trips through its encoding and checks out with the registry keys only
+	byts, err := blame.Encode()
+	require.NoError(t, err)
+	decoded := &frost.BlameMessage{}
+	require.NoError(t, decoded.Decode(byts))
+	checked, err := EquivocationFromBlame(decoded, testKeys)
+	require.NoError(t, err)
+	require.Equal(t, e.Error(), checked.Error())
+
+	same := *decoded
+	same.BlameData = [][]byte{decoded.BlameData[0], decoded.BlameData[0]}
+	_, err = EquivocationFromBlame(&same, testKeys)
+	require.ErrorContains(t, err, "the same")
+
+	otherRound, err := signed(2, dkg.OutputMsgType, []byte(`{}`)).Encode()
+	require.NoError(t, err)
+	rounds := *decoded
+	rounds.BlameData = [][]byte{decoded.BlameData[0], otherRound}
+	_, err = EquivocationFromBlame(&rounds, testKeys)
+	require.ErrorContains(t, err, "different rounds")
+
+	wrongTarget := *decoded
+	wrongTarget.TargetOperatorID = 3
+	_, err = EquivocationFromBlame(&wrongTarget, testKeys)
+	require.ErrorContains(t, err, "not by the blamed operator")
+}
+
+func TestTranscriptRefusesMessages(t *testing.T) {
+	transcript, err := NewTranscript(startMsg(), testKeys)
+	require.NoError(t, err)
+
+	msg := signed(1, dkg.ProtocolMsgType, frost.Testing_Round1MessageBytes(1, testingutils.KeygenMsgStore))
+	msg.Signer = 2
+	require.ErrorContains(t, transcript.Add(msg), "invalid signature")
+
+	msg = signed(1, dkg.ProtocolMsgType, frost.Testing_Round1MessageBytes(1, testingutils.KeygenMsgStore))
+	msg.Message.Identifier = dkg.RequestID{9}
+	require.Error(t, transcript.Add(msg), "other ceremony")
+
+	sk := testingutils.TestingResharingKeySet().DKGOperators[5].EncryptionKey
+	outsider := testingutils.SignDKGMsg(sk, 5, &dkg.Message{MsgType: dkg.ProtocolMsgType, Identifier: testRequestID, Data: frost.Testing_TimeoutMessageBytes(common.Round1)})
+	require.ErrorContains(t, transcript.Add(outsider), "not part of the ceremony")
+}
+
+func TestObserverRefusesOwnCommittee(t *testing.T) {
+	obs := New(1, nil, testKeys, &memStore{attestations: make(map[string]*Attestation)}, logrus.New())
+	require.Error(t, obs.Watch(startMsg()))
+
+	keySign := signed(1, dkg.KeySignMsgType, []byte("{}"))
+	_, err := NewTranscript(keySign, testKeys)
+	require.Error(t, err)
+}
@@ -0,0 +1,224 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// CommitteeOutputs are the signed outputs of every operator of a ceremony as
+// a node received them on the ceremony topic. Every node of the committee
+// keeps the whole set, so the result of a ceremony doesn't depend on the copy
+// the messenger was streamed.
+type CommitteeOutputs struct {
+	RequestID string `json:"request_id"`
+	// Operators are the operators expected to sign an output, empty when the
+	// node storing the outputs didn't track the ceremony
+	Operators []types.OperatorID                     `json:"operators,omitempty"`
+	Outputs   map[types.OperatorID]*dkg.SignedOutput `json:"outputs"`
+	// Conflicts are further outputs of an operator that differ from the first
+	Conflicts []*dkg.SignedOutput `json:"conflicts,omitempty"`
+	// Canary outputs come from a canary keygen and never back a validator
+	Canary    bool  `json:"canary,omitempty"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func NewCommitteeOutputs(requestID string, operators []types.OperatorID) *CommitteeOutputs {
+	return &CommitteeOutputs{
+		RequestID: requestID,
+		Operators: operators,
+		Outputs:   make(map[types.OperatorID]*dkg.SignedOutput),
+	}
+}
+
+// Add records the output of an operator once its signature checks out
+// against the registry key of the operator. A second output of the same
+// operator is kept as a conflict when it differs from the first.
+func (o *CommitteeOutputs) Add(output *dkg.SignedOutput, keys KeyLookup) error {
+	requestID, err := outputRequestID(output)
+	if err != nil {
+		return err
+	}
+	if requestID != o.RequestID {
+		return fmt.Errorf("output of operator %d is for request %s", output.Signer, requestID)
+	}
+	if err := VerifySignedOutput(output, keys); err != nil {
+		return fmt.Errorf("output of operator %d: %w", output.Signer, err)
+	}
+
+	o.UpdatedAt = time.Now().Unix()
+	if existing, ok := o.Outputs[output.Signer]; ok {
+		if !bytes.Equal(existing.Signature, output.Signature) {
+			o.Conflicts = append(o.Conflicts, output)
+		}
+		return nil
+	}
+	o.Outputs[output.Signer] = output
+	return nil
+}
+
+// Missing are the operators without an output, in ascending order
+func (o *CommitteeOutputs) Missing() []types.OperatorID {
+	var missing []types.OperatorID
+	for _, operatorID := range o.Operators {
+		if _, ok := o.Outputs[operatorID]; !ok {
+			missing = append(missing, operatorID)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	return missing
+}
+
+// Verify checks every output against the operator keys and against each
+// other. An empty list of findings means the committee agrees on the result.
+func (o *CommitteeOutputs) Verify(keys KeyLookup) []string {
+	var findings []string
+	signers := make([]types.OperatorID, 0, len(o.Outputs))
+	for operatorID := range o.Outputs {
+		signers = append(signers, operatorID)
+	}
+	sort.Slice(signers, func(i, j int) bool { return signers[i] < signers[j] })
+
+	var reference *dkg.SignedOutput
+	for _, operatorID := range signers {
+		output := o.Outputs[operatorID]
+		if output.Signer != operatorID {
+			findings = append(findings, fmt.Sprintf("output of operator %d is signed by operator %d", operatorID, output.Signer))
+			continue
+		}
+		if requestID, err := outputRequestID(output); err != nil || requestID != o.RequestID {
+			findings = append(findings, fmt.Sprintf("output of operator %d is for another request", operatorID))
+			continue
+		}
+		if err := VerifySignedOutput(output, keys); err != nil {
+			findings = append(findings, fmt.Sprintf("output of operator %d: %v", operatorID, err))
+			continue
+		}
+		if output.BlameData != nil {
+			findings = append(findings, fmt.Sprintf("operator %d output a blame", operatorID))
+			continue
+		}
+		if reference == nil {
+			reference = output
+		} else if err := sameResult(reference, output); err != nil {
+			findings = append(findings, fmt.Sprintf("output of operator %d disagrees with operator %d: %v", operatorID, reference.Signer, err))
+		}
+	}
+	for _, conflict := range o.Conflicts {
+		findings = append(findings, fmt.Sprintf("operator %d signed two different outputs", conflict.Signer))
+	}
+	for _, operatorID := range o.Missing() {
+		findings = append(findings, fmt.Sprintf("no output of operator %d", operatorID))
+	}
+	return findings
+}
+
+// OutputsReport are the committee outputs of a ceremony with the findings of
+// their verification
+type OutputsReport struct {
+	*CommitteeOutputs
+	Missing  []types.OperatorID `json:"missing,omitempty"`
+	Findings []string           `json:"findings,omitempty"`
+	// Consistent is set when every expected output is there and they agree
+	Consistent bool `json:"consistent"`
+}
+
+func (o *CommitteeOutputs) Report(keys KeyLookup) *OutputsReport {
+	findings := o.Verify(keys)
+	return &OutputsReport{
+		CommitteeOutputs: o,
+		Missing:          o.Missing(),
+		Findings:         findings,
+		Consistent:       len(findings) == 0 && len(o.Outputs) > 0,
+	}
+}
+
+// sameResult compares the public parts of two outputs, the encrypted share
+// and share key differ per operator
+func sameResult(a, b *dkg.SignedOutput) error {
+	switch {
+	case a.Data != nil && b.Data != nil:
+		if !bytes.Equal(a.Data.ValidatorPubKey, b.Data.ValidatorPubKey) {
+			return errors.New("different validator key")
+		}
+		if !bytes.Equal(a.Data.DepositDataSignature, b.Data.DepositDataSignature) {
+			return errors.New("different deposit data signature")
+		}
+	case a.KeySignData != nil && b.KeySignData != nil:
+		if !bytes.Equal(a.KeySignData.ValidatorPK, b.KeySignData.ValidatorPK) {
+			return errors.New("different validator key")
+		}
+		if !bytes.Equal(a.KeySignData.Signature, b.KeySignData.Signature) {
+			return errors.New("different signature")
+		}
+	default:
+		return errors.New("different kind of output")
+	}
+	return nil
+}
+
+func outputRequestID(output *dkg.SignedOutput) (string, error) {
+	switch {
+	case output.Data != nil:
+		return requestIDHex(output.Data.RequestID), nil
+	case output.KeySignData != nil:
+		return requestIDHex(output.KeySignData.RequestID), nil
+	case output.BlameData != nil:
+		return requestIDHex(output.BlameData.RequestID), nil
+	}
+	return "", fmt.Errorf("output of operator %d is empty", output.Signer)
+}
+
+// VerifySignedOutput checks the signature of an output with the registry key
+// of its signer
+func VerifySignedOutput(output *dkg.SignedOutput, keys KeyLookup) error {
+	pk, err := keys(output.Signer)
+	if err != nil {
+		return fmt.Errorf("failed to get key of operator %d: %w", output.Signer, err)
+	}
+	var data types.Root
+	switch {
+	case output.Data != nil:
+		data = output.Data
+	case output.KeySignData != nil:
+		data = output.KeySignData
+	case output.BlameData != nil:
+		data = output.BlameData
+	default:
+		return errors.New("empty output")
+	}
+	root, err := types.ComputeSigningRoot(data, types.ComputeSignatureDomain(types.PrimusTestnet, types.DKGSignatureType))
+	if err != nil {
+		return err
+	}
+	if !types.Verify(pk, root, output.Signature) {
+		return errors.New("invalid output signature")
+	}
+	return nil
+}
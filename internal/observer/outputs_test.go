@@ -0,0 +1,93 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/stretchr/testify/require"
+)
+
+func testOutput(t *testing.T, operatorID types.OperatorID, vk []byte) *dkg.SignedOutput {
+	output := &dkg.Output{RequestID: testRequestID, SharePubKey: []byte{byte(operatorID)}, ValidatorPubKey: vk}
+	sk := testingutils.TestingKeygenKeySet().DKGOperators[operatorID].EncryptionKey
+	root, err := types.ComputeSigningRoot(output, types.ComputeSignatureDomain(types.PrimusTestnet, types.DKGSignatureType))
+	require.NoError(t, err)
+	sig, err := types.Sign(sk, root)
+	require.NoError(t, err)
+	return &dkg.SignedOutput{Data: output, Signer: operatorID, Signature: sig}
+}
+
+func TestCommitteeOutputsConsistent(t *testing.T) {
+	outputs := NewCommitteeOutputs(requestIDHex(testRequestID), testOperators)
+	for _, msg := range keygenMessages(t) {
+		if msg.Message.MsgType != dkg.OutputMsgType {
+			continue
+		}
+		output := &dkg.SignedOutput{}
+		require.NoError(t, output.Decode(msg.Message.Data))
+		require.NoError(t, outputs.Add(output, testKeys))
+		// the same output arriving again is no conflict
+		require.NoError(t, outputs.Add(output, testKeys))
+	}
+
+	report := outputs.Report(testKeys)
+	require.Empty(t, report.Findings)
+	require.Empty(t, report.Missing)
+	require.True(t, report.Consistent)
+}
+
+func TestCommitteeOutputsFindings(t *testing.T) {
+	vk, _ := hex.DecodeString(testingutils.KeygenMsgStore.Round2[1].Vk)
+	outputs := NewCommitteeOutputs(requestIDHex(testRequestID), testOperators)
+	require.NoError(t, outputs.Add(testOutput(t, 1, vk), testKeys))
+	require.NoError(t, outputs.Add(testOutput(t, 2, vk), testKeys))
+	require.NoError(t, outputs.Add(testOutput(t, 3, []byte("other key")), testKeys))
+	// operator 2 signing a second, different output
+	require.NoError(t, outputs.Add(testOutput(t, 2, []byte("other key")), testKeys))
+
+	report := outputs.Report(testKeys)
+	require.False(t, report.Consistent)
+	require.Equal(t, []types.OperatorID{4}, report.Missing)
+	require.Equal(t, []string{
+		"output of operator 3 disagrees with operator 1: different validator key",
+		"operator 2 signed two different outputs",
+		"no output of operator 4",
+	}, report.Findings)
+}
+
+func TestCommitteeOutputsRefuseForgedOutputs(t *testing.T) {
+	outputs := NewCommitteeOutputs(requestIDHex(testRequestID), testOperators)
+
+	forged := testOutput(t, 1, []byte("key"))
+	forged.Signer = 2
+	require.Error(t, outputs.Add(forged, testKeys))
+
+	other := testOutput(t, 1, []byte("key"))
+	other.Data.RequestID = dkg.RequestID{9}
+	require.Error(t, outputs.Add(other, testKeys))
+	require.Empty(t, outputs.Outputs)
+}
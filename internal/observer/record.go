@@ -0,0 +1,179 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// TranscriptVersion is the version of the stored transcript format
+const TranscriptVersion = 1
+
+// TranscriptRecord is a transcript as it is stored and handed to auditors:
+// every broadcast message of the ceremony with the operator keys that signed
+// them, enough to verify the ceremony again without the registry or any node.
+type TranscriptRecord struct {
+	Version      int                `json:"version"`
+	RequestID    string             `json:"request_id"`
+	Kind         ceremony.Kind      `json:"kind"`
+	Operators    []types.OperatorID `json:"operators"`
+	OldOperators []types.OperatorID `json:"old_operators,omitempty"`
+	Threshold    uint64             `json:"threshold"`
+	// OperatorKeys are the encryption keys of the participants at the time of
+	// the ceremony, base64 PEM like in the operator registry
+	OperatorKeys map[types.OperatorID]string `json:"operator_keys"`
+	// Messages are the hex encoded signed dkg messages ordered by message
+	// type, round and signer, conflicting messages of a signer come last
+	Messages []string `json:"messages"`
+	// Root is the transcript root the messages hash to
+	Root      string `json:"root"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Record returns the transcript for storage, the keys of every participant
+// are looked up once more to go with it
+func (t *Transcript) Record() (*TranscriptRecord, error) {
+	record := &TranscriptRecord{
+		Version:      TranscriptVersion,
+		RequestID:    requestIDHex(t.RequestID),
+		Kind:         t.Kind,
+		Operators:    t.Operators,
+		OldOperators: t.OldOperators,
+		Threshold:    t.Threshold,
+		OperatorKeys: make(map[types.OperatorID]string),
+		Messages:     []string{},
+		Root:         hex.EncodeToString(t.Root()),
+		CreatedAt:    time.Now().UTC().Unix(),
+	}
+	for _, operatorID := range append(append([]types.OperatorID{}, t.Operators...), t.OldOperators...) {
+		pk, err := t.keys(operatorID)
+		if err != nil {
+			return nil, fmt.Errorf("Record: failed to get key of operator %d: %w", operatorID, err)
+		}
+		encoded, err := encryption.EncodeRSAPublicKey(pk)
+		if err != nil {
+			return nil, fmt.Errorf("Record: failed to encode key of operator %d: %w", operatorID, err)
+		}
+		record.OperatorKeys[operatorID] = encoded
+	}
+
+	keys := make([]string, 0, len(t.messages))
+	for key := range t.messages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	msgs := t.ordered(keys)
+	for _, e := range t.equivocations {
+		msgs = append(msgs, e.Second)
+	}
+	for _, msg := range msgs {
+		byts, err := msg.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("Record: failed to encode message: %w", err)
+		}
+		record.Messages = append(record.Messages, hex.EncodeToString(byts))
+	}
+	return record, nil
+}
+
+func (t *Transcript) ordered(keys []string) []*dkg.SignedMessage {
+	msgs := make([]*dkg.SignedMessage, 0, len(keys))
+	for _, key := range keys {
+		msgs = append(msgs, t.messages[key])
+	}
+	return msgs
+}
+
+// LoadTranscript rebuilds the transcript of a record, checking every message
+// signature against the keys of the record. The transcript can then be
+// verified like one an observer collected.
+func LoadTranscript(record *TranscriptRecord) (*Transcript, error) {
+	if record.Version != TranscriptVersion {
+		return nil, fmt.Errorf("LoadTranscript: unsupported transcript version %d", record.Version)
+	}
+	keys := make(map[types.OperatorID]*rsa.PublicKey)
+	for operatorID, encoded := range record.OperatorKeys {
+		pk, err := encryption.DecodeRSAPublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("LoadTranscript: invalid key of operator %d: %w", operatorID, err)
+		}
+		keys[operatorID] = pk
+	}
+	lookup := func(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+		pk, ok := keys[operatorID]
+		if !ok {
+			return nil, fmt.Errorf("no key of operator %d in the transcript", operatorID)
+		}
+		return pk, nil
+	}
+
+	msgs := make([]*dkg.SignedMessage, 0, len(record.Messages))
+	var start *dkg.SignedMessage
+	for i, encoded := range record.Messages {
+		byts, err := hex.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("LoadTranscript: message %d: %w", i+1, err)
+		}
+		msg := &dkg.SignedMessage{}
+		if err := msg.Decode(byts); err != nil {
+			return nil, fmt.Errorf("LoadTranscript: message %d: %w", i+1, err)
+		}
+		if msg.Message == nil {
+			return nil, fmt.Errorf("LoadTranscript: message %d is empty", i+1)
+		}
+		if start == nil && (msg.Message.MsgType == dkg.InitMsgType || msg.Message.MsgType == dkg.ReshareMsgType) {
+			start = msg
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if start == nil {
+		return nil, errors.New("LoadTranscript: transcript has no start message")
+	}
+
+	t, err := NewTranscript(start, lookup)
+	if err != nil {
+		return nil, fmt.Errorf("LoadTranscript: %w", err)
+	}
+	if requestIDHex(t.RequestID) != record.RequestID {
+		return nil, fmt.Errorf("LoadTranscript: start message is of request %s", requestIDHex(t.RequestID))
+	}
+	for i, msg := range msgs {
+		if err := t.Add(msg); err != nil {
+			return nil, fmt.Errorf("LoadTranscript: message of operator %d (%d of %d): %w", msg.Signer, i+1, len(msgs), err)
+		}
+	}
+	if root := hex.EncodeToString(t.Root()); root != record.Root {
+		return nil, fmt.Errorf("LoadTranscript: messages hash to root %s instead of %s", root, record.Root)
+	}
+	return t, nil
+}
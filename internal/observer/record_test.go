@@ -0,0 +1,117 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/bloxapp/ssv-spec/types/testingutils"
+	"github.com/stretchr/testify/require"
+)
+
+func completedTranscript(t *testing.T) *Transcript {
+	transcript, err := NewTranscript(startMsg(), testKeys)
+	require.NoError(t, err)
+	for _, msg := range keygenMessages(t) {
+		require.NoError(t, transcript.Add(msg))
+	}
+	require.True(t, transcript.Complete())
+	return transcript
+}
+
+func TestTranscriptRecordRoundTrip(t *testing.T) {
+	transcript := completedTranscript(t)
+	record, err := transcript.Record()
+	require.NoError(t, err)
+	require.Len(t, record.OperatorKeys, len(testOperators))
+
+	byts, err := json.Marshal(record)
+	require.NoError(t, err)
+	decoded := &TranscriptRecord{}
+	require.NoError(t, json.Unmarshal(byts, decoded))
+
+	loaded, err := LoadTranscript(decoded)
+	require.NoError(t, err)
+	require.Equal(t, transcript.Root(), loaded.Root())
+	validatorPK, findings := loaded.Verify()
+	require.Empty(t, findings)
+	require.Equal(t, testingutils.KeygenMsgStore.Round2[1].Vk, hex.EncodeToString(validatorPK))
+}
+
+func TestTranscriptRecordKeepsConflicts(t *testing.T) {
+	transcript := completedTranscript(t)
+	other := frost.Testing_Round2MessageBytes(2, testingutils.KeygenMsgStore)
+	require.NoError(t, transcript.Add(signed(1, dkg.ProtocolMsgType, other)))
+
+	record, err := transcript.Record()
+	require.NoError(t, err)
+	loaded, err := LoadTranscript(record)
+	require.NoError(t, err)
+	_, findings := loaded.Verify()
+	require.Contains(t, findings, "operator 1 sent conflicting round2 messages")
+}
+
+func TestLoadTranscriptRefusesTampering(t *testing.T) {
+	record, err := completedTranscript(t).Record()
+	require.NoError(t, err)
+
+	dropped := *record
+	dropped.Messages = record.Messages[:len(record.Messages)-1]
+	_, err = LoadTranscript(&dropped)
+	require.ErrorContains(t, err, "instead of")
+
+	rekeyed := *record
+	rekeyed.OperatorKeys = map[types.OperatorID]string{}
+	for operatorID, key := range record.OperatorKeys {
+		rekeyed.OperatorKeys[operatorID] = key
+	}
+	rekeyed.OperatorKeys[2] = record.OperatorKeys[3]
+	_, err = LoadTranscript(&rekeyed)
+	require.ErrorContains(t, err, "invalid signature")
+}
+
+func TestTranscriptFindsInvalidProof(t *testing.T) {
+	transcript, err := NewTranscript(startMsg(), testKeys)
+	require.NoError(t, err)
+
+	for _, msg := range keygenMessages(t) {
+		protocolMsg := &frost.ProtocolMsg{}
+		if msg.Signer == 2 && protocolMsg.Decode(msg.Message.Data) == nil && protocolMsg.Round1Message != nil {
+			// the proof of operator 1 doesn't prove the commitment of operator 2
+			proof := &frost.ProtocolMsg{}
+			require.NoError(t, proof.Decode(frost.Testing_Round1MessageBytes(1, testingutils.KeygenMsgStore)))
+			protocolMsg.Round1Message.ProofS = proof.Round1Message.ProofS
+			data, err := protocolMsg.Encode()
+			require.NoError(t, err)
+			msg = signed(2, dkg.ProtocolMsgType, data)
+		}
+		require.NoError(t, transcript.Add(msg))
+	}
+
+	_, findings := transcript.Verify()
+	require.Equal(t, []string{"round 1 proof of operator 2: proof of knowledge doesn't verify"}, findings)
+}
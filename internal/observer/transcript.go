@@ -0,0 +1,515 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package observer
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/dkg/common"
+	"github.com/bloxapp/ssv-spec/dkg/frost"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/coinbase/kryptology/pkg/core/curves"
+	"github.com/herumi/bls-eth-go-binary/bls"
+)
+
+// KeyLookup returns the registry encryption key of an operator
+type KeyLookup func(operatorID types.OperatorID) (*rsa.PublicKey, error)
+
+// Transcript collects the broadcast messages of one keygen or resharing as an
+// observer receives them and checks them against each other once the ceremony
+// completed. The observer holds no share, so only public data is checked: the
+// round 1 commitments and proofs, the round 2 verification keys and the signed
+// outputs.
+type Transcript struct {
+	RequestID    dkg.RequestID
+	Kind         ceremony.Kind
+	Operators    []types.OperatorID
+	OldOperators []types.OperatorID
+	Threshold    uint64
+	// ValidatorPK is the key a resharing must keep, empty for a keygen
+	ValidatorPK types.ValidatorPK
+
+	keys          KeyLookup
+	roots         map[string][]byte
+	messages      map[string]*dkg.SignedMessage
+	equivocations []*Equivocation
+	round1        map[types.OperatorID]*frost.Round1Message
+	round2        map[types.OperatorID]*frost.Round2Message
+	outputs       map[types.OperatorID]*dkg.SignedOutput
+	aborted       bool
+	findings      []string
+}
+
+// NewTranscript starts the transcript of the ceremony opened by start, which
+// must be a signed init or reshare message
+func NewTranscript(start *dkg.SignedMessage, keys KeyLookup) (*Transcript, error) {
+	if start == nil || start.Message == nil {
+		return nil, errors.New("NewTranscript: empty start message")
+	}
+	t := &Transcript{
+		RequestID: start.Message.Identifier,
+		keys:      keys,
+		roots:     make(map[string][]byte),
+		messages:  make(map[string]*dkg.SignedMessage),
+		round1:    make(map[types.OperatorID]*frost.Round1Message),
+		round2:    make(map[types.OperatorID]*frost.Round2Message),
+		outputs:   make(map[types.OperatorID]*dkg.SignedOutput),
+	}
+
+	switch start.Message.MsgType {
+	case dkg.InitMsgType:
+		init := &dkg.Init{}
+		if err := init.Decode(start.Message.Data); err != nil {
+			return nil, fmt.Errorf("NewTranscript: failed to decode init message: %w", err)
+		}
+		t.Kind = ceremony.KindKeygen
+		t.Operators = init.OperatorIDs
+		t.Threshold = uint64(init.Threshold)
+	case dkg.ReshareMsgType:
+		reshare := &dkg.Reshare{}
+		if err := reshare.Decode(start.Message.Data); err != nil {
+			return nil, fmt.Errorf("NewTranscript: failed to decode reshare message: %w", err)
+		}
+		t.Kind = ceremony.KindReshare
+		t.Operators = reshare.OperatorIDs
+		t.OldOperators = reshare.OldOperatorIDs
+		t.Threshold = uint64(reshare.Threshold)
+		t.ValidatorPK = reshare.ValidatorPK
+	default:
+		return nil, errors.New("NewTranscript: only keygen and resharing ceremonies can be observed")
+	}
+
+	if err := t.Add(start); err != nil {
+		return nil, fmt.Errorf("NewTranscript: %w", err)
+	}
+	return t, nil
+}
+
+// Add records a message broadcast for the ceremony. Messages with an invalid
+// signature or from operators outside the committee are refused, a second
+// different message from the same signer for the same round is recorded as
+// equivocation.
+func (t *Transcript) Add(msg *dkg.SignedMessage) error {
+	if msg.Message == nil || msg.Message.Identifier != t.RequestID {
+		return errors.New("message is not part of this ceremony")
+	}
+	if !t.isParticipant(msg.Signer) {
+		return fmt.Errorf("operator %d is not part of the ceremony", msg.Signer)
+	}
+	if err := t.verifyMessage(msg); err != nil {
+		return err
+	}
+
+	round, err := t.record(msg)
+	if err != nil {
+		return err
+	}
+	root, err := msg.GetRoot()
+	if err != nil {
+		return err
+	}
+	key := messageKey(msg, round)
+	if prev, ok := t.roots[key]; ok {
+		if !bytes.Equal(prev, root) && t.equivocation(key, root) == nil {
+			e := &Equivocation{
+				Operator: msg.Signer,
+				Round:    roundName(msg.Message.MsgType, round),
+				First:    t.messages[key],
+				Second:   msg,
+				key:      key,
+				root:     root,
+			}
+			t.findings = append(t.findings, e.Error())
+			t.equivocations = append(t.equivocations, e)
+		}
+		return nil
+	}
+	t.roots[key] = root
+	t.messages[key] = msg
+	return nil
+}
+
+// Conflict checks msg against the message its signer sent for the same round
+// before. A different one is recorded and returned as equivocation, isNew is
+// false when the same conflicting message was recorded already.
+func (t *Transcript) Conflict(msg *dkg.SignedMessage) (e *Equivocation, isNew bool) {
+	if msg.Message == nil || msg.Message.Identifier != t.RequestID {
+		return nil, false
+	}
+	round, err := messageRound(msg)
+	if err != nil {
+		return nil, false
+	}
+	key := messageKey(msg, round)
+	prev, ok := t.roots[key]
+	if !ok {
+		return nil, false
+	}
+	root, err := msg.GetRoot()
+	if err != nil || bytes.Equal(prev, root) {
+		return nil, false
+	}
+	if e := t.equivocation(key, root); e != nil {
+		return e, false
+	}
+	// Add checks the signature, a forged message proves nothing
+	if err := t.Add(msg); err != nil {
+		return nil, false
+	}
+	if e := t.equivocation(key, root); e != nil {
+		return e, true
+	}
+	return nil, false
+}
+
+// Equivocations are the conflicting messages recorded, in the order they came in
+func (t *Transcript) Equivocations() []*Equivocation {
+	return t.equivocations
+}
+
+func (t *Transcript) equivocation(key string, root []byte) *Equivocation {
+	for _, e := range t.equivocations {
+		if e.key == key && bytes.Equal(e.root, root) {
+			return e
+		}
+	}
+	return nil
+}
+
+// messageKey identifies the round of a signer, sorting the keys orders the
+// transcript by message type, round and signer
+func messageKey(msg *dkg.SignedMessage, round common.ProtocolRound) string {
+	return fmt.Sprintf("%d/%d/%010d", msg.Message.MsgType, round, msg.Signer)
+}
+
+// messageRound is the protocol round of msg, Uninitialized for messages
+// outside of the frost protocol
+func messageRound(msg *dkg.SignedMessage) (common.ProtocolRound, error) {
+	if msg.Message.MsgType != dkg.ProtocolMsgType {
+		return common.Uninitialized, nil
+	}
+	protocolMsg := &frost.ProtocolMsg{}
+	if err := protocolMsg.Decode(msg.Message.Data); err != nil {
+		return 0, fmt.Errorf("failed to decode protocol message: %w", err)
+	}
+	return protocolMsg.Round, nil
+}
+
+// record keeps the payload of msg and returns its protocol round, Uninitialized
+// for messages outside of the frost protocol
+func (t *Transcript) record(msg *dkg.SignedMessage) (common.ProtocolRound, error) {
+	switch msg.Message.MsgType {
+	case dkg.InitMsgType, dkg.ReshareMsgType, dkg.DepositDataMsgType:
+		return common.Uninitialized, nil
+	case dkg.ProtocolMsgType:
+		protocolMsg := &frost.ProtocolMsg{}
+		if err := protocolMsg.Decode(msg.Message.Data); err != nil {
+			return 0, fmt.Errorf("failed to decode protocol message: %w", err)
+		}
+		switch protocolMsg.Round {
+		case common.Round1:
+			if protocolMsg.Round1Message == nil {
+				return 0, errors.New("round 1 message without payload")
+			}
+			if _, ok := t.round1[msg.Signer]; !ok {
+				t.round1[msg.Signer] = protocolMsg.Round1Message
+			}
+		case common.Round2:
+			if protocolMsg.Round2Message == nil {
+				return 0, errors.New("round 2 message without payload")
+			}
+			if _, ok := t.round2[msg.Signer]; !ok {
+				t.round2[msg.Signer] = protocolMsg.Round2Message
+			}
+		case common.Blame:
+			t.aborted = true
+			t.findings = append(t.findings, fmt.Sprintf("operator %d broadcast a blame message", msg.Signer))
+		case common.Timeout:
+			t.aborted = true
+			t.findings = append(t.findings, fmt.Sprintf("operator %d timed out", msg.Signer))
+		}
+		return protocolMsg.Round, nil
+	case dkg.OutputMsgType:
+		output := &dkg.SignedOutput{}
+		if err := output.Decode(msg.Message.Data); err != nil {
+			return 0, fmt.Errorf("failed to decode output: %w", err)
+		}
+		if _, ok := t.outputs[msg.Signer]; !ok {
+			t.outputs[msg.Signer] = output
+		}
+		return common.Uninitialized, nil
+	}
+	return 0, fmt.Errorf("unexpected message type %d", msg.Message.MsgType)
+}
+
+func roundName(msgType dkg.MsgType, round common.ProtocolRound) string {
+	if msgType == dkg.ProtocolMsgType {
+		return strings.ToLower(round.String())
+	}
+	switch msgType {
+	case dkg.InitMsgType:
+		return "init"
+	case dkg.ReshareMsgType:
+		return "reshare"
+	case dkg.DepositDataMsgType:
+		return "deposit_data"
+	}
+	return "output"
+}
+
+// Complete reports whether every new operator delivered its output, or the
+// ceremony was aborted by a blame or a timeout
+func (t *Transcript) Complete() bool {
+	if t.aborted {
+		return true
+	}
+	for _, operatorID := range t.Operators {
+		if _, ok := t.outputs[operatorID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Root is the hash of every recorded message root, ordered by round and signer
+func (t *Transcript) Root() []byte {
+	keys := make([]string, 0, len(t.roots))
+	for key := range t.roots {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write(t.roots[key])
+	}
+	return h.Sum(nil)
+}
+
+// Messages is the number of distinct messages in the transcript
+func (t *Transcript) Messages() int {
+	return len(t.roots)
+}
+
+// Verify checks the public data of the transcript and returns the validator
+// key the committee agreed on together with everything found wrong. An empty
+// list of findings means the outputs are consistent with the commitments.
+func (t *Transcript) Verify() (types.ValidatorPK, []string) {
+	findings := append([]string{}, t.findings...)
+	if t.aborted {
+		return nil, findings
+	}
+
+	// round 1 is run by the old committee in a resharing
+	dealers := t.Operators
+	if t.Kind == ceremony.KindReshare {
+		dealers = t.OldOperators
+	}
+
+	polys := make(map[types.OperatorID][]bls.G1)
+	vk := &bls.G1{}
+	for _, operatorID := range dealers {
+		msg, ok := t.round1[operatorID]
+		if !ok {
+			findings = append(findings, fmt.Sprintf("missing round 1 message of operator %d", operatorID))
+			continue
+		}
+		poly, err := commitments(msg.Commitment)
+		if err != nil {
+			findings = append(findings, fmt.Sprintf("invalid round 1 commitments of operator %d: %v", operatorID, err))
+			continue
+		}
+		if uint64(len(poly)) != t.Threshold {
+			findings = append(findings, fmt.Sprintf("operator %d committed to %d coefficients, expected %d", operatorID, len(poly), t.Threshold))
+			continue
+		}
+		if err := verifyProof(operatorID, msg); err != nil {
+			findings = append(findings, fmt.Sprintf("round 1 proof of operator %d: %v", operatorID, err))
+			continue
+		}
+		polys[operatorID] = poly
+		bls.G1Add(vk, vk, &poly[0])
+	}
+	if len(polys) != len(dealers) {
+		return nil, findings
+	}
+
+	validatorPK := types.ValidatorPK(bls.CastToPublicKey(vk).Serialize())
+	if t.Kind == ceremony.KindReshare && !bytes.Equal(validatorPK, t.ValidatorPK) {
+		findings = append(findings, fmt.Sprintf("commitments of the old committee add up to %x instead of the resharing validator key", []byte(validatorPK)))
+	}
+
+	for _, operatorID := range t.Operators {
+		vkShare, err := shareKey(polys, operatorID)
+		if err != nil {
+			findings = append(findings, fmt.Sprintf("failed to evaluate commitments for operator %d: %v", operatorID, err))
+			continue
+		}
+
+		if msg, ok := t.round2[operatorID]; !ok {
+			findings = append(findings, fmt.Sprintf("missing round 2 message of operator %d", operatorID))
+		} else {
+			if !bytes.Equal(msg.Vk, validatorPK) {
+				findings = append(findings, fmt.Sprintf("operator %d announced validator key %x", operatorID, msg.Vk))
+			}
+			if !bytes.Equal(msg.VkShare, vkShare) {
+				findings = append(findings, fmt.Sprintf("share key announced by operator %d doesn't match the commitments", operatorID))
+			}
+		}
+
+		output, ok := t.outputs[operatorID]
+		if !ok || output.Data == nil {
+			findings = append(findings, fmt.Sprintf("missing output of operator %d", operatorID))
+			continue
+		}
+		if err := t.verifyOutput(output); err != nil {
+			findings = append(findings, fmt.Sprintf("output of operator %d: %v", operatorID, err))
+		}
+		if !bytes.Equal(output.Data.ValidatorPubKey, validatorPK) {
+			findings = append(findings, fmt.Sprintf("output of operator %d has validator key %x", operatorID, []byte(output.Data.ValidatorPubKey)))
+		}
+		if !bytes.Equal(output.Data.SharePubKey, vkShare) {
+			findings = append(findings, fmt.Sprintf("share key in the output of operator %d doesn't match the commitments", operatorID))
+		}
+	}
+	return validatorPK, findings
+}
+
+func (t *Transcript) isParticipant(operatorID types.OperatorID) bool {
+	for _, id := range t.Operators {
+		if id == operatorID {
+			return true
+		}
+	}
+	for _, id := range t.OldOperators {
+		if id == operatorID {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Transcript) verifyMessage(msg *dkg.SignedMessage) error {
+	return VerifySignedMessage(msg, t.keys)
+}
+
+// VerifySignedMessage checks the signature of a dkg message against the
+// registry key of its signer
+func VerifySignedMessage(msg *dkg.SignedMessage, keys KeyLookup) error {
+	pk, err := keys(msg.Signer)
+	if err != nil {
+		return fmt.Errorf("failed to get key of operator %d: %w", msg.Signer, err)
+	}
+	root, err := types.ComputeSigningRoot(&dkg.SignedMessage{
+		Message: msg.Message,
+		Signer:  msg.Signer,
+	}, types.ComputeSignatureDomain(types.PrimusTestnet, types.DKGSignatureType))
+	if err != nil {
+		return err
+	}
+	if !types.Verify(pk, root, msg.Signature) {
+		return fmt.Errorf("invalid signature of operator %d", msg.Signer)
+	}
+	return nil
+}
+
+func (t *Transcript) verifyOutput(output *dkg.SignedOutput) error {
+	return VerifySignedOutput(output, t.keys)
+}
+
+func commitments(raw [][]byte) ([]bls.G1, error) {
+	poly := make([]bls.G1, 0, len(raw))
+	for _, byts := range raw {
+		pk := &bls.PublicKey{}
+		if err := pk.Deserialize(byts); err != nil {
+			return nil, err
+		}
+		poly = append(poly, *bls.CastFromPublicKey(pk))
+	}
+	if len(poly) == 0 {
+		return nil, errors.New("no commitments")
+	}
+	return poly, nil
+}
+
+// verifyProof checks the Schnorr proof of knowledge of the secret a dealer
+// committed to in round 1, c = H(id, ctx, A0, g^s * A0^-c). The frost
+// instances hand kryptology a random context that isn't a number, which makes
+// it use a context of 0.
+func verifyProof(operatorID types.OperatorID, msg *frost.Round1Message) error {
+	curve := curves.BLS12381G1()
+	a0, err := curve.Point.FromAffineCompressed(msg.Commitment[0])
+	if err != nil {
+		return fmt.Errorf("invalid commitment: %w", err)
+	}
+	s, err := curve.Scalar.SetBytes(msg.ProofS)
+	if err != nil {
+		return fmt.Errorf("invalid proof s: %w", err)
+	}
+	c, err := curve.Scalar.SetBytes(msg.ProofR)
+	if err != nil {
+		return fmt.Errorf("invalid proof r: %w", err)
+	}
+	if c.IsZero() {
+		return errors.New("zero challenge")
+	}
+
+	r := curve.ScalarBaseMult(s).Add(a0.Mul(c.Neg()))
+	challenge := []byte{byte(operatorID), 0}
+	challenge = append(challenge, a0.ToAffineCompressed()...)
+	challenge = append(challenge, r.ToAffineCompressed()...)
+	if curve.Scalar.Hash(challenge).Cmp(c) != 0 {
+		return errors.New("proof of knowledge doesn't verify")
+	}
+	return nil
+}
+
+// shareKey is the public key of the share of operatorID, the sum of every
+// committed polynomial evaluated at the operator ID
+func shareKey(polys map[types.OperatorID][]bls.G1, operatorID types.OperatorID) ([]byte, error) {
+	x := &bls.Fr{}
+	x.SetInt64(int64(operatorID))
+
+	sum := &bls.G1{}
+	for _, poly := range polys {
+		y := &bls.G1{}
+		if err := bls.G1EvaluatePolynomial(y, poly, x); err != nil {
+			return nil, err
+		}
+		bls.G1Add(sum, sum, y)
+	}
+	return bls.CastToPublicKey(sum).Serialize(), nil
+}
+
+// requestIDHex is the request ID as used in topics and ceremony logs
+func requestIDHex(requestID dkg.RequestID) string {
+	return hex.EncodeToString(requestID[:])
+}
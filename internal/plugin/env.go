@@ -0,0 +1,119 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var pluginName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// FromEnv reads the plugins listed in NODE_PLUGINS (comma separated names),
+// each configured by NODE_PLUGIN_<NAME>_* variables:
+//
+//	_EXEC       command line of an exec plugin
+//	_GRPC       grpc:// or grpcs:// address of a grpc plugin
+//	_GRPC_CA    ca certificate of a grpcs plugin
+//	_HOOKS      hooks the plugin runs at, default pre-init
+//	_TIMEOUT    timeout of a call, default 10s
+//	_FAIL_OPEN  let ceremonies start when the pre-init plugin fails
+//	_ENV        node variables passed to an exec plugin
+//	_USER       user an exec plugin runs as
+func FromEnv() ([]*Registration, error) {
+	registrations := make([]*Registration, 0)
+	for _, name := range strings.Split(os.Getenv("NODE_PLUGINS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !pluginName.MatchString(name) {
+			return nil, fmt.Errorf("invalid plugin name %s", name)
+		}
+		r, err := registrationFromEnv(name)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", name, err)
+		}
+		registrations = append(registrations, r)
+	}
+	return registrations, nil
+}
+
+func registrationFromEnv(name string) (*Registration, error) {
+	env := func(key string) string {
+		return strings.TrimSpace(os.Getenv("NODE_PLUGIN_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_" + key))
+	}
+
+	r := &Registration{Hooks: []Hook{HookPreInit}, Timeout: DefaultTimeout}
+	command, address := strings.Fields(env("EXEC")), env("GRPC")
+	switch {
+	case len(command) > 0 && address != "":
+		return nil, fmt.Errorf("set either EXEC or GRPC")
+	case len(command) > 0:
+		p := NewExecPlugin(name, command[0], command[1:]...)
+		p.User = env("USER")
+		for _, v := range strings.Split(env("ENV"), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				p.Env = append(p.Env, v)
+			}
+		}
+		r.Plugin = p
+	case address != "":
+		p, err := NewGRPCPlugin(name, address, env("GRPC_CA"))
+		if err != nil {
+			return nil, err
+		}
+		r.Plugin = p
+	default:
+		return nil, fmt.Errorf("neither EXEC nor GRPC is set")
+	}
+
+	if value := env("HOOKS"); value != "" {
+		r.Hooks = nil
+		for _, v := range strings.Split(value, ",") {
+			hook, err := ParseHook(strings.TrimSpace(v))
+			if err != nil {
+				return nil, err
+			}
+			r.Hooks = append(r.Hooks, hook)
+		}
+	}
+	if value := env("TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TIMEOUT: %w", err)
+		}
+		r.Timeout = timeout
+	}
+	if value := env("FAIL_OPEN"); value != "" {
+		failOpen, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FAIL_OPEN: %w", err)
+		}
+		r.FailOpen = failOpen
+	}
+	return r, nil
+}
@@ -0,0 +1,157 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// MaxOutputBytes bounds what an exec plugin can write on stdout and stderr
+const MaxOutputBytes = 1 << 20
+
+// sandboxPath is the PATH exec plugins run with
+const sandboxPath = "/usr/local/bin:/usr/bin:/bin"
+
+// ExecPlugin runs a command for every call. The event is written to its stdin
+// and the response read as json from its stdout; a command that exits with 0
+// without output allows the event.
+//
+// The command runs sandboxed: in a private working directory removed after
+// the call, with an environment of only PATH, the DKG_PLUGIN_* variables and
+// the variables listed in Env, in its own process group killed on timeout,
+// and as User when set.
+type ExecPlugin struct {
+	name    string
+	Command string
+	Args    []string
+	// Env are the names of node environment variables passed to the command
+	Env []string
+	// User runs the command as another user, the node has to run as root
+	User string
+}
+
+func NewExecPlugin(name, command string, args ...string) *ExecPlugin {
+	return &ExecPlugin{name: name, Command: command, Args: args}
+}
+
+func (p *ExecPlugin) Name() string {
+	return p.name
+}
+
+func (p *ExecPlugin) Invoke(ctx context.Context, event *Event) (*Response, error) {
+	input, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("Invoke: failed to marshal event: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "dkg-plugin-"+p.name+"-")
+	if err != nil {
+		return nil, fmt.Errorf("Invoke: failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command(p.Command, p.Args...)
+	cmd.Dir = dir
+	cmd.Env = p.environ(event)
+	cmd.Stdin = bytes.NewReader(input)
+	stdout := &limitedBuffer{limit: MaxOutputBytes}
+	stderr := &limitedBuffer{limit: MaxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := sandbox(cmd, p.User, dir); err != nil {
+		return nil, fmt.Errorf("Invoke: failed to sandbox %s: %w", p.Command, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Invoke: failed to start %s: %w", p.Command, err)
+	}
+	waited := make(chan error, 1)
+	go func() { waited <- cmd.Wait() }()
+	select {
+	case err = <-waited:
+	case <-ctx.Done():
+		kill(cmd)
+		<-waited
+		return nil, fmt.Errorf("Invoke: %s killed: %w", p.Command, ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invoke: %s failed: %w: %s", p.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.overflow || stderr.overflow {
+		return nil, fmt.Errorf("Invoke: %s wrote more than %d bytes", p.Command, MaxOutputBytes)
+	}
+
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) == 0 {
+		return &Response{Allow: true}, nil
+	}
+	resp := &Response{}
+	if err := json.Unmarshal(output, resp); err != nil {
+		return nil, fmt.Errorf("Invoke: invalid response of %s: %w", p.Command, err)
+	}
+	return resp, nil
+}
+
+func (p *ExecPlugin) environ(event *Event) []string {
+	env := []string{
+		"PATH=" + sandboxPath,
+		"DKG_PLUGIN_NAME=" + p.name,
+		"DKG_PLUGIN_HOOK=" + string(event.Hook),
+		"DKG_PLUGIN_REQUEST_ID=" + event.RequestID,
+	}
+	for _, name := range p.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest,
+// the command isn't blocked on a full pipe
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.limit {
+		b.overflow = true
+		b.buf.Write(p[:b.limit-b.buf.Len()])
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
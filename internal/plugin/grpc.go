@@ -0,0 +1,203 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// InvokeMethod is the unary method grpc plugins serve, see plugin.proto
+const InvokeMethod = "/rockx.dkg.plugin.v1.Plugin/Invoke"
+
+// GRPCPlugin calls a plugin serving plugin.proto. The address is
+// grpc://host:port for plaintext http/2, on loopback or a private network, or
+// grpcs://host:port for tls.
+type GRPCPlugin struct {
+	name    string
+	address string
+	client  *http.Client
+}
+
+// NewGRPCPlugin dials address, caFile verifies a grpcs plugin whose
+// certificate isn't signed by a system root
+func NewGRPCPlugin(name, address, caFile string) (*GRPCPlugin, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("NewGRPCPlugin: invalid address %s: %w", address, err)
+	}
+	transport := &http2.Transport{}
+	switch u.Scheme {
+	case "grpc":
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+		u.Scheme = "http"
+	case "grpcs":
+		config := &tls.Config{MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("NewGRPCPlugin: failed to read ca: %w", err)
+			}
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("NewGRPCPlugin: no certificate in %s", caFile)
+			}
+		}
+		transport.TLSClientConfig = config
+		u.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("NewGRPCPlugin: address %s is neither grpc:// nor grpcs://", address)
+	}
+	return &GRPCPlugin{name: name, address: u.Scheme + "://" + u.Host, client: &http.Client{Transport: transport}}, nil
+}
+
+func (p *GRPCPlugin) Name() string {
+	return p.name
+}
+
+func (p *GRPCPlugin) Invoke(ctx context.Context, event *Event) (*Response, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("Invoke: failed to marshal event: %w", err)
+	}
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+	msg = protowire.AppendString(msg, string(event.Hook))
+	msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.address+InvokeMethod, bytes.NewReader(frame(msg)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Invoke: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Invoke: unexpected http status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxOutputBytes+5))
+	if err != nil {
+		return nil, fmt.Errorf("Invoke: failed to read response: %w", err)
+	}
+	// errors come as trailers, or in the headers of a response without body
+	if err := grpcStatus(resp.Trailer, resp.Header); err != nil {
+		return nil, fmt.Errorf("Invoke: %w", err)
+	}
+	msg, err = unframe(body)
+	if err != nil {
+		return nil, fmt.Errorf("Invoke: %w", err)
+	}
+	return decodeResponse(msg)
+}
+
+// frame prefixes an uncompressed grpc message with its length
+func frame(msg []byte) []byte {
+	framed := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(framed[1:5], uint32(len(msg)))
+	copy(framed[5:], msg)
+	return framed
+}
+
+func unframe(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, fmt.Errorf("response without message")
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("compressed responses are not supported")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)-5) < uint64(length) {
+		return nil, fmt.Errorf("truncated response of %d bytes, expected %d", len(body)-5, length)
+	}
+	return body[5 : 5+length], nil
+}
+
+func grpcStatus(headers ...http.Header) error {
+	for _, h := range headers {
+		status := h.Get("Grpc-Status")
+		if status == "" {
+			continue
+		}
+		if status == "0" {
+			return nil
+		}
+		message, _ := url.PathUnescape(h.Get("Grpc-Message"))
+		return fmt.Errorf("grpc status %s: %s", status, message)
+	}
+	return fmt.Errorf("response without grpc status")
+}
+
+func decodeResponse(msg []byte) (*Response, error) {
+	resp := &Response{}
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return nil, fmt.Errorf("decodeResponse: %w", protowire.ParseError(n))
+		}
+		msg = msg[n:]
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(msg)
+			if n < 0 {
+				return nil, fmt.Errorf("decodeResponse: %w", protowire.ParseError(n))
+			}
+			resp.Allow = protowire.DecodeBool(v)
+			msg = msg[n:]
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(msg)
+			if n < 0 {
+				return nil, fmt.Errorf("decodeResponse: %w", protowire.ParseError(n))
+			}
+			resp.Reason = v
+			msg = msg[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, msg)
+			if n < 0 {
+				return nil, fmt.Errorf("decodeResponse: %w", protowire.ParseError(n))
+			}
+			msg = msg[n:]
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,116 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// testGRPCServer serves plugin.proto over plaintext http/2, answering with
+// respond
+func testGRPCServer(t *testing.T, respond func(hook string, event *Event) (*Response, string)) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, InvokeMethod, r.URL.Path)
+		require.Equal(t, "application/grpc+proto", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		msg, err := unframe(body)
+		require.NoError(t, err)
+
+		var hook string
+		event := &Event{}
+		for len(msg) > 0 {
+			num, _, n := protowire.ConsumeTag(msg)
+			msg = msg[n:]
+			value, n := protowire.ConsumeBytes(msg)
+			msg = msg[n:]
+			switch num {
+			case 1:
+				hook = string(value)
+			case 2:
+				require.NoError(t, json.Unmarshal(value, event))
+			}
+		}
+
+		resp, status := respond(hook, event)
+		w.Header().Set("Content-Type", "application/grpc")
+		if status != "0" {
+			w.Header().Set("Grpc-Status", status)
+			w.Header().Set("Grpc-Message", "plugin%20failed")
+			return
+		}
+		var out []byte
+		out = protowire.AppendTag(out, 1, protowire.VarintType)
+		out = protowire.AppendVarint(out, protowire.EncodeBool(resp.Allow))
+		out = protowire.AppendTag(out, 2, protowire.BytesType)
+		out = protowire.AppendString(out, resp.Reason)
+		_, _ = w.Write(frame(out))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	})
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGRPCPluginInvoke(t *testing.T) {
+	srv := testGRPCServer(t, func(hook string, event *Event) (*Response, string) {
+		require.Equal(t, "pre-init", hook)
+		require.Equal(t, testEvent(), event)
+		return &Response{Allow: false, Reason: "operator 4 is blocked"}, "0"
+	})
+	p, err := NewGRPCPlugin("test", strings.Replace(srv.URL, "http://", "grpc://", 1), "")
+	require.NoError(t, err)
+
+	resp, err := p.Invoke(context.Background(), testEvent())
+	require.NoError(t, err)
+	require.Equal(t, &Response{Allow: false, Reason: "operator 4 is blocked"}, resp)
+}
+
+func TestGRPCPluginStatus(t *testing.T) {
+	srv := testGRPCServer(t, func(string, *Event) (*Response, string) {
+		return nil, "14"
+	})
+	p, err := NewGRPCPlugin("test", strings.Replace(srv.URL, "http://", "grpc://", 1), "")
+	require.NoError(t, err)
+
+	_, err = p.Invoke(context.Background(), testEvent())
+	require.ErrorContains(t, err, "grpc status 14: plugin failed")
+}
+
+func TestNewGRPCPluginAddress(t *testing.T) {
+	_, err := NewGRPCPlugin("test", "http://127.0.0.1:9000", "")
+	require.Error(t, err)
+	p, err := NewGRPCPlugin("test", "grpcs://plugin.internal:9000", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://plugin.internal:9000", p.address)
+}
@@ -0,0 +1,248 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/sink"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Hook is a point of the ceremony lifecycle plugins run at
+type Hook string
+
+const (
+	// HookPreInit runs before the node joins a keygen, resharing or keysign, a
+	// plugin refusing it keeps the node out of the ceremony
+	HookPreInit Hook = "pre-init"
+	// HookPostOutput runs once a ceremony of this node reached its end
+	HookPostOutput Hook = "post-output"
+	// HookExport hands the sealed result of a keygen or resharing to the
+	// plugin, like a result sink
+	HookExport Hook = "export"
+	// HookProgress runs on every event of the ceremonies started with the
+	// option progress-events=on
+	HookProgress Hook = "progress"
+)
+
+// DefaultTimeout bounds a plugin call that doesn't set its own timeout
+const DefaultTimeout = 10 * time.Second
+
+func ParseHook(value string) (Hook, error) {
+	switch hook := Hook(value); hook {
+	case HookPreInit, HookPostOutput, HookExport, HookProgress:
+		return hook, nil
+	}
+	return "", fmt.Errorf("unknown plugin hook %s", value)
+}
+
+// Event is what a plugin is called with, as json on the stdin of exec plugins
+// and in the event field of the grpc request
+type Event struct {
+	Hook       Hook             `json:"hook"`
+	RequestID  string           `json:"request_id"`
+	OperatorID types.OperatorID `json:"operator_id"`
+	Params     *ceremony.Params `json:"params,omitempty"`
+
+	// WithdrawalCredentials and ForkVersion of a keygen, hex encoded
+	WithdrawalCredentials string `json:"withdrawal_credentials,omitempty"`
+	ForkVersion           string `json:"fork_version,omitempty"`
+
+	// Outcome of the ceremony on post-output
+	Outcome *Outcome `json:"outcome,omitempty"`
+	// Record of the result on export, the share is sealed to the operator key
+	Record *sink.Record `json:"record,omitempty"`
+	// Progress of the ceremony on progress
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+type Outcome struct {
+	State       ceremony.State `json:"state"`
+	ValidatorPK string         `json:"validator_pk,omitempty"`
+	Details     string         `json:"details,omitempty"`
+}
+
+// Progress is an event of a ceremony and the state it left the ceremony in
+type Progress struct {
+	State ceremony.State  `json:"state"`
+	Event *ceremony.Event `json:"event"`
+}
+
+// Response is the answer of a plugin, only pre-init plugins can refuse
+type Response struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Plugin is an exec or grpc plugin
+type Plugin interface {
+	Name() string
+	Invoke(ctx context.Context, event *Event) (*Response, error)
+}
+
+// Registration runs a plugin at its hooks
+type Registration struct {
+	Plugin  Plugin
+	Hooks   []Hook
+	Timeout time.Duration
+	// FailOpen lets a ceremony start when the pre-init plugin fails or times
+	// out, by default the node refuses it
+	FailOpen bool
+}
+
+func (r *Registration) runsAt(hook Hook) bool {
+	for _, h := range r.Hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Registration) invoke(ctx context.Context, event *Event) (*Response, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return r.Plugin.Invoke(ctx, event)
+}
+
+// ErrRefused is returned when a pre-init plugin refuses a ceremony
+type ErrRefused struct {
+	Plugin string
+	Reason string
+}
+
+func (err *ErrRefused) Error() string {
+	if err.Reason == "" {
+		return fmt.Sprintf("refused by plugin %s", err.Plugin)
+	}
+	return fmt.Sprintf("refused by plugin %s: %s", err.Plugin, err.Reason)
+}
+
+// Hooks runs the registered plugins of a node
+type Hooks struct {
+	operatorID    types.OperatorID
+	registrations []*Registration
+	logger        *logrus.Logger
+}
+
+func NewHooks(operatorID types.OperatorID, registrations []*Registration, logger *logrus.Logger) *Hooks {
+	return &Hooks{operatorID: operatorID, registrations: registrations, logger: logger}
+}
+
+// Has reports whether any plugin runs at the hook
+func (h *Hooks) Has(hook Hook) bool {
+	if h == nil {
+		return false
+	}
+	for _, r := range h.registrations {
+		if r.runsAt(hook) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check runs the plugins of the event's hook one after the other and stops at
+// the first that refuses it. A failing plugin refuses the event unless it
+// fails open.
+func (h *Hooks) Check(ctx context.Context, event *Event) error {
+	if h == nil {
+		return nil
+	}
+	event.OperatorID = h.operatorID
+	for _, r := range h.registrations {
+		if !r.runsAt(event.Hook) {
+			continue
+		}
+		resp, err := r.invoke(ctx, event)
+		if err != nil {
+			if r.FailOpen {
+				h.logger.Warnf("Check: plugin %s failed on %s of request %s, failing open: %v", r.Plugin.Name(), event.Hook, event.RequestID, err)
+				continue
+			}
+			return fmt.Errorf("plugin %s failed: %w", r.Plugin.Name(), err)
+		}
+		if !resp.Allow {
+			return &ErrRefused{Plugin: r.Plugin.Name(), Reason: resp.Reason}
+		}
+	}
+	return nil
+}
+
+// Notify runs the plugins of the event's hook, failures are only logged
+func (h *Hooks) Notify(ctx context.Context, event *Event) {
+	if h == nil {
+		return
+	}
+	event.OperatorID = h.operatorID
+	for _, r := range h.registrations {
+		if !r.runsAt(event.Hook) {
+			continue
+		}
+		if _, err := r.invoke(ctx, event); err != nil {
+			h.logger.Errorf("Notify: plugin %s failed on %s of request %s: %v", r.Plugin.Name(), event.Hook, event.RequestID, err)
+			continue
+		}
+		h.logger.Debugf("Notify: plugin %s ran on %s of request %s", r.Plugin.Name(), event.Hook, event.RequestID)
+	}
+}
+
+// Sinks wraps the export plugins as result sinks
+func (h *Hooks) Sinks() []sink.Sink {
+	sinks := make([]sink.Sink, 0)
+	if h == nil {
+		return sinks
+	}
+	for _, r := range h.registrations {
+		if r.runsAt(HookExport) {
+			sinks = append(sinks, &exportSink{registration: r})
+		}
+	}
+	return sinks
+}
+
+type exportSink struct {
+	registration *Registration
+}
+
+func (s *exportSink) Name() string {
+	return "plugin " + s.registration.Plugin.Name()
+}
+
+func (s *exportSink) Put(ctx context.Context, record *sink.Record) error {
+	_, err := s.registration.invoke(ctx, &Event{
+		Hook:       HookExport,
+		RequestID:  record.RequestID,
+		OperatorID: record.OperatorID,
+		Record:     record,
+	})
+	return err
+}
@@ -0,0 +1,209 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/sink"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent() *Event {
+	return &Event{
+		Hook:      HookPreInit,
+		RequestID: "aa",
+		Params:    &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3, 4}, Threshold: 3},
+	}
+}
+
+func shPlugin(t *testing.T, script string) *ExecPlugin {
+	path := filepath.Join(t.TempDir(), "plugin.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755))
+	return NewExecPlugin("test", path)
+}
+
+func TestExecPluginResponse(t *testing.T) {
+	resp, err := shPlugin(t, "cat > /dev/null").Invoke(context.Background(), testEvent())
+	require.NoError(t, err)
+	require.True(t, resp.Allow, "no output allows")
+
+	resp, err = shPlugin(t, `echo '{"allow":false,"reason":"threshold too low"}'`).Invoke(context.Background(), testEvent())
+	require.NoError(t, err)
+	require.Equal(t, &Response{Allow: false, Reason: "threshold too low"}, resp)
+
+	_, err = shPlugin(t, "echo broken >&2; exit 3").Invoke(context.Background(), testEvent())
+	require.ErrorContains(t, err, "broken")
+
+	_, err = shPlugin(t, "echo not json").Invoke(context.Background(), testEvent())
+	require.ErrorContains(t, err, "invalid response")
+}
+
+func TestExecPluginReadsEvent(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "event.json")
+	p := shPlugin(t, "cat > "+out+"; pwd >> "+out+".dir; env > "+out+".env")
+	t.Setenv("PLUGIN_SECRET", "kept")
+	t.Setenv("NODE_OPERATOR_PRIVATE_KEY", "hidden")
+	p.Env = []string{"PLUGIN_SECRET"}
+
+	_, err := p.Invoke(context.Background(), testEvent())
+	require.NoError(t, err)
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	event := &Event{}
+	require.NoError(t, json.Unmarshal(data, event))
+	require.Equal(t, testEvent(), event)
+
+	env, err := os.ReadFile(out + ".env")
+	require.NoError(t, err)
+	require.Contains(t, string(env), "DKG_PLUGIN_HOOK=pre-init")
+	require.Contains(t, string(env), "PLUGIN_SECRET=kept")
+	require.NotContains(t, string(env), "hidden", "only listed variables reach the plugin")
+
+	dir, err := os.ReadFile(out + ".dir")
+	require.NoError(t, err)
+	_, err = os.Stat(string(dir[:len(dir)-1]))
+	require.True(t, os.IsNotExist(err), "the working directory is removed")
+}
+
+func TestExecPluginTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := shPlugin(t, "sleep 10 & sleep 10").Invoke(ctx, testEvent())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestExecPluginOutputLimit(t *testing.T) {
+	_, err := shPlugin(t, "head -c 2000000 /dev/zero").Invoke(context.Background(), testEvent())
+	require.ErrorContains(t, err, "more than")
+}
+
+type testPlugin struct {
+	resp   *Response
+	err    error
+	events []*Event
+}
+
+func (p *testPlugin) Name() string {
+	return "test"
+}
+
+func (p *testPlugin) Invoke(ctx context.Context, event *Event) (*Response, error) {
+	p.events = append(p.events, event)
+	return p.resp, p.err
+}
+
+func TestHooksCheck(t *testing.T) {
+	allow := &testPlugin{resp: &Response{Allow: true}}
+	deny := &testPlugin{resp: &Response{Reason: "no"}}
+	failing := &testPlugin{err: errors.New("down")}
+	logger := logrus.New()
+
+	hooks := NewHooks(7, []*Registration{
+		{Plugin: allow, Hooks: []Hook{HookPreInit}},
+		{Plugin: deny, Hooks: []Hook{HookPostOutput}},
+	}, logger)
+	require.NoError(t, hooks.Check(context.Background(), testEvent()))
+	require.Len(t, allow.events, 1)
+	require.EqualValues(t, 7, allow.events[0].OperatorID)
+	require.Empty(t, deny.events, "runs at post-output only")
+
+	hooks = NewHooks(7, []*Registration{{Plugin: deny, Hooks: []Hook{HookPreInit}}}, logger)
+	var refused *ErrRefused
+	require.ErrorAs(t, hooks.Check(context.Background(), testEvent()), &refused)
+	require.Equal(t, "no", refused.Reason)
+
+	hooks = NewHooks(7, []*Registration{{Plugin: failing, Hooks: []Hook{HookPreInit}}}, logger)
+	err := hooks.Check(context.Background(), testEvent())
+	require.ErrorContains(t, err, "down")
+	require.False(t, errors.As(err, &refused))
+
+	hooks = NewHooks(7, []*Registration{{Plugin: failing, Hooks: []Hook{HookPreInit}, FailOpen: true}}, logger)
+	require.NoError(t, hooks.Check(context.Background(), testEvent()))
+
+	var none *Hooks
+	require.False(t, none.Has(HookPreInit))
+	require.NoError(t, none.Check(context.Background(), testEvent()))
+}
+
+func TestHooksSinks(t *testing.T) {
+	export := &testPlugin{resp: &Response{}}
+	hooks := NewHooks(1, []*Registration{
+		{Plugin: export, Hooks: []Hook{HookExport}},
+		{Plugin: &testPlugin{}, Hooks: []Hook{HookPreInit}},
+	}, logrus.New())
+	sinks := hooks.Sinks()
+	require.Len(t, sinks, 1)
+	require.NoError(t, sinks[0].Put(context.Background(), &sink.Record{RequestID: "aa", OperatorID: 1}))
+	require.Equal(t, HookExport, export.events[0].Hook)
+	require.Equal(t, "aa", export.events[0].Record.RequestID)
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("NODE_PLUGINS", "")
+	registrations, err := FromEnv()
+	require.NoError(t, err)
+	require.Empty(t, registrations)
+
+	t.Setenv("NODE_PLUGINS", "policy, site-export")
+	t.Setenv("NODE_PLUGIN_POLICY_EXEC", "/opt/dkg/policy --strict")
+	t.Setenv("NODE_PLUGIN_POLICY_TIMEOUT", "3s")
+	t.Setenv("NODE_PLUGIN_POLICY_ENV", "POLICY_URL, POLICY_TOKEN")
+	t.Setenv("NODE_PLUGIN_SITE_EXPORT_GRPC", "grpc://127.0.0.1:9000")
+	t.Setenv("NODE_PLUGIN_SITE_EXPORT_HOOKS", "post-output,export")
+	t.Setenv("NODE_PLUGIN_SITE_EXPORT_FAIL_OPEN", "true")
+	registrations, err = FromEnv()
+	require.NoError(t, err)
+	require.Len(t, registrations, 2)
+
+	policy := registrations[0]
+	require.Equal(t, []Hook{HookPreInit}, policy.Hooks)
+	require.Equal(t, 3*time.Second, policy.Timeout)
+	exec := policy.Plugin.(*ExecPlugin)
+	require.Equal(t, "/opt/dkg/policy", exec.Command)
+	require.Equal(t, []string{"--strict"}, exec.Args)
+	require.Equal(t, []string{"POLICY_URL", "POLICY_TOKEN"}, exec.Env)
+
+	export := registrations[1]
+	require.Equal(t, []Hook{HookPostOutput, HookExport}, export.Hooks)
+	require.True(t, export.FailOpen)
+	require.Equal(t, "site-export", export.Plugin.Name())
+
+	t.Setenv("NODE_PLUGIN_SITE_EXPORT_HOOKS", "pre-start")
+	_, err = FromEnv()
+	require.ErrorContains(t, err, "unknown plugin hook")
+
+	t.Setenv("NODE_PLUGINS", "missing")
+	_, err = FromEnv()
+	require.ErrorContains(t, err, "neither EXEC nor GRPC")
+}
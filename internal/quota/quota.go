@@ -0,0 +1,345 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package quota watches the disk usage of the node database. It raises
+// alerts as the database grows towards its quota or the disk fills up,
+// refuses new ceremonies once usage is critical and records failed writes,
+// which would otherwise only show up as a ceremony that never finishes.
+package quota
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+type Level int
+
+const (
+	LevelOK Level = iota
+	LevelWarning
+	LevelCritical
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelWarning:
+		return "warning"
+	case LevelCritical:
+		return "critical"
+	}
+	return "ok"
+}
+
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+type Config struct {
+	// MaxBytes is the size the database may grow to, 0 for no quota
+	MaxBytes int64
+	// MinFreeBytes is the space that must stay free on the disk of the database, 0 for no minimum
+	MinFreeBytes int64
+	// WarnAt are the fractions of MaxBytes that raise an alert when the database grows past them
+	WarnAt []float64
+	// CriticalAt is the fraction of MaxBytes from which new ceremonies are refused
+	CriticalAt float64
+	// Interval is how often the usage is checked in the background
+	Interval time.Duration
+}
+
+var DefaultConfig = Config{
+	WarnAt:     []float64{0.8, 0.9},
+	CriticalAt: 0.95,
+	Interval:   time.Minute,
+}
+
+// Usage is the disk usage of the database at the last check
+type Usage struct {
+	DBBytes      int64 `json:"db_bytes"`
+	MaxBytes     int64 `json:"max_bytes,omitempty"`
+	FreeBytes    int64 `json:"free_bytes"`
+	MinFreeBytes int64 `json:"min_free_bytes,omitempty"`
+	// Ratio is DBBytes of MaxBytes, 0 without quota
+	Ratio     float64   `json:"ratio"`
+	Level     Level     `json:"level"`
+	Reason    string    `json:"reason,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	// WriteErrors counts the database writes that failed since the node started
+	WriteErrors    int64  `json:"write_errors"`
+	LastWriteError string `json:"last_write_error,omitempty"`
+}
+
+// ErrQuota is returned for a ceremony refused because disk usage is critical
+type ErrQuota struct {
+	Usage Usage
+}
+
+func (e *ErrQuota) Error() string {
+	return fmt.Sprintf("disk usage is critical: %s", e.Usage.Reason)
+}
+
+// Monitor checks the disk usage of the database in a directory
+type Monitor struct {
+	config Config
+	dir    string
+	logger *logrus.Logger
+
+	mu     sync.Mutex
+	usage  Usage
+	warned float64
+}
+
+func NewMonitor(config Config, dir string, logger *logrus.Logger) *Monitor {
+	sort.Float64s(config.WarnAt)
+	return &Monitor{config: config, dir: dir, logger: logger}
+}
+
+// Run checks the usage every interval until done is closed
+func (m *Monitor) Run(done <-chan struct{}) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	for {
+		m.Check()
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check measures the database and the free disk space, alerting on the
+// thresholds crossed since the last check
+func (m *Monitor) Check() Usage {
+	size, err := dirSize(m.dir)
+	if err != nil {
+		m.logger.Errorf("Check: failed to measure database in %s: %v", m.dir, err)
+	}
+	free, err := freeSpace(m.dir)
+	if err != nil {
+		m.logger.Debugf("Check: failed to get free disk space of %s: %v", m.dir, err)
+		free = -1
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := m.usage
+	usage.DBBytes = size
+	usage.MaxBytes = m.config.MaxBytes
+	usage.FreeBytes = free
+	usage.MinFreeBytes = m.config.MinFreeBytes
+	usage.CheckedAt = time.Now()
+	usage.Ratio = 0
+	if m.config.MaxBytes > 0 {
+		usage.Ratio = float64(size) / float64(m.config.MaxBytes)
+	}
+	usage.Level, usage.Reason = m.level(usage)
+
+	m.alert(m.usage, usage)
+	m.usage = usage
+	return usage
+}
+
+func (m *Monitor) level(u Usage) (Level, string) {
+	lowSpace := m.config.MinFreeBytes > 0 && u.FreeBytes >= 0
+	switch {
+	case m.config.MaxBytes > 0 && u.Ratio >= m.config.CriticalAt:
+		return LevelCritical, fmt.Sprintf("database uses %s of its %s quota", formatBytes(u.DBBytes), formatBytes(u.MaxBytes))
+	case lowSpace && u.FreeBytes < m.config.MinFreeBytes:
+		return LevelCritical, fmt.Sprintf("%s free on disk, below the %s minimum", formatBytes(u.FreeBytes), formatBytes(u.MinFreeBytes))
+	case m.config.MaxBytes > 0 && len(m.config.WarnAt) > 0 && u.Ratio >= m.config.WarnAt[0]:
+		return LevelWarning, fmt.Sprintf("database uses %.0f%% of its %s quota", u.Ratio*100, formatBytes(u.MaxBytes))
+	case lowSpace && u.FreeBytes < 2*m.config.MinFreeBytes:
+		return LevelWarning, fmt.Sprintf("%s free on disk, close to the %s minimum", formatBytes(u.FreeBytes), formatBytes(u.MinFreeBytes))
+	}
+	return LevelOK, ""
+}
+
+// alert logs the level changes and every warning threshold the database grew past
+func (m *Monitor) alert(prev, cur Usage) {
+	crossed := 0.0
+	for _, at := range m.config.WarnAt {
+		if cur.Ratio >= at {
+			crossed = at
+		}
+	}
+	if crossed > m.warned && cur.Level != LevelCritical {
+		m.logger.Warnf("Monitor: database passed %.0f%% of its quota: %s", crossed*100, cur.Reason)
+	}
+	m.warned = crossed
+
+	if cur.Level == prev.Level {
+		return
+	}
+	switch cur.Level {
+	case LevelCritical:
+		m.logger.Errorf("Monitor: disk usage is critical, new ceremonies are refused: %s", cur.Reason)
+	case LevelWarning:
+		if crossed == 0 || prev.Level == LevelCritical {
+			m.logger.Warnf("Monitor: disk usage is high: %s", cur.Reason)
+		}
+	case LevelOK:
+		m.logger.Infof("Monitor: disk usage is back to normal")
+	}
+}
+
+// Usage returns the usage at the last check
+func (m *Monitor) Usage() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// Admit checks the usage and returns an *ErrQuota when it is too critical to
+// start a ceremony, ceremonies already running are left to finish
+func (m *Monitor) Admit() error {
+	if usage := m.Check(); usage.Level == LevelCritical {
+		return &ErrQuota{Usage: usage}
+	}
+	return nil
+}
+
+// Wrap records the failed writes of db
+func (m *Monitor) Wrap(db storage.DB) storage.DB {
+	return &monitoredDB{DB: db, monitor: m}
+}
+
+func (m *Monitor) writeFailed(err error) {
+	m.mu.Lock()
+	m.usage.WriteErrors++
+	m.usage.LastWriteError = err.Error()
+	m.mu.Unlock()
+	m.logger.Errorf("Monitor: database write failed: %v", err)
+}
+
+// Collectors are the prometheus metrics of the monitor
+func (m *Monitor) Collectors() []prometheus.Collector {
+	gauge := func(name, help string, value func(u Usage) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			return value(m.Usage())
+		})
+	}
+	return []prometheus.Collector{
+		gauge("dkg_node_db_size_bytes", "Size of the node database on disk", func(u Usage) float64 { return float64(u.DBBytes) }),
+		gauge("dkg_node_db_quota_bytes", "Size the node database may grow to, 0 without quota", func(u Usage) float64 { return float64(u.MaxBytes) }),
+		gauge("dkg_node_disk_free_bytes", "Free space on the disk of the node database, -1 when unknown", func(u Usage) float64 { return float64(u.FreeBytes) }),
+		gauge("dkg_node_disk_level", "Disk usage level, 0 ok, 1 warning, 2 critical", func(u Usage) float64 { return float64(u.Level) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "dkg_node_db_write_errors_total",
+			Help: "Failed writes to the node database",
+		}, func() float64 {
+			return float64(m.Usage().WriteErrors)
+		}),
+	}
+}
+
+type monitoredDB struct {
+	storage.DB
+	monitor *Monitor
+}
+
+func (db *monitoredDB) Update(fn func(txn storage.Txn) error) error {
+	err := db.DB.Update(fn)
+	if err != nil {
+		db.monitor.writeFailed(err)
+	}
+	return err
+}
+
+func (db *monitoredDB) Batch(fn func(w storage.Writer) error) error {
+	err := db.DB.Batch(fn)
+	if err != nil {
+		db.monitor.writeFailed(err)
+	}
+	return err
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+var units = []string{"B", "KB", "MB", "GB", "TB"}
+
+// ParseBytes parses a size like 512MB or 20GB, units are powers of 1024
+func ParseBytes(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for i := len(units) - 1; i >= 0; i-- {
+		for _, suffix := range []string{units[i], strings.TrimSuffix(units[i], "B")} {
+			if suffix == "" || !strings.HasSuffix(s, suffix) {
+				continue
+			}
+			n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, suffix)), 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return int64(n * float64(int64(1)<<(10*i))), nil
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n, nil
+}
+
+func formatBytes(n int64) string {
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.1f%s", f, units[i])
+}
@@ -0,0 +1,137 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package quota
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name string, size int) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o600))
+}
+
+func testMonitor(t *testing.T, config Config) (*Monitor, string, *bytes.Buffer) {
+	dir := t.TempDir()
+	logs := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(logs)
+	return NewMonitor(config, dir, logger), dir, logs
+}
+
+func TestMonitorLevels(t *testing.T) {
+	config := DefaultConfig
+	config.MaxBytes = 1000
+	m, dir, logs := testMonitor(t, config)
+
+	writeFile(t, dir, "000001.vlog", 500)
+	usage := m.Check()
+	require.Equal(t, LevelOK, usage.Level)
+	require.EqualValues(t, 500, usage.DBBytes)
+	require.NoError(t, m.Admit())
+
+	// crossing 80% and then 90% raises an alert each
+	writeFile(t, dir, "000001.sst", 350)
+	require.Equal(t, LevelWarning, m.Check().Level)
+	require.Contains(t, logs.String(), "passed 80% of its quota")
+	writeFile(t, dir, "000002.sst", 60)
+	require.Equal(t, LevelWarning, m.Check().Level)
+	require.Contains(t, logs.String(), "passed 90% of its quota")
+	require.NoError(t, m.Admit())
+
+	writeFile(t, dir, "000003.sst", 50)
+	err := m.Admit()
+	var quotaErr *ErrQuota
+	require.True(t, errors.As(err, &quotaErr))
+	require.Equal(t, LevelCritical, quotaErr.Usage.Level)
+	require.EqualValues(t, 960, quotaErr.Usage.DBBytes)
+	require.Contains(t, logs.String(), "new ceremonies are refused")
+
+	// compaction frees space again
+	require.NoError(t, os.Remove(filepath.Join(dir, "000001.vlog")))
+	require.Equal(t, LevelOK, m.Check().Level)
+	require.Contains(t, logs.String(), "back to normal")
+}
+
+func TestMonitorMinFree(t *testing.T) {
+	m, _, _ := testMonitor(t, DefaultConfig)
+	free, err := freeSpace(m.dir)
+	if err != nil {
+		t.Skip("free disk space is not supported on this platform")
+	}
+
+	require.Equal(t, LevelOK, m.Check().Level)
+
+	m.config.MinFreeBytes = free + 1<<30
+	require.Equal(t, LevelCritical, m.Check().Level)
+	require.Error(t, m.Admit())
+}
+
+func TestMonitorWriteErrors(t *testing.T) {
+	m, _, _ := testMonitor(t, DefaultConfig)
+	db := m.Wrap(&failingDB{})
+
+	require.Error(t, db.Update(func(txn storage.Txn) error { return nil }))
+	require.NoError(t, db.View(func(txn storage.Txn) error { return nil }))
+	require.EqualValues(t, 1, m.Usage().WriteErrors)
+	require.Equal(t, "no space left on device", m.Usage().LastWriteError)
+}
+
+func TestParseBytes(t *testing.T) {
+	for input, want := range map[string]int64{
+		"1024":   1024,
+		"512MB":  512 << 20,
+		"20G":    20 << 30,
+		"1.5gb":  3 << 29,
+		" 2TB ":  2 << 40,
+		"100 KB": 100 << 10,
+	} {
+		got, err := ParseBytes(input)
+		require.NoError(t, err, input)
+		require.Equal(t, want, got, input)
+	}
+	for _, input := range []string{"", "GB", "-1GB", "ten"} {
+		_, err := ParseBytes(input)
+		require.Error(t, err, input)
+	}
+}
+
+type failingDB struct{}
+
+func (failingDB) View(fn func(txn storage.Txn) error) error { return fn(nil) }
+
+func (failingDB) Update(func(txn storage.Txn) error) error {
+	return errors.New("no space left on device")
+}
+
+func (failingDB) Batch(func(w storage.Writer) error) error {
+	return errors.New("no space left on device")
+}
+
+func (failingDB) Close() error { return nil }
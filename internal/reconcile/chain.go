@@ -0,0 +1,309 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// Contract is an SSVNetwork contract and the block it was deployed at, the
+// validator events before it don't need to be scanned
+type Contract struct {
+	Address     string
+	DeployBlock uint64
+}
+
+// Contracts are the SSVNetwork contracts by network
+var Contracts = map[string]Contract{
+	"mainnet": {Address: "0xDD9BC35aE942eF0cFa76930954a156B3fF30a4E1", DeployBlock: 17507487},
+	"holesky": {Address: "0x38A4794cCEd47d3baf7370CcC43B560D3a1beEFA", DeployBlock: 181612},
+}
+
+// DefaultBlockRange is how many blocks one eth_getLogs request covers, most
+// providers cap the range or the number of logs of a request
+const DefaultBlockRange = 10000
+
+const ssvNetworkABI = `[
+	{"type":"event","name":"ValidatorAdded","anonymous":false,"inputs":[
+		{"name":"owner","type":"address","indexed":true},
+		{"name":"operatorIds","type":"uint64[]","indexed":false},
+		{"name":"publicKey","type":"bytes","indexed":false},
+		{"name":"shares","type":"bytes","indexed":false},
+		{"name":"cluster","type":"tuple","indexed":false,"components":[
+			{"name":"validatorCount","type":"uint32"},
+			{"name":"networkFeeIndex","type":"uint64"},
+			{"name":"index","type":"uint64"},
+			{"name":"active","type":"bool"},
+			{"name":"balance","type":"uint256"}]}]},
+	{"type":"event","name":"ValidatorRemoved","anonymous":false,"inputs":[
+		{"name":"owner","type":"address","indexed":true},
+		{"name":"operatorIds","type":"uint64[]","indexed":false},
+		{"name":"publicKey","type":"bytes","indexed":false},
+		{"name":"cluster","type":"tuple","indexed":false,"components":[
+			{"name":"validatorCount","type":"uint32"},
+			{"name":"networkFeeIndex","type":"uint64"},
+			{"name":"index","type":"uint64"},
+			{"name":"active","type":"bool"},
+			{"name":"balance","type":"uint256"}]}]},
+	{"type":"event","name":"ClusterLiquidated","anonymous":false,"inputs":[
+		{"name":"owner","type":"address","indexed":true},
+		{"name":"operatorIds","type":"uint64[]","indexed":false},
+		{"name":"cluster","type":"tuple","indexed":false,"components":[
+			{"name":"validatorCount","type":"uint32"},
+			{"name":"networkFeeIndex","type":"uint64"},
+			{"name":"index","type":"uint64"},
+			{"name":"active","type":"bool"},
+			{"name":"balance","type":"uint256"}]}]},
+	{"type":"event","name":"ClusterReactivated","anonymous":false,"inputs":[
+		{"name":"owner","type":"address","indexed":true},
+		{"name":"operatorIds","type":"uint64[]","indexed":false},
+		{"name":"cluster","type":"tuple","indexed":false,"components":[
+			{"name":"validatorCount","type":"uint32"},
+			{"name":"networkFeeIndex","type":"uint64"},
+			{"name":"index","type":"uint64"},
+			{"name":"active","type":"bool"},
+			{"name":"balance","type":"uint256"}]}]},
+	{"type":"event","name":"ClusterWithdrawn","anonymous":false,"inputs":[
+		{"name":"owner","type":"address","indexed":true},
+		{"name":"operatorIds","type":"uint64[]","indexed":false},
+		{"name":"value","type":"uint256","indexed":false},
+		{"name":"cluster","type":"tuple","indexed":false,"components":[
+			{"name":"validatorCount","type":"uint32"},
+			{"name":"networkFeeIndex","type":"uint64"},
+			{"name":"index","type":"uint64"},
+			{"name":"active","type":"bool"},
+			{"name":"balance","type":"uint256"}]}]},
+	{"type":"event","name":"ClusterDeposited","anonymous":false,"inputs":[
+		{"name":"owner","type":"address","indexed":true},
+		{"name":"operatorIds","type":"uint64[]","indexed":false},
+		{"name":"value","type":"uint256","indexed":false},
+		{"name":"cluster","type":"tuple","indexed":false,"components":[
+			{"name":"validatorCount","type":"uint32"},
+			{"name":"networkFeeIndex","type":"uint64"},
+			{"name":"index","type":"uint64"},
+			{"name":"active","type":"bool"},
+			{"name":"balance","type":"uint256"}]}]},
+	{"type":"function","name":"registerValidator","stateMutability":"nonpayable","outputs":[],"inputs":[
+		{"name":"publicKey","type":"bytes"},
+		{"name":"operatorIds","type":"uint64[]"},
+		{"name":"sharesData","type":"bytes"},
+		{"name":"amount","type":"uint256"},
+		{"name":"cluster","type":"tuple","components":[
+			{"name":"validatorCount","type":"uint32"},
+			{"name":"networkFeeIndex","type":"uint64"},
+			{"name":"index","type":"uint64"},
+			{"name":"active","type":"bool"},
+			{"name":"balance","type":"uint256"}]}]}
+]`
+
+var ssvNetwork = mustParseABI(ssvNetworkABI)
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// Validator is a validator registered on chain
+type Validator struct {
+	// PublicKey is hex encoded without 0x, like the validator keys in the node storage
+	PublicKey   string             `json:"public_key"`
+	Owner       string             `json:"owner"`
+	OperatorIDs []types.OperatorID `json:"operator_ids"`
+}
+
+// Chain reads the validators registered in an SSVNetwork contract through an
+// execution node's json-rpc api
+type Chain struct {
+	RPC        string
+	Contract   Contract
+	BlockRange uint64
+	client     *http.Client
+}
+
+func NewChain(rpc string, contract Contract) *Chain {
+	return &Chain{
+		RPC:        rpc,
+		Contract:   contract,
+		BlockRange: DefaultBlockRange,
+		client:     &http.Client{Timeout: time.Minute},
+	}
+}
+
+type ethLog struct {
+	Topics  []string `json:"topics"`
+	Data    string   `json:"data"`
+	Removed bool     `json:"removed"`
+}
+
+// ValidatorsOf replays the validator events of the contract up to the latest
+// block and returns the validators registered with the operator by public key
+func (c *Chain) ValidatorsOf(ctx context.Context, operatorID types.OperatorID) (map[string]*Validator, error) {
+	var head string
+	if err := c.call(ctx, "eth_blockNumber", []interface{}{}, &head); err != nil {
+		return nil, err
+	}
+	latest, err := strconv.ParseUint(strings.TrimPrefix(head, "0x"), 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number %q: %w", head, err)
+	}
+
+	added, removed := ssvNetwork.Events["ValidatorAdded"], ssvNetwork.Events["ValidatorRemoved"]
+	validators := make(map[string]*Validator)
+	for from := c.Contract.DeployBlock; from <= latest; from += c.BlockRange {
+		to := from + c.BlockRange - 1
+		if to > latest {
+			to = latest
+		}
+		var logs []ethLog
+		filter := map[string]interface{}{
+			"address":   c.Contract.Address,
+			"fromBlock": fmt.Sprintf("0x%x", from),
+			"toBlock":   fmt.Sprintf("0x%x", to),
+			"topics":    [][]string{{added.ID.Hex(), removed.ID.Hex()}},
+		}
+		if err := c.call(ctx, "eth_getLogs", []interface{}{filter}, &logs); err != nil {
+			return nil, fmt.Errorf("failed to get logs of blocks %d to %d: %w", from, to, err)
+		}
+
+		for _, log := range logs {
+			if log.Removed || len(log.Topics) < 2 {
+				continue
+			}
+			event := added
+			if strings.EqualFold(log.Topics[0], removed.ID.Hex()) {
+				event = removed
+			}
+			validator, err := decodeValidator(event, log)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode %s event: %w", event.Name, err)
+			}
+			if !registeredWith(validator, operatorID) {
+				continue
+			}
+			if event.Name == removed.Name {
+				delete(validators, validator.PublicKey)
+			} else {
+				validators[validator.PublicKey] = validator
+			}
+		}
+	}
+	return validators, nil
+}
+
+func decodeValidator(event abi.Event, log ethLog) (*Validator, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(log.Data, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	if err := event.Inputs.NonIndexed().UnpackIntoMap(values, data); err != nil {
+		return nil, err
+	}
+	operatorIDs, ok := values["operatorIds"].([]uint64)
+	if !ok {
+		return nil, fmt.Errorf("unexpected operator ids %T", values["operatorIds"])
+	}
+	publicKey, ok := values["publicKey"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected public key %T", values["publicKey"])
+	}
+
+	validator := &Validator{
+		PublicKey: hex.EncodeToString(publicKey),
+		// the owner topic is the address left padded to 32 bytes
+		Owner: "0x" + log.Topics[1][len(log.Topics[1])-40:],
+	}
+	for _, id := range operatorIDs {
+		validator.OperatorIDs = append(validator.OperatorIDs, types.OperatorID(id))
+	}
+	return validator, nil
+}
+
+func registeredWith(validator *Validator, operatorID types.OperatorID) bool {
+	for _, id := range validator.OperatorIDs {
+		if id == operatorID {
+			return true
+		}
+	}
+	return false
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (c *Chain) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.RPC, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: rpc returned %s", method, resp.Status)
+	}
+	response := struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}{}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s: %s", method, response.Error.Message)
+	}
+	return json.Unmarshal(response.Result, result)
+}
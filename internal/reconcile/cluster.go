@@ -0,0 +1,148 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package reconcile
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Cluster is the snapshot of a cluster the SSVNetwork contract expects with
+// every call that changes it, taken from the latest event of the cluster
+type Cluster struct {
+	ValidatorCount  uint32   `json:"validatorCount"`
+	NetworkFeeIndex uint64   `json:"networkFeeIndex"`
+	Index           uint64   `json:"index"`
+	Active          bool     `json:"active"`
+	Balance         *big.Int `json:"balance"`
+}
+
+// NewCluster is the snapshot of a cluster without validators yet
+func NewCluster() *Cluster {
+	return &Cluster{Active: true, Balance: big.NewInt(0)}
+}
+
+// OwnerState is what registering another validator of the owner depends on
+type OwnerState struct {
+	// Nonce is the owner nonce the shares of the next validator are signed
+	// with, the number of validators the owner added so far
+	Nonce uint64 `json:"nonce"`
+	// Cluster of the operators, a new cluster when the owner has none with them
+	Cluster *Cluster `json:"cluster"`
+}
+
+var clusterEvents = []string{"ValidatorAdded", "ValidatorRemoved", "ClusterLiquidated", "ClusterReactivated", "ClusterWithdrawn", "ClusterDeposited"}
+
+// OwnerState replays the validator and cluster events of the owner up to
+// the latest block, for its nonce and the snapshot of its cluster with the
+// operators
+func (c *Chain) OwnerState(ctx context.Context, owner common.Address, operatorIDs []uint64) (*OwnerState, error) {
+	var head string
+	if err := c.call(ctx, "eth_blockNumber", []interface{}{}, &head); err != nil {
+		return nil, err
+	}
+	latest, err := strconv.ParseUint(strings.TrimPrefix(head, "0x"), 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number %q: %w", head, err)
+	}
+
+	ids := make([]string, 0, len(clusterEvents))
+	for _, name := range clusterEvents {
+		ids = append(ids, ssvNetwork.Events[name].ID.Hex())
+	}
+	ownerTopic := common.BytesToHash(owner.Bytes()).Hex()
+	clusterKey := operatorsKey(operatorIDs)
+
+	state := &OwnerState{Cluster: NewCluster()}
+	for from := c.Contract.DeployBlock; from <= latest; from += c.BlockRange {
+		to := from + c.BlockRange - 1
+		if to > latest {
+			to = latest
+		}
+		var logs []ethLog
+		filter := map[string]interface{}{
+			"address":   c.Contract.Address,
+			"fromBlock": fmt.Sprintf("0x%x", from),
+			"toBlock":   fmt.Sprintf("0x%x", to),
+			"topics":    [][]string{ids, {ownerTopic}},
+		}
+		if err := c.call(ctx, "eth_getLogs", []interface{}{filter}, &logs); err != nil {
+			return nil, fmt.Errorf("failed to get logs of blocks %d to %d: %w", from, to, err)
+		}
+
+		for _, log := range logs {
+			if log.Removed || len(log.Topics) < 2 {
+				continue
+			}
+			event, err := ssvNetwork.EventByID(common.HexToHash(log.Topics[0]))
+			if err != nil {
+				continue
+			}
+			if event.Name == "ValidatorAdded" {
+				state.Nonce++
+			}
+			eventIDs, cluster, err := decodeCluster(*event, log)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode %s event: %w", event.Name, err)
+			}
+			if operatorsKey(eventIDs) == clusterKey {
+				state.Cluster = cluster
+			}
+		}
+	}
+	return state, nil
+}
+
+func decodeCluster(event abi.Event, log ethLog) ([]uint64, *Cluster, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(log.Data, "0x"))
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make(map[string]interface{})
+	if err := event.Inputs.NonIndexed().UnpackIntoMap(values, data); err != nil {
+		return nil, nil, err
+	}
+	operatorIDs, ok := values["operatorIds"].([]uint64)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected operator ids %T", values["operatorIds"])
+	}
+	cluster, ok := abi.ConvertType(values["cluster"], new(Cluster)).(*Cluster)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected cluster %T", values["cluster"])
+	}
+	return operatorIDs, cluster, nil
+}
+
+// operatorsKey identifies a cluster by its sorted operator ids
+func operatorsKey(operatorIDs []uint64) string {
+	sorted := append([]uint64{}, operatorIDs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return fmt.Sprint(sorted)
+}
@@ -0,0 +1,125 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package reconcile compares the shares in the node storage with the
+// validators registered to the operator in the SSVNetwork contract.
+package reconcile
+
+import (
+	"encoding/hex"
+	"sort"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Report is the drift between the node storage and the chain
+type Report struct {
+	OperatorID types.OperatorID `json:"operator_id"`
+	// InSync are the validators with a local share registered with the same committee
+	InSync []string `json:"in_sync"`
+	// Unregistered are local shares of validators not registered with the operator
+	Unregistered []string `json:"unregistered"`
+	// Missing are validators registered with the operator without a local share
+	Missing []*Validator `json:"missing"`
+	// HandedOver are registered validators whose share this node handed over
+	// to another node of the operator, they are expected to have no share here
+	HandedOver []*Validator `json:"handed_over"`
+	// CommitteeMismatch are validators registered with another committee than
+	// the one of the local share, e.g. a resharing that was not registered
+	CommitteeMismatch []*Mismatch `json:"committee_mismatch"`
+}
+
+type Mismatch struct {
+	Validator        *Validator         `json:"validator"`
+	LocalOperatorIDs []types.OperatorID `json:"local_operator_ids"`
+}
+
+// Drifted reports whether storage and chain disagree
+func (r *Report) Drifted() bool {
+	return len(r.Unregistered) > 0 || len(r.Missing) > 0 || len(r.CommitteeMismatch) > 0
+}
+
+// Reconcile compares the local shares and the validators handed over by this
+// node, both by hex public key, with the validators registered on chain
+func Reconcile(operatorID types.OperatorID, shares []*storage.ValidatorShare, handedOver map[string]bool, registered map[string]*Validator) *Report {
+	report := &Report{
+		OperatorID:        operatorID,
+		InSync:            []string{},
+		Unregistered:      []string{},
+		Missing:           []*Validator{},
+		HandedOver:        []*Validator{},
+		CommitteeMismatch: []*Mismatch{},
+	}
+
+	local := make(map[string]*storage.ValidatorShare)
+	for _, share := range shares {
+		pk := hex.EncodeToString(share.ValidatorPK)
+		local[pk] = share
+
+		validator, ok := registered[pk]
+		switch {
+		case !ok:
+			report.Unregistered = append(report.Unregistered, pk)
+		case !sameOperators(share.Operators, validator.OperatorIDs):
+			report.CommitteeMismatch = append(report.CommitteeMismatch, &Mismatch{Validator: validator, LocalOperatorIDs: share.Operators})
+		default:
+			report.InSync = append(report.InSync, pk)
+		}
+	}
+	for pk, validator := range registered {
+		if _, ok := local[pk]; ok {
+			continue
+		}
+		if handedOver[pk] {
+			report.HandedOver = append(report.HandedOver, validator)
+		} else {
+			report.Missing = append(report.Missing, validator)
+		}
+	}
+
+	sort.Strings(report.InSync)
+	sort.Strings(report.Unregistered)
+	for _, validators := range [][]*Validator{report.Missing, report.HandedOver} {
+		validators := validators
+		sort.Slice(validators, func(i, j int) bool { return validators[i].PublicKey < validators[j].PublicKey })
+	}
+	sort.Slice(report.CommitteeMismatch, func(i, j int) bool {
+		return report.CommitteeMismatch[i].Validator.PublicKey < report.CommitteeMismatch[j].Validator.PublicKey
+	})
+	return report
+}
+
+func sameOperators(a, b []types.OperatorID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := make(map[types.OperatorID]bool)
+	for _, id := range a {
+		ids[id] = true
+	}
+	for _, id := range b {
+		if !ids[id] {
+			return false
+		}
+	}
+	return true
+}
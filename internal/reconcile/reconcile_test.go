@@ -0,0 +1,173 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package reconcile
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/storage"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+const testOwner = "0x000000000000000000000000a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2"
+
+func testPK(b byte) []byte {
+	pk := make([]byte, 48)
+	pk[0] = b
+	return pk
+}
+
+func eventLog(t *testing.T, name string, block uint64, operatorIDs []uint64, pk []byte) map[string]interface{} {
+	event := ssvNetwork.Events[name]
+	args := []interface{}{operatorIDs, pk}
+	if name == "ValidatorAdded" {
+		args = append(args, []byte("shares"))
+	}
+	args = append(args, Cluster{Balance: big.NewInt(0)})
+	data, err := event.Inputs.NonIndexed().Pack(args...)
+	require.NoError(t, err)
+	return map[string]interface{}{
+		"blockNumber": fmt.Sprintf("0x%x", block),
+		"topics":      []string{event.ID.Hex(), testOwner},
+		"data":        "0x" + hex.EncodeToString(data),
+		"removed":     false,
+	}
+}
+
+// rpcServer serves eth_blockNumber and eth_getLogs for the logs by block
+func rpcServer(t *testing.T, head uint64, logs []map[string]interface{}) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			Method string                   `json:"method"`
+			Params []map[string]interface{} `json:"params"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		var result interface{}
+		switch req.Method {
+		case "eth_blockNumber":
+			result = fmt.Sprintf("0x%x", head)
+		case "eth_getLogs":
+			requests++
+			var from, to uint64
+			fmt.Sscanf(req.Params[0]["fromBlock"].(string), "0x%x", &from)
+			fmt.Sscanf(req.Params[0]["toBlock"].(string), "0x%x", &to)
+			inRange := []map[string]interface{}{}
+			for _, log := range logs {
+				var block uint64
+				fmt.Sscanf(log["blockNumber"].(string), "0x%x", &block)
+				if block >= from && block <= to {
+					inRange = append(inRange, log)
+				}
+			}
+			result = inRange
+		default:
+			t.Fatalf("unexpected method %s", req.Method)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result}))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestValidatorsOf(t *testing.T) {
+	logs := []map[string]interface{}{
+		eventLog(t, "ValidatorAdded", 105, []uint64{1, 2, 3, 4}, testPK(1)),
+		eventLog(t, "ValidatorAdded", 120, []uint64{5, 6, 7, 8}, testPK(2)),
+		eventLog(t, "ValidatorAdded", 130, []uint64{1, 2, 3, 4}, testPK(3)),
+		eventLog(t, "ValidatorRemoved", 145, []uint64{1, 2, 3, 4}, testPK(3)),
+	}
+	server, requests := rpcServer(t, 150, logs)
+
+	chain := NewChain(server.URL, Contract{Address: "0x38A4794cCEd47d3baf7370CcC43B560D3a1beEFA", DeployBlock: 100})
+	chain.BlockRange = 20
+	validators, err := chain.ValidatorsOf(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, 3, *requests)
+
+	require.Len(t, validators, 1)
+	validator := validators[hex.EncodeToString(testPK(1))]
+	require.NotNil(t, validator)
+	require.Equal(t, []types.OperatorID{1, 2, 3, 4}, validator.OperatorIDs)
+	require.Equal(t, "0x"+testOwner[len(testOwner)-40:], validator.Owner)
+}
+
+func TestValidatorsOfRPCError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"query returned more than 10000 results"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewChain(server.URL, Contracts["holesky"]).ValidatorsOf(context.Background(), 1)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "more than 10000 results"))
+}
+
+func TestReconcile(t *testing.T) {
+	committee := []types.OperatorID{1, 2, 3, 4}
+	shares := []*storage.ValidatorShare{
+		{ValidatorPK: testPK(1), Operators: committee, Threshold: 3},
+		{ValidatorPK: testPK(2), Operators: committee, Threshold: 3},
+		{ValidatorPK: testPK(3), Operators: committee, Threshold: 3},
+	}
+	registered := map[string]*Validator{
+		hex.EncodeToString(testPK(1)): {PublicKey: hex.EncodeToString(testPK(1)), OperatorIDs: []types.OperatorID{4, 3, 2, 1}},
+		hex.EncodeToString(testPK(3)): {PublicKey: hex.EncodeToString(testPK(3)), OperatorIDs: []types.OperatorID{1, 2, 3, 5}},
+		hex.EncodeToString(testPK(4)): {PublicKey: hex.EncodeToString(testPK(4)), OperatorIDs: committee},
+		hex.EncodeToString(testPK(5)): {PublicKey: hex.EncodeToString(testPK(5)), OperatorIDs: committee},
+	}
+	handedOver := map[string]bool{hex.EncodeToString(testPK(5)): true}
+
+	report := Reconcile(1, shares, handedOver, registered)
+	require.True(t, report.Drifted())
+	require.Equal(t, []string{hex.EncodeToString(testPK(1))}, report.InSync)
+	require.Equal(t, []string{hex.EncodeToString(testPK(2))}, report.Unregistered)
+	require.Len(t, report.CommitteeMismatch, 1)
+	require.Equal(t, hex.EncodeToString(testPK(3)), report.CommitteeMismatch[0].Validator.PublicKey)
+	require.Equal(t, committee, report.CommitteeMismatch[0].LocalOperatorIDs)
+	require.Len(t, report.Missing, 1)
+	require.Equal(t, hex.EncodeToString(testPK(4)), report.Missing[0].PublicKey)
+	require.Len(t, report.HandedOver, 1)
+	require.Equal(t, hex.EncodeToString(testPK(5)), report.HandedOver[0].PublicKey)
+}
+
+func TestReconcileInSync(t *testing.T) {
+	shares := []*storage.ValidatorShare{{ValidatorPK: testPK(1), Operators: []types.OperatorID{1, 2, 3, 4}, Threshold: 3}}
+	registered := map[string]*Validator{
+		hex.EncodeToString(testPK(1)): {PublicKey: hex.EncodeToString(testPK(1)), OperatorIDs: []types.OperatorID{1, 2, 3, 4}},
+	}
+	handedOver := map[string]bool{hex.EncodeToString(testPK(2)): true}
+
+	report := Reconcile(1, shares, handedOver, registered)
+	require.False(t, report.Drifted())
+	require.Len(t, report.InSync, 1)
+}
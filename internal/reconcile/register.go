@@ -0,0 +1,164 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+)
+
+// DefaultPriorityFee is the tip offered when the rpc can't suggest one, 1.5 gwei
+var DefaultPriorityFee = big.NewInt(1_500_000_000)
+
+// gasMargin is the percentage added on top of the gas estimate, as the
+// cluster the estimate ran against can change before the transaction lands
+const gasMargin = 20
+
+// Registration is the registerValidator call of a validator with its
+// encrypted shares, for the cluster of its operators
+type Registration struct {
+	PublicKey   []byte
+	OperatorIDs []uint64
+	Shares      []byte
+	// Amount of SSV tokens, in wei, deposited to the cluster balance
+	Amount  *big.Int
+	Cluster *Cluster
+}
+
+// Data is the calldata of the registration
+func (r *Registration) Data() ([]byte, error) {
+	amount := r.Amount
+	if amount == nil {
+		amount = big.NewInt(0)
+	}
+	cluster := r.Cluster
+	if cluster == nil {
+		cluster = NewCluster()
+	}
+	data, err := ssvNetwork.Pack("registerValidator", r.PublicKey, r.OperatorIDs, r.Shares, amount, *cluster)
+	if err != nil {
+		return nil, fmt.Errorf("Data: failed to pack registerValidator: %w", err)
+	}
+	return data, nil
+}
+
+// TxOptions overrides what PrepareTx otherwise asks the rpc for
+type TxOptions struct {
+	Nonce       *uint64
+	GasLimit    uint64
+	PriorityFee *big.Int
+}
+
+// ChainID is the chain id of the rpc
+func (c *Chain) ChainID(ctx context.Context) (*big.Int, error) {
+	var chainID hexutil.Big
+	if err := c.call(ctx, "eth_chainId", []interface{}{}, &chainID); err != nil {
+		return nil, err
+	}
+	return chainID.ToInt(), nil
+}
+
+// PrepareTx builds the unsigned transaction calling the contract with data
+// from the sender, with its pending nonce, estimated gas and fees
+func (c *Chain) PrepareTx(ctx context.Context, from common.Address, data []byte, opts TxOptions) (*ethtypes.DynamicFeeTx, error) {
+	to := common.HexToAddress(c.Contract.Address)
+
+	chainID, err := c.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce uint64
+	if opts.Nonce != nil {
+		nonce = *opts.Nonce
+	} else {
+		var pending hexutil.Uint64
+		if err := c.call(ctx, "eth_getTransactionCount", []interface{}{from.Hex(), "pending"}, &pending); err != nil {
+			return nil, err
+		}
+		nonce = uint64(pending)
+	}
+
+	var head struct {
+		BaseFee *hexutil.Big `json:"baseFeePerGas"`
+	}
+	if err := c.call(ctx, "eth_getBlockByNumber", []interface{}{"latest", false}, &head); err != nil {
+		return nil, err
+	}
+	if head.BaseFee == nil {
+		return nil, fmt.Errorf("PrepareTx: the chain of the rpc doesn't support dynamic fee transactions")
+	}
+
+	tip := opts.PriorityFee
+	if tip == nil {
+		var suggested hexutil.Big
+		if err := c.call(ctx, "eth_maxPriorityFeePerGas", []interface{}{}, &suggested); err != nil {
+			tip = DefaultPriorityFee
+		} else {
+			tip = suggested.ToInt()
+		}
+	}
+	// room for the base fee to double before the transaction is stuck
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee.ToInt(), big.NewInt(2)), tip)
+
+	gas := opts.GasLimit
+	if gas == 0 {
+		msg := map[string]interface{}{
+			"from": from.Hex(),
+			"to":   to.Hex(),
+			"data": hexutil.Bytes(data),
+		}
+		var estimate hexutil.Uint64
+		if err := c.call(ctx, "eth_estimateGas", []interface{}{msg}, &estimate); err != nil {
+			return nil, fmt.Errorf("PrepareTx: the contract would revert: %w", err)
+		}
+		gas = uint64(estimate) * (100 + gasMargin) / 100
+	}
+
+	return &ethtypes.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       gas,
+		To:        &to,
+		Data:      data,
+	}, nil
+}
+
+// SendTx broadcasts the signed transaction and returns its hash
+func (c *Chain) SendTx(ctx context.Context, tx *ethtypes.Transaction) (common.Hash, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("SendTx: %w", err)
+	}
+	var hash common.Hash
+	if err := c.call(ctx, "eth_sendRawTransaction", []interface{}{hexutil.Bytes(raw)}, &hash); err != nil {
+		return common.Hash{}, err
+	}
+	return hash, nil
+}
@@ -0,0 +1,165 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package reconcile
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/require"
+)
+
+func clusterLog(t *testing.T, name string, block uint64, operatorIDs []uint64, cluster Cluster) map[string]interface{} {
+	event := ssvNetwork.Events[name]
+	args := []interface{}{operatorIDs}
+	switch name {
+	case "ValidatorAdded":
+		args = append(args, testPK(byte(block)), []byte("shares"))
+	case "ValidatorRemoved":
+		args = append(args, testPK(byte(block)))
+	case "ClusterWithdrawn", "ClusterDeposited":
+		args = append(args, big.NewInt(1))
+	}
+	args = append(args, cluster)
+	data, err := event.Inputs.NonIndexed().Pack(args...)
+	require.NoError(t, err)
+	return map[string]interface{}{
+		"blockNumber": fmt.Sprintf("0x%x", block),
+		"topics":      []string{event.ID.Hex(), testOwner},
+		"data":        "0x" + hex.EncodeToString(data),
+		"removed":     false,
+	}
+}
+
+func TestOwnerState(t *testing.T) {
+	logs := []map[string]interface{}{
+		clusterLog(t, "ValidatorAdded", 105, []uint64{4, 3, 2, 1}, Cluster{ValidatorCount: 1, Index: 7, Active: true, Balance: big.NewInt(10)}),
+		clusterLog(t, "ValidatorAdded", 110, []uint64{5, 6, 7, 8}, Cluster{ValidatorCount: 1, Active: true, Balance: big.NewInt(0)}),
+		clusterLog(t, "ClusterDeposited", 120, []uint64{1, 2, 3, 4}, Cluster{ValidatorCount: 1, Index: 8, Active: true, Balance: big.NewInt(30)}),
+		clusterLog(t, "ValidatorRemoved", 130, []uint64{5, 6, 7, 8}, Cluster{Active: true, Balance: big.NewInt(0)}),
+	}
+	server, _ := rpcServer(t, 150, logs)
+	chain := NewChain(server.URL, Contract{Address: "0x38A4794cCEd47d3baf7370CcC43B560D3a1beEFA", DeployBlock: 100})
+	chain.BlockRange = 20
+
+	state, err := chain.OwnerState(context.Background(), common.HexToAddress(testOwner[len(testOwner)-40:]), []uint64{1, 2, 3, 4})
+	require.NoError(t, err)
+	// removing a validator doesn't give its nonce back
+	require.Equal(t, uint64(2), state.Nonce)
+	require.Equal(t, uint32(1), state.Cluster.ValidatorCount)
+	require.Equal(t, uint64(8), state.Cluster.Index)
+	require.Equal(t, int64(30), state.Cluster.Balance.Int64())
+
+	state, err = chain.OwnerState(context.Background(), common.HexToAddress(testOwner[len(testOwner)-40:]), []uint64{9, 10, 11, 12})
+	require.NoError(t, err)
+	require.Equal(t, NewCluster(), state.Cluster)
+}
+
+func TestRegistrationData(t *testing.T) {
+	registration := &Registration{
+		PublicKey:   testPK(1),
+		OperatorIDs: []uint64{1, 2, 3, 4},
+		Shares:      []byte("shares"),
+		Amount:      big.NewInt(5),
+		Cluster:     &Cluster{ValidatorCount: 2, NetworkFeeIndex: 3, Index: 4, Active: true, Balance: big.NewInt(6)},
+	}
+	data, err := registration.Data()
+	require.NoError(t, err)
+
+	method := ssvNetwork.Methods["registerValidator"]
+	require.Equal(t, method.ID, data[:4])
+	values, err := method.Inputs.Unpack(data[4:])
+	require.NoError(t, err)
+	require.Equal(t, registration.PublicKey, values[0])
+	require.Equal(t, registration.OperatorIDs, values[1])
+	require.Equal(t, registration.Shares, values[2])
+	require.Equal(t, registration.Amount, values[3])
+	require.Equal(t, *registration.Cluster, *abi.ConvertType(values[4], new(Cluster)).(*Cluster))
+}
+
+// txServer answers the calls PrepareTx makes, failing eth_maxPriorityFeePerGas
+// unless a tip is given
+func txServer(t *testing.T, tip string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": 1}
+		switch req.Method {
+		case "eth_chainId":
+			response["result"] = "0x4268"
+		case "eth_getTransactionCount":
+			require.Equal(t, `"pending"`, string(req.Params[1]))
+			response["result"] = "0x7"
+		case "eth_getBlockByNumber":
+			response["result"] = map[string]interface{}{"number": "0x10", "baseFeePerGas": "0x3b9aca00"}
+		case "eth_maxPriorityFeePerGas":
+			if tip == "" {
+				response["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+			} else {
+				response["result"] = tip
+			}
+		case "eth_estimateGas":
+			response["result"] = "0x186a0"
+		default:
+			t.Fatalf("unexpected method %s", req.Method)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPrepareTx(t *testing.T) {
+	from := common.HexToAddress(testOwner[len(testOwner)-40:])
+	chain := NewChain(txServer(t, "0x77359400").URL, Contracts["holesky"])
+
+	tx, err := chain.PrepareTx(context.Background(), from, []byte{1, 2, 3}, TxOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int64(17000), tx.ChainID.Int64())
+	require.Equal(t, uint64(7), tx.Nonce)
+	require.Equal(t, uint64(120000), tx.Gas)
+	require.Equal(t, int64(2_000_000_000), tx.GasTipCap.Int64())
+	require.Equal(t, int64(4_000_000_000), tx.GasFeeCap.Int64())
+	require.Equal(t, common.HexToAddress(Contracts["holesky"].Address), *tx.To)
+	require.Equal(t, hexutil.Bytes{1, 2, 3}, hexutil.Bytes(tx.Data))
+
+	nonce := uint64(9)
+	chain = NewChain(txServer(t, "").URL, Contracts["holesky"])
+	tx, err = chain.PrepareTx(context.Background(), from, nil, TxOptions{Nonce: &nonce, GasLimit: 50000})
+	require.NoError(t, err)
+	require.Equal(t, uint64(9), tx.Nonce)
+	require.Equal(t, uint64(50000), tx.Gas)
+	require.Equal(t, DefaultPriorityFee, tx.GasTipCap)
+}
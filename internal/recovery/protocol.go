@@ -0,0 +1,380 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package recovery
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+)
+
+// Committee is the public part of a keygen output, every helper sends its
+// view so the recovering operator only accepts a share all of them agree on
+type Committee struct {
+	ValidatorPK     string                      `json:"validator_pk"`
+	Threshold       uint64                      `json:"threshold"`
+	OperatorPubKeys map[types.OperatorID]string `json:"operator_pub_keys"`
+}
+
+func CommitteeOf(output *dkg.KeyGenOutput) *Committee {
+	c := &Committee{
+		ValidatorPK:     hex.EncodeToString(output.ValidatorPK),
+		Threshold:       output.Threshold,
+		OperatorPubKeys: make(map[types.OperatorID]string),
+	}
+	for id, pk := range output.OperatorPubKeys {
+		c.OperatorPubKeys[id] = pk.SerializeToHexStr()
+	}
+	return c
+}
+
+func (c *Committee) has(operatorID types.OperatorID) bool {
+	_, ok := c.OperatorPubKeys[operatorID]
+	return ok
+}
+
+func (c *Committee) Equal(other *Committee) bool {
+	if other == nil || c.ValidatorPK != other.ValidatorPK || c.Threshold != other.Threshold || len(c.OperatorPubKeys) != len(other.OperatorPubKeys) {
+		return false
+	}
+	for id, pk := range c.OperatorPubKeys {
+		if other.OperatorPubKeys[id] != pk {
+			return false
+		}
+	}
+	return true
+}
+
+// Split is the weighted share of one helper cut into a summand for every
+// helper, each encrypted to that helper's operator key
+type Split struct {
+	RequestID string                                    `json:"request_id"`
+	From      types.OperatorID                          `json:"from"`
+	Committee *Committee                                `json:"committee"`
+	Parts     map[types.OperatorID]*encryption.Envelope `json:"parts"`
+	Signature []byte                                    `json:"signature,omitempty"`
+}
+
+func (s *Split) Root() ([]byte, error) {
+	unsigned := *s
+	unsigned.Signature = nil
+	return signingRoot(&unsigned)
+}
+
+// Contribution is the sum of the summands a helper received, encrypted to
+// the recovering operator
+type Contribution struct {
+	RequestID string               `json:"request_id"`
+	From      types.OperatorID     `json:"from"`
+	Committee *Committee           `json:"committee"`
+	Share     *encryption.Envelope `json:"share"`
+	Signature []byte               `json:"signature,omitempty"`
+}
+
+func (c *Contribution) Root() ([]byte, error) {
+	unsigned := *c
+	unsigned.Signature = nil
+	return signingRoot(&unsigned)
+}
+
+func signingRoot(v any) ([]byte, error) {
+	byts, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(append(append([]byte{}, label...), byts...))
+	return h[:], nil
+}
+
+// NewSplit is the first step of helper self: it weighs its share with its
+// lagrange coefficient for the recovering operator and splits it up
+func NewSplit(b *Bundle, self types.OperatorID, sk *rsa.PrivateKey, output *dkg.KeyGenOutput, keys KeyLookup) (*Split, error) {
+	r := b.Request
+	committee := CommitteeOf(output)
+	if err := b.Check(committee, keys); err != nil {
+		return nil, err
+	}
+	if !r.isHelper(self) {
+		return nil, fmt.Errorf("operator %d isn't a helper of request %s", self, r.ID)
+	}
+
+	lambda, err := lagrange(r.Helpers, self, r.Operator)
+	if err != nil {
+		return nil, err
+	}
+	weighted := new(bls.Fr)
+	bls.FrMul(weighted, bls.CastFromSecretKey(output.Share), lambda)
+
+	split := &Split{
+		RequestID: r.ID,
+		From:      self,
+		Committee: committee,
+		Parts:     make(map[types.OperatorID]*encryption.Envelope),
+	}
+	for i, helper := range r.Helpers {
+		part := new(bls.Fr)
+		if i == len(r.Helpers)-1 {
+			*part = *weighted
+		} else {
+			part.SetByCSPRNG()
+			bls.FrSub(weighted, weighted, part)
+		}
+		pk, err := keys(helper)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key of helper %d: %w", helper, err)
+		}
+		if split.Parts[helper], err = encryption.SealRSA(pk, part.Serialize(), partLabel(r.ID, self, helper)); err != nil {
+			return nil, fmt.Errorf("failed to encrypt part for helper %d: %w", helper, err)
+		}
+	}
+
+	root, err := split.Root()
+	if err != nil {
+		return nil, err
+	}
+	if split.Signature, err = types.Sign(sk, root); err != nil {
+		return nil, err
+	}
+	return split, nil
+}
+
+// Combine is the second step of helper self: it adds up the parts every
+// helper split for it and encrypts the sum to the recovering operator
+func Combine(b *Bundle, self types.OperatorID, sk *rsa.PrivateKey, output *dkg.KeyGenOutput, splits []*Split, keys KeyLookup) (*Contribution, error) {
+	r := b.Request
+	committee := CommitteeOf(output)
+	if err := b.Check(committee, keys); err != nil {
+		return nil, err
+	}
+	if !r.isHelper(self) {
+		return nil, fmt.Errorf("operator %d isn't a helper of request %s", self, r.ID)
+	}
+
+	msgs := make([]signed, 0, len(splits))
+	for _, split := range splits {
+		msgs = append(msgs, split)
+	}
+	bySender, err := collect(r, msgs, committee, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := new(bls.Fr)
+	for _, helper := range r.Helpers {
+		envelope, ok := bySender[helper].(*Split).Parts[self]
+		if !ok {
+			return nil, fmt.Errorf("split of helper %d has no part for %d", helper, self)
+		}
+		plaintext, err := encryption.OpenRSA(sk, envelope, partLabel(r.ID, helper, self))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt part of helper %d: %w", helper, err)
+		}
+		part := new(bls.Fr)
+		if err := part.Deserialize(plaintext); err != nil {
+			return nil, fmt.Errorf("invalid part of helper %d: %w", helper, err)
+		}
+		bls.FrAdd(sum, sum, part)
+	}
+
+	pk, err := keys(r.Operator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key of operator %d: %w", r.Operator, err)
+	}
+	envelope, err := encryption.SealRSA(pk, sum.Serialize(), contributionLabel(r.ID, self))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt contribution: %w", err)
+	}
+	contribution := &Contribution{RequestID: r.ID, From: self, Committee: committee, Share: envelope}
+	root, err := contribution.Root()
+	if err != nil {
+		return nil, err
+	}
+	if contribution.Signature, err = types.Sign(sk, root); err != nil {
+		return nil, err
+	}
+	return contribution, nil
+}
+
+// Recover is run by the recovering operator: it adds up the contributions of
+// every helper and checks the result against its share public key in the
+// committee all helpers agree on
+func Recover(b *Bundle, sk *rsa.PrivateKey, contributions []*Contribution, keys KeyLookup) (*dkg.KeyGenOutput, error) {
+	r := b.Request
+	if r == nil || len(contributions) == 0 {
+		return nil, fmt.Errorf("nothing to recover")
+	}
+	committee := contributions[0].Committee
+	if committee == nil {
+		return nil, fmt.Errorf("contribution of helper %d has no committee", contributions[0].From)
+	}
+	if err := b.Check(committee, keys); err != nil {
+		return nil, err
+	}
+
+	msgs := make([]signed, 0, len(contributions))
+	for _, contribution := range contributions {
+		msgs = append(msgs, contribution)
+	}
+	bySender, err := collect(r, msgs, committee, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	share := new(bls.Fr)
+	for _, helper := range r.Helpers {
+		plaintext, err := encryption.OpenRSA(sk, bySender[helper].(*Contribution).Share, contributionLabel(r.ID, helper))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt contribution of helper %d: %w", helper, err)
+		}
+		part := new(bls.Fr)
+		if err := part.Deserialize(plaintext); err != nil {
+			return nil, fmt.Errorf("invalid contribution of helper %d: %w", helper, err)
+		}
+		bls.FrAdd(share, share, part)
+	}
+
+	output := &dkg.KeyGenOutput{
+		Share:           bls.CastToSecretKey(share),
+		Threshold:       committee.Threshold,
+		OperatorPubKeys: make(map[types.OperatorID]*bls.PublicKey),
+	}
+	if output.ValidatorPK, err = hex.DecodeString(committee.ValidatorPK); err != nil {
+		return nil, fmt.Errorf("invalid validator pk: %w", err)
+	}
+	for id, encoded := range committee.OperatorPubKeys {
+		pk := new(bls.PublicKey)
+		if err := pk.DeserializeHexStr(encoded); err != nil {
+			return nil, fmt.Errorf("invalid share public key of operator %d: %w", id, err)
+		}
+		output.OperatorPubKeys[id] = pk
+	}
+	if !output.Share.GetPublicKey().IsEqual(output.OperatorPubKeys[r.Operator]) {
+		return nil, fmt.Errorf("recovered share doesn't match the share public key of operator %d", r.Operator)
+	}
+	return output, nil
+}
+
+// signed is a split or contribution sent by a helper
+type signed interface {
+	header() (from types.OperatorID, requestID string, committee *Committee, signature []byte)
+	Root() ([]byte, error)
+}
+
+func (s *Split) header() (types.OperatorID, string, *Committee, []byte) {
+	return s.From, s.RequestID, s.Committee, s.Signature
+}
+
+func (c *Contribution) header() (types.OperatorID, string, *Committee, []byte) {
+	return c.From, c.RequestID, c.Committee, c.Signature
+}
+
+// collect checks there is exactly one signed message per helper for the
+// request, all carrying the same committee
+func collect(r *Request, msgs []signed, committee *Committee, keys KeyLookup) (map[types.OperatorID]signed, error) {
+	bySender := make(map[types.OperatorID]signed)
+	for _, msg := range msgs {
+		from, requestID, msgCommittee, signature := msg.header()
+		if requestID != r.ID {
+			return nil, fmt.Errorf("message of operator %d is for request %s", from, requestID)
+		}
+		if !r.isHelper(from) {
+			return nil, fmt.Errorf("operator %d isn't a helper of request %s", from, r.ID)
+		}
+		if _, ok := bySender[from]; ok {
+			return nil, fmt.Errorf("helper %d sent more than one message", from)
+		}
+		if !committee.Equal(msgCommittee) {
+			return nil, fmt.Errorf("helper %d sees a different committee for validator %s", from, r.ValidatorPK)
+		}
+		pk, err := keys(from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key of helper %d: %w", from, err)
+		}
+		msgRoot, err := msg.Root()
+		if err != nil {
+			return nil, err
+		}
+		if !types.Verify(pk, msgRoot, signature) {
+			return nil, fmt.Errorf("invalid signature of helper %d", from)
+		}
+		bySender[from] = msg
+	}
+	missing := []types.OperatorID{}
+	for _, helper := range r.Helpers {
+		if _, ok := bySender[helper]; !ok {
+			missing = append(missing, helper)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+		return nil, fmt.Errorf("missing messages of helpers %v", missing)
+	}
+	return bySender, nil
+}
+
+// lagrange is the coefficient of the share of i when interpolating the
+// polynomial of the helpers at x
+func lagrange(helpers []types.OperatorID, i, x types.OperatorID) (*bls.Fr, error) {
+	num, den := new(bls.Fr), new(bls.Fr)
+	num.SetInt64(1)
+	den.SetInt64(1)
+	xi, xx := frOf(i), frOf(x)
+	for _, k := range helpers {
+		if k == i {
+			continue
+		}
+		xk := frOf(k)
+		diff := new(bls.Fr)
+		bls.FrSub(diff, xx, xk)
+		bls.FrMul(num, num, diff)
+		bls.FrSub(diff, xi, xk)
+		bls.FrMul(den, den, diff)
+	}
+	if den.IsZero() {
+		return nil, fmt.Errorf("helpers aren't distinct")
+	}
+	lambda := new(bls.Fr)
+	bls.FrDiv(lambda, num, den)
+	return lambda, nil
+}
+
+func frOf(operatorID types.OperatorID) *bls.Fr {
+	fr := new(bls.Fr)
+	fr.SetInt64(int64(operatorID))
+	return fr
+}
+
+func partLabel(requestID string, from, to types.OperatorID) []byte {
+	return []byte(fmt.Sprintf("%s/%s/part/%d/%d", label, requestID, from, to))
+}
+
+func contributionLabel(requestID string, from types.OperatorID) []byte {
+	return []byte(fmt.Sprintf("%s/%s/contribution/%d", label, requestID, from))
+}
@@ -0,0 +1,209 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package recovery rebuilds the share of an operator that lost its storage
+// from threshold many peers of its committee, without a reshare and without
+// any party but the recovering operator learning the share.
+//
+// Every helper i weighs its share with its lagrange coefficient for the
+// recovering operator j and splits the result into random summands, one per
+// helper, encrypted to that helper's operator key. Each helper adds up the
+// summands it received and encrypts the sum to operator j, who adds up the
+// sums to f(j). A helper only sees random summands of the others, the
+// recovering operator only sees sums of them.
+package recovery
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+var label = []byte("rockx-dkg-share-recovery")
+
+// MaxRequestAge is how long an approved request can be run
+const MaxRequestAge = 24 * time.Hour
+
+var ErrNotApproved = errors.New("recovery request not approved by the committee")
+
+// KeyLookup returns the registry key of an operator
+type KeyLookup func(types.OperatorID) (*rsa.PublicKey, error)
+
+// Request asks the helpers to recover the share of Operator for a validator
+type Request struct {
+	ID          string             `json:"id"`
+	ValidatorPK string             `json:"validator_pk"`
+	Operator    types.OperatorID   `json:"operator"`
+	Helpers     []types.OperatorID `json:"helpers"`
+	CreatedAt   int64              `json:"created_at"`
+}
+
+func NewRequest(validatorPK string, operator types.OperatorID, helpers []types.OperatorID) (*Request, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	r := &Request{
+		ID:          hex.EncodeToString(id),
+		ValidatorPK: validatorPK,
+		Operator:    operator,
+		Helpers:     append([]types.OperatorID{}, helpers...),
+		CreatedAt:   time.Now().Unix(),
+	}
+	sort.Slice(r.Helpers, func(i, j int) bool { return r.Helpers[i] < r.Helpers[j] })
+	return r, r.validate()
+}
+
+func (r *Request) validate() error {
+	if _, err := hex.DecodeString(r.ValidatorPK); err != nil || r.ValidatorPK == "" {
+		return fmt.Errorf("invalid validator pk %q", r.ValidatorPK)
+	}
+	if len(r.Helpers) == 0 {
+		return fmt.Errorf("recovery needs helpers")
+	}
+	seen := make(map[types.OperatorID]bool)
+	for _, helper := range r.Helpers {
+		if helper == r.Operator {
+			return fmt.Errorf("operator %d can't help recover its own share", helper)
+		}
+		if seen[helper] {
+			return fmt.Errorf("helper %d listed twice", helper)
+		}
+		seen[helper] = true
+	}
+	return nil
+}
+
+func (r *Request) Root() ([]byte, error) {
+	byts, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(append(append([]byte{}, label...), byts...))
+	return h[:], nil
+}
+
+func (r *Request) isHelper(operatorID types.OperatorID) bool {
+	for _, helper := range r.Helpers {
+		if helper == operatorID {
+			return true
+		}
+	}
+	return false
+}
+
+// Approval is the signature of a committee operator over a request
+type Approval struct {
+	OperatorID types.OperatorID `json:"operator_id"`
+	Signature  []byte           `json:"signature"`
+}
+
+func Approve(sk *rsa.PrivateKey, operatorID types.OperatorID, r *Request) (*Approval, error) {
+	root, err := r.Root()
+	if err != nil {
+		return nil, err
+	}
+	signature, err := types.Sign(sk, root)
+	if err != nil {
+		return nil, err
+	}
+	return &Approval{OperatorID: operatorID, Signature: signature}, nil
+}
+
+// Bundle is a request with the approvals collected for it
+type Bundle struct {
+	Request   *Request    `json:"request"`
+	Approvals []*Approval `json:"approvals"`
+}
+
+// Approvers returns the operators with an approval in the bundle, unchecked
+func (b *Bundle) Approvers() []types.OperatorID {
+	ids := make([]types.OperatorID, 0, len(b.Approvals))
+	for _, a := range b.Approvals {
+		ids = append(ids, a.OperatorID)
+	}
+	return ids
+}
+
+// Check verifies the request can run against the committee: it isn't expired,
+// operator and helpers are in the committee, there are enough helpers to
+// interpolate, and both the recovering operator and threshold many other
+// committee operators approved it.
+func (b *Bundle) Check(committee *Committee, keys KeyLookup) error {
+	r := b.Request
+	if r == nil {
+		return fmt.Errorf("bundle has no request")
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	if age := time.Since(time.Unix(r.CreatedAt, 0)); age > MaxRequestAge {
+		return fmt.Errorf("request %s expired %s ago", r.ID, (age - MaxRequestAge).Round(time.Second))
+	}
+	if r.ValidatorPK != committee.ValidatorPK {
+		return fmt.Errorf("request is for validator %s, committee for %s", r.ValidatorPK, committee.ValidatorPK)
+	}
+	if !committee.has(r.Operator) {
+		return fmt.Errorf("operator %d isn't in the committee of validator %s", r.Operator, r.ValidatorPK)
+	}
+	for _, helper := range r.Helpers {
+		if !committee.has(helper) {
+			return fmt.Errorf("helper %d isn't in the committee of validator %s", helper, r.ValidatorPK)
+		}
+	}
+	if uint64(len(r.Helpers)) < committee.Threshold {
+		return fmt.Errorf("%d helpers can't recover a share of a threshold %d committee", len(r.Helpers), committee.Threshold)
+	}
+
+	root, err := r.Root()
+	if err != nil {
+		return err
+	}
+	approved := make(map[types.OperatorID]bool)
+	for _, a := range b.Approvals {
+		if !committee.has(a.OperatorID) || approved[a.OperatorID] {
+			continue
+		}
+		pk, err := keys(a.OperatorID)
+		if err != nil {
+			return fmt.Errorf("failed to get key of operator %d: %w", a.OperatorID, err)
+		}
+		if !types.Verify(pk, root, a.Signature) {
+			return fmt.Errorf("invalid approval of operator %d", a.OperatorID)
+		}
+		approved[a.OperatorID] = true
+	}
+	if !approved[r.Operator] {
+		return fmt.Errorf("%w: missing approval of the recovering operator %d", ErrNotApproved, r.Operator)
+	}
+	if others := uint64(len(approved) - 1); others < committee.Threshold {
+		return fmt.Errorf("%w: %d of %d committee approvals", ErrNotApproved, others, committee.Threshold)
+	}
+	return nil
+}
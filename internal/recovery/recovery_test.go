@@ -0,0 +1,194 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package recovery
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+type testCommittee struct {
+	outputs map[types.OperatorID]*dkg.KeyGenOutput
+	sks     map[types.OperatorID]*rsa.PrivateKey
+}
+
+// newTestCommittee shares a random validator key between operators 1..n
+func newTestCommittee(t *testing.T, n, threshold int) *testCommittee {
+	types.InitBLS()
+	coefficients := make([]*bls.Fr, threshold)
+	for i := range coefficients {
+		coefficients[i] = new(bls.Fr)
+		coefficients[i].SetByCSPRNG()
+	}
+	eval := func(x types.OperatorID) *bls.Fr {
+		y := new(bls.Fr)
+		for i := len(coefficients) - 1; i >= 0; i-- {
+			bls.FrMul(y, y, frOf(x))
+			bls.FrAdd(y, y, coefficients[i])
+		}
+		return y
+	}
+
+	tc := &testCommittee{
+		outputs: make(map[types.OperatorID]*dkg.KeyGenOutput),
+		sks:     make(map[types.OperatorID]*rsa.PrivateKey),
+	}
+	pubKeys := make(map[types.OperatorID]*bls.PublicKey)
+	for i := 1; i <= n; i++ {
+		id := types.OperatorID(i)
+		pubKeys[id] = bls.CastToSecretKey(eval(id)).GetPublicKey()
+		sk, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		tc.sks[id] = sk
+	}
+	validatorPK := bls.CastToSecretKey(coefficients[0]).GetPublicKey().Serialize()
+	for i := 1; i <= n; i++ {
+		id := types.OperatorID(i)
+		tc.outputs[id] = &dkg.KeyGenOutput{
+			Share:           bls.CastToSecretKey(eval(id)),
+			ValidatorPK:     validatorPK,
+			OperatorPubKeys: pubKeys,
+			Threshold:       uint64(threshold),
+		}
+	}
+	return tc
+}
+
+func (tc *testCommittee) keys(operatorID types.OperatorID) (*rsa.PublicKey, error) {
+	sk, ok := tc.sks[operatorID]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator %d", operatorID)
+	}
+	return &sk.PublicKey, nil
+}
+
+func (tc *testCommittee) bundle(t *testing.T, operator types.OperatorID, helpers []types.OperatorID, approvers ...types.OperatorID) *Bundle {
+	r, err := NewRequest(hex.EncodeToString(tc.outputs[operator].ValidatorPK), operator, helpers)
+	require.NoError(t, err)
+	b := &Bundle{Request: r}
+	for _, id := range approvers {
+		a, err := Approve(tc.sks[id], id, r)
+		require.NoError(t, err)
+		b.Approvals = append(b.Approvals, a)
+	}
+	return b
+}
+
+func (tc *testCommittee) run(t *testing.T, b *Bundle) (*dkg.KeyGenOutput, error) {
+	splits := []*Split{}
+	for _, helper := range b.Request.Helpers {
+		split, err := NewSplit(b, helper, tc.sks[helper], tc.outputs[helper], tc.keys)
+		if err != nil {
+			return nil, err
+		}
+		splits = append(splits, split)
+	}
+	contributions := []*Contribution{}
+	for _, helper := range b.Request.Helpers {
+		contribution, err := Combine(b, helper, tc.sks[helper], tc.outputs[helper], splits, tc.keys)
+		if err != nil {
+			return nil, err
+		}
+		contributions = append(contributions, contribution)
+	}
+	return Recover(b, tc.sks[b.Request.Operator], contributions, tc.keys)
+}
+
+func TestRecover(t *testing.T) {
+	tc := newTestCommittee(t, 4, 3)
+	b := tc.bundle(t, 2, []types.OperatorID{4, 1, 3}, 2, 1, 3, 4)
+
+	output, err := tc.run(t, b)
+	require.NoError(t, err)
+	require.True(t, output.Share.IsEqual(tc.outputs[2].Share))
+	require.Equal(t, tc.outputs[2].ValidatorPK, output.ValidatorPK)
+	require.EqualValues(t, 3, output.Threshold)
+	require.Len(t, output.OperatorPubKeys, 4)
+}
+
+func TestRecoverNeedsApprovals(t *testing.T) {
+	tc := newTestCommittee(t, 4, 3)
+
+	// the recovering operator has to approve
+	_, err := tc.run(t, tc.bundle(t, 2, []types.OperatorID{1, 3, 4}, 1, 3, 4))
+	require.ErrorIs(t, err, ErrNotApproved)
+
+	// and threshold many others
+	_, err = tc.run(t, tc.bundle(t, 2, []types.OperatorID{1, 3, 4}, 2, 1, 3))
+	require.ErrorIs(t, err, ErrNotApproved)
+
+	// approvals of the wrong request don't count
+	b := tc.bundle(t, 2, []types.OperatorID{1, 3, 4}, 2, 1, 3, 4)
+	b.Request.Helpers = []types.OperatorID{1, 3}
+	_, err = tc.run(t, b)
+	require.Error(t, err)
+}
+
+func TestRecoverChecksRequest(t *testing.T) {
+	tc := newTestCommittee(t, 4, 3)
+
+	_, err := NewRequest(hex.EncodeToString(tc.outputs[1].ValidatorPK), 2, []types.OperatorID{1, 2, 3})
+	require.Error(t, err)
+
+	b := tc.bundle(t, 2, []types.OperatorID{1, 3}, 2, 1, 3, 4)
+	_, err = tc.run(t, b)
+	require.ErrorContains(t, err, "2 helpers")
+
+	b = tc.bundle(t, 2, []types.OperatorID{1, 3, 5}, 2, 1, 3, 4)
+	_, err = tc.run(t, b)
+	require.ErrorContains(t, err, "helper 5 isn't in the committee")
+
+	b = tc.bundle(t, 2, []types.OperatorID{1, 3, 4}, 2, 1, 3, 4)
+	b.Request.CreatedAt = time.Now().Add(-2 * MaxRequestAge).Unix()
+	_, err = tc.run(t, b)
+	require.ErrorContains(t, err, "expired")
+}
+
+func TestRecoverRejectsForeignCommittee(t *testing.T) {
+	tc := newTestCommittee(t, 4, 3)
+	b := tc.bundle(t, 2, []types.OperatorID{1, 3, 4}, 2, 1, 3, 4)
+
+	splits := []*Split{}
+	for _, helper := range b.Request.Helpers {
+		split, err := NewSplit(b, helper, tc.sks[helper], tc.outputs[helper], tc.keys)
+		require.NoError(t, err)
+		splits = append(splits, split)
+	}
+
+	// a split for a different committee is refused
+	splits[0].Committee = &Committee{ValidatorPK: splits[0].Committee.ValidatorPK}
+	_, err := Combine(b, 3, tc.sks[3], tc.outputs[3], splits, tc.keys)
+	require.ErrorContains(t, err, "different committee")
+
+	// a missing split stops the helper from combining
+	_, err = Combine(b, 3, tc.sks[3], tc.outputs[3], splits[1:], tc.keys)
+	require.ErrorContains(t, err, "missing messages of helpers [1]")
+}
@@ -0,0 +1,162 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package reshareplan assigns validators to new committees for a batch of
+// resharings, spreading the validators evenly over a pool of operators while
+// keeping each committee diverse in region and network.
+package reshareplan
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+var ErrUnsatisfiable = errors.New("constraints can't be met")
+
+// Validator is a validator to reshare with its current committee
+type Validator struct {
+	ValidatorPK  string             `json:"validator_pk"`
+	OldOperators []types.OperatorID `json:"operators_old"`
+}
+
+// Operator is an operator of the target pool with where its node runs, an
+// empty region or a zero asn is unknown and never counts against a limit
+type Operator struct {
+	ID     types.OperatorID
+	Region string
+	ASN    uint32
+}
+
+type Constraints struct {
+	CommitteeSize int
+	// MaxPerOperator is how many validators an operator takes at most
+	MaxPerOperator int
+	// MaxPerRegion and MaxPerASN are how many members of one committee may
+	// share a region or a network
+	MaxPerRegion int
+	MaxPerASN    int
+}
+
+// Assignment is the new committee of a validator
+type Assignment struct {
+	ValidatorPK  string             `json:"validator_pk"`
+	OldOperators []types.OperatorID `json:"operators_old"`
+	Operators    []types.OperatorID `json:"operators"`
+}
+
+type Plan struct {
+	Assignments []*Assignment `json:"assignments"`
+	// Load is how many validators each operator of the pool takes
+	Load map[types.OperatorID]int `json:"load"`
+}
+
+// Build assigns the validators in order, each committee takes the least
+// loaded operators that keep it within the limits, so the plan is the same
+// for the same input
+func Build(validators []Validator, pool []Operator, constraints Constraints) (*Plan, error) {
+	if constraints.CommitteeSize <= 0 {
+		return nil, fmt.Errorf("committee size must be positive")
+	}
+	if constraints.CommitteeSize > len(pool) {
+		return nil, fmt.Errorf("%w: committee of %d from a pool of %d operators", ErrUnsatisfiable, constraints.CommitteeSize, len(pool))
+	}
+	if constraints.MaxPerOperator > 0 && constraints.MaxPerOperator*len(pool) < constraints.CommitteeSize*len(validators) {
+		return nil, fmt.Errorf("%w: %d operators taking at most %d validators can't fill %d committees of %d", ErrUnsatisfiable, len(pool), constraints.MaxPerOperator, len(validators), constraints.CommitteeSize)
+	}
+
+	operators := make(map[types.OperatorID]Operator, len(pool))
+	for _, operator := range pool {
+		if _, ok := operators[operator.ID]; ok {
+			return nil, fmt.Errorf("operator %d is in the pool twice", operator.ID)
+		}
+		operators[operator.ID] = operator
+	}
+
+	plan := &Plan{Load: make(map[types.OperatorID]int, len(pool))}
+	for _, operator := range pool {
+		plan.Load[operator.ID] = 0
+	}
+	seen := make(map[string]bool, len(validators))
+	for _, validator := range validators {
+		if seen[validator.ValidatorPK] {
+			return nil, fmt.Errorf("validator %s is in the batch twice", validator.ValidatorPK)
+		}
+		seen[validator.ValidatorPK] = true
+
+		committee, err := pick(pool, plan.Load, constraints)
+		if err != nil {
+			return nil, fmt.Errorf("validator %s: %w", validator.ValidatorPK, err)
+		}
+		for _, operatorID := range committee {
+			plan.Load[operatorID]++
+		}
+		plan.Assignments = append(plan.Assignments, &Assignment{
+			ValidatorPK:  validator.ValidatorPK,
+			OldOperators: validator.OldOperators,
+			Operators:    committee,
+		})
+	}
+	return plan, nil
+}
+
+func pick(pool []Operator, load map[types.OperatorID]int, constraints Constraints) ([]types.OperatorID, error) {
+	candidates := make([]Operator, len(pool))
+	copy(candidates, pool)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if load[candidates[i].ID] != load[candidates[j].ID] {
+			return load[candidates[i].ID] < load[candidates[j].ID]
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+
+	regions := make(map[string]int)
+	asns := make(map[uint32]int)
+	committee := make([]types.OperatorID, 0, constraints.CommitteeSize)
+	for _, operator := range candidates {
+		if len(committee) == constraints.CommitteeSize {
+			break
+		}
+		if constraints.MaxPerOperator > 0 && load[operator.ID] >= constraints.MaxPerOperator {
+			continue
+		}
+		if constraints.MaxPerRegion > 0 && operator.Region != "" && regions[operator.Region] >= constraints.MaxPerRegion {
+			continue
+		}
+		if constraints.MaxPerASN > 0 && operator.ASN != 0 && asns[operator.ASN] >= constraints.MaxPerASN {
+			continue
+		}
+		committee = append(committee, operator.ID)
+		if operator.Region != "" {
+			regions[operator.Region]++
+		}
+		if operator.ASN != 0 {
+			asns[operator.ASN]++
+		}
+	}
+	if len(committee) < constraints.CommitteeSize {
+		return nil, fmt.Errorf("%w: found %d of %d operators for the committee", ErrUnsatisfiable, len(committee), constraints.CommitteeSize)
+	}
+	sort.Slice(committee, func(i, j int) bool { return committee[i] < committee[j] })
+	return committee, nil
+}
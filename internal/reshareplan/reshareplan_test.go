@@ -0,0 +1,107 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package reshareplan
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func validators(n int) []Validator {
+	out := make([]Validator, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, Validator{ValidatorPK: fmt.Sprintf("%096x", i), OldOperators: []types.OperatorID{1, 2, 3, 4}})
+	}
+	return out
+}
+
+func pool(regions ...string) []Operator {
+	out := make([]Operator, 0, len(regions))
+	for i, region := range regions {
+		out = append(out, Operator{ID: types.OperatorID(i + 1), Region: region})
+	}
+	return out
+}
+
+func TestBuildBalancesLoad(t *testing.T) {
+	plan, err := Build(validators(6), pool("", "", "", "", "", "", "", ""), Constraints{CommitteeSize: 4})
+	require.NoError(t, err)
+	require.Len(t, plan.Assignments, 6)
+	for operatorID, load := range plan.Load {
+		require.Equal(t, 3, load, "operator %d", operatorID)
+	}
+	require.Equal(t, []types.OperatorID{1, 2, 3, 4}, plan.Assignments[0].Operators)
+	require.Equal(t, []types.OperatorID{5, 6, 7, 8}, plan.Assignments[1].Operators)
+	require.Equal(t, []types.OperatorID{1, 2, 3, 4}, plan.Assignments[0].OldOperators)
+
+	again, err := Build(validators(6), pool("", "", "", "", "", "", "", ""), Constraints{CommitteeSize: 4})
+	require.NoError(t, err)
+	require.Equal(t, plan, again)
+}
+
+func TestBuildMaxPerOperator(t *testing.T) {
+	_, err := Build(validators(5), pool("", "", "", "", "", ""), Constraints{CommitteeSize: 4, MaxPerOperator: 3})
+	require.ErrorIs(t, err, ErrUnsatisfiable)
+
+	plan, err := Build(validators(4), pool("", "", "", "", "", ""), Constraints{CommitteeSize: 4, MaxPerOperator: 3})
+	require.NoError(t, err)
+	for _, load := range plan.Load {
+		require.LessOrEqual(t, load, 3)
+	}
+}
+
+func TestBuildRegionDiversity(t *testing.T) {
+	operators := pool("eu", "eu", "eu", "eu", "us", "us", "us", "us")
+	plan, err := Build(validators(4), operators, Constraints{CommitteeSize: 4, MaxPerRegion: 2})
+	require.NoError(t, err)
+	for _, assignment := range plan.Assignments {
+		regions := make(map[string]int)
+		for _, operatorID := range assignment.Operators {
+			regions[operators[operatorID-1].Region]++
+		}
+		require.Equal(t, map[string]int{"eu": 2, "us": 2}, regions)
+	}
+
+	_, err = Build(validators(1), operators, Constraints{CommitteeSize: 4, MaxPerRegion: 1})
+	require.ErrorIs(t, err, ErrUnsatisfiable)
+}
+
+func TestBuildASNDiversity(t *testing.T) {
+	operators := []Operator{{ID: 1, ASN: 16509}, {ID: 2, ASN: 16509}, {ID: 3, ASN: 24940}, {ID: 4}, {ID: 5}}
+	plan, err := Build(validators(1), operators, Constraints{CommitteeSize: 4, MaxPerASN: 1})
+	require.NoError(t, err)
+	require.Equal(t, []types.OperatorID{1, 3, 4, 5}, plan.Assignments[0].Operators)
+}
+
+func TestBuildRejectsDuplicates(t *testing.T) {
+	_, err := Build(append(validators(1), validators(1)...), pool("", "", "", ""), Constraints{CommitteeSize: 4})
+	require.Error(t, err)
+
+	_, err = Build(validators(1), []Operator{{ID: 1}, {ID: 1}, {ID: 2}, {ID: 3}}, Constraints{CommitteeSize: 4})
+	require.Error(t, err)
+
+	_, err = Build(validators(1), pool("", ""), Constraints{CommitteeSize: 4})
+	require.ErrorIs(t, err, ErrUnsatisfiable)
+}
@@ -0,0 +1,145 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package resolver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultDoHTimeout bounds a DNS-over-HTTPS query
+const DefaultDoHTimeout = 5 * time.Second
+
+// Config selects how the host names of outbound connections are resolved
+type Config struct {
+	// Hosts are static addresses of host names, used instead of any lookup
+	Hosts map[string][]net.IP
+	// DoH is the url of a DNS-over-HTTPS resolver (RFC 8484) asked for every
+	// other name instead of the system resolver, e.g. https://1.1.1.1/dns-query
+	DoH string
+	// DoHTimeout bounds a DNS-over-HTTPS query
+	DoHTimeout time.Duration
+}
+
+// Enabled reports whether the config changes anything over the system resolver
+func (c Config) Enabled() bool {
+	return len(c.Hosts) > 0 || c.DoH != ""
+}
+
+// ConfigFromEnv reads the resolution settings from the environment variables
+// starting with prefix:
+//
+//	_HOSTS        static host addresses, comma separated name=ip pairs, a name
+//	              with several addresses is listed once for each
+//	_HOSTS_FILE   static host addresses in the format of /etc/hosts
+//	_DOH_URL      DNS-over-HTTPS resolver for the other names
+//	_DOH_TIMEOUT  timeout of a DNS-over-HTTPS query, default 5s
+func ConfigFromEnv(prefix string) (Config, error) {
+	config := Config{
+		Hosts:      make(map[string][]net.IP),
+		DoH:        strings.TrimSpace(os.Getenv(prefix + "_DOH_URL")),
+		DoHTimeout: DefaultDoHTimeout,
+	}
+	if path := os.Getenv(prefix + "_HOSTS_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to open %s_HOSTS_FILE: %w", prefix, err)
+		}
+		defer file.Close()
+		if err := config.readHostsFile(file); err != nil {
+			return config, fmt.Errorf("invalid %s_HOSTS_FILE: %w", prefix, err)
+		}
+	}
+	for _, pair := range strings.Split(os.Getenv(prefix+"_HOSTS"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, addr, ok := strings.Cut(pair, "=")
+		if !ok {
+			return config, fmt.Errorf("invalid %s_HOSTS entry %s, expected name=ip", prefix, pair)
+		}
+		if err := config.addHost(name, addr); err != nil {
+			return config, fmt.Errorf("invalid %s_HOSTS entry %s: %w", prefix, pair, err)
+		}
+	}
+
+	if config.DoH != "" {
+		u, err := url.Parse(config.DoH)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return config, fmt.Errorf("invalid %s_DOH_URL %s, expected an https url", prefix, config.DoH)
+		}
+	}
+	if value := os.Getenv(prefix + "_DOH_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid %s_DOH_TIMEOUT: %w", prefix, err)
+		}
+		config.DoHTimeout = timeout
+	}
+	return config, nil
+}
+
+// readHostsFile adds the entries of a hosts file, an address followed by the
+// names it is the address of, # starts a comment
+func (c *Config) readHostsFile(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return fmt.Errorf("line %d: address without names", line)
+		}
+		for _, name := range fields[1:] {
+			if err := c.addHost(name, fields[0]); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *Config) addHost(name, addr string) error {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return fmt.Errorf("%s is not an ip address", addr)
+	}
+	name = canonicalName(name)
+	if name == "" {
+		return fmt.Errorf("empty host name")
+	}
+	c.Hosts[name] = append(c.Hosts[name], ip)
+	return nil
+}
+
+// canonicalName is the lower case name without the trailing dot
+func canonicalName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
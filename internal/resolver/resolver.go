@@ -0,0 +1,277 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package resolver resolves the host names of outbound connections with
+// static addresses and a DNS-over-HTTPS resolver, for operators whose hosts
+// can't rely on the system resolver or on editing /etc/hosts.
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxDNSMessage bounds a dns response read from a DoH resolver
+const maxDNSMessage = 64 << 10
+
+// Install makes the config resolve the names of every connection the process
+// opens without a resolver of its own, which is every http client of the cli
+// and the node. Nothing changes when the config isn't enabled.
+func Install(config Config) {
+	if !config.Enabled() {
+		return
+	}
+	net.DefaultResolver = New(config)
+}
+
+// New returns a resolver answering with the static addresses of the config,
+// other names are looked up with the DoH resolver or, without one, with the
+// name servers of the system
+func New(config Config) *net.Resolver {
+	r := &resolver{config: config, dialer: &net.Dialer{Resolver: &net.Resolver{}}}
+	if config.DoH != "" {
+		r.client = &http.Client{
+			Timeout: config.DoHTimeout,
+			Transport: &http.Transport{
+				DialContext:       r.dialDoH,
+				ForceAttemptHTTP2: true,
+			},
+		}
+	}
+	// the go resolver sends its queries through Dial, which answers them here
+	return &net.Resolver{PreferGo: true, Dial: r.dial}
+}
+
+type resolver struct {
+	config Config
+	dialer *net.Dialer
+	client *http.Client
+}
+
+func (r *resolver) dial(ctx context.Context, network, server string) (net.Conn, error) {
+	return &dnsConn{ctx: ctx, resolver: r, network: network, server: server}, nil
+}
+
+// dialDoH connects to the DoH resolver, with the static address of its host
+// when there is one and never through the resolver it is part of
+func (r *resolver) dialDoH(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ips := r.config.Hosts[canonicalName(host)]; len(ips) > 0 {
+		addr = net.JoinHostPort(ips[0].String(), port)
+	}
+	return r.dialer.DialContext(ctx, network, addr)
+}
+
+// exchange answers one dns query
+func (r *resolver) exchange(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	msg := dnsmessage.Message{}
+	if err := msg.Unpack(query); err != nil {
+		return nil, fmt.Errorf("invalid dns query: %w", err)
+	}
+	if len(msg.Questions) == 1 {
+		if ips, ok := r.config.Hosts[canonicalName(msg.Questions[0].Name.String())]; ok {
+			return staticAnswer(msg, ips)
+		}
+	}
+	if r.client != nil {
+		return r.queryDoH(ctx, query)
+	}
+	return r.forward(ctx, network, server, query)
+}
+
+// staticAnswer answers a query for a name with static addresses, a query for
+// a type without addresses is answered with none so no other source is asked
+func staticAnswer(query dnsmessage.Message, ips []net.IP) ([]byte, error) {
+	question := query.Questions[0]
+	answer := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.Header.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   query.Header.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: query.Questions,
+	}
+	header := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60}
+	for _, ip := range ips {
+		switch ip4 := ip.To4(); {
+		case question.Type == dnsmessage.TypeA && ip4 != nil:
+			a := dnsmessage.AResource{}
+			copy(a.A[:], ip4)
+			answer.Answers = append(answer.Answers, dnsmessage.Resource{Header: header, Body: &a})
+		case question.Type == dnsmessage.TypeAAAA && ip4 == nil:
+			aaaa := dnsmessage.AAAAResource{}
+			copy(aaaa.AAAA[:], ip.To16())
+			answer.Answers = append(answer.Answers, dnsmessage.Resource{Header: header, Body: &aaaa})
+		}
+	}
+	return answer.Pack()
+}
+
+func (r *resolver) queryDoH(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.config.DoH, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DoH query failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH query failed with status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDNSMessage))
+}
+
+// forward sends the query to the name server the go resolver picked from the
+// system config
+func (r *resolver) forward(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	conn, err := r.dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, ok := conn.(net.PacketConn); ok {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, maxDNSMessage)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	framed := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, framed[:2]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(framed[:2]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// dnsConn is the connection the go resolver sends its queries over. It isn't
+// a net.PacketConn, so queries and responses are framed with their length like
+// dns over tcp, and every query is answered by the resolver.
+type dnsConn struct {
+	ctx      context.Context
+	resolver *resolver
+	network  string
+	server   string
+
+	mu       sync.Mutex
+	query    []byte
+	resp     bytes.Buffer
+	deadline time.Time
+}
+
+func (c *dnsConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.query = append(c.query, b...)
+	for len(c.query) >= 2 {
+		size := int(binary.BigEndian.Uint16(c.query))
+		if len(c.query) < 2+size {
+			break
+		}
+		query := c.query[2 : 2+size]
+		c.query = c.query[2+size:]
+
+		ctx := c.ctx
+		if !c.deadline.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, c.deadline)
+			defer cancel()
+		}
+		resp, err := c.resolver.exchange(ctx, c.network, c.server, query)
+		if err != nil {
+			return 0, err
+		}
+		if len(resp) > 0xffff {
+			return 0, errors.New("dns response too large")
+		}
+		_ = binary.Write(&c.resp, binary.BigEndian, uint16(len(resp)))
+		c.resp.Write(resp)
+	}
+	return len(b), nil
+}
+
+func (c *dnsConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resp.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.resp.Read(b)
+}
+
+func (c *dnsConn) Close() error { return nil }
+
+func (c *dnsConn) LocalAddr() net.Addr { return dnsAddr{} }
+
+func (c *dnsConn) RemoteAddr() net.Addr { return dnsAddr{} }
+
+func (c *dnsConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *dnsConn) SetReadDeadline(t time.Time) error { return nil }
+
+func (c *dnsConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+type dnsAddr struct{}
+
+func (dnsAddr) Network() string { return "dns" }
+
+func (dnsAddr) String() string { return "resolver" }
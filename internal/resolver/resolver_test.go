@@ -0,0 +1,132 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package resolver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestStaticHosts(t *testing.T) {
+	r := New(Config{Hosts: map[string][]net.IP{
+		"messenger.dkg.test": {net.ParseIP("10.1.2.3"), net.ParseIP("fd00::3")},
+	}})
+
+	addrs, err := r.LookupHost(context.Background(), "Messenger.DKG.test")
+	require.NoError(t, err)
+	sort.Strings(addrs)
+	require.Equal(t, []string{"10.1.2.3", "fd00::3"}, addrs)
+
+	ips, err := r.LookupIP(context.Background(), "ip4", "messenger.dkg.test")
+	require.NoError(t, err)
+	require.Len(t, ips, 1)
+	require.True(t, ips[0].Equal(net.ParseIP("10.1.2.3")))
+}
+
+func TestDoH(t *testing.T) {
+	var queries int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "application/dns-message", req.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(req.Body)
+		msg := dnsmessage.Message{}
+		require.NoError(t, msg.Unpack(body))
+		atomic.AddInt32(&queries, 1)
+
+		msg.Header.Response = true
+		msg.Header.RecursionAvailable = true
+		question := msg.Questions[0]
+		if question.Type == dnsmessage.TypeA {
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 7}},
+			}}
+		}
+		msg.Additionals = nil
+		resp, err := msg.Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(resp)
+	}))
+	defer srv.Close()
+
+	r := &resolver{
+		config: Config{DoH: srv.URL + "/dns-query", Hosts: map[string][]net.IP{"static.dkg.test": {net.ParseIP("10.0.0.1")}}},
+		client: srv.Client(),
+	}
+	res := &net.Resolver{PreferGo: true, Dial: r.dial}
+
+	addrs, err := res.LookupHost(context.Background(), "node-1.dkg.test")
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.0.2.7"}, addrs)
+	require.NotZero(t, atomic.LoadInt32(&queries))
+
+	// static hosts never reach the DoH resolver
+	atomic.StoreInt32(&queries, 0)
+	addrs, err = res.LookupHost(context.Background(), "static.dkg.test")
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1"}, addrs)
+	require.Zero(t, atomic.LoadInt32(&queries))
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	hostsFile := filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(hostsFile, []byte("# operators\n10.0.0.1 node-1.dkg.test node-1\n\n10.0.0.2 node-2.dkg.test # backup\n"), 0o600))
+	t.Setenv("TEST_HOSTS_FILE", hostsFile)
+	t.Setenv("TEST_HOSTS", "messenger.dkg.test=10.0.0.9, messenger.dkg.test=fd00::9")
+	t.Setenv("TEST_DOH_URL", "https://1.1.1.1/dns-query")
+	t.Setenv("TEST_DOH_TIMEOUT", "2s")
+
+	config, err := ConfigFromEnv("TEST")
+	require.NoError(t, err)
+	require.True(t, config.Enabled())
+	require.Equal(t, "https://1.1.1.1/dns-query", config.DoH)
+	require.Equal(t, "2s", config.DoHTimeout.String())
+	require.Len(t, config.Hosts, 4)
+	require.Len(t, config.Hosts["messenger.dkg.test"], 2)
+	require.True(t, config.Hosts["node-1"][0].Equal(net.ParseIP("10.0.0.1")))
+
+	t.Setenv("TEST_DOH_URL", "http://1.1.1.1/dns-query")
+	_, err = ConfigFromEnv("TEST")
+	require.ErrorContains(t, err, "TEST_DOH_URL")
+
+	t.Setenv("TEST_DOH_URL", "")
+	t.Setenv("TEST_HOSTS", "messenger.dkg.test")
+	_, err = ConfigFromEnv("TEST")
+	require.ErrorContains(t, err, "expected name=ip")
+}
+
+func TestConfigDisabled(t *testing.T) {
+	config, err := ConfigFromEnv("UNSET_TEST")
+	require.NoError(t, err)
+	require.False(t, config.Enabled())
+}
@@ -0,0 +1,227 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package sandbox hardens the node process: it refuses to run as root unless
+// told to, switches to an unprivileged user once the ports are bound, and can
+// confine the process with landlock to the paths it needs and with seccomp
+// away from syscalls a key-handling daemon never makes.
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Modes of NODE_SANDBOX
+const (
+	ModeLandlock = "landlock"
+	ModeSeccomp  = "seccomp"
+)
+
+// enteredArg marks the process Enter started again inside the sandbox. It is
+// taken off os.Args before main runs and only trusted once probes show the
+// restrictions are in force, anyone can pass it.
+const enteredArg = "--dkg-sandbox-entered"
+
+var marked = takeEnteredArg()
+
+func takeEnteredArg() bool {
+	for i, arg := range os.Args {
+		if i > 0 && arg == enteredArg {
+			os.Args = append(os.Args[:i:i], os.Args[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrRoot        = errors.New("refusing to run as root")
+	ErrUnsupported = errors.New("not supported on this platform")
+)
+
+// Path is a path the sandboxed process may read, and write when Write is set
+type Path struct {
+	Path  string
+	Write bool
+}
+
+func (p Path) String() string {
+	if p.Write {
+		return p.Path + ":rw"
+	}
+	return p.Path
+}
+
+type Config struct {
+	// AllowRoot lets the process keep running as root when User is empty
+	AllowRoot bool
+	// User the process switches to once its ports are bound, a name or uid:gid
+	User string
+	// Landlock confines the process to Paths and the system paths
+	Landlock bool
+	// Seccomp refuses the syscalls of DeniedSyscalls with EPERM
+	Seccomp bool
+	Paths   []Path
+}
+
+// Enabled reports whether the process is confined
+func (c *Config) Enabled() bool {
+	return c.Landlock || c.Seccomp
+}
+
+func (c *Config) String() string {
+	modes := []string{}
+	if c.Landlock {
+		modes = append(modes, ModeLandlock)
+	}
+	if c.Seccomp {
+		modes = append(modes, ModeSeccomp)
+	}
+	if len(modes) == 0 {
+		modes = append(modes, "off")
+	}
+	user := c.User
+	if user == "" {
+		user = "-"
+	}
+	return fmt.Sprintf("%s user=%s allow_root=%t", strings.Join(modes, ","), user, c.AllowRoot)
+}
+
+// ParseModes reads a comma separated list of landlock and seccomp, empty or
+// off is no sandbox
+func ParseModes(value string) (landlock, seccomp bool, err error) {
+	for _, mode := range strings.Split(value, ",") {
+		switch strings.TrimSpace(mode) {
+		case "", "off":
+		case ModeLandlock:
+			landlock = true
+		case ModeSeccomp:
+			seccomp = true
+		default:
+			return false, false, fmt.Errorf("unknown sandbox mode %q, expected %s or %s", mode, ModeLandlock, ModeSeccomp)
+		}
+	}
+	return landlock, seccomp, nil
+}
+
+// ParsePaths reads a comma separated list of paths, a path ending in :rw is
+// writable
+func ParsePaths(value string) ([]Path, error) {
+	var paths []Path
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path := Path{Path: entry}
+		if strings.HasSuffix(entry, ":rw") {
+			path = Path{Path: strings.TrimSuffix(entry, ":rw"), Write: true}
+		} else if strings.HasSuffix(entry, ":ro") {
+			path.Path = strings.TrimSuffix(entry, ":ro")
+		}
+		if !strings.HasPrefix(path.Path, "/") {
+			return nil, fmt.Errorf("sandbox path %q isn't absolute", path.Path)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// SystemPaths are readable in the landlock sandbox: shared libraries, tls
+// roots, name resolution, time zones and the user database
+var SystemPaths = []string{
+	"/lib", "/lib64", "/usr/lib", "/usr/lib64", "/etc/ld.so.cache",
+	"/etc/ssl", "/etc/pki", "/etc/ca-certificates", "/usr/share/ca-certificates",
+	"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf", "/etc/host.conf", "/etc/gai.conf",
+	"/etc/localtime", "/usr/share/zoneinfo",
+	"/etc/passwd", "/etc/group",
+	"/dev/null", "/dev/urandom", "/proc/self", "/sys/kernel/mm/transparent_hugepage",
+}
+
+// CheckUser refuses to run as root unless the process drops to User or root
+// is allowed
+func CheckUser(config *Config) error {
+	return checkUser(os.Geteuid(), config)
+}
+
+func checkUser(euid int, config *Config) error {
+	if euid != 0 || config.User != "" || config.AllowRoot {
+		return nil
+	}
+	return fmt.Errorf("%w: set a user to switch to once the ports are bound, or allow root", ErrRoot)
+}
+
+// Enter confines the process: the restrictions are applied to the current
+// thread, which then executes the binary again so every thread of the new
+// process runs inside them. It returns right away in the process started
+// again, or when nothing is confined.
+func Enter(config *Config) error {
+	if !config.Enabled() {
+		return nil
+	}
+	if marked {
+		if config.Landlock && !landlockActive() {
+			return fmt.Errorf("Enter: started as sandboxed but the landlock ruleset isn't in force")
+		}
+		if config.Seccomp && !seccompActive() {
+			return fmt.Errorf("Enter: started as sandboxed but the seccomp filter isn't in force")
+		}
+		return nil
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Enter: %w", err)
+	}
+	paths := make([]Path, 0, len(SystemPaths)+len(config.Paths)+1)
+	for _, path := range SystemPaths {
+		paths = append(paths, Path{Path: path})
+	}
+	paths = append(paths, Path{Path: executable})
+	paths = append(paths, config.Paths...)
+
+	args := append(append([]string{}, os.Args...), enteredArg)
+	if err := restrictAndExec(config, paths, executable, args); err != nil {
+		return fmt.Errorf("Enter: %w", err)
+	}
+	return nil
+}
+
+// Entered reports whether the process runs inside the sandbox Enter set up:
+// it was started again by Enter and is confined
+func Entered() bool {
+	return marked && (landlockActive() || seccompActive())
+}
+
+// DropPrivileges switches the process to the user of the config, owning
+// paths first so the user can write them. Nothing changes without a user,
+// or when the process already runs as that user.
+func DropPrivileges(config *Config, own ...string) error {
+	if config.User == "" {
+		return nil
+	}
+	if err := dropPrivileges(config.User, own); err != nil {
+		return fmt.Errorf("DropPrivileges: %w", err)
+	}
+	return nil
+}
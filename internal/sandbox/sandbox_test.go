@@ -0,0 +1,97 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package sandbox
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModes(t *testing.T) {
+	landlock, seccomp, err := ParseModes("")
+	require.NoError(t, err)
+	require.False(t, landlock)
+	require.False(t, seccomp)
+
+	landlock, seccomp, err = ParseModes("landlock, seccomp")
+	require.NoError(t, err)
+	require.True(t, landlock)
+	require.True(t, seccomp)
+
+	landlock, seccomp, err = ParseModes("off")
+	require.NoError(t, err)
+	require.False(t, landlock || seccomp)
+
+	_, _, err = ParseModes("apparmor")
+	require.Error(t, err)
+}
+
+func TestParsePaths(t *testing.T) {
+	paths, err := ParsePaths("/var/lib/dkg:rw, /etc/dkg/plugin ,/opt/sink:ro")
+	require.NoError(t, err)
+	require.Equal(t, []Path{
+		{Path: "/var/lib/dkg", Write: true},
+		{Path: "/etc/dkg/plugin"},
+		{Path: "/opt/sink"},
+	}, paths)
+	require.Equal(t, "/var/lib/dkg:rw", paths[0].String())
+
+	_, err = ParsePaths("relative/dir")
+	require.Error(t, err)
+}
+
+func TestCheckUser(t *testing.T) {
+	require.ErrorIs(t, checkUser(0, &Config{}), ErrRoot)
+	require.NoError(t, checkUser(0, &Config{AllowRoot: true}))
+	require.NoError(t, checkUser(0, &Config{User: "dkg"}))
+	require.NoError(t, checkUser(1000, &Config{}))
+}
+
+func TestConfigString(t *testing.T) {
+	config := &Config{}
+	require.False(t, config.Enabled())
+	require.Equal(t, "off user=- allow_root=false", config.String())
+
+	config = &Config{User: "dkg", Landlock: true, Seccomp: true}
+	require.True(t, config.Enabled())
+	require.Equal(t, "landlock,seccomp user=dkg allow_root=false", config.String())
+}
+
+func TestEnterDisabled(t *testing.T) {
+	// nothing to confine, the process carries on without starting again
+	require.NoError(t, Enter(&Config{}))
+	require.False(t, Entered())
+	require.NoError(t, DropPrivileges(&Config{}))
+}
+
+func TestEnterSpoofedMarker(t *testing.T) {
+	if landlockActive() || seccompActive() {
+		t.Skip("the test runs confined already")
+	}
+	// the marker passed to a process that isn't confined is refused
+	marked = true
+	defer func() { marked = false }()
+	require.False(t, Entered())
+	require.ErrorContains(t, Enter(&Config{Seccomp: true}), "seccomp filter isn't in force")
+	require.ErrorContains(t, Enter(&Config{Landlock: true}), "landlock ruleset isn't in force")
+}
@@ -0,0 +1,137 @@
+//go:build linux && (amd64 || arm64)
+
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package sandbox
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccomp filter return values, x/sys doesn't define them
+const (
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+)
+
+// DeniedSyscalls fail with EPERM in the seccomp sandbox: debugging other
+// processes, mounts and namespaces, kernel modules and keyrings, clocks and
+// host names, bpf and perf
+var DeniedSyscalls = map[string]uintptr{
+	"ptrace":            unix.SYS_PTRACE,
+	"process_vm_readv":  unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev": unix.SYS_PROCESS_VM_WRITEV,
+	"kcmp":              unix.SYS_KCMP,
+	"mount":             unix.SYS_MOUNT,
+	"umount2":           unix.SYS_UMOUNT2,
+	"pivot_root":        unix.SYS_PIVOT_ROOT,
+	"chroot":            unix.SYS_CHROOT,
+	"unshare":           unix.SYS_UNSHARE,
+	"setns":             unix.SYS_SETNS,
+	"open_by_handle_at": unix.SYS_OPEN_BY_HANDLE_AT,
+	"name_to_handle_at": unix.SYS_NAME_TO_HANDLE_AT,
+	"swapon":            unix.SYS_SWAPON,
+	"swapoff":           unix.SYS_SWAPOFF,
+	"reboot":            unix.SYS_REBOOT,
+	"kexec_load":        unix.SYS_KEXEC_LOAD,
+	"kexec_file_load":   unix.SYS_KEXEC_FILE_LOAD,
+	"init_module":       unix.SYS_INIT_MODULE,
+	"finit_module":      unix.SYS_FINIT_MODULE,
+	"delete_module":     unix.SYS_DELETE_MODULE,
+	"acct":              unix.SYS_ACCT,
+	"quotactl":          unix.SYS_QUOTACTL,
+	"keyctl":            unix.SYS_KEYCTL,
+	"add_key":           unix.SYS_ADD_KEY,
+	"request_key":       unix.SYS_REQUEST_KEY,
+	"settimeofday":      unix.SYS_SETTIMEOFDAY,
+	"clock_settime":     unix.SYS_CLOCK_SETTIME,
+	"clock_adjtime":     unix.SYS_CLOCK_ADJTIME,
+	"adjtimex":          unix.SYS_ADJTIMEX,
+	"sethostname":       unix.SYS_SETHOSTNAME,
+	"setdomainname":     unix.SYS_SETDOMAINNAME,
+	"bpf":               unix.SYS_BPF,
+	"perf_event_open":   unix.SYS_PERF_EVENT_OPEN,
+	"userfaultfd":       unix.SYS_USERFAULTFD,
+}
+
+func auditArch() uint32 {
+	if runtime.GOARCH == "arm64" {
+		return unix.AUDIT_ARCH_AARCH64
+	}
+	return unix.AUDIT_ARCH_X86_64
+}
+
+// seccompFilter kills the process on a foreign architecture or for an x32
+// syscall, refuses the denied syscalls and allows everything else
+func seccompFilter() []unix.SockFilter {
+	const (
+		offsetNr   = 0
+		offsetArch = 4
+		// x32 syscalls pass the x86_64 arch check with this bit set, they
+		// would skip the denied syscall numbers below
+		x32SyscallBit = 0x40000000
+	)
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: k, Jt: jt, Jf: jf}
+	}
+
+	filter := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(auditArch(), 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, seccompRetKillProcess),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+		{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, K: x32SyscallBit, Jt: 0, Jf: 1},
+		stmt(unix.BPF_RET|unix.BPF_K, seccompRetKillProcess),
+	}
+	for _, nr := range DeniedSyscalls {
+		filter = append(filter,
+			jump(uint32(nr), 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, seccompRetErrno|uint32(unix.EPERM)),
+		)
+	}
+	return append(filter, stmt(unix.BPF_RET|unix.BPF_K, seccompRetAllow))
+}
+
+// seccompActive probes for the filter: kcmp with an unknown type fails with
+// EINVAL, or ENOSYS without kcmp, unless the filter refuses it
+func seccompActive() bool {
+	pid := uintptr(unix.Getpid())
+	_, _, errno := unix.Syscall6(unix.SYS_KCMP, pid, pid, 0xff, 0, 0, 0)
+	return errno == unix.EPERM
+}
+
+func seccomp() error {
+	filter := seccompFilter()
+	program := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&program)), 0, 0); err != nil {
+		return fmt.Errorf("failed to install seccomp filter: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+//go:build linux && (amd64 || arm64)
+
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestSeccompFilter(t *testing.T) {
+	filter := seccompFilter()
+	// arch check, syscall load, x32 check, a jump and return per denied
+	// syscall, allow
+	require.Len(t, filter, 6+2*len(DeniedSyscalls)+1)
+	require.Equal(t, auditArch(), filter[1].K)
+	require.Equal(t, uint16(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K), filter[4].Code)
+	require.Equal(t, uint32(0x40000000), filter[4].K)
+	require.Equal(t, uint32(seccompRetKillProcess), filter[5].K)
+	require.Equal(t, uint32(seccompRetAllow), filter[len(filter)-1].K)
+}
+
+func TestLookupUser(t *testing.T) {
+	uid, gid, err := lookupUser("1000:1001")
+	require.NoError(t, err)
+	require.Equal(t, 1000, uid)
+	require.Equal(t, 1001, gid)
+
+	_, _, err = lookupUser("x:1")
+	require.Error(t, err)
+}
+
+// TestSeccompChild runs in the child TestSeccomp starts, inside the filter
+func TestSeccompChild(t *testing.T) {
+	if os.Getenv("SANDBOX_TEST_CHILD") != "1" {
+		t.Skip("runs in the child of TestSeccomp")
+	}
+	// the filter holds for this thread only
+	runtime.LockOSThread()
+	require.NoError(t, unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0))
+	require.NoError(t, seccomp())
+	_, _, errno := unix.Syscall(unix.SYS_UNSHARE, 0, 0, 0)
+	require.Equal(t, unix.EPERM, errno)
+	require.True(t, seccompActive())
+	_, err := os.Getwd()
+	require.NoError(t, err)
+}
+
+func TestSeccomp(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestSeccompChild$", "-test.v")
+	cmd.Env = append(os.Environ(), "SANDBOX_TEST_CHILD=1")
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.Contains(t, string(out), "--- PASS: TestSeccompChild")
+}
@@ -0,0 +1,106 @@
+//go:build darwin
+
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultLogDir  = "/Library/Logs/rockx-dkg"
+	defaultDataDir = "/Library/Application Support/rockx-dkg/data"
+)
+
+var launchDaemonDir = "/Library/LaunchDaemons"
+
+type launchdManager struct{}
+
+func New() Manager {
+	return launchdManager{}
+}
+
+func plistPath(name string) string {
+	return filepath.Join(launchDaemonDir, LaunchdLabel(name)+".plist")
+}
+
+func (launchdManager) Install(cfg *Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(plistPath(cfg.Name)); err == nil {
+		return fmt.Errorf("service %s is already installed", cfg.Name)
+	}
+	for _, dir := range []string{cfg.LogDir, cfg.DataDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	// launchd refuses daemon plists writable by anyone but root
+	if err := os.WriteFile(plistPath(cfg.Name), []byte(LaunchdPlist(cfg)), 0o644); err != nil {
+		return fmt.Errorf("failed to write launchd plist: %w", err)
+	}
+	return launchctl("load", "-w", plistPath(cfg.Name))
+}
+
+func (launchdManager) Uninstall(name string) error {
+	if _, err := os.Stat(plistPath(name)); err != nil {
+		return fmt.Errorf("service %s isn't installed", name)
+	}
+	if err := launchctl("unload", "-w", plistPath(name)); err != nil {
+		return err
+	}
+	return os.Remove(plistPath(name))
+}
+
+var launchctlPID = regexp.MustCompile(`"PID" = (\d+);`)
+
+func (launchdManager) Status(name string) (string, error) {
+	if _, err := os.Stat(plistPath(name)); err != nil {
+		return "not installed", nil
+	}
+	out, err := exec.Command("launchctl", "list", LaunchdLabel(name)).Output()
+	if err != nil {
+		return "not loaded", nil
+	}
+	if match := launchctlPID.FindSubmatch(out); match != nil {
+		return fmt.Sprintf("running (pid %s)", match[1]), nil
+	}
+	return "stopped", nil
+}
+
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
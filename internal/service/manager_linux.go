@@ -0,0 +1,103 @@
+//go:build linux
+
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultLogDir  = "/var/log/rockx-dkg"
+	defaultDataDir = "/frost-dkg-data"
+)
+
+var systemdUnitDir = "/etc/systemd/system"
+
+type systemdManager struct{}
+
+func New() Manager {
+	return systemdManager{}
+}
+
+func unitPath(name string) string {
+	return filepath.Join(systemdUnitDir, name+".service")
+}
+
+func (systemdManager) Install(cfg *Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(unitPath(cfg.Name)); err == nil {
+		return fmt.Errorf("service %s is already installed", cfg.Name)
+	}
+	for _, dir := range []string{cfg.LogDir, cfg.DataDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(unitPath(cfg.Name), []byte(SystemdUnit(cfg)), 0o644); err != nil {
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", "--now", cfg.Name+".service")
+}
+
+func (systemdManager) Uninstall(name string) error {
+	if _, err := os.Stat(unitPath(name)); err != nil {
+		return fmt.Errorf("service %s isn't installed", name)
+	}
+	if err := systemctl("disable", "--now", name+".service"); err != nil {
+		return err
+	}
+	if err := os.Remove(unitPath(name)); err != nil {
+		return err
+	}
+	return systemctl("daemon-reload")
+}
+
+func (systemdManager) Status(name string) (string, error) {
+	if _, err := os.Stat(unitPath(name)); err != nil {
+		return "not installed", nil
+	}
+	// is-active exits non-zero for inactive units, the state is still printed
+	out, _ := exec.Command("systemctl", "is-active", name+".service").Output()
+	return strings.TrimSpace(string(out)), nil
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
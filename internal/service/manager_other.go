@@ -0,0 +1,47 @@
+//go:build !linux && !darwin && !windows
+
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package service
+
+const (
+	defaultLogDir  = ""
+	defaultDataDir = "/frost-dkg-data"
+)
+
+type unsupportedManager struct{}
+
+func New() Manager {
+	return unsupportedManager{}
+}
+
+func (unsupportedManager) Install(*Config) error {
+	return ErrUnsupported
+}
+
+func (unsupportedManager) Uninstall(string) error {
+	return ErrUnsupported
+}
+
+func (unsupportedManager) Status(string) (string, error) {
+	return "", ErrUnsupported
+}
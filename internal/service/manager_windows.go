@@ -0,0 +1,165 @@
+//go:build windows
+
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	defaultLogDir  = `C:\ProgramData\rockx-dkg\logs`
+	defaultDataDir = `C:\ProgramData\rockx-dkg\data`
+)
+
+// restartResetPeriod is how long the node must run before the service control
+// manager forgets earlier failures, in seconds
+const restartResetPeriod = 24 * 60 * 60
+
+type windowsManager struct{}
+
+func New() Manager {
+	return windowsManager{}
+}
+
+func (windowsManager) Install(cfg *Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	for _, dir := range []string{cfg.LogDir, cfg.DataDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(cfg.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", cfg.Name)
+	}
+	s, err := m.CreateService(cfg.Name, cfg.Executable, mgr.Config{
+		DisplayName:      cfg.DisplayName,
+		Description:      cfg.Description,
+		StartType:        mgr.StartAutomatic,
+		DelayedAutoStart: true,
+	}, cfg.Args()...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: cfg.RestartDelay}
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{restart, restart, restart}, restartResetPeriod); err != nil {
+		return fmt.Errorf("failed to set restart policy: %w", err)
+	}
+	if err := setServiceEnvironment(cfg.Name, cfg.Environment()); err != nil {
+		return fmt.Errorf("failed to set service environment: %w", err)
+	}
+	return s.Start()
+}
+
+// setServiceEnvironment stores the variables the service control manager sets
+// for the process, there's no field for them in the service config
+func setServiceEnvironment(name string, env map[string]string) error {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+name, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	values := make([]string, 0, len(env))
+	for _, k := range sortedKeys(env) {
+		values = append(values, k+"="+env[k])
+	}
+	return key.SetStringsValue("Environment", values)
+}
+
+func (windowsManager) Uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s isn't installed", name)
+	}
+	defer s.Close()
+
+	if status, err := s.Query(); err == nil && status.State != svc.Stopped {
+		if _, err := s.Control(svc.Stop); err != nil {
+			return fmt.Errorf("failed to stop service: %w", err)
+		}
+		for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+			if status, err := s.Query(); err != nil || status.State == svc.Stopped {
+				break
+			}
+		}
+	}
+	return s.Delete()
+}
+
+func (windowsManager) Status(name string) (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to the service control manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return "not installed", nil
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return "", err
+	}
+	return serviceStates[status.State], nil
+}
+
+var serviceStates = map[svc.State]string{
+	svc.Stopped:         "stopped",
+	svc.StartPending:    "start pending",
+	svc.StopPending:     "stop pending",
+	svc.Running:         "running",
+	svc.ContinuePending: "continue pending",
+	svc.PausePending:    "pause pending",
+	svc.Paused:          "paused",
+}
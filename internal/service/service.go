@@ -0,0 +1,153 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package service installs the operator node as a system service, a systemd
+// unit on linux, a launchd daemon on macOS and a native service on Windows.
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const DefaultName = "rockx-dkg-node"
+
+var ErrUnsupported = errors.New("services aren't supported on this platform")
+
+// Config describes the installed service. The node reads its settings from
+// EnvFile when the service starts, so secrets stay out of the unit files.
+type Config struct {
+	Name        string
+	DisplayName string
+	Description string
+	// Executable is the absolute path of the node binary
+	Executable string
+	EnvFile    string
+	// LogDir receives the node log file and, where the platform routes it,
+	// stdout and stderr of the process
+	LogDir  string
+	DataDir string
+	// RestartDelay is how long the supervisor waits before restarting a failed node
+	RestartDelay time.Duration
+}
+
+// DefaultConfig fills the platform defaults for the node binary at executable
+func DefaultConfig(executable string) *Config {
+	return &Config{
+		Name:         DefaultName,
+		DisplayName:  "RockX DKG operator node",
+		Description:  "Runs keygen, resharing and signing ceremonies for an ssv operator",
+		Executable:   executable,
+		LogDir:       defaultLogDir,
+		DataDir:      defaultDataDir,
+		RestartDelay: 10 * time.Second,
+	}
+}
+
+func (cfg *Config) validate() error {
+	if cfg.Name == "" || cfg.Executable == "" {
+		return fmt.Errorf("service name and executable are required")
+	}
+	if cfg.EnvFile == "" {
+		return fmt.Errorf("env file is required")
+	}
+	if _, err := os.Stat(cfg.EnvFile); err != nil {
+		return fmt.Errorf("env file: %w", err)
+	}
+	return nil
+}
+
+// Args is the command line the supervisor starts the node with
+func (cfg *Config) Args() []string {
+	return []string{"service", "run", "--name", cfg.Name, "--env-file", cfg.EnvFile}
+}
+
+// Environment is set by the supervisor on top of the env file, it routes the
+// node log file and badger data to the service directories
+func (cfg *Config) Environment() map[string]string {
+	env := map[string]string{}
+	if cfg.LogDir != "" {
+		env["DKG_LOG_PATH"] = cfg.LogDir
+	}
+	if cfg.DataDir != "" {
+		env["NODE_DATA_DIR"] = cfg.DataDir
+	}
+	return env
+}
+
+// Manager installs and controls the service on the current platform
+type Manager interface {
+	Install(cfg *Config) error
+	Uninstall(name string) error
+	Status(name string) (string, error)
+}
+
+// LoadEnvFile reads KEY=VALUE lines like docker's --env-file, blank lines and
+// lines starting with # are skipped and surrounding quotes are removed
+func LoadEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	env := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[strings.TrimSpace(key)] = value
+	}
+	return env, scanner.Err()
+}
+
+// ApplyEnvFile sets the variables of the env file in the process environment,
+// variables already set by the supervisor win
+func ApplyEnvFile(path string) error {
+	env, err := LoadEnvFile(path)
+	if err != nil {
+		return err
+	}
+	for key, value := range env {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package service
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *Config {
+	cfg := DefaultConfig("/opt/rockx dkg/node")
+	cfg.EnvFile = "/etc/rockx-dkg/operator.env"
+	cfg.LogDir = "/var/log/rockx-dkg"
+	cfg.DataDir = "/var/lib/rockx-dkg"
+	cfg.RestartDelay = 15 * time.Second
+	return cfg
+}
+
+func TestSystemdUnit(t *testing.T) {
+	unit := SystemdUnit(testConfig())
+
+	require.Contains(t, unit, `ExecStart="/opt/rockx dkg/node" service run --name rockx-dkg-node --env-file /etc/rockx-dkg/operator.env`+"\n")
+	require.Contains(t, unit, "Environment=DKG_LOG_PATH=/var/log/rockx-dkg\nEnvironment=NODE_DATA_DIR=/var/lib/rockx-dkg\n")
+	require.Contains(t, unit, "Restart=on-failure\nRestartSec=15\n")
+	require.Contains(t, unit, "WantedBy=multi-user.target\n")
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	cfg := testConfig()
+	cfg.EnvFile = "/etc/rockx-dkg/a&b.env"
+	plist := LaunchdPlist(cfg)
+
+	// the plist must stay well formed whatever the paths contain
+	decoder := xml.NewDecoder(strings.NewReader(plist))
+	decoder.Strict = true
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+
+	require.Contains(t, plist, "<string>com.rockx.rockx-dkg-node</string>")
+	require.Contains(t, plist, "<string>/etc/rockx-dkg/a&amp;b.env</string>")
+	require.Contains(t, plist, "<key>ThrottleInterval</key>\n\t<integer>15</integer>")
+	require.Contains(t, plist, "<string>/var/log/rockx-dkg/rockx-dkg-node.err.log</string>")
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "operator.env")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# operator 1
+NODE_OPERATOR_ID=1
+export NODE_ADDR=0.0.0.0:8080
+MESSENGER_SRV_ADDR="https://dkg-messenger.rockx.com"
+OPERATOR_PRIVATE_KEY='abc=='
+`), 0o600))
+
+	env, err := LoadEnvFile(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"NODE_OPERATOR_ID":     "1",
+		"NODE_ADDR":            "0.0.0.0:8080",
+		"MESSENGER_SRV_ADDR":   "https://dkg-messenger.rockx.com",
+		"OPERATOR_PRIVATE_KEY": "abc==",
+	}, env)
+
+	require.NoError(t, os.WriteFile(path, []byte("NODE_OPERATOR_ID\n"), 0o600))
+	_, err = LoadEnvFile(path)
+	require.ErrorContains(t, err, "expected KEY=VALUE")
+}
+
+func TestApplyEnvFileKeepsSupervisorEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "operator.env")
+	require.NoError(t, os.WriteFile(path, []byte("SERVICE_TEST_A=file\nSERVICE_TEST_B=file\n"), 0o600))
+	t.Setenv("SERVICE_TEST_A", "supervisor")
+	t.Setenv("SERVICE_TEST_B", "")
+	os.Unsetenv("SERVICE_TEST_B")
+
+	require.NoError(t, ApplyEnvFile(path))
+	require.Equal(t, "supervisor", os.Getenv("SERVICE_TEST_A"))
+	require.Equal(t, "file", os.Getenv("SERVICE_TEST_B"))
+}
@@ -0,0 +1,79 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SystemdUnit renders the unit file for cfg. stdout and stderr go to the
+// journal, the node writes its json log to LogDir.
+func SystemdUnit(cfg *Config) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", cfg.Description)
+	fmt.Fprintf(&b, "Wants=network-online.target\n")
+	fmt.Fprintf(&b, "After=network-online.target\n")
+	fmt.Fprintf(&b, "StartLimitIntervalSec=0\n\n")
+
+	fmt.Fprintf(&b, "[Service]\n")
+	fmt.Fprintf(&b, "Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", systemdCommand(cfg.Executable, cfg.Args()))
+	for _, key := range sortedKeys(cfg.Environment()) {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(key+"="+cfg.Environment()[key]))
+	}
+	fmt.Fprintf(&b, "Restart=on-failure\n")
+	fmt.Fprintf(&b, "RestartSec=%d\n", int(cfg.RestartDelay.Seconds()))
+	fmt.Fprintf(&b, "StandardOutput=journal\n")
+	fmt.Fprintf(&b, "StandardError=journal\n")
+	fmt.Fprintf(&b, "SyslogIdentifier=%s\n\n", cfg.Name)
+
+	fmt.Fprintf(&b, "[Install]\n")
+	fmt.Fprintf(&b, "WantedBy=multi-user.target\n")
+	return b.String()
+}
+
+func systemdCommand(executable string, args []string) string {
+	quoted := []string{systemdQuote(executable)}
+	for _, arg := range args {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func systemdQuote(s string) string {
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,187 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package signing derives signing roots for application messages signed with
+// the validator key outside of ethereum, and the node policy deciding which
+// of them a committee may sign.
+package signing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ApplicationDomainType is DOMAIN_APPLICATION_MASK of the consensus specs,
+// reserved for signatures that are never valid on the beacon chain
+var ApplicationDomainType = [4]byte{0x00, 0x00, 0x00, 0x01}
+
+// EthereumDomains is the policy entry allowing keysign requests without a
+// domain tag, the deposit, exit and withdrawal change signatures of the cli
+const EthereumDomains = "ethereum"
+
+const maxDomainTagLength = 64
+
+var (
+	ErrDomainNotAllowed = errors.New("signing domain not allowed by node policy")
+	ErrRootMismatch     = errors.New("signing root doesn't match domain and message root")
+)
+
+// Domain separates the signatures of an application, tag names it (e.g.
+// "acme-bridge/v1"). It is the application domain type followed by 28 bytes
+// of the hash of the tag.
+func Domain(tag string) ([32]byte, error) {
+	domain := [32]byte{}
+	if err := validateTag(tag); err != nil {
+		return domain, err
+	}
+	h := sha256.Sum256([]byte("rockx-dkg-domain:" + tag))
+	copy(domain[:4], ApplicationDomainType[:])
+	copy(domain[4:], h[:28])
+	return domain, nil
+}
+
+func validateTag(tag string) error {
+	if tag == "" || len(tag) > maxDomainTagLength {
+		return fmt.Errorf("domain tag must have 1 to %d characters", maxDomainTagLength)
+	}
+	if tag == EthereumDomains || strings.HasSuffix(tag, "*") {
+		return fmt.Errorf("domain tag %q is reserved", tag)
+	}
+	for _, r := range tag {
+		if r < '!' || r > '~' {
+			return fmt.Errorf("domain tag %q must be printable ascii without spaces", tag)
+		}
+	}
+	return nil
+}
+
+// SigningRoot is hash_tree_root(SigningData(messageRoot, domain)) as in the
+// consensus specs
+func SigningRoot(messageRoot, domain [32]byte) [32]byte {
+	return sha256.Sum256(append(messageRoot[:], domain[:]...))
+}
+
+// KeySign is the data of a keysign start message, dkg.KeySign with the domain
+// tag and message root the signing root was derived from. Nodes of the spec
+// ignore the extra fields.
+type KeySign struct {
+	ValidatorPK []byte
+	SigningRoot []byte
+	DomainTag   string `json:",omitempty"`
+	MessageRoot []byte `json:",omitempty"`
+	// Usage and Message declare what an ethereum signing root signs, see VerifyUsage
+	Usage   Usage       `json:",omitempty"`
+	Message *EthMessage `json:",omitempty"`
+}
+
+// NewKeySign derives the signing root of messageRoot under the domain of tag
+func NewKeySign(validatorPK []byte, tag string, messageRoot [32]byte) (*KeySign, error) {
+	domain, err := Domain(tag)
+	if err != nil {
+		return nil, err
+	}
+	root := SigningRoot(messageRoot, domain)
+	return &KeySign{
+		ValidatorPK: validatorPK,
+		SigningRoot: root[:],
+		DomainTag:   tag,
+		MessageRoot: messageRoot[:],
+	}, nil
+}
+
+// Policy is the allowlist of domain tags a node signs for, an entry ending in
+// * allows every tag with that prefix
+type Policy struct {
+	allowed []string
+}
+
+// ParsePolicy reads a comma separated allowlist, an empty one allows nothing
+// but the ethereum signatures
+func ParsePolicy(s string) *Policy {
+	p := &Policy{}
+	if strings.TrimSpace(s) == "" {
+		p.allowed = []string{EthereumDomains}
+		return p
+	}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			p.allowed = append(p.allowed, entry)
+		}
+	}
+	return p
+}
+
+func (p *Policy) Allows(tag string) bool {
+	for _, entry := range p.allowed {
+		if entry == tag {
+			return true
+		}
+		if strings.HasSuffix(entry, "*") && tag != EthereumDomains && strings.HasPrefix(tag, strings.TrimSuffix(entry, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) String() string {
+	return strings.Join(p.allowed, ",")
+}
+
+// Check verifies the data of a keysign start message against the policy,
+// the signing root must be the one of the claimed domain and message root
+func (p *Policy) Check(data []byte) error {
+	keySign := &KeySign{}
+	if err := json.Unmarshal(data, keySign); err != nil {
+		return fmt.Errorf("failed to decode keysign request: %w", err)
+	}
+
+	if keySign.DomainTag == "" {
+		if !p.Allows(EthereumDomains) {
+			return fmt.Errorf("%w: request without domain tag", ErrDomainNotAllowed)
+		}
+		return nil
+	}
+	if !p.Allows(keySign.DomainTag) {
+		return fmt.Errorf("%w: %s", ErrDomainNotAllowed, keySign.DomainTag)
+	}
+	return keySign.verifyDomain()
+}
+
+// verifyDomain checks the signing root is the one of the domain tag and message root
+func (k *KeySign) verifyDomain() error {
+	if len(k.MessageRoot) != 32 {
+		return fmt.Errorf("message root must be 32 bytes")
+	}
+	messageRoot := [32]byte{}
+	copy(messageRoot[:], k.MessageRoot)
+	expected, err := NewKeySign(k.ValidatorPK, k.DomainTag, messageRoot)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(expected.SigningRoot, k.SigningRoot) {
+		return ErrRootMismatch
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package signing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomain(t *testing.T) {
+	domain, err := Domain("acme-bridge/v1")
+	require.NoError(t, err)
+	require.Equal(t, ApplicationDomainType[:], domain[:4])
+
+	other, err := Domain("acme-bridge/v2")
+	require.NoError(t, err)
+	require.NotEqual(t, domain, other)
+
+	for _, tag := range []string{"", "with space", EthereumDomains, "acme*", string(make([]byte, maxDomainTagLength+1))} {
+		_, err := Domain(tag)
+		require.Error(t, err, tag)
+	}
+}
+
+func TestSigningRoot(t *testing.T) {
+	// compute_signing_root of the consensus specs for a zero root in the zero domain
+	root := SigningRoot([32]byte{}, [32]byte{})
+	require.Equal(t, "f5a5fd42d16a20302798ef6ed309979b43003d2320d9f0e8ea9831a92759fb4b", hex.EncodeToString(root[:]))
+}
+
+func keySignData(t *testing.T, keySign *KeySign) []byte {
+	data, err := json.Marshal(keySign)
+	require.NoError(t, err)
+	return data
+}
+
+func TestPolicyCheck(t *testing.T) {
+	messageRoot := sha256.Sum256([]byte("transfer 10 to bob"))
+	keySign, err := NewKeySign([]byte{1, 2, 3}, "acme-bridge/v1", messageRoot)
+	require.NoError(t, err)
+	legacy := &KeySign{ValidatorPK: []byte{1, 2, 3}, SigningRoot: messageRoot[:]}
+
+	// default policy: ethereum signatures only
+	policy := ParsePolicy("")
+	require.NoError(t, policy.Check(keySignData(t, legacy)))
+	require.True(t, errors.Is(policy.Check(keySignData(t, keySign)), ErrDomainNotAllowed))
+
+	policy = ParsePolicy("acme-*")
+	require.NoError(t, policy.Check(keySignData(t, keySign)))
+	require.True(t, errors.Is(policy.Check(keySignData(t, legacy)), ErrDomainNotAllowed))
+
+	policy = ParsePolicy("ethereum, acme-bridge/v1")
+	require.NoError(t, policy.Check(keySignData(t, legacy)))
+	require.NoError(t, policy.Check(keySignData(t, keySign)))
+
+	// a signing root that isn't derived from the claimed domain is refused
+	forged := *keySign
+	forged.SigningRoot = messageRoot[:]
+	require.True(t, errors.Is(policy.Check(keySignData(t, &forged)), ErrRootMismatch))
+}
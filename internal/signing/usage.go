@@ -0,0 +1,348 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package signing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/bloxapp/ssv-spec/types"
+	ssz "github.com/ferranbt/fastssz"
+)
+
+// Usage is what a keysign signs, the node recomputes the signing root from
+// the message the request declares before it signs
+type Usage string
+
+const (
+	UsageDeposit          Usage = "deposit"
+	UsageExit             Usage = "exit"
+	UsageWithdrawalChange Usage = "withdrawal_change"
+	// UsageRegistration is the owner address and nonce prefixing ssv keyshares
+	UsageRegistration Usage = "registration"
+	// UsageApplication is a message root under an application domain tag
+	UsageApplication Usage = "application"
+	// UsageUndeclared is a signing root sent without its message, by older
+	// clis or anyone who doesn't want the node to know what it signs
+	UsageUndeclared Usage = "undeclared"
+)
+
+// Usages are the usages a policy can allow
+var Usages = []Usage{UsageDeposit, UsageExit, UsageWithdrawalChange, UsageRegistration, UsageApplication, UsageUndeclared}
+
+// DomainBLSToExecutionChange is the capella signature domain for withdrawal credential changes
+var DomainBLSToExecutionChange = phase0.DomainType{0x0a, 0x00, 0x00, 0x00}
+
+var (
+	ErrUsageNotAllowed = errors.New("key share usage not allowed by node policy")
+
+	registrationRoot = regexp.MustCompile(`^0x[0-9a-fA-F]{40}:[0-9]+$`)
+)
+
+// EthMessage is the ethereum message behind the signing root of a deposit,
+// exit or withdrawal change keysign, byte fields are hex encoded
+type EthMessage struct {
+	// ForkVersion and GenesisValidatorsRoot give the signature domain, deposits
+	// are signed without a genesis validators root
+	ForkVersion           string `json:"fork_version"`
+	GenesisValidatorsRoot string `json:"genesis_validators_root,omitempty"`
+
+	// deposit
+	WithdrawalCredentials string `json:"withdrawal_credentials,omitempty"`
+	Amount                uint64 `json:"amount,omitempty"`
+	// exit
+	Epoch uint64 `json:"epoch,omitempty"`
+	// exit and withdrawal change
+	ValidatorIndex uint64 `json:"validator_index,omitempty"`
+	// withdrawal change
+	ToExecutionAddress string `json:"to_execution_address,omitempty"`
+}
+
+// withdrawalChange is the capella BLSToExecutionChange container, the
+// go-eth2-client in use predates capella
+type withdrawalChange struct {
+	ValidatorIndex     uint64
+	FromBLSPubkey      [48]byte
+	ToExecutionAddress [20]byte
+}
+
+func (c *withdrawalChange) HashTreeRoot() ([32]byte, error) {
+	return ssz.HashWithDefaultHasher(c)
+}
+
+func (c *withdrawalChange) HashTreeRootWith(hh *ssz.Hasher) error {
+	indx := hh.Index()
+	hh.PutUint64(c.ValidatorIndex)
+	hh.PutBytes(c.FromBLSPubkey[:])
+	hh.PutBytes(c.ToExecutionAddress[:])
+	hh.Merkleize(indx)
+	return nil
+}
+
+// SigningRoot computes the root of the message for usage, signed with the
+// validator key validatorPK
+func (m *EthMessage) SigningRoot(usage Usage, validatorPK []byte) ([32]byte, error) {
+	fork, err := decodeFixed(m.ForkVersion, 4, "fork version")
+	if err != nil {
+		return [32]byte{}, err
+	}
+	gvr := make([]byte, 32)
+	if m.GenesisValidatorsRoot != "" {
+		if gvr, err = decodeFixed(m.GenesisValidatorsRoot, 32, "genesis validators root"); err != nil {
+			return [32]byte{}, err
+		}
+	}
+	if len(validatorPK) != 48 {
+		return [32]byte{}, fmt.Errorf("validator key must be 48 bytes")
+	}
+
+	var (
+		domainType phase0.DomainType
+		obj        ssz.HashRoot
+	)
+	switch usage {
+	case UsageDeposit:
+		credentials, err := decodeFixed(m.WithdrawalCredentials, 32, "withdrawal credentials")
+		if err != nil {
+			return [32]byte{}, err
+		}
+		// the deposit domain ignores the genesis validators root
+		domainType, gvr = types.DomainDeposit, make([]byte, 32)
+		obj = &phase0.DepositMessage{PublicKey: phase0.BLSPubKey(toArray48(validatorPK)), WithdrawalCredentials: credentials, Amount: phase0.Gwei(m.Amount)}
+	case UsageExit:
+		domainType = types.DomainVoluntaryExit
+		obj = &phase0.VoluntaryExit{Epoch: phase0.Epoch(m.Epoch), ValidatorIndex: phase0.ValidatorIndex(m.ValidatorIndex)}
+	case UsageWithdrawalChange:
+		address, err := decodeFixed(m.ToExecutionAddress, 20, "execution address")
+		if err != nil {
+			return [32]byte{}, err
+		}
+		change := &withdrawalChange{ValidatorIndex: m.ValidatorIndex, FromBLSPubkey: toArray48(validatorPK)}
+		copy(change.ToExecutionAddress[:], address)
+		domainType, obj = DomainBLSToExecutionChange, change
+	default:
+		return [32]byte{}, fmt.Errorf("usage %s has no ethereum message", usage)
+	}
+
+	var version phase0.Version
+	var root phase0.Root
+	copy(version[:], fork)
+	copy(root[:], gvr)
+	domain, err := types.ComputeETHDomain(domainType, version, root)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return types.ComputeETHSigningRoot(obj, domain)
+}
+
+// VerifyUsage finds out what the keysign signs and checks the signing root
+// is the one of the declared message
+func (k *KeySign) VerifyUsage() (Usage, error) {
+	if k.DomainTag != "" {
+		if k.Usage != "" && k.Usage != UsageApplication {
+			return "", fmt.Errorf("a keysign with a domain tag can't be a %s", k.Usage)
+		}
+		return UsageApplication, k.verifyDomain()
+	}
+
+	switch k.Usage {
+	case "":
+		// the owner prefix of ssv keyshares is its own signing root
+		if registrationRoot.Match(k.SigningRoot) {
+			return UsageRegistration, nil
+		}
+		return UsageUndeclared, nil
+	case UsageRegistration:
+		if !registrationRoot.Match(k.SigningRoot) {
+			return "", fmt.Errorf("registration signing root must be <owner address>:<nonce>")
+		}
+		return UsageRegistration, nil
+	case UsageDeposit, UsageExit, UsageWithdrawalChange:
+		if k.Message == nil {
+			return "", fmt.Errorf("%s keysign without its message", k.Usage)
+		}
+		root, err := k.Message.SigningRoot(k.Usage, k.ValidatorPK)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s message: %w", k.Usage, err)
+		}
+		if !bytes.Equal(root[:], k.SigningRoot) {
+			return "", fmt.Errorf("%w: not the root of the %s message", ErrRootMismatch, k.Usage)
+		}
+		return k.Usage, nil
+	}
+	return "", fmt.Errorf("unknown keysign usage %q", k.Usage)
+}
+
+// UsageRule lists what the shares of a validator may sign
+type UsageRule struct {
+	Usages []Usage `json:"usages"`
+	// ActivationEpoch, when set, refuses exits for an earlier epoch
+	ActivationEpoch *uint64 `json:"activation_epoch,omitempty"`
+}
+
+func (r *UsageRule) allows(usage Usage) bool {
+	for _, allowed := range r.Usages {
+		if allowed == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// UsagePolicy restricts what the node signs with its key shares. Validators
+// with a rule of their own follow it, the others the default rule, and
+// without one they sign anything the domain policy allows.
+type UsagePolicy struct {
+	Default    *UsageRule
+	Validators map[string]*UsageRule
+}
+
+// ParseUsages reads a comma separated list of usages
+func ParseUsages(s string) ([]Usage, error) {
+	var usages []Usage
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if err := validateUsage(Usage(entry)); err != nil {
+			return nil, err
+		}
+		usages = append(usages, Usage(entry))
+	}
+	return usages, nil
+}
+
+func validateUsage(usage Usage) error {
+	for _, known := range Usages {
+		if usage == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key share usage %q", usage)
+}
+
+// LoadUsagePolicy builds the policy from the default usages and a json file
+// of validator rules keyed by validator public key, nil when both are empty
+func LoadUsagePolicy(defaults, path string) (*UsagePolicy, error) {
+	if strings.TrimSpace(defaults) == "" && path == "" {
+		return nil, nil
+	}
+	p := &UsagePolicy{Validators: make(map[string]*UsageRule)}
+	if strings.TrimSpace(defaults) != "" {
+		usages, err := ParseUsages(defaults)
+		if err != nil {
+			return nil, fmt.Errorf("LoadUsagePolicy: %w", err)
+		}
+		p.Default = &UsageRule{Usages: usages}
+	}
+	if path == "" {
+		return p, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("LoadUsagePolicy: %w", err)
+	}
+	rules := make(map[string]*UsageRule)
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("LoadUsagePolicy: failed to decode %s: %w", path, err)
+	}
+	for pk, rule := range rules {
+		key, err := hexenc.ParseValidatorPK(pk)
+		if err != nil {
+			return nil, fmt.Errorf("LoadUsagePolicy: %s is not a validator public key", pk)
+		}
+		if rule == nil {
+			return nil, fmt.Errorf("LoadUsagePolicy: no rule for validator %s", pk)
+		}
+		for _, usage := range rule.Usages {
+			if err := validateUsage(usage); err != nil {
+				return nil, fmt.Errorf("LoadUsagePolicy: validator %s: %w", pk, err)
+			}
+		}
+		p.Validators[hexenc.Key(key)] = rule
+	}
+	return p, nil
+}
+
+// Rule is the rule the shares of the validator follow, nil when unrestricted
+func (p *UsagePolicy) Rule(validatorPK []byte) *UsageRule {
+	if rule, ok := p.Validators[hexenc.Key(validatorPK)]; ok {
+		return rule
+	}
+	return p.Default
+}
+
+// Check verifies the data of a keysign start message against the rule of its validator
+func (p *UsagePolicy) Check(data []byte) error {
+	keySign := &KeySign{}
+	if err := json.Unmarshal(data, keySign); err != nil {
+		return fmt.Errorf("failed to decode keysign request: %w", err)
+	}
+	rule := p.Rule(keySign.ValidatorPK)
+	if rule == nil {
+		return nil
+	}
+	usage, err := keySign.VerifyUsage()
+	if err != nil {
+		return err
+	}
+	if !rule.allows(usage) {
+		return fmt.Errorf("%w: %s for validator %x", ErrUsageNotAllowed, usage, keySign.ValidatorPK)
+	}
+	if usage == UsageExit && rule.ActivationEpoch != nil && keySign.Message.Epoch < *rule.ActivationEpoch {
+		return fmt.Errorf("%w: exit at epoch %d before activation epoch %d", ErrUsageNotAllowed, keySign.Message.Epoch, *rule.ActivationEpoch)
+	}
+	return nil
+}
+
+func (p *UsagePolicy) String() string {
+	if p.Default == nil {
+		return fmt.Sprintf("unrestricted, %d validator rules", len(p.Validators))
+	}
+	usages := make([]string, 0, len(p.Default.Usages))
+	for _, usage := range p.Default.Usages {
+		usages = append(usages, string(usage))
+	}
+	return fmt.Sprintf("%s, %d validator rules", strings.Join(usages, ","), len(p.Validators))
+}
+
+func decodeFixed(value string, size int, name string) ([]byte, error) {
+	b, err := hexenc.ParseFixed(value, size, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be %d bytes of hex", name, size)
+	}
+	return b, nil
+}
+
+func toArray48(b []byte) [48]byte {
+	a := [48]byte{}
+	copy(a[:], b)
+	return a
+}
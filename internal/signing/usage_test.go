@@ -0,0 +1,119 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package signing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testValidatorPK(b byte) []byte {
+	pk := make([]byte, 48)
+	for i := range pk {
+		pk[i] = b
+	}
+	return pk
+}
+
+func ethKeySign(t *testing.T, pk []byte, usage Usage, message *EthMessage) *KeySign {
+	root, err := message.SigningRoot(usage, pk)
+	require.NoError(t, err)
+	return &KeySign{ValidatorPK: pk, SigningRoot: root[:], Usage: usage, Message: message}
+}
+
+func TestVerifyUsage(t *testing.T) {
+	pk := testValidatorPK(1)
+	deposit := ethKeySign(t, pk, UsageDeposit, &EthMessage{ForkVersion: "00001020", WithdrawalCredentials: hex.EncodeToString(make([]byte, 32)), Amount: 32000000000})
+	usage, err := deposit.VerifyUsage()
+	require.NoError(t, err)
+	require.Equal(t, UsageDeposit, usage)
+
+	// the same message signed as an exit has another root
+	exit := ethKeySign(t, pk, UsageExit, &EthMessage{ForkVersion: "03001020", Epoch: 200000, ValidatorIndex: 7})
+	usage, err = exit.VerifyUsage()
+	require.NoError(t, err)
+	require.Equal(t, UsageExit, usage)
+	disguised := *exit
+	disguised.Usage = UsageDeposit
+	_, err = disguised.VerifyUsage()
+	require.Error(t, err)
+	disguised = *exit
+	disguised.SigningRoot = deposit.SigningRoot
+	_, err = disguised.VerifyUsage()
+	require.True(t, errors.Is(err, ErrRootMismatch))
+
+	registration := &KeySign{ValidatorPK: pk, SigningRoot: []byte("0x1d2f14d2dffee594b4093d42e4bc1b0ea55e8aa7:3")}
+	usage, err = registration.VerifyUsage()
+	require.NoError(t, err)
+	require.Equal(t, UsageRegistration, usage)
+
+	undeclared := &KeySign{ValidatorPK: pk, SigningRoot: deposit.SigningRoot}
+	usage, err = undeclared.VerifyUsage()
+	require.NoError(t, err)
+	require.Equal(t, UsageUndeclared, usage)
+
+	application, err := NewKeySign(pk, "acme-bridge/v1", sha256.Sum256([]byte("transfer")))
+	require.NoError(t, err)
+	usage, err = application.VerifyUsage()
+	require.NoError(t, err)
+	require.Equal(t, UsageApplication, usage)
+
+	_, err = (&KeySign{ValidatorPK: pk, SigningRoot: deposit.SigningRoot, Usage: UsageExit}).VerifyUsage()
+	require.Error(t, err, "an exit without its message")
+}
+
+func TestUsagePolicy(t *testing.T) {
+	pk, other := testValidatorPK(1), testValidatorPK(2)
+	path := filepath.Join(t.TempDir(), "usage.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"0x`+hex.EncodeToString(pk)+`": {"usages": ["exit"], "activation_epoch": 1000}}`), 0600))
+
+	policy, err := LoadUsagePolicy("deposit, registration", path)
+	require.NoError(t, err)
+	check := func(k *KeySign) error {
+		return policy.Check(keySignData(t, k))
+	}
+
+	deposit := &EthMessage{ForkVersion: "00001020", WithdrawalCredentials: hex.EncodeToString(make([]byte, 32)), Amount: 32000000000}
+	require.NoError(t, check(ethKeySign(t, other, UsageDeposit, deposit)), "the default rule")
+	require.True(t, errors.Is(check(ethKeySign(t, other, UsageExit, &EthMessage{ForkVersion: "03001020", Epoch: 2000})), ErrUsageNotAllowed))
+	require.True(t, errors.Is(check(&KeySign{ValidatorPK: other, SigningRoot: make([]byte, 32)}), ErrUsageNotAllowed), "undeclared roots aren't in the default rule")
+
+	// the validator's own rule replaces the default one
+	require.True(t, errors.Is(check(ethKeySign(t, pk, UsageDeposit, deposit)), ErrUsageNotAllowed))
+	require.NoError(t, check(ethKeySign(t, pk, UsageExit, &EthMessage{ForkVersion: "03001020", Epoch: 1000})))
+	require.True(t, errors.Is(check(ethKeySign(t, pk, UsageExit, &EthMessage{ForkVersion: "03001020", Epoch: 999})), ErrUsageNotAllowed), "exits before the activation epoch")
+
+	policy, err = LoadUsagePolicy("", "")
+	require.NoError(t, err)
+	require.Nil(t, policy)
+	_, err = LoadUsagePolicy("deposit,transfer", "")
+	require.Error(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(`{"0x01": {"usages": ["exit"]}}`), 0600))
+	_, err = LoadUsagePolicy("", path)
+	require.Error(t, err)
+}
@@ -0,0 +1,191 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const awsService = "secretsmanager"
+
+// AWSSink writes records to AWS Secrets Manager, creating the secret on the
+// first write and adding a version on the next ones
+type AWSSink struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Prefix          string
+	Endpoint        string
+	client          *http.Client
+	now             func() time.Time
+}
+
+func NewAWSSink(region, accessKeyID, secretAccessKey, sessionToken, prefix string) *AWSSink {
+	return &AWSSink{
+		Region:          region,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		SessionToken:    sessionToken,
+		Prefix:          prefix,
+		Endpoint:        fmt.Sprintf("https://%s.%s.amazonaws.com", awsService, region),
+		client:          defaultHTTPClient(),
+		now:             time.Now,
+	}
+}
+
+func NewAWSSinkFromEnv() (*AWSSink, error) {
+	region := os.Getenv("AWS_REGION")
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if region == "" || accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("aws sink needs AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	s := NewAWSSink(region, accessKeyID, secretAccessKey, os.Getenv("AWS_SESSION_TOKEN"), envOrDefault("AWS_SECRETS_PREFIX", "rockx-dkg"))
+	if endpoint := os.Getenv("AWS_SECRETSMANAGER_ENDPOINT"); endpoint != "" {
+		s.Endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+	return s, nil
+}
+
+func (s *AWSSink) Name() string {
+	return "aws"
+}
+
+func (s *AWSSink) Put(ctx context.Context, record *Record) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	name := record.SecretName(s.Prefix)
+
+	err = s.call(ctx, "CreateSecret", map[string]string{"Name": name, "SecretString": string(value)})
+	if apiErr, ok := err.(*awsError); ok && strings.HasSuffix(apiErr.Type, "ResourceExistsException") {
+		err = s.call(ctx, "PutSecretValue", map[string]string{"SecretId": name, "SecretString": string(value)})
+	}
+	return err
+}
+
+type awsError struct {
+	ErrUnexpectedStatus
+	Type string `json:"__type"`
+}
+
+func (s *AWSSink) call(ctx context.Context, operation string, in interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager."+operation)
+	s.sign(req, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request to aws secrets manager: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		apiErr := &awsError{}
+		_ = json.Unmarshal(respBody, apiErr)
+		apiErr.ErrUnexpectedStatus = ErrUnexpectedStatus{Sink: s.Name(), Operation: operation, StatusCode: resp.StatusCode, Body: string(respBody)}
+		return apiErr
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 authorization header to req
+func (s *AWSSink) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, s.Region, awsService)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, awsService)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,156 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPSink writes records to GCP Secret Manager. It authenticates with
+// GCP_ACCESS_TOKEN when set and with the instance service account otherwise.
+type GCPSink struct {
+	Project     string
+	Prefix      string
+	AccessToken string
+	Endpoint    string
+	TokenURL    string
+	client      *http.Client
+}
+
+func NewGCPSink(project, prefix, accessToken string) *GCPSink {
+	return &GCPSink{
+		Project:     project,
+		Prefix:      prefix,
+		AccessToken: accessToken,
+		Endpoint:    "https://secretmanager.googleapis.com",
+		TokenURL:    gcpMetadataTokenURL,
+		client:      defaultHTTPClient(),
+	}
+}
+
+func NewGCPSinkFromEnv() (*GCPSink, error) {
+	project := os.Getenv("GCP_PROJECT")
+	if project == "" {
+		return nil, fmt.Errorf("gcp sink needs GCP_PROJECT")
+	}
+	s := NewGCPSink(project, envOrDefault("GCP_SECRET_PREFIX", "rockx-dkg"), os.Getenv("GCP_ACCESS_TOKEN"))
+	if endpoint := os.Getenv("GCP_SECRETMANAGER_ENDPOINT"); endpoint != "" {
+		s.Endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+	return s, nil
+}
+
+func (s *GCPSink) Name() string {
+	return "gcp"
+}
+
+func (s *GCPSink) Put(ctx context.Context, record *Record) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	token, err := s.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	secretID := record.SecretName(s.Prefix)
+	parent := fmt.Sprintf("projects/%s", url.PathEscape(s.Project))
+
+	create := map[string]interface{}{"replication": map[string]interface{}{"automatic": map[string]interface{}{}}}
+	err = s.call(ctx, token, "create secret", fmt.Sprintf("/v1/%s/secrets?secretId=%s", parent, url.QueryEscape(secretID)), create)
+	if statusErr, ok := err.(*ErrUnexpectedStatus); ok && statusErr.StatusCode == http.StatusConflict {
+		err = nil // secret exists from an earlier ceremony output, add a version
+	}
+	if err != nil {
+		return err
+	}
+
+	version := map[string]interface{}{"payload": map[string]string{"data": base64.StdEncoding.EncodeToString(value)}}
+	return s.call(ctx, token, "add secret version", fmt.Sprintf("/v1/%s/secrets/%s:addVersion", parent, url.PathEscape(secretID)), version)
+}
+
+func (s *GCPSink) call(ctx context.Context, token, operation, path string, in interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request to gcp secret manager: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &ErrUnexpectedStatus{Sink: s.Name(), Operation: operation, StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
+
+func (s *GCPSink) token(ctx context.Context) (string, error) {
+	if s.AccessToken != "" {
+		return s.AccessToken, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.TokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token from gcp metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", &ErrUnexpectedStatus{Sink: s.Name(), Operation: "get access token", StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse gcp access token: %w", err)
+	}
+	return token.AccessToken, nil
+}
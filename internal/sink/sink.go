@@ -0,0 +1,111 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/encryption"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Record is what a node pushes to a secret store when a ceremony completes. The
+// share never leaves the node in clear, it is sealed to the operator key.
+type Record struct {
+	RequestID       string                      `json:"request_id"`
+	OperatorID      types.OperatorID            `json:"operator_id"`
+	ValidatorPK     string                      `json:"validator_pk"`
+	SharePubKey     string                      `json:"share_pub_key"`
+	OperatorPubKeys map[types.OperatorID]string `json:"operator_pub_keys"`
+	Threshold       uint64                      `json:"threshold"`
+	EncryptedShare  *encryption.Envelope        `json:"encrypted_share"`
+	CompletedAt     int64                       `json:"completed_at"`
+}
+
+// SecretName is the name a record is stored under, it only uses characters
+// every supported store accepts
+func (r *Record) SecretName(prefix string) string {
+	return fmt.Sprintf("%s-%d-%s", prefix, r.OperatorID, r.ValidatorPK)
+}
+
+// Sink is a destination for ceremony results
+type Sink interface {
+	Name() string
+	Put(ctx context.Context, record *Record) error
+}
+
+// FromEnv builds the sinks listed in NODE_SINKS (comma separated, any of vault,
+// aws and gcp), each sink reads its own settings from the environment
+func FromEnv() ([]Sink, error) {
+	sinks := make([]Sink, 0)
+	for _, name := range strings.Split(os.Getenv("NODE_SINKS"), ",") {
+		name = strings.TrimSpace(name)
+		var (
+			s   Sink
+			err error
+		)
+		switch name {
+		case "":
+			continue
+		case "vault":
+			s, err = NewVaultSinkFromEnv()
+		case "aws":
+			s, err = NewAWSSinkFromEnv()
+		case "gcp":
+			s, err = NewGCPSinkFromEnv()
+		default:
+			err = fmt.Errorf("unknown sink %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+func defaultHTTPClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+type ErrUnexpectedStatus struct {
+	Sink       string
+	Operation  string
+	StatusCode int
+	Body       string
+}
+
+func (err *ErrUnexpectedStatus) Error() string {
+	return fmt.Sprintf("%s sink %s failed with status %d: %s", err.Sink, err.Operation, err.StatusCode, err.Body)
+}
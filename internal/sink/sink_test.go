@@ -0,0 +1,128 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testRecord() *Record {
+	return &Record{RequestID: "req", OperatorID: 1, ValidatorPK: "abcd", Threshold: 3}
+}
+
+func TestVaultSinkPut(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/v1/secret/data/rockx-dkg/1/abcd", r.URL.Path)
+		require.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+
+		body := struct {
+			Data *Record `json:"data"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, "req", body.Data.RequestID)
+	}))
+	defer srv.Close()
+
+	require.NoError(t, NewVaultSink(srv.URL, "token", "secret", "rockx-dkg").Put(context.Background(), testRecord()))
+}
+
+func TestAWSSinkPutExistingSecret(t *testing.T) {
+	operations := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/20230102/eu-west-1/secretsmanager/aws4_request"))
+		require.Equal(t, "20230102T030405Z", r.Header.Get("X-Amz-Date"))
+
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "secretsmanager.")
+		operations = append(operations, operation)
+		if operation == "CreateSecret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"__type":"ResourceExistsException","message":"exists"}`)
+			return
+		}
+
+		body := map[string]string{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, "rockx-dkg-1-abcd", body["SecretId"])
+	}))
+	defer srv.Close()
+
+	s := NewAWSSink("eu-west-1", "AKID", "secret", "", "rockx-dkg")
+	s.Endpoint = srv.URL
+	s.now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	require.NoError(t, s.Put(context.Background(), testRecord()))
+	require.Equal(t, []string{"CreateSecret", "PutSecretValue"}, operations)
+}
+
+func TestGCPSinkPutExistingSecret(t *testing.T) {
+	paths := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			require.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+			_, _ = io.WriteString(w, `{"access_token":"gcp-token"}`)
+			return
+		case "/v1/projects/proj/secrets":
+			require.Equal(t, "rockx-dkg-1-abcd", r.URL.Query().Get("secretId"))
+			w.WriteHeader(http.StatusConflict)
+		}
+		require.Equal(t, "Bearer gcp-token", r.Header.Get("Authorization"))
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	s := NewGCPSink("proj", "rockx-dkg", "")
+	s.Endpoint = srv.URL
+	s.TokenURL = srv.URL + "/token"
+
+	require.NoError(t, s.Put(context.Background(), testRecord()))
+	require.Equal(t, []string{"/v1/projects/proj/secrets", "/v1/projects/proj/secrets/rockx-dkg-1-abcd:addVersion"}, paths)
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("NODE_SINKS", "")
+	sinks, err := FromEnv()
+	require.NoError(t, err)
+	require.Empty(t, sinks)
+
+	t.Setenv("NODE_SINKS", "vault, gcp")
+	t.Setenv("VAULT_ADDR", "http://vault:8200")
+	t.Setenv("VAULT_TOKEN", "token")
+	t.Setenv("GCP_PROJECT", "proj")
+	sinks, err = FromEnv()
+	require.NoError(t, err)
+	require.Len(t, sinks, 2)
+
+	t.Setenv("NODE_SINKS", "s3")
+	_, err = FromEnv()
+	require.Error(t, err)
+}
@@ -0,0 +1,92 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// VaultSink writes records to a HashiCorp Vault KV version 2 secrets engine
+type VaultSink struct {
+	Addr   string
+	Token  string
+	Mount  string
+	Prefix string
+	client *http.Client
+}
+
+func NewVaultSink(addr, token, mount, prefix string) *VaultSink {
+	return &VaultSink{
+		Addr:   strings.TrimSuffix(addr, "/"),
+		Token:  token,
+		Mount:  mount,
+		Prefix: prefix,
+		client: defaultHTTPClient(),
+	}
+}
+
+func NewVaultSinkFromEnv() (*VaultSink, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("vault sink needs VAULT_ADDR and VAULT_TOKEN")
+	}
+	return NewVaultSink(addr, token, envOrDefault("VAULT_KV_MOUNT", "secret"), envOrDefault("VAULT_KV_PREFIX", "rockx-dkg")), nil
+}
+
+func (s *VaultSink) Name() string {
+	return "vault"
+}
+
+func (s *VaultSink) Put(ctx context.Context, record *Record) error {
+	body, err := json.Marshal(map[string]interface{}{"data": record})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s/%d/%s", s.Addr, s.Mount, s.Prefix, record.OperatorID, record.ValidatorPK)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", s.Token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request to vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &ErrUnexpectedStatus{Sink: s.Name(), Operation: "write", StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
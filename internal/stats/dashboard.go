@@ -0,0 +1,223 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package stats
+
+import "fmt"
+
+// DashboardUID is the uid of the generated dashboard, importing a newer one
+// replaces it
+const DashboardUID = "rockx-dkg-ceremonies"
+
+// Dashboard is a grafana dashboard definition, only the fields it uses
+type Dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          TimeRange  `json:"time"`
+	Templating    Templating `json:"templating"`
+	Panels        []*Panel   `json:"panels"`
+}
+
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Templating struct {
+	List []*Variable `json:"list"`
+}
+
+// Variable is a dashboard variable, the datasource or a custom list
+type Variable struct {
+	Name    string            `json:"name"`
+	Label   string            `json:"label"`
+	Type    string            `json:"type"`
+	Query   string            `json:"query"`
+	Current map[string]string `json:"current,omitempty"`
+	Options []VariableOption  `json:"options,omitempty"`
+}
+
+type VariableOption struct {
+	Text     string `json:"text"`
+	Value    string `json:"value"`
+	Selected bool   `json:"selected"`
+}
+
+type Panel struct {
+	ID          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	GridPos     GridPos                `json:"gridPos"`
+	Datasource  Datasource             `json:"datasource"`
+	Targets     []Target               `json:"targets"`
+	FieldConfig FieldConfig            `json:"fieldConfig"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+}
+
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type Target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	Interval     string `json:"interval,omitempty"`
+	Instant      bool   `json:"instant,omitempty"`
+}
+
+type FieldConfig struct {
+	Defaults FieldDefaults `json:"defaults"`
+}
+
+type FieldDefaults struct {
+	Unit   string                 `json:"unit,omitempty"`
+	Min    *float64               `json:"min,omitempty"`
+	Max    *float64               `json:"max,omitempty"`
+	Custom map[string]interface{} `json:"custom,omitempty"`
+}
+
+// NewDashboard is the dashboard of the ceremony metrics of the nodes and the
+// messenger, with a variable to switch between them
+func NewDashboard() *Dashboard {
+	zero, one := 0.0, 1.0
+	prometheus := Datasource{Type: "prometheus", UID: "${datasource}"}
+	metric := func(name string) string { return fmt.Sprintf("dkg_${service}_%s", name) }
+	bars := map[string]interface{}{"drawStyle": "bars", "fillOpacity": 80, "stacking": map[string]string{"mode": "normal"}}
+
+	panels := []*Panel{
+		{
+			Type:        "timeseries",
+			Title:       "Ceremonies per day",
+			Description: "Finished ceremonies by outcome",
+			GridPos:     GridPos{H: 8, W: 12, X: 0, Y: 0},
+			Targets: []Target{{
+				Expr:         fmt.Sprintf("sum by (outcome) (increase(%s[1d]))", metric("ceremonies_total")),
+				LegendFormat: "{{outcome}}",
+				Interval:     "1d",
+			}},
+			FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: "short", Custom: bars}},
+		},
+		{
+			Type:        "timeseries",
+			Title:       "Success rate",
+			Description: "Share of the ceremonies of the day that completed",
+			GridPos:     GridPos{H: 8, W: 12, X: 12, Y: 0},
+			Targets: []Target{{
+				Expr: fmt.Sprintf(`sum(increase(%[1]s{outcome="%[2]s"}[1d])) / sum(increase(%[1]s[1d]))`,
+					metric("ceremonies_total"), OutcomeCompleted),
+				LegendFormat: "success rate",
+				Interval:     "1d",
+			}},
+			FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: "percentunit", Min: &zero, Max: &one}},
+		},
+		{
+			Type:        "timeseries",
+			Title:       "Mean duration",
+			Description: "Mean time of the completed ceremonies from their start to their result",
+			GridPos:     GridPos{H: 8, W: 12, X: 0, Y: 8},
+			Targets: []Target{{
+				Expr: fmt.Sprintf(`sum(increase(%[1]s_sum{outcome="%[2]s"}[1d])) / sum(increase(%[1]s_count{outcome="%[2]s"}[1d]))`,
+					metric("ceremony_duration_seconds"), OutcomeCompleted),
+				LegendFormat: "mean duration",
+				Interval:     "1d",
+			}},
+			FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: "s"}},
+		},
+		{
+			Type:        "bargauge",
+			Title:       "Failure contribution by operator",
+			Description: "Share of the failed ceremonies of the time range each operator is a culprit of",
+			GridPos:     GridPos{H: 8, W: 12, X: 12, Y: 8},
+			Targets: []Target{{
+				Expr: fmt.Sprintf(`sum by (operator) (increase(%s[$__range])) / scalar(sum(increase(%s{outcome="%s"}[$__range])))`,
+					metric("ceremony_failures_total"), metric("ceremonies_total"), OutcomeFailed),
+				LegendFormat: "operator {{operator}}",
+				Instant:      true,
+			}},
+			FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: "percentunit", Min: &zero, Max: &one}},
+			Options:     map[string]interface{}{"orientation": "horizontal", "displayMode": "gradient"},
+		},
+		{
+			Type:        "timeseries",
+			Title:       "Failures by cause",
+			Description: "Failed ceremonies per day by the cause of the failure: invalid shares, missing messages, bad signatures, timeouts, decode failures",
+			GridPos:     GridPos{H: 8, W: 12, X: 0, Y: 16},
+			Targets: []Target{{
+				Expr:         fmt.Sprintf("sum by (cause) (increase(%s[1d]))", metric("ceremony_failure_causes_total")),
+				LegendFormat: "{{cause}}",
+				Interval:     "1d",
+			}},
+			FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: "short", Custom: bars}},
+		},
+		{
+			Type:        "timeseries",
+			Title:       "HTTP requests",
+			Description: "Requests per second by route",
+			GridPos:     GridPos{H: 8, W: 12, X: 12, Y: 16},
+			Targets: []Target{{
+				Expr:         fmt.Sprintf("sum by (route) (rate(%s[5m]))", metric("http_requests_total")),
+				LegendFormat: "{{route}}",
+			}},
+			FieldConfig: FieldConfig{Defaults: FieldDefaults{Unit: "reqps"}},
+		},
+	}
+	for i, panel := range panels {
+		panel.ID = i + 1
+		panel.Datasource = prometheus
+		for j := range panel.Targets {
+			panel.Targets[j].RefID = string(rune('A' + j))
+		}
+	}
+
+	return &Dashboard{
+		UID:           DashboardUID,
+		Title:         "RockX DKG ceremonies",
+		Tags:          []string{"dkg"},
+		SchemaVersion: 36,
+		Refresh:       "1m",
+		Time:          TimeRange{From: "now-30d", To: "now"},
+		Templating: Templating{List: []*Variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+			{
+				Name:    "service",
+				Label:   "Service",
+				Type:    "custom",
+				Query:   "node,messenger",
+				Current: map[string]string{"text": "node", "value": "node"},
+				Options: []VariableOption{{Text: "node", Value: "node", Selected: true}, {Text: "messenger", Value: "messenger"}},
+			},
+		}},
+		Panels: panels,
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package stats
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	OutcomeCompleted = "completed"
+	OutcomeFailed    = "failed"
+)
+
+// Metrics count the finished ceremonies of a service for the dashboard, the
+// stats endpoints cover the history from before the last restart
+type Metrics struct {
+	ceremonies *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	failures   *prometheus.CounterVec
+	causes     *prometheus.CounterVec
+}
+
+// NewMetrics names the metrics after the service, e.g. dkg_node_ceremonies_total
+func NewMetrics(service string) *Metrics {
+	return &Metrics{
+		ceremonies: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: fmt.Sprintf("dkg_%s_ceremonies_total", service),
+			Help: "Finished ceremonies by outcome",
+		}, []string{"outcome"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    fmt.Sprintf("dkg_%s_ceremony_duration_seconds", service),
+			Help:    "Time from the start of a ceremony to its result by outcome",
+			Buckets: []float64{1, 2, 5, 10, 20, 30, 60, 120, 300, 600},
+		}, []string{"outcome"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: fmt.Sprintf("dkg_%s_ceremony_failures_total", service),
+			Help: "Failed ceremonies by the operator they are attributed to",
+		}, []string{"operator"}),
+		causes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: fmt.Sprintf("dkg_%s_ceremony_failure_causes_total", service),
+			Help: "Failed ceremonies by the cause of the failure",
+		}, []string{"cause"}),
+	}
+}
+
+func (m *Metrics) Observe(s Sample) {
+	outcome := OutcomeCompleted
+	if !s.Completed {
+		outcome = OutcomeFailed
+	}
+	m.ceremonies.WithLabelValues(outcome).Inc()
+	m.duration.WithLabelValues(outcome).Observe(s.Duration().Seconds())
+	if !s.Completed {
+		m.causes.WithLabelValues(string(s.cause())).Inc()
+	}
+	for _, operatorID := range s.Culprits {
+		m.failures.WithLabelValues(strconv.FormatUint(uint64(operatorID), 10)).Inc()
+	}
+}
+
+// ObserveCeremony is a tracker listener counting the ceremonies of a node as
+// they reach a terminal state
+func (m *Metrics) ObserveCeremony(c *ceremony.Ceremony, e *ceremony.Event) {
+	if e.Type.IsProgress() {
+		return
+	}
+	if s, ok := FromCeremony(c); ok {
+		m.Observe(s)
+	}
+}
+
+func (m *Metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.ceremonies, m.duration, m.failures, m.causes}
+}
@@ -0,0 +1,99 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// DefaultRecorderSize is how many finished ceremonies a recorder keeps
+const DefaultRecorderSize = 10000
+
+// Recorder keeps the ceremonies the messenger relayed, from the creation of
+// their topic to their result. The messenger has no storage, the recorder
+// forgets the oldest ceremonies first and everything on a restart.
+type Recorder struct {
+	Metrics *Metrics
+
+	mu       sync.Mutex
+	size     int
+	started  map[string]time.Time
+	finished []Sample
+}
+
+func NewRecorder(size int) *Recorder {
+	if size <= 0 {
+		size = DefaultRecorderSize
+	}
+	return &Recorder{size: size, started: make(map[string]time.Time)}
+}
+
+// Start marks the start of the ceremony of requestID, a ceremony started
+// again starts over
+func (r *Recorder) Start(requestID string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started[requestID] = at
+	// results that never come don't grow the map without bounds
+	if len(r.started) > r.size {
+		oldest, oldestAt := "", at
+		for id, startedAt := range r.started {
+			if startedAt.Before(oldestAt) {
+				oldest, oldestAt = id, startedAt
+			}
+		}
+		delete(r.started, oldest)
+	}
+}
+
+// Finish records the result of a started ceremony, the results of the other
+// operators of a ceremony and of ceremonies that weren't started are ignored
+func (r *Recorder) Finish(requestID string, completed bool, cause ceremony.Cause, culprits []types.OperatorID, at time.Time) {
+	r.mu.Lock()
+	startedAt, ok := r.started[requestID]
+	if !ok {
+		r.mu.Unlock()
+		return
+	}
+	delete(r.started, requestID)
+	s := Sample{RequestID: requestID, Start: startedAt, End: at, Completed: completed, Cause: cause, Culprits: culprits}
+	r.finished = append(r.finished, s)
+	if len(r.finished) > r.size {
+		r.finished = append([]Sample(nil), r.finished[len(r.finished)-r.size:]...)
+	}
+	r.mu.Unlock()
+
+	if r.Metrics != nil {
+		r.Metrics.Observe(s)
+	}
+}
+
+// Samples are the finished ceremonies, the oldest first
+func (r *Recorder) Samples() []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Sample(nil), r.finished...)
+}
@@ -0,0 +1,238 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package stats aggregates the ceremonies a node or the messenger saw into
+// daily statistics and the prometheus metrics the grafana dashboard reads
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+const (
+	// DefaultDays is the window of the stats when none is asked for
+	DefaultDays = 30
+	// MaxDays bounds the window of the stats
+	MaxDays = 365
+
+	dayLayout = "2006-01-02"
+)
+
+// Sample is a finished ceremony as counted by the stats
+type Sample struct {
+	RequestID string
+	Start     time.Time
+	End       time.Time
+	Completed bool
+	// Cause categorizes why a failed ceremony failed
+	Cause ceremony.Cause
+	// Culprits are the operators a failed ceremony is attributed to: the
+	// target of its blame, the operators missing when it timed out and the
+	// peers that didn't answer re-requests
+	Culprits []types.OperatorID
+}
+
+func (s Sample) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// cause is the cause of a failed sample, other when it wasn't categorized
+func (s Sample) cause() ceremony.Cause {
+	if s.Cause == "" {
+		return ceremony.CauseOther
+	}
+	return s.Cause
+}
+
+// DayStats are the ceremonies started on one UTC day, or in the whole window
+// for the totals
+type DayStats struct {
+	Day        string `json:"day,omitempty"`
+	Ceremonies int    `json:"ceremonies"`
+	Completed  int    `json:"completed"`
+	Failed     int    `json:"failed"`
+	// SuccessRate is the share of the ceremonies that completed, 0 without any
+	SuccessRate float64 `json:"success_rate"`
+	// MeanDurationSeconds is the mean time of the completed ceremonies from
+	// their start to their result, failed ones end at a timeout
+	MeanDurationSeconds float64 `json:"mean_duration_seconds"`
+
+	completedSeconds float64
+}
+
+// OperatorFailures is how many failed ceremonies of the window an operator is
+// a culprit of
+type OperatorFailures struct {
+	Operator types.OperatorID `json:"operator"`
+	Failures int              `json:"failures"`
+	// Contribution is the share of the failed ceremonies the operator is a
+	// culprit of, they add up to more than 1 when ceremonies have several
+	Contribution float64 `json:"contribution"`
+}
+
+// CauseFailures is how many failed ceremonies of the window failed for a cause
+type CauseFailures struct {
+	Cause    ceremony.Cause `json:"cause"`
+	Failures int            `json:"failures"`
+	// Share is the share of the failed ceremonies with the cause
+	Share float64 `json:"share"`
+}
+
+// Stats are the ceremonies of a window of days, up to today
+type Stats struct {
+	Since     time.Time           `json:"since"`
+	Days      []*DayStats         `json:"days"`
+	Total     *DayStats           `json:"total"`
+	Operators []*OperatorFailures `json:"operators"`
+	Causes    []*CauseFailures    `json:"causes"`
+}
+
+// Aggregate counts the samples started in the days window ending with the day
+// of now, every day of the window is listed even without ceremonies
+func Aggregate(samples []Sample, days int, now time.Time) *Stats {
+	today := now.UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, 1-days)
+	stats := &Stats{Since: since, Days: make([]*DayStats, 0, days), Total: &DayStats{}, Operators: []*OperatorFailures{}, Causes: []*CauseFailures{}}
+	byDay := make(map[string]*DayStats, days)
+	for day := since; !day.After(today); day = day.AddDate(0, 0, 1) {
+		d := &DayStats{Day: day.Format(dayLayout)}
+		stats.Days = append(stats.Days, d)
+		byDay[d.Day] = d
+	}
+
+	failures := make(map[types.OperatorID]int)
+	causes := make(map[ceremony.Cause]int)
+	for _, s := range samples {
+		d, ok := byDay[s.Start.UTC().Format(dayLayout)]
+		if !ok {
+			continue
+		}
+		for _, counted := range []*DayStats{d, stats.Total} {
+			counted.add(s)
+		}
+		if !s.Completed {
+			causes[s.cause()]++
+			for _, operatorID := range s.Culprits {
+				failures[operatorID]++
+			}
+		}
+	}
+	for _, d := range append(stats.Days, stats.Total) {
+		d.finish()
+	}
+
+	for operatorID, count := range failures {
+		stats.Operators = append(stats.Operators, &OperatorFailures{
+			Operator:     operatorID,
+			Failures:     count,
+			Contribution: float64(count) / float64(stats.Total.Failed),
+		})
+	}
+	sort.Slice(stats.Operators, func(i, j int) bool {
+		if stats.Operators[i].Failures != stats.Operators[j].Failures {
+			return stats.Operators[i].Failures > stats.Operators[j].Failures
+		}
+		return stats.Operators[i].Operator < stats.Operators[j].Operator
+	})
+
+	for cause, count := range causes {
+		stats.Causes = append(stats.Causes, &CauseFailures{
+			Cause:    cause,
+			Failures: count,
+			Share:    float64(count) / float64(stats.Total.Failed),
+		})
+	}
+	sort.Slice(stats.Causes, func(i, j int) bool {
+		if stats.Causes[i].Failures != stats.Causes[j].Failures {
+			return stats.Causes[i].Failures > stats.Causes[j].Failures
+		}
+		return stats.Causes[i].Cause < stats.Causes[j].Cause
+	})
+	return stats
+}
+
+func (d *DayStats) add(s Sample) {
+	d.Ceremonies++
+	if s.Completed {
+		d.Completed++
+		d.completedSeconds += s.Duration().Seconds()
+	} else {
+		d.Failed++
+	}
+}
+
+func (d *DayStats) finish() {
+	if d.Ceremonies > 0 {
+		d.SuccessRate = float64(d.Completed) / float64(d.Ceremonies)
+	}
+	if d.Completed > 0 {
+		d.MeanDurationSeconds = d.completedSeconds / float64(d.Completed)
+	}
+}
+
+// ParseDays reads the ?days= window of a stats request, DefaultDays when empty
+func ParseDays(value string) (int, error) {
+	if value == "" {
+		return DefaultDays, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days <= 0 || days > MaxDays {
+		return 0, fmt.Errorf("days must be between 1 and %d", MaxDays)
+	}
+	return days, nil
+}
+
+// FromCeremony is the sample of a ceremony as seen by a node, false while it
+// isn't finished
+func FromCeremony(c *ceremony.Ceremony) (Sample, bool) {
+	if !c.State.IsTerminal() {
+		return Sample{}, false
+	}
+	s := Sample{RequestID: c.RequestID, Start: c.CreatedAt, End: c.UpdatedAt, Completed: c.State == ceremony.StateCompleted, Cause: c.Cause}
+	if s.Completed {
+		return s, true
+	}
+
+	culprits := make(map[types.OperatorID]bool)
+	for _, e := range c.Events {
+		switch e.Type {
+		case ceremony.EventBlamed, ceremony.EventPeerUnresponsive:
+			if e.Operator != 0 {
+				culprits[e.Operator] = true
+			}
+		case ceremony.EventTimedOut:
+			for _, operatorID := range e.Missing {
+				culprits[operatorID] = true
+			}
+		}
+	}
+	for operatorID := range culprits {
+		s.Culprits = append(s.Culprits, operatorID)
+	}
+	sort.Slice(s.Culprits, func(i, j int) bool { return s.Culprits[i] < s.Culprits[j] })
+	return s, true
+}
@@ -0,0 +1,162 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package stats
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregate(t *testing.T) {
+	now := time.Date(2023, 4, 3, 15, 0, 0, 0, time.UTC)
+	at := func(day, hour int) time.Time { return time.Date(2023, 4, day, hour, 0, 0, 0, time.UTC) }
+	samples := []Sample{
+		{Start: at(1, 10), End: at(1, 10).Add(10 * time.Second), Completed: true},
+		{Start: at(1, 11), End: at(1, 11).Add(30 * time.Second), Completed: true},
+		{Start: at(1, 12), End: at(1, 12).Add(time.Minute), Cause: ceremony.CauseMissingMessage, Culprits: []types.OperatorID{3}},
+		{Start: at(3, 9), End: at(3, 9).Add(time.Minute), Culprits: []types.OperatorID{2, 3}},
+		// before the window
+		{Start: at(1, 12).AddDate(0, 0, -3), End: at(1, 13), Culprits: []types.OperatorID{4}},
+	}
+
+	stats := Aggregate(samples, 3, now)
+	require.Equal(t, at(1, 0), stats.Since)
+	require.Len(t, stats.Days, 3, "days without ceremonies are listed")
+	require.Equal(t, &DayStats{Day: "2023-04-01", Ceremonies: 3, Completed: 2, Failed: 1, SuccessRate: 2.0 / 3, MeanDurationSeconds: 20, completedSeconds: 40}, stats.Days[0])
+	require.Equal(t, &DayStats{Day: "2023-04-02"}, stats.Days[1])
+	require.Equal(t, 1, stats.Days[2].Failed)
+	require.Equal(t, 0.0, stats.Days[2].SuccessRate)
+	require.Equal(t, 4, stats.Total.Ceremonies)
+	require.Equal(t, 0.5, stats.Total.SuccessRate)
+
+	require.Equal(t, []*OperatorFailures{
+		{Operator: 3, Failures: 2, Contribution: 1},
+		{Operator: 2, Failures: 1, Contribution: 0.5},
+	}, stats.Operators)
+	require.Equal(t, []*CauseFailures{
+		{Cause: ceremony.CauseMissingMessage, Failures: 1, Share: 0.5},
+		{Cause: ceremony.CauseOther, Failures: 1, Share: 0.5},
+	}, stats.Causes, "failures without a cause count as other")
+}
+
+func TestFromCeremony(t *testing.T) {
+	created := time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC)
+	c := ceremony.New("abcd")
+	apply := func(e *ceremony.Event) {
+		e.Seq = uint64(len(c.Events) + 1)
+		require.NoError(t, c.Apply(e))
+	}
+	apply(&ceremony.Event{Type: ceremony.EventCreated, Time: created, Params: &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3, 4}}})
+	apply(&ceremony.Event{Type: ceremony.EventInitialized, Time: created})
+	_, ok := FromCeremony(c)
+	require.False(t, ok, "running ceremonies aren't counted")
+
+	apply(&ceremony.Event{Type: ceremony.EventPeerUnresponsive, Time: created, Operator: 4})
+	apply(&ceremony.Event{Type: ceremony.EventTimedOut, Time: created.Add(time.Minute), Missing: []types.OperatorID{4, 2}})
+	s, ok := FromCeremony(c)
+	require.True(t, ok)
+	require.False(t, s.Completed)
+	require.Equal(t, time.Minute, s.Duration())
+	require.Equal(t, []types.OperatorID{2, 4}, s.Culprits)
+	require.Equal(t, ceremony.CauseMissingMessage, s.Cause)
+}
+
+func TestParseDays(t *testing.T) {
+	days, err := ParseDays("")
+	require.NoError(t, err)
+	require.Equal(t, DefaultDays, days)
+	days, err = ParseDays("7")
+	require.NoError(t, err)
+	require.Equal(t, 7, days)
+	for _, value := range []string{"0", "-1", "week", "366"} {
+		_, err := ParseDays(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(2)
+	r.Metrics = NewMetrics("test")
+	start := time.Unix(1700000000, 0)
+
+	r.Finish("unknown", true, "", nil, start)
+	require.Empty(t, r.Samples(), "results of ceremonies that weren't started are ignored")
+
+	for _, id := range []string{"a", "b", "c"} {
+		r.Start(id, start)
+		start = start.Add(time.Second)
+	}
+	r.Finish("a", true, "", nil, start)
+	require.Empty(t, r.Samples(), "the oldest started ceremony was dropped")
+
+	r.Finish("b", true, "", nil, start)
+	r.Finish("b", true, "", nil, start)
+	r.Start("d", start)
+	r.Finish("c", false, ceremony.CauseInvalidShare, []types.OperatorID{2}, start)
+	r.Finish("d", true, "", nil, start.Add(time.Second))
+	samples := r.Samples()
+	require.Len(t, samples, 2, "only the newest samples are kept")
+	require.Equal(t, "c", samples[0].RequestID)
+	require.Equal(t, time.Second, samples[0].Duration())
+	require.Equal(t, "d", samples[1].RequestID)
+
+	require.Equal(t, 2.0, testutil.ToFloat64(r.Metrics.ceremonies.WithLabelValues(OutcomeCompleted)))
+	require.Equal(t, 1.0, testutil.ToFloat64(r.Metrics.ceremonies.WithLabelValues(OutcomeFailed)))
+	require.Equal(t, 1.0, testutil.ToFloat64(r.Metrics.failures.WithLabelValues("2")))
+	require.Equal(t, 1.0, testutil.ToFloat64(r.Metrics.causes.WithLabelValues(string(ceremony.CauseInvalidShare))))
+}
+
+func TestDashboardQueriesMetrics(t *testing.T) {
+	data, err := json.Marshal(NewDashboard())
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"uid":"rockx-dkg-ceremonies"`)
+
+	// every metric a panel queries is one the services export
+	registry := prometheus.NewRegistry()
+	metrics := NewMetrics("node")
+	registry.MustRegister(metrics.Collectors()...)
+	metrics.Observe(Sample{Completed: false, Culprits: []types.OperatorID{1}})
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	exported := map[string]bool{"dkg_node_http_requests_total": true}
+	for _, family := range families {
+		exported[family.GetName()] = true
+	}
+	for _, panel := range NewDashboard().Panels {
+		for _, target := range panel.Targets {
+			expr := strings.ReplaceAll(target.Expr, "${service}", "node")
+			found := false
+			for name := range exported {
+				found = found || strings.Contains(expr, name)
+			}
+			require.True(t, found, "panel %q queries no exported metric", panel.Title)
+		}
+	}
+}
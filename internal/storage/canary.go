@@ -0,0 +1,96 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+const canaryBase = "canary/"
+
+// CanaryShare marks the share of a canary keygen, it is deleted once it expires
+type CanaryShare struct {
+	ValidatorPK string `json:"validator_pk"`
+	RequestID   string `json:"request_id"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+func canaryKey(pk types.ValidatorPK) []byte {
+	return []byte(canaryBase + hex.EncodeToString(pk))
+}
+
+func (s *Storage) SaveCanaryShare(canary *CanaryShare) error {
+	pk, err := hexenc.ParseValidatorPK(canary.ValidatorPK)
+	if err != nil {
+		return fmt.Errorf("failed to decode validator pk :: %s", err.Error())
+	}
+	value, err := json.Marshal(canary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal canary share :: %s", err.Error())
+	}
+	return s.db.Update(func(txn Txn) error {
+		return txn.Set(canaryKey(pk), value)
+	})
+}
+
+// IsCanaryShare reports whether the share of the validator comes from a canary keygen
+func (s *Storage) IsCanaryShare(pk types.ValidatorPK) (bool, error) {
+	_, err := s.get(canaryKey(pk))
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Storage) ListCanaryShares() ([]*CanaryShare, error) {
+	canaries := make([]*CanaryShare, 0)
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(canaryBase), func(_, val []byte) error {
+			canary := &CanaryShare{}
+			if err := json.Unmarshal(val, canary); err != nil {
+				return fmt.Errorf("failed to unmarshal canary share :: %s", err.Error())
+			}
+			canaries = append(canaries, canary)
+			return nil
+		})
+	})
+	return canaries, err
+}
+
+// DeleteCanaryShare deletes the share of a canary keygen together with its
+// index entries and the canary mark
+func (s *Storage) DeleteCanaryShare(pk types.ValidatorPK) error {
+	return s.db.Update(func(txn Txn) error {
+		if err := txn.Delete([]byte(pk)); err != nil {
+			return err
+		}
+		if err := unindexShare(txn, pk); err != nil {
+			return err
+		}
+		return txn.Delete(canaryKey(pk))
+	})
+}
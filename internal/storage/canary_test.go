@@ -0,0 +1,63 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteCanaryShare(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+	canary := testKeyGenOutput(1, 2, 3, 4)
+	kept := testKeyGenOutput(1, 2, 3, 4)
+	require.NoError(t, s.SaveKeyGenOutput(canary))
+	require.NoError(t, s.SaveKeyGenOutput(kept))
+	require.NoError(t, s.SaveCanaryShare(&CanaryShare{ValidatorPK: hex.EncodeToString(canary.ValidatorPK), RequestID: "aa", ExpiresAt: 1}))
+
+	isCanary, err := s.IsCanaryShare(canary.ValidatorPK)
+	require.NoError(t, err)
+	require.True(t, isCanary)
+	isCanary, err = s.IsCanaryShare(kept.ValidatorPK)
+	require.NoError(t, err)
+	require.False(t, isCanary)
+	canaries, err := s.ListCanaryShares()
+	require.NoError(t, err)
+	require.Len(t, canaries, 1)
+
+	require.NoError(t, s.DeleteCanaryShare(canary.ValidatorPK))
+	_, err = s.GetKeyGenOutput(canary.ValidatorPK)
+	require.Error(t, err)
+	_, err = s.GetKeyGenOutput(kept.ValidatorPK)
+	require.NoError(t, err)
+	canaries, err = s.ListCanaryShares()
+	require.NoError(t, err)
+	require.Empty(t, canaries)
+
+	shares, _, err := s.ListByOperator(1, ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, shares, 1, "the index of the canary share is gone")
+	require.Equal(t, types.ValidatorPK(kept.ValidatorPK), shares[0].ValidatorPK)
+}
@@ -0,0 +1,106 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+)
+
+const ceremonyKeyBase = "ceremony/"
+
+func ceremonyEventPrefix(requestID string) []byte {
+	return []byte(fmt.Sprintf("%s%s/event/", ceremonyKeyBase, requestID))
+}
+
+func ceremonyEventKey(requestID string, seq uint64) []byte {
+	return []byte(fmt.Sprintf("%s%s/event/%020d", ceremonyKeyBase, requestID, seq))
+}
+
+func (s *Storage) AppendCeremonyEvent(requestID string, e *ceremony.Event) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ceremony event :: %s", err.Error())
+	}
+	return s.db.Update(func(txn Txn) error {
+		key := ceremonyEventKey(requestID, e.Seq)
+		if _, err := txn.Get(key); err == nil {
+			return fmt.Errorf("ceremony event %d for %s already exists", e.Seq, requestID)
+		} else if err != ErrKeyNotFound {
+			return err
+		}
+		if err := txn.Set(key, value); err != nil {
+			return err
+		}
+		if err := indexCeremonyState(txn, requestID, e.Type); err != nil {
+			return err
+		}
+		if err := indexLineage(txn, requestID, e); err != nil {
+			return err
+		}
+		return indexUsage(txn, requestID, e)
+	})
+}
+
+func (s *Storage) GetCeremonyEvents(requestID string) ([]*ceremony.Event, error) {
+	events := make([]*ceremony.Event, 0)
+	prefix := ceremonyEventPrefix(requestID)
+
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate(prefix, func(_, val []byte) error {
+			e := &ceremony.Event{}
+			if err := json.Unmarshal(val, e); err != nil {
+				return fmt.Errorf("failed to unmarshal ceremony event :: %s", err.Error())
+			}
+			events = append(events, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ceremony.ErrCeremonyNotFound
+	}
+	return events, nil
+}
+
+// ListCeremonyIDs returns the request ID of every ceremony with stored events
+func (s *Storage) ListCeremonyIDs() ([]string, error) {
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(ceremonyKeyBase), func(key, _ []byte) error {
+			requestID := strings.SplitN(strings.TrimPrefix(string(key), ceremonyKeyBase), "/", 2)[0]
+			if !seen[requestID] {
+				seen[requestID] = true
+				ids = append(ids, requestID)
+			}
+			return nil
+		})
+	})
+	return ids, err
+}
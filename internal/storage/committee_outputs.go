@@ -0,0 +1,73 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+)
+
+func committeeOutputsKey(requestID string) []byte {
+	return []byte(fmt.Sprintf("committee-outputs/%s", requestID))
+}
+
+// UpdateCommitteeOutputs applies update to the committee outputs stored for
+// the request, or to new ones when none were stored yet, in one transaction
+func (s *Storage) UpdateCommitteeOutputs(requestID string, update func(*observer.CommitteeOutputs) error) error {
+	return s.db.Update(func(txn Txn) error {
+		outputs := observer.NewCommitteeOutputs(requestID, nil)
+		val, err := txn.Get(committeeOutputsKey(requestID))
+		if err == nil {
+			if err := json.Unmarshal(val, outputs); err != nil {
+				return fmt.Errorf("failed to unmarshal committee outputs :: %s", err.Error())
+			}
+		} else if err != ErrKeyNotFound {
+			return err
+		}
+
+		if err := update(outputs); err != nil {
+			return err
+		}
+		value, err := json.Marshal(outputs)
+		if err != nil {
+			return fmt.Errorf("failed to marshal committee outputs :: %s", err.Error())
+		}
+		return txn.Set(committeeOutputsKey(requestID), value)
+	})
+}
+
+func (s *Storage) GetCommitteeOutputs(requestID string) (*observer.CommitteeOutputs, error) {
+	val, err := s.get(committeeOutputsKey(requestID))
+	if err == ErrKeyNotFound {
+		return nil, observer.ErrNoCommitteeOutputs
+	} else if err != nil {
+		return nil, err
+	}
+
+	outputs := &observer.CommitteeOutputs{}
+	if err := json.Unmarshal(val, outputs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal committee outputs :: %s", err.Error())
+	}
+	return outputs, nil
+}
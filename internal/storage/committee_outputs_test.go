@@ -0,0 +1,58 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitteeOutputs(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+
+	_, err := s.GetCommitteeOutputs("abc")
+	require.ErrorIs(t, err, observer.ErrNoCommitteeOutputs)
+
+	for _, operatorID := range []types.OperatorID{1, 2} {
+		require.NoError(t, s.UpdateCommitteeOutputs("abc", func(outputs *observer.CommitteeOutputs) error {
+			outputs.Operators = []types.OperatorID{1, 2, 3}
+			outputs.Outputs[operatorID] = &dkg.SignedOutput{Signer: operatorID, Data: &dkg.Output{ValidatorPubKey: []byte{1}}}
+			return nil
+		}))
+	}
+	// a failed update leaves the stored outputs alone
+	require.Error(t, s.UpdateCommitteeOutputs("abc", func(outputs *observer.CommitteeOutputs) error {
+		outputs.Outputs[3] = &dkg.SignedOutput{Signer: 3}
+		return errors.New("refused")
+	}))
+
+	outputs, err := s.GetCommitteeOutputs("abc")
+	require.NoError(t, err)
+	require.Len(t, outputs.Outputs, 2)
+	require.Equal(t, types.ValidatorPK{1}, outputs.Outputs[2].Data.ValidatorPubKey)
+	require.Equal(t, []types.OperatorID{3}, outputs.Missing())
+}
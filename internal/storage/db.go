@@ -0,0 +1,140 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"github.com/dgraph-io/badger/v3"
+)
+
+// ErrKeyNotFound is returned by Txn.Get for missing keys whatever the backend
+var ErrKeyNotFound = badger.ErrKeyNotFound
+
+// DB is the key value store behind Storage. Badger is the default, a shared
+// SQL database lets two nodes of the same operator use the same data.
+type DB interface {
+	View(fn func(txn Txn) error) error
+	// Update runs fn in a read-write transaction, again when it conflicts
+	// with a concurrent one, see RetryPolicy
+	Update(fn func(txn Txn) error) error
+	// Batch writes many keys at once, faster than an Update per key for bulk
+	// writes. It doesn't read and isn't atomic on badger: a failing batch
+	// can leave some of its keys written.
+	Batch(fn func(w Writer) error) error
+	Close() error
+}
+
+// Writer is the write side of a Txn, all a Batch can do
+type Writer interface {
+	Set(key, value []byte) error
+	Delete(key []byte) error
+}
+
+type Txn interface {
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	// Iterate calls fn for every key starting with prefix, in key order
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+	// IterateFrom is Iterate from the first key not before start
+	IterateFrom(prefix, start []byte, fn func(key, value []byte) error) error
+}
+
+type BadgerDB struct {
+	db    *badger.DB
+	retry RetryPolicy
+}
+
+func NewBadgerDB(db *badger.DB) *BadgerDB {
+	return &BadgerDB{db: db, retry: DefaultRetryPolicy}
+}
+
+// SetRetryPolicy replaces how conflicting updates are retried
+func (b *BadgerDB) SetRetryPolicy(policy RetryPolicy) {
+	b.retry = policy
+}
+
+func (b *BadgerDB) View(fn func(txn Txn) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn: txn})
+	})
+}
+
+func (b *BadgerDB) Update(fn func(txn Txn) error) error {
+	return b.retry.retry(func() error {
+		return b.db.Update(func(txn *badger.Txn) error {
+			return fn(&badgerTxn{txn: txn})
+		})
+	})
+}
+
+func (b *BadgerDB) Batch(fn func(w Writer) error) error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+	if err := fn(wb); err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+func (b *BadgerDB) Close() error {
+	return b.db.Close()
+}
+
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+func (t *badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func (t *badgerTxn) Set(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t *badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
+
+func (t *badgerTxn) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return t.IterateFrom(prefix, prefix, fn)
+}
+
+func (t *badgerTxn) IterateFrom(prefix, start []byte, fn func(key, value []byte) error) error {
+	it := t.txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true, PrefetchSize: 100})
+	defer it.Close()
+
+	for it.Seek(start); it.Valid(); it.Next() {
+		val, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := fn(it.Item().KeyCopy(nil), val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
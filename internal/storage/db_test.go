@@ -0,0 +1,201 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func testBadgerDB(t *testing.T) *BadgerDB {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return NewBadgerDB(db)
+}
+
+// increment reads and writes the same key from every goroutine, each
+// transaction conflicts with the ones committed while it ran
+func increment(t *testing.T, db DB, workers int) []error {
+	errs := make([]error, workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.Update(func(txn Txn) error {
+				count := 0
+				if value, err := txn.Get([]byte("counter")); err == nil {
+					count, _ = strconv.Atoi(string(value))
+				} else if err != ErrKeyNotFound {
+					return err
+				}
+				time.Sleep(time.Millisecond)
+				return txn.Set([]byte("counter"), []byte(strconv.Itoa(count+1)))
+			})
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func counter(t *testing.T, db DB) int {
+	count := 0
+	require.NoError(t, db.View(func(txn Txn) error {
+		value, err := txn.Get([]byte("counter"))
+		if err != nil {
+			return err
+		}
+		count, err = strconv.Atoi(string(value))
+		return err
+	}))
+	return count
+}
+
+func TestUpdateRetriesConflicts(t *testing.T) {
+	db := testBadgerDB(t)
+	db.SetRetryPolicy(RetryPolicy{Attempts: 100, Backoff: time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+
+	for _, err := range increment(t, db, 20) {
+		require.NoError(t, err)
+	}
+	require.Equal(t, 20, counter(t, db))
+}
+
+func TestUpdateGivesUpOnConflicts(t *testing.T) {
+	db := testBadgerDB(t)
+	db.SetRetryPolicy(RetryPolicy{Attempts: 1})
+
+	conflicts := 0
+	for _, err := range increment(t, db, 20) {
+		if err != nil {
+			require.True(t, IsConflict(err))
+			conflicts++
+		}
+	}
+	require.Greater(t, conflicts, 0)
+	require.Equal(t, 20-conflicts, counter(t, db))
+}
+
+func TestConcurrentCeremonyWrites(t *testing.T) {
+	types.InitBLS()
+	s := NewStorage(testBadgerDB(t), 1, nil)
+
+	outputs := make([]*dkg.KeyGenOutput, 8)
+	for i := range outputs {
+		share := &bls.SecretKey{}
+		share.SetByCSPRNG()
+		outputs[i] = &dkg.KeyGenOutput{
+			Share:           share,
+			ValidatorPK:     share.GetPublicKey().Serialize(),
+			OperatorPubKeys: map[types.OperatorID]*bls.PublicKey{1: share.GetPublicKey()},
+			Threshold:       3,
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, len(outputs)*21)
+	for i, output := range outputs {
+		wg.Add(1)
+		go func(i int, output *dkg.KeyGenOutput) {
+			defer wg.Done()
+			requestID := fmt.Sprintf("%048d", i)
+			for seq := uint64(0); seq < 20; seq++ {
+				errs <- s.AppendCeremonyEvent(requestID, &ceremony.Event{Seq: seq, Type: ceremony.EventMessageReceived, Operator: 2})
+			}
+			errs <- s.SaveKeyGenOutput(output)
+		}(i, output)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	for i, output := range outputs {
+		stored, err := s.GetKeyGenOutput(output.ValidatorPK)
+		require.NoError(t, err)
+		require.Equal(t, output.Share.SerializeToHexStr(), stored.Share.SerializeToHexStr())
+		events, err := s.GetCeremonyEvents(fmt.Sprintf("%048d", i))
+		require.NoError(t, err)
+		require.Len(t, events, 20)
+	}
+	shares, err := s.ListValidatorShares()
+	require.NoError(t, err)
+	require.Len(t, shares, len(outputs))
+}
+
+func TestConcurrentDuplicateCeremonyEvent(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+
+	// both read the key as missing, the retry of the second finds it written
+	wg := sync.WaitGroup{}
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.AppendCeremonyEvent("req", &ceremony.Event{Seq: 0, Type: ceremony.EventCreated})
+		}(i)
+	}
+	wg.Wait()
+	if errs[0] == nil {
+		require.Error(t, errs[1])
+	} else {
+		require.NoError(t, errs[1])
+	}
+	require.False(t, IsConflict(errs[0]) || IsConflict(errs[1]))
+}
+
+func TestBatch(t *testing.T) {
+	db := testBadgerDB(t)
+	s := NewStorage(db, 1, nil)
+
+	records := map[types.OperatorID]*OperatorRecord{}
+	for i := 1; i <= 100; i++ {
+		records[types.OperatorID(i)] = &OperatorRecord{Operator: &dkg.Operator{OperatorID: types.OperatorID(i)}, FetchedAt: int64(i)}
+	}
+	require.NoError(t, s.SaveOperatorRecords(records))
+
+	ids, err := s.ListOperatorIDs()
+	require.NoError(t, err)
+	require.Len(t, ids, 100)
+	record, err := s.GetOperatorRecord(42)
+	require.NoError(t, err)
+	require.EqualValues(t, 42, record.FetchedAt)
+
+	require.NoError(t, db.Batch(func(w Writer) error {
+		return w.Delete(operatorKey(42))
+	}))
+	_, err = s.GetOperatorRecord(42)
+	require.Equal(t, ErrKeyNotFound, err)
+}
@@ -0,0 +1,382 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Values of an encrypted storage are sealed with AES-256-GCM under a key
+// derived from the storage passphrase and the salt of the database, bound to
+// the key they are stored under. Keys stay in the clear, the listings need
+// them in order. The meta keys under encryptionBase are never encrypted.
+const (
+	encryptionBase     = "encryption/"
+	encryptionSaltKey  = "encryption/salt"
+	encryptionKeyIDKey = "encryption/key"
+	rekeyCheckpointKey = "encryption/rekey"
+)
+
+// sealedMagic starts every sealed value, followed by the id of its key and
+// the nonce
+var sealedMagic = []byte("dkgenc1:")
+
+const (
+	storageKeyIDLen = 8
+	sealedHeaderLen = 8 + storageKeyIDLen + 12
+)
+
+var (
+	ErrStorageEncrypted    = errors.New("storage is encrypted, NODE_STORAGE_PASSPHRASE is required")
+	ErrStoragePassphrase   = errors.New("the storage passphrase doesn't open the storage")
+	ErrStorageNotEncrypted = errors.New("storage isn't encrypted yet, encrypt it with node rekey-storage")
+	ErrRekeyUnfinished     = errors.New("re-keying of the storage is unfinished, run node rekey-storage again or start with both passphrases")
+)
+
+// StorageKey is a key values are sealed with, ID names it in the values
+type StorageKey struct {
+	ID   string
+	aead cipher.AEAD
+}
+
+// DeriveStorageKey derives the key of passphrase with scrypt
+func DeriveStorageKey(passphrase string, salt []byte) (*StorageKey, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(append([]byte("dkg storage key"), key...))
+	return &StorageKey{ID: hex.EncodeToString(id[:storageKeyIDLen]), aead: aead}, nil
+}
+
+func (k *StorageKey) seal(key, value []byte) ([]byte, error) {
+	sealed := make([]byte, sealedHeaderLen, sealedHeaderLen+len(value)+k.aead.Overhead())
+	copy(sealed, sealedMagic)
+	id, _ := hex.DecodeString(k.ID)
+	copy(sealed[len(sealedMagic):], id)
+	if _, err := rand.Read(sealed[len(sealedMagic)+storageKeyIDLen:]); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(sealed, sealed[len(sealedMagic)+storageKeyIDLen:], value, key), nil
+}
+
+func (k *StorageKey) open(key, sealed []byte) ([]byte, error) {
+	value, err := k.aead.Open(nil, sealed[len(sealedMagic)+storageKeyIDLen:sealedHeaderLen], sealed[sealedHeaderLen:], key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value of %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// sealedKeyID returns the id of the key value is sealed with, empty for a
+// value in the clear
+func sealedKeyID(value []byte) string {
+	if len(value) < sealedHeaderLen || !bytes.HasPrefix(value, sealedMagic) {
+		return ""
+	}
+	return hex.EncodeToString(value[len(sealedMagic) : len(sealedMagic)+storageKeyIDLen])
+}
+
+func isEncryptionMeta(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(encryptionBase))
+}
+
+// EncryptedDB seals the values written to a DB and opens the ones read from
+// it. It reads values under any of its keys, and in the clear while an
+// unencrypted storage is being encrypted, which lets a node run between the
+// batches of an interrupted re-keying.
+type EncryptedDB struct {
+	DB
+	write     *StorageKey
+	keys      map[string]*StorageKey
+	plaintext bool
+}
+
+func newEncryptedDB(db DB, write *StorageKey, plaintext bool, keys ...*StorageKey) *EncryptedDB {
+	e := &EncryptedDB{DB: db, write: write, keys: make(map[string]*StorageKey), plaintext: plaintext}
+	for _, key := range append(keys, write) {
+		if key != nil {
+			e.keys[key.ID] = key
+		}
+	}
+	return e
+}
+
+func (e *EncryptedDB) View(fn func(txn Txn) error) error {
+	return e.DB.View(func(txn Txn) error {
+		return fn(&encryptedTxn{Txn: txn, db: e})
+	})
+}
+
+func (e *EncryptedDB) Update(fn func(txn Txn) error) error {
+	return e.DB.Update(func(txn Txn) error {
+		return fn(&encryptedTxn{Txn: txn, db: e})
+	})
+}
+
+func (e *EncryptedDB) Batch(fn func(w Writer) error) error {
+	return e.DB.Batch(func(w Writer) error {
+		return fn(&encryptedWriter{Writer: w, db: e})
+	})
+}
+
+func (e *EncryptedDB) seal(key, value []byte) ([]byte, error) {
+	if e.write == nil || isEncryptionMeta(key) {
+		return value, nil
+	}
+	return e.write.seal(key, value)
+}
+
+func (e *EncryptedDB) open(key, value []byte) ([]byte, error) {
+	if isEncryptionMeta(key) {
+		return value, nil
+	}
+	id := sealedKeyID(value)
+	if id == "" {
+		if e.plaintext {
+			return value, nil
+		}
+		return nil, fmt.Errorf("value of %q isn't encrypted", key)
+	}
+	k, ok := e.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("value of %q is encrypted with unknown storage key %s", key, id)
+	}
+	return k.open(key, value)
+}
+
+type encryptedWriter struct {
+	Writer
+	db *EncryptedDB
+}
+
+func (w *encryptedWriter) Set(key, value []byte) error {
+	sealed, err := w.db.seal(key, value)
+	if err != nil {
+		return err
+	}
+	return w.Writer.Set(key, sealed)
+}
+
+type encryptedTxn struct {
+	Txn
+	db *EncryptedDB
+}
+
+func (t *encryptedTxn) Get(key []byte) ([]byte, error) {
+	value, err := t.Txn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return t.db.open(key, value)
+}
+
+func (t *encryptedTxn) Set(key, value []byte) error {
+	sealed, err := t.db.seal(key, value)
+	if err != nil {
+		return err
+	}
+	return t.Txn.Set(key, sealed)
+}
+
+func (t *encryptedTxn) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return t.Txn.Iterate(prefix, func(key, value []byte) error {
+		opened, err := t.db.open(key, value)
+		if err != nil {
+			return err
+		}
+		return fn(key, opened)
+	})
+}
+
+func (t *encryptedTxn) IterateFrom(prefix, start []byte, fn func(key, value []byte) error) error {
+	return t.Txn.IterateFrom(prefix, start, func(key, value []byte) error {
+		opened, err := t.db.open(key, value)
+		if err != nil {
+			return err
+		}
+		return fn(key, opened)
+	})
+}
+
+// RekeyCheckpoint is the progress of a re-keying, written with every batch.
+// From and To are the ids of the keys, empty for values in the clear.
+type RekeyCheckpoint struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	After     string    `json:"after,omitempty"`
+	Keys      int       `json:"keys"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// encryptionState is what the meta keys say about the storage
+type encryptionState struct {
+	salt       []byte
+	keyID      string
+	checkpoint *RekeyCheckpoint
+	// empty is set when the storage holds nothing but meta keys
+	empty bool
+}
+
+func readEncryptionState(db DB) (*encryptionState, error) {
+	state := &encryptionState{empty: true}
+	err := db.View(func(txn Txn) error {
+		salt, err := txn.Get([]byte(encryptionSaltKey))
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+		state.salt = salt
+		keyID, err := txn.Get([]byte(encryptionKeyIDKey))
+		if err != nil && err != ErrKeyNotFound {
+			return err
+		}
+		state.keyID = string(keyID)
+		checkpoint, err := txn.Get([]byte(rekeyCheckpointKey))
+		if err == nil {
+			state.checkpoint = &RekeyCheckpoint{}
+			if err := json.Unmarshal(checkpoint, state.checkpoint); err != nil {
+				return fmt.Errorf("failed to unmarshal re-keying checkpoint :: %s", err.Error())
+			}
+		} else if err != ErrKeyNotFound {
+			return err
+		}
+		err = txn.Iterate(nil, func(key, _ []byte) error {
+			if isEncryptionMeta(key) {
+				return nil
+			}
+			state.empty = false
+			return errStopIteration
+		})
+		if err == errStopIteration {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// storageKeys derives the keys of the passphrases with the salt of the
+// storage, creating the salt of a storage that has none. An empty passphrase
+// has no key.
+func storageKeys(db DB, state *encryptionState, passphrases ...string) ([]*StorageKey, error) {
+	if state.salt == nil {
+		state.salt = make([]byte, 32)
+		if _, err := rand.Read(state.salt); err != nil {
+			return nil, err
+		}
+		if err := db.Update(func(txn Txn) error {
+			return txn.Set([]byte(encryptionSaltKey), state.salt)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to store storage salt: %w", err)
+		}
+	}
+	keys := make([]*StorageKey, len(passphrases))
+	for i, passphrase := range passphrases {
+		if passphrase == "" {
+			continue
+		}
+		key, err := DeriveStorageKey(passphrase, state.salt)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+func storageKeyID(key *StorageKey) string {
+	if key == nil {
+		return ""
+	}
+	return key.ID
+}
+
+// OpenEncrypted opens db with the storage passphrase, and the previous one
+// while a re-keying is unfinished. Without passphrases an unencrypted storage
+// is returned as it is and an encrypted one is refused. An empty storage is
+// encrypted from the start.
+func OpenEncrypted(db DB, passphrase, oldPassphrase string) (DB, error) {
+	state, err := readEncryptionState(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage encryption: %w", err)
+	}
+	if passphrase == "" && oldPassphrase == "" {
+		if state.keyID != "" || state.checkpoint != nil {
+			return nil, ErrStorageEncrypted
+		}
+		return db, nil
+	}
+	keys, err := storageKeys(db, state, passphrase, oldPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	current, old := keys[0], keys[1]
+
+	if cp := state.checkpoint; cp != nil {
+		if cp.To != storageKeyID(current) || cp.From != storageKeyID(old) {
+			return nil, ErrRekeyUnfinished
+		}
+		return newEncryptedDB(db, current, cp.From == "" || cp.To == "", old), nil
+	}
+	if current == nil {
+		return nil, fmt.Errorf("NODE_STORAGE_PASSPHRASE is required, the old passphrase only opens a storage while it is re-keyed")
+	}
+	switch state.keyID {
+	case current.ID:
+		return newEncryptedDB(db, current, false), nil
+	case "":
+		if !state.empty {
+			return nil, ErrStorageNotEncrypted
+		}
+		if err := db.Update(func(txn Txn) error {
+			return txn.Set([]byte(encryptionKeyIDKey), []byte(current.ID))
+		}); err != nil {
+			return nil, err
+		}
+		return newEncryptedDB(db, current, false), nil
+	case storageKeyID(old):
+		return nil, fmt.Errorf("%w: it is still under the old passphrase, run node rekey-storage", ErrStoragePassphrase)
+	}
+	return nil, ErrStoragePassphrase
+}
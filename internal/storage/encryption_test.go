@@ -0,0 +1,239 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setValues(t *testing.T, db DB, n int) map[string]string {
+	values := make(map[string]string, n)
+	require.NoError(t, db.Update(func(txn Txn) error {
+		for i := 0; i < n; i++ {
+			key, value := fmt.Sprintf("key/%03d", i), fmt.Sprintf(`{"value":%d}`, i)
+			values[key] = value
+			if err := txn.Set([]byte(key), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	return values
+}
+
+func requireValues(t *testing.T, db DB, values map[string]string) {
+	require.NoError(t, db.View(func(txn Txn) error {
+		for key, value := range values {
+			got, err := txn.Get([]byte(key))
+			require.NoError(t, err)
+			require.Equal(t, value, string(got), key)
+		}
+		return nil
+	}))
+}
+
+func rawValue(t *testing.T, db DB, key string) []byte {
+	var value []byte
+	require.NoError(t, db.View(func(txn Txn) error {
+		var err error
+		value, err = txn.Get([]byte(key))
+		return err
+	}))
+	return value
+}
+
+func TestOpenEncrypted(t *testing.T) {
+	raw := testBadgerDB(t)
+
+	// an empty storage is encrypted from the start
+	db, err := OpenEncrypted(raw, "one", "")
+	require.NoError(t, err)
+	values := setValues(t, db, 3)
+	requireValues(t, db, values)
+	require.NotEmpty(t, sealedKeyID(rawValue(t, raw, "key/000")))
+	require.NotContains(t, string(rawValue(t, raw, "key/000")), "value")
+
+	_, err = OpenEncrypted(raw, "", "")
+	require.ErrorIs(t, err, ErrStorageEncrypted)
+	_, err = OpenEncrypted(raw, "two", "")
+	require.ErrorIs(t, err, ErrStoragePassphrase)
+	db, err = OpenEncrypted(raw, "one", "")
+	require.NoError(t, err)
+	requireValues(t, db, values)
+
+	// a value is bound to its key
+	require.NoError(t, raw.Update(func(txn Txn) error {
+		return txn.Set([]byte("key/001"), rawValue(t, raw, "key/000"))
+	}))
+	require.Error(t, db.View(func(txn Txn) error {
+		_, err := txn.Get([]byte("key/001"))
+		return err
+	}))
+
+	// an unencrypted storage stays as it is until rekey-storage encrypts it
+	plain := testBadgerDB(t)
+	setValues(t, plain, 1)
+	db, err = OpenEncrypted(plain, "", "")
+	require.NoError(t, err)
+	require.Equal(t, DB(plain), db)
+	_, err = OpenEncrypted(plain, "one", "")
+	require.ErrorIs(t, err, ErrStorageNotEncrypted)
+}
+
+func TestRekey(t *testing.T) {
+	raw := testBadgerDB(t)
+	values := setValues(t, raw, 10)
+
+	// encrypt the storage, then rotate the passphrase
+	result, err := Rekey(raw, "", "one", 3, nil)
+	require.NoError(t, err)
+	require.Equal(t, 10, result.Keys)
+	require.Equal(t, 10, result.Verified)
+	db, err := OpenEncrypted(raw, "one", "")
+	require.NoError(t, err)
+	requireValues(t, db, values)
+
+	_, err = Rekey(raw, "two", "three", 3, nil)
+	require.ErrorIs(t, err, ErrStoragePassphrase)
+	_, err = Rekey(raw, "one", "one", 3, nil)
+	require.Error(t, err)
+
+	var progress []int
+	result, err = Rekey(raw, "one", "two", 4, func(done int) { progress = append(progress, done) })
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 8, 10}, progress)
+	require.Equal(t, result.To, sealedKeyID(rawValue(t, raw, "key/009")))
+	_, err = OpenEncrypted(raw, "one", "")
+	require.ErrorIs(t, err, ErrStoragePassphrase)
+	db, err = OpenEncrypted(raw, "two", "")
+	require.NoError(t, err)
+	requireValues(t, db, values)
+
+	// and back to the clear
+	_, err = Rekey(raw, "two", "", 4, nil)
+	require.NoError(t, err)
+	requireValues(t, raw, values)
+	db, err = OpenEncrypted(raw, "", "")
+	require.NoError(t, err)
+	require.Equal(t, DB(raw), db)
+}
+
+func TestRekeyResumes(t *testing.T) {
+	raw := testBadgerDB(t)
+	values := setValues(t, raw, 10)
+	_, err := Rekey(raw, "", "one", 0, nil)
+	require.NoError(t, err)
+
+	// a run that crashed after its first batch
+	state, err := readEncryptionState(raw)
+	require.NoError(t, err)
+	keys, err := storageKeys(raw, state, "one", "two")
+	require.NoError(t, err)
+	checkpoint := &RekeyCheckpoint{From: keys[0].ID, To: keys[1].ID}
+	require.NoError(t, setRekeyCheckpoint(raw, checkpoint))
+	require.Panics(t, func() {
+		_ = rekeyValues(raw, checkpoint, keys[0], keys[1], 4, func(int) { panic("crash") })
+	})
+	require.Equal(t, keys[1].ID, sealedKeyID(rawValue(t, raw, "key/000")))
+	require.Equal(t, keys[0].ID, sealedKeyID(rawValue(t, raw, "key/009")))
+
+	// the node runs on both passphrases in between, and writes under the new one
+	_, err = OpenEncrypted(raw, "two", "")
+	require.ErrorIs(t, err, ErrRekeyUnfinished)
+	db, err := OpenEncrypted(raw, "two", "one")
+	require.NoError(t, err)
+	requireValues(t, db, values)
+	require.NoError(t, db.Update(func(txn Txn) error {
+		values["key/999"] = "written in between"
+		return txn.Set([]byte("key/999"), []byte(values["key/999"]))
+	}))
+	require.Equal(t, keys[1].ID, sealedKeyID(rawValue(t, raw, "key/999")))
+
+	var progress []int
+	result, err := Rekey(raw, "one", "two", 4, func(done int) { progress = append(progress, done) })
+	require.NoError(t, err)
+	require.Equal(t, []int{8, 11}, progress)
+	require.Equal(t, 11, result.Verified)
+	db, err = OpenEncrypted(raw, "two", "")
+	require.NoError(t, err)
+	requireValues(t, db, values)
+}
+
+func TestRekeyRefusesUnknownKey(t *testing.T) {
+	raw := testBadgerDB(t)
+	setValues(t, raw, 10)
+	_, err := Rekey(raw, "", "one", 0, nil)
+	require.NoError(t, err)
+
+	// a value under a key neither passphrase opens is found before anything is touched
+	stranger, err := OpenEncrypted(testBadgerDB(t), "stranger", "")
+	require.NoError(t, err)
+	setValues(t, stranger, 1)
+	sealed := rawValue(t, stranger.(*EncryptedDB).DB, "key/000")
+	require.NoError(t, raw.Update(func(txn Txn) error {
+		return txn.Set([]byte("key/005"), sealed)
+	}))
+
+	_, err = Rekey(raw, "one", "two", 2, nil)
+	require.ErrorContains(t, err, "unknown storage key")
+	state, err := readEncryptionState(raw)
+	require.NoError(t, err)
+	require.Nil(t, state.checkpoint)
+	require.NotEqual(t, sealedKeyID(sealed), sealedKeyID(rawValue(t, raw, "key/000")))
+}
+
+func TestRekeyRollsBack(t *testing.T) {
+	raw := testBadgerDB(t)
+	values := setValues(t, raw, 10)
+	_, err := Rekey(raw, "", "one", 0, nil)
+	require.NoError(t, err)
+	state, err := readEncryptionState(raw)
+	require.NoError(t, err)
+	keys, err := storageKeys(raw, state, "one")
+	require.NoError(t, err)
+
+	// a node still running on the old passphrase writes behind the re-keying,
+	// the verification catches it and every value goes back to the old key
+	stale := newEncryptedDB(raw, keys[0], false, keys[0])
+	_, err = Rekey(raw, "one", "two", 4, func(done int) {
+		if done == 4 {
+			require.NoError(t, stale.Update(func(txn Txn) error {
+				return txn.Set([]byte("key/000"), []byte(values["key/000"]))
+			}))
+		}
+	})
+	require.ErrorContains(t, err, "rolled back")
+	require.ErrorContains(t, err, "isn't under the new passphrase")
+	state, err = readEncryptionState(raw)
+	require.NoError(t, err)
+	require.Nil(t, state.checkpoint)
+	require.Equal(t, keys[0].ID, state.keyID)
+	for key := range values {
+		require.Equal(t, keys[0].ID, sealedKeyID(rawValue(t, raw, key)))
+	}
+	db, err := OpenEncrypted(raw, "one", "")
+	require.NoError(t, err)
+	requireValues(t, db, values)
+}
@@ -39,26 +39,83 @@ import (
 	"github.com/bloxapp/ssv-spec/types"
 )
 
+// RegistryAPI is the base url of the ssv operator registry
+var RegistryAPI = "https://api.ssv.network/api/v4"
+
 func FetchOperatorByID(operatorID types.OperatorID) (*dkg.Operator, error) {
+	record, err := FetchOperator(operatorID, nil)
+	if err != nil {
+		return nil, err
+	}
+	return record.Operator, nil
+}
+
+// FetchOperator gets an operator from the registry. With a cached record the
+// request is conditional, an unchanged operator returns the cached record with
+// a new fetch time.
+func FetchOperator(operatorID types.OperatorID, cached *OperatorRecord) (*OperatorRecord, error) {
 	// Note, this is just for testing, to be removed before moving to staging
-	if isUsingHardcodedOperators() {
-		return hardCodedOperatorInfo(operatorID)
+	if UsingHardcodedOperators() {
+		operator, err := hardCodedOperatorInfo(operatorID)
+		if err != nil {
+			return nil, err
+		}
+		return &OperatorRecord{Operator: operator, FetchedAt: time.Now().Unix()}, nil
 	}
 
-	operator, err := GetOperatorFromRegistryByID(operatorID)
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s/operators/%d", RegistryAPI, Network, operatorID), nil)
 	if err != nil {
 		return nil, err
 	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := getHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		record := *cached
+		record.FetchedAt = time.Now().Unix()
+		return &record, nil
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("operator registry returned %s for operator %d", resp.Status, operatorID)
+	}
+
+	operator := new(operatorResponse)
+	if err := json.Unmarshal(respBody, operator); err != nil {
+		return nil, err
+	}
 	publicKey, err := ParsePublicKeyFromBase64(operator.PublicKey)
 	if err != nil {
 		return nil, err
 	}
+	if len(operator.Owner) < 2 {
+		return nil, fmt.Errorf("operator %d has no owner address", operatorID)
+	}
 
-	return &dkg.Operator{
-		OperatorID:       operatorID,
-		ETHAddress:       ethAddressFromHex(operator.Owner[2:]),
-		EncryptionPubKey: publicKey,
+	return &OperatorRecord{
+		Operator: &dkg.Operator{
+			OperatorID:       operatorID,
+			ETHAddress:       ethAddressFromHex(operator.Owner[2:]),
+			EncryptionPubKey: publicKey,
+		},
+		FetchedAt:    time.Now().Unix(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
 	}, nil
 }
 
@@ -70,7 +127,7 @@ type operatorResponse struct {
 
 func GetOperatorFromRegistryByID(operatorID types.OperatorID) (*operatorResponse, error) {
 	var operator = new(operatorResponse)
-	respBody, err := getResponse(fmt.Sprintf("https://api.ssv.network/api/v4/prater/operators/%d", operatorID))
+	respBody, err := getResponse(fmt.Sprintf("%s/prater/operators/%d", RegistryAPI, operatorID))
 	if err != nil {
 		return nil, err
 	}
@@ -80,11 +137,9 @@ func GetOperatorFromRegistryByID(operatorID types.OperatorID) (*operatorResponse
 	return operator, nil
 }
 
-func isUsingHardcodedOperators() bool {
-	isHardcoded := os.Getenv("USE_HARDCODED_OPERATORS")
-	if isHardcoded == "" {
-		isHardcoded = "false"
-	}
+// UsingHardcodedOperators tells whether operators come from the testing keys
+// of the dev setup instead of the registry
+func UsingHardcodedOperators() bool {
 	return os.Getenv("USE_HARDCODED_OPERATORS") == "true"
 }
 
@@ -0,0 +1,128 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+const (
+	enrollmentKeyKey      = "handover/enrollment-key"
+	handoverTombstoneBase = "handover/tombstone/"
+)
+
+var ErrShareHandedOver = errors.New("share for this validator was handed over to another node")
+
+// HandoverTombstone is kept in place of a share that was exported to another
+// node so that later lookups fail loudly instead of looking like a missing key.
+type HandoverTombstone struct {
+	ValidatorPK string `json:"validator_pk"`
+	RecordHash  string `json:"record_hash"`
+	ExportedAt  int64  `json:"exported_at"`
+}
+
+func (s *Storage) OperatorID() types.OperatorID {
+	return s.thisOperator
+}
+
+// SaveEnrollmentKey stores the key a node uses to receive a share handover
+func (s *Storage) SaveEnrollmentKey(sk *rsa.PrivateKey) error {
+	return s.db.Update(func(txn Txn) error {
+		return txn.Set([]byte(enrollmentKeyKey), x509.MarshalPKCS1PrivateKey(sk))
+	})
+}
+
+func (s *Storage) GetEnrollmentKey() (*rsa.PrivateKey, error) {
+	val, err := s.get([]byte(enrollmentKeyKey))
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKCS1PrivateKey(val)
+}
+
+// InvalidateKeyGenOutput removes the share for pk and leaves a tombstone in a single transaction
+func (s *Storage) InvalidateKeyGenOutput(pk types.ValidatorPK, tombstone *HandoverTombstone) error {
+	value, err := json.Marshal(tombstone)
+	if err != nil {
+		return fmt.Errorf("failed to marshal handover tombstone :: %s", err.Error())
+	}
+	return s.db.Update(func(txn Txn) error {
+		if err := txn.Delete([]byte(pk)); err != nil {
+			return err
+		}
+		if err := unindexShare(txn, pk); err != nil {
+			return err
+		}
+		return txn.Set(handoverTombstoneKey(pk), value)
+	})
+}
+
+func (s *Storage) GetHandoverTombstone(pk types.ValidatorPK) (*HandoverTombstone, error) {
+	val, err := s.get(handoverTombstoneKey(pk))
+	if err != nil {
+		return nil, err
+	}
+	tombstone := &HandoverTombstone{}
+	return tombstone, json.Unmarshal(val, tombstone)
+}
+
+func (s *Storage) ClearHandoverTombstone(pk types.ValidatorPK) error {
+	return s.db.Update(func(txn Txn) error {
+		return txn.Delete(handoverTombstoneKey(pk))
+	})
+}
+
+func (s *Storage) ListHandoverTombstones() ([]*HandoverTombstone, error) {
+	tombstones := make([]*HandoverTombstone, 0)
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(handoverTombstoneBase), func(_, val []byte) error {
+			tombstone := &HandoverTombstone{}
+			if err := json.Unmarshal(val, tombstone); err != nil {
+				return fmt.Errorf("failed to unmarshal handover tombstone :: %s", err.Error())
+			}
+			tombstones = append(tombstones, tombstone)
+			return nil
+		})
+	})
+	return tombstones, err
+}
+
+func (s *Storage) get(key []byte) ([]byte, error) {
+	var val []byte
+	err := s.db.View(func(txn Txn) error {
+		var err error
+		val, err = txn.Get(key)
+		return err
+	})
+	return val, err
+}
+
+func handoverTombstoneKey(pk types.ValidatorPK) []byte {
+	return []byte(handoverTombstoneBase + hex.EncodeToString(pk))
+}
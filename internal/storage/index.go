@@ -0,0 +1,358 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Shares are stored under the bare validator public key and ceremonies as
+// their events, neither can be listed without a full scan. The index keys
+// below are kept in the same transaction as the data and make them prefix
+// scans.
+const (
+	indexBase              = "index/"
+	indexVersionKey        = "index/version"
+	shareIndexBase         = "index/share/"
+	operatorShareIndexBase = "index/share-operator/"
+	ceremonyStateKeyBase   = "index/ceremony/"
+	ceremonyStateIndexBase = "index/ceremony-state/"
+	indexVersion           = "3"
+	DefaultListLimit       = 100
+	MaxListLimit           = 1000
+)
+
+// ListOptions pages through a list, After is the cursor returned with the previous page
+type ListOptions struct {
+	After string
+	Limit int
+}
+
+func (o ListOptions) limit() int {
+	switch {
+	case o.Limit <= 0:
+		return DefaultListLimit
+	case o.Limit > MaxListLimit:
+		return MaxListLimit
+	}
+	return o.Limit
+}
+
+var errPageFull = errors.New("page full")
+
+// listPage calls fn with the key suffix and value of the keys under prefix
+// after the cursor, and returns the cursor of the next page, empty after the
+// last one
+func (s *Storage) listPage(prefix string, opts ListOptions, fn func(suffix string, value []byte) error) (string, error) {
+	limit := opts.limit()
+	start := prefix
+	if opts.After != "" {
+		start = prefix + opts.After + "\x00"
+	}
+
+	var last, next string
+	count := 0
+	err := s.db.View(func(txn Txn) error {
+		return txn.IterateFrom([]byte(prefix), []byte(start), func(key, value []byte) error {
+			if count == limit {
+				next = last
+				return errPageFull
+			}
+			last = strings.TrimPrefix(string(key), prefix)
+			count++
+			return fn(last, value)
+		})
+	})
+	if err != nil && err != errPageFull {
+		return "", err
+	}
+	return next, nil
+}
+
+// ListKeyGenOutputs pages through the shares this node holds, without their secret
+func (s *Storage) ListKeyGenOutputs(opts ListOptions) ([]*ValidatorShare, string, error) {
+	return s.listShares(shareIndexBase, opts)
+}
+
+// ListByOperator pages through the shares of committees operatorID is part of
+func (s *Storage) ListByOperator(operatorID types.OperatorID, opts ListOptions) ([]*ValidatorShare, string, error) {
+	return s.listShares(operatorShareIndexPrefix(operatorID), opts)
+}
+
+func (s *Storage) listShares(prefix string, opts ListOptions) ([]*ValidatorShare, string, error) {
+	shares := make([]*ValidatorShare, 0)
+	next, err := s.listPage(prefix, opts, func(_ string, value []byte) error {
+		share, err := decodeShareIndex(value)
+		if err != nil {
+			return err
+		}
+		shares = append(shares, share)
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list validator shares :: %s", err.Error())
+	}
+	return shares, next, nil
+}
+
+// ListCeremoniesByStatus pages through the request IDs of the ceremonies in
+// state, of every ceremony when state is empty
+func (s *Storage) ListCeremoniesByStatus(state ceremony.State, opts ListOptions) ([]string, string, error) {
+	prefix := ceremonyStateKeyBase
+	if state != ceremony.StateNone {
+		prefix = ceremonyStateIndexBase + string(state) + "/"
+	}
+	ids := make([]string, 0)
+	next, err := s.listPage(prefix, opts, func(requestID string, _ []byte) error {
+		ids = append(ids, requestID)
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list ceremonies :: %s", err.Error())
+	}
+	return ids, next, nil
+}
+
+// EnsureIndexes builds the indexes of a database written before they were
+// kept, or by another version of them. It reports whether it had to.
+func (s *Storage) EnsureIndexes() (bool, error) {
+	version, err := s.get([]byte(indexVersionKey))
+	if err == nil && string(version) == indexVersion {
+		return false, nil
+	} else if err != nil && err != ErrKeyNotFound {
+		return false, err
+	}
+	return true, s.Reindex()
+}
+
+// Reindex drops the indexes and builds them again from the shares and
+// ceremony events. The lineage and usage of ceremonies whose events were
+// purged can't be rebuilt and are kept as they are.
+func (s *Storage) Reindex() error {
+	var stale [][]byte
+	if err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(indexBase), func(key, _ []byte) error {
+			stale = append(stale, key)
+			return nil
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to list index keys :: %s", err.Error())
+	}
+
+	shares, err := s.ListValidatorShares()
+	if err != nil {
+		return err
+	}
+	ids, err := s.ListCeremonyIDs()
+	if err != nil {
+		return err
+	}
+	stale = keepPurgedLineage(stale, ids)
+	states := make(map[string]ceremony.State, len(ids))
+	replayed := make([]*ceremony.Ceremony, 0, len(ids))
+	for _, requestID := range ids {
+		events, err := s.GetCeremonyEvents(requestID)
+		if err != nil {
+			return err
+		}
+		c, err := ceremony.Replay(requestID, events)
+		if err != nil {
+			return err
+		}
+		states[requestID] = c.State
+		replayed = append(replayed, c)
+	}
+
+	return s.db.Batch(func(w Writer) error {
+		for _, key := range stale {
+			if err := w.Delete(key); err != nil {
+				return err
+			}
+		}
+		for _, share := range shares {
+			if err := setShareIndex(w, share); err != nil {
+				return err
+			}
+		}
+		for requestID, state := range states {
+			if err := setCeremonyStateIndex(w, requestID, state); err != nil {
+				return err
+			}
+		}
+		for _, c := range replayed {
+			if err := ceremonyLineage(w, c); err != nil {
+				return err
+			}
+			if err := ceremonyUsage(w, c); err != nil {
+				return err
+			}
+		}
+		return w.Set([]byte(indexVersionKey), []byte(indexVersion))
+	})
+}
+
+// keepPurgedLineage takes the lineage and usage keys of ceremonies without
+// events out of the stale index keys
+func keepPurgedLineage(stale [][]byte, ids []string) [][]byte {
+	hasEvents := make(map[string]bool, len(ids))
+	for _, requestID := range ids {
+		hasEvents[requestID] = true
+	}
+	kept := stale[:0]
+	for _, key := range stale {
+		if name := string(key); strings.HasPrefix(name, lineageIndexBase) || strings.HasPrefix(name, usageIndexBase) {
+			if !hasEvents[name[strings.LastIndex(name, "/")+1:]] {
+				continue
+			}
+		}
+		kept = append(kept, key)
+	}
+	return kept
+}
+
+// shareIndex is the value of the share index keys
+type shareIndex struct {
+	ValidatorPK string             `json:"validator_pk"`
+	Operators   []types.OperatorID `json:"operators"`
+	Threshold   uint64             `json:"threshold"`
+}
+
+func decodeShareIndex(value []byte) (*ValidatorShare, error) {
+	entry := &shareIndex{}
+	if err := json.Unmarshal(value, entry); err != nil {
+		return nil, err
+	}
+	pk, err := hexenc.Parse(entry.ValidatorPK)
+	if err != nil {
+		return nil, err
+	}
+	return &ValidatorShare{ValidatorPK: pk, Operators: entry.Operators, Threshold: entry.Threshold}, nil
+}
+
+// indexShare replaces the index entries of the share's validator, the
+// committee changes with a resharing
+func indexShare(txn Txn, share *ValidatorShare) error {
+	if err := unindexShare(txn, share.ValidatorPK); err != nil {
+		return err
+	}
+	return setShareIndex(txn, share)
+}
+
+func setShareIndex(w Writer, share *ValidatorShare) error {
+	operators := append([]types.OperatorID{}, share.Operators...)
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+	value, err := json.Marshal(&shareIndex{
+		ValidatorPK: hex.EncodeToString(share.ValidatorPK),
+		Operators:   operators,
+		Threshold:   share.Threshold,
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.Set(shareIndexKey(share.ValidatorPK), value); err != nil {
+		return err
+	}
+	for _, operatorID := range operators {
+		if err := w.Set(operatorShareIndexKey(operatorID, share.ValidatorPK), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unindexShare(txn Txn, pk types.ValidatorPK) error {
+	value, err := txn.Get(shareIndexKey(pk))
+	if err == ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	share, err := decodeShareIndex(value)
+	if err != nil {
+		return err
+	}
+	for _, operatorID := range share.Operators {
+		if err := txn.Delete(operatorShareIndexKey(operatorID, pk)); err != nil {
+			return err
+		}
+	}
+	return txn.Delete(shareIndexKey(pk))
+}
+
+// indexCeremonyState moves the ceremony to the state eventType leads to. An
+// event the state doesn't allow is left to the tracker, which refuses it
+// before it is stored; for a ceremony stored before the index the index is
+// built on start.
+func indexCeremonyState(txn Txn, requestID string, eventType ceremony.EventType) error {
+	current := ceremony.StateNone
+	if value, err := txn.Get(ceremonyStateKey(requestID)); err == nil {
+		current = ceremony.State(value)
+	} else if err != ErrKeyNotFound {
+		return err
+	}
+	next, err := ceremony.Next(current, eventType)
+	if err != nil || next == current {
+		return nil
+	}
+	if current != ceremony.StateNone {
+		if err := txn.Delete(ceremonyStateIndexKey(current, requestID)); err != nil {
+			return err
+		}
+	}
+	return setCeremonyStateIndex(txn, requestID, next)
+}
+
+func setCeremonyStateIndex(w Writer, requestID string, state ceremony.State) error {
+	if err := w.Set(ceremonyStateKey(requestID), []byte(state)); err != nil {
+		return err
+	}
+	return w.Set(ceremonyStateIndexKey(state, requestID), []byte{})
+}
+
+func shareIndexKey(pk types.ValidatorPK) []byte {
+	return []byte(shareIndexBase + hex.EncodeToString(pk))
+}
+
+func operatorShareIndexPrefix(operatorID types.OperatorID) string {
+	return fmt.Sprintf("%s%020d/", operatorShareIndexBase, operatorID)
+}
+
+func operatorShareIndexKey(operatorID types.OperatorID, pk types.ValidatorPK) []byte {
+	return []byte(operatorShareIndexPrefix(operatorID) + hex.EncodeToString(pk))
+}
+
+func ceremonyStateKey(requestID string) []byte {
+	return []byte(ceremonyStateKeyBase + requestID)
+}
+
+func ceremonyStateIndexKey(state ceremony.State, requestID string) []byte {
+	return []byte(ceremonyStateIndexBase + string(state) + "/" + requestID)
+}
@@ -0,0 +1,266 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyGenOutput(operators ...types.OperatorID) *dkg.KeyGenOutput {
+	types.InitBLS()
+	share := &bls.SecretKey{}
+	share.SetByCSPRNG()
+	output := &dkg.KeyGenOutput{
+		Share:           share,
+		ValidatorPK:     share.GetPublicKey().Serialize(),
+		OperatorPubKeys: make(map[types.OperatorID]*bls.PublicKey),
+		Threshold:       3,
+	}
+	for _, operatorID := range operators {
+		output.OperatorPubKeys[operatorID] = share.GetPublicKey()
+	}
+	return output
+}
+
+func TestListKeyGenOutputs(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.SaveKeyGenOutput(testKeyGenOutput(1, 2, 3, 4)))
+	}
+	other := testKeyGenOutput(1, 5, 6, 7)
+	require.NoError(t, s.SaveKeyGenOutput(other))
+
+	seen := map[string]bool{}
+	opts := ListOptions{Limit: 2}
+	for pages := 1; ; pages++ {
+		shares, next, err := s.ListKeyGenOutputs(opts)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(shares), 2)
+		for _, share := range shares {
+			seen[string(share.ValidatorPK)] = true
+		}
+		if next == "" {
+			require.Equal(t, 3, pages)
+			break
+		}
+		opts.After = next
+	}
+	require.Len(t, seen, 6)
+
+	shares, next, err := s.ListByOperator(5, ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, next)
+	require.Len(t, shares, 1)
+	require.Equal(t, types.ValidatorPK(other.ValidatorPK), shares[0].ValidatorPK)
+	require.Equal(t, []types.OperatorID{1, 5, 6, 7}, shares[0].Operators)
+
+	// resharing moves the validator to another committee
+	reshared := testKeyGenOutput(1, 8, 9, 10)
+	reshared.ValidatorPK = other.ValidatorPK
+	require.NoError(t, s.SaveKeyGenOutput(reshared))
+	shares, _, err = s.ListByOperator(5, ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, shares)
+	shares, _, err = s.ListByOperator(8, ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, shares, 1)
+
+	require.NoError(t, s.InvalidateKeyGenOutput(other.ValidatorPK, &HandoverTombstone{}))
+	shares, _, err = s.ListByOperator(1, ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, shares, 5)
+}
+
+func recordCeremony(t *testing.T, tracker *ceremony.Tracker, requestID string, events ...ceremony.EventType) {
+	for _, eventType := range events {
+		_, err := tracker.Record(requestID, eventType, func(e *ceremony.Event) {
+			if eventType == ceremony.EventCreated {
+				e.Params = &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3, 4}, Threshold: 3}
+			}
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestListCeremoniesByStatus(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+	tracker := ceremony.NewTracker(s)
+	recordCeremony(t, tracker, "a", ceremony.EventCreated, ceremony.EventInitialized)
+	recordCeremony(t, tracker, "b", ceremony.EventCreated, ceremony.EventInitialized, ceremony.EventAborted)
+	recordCeremony(t, tracker, "c", ceremony.EventCreated, ceremony.EventAborted)
+
+	ids, _, err := s.ListCeremoniesByStatus(ceremony.StateAborted, ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c"}, ids)
+	ids, _, err = s.ListCeremoniesByStatus(ceremony.StateInitialized, ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, ids)
+
+	ids, next, err := s.ListCeremoniesByStatus(ceremony.StateNone, ListOptions{Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, ids)
+	require.Equal(t, "b", next)
+	ids, next, err = s.ListCeremoniesByStatus(ceremony.StateNone, ListOptions{Limit: 2, After: next})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, ids)
+	require.Empty(t, next)
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	db := testBadgerDB(t)
+	s := NewStorage(db, 1, nil)
+	output := testKeyGenOutput(1, 2, 3, 4)
+	require.NoError(t, s.SaveKeyGenOutput(output))
+	recordCeremony(t, ceremony.NewTracker(s), "a", ceremony.EventCreated, ceremony.EventAborted)
+
+	rebuilt, err := s.EnsureIndexes()
+	require.NoError(t, err)
+	require.True(t, rebuilt, "database written before the index version was set")
+	rebuilt, err = s.EnsureIndexes()
+	require.NoError(t, err)
+	require.False(t, rebuilt)
+
+	// drop the index like a database of an older node
+	require.NoError(t, db.Update(func(txn Txn) error {
+		var keys [][]byte
+		if err := txn.Iterate([]byte(indexBase), func(key, _ []byte) error {
+			keys = append(keys, key)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	shares, _, err := s.ListKeyGenOutputs(ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, shares)
+
+	rebuilt, err = s.EnsureIndexes()
+	require.NoError(t, err)
+	require.True(t, rebuilt)
+	shares, _, err = s.ListByOperator(3, ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, shares, 1)
+	ids, _, err := s.ListCeremoniesByStatus(ceremony.StateAborted, ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, ids)
+}
+
+func completeCeremony(t *testing.T, tracker *ceremony.Tracker, requestID string, params *ceremony.Params, validatorPK string) {
+	for _, eventType := range []ceremony.EventType{ceremony.EventCreated, ceremony.EventInitialized, ceremony.EventRound1, ceremony.EventOutputPending, ceremony.EventCompleted} {
+		_, err := tracker.Record(requestID, eventType, func(e *ceremony.Event) {
+			switch eventType {
+			case ceremony.EventCreated:
+				e.Params = params
+			case ceremony.EventCompleted:
+				e.ValidatorPK = validatorPK
+			}
+		})
+		require.NoError(t, err)
+	}
+}
+
+func TestLineage(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+	tracker := ceremony.NewTracker(s)
+	output := testKeyGenOutput(1, 2, 3, 4)
+	pk := hex.EncodeToString(output.ValidatorPK)
+
+	completeCeremony(t, tracker, "keygen", &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{4, 3, 2, 1}, Threshold: 3}, pk)
+	completeCeremony(t, tracker, "reshare", &ceremony.Params{Kind: ceremony.KindReshare, Operators: []types.OperatorID{1, 5, 6, 7}, OldOperators: []types.OperatorID{1, 2, 3, 4}, Threshold: 3, ValidatorPK: pk}, pk)
+	completeCeremony(t, tracker, "canary", &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3, 4}, Canary: &ceremony.Canary{}}, hex.EncodeToString(testKeyGenOutput().ValidatorPK))
+	recordCeremony(t, tracker, "aborted", ceremony.EventCreated, ceremony.EventAborted)
+
+	lineage, err := s.Lineage(output.ValidatorPK)
+	require.NoError(t, err)
+	require.Len(t, lineage, 2)
+	require.Equal(t, "keygen", lineage[0].RequestID)
+	require.Equal(t, []types.OperatorID{1, 2, 3, 4}, lineage[0].Operators)
+	require.Equal(t, "reshare", lineage[1].RequestID)
+	require.Equal(t, ceremony.KindReshare, lineage[1].Kind)
+	require.Equal(t, []types.OperatorID{1, 2, 3, 4}, lineage[1].OldOperators)
+	require.False(t, lineage[1].CompletedAt.Before(lineage[0].CompletedAt))
+
+	// the lineage is rebuilt from the ceremony events
+	require.NoError(t, s.Reindex())
+	rebuilt, err := s.Lineage(output.ValidatorPK)
+	require.NoError(t, err)
+	require.Equal(t, lineage, rebuilt)
+}
+
+func TestUsage(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+	tracker := ceremony.NewTracker(s)
+	output := testKeyGenOutput(1, 2, 3, 4)
+	pk := hex.EncodeToString(output.ValidatorPK)
+
+	completeCeremony(t, tracker, "keygen", &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{4, 3, 2, 1}, Threshold: 3, ForkVersion: "00000000", WithdrawalCredentials: hex.EncodeToString(make([]byte, 32))}, pk)
+	completeCeremony(t, tracker, "canary", &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3, 4}, Canary: &ceremony.Canary{}}, pk)
+	// a keysign is in the usage from its start, it may have signed before it aborted
+	_, err := tracker.Record("exit", ceremony.EventCreated, func(e *ceremony.Event) {
+		e.Params = &ceremony.Params{Kind: ceremony.KindKeySign, Operators: []types.OperatorID{1, 2, 3}, ValidatorPK: pk, KeySign: &ceremony.KeySignParams{Usage: "exit", SigningRoot: "0x01"}}
+	})
+	require.NoError(t, err)
+	_, err = tracker.Record("exit", ceremony.EventAborted, nil)
+	require.NoError(t, err)
+	_, err = tracker.Record("raw", ceremony.EventCreated, func(e *ceremony.Event) {
+		e.Params = &ceremony.Params{Kind: ceremony.KindKeySign, Operators: []types.OperatorID{1, 2, 3}, ValidatorPK: pk}
+	})
+	require.NoError(t, err)
+
+	usage, err := s.Usage(output.ValidatorPK)
+	require.NoError(t, err)
+	require.Len(t, usage, 3)
+	require.Equal(t, "keygen", usage[0].RequestID)
+	require.Equal(t, "deposit", usage[0].Usage)
+	require.NotEmpty(t, usage[0].SigningRoot)
+	require.Equal(t, []types.OperatorID{1, 2, 3, 4}, usage[0].Operators)
+	require.Equal(t, "exit", usage[1].RequestID)
+	require.Equal(t, "exit", usage[1].Usage)
+	require.Equal(t, "0x01", usage[1].SigningRoot)
+	require.Equal(t, "undeclared", usage[2].Usage)
+
+	// the usage is rebuilt from the ceremony events, and kept once they are purged
+	require.NoError(t, s.Reindex())
+	rebuilt, err := s.Usage(output.ValidatorPK)
+	require.NoError(t, err)
+	require.Equal(t, usage, rebuilt)
+
+	_, err = s.PurgeCeremony("exit")
+	require.NoError(t, err)
+	require.NoError(t, s.Reindex())
+	rebuilt, err = s.Usage(output.ValidatorPK)
+	require.NoError(t, err)
+	require.Equal(t, usage, rebuilt)
+}
@@ -0,0 +1,145 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// lineageIndexBase keys the completed keygens and resharings of a validator
+// by validator public key and completion time
+const lineageIndexBase = "index/lineage/"
+
+// LineageEntry is a completed keygen or resharing of a validator, the
+// committee it left the validator with
+type LineageEntry struct {
+	RequestID    string             `json:"request_id"`
+	Kind         ceremony.Kind      `json:"kind"`
+	Operators    []types.OperatorID `json:"operators"`
+	OldOperators []types.OperatorID `json:"old_operators,omitempty"`
+	Threshold    uint64             `json:"threshold,omitempty"`
+	StartedAt    time.Time          `json:"started_at"`
+	CompletedAt  time.Time          `json:"completed_at"`
+}
+
+// Lineage returns the keygen and resharings of the validator this node took
+// part in, oldest first
+func (s *Storage) Lineage(pk types.ValidatorPK) ([]*LineageEntry, error) {
+	entries := make([]*LineageEntry, 0)
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(lineageIndexPrefix(hex.EncodeToString(pk))), func(_, value []byte) error {
+			entry := &LineageEntry{}
+			if err := json.Unmarshal(value, entry); err != nil {
+				return fmt.Errorf("failed to unmarshal lineage entry :: %s", err.Error())
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// indexLineage adds the ceremony to the lineage of its validator when e
+// completes a keygen or resharing, the params come from the created event
+// stored with the first event of the ceremony
+func indexLineage(txn Txn, requestID string, e *ceremony.Event) error {
+	if e.Type != ceremony.EventCompleted || e.ValidatorPK == "" {
+		return nil
+	}
+	value, err := txn.Get(ceremonyEventKey(requestID, 1))
+	if err == ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	created := &ceremony.Event{}
+	if err := json.Unmarshal(value, created); err != nil {
+		return fmt.Errorf("failed to unmarshal ceremony event :: %s", err.Error())
+	}
+	return setLineageIndex(txn, requestID, created.Params, created.Time, e)
+}
+
+// ceremonyLineage adds a replayed ceremony to the lineage of its validator
+// when it completed
+func ceremonyLineage(w Writer, c *ceremony.Ceremony) error {
+	if c.State != ceremony.StateCompleted {
+		return nil
+	}
+	for _, e := range c.Events {
+		if e.Type == ceremony.EventCompleted {
+			return setLineageIndex(w, c.RequestID, c.Params, c.CreatedAt, e)
+		}
+	}
+	return nil
+}
+
+// setLineageIndex leaves out canary keygens, they back no validator
+func setLineageIndex(w Writer, requestID string, params *ceremony.Params, startedAt time.Time, completed *ceremony.Event) error {
+	if params == nil || params.Canary != nil || completed.ValidatorPK == "" {
+		return nil
+	}
+	if params.Kind != ceremony.KindKeygen && params.Kind != ceremony.KindReshare {
+		return nil
+	}
+	entry := &LineageEntry{
+		RequestID:    requestID,
+		Kind:         params.Kind,
+		Operators:    sortedOperators(params.Operators),
+		OldOperators: sortedOperators(params.OldOperators),
+		Threshold:    params.Threshold,
+		StartedAt:    startedAt,
+		CompletedAt:  completed.Time,
+	}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return w.Set(lineageIndexKey(completed.ValidatorPK, completed.Time, requestID), value)
+}
+
+func sortedOperators(operators []types.OperatorID) []types.OperatorID {
+	if len(operators) == 0 {
+		return nil
+	}
+	sorted := append([]types.OperatorID{}, operators...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func lineageIndexPrefix(pk string) string {
+	return lineageIndexBase + strings.ToLower(strings.TrimPrefix(pk, "0x")) + "/"
+}
+
+func lineageIndexKey(pk string, completedAt time.Time, requestID string) []byte {
+	return []byte(fmt.Sprintf("%s%020d/%s", lineageIndexPrefix(pk), completedAt.UnixNano(), requestID))
+}
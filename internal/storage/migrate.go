@@ -0,0 +1,233 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+)
+
+// DefaultMigrateBatch is how many keys Migrate writes per batch
+const DefaultMigrateBatch = 500
+
+// keyKinds group the keys of a database for the digest of a migration, keys
+// of no kind with the length of a validator public key are shares
+var keyKinds = []struct {
+	prefix string
+	kind   string
+}{
+	{ceremonyKeyBase, "ceremonies"},
+	{operatorPrefix, "operators"},
+	{indexBase, "indexes"},
+	{"transcript/", "transcripts"},
+	{"committee-outputs/", "outputs"},
+	{encryptionBase, "encryption"},
+}
+
+var errStopIteration = errors.New("stop iteration")
+
+func keyKind(key []byte) string {
+	for _, kind := range keyKinds {
+		if bytes.HasPrefix(key, []byte(kind.prefix)) {
+			return kind.kind
+		}
+	}
+	if len(key) == 48 {
+		return "shares"
+	}
+	return "other"
+}
+
+// KindDigest is the number of keys of a kind and the sha256 of the keys and
+// values in key order
+type KindDigest struct {
+	Keys int    `json:"keys"`
+	Hash string `json:"hash"`
+}
+
+// Digest of every kind of key in a database
+type Digest map[string]*KindDigest
+
+// Kinds in alphabetical order
+func (d Digest) Kinds() []string {
+	kinds := make([]string, 0, len(d))
+	for kind := range d {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Keys of every kind
+func (d Digest) Keys() int {
+	keys := 0
+	for _, digest := range d {
+		keys += digest.Keys
+	}
+	return keys
+}
+
+// Compare returns an error naming the kinds whose count or hash differ
+func (d Digest) Compare(other Digest) error {
+	kinds := d.Kinds()
+	for _, kind := range other.Kinds() {
+		if d[kind] == nil {
+			kinds = append(kinds, kind)
+		}
+	}
+	for _, kind := range kinds {
+		mine, theirs := d[kind], other[kind]
+		if mine == nil || theirs == nil {
+			return fmt.Errorf("%s are missing on one side", kind)
+		}
+		if mine.Keys != theirs.Keys {
+			return fmt.Errorf("%s: %d keys, %d copied", kind, mine.Keys, theirs.Keys)
+		}
+		if mine.Hash != theirs.Hash {
+			return fmt.Errorf("%s: hash %s, %s copied", kind, mine.Hash, theirs.Hash)
+		}
+	}
+	return nil
+}
+
+// DigestDB counts and hashes every key of db by kind. Badger and Postgres
+// both order keys bytewise, the digests of a database and its copy match.
+func DigestDB(db DB) (Digest, error) {
+	hashes := make(map[string]hash.Hash)
+	digest := make(Digest)
+	err := db.View(func(txn Txn) error {
+		return txn.Iterate(nil, func(key, value []byte) error {
+			kind := keyKind(key)
+			h, ok := hashes[kind]
+			if !ok {
+				h = sha256.New()
+				hashes[kind] = h
+				digest[kind] = &KindDigest{}
+			}
+			h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(key))))
+			h.Write(key)
+			h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(value))))
+			h.Write(value)
+			digest[kind].Keys++
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for kind, h := range hashes {
+		digest[kind].Hash = hex.EncodeToString(h.Sum(nil))
+	}
+	return digest, nil
+}
+
+// isEmpty reports whether db holds no key at all
+func isEmpty(db DB) (bool, error) {
+	empty := true
+	err := db.View(func(txn Txn) error {
+		return txn.Iterate(nil, func(_, _ []byte) error {
+			empty = false
+			return errStopIteration
+		})
+	})
+	if err != nil && err != errStopIteration {
+		return false, err
+	}
+	return empty, nil
+}
+
+// Migrate copies every key of from to the empty database to, batchSize keys
+// at a time, and checks the copy against the digest of from. Values are
+// copied as they are: shares, ceremony records and operators are stored the
+// same way by every backend. Nothing may write to from while it runs.
+func Migrate(from, to DB, batchSize int, progress func(copied int)) (Digest, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultMigrateBatch
+	}
+	empty, err := isEmpty(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target database: %w", err)
+	}
+	if !empty {
+		return nil, fmt.Errorf("target database isn't empty")
+	}
+
+	copied := 0
+	keys, values := make([][]byte, 0, batchSize), make([][]byte, 0, batchSize)
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		err := to.Batch(func(w Writer) error {
+			for i := range keys {
+				if err := w.Set(keys[i], values[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write batch after %d keys: %w", copied, err)
+		}
+		copied += len(keys)
+		keys, values = keys[:0], values[:0]
+		if progress != nil {
+			progress(copied)
+		}
+		return nil
+	}
+	err = from.View(func(txn Txn) error {
+		err := txn.Iterate(nil, func(key, value []byte) error {
+			keys, values = append(keys, key), append(values, value)
+			if len(keys) < batchSize {
+				return nil
+			}
+			return flush()
+		})
+		if err != nil {
+			return err
+		}
+		return flush()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := DigestDB(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to digest source database: %w", err)
+	}
+	target, err := DigestDB(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to digest target database: %w", err)
+	}
+	if err := source.Compare(target); err != nil {
+		return nil, fmt.Errorf("copy doesn't match the source: %w", err)
+	}
+	return source, nil
+}
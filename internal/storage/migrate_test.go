@@ -0,0 +1,90 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fillDB(t *testing.T, db DB) {
+	require.NoError(t, db.Batch(func(w Writer) error {
+		for i := 0; i < 25; i++ {
+			if err := w.Set([]byte(fmt.Sprintf("%s%d", ceremonyKeyBase, i)), []byte(fmt.Sprintf("ceremony %d", i))); err != nil {
+				return err
+			}
+			if err := w.Set(bytes.Repeat([]byte{byte(i)}, 48), []byte(fmt.Sprintf("share %d", i))); err != nil {
+				return err
+			}
+		}
+		return w.Set([]byte(operatorPrefix+"1"), []byte("operator 1"))
+	}))
+}
+
+func TestMigrate(t *testing.T) {
+	from, to := testBadgerDB(t), testBadgerDB(t)
+	fillDB(t, from)
+
+	batches := 0
+	digest, err := Migrate(from, to, 10, func(int) { batches++ })
+	require.NoError(t, err)
+	require.Equal(t, 6, batches)
+	require.Equal(t, 51, digest.Keys())
+	require.Equal(t, 25, digest["shares"].Keys)
+	require.Equal(t, 25, digest["ceremonies"].Keys)
+	require.Equal(t, 1, digest["operators"].Keys)
+
+	copied, err := DigestDB(to)
+	require.NoError(t, err)
+	require.NoError(t, digest.Compare(copied))
+
+	_, err = Migrate(from, to, 10, nil)
+	require.Error(t, err, "target isn't empty")
+}
+
+func TestDigestCompare(t *testing.T) {
+	a, b := testBadgerDB(t), testBadgerDB(t)
+	fillDB(t, a)
+	fillDB(t, b)
+	require.NoError(t, b.Update(func(txn Txn) error {
+		return txn.Set([]byte(operatorPrefix+"1"), []byte("operator 2"))
+	}))
+
+	digestA, err := DigestDB(a)
+	require.NoError(t, err)
+	digestB, err := DigestDB(b)
+	require.NoError(t, err)
+	require.ErrorContains(t, digestA.Compare(digestB), "operators")
+
+	require.NoError(t, b.Update(func(txn Txn) error {
+		if err := txn.Set([]byte(operatorPrefix+"1"), []byte("operator 1")); err != nil {
+			return err
+		}
+		return txn.Set([]byte("extra"), []byte("value"))
+	}))
+	digestB, err = DigestDB(b)
+	require.NoError(t, err)
+	require.ErrorContains(t, digestA.Compare(digestB), "other")
+}
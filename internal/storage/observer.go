@@ -0,0 +1,58 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+)
+
+func attestationKey(requestID string) []byte {
+	return []byte(fmt.Sprintf("attestation/%s", requestID))
+}
+
+func (s *Storage) SaveAttestation(a *observer.Attestation) error {
+	value, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal attestation :: %s", err.Error())
+	}
+	return s.db.Update(func(txn Txn) error {
+		return txn.Set(attestationKey(a.RequestID), value)
+	})
+}
+
+func (s *Storage) GetAttestation(requestID string) (*observer.Attestation, error) {
+	val, err := s.get(attestationKey(requestID))
+	if err == ErrKeyNotFound {
+		return nil, observer.ErrNotObserved
+	} else if err != nil {
+		return nil, err
+	}
+
+	a := &observer.Attestation{}
+	if err := json.Unmarshal(val, a); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal attestation :: %s", err.Error())
+	}
+	return a, nil
+}
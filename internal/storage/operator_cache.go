@@ -0,0 +1,203 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+)
+
+const operatorPrefix = "operator/"
+
+// OperatorRecord is a registry operator as kept in the cache, with the
+// validators needed to revalidate it with a conditional request
+type OperatorRecord struct {
+	Operator     *dkg.Operator `json:"operator"`
+	FetchedAt    int64         `json:"fetched_at"`
+	ETag         string        `json:"etag,omitempty"`
+	LastModified string        `json:"last_modified,omitempty"`
+}
+
+// Age is the time since the record was fetched or last revalidated
+func (r *OperatorRecord) Age() time.Duration {
+	return time.Since(time.Unix(r.FetchedAt, 0))
+}
+
+// OperatorCachePolicy decides how long cached operators are trusted
+type OperatorCachePolicy struct {
+	// TTL is how long a cached operator is served without asking the registry
+	TTL time.Duration
+	// StaleWhileRevalidate is how long after the TTL a cached operator is
+	// still served while it is revalidated in the background. Older operators
+	// are revalidated before they are served.
+	StaleWhileRevalidate time.Duration
+}
+
+var DefaultOperatorCachePolicy = OperatorCachePolicy{
+	TTL:                  time.Hour,
+	StaleWhileRevalidate: 24 * time.Hour,
+}
+
+func (s *Storage) SetOperatorCache(policy OperatorCachePolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operatorCache = policy
+}
+
+func (s *Storage) cachedOperator(operatorID types.OperatorID) (*OperatorRecord, error) {
+	record, err := s.GetOperatorRecord(operatorID)
+	if err == ErrKeyNotFound {
+		return s.RefreshOperator(operatorID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	policy := s.operatorCache
+	s.mu.Unlock()
+
+	age := record.Age()
+	switch {
+	case age < policy.TTL:
+		return record, nil
+	case age < policy.TTL+policy.StaleWhileRevalidate:
+		s.revalidateInBackground(operatorID)
+		return record, nil
+	default:
+		return s.RefreshOperator(operatorID)
+	}
+}
+
+func (s *Storage) revalidateInBackground(operatorID types.OperatorID) {
+	s.mu.Lock()
+	if s.refreshing[operatorID] {
+		s.mu.Unlock()
+		return
+	}
+	s.refreshing[operatorID] = true
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.refreshing, operatorID)
+			s.mu.Unlock()
+		}()
+		if _, err := s.RefreshOperator(operatorID); err != nil {
+			logrus.Warnf("failed to revalidate operator %d, serving the cached key: %v", operatorID, err)
+		}
+	}()
+}
+
+// RefreshOperator revalidates the cached operator with the registry, or
+// fetches it when it isn't cached, and stores the result
+func (s *Storage) RefreshOperator(operatorID types.OperatorID) (*OperatorRecord, error) {
+	record, err := s.FetchOperatorRecord(operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SaveOperatorRecords(map[types.OperatorID]*OperatorRecord{operatorID: record}); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// FetchOperatorRecord revalidates the cached operator with the registry like
+// RefreshOperator without storing the result
+func (s *Storage) FetchOperatorRecord(operatorID types.OperatorID) (*OperatorRecord, error) {
+	cached, err := s.GetOperatorRecord(operatorID)
+	if err == ErrKeyNotFound {
+		cached = nil
+	} else if err != nil {
+		return nil, err
+	}
+	return FetchOperator(operatorID, cached)
+}
+
+// SaveOperatorRecords stores fetched operators in one batch
+func (s *Storage) SaveOperatorRecords(records map[types.OperatorID]*OperatorRecord) error {
+	values := make(map[types.OperatorID][]byte, len(records))
+	for operatorID, record := range records {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal operator record :: %s", err.Error())
+		}
+		values[operatorID] = value
+	}
+	return s.db.Batch(func(w Writer) error {
+		for operatorID, value := range values {
+			if err := w.Set(operatorKey(operatorID), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetOperatorRecord returns the cached operator, operators cached before
+// records were kept are returned with a zero fetch time
+func (s *Storage) GetOperatorRecord(operatorID types.OperatorID) (*OperatorRecord, error) {
+	val, err := s.get(operatorKey(operatorID))
+	if err != nil {
+		return nil, err
+	}
+
+	record := new(OperatorRecord)
+	if err := json.Unmarshal(val, record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal operator record :: %s", err.Error())
+	}
+	if record.Operator == nil {
+		operator := new(dkg.Operator)
+		if err := json.Unmarshal(val, operator); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal operator :: %s", err.Error())
+		}
+		record = &OperatorRecord{Operator: operator}
+	}
+	return record, nil
+}
+
+// ListOperatorIDs returns the ids of the cached operators
+func (s *Storage) ListOperatorIDs() ([]types.OperatorID, error) {
+	var ids []types.OperatorID
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(operatorPrefix), func(key, _ []byte) error {
+			id, err := strconv.ParseUint(strings.TrimPrefix(string(key), operatorPrefix), 10, 64)
+			if err != nil {
+				return nil
+			}
+			ids = append(ids, types.OperatorID(id))
+			return nil
+		})
+	})
+	return ids, err
+}
+
+func operatorKey(operatorID types.OperatorID) []byte {
+	return []byte(fmt.Sprintf("%s%d", operatorPrefix, operatorID))
+}
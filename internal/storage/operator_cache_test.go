@@ -0,0 +1,170 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// testRegistry serves operator 1 with an etag, answering 304 to requests
+// that already have it
+type testRegistry struct {
+	key      *rsa.PrivateKey
+	etag     string
+	requests int32
+	notMod   int32
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	os.Setenv("USE_HARDCODED_OPERATORS", "false")
+	r := &testRegistry{etag: `"v1"`}
+	r.rotate(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&r.requests, 1)
+		if req.Header.Get("If-None-Match") == r.etag {
+			atomic.AddInt32(&r.notMod, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		der, _ := x509.MarshalPKIXPublicKey(&r.key.PublicKey)
+		pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: der})
+		w.Header().Set("ETag", r.etag)
+		json.NewEncoder(w).Encode(operatorResponse{
+			ID:        1,
+			Owner:     "0x0000000000000000000000000000000000000001",
+			PublicKey: base64.StdEncoding.EncodeToString(pemKey),
+		})
+	}))
+	old := RegistryAPI
+	RegistryAPI = server.URL
+	t.Cleanup(func() {
+		RegistryAPI = old
+		server.Close()
+	})
+	return r
+}
+
+func (r *testRegistry) rotate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	r.key = key
+}
+
+func testStorage(t *testing.T) *Storage {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return NewStorage(NewBadgerDB(db), 2, nil)
+}
+
+func TestGetDKGOperatorRevalidates(t *testing.T) {
+	registry := newTestRegistry(t)
+	s := testStorage(t)
+	s.SetOperatorCache(OperatorCachePolicy{TTL: time.Hour})
+
+	_, operator, err := s.GetDKGOperator(1)
+	require.NoError(t, err)
+	require.True(t, operator.EncryptionPubKey.Equal(&registry.key.PublicKey))
+
+	// fresh, served from the cache
+	_, _, err = s.GetDKGOperator(1)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, registry.requests)
+
+	// expired without a stale window, revalidated before it is served
+	s.SetOperatorCache(OperatorCachePolicy{})
+	_, _, err = s.GetDKGOperator(1)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, registry.requests)
+	require.EqualValues(t, 1, registry.notMod)
+
+	// a rotated key is picked up on the next revalidation
+	registry.rotate(t)
+	registry.etag = `"v2"`
+	_, operator, err = s.GetDKGOperator(1)
+	require.NoError(t, err)
+	require.True(t, operator.EncryptionPubKey.Equal(&registry.key.PublicKey))
+
+	record, err := s.GetOperatorRecord(1)
+	require.NoError(t, err)
+	require.Equal(t, `"v2"`, record.ETag)
+}
+
+func TestGetDKGOperatorStaleWhileRevalidate(t *testing.T) {
+	registry := newTestRegistry(t)
+	s := testStorage(t)
+
+	_, _, err := s.GetDKGOperator(1)
+	require.NoError(t, err)
+	old := registry.key
+
+	registry.rotate(t)
+	registry.etag = `"v2"`
+	s.SetOperatorCache(OperatorCachePolicy{StaleWhileRevalidate: time.Hour})
+
+	// stale, the cached key is served and refreshed in the background
+	_, operator, err := s.GetDKGOperator(1)
+	require.NoError(t, err)
+	require.True(t, operator.EncryptionPubKey.Equal(&old.PublicKey))
+
+	require.Eventually(t, func() bool {
+		record, err := s.GetOperatorRecord(1)
+		return err == nil && record.ETag == `"v2"`
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestGetOperatorRecordLegacy(t *testing.T) {
+	newTestRegistry(t)
+	s := testStorage(t)
+
+	operator, err := FetchOperatorByID(1)
+	require.NoError(t, err)
+	value, err := json.Marshal(operator)
+	require.NoError(t, err)
+	require.NoError(t, s.db.Update(func(txn Txn) error {
+		return txn.Set(operatorKey(1), value)
+	}))
+
+	record, err := s.GetOperatorRecord(1)
+	require.NoError(t, err)
+	require.Zero(t, record.FetchedAt)
+	require.True(t, record.Operator.EncryptionPubKey.Equal(operator.EncryptionPubKey))
+
+	ids, err := s.ListOperatorIDs()
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+}
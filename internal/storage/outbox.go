@@ -0,0 +1,81 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const outboxBase = "outbox/"
+
+// OutboxEntry is a message this node failed to publish to the messenger,
+// kept until a retry publishes it. Seq orders the entries of a topic.
+type OutboxEntry struct {
+	Topic     string `json:"topic"`
+	Seq       uint64 `json:"seq"`
+	Data      []byte `json:"data"`
+	QueuedAt  int64  `json:"queued_at"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+func outboxKey(topic string, seq uint64) []byte {
+	return []byte(fmt.Sprintf("%s%s/%020d", outboxBase, topic, seq))
+}
+
+func (s *Storage) SaveOutboxEntry(e *OutboxEntry) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox entry :: %s", err.Error())
+	}
+	return s.db.Update(func(txn Txn) error {
+		return txn.Set(outboxKey(e.Topic, e.Seq), value)
+	})
+}
+
+func (s *Storage) DeleteOutboxEntry(topic string, seq uint64) error {
+	return s.db.Update(func(txn Txn) error {
+		return txn.Delete(outboxKey(topic, seq))
+	})
+}
+
+// ListOutbox returns the entries of a topic in the order they were queued,
+// those of every topic with an empty topic
+func (s *Storage) ListOutbox(topic string) ([]*OutboxEntry, error) {
+	prefix := outboxBase
+	if topic != "" {
+		prefix += topic + "/"
+	}
+	entries := make([]*OutboxEntry, 0)
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(prefix), func(_, val []byte) error {
+			e := &OutboxEntry{}
+			if err := json.Unmarshal(val, e); err != nil {
+				return fmt.Errorf("failed to unmarshal outbox entry :: %s", err.Error())
+			}
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	return entries, err
+}
@@ -0,0 +1,50 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+	for _, e := range []*OutboxEntry{{Topic: "bb", Seq: 10}, {Topic: "aa", Seq: 9}, {Topic: "aa", Seq: 2}, {Topic: "a", Seq: 1}} {
+		require.NoError(t, s.SaveOutboxEntry(e))
+	}
+
+	entries, err := s.ListOutbox("aa")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, uint64(2), entries[0].Seq)
+	require.Equal(t, uint64(9), entries[1].Seq)
+
+	all, err := s.ListOutbox("")
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+
+	require.NoError(t, s.DeleteOutboxEntry("aa", 2))
+	entries, err = s.ListOutbox("aa")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,70 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+const recoveryAuditBase = "recovery/"
+
+// RecoveryAudit records one step this node took in a share recovery, refused
+// steps are recorded with the reason
+type RecoveryAudit struct {
+	RequestID   string             `json:"request_id"`
+	Step        string             `json:"step"`
+	ValidatorPK string             `json:"validator_pk"`
+	Operator    types.OperatorID   `json:"operator"`
+	Helpers     []types.OperatorID `json:"helpers"`
+	Approvers   []types.OperatorID `json:"approvers"`
+	At          int64              `json:"at"`
+	Error       string             `json:"error,omitempty"`
+}
+
+func (s *Storage) SaveRecoveryAudit(a *RecoveryAudit) error {
+	value, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recovery audit :: %s", err.Error())
+	}
+	return s.db.Update(func(txn Txn) error {
+		return txn.Set([]byte(fmt.Sprintf("%s%s/%020d/%s", recoveryAuditBase, a.RequestID, a.At, a.Step)), value)
+	})
+}
+
+// ListRecoveryAudits returns the steps of a recovery in the order they were taken
+func (s *Storage) ListRecoveryAudits(requestID string) ([]*RecoveryAudit, error) {
+	audits := make([]*RecoveryAudit, 0)
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(recoveryAuditBase+requestID+"/"), func(_, val []byte) error {
+			a := &RecoveryAudit{}
+			if err := json.Unmarshal(val, a); err != nil {
+				return fmt.Errorf("failed to unmarshal recovery audit :: %s", err.Error())
+			}
+			audits = append(audits, a)
+			return nil
+		})
+	})
+	return audits, err
+}
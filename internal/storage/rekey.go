@@ -0,0 +1,285 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultRekeyBatch is how many values Rekey re-encrypts per transaction
+const DefaultRekeyBatch = 500
+
+// RekeyResult is what a re-keying did, From and To are the ids of the keys,
+// empty for values in the clear
+type RekeyResult struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Keys is how many values the re-keying went through, over every run
+	Keys int `json:"keys"`
+	// Verified is how many values were found under the new key afterwards
+	Verified int `json:"verified"`
+}
+
+// Rekey re-encrypts every value of db from the key of oldPassphrase to the
+// key of newPassphrase, an empty passphrase stands for values in the clear.
+// Each batch is written in one transaction with a checkpoint, so a run that
+// crashed resumes where it stopped and the node can run in between with both
+// passphrases. Once every value is under the new key they are checked
+// against the digest taken before; a re-keying that fails is rolled back to
+// the old key. Nothing else may write to db while it runs.
+func Rekey(db DB, oldPassphrase, newPassphrase string, batchSize int, progress func(done int)) (*RekeyResult, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultRekeyBatch
+	}
+	state, err := readEncryptionState(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage encryption: %w", err)
+	}
+	keys, err := storageKeys(db, state, oldPassphrase, newPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	from, to := keys[0], keys[1]
+	fromID, toID := storageKeyID(from), storageKeyID(to)
+	if fromID == toID {
+		return nil, fmt.Errorf("the old and the new passphrase open the same key")
+	}
+
+	checkpoint := &RekeyCheckpoint{From: fromID, To: toID, StartedAt: time.Now().UTC()}
+	switch cp := state.checkpoint; {
+	case cp != nil && cp.From == fromID && cp.To == toID:
+		checkpoint = cp
+	case cp != nil && cp.From == toID && cp.To == fromID:
+		// turning back an unfinished re-keying, every value is under one of the keys
+	case cp != nil:
+		return nil, fmt.Errorf("%w: it goes from key %q to %q", ErrRekeyUnfinished, cp.From, cp.To)
+	case state.keyID == "" && fromID != "":
+		return nil, fmt.Errorf("storage isn't encrypted, leave the old passphrase empty")
+	case state.keyID != fromID:
+		return nil, fmt.Errorf("%w: it isn't under the old passphrase", ErrStoragePassphrase)
+	}
+
+	// the values as the node reads them, whatever key they are under
+	view := newEncryptedDB(db, nil, fromID == "" || toID == "", from, to)
+	before, err := plaintextDigest(view)
+	if err != nil {
+		return nil, fmt.Errorf("failed to digest storage: %w", err)
+	}
+	if err := setRekeyCheckpoint(db, checkpoint); err != nil {
+		return nil, err
+	}
+
+	result := &RekeyResult{From: fromID, To: toID}
+	err = rekeyValues(db, checkpoint, from, to, batchSize, progress)
+	if err == nil {
+		result.Verified, err = verifyRekey(db, view, to, before)
+	}
+	if err != nil {
+		back := &RekeyCheckpoint{From: toID, To: fromID, StartedAt: time.Now().UTC()}
+		if rollbackErr := rollbackRekey(db, back, to, from, batchSize); rollbackErr != nil {
+			return nil, fmt.Errorf("re-keying failed: %w; the rollback failed too (%v), start the node with both passphrases and run rekey-storage again", err, rollbackErr)
+		}
+		return nil, fmt.Errorf("re-keying failed and was rolled back to the old passphrase: %w", err)
+	}
+	if err := finishRekey(db, toID); err != nil {
+		return nil, err
+	}
+	result.Keys = checkpoint.Keys
+	return result, nil
+}
+
+func rollbackRekey(db DB, checkpoint *RekeyCheckpoint, from, to *StorageKey, batchSize int) error {
+	if err := setRekeyCheckpoint(db, checkpoint); err != nil {
+		return err
+	}
+	if err := rekeyValues(db, checkpoint, from, to, batchSize, nil); err != nil {
+		return err
+	}
+	return finishRekey(db, storageKeyID(to))
+}
+
+// rekeyValues re-encrypts the values after the checkpoint, batchSize of them
+// and the checkpoint per transaction
+func rekeyValues(db DB, checkpoint *RekeyCheckpoint, from, to *StorageKey, batchSize int, progress func(done int)) error {
+	for {
+		start := []byte{}
+		if checkpoint.After != "" {
+			after, err := hex.DecodeString(checkpoint.After)
+			if err != nil {
+				return fmt.Errorf("invalid re-keying checkpoint: %w", err)
+			}
+			start = append(after, 0)
+		}
+
+		done := 0
+		err := db.Update(func(txn Txn) error {
+			var keys, values [][]byte
+			err := txn.IterateFrom(nil, start, func(key, value []byte) error {
+				if isEncryptionMeta(key) {
+					return nil
+				}
+				if len(keys) == batchSize {
+					return errStopIteration
+				}
+				keys, values = append(keys, key), append(values, value)
+				return nil
+			})
+			if err != nil && err != errStopIteration {
+				return err
+			}
+			// the values are set once the iteration is closed, postgres
+			// can't write on a connection with open rows
+			for i, key := range keys {
+				value, err := reseal(key, values[i], from, to)
+				if err != nil {
+					return err
+				}
+				if value == nil {
+					continue
+				}
+				if err := txn.Set(key, value); err != nil {
+					return err
+				}
+			}
+			if len(keys) == 0 {
+				return nil
+			}
+			next := *checkpoint
+			next.After = hex.EncodeToString(keys[len(keys)-1])
+			next.Keys += len(keys)
+			value, err := json.Marshal(&next)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set([]byte(rekeyCheckpointKey), value); err != nil {
+				return err
+			}
+			done, checkpoint.After, checkpoint.Keys = len(keys), next.After, next.Keys
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt batch after %d keys: %w", checkpoint.Keys, err)
+		}
+		if done == 0 {
+			return nil
+		}
+		if progress != nil {
+			progress(checkpoint.Keys)
+		}
+	}
+}
+
+// reseal opens value with from and seals it with to, nil values of either
+// are in the clear. It returns nil for a value already under to.
+func reseal(key, value []byte, from, to *StorageKey) ([]byte, error) {
+	id := sealedKeyID(value)
+	if id == storageKeyID(to) {
+		return nil, nil
+	}
+	if id != storageKeyID(from) {
+		return nil, fmt.Errorf("value of %q is under neither the old nor the new passphrase", key)
+	}
+	plain := value
+	if from != nil {
+		var err error
+		if plain, err = from.open(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if to == nil {
+		return plain, nil
+	}
+	return to.seal(key, plain)
+}
+
+// verifyRekey checks every value is under to and the values read the same as
+// before the re-keying
+func verifyRekey(db DB, view DB, to *StorageKey, before Digest) (int, error) {
+	verified := 0
+	err := db.View(func(txn Txn) error {
+		return txn.Iterate(nil, func(key, value []byte) error {
+			if isEncryptionMeta(key) {
+				return nil
+			}
+			if sealedKeyID(value) != storageKeyID(to) {
+				return fmt.Errorf("value of %q isn't under the new passphrase", key)
+			}
+			verified++
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	after, err := plaintextDigest(view)
+	if err != nil {
+		return 0, err
+	}
+	if err := before.Compare(after); err != nil {
+		return 0, fmt.Errorf("values changed while re-keying: %w", err)
+	}
+	return verified, nil
+}
+
+func plaintextDigest(view DB) (Digest, error) {
+	digest, err := DigestDB(view)
+	if err != nil {
+		return nil, err
+	}
+	delete(digest, "encryption")
+	return digest, nil
+}
+
+func setRekeyCheckpoint(db DB, checkpoint *RekeyCheckpoint) error {
+	value, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := db.Update(func(txn Txn) error {
+		return txn.Set([]byte(rekeyCheckpointKey), value)
+	}); err != nil {
+		return fmt.Errorf("failed to store re-keying checkpoint: %w", err)
+	}
+	return nil
+}
+
+// finishRekey records the key every value is under now and drops the checkpoint
+func finishRekey(db DB, keyID string) error {
+	err := db.Update(func(txn Txn) error {
+		if keyID == "" {
+			if err := txn.Delete([]byte(encryptionKeyIDKey)); err != nil && !errors.Is(err, ErrKeyNotFound) {
+				return err
+			}
+		} else if err := txn.Set([]byte(encryptionKeyIDKey), []byte(keyID)); err != nil {
+			return err
+		}
+		return txn.Delete([]byte(rekeyCheckpointKey))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to finish re-keying: %w", err)
+	}
+	return nil
+}
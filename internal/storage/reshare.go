@@ -0,0 +1,75 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+const reshareBase = "reshare/"
+
+// ReshareStart records a resharing of a validator this node joined, kept to
+// limit how often a validator is reshared
+type ReshareStart struct {
+	ValidatorPK string `json:"validator_pk"`
+	RequestID   string `json:"request_id"`
+	StartedAt   int64  `json:"started_at"`
+}
+
+func reshareKey(pk types.ValidatorPK, requestID string) []byte {
+	return []byte(reshareBase + hex.EncodeToString(pk) + "/" + requestID)
+}
+
+func (s *Storage) SaveReshareStart(start *ReshareStart) error {
+	pk, err := hexenc.ParseValidatorPK(start.ValidatorPK)
+	if err != nil {
+		return fmt.Errorf("failed to decode validator pk :: %s", err.Error())
+	}
+	value, err := json.Marshal(start)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reshare start :: %s", err.Error())
+	}
+	return s.db.Update(func(txn Txn) error {
+		return txn.Set(reshareKey(pk, start.RequestID), value)
+	})
+}
+
+// ListReshareStarts returns the resharings of the validator this node joined
+func (s *Storage) ListReshareStarts(pk types.ValidatorPK) ([]*ReshareStart, error) {
+	starts := make([]*ReshareStart, 0)
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(reshareBase+hex.EncodeToString(pk)+"/"), func(_, val []byte) error {
+			start := &ReshareStart{}
+			if err := json.Unmarshal(val, start); err != nil {
+				return fmt.Errorf("failed to unmarshal reshare start :: %s", err.Error())
+			}
+			starts = append(starts, start)
+			return nil
+		})
+	})
+	return starts, err
+}
@@ -0,0 +1,49 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReshareStarts(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+	reshared := testKeyGenOutput(1, 2, 3, 4)
+	other := testKeyGenOutput(1, 2, 3, 4)
+	for i, requestID := range []string{"aa", "bb"} {
+		require.NoError(t, s.SaveReshareStart(&ReshareStart{ValidatorPK: hex.EncodeToString(reshared.ValidatorPK), RequestID: requestID, StartedAt: int64(i)}))
+	}
+	require.NoError(t, s.SaveReshareStart(&ReshareStart{ValidatorPK: hex.EncodeToString(other.ValidatorPK), RequestID: "cc"}))
+
+	starts, err := s.ListReshareStarts(reshared.ValidatorPK)
+	require.NoError(t, err)
+	require.Len(t, starts, 2)
+	require.Equal(t, "bb", starts[1].RequestID)
+	require.Equal(t, int64(1), starts[1].StartedAt)
+
+	starts, err = s.ListReshareStarts(reshared.ValidatorPK[:4])
+	require.NoError(t, err)
+	require.Empty(t, starts)
+}
@@ -0,0 +1,130 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+)
+
+// Purged counts the keys a purge deleted and the bytes of their keys and values
+type Purged struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (p *Purged) Add(other *Purged) {
+	p.Keys += other.Keys
+	p.Bytes += other.Bytes
+}
+
+// CeremonyEnd is a ceremony that reached a terminal state and when it did
+type CeremonyEnd struct {
+	RequestID string
+	State     ceremony.State
+	EndedAt   time.Time
+}
+
+// ListEndedCeremonies returns the ceremonies in a terminal state with the
+// time of their last event
+func (s *Storage) ListEndedCeremonies() ([]*CeremonyEnd, error) {
+	var ended []*CeremonyEnd
+	for _, state := range ceremony.States {
+		if !state.IsTerminal() {
+			continue
+		}
+		opts := ListOptions{Limit: MaxListLimit}
+		for {
+			ids, next, err := s.ListCeremoniesByStatus(state, opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, requestID := range ids {
+				events, err := s.GetCeremonyEvents(requestID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get events of ceremony %s :: %s", requestID, err.Error())
+				}
+				ended = append(ended, &CeremonyEnd{RequestID: requestID, State: state, EndedAt: events[len(events)-1].Time})
+			}
+			if next == "" {
+				break
+			}
+			opts.After = next
+		}
+	}
+	return ended, nil
+}
+
+// PurgeJournals deletes the transcript and committee outputs of a ceremony,
+// its events stay
+func (s *Storage) PurgeJournals(requestID string) (*Purged, error) {
+	purged := &Purged{}
+	err := s.db.Update(func(txn Txn) error {
+		return deleteKeys(txn, purged, transcriptKey(requestID), committeeOutputsKey(requestID))
+	})
+	return purged, err
+}
+
+// PurgeCeremony deletes everything stored about a ceremony: its events and
+// state index, attestation, transcript and committee outputs. The shares it
+// produced, their lineage, usage and reshare records are kept.
+func (s *Storage) PurgeCeremony(requestID string) (*Purged, error) {
+	purged := &Purged{}
+	err := s.db.Update(func(txn Txn) error {
+		var keys [][]byte
+		prefix := []byte(ceremonyKeyBase + requestID + "/")
+		if err := txn.Iterate(prefix, func(key, _ []byte) error {
+			keys = append(keys, append([]byte{}, key...))
+			return nil
+		}); err != nil {
+			return err
+		}
+		if state, err := txn.Get(ceremonyStateKey(requestID)); err == nil {
+			keys = append(keys, ceremonyStateKey(requestID), ceremonyStateIndexKey(ceremony.State(state), requestID))
+		} else if err != ErrKeyNotFound {
+			return err
+		}
+		keys = append(keys, attestationKey(requestID), transcriptKey(requestID), committeeOutputsKey(requestID))
+		return deleteKeys(txn, purged, keys...)
+	})
+	return purged, err
+}
+
+// deleteKeys deletes the keys that exist and counts them in purged
+func deleteKeys(txn Txn, purged *Purged, keys ...[]byte) error {
+	for _, key := range keys {
+		value, err := txn.Get(key)
+		if err == ErrKeyNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+		purged.Keys++
+		purged.Bytes += int64(len(key) + len(value))
+	}
+	return nil
+}
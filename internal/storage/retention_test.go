@@ -0,0 +1,80 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeCeremony(t *testing.T) {
+	s := NewStorage(testBadgerDB(t), 1, nil)
+	tracker := ceremony.NewTracker(s)
+	output := testKeyGenOutput(1, 2, 3, 4)
+	require.NoError(t, s.SaveKeyGenOutput(output))
+	pk := hex.EncodeToString(output.ValidatorPK)
+	completeCeremony(t, tracker, "keygen", &ceremony.Params{Kind: ceremony.KindKeygen, Operators: []types.OperatorID{1, 2, 3, 4}, Threshold: 3}, pk)
+	recordCeremony(t, tracker, "running", ceremony.EventCreated, ceremony.EventInitialized)
+	require.NoError(t, s.SaveTranscript(&observer.TranscriptRecord{RequestID: "keygen"}))
+	require.NoError(t, s.UpdateCommitteeOutputs("keygen", func(*observer.CommitteeOutputs) error { return nil }))
+
+	ended, err := s.ListEndedCeremonies()
+	require.NoError(t, err)
+	require.Len(t, ended, 1)
+	require.Equal(t, "keygen", ended[0].RequestID)
+	require.Equal(t, ceremony.StateCompleted, ended[0].State)
+
+	purged, err := s.PurgeJournals("keygen")
+	require.NoError(t, err)
+	require.Equal(t, 2, purged.Keys)
+	require.Positive(t, purged.Bytes)
+	_, err = s.GetTranscript("keygen")
+	require.ErrorIs(t, err, observer.ErrNoTranscript)
+	_, err = s.GetCeremonyEvents("keygen")
+	require.NoError(t, err, "the events outlive the journals")
+
+	purged, err = s.PurgeCeremony("keygen")
+	require.NoError(t, err)
+	// five events and the two state index keys
+	require.Equal(t, 7, purged.Keys)
+	_, err = s.GetCeremonyEvents("keygen")
+	require.ErrorIs(t, err, ceremony.ErrCeremonyNotFound)
+	ended, err = s.ListEndedCeremonies()
+	require.NoError(t, err)
+	require.Empty(t, ended)
+	_, err = s.GetCeremonyEvents("running")
+	require.NoError(t, err)
+
+	// the share and its lineage are kept, also through a reindex
+	_, err = s.GetKeyGenOutput(output.ValidatorPK)
+	require.NoError(t, err)
+	require.NoError(t, s.Reindex())
+	lineage, err := s.Lineage(output.ValidatorPK)
+	require.NoError(t, err)
+	require.Len(t, lineage, 1)
+	require.Equal(t, "keygen", lineage[0].RequestID)
+}
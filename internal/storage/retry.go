@@ -0,0 +1,82 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// ErrConflict is returned by Update when a transaction kept conflicting with
+// concurrent writes after every retry
+var ErrConflict = badger.ErrConflict
+
+// RetryPolicy bounds how often an update conflicting with a concurrent one is
+// run again. Two ceremonies finishing at once write their results and events
+// concurrently; badger aborts a transaction whose reads were written by
+// another one committed in the meantime, postgres a serializable transaction.
+type RetryPolicy struct {
+	// Attempts is the number of times an update runs, 1 turns retries off
+	Attempts int
+	// Backoff is the wait before the first retry, doubled for every next one
+	Backoff time.Duration
+	// MaxBackoff caps the wait between retries
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   10,
+	Backoff:    2 * time.Millisecond,
+	MaxBackoff: 250 * time.Millisecond,
+}
+
+// IsConflict reports whether err is a transaction conflict of either backend
+func IsConflict(err error) bool {
+	if errors.Is(err, badger.ErrConflict) {
+		return true
+	}
+	// lib/pq and pgx both keep the message of serialization_failure (40001)
+	return err != nil && strings.Contains(err.Error(), "could not serialize access")
+}
+
+// retry runs update until it doesn't conflict, waiting a jittered, growing
+// backoff between attempts. update must have no side effects outside the
+// transaction, it may run more than once.
+func (p RetryPolicy) retry(update func() error) error {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := update()
+		if err == nil || !IsConflict(err) || attempt >= p.Attempts {
+			return err
+		}
+		if backoff > 0 {
+			time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+			if backoff *= 2; p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+				backoff = p.MaxBackoff
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// SQLDB keeps the key value pairs in a single table of a Postgres database.
+// The driver is registered by the binary, see cmd/node/postgres.go.
+type SQLDB struct {
+	db    *sql.DB
+	retry RetryPolicy
+}
+
+func OpenSQLDB(driver, dsn string) (*SQLDB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to %s database: %w", driver, err)
+	}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS kv (key BYTEA PRIMARY KEY, value BYTEA NOT NULL)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create kv table: %w", err)
+	}
+	return &SQLDB{db: db, retry: DefaultRetryPolicy}, nil
+}
+
+// SQL returns the underlying database, the failover lease lives next to the data
+func (s *SQLDB) SQL() *sql.DB {
+	return s.db
+}
+
+func (s *SQLDB) View(fn func(txn Txn) error) error {
+	return s.run(&sql.TxOptions{ReadOnly: true}, fn)
+}
+
+func (s *SQLDB) Update(fn func(txn Txn) error) error {
+	return s.retry.retry(func() error {
+		return s.run(&sql.TxOptions{Isolation: sql.LevelSerializable}, fn)
+	})
+}
+
+// Batch writes in one transaction, without the serializable isolation of
+// Update as it doesn't read
+func (s *SQLDB) Batch(fn func(w Writer) error) error {
+	return s.run(&sql.TxOptions{}, func(txn Txn) error {
+		return fn(txn)
+	})
+}
+
+// SetRetryPolicy replaces how updates failing on a serialization conflict are retried
+func (s *SQLDB) SetRetryPolicy(policy RetryPolicy) {
+	s.retry = policy
+}
+
+func (s *SQLDB) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLDB) run(opts *sql.TxOptions, fn func(txn Txn) error) error {
+	tx, err := s.db.BeginTx(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+	if err := fn(&sqlTxn{tx: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqlTxn struct {
+	tx *sql.Tx
+}
+
+func (t *sqlTxn) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := t.tx.QueryRow(`SELECT value FROM kv WHERE key = $1`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, ErrKeyNotFound
+	}
+	return value, err
+}
+
+func (t *sqlTxn) Set(key, value []byte) error {
+	_, err := t.tx.Exec(`INSERT INTO kv (key, value) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value`, key, value)
+	return err
+}
+
+func (t *sqlTxn) Delete(key []byte) error {
+	_, err := t.tx.Exec(`DELETE FROM kv WHERE key = $1`, key)
+	return err
+}
+
+func (t *sqlTxn) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return t.IterateFrom(prefix, prefix, fn)
+}
+
+func (t *sqlTxn) IterateFrom(prefix, start []byte, fn func(key, value []byte) error) error {
+	rows, err := t.tx.Query(`SELECT key, value FROM kv WHERE substring(key from 1 for $2) = $1 AND key >= $3 ORDER BY key`, prefix, len(prefix), start)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -26,11 +26,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 
+	"github.com/RockX-SG/frost-dkg-demo/pkg/artifacts"
 	"github.com/bloxapp/ssv-spec/dkg"
 	"github.com/bloxapp/ssv-spec/types"
-	"github.com/dgraph-io/badger/v3"
-	"github.com/herumi/bls-eth-go-binary/bls"
 )
 
 var (
@@ -38,120 +39,43 @@ var (
 )
 
 type Storage struct {
-	db           *badger.DB
+	db           DB
 	thisOperator types.OperatorID
 	thisSK       *rsa.PrivateKey
+
+	operatorCache OperatorCachePolicy
+	mu            sync.Mutex
+	refreshing    map[types.OperatorID]bool
 }
 
-func NewStorage(db *badger.DB, operatorID types.OperatorID, operatorKey *rsa.PrivateKey) dkg.Storage {
+func NewStorage(db DB, operatorID types.OperatorID, operatorKey *rsa.PrivateKey) *Storage {
 	return &Storage{
-		db:           db,
-		thisOperator: operatorID,
-		thisSK:       operatorKey,
+		db:            db,
+		thisOperator:  operatorID,
+		thisSK:        operatorKey,
+		operatorCache: DefaultOperatorCachePolicy,
+		refreshing:    make(map[types.OperatorID]bool),
 	}
 }
 
+// GetDKGOperator returns the operator from the cache, fetching it from the
+// registry on a miss and revalidating it once it is older than the cache ttl
 func (s *Storage) GetDKGOperator(operatorID types.OperatorID) (bool, *dkg.Operator, error) {
-
-	var (
-		val          []byte
-		requireFetch bool   = false
-		key          string = fmt.Sprintf("operator/%d", operatorID)
-	)
-
-	err := s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(key))
-		if err != nil {
-			return err
-		}
-		val, err = item.ValueCopy(nil)
-		return err
-	})
-	if err == badger.ErrKeyNotFound {
-		requireFetch = true
-	} else if err != nil {
+	record, err := s.cachedOperator(operatorID)
+	if err != nil {
 		return false, nil, err
 	}
 
-	var operator = new(dkg.Operator)
-	if !requireFetch {
-		if err := json.Unmarshal(val, operator); err != nil {
-			return false, nil, err
-		}
-	} else {
-		operator, err = FetchOperatorByID(operatorID)
-		if err != nil {
-			return false, nil, err
-		}
-		value, err := json.Marshal(operator)
-		if err != nil {
-			return false, nil, fmt.Errorf("failed to marshal keygen output :: %s", err.Error())
-		}
-		if err = s.db.Update(func(txn *badger.Txn) error {
-			return txn.Set([]byte(key), value)
-		}); err != nil {
-			return false, nil, err
-		}
-	}
-
+	operator := *record.Operator
 	if operatorID == s.thisOperator {
 		operator.EncryptionPrivateKey = s.thisSK
 	}
 
-	return true, operator, nil
+	return true, &operator, nil
 }
 
-type KeyGenOutput struct {
-	Share           string
-	OperatorPubKeys map[types.OperatorID]string
-	ValidatorPK     string
-	Threshold       uint64
-}
-
-func (o *KeyGenOutput) Encode(output *dkg.KeyGenOutput) ([]byte, error) {
-	kgo := &KeyGenOutput{
-		Share:           output.Share.SerializeToHexStr(),
-		OperatorPubKeys: make(map[types.OperatorID]string),
-		ValidatorPK:     hex.EncodeToString(output.ValidatorPK),
-		Threshold:       output.Threshold,
-	}
-	for operatorID, pk := range output.OperatorPubKeys {
-		kgo.OperatorPubKeys[operatorID] = pk.SerializeToHexStr()
-	}
-	return json.Marshal(kgo)
-}
-
-func (o *KeyGenOutput) Decode(output []byte) (*dkg.KeyGenOutput, error) {
-	if err := json.Unmarshal(output, o); err != nil {
-		return nil, err
-	}
-
-	kgo := &dkg.KeyGenOutput{
-		OperatorPubKeys: make(map[types.OperatorID]*bls.PublicKey),
-		Threshold:       o.Threshold,
-	}
-
-	vk, err := hex.DecodeString(o.ValidatorPK)
-	if err != nil {
-		return nil, err
-	}
-	kgo.ValidatorPK = vk
-
-	share := bls.SecretKey{}
-	if err := share.DeserializeHexStr(o.Share); err != nil {
-		return nil, err
-	}
-	kgo.Share = &share
-
-	for operatorID, pkhex := range o.OperatorPubKeys {
-		pk := bls.PublicKey{}
-		if err := pk.DeserializeHexStr(pkhex); err != nil {
-			return nil, err
-		}
-		kgo.OperatorPubKeys[operatorID] = &pk
-	}
-	return kgo, nil
-}
+// KeyGenOutput is the codec of the stored shares, part of the public artifacts
+type KeyGenOutput = artifacts.KeyGenOutput
 
 func (s *Storage) SaveKeyGenOutput(output *dkg.KeyGenOutput) error {
 	kgo := &KeyGenOutput{}
@@ -160,23 +84,30 @@ func (s *Storage) SaveKeyGenOutput(output *dkg.KeyGenOutput) error {
 		return fmt.Errorf("failed to marshal keygen output :: %s", err.Error())
 	}
 
-	return s.db.Update(func(txn *badger.Txn) error {
-		return txn.Set([]byte(output.ValidatorPK), value)
+	share := &ValidatorShare{ValidatorPK: output.ValidatorPK, Threshold: output.Threshold}
+	for operatorID := range output.OperatorPubKeys {
+		share.Operators = append(share.Operators, operatorID)
+	}
+
+	return s.db.Update(func(txn Txn) error {
+		if err := txn.Delete(handoverTombstoneKey(output.ValidatorPK)); err != nil {
+			return err
+		}
+		if err := txn.Set([]byte(output.ValidatorPK), value); err != nil {
+			return err
+		}
+		return indexShare(txn, share)
 	})
 }
 
 func (s *Storage) GetKeyGenOutput(pk types.ValidatorPK) (*dkg.KeyGenOutput, error) {
-	var val []byte
-	err := s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(pk))
-		if err != nil {
-			return err
+	val, err := s.get([]byte(pk))
+	if err == ErrKeyNotFound {
+		if _, tombstoneErr := s.GetHandoverTombstone(pk); tombstoneErr == nil {
+			return nil, ErrShareHandedOver
 		}
-
-		val, err = item.ValueCopy(nil)
-		return err
-	})
-	if err != nil {
+		return nil, err
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -187,3 +118,39 @@ func (s *Storage) GetKeyGenOutput(pk types.ValidatorPK) (*dkg.KeyGenOutput, erro
 	}
 	return result, nil
 }
+
+// ValidatorShare describes a share held by this node without its secret
+type ValidatorShare struct {
+	ValidatorPK types.ValidatorPK
+	Operators   []types.OperatorID
+	Threshold   uint64
+}
+
+// ListValidatorShares lists the validators this node holds a share of. Shares
+// are stored under the bare validator public key, so every 48 byte key whose
+// value is a keygen output of that validator is one.
+func (s *Storage) ListValidatorShares() ([]*ValidatorShare, error) {
+	shares := []*ValidatorShare{}
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate(nil, func(key, value []byte) error {
+			if len(key) != 48 {
+				return nil
+			}
+			kgo := &KeyGenOutput{}
+			if err := json.Unmarshal(value, kgo); err != nil || kgo.ValidatorPK != hex.EncodeToString(key) {
+				return nil
+			}
+			share := &ValidatorShare{ValidatorPK: key, Threshold: kgo.Threshold}
+			for operatorID := range kgo.OperatorPubKeys {
+				share.Operators = append(share.Operators, operatorID)
+			}
+			sort.Slice(share.Operators, func(i, j int) bool { return share.Operators[i] < share.Operators[j] })
+			shares = append(shares, share)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list validator shares :: %s", err.Error())
+	}
+	return shares, nil
+}
@@ -0,0 +1,124 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/herumi/bls-eth-go-binary/bls"
+)
+
+func benchKeyGenOutput(b *testing.B, operators int) *dkg.KeyGenOutput {
+	types.InitBLS()
+	share := &bls.SecretKey{}
+	share.SetByCSPRNG()
+	output := &dkg.KeyGenOutput{
+		Share:           share,
+		ValidatorPK:     share.GetPublicKey().Serialize(),
+		OperatorPubKeys: make(map[types.OperatorID]*bls.PublicKey),
+		Threshold:       uint64(operators*2/3 + 1),
+	}
+	for i := 1; i <= operators; i++ {
+		sk := &bls.SecretKey{}
+		sk.SetByCSPRNG()
+		output.OperatorPubKeys[types.OperatorID(i)] = sk.GetPublicKey()
+	}
+	return output
+}
+
+func benchStorage(b *testing.B) *Storage {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return NewStorage(NewBadgerDB(db), 1, nil)
+}
+
+func BenchmarkKeyGenOutputEncode(b *testing.B) {
+	output := benchKeyGenOutput(b, 13)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := (&KeyGenOutput{}).Encode(output); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkKeyGenOutputDecode(b *testing.B) {
+	encoded, err := (&KeyGenOutput{}).Encode(benchKeyGenOutput(b, 13))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := (&KeyGenOutput{}).Decode(encoded); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSaveKeyGenOutput(b *testing.B) {
+	s := benchStorage(b)
+	output := benchKeyGenOutput(b, 4)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.SaveKeyGenOutput(output); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetKeyGenOutput(b *testing.B) {
+	s := benchStorage(b)
+	output := benchKeyGenOutput(b, 4)
+	if err := s.SaveKeyGenOutput(output); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetKeyGenOutput(output.ValidatorPK); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendCeremonyEvent(b *testing.B) {
+	s := benchStorage(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e := &ceremony.Event{Seq: uint64(i), Type: ceremony.EventMessageReceived, Operator: 2, Round: "round1"}
+		if err := s.AppendCeremonyEvent(fmt.Sprintf("%048d", i%100), e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
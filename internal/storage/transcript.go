@@ -0,0 +1,60 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/observer"
+)
+
+func transcriptKey(requestID string) []byte {
+	return []byte(fmt.Sprintf("transcript/%s", requestID))
+}
+
+// SaveTranscript keeps the transcript of a ceremony next to its output, a
+// transcript saved again for the same request replaces the earlier one
+func (s *Storage) SaveTranscript(record *observer.TranscriptRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transcript :: %s", err.Error())
+	}
+	return s.db.Update(func(txn Txn) error {
+		return txn.Set(transcriptKey(record.RequestID), value)
+	})
+}
+
+func (s *Storage) GetTranscript(requestID string) (*observer.TranscriptRecord, error) {
+	val, err := s.get(transcriptKey(requestID))
+	if err == ErrKeyNotFound {
+		return nil, observer.ErrNoTranscript
+	} else if err != nil {
+		return nil, err
+	}
+
+	record := &observer.TranscriptRecord{}
+	if err := json.Unmarshal(val, record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transcript :: %s", err.Error())
+	}
+	return record, nil
+}
@@ -0,0 +1,176 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/internal/signing"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// usageIndexBase keys what the shares of a validator signed by validator
+// public key and time: the deposit of its keygen and its keysigns
+const usageIndexBase = "index/usage/"
+
+// UsageEntry is a signature this node took part in with its share of a
+// validator, the deposit of a completed keygen or a keysign it was started
+// for, whatever became of it
+type UsageEntry struct {
+	RequestID   string             `json:"request_id"`
+	Kind        ceremony.Kind      `json:"kind"`
+	Usage       string             `json:"usage"`
+	DomainTag   string             `json:"domain_tag,omitempty"`
+	SigningRoot string             `json:"signing_root,omitempty"`
+	Message     json.RawMessage    `json:"message,omitempty"`
+	Operators   []types.OperatorID `json:"operators"`
+	Time        time.Time          `json:"time"`
+}
+
+// Usage returns what this node signed with its shares of the validator,
+// oldest first
+func (s *Storage) Usage(pk types.ValidatorPK) ([]*UsageEntry, error) {
+	entries := make([]*UsageEntry, 0)
+	err := s.db.View(func(txn Txn) error {
+		return txn.Iterate([]byte(usageIndexPrefix(hex.EncodeToString(pk))), func(_, value []byte) error {
+			entry := &UsageEntry{}
+			if err := json.Unmarshal(value, entry); err != nil {
+				return fmt.Errorf("failed to unmarshal usage entry :: %s", err.Error())
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// indexUsage adds a keysign to the usage of its validator when it is created
+// and a keygen when it completes, the params of a keygen come from its
+// created event
+func indexUsage(txn Txn, requestID string, e *ceremony.Event) error {
+	switch {
+	case e.Type == ceremony.EventCreated && e.Params != nil && e.Params.Kind == ceremony.KindKeySign:
+		return setUsageIndex(txn, requestID, e.Params, e)
+	case e.Type == ceremony.EventCompleted && e.ValidatorPK != "":
+		value, err := txn.Get(ceremonyEventKey(requestID, 1))
+		if err == ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		created := &ceremony.Event{}
+		if err := json.Unmarshal(value, created); err != nil {
+			return fmt.Errorf("failed to unmarshal ceremony event :: %s", err.Error())
+		}
+		if created.Params != nil && created.Params.Kind == ceremony.KindKeygen {
+			return setUsageIndex(txn, requestID, created.Params, e)
+		}
+	}
+	return nil
+}
+
+// ceremonyUsage adds a replayed keysign, or keygen when it completed, to the
+// usage of its validator
+func ceremonyUsage(w Writer, c *ceremony.Ceremony) error {
+	if c.Params == nil {
+		return nil
+	}
+	for _, e := range c.Events {
+		if c.Params.Kind == ceremony.KindKeySign && e.Type == ceremony.EventCreated {
+			return setUsageIndex(w, c.RequestID, c.Params, e)
+		}
+		if c.Params.Kind == ceremony.KindKeygen && e.Type == ceremony.EventCompleted && e.ValidatorPK != "" {
+			return setUsageIndex(w, c.RequestID, c.Params, e)
+		}
+	}
+	return nil
+}
+
+// setUsageIndex records the keysign params, or the deposit message a keygen
+// signs with its output. Canary keygens back no validator and are left out.
+func setUsageIndex(w Writer, requestID string, params *ceremony.Params, e *ceremony.Event) error {
+	entry := &UsageEntry{
+		RequestID: requestID,
+		Kind:      params.Kind,
+		Operators: sortedOperators(params.Operators),
+		Time:      e.Time,
+	}
+	pk := params.ValidatorPK
+	switch params.Kind {
+	case ceremony.KindKeySign:
+		entry.Usage = string(signing.UsageUndeclared)
+		if params.KeySign != nil {
+			entry.Usage = params.KeySign.Usage
+			entry.DomainTag = params.KeySign.DomainTag
+			entry.SigningRoot = params.KeySign.SigningRoot
+			entry.Message = params.KeySign.Message
+		}
+	case ceremony.KindKeygen:
+		if params.Canary != nil {
+			return nil
+		}
+		pk = e.ValidatorPK
+		entry.Usage = string(signing.UsageDeposit)
+		deposit := &signing.EthMessage{
+			ForkVersion:           params.ForkVersion,
+			WithdrawalCredentials: params.WithdrawalCredentials,
+			Amount:                types.MaxEffectiveBalanceInGwei,
+		}
+		if validatorPK, err := hexenc.Parse(pk); err == nil {
+			if root, err := deposit.SigningRoot(signing.UsageDeposit, validatorPK); err == nil {
+				entry.SigningRoot = hexenc.Format(root[:])
+			}
+		}
+		message, err := json.Marshal(deposit)
+		if err != nil {
+			return err
+		}
+		entry.Message = message
+	default:
+		return nil
+	}
+	if pk == "" {
+		return nil
+	}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return w.Set(usageIndexKey(pk, e.Time, requestID), value)
+}
+
+func usageIndexPrefix(pk string) string {
+	return usageIndexBase + strings.ToLower(strings.TrimPrefix(pk, "0x")) + "/"
+}
+
+func usageIndexKey(pk string, at time.Time, requestID string) []byte {
+	return []byte(fmt.Sprintf("%s%020d/%s", usageIndexPrefix(pk), at.UnixNano(), requestID))
+}
@@ -0,0 +1,362 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package telemetry reports anonymized aggregate statistics of the ceremonies
+// of a node to an endpoint, only when its operator opted in. A report holds
+// counts, durations and failure causes per ceremony kind and never request
+// ids, operator ids, keys, addresses or anything else naming a ceremony.
+package telemetry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SchemaVersion is the version of the report schema, bumped when a field
+	// changes meaning or goes away
+	SchemaVersion = 1
+	// DefaultInterval is the time between two reports and the period one covers
+	DefaultInterval = 24 * time.Hour
+	// MinInterval keeps the reported periods coarse
+	MinInterval = time.Hour
+
+	// InstallationIDFile is the file in the data directory holding the random
+	// id that tells reports of one installation apart
+	InstallationIDFile = "telemetry_id"
+
+	ModeOff = "off"
+	ModeOn  = "on"
+)
+
+// Config is where and how often reports go, nothing is sent unless Enabled
+type Config struct {
+	Enabled  bool
+	Endpoint string
+	Interval time.Duration
+}
+
+func (c Config) String() string {
+	if !c.Enabled {
+		return ModeOff
+	}
+	return fmt.Sprintf("%s endpoint=%s interval=%s", ModeOn, c.Endpoint, c.Interval)
+}
+
+// ParseMode reads the telemetry mode, off when empty
+func ParseMode(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", ModeOff:
+		return false, nil
+	case ModeOn:
+		return true, nil
+	}
+	return false, fmt.Errorf("telemetry must be %s or %s, got %q", ModeOff, ModeOn, value)
+}
+
+// Validate checks an enabled config has an http(s) endpoint and a period of
+// at least MinInterval
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("telemetry endpoint must be an http(s) url, got %q", c.Endpoint)
+	}
+	if c.Interval < MinInterval {
+		return fmt.Errorf("telemetry interval must be at least %s", MinInterval)
+	}
+	return nil
+}
+
+// Durations are the durations in whole seconds of the completed ceremonies
+// of a kind, from their start to their result
+type Durations struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+}
+
+// KindReport counts the ceremonies of a kind that ended in the period
+type KindReport struct {
+	Ended           int       `json:"ended"`
+	Completed       int       `json:"completed"`
+	Failed          int       `json:"failed"`
+	DurationSeconds Durations `json:"duration_seconds"`
+
+	seconds []float64
+}
+
+// Report is the payload posted to the endpoint, see the README for the schema
+type Report struct {
+	Schema          int    `json:"schema"`
+	InstallationID  string `json:"installation_id"`
+	Component       string `json:"component"`
+	Version         string `json:"version"`
+	ProtocolVersion uint32 `json:"protocol_version"`
+	// PeriodStart and PeriodEnd are whole hours, the report counts the
+	// ceremonies that ended in between
+	PeriodStart time.Time                     `json:"period_start"`
+	PeriodEnd   time.Time                     `json:"period_end"`
+	Ceremonies  map[ceremony.Kind]*KindReport `json:"ceremonies"`
+	// FailureCauses counts the failed ceremonies of all kinds by cause
+	FailureCauses map[ceremony.Cause]int `json:"failure_causes"`
+}
+
+// Build aggregates the ceremonies that ended from since until until, running
+// ones and those without parameters are left out
+func Build(ceremonies []*ceremony.Ceremony, since, until time.Time) *Report {
+	report := &Report{
+		Schema:          SchemaVersion,
+		ProtocolVersion: ceremony.ProtocolVersion,
+		PeriodStart:     since.UTC(),
+		PeriodEnd:       until.UTC(),
+		Ceremonies:      make(map[ceremony.Kind]*KindReport),
+		FailureCauses:   make(map[ceremony.Cause]int),
+	}
+	for _, kind := range []ceremony.Kind{ceremony.KindKeygen, ceremony.KindReshare, ceremony.KindKeySign} {
+		report.Ceremonies[kind] = &KindReport{}
+	}
+	for _, c := range ceremonies {
+		if !c.State.IsTerminal() || c.Params == nil || c.UpdatedAt.Before(since) || !c.UpdatedAt.Before(until) {
+			continue
+		}
+		kind, ok := report.Ceremonies[c.Params.Kind]
+		if !ok {
+			continue
+		}
+		kind.Ended++
+		if c.State == ceremony.StateCompleted {
+			kind.Completed++
+			kind.seconds = append(kind.seconds, math.Round(c.UpdatedAt.Sub(c.CreatedAt).Seconds()))
+			continue
+		}
+		kind.Failed++
+		cause := c.Cause
+		if cause == "" {
+			cause = ceremony.CauseOther
+		}
+		report.FailureCauses[cause]++
+	}
+	for _, kind := range report.Ceremonies {
+		kind.finish()
+	}
+	return report
+}
+
+func (k *KindReport) finish() {
+	if len(k.seconds) == 0 {
+		return
+	}
+	sort.Float64s(k.seconds)
+	total := 0.0
+	for _, s := range k.seconds {
+		total += s
+	}
+	k.DurationSeconds = Durations{
+		Mean: math.Round(total / float64(len(k.seconds))),
+		P50:  percentile(k.seconds, 50),
+		P90:  percentile(k.seconds, 90),
+	}
+}
+
+// percentile is the nearest rank percentile of sorted values
+func percentile(sorted []float64, p int) float64 {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// InstallationID reads the random id of the installation from dir, creating
+// it on first use. It is the only thing tying two reports together.
+func InstallationID(dir string) (string, error) {
+	path := filepath.Join(dir, InstallationIDFile)
+	if data, err := os.ReadFile(path); err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("InstallationID: failed to read %s: %w", path, err)
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("InstallationID: %w", err)
+	}
+	id := hex.EncodeToString(b)
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("InstallationID: failed to write %s: %w", path, err)
+	}
+	return id, nil
+}
+
+// Source lists the ceremonies a report is built from
+type Source func() ([]*ceremony.Ceremony, error)
+
+// Reporter posts a report every interval while telemetry is on, and builds
+// the same report for a preview whether it is on or not
+type Reporter struct {
+	config         Config
+	component      string
+	version        string
+	installationID string
+	source         Source
+	client         *http.Client
+	logger         *logrus.Logger
+	now            func() time.Time
+	// active tells whether this instance sends, only the leader of a
+	// failover group does
+	active func() bool
+
+	mu sync.Mutex
+	// since is the start of the next period, the end of the last one sent
+	since time.Time
+}
+
+func NewReporter(config Config, component, version, installationID string, source Source, logger *logrus.Logger) *Reporter {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if version == "" {
+		version = "unknown"
+	}
+	return &Reporter{
+		config:         config,
+		component:      component,
+		version:        version,
+		installationID: installationID,
+		source:         source,
+		client:         &http.Client{Timeout: 30 * time.Second},
+		logger:         logger,
+		now:            time.Now,
+		active:         func() bool { return true },
+	}
+}
+
+// OnlyWhen restricts the reports to the times active holds, e.g. while this
+// instance leads a failover group
+func (r *Reporter) OnlyWhen(active func() bool) *Reporter {
+	r.active = active
+	return r
+}
+
+func (r *Reporter) Enabled() bool {
+	return r.config.Enabled
+}
+
+// Preview is the report the next send would post
+func (r *Reporter) Preview() (*Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.build()
+}
+
+func (r *Reporter) build() (*Report, error) {
+	until := r.now().UTC().Truncate(time.Hour)
+	since := r.since
+	if since.IsZero() {
+		since = until.Add(-r.config.Interval)
+	}
+	ceremonies, err := r.source()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ceremonies: %w", err)
+	}
+	report := Build(ceremonies, since, until)
+	report.InstallationID = r.installationID
+	report.Component = r.component
+	report.Version = r.version
+	return report, nil
+}
+
+// Send posts the report of the period since the last one sent, a period that
+// failed to send is covered by the next report
+func (r *Reporter) Send() (*Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.config.Enabled {
+		return nil, fmt.Errorf("Send: telemetry is %s", ModeOff)
+	}
+	report, err := r.build()
+	if err != nil {
+		return nil, fmt.Errorf("Send: %w", err)
+	}
+	if !report.PeriodEnd.After(report.PeriodStart) {
+		return report, nil
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("Send: %w", err)
+	}
+	resp, err := r.client.Post(r.config.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("Send: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("Send: endpoint answered %s: %s", resp.Status, string(respBody))
+	}
+	r.since = report.PeriodEnd
+	return report, nil
+}
+
+// Run sends a report every interval until done is closed, it returns at once
+// when telemetry is off
+func (r *Reporter) Run(done <-chan struct{}) {
+	if !r.config.Enabled {
+		return
+	}
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if !r.active() {
+			continue
+		}
+		if report, err := r.Send(); err != nil {
+			r.logger.Warnf("Reporter: %v", err)
+		} else {
+			r.logger.Debugf("Reporter: sent telemetry of %s to %s", report.PeriodStart.Format(time.RFC3339), report.PeriodEnd.Format(time.RFC3339))
+		}
+	}
+}
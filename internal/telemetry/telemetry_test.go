@@ -0,0 +1,153 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package telemetry
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func testCeremony(kind ceremony.Kind, state ceremony.State, cause ceremony.Cause, end time.Time, took time.Duration) *ceremony.Ceremony {
+	return &ceremony.Ceremony{
+		RequestID: "9a45c1f30a9896c5263508c2a132ebf7fc7e3c37ab86c74b",
+		State:     state,
+		Cause:     cause,
+		Params:    &ceremony.Params{Kind: kind, Operators: []types.OperatorID{1, 2, 3, 4}},
+		CreatedAt: end.Add(-took),
+		UpdatedAt: end,
+	}
+}
+
+func TestBuild(t *testing.T) {
+	since := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(24 * time.Hour)
+	at := func(hour int) time.Time { return since.Add(time.Duration(hour) * time.Hour) }
+	ceremonies := []*ceremony.Ceremony{
+		testCeremony(ceremony.KindKeygen, ceremony.StateCompleted, "", at(1), 10*time.Second),
+		testCeremony(ceremony.KindKeygen, ceremony.StateCompleted, "", at(2), 20*time.Second),
+		testCeremony(ceremony.KindKeygen, ceremony.StateCompleted, "", at(3), 60*time.Second),
+		testCeremony(ceremony.KindKeygen, ceremony.StateAborted, ceremony.CauseMissingMessage, at(4), time.Minute),
+		testCeremony(ceremony.KindReshare, ceremony.StateBlamed, "", at(5), time.Minute),
+		// running, and ended outside the period
+		testCeremony(ceremony.KindKeygen, ceremony.StateRound1, "", at(6), time.Minute),
+		testCeremony(ceremony.KindKeygen, ceremony.StateCompleted, "", at(-1), time.Minute),
+		testCeremony(ceremony.KindKeygen, ceremony.StateCompleted, "", until, time.Minute),
+	}
+
+	report := Build(ceremonies, since, until)
+	require.Equal(t, SchemaVersion, report.Schema)
+	require.Equal(t, ceremony.ProtocolVersion, report.ProtocolVersion)
+	require.Equal(t, &KindReport{Ended: 4, Completed: 3, Failed: 1, DurationSeconds: Durations{Mean: 30, P50: 20, P90: 60}, seconds: []float64{10, 20, 60}}, report.Ceremonies[ceremony.KindKeygen])
+	require.Equal(t, 1, report.Ceremonies[ceremony.KindReshare].Failed)
+	require.Equal(t, &KindReport{}, report.Ceremonies[ceremony.KindKeySign], "kinds without ceremonies are listed")
+	require.Equal(t, map[ceremony.Cause]int{ceremony.CauseMissingMessage: 1, ceremony.CauseOther: 1}, report.FailureCauses)
+
+	payload, err := json.Marshal(report)
+	require.NoError(t, err)
+	require.NotContains(t, string(payload), ceremonies[0].RequestID, "request ids are never reported")
+	require.NotContains(t, string(payload), "operators")
+}
+
+func TestParseMode(t *testing.T) {
+	for value, enabled := range map[string]bool{"": false, "off": false, "on": true, "ON": true} {
+		parsed, err := ParseMode(value)
+		require.NoError(t, err)
+		require.Equal(t, enabled, parsed, value)
+	}
+	_, err := ParseMode("yes")
+	require.Error(t, err)
+
+	require.NoError(t, Config{}.Validate(), "off needs no endpoint")
+	require.Error(t, Config{Enabled: true, Interval: DefaultInterval}.Validate())
+	require.Error(t, Config{Enabled: true, Endpoint: "https://telemetry.example.com", Interval: time.Minute}.Validate())
+	require.NoError(t, Config{Enabled: true, Endpoint: "https://telemetry.example.com", Interval: DefaultInterval}.Validate())
+}
+
+func TestInstallationID(t *testing.T) {
+	dir := t.TempDir()
+	id, err := InstallationID(dir)
+	require.NoError(t, err)
+	require.Len(t, id, 32)
+	again, err := InstallationID(dir)
+	require.NoError(t, err)
+	require.Equal(t, id, again, "the id is kept in the data directory")
+	data, err := os.ReadFile(filepath.Join(dir, InstallationIDFile))
+	require.NoError(t, err)
+	require.Equal(t, id, strings.TrimSpace(string(data)))
+}
+
+func TestReporterSend(t *testing.T) {
+	var posted []*Report
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		report := &Report{}
+		require.NoError(t, json.Unmarshal(body, report))
+		posted = append(posted, report)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2023, 4, 2, 0, 30, 0, 0, time.UTC)
+	ceremonies := []*ceremony.Ceremony{
+		testCeremony(ceremony.KindKeygen, ceremony.StateCompleted, "", now.Add(-2*time.Hour), 10*time.Second),
+	}
+	source := func() ([]*ceremony.Ceremony, error) { return ceremonies, nil }
+
+	off := NewReporter(Config{}, "node", "v1.0.0", "abc", source, logrus.New())
+	off.now = func() time.Time { return now }
+	preview, err := off.Preview()
+	require.NoError(t, err, "the preview works with telemetry off")
+	require.Equal(t, 1, preview.Ceremonies[ceremony.KindKeygen].Completed)
+	_, err = off.Send()
+	require.Error(t, err)
+
+	reporter := NewReporter(Config{Enabled: true, Endpoint: srv.URL, Interval: DefaultInterval}, "node", "v1.0.0", "abc", source, logrus.New())
+	reporter.now = func() time.Time { return now }
+	preview, err = reporter.Preview()
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), preview.PeriodStart)
+	require.Equal(t, time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC), preview.PeriodEnd)
+
+	sent, err := reporter.Send()
+	require.NoError(t, err)
+	require.Len(t, posted, 1)
+	require.Equal(t, preview.PeriodEnd, posted[0].PeriodEnd)
+	require.Equal(t, "abc", posted[0].InstallationID)
+	require.Equal(t, 1, posted[0].Ceremonies[ceremony.KindKeygen].Completed)
+
+	reporter.now = func() time.Time { return now.Add(24 * time.Hour) }
+	next, err := reporter.Preview()
+	require.NoError(t, err)
+	require.Equal(t, sent.PeriodEnd, next.PeriodStart, "the next period starts where the sent one ended")
+	require.Zero(t, next.Ceremonies[ceremony.KindKeygen].Ended)
+}
@@ -0,0 +1,248 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package topiccache keeps what the cli last fetched about the topics of its
+// ceremonies, so their state can be inspected while the messenger is down.
+package topiccache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// MaxEntries is how many topics are kept, the least recently updated go first
+const MaxEntries = 500
+
+var ErrNotCached = errors.New("topic not in cache")
+
+// Delivery is the outcome of sending the start message of a ceremony
+type Delivery struct {
+	At        int64              `json:"at"`
+	Operators []types.OperatorID `json:"operators"`
+	// Error is why the message didn't reach every operator, empty when it did
+	Error string `json:"error,omitempty"`
+}
+
+type Entry struct {
+	RequestID string        `json:"request_id"`
+	Kind      ceremony.Kind `json:"kind,omitempty"`
+	// Subscribers are the operators subscribed to the topic
+	Subscribers []string  `json:"subscribers,omitempty"`
+	Delivery    *Delivery `json:"delivery,omitempty"`
+	// ManifestHash is the hash of the manifest the start message was sent with
+	ManifestHash string                                 `json:"manifest_hash,omitempty"`
+	Outputs      map[types.OperatorID]*dkg.SignedOutput `json:"outputs,omitempty"`
+	Result       *messengerclient.DataStore             `json:"result,omitempty"`
+	// ResultETag is the etag the messenger sent the result with, the cli
+	// asks for the result with it and gets 304 instead of the result again
+	ResultETag string `json:"result_etag,omitempty"`
+	// FetchedAt is when the messenger last answered for the topic, zero when
+	// only the delivery is known
+	FetchedAt int64 `json:"fetched_at,omitempty"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// Age is how old the data fetched from the messenger is
+func (e *Entry) Age(now time.Time) time.Duration {
+	if e.FetchedAt == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(e.FetchedAt, 0))
+}
+
+// Cache maps request IDs to what was last seen of their topic, it is stored
+// as a json file next to the cli
+type Cache struct {
+	mu     sync.Mutex
+	path   string
+	Topics map[string]*Entry `json:"topics"`
+}
+
+// DefaultPath is $DKG_TOPIC_CACHE or ~/.rockx-dkg/topics.json
+func DefaultPath() string {
+	if path := os.Getenv("DKG_TOPIC_CACHE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "topics.json"
+	}
+	return filepath.Join(home, ".rockx-dkg", "topics.json")
+}
+
+// Load reads the cache at path, a missing file is an empty cache
+func Load(path string) (*Cache, error) {
+	cache := &Cache{path: path, Topics: make(map[string]*Entry)}
+
+	byts, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read topic cache %s: %w", path, err)
+	}
+	if err := json.Unmarshal(byts, cache); err != nil {
+		return nil, fmt.Errorf("failed to parse topic cache %s: %w", path, err)
+	}
+	if cache.Topics == nil {
+		cache.Topics = make(map[string]*Entry)
+	}
+	return cache, nil
+}
+
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evict()
+	byts, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, byts, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// evict drops the least recently updated topics beyond MaxEntries
+func (c *Cache) evict() {
+	if len(c.Topics) <= MaxEntries {
+		return
+	}
+	entries := c.list()
+	for _, entry := range entries[MaxEntries:] {
+		delete(c.Topics, entry.RequestID)
+	}
+}
+
+func (c *Cache) Get(requestID string) (*Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.Topics[requestID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotCached, requestID)
+	}
+	return entry, nil
+}
+
+// List returns the entries, the most recently updated first
+func (c *Cache) List() []*Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.list()
+}
+
+func (c *Cache) list() []*Entry {
+	entries := make([]*Entry, 0, len(c.Topics))
+	for _, entry := range c.Topics {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].UpdatedAt != entries[j].UpdatedAt {
+			return entries[i].UpdatedAt > entries[j].UpdatedAt
+		}
+		return entries[i].RequestID < entries[j].RequestID
+	})
+	return entries
+}
+
+// SetDelivery records the outcome of sending the start message
+func (c *Cache) SetDelivery(requestID string, kind ceremony.Kind, operators []types.OperatorID, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entry(requestID)
+	entry.Kind = kind
+	entry.Delivery = &Delivery{At: entry.UpdatedAt, Operators: operators}
+	if err != nil {
+		entry.Delivery.Error = err.Error()
+	}
+}
+
+// SetManifestHash records the hash of the manifest of the ceremony
+func (c *Cache) SetManifestHash(requestID string, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entry(requestID).ManifestHash = hash
+}
+
+// SetSubscribers records the operators subscribed to the topic
+func (c *Cache) SetSubscribers(requestID string, subscribers []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.fetched(requestID)
+	entry.Subscribers = subscribers
+}
+
+// SetOutputs records the outputs published to the topic so far
+func (c *Cache) SetOutputs(requestID string, outputs map[types.OperatorID]*dkg.SignedOutput) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.fetched(requestID)
+	entry.Outputs = outputs
+}
+
+// SetResult records the result of the ceremony with its etag, the outputs it
+// holds aren't kept twice
+func (c *Cache) SetResult(requestID string, result *messengerclient.DataStore, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.fetched(requestID)
+	entry.Result = result
+	entry.ResultETag = etag
+	entry.Outputs = nil
+}
+
+func (c *Cache) fetched(requestID string) *Entry {
+	entry := c.entry(requestID)
+	entry.FetchedAt = entry.UpdatedAt
+	return entry
+}
+
+func (c *Cache) entry(requestID string) *Entry {
+	entry, ok := c.Topics[requestID]
+	if !ok {
+		entry = &Entry{RequestID: requestID}
+		c.Topics[requestID] = entry
+	}
+	entry.UpdatedAt = time.Now().UTC().Unix()
+	return entry
+}
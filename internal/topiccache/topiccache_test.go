@@ -0,0 +1,89 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package topiccache
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/internal/ceremony"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/messengerclient"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "topics.json")
+
+	cache, err := Load(path)
+	require.NoError(t, err)
+	require.Empty(t, cache.List())
+	_, err = cache.Get("aa")
+	require.ErrorIs(t, err, ErrNotCached)
+
+	cache.SetDelivery("aa", ceremony.KindKeygen, []types.OperatorID{1, 2, 3, 4}, errors.New("operator 4 unreachable"))
+	entry, err := cache.Get("aa")
+	require.NoError(t, err)
+	require.Zero(t, entry.FetchedAt, "a delivery isn't fetched from the messenger")
+
+	outputs := map[types.OperatorID]*dkg.SignedOutput{1: {Signer: 1}, 2: {Signer: 2}}
+	cache.SetSubscribers("aa", []string{"1", "2", "3", "4"})
+	cache.SetOutputs("aa", outputs)
+	require.NoError(t, cache.Save())
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	entry, err = loaded.Get("aa")
+	require.NoError(t, err)
+	require.Equal(t, ceremony.KindKeygen, entry.Kind)
+	require.Equal(t, "operator 4 unreachable", entry.Delivery.Error)
+	require.Equal(t, []string{"1", "2", "3", "4"}, entry.Subscribers)
+	require.Len(t, entry.Outputs, 2)
+	require.NotZero(t, entry.FetchedAt)
+
+	// the result replaces the outputs it is made of
+	loaded.SetResult("aa", &messengerclient.DataStore{DKGOutputs: outputs}, `"e1"`)
+	entry, _ = loaded.Get("aa")
+	require.Nil(t, entry.Outputs)
+	require.Len(t, entry.Result.DKGOutputs, 2)
+	require.Equal(t, `"e1"`, entry.ResultETag)
+}
+
+func TestCacheEviction(t *testing.T) {
+	cache, err := Load(filepath.Join(t.TempDir(), "topics.json"))
+	require.NoError(t, err)
+	for i := 0; i < MaxEntries+5; i++ {
+		requestID := fmt.Sprintf("%04d", i)
+		cache.SetSubscribers(requestID, nil)
+		cache.Topics[requestID].UpdatedAt = int64(i)
+	}
+	require.NoError(t, cache.Save())
+
+	entries := cache.List()
+	require.Len(t, entries, MaxEntries)
+	require.Equal(t, fmt.Sprintf("%04d", MaxEntries+4), entries[0].RequestID)
+	_, err = cache.Get("0004")
+	require.ErrorIs(t, err, ErrNotCached, "the least recently updated topics are dropped")
+}
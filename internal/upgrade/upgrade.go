@@ -0,0 +1,352 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package upgrade replaces a running node process with a new binary without
+// closing its listeners. The old process starts the new one with its
+// listening sockets, hands it the ceremonies it has in flight and stops
+// accepting once the new process acks. The dkg runners of those ceremonies
+// keep their secrets in memory, so they stay with the old process: the new
+// one forwards their messages to it over the handover socket until they end.
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// EnvListeners lists the addresses of the listeners passed to the new
+	// process, in the order of their file descriptors from 3 on
+	EnvListeners = "DKG_UPGRADE_LISTENERS"
+	// EnvSocket is the handover socket of the old process
+	EnvSocket = "DKG_UPGRADE_SOCKET"
+
+	statePath = "/upgrade/state"
+	ackPath   = "/upgrade/ack"
+)
+
+// State is what the old process hands the new one
+type State struct {
+	PID     int    `json:"pid"`
+	Version string `json:"version"`
+	// Ceremonies in flight in the old process, it finishes them
+	Ceremonies []string  `json:"ceremonies"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// Handover is the side of the old process. Its socket answers the state and
+// the ack of the new process, and passes every other request to the handler
+// the old process serves its api with.
+type Handover struct {
+	socket   string
+	state    func() *State
+	handler  http.Handler
+	listener net.Listener
+	server   *http.Server
+	acked    chan struct{}
+	ackOnce  sync.Once
+	logger   *logrus.Logger
+
+	process *os.Process
+	exited  chan error
+}
+
+func newHandover(socket string, state func() *State, handler http.Handler, logger *logrus.Logger) *Handover {
+	return &Handover{
+		socket:  socket,
+		state:   state,
+		handler: handler,
+		acked:   make(chan struct{}),
+		logger:  logger,
+	}
+}
+
+// Start runs exe with args as the new process, passing it the listeners
+// bound to addrs, and waits up to timeout for its ack. The old process keeps
+// serving when Start fails, the new one is killed if it was started.
+func Start(exe string, args []string, socket string, addrs []string, listeners []net.Listener, handler http.Handler, state func() *State, timeout time.Duration, logger *logrus.Logger) (*Handover, error) {
+	if len(addrs) != len(listeners) {
+		return nil, fmt.Errorf("Start: %d addresses for %d listeners", len(addrs), len(listeners))
+	}
+	h := newHandover(socket, state, handler, logger)
+	if err := h.listen(); err != nil {
+		return nil, fmt.Errorf("Start: %w", err)
+	}
+	files, err := listenerFiles(listeners)
+	if err != nil {
+		h.Close()
+		return nil, fmt.Errorf("Start: %w", err)
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), EnvListeners+"="+strings.Join(addrs, ","), EnvSocket+"="+socket)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		h.Close()
+		return nil, fmt.Errorf("Start: failed to run %s: %w", exe, err)
+	}
+	h.process, h.exited = cmd.Process, make(chan error, 1)
+	go func() { h.exited <- cmd.Wait() }()
+
+	select {
+	case <-h.acked:
+		logger.Infof("Start: node process %d took over the listeners", cmd.Process.Pid)
+		return h, nil
+	case err := <-h.exited:
+		h.Close()
+		return nil, fmt.Errorf("Start: new node process exited before it took over: %v", err)
+	case <-time.After(timeout):
+		_ = cmd.Process.Kill()
+		h.Close()
+		return nil, fmt.Errorf("Start: new node process didn't take over within %s", timeout)
+	}
+}
+
+func (h *Handover) listen() error {
+	// a socket left behind by an earlier upgrade refuses the bind
+	if info, err := os.Lstat(h.socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(h.socket)
+	}
+	l, err := net.Listen("unix", h.socket)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(h.socket, 0600); err != nil {
+		l.Close()
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(statePath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.state())
+	})
+	mux.HandleFunc(ackPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.ackOnce.Do(func() { close(h.acked) })
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("/", h.handler)
+	h.listener, h.server = l, &http.Server{Handler: mux}
+	go func() {
+		if err := h.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			h.logger.Errorf("Handover: socket %s failed: %v", h.socket, err)
+		}
+	}()
+	return nil
+}
+
+// Close stops the handover socket, the new process handles the ceremonies
+// it forwarded from then on
+func (h *Handover) Close() error {
+	if h.server == nil {
+		return nil
+	}
+	return h.server.Close()
+}
+
+// Supervise waits for the new process, which runs as a child of this one,
+// and returns its exit code. Supervisors and container runtimes watch the
+// process they started, so it stays and passes them the signals they send.
+func (h *Handover) Supervise() int {
+	signals := make(chan os.Signal, 1)
+	forwarded := []os.Signal{os.Interrupt, syscall.SIGTERM}
+	if Signal != nil {
+		forwarded = append(forwarded, Signal)
+	}
+	signal.Notify(signals, forwarded...)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case sig := <-signals:
+			_ = h.process.Signal(sig)
+		case err := <-h.exited:
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return exitErr.ExitCode()
+			}
+			if err != nil {
+				return 1
+			}
+			return 0
+		}
+	}
+}
+
+// listenerFiles duplicates the file descriptors of listeners to pass them to
+// the new process. Unix sockets are kept on disk when the old process closes
+// its copy.
+func listenerFiles(listeners []net.Listener) ([]*os.File, error) {
+	var files []*os.File
+	for _, l := range listeners {
+		var f *os.File
+		var err error
+		switch l := l.(type) {
+		case *net.TCPListener:
+			f, err = l.File()
+		case *net.UnixListener:
+			l.SetUnlinkOnClose(false)
+			f, err = l.File()
+		default:
+			err = fmt.Errorf("can't pass a %T listener", l)
+		}
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Inherited returns the listeners the old process passed by the address it
+// was configured with, none
+// when the process wasn't started for an upgrade
+func Inherited() (map[string]net.Listener, error) {
+	value := os.Getenv(EnvListeners)
+	if value == "" {
+		return nil, nil
+	}
+	addrs := strings.Split(value, ",")
+	files := make([]*os.File, len(addrs))
+	for i, addr := range addrs {
+		files[i] = os.NewFile(uintptr(3+i), addr)
+	}
+	return fileListeners(files, addrs)
+}
+
+func fileListeners(files []*os.File, addrs []string) (map[string]net.Listener, error) {
+	listeners := make(map[string]net.Listener, len(files))
+	for i, f := range files {
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("Inherited: listener %s: %w", addrs[i], err)
+		}
+		listeners[addrs[i]] = l
+	}
+	return listeners, nil
+}
+
+// Predecessor is the old process as the new one sees it
+type Predecessor struct {
+	State *State
+
+	socket     string
+	client     *http.Client
+	proxy      *httputil.ReverseProxy
+	ceremonies map[string]bool
+	gone       atomic.Bool
+	logger     *logrus.Logger
+}
+
+// Join loads the state of the old process from its handover socket, it
+// returns nil when the process wasn't started for an upgrade
+func Join(logger *logrus.Logger) (*Predecessor, error) {
+	socket := os.Getenv(EnvSocket)
+	if socket == "" {
+		return nil, nil
+	}
+	p := &Predecessor{socket: socket, logger: logger, ceremonies: make(map[string]bool)}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}
+	p.client = &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	p.proxy = httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: "upgrade"})
+	p.proxy.Transport = transport
+	p.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// the old process is gone once its socket is, its ceremonies with it
+		p.gone.Store(true)
+		p.logger.Warnf("Predecessor: failed to forward %s to the old process: %v", r.URL.Path, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	resp, err := p.client.Get("http://upgrade" + statePath)
+	if err != nil {
+		return nil, fmt.Errorf("Join: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Join: handover socket answered with status %s", resp.Status)
+	}
+	p.State = &State{}
+	if err := json.NewDecoder(resp.Body).Decode(p.State); err != nil {
+		return nil, fmt.Errorf("Join: %w", err)
+	}
+	for _, requestID := range p.State.Ceremonies {
+		p.ceremonies[requestID] = true
+	}
+	return p, nil
+}
+
+// Ack tells the old process this one serves, the old one stops accepting
+func (p *Predecessor) Ack() error {
+	resp, err := p.client.Post("http://upgrade"+ackPath, "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("Ack: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Ack: handover socket answered with status %s", resp.Status)
+	}
+	return nil
+}
+
+// Owns reports whether the ceremony runs in the old process
+func (p *Predecessor) Owns(requestID string) bool {
+	return p != nil && !p.gone.Load() && p.ceremonies[requestID]
+}
+
+// Forward passes a request about a ceremony of the old process to it
+func (p *Predecessor) Forward(w http.ResponseWriter, r *http.Request) {
+	p.proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,104 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package upgrade
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandover(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "upgrade.sock")
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "old process "+r.URL.Path)
+	})
+	state := &State{PID: 1, Version: "v1", Ceremonies: []string{"aa"}, StartedAt: time.Now()}
+	h := newHandover(socket, func() *State { return state }, api, logrus.New())
+	require.NoError(t, h.listen())
+
+	t.Setenv(EnvSocket, socket)
+	p, err := Join(logrus.New())
+	require.NoError(t, err)
+	require.Equal(t, "v1", p.State.Version)
+	require.True(t, p.Owns("aa"))
+	require.False(t, p.Owns("bb"))
+
+	require.NoError(t, p.Ack())
+	select {
+	case <-h.acked:
+	default:
+		t.Fatal("ack didn't reach the old process")
+	}
+	require.NoError(t, p.Ack(), "a repeated ack is fine")
+
+	rec := httptest.NewRecorder()
+	p.Forward(rec, httptest.NewRequest(http.MethodGet, "/ceremonies/aa", nil))
+	require.Equal(t, "old process /ceremonies/aa", rec.Body.String())
+
+	// once the old process is gone its ceremonies aren't forwarded anymore
+	require.NoError(t, h.Close())
+	rec = httptest.NewRecorder()
+	p.Forward(rec, httptest.NewRequest(http.MethodGet, "/ceremonies/aa", nil))
+	require.Equal(t, http.StatusBadGateway, rec.Code)
+	require.False(t, p.Owns("aa"))
+}
+
+func TestJoinWithoutUpgrade(t *testing.T) {
+	t.Setenv(EnvSocket, "")
+	p, err := Join(logrus.New())
+	require.NoError(t, err)
+	require.Nil(t, p)
+	require.False(t, p.Owns("aa"))
+}
+
+func TestListenerFiles(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	files, err := listenerFiles([]net.Listener{l})
+	require.NoError(t, err)
+	addrs := []string{l.Addr().String()}
+
+	inherited, err := fileListeners(files, addrs)
+	require.NoError(t, err)
+	// the old process closing its copy leaves the passed one accepting
+	require.NoError(t, l.Close())
+	passed := inherited[addrs[0]]
+	defer passed.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", addrs[0])
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := passed.Accept()
+	require.NoError(t, err)
+	conn.Close()
+}
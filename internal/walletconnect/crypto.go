@@ -0,0 +1,176 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package walletconnect
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// envelopeType0 is a message sealed with the symmetric key of its topic
+const envelopeType0 = 0
+
+func randomKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// seal encrypts a message for a topic, type byte, iv and the sealed box in base64
+func seal(key, message []byte) (string, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, chacha20poly1305.NonceSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	envelope := append([]byte{envelopeType0}, iv...)
+	envelope = aead.Seal(envelope, iv, message, nil)
+	return base64.StdEncoding.EncodeToString(envelope), nil
+}
+
+func open(key []byte, message string) ([]byte, error) {
+	envelope, err := base64.StdEncoding.DecodeString(message)
+	if err != nil {
+		return nil, fmt.Errorf("open: message isn't base64: %w", err)
+	}
+	if len(envelope) < 1+chacha20poly1305.NonceSize || envelope[0] != envelopeType0 {
+		return nil, fmt.Errorf("open: unsupported envelope")
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := envelope[1 : 1+chacha20poly1305.NonceSize]
+	plain, err := aead.Open(nil, iv, envelope[1+chacha20poly1305.NonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	return plain, nil
+}
+
+// newKeyPair returns an x25519 private key and its public key
+func newKeyPair() ([]byte, []byte, error) {
+	private, err := randomKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	return private, public, nil
+}
+
+// deriveSymKey is the key of the session topic, agreed from the proposer and
+// responder keys
+func deriveSymKey(private, peerPublic []byte) ([]byte, error) {
+	shared, err := curve25519.X25519(private, peerPublic)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, nil, nil), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// topicOf is the topic of a session, the hash of its key
+func topicOf(symKey []byte) string {
+	hash := sha256.Sum256(symKey)
+	return hex.EncodeToString(hash[:])
+}
+
+// authToken is the jwt the relay takes a connection with, signed with a
+// throwaway ed25519 key identified as a did:key
+func authToken(relay string, now time.Time) (string, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	subject, err := randomKey()
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]string{"alg": "EdDSA", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": didKey(public),
+		"sub": hex.EncodeToString(subject),
+		"aud": relay,
+		"iat": now.Unix(),
+		"exp": now.Add(24 * time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	signature := ed25519.Sign(private, []byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// didKey is the did:key of an ed25519 public key, its multicodec prefix and
+// key in base58btc
+func didKey(public ed25519.PublicKey) string {
+	return "did:key:z" + base58(append([]byte{0xed, 0x01}, public...))
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58(input []byte) string {
+	var out []byte
+	n := new(big.Int).SetBytes(input)
+	radix, mod := big.NewInt(58), new(big.Int)
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range input {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
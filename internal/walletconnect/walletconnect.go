@@ -0,0 +1,541 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package walletconnect is a minimal WalletConnect v2 client. It pairs with a
+// wallet app through the relay and asks it to sign, so the key of an address
+// stays in the app, or in the hardware wallet the app drives.
+package walletconnect
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const DefaultRelay = "wss://relay.walletconnect.com"
+
+// tags of published messages, the relay routes push notifications with them
+const (
+	tagSessionPropose       = 1100
+	tagSessionProposeResult = 1101
+	tagSessionSettle        = 1102
+	tagSessionSettleResult  = 1103
+	tagSessionRequest       = 1108
+	tagSessionRequestResult = 1109
+	tagSessionDelete        = 1112
+	tagSessionPingResult    = 1115
+)
+
+const (
+	// messageTTL is how long, in seconds, the relay keeps a published message
+	messageTTL  = 300
+	proposalTTL = 5 * time.Minute
+)
+
+// ErrRejected is a request the wallet, or its user, declined
+var ErrRejected = errors.New("the wallet rejected the request")
+
+// Metadata describes the cli to the wallet user
+type Metadata struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Icons       []string `json:"icons"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+type rpcMessage struct {
+	ID      int64           `json:"id"`
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// topicRequest is a request a peer published on one of the subscribed topics
+type topicRequest struct {
+	topic string
+	msg   *rpcMessage
+}
+
+// Client is a connection to the relay
+type Client struct {
+	conn     *websocket.Conn
+	metadata Metadata
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	lastID   int64
+	pending  map[int64]chan *rpcMessage
+	keys     map[string][]byte
+	requests chan *topicRequest
+	done     chan struct{}
+	err      error
+}
+
+// Dial connects to the relay of projectID
+func Dial(ctx context.Context, relay, projectID string, metadata Metadata) (*Client, error) {
+	token, err := authToken(relay, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("Dial: failed to create auth token: %w", err)
+	}
+	u, err := url.Parse(relay)
+	if err != nil {
+		return nil, fmt.Errorf("Dial: invalid relay url: %w", err)
+	}
+	query := u.Query()
+	query.Set("auth", token)
+	query.Set("projectId", projectID)
+	u.RawQuery = query.Encode()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Dial: failed to connect to relay %s: %w", relay, err)
+	}
+	c := &Client{
+		conn:     conn,
+		metadata: metadata,
+		pending:  make(map[int64]chan *rpcMessage),
+		keys:     make(map[string][]byte),
+		requests: make(chan *topicRequest, 16),
+		done:     make(chan struct{}),
+	}
+	go c.read()
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// nextID is a unique id in the microsecond clock format other clients use
+func (c *Client) nextID() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := time.Now().UnixNano() / int64(time.Microsecond)
+	if id <= c.lastID {
+		id = c.lastID + 1
+	}
+	c.lastID = id
+	return id
+}
+
+func (c *Client) write(msg *rpcMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(msg)
+}
+
+func (c *Client) read() {
+	defer close(c.done)
+	for {
+		msg := &rpcMessage{}
+		if err := c.conn.ReadJSON(msg); err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			return
+		}
+		if msg.Method == "" {
+			c.resolve(msg)
+			continue
+		}
+		if msg.Method != "irn_subscription" {
+			continue
+		}
+		// the relay redelivers a message until it is acknowledged
+		if err := c.write(&rpcMessage{ID: msg.ID, JSONRPC: "2.0", Result: json.RawMessage("true")}); err != nil {
+			continue
+		}
+		c.deliver(msg.Params)
+	}
+}
+
+// deliver opens a message published on a subscribed topic and hands it to
+// whoever waits for it
+func (c *Client) deliver(params json.RawMessage) {
+	var subscription struct {
+		Data struct {
+			Topic   string `json:"topic"`
+			Message string `json:"message"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(params, &subscription); err != nil {
+		return
+	}
+	topic := subscription.Data.Topic
+	c.mu.Lock()
+	key, ok := c.keys[topic]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	plain, err := open(key, subscription.Data.Message)
+	if err != nil {
+		return
+	}
+	payload := &rpcMessage{}
+	if err := json.Unmarshal(plain, payload); err != nil {
+		return
+	}
+	switch payload.Method {
+	case "":
+		c.resolve(payload)
+	case "wc_sessionPing":
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = c.respond(ctx, topic, payload.ID, true, tagSessionPingResult)
+		}()
+	default:
+		select {
+		case c.requests <- &topicRequest{topic: topic, msg: payload}:
+		default:
+		}
+	}
+}
+
+func (c *Client) resolve(msg *rpcMessage) {
+	c.mu.Lock()
+	ch, ok := c.pending[msg.ID]
+	delete(c.pending, msg.ID)
+	c.mu.Unlock()
+	if ok {
+		ch <- msg
+	}
+}
+
+// expect registers a response the caller waits for with wait
+func (c *Client) expect(id int64) chan *rpcMessage {
+	ch := make(chan *rpcMessage, 1)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+	return ch
+}
+
+func (c *Client) forget(id int64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *Client) wait(ctx context.Context, ch chan *rpcMessage, result interface{}) error {
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return fmt.Errorf("connection to the relay closed: %v", c.err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// call sends a request to the relay itself
+func (c *Client) call(ctx context.Context, method string, params, result interface{}) error {
+	byts, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	id := c.nextID()
+	ch := c.expect(id)
+	defer c.forget(id)
+	if err := c.write(&rpcMessage{ID: id, JSONRPC: "2.0", Method: method, Params: byts}); err != nil {
+		return err
+	}
+	if err := c.wait(ctx, ch, result); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	return nil
+}
+
+func (c *Client) subscribe(ctx context.Context, topic string, key []byte) error {
+	// the key goes first, the relay delivers stored messages right away
+	c.mu.Lock()
+	c.keys[topic] = key
+	c.mu.Unlock()
+	var subscription string
+	return c.call(ctx, "irn_subscribe", map[string]string{"topic": topic}, &subscription)
+}
+
+func (c *Client) publish(ctx context.Context, topic string, msg *rpcMessage, tag int, prompt bool) error {
+	c.mu.Lock()
+	key, ok := c.keys[topic]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("publish: no key for topic %s", topic)
+	}
+	plain, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	message, err := seal(key, plain)
+	if err != nil {
+		return err
+	}
+	var published bool
+	return c.call(ctx, "irn_publish", map[string]interface{}{
+		"topic":   topic,
+		"message": message,
+		"ttl":     messageTTL,
+		"tag":     tag,
+		"prompt":  prompt,
+	}, &published)
+}
+
+// send publishes a request to the peer of the topic, the response arrives on
+// the returned channel
+func (c *Client) send(ctx context.Context, topic, method string, params interface{}, tag int) (int64, chan *rpcMessage, error) {
+	byts, err := json.Marshal(params)
+	if err != nil {
+		return 0, nil, err
+	}
+	id := c.nextID()
+	ch := c.expect(id)
+	if err := c.publish(ctx, topic, &rpcMessage{ID: id, JSONRPC: "2.0", Method: method, Params: byts}, tag, true); err != nil {
+		c.forget(id)
+		return 0, nil, err
+	}
+	return id, ch, nil
+}
+
+// request sends a request to the peer of the topic and waits for its result
+func (c *Client) request(ctx context.Context, topic, method string, params interface{}, tag int, result interface{}) error {
+	id, ch, err := c.send(ctx, topic, method, params, tag)
+	if err != nil {
+		return err
+	}
+	defer c.forget(id)
+	return walletError(c.wait(ctx, ch, result))
+}
+
+func (c *Client) respond(ctx context.Context, topic string, id int64, result interface{}, tag int) error {
+	byts, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, topic, &rpcMessage{ID: id, JSONRPC: "2.0", Result: byts}, tag, false)
+}
+
+// walletError marks an error response of the wallet as a rejection
+func walletError(err error) error {
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		return fmt.Errorf("%w: %s", ErrRejected, rpcErr)
+	}
+	return err
+}
+
+// EIP155 is the CAIP-2 id of an evm chain
+func EIP155(chainID *big.Int) string {
+	return "eip155:" + chainID.String()
+}
+
+type namespace struct {
+	Chains   []string `json:"chains,omitempty"`
+	Accounts []string `json:"accounts,omitempty"`
+	Methods  []string `json:"methods"`
+	Events   []string `json:"events"`
+}
+
+type participant struct {
+	PublicKey string   `json:"publicKey"`
+	Metadata  Metadata `json:"metadata"`
+}
+
+type relay struct {
+	Protocol string `json:"protocol"`
+}
+
+type proposal struct {
+	RequiredNamespaces map[string]namespace `json:"requiredNamespaces"`
+	OptionalNamespaces map[string]namespace `json:"optionalNamespaces"`
+	Relays             []relay              `json:"relays"`
+	Proposer           participant          `json:"proposer"`
+	ExpiryTimestamp    int64                `json:"expiryTimestamp"`
+}
+
+type proposalResult struct {
+	Relay              relay  `json:"relay"`
+	ResponderPublicKey string `json:"responderPublicKey"`
+}
+
+type settlement struct {
+	Relay      relay                `json:"relay"`
+	Namespaces map[string]namespace `json:"namespaces"`
+	Controller participant          `json:"controller"`
+	Expiry     int64                `json:"expiry"`
+}
+
+// Pairing is a session proposal waiting for a wallet to scan its uri
+type Pairing struct {
+	// URI is what the wallet scans, usually shown as a qr code
+	URI string
+
+	id       int64
+	response chan *rpcMessage
+	private  []byte
+}
+
+// Pair proposes a session with the methods on the chain and returns the
+// pairing uri for the wallet
+func (c *Client) Pair(ctx context.Context, chain string, methods []string) (*Pairing, error) {
+	symKey, err := randomKey()
+	if err != nil {
+		return nil, err
+	}
+	topicKey, err := randomKey()
+	if err != nil {
+		return nil, err
+	}
+	topic := hex.EncodeToString(topicKey)
+	if err := c.subscribe(ctx, topic, symKey); err != nil {
+		return nil, fmt.Errorf("Pair: %w", err)
+	}
+
+	private, public, err := newKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	expiry := time.Now().Add(proposalTTL).Unix()
+	id, response, err := c.send(ctx, topic, "wc_sessionPropose", &proposal{
+		RequiredNamespaces: map[string]namespace{"eip155": {
+			Chains:  []string{chain},
+			Methods: methods,
+			Events:  []string{"chainChanged", "accountsChanged"},
+		}},
+		OptionalNamespaces: map[string]namespace{},
+		Relays:             []relay{{Protocol: "irn"}},
+		Proposer:           participant{PublicKey: hex.EncodeToString(public), Metadata: c.metadata},
+		ExpiryTimestamp:    expiry,
+	}, tagSessionPropose)
+	if err != nil {
+		return nil, fmt.Errorf("Pair: failed to publish proposal: %w", err)
+	}
+	return &Pairing{
+		URI:      fmt.Sprintf("wc:%s@2?relay-protocol=irn&symKey=%s&expiryTimestamp=%d", topic, hex.EncodeToString(symKey), expiry),
+		id:       id,
+		response: response,
+		private:  private,
+	}, nil
+}
+
+// Session is a session a wallet approved
+type Session struct {
+	client     *Client
+	topic      string
+	namespaces map[string]namespace
+}
+
+// Approved waits until the wallet approves the proposal and settles the session
+func (c *Client) Approved(ctx context.Context, pairing *Pairing) (*Session, error) {
+	defer c.forget(pairing.id)
+	result := &proposalResult{}
+	if err := walletError(c.wait(ctx, pairing.response, result)); err != nil {
+		return nil, fmt.Errorf("Approved: %w", err)
+	}
+	responder, err := hex.DecodeString(result.ResponderPublicKey)
+	if err != nil || len(responder) != 32 {
+		return nil, fmt.Errorf("Approved: invalid responder public key")
+	}
+	symKey, err := deriveSymKey(pairing.private, responder)
+	if err != nil {
+		return nil, fmt.Errorf("Approved: %w", err)
+	}
+	topic := topicOf(symKey)
+	if err := c.subscribe(ctx, topic, symKey); err != nil {
+		return nil, fmt.Errorf("Approved: %w", err)
+	}
+
+	for {
+		select {
+		case request := <-c.requests:
+			if request.topic != topic || request.msg.Method != "wc_sessionSettle" {
+				continue
+			}
+			settled := &settlement{}
+			if err := json.Unmarshal(request.msg.Params, settled); err != nil {
+				return nil, fmt.Errorf("Approved: invalid session settlement: %w", err)
+			}
+			if err := c.respond(ctx, topic, request.msg.ID, true, tagSessionSettleResult); err != nil {
+				return nil, fmt.Errorf("Approved: %w", err)
+			}
+			return &Session{client: c, topic: topic, namespaces: settled.Namespaces}, nil
+		case <-c.done:
+			return nil, fmt.Errorf("Approved: connection to the relay closed")
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Approved: %w", ctx.Err())
+		}
+	}
+}
+
+// Accounts are the addresses the wallet shares on the chain
+func (s *Session) Accounts(chain string) []string {
+	var accounts []string
+	for _, account := range s.namespaces["eip155"].Accounts {
+		if address := strings.TrimPrefix(account, chain+":"); address != account {
+			accounts = append(accounts, address)
+		}
+	}
+	return accounts
+}
+
+// Request asks the wallet to run a json-rpc method on the chain
+func (s *Session) Request(ctx context.Context, chain, method string, params, result interface{}) error {
+	return s.client.request(ctx, s.topic, "wc_sessionRequest", map[string]interface{}{
+		"request": map[string]interface{}{"method": method, "params": params},
+		"chainId": chain,
+	}, tagSessionRequest, result)
+}
+
+// Disconnect tells the wallet the session is over, it doesn't wait for an answer
+func (s *Session) Disconnect(ctx context.Context) error {
+	id, _, err := s.client.send(ctx, s.topic, "wc_sessionDelete", &rpcError{Code: 6000, Message: "User disconnected"}, tagSessionDelete)
+	s.client.forget(id)
+	return err
+}
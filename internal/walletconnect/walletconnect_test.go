@@ -0,0 +1,272 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package walletconnect
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRelay keeps every message published on a topic and delivers it to the
+// other subscribers of the topic, also the ones that subscribe later
+type fakeRelay struct {
+	mu          sync.Mutex
+	subscribers map[string][]*relayConn
+	stored      map[string][]string
+}
+
+type relayConn struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (rc *relayConn) send(msg *rpcMessage) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	_ = rc.conn.WriteJSON(msg)
+}
+
+func (rc *relayConn) deliver(topic, message string) {
+	params, _ := json.Marshal(map[string]interface{}{
+		"id":   "sub",
+		"data": map[string]string{"topic": topic, "message": message},
+	})
+	rc.send(&rpcMessage{ID: time.Now().UnixNano(), JSONRPC: "2.0", Method: "irn_subscription", Params: params})
+}
+
+func (r *fakeRelay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Query().Get("projectId") != "test" || len(strings.Split(req.URL.Query().Get("auth"), ".")) != 3 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	rc := &relayConn{conn: conn}
+	for {
+		msg := &rpcMessage{}
+		if err := conn.ReadJSON(msg); err != nil {
+			return
+		}
+		var params struct {
+			Topic   string `json:"topic"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+		switch msg.Method {
+		case "irn_subscribe":
+			r.mu.Lock()
+			r.subscribers[params.Topic] = append(r.subscribers[params.Topic], rc)
+			stored := append([]string(nil), r.stored[params.Topic]...)
+			r.mu.Unlock()
+			rc.send(&rpcMessage{ID: msg.ID, JSONRPC: "2.0", Result: json.RawMessage(`"sub"`)})
+			for _, message := range stored {
+				rc.deliver(params.Topic, message)
+			}
+		case "irn_publish":
+			r.mu.Lock()
+			r.stored[params.Topic] = append(r.stored[params.Topic], params.Message)
+			subscribers := append([]*relayConn(nil), r.subscribers[params.Topic]...)
+			r.mu.Unlock()
+			rc.send(&rpcMessage{ID: msg.ID, JSONRPC: "2.0", Result: json.RawMessage("true")})
+			for _, subscriber := range subscribers {
+				if subscriber != rc {
+					subscriber.deliver(params.Topic, params.Message)
+				}
+			}
+		}
+	}
+}
+
+func nextRequest(ctx context.Context, c *Client, method string) (*topicRequest, error) {
+	for {
+		select {
+		case request := <-c.requests:
+			if request.msg.Method == method {
+				return request, nil
+			}
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no %s request: %w", method, ctx.Err())
+		}
+	}
+}
+
+// runWallet approves the proposal of uri with account, signs the first
+// request and rejects the second
+func runWallet(ctx context.Context, w *Client, uri, account string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	topic := strings.TrimSuffix(u.Opaque, "@2")
+	symKey, err := hex.DecodeString(u.Query().Get("symKey"))
+	if err != nil {
+		return err
+	}
+	if err := w.subscribe(ctx, topic, symKey); err != nil {
+		return err
+	}
+
+	request, err := nextRequest(ctx, w, "wc_sessionPropose")
+	if err != nil {
+		return err
+	}
+	proposed := &proposal{}
+	if err := json.Unmarshal(request.msg.Params, proposed); err != nil {
+		return err
+	}
+	private, public, err := newKeyPair()
+	if err != nil {
+		return err
+	}
+	result := &proposalResult{Relay: relay{Protocol: "irn"}, ResponderPublicKey: hex.EncodeToString(public)}
+	if err := w.respond(ctx, topic, request.msg.ID, result, tagSessionProposeResult); err != nil {
+		return err
+	}
+	proposer, err := hex.DecodeString(proposed.Proposer.PublicKey)
+	if err != nil {
+		return err
+	}
+	sessionKey, err := deriveSymKey(private, proposer)
+	if err != nil {
+		return err
+	}
+	sessionTopic := topicOf(sessionKey)
+	if err := w.subscribe(ctx, sessionTopic, sessionKey); err != nil {
+		return err
+	}
+	chain := proposed.RequiredNamespaces["eip155"].Chains[0]
+	settled := &settlement{
+		Relay:      relay{Protocol: "irn"},
+		Namespaces: map[string]namespace{"eip155": {Accounts: []string{chain + ":" + account}, Methods: proposed.RequiredNamespaces["eip155"].Methods, Events: []string{}}},
+		Controller: participant{PublicKey: hex.EncodeToString(public), Metadata: Metadata{Name: "wallet"}},
+		Expiry:     time.Now().Add(time.Hour).Unix(),
+	}
+	if err := w.request(ctx, sessionTopic, "wc_sessionSettle", settled, tagSessionSettle, nil); err != nil {
+		return err
+	}
+
+	if request, err = nextRequest(ctx, w, "wc_sessionRequest"); err != nil {
+		return err
+	}
+	if err := w.respond(ctx, sessionTopic, request.msg.ID, "0x02ab", tagSessionRequestResult); err != nil {
+		return err
+	}
+	if request, err = nextRequest(ctx, w, "wc_sessionRequest"); err != nil {
+		return err
+	}
+	rejected := &rpcMessage{ID: request.msg.ID, JSONRPC: "2.0", Error: &rpcError{Code: 5000, Message: "User rejected."}}
+	return w.publish(ctx, sessionTopic, rejected, tagSessionRequestResult, false)
+}
+
+func TestSession(t *testing.T) {
+	relay := &fakeRelay{subscribers: make(map[string][]*relayConn), stored: make(map[string][]string)}
+	server := httptest.NewServer(relay)
+	defer server.Close()
+	relayURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := Dial(ctx, relayURL, "other", Metadata{})
+	require.Error(t, err)
+
+	dapp, err := Dial(ctx, relayURL, "test", Metadata{Name: "cli"})
+	require.NoError(t, err)
+	defer dapp.Close()
+	wallet, err := Dial(ctx, relayURL, "test", Metadata{Name: "wallet"})
+	require.NoError(t, err)
+	defer wallet.Close()
+
+	chain := EIP155(big.NewInt(1))
+	require.Equal(t, "eip155:1", chain)
+	pairing, err := dapp.Pair(ctx, chain, []string{"eth_signTransaction"})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(pairing.URI, "wc:"))
+
+	account := "0x52908400098527886E0F7030069857D2E4169EE7"
+	walletErr := make(chan error, 1)
+	go func() { walletErr <- runWallet(ctx, wallet, pairing.URI, account) }()
+
+	session, err := dapp.Approved(ctx, pairing)
+	require.NoError(t, err)
+	require.Equal(t, []string{account}, session.Accounts(chain))
+	require.Empty(t, session.Accounts("eip155:5"))
+
+	var raw string
+	require.NoError(t, session.Request(ctx, chain, "eth_signTransaction", []interface{}{map[string]string{"from": account}}, &raw))
+	require.Equal(t, "0x02ab", raw)
+	err = session.Request(ctx, chain, "eth_signTransaction", []interface{}{map[string]string{"from": account}}, &raw)
+	require.ErrorIs(t, err, ErrRejected)
+	require.NoError(t, <-walletErr)
+	require.NoError(t, session.Disconnect(ctx))
+}
+
+func TestEnvelope(t *testing.T) {
+	key, err := randomKey()
+	require.NoError(t, err)
+	message, err := seal(key, []byte("message"))
+	require.NoError(t, err)
+	plain, err := open(key, message)
+	require.NoError(t, err)
+	require.Equal(t, []byte("message"), plain)
+
+	other, err := randomKey()
+	require.NoError(t, err)
+	_, err = open(other, message)
+	require.Error(t, err)
+
+	privateA, publicA, err := newKeyPair()
+	require.NoError(t, err)
+	privateB, publicB, err := newKeyPair()
+	require.NoError(t, err)
+	symA, err := deriveSymKey(privateA, publicB)
+	require.NoError(t, err)
+	symB, err := deriveSymKey(privateB, publicA)
+	require.NoError(t, err)
+	require.Equal(t, symA, symB)
+	require.Len(t, topicOf(symA), 64)
+}
+
+func TestAuthToken(t *testing.T) {
+	require.Equal(t, "StV1DL6CwTryKyV", base58([]byte("hello world")))
+	require.Equal(t, "1112", base58([]byte{0, 0, 0, 1}))
+	require.True(t, strings.HasPrefix(didKey(make(ed25519.PublicKey, ed25519.PublicKeySize)), "did:key:z6Mk"))
+
+	token, err := authToken(DefaultRelay, time.Unix(1700000000, 0))
+	require.NoError(t, err)
+	require.Len(t, strings.Split(token, "."), 3)
+}
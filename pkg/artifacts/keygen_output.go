@@ -0,0 +1,107 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package artifacts
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/cryptosuite"
+	"github.com/RockX-SG/frost-dkg-demo/pkg/hexenc"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+)
+
+// KeyGenOutput is the json encoding of a dkg.KeyGenOutput, as a node stores it
+// and as it is sealed in a share handover. Keys are hex encoded.
+type KeyGenOutput struct {
+	Share           string
+	OperatorPubKeys map[types.OperatorID]string
+	ValidatorPK     string
+	Threshold       uint64
+	// Suite is the ID of the crypto suite the keys belong to, outputs
+	// stored before suites were recorded have none and the default one
+	Suite string `json:",omitempty"`
+}
+
+// Encode encodes output as made with the suite of o, the default one when o
+// has none
+func (o *KeyGenOutput) Encode(output *dkg.KeyGenOutput) ([]byte, error) {
+	suite, err := cryptosuite.Lookup(o.Suite)
+	if err != nil {
+		return nil, err
+	}
+	kgo := &KeyGenOutput{
+		Suite:           suite.ID,
+		Share:           output.Share.SerializeToHexStr(),
+		OperatorPubKeys: make(map[types.OperatorID]string),
+		ValidatorPK:     hex.EncodeToString(output.ValidatorPK),
+		Threshold:       output.Threshold,
+	}
+	for operatorID, pk := range output.OperatorPubKeys {
+		kgo.OperatorPubKeys[operatorID] = pk.SerializeToHexStr()
+	}
+	return json.Marshal(kgo)
+}
+
+// Decode parses an encoded output, bls has to be initialized with
+// types.InitBLS before
+func (o *KeyGenOutput) Decode(output []byte) (*dkg.KeyGenOutput, error) {
+	if err := json.Unmarshal(output, o); err != nil {
+		return nil, err
+	}
+	suite, err := cryptosuite.Lookup(o.Suite)
+	if err != nil {
+		return nil, err
+	}
+	if suite.Curve != cryptosuite.CurveBLS12381 {
+		return nil, fmt.Errorf("keys of crypto suite %s are on %s, not on %s", suite.ID, suite.Curve, cryptosuite.CurveBLS12381)
+	}
+
+	kgo := &dkg.KeyGenOutput{
+		OperatorPubKeys: make(map[types.OperatorID]*bls.PublicKey),
+		Threshold:       o.Threshold,
+	}
+
+	vk, err := hexenc.ParseValidatorPK(o.ValidatorPK)
+	if err != nil {
+		return nil, err
+	}
+	kgo.ValidatorPK = vk
+
+	share := bls.SecretKey{}
+	if err := share.DeserializeHexStr(o.Share); err != nil {
+		return nil, err
+	}
+	kgo.Share = &share
+
+	for operatorID, pkhex := range o.OperatorPubKeys {
+		pk := bls.PublicKey{}
+		if err := pk.DeserializeHexStr(pkhex); err != nil {
+			return nil, err
+		}
+		kgo.OperatorPubKeys[operatorID] = &pk
+	}
+	return kgo, nil
+}
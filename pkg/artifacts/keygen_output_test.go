@@ -0,0 +1,75 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package artifacts
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/cryptosuite"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+	"github.com/herumi/bls-eth-go-binary/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyGenOutputRoundTrip(t *testing.T) {
+	types.InitBLS()
+
+	share := bls.SecretKey{}
+	share.SetByCSPRNG()
+	validator := bls.SecretKey{}
+	validator.SetByCSPRNG()
+	output := &dkg.KeyGenOutput{
+		Share:           &share,
+		ValidatorPK:     validator.GetPublicKey().Serialize(),
+		OperatorPubKeys: map[types.OperatorID]*bls.PublicKey{1: share.GetPublicKey()},
+		Threshold:       3,
+	}
+
+	data, err := (&KeyGenOutput{}).Encode(output)
+	require.NoError(t, err)
+
+	decoded, err := (&KeyGenOutput{}).Decode(data)
+	require.NoError(t, err)
+	require.True(t, share.IsEqual(decoded.Share))
+	require.Equal(t, output.ValidatorPK, decoded.ValidatorPK)
+	require.True(t, share.GetPublicKey().IsEqual(decoded.OperatorPubKeys[1]))
+	require.EqualValues(t, 3, decoded.Threshold)
+
+	kgo := &KeyGenOutput{}
+	require.NoError(t, json.Unmarshal(data, kgo))
+	require.Equal(t, cryptosuite.Default, kgo.Suite)
+
+	// outputs stored before suites were recorded
+	kgo.Suite = ""
+	legacy, err := json.Marshal(kgo)
+	require.NoError(t, err)
+	_, err = (&KeyGenOutput{}).Decode(legacy)
+	require.NoError(t, err)
+
+	kgo.Suite = "unknown"
+	unknown, err := json.Marshal(kgo)
+	require.NoError(t, err)
+	_, err = (&KeyGenOutput{}).Decode(unknown)
+	require.Error(t, err)
+}
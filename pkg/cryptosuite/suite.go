@@ -0,0 +1,149 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package cryptosuite is the registry of the cryptographic suites ceremonies
+// and their artifacts are bound to. A suite names the curve of the keys, the
+// hash that digests manifests and the HKDF parameters keys are derived with.
+// Manifests and stored artifacts carry the ID of their suite, so a new suite
+// can be registered next to the current one without breaking what was stored
+// before; an artifact without a suite ID was made with the default one.
+//
+// The package is part of the public api of the repository, like artifacts.
+package cryptosuite
+
+import (
+	"crypto"
+	// the hashes of the registered suites
+	_ "crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// CurveBLS12381 is the curve of ethereum validator keys
+const CurveBLS12381 = "BLS12-381"
+
+// Default is the suite of every ceremony so far: BLS12-381 keys, sha256
+// digests and HKDF-SHA256
+const Default = "bls12381-sha256"
+
+// Suite is a set of cryptographic parameters ceremonies are run with
+type Suite struct {
+	ID string
+	// Curve the shares and validator keys are on
+	Curve string
+	// Hash digests manifests and wraps envelope keys
+	Hash crypto.Hash
+	// KDFHash and KDFInfo are the HKDF parameters keys are derived with
+	KDFHash crypto.Hash
+	KDFInfo string
+}
+
+// Digest hashes data with the hash of the suite
+func (s *Suite) Digest(data []byte) []byte {
+	h := s.Hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// DeriveKey derives a key of size bytes from secret and salt with the HKDF
+// parameters of the suite
+func (s *Suite) DeriveKey(secret, salt []byte, size int) ([]byte, error) {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(s.KDFHash.New, secret, salt, []byte(s.KDFInfo)), key); err != nil {
+		return nil, fmt.Errorf("DeriveKey: %w", err)
+	}
+	return key, nil
+}
+
+var (
+	mu     sync.RWMutex
+	suites = make(map[string]*Suite)
+)
+
+func init() {
+	if err := Register(&Suite{
+		ID:      Default,
+		Curve:   CurveBLS12381,
+		Hash:    crypto.SHA256,
+		KDFHash: crypto.SHA256,
+		KDFInfo: "rockx-dkg/" + Default,
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// Register adds a suite to the registry, its ID must be new and its hashes
+// linked into the binary
+func Register(s *Suite) error {
+	if s.ID == "" {
+		return errors.New("Register: suite without id")
+	}
+	if !s.Hash.Available() || !s.KDFHash.Available() {
+		return fmt.Errorf("Register: hash of suite %s isn't available", s.ID)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := suites[s.ID]; ok {
+		return fmt.Errorf("Register: suite %s is registered already", s.ID)
+	}
+	suites[s.ID] = s
+	return nil
+}
+
+// Lookup returns the suite with id, the default one for an empty id
+func Lookup(id string) (*Suite, error) {
+	if id == "" {
+		id = Default
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := suites[id]
+	if !ok {
+		return nil, fmt.Errorf("unsupported crypto suite %s", id)
+	}
+	return s, nil
+}
+
+// IDs of the registered suites, sorted
+func IDs() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	ids := make([]string, 0, len(suites))
+	for id := range suites {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Canonical is the form of id manifests are hashed with, empty for the
+// default suite so manifests made before suites existed keep their hash
+func Canonical(id string) string {
+	if id == Default {
+		return ""
+	}
+	return id
+}
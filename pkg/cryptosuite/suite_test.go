@@ -0,0 +1,67 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package cryptosuite
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	s, err := Lookup("")
+	require.NoError(t, err)
+	require.Equal(t, Default, s.ID)
+	require.Equal(t, CurveBLS12381, s.Curve)
+
+	_, err = Lookup("unknown")
+	require.Error(t, err)
+
+	require.Contains(t, IDs(), Default)
+	require.Empty(t, Canonical(Default))
+	require.Equal(t, "other", Canonical("other"))
+}
+
+func TestRegister(t *testing.T) {
+	require.Error(t, Register(&Suite{ID: Default, Hash: crypto.SHA256, KDFHash: crypto.SHA256}), "registered already")
+	require.Error(t, Register(&Suite{Hash: crypto.SHA256, KDFHash: crypto.SHA256}), "no id")
+	require.Error(t, Register(&Suite{ID: "no-hash"}), "hash not available")
+}
+
+func TestDeriveKey(t *testing.T) {
+	s, err := Lookup(Default)
+	require.NoError(t, err)
+
+	key, err := s.DeriveKey([]byte("secret"), []byte("salt"), 32)
+	require.NoError(t, err)
+	require.Len(t, key, 32)
+
+	same, err := s.DeriveKey([]byte("secret"), []byte("salt"), 32)
+	require.NoError(t, err)
+	require.Equal(t, key, same)
+
+	other, err := s.DeriveKey([]byte("secret"), []byte("other salt"), 32)
+	require.NoError(t, err)
+	require.NotEqual(t, key, other)
+	require.Len(t, s.Digest([]byte("data")), 32)
+}
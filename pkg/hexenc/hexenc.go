@@ -0,0 +1,139 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package hexenc parses and formats the byte strings ceremonies are keyed by:
+// validator public keys, request ids, withdrawal credentials and addresses.
+// Input is taken leniently, with or without a 0x prefix, in either case and
+// with surrounding white space, and checked against the length of what it
+// names. Output is canonical, 0x-prefixed lowercase hex, except for Key which
+// is the bare lowercase form storage keys and request id lookups have always
+// used, so that a value is found whichever way a caller wrote it.
+//
+// The package is part of the public api of the repository, like artifacts.
+package hexenc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+)
+
+const (
+	ValidatorPKLen           = 48
+	RequestIDLen             = len(dkg.RequestID{})
+	WithdrawalCredentialsLen = 32
+	AddressLen               = 20
+)
+
+// Parse decodes hex with or without a 0x prefix, in either case
+func Parse(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %w", err)
+	}
+	return b, nil
+}
+
+// ParseFixed decodes hex of exactly n bytes, what names the value in errors
+func ParseFixed(s string, n int, what string) ([]byte, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("%s is empty", what)
+	}
+	b, err := Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", what, err)
+	}
+	if len(b) != n {
+		return nil, fmt.Errorf("%s has %d bytes, expected %d", what, len(b), n)
+	}
+	return b, nil
+}
+
+func ParseValidatorPK(s string) ([]byte, error) {
+	return ParseFixed(s, ValidatorPKLen, "validator pk")
+}
+
+func ParseWithdrawalCredentials(s string) ([]byte, error) {
+	return ParseFixed(s, WithdrawalCredentialsLen, "withdrawal credentials")
+}
+
+func ParseAddress(s string) ([]byte, error) {
+	return ParseFixed(s, AddressLen, "address")
+}
+
+func ParseRequestID(s string) (dkg.RequestID, error) {
+	requestID := dkg.RequestID{}
+	b, err := ParseFixed(s, RequestIDLen, "request id")
+	if err != nil {
+		return requestID, err
+	}
+	copy(requestID[:], b)
+	return requestID, nil
+}
+
+// Format is the canonical output form, 0x-prefixed lowercase hex
+func Format(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+// Key is the bare lowercase hex storage keys and request id lookups are
+// indexed by
+func Key(b []byte) string {
+	return hex.EncodeToString(b)
+}
+
+// RequestIDKey is the lookup key of a request id written either way
+func RequestIDKey(s string) (string, error) {
+	requestID, err := ParseRequestID(s)
+	if err != nil {
+		return "", err
+	}
+	return Key(requestID[:]), nil
+}
+
+// ValidatorPKKey is the lookup key of a validator pk written either way
+func ValidatorPKKey(s string) (string, error) {
+	pk, err := ParseValidatorPK(s)
+	if err != nil {
+		return "", err
+	}
+	return Key(pk), nil
+}
+
+// Equal tells whether two hex strings hold the same bytes, false when either
+// isn't hex
+func Equal(a, b string) bool {
+	x, err := Parse(a)
+	if err != nil {
+		return false
+	}
+	y, err := Parse(b)
+	if err != nil {
+		return false
+	}
+	return string(x) == string(y)
+}
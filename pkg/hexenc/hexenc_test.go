@@ -0,0 +1,67 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package hexenc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPK = "8e80066551a81b318258709edaf7dd1f63cd686a0e4db8b29bbb7acfe65608677af5a527d9448ee47835485e02b50bc0"
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{testPK, "0x" + testPK, "0X" + strings.ToUpper(testPK), "  " + testPK + "\n"} {
+		pk, err := ParseValidatorPK(s)
+		require.NoError(t, err, s)
+		require.Equal(t, testPK, Key(pk))
+		require.Equal(t, "0x"+testPK, Format(pk))
+	}
+
+	_, err := ParseValidatorPK(testPK[:94])
+	require.EqualError(t, err, "validator pk has 47 bytes, expected 48")
+	_, err = ParseValidatorPK("")
+	require.EqualError(t, err, "validator pk is empty")
+	_, err = ParseWithdrawalCredentials("0x01zz")
+	require.Error(t, err)
+	_, err = ParseAddress("0x1d2f14d2dffee594b4093d42e4bc1b0ea55e8aa7")
+	require.NoError(t, err)
+}
+
+func TestRequestIDKey(t *testing.T) {
+	key, err := RequestIDKey("0x9A45C1F30A9896C5263508C2A132EBF7FC7E3C37AB86C74B")
+	require.NoError(t, err)
+	require.Equal(t, "9a45c1f30a9896c5263508c2a132ebf7fc7e3c37ab86c74b", key)
+	_, err = RequestIDKey("9a45c1f30a9896c5263508c2a132ebf7")
+	require.Error(t, err)
+
+	key, err = ValidatorPKKey("0x" + strings.ToUpper(testPK))
+	require.NoError(t, err)
+	require.Equal(t, testPK, key)
+}
+
+func TestEqual(t *testing.T) {
+	require.True(t, Equal(testPK, "0x"+strings.ToUpper(testPK)))
+	require.False(t, Equal(testPK, testPK[:94]))
+	require.False(t, Equal("zz", "zz"), "values that aren't hex are never equal")
+}
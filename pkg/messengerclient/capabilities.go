@@ -0,0 +1,108 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"context"
+	"net/http"
+)
+
+// ProtocolFROST is the keygen and resharing protocol of the nodes
+const ProtocolFROST = "frost"
+
+// Capabilities a node advertises when it registers with the messenger and in
+// its ack of a start message. Nodes older than capabilities advertise none.
+type Capabilities struct {
+	// Protocols are the keygen and resharing protocols the node runs
+	Protocols []string `json:"protocols"`
+	// ProtocolVersion is the newest protocol version the node speaks,
+	// MinProtocolVersion the oldest it still joins
+	ProtocolVersion    uint32 `json:"protocol_version"`
+	MinProtocolVersion uint32 `json:"min_protocol_version"`
+	// MaxCommittee bounds the operators of a ceremony, old and new committee
+	// and observers
+	MaxCommittee int  `json:"max_committee"`
+	Resharing    bool `json:"resharing"`
+	Keysign      bool `json:"keysign"`
+	// Observer reports whether the node joins ceremonies as observer
+	Observer bool `json:"observer"`
+	// Options are the ceremony options the node honors with their supported
+	// values, the first one is the default
+	Options map[string][]string `json:"options,omitempty"`
+	// Suites are the IDs of the crypto suites the node runs ceremonies with,
+	// nodes without any only run the default one
+	Suites []string `json:"suites,omitempty"`
+}
+
+// Supports reports whether the node runs protocol
+func (c *Capabilities) Supports(protocol string) bool {
+	for _, supported := range c.Protocols {
+		if supported == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsOption reports whether the node honors the ceremony option key set
+// to value
+func (c *Capabilities) SupportsOption(key, value string) bool {
+	for _, supported := range c.Options[key] {
+		if supported == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsSuite reports whether the node runs ceremonies with the crypto
+// suite id
+func (c *Capabilities) SupportsSuite(id string) bool {
+	for _, supported := range c.Suites {
+		if supported == id {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterOperatorNodeWith registers the node like RegisterOperatorNode,
+// along with its capabilities
+func (cl *Client) RegisterOperatorNodeWith(id, addr string, capabilities *Capabilities) error {
+	return cl.registerOperatorNode(&Subscriber{Name: id, SrvAddr: addr, Capabilities: capabilities})
+}
+
+// Capabilities of the registered nodes by operator id, nodes that registered
+// without any are left out
+func (cl *Client) Capabilities(ctx context.Context) (map[string]*Capabilities, error) {
+	topic := &Topic{}
+	if err := cl.do(ctx, http.MethodGet, "/topics/"+DefaultTopic, nil, nil, topic); err != nil {
+		return nil, err
+	}
+	capabilities := make(map[string]*Capabilities)
+	for name, subscriber := range topic.Subscribers {
+		if subscriber.Capabilities != nil {
+			capabilities[name] = subscriber.Capabilities
+		}
+	}
+	return capabilities, nil
+}
@@ -0,0 +1,538 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Client of a messenger, the zero value isn't usable, create it with New
+type Client struct {
+	SrvAddr string
+	// Token is sent as bearer token, the replication api of a messenger may require one
+	Token string
+	// MaxMessageBytes, when set, refuses to send larger request bodies instead
+	// of having the messenger turn them down
+	MaxMessageBytes int64
+	client          *http.Client
+	// session is set by WithSession
+	session *sessionState
+}
+
+// New returns a client of the messenger at srvAddr, the public RockX messenger
+// when empty
+func New(srvAddr string) *Client {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	if srvAddr == "" {
+		srvAddr = "https://dkg-messenger.rockx.com"
+	}
+
+	return &Client{
+		SrvAddr: srvAddr,
+		client:  &http.Client{Transport: tr},
+	}
+}
+
+// WithTransport sends the requests of the client through tr, e.g. to add
+// client certificates
+func (cl *Client) WithTransport(tr http.RoundTripper) *Client {
+	cl.client.Transport = tr
+	return cl
+}
+
+func (cl *Client) StreamDKGBlame(blame *dkg.BlameOutput) error {
+	return cl.StreamDKGBlameContext(context.Background(), blame)
+}
+
+func (cl *Client) StreamDKGBlameContext(ctx context.Context, blame *dkg.BlameOutput) error {
+	requestID := hex.EncodeToString(blame.BlameMessage.Message.Identifier[:])
+	data, err := json.Marshal(blame)
+	if err != nil {
+		return err
+	}
+
+	return cl.stream(ctx, "dkgblame", requestID, data)
+}
+
+func (cl *Client) StreamDKGOutput(output map[types.OperatorID]*dkg.SignedOutput) error {
+	return cl.StreamDKGOutputContext(context.Background(), output)
+}
+
+func (cl *Client) StreamDKGOutputContext(ctx context.Context, output map[types.OperatorID]*dkg.SignedOutput) error {
+	var requestID string
+
+	// assuming all signed output have same identifier. skipping validation here
+	for _, output := range output {
+		if output.Data != nil {
+			requestID = hex.EncodeToString(output.Data.RequestID[:])
+		} else if output.KeySignData != nil {
+			requestID = hex.EncodeToString(output.KeySignData.RequestID[:])
+		}
+	}
+
+	data, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+	return cl.stream(ctx, "dkgoutput", requestID, data)
+}
+
+func (cl *Client) BroadcastDKGMessage(msg *dkg.SignedMessage) error {
+	return cl.BroadcastDKGMessageContext(context.Background(), msg)
+}
+
+func (cl *Client) BroadcastDKGMessageContext(ctx context.Context, msg *dkg.SignedMessage) error {
+	requestID := hex.EncodeToString(msg.Message.Identifier[:])
+
+	msgBytes, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+	ssvMsg := types.SSVMessage{
+		MsgType: types.DKGMsgType,
+		Data:    msgBytes,
+	}
+	ssvMsgBytes, _ := ssvMsg.Encode()
+
+	return cl.Publish(ctx, requestID, ssvMsgBytes)
+}
+
+func (cl *Client) RegisterOperatorNode(id, addr string) error {
+	return cl.registerOperatorNode(&Subscriber{Name: id, SrvAddr: addr})
+}
+
+func (cl *Client) registerOperatorNode(sub *Subscriber) error {
+	numtries := 3
+	try := 1
+
+	errors := make([]error, 0)
+	for ; try <= numtries; try++ {
+		if err := cl.RegisterNode(context.Background(), DefaultTopic, sub); err != nil {
+			err := fmt.Errorf("failed to register operator of ID %s with the messenger on %d try: %w", sub.Name, try, err)
+			log.Printf("Error: %s\n", err.Error())
+			errors = append(errors, err)
+		} else {
+			break
+		}
+	}
+
+	if try > numtries {
+		return fmt.Errorf("failed to register this node even after %d tries with errors %+v", numtries, errors)
+	}
+	return nil
+}
+
+func (cl *Client) RegisterNode(ctx context.Context, topicName string, sub *Subscriber) error {
+	query := url.Values{"subscribes_to": []string{topicName}}
+	return cl.do(ctx, http.MethodPost, "/register_node", query, sub, nil)
+}
+
+func (cl *Client) Publish(ctx context.Context, topicName string, data []byte) error {
+	query := url.Values{"topic_name": []string{topicName}}
+	return cl.doRaw(ctx, http.MethodPost, "/publish", query, data, nil)
+}
+
+func (cl *Client) stream(ctx context.Context, urlparam string, requestID string, data []byte) error {
+	query := url.Values{"request_id": []string{requestID}}
+	return cl.doRaw(ctx, http.MethodPost, "/stream/"+urlparam, query, data, nil)
+}
+
+func (cl *Client) CreateTopic(requestID string, l []types.OperatorID) error {
+	return cl.CreateTopicContext(context.Background(), newTopicJSON(requestID, l))
+}
+
+// CreateCanaryTopic creates the topic of a canary keygen, whose result the
+// messenger marks as canary
+func (cl *Client) CreateCanaryTopic(requestID string, l []types.OperatorID) error {
+	topic := newTopicJSON(requestID, l)
+	topic.Canary = true
+	return cl.CreateTopicContext(context.Background(), topic)
+}
+
+// CreateUrgentTopic creates the topic of a time-sensitive ceremony, whose
+// messages the messenger relays ahead of the ones of other topics
+func (cl *Client) CreateUrgentTopic(requestID string, l []types.OperatorID) error {
+	topic := newTopicJSON(requestID, l)
+	topic.Urgent = true
+	return cl.CreateTopicContext(context.Background(), topic)
+}
+
+func newTopicJSON(requestID string, l []types.OperatorID) *TopicJSON {
+	topic := &TopicJSON{
+		TopicName:   requestID,
+		Subscribers: make([]string, 0),
+	}
+	for _, operatorID := range l {
+		topic.Subscribers = append(topic.Subscribers, strconv.Itoa(int(operatorID)))
+	}
+	return topic
+}
+
+func (cl *Client) CreateTopicContext(ctx context.Context, topic *TopicJSON) error {
+	return cl.do(ctx, http.MethodPost, "/topics", nil, topic, nil)
+}
+
+func (cl *Client) GetTopic(topicName string) (*Topic, error) {
+	return cl.GetTopicContext(context.Background(), topicName)
+}
+
+func (cl *Client) GetTopicContext(ctx context.Context, topicName string) (*Topic, error) {
+	topic := &Topic{}
+	if err := cl.do(ctx, http.MethodGet, "/topics/"+url.PathEscape(topicName), nil, nil, topic); err != nil {
+		return nil, err
+	}
+	return topic, nil
+}
+
+// SyncTopic returns the messages of the topic that aren't in have, the
+// hashes computed with MessageHash, leaving out the ones operatorID published
+func (cl *Client) SyncTopic(ctx context.Context, topicName string, operatorID types.OperatorID, have []string) (*SyncResponse, error) {
+	req := &SyncRequest{Operator: strconv.Itoa(int(operatorID)), Have: have}
+	resp := &SyncResponse{}
+	if err := cl.do(ctx, http.MethodPost, "/topics/"+url.PathEscape(topicName)+"/sync", nil, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// TopicOutputs returns the outputs published to the topic of a ceremony so
+// far, they arrive one operator at a time before the result is streamed
+func (cl *Client) TopicOutputs(ctx context.Context, topicName string) (*TopicOutputs, error) {
+	outputs := &TopicOutputs{}
+	if err := cl.do(ctx, http.MethodGet, "/topics/"+url.PathEscape(topicName)+"/outputs", nil, nil, outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// TopicOutputsAfter returns the outputs published to the topic except the
+// ones of the first after operators that published, ErrNotModified when
+// nothing changed since the response with etag
+func (cl *Client) TopicOutputsAfter(ctx context.Context, topicName string, after int, etag string) (*TopicOutputs, string, error) {
+	query := url.Values{}
+	if after > 0 {
+		query.Set("after", strconv.Itoa(after))
+	}
+	outputs := &TopicOutputs{}
+	etag, err := cl.getIfChanged(ctx, "/topics/"+url.PathEscape(topicName)+"/outputs", query, etag, outputs)
+	if err != nil {
+		return nil, "", err
+	}
+	return outputs, etag, nil
+}
+
+// TopicPartials returns the partial signatures published to the topic of a
+// keysign so far
+func (cl *Client) TopicPartials(ctx context.Context, topicName string) (*TopicPartials, error) {
+	partials := &TopicPartials{}
+	if err := cl.do(ctx, http.MethodGet, "/topics/"+url.PathEscape(topicName)+"/partials", nil, nil, partials); err != nil {
+		return nil, err
+	}
+	return partials, nil
+}
+
+// TopicProgress returns the stage each operator of a ceremony reached by the
+// messages it published to the topic
+func (cl *Client) TopicProgress(ctx context.Context, topicName string) (*TopicProgress, error) {
+	progress := &TopicProgress{}
+	if err := cl.do(ctx, http.MethodGet, "/topics/"+url.PathEscape(topicName)+"/progress", nil, nil, progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// PublishSealed relays the envelopes of a sealed start message to the
+// operators of the topic they are encrypted to
+func (cl *Client) PublishSealed(ctx context.Context, topicName string, sealed *SealedStart) error {
+	return cl.do(ctx, http.MethodPost, "/topics/"+url.PathEscape(topicName)+"/sealed", nil, sealed, nil)
+}
+
+// PublishStart relays a plain start message to the listed operators of the
+// topic, through the delivery and retries of the messenger
+func (cl *Client) PublishStart(ctx context.Context, topicName string, start *RelayedStart) error {
+	return cl.do(ctx, http.MethodPost, "/topics/"+url.PathEscape(topicName)+"/start", nil, start, nil)
+}
+
+func (cl *Client) GetTopics(ctx context.Context) (map[string]*Topic, error) {
+	topics := make(map[string]*Topic)
+	if err := cl.do(ctx, http.MethodGet, "/topics", nil, nil, &topics); err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
+func (cl *Client) DeleteTopic(ctx context.Context, topicName string) error {
+	return cl.do(ctx, http.MethodDelete, "/topics/"+url.PathEscape(topicName), nil, nil, nil)
+}
+
+func (cl *Client) GetData(ctx context.Context, requestID string) (*DataStore, error) {
+	data := &DataStore{}
+	if err := cl.do(ctx, http.MethodGet, "/data/"+url.PathEscape(requestID), nil, nil, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// PublicResult returns the published outputs of a ceremony from the public
+// endpoint of the messenger, which takes no credentials so delegators can
+// verify the ceremonies run for their stake
+func (cl *Client) PublicResult(ctx context.Context, requestID string) (*DataStore, error) {
+	data := &DataStore{}
+	if err := cl.do(ctx, http.MethodGet, PublicResultsPath+"/"+url.PathEscape(requestID), nil, nil, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetDataIfChanged returns the result of a ceremony like GetData,
+// ErrNotModified when it is still the one of the response with etag
+func (cl *Client) GetDataIfChanged(ctx context.Context, requestID, etag string) (*DataStore, string, error) {
+	data := &DataStore{}
+	etag, err := cl.getIfChanged(ctx, "/data/"+url.PathEscape(requestID), nil, etag, data)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, etag, nil
+}
+
+// DataOutputs returns a page of the outputs in the result of a ceremony, a
+// limit of zero takes the page size of the messenger
+func (cl *Client) DataOutputs(ctx context.Context, requestID string, offset, limit int) (*OutputPage, error) {
+	page := &OutputPage{}
+	if err := cl.do(ctx, http.MethodGet, "/data/"+url.PathEscape(requestID)+"/outputs", pageQuery(offset, limit), nil, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// DataBlames returns a page of the blames in the result of a ceremony
+func (cl *Client) DataBlames(ctx context.Context, requestID string, offset, limit int) (*BlamePage, error) {
+	page := &BlamePage{}
+	if err := cl.do(ctx, http.MethodGet, "/data/"+url.PathEscape(requestID)+"/blames", pageQuery(offset, limit), nil, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func pageQuery(offset, limit int) url.Values {
+	query := url.Values{}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	return query
+}
+
+// ReplicationChanges returns the changes of a primary messenger after seq,
+// waiting up to wait for new ones when there are none
+func (cl *Client) ReplicationChanges(ctx context.Context, after uint64, wait time.Duration) (*ChangesResponse, error) {
+	query := url.Values{"after": []string{strconv.FormatUint(after, 10)}}
+	if wait > 0 {
+		query.Set("wait", wait.String())
+	}
+	resp := &ChangesResponse{}
+	if err := cl.do(ctx, http.MethodGet, "/replication/changes", query, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (cl *Client) ReplicationSnapshot(ctx context.Context) (*ReplicationSnapshot, error) {
+	snapshot := &ReplicationSnapshot{}
+	if err := cl.do(ctx, http.MethodGet, "/replication/snapshot", nil, nil, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (cl *Client) ReplicationStatus(ctx context.Context) (*ReplicationStatus, error) {
+	status := &ReplicationStatus{}
+	if err := cl.do(ctx, http.MethodGet, "/replication/status", nil, nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Limits returns the limits the messenger advertises, nil for a messenger
+// that doesn't advertise any. Limits left at zero aren't advertised either.
+func (cl *Client) Limits(ctx context.Context) (*Limits, error) {
+	limits := &Limits{}
+	if err := cl.do(ctx, http.MethodGet, "/limits", nil, nil, limits); err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return limits, nil
+}
+
+func (cl *Client) Version(ctx context.Context) (string, error) {
+	resp := &VersionResponse{}
+	if err := cl.do(ctx, http.MethodGet, "/version", nil, nil, resp); err != nil {
+		return "", err
+	}
+	return resp.Version, nil
+}
+
+func (cl *Client) Ping(ctx context.Context) error {
+	return cl.do(ctx, http.MethodGet, "/ping", nil, nil, &PingResponse{})
+}
+
+// do sends in as a json body and decodes the response body into out when out is not nil
+func (cl *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body []byte
+	if in != nil {
+		byts, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body for %s %s: %w", method, path, err)
+		}
+		body = byts
+	}
+	return cl.doRaw(ctx, method, path, query, body, out)
+}
+
+// doRaw sends the writes with the session token when the client has a
+// session, and once more with a new session when the messenger refused it
+func (cl *Client) doRaw(ctx context.Context, method, path string, query url.Values, body []byte, out any) error {
+	if cl.session == nil || method == http.MethodGet || path == SessionPath || path == SessionChallengePath {
+		return cl.send(ctx, method, path, query, body, out, "")
+	}
+	token, err := cl.sessionToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = cl.send(ctx, method, path, query, body, out, token)
+	if token != "" && IsInvalidSession(err) {
+		cl.dropSession(token)
+		if token, err = cl.sessionToken(ctx); err != nil {
+			return err
+		}
+		err = cl.send(ctx, method, path, query, body, out, token)
+	}
+	return err
+}
+
+func (cl *Client) send(ctx context.Context, method, path string, query url.Values, body []byte, out any, sessionToken string) error {
+	header := make(http.Header)
+	if sessionToken != "" {
+		header.Set(SessionHeader, sessionToken)
+	}
+	_, err := cl.exchange(ctx, method, path, query, body, header, out)
+	return err
+}
+
+// getIfChanged gets path like do, unless etag is still current: then the
+// messenger answers 304, out is left alone and ErrNotModified is returned.
+// It returns the etag of the response.
+func (cl *Client) getIfChanged(ctx context.Context, path string, query url.Values, etag string, out any) (string, error) {
+	header := make(http.Header)
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	respHeader, err := cl.exchange(ctx, http.MethodGet, path, query, nil, header, out)
+	if err != nil {
+		return "", err
+	}
+	return respHeader.Get("ETag"), nil
+}
+
+func (cl *Client) exchange(ctx context.Context, method, path string, query url.Values, body []byte, header http.Header, out any) (http.Header, error) {
+	endpoint := cl.SrvAddr + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		if cl.MaxMessageBytes > 0 && int64(len(body)) > cl.MaxMessageBytes {
+			return nil, fmt.Errorf("%s %s: %w", method, path, &ErrLimitExceeded{Limit: "message bytes", Value: int64(len(body)), Max: cl.MaxMessageBytes})
+		}
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cl.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cl.Token)
+	}
+
+	resp, err := cl.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to messenger: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		return resp.Header, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiResp := &APIResponse{}
+		_ = json.Unmarshal(respBody, apiResp)
+		return nil, &ErrUnexpectedStatus{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    apiResp.Message,
+			Code:       apiResp.Code,
+		}
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return resp.Header, nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return nil, fmt.Errorf("failed to parse response from %s %s: %w", method, path, err)
+	}
+	return resp.Header, nil
+}
@@ -0,0 +1,71 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPublish(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/publish", r.URL.Path)
+		require.Equal(t, "abcd", r.URL.Query().Get("topic_name"))
+		body, _ := io.ReadAll(r.Body)
+		require.Equal(t, `{"k":"v"}`, string(body))
+		_ = json.NewEncoder(w).Encode(&APIResponse{Message: "ok"})
+	}))
+	defer srv.Close()
+
+	cl := New(srv.URL)
+	require.NoError(t, cl.Publish(context.Background(), "abcd", []byte(`{"k":"v"}`)))
+}
+
+func TestClientErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(&APIResponse{Message: "topic missing doesn't exist"})
+	}))
+	defer srv.Close()
+
+	cl := New(srv.URL)
+	_, err := cl.GetData(context.Background(), "missing")
+	require.Error(t, err)
+	require.True(t, IsNotFound(err))
+	require.Contains(t, err.Error(), "topic missing doesn't exist")
+}
+
+func TestClientLimitsNotAdvertised(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	limits, err := New(srv.URL).Limits(context.Background())
+	require.NoError(t, err)
+	require.Nil(t, limits)
+}
@@ -0,0 +1,30 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+// Package messengerclient speaks to the dkg messenger: topics of ceremonies,
+// publishing and syncing their messages, results, limits and replication.
+// The client also implements the dkg.Network of the ssv-spec dkg node.
+//
+// The package is part of the public api of the repository. Its exported names
+// and the wire types, which mirror openapi.json of the messenger, follow
+// semantic versioning with the release tags: a minor release only adds, a
+// change that breaks callers or the wire format needs a new major version.
+package messengerclient
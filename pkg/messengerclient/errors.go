@@ -0,0 +1,74 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNotModified is returned by the conditional gets when the messenger still
+// has what the client fetched before
+var ErrNotModified = errors.New("not modified")
+
+type ErrUnexpectedStatus struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+	// Code tells apart refusals of the same status, e.g. invalid_session
+	Code string
+}
+
+func (err *ErrUnexpectedStatus) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("messenger request %s %s failed with status %d", err.Method, err.Path, err.StatusCode)
+	}
+	return fmt.Sprintf("messenger request %s %s failed with status %d: %s", err.Method, err.Path, err.StatusCode, err.Message)
+}
+
+// ErrLimitExceeded is returned when a ceremony or a request is larger than a limit allows
+type ErrLimitExceeded struct {
+	Limit string
+	Value int64
+	Max   int64
+}
+
+func (err *ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("%s %d exceeds the limit of %d", err.Limit, err.Value, err.Max)
+}
+
+func IsNotFound(err error) bool {
+	statusErr, ok := err.(*ErrUnexpectedStatus)
+	return ok && statusErr.StatusCode == http.StatusNotFound
+}
+
+// IsLimitExceeded reports whether a request was over the limits of the
+// messenger, refused by it with 413 or before sending by the client
+func IsLimitExceeded(err error) bool {
+	if statusErr, ok := err.(*ErrUnexpectedStatus); ok && statusErr.StatusCode == http.StatusRequestEntityTooLarge {
+		return true
+	}
+	var limitErr *ErrLimitExceeded
+	return errors.As(err, &limitErr)
+}
@@ -0,0 +1,160 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of a delivery the messenger pushes to a node. The relay signature
+// covers the recipient, the topic, the node path, the timestamp and the body,
+// a node checks it to tell deliveries of its messenger from direct posts.
+const (
+	RelaySignatureHeader = "X-DKG-Relay-Signature"
+	RelayTimestampHeader = "X-DKG-Relay-Timestamp"
+	RelayTopicHeader     = "X-DKG-Relay-Topic"
+
+	// RelayKeyPath is where the messenger publishes its relay public key
+	RelayKeyPath = "/relay_key"
+
+	// DefaultRelayMaxAge is how old a delivery may be before a node refuses it
+	DefaultRelayMaxAge = 5 * time.Minute
+)
+
+const relayDomain = "rockx-dkg-relay-v1"
+
+var (
+	ErrRelayUnsigned  = errors.New("delivery isn't signed by the messenger")
+	ErrRelaySignature = errors.New("invalid relay signature")
+	ErrRelayExpired   = errors.New("relay timestamp outside the accepted window")
+)
+
+// RelayKey is the public key the messenger signs its deliveries with
+type RelayKey struct {
+	// PublicKey is the base64 encoded ed25519 public key
+	PublicKey string `json:"public_key"`
+}
+
+// Delivery is what a relay signature covers
+type Delivery struct {
+	// Recipient is the subscriber name of the node, its operator id
+	Recipient string
+	Topic     string
+	Path      string
+	Timestamp time.Time
+	Body      []byte
+}
+
+// digest is the sha256 over the domain and the length prefixed fields of the
+// delivery, the body by its own sha256
+func (d *Delivery) digest() []byte {
+	h := sha256.New()
+	bodyHash := sha256.Sum256(d.Body)
+	for _, field := range [][]byte{
+		[]byte(relayDomain),
+		[]byte(d.Recipient),
+		[]byte(d.Topic),
+		[]byte(d.Path),
+		[]byte(strconv.FormatInt(d.Timestamp.Unix(), 10)),
+		bodyHash[:],
+	} {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	return h.Sum(nil)
+}
+
+// SignDelivery sets the relay headers of req, a delivery of body to recipient
+func SignDelivery(req *http.Request, key ed25519.PrivateKey, recipient, topic string, body []byte, now time.Time) {
+	delivery := &Delivery{Recipient: recipient, Topic: topic, Path: req.URL.Path, Timestamp: now, Body: body}
+	signature := ed25519.Sign(key, delivery.digest())
+	req.Header.Set(RelaySignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	req.Header.Set(RelayTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(RelayTopicHeader, topic)
+}
+
+// VerifyDelivery checks the relay headers of a delivery of body to recipient
+// against keys, any of them may have signed it. maxAge bounds the difference
+// between the relay timestamp and now in either direction.
+func VerifyDelivery(header http.Header, path, recipient string, body []byte, keys []ed25519.PublicKey, now time.Time, maxAge time.Duration) error {
+	encoded := header.Get(RelaySignatureHeader)
+	if encoded == "" {
+		return ErrRelayUnsigned
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrRelaySignature, err.Error())
+	}
+	unix, err := strconv.ParseInt(header.Get(RelayTimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp", ErrRelaySignature)
+	}
+	timestamp := time.Unix(unix, 0)
+	if age := now.Sub(timestamp); age > maxAge || age < -maxAge {
+		return fmt.Errorf("%w: %s", ErrRelayExpired, timestamp.UTC().Format(time.RFC3339))
+	}
+
+	delivery := &Delivery{Recipient: recipient, Topic: header.Get(RelayTopicHeader), Path: path, Timestamp: timestamp, Body: body}
+	digest := delivery.digest()
+	for _, key := range keys {
+		if ed25519.Verify(key, digest, signature) {
+			return nil
+		}
+	}
+	return ErrRelaySignature
+}
+
+// ParseRelayKey decodes a base64 encoded ed25519 public key
+func ParseRelayKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid relay key: %d bytes instead of %d", len(key), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// RelayKey returns the public key the messenger signs its deliveries with,
+// nil for a messenger that doesn't sign them
+func (cl *Client) RelayKey(ctx context.Context) (ed25519.PublicKey, error) {
+	resp := &RelayKey{}
+	if err := cl.do(ctx, http.MethodGet, RelayKeyPath, nil, nil, resp); err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return ParseRelayKey(resp.PublicKey)
+}
@@ -0,0 +1,80 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelaySignature(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPK, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	now := time.Now()
+	body := []byte("message")
+
+	req, err := http.NewRequest(http.MethodPost, "http://node/consume", bytes.NewReader(body))
+	require.NoError(t, err)
+	SignDelivery(req, sk, "1", "aa", body, now)
+
+	require.NoError(t, VerifyDelivery(req.Header, "/consume", "1", body, []ed25519.PublicKey{otherPK, pk}, now, DefaultRelayMaxAge))
+	require.ErrorIs(t, VerifyDelivery(req.Header, "/consume", "1", body, []ed25519.PublicKey{otherPK}, now, DefaultRelayMaxAge), ErrRelaySignature)
+	require.ErrorIs(t, VerifyDelivery(req.Header, "/consume", "2", body, []ed25519.PublicKey{pk}, now, DefaultRelayMaxAge), ErrRelaySignature, "delivery replayed to another node")
+	require.ErrorIs(t, VerifyDelivery(req.Header, SealedStartPath, "1", body, []ed25519.PublicKey{pk}, now, DefaultRelayMaxAge), ErrRelaySignature, "delivery replayed to another path")
+	require.ErrorIs(t, VerifyDelivery(req.Header, "/consume", "1", []byte("other"), []ed25519.PublicKey{pk}, now, DefaultRelayMaxAge), ErrRelaySignature)
+	require.ErrorIs(t, VerifyDelivery(req.Header, "/consume", "1", body, []ed25519.PublicKey{pk}, now.Add(10*time.Minute), DefaultRelayMaxAge), ErrRelayExpired)
+	require.ErrorIs(t, VerifyDelivery(http.Header{}, "/consume", "1", body, []ed25519.PublicKey{pk}, now, DefaultRelayMaxAge), ErrRelayUnsigned)
+
+	req.Header.Set(RelayTopicHeader, "bb")
+	require.ErrorIs(t, VerifyDelivery(req.Header, "/consume", "1", body, []ed25519.PublicKey{pk}, now, DefaultRelayMaxAge), ErrRelaySignature)
+}
+
+func TestClientRelayKey(t *testing.T) {
+	pk, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, RelayKeyPath, r.URL.Path)
+		_ = json.NewEncoder(w).Encode(&RelayKey{PublicKey: base64.StdEncoding.EncodeToString(pk)})
+	}))
+	defer srv.Close()
+
+	key, err := New(srv.URL).RelayKey(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, pk, key)
+
+	unsigned := httptest.NewServer(http.NotFoundHandler())
+	defer unsigned.Close()
+	key, err = New(unsigned.URL).RelayKey(context.Background())
+	require.NoError(t, err)
+	require.Nil(t, key)
+}
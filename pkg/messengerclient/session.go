@@ -0,0 +1,188 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Nodes open a session with the messenger by signing a challenge with their
+// operator key, and send its token on every publish, stream and registration
+// so the messenger knows which operator is calling.
+const (
+	SessionHeader = "X-DKG-Session"
+
+	SessionChallengePath = "/sessions/challenge"
+	SessionPath          = "/sessions"
+
+	// CodeInvalidSession is the code of the 401 the messenger answers a
+	// missing, unknown or expired session token with
+	CodeInvalidSession = "invalid_session"
+)
+
+const sessionDomain = "rockx-dkg-session-v1"
+
+// sessionRenewBefore renews a session that expires sooner, so a request never
+// goes out with a token about to expire
+const sessionRenewBefore = time.Minute
+
+// SessionChallengeRequest asks the messenger for a challenge to sign
+type SessionChallengeRequest struct {
+	Operator string `json:"operator"`
+}
+
+// SessionChallenge is the nonce an operator signs to open a session, it can
+// be used once before it expires
+type SessionChallenge struct {
+	Operator  string `json:"operator"`
+	Challenge string `json:"challenge"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// SessionRequest opens a session with the signed challenge
+type SessionRequest struct {
+	Operator  string `json:"operator"`
+	Challenge string `json:"challenge"`
+	// Signature over SessionRoot with the operator key, hex encoded
+	Signature string `json:"signature"`
+}
+
+// Session is a short lived token the messenger maps to an operator
+type Session struct {
+	Token     string `json:"token"`
+	Operator  string `json:"operator"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// SessionRoot is what an operator signs to open a session, the domain, its
+// operator id and the challenge
+func SessionRoot(operator types.OperatorID, challenge []byte) []byte {
+	root := append([]byte{}, sessionDomain...)
+	root = binary.BigEndian.AppendUint64(root, uint64(operator))
+	return append(root, challenge...)
+}
+
+// SignSessionChallenge signs the challenge with the operator key
+func SignSessionChallenge(sk *rsa.PrivateKey, challenge *SessionChallenge) (*SessionRequest, error) {
+	operator, err := strconv.ParseUint(challenge.Operator, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid operator %q: %w", challenge.Operator, err)
+	}
+	nonce, err := hex.DecodeString(challenge.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid challenge encoding: %w", err)
+	}
+	signature, err := types.Sign(sk, SessionRoot(types.OperatorID(operator), nonce))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign session challenge: %w", err)
+	}
+	return &SessionRequest{Operator: challenge.Operator, Challenge: challenge.Challenge, Signature: hex.EncodeToString(signature)}, nil
+}
+
+// IsInvalidSession reports whether the messenger refused the session token
+func IsInvalidSession(err error) bool {
+	statusErr, ok := err.(*ErrUnexpectedStatus)
+	return ok && statusErr.StatusCode == http.StatusUnauthorized && statusErr.Code == CodeInvalidSession
+}
+
+type sessionState struct {
+	operator types.OperatorID
+	key      *rsa.PrivateKey
+
+	mu      sync.Mutex
+	current *Session
+	// unsupported is set once the messenger answered 404, it predates sessions
+	unsupported bool
+}
+
+// WithSession has the client open a session as operator, signing the
+// challenge with key, and send its token on every write, like publishes,
+// streams and registrations. The session is
+// renewed before it expires and when the messenger forgot it, e.g. after a
+// restart or a failover.
+func (cl *Client) WithSession(operator types.OperatorID, key *rsa.PrivateKey) *Client {
+	cl.session = &sessionState{operator: operator, key: key}
+	return cl
+}
+
+// OpenSession signs a new challenge of the messenger with the operator key
+func (cl *Client) OpenSession(ctx context.Context, operator types.OperatorID, key *rsa.PrivateKey) (*Session, error) {
+	challenge := &SessionChallenge{}
+	req := &SessionChallengeRequest{Operator: strconv.FormatUint(uint64(operator), 10)}
+	if err := cl.do(ctx, http.MethodPost, SessionChallengePath, nil, req, challenge); err != nil {
+		return nil, err
+	}
+	signed, err := SignSessionChallenge(key, challenge)
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{}
+	if err := cl.do(ctx, http.MethodPost, SessionPath, nil, signed, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// sessionToken returns the token of the current session, opening a new one
+// when there is none or it is about to expire. It is empty for a messenger
+// without sessions.
+func (cl *Client) sessionToken(ctx context.Context) (string, error) {
+	s := cl.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unsupported {
+		return "", nil
+	}
+	if s.current != nil && time.Until(time.Unix(s.current.ExpiresAt, 0)) > sessionRenewBefore {
+		return s.current.Token, nil
+	}
+	session, err := cl.OpenSession(ctx, s.operator, s.key)
+	if IsNotFound(err) {
+		s.unsupported = true
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open messenger session: %w", err)
+	}
+	s.current = session
+	return session.Token, nil
+}
+
+// dropSession forgets the token the messenger refused
+func (cl *Client) dropSession(token string) {
+	s := cl.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && s.current.Token == token {
+		s.current = nil
+	}
+}
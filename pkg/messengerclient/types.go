@@ -0,0 +1,319 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/RockX-SG/frost-dkg-demo/pkg/artifacts"
+	"github.com/bloxapp/ssv-spec/dkg"
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+const (
+	// DefaultTopic is the topic every operator node subscribes to
+	DefaultTopic = "default"
+
+	// SealedStartPath is the node endpoint sealed start messages are relayed to
+	SealedStartPath = "/consume/sealed"
+
+	// RelayedStartPath is the node endpoint plain start messages are relayed
+	// to, for committees only reachable through the messenger
+	RelayedStartPath = "/consume/relayed"
+)
+
+// Operations of the replication log, each changes the state a standby has to
+// mirror to take over in-flight ceremonies
+const (
+	OpRegisterNode  = "register_node"
+	OpCreateTopic   = "create_topic"
+	OpDeleteTopic   = "delete_topic"
+	OpPublish       = "publish"
+	OpResult        = "result"
+	OpAddWebhook    = "add_webhook"
+	OpDeleteWebhook = "delete_webhook"
+)
+
+const (
+	RolePrimary = "primary"
+	RoleStandby = "standby"
+)
+
+// MessageHash identifies a published message in sync requests. It is the
+// first 8 bytes of the sha256 of the message in hex, enough to tell apart the
+// messages of one topic at a quarter of the size of the full hash.
+func MessageHash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:8])
+}
+
+// APIResponse is the generic body returned by the messenger for write
+// operations and failures. It mirrors the "ApiResponse" schema in openapi.json.
+type APIResponse struct {
+	Message string `json:"message"`
+	Error   string `json:"error"`
+	Code    string `json:"code,omitempty"`
+}
+
+type VersionResponse struct {
+	Version string `json:"version"`
+}
+
+type PingResponse struct {
+	Message string `json:"message"`
+}
+
+// Subscriber is an operator node registered with the messenger
+type Subscriber struct {
+	Name    string `json:"name"`
+	SrvAddr string `json:"srv_addr"`
+	// Capabilities the node advertised when it registered
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+}
+
+type Topic struct {
+	Name        string
+	Subscribers map[string]*Subscriber
+	// Canary topics carry canary keygens, their results are marked as such
+	Canary bool `json:",omitempty"`
+	// Urgent topics carry time-sensitive ceremonies, their messages are
+	// relayed ahead of the ones of other topics
+	Urgent bool `json:",omitempty"`
+}
+
+type TopicJSON struct {
+	TopicName   string   `json:"topic_name"`
+	Subscribers []string `json:"subscribers"`
+	Canary      bool     `json:"canary,omitempty"`
+	Urgent      bool     `json:"urgent,omitempty"`
+}
+
+// DataStore is the result of a ceremony, the outputs of the operators or a blame
+// PublicResultsPath is where the messenger serves the outputs of finished
+// ceremonies without authentication
+const PublicResultsPath = "/public/results"
+
+type DataStore struct {
+	DKGOutputs  map[types.OperatorID]*dkg.SignedOutput
+	BlameOutput *dkg.BlameOutput
+	// Canary results come from a canary keygen and never back a validator
+	Canary bool `json:",omitempty"`
+}
+
+// TopicOutputs are the outputs the operators of a ceremony have published to
+// its topic so far, before the messenger has the full result
+type TopicOutputs struct {
+	// Operators subscribed to the topic
+	Operators []string                               `json:"operators"`
+	Outputs   map[types.OperatorID]*dkg.SignedOutput `json:"outputs"`
+	// Total is how many operators published an output, Outputs leaves out
+	// the ones before the after the outputs were asked with
+	Total int `json:"total"`
+}
+
+// OutputPage is a page of the outputs in the result of a ceremony, ordered
+// by operator id
+type OutputPage struct {
+	Outputs []*dkg.SignedOutput `json:"outputs"`
+	Offset  int                 `json:"offset"`
+	Total   int                 `json:"total"`
+	// Next is the offset of the next page, zero on the last one
+	Next   int  `json:"next,omitempty"`
+	Canary bool `json:"canary,omitempty"`
+}
+
+// BlamePage is a page of the blames in the result of a ceremony
+type BlamePage struct {
+	Blames []*dkg.BlameOutput `json:"blames"`
+	Offset int                `json:"offset"`
+	Total  int                `json:"total"`
+	// Next is the offset of the next page, zero on the last one
+	Next int `json:"next,omitempty"`
+}
+
+// TopicPartials are the partial signatures the operators of a keysign have
+// published to its topic so far, the cli recovers the signature from any
+// threshold of them when the keysign doesn't finish
+type TopicPartials struct {
+	// Operators subscribed to the topic
+	Operators []string                    `json:"operators"`
+	Partials  map[types.OperatorID][]byte `json:"partials"`
+}
+
+// ProgressStage is how far an operator got in a ceremony, by the last
+// protocol round it published to the topic
+type ProgressStage string
+
+const (
+	// StageInitReceived is an operator that took the start message and
+	// published its preparation
+	StageInitReceived ProgressStage = "init_received"
+	StageRound1       ProgressStage = "round1"
+	StageRound2       ProgressStage = "round2"
+	// StageOutput is an operator that published its output
+	StageOutput ProgressStage = "output"
+)
+
+// ProgressStages are the stages of a ceremony in the order operators reach them
+var ProgressStages = []ProgressStage{StageInitReceived, StageRound1, StageRound2, StageOutput}
+
+// Index is the position of the stage in ProgressStages, -1 for an operator
+// that published nothing yet
+func (s ProgressStage) Index() int {
+	for i, stage := range ProgressStages {
+		if stage == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// TopicProgress is the stage each operator of a ceremony reached, operators
+// that published nothing to the topic yet have none
+type TopicProgress struct {
+	// Operators subscribed to the topic
+	Operators []string                           `json:"operators"`
+	Stages    map[types.OperatorID]ProgressStage `json:"stages"`
+}
+
+// SyncRequest lists the hashes of the topic messages a node already has
+type SyncRequest struct {
+	Operator string   `json:"operator"`
+	Have     []string `json:"have"`
+}
+
+type SyncResponse struct {
+	// Messages are the ssv messages of the topic missing on the node, as published
+	Messages [][]byte `json:"messages"`
+	// Total is the number of messages the messenger keeps for the topic
+	Total int `json:"total"`
+	// More is set when more messages are missing than fit one response, the
+	// node syncs again with the hashes of these messages added
+	More bool `json:"more,omitempty"`
+}
+
+// HistoryMessage is a message kept for catch-up, as replicated to a standby
+type HistoryMessage struct {
+	Signer string `json:"signer"`
+	Data   []byte `json:"data"`
+}
+
+// SealedStart is a ceremony start message encrypted to each operator of the
+// topic, keyed by operator id. The messenger routes the envelopes to the
+// subscribers without being able to read the ceremony parameters.
+type SealedStart struct {
+	Envelopes map[string]*artifacts.Envelope `json:"envelopes"`
+}
+
+// SealedDelivery is what a node receives on SealedStartPath, its own envelope
+// of a sealed start message
+type SealedDelivery struct {
+	Topic    string              `json:"topic"`
+	Envelope *artifacts.Envelope `json:"envelope"`
+}
+
+// RelayedStart is a ceremony start message the messenger relays in plain to
+// the listed operators of the topic, with the query the initiator would post
+// it to /consume with
+type RelayedStart struct {
+	Operators []string `json:"operators"`
+	Message   []byte   `json:"message"`
+	Query     string   `json:"query,omitempty"`
+}
+
+// RelayedDelivery is what a node receives on RelayedStartPath
+type RelayedDelivery struct {
+	Topic   string `json:"topic"`
+	Message []byte `json:"message"`
+	Query   string `json:"query,omitempty"`
+}
+
+// Change is one mutation of the messenger state
+type Change struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+
+	Topic       string      `json:"topic,omitempty"`
+	Subscriber  *Subscriber `json:"subscriber,omitempty"`
+	Subscribers []string    `json:"subscribers,omitempty"`
+	Canary      bool        `json:"canary,omitempty"`
+	Urgent      bool        `json:"urgent,omitempty"`
+	Signer      string      `json:"signer,omitempty"`
+	Data        []byte      `json:"data,omitempty"`
+	RequestID   string      `json:"request_id,omitempty"`
+	Result      *DataStore  `json:"result,omitempty"`
+	Webhook     *Webhook    `json:"webhook,omitempty"`
+}
+
+// ChangesResponse are the changes after the sequence number a standby asked
+// for, along with the latest change of the primary to tell the lag
+type ChangesResponse struct {
+	Changes  []*Change `json:"changes"`
+	Head     uint64    `json:"head"`
+	HeadTime time.Time `json:"head_time"`
+}
+
+// ReplicationSnapshot is the whole state of a primary as of change Seq. Changes
+// after Seq may already show in it, replaying them on top leads to the same state.
+type ReplicationSnapshot struct {
+	Seq    uint64                `json:"seq"`
+	Time   time.Time             `json:"time"`
+	Topics []*TopicSnapshot      `json:"topics"`
+	Data   map[string]*DataStore `json:"data"`
+}
+
+type TopicSnapshot struct {
+	Name        string            `json:"name"`
+	Subscribers []*Subscriber     `json:"subscribers"`
+	Canary      bool              `json:"canary,omitempty"`
+	Urgent      bool              `json:"urgent,omitempty"`
+	History     []*HistoryMessage `json:"history"`
+	Webhooks    []*Webhook        `json:"webhooks,omitempty"`
+}
+
+// ReplicationStatus is the replication state of a messenger
+type ReplicationStatus struct {
+	// Role is primary or standby
+	Role    string `json:"role"`
+	Primary string `json:"primary,omitempty"`
+	// AppliedSeq is the last change applied, on a primary the last change logged
+	AppliedSeq uint64 `json:"applied_seq"`
+	PrimarySeq uint64 `json:"primary_seq"`
+	LagChanges uint64 `json:"lag_changes"`
+	// LagSeconds is how much older the last applied change is than the latest change of the primary
+	LagSeconds  float64    `json:"lag_seconds"`
+	LastContact *time.Time `json:"last_contact,omitempty"`
+	PromotedAt  *time.Time `json:"promoted_at,omitempty"`
+}
+
+// Limits are the limits a messenger advertises on GET /limits
+type Limits struct {
+	// MaxOperators bounds the operators taking part in a ceremony
+	MaxOperators int `json:"max_operators"`
+	// MaxMessageBytes bounds a request body
+	MaxMessageBytes int64 `json:"max_message_bytes"`
+	// MaxBatchSize bounds the items of a list in one request or response
+	MaxBatchSize int `json:"max_batch_size"`
+}
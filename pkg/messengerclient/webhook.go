@@ -0,0 +1,184 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloxapp/ssv-spec/types"
+)
+
+// Events a webhook is notified of
+const (
+	// WebhookProgress is sent for every message an operator publishes on the topic
+	WebhookProgress = "progress"
+	// WebhookOutput is sent when the outputs of the ceremony arrived
+	WebhookOutput = "output"
+	// WebhookBlame is sent when an operator of the ceremony was blamed
+	WebhookBlame = "blame"
+)
+
+// WebhookEvents are the events a webhook can be registered for
+var WebhookEvents = []string{WebhookProgress, WebhookOutput, WebhookBlame}
+
+// Headers of a webhook notification. The signature is the hex HMAC-SHA256,
+// keyed with the webhook secret, of the timestamp, a dot and the body.
+const (
+	WebhookEventHeader     = "X-DKG-Event"
+	WebhookTimestampHeader = "X-DKG-Timestamp"
+	WebhookSignatureHeader = "X-DKG-Signature"
+	// WebhookSecretHeader carries the webhook secret to delete a webhook
+	WebhookSecretHeader = "X-DKG-Webhook-Secret"
+)
+
+// Webhook is an endpoint of an external system, e.g. a portfolio system,
+// notified of the progress and result of the ceremony of a topic without
+// polling the messenger or subscribing as an operator
+type Webhook struct {
+	ID  string `json:"id,omitempty"`
+	URL string `json:"url"`
+	// Events the webhook is notified of, every one when empty
+	Events []string `json:"events,omitempty"`
+	// Secret keys the signatures of the notifications. The messenger picks
+	// one when it is registered without, and only returns it then.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Wants reports whether the webhook is notified of event
+func (w *Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the url and the events of a webhook to register
+func (w *Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook url %q isn't an http or https url", w.URL)
+	}
+	for _, event := range w.Events {
+		known := false
+		for _, e := range WebhookEvents {
+			known = known || e == event
+		}
+		if !known {
+			return fmt.Errorf("unknown webhook event %q, one of %s", event, strings.Join(WebhookEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// WebhookNotification is the body posted to a webhook
+type WebhookNotification struct {
+	Event     string    `json:"event"`
+	Topic     string    `json:"topic"`
+	RequestID string    `json:"request_id"`
+	Time      time.Time `json:"time"`
+	// Operator published the message of a progress notification
+	Operator types.OperatorID `json:"operator,omitempty"`
+	// Messages is the number of messages kept for the topic so far
+	Messages int `json:"messages,omitempty"`
+	// ValidatorPK and Operators of an output notification
+	ValidatorPK string             `json:"validator_pk,omitempty"`
+	Operators   []types.OperatorID `json:"operators,omitempty"`
+	// Cause and Culprit of a blame notification
+	Cause   string           `json:"cause,omitempty"`
+	Culprit types.OperatorID `json:"culprit,omitempty"`
+}
+
+// SignWebhook returns the signature of a notification body sent at timestamp
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature headers of a notification, receivers
+// refuse notifications older than maxAge so a captured one can't be replayed
+func VerifyWebhook(secret string, header http.Header, body []byte, maxAge time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header", WebhookTimestampHeader)
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); maxAge > 0 && (age > maxAge || age < -maxAge) {
+		return fmt.Errorf("notification sent %s ago, older than %s", age.Round(time.Second), maxAge)
+	}
+	signature, err := hex.DecodeString(header.Get(WebhookSignatureHeader))
+	if err != nil {
+		return fmt.Errorf("invalid %s header", WebhookSignatureHeader)
+	}
+	expected, _ := hex.DecodeString(SignWebhook(secret, timestamp, body))
+	if !hmac.Equal(signature, expected) {
+		return errors.New("invalid webhook signature")
+	}
+	return nil
+}
+
+func webhooksPath(topicName string) string {
+	return "/topics/" + url.PathEscape(topicName) + "/webhooks"
+}
+
+// RegisterWebhook registers the webhook on the topic, the returned webhook
+// has its id and secret
+func (cl *Client) RegisterWebhook(ctx context.Context, topicName string, webhook *Webhook) (*Webhook, error) {
+	registered := &Webhook{}
+	if err := cl.do(ctx, http.MethodPost, webhooksPath(topicName), nil, webhook, registered); err != nil {
+		return nil, err
+	}
+	return registered, nil
+}
+
+// Webhooks lists the webhooks of the topic, without their secrets
+func (cl *Client) Webhooks(ctx context.Context, topicName string) ([]*Webhook, error) {
+	webhooks := make([]*Webhook, 0)
+	if err := cl.do(ctx, http.MethodGet, webhooksPath(topicName), nil, nil, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes the webhook from the topic, proven with its secret
+func (cl *Client) DeleteWebhook(ctx context.Context, topicName, id, secret string) error {
+	header := make(http.Header)
+	header.Set(WebhookSecretHeader, secret)
+	_, err := cl.exchange(ctx, http.MethodDelete, webhooksPath(topicName)+"/"+url.PathEscape(id), nil, nil, header, nil)
+	return err
+}
@@ -0,0 +1,59 @@
+/*
+ * ==================================================================
+ *Copyright (C) 2022-2023 Altstake Technology Pte. Ltd. (RockX)
+ *This file is part of rockx-dkg-cli <https://github.com/RockX-SG/rockx-dkg-cli>
+ *CAUTION: THESE CODES HAVE NOT BEEN AUDITED
+ *
+ *rockx-dkg-cli is free software: you can redistribute it and/or modify
+ *it under the terms of the GNU General Public License as published by
+ *the Free Software Foundation, either version 3 of the License, or
+ *(at your option) any later version.
+ *
+ *rockx-dkg-cli is distributed in the hope that it will be useful,
+ *but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *GNU General Public License for more details.
+ *
+ *You should have received a copy of the GNU General Public License
+ *along with rockx-dkg-cli. If not, see <http://www.gnu.org/licenses/>.
+ *==================================================================
+ */
+
+package messengerclient
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"event":"output"}`)
+	sent := time.Now().Unix()
+	header := http.Header{}
+	header.Set(WebhookTimestampHeader, strconv.FormatInt(sent, 10))
+	header.Set(WebhookSignatureHeader, SignWebhook("secret", sent, body))
+
+	require.NoError(t, VerifyWebhook("secret", header, body, time.Minute))
+	require.Error(t, VerifyWebhook("other", header, body, time.Minute))
+	require.Error(t, VerifyWebhook("secret", header, []byte(`{"event":"blame"}`), time.Minute))
+
+	// the timestamp is signed, so an old notification can't be passed as new
+	old := time.Now().Add(-time.Hour).Unix()
+	header.Set(WebhookTimestampHeader, strconv.FormatInt(old, 10))
+	require.Error(t, VerifyWebhook("secret", header, body, time.Minute))
+	header.Set(WebhookSignatureHeader, SignWebhook("secret", old, body))
+	require.Error(t, VerifyWebhook("secret", header, body, time.Minute))
+	require.NoError(t, VerifyWebhook("secret", header, body, 0), "no max age")
+}
+
+func TestWebhookValidate(t *testing.T) {
+	require.NoError(t, (&Webhook{URL: "https://example.com/hook", Events: []string{WebhookBlame}}).Validate())
+	require.Error(t, (&Webhook{URL: "ftp://example.com/hook"}).Validate())
+	require.Error(t, (&Webhook{URL: "https://example.com/hook", Events: []string{"done"}}).Validate())
+	require.True(t, (&Webhook{}).Wants(WebhookProgress))
+	require.False(t, (&Webhook{Events: []string{WebhookOutput}}).Wants(WebhookProgress))
+}